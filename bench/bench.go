@@ -0,0 +1,173 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+// Package bench is the standard suite of benchmarks of the interpreter:
+// representative workloads written in WebAssembly, for the performance
+// regressions of the execution to be caught and its optimizations to be
+// measured.
+//
+// Every workload runs a call of an export of its module, whose result is
+// checked before it is timed. Besides the time and the allocations of a
+// call, the benchmarks report the throughput of the workloads processing
+// a buffer, in MB/s, and the number of instructions the interpreter runs
+// per second, in Minstr/s, counted once with fuel, see exec.VM.SetFuel.
+//
+// The workloads run as benchmarks of go test:
+//
+//	go test -run NONE -bench . -benchmem ./bench
+//
+// or from another program with Run.
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wat"
+)
+
+// InputOffset is the offset in memory of the input of a workload.
+const InputOffset = 4096
+
+// Workload is a benchmark of the interpreter: a call of an export of a
+// module, which exports its memory as "memory".
+type Workload struct {
+	Name string
+	// Source is the module, in the text format.
+	Source string
+	// Input, if any, is written to the memory at InputOffset once the
+	// module is instantiated, and Bytes is the number of bytes a call
+	// processes.
+	Input []byte
+	Bytes int64
+	// Export is the function called with Args.
+	Export string
+	Args   []uint64
+	// Check returns an error if the results of a call, or the memory it
+	// leaves, are wrong.
+	Check func(results []uint64, memory []byte) error
+}
+
+// Result is the result of a workload run by Run.
+type Result struct {
+	Workload string
+	// Instructions is the number of instructions a call runs.
+	Instructions uint64
+	testing.BenchmarkResult
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%-10s %s %s", r.Workload, r.BenchmarkResult.String(), r.MemString())
+}
+
+// Run checks and benchmarks the workloads with VMs using config, and
+// returns their results in order.
+func Run(workloads []*Workload, config exec.VMConfig) ([]Result, error) {
+	var results []Result
+	for _, w := range workloads {
+		instructions, err := w.Verify(config)
+		if err != nil {
+			return nil, err
+		}
+		res := testing.Benchmark(func(b *testing.B) { w.Benchmark(b, config) })
+		results = append(results, Result{Workload: w.Name, Instructions: instructions, BenchmarkResult: res})
+	}
+	return results, nil
+}
+
+// instantiate returns a VM of a new instance of the module of w, using
+// config, and the index of its export.
+func (w *Workload) instantiate(config exec.VMConfig) (*exec.VM, int64, error) {
+	code, err := wat.Assemble([]byte(w.Source))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", w.Name, err)
+	}
+	module, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", w.Name, err)
+	}
+	compiled, err := exec.CompileModule(module, config)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", w.Name, err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", w.Name, err)
+	}
+	fn, ok := inst.ExportedFunction(w.Export)
+	if !ok {
+		return nil, 0, fmt.Errorf("%s: no exported function %q", w.Name, w.Export)
+	}
+	vm := inst.NewVM()
+	copy(vm.Memory()[InputOffset:], w.Input)
+	return vm, int64(fn.Index), nil
+}
+
+// call calls the export of w on vm, returning its trap as an error.
+func (w *Workload) call(vm *exec.VM, fnIndex int64) (results []uint64, err error) {
+	defer exec.RecoverTrap(&err)
+	return vm.ExecCodeValues(fnIndex, w.Args...)
+}
+
+// Verify runs a call of w with a VM using config, and returns the number
+// of instructions it ran, or the error failing it or its check.
+func (w *Workload) Verify(config exec.VMConfig) (uint64, error) {
+	vm, fn, err := w.instantiate(config)
+	if err != nil {
+		return 0, err
+	}
+	defer vm.Close()
+	vm.SetFuel(math.MaxUint64)
+	results, err := w.call(vm, fn)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", w.Name, err)
+	}
+	if err := w.Check(results, vm.Memory()); err != nil {
+		return 0, fmt.Errorf("%s: %v", w.Name, err)
+	}
+	return vm.FuelUsed(), nil
+}
+
+// Benchmark runs b.N calls of w with VMs using config, once checked, on a
+// single instance.
+func (w *Workload) Benchmark(b *testing.B, config exec.VMConfig) {
+	instructions, err := w.Verify(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	vm, fn, err := w.instantiate(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer vm.Close()
+
+	b.SetBytes(w.Bytes)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := w.call(vm, fn); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if elapsed := b.Elapsed(); elapsed > 0 {
+		b.ReportMetric(float64(instructions)*float64(b.N)/elapsed.Seconds()/1e6, "Minstr/s")
+	}
+}
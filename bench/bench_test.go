@@ -0,0 +1,72 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package bench
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+)
+
+// configs are the configurations the workloads are benchmarked with.
+var configs = []struct {
+	name   string
+	config exec.VMConfig
+}{
+	{"interp", exec.VMConfig{}},
+	{"aot", exec.VMConfig{AOT: true}},
+}
+
+func TestWorkloads(t *testing.T) {
+	for _, c := range configs {
+		for _, w := range Workloads {
+			instructions, err := w.Verify(c.config)
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+				continue
+			}
+			if instructions == 0 {
+				t.Errorf("%s: %s: no instructions counted", c.name, w.Name)
+			}
+		}
+	}
+
+	// the Keccak-256 of no bytes
+	vm, fn, err := Keccak.instantiate(exec.VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if _, err := vm.ExecCodeValues(fn, InputOffset, 0); err != nil {
+		t.Fatal(err)
+	}
+	const empty = "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"
+	if hash := fmt.Sprintf("%x", vm.Memory()[:32]); hash != empty {
+		t.Errorf("keccak of no bytes: got=%s, want=%s", hash, empty)
+	}
+}
+
+func BenchmarkWorkloads(b *testing.B) {
+	for _, c := range configs {
+		for _, w := range Workloads {
+			b.Run(c.name+"/"+w.Name, func(b *testing.B) {
+				w.Benchmark(b, c.config)
+			})
+		}
+	}
+}
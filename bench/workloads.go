@@ -0,0 +1,489 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package bench
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+)
+
+// Workloads are the workloads of the suite.
+var Workloads = []*Workload{Fib, Keccak, JSON, Memcpy, Dispatch}
+
+// Fib computes the 24th Fibonacci number recursively, for the cost of the
+// direct calls and of the branches.
+var Fib = &Workload{
+	Name: "fib",
+	Source: `(module
+  (memory (export "memory") 1)
+  (func $fib (export "fib") (param $n i32) (result i32)
+    (if (result i32) (i32.lt_u (local.get $n) (i32.const 2))
+      (then (local.get $n))
+      (else (i32.add
+        (call $fib (i32.sub (local.get $n) (i32.const 1)))
+        (call $fib (i32.sub (local.get $n) (i32.const 2))))))))`,
+	Export: "fib",
+	Args:   []uint64{24},
+	Check: func(results []uint64, memory []byte) error {
+		return checkResult(results, 46368)
+	},
+}
+
+// keccakInput is the input hashed by Keccak, and keccakHash its hash.
+var (
+	keccakInput = pattern(16384)
+	keccakHash  = "3218ec5c03cc0adb11e9527f34277e92897f5b2d9ecd8d6df2f026e28686fc32"
+)
+
+// Keccak hashes 16 KiB with Keccak-256, for the cost of the 64-bit
+// arithmetic and of the loads and stores.
+var Keccak = &Workload{
+	Name: "keccak",
+	Source: `(module
+  (memory (export "memory") 1)
+  ;; the state is at 0, the parities of its columns at 200, and the last
+  ;; block, once padded, at 256; the round constants are at 512, and the
+  ;; rotations and the lanes of the rho and pi steps at 768 and 800
+  (data (i32.const 512) "\01\00\00\00\00\00\00\00\82\80\00\00\00\00\00\00\8a\80\00\00\00\00\00\80\00\80\00\80\00\00\00\80\8b\80\00\00\00\00\00\00\01\00\00\80\00\00\00\00\81\80\00\80\00\00\00\80\09\80\00\00\00\00\00\80\8a\00\00\00\00\00\00\00\88\00\00\00\00\00\00\00\09\80\00\80\00\00\00\00\0a\00\00\80\00\00\00\00\8b\80\00\80\00\00\00\00\8b\00\00\00\00\00\00\80\89\80\00\00\00\00\00\80\03\80\00\00\00\00\00\80\02\80\00\00\00\00\00\80\80\00\00\00\00\00\00\80\0a\80\00\00\00\00\00\00\0a\00\00\80\00\00\00\80\81\80\00\80\00\00\00\80\80\80\00\00\00\00\00\80\01\00\00\80\00\00\00\00\08\80\00\80\00\00\00\80")
+  (data (i32.const 768) "\01\03\06\0a\0f\15\1c\24\2d\37\02\0e\1b\29\38\08\19\2b\3e\12\27\3d\14\2c")
+  (data (i32.const 800) "\0a\07\0b\11\12\03\05\10\08\15\18\04\0f\17\13\0d\0c\02\14\0e\16\09\06\01")
+  (func $keccakf
+    (local $round i32) (local $x i32) (local $y i32) (local $t i32) (local $j i32)
+    (local $d i64) (local $cur i64) (local $tmp i64)
+    (loop $rounds
+      ;; theta
+      (local.set $x (i32.const 0))
+      (loop $parity
+        (local.set $j (i32.shl (local.get $x) (i32.const 3)))
+        (i64.store offset=200 (local.get $j)
+          (i64.xor
+            (i64.xor
+              (i64.xor (i64.load (local.get $j)) (i64.load offset=40 (local.get $j)))
+              (i64.xor (i64.load offset=80 (local.get $j)) (i64.load offset=120 (local.get $j))))
+            (i64.load offset=160 (local.get $j))))
+        (br_if $parity (i32.lt_u (local.tee $x (i32.add (local.get $x) (i32.const 1))) (i32.const 5))))
+      (local.set $x (i32.const 0))
+      (loop $columns
+        (local.set $d
+          (i64.xor
+            (i64.load offset=200 (i32.shl (i32.rem_u (i32.add (local.get $x) (i32.const 4)) (i32.const 5)) (i32.const 3)))
+            (i64.rotl
+              (i64.load offset=200 (i32.shl (i32.rem_u (i32.add (local.get $x) (i32.const 1)) (i32.const 5)) (i32.const 3)))
+              (i64.const 1))))
+        (local.set $y (i32.const 0))
+        (loop $lanes
+          (local.set $j (i32.add (i32.shl (local.get $x) (i32.const 3)) (i32.mul (local.get $y) (i32.const 40))))
+          (i64.store (local.get $j) (i64.xor (i64.load (local.get $j)) (local.get $d)))
+          (br_if $lanes (i32.lt_u (local.tee $y (i32.add (local.get $y) (i32.const 1))) (i32.const 5))))
+        (br_if $columns (i32.lt_u (local.tee $x (i32.add (local.get $x) (i32.const 1))) (i32.const 5))))
+      ;; rho and pi
+      (local.set $cur (i64.load offset=8 (i32.const 0)))
+      (local.set $t (i32.const 0))
+      (loop $rhopi
+        (local.set $j (i32.shl (i32.load8_u offset=800 (local.get $t)) (i32.const 3)))
+        (local.set $tmp (i64.load (local.get $j)))
+        (i64.store (local.get $j)
+          (i64.rotl (local.get $cur) (i64.extend_i32_u (i32.load8_u offset=768 (local.get $t)))))
+        (local.set $cur (local.get $tmp))
+        (br_if $rhopi (i32.lt_u (local.tee $t (i32.add (local.get $t) (i32.const 1))) (i32.const 24))))
+      ;; chi
+      (local.set $y (i32.const 0))
+      (loop $rows
+        (local.set $x (i32.const 0))
+        (loop $copy
+          (i64.store offset=200 (i32.shl (local.get $x) (i32.const 3))
+            (i64.load (i32.add (i32.mul (local.get $y) (i32.const 40)) (i32.shl (local.get $x) (i32.const 3)))))
+          (br_if $copy (i32.lt_u (local.tee $x (i32.add (local.get $x) (i32.const 1))) (i32.const 5))))
+        (local.set $x (i32.const 0))
+        (loop $chi
+          (i64.store (i32.add (i32.mul (local.get $y) (i32.const 40)) (i32.shl (local.get $x) (i32.const 3)))
+            (i64.xor
+              (i64.load offset=200 (i32.shl (local.get $x) (i32.const 3)))
+              (i64.and
+                (i64.xor
+                  (i64.load offset=200 (i32.shl (i32.rem_u (i32.add (local.get $x) (i32.const 1)) (i32.const 5)) (i32.const 3)))
+                  (i64.const -1))
+                (i64.load offset=200 (i32.shl (i32.rem_u (i32.add (local.get $x) (i32.const 2)) (i32.const 5)) (i32.const 3))))))
+          (br_if $chi (i32.lt_u (local.tee $x (i32.add (local.get $x) (i32.const 1))) (i32.const 5))))
+        (br_if $rows (i32.lt_u (local.tee $y (i32.add (local.get $y) (i32.const 1))) (i32.const 5))))
+      ;; iota
+      (i64.store (i32.const 0)
+        (i64.xor (i64.load (i32.const 0)) (i64.load offset=512 (i32.shl (local.get $round) (i32.const 3)))))
+      (br_if $rounds (i32.lt_u (local.tee $round (i32.add (local.get $round) (i32.const 1))) (i32.const 24)))))
+  ;; absorb xors the block of 136 bytes at $p into the state, and permutes it
+  (func $absorb (param $p i32)
+    (local $i i32)
+    (loop $lanes
+      (i64.store (local.get $i)
+        (i64.xor (i64.load (local.get $i)) (i64.load (i32.add (local.get $p) (local.get $i)))))
+      (br_if $lanes (i32.lt_u (local.tee $i (i32.add (local.get $i) (i32.const 8))) (i32.const 136))))
+    (call $keccakf))
+  ;; keccak hashes the $n bytes at $p, leaving the hash at 0
+  (func (export "keccak") (param $p i32) (param $n i32)
+    (memory.fill (i32.const 0) (i32.const 0) (i32.const 200))
+    (block $last
+      (loop $blocks
+        (br_if $last (i32.lt_u (local.get $n) (i32.const 136)))
+        (call $absorb (local.get $p))
+        (local.set $p (i32.add (local.get $p) (i32.const 136)))
+        (local.set $n (i32.sub (local.get $n) (i32.const 136)))
+        (br $blocks)))
+    (memory.fill (i32.const 256) (i32.const 0) (i32.const 136))
+    (memory.copy (i32.const 256) (local.get $p) (local.get $n))
+    (i32.store8 offset=256 (local.get $n) (i32.xor (i32.load8_u offset=256 (local.get $n)) (i32.const 0x01)))
+    (i32.store8 offset=391 (i32.const 0) (i32.xor (i32.load8_u offset=391 (i32.const 0)) (i32.const 0x80)))
+    (call $absorb (i32.const 256))))`,
+	Input:  keccakInput,
+	Bytes:  int64(len(keccakInput)),
+	Export: "keccak",
+	Args:   []uint64{InputOffset, uint64(len(keccakInput))},
+	Check: func(results []uint64, memory []byte) error {
+		if hash := hex.EncodeToString(memory[:32]); hash != keccakHash {
+			return fmt.Errorf("hash %s, want %s", hash, keccakHash)
+		}
+		return nil
+	},
+}
+
+// jsonInput is the document parsed by JSON.
+var jsonInput = jsonDocument(200)
+
+// JSON parses a JSON document of 40 KiB or so and counts its values, for
+// the cost of the byte loads, of the branches and of the recursion.
+var JSON = &Workload{
+	Name: "json",
+	Source: `(module
+  (memory (export "memory") 1)
+  (global $end (mut i32) (i32.const 0))
+  (global $count (mut i32) (i32.const 0))
+  (data (i32.const 16) "true")
+  (data (i32.const 24) "false")
+  (data (i32.const 32) "null")
+  ;; peek returns the byte at $p, or -1 at the end of the document
+  (func $peek (param $p i32) (result i32)
+    (if (result i32) (i32.lt_u (local.get $p) (global.get $end))
+      (then (i32.load8_u (local.get $p)))
+      (else (i32.const -1))))
+  ;; space skips the white space at $p
+  (func $space (param $p i32) (result i32)
+    (local $c i32)
+    (block $done
+      (loop $bytes
+        (local.set $c (call $peek (local.get $p)))
+        (br_if $done
+          (i32.eqz
+            (i32.or
+              (i32.or (i32.eq (local.get $c) (i32.const 0x20)) (i32.eq (local.get $c) (i32.const 0x0a)))
+              (i32.or (i32.eq (local.get $c) (i32.const 0x0d)) (i32.eq (local.get $c) (i32.const 0x09))))))
+        (local.set $p (i32.add (local.get $p) (i32.const 1)))
+        (br $bytes)))
+    (local.get $p))
+  ;; the parsers of the values at $p return the offset following them, or
+  ;; -1 for a syntax error
+  (func $literal (param $p i32) (param $lit i32) (param $n i32) (result i32)
+    (local $i i32)
+    (block $done
+      (loop $bytes
+        (br_if $done (i32.ge_u (local.get $i) (local.get $n)))
+        (if (i32.ne (call $peek (i32.add (local.get $p) (local.get $i)))
+                    (i32.load8_u (i32.add (local.get $lit) (local.get $i))))
+          (then (return (i32.const -1))))
+        (local.set $i (i32.add (local.get $i) (i32.const 1)))
+        (br $bytes)))
+    (i32.add (local.get $p) (local.get $n)))
+  (func $string (param $p i32) (result i32)
+    (local $c i32)
+    (local.set $p (i32.add (local.get $p) (i32.const 1)))
+    (loop $bytes
+      (local.set $c (call $peek (local.get $p)))
+      (if (i32.eq (local.get $c) (i32.const 0x22))
+        (then (return (i32.add (local.get $p) (i32.const 1)))))
+      (if (i32.lt_s (local.get $c) (i32.const 0x20))
+        (then (return (i32.const -1))))
+      (if (i32.eq (local.get $c) (i32.const 0x5c))
+        (then (local.set $p (i32.add (local.get $p) (i32.const 1)))))
+      (local.set $p (i32.add (local.get $p) (i32.const 1)))
+      (br $bytes))
+    (i32.const -1))
+  (func $digits (param $p i32) (result i32)
+    (local $start i32)
+    (local.set $start (local.get $p))
+    (block $done
+      (loop $bytes
+        (br_if $done (i32.gt_u (i32.sub (call $peek (local.get $p)) (i32.const 0x30)) (i32.const 9)))
+        (local.set $p (i32.add (local.get $p) (i32.const 1)))
+        (br $bytes)))
+    (if (result i32) (i32.eq (local.get $p) (local.get $start))
+      (then (i32.const -1))
+      (else (local.get $p))))
+  (func $number (param $p i32) (result i32)
+    (local $c i32)
+    (if (i32.eq (call $peek (local.get $p)) (i32.const 0x2d))
+      (then (local.set $p (i32.add (local.get $p) (i32.const 1)))))
+    (local.set $p (call $digits (local.get $p)))
+    (if (i32.lt_s (local.get $p) (i32.const 0)) (then (return (i32.const -1))))
+    (if (i32.eq (call $peek (local.get $p)) (i32.const 0x2e))
+      (then
+        (local.set $p (call $digits (i32.add (local.get $p) (i32.const 1))))
+        (if (i32.lt_s (local.get $p) (i32.const 0)) (then (return (i32.const -1))))))
+    (local.set $c (i32.or (call $peek (local.get $p)) (i32.const 0x20)))
+    (if (i32.eq (local.get $c) (i32.const 0x65))
+      (then
+        (local.set $p (i32.add (local.get $p) (i32.const 1)))
+        (local.set $c (call $peek (local.get $p)))
+        (if (i32.or (i32.eq (local.get $c) (i32.const 0x2b)) (i32.eq (local.get $c) (i32.const 0x2d)))
+          (then (local.set $p (i32.add (local.get $p) (i32.const 1)))))
+        (local.set $p (call $digits (local.get $p)))))
+    (local.get $p))
+  (func $array (param $p i32) (result i32)
+    (local $c i32)
+    (local.set $p (call $space (i32.add (local.get $p) (i32.const 1))))
+    (if (i32.eq (call $peek (local.get $p)) (i32.const 0x5d))
+      (then (return (i32.add (local.get $p) (i32.const 1)))))
+    (loop $elements
+      (local.set $p (call $value (local.get $p)))
+      (if (i32.lt_s (local.get $p) (i32.const 0)) (then (return (i32.const -1))))
+      (local.set $p (call $space (local.get $p)))
+      (local.set $c (call $peek (local.get $p)))
+      (local.set $p (i32.add (local.get $p) (i32.const 1)))
+      (br_if $elements (i32.eq (local.get $c) (i32.const 0x2c)))
+      (if (i32.eq (local.get $c) (i32.const 0x5d)) (then (return (local.get $p)))))
+    (i32.const -1))
+  (func $object (param $p i32) (result i32)
+    (local $c i32)
+    (local.set $p (call $space (i32.add (local.get $p) (i32.const 1))))
+    (if (i32.eq (call $peek (local.get $p)) (i32.const 0x7d))
+      (then (return (i32.add (local.get $p) (i32.const 1)))))
+    (loop $members
+      (local.set $p (call $space (local.get $p)))
+      (if (i32.ne (call $peek (local.get $p)) (i32.const 0x22)) (then (return (i32.const -1))))
+      (local.set $p (call $space (call $string (local.get $p))))
+      (if (i32.ne (call $peek (local.get $p)) (i32.const 0x3a)) (then (return (i32.const -1))))
+      (local.set $p (call $value (i32.add (local.get $p) (i32.const 1))))
+      (if (i32.lt_s (local.get $p) (i32.const 0)) (then (return (i32.const -1))))
+      (local.set $p (call $space (local.get $p)))
+      (local.set $c (call $peek (local.get $p)))
+      (local.set $p (i32.add (local.get $p) (i32.const 1)))
+      (br_if $members (i32.eq (local.get $c) (i32.const 0x2c)))
+      (if (i32.eq (local.get $c) (i32.const 0x7d)) (then (return (local.get $p)))))
+    (i32.const -1))
+  (func $value (param $p i32) (result i32)
+    (local $c i32)
+    (local.set $p (call $space (local.get $p)))
+    (local.set $c (call $peek (local.get $p)))
+    (global.set $count (i32.add (global.get $count) (i32.const 1)))
+    (if (i32.eq (local.get $c) (i32.const 0x7b)) (then (return (call $object (local.get $p)))))
+    (if (i32.eq (local.get $c) (i32.const 0x5b)) (then (return (call $array (local.get $p)))))
+    (if (i32.eq (local.get $c) (i32.const 0x22)) (then (return (call $string (local.get $p)))))
+    (if (i32.eq (local.get $c) (i32.const 0x74)) (then (return (call $literal (local.get $p) (i32.const 16) (i32.const 4)))))
+    (if (i32.eq (local.get $c) (i32.const 0x66)) (then (return (call $literal (local.get $p) (i32.const 24) (i32.const 5)))))
+    (if (i32.eq (local.get $c) (i32.const 0x6e)) (then (return (call $literal (local.get $p) (i32.const 32) (i32.const 4)))))
+    (call $number (local.get $p)))
+  ;; parse parses the document of $n bytes at $p, and returns the number of
+  ;; its values, or -1 for a syntax error
+  (func (export "parse") (param $p i32) (param $n i32) (result i32)
+    (global.set $end (i32.add (local.get $p) (local.get $n)))
+    (global.set $count (i32.const 0))
+    (local.set $p (call $value (local.get $p)))
+    (if (i32.lt_s (local.get $p) (i32.const 0)) (then (return (i32.const -1))))
+    (if (i32.ne (call $space (local.get $p)) (global.get $end)) (then (return (i32.const -1))))
+    (global.get $count)))`,
+	Input:  jsonInput,
+	Bytes:  int64(len(jsonInput)),
+	Export: "parse",
+	Args:   []uint64{InputOffset, uint64(len(jsonInput))},
+	Check: func(results []uint64, memory []byte) error {
+		var doc interface{}
+		if err := json.Unmarshal(jsonInput, &doc); err != nil {
+			return err
+		}
+		return checkResult(results, uint64(countValues(doc)))
+	},
+}
+
+// memcpyLength is the number of bytes copied by Memcpy, to memcpyDst.
+const (
+	memcpyLength = 16384
+	memcpyDst    = 32768
+)
+
+// Memcpy copies 16 KiB with a loop of 64-bit loads and stores, then of
+// byte ones, for the cost of the memory accesses and of their bounds
+// checks.
+var Memcpy = &Workload{
+	Name: "memcpy",
+	Source: `(module
+  (memory (export "memory") 1)
+  (func (export "memcpy") (param $dst i32) (param $src i32) (param $n i32)
+    (local $end i32)
+    (local.set $end (i32.add (local.get $src) (i32.and (local.get $n) (i32.const -8))))
+    (block $words
+      (loop $copy
+        (br_if $words (i32.ge_u (local.get $src) (local.get $end)))
+        (i64.store (local.get $dst) (i64.load (local.get $src)))
+        (local.set $dst (i32.add (local.get $dst) (i32.const 8)))
+        (local.set $src (i32.add (local.get $src) (i32.const 8)))
+        (br $copy)))
+    (local.set $end (i32.add (local.get $src) (i32.and (local.get $n) (i32.const 7))))
+    (block $bytes
+      (loop $copy
+        (br_if $bytes (i32.ge_u (local.get $src) (local.get $end)))
+        (i32.store8 (local.get $dst) (i32.load8_u (local.get $src)))
+        (local.set $dst (i32.add (local.get $dst) (i32.const 1)))
+        (local.set $src (i32.add (local.get $src) (i32.const 1)))
+        (br $copy)))))`,
+	Input:  pattern(memcpyLength + 5),
+	Bytes:  memcpyLength + 5,
+	Export: "memcpy",
+	Args:   []uint64{memcpyDst, InputOffset, memcpyLength + 5},
+	Check: func(results []uint64, memory []byte) error {
+		if !bytes.Equal(memory[memcpyDst:memcpyDst+memcpyLength+5], pattern(memcpyLength+5)) {
+			return fmt.Errorf("copy differs from the input")
+		}
+		return nil
+	},
+}
+
+// dispatchCalls is the number of indirect calls of Dispatch.
+const dispatchCalls = 10000
+
+// Dispatch makes 10000 indirect calls of 8 small functions, some of them
+// calling another one, for the cost of call_indirect and of the frames.
+var Dispatch = &Workload{
+	Name: "dispatch",
+	Source: `(module
+  (memory (export "memory") 1)
+  (type $op (func (param i32 i32) (result i32)))
+  (table 8 funcref)
+  (elem (i32.const 0) $add $xor $mul $sub $rotl $double $mix $nested)
+  (func $add (type $op) (i32.add (local.get 0) (local.get 1)))
+  (func $xor (type $op) (i32.xor (local.get 0) (local.get 1)))
+  (func $mul (type $op) (i32.mul (local.get 0) (i32.or (local.get 1) (i32.const 1))))
+  (func $sub (type $op) (i32.sub (local.get 0) (local.get 1)))
+  (func $rotl (type $op) (i32.rotl (local.get 0) (local.get 1)))
+  (func $double (type $op) (i32.add (local.get 0) (i32.shl (local.get 1) (i32.const 1))))
+  (func $mix (type $op) (i32.xor (local.get 0) (i32.mul (local.get 1) (i32.const 0x9e3779b9))))
+  (func $scale (param i32) (result i32) (i32.add (i32.mul (local.get 0) (i32.const 5)) (i32.const 1)))
+  (func $nested (type $op) (i32.add (call $scale (local.get 0)) (local.get 1)))
+  (func (export "dispatch") (param $n i32) (result i32)
+    (local $i i32) (local $acc i32)
+    (block $done
+      (loop $calls
+        (br_if $done (i32.ge_u (local.get $i) (local.get $n)))
+        (local.set $acc
+          (call_indirect (type $op) (local.get $acc) (local.get $i) (i32.and (local.get $i) (i32.const 7))))
+        (local.set $i (i32.add (local.get $i) (i32.const 1)))
+        (br $calls)))
+    (local.get $acc)))`,
+	Export: "dispatch",
+	Args:   []uint64{dispatchCalls},
+	Check: func(results []uint64, memory []byte) error {
+		return checkResult(results, uint64(dispatch(dispatchCalls)))
+	},
+}
+
+// dispatch returns the result of Dispatch making n calls.
+func dispatch(n uint32) uint32 {
+	var acc uint32
+	for i := uint32(0); i < n; i++ {
+		switch i & 7 {
+		case 0:
+			acc += i
+		case 1:
+			acc ^= i
+		case 2:
+			acc *= i | 1
+		case 3:
+			acc -= i
+		case 4:
+			acc = bits.RotateLeft32(acc, int(i&31))
+		case 5:
+			acc += i << 1
+		case 6:
+			acc ^= i * 0x9e3779b9
+		case 7:
+			acc = acc*5 + 1 + i
+		}
+	}
+	return acc
+}
+
+// checkResult returns an error unless results are the single value want.
+func checkResult(results []uint64, want uint64) error {
+	if len(results) != 1 || uint32(results[0]) != uint32(want) {
+		return fmt.Errorf("results %v, want %d", results, want)
+	}
+	return nil
+}
+
+// pattern returns n bytes of input.
+func pattern(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*31 + 7)
+	}
+	return b
+}
+
+// jsonDocument returns a JSON document of n records.
+func jsonDocument(n int) []byte {
+	type record struct {
+		ID     int               `json:"id"`
+		Name   string            `json:"name"`
+		Tags   []string          `json:"tags"`
+		Price  float64           `json:"price"`
+		Active bool              `json:"active"`
+		Parent *int              `json:"parent"`
+		Attrs  map[string]string `json:"attrs"`
+	}
+	records := make([]record, n)
+	for i := range records {
+		records[i] = record{
+			ID:     i,
+			Name:   fmt.Sprintf("item \"%d\"", i),
+			Tags:   []string{"a", "b\n", fmt.Sprint(i % 7)},
+			Price:  float64(i) * 1.25e-3,
+			Active: i%2 == 0,
+			Attrs:  map[string]string{"color": "red", "size": "xl"},
+		}
+	}
+	doc, err := json.MarshalIndent(map[string]interface{}{"records": records, "count": n}, "", " ")
+	if err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+// countValues returns the number of values of the decoded JSON value v,
+// itself included.
+func countValues(v interface{}) int {
+	n := 1
+	switch v := v.(type) {
+	case []interface{}:
+		for _, e := range v {
+			n += countValues(e)
+		}
+	case map[string]interface{}:
+		for _, e := range v {
+			n += countValues(e)
+		}
+	}
+	return n
+}
@@ -0,0 +1,513 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package bindgen generates Go packages wrapping the exported functions of
+// a module in typed methods, and the host and guest bindings of interfaces
+// of host functions, see the wasmbindgen command.
+package bindgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+	"unicode"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// ABISection is the name of the custom section holding the JSON ABI of a
+// module, see exec.ParseJSONABI.
+const ABISection = "abi"
+
+// Options are the options of Generate.
+type Options struct {
+	Package string // The name of the generated package
+	Source  string // The name of the module file, mentioned in the generated code
+	// ABI describes the exports taking or returning strings and byte
+	// slices. If nil, the ABI is read from the ABISection of the module,
+	// if any.
+	ABI *exec.JSONABI
+}
+
+// UnsupportedTypeError is returned by Generate for a method of the ABI
+// using a type the generated code can't marshal.
+type UnsupportedTypeError struct {
+	Method string
+	Kind   exec.ABIKind
+}
+
+func (e UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("bindgen: %s: unsupported ABI type kind %d", e.Method, e.Kind)
+}
+
+// SignatureError is returned by Generate for a method of the ABI whose
+// types don't match the signature of the function it calls.
+type SignatureError string
+
+func (e SignatureError) Error() string {
+	return fmt.Sprintf("bindgen: %s: the ABI doesn't match the signature of the export", string(e))
+}
+
+// Generate returns the source of a Go package wrapping a VM of module in a
+// Module type with a method calling every exported function.
+//
+// The methods of the exports described by the ABI take and return the Go
+// values of their types, the strings and the byte slices (lists of u8)
+// being passed as their address and length in the linear memory, and
+// returned as the address of their address and length, like
+// exec.CallJSON. The other exports take and return uint32, uint64,
+// float32 and float64 values, and the ones using v128 or references are
+// left out.
+func Generate(module *wasm.Module, opts Options) ([]byte, error) {
+	abi := opts.ABI
+	if abi == nil {
+		if payload, ok := module.CustomSection(ABISection); ok {
+			var err error
+			if abi, err = exec.ParseJSONABI(payload); err != nil {
+				return nil, err
+			}
+		}
+	}
+	methods := make(map[string]exec.JSONMethod)
+	if abi != nil {
+		for _, m := range abi.Methods() {
+			methods[m.Export] = m
+		}
+	}
+
+	g := &generator{names: make(map[string]bool)}
+	g.printf("%s", prelude)
+	if module.Export != nil {
+		for _, name := range module.Export.Names {
+			entry := module.Export.Entries[name]
+			if entry.Kind != wasm.ExternalFunction {
+				continue
+			}
+			fn := module.GetFunction(int(entry.Index))
+			if fn == nil {
+				continue
+			}
+			if m, ok := methods[name]; ok {
+				if err := g.abiMethod(m, fn.Sig); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			g.coreMethod(name, fn.Sig)
+		}
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by wasmbindgen from %s. DO NOT EDIT.\n\n", opts.Source)
+	fmt.Fprintf(&src, "package %s\n\n", opts.Package)
+	if g.math {
+		src.WriteString("import (\n\t\"math\"\n\n\t\"github.com/bottos-project/bottos/vm/wasm/exec\"\n)\n\n")
+	} else {
+		src.WriteString("import \"github.com/bottos-project/bottos/vm/wasm/exec\"\n\n")
+	}
+	src.Write(g.buf.Bytes())
+	return format.Source(src.Bytes())
+}
+
+// prelude is the code of the Module type and of its helpers.
+const prelude = `// Module calls the exports of a module on a VM.
+type Module struct {
+	VM *exec.VM
+}
+
+// New returns a Module calling the exports of the module of vm.
+func New(vm *exec.VM) *Module {
+	return &Module{VM: vm}
+}
+
+// call calls the function exported as name, and returns its results.
+func (m *Module) call(name string, args ...uint64) ([]uint64, error) {
+	export, ok := m.VM.ExportedFunction(name)
+	if !ok {
+		return nil, exec.ERR_UNKNOWN_EXPORT
+	}
+	return m.VM.ExecCodeValues(int64(export.Index), args...)
+}
+
+// lowerString stores s in the memory, and returns its address and length.
+func (m *Module) lowerString(s string) (uint64, uint64, error) {
+	abi, err := m.VM.CanonicalABI("")
+	if err != nil {
+		return 0, 0, err
+	}
+	ptr, n, err := abi.LowerString(s)
+	return uint64(ptr), uint64(n), err
+}
+
+// lift returns the value of type t at the address ptr.
+func (m *Module) lift(t *exec.ABIType, ptr uint64) (interface{}, error) {
+	abi, err := m.VM.CanonicalABI("")
+	if err != nil {
+		return nil, err
+	}
+	return abi.Lift(t, uint32(ptr))
+}
+
+func boolBits(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+`
+
+type generator struct {
+	buf   bytes.Buffer
+	names map[string]bool // the names of the methods generated so far
+	math  bool            // whether the methods use the math package
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// methodName returns a unique exported Go name for the export name.
+func (g *generator) methodName(name string) string {
+	id := identifier(name, true)
+	switch id {
+	case "VM", "New":
+		id += "_"
+	}
+	unique := id
+	for i := 2; g.names[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", id, i)
+	}
+	g.names[unique] = true
+	return unique
+}
+
+// identifier returns the Go identifier made of the letters and digits of
+// name in camel case, exported or not.
+func identifier(name string, exported bool) string {
+	var b strings.Builder
+	upper := exported
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = b.Len() != 0 || exported
+			continue
+		}
+		switch {
+		case upper:
+			r = unicode.ToUpper(r)
+		case b.Len() == 0:
+			r = unicode.ToLower(r)
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	id := b.String()
+	if id == "" || unicode.IsDigit([]rune(id)[0]) {
+		if exported {
+			id = "X" + id
+		} else {
+			id = "x" + id
+		}
+	}
+	if token.IsKeyword(id) {
+		id += "_"
+	}
+	return id
+}
+
+// coreTypes are the Go types of the core value types.
+var coreTypes = map[wasm.ValueType]string{
+	wasm.ValueTypeI32: "uint32",
+	wasm.ValueTypeI64: "uint64",
+	wasm.ValueTypeF32: "float32",
+	wasm.ValueTypeF64: "float64",
+}
+
+// coreMethod writes the method calling the function exported as name with
+// core values.
+func (g *generator) coreMethod(name string, sig *wasm.FunctionSig) {
+	for _, t := range append(append([]wasm.ValueType(nil), sig.ParamTypes...), sig.ReturnTypes...) {
+		if _, ok := coreTypes[t]; !ok {
+			return
+		}
+	}
+
+	var params, args []string
+	for i, t := range sig.ParamTypes {
+		p := fmt.Sprintf("p%d", i)
+		params = append(params, p+" "+coreTypes[t])
+		args = append(args, g.coreArg(t, p))
+	}
+	var results, zeros, values []string
+	for i, t := range sig.ReturnTypes {
+		results = append(results, coreTypes[t])
+		zeros = append(zeros, "0")
+		values = append(values, g.coreResult(t, fmt.Sprintf("res[%d]", i)))
+	}
+
+	method := g.methodName(name)
+	g.printf("// %s calls the function exported as %q.\n", method, name)
+	ret := "error"
+	if len(results) != 0 {
+		ret = "(" + strings.Join(append(results, "error"), ", ") + ")"
+	}
+	g.printf("func (m *Module) %s(%s) %s {\n", method, strings.Join(params, ", "), ret)
+	res := "res"
+	if len(results) == 0 {
+		res = "_"
+	}
+	g.printf("\t%s, err := m.call(%s)\n", res, strings.Join(append([]string{fmt.Sprintf("%q", name)}, args...), ", "))
+	g.printf("\tif err != nil {\n\t\treturn %s\n\t}\n", strings.Join(append(zeros, "err"), ", "))
+	g.printf("\treturn %s\n}\n\n", strings.Join(append(values, "nil"), ", "))
+}
+
+func (g *generator) coreArg(t wasm.ValueType, p string) string {
+	switch t {
+	case wasm.ValueTypeF32, wasm.ValueTypeF64:
+		g.math = true
+	}
+	switch t {
+	case wasm.ValueTypeF32:
+		return fmt.Sprintf("uint64(math.Float32bits(%s))", p)
+	case wasm.ValueTypeF64:
+		return fmt.Sprintf("math.Float64bits(%s)", p)
+	}
+	return fmt.Sprintf("uint64(%s)", p)
+}
+
+func (g *generator) coreResult(t wasm.ValueType, v string) string {
+	switch t {
+	case wasm.ValueTypeF32, wasm.ValueTypeF64:
+		g.math = true
+	}
+	switch t {
+	case wasm.ValueTypeI32:
+		return fmt.Sprintf("uint32(%s)", v)
+	case wasm.ValueTypeF32:
+		return fmt.Sprintf("math.Float32frombits(uint32(%s))", v)
+	case wasm.ValueTypeF64:
+		return fmt.Sprintf("math.Float64frombits(%s)", v)
+	}
+	return v
+}
+
+// abiTypes are the Go types of the ABI types supported by the generated
+// code, along with the core type of their values.
+var abiTypes = map[exec.ABIKind]struct {
+	goType string
+	core   wasm.ValueType
+}{
+	exec.ABIBool: {"bool", wasm.ValueTypeI32},
+	exec.ABIS8:   {"int8", wasm.ValueTypeI32},
+	exec.ABIU8:   {"uint8", wasm.ValueTypeI32},
+	exec.ABIS16:  {"int16", wasm.ValueTypeI32},
+	exec.ABIU16:  {"uint16", wasm.ValueTypeI32},
+	exec.ABIS32:  {"int32", wasm.ValueTypeI32},
+	exec.ABIU32:  {"uint32", wasm.ValueTypeI32},
+	exec.ABIS64:  {"int64", wasm.ValueTypeI64},
+	exec.ABIU64:  {"uint64", wasm.ValueTypeI64},
+	exec.ABIF32:  {"float32", wasm.ValueTypeF32},
+	exec.ABIF64:  {"float64", wasm.ValueTypeF64},
+	exec.ABIChar: {"rune", wasm.ValueTypeI32},
+}
+
+// isBytes returns whether t is a list of u8, which is a []byte.
+func isBytes(t *exec.ABIType) bool {
+	return t.Kind == exec.ABIList && t.Elem.Kind == exec.ABIU8
+}
+
+// goType returns the Go type of the values of t, and false if the
+// generated code doesn't support t.
+func goType(t *exec.ABIType) (string, bool) {
+	switch {
+	case t.Kind == exec.ABIString:
+		return "string", true
+	case isBytes(t):
+		return "[]byte", true
+	}
+	scalar, ok := abiTypes[t.Kind]
+	return scalar.goType, ok
+}
+
+// abiMethod writes the method calling the export of the method m of the
+// ABI, whose function has the signature sig.
+func (g *generator) abiMethod(m exec.JSONMethod, sig *wasm.FunctionSig) error {
+	var result, zero string
+	var results []wasm.ValueType
+	if m.Result != nil {
+		var ok bool
+		if result, ok = goType(m.Result); !ok {
+			return UnsupportedTypeError{Method: m.Name, Kind: m.Result.Kind}
+		}
+		switch result {
+		case "string":
+			zero = `""`
+		case "[]byte":
+			zero = "nil"
+		case "bool":
+			zero = "false"
+		default:
+			zero = "0"
+		}
+		// the strings and the byte slices are returned through the memory
+		results = []wasm.ValueType{wasm.ValueTypeI32}
+		if scalar, ok := abiTypes[m.Result.Kind]; ok {
+			results = []wasm.ValueType{scalar.core}
+		}
+	}
+	fail := "err"
+	if result != "" {
+		fail = zero + ", err"
+	}
+
+	var decls, args []string
+	var lowers bytes.Buffer
+	var core []wasm.ValueType
+	for i, t := range m.Params {
+		typ, ok := goType(t)
+		if !ok {
+			return UnsupportedTypeError{Method: m.Name, Kind: t.Kind}
+		}
+		p := fmt.Sprintf("p%d", i)
+		if i < len(m.ParamNames) && m.ParamNames[i] != "" {
+			p = paramName(m.ParamNames[i])
+		}
+		decls = append(decls, p+" "+typ)
+
+		if _, ok := abiTypes[t.Kind]; ok {
+			core = append(core, abiTypes[t.Kind].core)
+			args = append(args, g.abiArg(t.Kind, p))
+			continue
+		}
+		core = append(core, wasm.ValueTypeI32, wasm.ValueTypeI32)
+		value := p
+		if isBytes(t) {
+			value = "string(" + p + ")"
+		}
+		fmt.Fprintf(&lowers, "\tptr%d, len%d, err := m.lowerString(%s)\n", i, i, value)
+		fmt.Fprintf(&lowers, "\tif err != nil {\n\t\treturn %s\n\t}\n", fail)
+		args = append(args, fmt.Sprintf("ptr%d", i), fmt.Sprintf("len%d", i))
+	}
+	if !sameTypes(sig.ParamTypes, core) || !sameTypes(sig.ReturnTypes, results) {
+		return SignatureError(m.Name)
+	}
+
+	method := g.methodName(m.Name)
+	ret := "error"
+	if result != "" {
+		ret = "(" + result + ", error)"
+	}
+	g.printf("// %s calls the function exported as %q.\n", method, m.Export)
+	g.printf("func (m *Module) %s(%s) %s {\n", method, strings.Join(decls, ", "), ret)
+	g.buf.Write(lowers.Bytes())
+	res, op := "res", ":="
+	if result == "" {
+		res = "_"
+	}
+	if lowers.Len() != 0 {
+		// err is declared by the lowering of the arguments
+		op = "="
+		if result != "" {
+			g.printf("\tvar res []uint64\n")
+		}
+	}
+	g.printf("\t%s, err %s m.call(%s)\n", res, op, strings.Join(append([]string{fmt.Sprintf("%q", m.Export)}, args...), ", "))
+	g.printf("\tif err != nil {\n\t\treturn %s\n\t}\n", fail)
+
+	switch result {
+	case "":
+		g.printf("\treturn nil\n}\n\n")
+	case "string", "[]byte":
+		t := "&exec.ABIType{Kind: exec.ABIString}"
+		if result == "[]byte" {
+			t = "&exec.ABIType{Kind: exec.ABIList, Elem: &exec.ABIType{Kind: exec.ABIU8}}"
+		}
+		g.printf("\tv, err := m.lift(%s, res[0])\n", t)
+		g.printf("\tif err != nil {\n\t\treturn %s\n\t}\n", fail)
+		g.printf("\treturn v.(%s), nil\n}\n\n", result)
+	default:
+		g.printf("\treturn %s, nil\n}\n\n", g.abiResult(m.Result.Kind, "res[0]"))
+	}
+	return nil
+}
+
+// reserved are the names used by the generated methods and host
+// functions, which the parameters can't take.
+var reserved = map[string]bool{
+	"m": true, "err": true, "res": true, "v": true, "math": true, "exec": true,
+	"vm": true, "env": true, "host": true, "params": true, "length": true,
+}
+
+// paramName returns the Go name of the parameter named name in the ABI.
+func paramName(name string) string {
+	p := identifier(name, false)
+	if reserved[p] || strings.HasPrefix(p, "ptr") || strings.HasPrefix(p, "len") {
+		p += "_"
+	}
+	return p
+}
+
+func (g *generator) abiArg(kind exec.ABIKind, p string) string {
+	switch kind {
+	case exec.ABIF32, exec.ABIF64:
+		g.math = true
+	}
+	switch kind {
+	case exec.ABIBool:
+		return fmt.Sprintf("boolBits(%s)", p)
+	case exec.ABIS8, exec.ABIS16, exec.ABIS32, exec.ABIChar:
+		// the sign extension is dropped from the i32 value
+		return fmt.Sprintf("uint64(uint32(%s))", p)
+	case exec.ABIF32:
+		return fmt.Sprintf("uint64(math.Float32bits(%s))", p)
+	case exec.ABIF64:
+		return fmt.Sprintf("math.Float64bits(%s)", p)
+	}
+	return fmt.Sprintf("uint64(%s)", p)
+}
+
+func (g *generator) abiResult(kind exec.ABIKind, v string) string {
+	switch kind {
+	case exec.ABIF32, exec.ABIF64:
+		g.math = true
+	}
+	switch kind {
+	case exec.ABIBool:
+		return fmt.Sprintf("uint32(%s) != 0", v)
+	case exec.ABIF32:
+		return fmt.Sprintf("math.Float32frombits(uint32(%s))", v)
+	case exec.ABIF64:
+		return fmt.Sprintf("math.Float64frombits(%s)", v)
+	case exec.ABIU64:
+		return v
+	}
+	return fmt.Sprintf("%s(%s)", abiTypes[kind].goType, v)
+}
+
+func sameTypes(a, b []wasm.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
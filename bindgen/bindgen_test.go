@@ -0,0 +1,80 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package bindgen
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestGenerate(t *testing.T) {
+	i32, f64 := wasm.ValueTypeI32, wasm.ValueTypeF64
+	module := &wasm.Module{
+		Types: &wasm.SectionTypes{Entries: []wasm.FunctionSig{
+			{ParamTypes: []wasm.ValueType{i32, i32}, ReturnTypes: []wasm.ValueType{i32}},
+			{ParamTypes: []wasm.ValueType{f64}},
+		}},
+		Export: &wasm.SectionExports{
+			Entries: map[string]wasm.ExportEntry{
+				"add":      {FieldStr: "add", Kind: wasm.ExternalFunction, Index: 0},
+				"greet":    {FieldStr: "greet", Kind: wasm.ExternalFunction, Index: 1},
+				"set-rate": {FieldStr: "set-rate", Kind: wasm.ExternalFunction, Index: 2},
+			},
+			Names: []string{"add", "greet", "set-rate"},
+		},
+	}
+	module.FunctionIndexSpace = []wasm.Function{
+		{Sig: &module.Types.Entries[0]},
+		{Sig: &module.Types.Entries[0]},
+		{Sig: &module.Types.Entries[1]},
+	}
+	abi, err := exec.ParseJSONABI([]byte(`{"methods": [{"name": "greet", "params": [{"name": "name", "type": "string"}], "result": "string"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := Generate(module, Options{Package: "greeter", Source: "greeter.wasm", ABI: abi})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "greeter.go", src, 0); err != nil {
+		t.Fatalf("invalid source: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		"func (m *Module) Add(p0 uint32, p1 uint32) (uint32, error) {",
+		"func (m *Module) Greet(name string) (string, error) {",
+		"func (m *Module) SetRate(p0 float64) error {",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("missing %q in\n%s", want, src)
+		}
+	}
+
+	// the ABI must match the signatures of the exports
+	if abi, err = exec.ParseJSONABI([]byte(`{"methods": [{"name": "add", "params": [{"name": "x", "type": "u64"}]}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Generate(module, Options{Package: "greeter", ABI: abi}); err != SignatureError("add") {
+		t.Errorf("got=%v, want=%v", err, SignatureError("add"))
+	}
+}
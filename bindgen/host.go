@@ -0,0 +1,288 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package bindgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+)
+
+// The host functions of an Interface pass their scalar arguments and
+// results as core values, and their string and byte slice (list of u8)
+// arguments as their address and length in the linear memory. A string or
+// byte slice result is copied to a buffer given by its address and size,
+// as two more arguments, truncated if the buffer is too small, and the
+// function returns its length instead, like getStrValue.
+
+// GenerateHost returns the source of a Go package registering the
+// functions of iface with an exec.EnvFunc. It declares a Host interface
+// with a method implementing every function of iface, and a Register
+// function registering the methods of a Host under the import names of
+// the functions, charging exec.HOST_CALL_GAS for every call and
+// exec.HOST_BYTE_GAS for every byte of their string and byte slice
+// arguments and buffers. Options.ABI is ignored.
+func GenerateHost(iface *Interface, opts Options) ([]byte, error) {
+	g := &generator{names: make(map[string]bool)}
+	methods := make([]string, len(iface.Funcs))
+	g.printf("// Host implements the functions of the %s interface.\n", iface.Name)
+	g.printf("type Host interface {\n")
+	for i, fn := range iface.Funcs {
+		if err := checkHostFunc(fn); err != nil {
+			return nil, err
+		}
+		methods[i] = g.methodName(fn.Name)
+		if fn.Doc != "" {
+			g.printf("\t// %s\n", strings.Replace(fn.Doc, "\n", "\n\t// ", -1))
+		}
+		decls := []string{"vm *exec.VM"}
+		for _, p := range fn.Params {
+			typ, _ := goType(p.Type)
+			decls = append(decls, paramName(p.Name)+" "+typ)
+		}
+		ret := "error"
+		if fn.Result != nil {
+			typ, _ := goType(fn.Result)
+			ret = "(" + typ + ", error)"
+		}
+		g.printf("\t%s(%s) %s\n", methods[i], strings.Join(decls, ", "), ret)
+	}
+	g.printf("}\n\n")
+
+	g.printf("// Register registers the functions of host with env, under the names\n")
+	g.printf("// the modules import them with.\n")
+	g.printf("func Register(env *exec.EnvFunc, host Host) {\n")
+	for i, fn := range iface.Funcs {
+		g.hostFunc(fn, methods[i])
+	}
+	g.printf("}\n\n")
+	g.printf("%s", hostPrelude)
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by wasmbindgen from %s. DO NOT EDIT.\n\n", opts.Source)
+	fmt.Fprintf(&src, "package %s\n\n", opts.Package)
+	if g.math {
+		src.WriteString("import (\n\t\"math\"\n\n\t\"github.com/bottos-project/bottos/vm/wasm/exec\"\n)\n\n")
+	} else {
+		src.WriteString("import \"github.com/bottos-project/bottos/vm/wasm/exec\"\n\n")
+	}
+	src.Write(g.buf.Bytes())
+	return format.Source(src.Bytes())
+}
+
+// hostPrelude is the code of the helpers of the host functions.
+const hostPrelude = `// hostBytes returns a copy of the n bytes at the address ptr of the
+// memory of vm.
+func hostBytes(vm *exec.VM, ptr, n uint64) ([]byte, error) {
+	mem := vm.Memory()
+	ptr, n = uint64(uint32(ptr)), uint64(uint32(n))
+	if ptr+n > uint64(len(mem)) {
+		return nil, exec.ERR_OUT_BOUNDS
+	}
+	return append([]byte(nil), mem[ptr:ptr+n]...), nil
+}
+
+// putHostBytes copies b to the buffer of n bytes at the address ptr of the
+// memory of vm, truncating it if the buffer is smaller, and returns the
+// length of b.
+func putHostBytes(vm *exec.VM, ptr, n uint64, b []byte) (uint64, error) {
+	mem := vm.Memory()
+	ptr, n = uint64(uint32(ptr)), uint64(uint32(n))
+	if ptr+n > uint64(len(mem)) {
+		return 0, exec.ERR_OUT_BOUNDS
+	}
+	copy(mem[ptr:ptr+n], b)
+	return uint64(len(b)), nil
+}
+
+func boolBits(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+`
+
+// checkHostFunc returns an UnsupportedTypeError if the generated code
+// can't marshal a type of fn.
+func checkHostFunc(fn HostFunc) error {
+	for _, p := range fn.Params {
+		if _, ok := goType(p.Type); !ok {
+			return UnsupportedTypeError{Method: fn.Name, Kind: p.Type.Kind}
+		}
+	}
+	if fn.Result != nil {
+		if _, ok := goType(fn.Result); !ok {
+			return UnsupportedTypeError{Method: fn.Name, Kind: fn.Result.Kind}
+		}
+	}
+	return nil
+}
+
+// isScalar returns whether the values of t are passed as a core value,
+// rather than through the memory.
+func isScalar(t *exec.ABIType) bool {
+	_, ok := abiTypes[t.Kind]
+	return ok
+}
+
+// hostFunc writes the registration of the host function fn, implemented
+// by the method of the Host.
+func (g *generator) hostFunc(fn HostFunc, method string) {
+	var body bytes.Buffer
+	var args []string
+	var lengths []string // the indices of the lengths of the buffers
+	n := 0               // the number of core arguments
+	for _, p := range fn.Params {
+		if isScalar(p.Type) {
+			args = append(args, g.abiResult(p.Type.Kind, fmt.Sprintf("params[%d]", n)))
+			n++
+			continue
+		}
+		v := paramName(p.Name)
+		fmt.Fprintf(&body, "\t\t%s, err := hostBytes(vm, params[%d], params[%d])\n", v, n, n+1)
+		fmt.Fprintf(&body, "\t\tif err != nil {\n\t\t\treturn false, err\n\t\t}\n")
+		if p.Type.Kind == exec.ABIString {
+			v = "string(" + v + ")"
+		}
+		args = append(args, v)
+		lengths = append(lengths, strconv.Itoa(n+1))
+		n += 2
+	}
+	call := fmt.Sprintf("host.%s(%s)", method, strings.Join(append([]string{"vm"}, args...), ", "))
+
+	switch {
+	case fn.Result == nil:
+		fmt.Fprintf(&body, "\t\tif err := %s; err != nil {\n\t\t\treturn false, err\n\t\t}\n", call)
+	case isScalar(fn.Result):
+		fmt.Fprintf(&body, "\t\tres, err := %s\n", call)
+		fmt.Fprintf(&body, "\t\tif err != nil {\n\t\t\treturn false, err\n\t\t}\n")
+		fmt.Fprintf(&body, "\t\tvm.SetFuncResult(%s)\n", g.abiArg(fn.Result.Kind, "res"))
+	default:
+		fmt.Fprintf(&body, "\t\tres, err := %s\n", call)
+		fmt.Fprintf(&body, "\t\tif err != nil {\n\t\t\treturn false, err\n\t\t}\n")
+		fmt.Fprintf(&body, "\t\tlength, err := putHostBytes(vm, params[%d], params[%d], []byte(res))\n", n, n+1)
+		fmt.Fprintf(&body, "\t\tif err != nil {\n\t\t\treturn false, err\n\t\t}\n")
+		fmt.Fprintf(&body, "\t\tvm.SetFuncResult(length)\n")
+		lengths = append(lengths, strconv.Itoa(n+1))
+		n += 2
+	}
+
+	g.printf("\tenv.RegisterWithCost(%q, func(vm *exec.VM) (bool, error) {\n", fn.Import)
+	g.printf("\t\tparams := vm.GetFuncParams()\n")
+	g.printf("\t\tif len(params) != %d {\n\t\t\treturn false, exec.ERR_PARAM_COUNT\n\t\t}\n", n)
+	g.buf.Write(body.Bytes())
+	g.printf("\t\treturn true, nil\n")
+	g.printf("\t}, exec.ByteCost(%s))\n", strings.Join(append([]string{"exec.HOST_CALL_GAS", "exec.HOST_BYTE_GAS"}, lengths...), ", "))
+}
+
+// cTypes are the C types of the scalar types.
+var cTypes = map[exec.ABIKind]string{
+	exec.ABIBool: "bool",
+	exec.ABIS8:   "int8_t",
+	exec.ABIU8:   "uint8_t",
+	exec.ABIS16:  "int16_t",
+	exec.ABIU16:  "uint16_t",
+	exec.ABIS32:  "int32_t",
+	exec.ABIU32:  "uint32_t",
+	exec.ABIS64:  "int64_t",
+	exec.ABIU64:  "uint64_t",
+	exec.ABIF32:  "float",
+	exec.ABIF64:  "double",
+	exec.ABIChar: "uint32_t",
+}
+
+// cKeywords are the C and C++ keywords the parameters can't be named.
+var cKeywords = map[string]bool{
+	"auto": true, "bool": true, "break": true, "case": true, "char": true, "class": true,
+	"const": true, "continue": true, "default": true, "delete": true, "do": true,
+	"double": true, "else": true, "enum": true, "extern": true, "float": true, "for": true,
+	"goto": true, "if": true, "int": true, "long": true, "new": true, "register": true,
+	"return": true, "short": true, "signed": true, "sizeof": true, "static": true,
+	"struct": true, "switch": true, "template": true, "this": true, "typedef": true,
+	"union": true, "unsigned": true, "void": true, "volatile": true, "while": true,
+}
+
+// cName returns the C name of the parameter named name in the interface.
+func cName(name string) string {
+	c := strings.Replace(name, "-", "_", -1)
+	if cKeywords[c] {
+		c += "_"
+	}
+	return c
+}
+
+// GenerateGuest returns a C header declaring the functions of iface the
+// contracts import, for the contract SDKs. Options.Package and
+// Options.ABI are ignored.
+func GenerateGuest(iface *Interface, opts Options) ([]byte, error) {
+	guard := strings.ToUpper(cName(iface.Name)) + "_H"
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by wasmbindgen from %s. DO NOT EDIT.\n\n", opts.Source)
+	fmt.Fprintf(&b, "#ifndef %s\n#define %s\n\n", guard, guard)
+	b.WriteString("#include <stdbool.h>\n#include <stdint.h>\n\n")
+	b.WriteString("#ifdef __cplusplus\nextern \"C\" {\n#endif\n")
+
+	for _, fn := range iface.Funcs {
+		if err := checkHostFunc(fn); err != nil {
+			return nil, err
+		}
+		var params []string
+		for _, p := range fn.Params {
+			name := cName(p.Name)
+			switch {
+			case isScalar(p.Type):
+				params = append(params, cTypes[p.Type.Kind]+" "+name)
+			case p.Type.Kind == exec.ABIString:
+				params = append(params, "const char *"+name, "uint32_t "+name+"_len")
+			default:
+				params = append(params, "const uint8_t *"+name, "uint32_t "+name+"_len")
+			}
+		}
+		ret := "void"
+		switch {
+		case fn.Result == nil:
+		case isScalar(fn.Result):
+			ret = cTypes[fn.Result.Kind]
+		case fn.Result.Kind == exec.ABIString:
+			ret = "uint32_t"
+			params = append(params, "char *result_buf", "uint32_t result_buf_len")
+		default:
+			ret = "uint32_t"
+			params = append(params, "uint8_t *result_buf", "uint32_t result_buf_len")
+		}
+		if len(params) == 0 {
+			params = []string{"void"}
+		}
+
+		b.WriteString("\n")
+		if fn.Doc != "" {
+			fmt.Fprintf(&b, "// %s\n", strings.Replace(fn.Doc, "\n", "\n// ", -1))
+		}
+		fmt.Fprintf(&b, "__attribute__((import_module(\"env\"), import_name(%q)))\n", fn.Import)
+		fmt.Fprintf(&b, "%s %s(%s);\n", ret, fn.Import, strings.Join(params, ", "))
+	}
+
+	b.WriteString("\n#ifdef __cplusplus\n}\n#endif\n\n")
+	fmt.Fprintf(&b, "#endif // %s\n", guard)
+	return b.Bytes(), nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package bindgen
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+)
+
+const chainWIT = `package bottos:chain;
+
+// the storage of the contracts
+interface chain {
+	/// Returns the value of key in the table of a contract.
+	get-str-value: func(contract: string, object: string, key: string) -> string;
+	is-account-exist: func(name: string) -> bool;
+
+	printi: func(value: u64)
+	set-rate: func(rate: f64, data: list<u8>);
+}
+`
+
+func TestParseInterface(t *testing.T) {
+	iface, err := ParseInterface([]byte(chainWIT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iface.Name != "chain" || len(iface.Funcs) != 4 {
+		t.Fatalf("unexpected interface: %+v", iface)
+	}
+	fn := iface.Funcs[0]
+	if fn.Name != "get-str-value" || fn.Import != "getStrValue" || len(fn.Params) != 3 ||
+		fn.Params[2].Name != "key" || fn.Result.Kind != exec.ABIString {
+		t.Errorf("unexpected function: %+v", fn)
+	}
+	if want := "Returns the value of key in the table of a contract."; fn.Doc != want {
+		t.Errorf("unexpected doc: got=%q, want=%q", fn.Doc, want)
+	}
+	if fn := iface.Funcs[3]; fn.Params[1].Type.Kind != exec.ABIList || fn.Params[1].Type.Elem.Kind != exec.ABIU8 || fn.Result != nil {
+		t.Errorf("unexpected function: %+v", fn)
+	}
+
+	for _, src := range []string{
+		"interface chain { f: func(x: u128); }",
+		"interface chain { f: func(); f: func(); }",
+		"interface chain { f: func() }}",
+		"chain { f: func() }",
+	} {
+		if _, err := ParseInterface([]byte(src)); err == nil {
+			t.Errorf("%s: no error", src)
+		}
+	}
+}
+
+func TestGenerateHost(t *testing.T) {
+	iface, err := ParseInterface([]byte(chainWIT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Package: "chain", Source: "chain.wit"}
+
+	src, err := GenerateHost(iface, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "host.go", src, 0); err != nil {
+		t.Fatalf("invalid source: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		"GetStrValue(vm *exec.VM, contract string, object string, key string) (string, error)",
+		"IsAccountExist(vm *exec.VM, name string) (bool, error)",
+		"Printi(vm *exec.VM, value uint64) error",
+		"SetRate(vm *exec.VM, rate float64, data []byte) error",
+		`env.RegisterWithCost("getStrValue", func(vm *exec.VM) (bool, error) {`,
+		"}, exec.ByteCost(exec.HOST_CALL_GAS, exec.HOST_BYTE_GAS, 1, 3, 5, 7))",
+		"vm.SetFuncResult(boolBits(res))",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("missing %q in\n%s", want, src)
+		}
+	}
+
+	header, err := GenerateGuest(iface, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`__attribute__((import_module("env"), import_name("getStrValue")))`,
+		"uint32_t getStrValue(const char *contract, uint32_t contract_len, const char *object, uint32_t object_len, const char *key, uint32_t key_len, char *result_buf, uint32_t result_buf_len);",
+		"bool isAccountExist(const char *name, uint32_t name_len);",
+		"void printi(uint64_t value);",
+		"void setRate(double rate, const uint8_t *data, uint32_t data_len);",
+	} {
+		if !strings.Contains(string(header), want) {
+			t.Errorf("missing %q in\n%s", want, header)
+		}
+	}
+
+	iface.Funcs[0].Result = &exec.ABIType{Kind: exec.ABIList, Elem: &exec.ABIType{Kind: exec.ABIString}}
+	if _, err := GenerateHost(iface, opts); err != (UnsupportedTypeError{Method: "get-str-value", Kind: exec.ABIList}) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package bindgen
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+)
+
+// Interface is an interface of host functions, see ParseInterface.
+type Interface struct {
+	Name  string
+	Funcs []HostFunc
+}
+
+// HostFunc is a function of an Interface.
+type HostFunc struct {
+	Name string // The name in the interface, in kebab case
+	// Import is the name the modules import the function with from the env
+	// module, the name in camel case.
+	Import string
+	Doc    string // The documentation comments of the function, without the slashes
+	Params []HostParam
+	Result *exec.ABIType // nil if the function returns nothing
+}
+
+// HostParam is a parameter of a HostFunc.
+type HostParam struct {
+	Name string
+	Type *exec.ABIType
+}
+
+// WITError is returned by ParseInterface for an invalid interface.
+type WITError struct {
+	Line int
+	Msg  string
+}
+
+func (e WITError) Error() string {
+	return fmt.Sprintf("bindgen: line %d: %s", e.Line, e.Msg)
+}
+
+// witKinds are the kinds of the scalar and string types of an interface.
+var witKinds = map[string]exec.ABIKind{
+	"bool": exec.ABIBool, "s8": exec.ABIS8, "u8": exec.ABIU8, "s16": exec.ABIS16, "u16": exec.ABIU16,
+	"s32": exec.ABIS32, "u32": exec.ABIU32, "s64": exec.ABIS64, "u64": exec.ABIU64,
+	"f32": exec.ABIF32, "f64": exec.ABIF64, "char": exec.ABIChar, "string": exec.ABIString,
+}
+
+// ParseInterface parses an interface of host functions written in the
+// subset of WIT, the IDL of the component model, made of a single
+// interface of functions:
+//
+//	package bottos:chain;
+//
+//	interface chain {
+//		/// Returns the value of key in the table of a contract.
+//		get-str-value: func(contract: string, object: string, key: string) -> string;
+//		printi: func(value: u64);
+//	}
+//
+// The types are the scalars, string and list<T>, and the package
+// declaration and the semicolons are optional.
+func ParseInterface(src []byte) (*Interface, error) {
+	p := &witParser{src: string(src), line: 1}
+	p.next()
+	if p.tok == "package" {
+		for p.tok != ";" && p.tok != "" {
+			p.next()
+		}
+		p.next()
+	}
+	if err := p.expect("interface"); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	iface := &Interface{Name: name}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for p.tok != "}" {
+		fn := HostFunc{Doc: strings.Join(p.doc, "\n")}
+		if fn.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if names[fn.Name] {
+			return nil, p.errorf("duplicate function %s", fn.Name)
+		}
+		names[fn.Name] = true
+		fn.Import = identifier(fn.Name, false)
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if err := p.expect("func"); err != nil {
+			return nil, err
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for p.tok != ")" {
+			var param HostParam
+			if param.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if param.Type, err = p.typ(); err != nil {
+				return nil, err
+			}
+			fn.Params = append(fn.Params, param)
+			if p.tok != "," {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if p.tok == "->" {
+			p.next()
+			if fn.Result, err = p.typ(); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok == ";" {
+			p.next()
+		}
+		iface.Funcs = append(iface.Funcs, fn)
+	}
+	p.next()
+	if p.tok != "" {
+		return nil, p.errorf("unexpected %q after the interface", p.tok)
+	}
+	return iface, nil
+}
+
+// witParser reads the tokens of an interface.
+type witParser struct {
+	src  string
+	line int
+	tok  string   // the current token, "" at the end of the source
+	doc  []string // the documentation comments before tok
+}
+
+func (p *witParser) errorf(format string, args ...interface{}) error {
+	return WITError{Line: p.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next reads the next token, skipping the spaces and the comments.
+func (p *witParser) next() {
+	p.doc = p.doc[:0]
+	for {
+		p.src = strings.TrimLeftFunc(p.src, func(r rune) bool {
+			if r == '\n' {
+				p.line++
+				// a blank line ends the documentation comments
+				p.doc = p.doc[:0]
+			}
+			return unicode.IsSpace(r)
+		})
+		switch {
+		case strings.HasPrefix(p.src, "///"):
+			end := strings.IndexByte(p.src, '\n')
+			if end < 0 {
+				end = len(p.src)
+			}
+			p.doc = append(p.doc, strings.TrimSpace(p.src[3:end]))
+			p.src = p.src[end:]
+			// the newline ending the comment doesn't end the documentation
+			if len(p.src) != 0 {
+				p.src = p.src[1:]
+				p.line++
+			}
+		case strings.HasPrefix(p.src, "//"):
+			end := strings.IndexByte(p.src, '\n')
+			if end < 0 {
+				end = len(p.src)
+			}
+			p.src = p.src[end:]
+		case strings.HasPrefix(p.src, "/*"):
+			end := strings.Index(p.src, "*/")
+			if end < 0 {
+				end = len(p.src) - 2
+			}
+			p.line += strings.Count(p.src[:end], "\n")
+			p.src = p.src[end+2:]
+		default:
+			p.scan()
+			return
+		}
+	}
+}
+
+// scan reads the token at the start of the source.
+func (p *witParser) scan() {
+	if p.src == "" {
+		p.tok = ""
+		return
+	}
+	n := 1
+	switch c := p.src[0]; {
+	case strings.HasPrefix(p.src, "->"):
+		n = 2
+	case c == '%' || c == '-' || c == '_' || c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))):
+		for n < len(p.src) {
+			c := rune(p.src[n])
+			if c != '-' && c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) || strings.HasPrefix(p.src[n:], "->") {
+				break
+			}
+			n++
+		}
+	}
+	p.tok, p.src = p.src[:n], p.src[n:]
+}
+
+func (p *witParser) expect(tok string) error {
+	if p.tok != tok {
+		return p.errorf("expected %q, found %q", tok, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+// name reads a name, returning it without the % escaping keywords.
+func (p *witParser) name() (string, error) {
+	name := strings.TrimPrefix(p.tok, "%")
+	if name == "" || !unicode.IsLetter(rune(name[0])) {
+		return "", p.errorf("expected a name, found %q", p.tok)
+	}
+	p.next()
+	return name, nil
+}
+
+// typ reads a type.
+func (p *witParser) typ() (*exec.ABIType, error) {
+	if kind, ok := witKinds[p.tok]; ok {
+		p.next()
+		return &exec.ABIType{Kind: kind}, nil
+	}
+	if p.tok != "list" {
+		return nil, p.errorf("unsupported type %q", p.tok)
+	}
+	p.next()
+	if err := p.expect("<"); err != nil {
+		return nil, err
+	}
+	elem, err := p.typ()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(">"); err != nil {
+		return nil, err
+	}
+	return &exec.ABIType{Kind: exec.ABIList, Elem: elem}, nil
+}
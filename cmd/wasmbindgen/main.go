@@ -0,0 +1,145 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Command wasmbindgen writes a Go package wrapping the exports of a module
+// in typed methods, see the bindgen package. It is meant to be run by
+// go generate:
+//
+//	//go:generate go run github.com/bottos-project/bottos/vm/wasm/cmd/wasmbindgen -pkg token -o token.go token.wasm
+//
+// The ABI describing the exports taking strings and byte slices is read
+// from the file given by -abi, or else from the abi custom section of the
+// module.
+//
+// Given an interface of host functions instead of a module, wasmbindgen
+// writes the Go package registering them with the VM, and the C header
+// declaring their imports for the contracts to the file given by -header:
+//
+//	//go:generate go run github.com/bottos-project/bottos/vm/wasm/cmd/wasmbindgen -pkg chain -o host.go -header chain.h chain.wit
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bottos-project/bottos/vm/wasm/bindgen"
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func main() {
+	pkg := flag.String("pkg", "", "the name of the generated package, the one of $GOPACKAGE if empty")
+	out := flag.String("o", "", "the file written, the standard output if empty")
+	abiFile := flag.String("abi", "", "the JSON ABI of the module")
+	header := flag.String("header", "", "the C header written for an interface")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: wasmbindgen [flags] module.wasm|interface.wit\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *pkg == "" {
+		*pkg = os.Getenv("GOPACKAGE")
+	}
+	if *pkg == "" {
+		fmt.Fprintln(os.Stderr, "wasmbindgen: missing package name")
+		os.Exit(2)
+	}
+
+	var err error
+	if filepath.Ext(flag.Arg(0)) == ".wit" {
+		err = runInterface(flag.Arg(0), *pkg, *out, *header)
+	} else {
+		err = run(flag.Arg(0), *pkg, *out, *abiFile)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "wasmbindgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(path, pkg, out, abiFile string) error {
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	module, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		return err
+	}
+	opts := bindgen.Options{Package: pkg, Source: filepath.Base(path)}
+	if abiFile != "" {
+		data, err := ioutil.ReadFile(abiFile)
+		if err != nil {
+			return err
+		}
+		if opts.ABI, err = exec.ParseJSONABI(data); err != nil {
+			return err
+		}
+	}
+
+	src, err := bindgen.Generate(module, opts)
+	if err != nil {
+		return err
+	}
+	return write(out, src)
+}
+
+func runInterface(path, pkg, out, header string) error {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	iface, err := bindgen.ParseInterface(src)
+	if err != nil {
+		return err
+	}
+	opts := bindgen.Options{Package: pkg, Source: filepath.Base(path)}
+
+	host, err := bindgen.GenerateHost(iface, opts)
+	if err != nil {
+		return err
+	}
+	if err := write(out, host); err != nil {
+		return err
+	}
+	if header == "" {
+		return nil
+	}
+	guest, err := bindgen.GenerateGuest(iface, opts)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(header, guest, 0644)
+}
+
+// write writes src to the file out, or to the standard output if out is
+// empty.
+func write(out string, src []byte) error {
+	if out == "" {
+		_, err := os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(out, src, 0644)
+}
@@ -0,0 +1,124 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Command wasmvm runs the exports of modules from the command line, for
+// the developers of contracts to try them without a chain:
+//
+//	wasmvm run [flags] module.wasm export [args...]
+//
+// calls export with the arguments, converted to the types of its
+// parameters, and prints its results. The module runs with the default
+// env functions and the storage, events, crypto, big integer and chain
+// context host functions, its storage being kept in memory. The gas used,
+// the events emitted and the call stack of a trap are printed to the
+// standard error, the stack with the source lines of the DWARF sections of
+// the module, or of its source map file next to it. With -json, export is
+// a method of the ABI embedded in the module, see exec.EmbedABI, and the
+// arguments are JSON values.
+//
+//	wasmvm validate [flags] module.wasm...
+//
+// decodes and validates the modules, and checks them against a deployment
+// policy, see exec.ValidateForDeployment. It prints every requirement a
+// module breaks, with the offset in the file of the instruction breaking
+// it, if any, and the kind of the requirement, and exits with a non zero
+// status if any module can't be deployed.
+//
+//	wasmvm repl [flags] module.wasm
+//
+// instantiates the module and reads commands from the standard input to
+// call its exports, as run does, and to inspect and modify its memory and
+// globals between the calls, the instance keeping its state from a call to
+// the next. The module is instantiated again when its file changes. Type
+// help for the commands.
+//
+//	wasmvm wast script.wast...
+//
+// runs the scripts of spec-style tests, see package wast, and prints the
+// commands which failed, exiting with a non zero status if any did.
+//
+//	wasmvm serve [-grpc addr] [-http addr] [flags] [module.wasm...]
+//
+// serves the VM as a gRPC service, see package rpc, for the clients to
+// load modules, instantiate them and call their exports, and as an HTTP
+// endpoint calling the methods of the ABIs embedded in the modules with
+// JSON arguments, see (*rpc.Server).HTTPHandler. The modules given are
+// loaded first, named after their files. The instances have the host
+// functions of run and a storage kept in memory. The gas and the time of
+// the calls are limited by -gas and -timeout, and by the requests.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "run":
+		if err := run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "wasmvm: %v\n", err)
+			os.Exit(1)
+		}
+	case "validate":
+		valid, err := validateModules(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wasmvm: %v\n", err)
+			os.Exit(1)
+		}
+		if !valid {
+			os.Exit(1)
+		}
+	case "repl":
+		if err := repl(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "wasmvm: %v\n", err)
+			os.Exit(1)
+		}
+	case "wast":
+		passed, err := runScripts(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wasmvm: %v\n", err)
+			os.Exit(1)
+		}
+		if !passed {
+			os.Exit(1)
+		}
+	case "serve":
+		if err := serve(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "wasmvm: %v\n", err)
+			os.Exit(1)
+		}
+	case "help", "-h", "-help", "--help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "wasmvm: unknown command %q\n", os.Args[1])
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: wasmvm run [flags] module.wasm export [args...]\n")
+	fmt.Fprintf(os.Stderr, "       wasmvm validate [flags] module.wasm...\n")
+	fmt.Fprintf(os.Stderr, "       wasmvm repl [flags] module.wasm\n")
+	fmt.Fprintf(os.Stderr, "       wasmvm wast script.wast...\n")
+	fmt.Fprintf(os.Stderr, "       wasmvm serve [-grpc addr] [-http addr] [flags] [module.wasm...]\n")
+	fmt.Fprintf(os.Stderr, "run 'wasmvm <command> -h' for the flags of a command\n")
+	os.Exit(2)
+}
@@ -0,0 +1,321 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+const replHelp = `commands:
+  exports                    list the exports of the module
+  call export [args...]      call export, or just: export [args...]
+  mem addr [length]          dump length bytes of the memory at addr, 64 by default
+  setmem addr hex            write the hex encoded bytes to the memory at addr
+  globals                    list the globals
+  setglobal index value      set the global with the given index
+  reset                      reset the instance to its initial state
+  reload                     read the module again, which is also done once its file changes
+  help                       print this help
+  quit                       exit
+`
+
+// session is the state of a repl: the instance of the module in the file
+// path, and the storage of the contract, kept across reloads.
+type session struct {
+	path    string
+	flags   *callFlags
+	store   memStore
+	inst    *exec.Instance
+	vm      *exec.VM
+	modTime time.Time
+}
+
+// repl runs the repl command with the given command line arguments.
+func repl(args []string) error {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	callFlags := addCallFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: wasmvm repl [flags] module.wasm\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	s := &session{path: flags.Arg(0), flags: callFlags, store: memStore{}}
+	if err := s.load(); err != nil {
+		return err
+	}
+	defer func() { s.inst.Close() }()
+	s.listExports(os.Stdout)
+	return s.loop(os.Stdin, os.Stdout)
+}
+
+// load instantiates the module in the file of s, replacing the previous
+// instance, if any.
+func (s *session) load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	inst, err := instantiate(s.path)
+	if err != nil {
+		return err
+	}
+	if s.inst != nil {
+		s.inst.Close()
+	}
+	s.inst, s.vm, s.modTime = inst, inst.NewVM(), info.ModTime()
+	return nil
+}
+
+// loop reads the commands from r until its end or quit, and writes their
+// output to w.
+func (s *session) loop(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(w, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(w)
+			return scanner.Err()
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "exit" {
+			return nil
+		}
+		// the module is reloaded once its file changes, for it to be
+		// rebuilt while the repl runs
+		if info, err := os.Stat(s.path); err == nil && !info.ModTime().Equal(s.modTime) && fields[0] != "reload" {
+			if err := s.load(); err != nil {
+				fmt.Fprintf(w, "error: reload: %v\n", err)
+				continue
+			}
+			fmt.Fprintf(w, "reloaded %s\n", s.path)
+		}
+		if err := s.exec(w, fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(w, "error: %v\n", err)
+		}
+	}
+}
+
+// exec runs the command cmd with the given arguments.
+func (s *session) exec(w io.Writer, cmd string, args []string) error {
+	switch cmd {
+	case "help":
+		fmt.Fprint(w, replHelp)
+	case "exports":
+		s.listExports(w)
+	case "call":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: call export [args...]")
+		}
+		return s.call(w, args[0], args[1:])
+	case "mem":
+		return s.dumpMemory(w, args)
+	case "setmem":
+		return s.setMemory(args)
+	case "globals":
+		s.listGlobals(w)
+	case "setglobal":
+		return s.setGlobal(args)
+	case "reset":
+		if err := s.inst.Reset(); err != nil {
+			return err
+		}
+		s.vm = s.inst.NewVM()
+	case "reload":
+		if err := s.load(); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "reloaded %s\n", s.path)
+	default:
+		if _, ok := s.inst.ExportedFunction(cmd); !ok {
+			return fmt.Errorf("unknown command %q, try help", cmd)
+		}
+		return s.call(w, cmd, args)
+	}
+	return nil
+}
+
+// listExports writes the exports of the module to w.
+func (s *session) listExports(w io.Writer) {
+	for _, e := range s.inst.Module().Exports() {
+		if e.Sig != nil {
+			fmt.Fprintf(w, "%s %s %v\n", e.Kind, e.Name, *e.Sig)
+			continue
+		}
+		fmt.Fprintf(w, "%s %s\n", e.Kind, e.Name)
+	}
+}
+
+// call calls export with the arguments and writes its results to w, and
+// the events it emitted and the gas it used to the standard error.
+func (s *session) call(w io.Writer, export string, args []string) error {
+	if err := s.flags.prepare(s.vm, s.path, export, s.store); err != nil {
+		return err
+	}
+	results, err := call(s.vm, s.inst, export, args)
+	s.flags.report(s.vm)
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		fmt.Fprintln(w, res)
+	}
+	return nil
+}
+
+// dumpMemory writes the memory at the address of args, and the length
+// following it, if any, to w.
+func (s *session) dumpMemory(w io.Writer, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: mem addr [length]")
+	}
+	addr, err := strconv.ParseUint(args[0], 0, 32)
+	if err != nil {
+		return err
+	}
+	length := uint64(64)
+	if len(args) == 2 {
+		if length, err = strconv.ParseUint(args[1], 0, 32); err != nil {
+			return err
+		}
+	}
+	memory := s.vm.Memory()
+	if addr+length > uint64(len(memory)) {
+		return fmt.Errorf("%d bytes at %#x out of the %d bytes of the memory", length, addr, len(memory))
+	}
+	for start := addr; start < addr+length; start += 16 {
+		end := start + 16
+		if end > addr+length {
+			end = addr + length
+		}
+		line := memory[start:end]
+		fmt.Fprintf(w, "%08x  %-48s |%s|\n", start, spacedHex(line), printable(line))
+	}
+	return nil
+}
+
+// setMemory writes the hex encoded bytes of args to the memory at the
+// address preceding them.
+func (s *session) setMemory(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: setmem addr hex")
+	}
+	addr, err := strconv.ParseUint(args[0], 0, 32)
+	if err != nil {
+		return err
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(args[1], "0x"))
+	if err != nil {
+		return err
+	}
+	memory := s.vm.Memory()
+	if addr+uint64(len(data)) > uint64(len(memory)) {
+		return fmt.Errorf("%d bytes at %#x out of the %d bytes of the memory", len(data), addr, len(memory))
+	}
+	copy(memory[addr:], data)
+	return nil
+}
+
+// listGlobals writes the globals of the module, with their values, to w.
+func (s *session) listGlobals(w io.Writer) {
+	module := s.inst.Module().Wasm()
+	names := map[uint32]string{}
+	for _, e := range s.inst.Module().Exports() {
+		if e.Kind == wasm.ExternalGlobal {
+			names[e.Index] = e.Name
+		}
+	}
+	slots, values := disasm.GlobalSlots(module), s.vm.Globals()
+	for i, global := range module.GlobalIndexSpace {
+		mutability := "const"
+		if global.Type.Mutable {
+			mutability = "mut"
+		}
+		value := formatValue(global.Type.Type, values[slots[i]])
+		if global.Type.Type == wasm.ValueTypeV128 {
+			value = fmt.Sprintf("0x%016x%016x", values[slots[i]+1], values[slots[i]])
+		}
+		fmt.Fprintf(w, "%d %s %s %s %s\n", i, names[uint32(i)], mutability, global.Type.Type, value)
+	}
+}
+
+// setGlobal sets the global whose index is the first argument to the
+// value of the second, whether it is mutable or not.
+func (s *session) setGlobal(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: setglobal index value")
+	}
+	module := s.inst.Module().Wasm()
+	index, err := strconv.ParseUint(args[0], 0, 32)
+	if err != nil {
+		return err
+	}
+	if index >= uint64(len(module.GlobalIndexSpace)) {
+		return fmt.Errorf("no global %d", index)
+	}
+	t := module.GlobalIndexSpace[index].Type.Type
+	v, err := parseValue(t, args[1])
+	if err != nil {
+		return err
+	}
+	s.vm.Globals()[disasm.GlobalSlots(module)[index]] = v
+	return nil
+}
+
+// spacedHex returns the bytes of b in hex, separated by spaces.
+func spacedHex(b []byte) string {
+	var sb strings.Builder
+	for i, c := range b {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		fmt.Fprintf(&sb, "%02x", c)
+	}
+	return sb.String()
+}
+
+// printable returns b with its non printable bytes replaced by dots.
+func printable(b []byte) string {
+	p := make([]byte, len(b))
+	for i, c := range b {
+		p[i] = '.'
+		if c >= 0x20 && c < 0x7f {
+			p[i] = c
+		}
+	}
+	return string(p)
+}
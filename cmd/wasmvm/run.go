@@ -0,0 +1,322 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bottos-project/bottos/common/types"
+	"github.com/bottos-project/bottos/contract"
+	"github.com/bottos-project/bottos/vm/wasm/debuginfo"
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// callFlags are the flags of the commands calling the exports of a
+// module, setting up the VMs of the calls.
+type callFlags struct {
+	gas      *uint64
+	schedule *string
+	contract *string
+	caller   *string
+	height   *uint64
+	value    *uint64
+}
+
+// addCallFlags defines the call flags in flags.
+func addCallFlags(flags *flag.FlagSet) *callFlags {
+	return &callFlags{
+		gas:      flags.Uint64("gas", 0, "the gas limit of the call, unmetered if zero"),
+		schedule: flags.String("schedule", "", "the JSON gas schedule of a metered call, the default one if empty"),
+		contract: flags.String("contract", "", "the account of the contract, the name of the module if empty"),
+		caller:   flags.String("caller", "", "the account calling the contract"),
+		height:   flags.Uint64("height", 1, "the height of the block"),
+		value:    flags.Uint64("value", 0, "the value transferred to the contract"),
+	}
+}
+
+// run runs the run command with the given command line arguments.
+func run(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	callFlags := addCallFlags(flags)
+	jsonArgs := flags.Bool("json", false, "call a method of the embedded ABI with JSON arguments")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: wasmvm run [flags] module.wasm export [args...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	path, export, callArgs := flags.Arg(0), flags.Arg(1), flags.Args()[2:]
+
+	inst, err := instantiate(path)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	if err := callFlags.prepare(vm, path, export, memStore{}); err != nil {
+		return err
+	}
+
+	var results []string
+	if *jsonArgs {
+		results, err = callJSON(vm, export, callArgs)
+	} else {
+		results, err = call(vm, inst, export, callArgs)
+	}
+	callFlags.report(vm)
+	if trap, ok := err.(*exec.TrapError); ok {
+		// the call stack of the trap is shown as well
+		return fmt.Errorf("trap: %+v", trap)
+	}
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		fmt.Println(res)
+	}
+	return nil
+}
+
+// instantiate reads the module in the file path and instantiates it with
+// the host functions of the commands.
+func instantiate(path string) (*exec.Instance, error) {
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	module, err := wasm.ReadModule(bytes.NewReader(code), resolver(filepath.Dir(path)))
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := exec.CompileModule(module, exec.VMConfig{})
+	if err != nil {
+		return nil, err
+	}
+	if err := loadSourceMap(compiled, module, filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	return compiled.Instantiate(newEnv())
+}
+
+// loadSourceMap sets the source map of compiled to the file in dir the
+// sourceMappingURL section of module names, if any, for the call stacks
+// of the traps to show the lines of the AssemblyScript sources. A missing
+// file isn't an error, the source maps not always shipping with their
+// modules.
+func loadSourceMap(compiled *exec.Module, module *wasm.Module, dir string) error {
+	url, ok := debuginfo.SourceMappingURL(module)
+	if !ok || strings.HasPrefix(url, "data:") || strings.Contains(url, "://") {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(url)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := compiled.SetSourceMap(data); err != nil {
+		return fmt.Errorf("%s: %v", url, err)
+	}
+	return nil
+}
+
+// newEnv returns the host functions of the modules run by the commands:
+// the default env functions along with the storage, events, crypto, big
+// integer and chain context ones.
+func newEnv() *exec.EnvFunc {
+	env := exec.NewEnvFunc()
+	exec.RegisterStorage(env, exec.StorageConfig{})
+	exec.RegisterEvents(env, exec.EventConfig{})
+	exec.RegisterCrypto(env, exec.CryptoConfig{})
+	exec.RegisterBigInt(env, exec.BigIntConfig{})
+	exec.RegisterChainContext(env, exec.ChainContextConfig{})
+	return env
+}
+
+// prepare sets up vm for a call of method of the contract in the file
+// path, the contract storing its state in store.
+func (f *callFlags) prepare(vm *exec.VM, path, method string, store exec.StateStore) error {
+	contractName := *f.contract
+	if contractName == "" {
+		contractName = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	vm.SetStateStore(store)
+	vm.SetContract(&contract.Context{Trx: &types.Transaction{Sender: *f.caller, Contract: contractName, Method: method}})
+	vm.SetChainContext(&exec.ChainContext{
+		BlockHeight:    *f.height,
+		BlockTimestamp: uint64(time.Now().Unix()),
+		Caller:         *f.caller,
+		Contract:       contractName,
+		Value:          *f.value,
+	})
+	vm.CollectEvents(true)
+	if *f.gas == 0 {
+		return nil
+	}
+	schedule := exec.DefaultGasSchedule()
+	if *f.schedule != "" {
+		data, err := ioutil.ReadFile(*f.schedule)
+		if err != nil {
+			return err
+		}
+		if schedule, err = exec.ParseGasSchedule(data); err != nil {
+			return err
+		}
+	}
+	vm.SetGasMeter(exec.NewGasMeter(*f.gas), schedule)
+	return nil
+}
+
+// report prints the events emitted by the last call of vm and the gas it
+// used, if metered, to the standard error.
+func (f *callFlags) report(vm *exec.VM) {
+	for _, e := range vm.Events() {
+		fmt.Fprintf(os.Stderr, "event %s %q\n", e.Topic, e.Data)
+	}
+	if *f.gas != 0 {
+		fmt.Fprintf(os.Stderr, "gas used: %d\n", vm.GasUsed())
+	}
+}
+
+// resolver returns the function resolving the modules imported by a
+// module, other than the env functions, as the modules in the files
+// named after them in dir.
+func resolver(dir string) wasm.ResolveFunc {
+	var resolve wasm.ResolveFunc
+	resolve = func(name string) (*wasm.Module, error) {
+		code, err := ioutil.ReadFile(filepath.Join(dir, name+".wasm"))
+		if err != nil {
+			return nil, err
+		}
+		return wasm.ReadModule(bytes.NewReader(code), resolve)
+	}
+	return resolve
+}
+
+// call calls export on vm with the arguments converted to the types of its
+// parameters, and returns its results formatted according to their types.
+func call(vm *exec.VM, inst *exec.Instance, export string, args []string) (results []string, err error) {
+	fn, ok := inst.ExportedFunction(export)
+	if !ok {
+		return nil, fmt.Errorf("no exported function %q", export)
+	}
+	if len(args) != len(fn.Sig.ParamTypes) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", export, len(fn.Sig.ParamTypes), len(args))
+	}
+	values := make([]uint64, len(args))
+	for i, t := range fn.Sig.ParamTypes {
+		if values[i], err = parseValue(t, args[i]); err != nil {
+			return nil, fmt.Errorf("argument %d: %v", i, err)
+		}
+	}
+
+	defer exec.RecoverTrap(&err)
+	res, err := vm.ExecCodeValues(int64(fn.Index), values...)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range fn.Sig.ReturnTypes {
+		if t == wasm.ValueTypeV128 {
+			results = append(results, fmt.Sprintf("0x%016x%016x", res[1], res[0]))
+			res = res[2:]
+			continue
+		}
+		results = append(results, formatValue(t, res[0]))
+		res = res[1:]
+	}
+	return results, nil
+}
+
+// callJSON calls the method of the ABI embedded in the module of vm with
+// the JSON arguments, and returns its JSON result.
+func callJSON(vm *exec.VM, method string, args []string) (results []string, err error) {
+	payload := struct {
+		Method string            `json:"method"`
+		Args   []json.RawMessage `json:"args"`
+	}{Method: method, Args: []json.RawMessage{}}
+	for _, arg := range args {
+		payload.Args = append(payload.Args, json.RawMessage(arg))
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	defer exec.RecoverTrap(&err)
+	res, err := vm.CallJSON(nil, data)
+	if err != nil {
+		return nil, err
+	}
+	return []string{string(res)}, nil
+}
+
+// parseValue parses s as a value of type t: an integer, signed or not, in
+// any base strconv.ParseInt reads, or a floating-point number.
+func parseValue(t wasm.ValueType, s string) (uint64, error) {
+	switch t {
+	case wasm.ValueTypeI32:
+		if n, err := strconv.ParseInt(s, 0, 32); err == nil {
+			return uint64(uint32(n)), nil
+		}
+		n, err := strconv.ParseUint(s, 0, 32)
+		return n, err
+	case wasm.ValueTypeI64:
+		if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return uint64(n), nil
+		}
+		return strconv.ParseUint(s, 0, 64)
+	case wasm.ValueTypeF32:
+		f, err := strconv.ParseFloat(s, 32)
+		return uint64(math.Float32bits(float32(f))), err
+	case wasm.ValueTypeF64:
+		f, err := strconv.ParseFloat(s, 64)
+		return math.Float64bits(f), err
+	}
+	return 0, fmt.Errorf("unsupported parameter type %v", t)
+}
+
+// formatValue formats the raw bits v of a value of type t, the integers
+// being signed.
+func formatValue(t wasm.ValueType, v uint64) string {
+	switch t {
+	case wasm.ValueTypeI32:
+		return strconv.FormatInt(int64(int32(v)), 10)
+	case wasm.ValueTypeI64:
+		return strconv.FormatInt(int64(v), 10)
+	case wasm.ValueTypeF32:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(v))), 'g', -1, 32)
+	case wasm.ValueTypeF64:
+		return strconv.FormatFloat(math.Float64frombits(v), 'g', -1, 64)
+	}
+	return fmt.Sprintf("0x%x", v)
+}
@@ -0,0 +1,135 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/rpc"
+	"google.golang.org/grpc"
+)
+
+// serve runs the serve command with the given command line arguments.
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("grpc", "", "the address to serve the gRPC service on, like localhost:9090")
+	httpAddr := flags.String("http", "", "the address to serve the HTTP endpoint on, like localhost:8080")
+	gas := flags.Uint64("gas", 0, "the gas limit of the calls, which a request may lower, unmetered if zero")
+	timeout := flags.Duration("timeout", 0, "the time limit of the calls and of the start functions, which a request may lower, unbounded if zero")
+	schedule := flags.String("schedule", "", "the JSON gas schedule of the calls, the default one if empty")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: wasmvm serve [-grpc addr] [-http addr] [flags] [module.wasm...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *addr == "" && *httpAddr == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	config := rpc.Config{
+		VM:         exec.VMConfig{MaxExecutionTime: *timeout},
+		Imports:    newEnv(),
+		Store:      &lockedStore{store: memStore{}},
+		MaxGas:     *gas,
+		MaxTimeout: *timeout,
+	}
+	if *schedule != "" {
+		data, err := ioutil.ReadFile(*schedule)
+		if err != nil {
+			return err
+		}
+		if config.Schedule, err = exec.ParseGasSchedule(data); err != nil {
+			return err
+		}
+	}
+
+	server := rpc.NewServer(config)
+	for _, path := range flags.Args() {
+		code, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if _, err := server.LoadModule(context.Background(), &rpc.LoadModuleRequest{Name: name, Code: code}); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	errs := make(chan error, 2)
+	if *addr != "" {
+		listener, err := net.Listen("tcp", *addr)
+		if err != nil {
+			return err
+		}
+		grpcServer := grpc.NewServer()
+		rpc.RegisterVMServer(grpcServer, server)
+		log.Printf("wasmvm: serving gRPC on %s", listener.Addr())
+		go func() { errs <- grpcServer.Serve(listener) }()
+	}
+	if *httpAddr != "" {
+		listener, err := net.Listen("tcp", *httpAddr)
+		if err != nil {
+			return err
+		}
+		log.Printf("wasmvm: serving HTTP on %s", listener.Addr())
+		go func() { errs <- http.Serve(listener, server.HTTPHandler()) }()
+	}
+	return <-errs
+}
+
+// lockedStore is a memStore shared by the concurrent calls of the
+// instances of the serve command.
+type lockedStore struct {
+	mu    sync.Mutex
+	store memStore
+}
+
+func (s *lockedStore) Get(contract string, key []byte) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.Get(contract, key)
+}
+
+func (s *lockedStore) Set(contract string, key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.Set(contract, key, value)
+}
+
+func (s *lockedStore) Remove(contract string, key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.Remove(contract, key)
+}
+
+func (s *lockedStore) Next(contract string, prefix, start []byte) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.Next(contract, prefix, start)
+}
@@ -0,0 +1,56 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// memStore is an exec.StateStore keeping the storage of the contracts in
+// memory, for the duration of the command.
+type memStore map[string][]byte
+
+func (s memStore) Get(contract string, key []byte) ([]byte, bool, error) {
+	v, ok := s[contract+"/"+string(key)]
+	return v, ok, nil
+}
+
+func (s memStore) Set(contract string, key, value []byte) error {
+	s[contract+"/"+string(key)] = value
+	return nil
+}
+
+func (s memStore) Remove(contract string, key []byte) error {
+	delete(s, contract+"/"+string(key))
+	return nil
+}
+
+func (s memStore) Next(contract string, prefix, start []byte) ([]byte, bool, error) {
+	var keys []string
+	for k := range s {
+		if key := strings.TrimPrefix(k, contract+"/"); key != k && strings.HasPrefix(key, string(prefix)) && key >= string(start) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, false, nil
+	}
+	sort.Strings(keys)
+	return []byte(keys[0]), true, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// validateModules runs the validate command with the given command line
+// arguments, and returns whether all the modules can be deployed.
+func validateModules(args []string) (bool, error) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	policyFile := flags.String("policy", "", "the JSON exec.DeployPolicy the modules are checked against")
+	noFloats := flags.Bool("no-floats", false, "reject the floats")
+	noSIMD := flags.Bool("no-simd", false, "reject the SIMD instructions")
+	noThreads := flags.Bool("no-threads", false, "reject the shared memories and the atomic instructions")
+	exports := flags.String("exports", "", "the comma separated functions the modules must export")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: wasmvm validate [flags] module.wasm...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var policy exec.DeployPolicy
+	if *policyFile != "" {
+		data, err := ioutil.ReadFile(*policyFile)
+		if err != nil {
+			return false, err
+		}
+		if err := json.Unmarshal(data, &policy); err != nil {
+			return false, fmt.Errorf("%s: %v", *policyFile, err)
+		}
+	}
+	policy.Policy.NoFloats = policy.Policy.NoFloats || *noFloats
+	policy.Policy.NoSIMD = policy.Policy.NoSIMD || *noSIMD
+	policy.Policy.NoThreads = policy.Policy.NoThreads || *noThreads
+	if *exports != "" {
+		policy.RequiredExports = append(policy.RequiredExports, strings.Split(*exports, ",")...)
+	}
+
+	valid := true
+	for _, path := range flags.Args() {
+		code, err := ioutil.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		violations := exec.ValidateForDeployment(code, policy)
+		if len(violations) == 0 {
+			continue
+		}
+		valid = false
+		// the offsets of the instructions are counted from the start of
+		// the file, from their function body
+		module, _ := wasm.ReadModule(bytes.NewReader(code), resolver("."))
+		for _, v := range violations {
+			fmt.Printf("%s%s: %s: %s\n", path, location(module, v), v.Kind, v.Reason)
+		}
+	}
+	return valid, nil
+}
+
+// location returns the location of the violation v of module in its file,
+// if any: the offset of its instruction, and its function.
+func location(module *wasm.Module, v exec.DeployViolation) string {
+	if v.Function < 0 {
+		return ""
+	}
+	if v.Offset < 0 || module == nil || v.Function >= len(module.FunctionIndexSpace) || module.FunctionIndexSpace[v.Function].Body == nil {
+		return fmt.Sprintf(": function %d", v.Function)
+	}
+	offset := module.FunctionIndexSpace[v.Function].Body.Offset + int64(v.Offset)
+	return fmt.Sprintf(":0x%x: function %d", offset, v.Function)
+}
@@ -0,0 +1,60 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wast"
+)
+
+// runScripts runs the wast command with the given command line arguments,
+// and returns whether all the commands of the scripts succeeded.
+func runScripts(args []string) (bool, error) {
+	flags := flag.NewFlagSet("wast", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: wasmvm wast script.wast...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	passed := true
+	for _, path := range flags.Args() {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		failures, err := wast.Run(src, exec.VMConfig{})
+		if err != nil {
+			return false, fmt.Errorf("%s: %v", path, err)
+		}
+		for _, f := range failures {
+			fmt.Printf("%s:%d: %s: %s\n", path, f.Line, f.Command, f.Msg)
+		}
+		passed = passed && len(failures) == 0
+	}
+	return passed, nil
+}
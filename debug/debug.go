@@ -0,0 +1,325 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package debug runs the calls of a VM under the control of a debugger,
+// stopping them at breakpoints, before the accesses to watched ranges of
+// the memory, or instruction by instruction, to inspect their frames, and
+// the globals and memory of their instance, while they are stopped. Built
+// with the wasmdebug build tag, it steps the calls backwards too, from
+// snapshots of their state, see EnableSnapshots.
+//
+//	d := debug.New(vm)
+//	d.SetBreakpoint(debug.Breakpoint{Func: fn, Offset: offset})
+//	stop, err := d.Start(fn, args...)
+//	for err == nil && !stop.Done {
+//		fmt.Println(stop, d.Frames())
+//		stop, err = d.Step()
+//	}
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+)
+
+var (
+	// ErrRunning is returned by Start while a call is already debugged.
+	ErrRunning = errors.New("debug: a call is already debugged")
+	// ErrNotStopped is returned when resuming without a stopped call.
+	ErrNotStopped = errors.New("debug: no call is stopped")
+	// ErrNoInstruction is returned by SetBreakpoint for a breakpoint which
+	// isn't the offset of an instruction of its function.
+	ErrNoInstruction = errors.New("debug: no instruction at the breakpoint")
+	// ErrKilled is the error of a call ended by Kill.
+	ErrKilled = errors.New("debug: call killed")
+	// ErrNoSnapshot is returned by StepBack for a call stopped at its
+	// first instruction, or without a snapshot before its previous one.
+	ErrNoSnapshot = errors.New("debug: no snapshot before the instruction")
+)
+
+// Breakpoint is an instruction of a module: the index of its function and
+// its offset in the module, like the Offset of a disasm.Instruction.
+type Breakpoint struct {
+	Func   int64
+	Offset int64
+}
+
+// Stop is the state of a debugged call once it stops, before the
+// instruction given by its Breakpoint, or once it is done.
+type Stop struct {
+	Breakpoint
+	Hit bool // Whether the instruction is one of the breakpoints
+	// The access of the instruction to a watchpoint, nil if the call
+	// didn't stop for a watchpoint
+	Access *exec.MemoryAccess
+
+	Done   bool        // Whether the call returned or failed
+	Result interface{} // The result of the call, see (*exec.VM).ExecCode
+	Err    error       // The error of the call, traps included
+}
+
+func (s Stop) String() string {
+	if s.Done {
+		if s.Err != nil {
+			return fmt.Sprintf("failed: %v", s.Err)
+		}
+		return fmt.Sprintf("returned %v", s.Result)
+	}
+	if s.Access != nil {
+		return fmt.Sprintf("stopped in function %d at offset %#x, accessing %d bytes at %#x", s.Func, s.Offset, s.Access.Size, s.Access.Addr)
+	}
+	return fmt.Sprintf("stopped in function %d at offset %#x", s.Func, s.Offset)
+}
+
+// mode is the way a stopped call is resumed.
+type mode int
+
+const (
+	modeContinue mode = iota // until a breakpoint
+	modeStep                 // until the next instruction
+	modeStepOver             // until the next instruction of the frame or its callers
+	modeStepOut              // until the next instruction of a caller
+	modeKill                 // failing with ErrKilled
+	modeBack                 // until the instruction target, from a snapshot
+)
+
+// Debugger runs the calls of a VM, one at a time, stopping them at its
+// breakpoints, before the accesses to its watchpoints and after each
+// step. The call runs in its own goroutine,
+// while the methods of the Debugger wait for it to stop: a Debugger must
+// be used by a single goroutine.
+//
+// The instructions inlined into a function are seen at their call, see
+// (*exec.VM).SetDebugHook.
+type Debugger struct {
+	vm          *exec.VM
+	module      *exec.Module
+	breakpoints map[Breakpoint]bool
+
+	// how the stopped call was resumed, and its depth when it was
+	running bool
+	stopped bool
+	mode    mode
+	depth   int
+
+	// the number of instructions the call ran, the snapshots of the call
+	// taken every interval instructions, and the instruction a step back
+	// stops at, see StepBack
+	count     int64
+	interval  int64
+	snapshots []snapshot
+	target    int64
+
+	stops  chan Stop
+	resume chan struct{}
+}
+
+// New returns a Debugger running the calls of vm, setting its debug hook.
+func New(vm *exec.VM) *Debugger {
+	d := &Debugger{
+		vm:          vm,
+		module:      vm.Module(),
+		breakpoints: make(map[Breakpoint]bool),
+		stops:       make(chan Stop),
+		resume:      make(chan struct{}),
+	}
+	vm.SetDebugHook(d.hook)
+	vm.SetWatchFunc(d.watch)
+	return d
+}
+
+// SetBreakpoint adds b to the breakpoints of d, returning
+// ErrNoInstruction if no instruction of its function starts at its
+// offset.
+func (d *Debugger) SetBreakpoint(b Breakpoint) error {
+	instrs, err := d.module.Disassemble(int(b.Func))
+	if err != nil {
+		return err
+	}
+	i := sort.Search(len(instrs), func(i int) bool { return instrs[i].Offset >= b.Offset })
+	if i == len(instrs) || instrs[i].Offset != b.Offset {
+		return ErrNoInstruction
+	}
+	d.breakpoints[b] = true
+	return nil
+}
+
+// ClearBreakpoint removes b from the breakpoints of d.
+func (d *Debugger) ClearBreakpoint(b Breakpoint) {
+	delete(d.breakpoints, b)
+}
+
+// Breakpoints returns the breakpoints of d, in the order of the module.
+func (d *Debugger) Breakpoints() []Breakpoint {
+	breakpoints := make([]Breakpoint, 0, len(d.breakpoints))
+	for b := range d.breakpoints {
+		breakpoints = append(breakpoints, b)
+	}
+	sort.Slice(breakpoints, func(i, j int) bool {
+		return breakpoints[i].Offset < breakpoints[j].Offset
+	})
+	return breakpoints
+}
+
+// Watch adds w to the watchpoints of the VM: the call stops before the
+// instructions accessing its range, see (*exec.VM).AddWatchpoint.
+func (d *Debugger) Watch(w exec.Watchpoint) {
+	d.vm.AddWatchpoint(w)
+}
+
+// Unwatch removes w from the watchpoints of the VM.
+func (d *Debugger) Unwatch(w exec.Watchpoint) {
+	d.vm.RemoveWatchpoint(w)
+}
+
+// Start calls the function with the given index and arguments, like
+// (*exec.VM).ExecCode, and returns where the call stops first.
+func (d *Debugger) Start(fnIndex int64, args ...uint64) (Stop, error) {
+	if d.running {
+		return Stop{}, ErrRunning
+	}
+	d.running, d.mode = true, modeContinue
+	d.count, d.snapshots = 0, nil
+	go d.run(fnIndex, args)
+	return d.wait(), nil
+}
+
+// run runs a debugged call, and sends its outcome once it is done. A step
+// back unwinds the call, to run it again from a snapshot.
+func (d *Debugger) run(fnIndex int64, args []uint64) {
+	stop := d.call(func() (interface{}, error) {
+		return d.vm.ExecCode(fnIndex, args...)
+	})
+	for errors.Is(stop.Err, errStepBack) {
+		s := d.rewind()
+		stop = d.call(func() (interface{}, error) {
+			return d.vm.Restore(s)
+		})
+	}
+	d.stops <- stop
+}
+
+// call runs f, which runs a debugged call, and returns its outcome.
+func (d *Debugger) call(f func() (interface{}, error)) (stop Stop) {
+	stop.Done = true
+	defer func() {
+		// the traps unwind the call
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok {
+				stop.Err = err
+			} else {
+				stop.Err = fmt.Errorf("debug: %v", r)
+			}
+		}
+	}()
+	stop.Result, stop.Err = f()
+	return stop
+}
+
+// wait waits for the debugged call to stop.
+func (d *Debugger) wait() Stop {
+	stop := <-d.stops
+	d.stopped = !stop.Done
+	d.running = d.stopped
+	return stop
+}
+
+// hook stops the debugged call before the instruction of the function fn
+// at offset, if it is a breakpoint or ends the current step.
+func (d *Debugger) hook(fn, offset int64) {
+	d.snapshot()
+	d.count++
+	b := Breakpoint{Func: fn, Offset: offset}
+	hit := d.breakpoints[b]
+	stop := hit
+	switch d.mode {
+	case modeBack:
+		stop = d.count-1 == d.target
+	case modeStep:
+		stop = true
+	case modeStepOver:
+		stop = stop || d.vm.CallDepth() <= d.depth
+	case modeStepOut:
+		stop = stop || d.vm.CallDepth() < d.depth
+	}
+	if stop {
+		d.stop(Stop{Breakpoint: b, Hit: hit})
+	}
+}
+
+// watch stops the debugged call before an access to the watchpoint w.
+func (d *Debugger) watch(w exec.Watchpoint, access exec.MemoryAccess) {
+	if d.mode == modeBack && d.count-1 != d.target {
+		return
+	}
+	d.stop(Stop{Breakpoint: Breakpoint{Func: access.Func, Offset: access.Offset}, Access: &access})
+}
+
+// stop stops the debugged call at s, until it is resumed.
+func (d *Debugger) stop(s Stop) {
+	d.stops <- s
+	<-d.resume
+	switch d.mode {
+	case modeKill:
+		panic(ErrKilled)
+	case modeBack:
+		panic(errStepBack)
+	}
+}
+
+// resumeWith resumes the stopped call in the given mode, and returns
+// where it stops next.
+func (d *Debugger) resumeWith(m mode) (Stop, error) {
+	if !d.stopped {
+		return Stop{}, ErrNotStopped
+	}
+	d.stopped, d.mode, d.depth = false, m, d.vm.CallDepth()
+	d.resume <- struct{}{}
+	return d.wait(), nil
+}
+
+// Continue resumes the stopped call until it reaches a breakpoint.
+func (d *Debugger) Continue() (Stop, error) {
+	return d.resumeWith(modeContinue)
+}
+
+// Step resumes the stopped call for a single instruction, stopping in the
+// function it calls if it is a call.
+func (d *Debugger) Step() (Stop, error) {
+	return d.resumeWith(modeStep)
+}
+
+// StepOver resumes the stopped call for a single instruction, running the
+// function it calls to completion if it is a call, unless a breakpoint is
+// reached first.
+func (d *Debugger) StepOver() (Stop, error) {
+	return d.resumeWith(modeStepOver)
+}
+
+// StepOut resumes the stopped call until its current function returns,
+// unless a breakpoint is reached first.
+func (d *Debugger) StepOut() (Stop, error) {
+	return d.resumeWith(modeStepOut)
+}
+
+// Kill ends the stopped call, which fails with ErrKilled.
+func (d *Debugger) Kill() (Stop, error) {
+	return d.resumeWith(modeKill)
+}
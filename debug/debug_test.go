@@ -0,0 +1,203 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package debug
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+	"github.com/bottos-project/bottos/vm/wasm/wat"
+)
+
+const testModule = `(module
+  (memory 1)
+  (global (mut i32) (i32.const 0))
+  (func $double (param i32) (result i32)
+    local.get 0
+    i32.const 2
+    i32.mul)
+  (func (export "run") (param i32) (result i32) (local i32)
+    local.get 0
+    call $double
+    local.set 1
+    local.get 1
+    global.set 0
+    local.get 1)
+  (func (export "store") (param i32 i32)
+    local.get 0
+    local.get 1
+    i32.store))`
+
+func newDebugger(t *testing.T) (*exec.Instance, [][]disasm.Instruction) {
+	module, err := wat.Parse([]byte(testModule), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := exec.CompileModule(module, exec.VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(exec.NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var instrs [][]disasm.Instruction
+	for i := range module.FunctionIndexSpace {
+		code, err := compiled.Disassemble(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		instrs = append(instrs, code)
+	}
+	return inst, instrs
+}
+
+func TestDebugger(t *testing.T) {
+	inst, instrs := newDebugger(t)
+	defer inst.Close()
+	d := New(inst.NewVM())
+	double, run := instrs[0], instrs[1]
+	if run[1].Op.Code != ops.Call {
+		t.Fatalf("unexpected instructions: %v", run)
+	}
+
+	check := func(stop Stop, err error, fn int64, instr disasm.Instruction, hit bool) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Stop{Breakpoint: Breakpoint{Func: fn, Offset: instr.Offset}, Hit: hit}
+		if stop != want {
+			t.Fatalf("got=%v, want=%v", stop, want)
+		}
+	}
+
+	entry := Breakpoint{Func: 0, Offset: double[0].Offset}
+	if err := d.SetBreakpoint(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetBreakpoint(Breakpoint{Func: 0, Offset: double[0].Offset + 1}); err != ErrNoInstruction {
+		t.Errorf("got=%v, want=%v", err, ErrNoInstruction)
+	}
+
+	stop, err := d.Start(1, 21)
+	check(stop, err, 0, double[0], true)
+	frames := d.Frames()
+	if len(frames) != 2 || frames[0].Func != 0 || frames[1].Func != 1 {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	if frames[0].Locals[0] != uint32(21) || frames[1].Offset != run[1].Offset {
+		t.Errorf("unexpected frames: %+v", frames)
+	}
+	if frames[1].Locals[0] != uint32(21) || frames[1].Locals[1] != uint32(0) {
+		t.Errorf("unexpected caller locals: %v", frames[1].Locals)
+	}
+	if _, err := d.Start(1, 21); err != ErrRunning {
+		t.Errorf("got=%v, want=%v", err, ErrRunning)
+	}
+
+	stop, err = d.Step()
+	check(stop, err, 0, double[1], false)
+	if stack := d.Frames()[0].Stack; len(stack) != 1 || stack[0] != 21 {
+		t.Errorf("unexpected stack: %v", stack)
+	}
+
+	// back in run, before storing the result of the call
+	stop, err = d.StepOut()
+	check(stop, err, 1, run[2], false)
+	if stack := d.Frames()[0].Stack; len(stack) != 1 || stack[0] != 42 {
+		t.Errorf("unexpected stack: %v", stack)
+	}
+
+	stop, err = d.StepOver()
+	check(stop, err, 1, run[3], false)
+	stop, err = d.Continue()
+	if err != nil || !stop.Done || stop.Result != uint32(42) || stop.Err != nil {
+		t.Fatalf("unexpected stop: %+v, %v", stop, err)
+	}
+	if g, err := d.Global(0); err != nil || g != uint32(42) {
+		t.Errorf("global: got=%v, %v", g, err)
+	}
+	if _, err := d.Continue(); err != ErrNotStopped {
+		t.Errorf("got=%v, want=%v", err, ErrNotStopped)
+	}
+
+	// stepping over the call skips the breakpoint-free callee
+	d.ClearBreakpoint(entry)
+	call := Breakpoint{Func: 1, Offset: run[1].Offset}
+	if err := d.SetBreakpoint(call); err != nil {
+		t.Fatal(err)
+	}
+	stop, err = d.Start(1, 5)
+	check(stop, err, 1, run[1], true)
+	stop, err = d.StepOver()
+	check(stop, err, 1, run[2], false)
+	stop, err = d.Step()
+	check(stop, err, 1, run[3], false)
+
+	stop, err = d.Kill()
+	if err != nil || !stop.Done || !errors.Is(stop.Err, ErrKilled) {
+		t.Fatalf("unexpected stop: %+v, %v", stop, err)
+	}
+	if bps := d.Breakpoints(); len(bps) != 1 || bps[0] != call {
+		t.Errorf("unexpected breakpoints: %v", bps)
+	}
+
+	// the VM can run again once the call is killed
+	d.ClearBreakpoint(call)
+	stop, err = d.Start(1, 1)
+	if err != nil || !stop.Done || stop.Result != uint32(2) {
+		t.Fatalf("unexpected stop: %+v, %v", stop, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	inst, instrs := newDebugger(t)
+	defer inst.Close()
+	d := New(inst.NewVM())
+	store := instrs[2]
+
+	w := exec.Watchpoint{Addr: 16, Size: 4, Write: true}
+	d.Watch(w)
+	stop, err := d.Start(2, 14, 0xdeadbeef)
+	if err != nil || stop.Access == nil || stop.Offset != store[2].Offset {
+		t.Fatalf("unexpected stop: %v, %v", stop, err)
+	}
+	want := exec.MemoryAccess{Func: 2, Offset: store[2].Offset, Addr: 14, Size: 4, Write: true}
+	if *stop.Access != want {
+		t.Errorf("got=%+v, want=%+v", *stop.Access, want)
+	}
+	// the stop precedes the store
+	if m := d.Memory(); m[16] != 0 {
+		t.Errorf("unexpected memory: %x", m[14:18])
+	}
+	if stop, err = d.Continue(); err != nil || !stop.Done || stop.Err != nil {
+		t.Fatalf("unexpected stop: %v, %v", stop, err)
+	}
+	if m := d.Memory(); m[16] != 0xad {
+		t.Errorf("unexpected memory: %x", m[14:18])
+	}
+
+	d.Unwatch(w)
+	if stop, err = d.Start(2, 14, 0); err != nil || !stop.Done {
+		t.Fatalf("unexpected stop: %v, %v", stop, err)
+	}
+}
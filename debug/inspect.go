@@ -0,0 +1,131 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package debug
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// ErrInvalidGlobal is returned by Global for an index out of the global
+// index space of the module.
+var ErrInvalidGlobal = errors.New("debug: invalid global index")
+
+// Frame is a frame of a stopped call.
+type Frame struct {
+	Func int64
+	// The offset in the module of the instruction the frame is stopped
+	// at, the call of the frame above it for a caller, -1 if unknown
+	Offset int64
+	// The values of the parameters and locals of the function, see Value
+	Locals []interface{}
+	// The slots of the operand stack, from its bottom, see disasm.Slots
+	Stack []uint64
+}
+
+// Frames returns the frames of the stopped call, from the innermost one,
+// or nil if no call is stopped.
+func (d *Debugger) Frames() []Frame {
+	if !d.stopped {
+		return nil
+	}
+	vmFrames := d.vm.Frames()
+	frames := make([]Frame, len(vmFrames))
+	for i, f := range vmFrames {
+		pc := f.PC
+		if i != len(vmFrames)-1 {
+			// the pc of a caller follows its call
+			pc--
+		}
+		offset, ok := d.module.CodeOffset(f.Func, pc)
+		if !ok {
+			offset = -1
+		}
+		frames[len(frames)-1-i] = Frame{
+			Func:   f.Func,
+			Offset: offset,
+			Locals: locals(d.module.Wasm().FunctionIndexSpace[f.Func], f.Locals),
+			Stack:  f.Stack,
+		}
+	}
+	return frames
+}
+
+// locals returns the values of the parameters and locals of fn held by
+// slots.
+func locals(fn wasm.Function, slots []uint64) []interface{} {
+	types := append([]wasm.ValueType(nil), fn.Sig.ParamTypes...)
+	if fn.Body != nil {
+		for _, entry := range fn.Body.Locals {
+			for i := uint32(0); i < entry.Count; i++ {
+				types = append(types, entry.Type)
+			}
+		}
+	}
+	values := make([]interface{}, len(types))
+	for i, t := range types {
+		values[i] = Value(t, slots)
+		slots = slots[disasm.Slots(t):]
+	}
+	return values
+}
+
+// Global returns the value of the global with the given index, see
+// Value. The globals can be read whether a call is stopped or not.
+func (d *Debugger) Global(index uint32) (interface{}, error) {
+	module := d.module.Wasm()
+	if int(index) >= len(module.GlobalIndexSpace) {
+		return nil, ErrInvalidGlobal
+	}
+	slot := disasm.GlobalSlots(module)[index]
+	return Value(module.GlobalIndexSpace[index].Type.Type, d.vm.Globals()[slot:]), nil
+}
+
+// Memory returns the memory of the instance of the VM, which is only
+// safe to use while no call runs.
+func (d *Debugger) Memory() []byte {
+	return d.vm.Memory()
+}
+
+// Value returns the value of type t held by the first slots, like the
+// results of (*exec.VM).ExecCode: a uint32 for an i32, a uint64 for an
+// i64, a float32 or float64 for a float, a wasm.V128 for a v128 and a
+// wasm.Ref for a reference.
+func Value(t wasm.ValueType, slots []uint64) interface{} {
+	switch t {
+	case wasm.ValueTypeI32:
+		return uint32(slots[0])
+	case wasm.ValueTypeI64:
+		return slots[0]
+	case wasm.ValueTypeF32:
+		return math.Float32frombits(uint32(slots[0]))
+	case wasm.ValueTypeF64:
+		return math.Float64frombits(slots[0])
+	case wasm.ValueTypeV128:
+		var v wasm.V128
+		binary.LittleEndian.PutUint64(v[:8], slots[0])
+		binary.LittleEndian.PutUint64(v[8:], slots[1])
+		return v
+	default:
+		return wasm.Ref(slots[0])
+	}
+}
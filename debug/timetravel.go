@@ -0,0 +1,95 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package debug
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+)
+
+// errStepBack is the value the hook unwinds a call stepped back with.
+var errStepBack = errors.New("debug: stepping back")
+
+// snapshot is a snapshot of the debugged call, taken before the
+// instruction count.
+type snapshot struct {
+	count int64
+	state *exec.Snapshot
+}
+
+// EnableSnapshots makes d snapshot the debugged calls every interval
+// instructions, for StepBack, or stop snapshotting them with a zero
+// interval. The snapshots take a copy of the memory pages changed since the
+// previous one, which makes them costly: they are only available with the
+// wasmdebug build tag, and EnableSnapshots returns
+// exec.ERR_SNAPSHOTS_DISABLED otherwise.
+func (d *Debugger) EnableSnapshots(interval int) error {
+	if !exec.SnapshotsEnabled {
+		return exec.ERR_SNAPSHOTS_DISABLED
+	}
+	d.interval = int64(interval)
+	return nil
+}
+
+// StepBack stops the stopped call before the instruction it ran before the
+// one it is stopped at: the call runs again from the last snapshot before
+// that instruction, see EnableSnapshots, without stopping at breakpoints
+// and watchpoints on the way. It returns ErrNoSnapshot if there is no such
+// snapshot.
+func (d *Debugger) StepBack() (Stop, error) {
+	if !d.stopped {
+		return Stop{}, ErrNotStopped
+	}
+	// the call is stopped before the instruction count-1
+	target := d.count - 2
+	if target < 0 || len(d.snapshots) == 0 || d.snapshots[0].count > target {
+		return Stop{}, ErrNoSnapshot
+	}
+	d.target = target
+	return d.resumeWith(modeBack)
+}
+
+// snapshot snapshots the debugged call before its next instruction, if
+// the interval of the snapshots is over.
+func (d *Debugger) snapshot() {
+	if d.interval == 0 || d.count%d.interval != 0 {
+		return
+	}
+	var prev *exec.Snapshot
+	if n := len(d.snapshots); n != 0 {
+		if d.snapshots[n-1].count >= d.count {
+			// the call runs again from a snapshot
+			return
+		}
+		prev = d.snapshots[n-1].state
+	}
+	if state, err := d.vm.Snapshot(prev); err == nil {
+		d.snapshots = append(d.snapshots, snapshot{count: d.count, state: state})
+	}
+}
+
+// rewind returns the last snapshot before the target of a step back, which
+// the call runs again from, dropping the later ones.
+func (d *Debugger) rewind() *exec.Snapshot {
+	i := sort.Search(len(d.snapshots), func(i int) bool { return d.snapshots[i].count > d.target }) - 1
+	d.snapshots = d.snapshots[:i+1]
+	d.count = d.snapshots[i].count
+	return d.snapshots[i].state
+}
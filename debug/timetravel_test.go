@@ -0,0 +1,104 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build wasmdebug
+
+package debug
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+)
+
+func TestStepBack(t *testing.T) {
+	newStepper := func() (*exec.Instance, *Debugger) {
+		inst, instrs := newDebugger(t)
+		d := New(inst.NewVM())
+		if err := d.EnableSnapshots(2); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.SetBreakpoint(Breakpoint{Func: 1, Offset: instrs[1][0].Offset}); err != nil {
+			t.Fatal(err)
+		}
+		return inst, d
+	}
+	inst, d := newStepper()
+	defer inst.Close()
+
+	// step through run and double, then back to the start of run
+	type state struct {
+		stop   Stop
+		frames []Frame
+		global interface{}
+	}
+	current := func(stop Stop) state {
+		g, err := d.Global(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return state{stop, d.Frames(), g}
+	}
+	stop, err := d.Start(1, 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.StepBack(); err != ErrNoSnapshot {
+		t.Errorf("got=%v, want=%v", err, ErrNoSnapshot)
+	}
+	var states []state
+	for !stop.Done {
+		states = append(states, current(stop))
+		if stop, err = d.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stop.Result != uint32(42) {
+		t.Fatalf("unexpected stop: %v", stop)
+	}
+	if _, err := d.StepBack(); err != ErrNotStopped {
+		t.Errorf("got=%v, want=%v", err, ErrNotStopped)
+	}
+
+	// the global is only set by the end of run
+	if last := states[len(states)-1]; last.global != uint32(42) || states[0].global != uint32(0) {
+		t.Fatalf("unexpected globals: %v, %v", states[0].global, last.global)
+	}
+	// a new instance, whose global isn't set yet, runs the call again
+	inst, d = newStepper()
+	defer inst.Close()
+	stop, err = d.Start(1, 21)
+	for i := 0; i < len(states)-1; i++ {
+		if stop, err = d.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := len(states) - 2; i >= 0; i-- {
+		if stop, err = d.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+		if got := current(stop); !reflect.DeepEqual(got, states[i]) {
+			t.Fatalf("step back to %d: got=%+v, want=%+v", i, got, states[i])
+		}
+	}
+
+	// the call runs forward again from the step back
+	if stop, err = d.Continue(); err != nil || !stop.Done || stop.Result != uint32(42) {
+		t.Fatalf("unexpected stop: %v, %v", stop, err)
+	}
+}
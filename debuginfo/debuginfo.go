@@ -0,0 +1,168 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package debuginfo reads the DWARF debugging information compilers embed
+// in the custom sections of a module, to map its code to the source lines
+// it was compiled from.
+package debuginfo
+
+import (
+	"debug/dwarf"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// ErrNoLineInfo is returned by ReadLines for a module without DWARF line
+// information.
+var ErrNoLineInfo = errors.New("debuginfo: the module has no DWARF line information")
+
+// Line is a position in a source file.
+type Line struct {
+	File   string // The path of the file, as recorded by the compiler
+	Line   int
+	Column int // 0 if unknown
+}
+
+// String returns the base name of the file followed by the line, like
+// lib.rs:142.
+func (l Line) String() string {
+	return path.Base(l.File) + ":" + strconv.Itoa(l.Line)
+}
+
+// LineTable maps the instructions of a module to their source lines.
+type LineTable struct {
+	rows []row
+}
+
+// row is a row of the line table: the instructions from offset up to the
+// next row come from line, unless the row ends a sequence of instructions.
+type row struct {
+	offset int64
+	line   Line
+	end    bool
+}
+
+// ReadLines reads the line table of the DWARF sections of m, from the
+// .debug_info, .debug_abbrev and .debug_line custom sections, and the
+// other ones they reference. The addresses of the DWARF information of a
+// module are offsets in the payload of its code section, and the
+// sequences of instructions at address 0, or at the tombstone addresses
+// 0xfffffffe and 0xffffffff, are the ones of the functions left out of the
+// module by the linker.
+func ReadLines(m *wasm.Module) (*LineTable, error) {
+	section := func(name string) []byte {
+		payload, _ := m.CustomSection(name)
+		return payload
+	}
+	info, line := section(".debug_info"), section(".debug_line")
+	if info == nil || line == nil || m.Code == nil {
+		return nil, ErrNoLineInfo
+	}
+	d, err := dwarf.New(section(".debug_abbrev"), section(".debug_aranges"), nil, info, line,
+		nil, section(".debug_ranges"), section(".debug_str"))
+	if err != nil {
+		return nil, err
+	}
+	// the sections of DWARF 5
+	for _, name := range []string{".debug_addr", ".debug_line_str", ".debug_str_offsets", ".debug_rnglists"} {
+		if payload := section(name); payload != nil {
+			if err := d.AddSection(name, payload); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	t := &LineTable{}
+	r := d.Reader()
+	for {
+		unit, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if unit == nil {
+			break
+		}
+		if unit.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		lines, err := d.LineReader(unit)
+		if err != nil {
+			return nil, err
+		}
+		r.SkipChildren()
+		if lines == nil {
+			continue
+		}
+		if err := t.readSequences(lines, m.Code.Start); err != nil {
+			return nil, err
+		}
+	}
+
+	// an end of sequence comes before a sequence starting at its address
+	sort.SliceStable(t.rows, func(i, j int) bool {
+		a, b := t.rows[i], t.rows[j]
+		return a.offset < b.offset || a.offset == b.offset && a.end && !b.end
+	})
+	return t, nil
+}
+
+// readSequences reads the rows of the sequences of a line program, whose
+// addresses are relative to the offset code of the code section.
+func (t *LineTable) readSequences(lines *dwarf.LineReader, code int64) error {
+	var entry dwarf.LineEntry
+	start := true // whether entry starts a sequence
+	skip := false // whether the sequence is left out of the module
+	for {
+		if err := lines.Next(&entry); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if start {
+			skip = entry.Address == 0 || entry.Address >= 0xfffffffe
+			start = false
+		}
+		if entry.EndSequence {
+			start = true
+		}
+		if skip {
+			continue
+		}
+		r := row{offset: code + int64(entry.Address), end: entry.EndSequence}
+		if !r.end && entry.File != nil {
+			r.line = Line{File: entry.File.Name, Line: entry.Line, Column: entry.Column}
+		}
+		t.rows = append(t.rows, r)
+	}
+}
+
+// Lookup returns the source line of the instruction at offset in the
+// module, and false if the line table doesn't cover it.
+func (t *LineTable) Lookup(offset int64) (Line, bool) {
+	i := sort.Search(len(t.rows), func(i int) bool { return t.rows[i].offset > offset }) - 1
+	if i < 0 || t.rows[i].end || t.rows[i].line.Line == 0 {
+		return Line{}, false
+	}
+	return t.rows[i].line, true
+}
@@ -0,0 +1,165 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package debuginfo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+func readModule(t *testing.T, path string) *wasm.Module {
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestReadLines(t *testing.T) {
+	// the line table of testdata/lines.wasm covers its two functions, and
+	// a function left out by the linker at address 0
+	m := readModule(t, "testdata/lines.wasm")
+	table, err := ReadLines(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := m.FunctionIndexSpace[0].Body.Offset
+	fill := m.FunctionIndexSpace[1].Body.Offset
+
+	for _, tc := range []struct {
+		offset int64
+		line   int
+	}{
+		{load, 141},
+		{load + 1, 141},
+		{load + 2, 142},
+		{load + 4, 142},
+		{load + 6, 0},
+		{fill, 150},
+		{fill + 6, 153},
+		{fill + 10, 153},
+		{fill + 11, 0},
+		{m.Code.Start, 0},
+		{0, 0},
+	} {
+		line, ok := table.Lookup(tc.offset)
+		if ok != (tc.line != 0) || line.Line != tc.line {
+			t.Errorf("offset %d: got=%v %v, want line %d", tc.offset, line, ok, tc.line)
+			continue
+		}
+		if ok && (line.File != "/src/token/lib.rs" || line.String() != "lib.rs:"+strconv.Itoa(tc.line)) {
+			t.Errorf("offset %d: unexpected line %+v (%v)", tc.offset, line, line)
+		}
+	}
+}
+
+func TestReadLinesMissing(t *testing.T) {
+	m := readModule(t, "../exec/testdata/load.wasm")
+	if _, err := ReadLines(m); err != ErrNoLineInfo {
+		t.Errorf("got=%v, want=%v", err, ErrNoLineInfo)
+	}
+}
+
+func TestReadSourceMap(t *testing.T) {
+	m := readModule(t, "../exec/testdata/load.wasm")
+	if _, err := ReadSourceMap(m, nil); err != ErrNoSourceMap {
+		t.Errorf("got=%v, want=%v", err, ErrNoSourceMap)
+	}
+
+	// the code of the first two functions of load.wasm, the second one
+	// mapped to a.ts:2:5 and b.ts:10:1 from its third byte
+	first := m.FunctionIndexSpace[0].Body.Offset
+	second := m.FunctionIndexSpace[1].Body.Offset
+	sourceMap := `{"version": 3, "sources": ["a.ts", "b.ts"], "mappings": "` +
+		vlq(first) + "," + vlq(second-first) + "ACI," + "ECQJA;" + `"}`
+	for _, embedded := range []bool{false, true} {
+		var table *LineTable
+		var err error
+		if embedded {
+			url := "data:application/json;base64," + base64.StdEncoding.EncodeToString([]byte(sourceMap))
+			var payload bytes.Buffer
+			leb128.WriteVarUint32(&payload, uint32(len(url)))
+			payload.WriteString(url)
+			m.AddCustomSection(SourceMappingURLSection, payload.Bytes())
+			if got, ok := SourceMappingURL(m); !ok || got != url {
+				t.Fatalf("got=%q %v, want=%q", got, ok, url)
+			}
+			table, err = ReadSourceMap(m, nil)
+		} else {
+			table, err = ReadSourceMap(m, []byte(sourceMap))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range []struct {
+			offset int64
+			line   Line
+		}{
+			{first, Line{}},
+			{second - 1, Line{}},
+			{second, Line{"a.ts", 2, 5}},
+			{second + 1, Line{"a.ts", 2, 5}},
+			{second + 2, Line{"b.ts", 10, 1}},
+			{m.Code.End - 1, Line{"b.ts", 10, 1}},
+			{m.Code.End, Line{}},
+		} {
+			if line, ok := table.Lookup(tc.offset); ok != (tc.line.Line != 0) || line != tc.line {
+				t.Errorf("offset %d: got=%+v %v, want=%+v", tc.offset, line, ok, tc.line)
+			}
+		}
+	}
+
+	for _, sourceMap := range []string{
+		`{"version": 3, "sources": [], "mappings": "AAAA"}`,
+		`{"version": 3, "sources": ["a.ts"], "mappings": "AA"}`,
+		`{"version": 3, "sources": ["a.ts"], "mappings": "AAAA;AAAA"}`,
+		`{"version": 3, "sources": ["a.ts"], "mappings": "g"}`,
+		`{"version": 3, "sources": ["a.ts"], "mappings": "A*AA"}`,
+	} {
+		if _, err := ReadSourceMap(m, []byte(sourceMap)); !errors.As(err, new(SourceMapError)) {
+			t.Errorf("%s: unexpected error %v", sourceMap, err)
+		}
+	}
+}
+
+// vlq returns the base64 VLQ of the positive v.
+func vlq(v int64) string {
+	const digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	s := ""
+	for u := uint64(v) << 1; ; {
+		d := u & 31
+		if u >>= 5; u != 0 {
+			d |= 32
+		}
+		s += string(digits[d])
+		if u == 0 {
+			return s
+		}
+	}
+}
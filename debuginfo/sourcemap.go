@@ -0,0 +1,174 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package debuginfo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+// SourceMappingURLSection is the name of the custom section holding the
+// URL of the source map of a module, as written by AssemblyScript and
+// Emscripten.
+const SourceMappingURLSection = "sourceMappingURL"
+
+// ErrNoSourceMap is returned by ReadSourceMap for a module without a
+// source map embedded in its sourceMappingURL section, when none is
+// provided.
+var ErrNoSourceMap = errors.New("debuginfo: the module has no embedded source map")
+
+// SourceMapError is returned by ReadSourceMap for an invalid source map.
+type SourceMapError struct {
+	Reason string
+}
+
+func (e SourceMapError) Error() string {
+	return "debuginfo: invalid source map: " + e.Reason
+}
+
+// SourceMappingURL returns the URL of the source map of m, from its
+// sourceMappingURL section, and false if it has none. The URL of a file is
+// usually relative to the one of the module.
+func SourceMappingURL(m *wasm.Module) (string, bool) {
+	payload, ok := m.CustomSection(SourceMappingURLSection)
+	if !ok {
+		return "", false
+	}
+	r := bytes.NewReader(payload)
+	n, err := leb128.ReadVarUint32(r)
+	if err != nil || int(n) != r.Len() {
+		return "", false
+	}
+	return string(payload[len(payload)-int(n):]), true
+}
+
+// sourceMapFile is a source map of revision 3, see
+// https://sourcemaps.info/spec.html. The generated code of the source map
+// of a module is a single line, whose columns are offsets in the module.
+type sourceMapFile struct {
+	Version    int      `json:"version"`
+	SourceRoot string   `json:"sourceRoot"`
+	Sources    []string `json:"sources"`
+	Mappings   string   `json:"mappings"`
+}
+
+// ReadSourceMap reads the line table of m from the JSON source map
+// sourceMap, or from the one embedded in the sourceMappingURL section of m
+// as a data URL if sourceMap is nil. The source maps of AssemblyScript
+// usually are files next to their module, see SourceMappingURL.
+func ReadSourceMap(m *wasm.Module, sourceMap []byte) (*LineTable, error) {
+	if sourceMap == nil {
+		url, _ := SourceMappingURL(m)
+		const prefix = "data:application/json;base64,"
+		if !strings.HasPrefix(url, prefix) {
+			return nil, ErrNoSourceMap
+		}
+		var err error
+		if sourceMap, err = base64.StdEncoding.DecodeString(url[len(prefix):]); err != nil {
+			return nil, SourceMapError{"data URL: " + err.Error()}
+		}
+	}
+	var s sourceMapFile
+	if err := json.Unmarshal(sourceMap, &s); err != nil {
+		return nil, SourceMapError{err.Error()}
+	}
+	if s.Version != 3 {
+		return nil, SourceMapError{fmt.Sprintf("version %d", s.Version)}
+	}
+	root := s.SourceRoot
+	if root != "" && !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+
+	t := &LineTable{}
+	var fields [4]int64 // the offset, source, line and column of the segment
+	for _, segment := range strings.Split(strings.TrimRight(s.Mappings, ";"), ",") {
+		if segment == "" {
+			continue
+		}
+		if strings.Contains(segment, ";") {
+			return nil, SourceMapError{"the generated code has more than one line"}
+		}
+		n := 0
+		for rest := segment; rest != ""; n++ {
+			v, size, err := readVLQ(rest)
+			if err != nil {
+				return nil, SourceMapError{fmt.Sprintf("segment %q: %v", segment, err)}
+			}
+			// the fifth field is the index of a name, unused
+			if n < len(fields) {
+				fields[n] += v
+			}
+			rest = rest[size:]
+		}
+		if n != 1 && n != 4 && n != 5 {
+			return nil, SourceMapError{fmt.Sprintf("segment %q has %d fields", segment, n)}
+		}
+		// a segment of a single field maps its code to no source
+		r := row{offset: fields[0], end: n == 1}
+		if !r.end {
+			if fields[1] < 0 || fields[1] >= int64(len(s.Sources)) {
+				return nil, SourceMapError{fmt.Sprintf("segment %q: no source %d", segment, fields[1])}
+			}
+			r.line = Line{File: root + s.Sources[fields[1]], Line: int(fields[2]) + 1, Column: int(fields[3]) + 1}
+		}
+		t.rows = append(t.rows, r)
+	}
+	if m.Code != nil {
+		t.rows = append(t.rows, row{offset: m.Code.End, end: true})
+	}
+
+	sort.SliceStable(t.rows, func(i, j int) bool {
+		a, b := t.rows[i], t.rows[j]
+		return a.offset < b.offset || a.offset == b.offset && a.end && !b.end
+	})
+	return t, nil
+}
+
+// readVLQ reads the base64 VLQ at the start of s, and returns its value
+// and its length.
+func readVLQ(s string) (int64, int, error) {
+	const digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	var v uint64
+	for i, shift := 0, uint(0); i < len(s); i, shift = i+1, shift+5 {
+		digit := strings.IndexByte(digits, s[i])
+		if digit < 0 {
+			return 0, 0, fmt.Errorf("invalid character %q", s[i])
+		}
+		if shift > 60 {
+			return 0, 0, errors.New("value overflow")
+		}
+		v |= uint64(digit&31) << shift
+		if digit&32 == 0 {
+			// the lowest bit is the sign
+			if v&1 != 0 {
+				return -int64(v >> 1), i + 1, nil
+			}
+			return int64(v >> 1), i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("unterminated value")
+}
@@ -0,0 +1,735 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package demangle turns the mangled symbols of C++ and Rust, found in the
+// name section of the modules they are compiled to, into readable names.
+package demangle
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxLength bounds the length of a demangled name, the substitutions
+	// of a mangled name expanding exponentially otherwise.
+	maxLength = 4096
+	// maxDepth bounds the nesting of the types of a mangled name.
+	maxDepth = 256
+)
+
+// Demangle returns the readable form of name if it is a symbol mangled by
+// the Itanium C++ ABI, or by the legacy mangling of Rust, and else name
+// itself, like for the symbols using a construct it doesn't support.
+//
+// The names are printed like c++filt does, a Rust symbol losing the hash
+// ending its path:
+//
+//	_ZN4core3fmt5write17h0f3ba4b6a1b4c6d2E  core::fmt::write
+//	_ZNK3foo3barEPKci                       foo::bar(char const*, int) const
+func Demangle(name string) string {
+	if !strings.HasPrefix(name, "_Z") {
+		return name
+	}
+	if s, ok := rust(name[2:]); ok {
+		return s
+	}
+	if s, ok := itanium(name[2:]); ok {
+		return s
+	}
+	return name
+}
+
+// rust demangles the legacy Rust symbol s, without its _Z prefix: a
+// nested name of source names, the last one being the hash of the symbol.
+func rust(s string) (string, bool) {
+	if !strings.HasPrefix(s, "N") {
+		return "", false
+	}
+	s = s[1:]
+	var parts []string
+	for !strings.HasPrefix(s, "E") {
+		n, i := 0, 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' && n <= len(s) {
+			n = n*10 + int(s[i]-'0')
+			i++
+		}
+		if i == 0 || n > len(s)-i {
+			return "", false
+		}
+		parts = append(parts, s[i:i+n])
+		s = s[i+n:]
+	}
+	// the suffixes LLVM adds to the symbols, like .llvm.123, are dropped
+	if s = s[1:]; s != "" && s[0] != '.' {
+		return "", false
+	}
+	if len(parts) < 2 || !isRustHash(parts[len(parts)-1]) {
+		return "", false
+	}
+
+	parts = parts[:len(parts)-1]
+	for i, part := range parts {
+		var ok bool
+		if parts[i], ok = unescapeRust(part); !ok {
+			return "", false
+		}
+	}
+	return strings.Join(parts, "::"), true
+}
+
+// isRustHash returns whether part is the hash ending a Rust symbol, an h
+// followed by 16 hexadecimal digits.
+func isRustHash(part string) bool {
+	if len(part) != 17 || part[0] != 'h' {
+		return false
+	}
+	for _, c := range part[1:] {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// rustEscapes are the characters a Rust symbol escapes between dollars.
+var rustEscapes = map[string]string{
+	"SP": "@", "BP": "*", "RF": "&", "LT": "<", "GT": ">", "LP": "(", "RP": ")", "C": ",",
+}
+
+// unescapeRust returns the part of a Rust path whose characters are
+// escaped.
+func unescapeRust(part string) (string, bool) {
+	// a part starting with a dollar is prefixed by an underscore
+	if strings.HasPrefix(part, "_$") {
+		part = part[1:]
+	}
+	var b strings.Builder
+	for part != "" {
+		switch {
+		case part[0] == '$':
+			end := strings.IndexByte(part[1:], '$')
+			if end < 0 {
+				return "", false
+			}
+			code := part[1 : end+1]
+			part = part[end+2:]
+			if s, ok := rustEscapes[code]; ok {
+				b.WriteString(s)
+				continue
+			}
+			if !strings.HasPrefix(code, "u") {
+				return "", false
+			}
+			r, err := strconv.ParseUint(code[1:], 16, 32)
+			if err != nil {
+				return "", false
+			}
+			b.WriteRune(rune(r))
+		case strings.HasPrefix(part, ".."):
+			b.WriteString("::")
+			part = part[2:]
+		default:
+			b.WriteByte(part[0])
+			part = part[1:]
+		}
+	}
+	return b.String(), true
+}
+
+// errMangled is the panic value of the demangler on a name it can't
+// demangle.
+type errMangled struct{}
+
+// demangler demangles a C++ symbol.
+type demangler struct {
+	s     string
+	subs  []string // the substitution candidates, see addSub
+	tmpl  []string // the template arguments of the function, see templateParam
+	quals string   // the qualifiers of the member function
+	depth int
+}
+
+// itanium demangles the C++ symbol s, without its _Z prefix.
+func itanium(s string) (name string, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(errMangled); !ok {
+				panic(r)
+			}
+			name, ok = "", false
+		}
+	}()
+	d := &demangler{s: s}
+	name = d.encoding()
+	switch {
+	case d.s == "":
+	case d.s[0] == '.':
+		name += " [clone " + d.s + "]"
+	default:
+		d.fail()
+	}
+	return name, len(name) <= maxLength
+}
+
+func (d *demangler) fail() {
+	panic(errMangled{})
+}
+
+// peek returns the next character, 0 at the end of the symbol.
+func (d *demangler) peek() byte {
+	if d.s == "" {
+		return 0
+	}
+	return d.s[0]
+}
+
+func (d *demangler) next() byte {
+	c := d.peek()
+	if c == 0 {
+		d.fail()
+	}
+	d.s = d.s[1:]
+	return c
+}
+
+func (d *demangler) expect(c byte) {
+	if d.next() != c {
+		d.fail()
+	}
+}
+
+// addSub adds a substitution candidate, referenced by a later S_.
+func (d *demangler) addSub(s string) {
+	if len(s) > maxLength {
+		d.fail()
+	}
+	d.subs = append(d.subs, s)
+}
+
+// number reads a decimal number, possibly negative.
+func (d *demangler) number() int {
+	neg := d.peek() == 'n'
+	if neg {
+		d.next()
+	}
+	n, i := 0, 0
+	for i < len(d.s) && d.s[i] >= '0' && d.s[i] <= '9' {
+		if n > maxLength {
+			d.fail()
+		}
+		n = n*10 + int(d.s[i]-'0')
+		i++
+	}
+	if i == 0 {
+		d.fail()
+	}
+	d.s = d.s[i:]
+	if neg {
+		return -n
+	}
+	return n
+}
+
+// encoding reads the name of a function and its parameters, or the name
+// of a variable.
+func (d *demangler) encoding() string {
+	name, template, special := d.name(true)
+	quals := d.quals
+	d.quals = ""
+	if c := d.peek(); c == 0 || c == 'E' || c == '.' {
+		return name
+	}
+	// the return type of the template functions comes first
+	if template && !special {
+		name = d.typ() + " " + name
+	}
+	params := d.params()
+	return name + "(" + params + ")" + quals
+}
+
+// params reads the parameters of a function, up to the end of its
+// encoding.
+func (d *demangler) params() string {
+	var params []string
+	for c := d.peek(); c != 0 && c != 'E' && c != '.'; c = d.peek() {
+		params = append(params, d.typ())
+	}
+	if len(params) == 1 && params[0] == "void" {
+		return ""
+	}
+	return strings.Join(params, ", ")
+}
+
+// name reads a name, and returns whether it ends with template arguments
+// and whether it is a constructor, a destructor or a conversion operator,
+// which have no return type. The template arguments of the name of the
+// encoding, read when top is true, are the ones of the function.
+func (d *demangler) name(top bool) (name string, template, special bool) {
+	switch c := d.peek(); {
+	case c == 'N':
+		return d.nested(top)
+	case c == 'Z':
+		// a local name: the encoding of the function and the entity
+		d.next()
+		fn := d.encoding()
+		d.expect('E')
+		if d.peek() == 's' {
+			d.next()
+			name = "string literal"
+		} else {
+			name, template, special = d.name(false)
+		}
+		if d.peek() == '_' {
+			d.next()
+			d.number()
+		}
+		return fn + "::" + name, template, special
+	case c == 'S' && strings.HasPrefix(d.s, "St"):
+		d.s = d.s[2:]
+		name, special = d.unqualified()
+		name = "std::" + name
+	case c == 'S':
+		// an unscoped template name can only be a substitution
+		name = d.substitution()
+		if d.peek() != 'I' {
+			d.fail()
+		}
+		return name + d.templateArgs(top), true, false
+	default:
+		name, special = d.unqualified()
+	}
+	if d.peek() == 'I' {
+		d.addSub(name)
+		return name + d.templateArgs(top), true, special
+	}
+	return name, false, special
+}
+
+// nested reads a nested name, N [qualifiers] prefixes E.
+func (d *demangler) nested(top bool) (name string, template, special bool) {
+	d.expect('N')
+	quals := d.cvQualifiers()
+	switch d.peek() {
+	case 'R':
+		d.next()
+		quals += " &"
+	case 'O':
+		d.next()
+		quals += " &&"
+	}
+	if top {
+		d.quals = quals
+	}
+
+	var last string // the last source name, naming the constructors
+	for d.peek() != 'E' {
+		var comp string
+		switch c := d.peek(); {
+		case c == 'S' && strings.HasPrefix(d.s, "St") && name == "":
+			d.s = d.s[2:]
+			name = "std"
+			continue
+		case c == 'S' && name == "":
+			name, template, special = d.substitution(), false, false
+			continue
+		case c == 'I':
+			if name == "" {
+				d.fail()
+			}
+			name += d.templateArgs(top)
+			template = true
+		case c == 'T' && name == "":
+			name = d.templateParam()
+		case (c == 'C' || c == 'D') && len(d.s) > 1 && d.s[1] >= '0' && d.s[1] <= '9':
+			if last == "" {
+				d.fail()
+			}
+			d.next()
+			if c == 'D' {
+				comp = "~"
+			}
+			comp += last
+			d.next()
+			template, special = false, true
+		default:
+			comp, special = d.unqualified()
+			template = false
+			if !special {
+				last = comp
+				if i := strings.IndexByte(last, '['); i > 0 {
+					last = last[:i]
+				}
+			}
+		}
+		if comp != "" {
+			if name != "" {
+				name += "::"
+			}
+			name += comp
+		}
+		if d.peek() != 'E' {
+			d.addSub(name)
+		}
+	}
+	d.next()
+	return name, template, special
+}
+
+// unqualified reads an unqualified name, and returns whether it is a
+// conversion operator.
+func (d *demangler) unqualified() (name string, conversion bool) {
+	switch c := d.peek(); {
+	case c >= '0' && c <= '9':
+		name = d.sourceName()
+	case c == 'L':
+		// the name of an entity with internal linkage
+		d.next()
+		name = d.sourceName()
+	case c == 'U':
+		name = d.unnamed()
+	case c >= 'a' && c <= 'z':
+		name, conversion = d.operator()
+	default:
+		d.fail()
+	}
+	for d.peek() == 'B' {
+		d.next()
+		name += "[abi:" + d.sourceName() + "]"
+	}
+	return name, conversion
+}
+
+func (d *demangler) sourceName() string {
+	n := d.number()
+	if n <= 0 || n > len(d.s) {
+		d.fail()
+	}
+	name := d.s[:n]
+	d.s = d.s[n:]
+	if strings.HasPrefix(name, "_GLOBAL__N") {
+		return "(anonymous namespace)"
+	}
+	return name
+}
+
+// unnamed reads the name of an unnamed type or of a lambda.
+func (d *demangler) unnamed() string {
+	d.expect('U')
+	switch d.next() {
+	case 't':
+		return "{unnamed type#" + d.discriminator() + "}"
+	case 'l':
+		params := d.params()
+		d.expect('E')
+		return "{lambda(" + params + ")#" + d.discriminator() + "}"
+	}
+	d.fail()
+	return ""
+}
+
+// discriminator reads the number of an unnamed entity, [n] _ numbering
+// it n+2.
+func (d *demangler) discriminator() string {
+	n := 1
+	if d.peek() != '_' {
+		n = d.number() + 2
+	}
+	d.expect('_')
+	return strconv.Itoa(n)
+}
+
+// operators are the names of the operators, by their code.
+var operators = map[string]string{
+	"nw": "new", "na": "new[]", "dl": "delete", "da": "delete[]",
+	"ps": "+", "ng": "-", "ad": "&", "de": "*", "co": "~",
+	"pl": "+", "mi": "-", "ml": "*", "dv": "/", "rm": "%", "an": "&", "or": "|", "eo": "^",
+	"aS": "=", "pL": "+=", "mI": "-=", "mL": "*=", "dV": "/=", "rM": "%=", "aN": "&=", "oR": "|=", "eO": "^=",
+	"ls": "<<", "rs": ">>", "lS": "<<=", "rS": ">>=",
+	"eq": "==", "ne": "!=", "lt": "<", "gt": ">", "le": "<=", "ge": ">=", "ss": "<=>",
+	"nt": "!", "aa": "&&", "oo": "||", "pp": "++", "mm": "--", "cm": ",",
+	"pm": "->*", "pt": "->", "cl": "()", "ix": "[]", "qu": "?",
+}
+
+// operator reads the name of an operator, and returns whether it is a
+// conversion operator.
+func (d *demangler) operator() (string, bool) {
+	if len(d.s) < 2 {
+		d.fail()
+	}
+	code := d.s[:2]
+	d.s = d.s[2:]
+	switch code {
+	case "cv":
+		return "operator " + d.typ(), true
+	case "li":
+		return `operator"" ` + d.sourceName(), false
+	}
+	op, ok := operators[code]
+	if !ok {
+		d.fail()
+	}
+	if op[0] >= 'a' && op[0] <= 'z' {
+		return "operator " + op, false
+	}
+	return "operator" + op, false
+}
+
+// cvQualifiers reads the qualifiers of a type or of a member function.
+func (d *demangler) cvQualifiers() string {
+	var restrict, volatile, constant bool
+	for {
+		switch d.peek() {
+		case 'r':
+			restrict = true
+		case 'V':
+			volatile = true
+		case 'K':
+			constant = true
+		default:
+			var quals string
+			if constant {
+				quals += " const"
+			}
+			if volatile {
+				quals += " volatile"
+			}
+			if restrict {
+				quals += " restrict"
+			}
+			return quals
+		}
+		d.next()
+	}
+}
+
+// builtins are the names of the builtin types, by their code.
+var builtins = map[byte]string{
+	'v': "void", 'w': "wchar_t", 'b': "bool", 'c': "char", 'a': "signed char", 'h': "unsigned char",
+	's': "short", 't': "unsigned short", 'i': "int", 'j': "unsigned int", 'l': "long", 'm': "unsigned long",
+	'x': "long long", 'y': "unsigned long long", 'n': "__int128", 'o': "unsigned __int128",
+	'f': "float", 'd': "double", 'e': "long double", 'g': "__float128", 'z': "...",
+}
+
+// extendedBuiltins are the names of the builtin types whose code starts
+// with D.
+var extendedBuiltins = map[byte]string{
+	'n': "decltype(nullptr)", 'a': "auto", 'c': "decltype(auto)",
+	'i': "char32_t", 's': "char16_t", 'u': "char8_t", 'h': "half",
+	'f': "decimal32", 'd': "decimal64", 'e': "decimal128",
+}
+
+// typ reads a type.
+func (d *demangler) typ() string {
+	if d.depth++; d.depth > maxDepth {
+		d.fail()
+	}
+	defer func() { d.depth-- }()
+
+	c := d.peek()
+	if name, ok := builtins[c]; ok {
+		d.next()
+		return name
+	}
+	var t string
+	switch c {
+	case 'D':
+		if len(d.s) < 2 {
+			d.fail()
+		}
+		if name, ok := extendedBuiltins[d.s[1]]; ok {
+			d.s = d.s[2:]
+			return name
+		}
+		if d.s[1] != 'p' {
+			d.fail()
+		}
+		d.s = d.s[2:]
+		t = d.typ() + "..."
+	case 'u':
+		d.next()
+		return d.sourceName()
+	case 'r', 'V', 'K':
+		quals := d.cvQualifiers()
+		t = d.typ() + quals
+	case 'P':
+		d.next()
+		t = d.typ() + "*"
+	case 'R':
+		d.next()
+		t = d.typ() + "&"
+	case 'O':
+		d.next()
+		t = d.typ() + "&&"
+	case 'A':
+		d.next()
+		n := d.number()
+		d.expect('_')
+		t = d.typ() + " [" + strconv.Itoa(n) + "]"
+	case 'M':
+		d.next()
+		class := d.typ()
+		if d.peek() == 'F' {
+			d.fail()
+		}
+		t = d.typ() + " " + class + "::*"
+	case 'T':
+		t = d.templateParam()
+		if d.peek() == 'I' {
+			d.addSub(t)
+			t += d.templateArgs(false)
+		}
+	case 'S':
+		if strings.HasPrefix(d.s, "St") {
+			t, _, _ = d.name(false)
+			break
+		}
+		t = d.substitution()
+		if d.peek() != 'I' {
+			return t
+		}
+		t += d.templateArgs(false)
+	case 'N', 'Z', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		t, _, _ = d.name(false)
+	default:
+		d.fail()
+	}
+	d.addSub(t)
+	return t
+}
+
+// templateArgs reads the template arguments of a name, which are the ones
+// of the function if top is true.
+func (d *demangler) templateArgs(top bool) string {
+	d.expect('I')
+	var args []string
+	for d.peek() != 'E' {
+		args = append(args, d.templateArg())
+	}
+	d.next()
+	if top {
+		d.tmpl = args
+	}
+	s := "<" + strings.Join(args, ", ")
+	if strings.HasSuffix(s, ">") {
+		s += " "
+	}
+	return s + ">"
+}
+
+func (d *demangler) templateArg() string {
+	switch d.peek() {
+	case 'L':
+		return d.literal()
+	case 'J':
+		// an argument pack
+		d.next()
+		var args []string
+		for d.peek() != 'E' {
+			args = append(args, d.templateArg())
+		}
+		d.next()
+		return strings.Join(args, ", ")
+	}
+	return d.typ()
+}
+
+// literal reads the literal value of a template argument, L type value E.
+func (d *demangler) literal() string {
+	d.expect('L')
+	if strings.HasPrefix(d.s, "_Z") {
+		d.s = d.s[2:]
+		s := d.encoding()
+		d.expect('E')
+		return s
+	}
+	t := d.typ()
+	n := strconv.Itoa(d.number())
+	d.expect('E')
+	switch t {
+	case "bool":
+		if n == "0" {
+			return "false"
+		}
+		return "true"
+	case "int":
+		return n
+	case "unsigned int":
+		return n + "u"
+	case "long":
+		return n + "l"
+	case "unsigned long":
+		return n + "ul"
+	}
+	return "(" + t + ")" + n
+}
+
+// templateParam reads a reference to a template argument of the function,
+// T_ for the first one and Tn_ for the n+2th.
+func (d *demangler) templateParam() string {
+	d.expect('T')
+	i := 0
+	if d.peek() != '_' {
+		i = d.number() + 1
+	}
+	d.expect('_')
+	if i < 0 || i >= len(d.tmpl) {
+		d.fail()
+	}
+	return d.tmpl[i]
+}
+
+// stdSubs are the names of the substitutions of the standard library.
+var stdSubs = map[byte]string{
+	'a': "std::allocator", 'b': "std::basic_string", 's': "std::string",
+	'i': "std::istream", 'o': "std::ostream", 'd': "std::iostream",
+}
+
+// substitution reads a reference to a substitution candidate, S_ for the
+// first one and Sn_ for the n+2th, n being in base 36, or to a name of the
+// standard library.
+func (d *demangler) substitution() string {
+	d.expect('S')
+	c := d.next()
+	if name, ok := stdSubs[c]; ok {
+		return name
+	}
+	i := 0
+	if c != '_' {
+		n := 0
+		for ; c != '_'; c = d.next() {
+			var digit int
+			switch {
+			case c >= '0' && c <= '9':
+				digit = int(c - '0')
+			case c >= 'A' && c <= 'Z':
+				digit = int(c-'A') + 10
+			default:
+				d.fail()
+			}
+			if n > len(d.subs) {
+				d.fail()
+			}
+			n = n*36 + digit
+		}
+		i = n + 1
+	}
+	if i >= len(d.subs) {
+		d.fail()
+	}
+	return d.subs[i]
+}
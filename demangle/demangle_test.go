@@ -0,0 +1,66 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package demangle
+
+import "testing"
+
+func TestDemangle(t *testing.T) {
+	for _, test := range []struct {
+		name, want string
+	}{
+		// Rust
+		{"_ZN4core3fmt5write17h0f3ba4b6a1b4c6d2E", "core::fmt::write"},
+		{"_ZN60_$LT$alloc..string..String$u20$as$u20$core..fmt..Display$GT$3fmt17h3ab0e0b1c2d3e4f5E.llvm.42",
+			"<alloc::string::String as core::fmt::Display>::fmt"},
+		{"_ZN3std2rt10lang_start28_$u7b$$u7b$closure$u7d$$u7d$17h0123456789abcdefE", "std::rt::lang_start::{{closure}}"},
+
+		// C++
+		{"_Z3foov", "foo()"},
+		{"_Z3fooi", "foo(int)"},
+		{"_ZN3foo3barEPKci", "foo::bar(char const*, int)"},
+		{"_ZNK3foo3barEv", "foo::bar() const"},
+		{"_ZN3fooC1Ev", "foo::foo()"},
+		{"_ZN3fooD2Ev", "foo::~foo()"},
+		{"_ZN3fooplERKS_", "foo::operator+(foo const&)"},
+		{"_ZN1N1TIiiE2mfES0_IddE", "N::T<int, int>::mf(N::T<double, double>)"},
+		{"_Z1fIiEvT_", "void f<int>(int)"},
+		{"_ZNSt6vectorIiSaIiEE9push_backERKi", "std::vector<int, std::allocator<int> >::push_back(int const&)"},
+		{"_ZNKSt3__112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE4sizeEv",
+			"std::__1::basic_string<char, std::__1::char_traits<char>, std::__1::allocator<char> >::size() const"},
+		{"_ZN12_GLOBAL__N_13fooEv", "(anonymous namespace)::foo()"},
+		{"_Z3fooILi3EEvv", "void foo<3>()"},
+		{"_Z3fooA10_i", "foo(int [10])"},
+		{"_ZN3foocviEv", "foo::operator int()"},
+		{"_Z3foov.cold", "foo() [clone .cold]"},
+		{"_ZZ4mainE1x", "main::x"},
+		{"_Z3foo", "foo"},
+		{"_ZTV3foo", "_ZTV3foo"},
+
+		// not mangled, or not supported
+		{"main", "main"},
+		{"_Z", "_Z"},
+		{"_Z4foo", "_Z4foo"},
+		{"_Z3fooPFviE", "_Z3fooPFviE"},
+		{"_Z1fS_", "_Z1fS_"},
+		{"_Z1fT_", "_Z1fT_"},
+	} {
+		if got := Demangle(test.name); got != test.want {
+			t.Errorf("Demangle(%q): got=%q, want=%q", test.name, got, test.want)
+		}
+	}
+}
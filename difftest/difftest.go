@@ -0,0 +1,223 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+// Package difftest runs modules under the VM and under a reference
+// runtime, and compares what they do, for the bugs of the interpreter
+// which would make the nodes of a chain disagree to be found before they
+// do:
+//
+//	calls := []difftest.Call{{Export: "div", Args: []uint64{7, 2}}, {Export: "div", Args: []uint64{1, 0}}}
+//	divergences, err := difftest.Compare(code, calls, difftest.VM{}, difftest.Node{})
+//
+// Both runtimes instantiate the module, without imports, and make the
+// calls in order on the instance. Compare flags the instantiations which
+// fail under one runtime only, and the calls whose results differ, which
+// trap under one runtime only, or after which the exported memory differs.
+//
+// The messages of the traps are not compared, the runtimes wording them
+// differently, and neither are the payloads of the NaNs, which the spec
+// leaves to the runtimes and which JavaScript engines don't preserve
+// across calls: any two NaNs of the same type are equal. The references
+// are compared by their nullness only.
+package difftest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// Call is a call of an exported function, with the raw bits of its
+// arguments, as taken by exec.VM.ExecCodeValues.
+type Call struct {
+	Export string
+	Args   []uint64
+}
+
+// Outcome is what a call did: its results, as raw bits, or its trap, and
+// the digest of the exported memory once it returned.
+type Outcome struct {
+	Results []uint64
+	Trapped bool
+	Trap    string
+	// Memory is the SHA-256 digest of the first memory, if the module
+	// exports it, and is zero otherwise.
+	Memory [sha256.Size]byte
+}
+
+// Result is what a runtime did with a module: the error failing its
+// instantiation, if any, or the outcomes of the calls.
+type Result struct {
+	InstantiateErr string
+	Outcomes       []Outcome
+}
+
+// Runtime runs the calls of the exported functions of modules.
+type Runtime interface {
+	// Name is the name of the runtime, in the divergences.
+	Name() string
+	// Run instantiates the module code and makes the calls in order on
+	// the instance. The failures of the module, to instantiate or in a
+	// call, are in the result: the error is a failure of the runtime.
+	Run(code []byte, calls []Call) (*Result, error)
+}
+
+// Divergence is a call, or the instantiation, the runtimes disagree on.
+type Divergence struct {
+	// Call is the index of the call, -1 for the instantiation.
+	Call   int
+	Export string
+	Msg    string
+}
+
+func (d Divergence) Error() string {
+	if d.Call < 0 {
+		return fmt.Sprintf("difftest: instantiation: %s", d.Msg)
+	}
+	return fmt.Sprintf("difftest: call %d of %s: %s", d.Call, d.Export, d.Msg)
+}
+
+// Compare runs the calls on the module code under the runtimes a and b,
+// and returns the divergences between them, the one of the instantiation
+// or the ones of the calls in order. It returns an error if a runtime
+// failed.
+func Compare(code []byte, calls []Call, a, b Runtime) ([]Divergence, error) {
+	resA, err := a.Run(code, calls)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", a.Name(), err)
+	}
+	resB, err := b.Run(code, calls)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+
+	if (resA.InstantiateErr == "") != (resB.InstantiateErr == "") {
+		return []Divergence{{Call: -1, Msg: fmt.Sprintf("%s: %s, %s: %s",
+			a.Name(), failure(resA.InstantiateErr), b.Name(), failure(resB.InstantiateErr))}}, nil
+	}
+	if resA.InstantiateErr != "" {
+		return nil, nil
+	}
+	if len(resA.Outcomes) != len(calls) || len(resB.Outcomes) != len(calls) {
+		return nil, fmt.Errorf("%d calls, %s made %d, %s made %d", len(calls), a.Name(), len(resA.Outcomes), b.Name(), len(resB.Outcomes))
+	}
+
+	// the types of the results, for their comparison
+	module, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		return nil, err
+	}
+	var divergences []Divergence
+	for i, call := range calls {
+		outA, outB := resA.Outcomes[i], resB.Outcomes[i]
+		var types []wasm.ValueType
+		if sig := exportedSig(module, call.Export); sig != nil {
+			types = sig.ReturnTypes
+		}
+		diverge := func(format string, args ...interface{}) {
+			divergences = append(divergences, Divergence{Call: i, Export: call.Export, Msg: fmt.Sprintf(format, args...)})
+		}
+		switch {
+		case outA.Trapped != outB.Trapped:
+			diverge("%s: %s, %s: %s", a.Name(), outcome(outA), b.Name(), outcome(outB))
+		case !outA.Trapped && !equalResults(types, outA.Results, outB.Results):
+			diverge("%s: %s, %s: %s", a.Name(), outcome(outA), b.Name(), outcome(outB))
+		}
+		if outA.Memory != outB.Memory {
+			diverge("memory: %s: %x, %s: %x", a.Name(), outA.Memory[:8], b.Name(), outB.Memory[:8])
+		}
+	}
+	return divergences, nil
+}
+
+// failure describes the failure err of an instantiation.
+func failure(err string) string {
+	if err == "" {
+		return "instantiated"
+	}
+	return err
+}
+
+// outcome describes the results or the trap of o.
+func outcome(o Outcome) string {
+	if o.Trapped {
+		return "trap " + o.Trap
+	}
+	return fmt.Sprintf("%#x", o.Results)
+}
+
+// exportedSig returns the signature of the function module exports as
+// name, nil if there is none.
+func exportedSig(module *wasm.Module, name string) *wasm.FunctionSig {
+	if module.Export == nil {
+		return nil
+	}
+	export, ok := module.Export.Entries[name]
+	if !ok || export.Kind != wasm.ExternalFunction {
+		return nil
+	}
+	if fn := module.GetFunction(int(export.Index)); fn != nil {
+		return fn.Sig
+	}
+	return nil
+}
+
+// equalResults returns whether the results a and b of a call, of the
+// given types, are equal, any NaNs of the same type being equal and the
+// references being compared by their nullness.
+func equalResults(types []wasm.ValueType, a, b []uint64) bool {
+	if len(a) != len(b) || len(a) != disasm.Slots(types...) {
+		return false
+	}
+	for _, t := range types {
+		if t == wasm.ValueTypeV128 {
+			if a[0] != b[0] || a[1] != b[1] {
+				return false
+			}
+			a, b = a[2:], b[2:]
+			continue
+		}
+		if !equalValue(t, a[0], b[0]) {
+			return false
+		}
+		a, b = a[1:], b[1:]
+	}
+	return true
+}
+
+// equalValue returns whether the values a and b of type t are equal.
+func equalValue(t wasm.ValueType, a, b uint64) bool {
+	switch {
+	case a == b:
+		return true
+	case t == wasm.ValueTypeF32:
+		return isNaN32(a) && isNaN32(b)
+	case t == wasm.ValueTypeF64:
+		return math.IsNaN(math.Float64frombits(a)) && math.IsNaN(math.Float64frombits(b))
+	case t.IsRef():
+		return a != uint64(wasm.NullRef) && b != uint64(wasm.NullRef)
+	}
+	return false
+}
+
+func isNaN32(bits uint64) bool {
+	f := math.Float32frombits(uint32(bits))
+	return f != f
+}
@@ -0,0 +1,151 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package difftest
+
+import (
+	"math"
+	osexec "os/exec"
+	"testing"
+	"time"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wat"
+)
+
+const testModule = `(module
+  (memory (export "mem") 1)
+  (global $count (mut i64) (i64.const 0))
+  (func (export "add") (param i32 i32) (result i32) (i32.add (local.get 0) (local.get 1)))
+  (func (export "div") (param i32 i32) (result i32) (i32.div_s (local.get 0) (local.get 1)))
+  (func (export "nan") (result f32) (f32.div (f32.const 0) (f32.const 0)))
+  (func (export "store") (param i32) (i32.store (i32.const 0) (local.get 0)))
+  (func (export "count") (param i64) (result i64)
+    (global.set $count (i64.add (global.get $count) (local.get 0)))
+    (global.get $count))
+  (func (export "sqrt") (param f64) (result f64) (f64.sqrt (local.get 0)))
+  (func (export "swap") (param i32 i64) (result i64 i32) (local.get 1) (local.get 0))
+  (func (export "load") (param i32) (result i32) (i32.load (local.get 0)))
+  (func $recurse (export "recurse") (call $recurse))
+  (func (export "null") (result funcref) (ref.null func)))`
+
+var testCalls = []Call{
+	{Export: "add", Args: []uint64{1, 0xffffffff}},
+	{Export: "div", Args: []uint64{1, 0}},
+	{Export: "nan"},
+	{Export: "store", Args: []uint64{0xdeadbeef}},
+	{Export: "count", Args: []uint64{1 << 40}},
+	{Export: "count", Args: []uint64{math.MaxUint64}},
+	{Export: "sqrt", Args: []uint64{math.Float64bits(2)}},
+	{Export: "sqrt", Args: []uint64{math.Float64bits(-1)}},
+	{Export: "swap", Args: []uint64{7, 1 << 63}},
+	{Export: "load", Args: []uint64{65535}},
+	{Export: "recurse"},
+	{Export: "null"},
+}
+
+// altered is the runtime of the VM altering its results.
+type altered struct {
+	VM
+	alter func(*Result)
+}
+
+func (r altered) Run(code []byte, calls []Call) (*Result, error) {
+	res, err := r.VM.Run(code, calls)
+	if err == nil {
+		r.alter(res)
+	}
+	return res, err
+}
+
+func TestCompare(t *testing.T) {
+	code, err := wat.Assemble([]byte(testModule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name  string
+		alter func(*Result)
+		calls []int
+	}{
+		{"same", func(*Result) {}, nil},
+		{"results", func(res *Result) { res.Outcomes[0].Results[0]++ }, []int{0}},
+		{"nan payload", func(res *Result) { res.Outcomes[2].Results[0] = 0x7fc00001 }, nil},
+		{"nan", func(res *Result) { res.Outcomes[2].Results[0] = 0 }, []int{2}},
+		{"trap", func(res *Result) { res.Outcomes[1].Trapped, res.Outcomes[1].Results = false, []uint64{0} }, []int{1}},
+		{"memory", func(res *Result) { res.Outcomes[3].Memory[0] ^= 1 }, []int{3}},
+		{"multi-value", func(res *Result) { res.Outcomes[8].Results[1] = 8 }, []int{8}},
+		{"ref", func(res *Result) { res.Outcomes[11].Results[0] = 0 }, []int{11}},
+		{"instantiation", func(res *Result) { *res = Result{InstantiateErr: "unlinkable"} }, []int{-1}},
+	} {
+		divergences, err := Compare(code, testCalls, VM{}, altered{alter: test.alter})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var calls []int
+		for _, d := range divergences {
+			calls = append(calls, d.Call)
+		}
+		if len(calls) != len(test.calls) || len(calls) != 0 && calls[0] != test.calls[0] {
+			t.Errorf("%s: unexpected divergences: %v", test.name, divergences)
+		}
+	}
+
+	// the divergences of the memory are flagged along with the ones of the
+	// results
+	divergences, err := Compare(code, testCalls, VM{}, altered{alter: func(res *Result) {
+		res.Outcomes[4].Results[0] = 0
+		res.Outcomes[4].Memory[0] ^= 1
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(divergences) != 2 {
+		t.Errorf("unexpected divergences: %v", divergences)
+	}
+	if _, err := Compare(code, []Call{{Export: "missing"}}, VM{}, VM{}); err == nil {
+		t.Error("call of a missing export compared")
+	}
+}
+
+func TestNode(t *testing.T) {
+	path, err := osexec.LookPath("node")
+	if err != nil {
+		t.Skip("node isn't installed")
+	}
+	code, err := wat.Assemble([]byte(testModule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := VM{Config: exec.VMConfig{MaxExecutionTime: time.Second}}
+	node := Node{Path: path, Timeout: 30 * time.Second}
+	divergences, err := Compare(code, testCalls, vm, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range divergences {
+		t.Error(d)
+	}
+
+	// a module both runtimes reject doesn't diverge
+	divergences, err = Compare([]byte("\x00asm\x01\x00\x00\x00\x01"), nil, vm, node)
+	if err != nil || len(divergences) != 0 {
+		t.Errorf("unexpected divergences: %v, %v", divergences, err)
+	}
+	if _, err := node.Run([]byte("\x00asm\x01\x00\x00\x00"), []Call{{Export: "f"}}); err == nil {
+		t.Error("call of a missing export run")
+	}
+}
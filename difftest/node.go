@@ -0,0 +1,229 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package difftest
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	osexec "os/exec"
+	"strconv"
+	"time"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// nodeScript is the program run by node for Node.Run, reading a
+// nodeRequest from its standard input and writing a nodeResult to its
+// standard output. The values are passed as the decimal strings of their
+// bits, which JSON numbers can't hold.
+const nodeScript = `
+const crypto = require('crypto');
+const nullRef = 0xffffffffn;
+const view = new DataView(new ArrayBuffer(8));
+const toJS = (t, s) => {
+  const bits = BigInt(s);
+  switch (t) {
+  case 'i32': return Number(BigInt.asIntN(32, bits));
+  case 'i64': return BigInt.asIntN(64, bits);
+  case 'f32': view.setUint32(0, Number(bits & 0xffffffffn), true); return view.getFloat32(0, true);
+  case 'f64': view.setBigUint64(0, bits, true); return view.getFloat64(0, true);
+  }
+  return null;
+};
+const fromJS = (t, v) => {
+  switch (t) {
+  case 'i32': return String(v >>> 0);
+  case 'i64': return BigInt.asUintN(64, v).toString();
+  case 'f32': view.setFloat32(0, v, true); return String(view.getUint32(0, true));
+  case 'f64': view.setFloat64(0, v, true); return view.getBigUint64(0, true).toString();
+  }
+  return v === null ? nullRef.toString() : '0';
+};
+let input = '';
+process.stdin.on('data', d => input += d);
+process.stdin.on('end', () => {
+  const req = JSON.parse(input);
+  const res = {instantiateErr: '', outcomes: []};
+  let instance;
+  try {
+    instance = new WebAssembly.Instance(new WebAssembly.Module(Buffer.from(req.code, 'base64')), {});
+  } catch (e) {
+    res.instantiateErr = String(e.message || e) || 'instantiation failed';
+    process.stdout.write(JSON.stringify(res));
+    return;
+  }
+  for (const c of req.calls) {
+    const args = c.args.map((s, i) => toJS(c.params[i], s));
+    const out = {results: [], trapped: false, trap: '', memory: ''};
+    try {
+      let r = instance.exports[c.export](...args);
+      if (c.results.length === 1) {
+        r = [r];
+      }
+      out.results = c.results.map((t, i) => fromJS(t, r[i]));
+    } catch (e) {
+      out.trapped = true;
+      out.trap = String(e.message || e);
+    }
+    if (req.memory) {
+      out.memory = crypto.createHash('sha256').update(new Uint8Array(instance.exports[req.memory].buffer)).digest('hex');
+    }
+    res.outcomes.push(out);
+  }
+  process.stdout.write(JSON.stringify(res));
+});
+`
+
+// Node is the Runtime of the WebAssembly engine of Node.js, the V8 one,
+// run as a node process per module. It only runs the modules without
+// imports, and the calls whose arguments and results JavaScript can
+// hold: no v128, and no references but the null ones as arguments.
+type Node struct {
+	// Path is the path of the node executable, found in the PATH if
+	// empty.
+	Path string
+	// Timeout, if not zero, is the time the process may run for, which
+	// stops the calls looping forever.
+	Timeout time.Duration
+}
+
+// nodeRequest is the input of nodeScript.
+type nodeRequest struct {
+	Code   []byte     `json:"code"`
+	Memory string     `json:"memory"`
+	Calls  []nodeCall `json:"calls"`
+}
+
+type nodeCall struct {
+	Export  string   `json:"export"`
+	Args    []string `json:"args"`
+	Params  []string `json:"params"`
+	Results []string `json:"results"`
+}
+
+// nodeResult is the output of nodeScript.
+type nodeResult struct {
+	InstantiateErr string `json:"instantiateErr"`
+	Outcomes       []struct {
+		Results []string `json:"results"`
+		Trapped bool     `json:"trapped"`
+		Trap    string   `json:"trap"`
+		Memory  string   `json:"memory"`
+	} `json:"outcomes"`
+}
+
+// Name returns "node".
+func (r Node) Name() string {
+	return "node"
+}
+
+// Run runs the module code and the calls in a node process. A module the
+// decoder of the VM rejects is only instantiated, its calls being typed
+// from its decoded exports.
+func (r Node) Run(code []byte, calls []Call) (*Result, error) {
+	req := nodeRequest{Code: code, Calls: []nodeCall{}}
+	if module, err := wasm.ReadModule(bytes.NewReader(code), nil); err == nil {
+		if module.Import != nil && len(module.Import.Entries) != 0 {
+			return nil, fmt.Errorf("node doesn't run modules with imports")
+		}
+		req.Memory, _ = memoryExport(module)
+		for _, call := range calls {
+			c, err := r.call(module, call)
+			if err != nil {
+				return nil, err
+			}
+			req.Calls = append(req.Calls, c)
+		}
+	}
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := stdcontext.Background()
+	if r.Timeout != 0 {
+		var cancel stdcontext.CancelFunc
+		ctx, cancel = stdcontext.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	path := r.Path
+	if path == "" {
+		path = "node"
+	}
+	cmd := osexec.CommandContext(ctx, path, "-e", nodeScript)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(input), &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("node: %v", ctx.Err())
+		}
+		return nil, fmt.Errorf("node: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var out nodeResult
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("node: %v", err)
+	}
+	res := &Result{InstantiateErr: out.InstantiateErr}
+	for _, o := range out.Outcomes {
+		outcome := Outcome{Trapped: o.Trapped, Trap: o.Trap}
+		for _, s := range o.Results {
+			v, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("node: %v", err)
+			}
+			outcome.Results = append(outcome.Results, v)
+		}
+		if o.Memory != "" {
+			if _, err := hex.Decode(outcome.Memory[:], []byte(o.Memory)); err != nil {
+				return nil, fmt.Errorf("node: %v", err)
+			}
+		}
+		res.Outcomes = append(res.Outcomes, outcome)
+	}
+	return res, nil
+}
+
+// call returns the call of nodeScript for call, typed from the signature
+// of the exported function of module.
+func (r Node) call(module *wasm.Module, call Call) (nodeCall, error) {
+	sig := exportedSig(module, call.Export)
+	if sig == nil {
+		return nodeCall{}, fmt.Errorf("no exported function %q", call.Export)
+	}
+	if len(call.Args) != len(sig.ParamTypes) {
+		return nodeCall{}, fmt.Errorf("%s takes %d arguments, got %d", call.Export, len(sig.ParamTypes), len(call.Args))
+	}
+	c := nodeCall{Export: call.Export, Args: []string{}, Params: []string{}, Results: []string{}}
+	for i, t := range sig.ParamTypes {
+		if t == wasm.ValueTypeV128 || t.IsRef() && call.Args[i] != uint64(wasm.NullRef) {
+			return nodeCall{}, fmt.Errorf("%s: node can't pass a %v argument", call.Export, t)
+		}
+		c.Args = append(c.Args, strconv.FormatUint(call.Args[i], 10))
+		c.Params = append(c.Params, t.String())
+	}
+	for _, t := range sig.ReturnTypes {
+		if t == wasm.ValueTypeV128 {
+			return nodeCall{}, fmt.Errorf("%s: node can't return a v128", call.Export)
+		}
+		c.Results = append(c.Results, t.String())
+	}
+	return c, nil
+}
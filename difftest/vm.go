@@ -0,0 +1,106 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package difftest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// VM is the Runtime of this VM, whose instances use Config. A limit on
+// the execution, such as Config.MaxExecutionTime, keeps a call looping
+// forever from hanging the comparison.
+type VM struct {
+	Config exec.VMConfig
+}
+
+// Name returns "wasmvm".
+func (r VM) Name() string {
+	return "wasmvm"
+}
+
+// Run instantiates the module code with r.Config, and makes the calls on
+// a single VM of the instance.
+func (r VM) Run(code []byte, calls []Call) (*Result, error) {
+	module, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		return &Result{InstantiateErr: err.Error()}, nil
+	}
+	inst, err := r.instantiate(module)
+	if err != nil {
+		return &Result{InstantiateErr: err.Error()}, nil
+	}
+	defer inst.Close()
+
+	_, memory := memoryExport(module)
+	vm := inst.NewVM()
+	res := &Result{}
+	for _, call := range calls {
+		fn, ok := inst.ExportedFunction(call.Export)
+		if !ok {
+			return nil, fmt.Errorf("no exported function %q", call.Export)
+		}
+		var out Outcome
+		if results, err := execCall(vm, int64(fn.Index), call.Args); err != nil {
+			out.Trapped, out.Trap = true, err.Error()
+		} else {
+			out.Results = results
+		}
+		if memory {
+			out.Memory = sha256.Sum256(vm.Memory())
+		}
+		res.Outcomes = append(res.Outcomes, out)
+	}
+	return res, nil
+}
+
+// instantiate compiles and instantiates module, returning the trap of
+// its start function as an error.
+func (r VM) instantiate(module *wasm.Module) (inst *exec.Instance, err error) {
+	compiled, err := exec.CompileModule(module, r.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer exec.RecoverTrap(&err)
+	return compiled.Instantiate(nil)
+}
+
+// execCall calls the function with the given index on vm, returning its
+// trap as an error.
+func execCall(vm *exec.VM, fnIndex int64, args []uint64) (results []uint64, err error) {
+	defer exec.RecoverTrap(&err)
+	return vm.ExecCodeValues(fnIndex, args...)
+}
+
+// memoryExport returns the name module exports its first memory as, whose
+// digest is then part of the outcomes of the calls, and false if it
+// doesn't.
+func memoryExport(module *wasm.Module) (string, bool) {
+	if module.Export == nil {
+		return "", false
+	}
+	for _, export := range module.Exports() {
+		if export.Kind == wasm.ExternalMemory && export.Index == 0 {
+			return export.FieldStr, true
+		}
+	}
+	return "", false
+}
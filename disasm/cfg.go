@@ -0,0 +1,261 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package disasm
+
+import (
+	"sort"
+
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// BasicBlock is a straight sequence of instructions of a function, only
+// entered by its first instruction and only left after its last one.
+type BasicBlock struct {
+	Start int   // The index in Disassembly.Code of the first instruction
+	End   int   // The index in Disassembly.Code past the last instruction
+	Succs []int // The blocks control can go to from the end of the block
+	Preds []int // The blocks control can come from to the start of the block
+	// Loop is the index in CFG.Loops of the innermost loop the block is
+	// part of, -1 if none.
+	Loop int
+}
+
+// Loop is a loop of a function: a loop block branched to from its body.
+type Loop struct {
+	Header int   // The block starting with the loop instruction
+	Blocks []int // The blocks of the loop, the header first, in the order of the code
+	// Parent is the index in CFG.Loops of the loop holding this one, -1
+	// if none.
+	Parent int
+}
+
+// CFG is the control-flow graph of a function, whose nodes are the basic
+// blocks of its code. The blocks are indexed in the order of the code, the
+// entry block being the first one, and the blocks without successors leave
+// the function, or trap.
+//
+// The handlers of a try block are the successors of the try instruction
+// rather than of the instructions that may throw, and a throw, a rethrow
+// or a delegate never goes to a handler of the function.
+type CFG struct {
+	Blocks []BasicBlock
+	Loops  []Loop // The loops of the function, outer ones first
+}
+
+// construct is a block, loop, if or try of the code, with the indices of
+// its else or catch instructions and of its end.
+type construct struct {
+	start    int
+	handlers []int // the index of else, or of every catch and catch_all
+	end      int
+}
+
+// BuildCFG builds the control-flow graph of a function from its
+// disassembly, see Disassemble.
+func BuildCFG(d *Disassembly) *CFG {
+	code := d.Code
+
+	// the constructs of the code, indexed by the instructions starting,
+	// continuing and ending them
+	constructs := make(map[int]*construct)
+	var open []*construct
+	for i, instr := range code {
+		switch instr.Op.Code {
+		case ops.Block, ops.Loop, ops.If, ops.Try:
+			c := &construct{start: i, end: len(code)}
+			constructs[i] = c
+			open = append(open, c)
+		case ops.Else, ops.Catch, ops.CatchAll:
+			if len(open) != 0 {
+				c := open[len(open)-1]
+				c.handlers = append(c.handlers, i)
+				constructs[i] = c
+			}
+		case ops.End, ops.Delegate:
+			if len(open) != 0 {
+				c := open[len(open)-1]
+				open = open[:len(open)-1]
+				c.end = i
+				constructs[i] = c
+			}
+		}
+	}
+
+	// the leaders are the instructions starting the blocks: the first
+	// one, the targets of the branches and the ones following a jump
+	leaders := map[int]bool{0: true}
+	for i, instr := range code {
+		switch instr.Op.Code {
+		case ops.Loop, ops.End, ops.Delegate, ops.Catch, ops.CatchAll:
+			leaders[i] = true
+		}
+		if isJump(instr.Op.Code) {
+			leaders[i+1] = true
+		}
+	}
+	var starts []int
+	for i := range leaders {
+		if i < len(code) {
+			starts = append(starts, i)
+		}
+	}
+	sort.Ints(starts)
+
+	cfg := &CFG{Blocks: make([]BasicBlock, len(starts))}
+	blockOf := make([]int, len(code))
+	for b, start := range starts {
+		end := len(code)
+		if b+1 < len(starts) {
+			end = starts[b+1]
+		}
+		cfg.Blocks[b] = BasicBlock{Start: start, End: end, Loop: -1}
+		for i := start; i < end; i++ {
+			blockOf[i] = b
+		}
+	}
+
+	// fall returns the instruction run after the one at index i when it
+	// doesn't jump, -1 if the function returns: the end of a try once the
+	// code before a handler is done.
+	fall := func(i int) int {
+		next := i + 1
+		if next >= len(code) {
+			return -1
+		}
+		if op := code[next].Op.Code; op == ops.Catch || op == ops.CatchAll {
+			return constructs[next].end
+		}
+		return next
+	}
+
+	// the constructs holding the current instruction, to resolve the
+	// labels of the branches
+	open = open[:0]
+	// target returns the instruction a branch to the label at depth goes
+	// to, -1 if it returns.
+	target := func(depth uint32) int {
+		if int(depth) >= len(open) {
+			return -1
+		}
+		c := open[len(open)-1-int(depth)]
+		if code[c.start].Op.Code == ops.Loop {
+			return c.start
+		}
+		return c.end
+	}
+
+	backEdges := make(map[int]bool) // the loops branched to from their body
+	for b := range cfg.Blocks {
+		block := &cfg.Blocks[b]
+		var succs []int
+		for i := block.Start; i < block.End; i++ {
+			instr := code[i]
+			switch instr.Op.Code {
+			case ops.Block, ops.Loop, ops.If, ops.Try:
+				open = append(open, constructs[i])
+			case ops.End, ops.Delegate:
+				if constructs[i] != nil {
+					open = open[:len(open)-1]
+				}
+			}
+			if i != block.End-1 {
+				continue
+			}
+
+			switch instr.Op.Code {
+			case ops.Br:
+				succs = append(succs, target(instr.Immediates[0].(uint32)))
+			case ops.BrIf, ops.BrOnNull, ops.BrOnNonNull:
+				succs = append(succs, target(instr.Immediates[0].(uint32)), fall(i))
+			case ops.BrTable:
+				for _, depth := range instr.Immediates[1:] {
+					succs = append(succs, target(depth.(uint32)))
+				}
+			case ops.If:
+				c := constructs[i]
+				if len(c.handlers) != 0 {
+					succs = append(succs, i+1, c.handlers[0]+1)
+				} else {
+					succs = append(succs, i+1, c.end)
+				}
+			case ops.Else:
+				succs = append(succs, constructs[i].end)
+			case ops.Try:
+				succs = append(succs, i+1)
+				succs = append(succs, constructs[i].handlers...)
+			case ops.Return, ops.Unreachable, ops.Throw, ops.Rethrow,
+				ops.ReturnCall, ops.ReturnCallIndirect, ops.ReturnCallRef:
+			default:
+				succs = append(succs, fall(i))
+			}
+		}
+
+		seen := make(map[int]bool)
+		for _, i := range succs {
+			if i < 0 || i >= len(code) || seen[blockOf[i]] {
+				continue
+			}
+			succ := blockOf[i]
+			seen[succ] = true
+			block.Succs = append(block.Succs, succ)
+			cfg.Blocks[succ].Preds = append(cfg.Blocks[succ].Preds, b)
+			if code[i].Op.Code == ops.Loop && succ <= b {
+				backEdges[i] = true
+			}
+		}
+	}
+
+	// the loops are the loop constructs with a back edge, holding the
+	// blocks up to their end
+	var loops []int // the constructs of cfg.Loops
+	for _, start := range starts {
+		if !backEdges[start] {
+			continue
+		}
+		c := constructs[start]
+		loop := Loop{Header: blockOf[start], Parent: -1}
+		for b := loop.Header; b < len(cfg.Blocks) && cfg.Blocks[b].Start < c.end; b++ {
+			loop.Blocks = append(loop.Blocks, b)
+		}
+		for l := len(loops) - 1; l >= 0; l-- {
+			if outer := constructs[loops[l]]; outer.end > start {
+				loop.Parent = l
+				break
+			}
+		}
+		for _, b := range loop.Blocks {
+			cfg.Blocks[b].Loop = len(cfg.Loops)
+		}
+		cfg.Loops = append(cfg.Loops, loop)
+		loops = append(loops, start)
+	}
+
+	return cfg
+}
+
+// isJump returns whether the instruction with the given opcode never goes
+// on with the instruction following it, or may not.
+func isJump(op byte) bool {
+	switch op {
+	case ops.Br, ops.BrIf, ops.BrTable, ops.BrOnNull, ops.BrOnNonNull,
+		ops.If, ops.Else, ops.Try, ops.Return, ops.Unreachable,
+		ops.Throw, ops.Rethrow, ops.ReturnCall, ops.ReturnCallIndirect, ops.ReturnCallRef:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package disasm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestBuildCFG(t *testing.T) {
+	code := []byte{
+		0x03, 0x40, // 0: loop
+		0x20, 0x00, // 1:   local.get 0
+		0x0d, 0x00, // 2:   br_if 0
+		0x0b,       // 3: end
+		0x02, 0x40, // 4: block
+		0x41, 0x01, // 5:   i32.const 1
+		0x04, 0x40, // 6:   if
+		0x01,       // 7:     nop
+		0x05,       // 8:   else
+		0x0c, 0x01, // 9:     br 1
+		0x0b, // 10:  end
+		0x0b, // 11: end
+	}
+	module := &wasm.Module{
+		Types: &wasm.SectionTypes{Entries: []wasm.FunctionSig{{ParamTypes: []wasm.ValueType{wasm.ValueTypeI32}}}},
+	}
+	fn := wasm.Function{Sig: &module.Types.Entries[0], Body: &wasm.FunctionBody{Code: code}}
+	d, err := Disassemble(fn, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &CFG{
+		Blocks: []BasicBlock{
+			{Start: 0, End: 3, Succs: []int{0, 1}, Preds: []int{0}, Loop: 0},
+			{Start: 3, End: 7, Succs: []int{2, 3}, Preds: []int{0}, Loop: -1},
+			{Start: 7, End: 9, Succs: []int{4}, Preds: []int{1}, Loop: -1},
+			{Start: 9, End: 10, Succs: []int{5}, Preds: []int{1}, Loop: -1},
+			{Start: 10, End: 11, Succs: []int{5}, Preds: []int{2}, Loop: -1},
+			{Start: 11, End: 12, Preds: []int{3, 4}, Loop: -1},
+		},
+		Loops: []Loop{{Header: 0, Blocks: []int{0}, Parent: -1}},
+	}
+	if got := BuildCFG(d); !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%+v, want=%+v", got, want)
+	}
+}
@@ -38,10 +38,10 @@ import (
 	"math"
 
 	"github.com/bottos-project/bottos/vm/wasm/internal/stack"
+	"github.com/bottos-project/bottos/vm/wasm/log"
 	"github.com/bottos-project/bottos/vm/wasm/wasm"
 	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
 	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
-	log "github.com/cihub/seelog"
 )
 
 // Instr describes an instruction, consisting of an operator, with its
@@ -65,12 +65,25 @@ type Instr struct {
 	// If the operator is br_table (ops.BrTable), this is a list of StackInfo
 	// fields for each of the blocks/branches referenced by the operator.
 	Branches []StackInfo
+	// Slot is the first stack slot of the local or global variable accessed
+	// by the instruction, see Slots. Wide is true if the variable, or the
+	// operand of drop or select, is a v128 taking two slots.
+	Slot uint32
+	Wide bool
+	// Memory is the index of the memory accessed by a load, a store,
+	// memory.size, memory.grow, or a SIMD or atomic memory access. The
+	// bulk memory operators have their memory indices as immediates.
+	Memory uint32
+	// Offset is the offset of the instruction in the code of the function,
+	// -1 for the instructions Disassemble adds to zero the reference locals.
+	Offset int
 }
 
 // StackInfo stores details about a new stack created or unwinded by an instruction.
+// The depths of the stack are counted in slots, see Slots.
 type StackInfo struct {
 	StackTopDiff int64 // The difference between the stack depths at the end of the block
-	PreserveTop  bool  // Whether the value on the top of the stack should be preserved while unwinding
+	Preserve     int   // The number of slots on the top of the stack to preserve while unwinding
 	IsReturn     bool  // Whether the unwind is equivalent to a return
 }
 
@@ -87,11 +100,17 @@ type BlockInfo struct {
 	// The index to the `end' operator for if/else/loop/block.
 	EndIndex int
 	// For end, it is the index to the operator that starts the block.
+	// For catch, catch_all and delegate, it is the index to the 'try'
+	// operator or to the previous catch of the block.
 	BlockStartIndex int
+	// For 'try', the depth of the stack below the parameters of the
+	// block, which is restored before running a handler of the block.
+	StackDepth int
 }
 
 // Disassembly is the result of disassembling a WebAssembly function.
 type Disassembly struct {
+	Name     string // The name of the function in the name section, if any
 	Code     []Instr
 	MaxDepth int // The maximum stack depth that can be reached while executing this function
 }
@@ -110,16 +129,78 @@ func isInstrReachable(indexStack [][]int) bool {
 	return len(indexStack[len(indexStack)-1]) == 0
 }
 
+// labelArity returns the number of slots of the values carried by a branch
+// to the label of the block started by instr: the parameters of a loop, or
+// the results of any other block.
+func labelArity(instr Instr, module *wasm.Module) int {
+	params, results, _ := instr.Block.Signature.Signature(module)
+	if instr.Op.Code == ops.Loop {
+		return Slots(params...)
+	}
+	return Slots(results...)
+}
+
+// Slots returns the number of 64 bits stack slots taken by values of the
+// given types: a v128 value takes two slots, any other value one. The
+// local and global variables are laid out in slots as well.
+func Slots(types ...wasm.ValueType) int {
+	n := len(types)
+	for _, t := range types {
+		if t == wasm.ValueTypeV128 {
+			n++
+		}
+	}
+	return n
+}
+
+// GlobalSlots returns the first slot of every global variable of module,
+// indexed by global index, followed by the total number of slots.
+func GlobalSlots(module *wasm.Module) []uint32 {
+	slots := make([]uint32, len(module.GlobalIndexSpace)+1)
+	for i, global := range module.GlobalIndexSpace {
+		slots[i+1] = slots[i] + uint32(Slots(global.Type.Type))
+	}
+	return slots
+}
+
+// localVariable returns the type and first slot of the local variable of fn
+// with the given index, the parameters being the first ones.
+func localVariable(fn wasm.Function, index uint32) (wasm.ValueType, uint32, error) {
+	var slot uint32
+	for i, t := range fn.Sig.ParamTypes {
+		if uint32(i) == index {
+			return t, slot, nil
+		}
+		slot += uint32(Slots(t))
+	}
+	i := uint32(len(fn.Sig.ParamTypes))
+	for _, entry := range fn.Body.Locals {
+		if index-i < entry.Count {
+			return entry.Type, slot + (index-i)*uint32(Slots(entry.Type)), nil
+		}
+		i += entry.Count
+		slot += entry.Count * uint32(Slots(entry.Type))
+	}
+	return 0, 0, ErrInvalidLocalIndex
+}
+
 // ErrStackUnderflow defines an error
 var ErrStackUnderflow = errors.New("disasm: stack underflow")
 
+// ErrInvalidLocalIndex is returned for an access to a local variable the
+// function doesn't have.
+var ErrInvalidLocalIndex = errors.New("disasm: invalid local variable index")
+
 // Disassemble disassembles the given function. It also takes the function's
 // parent module as an argument for locating any other functions referenced by
 // fn.
 func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
+	if err := fn.Body.Decode(); err != nil {
+		return nil, err
+	}
 	code := fn.Body.Code
 	reader := bytes.NewReader(code)
-	disas := &Disassembly{}
+	disas := &Disassembly{Name: fn.Name}
 
 	// A stack of int arrays holding indices to instructions that make the stack
 	// polymorphic. Each block has its corresponding array. We start with one
@@ -133,7 +214,88 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 	curIndex := 0
 	var lastOpReturn bool
 
+	// the offsets of the memory immediates are uint64 on a 64-bit memory
+	var memories []wasm.Memory
+	if module != nil {
+		memories = module.Memories()
+	}
+
+	// whether the operands pushed by the reachable instructions are v128
+	// values, for drop and select to know the number of slots of their
+	// operands. They take the slots counted by the top of stackDepths.
+	var wide []bool
+	var wideSlots uint64
+	pushWide := func(w bool) {
+		wide = append(wide, w)
+		wideSlots++
+		if w {
+			wideSlots++
+		}
+		stackDepths.SetTop(wideSlots)
+		disas.checkMaxDepth(int(wideSlots))
+	}
+	push := func(types ...wasm.ValueType) {
+		for _, t := range types {
+			pushWide(t == wasm.ValueTypeV128)
+		}
+	}
+	// pop pops n operands, and returns whether the last one is a v128.
+	pop := func(n int) (bool, error) {
+		var w bool
+		for i := 0; i < n; i++ {
+			if len(wide) == 0 {
+				return false, ErrStackUnderflow
+			}
+			w = wide[len(wide)-1]
+			wide = wide[:len(wide)-1]
+			wideSlots--
+			if w {
+				wideSlots--
+			}
+		}
+		stackDepths.SetTop(wideSlots)
+		return w, nil
+	}
+	// truncate pops the operands above the given depth, once the code
+	// following an unconditional branch has been skipped.
+	truncate := func(depth uint64) {
+		for wideSlots > depth {
+			pop(1)
+		}
+	}
+	var globalSlots []uint32
+	// tagParams returns the types of the values of the exceptions thrown
+	// with the tag at index.
+	tagParams := func(index uint32) ([]wasm.ValueType, error) {
+		tags := module.Tags()
+		if int(index) >= len(tags) {
+			return nil, wasm.InvalidTagIndexError(index)
+		}
+		return module.Types.Entries[tags[index].Type].ParamTypes, nil
+	}
+
+	// the locals are zeroed, the references are set to null first
+	index := uint32(len(fn.Sig.ParamTypes))
+	slot := uint32(Slots(fn.Sig.ParamTypes...))
+	for _, entry := range fn.Body.Locals {
+		for i := uint32(0); i < entry.Count; i++ {
+			if entry.Type.IsRef() {
+				refNull, _ := ops.New(ops.RefNull)
+				setLocal, _ := ops.New(ops.SetLocal)
+				push(entry.Type)
+				pop(1)
+				disas.Code = append(disas.Code,
+					Instr{Op: refNull, Immediates: []interface{}{entry.Type}, Offset: -1},
+					Instr{Op: setLocal, Immediates: []interface{}{index}, Slot: slot, Offset: -1})
+			}
+			index++
+			slot += uint32(Slots(entry.Type))
+		}
+	}
+	curIndex = len(disas.Code)
+
 	for {
+		offset := len(code) - reader.Len()
 		op, err := reader.ReadByte()
 		if err == io.EOF {
 			break
@@ -143,14 +305,22 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 		log.Trace("stack top is %d", stackDepths.Top())
 
 		opStr, err := ops.New(op)
+		if op == ops.PrefixMisc || op == ops.PrefixSIMD || op == ops.PrefixAtomic || op == ops.PrefixGC {
+			var sub uint32
+			if sub, err = leb128.ReadVarUint32(reader); err != nil {
+				return nil, err
+			}
+			opStr, err = ops.NewPrefixed(op, sub)
+		}
 		if err != nil {
 			return nil, err
 		}
 		instr := Instr{
 			Op:         opStr,
 			Immediates: [](interface{}){},
+			Offset:     offset,
 		}
-		if op == ops.End || op == ops.Else {
+		if op == ops.End || op == ops.Else || op == ops.Catch || op == ops.CatchAll || op == ops.Delegate {
 			// There are two possible cases here:
 			// 1. The corresponding block/if/loop instruction
 			// *is* reachable, and an instruction somewhere in this
@@ -168,17 +338,12 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 
 		log.Trace("op: %s, unreachable: %v", opStr.Name, instr.Unreachable)
 		if !opStr.Polymorphic && !instr.Unreachable {
-			top := int(stackDepths.Top())
-			top -= len(opStr.Args)
-			stackDepths.SetTop(uint64(top))
-			if top < -1 {
-				return nil, ErrStackUnderflow
+			if _, err := pop(len(opStr.Args)); err != nil {
+				return nil, err
 			}
 			if opStr.Returns != wasm.ValueType(wasm.BlockTypeEmpty) {
-				top++
-				stackDepths.SetTop(uint64(top))
+				push(opStr.Returns)
 			}
-			disas.checkMaxDepth(top)
 		}
 
 		switch op {
@@ -186,46 +351,117 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 			pushPolymorphicOp(blockPolymorphicOps, curIndex)
 		case ops.Drop:
 			if !instr.Unreachable {
-				stackDepths.SetTop(stackDepths.Top() - 1)
+				if instr.Wide, err = pop(1); err != nil {
+					return nil, err
+				}
+			}
+		case ops.Select, ops.SelectTyped:
+			if op == ops.SelectTyped {
+				// the operand types, a single one is allowed
+				n, err := leb128.ReadVarUint32(reader)
+				if err != nil {
+					return nil, err
+				}
+				for i := uint32(0); i < n; i++ {
+					t, err := wasm.ReadValueType(reader)
+					if err != nil {
+						return nil, err
+					}
+					instr.Immediates = append(instr.Immediates, t)
+				}
 			}
-		case ops.Select:
 			if !instr.Unreachable {
-				stackDepths.SetTop(stackDepths.Top() - 2)
+				if _, err := pop(1); err != nil {
+					return nil, err
+				}
+				if instr.Wide, err = pop(2); err != nil {
+					return nil, err
+				}
+				pushWide(instr.Wide)
+			}
+		case ops.RefNull:
+			t, err := leb128.ReadVarint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, wasm.ValueType(t))
+			if !instr.Unreachable {
+				push(wasm.ValueType(t))
+			}
+		case ops.RefIsNull:
+			// the reference is replaced by an i32
+		case ops.RefFunc, ops.TableGet, ops.TableSet:
+			index, err := leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, index)
+			if op == ops.TableSet && !instr.Unreachable {
+				if _, err := pop(2); err != nil {
+					return nil, err
+				}
 			}
 		case ops.Return:
 			if !instr.Unreachable {
-				stackDepths.SetTop(stackDepths.Top() - uint64(len(fn.Sig.ReturnTypes)))
+				if _, err := pop(len(fn.Sig.ReturnTypes)); err != nil {
+					return nil, err
+				}
 			}
 			pushPolymorphicOp(blockPolymorphicOps, curIndex)
 			lastOpReturn = true
-		case ops.End, ops.Else:
+		case ops.End, ops.Else, ops.Catch, ops.CatchAll, ops.Delegate:
+			// catch and catch_all start a handler of a try block like
+			// else, delegate ends the block like end
+			var handlerParams []wasm.ValueType
+			switch op {
+			case ops.Catch:
+				index, err := leb128.ReadVarUint32(reader)
+				if err != nil {
+					return nil, err
+				}
+				instr.Immediates = append(instr.Immediates, index)
+				if handlerParams, err = tagParams(index); err != nil {
+					return nil, err
+				}
+			case ops.Delegate:
+				depth, err := leb128.ReadVarUint32(reader)
+				if err != nil {
+					return nil, err
+				}
+				instr.Immediates = append(instr.Immediates, depth)
+			}
+			ends := op == ops.End || op == ops.Delegate
+
 			// The max depth reached while execing the current block
 			curDepth := stackDepths.Top()
 			blockStartIndex := blockIndices.Pop()
 			blockSig := disas.Code[blockStartIndex].Block.Signature
+			params, results, _ := blockSig.Signature(module)
 			instr.Block = &BlockInfo{
 				Start:     false,
 				Signature: blockSig,
 			}
-			if op == ops.End {
+			if ends {
 				instr.Block.BlockStartIndex = int(blockStartIndex)
 				disas.Code[blockStartIndex].Block.EndIndex = curIndex
+			} else if op != ops.Else {
+				instr.Block.BlockStartIndex = int(blockStartIndex)
 			} else { // ops.Else
 				instr.Block.ElseIfIndex = int(blockStartIndex)
 				disas.Code[blockStartIndex].Block.IfElseIndex = int(blockStartIndex)
 			}
 
 			// The max depth reached while execing the last block
-			// If the signature of the current block is not empty,
-			// this will be incremented.
+			// If the block has results, this will be incremented
+			// by their number.
 			// Same with ops.Br/BrIf, we subtract 2 instead of 1
 			// to get the depth of the *parent* block of the branch
 			// we want to take.
 			prevDepthIndex := stackDepths.Len() - 2
 			prevDepth := stackDepths.Get(prevDepthIndex)
 
-			if op != ops.Else && blockSig != wasm.BlockTypeEmpty && !instr.Unreachable {
-				stackDepths.Set(prevDepthIndex, prevDepth+1)
+			if ends && len(results) != 0 && !instr.Unreachable {
+				stackDepths.Set(prevDepthIndex, prevDepth+uint64(Slots(results...)))
 				disas.checkMaxDepth(int(stackDepths.Get(prevDepthIndex)))
 			}
 
@@ -236,9 +472,9 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 				}
 				instr.NewStack = &StackInfo{
 					StackTopDiff: int64(elemsDiscard),
-					PreserveTop:  blockSig != wasm.BlockTypeEmpty,
+					Preserve:     Slots(results...),
 				}
-				log.Trace("discard %d elements, preserve top: %v", elemsDiscard, instr.NewStack.PreserveTop)
+				log.Trace("discard %d elements, preserve %d", elemsDiscard, instr.NewStack.Preserve)
 			} else {
 				instr.NewStack = &StackInfo{}
 			}
@@ -250,21 +486,44 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 			}
 
 			stackDepths.Pop()
-			if op == ops.Else {
-				stackDepths.Push(0)
+			truncate(prevDepth)
+			if !ends {
+				// the else branch starts again with the parameters
+				// of the block, a handler with the values of the
+				// exception it catches
+				if op != ops.Else {
+					params = handlerParams
+				}
+				stackDepths.Push(prevDepth)
+				push(params...)
 				blockIndices.Push(uint64(curIndex))
 				if !instr.Unreachable {
 					blockPolymorphicOps = append(blockPolymorphicOps, []int{})
 				}
+			} else if !instr.Unreachable {
+				push(results...)
 			}
 
-		case ops.Block, ops.Loop, ops.If:
-			sig, err := leb128.ReadVarint32(reader)
+		case ops.Block, ops.Loop, ops.If, ops.Try:
+			sig, err := wasm.ReadBlockType(reader)
+			if err != nil {
+				return nil, err
+			}
+			params, _, err := sig.Signature(module)
 			if err != nil {
 				return nil, err
 			}
 			log.Trace("if, depth is %d", stackDepths.Top())
-			stackDepths.Push(stackDepths.Top())
+			// the parameters of the block are moved from the stack of
+			// its parent to its own
+			top := stackDepths.Top()
+			if !instr.Unreachable {
+				if int(top) < Slots(params...) {
+					return nil, ErrStackUnderflow
+				}
+				stackDepths.SetTop(top - uint64(Slots(params...)))
+			}
+			stackDepths.Push(top)
 			// If this new block is unreachable, its
 			// entire instruction sequence is unreachable
 			// as well. To make sure that isInstrReachable
@@ -276,18 +535,26 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 				blockPolymorphicOps = append(blockPolymorphicOps, []int{})
 			}
 			instr.Block = &BlockInfo{
-				Start:     true,
-				Signature: wasm.BlockType(sig),
+				Start:      true,
+				Signature:  sig,
+				StackDepth: int(stackDepths.Get(stackDepths.Len() - 2)),
 			}
 
 			blockIndices.Push(uint64(curIndex))
-			instr.Immediates = append(instr.Immediates, wasm.BlockType(sig))
-		case ops.Br, ops.BrIf:
+			instr.Immediates = append(instr.Immediates, sig)
+		case ops.Br, ops.BrIf, ops.BrOnNull, ops.BrOnNonNull:
 			depth, err := leb128.ReadVarUint32(reader)
 			if err != nil {
 				return nil, err
 			}
 			instr.Immediates = append(instr.Immediates, depth)
+			// br_on_null branches without the reference it tests, and
+			// keeps it otherwise
+			if op == ops.BrOnNull && !instr.Unreachable {
+				if _, err := pop(1); err != nil {
+					return nil, err
+				}
+			}
 
 			if int(depth) == blockIndices.Len() {
 				instr.IsReturn = true
@@ -309,22 +576,37 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 				index := blockIndices.Get(blockIndices.Len() - 1 - int(depth))
 				instr.NewStack = &StackInfo{
 					StackTopDiff: int64(elemsDiscard),
-					PreserveTop:  disas.Code[index].Block.Signature != wasm.BlockTypeEmpty,
+					Preserve:     labelArity(disas.Code[index], module),
 				}
 			}
 			if op == ops.Br {
 				pushPolymorphicOp(blockPolymorphicOps, curIndex)
 			}
+			if !instr.Unreachable {
+				switch op {
+				case ops.BrOnNull:
+					pushWide(false)
+				case ops.BrOnNonNull:
+					if _, err := pop(1); err != nil {
+						return nil, err
+					}
+				}
+			}
 
 		case ops.BrTable:
 			if !instr.Unreachable {
-				stackDepths.SetTop(stackDepths.Top() - 1)
+				if _, err := pop(1); err != nil {
+					return nil, err
+				}
 			}
 
 			targetCount, err := leb128.ReadVarUint32(reader)
 			if err != nil {
 				return nil, err
 			}
+			if max := module.DecodeLimits().MaxBrTableTargets; max != 0 && uint64(targetCount) > uint64(max) {
+				return nil, wasm.DecodeLimitError{Limit: "br_table targets", Max: max}
+			}
 			instr.Immediates = append(instr.Immediates, targetCount)
 			for i := uint32(0); i < targetCount; i++ {
 				entry, err := leb128.ReadVarUint32(reader)
@@ -347,7 +629,7 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 					}
 					index := blockIndices.Get(blockIndices.Len() - 1 - int(entry))
 					info.StackTopDiff = int64(elemsDiscard)
-					info.PreserveTop = disas.Code[index].Block.Signature != wasm.BlockTypeEmpty
+					info.Preserve = labelArity(disas.Code[index], module)
 				}
 				instr.Branches = append(instr.Branches, info)
 			}
@@ -372,17 +654,43 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 				}
 				index := blockIndices.Get(blockIndices.Len() - 1 - int(defaultTarget))
 				info.StackTopDiff = int64(elemsDiscard)
-				info.PreserveTop = disas.Code[index].Block.Signature != wasm.BlockTypeEmpty
+				info.Preserve = labelArity(disas.Code[index], module)
 			}
 			instr.Branches = append(instr.Branches, info)
 			pushPolymorphicOp(blockPolymorphicOps, curIndex)
-		case ops.Call, ops.CallIndirect:
+		case ops.Throw:
+			index, err := leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, index)
+			params, err := tagParams(index)
+			if err != nil {
+				return nil, err
+			}
+			if !instr.Unreachable {
+				if _, err := pop(len(params)); err != nil {
+					return nil, err
+				}
+			}
+			pushPolymorphicOp(blockPolymorphicOps, curIndex)
+		case ops.Rethrow:
+			depth, err := leb128.ReadVarUint32(reader)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, depth)
+			pushPolymorphicOp(blockPolymorphicOps, curIndex)
+		case ops.Call, ops.CallIndirect, ops.ReturnCall, ops.ReturnCallIndirect, ops.CallRef, ops.ReturnCallRef:
+			indirect := op == ops.CallIndirect || op == ops.ReturnCallIndirect
+			byRef := op == ops.CallRef || op == ops.ReturnCallRef
+			tail := op == ops.ReturnCall || op == ops.ReturnCallIndirect || op == ops.ReturnCallRef
 			index, err := leb128.ReadVarUint32(reader)
 			if err != nil {
 				return nil, err
 			}
 			instr.Immediates = append(instr.Immediates, index)
-			if op == ops.CallIndirect {
+			if indirect {
 				reserved, err := leb128.ReadVarUint32(reader)
 				if err != nil {
 					return nil, err
@@ -391,20 +699,29 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 			}
 			if !instr.Unreachable {
 				var sig *wasm.FunctionSig
-				top := int(stackDepths.Top())
-				if op == ops.CallIndirect {
+				if indirect || byRef {
 					if module.Types == nil {
 						return nil, errors.New("missing types section")
 					}
 					sig = &module.Types.Entries[index]
-					top--
+					if _, err := pop(1); err != nil {
+						return nil, err
+					}
 				} else {
 					sig = module.GetFunction(int(index)).Sig
 				}
-				top -= len(sig.ParamTypes)
-				top += len(sig.ReturnTypes)
-				stackDepths.SetTop(uint64(top))
-				disas.checkMaxDepth(top)
+				if _, err := pop(len(sig.ParamTypes)); err != nil {
+					return nil, err
+				}
+				if !tail {
+					push(sig.ReturnTypes...)
+				}
+			}
+			if tail {
+				// the callee's results are the caller's, nothing after
+				// a tail call is reachable
+				pushPolymorphicOp(blockPolymorphicOps, curIndex)
+				lastOpReturn = true
 			}
 		case ops.GetLocal, ops.SetLocal, ops.TeeLocal, ops.GetGlobal, ops.SetGlobal:
 			index, err := leb128.ReadVarUint32(reader)
@@ -413,16 +730,32 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 			}
 			instr.Immediates = append(instr.Immediates, index)
 
+			var t wasm.ValueType
+			switch op {
+			case ops.GetLocal, ops.SetLocal, ops.TeeLocal:
+				if t, instr.Slot, err = localVariable(fn, index); err != nil {
+					return nil, err
+				}
+			default:
+				global := module.GetGlobal(int(index))
+				if global == nil {
+					return nil, wasm.InvalidGlobalIndexError(index)
+				}
+				if globalSlots == nil {
+					globalSlots = GlobalSlots(module)
+				}
+				t, instr.Slot = global.Type.Type, globalSlots[index]
+			}
+			instr.Wide = t == wasm.ValueTypeV128
+
 			if !instr.Unreachable {
-				top := stackDepths.Top()
 				switch op {
 				case ops.GetLocal, ops.GetGlobal:
-					top++
-					stackDepths.SetTop(top)
-					disas.checkMaxDepth(int(top))
+					push(t)
 				case ops.SetLocal, ops.SetGlobal:
-					top--
-					stackDepths.SetTop(top)
+					if _, err := pop(1); err != nil {
+						return nil, err
+					}
 				case ops.TeeLocal:
 					// stack remains unchanged for tee_local
 				}
@@ -459,26 +792,88 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 			instr.Immediates = append(instr.Immediates, math.Float64frombits(i))
 		case ops.I32Load, ops.I64Load, ops.F32Load, ops.F64Load, ops.I32Load8s, ops.I32Load8u, ops.I32Load16s, ops.I32Load16u, ops.I64Load8s, ops.I64Load8u, ops.I64Load16s, ops.I64Load16u, ops.I64Load32s, ops.I64Load32u, ops.I32Store, ops.I64Store, ops.F32Store, ops.F64Store, ops.I32Store8, ops.I32Store16, ops.I64Store8, ops.I64Store16, ops.I64Store32:
 			// read memory_immediate
-			flags, err := leb128.ReadVarUint32(reader)
+			align, index, offset, err := readMemArg(reader, memories)
 			if err != nil {
 				return nil, err
 			}
-			instr.Immediates = append(instr.Immediates, flags)
-
-			offset, err := leb128.ReadVarUint32(reader)
+			instr.Immediates = append(instr.Immediates, align, offset)
+			instr.Memory = index
+		case ops.CurrentMemory, ops.GrowMemory:
+			// the reserved byte of the MVP is the memory index
+			index, err := leb128.ReadVarUint32(reader)
 			if err != nil {
 				return nil, err
 			}
-			instr.Immediates = append(instr.Immediates, offset)
-		case ops.CurrentMemory, ops.GrowMemory:
-			res, err := leb128.ReadVarUint32(reader)
+			instr.Immediates = append(instr.Immediates, uint8(0))
+			instr.Memory = index
+		case ops.PrefixMisc:
+			// segment, memory and table indices
+			n := 2
+			switch opStr.Sub {
+			case ops.DataDrop, ops.MemoryFill, ops.ElemDrop, ops.TableGrow, ops.TableSize, ops.TableFill:
+				n = 1
+			}
+			if !instr.Unreachable {
+				switch opStr.Sub {
+				case ops.TableGrow:
+					if _, err := pop(2); err != nil {
+						return nil, err
+					}
+					push(wasm.ValueTypeI32)
+				case ops.TableFill:
+					if _, err := pop(3); err != nil {
+						return nil, err
+					}
+				}
+			}
+			for i := 0; i < n; i++ {
+				idx, err := leb128.ReadVarUint32(reader)
+				if err != nil {
+					return nil, err
+				}
+				instr.Immediates = append(instr.Immediates, idx)
+			}
+		case ops.PrefixSIMD:
+			imms, index, err := readSIMDImmediates(reader, opStr.Sub, memories)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, imms...)
+			instr.Memory = index
+		case ops.PrefixAtomic:
+			// the reserved byte of atomic.fence, or the alignment and
+			// offset of a memory access
+			if opStr.Sub == ops.AtomicFence {
+				res, err := reader.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				instr.Immediates = append(instr.Immediates, res)
+				break
+			}
+			align, index, offset, err := readMemArg(reader, memories)
 			if err != nil {
 				return nil, err
 			}
-			instr.Immediates = append(instr.Immediates, uint8(res))
+			instr.Immediates = append(instr.Immediates, align, offset)
+			instr.Memory = index
+		case ops.PrefixGC:
+			imms, pops, result, err := readGCImmediates(reader, opStr.Sub, module)
+			if err != nil {
+				return nil, err
+			}
+			instr.Immediates = append(instr.Immediates, imms...)
+			if !instr.Unreachable && opStr.Polymorphic {
+				if _, err := pop(pops); err != nil {
+					return nil, err
+				}
+				if result != wasm.ValueType(wasm.BlockTypeEmpty) {
+					push(result)
+				}
+			}
 		}
 
-		if op != ops.Return {
+		if op != ops.Return && op != ops.ReturnCall && op != ops.ReturnCallIndirect {
 			lastOpReturn = false
 		}
 
@@ -492,3 +887,184 @@ func Disassemble(fn wasm.Function, module *wasm.Module) (*Disassembly, error) {
 
 	return disas, nil
 }
+
+// Instruction is an instruction of a function as it is encoded in the code
+// section of its module.
+type Instruction struct {
+	Offset     int64 // The offset of the instruction in the module
+	Op         ops.Op
+	Immediates []interface{}
+}
+
+// ErrInvalidFunctionIndex is returned for a function index out of the
+// function index space of the module.
+var ErrInvalidFunctionIndex = errors.New("disasm: invalid function index")
+
+// DisassembleFunction disassembles the function of module at index in its
+// function index space, and returns its instructions in the order of the
+// code, the final end being left out like in Disassemble.
+func DisassembleFunction(module *wasm.Module, index int) ([]Instruction, error) {
+	fn := module.GetFunction(index)
+	if fn == nil {
+		return nil, ErrInvalidFunctionIndex
+	}
+	disassembly, err := Disassemble(*fn, module)
+	if err != nil {
+		return nil, err
+	}
+	instrs := make([]Instruction, 0, len(disassembly.Code))
+	for _, instr := range disassembly.Code {
+		if instr.Offset < 0 {
+			continue
+		}
+		instrs = append(instrs, Instruction{
+			Offset:     fn.Body.Offset + int64(instr.Offset),
+			Op:         instr.Op,
+			Immediates: instr.Immediates,
+		})
+	}
+	return instrs, nil
+}
+
+// readSIMDImmediates reads the immediates of the SIMD operator with the
+// given sub-opcode: the alignment and offset of a memory access, followed by
+// a uint8 lane index for the lane accesses, the 16 bytes of v128.const and
+// the lane indices of i8x16.shuffle as a wasm.V128, or the uint8 lane index
+// of the extract and replace lane operators. It also returns the index of
+// the memory accessed.
+func readSIMDImmediates(reader *bytes.Reader, sub uint32, memories []wasm.Memory) ([]interface{}, uint32, error) {
+	var imms []interface{}
+	var index uint32
+	switch {
+	case sub <= ops.V128Store || sub >= ops.V128Load8Lane && sub <= ops.V128Load64Zero:
+		align, memory, offset, err := readMemArg(reader, memories)
+		if err != nil {
+			return nil, 0, err
+		}
+		imms, index = append(imms, align, offset), memory
+		if sub >= ops.V128Load8Lane && sub <= ops.V128Store64Lane {
+			lane, err := reader.ReadByte()
+			if err != nil {
+				return nil, 0, err
+			}
+			imms = append(imms, lane)
+		}
+	case sub == ops.V128Const || sub == ops.I8x16Shuffle:
+		var v wasm.V128
+		if _, err := io.ReadFull(reader, v[:]); err != nil {
+			return nil, 0, err
+		}
+		imms = append(imms, v)
+	case sub >= ops.I8x16ExtractLaneS && sub <= ops.F64x2ReplaceLane:
+		lane, err := reader.ReadByte()
+		if err != nil {
+			return nil, 0, err
+		}
+		imms = append(imms, lane)
+	}
+	return imms, index, nil
+}
+
+// readGCImmediates reads the immediates of the GC operator with the given
+// sub-opcode: the uint32 type, field and operand count indices, or the
+// wasm.ValueType heap type of ref.test and ref.cast. It also returns the
+// number of operands the polymorphic operators pop, and the type of their
+// result, or BlockTypeEmpty.
+func readGCImmediates(reader *bytes.Reader, sub uint32, module *wasm.Module) ([]interface{}, int, wasm.ValueType, error) {
+	none := wasm.ValueType(wasm.BlockTypeEmpty)
+	if sub == ops.RefTest || sub == ops.RefTestNull || sub == ops.RefCast || sub == ops.RefCastNull {
+		t, err := leb128.ReadVarint32(reader)
+		if err != nil {
+			return nil, 0, none, err
+		}
+		result := wasm.ValueTypeI32
+		if sub == ops.RefCast || sub == ops.RefCastNull {
+			result = wasm.ValueType(t)
+		}
+		return []interface{}{wasm.ValueType(t)}, 1, result, nil
+	}
+	if sub == ops.ArrayLen || sub >= ops.AnyConvertExtern {
+		return nil, 0, none, nil
+	}
+
+	n := 1
+	switch sub {
+	case ops.StructGet, ops.StructGetS, ops.StructGetU, ops.StructSet, ops.ArrayNewFixed, ops.ArrayCopy:
+		n = 2
+	}
+	imms := make([]interface{}, n)
+	for i := range imms {
+		index, err := leb128.ReadVarUint32(reader)
+		if err != nil {
+			return nil, 0, none, err
+		}
+		imms[i] = index
+	}
+	typ := imms[0].(uint32)
+	if module.Types == nil || int(typ) >= len(module.Types.Entries) {
+		return nil, 0, none, wasm.InvalidTypeIndexError(typ)
+	}
+	// the fields all take a single slot, v128 fields being rejected
+	ref := wasm.ValueType(typ)
+	switch sub {
+	case ops.StructNew:
+		return imms, len(module.Types.Entries[typ].Fields), ref, nil
+	case ops.StructNewDefault:
+		return imms, 0, ref, nil
+	case ops.StructGet, ops.StructGetS, ops.StructGetU:
+		fields := module.Types.Entries[typ].Fields
+		if int(imms[1].(uint32)) >= len(fields) {
+			return nil, 0, none, ErrInvalidFieldIndex
+		}
+		return imms, 1, fields[imms[1].(uint32)].Type.Unpacked(), nil
+	case ops.StructSet:
+		return imms, 2, none, nil
+	case ops.ArrayNew:
+		return imms, 2, ref, nil
+	case ops.ArrayNewDefault:
+		return imms, 1, ref, nil
+	case ops.ArrayNewFixed:
+		return imms, int(imms[1].(uint32)), ref, nil
+	case ops.ArrayGet, ops.ArrayGetS, ops.ArrayGetU:
+		if !module.Types.Entries[typ].IsArray() {
+			return nil, 0, none, ErrInvalidFieldIndex
+		}
+		return imms, 2, module.Types.Entries[typ].Fields[0].Type.Unpacked(), nil
+	case ops.ArraySet:
+		return imms, 3, none, nil
+	case ops.ArrayFill:
+		return imms, 4, none, nil
+	}
+	// array.copy
+	return imms, 5, none, nil
+}
+
+// ErrInvalidFieldIndex is returned for an access to a field a struct type
+// doesn't have, or to the elements of a type which isn't an array.
+var ErrInvalidFieldIndex = errors.New("disasm: invalid field index")
+
+// memIndexFlag is the bit of the alignment of a memory immediate set when
+// a memory index follows the alignment, as defined by the multi-memory
+// proposal.
+const memIndexFlag = 0x40
+
+// readMemArg reads a memory immediate: its alignment, the index of the
+// memory it accesses, and its offset, returned as a uint32, or as a uint64
+// on a 64-bit memory.
+func readMemArg(reader *bytes.Reader, memories []wasm.Memory) (align, index uint32, offset interface{}, err error) {
+	if align, err = leb128.ReadVarUint32(reader); err != nil {
+		return 0, 0, nil, err
+	}
+	if align&memIndexFlag != 0 {
+		align &^= memIndexFlag
+		if index, err = leb128.ReadVarUint32(reader); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	if int(index) < len(memories) && memories[index].Limits.Memory64() {
+		offset, err = leb128.ReadVarUint64(reader)
+	} else {
+		offset, err = leb128.ReadVarUint32(reader)
+	}
+	return align, index, offset, err
+}
@@ -0,0 +1,193 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+// ABI_SECTION is the name of the custom section holding the ABI of a
+// module, see EmbedABI.
+const ABI_SECTION = "abi"
+
+// EmbedABI returns the wasm bytes code with abi embedded, for the callers
+// of the module not to need it apart: it appends a custom section named
+// ABI_SECTION holding the JSON document of abi, see ParseJSONABI. The ABI
+// section of a module already holding one is replaced. The signature
+// section of a signed module is removed, since it doesn't sign the new
+// bytes: a module is signed once its ABI is embedded, see SignModule.
+func EmbedABI(code []byte, abi *JSONABI) ([]byte, error) {
+	doc, err := json.Marshal(abi)
+	if err != nil {
+		return nil, err
+	}
+	var sections [][]byte
+	err = walkSections(code, func(id wasm.SectionID, name string, section []byte) {
+		if id != wasm.SectionIDCustom || name != ABI_SECTION && name != SIGNATURE_SECTION {
+			sections = append(sections, section)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(code)+len(doc)+16))
+	out.Write(code[:8])
+	for _, section := range sections {
+		out.Write(section)
+	}
+	var payload bytes.Buffer
+	writeName(&payload, ABI_SECTION)
+	payload.Write(doc)
+	writeSection(out, wasm.SectionIDCustom, payload.Bytes())
+	return out.Bytes(), nil
+}
+
+// walkSections calls fn with every section of code, along with its id and
+// the name of a custom section.
+func walkSections(code []byte, fn func(id wasm.SectionID, name string, section []byte)) error {
+	if len(code) < 8 {
+		return io.ErrUnexpectedEOF
+	}
+	if binary.LittleEndian.Uint32(code) != wasm.Magic {
+		return wasm.ErrInvalidMagic
+	}
+	r := bytes.NewReader(code[8:])
+	for r.Len() > 0 {
+		start := len(code) - r.Len()
+		id, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return err
+		}
+		size, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return err
+		}
+		if uint32(r.Len()) < size {
+			return io.ErrUnexpectedEOF
+		}
+		end := len(code) - r.Len() + int(size)
+		var name string
+		if wasm.SectionID(id) == wasm.SectionIDCustom {
+			payload := code[end-int(size) : end]
+			n, k, err := leb128.ReadVarUint32Size(bytes.NewReader(payload))
+			if err != nil {
+				return err
+			}
+			if uint64(k)+uint64(n) > uint64(len(payload)) {
+				return io.ErrUnexpectedEOF
+			}
+			name = string(payload[k : int(k)+int(n)])
+		}
+		fn(wasm.SectionID(id), name, code[start:end])
+		r.Seek(int64(end-8), io.SeekStart)
+	}
+	return nil
+}
+
+// ABI returns the ABI embedded in m, see EmbedABI, or nil if it has none.
+// The ABI is parsed on every call.
+func (m *Module) ABI() (*JSONABI, error) {
+	doc, ok := m.module.CustomSection(ABI_SECTION)
+	if !ok {
+		return nil, nil
+	}
+	return ParseJSONABI(doc)
+}
+
+// MarshalJSON returns the JSON document of abi, which ParseJSONABI reads
+// back.
+func (abi *JSONABI) MarshalJSON() ([]byte, error) {
+	type param struct {
+		Name string    `json:"name"`
+		Type *jsonType `json:"type"`
+	}
+	type method struct {
+		Name   string    `json:"name"`
+		Export string    `json:"export,omitempty"`
+		Params []param   `json:"params"`
+		Result *jsonType `json:"result,omitempty"`
+	}
+	type event struct {
+		Name   string  `json:"name"`
+		Fields []param `json:"fields"`
+	}
+	var doc struct {
+		Methods []method `json:"methods"`
+		Events  []event  `json:"events,omitempty"`
+	}
+	doc.Methods = []method{}
+	for _, name := range abi.names {
+		m := abi.methods[name]
+		out := method{Name: name, Params: []param{}, Result: m.result}
+		if m.export != name {
+			out.Export = m.export
+		}
+		for i, t := range m.params {
+			out.Params = append(out.Params, param{m.paramNames[i], t})
+		}
+		doc.Methods = append(doc.Methods, out)
+	}
+	for _, e := range abi.events {
+		out := event{Name: e.name, Fields: []param{}}
+		for i, t := range e.fields.members {
+			out.Fields = append(out.Fields, param{e.fields.fields[i], t})
+		}
+		doc.Events = append(doc.Events, out)
+	}
+	return json.Marshal(doc)
+}
+
+// MarshalJSON returns the JSON representation of t, see ParseJSONABI.
+func (t *jsonType) MarshalJSON() ([]byte, error) {
+	switch t.abi.Kind {
+	case ABIList:
+		return json.Marshal(map[string]*jsonType{"list": t.elem})
+	case ABIRecord:
+		type field struct {
+			Name string    `json:"name"`
+			Type *jsonType `json:"type"`
+		}
+		fields := []field{}
+		for i, member := range t.members {
+			fields = append(fields, field{t.fields[i], member})
+		}
+		return json.Marshal(map[string][]field{"record": fields})
+	case ABIResult:
+		result := map[string]*jsonType{}
+		if t.ok != nil {
+			result["ok"] = t.ok
+		}
+		if t.err != nil {
+			result["err"] = t.err
+		}
+		return json.Marshal(map[string]map[string]*jsonType{"result": result})
+	}
+	for name, kind := range abiKinds {
+		if kind == t.abi.Kind {
+			return json.Marshal(name)
+		}
+	}
+	return nil, InvalidABITypeError(strconv.Itoa(int(t.abi.Kind)))
+}
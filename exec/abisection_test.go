@@ -0,0 +1,99 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"crypto/ed25519"
+	"reflect"
+	"testing"
+)
+
+func TestEmbedABI(t *testing.T) {
+	abi, err := ParseJSONABI([]byte(`{"methods": [
+		{"name": "sum", "params": [{"name": "r", "type": {"record": [
+			{"name": "first", "type": "u32"},
+			{"name": "rest", "type": {"list": "u32"}}]}}], "result": "u32"},
+		{"name": "hello", "export": "greet", "result": {"result": {"ok": "string", "err": "u8"}}}
+	], "events": [
+		{"name": "transfer", "fields": [{"name": "to", "type": "string"}, {"name": "amount", "type": "u64"}]},
+		{"name": "reset"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := abi.Events()
+	want := []JSONEvent{
+		{Name: "transfer", Fields: []*ABIType{{Kind: ABIString}, {Kind: ABIU64}}, FieldNames: []string{"to", "amount"}},
+		{Name: "reset"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("unexpected events: got=%+v, want=%+v", events, want)
+	}
+
+	// embedding the abi again replaces it, and drops the signature
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := EmbedABI(readTestCode(t, "testdata/canon.wasm"), abi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, err = SignModule(code, key); err != nil {
+		t.Fatal(err)
+	}
+	if code, err = EmbedABI(code, abi); err != nil {
+		t.Fatal(err)
+	}
+	module, err := NewModuleCache(VMConfig{}, nil, 2, 1<<20).Load(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(module.module.CustomSections(ABI_SECTION)); n != 1 {
+		t.Errorf("unexpected abi sections: %d", n)
+	}
+	if _, ok := module.module.CustomSection(SIGNATURE_SECTION); ok {
+		t.Error("the signature section is kept")
+	}
+	embedded, err := module.ABI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(embedded, abi) {
+		t.Errorf("unexpected embedded abi: got=%+v, want=%+v", embedded, abi)
+	}
+
+	// the embedded abi lowers the arguments of the calls without one
+	inst, err := module.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	res, err := inst.NewVM().CallJSON(nil, []byte(`{"method": "sum", "args": [{"first": 1, "rest": [2, 3, 4]}]}`))
+	if err != nil || string(res) != `{"result":10}` {
+		t.Errorf("unexpected result: got=%s, %v", res, err)
+	}
+
+	other, err := NewVM(readTestModule(t, "testdata/canon.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.CallJSON(nil, []byte(`{"method": "sum", "args": []}`)); err != ERR_NO_ABI {
+		t.Errorf("unexpected error without an abi: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import "fmt"
+
+// AlignCheck is whether the memory accesses violating the alignment hint
+// of their instruction are reported or trap, see SetAlignCheck.
+type AlignCheck int
+
+const (
+	// AlignCheckOff doesn't check the alignment of the accesses, which the
+	// hints don't constrain.
+	AlignCheckOff AlignCheck = iota
+	// AlignCheckReport reports the misaligned accesses to an AlignFunc.
+	AlignCheckReport
+	// AlignCheckTrap traps the misaligned accesses with a
+	// MisalignedAccessError.
+	AlignCheckTrap
+)
+
+// ErrMisalignedAccess is the error value matched by the
+// MisalignedAccessError of the accesses violating their alignment hint.
+var ErrMisalignedAccess = newTrap(TrapMisalignedAccess, "exec: misaligned memory access")
+
+// AlignFunc is called before an instruction accesses the memory at an
+// address which isn't a multiple of align, the alignment in bytes its
+// hint promises. Like a WatchFunc, it runs on the goroutine of the call.
+type AlignFunc func(access MemoryAccess, align uint64)
+
+// MisalignedAccessError is the error value used while trapping the VM in
+// the AlignCheckTrap mode when an instruction accesses the memory at an
+// address which isn't a multiple of Align, the alignment in bytes its
+// hint promises. It matches ErrMisalignedAccess with errors.Is.
+type MisalignedAccessError struct {
+	Access MemoryAccess
+	Align  uint64
+}
+
+func (e *MisalignedAccessError) Error() string {
+	return fmt.Sprintf("%v: address %d, size %d, alignment %d, in function %d at offset %d",
+		ErrMisalignedAccess, e.Access.Addr, e.Access.Size, e.Align, e.Access.Func, e.Access.Offset)
+}
+
+// Is reports whether target is ErrMisalignedAccess.
+func (e *MisalignedAccessError) Is(target error) bool {
+	return target == ErrMisalignedAccess
+}
+
+// TrapCode returns TrapMisalignedAccess.
+func (e *MisalignedAccessError) TrapCode() TrapCode { return TrapMisalignedAccess }
+
+// SetAlignCheck sets how vm checks the alignment hints of the loads and
+// stores of the module, which the specification leaves unenforced: with
+// AlignCheckReport, the accesses at an address which isn't a multiple of
+// the alignment their hint promises are reported to report, and with
+// AlignCheckTrap they trap with a MisalignedAccessError, for instance to
+// find the accesses of a contract which are slow on the hardware, or
+// which an aligned native code couldn't run. The atomic operators trap
+// with ErrUnalignedAtomic regardless of the mode.
+//
+// The accesses are checked before each instruction, like the watchpoints,
+// see SetWatchFunc: functions compiled to native code are interpreted
+// while vm checks the alignment, and the accesses of the instructions
+// inlined into a function aren't checked.
+func (vm *VM) SetAlignCheck(mode AlignCheck, report AlignFunc) {
+	if mode == AlignCheckReport && report == nil {
+		mode = AlignCheckOff
+	}
+	vm.alignCheck, vm.alignFunc = mode, report
+	vm.setHooked()
+}
+
+// checkAlign reports or traps the access if its address isn't a multiple
+// of align.
+func (vm *VM) checkAlign(access MemoryAccess, align uint64) {
+	if access.Addr%align == 0 {
+		return
+	}
+	if vm.alignCheck == AlignCheckTrap {
+		panic(&MisalignedAccessError{Access: access, Align: align})
+	}
+	vm.alignFunc(access, align)
+}
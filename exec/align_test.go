@@ -0,0 +1,84 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAlignCheck(t *testing.T) {
+	module := readTestModule(t, "testdata/dwarf.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+
+	load := int64(module.Export.Entries["load"].Index)
+	loadInstrs, err := compiled.Disassemble(int(load))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reported []MemoryAccess
+	vm.SetAlignCheck(AlignCheckReport, func(access MemoryAccess, align uint64) {
+		if align != 4 {
+			t.Errorf("alignment %d, want 4", align)
+		}
+		reported = append(reported, access)
+	})
+	for _, addr := range []uint64{96, 98, 100, 101} {
+		if _, err := vm.ExecCode(load, addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []MemoryAccess{
+		{Func: load, Offset: loadInstrs[1].Offset, Addr: 98, Size: 4, Read: true},
+		{Func: load, Offset: loadInstrs[1].Offset, Addr: 101, Size: 4, Read: true},
+	}
+	if len(reported) != len(want) || reported[0] != want[0] || reported[1] != want[1] {
+		t.Errorf("got=%+v, want=%+v", reported, want)
+	}
+
+	vm.SetAlignCheck(AlignCheckTrap, nil)
+	if _, err := vm.ExecCode(load, 100); err != nil {
+		t.Fatal(err)
+	}
+	trapped := func() (err error) {
+		defer func() { err, _ = recover().(error) }()
+		vm.ExecCode(load, 98)
+		return nil
+	}()
+	var misaligned *MisalignedAccessError
+	if !errors.As(trapped, &misaligned) || !errors.Is(trapped, ErrMisalignedAccess) || TrapCodeOf(trapped) != TrapMisalignedAccess {
+		t.Fatalf("got=%v", trapped)
+	}
+	if misaligned.Access != want[0] || misaligned.Align != 4 {
+		t.Errorf("got=%+v", misaligned)
+	}
+
+	vm.SetAlignCheck(AlignCheckOff, nil)
+	if _, err := vm.ExecCode(load, 98); err != nil {
+		t.Fatal(err)
+	}
+}
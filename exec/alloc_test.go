@@ -0,0 +1,55 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestExecCodeRawAllocs(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	for _, test := range []struct {
+		name   string
+		config VMConfig
+	}{
+		{"interpreter", VMConfig{}},
+		{"aot", VMConfig{AOT: true}},
+	} {
+		vm, err := NewVMWithConfig(module, test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, fn := range []string{"fac-rec", "fac-iter"} {
+			index := int64(module.Export.Entries[fn].Index)
+			// warm up, so that the frames are allocated
+			if _, err := vm.ExecCodeRaw(index, 20); err != nil {
+				t.Fatal(err)
+			}
+
+			var res uint64
+			allocs := testing.AllocsPerRun(100, func() {
+				res, _ = vm.ExecCodeRaw(index, 20)
+			})
+			if res != 2432902008176640000 {
+				t.Errorf("%s, %s: unexpected result: %d", test.name, fn, res)
+			}
+			if allocs != 0 {
+				t.Errorf("%s, %s: unexpected allocations: %v", test.name, fn, allocs)
+			}
+		}
+	}
+}
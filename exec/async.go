@@ -0,0 +1,80 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	stdcontext "context"
+)
+
+// AsyncResult is the result of a host function completing asynchronously,
+// see RegisterAsync. An error traps the call of the module.
+type AsyncResult struct {
+	Value uint64
+	Err   error
+}
+
+// RegisterAsync registers a host function completing asynchronously, for
+// the asyncified modules run by Asyncify. handler starts the operation
+// with the arguments of the call, see VM.GetFuncParams, and returns the
+// channel its result is sent on. The call of the module then suspends
+// until the result is received, holding no goroutine nor stack while the
+// operation is in progress, see Asyncify.Await.
+func (env *EnvFunc) RegisterAsync(method string, handler func(*VM) <-chan AsyncResult) {
+	env.Register(method, func(vm *VM) (bool, error) {
+		a := vm.asyncify
+		if a == nil {
+			panic(ERR_ASYNCIFY)
+		}
+		if a.state != asyncifyRewinding {
+			a.pending = handler(vm)
+		} else if err := a.result.Err; err != nil {
+			a.Suspend()
+			panic(err)
+		}
+		a.Suspend()
+		return true, nil
+	})
+}
+
+// Pending returns the channel the result of the asynchronous host function
+// the call is suspended in is sent on, or nil if the call was suspended by
+// Suspend or the state was deserialized.
+func (s *AsyncifyState) Pending() <-chan AsyncResult {
+	return s.pending
+}
+
+// Await calls the function with the given index and arguments like Call,
+// and whenever the call suspends in an asynchronous host function, waits
+// for the result of the host function and resumes the call with it, until
+// the call returns. If ctx is done first, the suspended call is abandoned
+// and the error of ctx returned.
+func (a *Asyncify) Await(ctx stdcontext.Context, fnIndex int64, args ...uint64) (uint64, error) {
+	res, state, err := a.Call(fnIndex, args...)
+	for err == nil && state != nil {
+		if state.pending == nil {
+			return 0, ERR_ASYNCIFY_STATE
+		}
+		select {
+		case result := <-state.pending:
+			res, state, err = a.resume(state, result)
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	return res, err
+}
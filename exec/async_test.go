@@ -0,0 +1,88 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	stdcontext "context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestRegisterAsync(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/asyncify.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan AsyncResult)
+	imports := NewEnvFunc()
+	imports.RegisterAsync("oracle", func(vm *VM) <-chan AsyncResult {
+		return results
+	})
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	async, err := vm.Asyncify(1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, _ := vm.exportedFunc("run")
+
+	// run(x) returns x + 2*oracle(), the oracle answering later
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		results <- AsyncResult{Value: 7}
+	}()
+	if res, err := async.Await(stdcontext.Background(), run, 5); err != nil || res != 19 {
+		t.Fatalf("Await: got=%d, %v", res, err)
+	}
+
+	// an error traps the call
+	failed := errors.New("oracle failed")
+	go func() { results <- AsyncResult{Err: failed} }()
+	func() {
+		defer func() {
+			if r := trapValue(recover()); r != failed {
+				t.Errorf("Await with an error: got=%v, want=%v", r, failed)
+			}
+		}()
+		async.Await(stdcontext.Background(), run, 5)
+	}()
+
+	// the call is abandoned once the context is done
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := async.Await(ctx, run, 5); err != stdcontext.DeadlineExceeded {
+		t.Errorf("Await with a deadline: got=%v, want=%v", err, stdcontext.DeadlineExceeded)
+	}
+
+	go func() { results <- AsyncResult{Value: 1} }()
+	if res, err := async.Await(stdcontext.Background(), run, 2); err != nil || res != 4 {
+		t.Errorf("Await: got=%d, %v", res, err)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"encoding/binary"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// the states of the calls of an asyncified module, as returned by its
+// asyncify_get_state function
+const (
+	asyncifyNormal = iota
+	asyncifyUnwinding
+	asyncifyRewinding
+)
+
+// Asyncify runs the functions of a module transformed by the asyncify pass
+// of Binaryen, whose calls can be suspended by a host function: the call
+// then unwinds, saving the locals of its frames in a buffer of the memory
+// of the module, and can be resumed later by rewinding the frames. Unlike
+// Pause, the module suspends itself, so the calls suspend in native code
+// as well, and the suspended state only holds the frames of the module.
+type Asyncify struct {
+	vm *VM
+	// the indices of asyncify_start_unwind, asyncify_stop_unwind,
+	// asyncify_start_rewind and asyncify_stop_rewind
+	startUnwind, stopUnwind, startRewind, stopRewind int64
+	// the address of the asyncify data structure, followed by the buffer
+	// of the frames up to end
+	data, end uint32
+
+	state int
+	// the result of the host function the call is resumed in, and the
+	// operation of the asynchronous host function suspending the call
+	result  AsyncResult
+	pending <-chan AsyncResult
+}
+
+// AsyncifyState is the state of a call suspended by Asyncify: the function
+// called and its arguments, and the frames of the call saved by the
+// module, which hold the locals of the frames. It can be resumed by an
+// Asyncify of the same instance, or of a copy of it, possibly in another
+// process once serialized with MarshalBinary.
+type AsyncifyState struct {
+	Func   int64
+	Args   []uint64
+	Frames []byte
+
+	// the result of the asynchronous host function the call is suspended
+	// in, see Pending
+	pending <-chan AsyncResult
+}
+
+// Asyncify returns the Asyncify running the calls of vm, whose module must
+// export the functions added by the asyncify pass, otherwise ERR_ASYNCIFY
+// is returned. The suspended frames are saved in the size bytes of the
+// memory at data, which the module mustn't use otherwise.
+func (vm *VM) Asyncify(data, size uint32) (*Asyncify, error) {
+	a := &Asyncify{vm: vm, data: data, end: data + size}
+	if size < 8 || uint64(data)+uint64(size) > uint64(len(vm.memory)) || data%4 != 0 {
+		return nil, ERR_ASYNCIFY
+	}
+	for _, fn := range []struct {
+		name  string
+		index *int64
+		param bool
+	}{
+		{"asyncify_start_unwind", &a.startUnwind, true},
+		{"asyncify_stop_unwind", &a.stopUnwind, false},
+		{"asyncify_start_rewind", &a.startRewind, true},
+		{"asyncify_stop_rewind", &a.stopRewind, false},
+	} {
+		index, ok := vm.exportedFunc(fn.name)
+		if !ok {
+			return nil, ERR_ASYNCIFY
+		}
+		sig := vm.module.GetFunction(int(index)).Sig
+		var params []wasm.ValueType
+		if fn.param {
+			params = []wasm.ValueType{wasm.ValueTypeI32}
+		}
+		if !sameTypes(sig.ParamTypes, params) || len(sig.ReturnTypes) != 0 {
+			return nil, ERR_ASYNCIFY
+		}
+		*fn.index = index
+	}
+	vm.asyncify = a
+	return a, nil
+}
+
+// exportedFunc returns the index of the function the module of vm exports
+// with the given name, and whether there is one.
+func (vm *VM) exportedFunc(name string) (int64, bool) {
+	if vm.module.Export == nil {
+		return 0, false
+	}
+	entry, ok := vm.module.Export.Entries[name]
+	if !ok || entry.Kind != wasm.ExternalFunction || vm.module.GetFunction(int(entry.Index)) == nil {
+		return 0, false
+	}
+	return int64(entry.Index), true
+}
+
+// Call calls the function with the given index and arguments like
+// ExecCodeRaw. If a host function suspends the call with Suspend, Call
+// returns the state of the call once it unwound, for Resume to resume it.
+func (a *Asyncify) Call(fnIndex int64, args ...uint64) (uint64, *AsyncifyState, error) {
+	if a.state != asyncifyNormal {
+		return 0, nil, ERR_ASYNCIFY_STATE
+	}
+	return a.run(fnIndex, args)
+}
+
+// Resume resumes the call suspended with the given state, the host
+// function that suspended it returning result.
+func (a *Asyncify) Resume(state *AsyncifyState, result uint64) (uint64, *AsyncifyState, error) {
+	return a.resume(state, AsyncResult{Value: result})
+}
+
+func (a *Asyncify) resume(state *AsyncifyState, result AsyncResult) (uint64, *AsyncifyState, error) {
+	if a.state != asyncifyNormal {
+		return 0, nil, ERR_ASYNCIFY_STATE
+	}
+	if uint64(len(state.Frames)) > uint64(a.end-a.data-8) {
+		return 0, nil, ERR_ASYNCIFY
+	}
+	// the module rewinds from the top of the saved frames
+	mem := a.vm.memory
+	top := a.data + 8 + uint32(len(state.Frames))
+	copy(mem[a.data+8:], state.Frames)
+	binary.LittleEndian.PutUint32(mem[a.data:], top)
+	binary.LittleEndian.PutUint32(mem[a.data+4:], a.end)
+	a.vm.wrote(uint64(a.data), 8+uint64(len(state.Frames)))
+
+	if _, err := a.vm.ExecCodeRaw(a.startRewind, uint64(a.data)); err != nil {
+		return 0, nil, err
+	}
+	a.state, a.result = asyncifyRewinding, result
+	return a.run(state.Func, state.Args)
+}
+
+// run runs a call, and captures its state if it unwinds.
+func (a *Asyncify) run(fnIndex int64, args []uint64) (uint64, *AsyncifyState, error) {
+	// a trap leaves the module in the normal state
+	trapped := true
+	defer func() {
+		if trapped {
+			a.reset()
+		}
+	}()
+	res, err := a.vm.ExecCodeRaw(fnIndex, args...)
+	trapped = false
+	switch {
+	case err != nil:
+		a.reset()
+		return 0, nil, err
+	case a.state == asyncifyRewinding:
+		// the call didn't reach a host function to resume
+		a.reset()
+		return 0, nil, ERR_ASYNCIFY_STATE
+	case a.state != asyncifyUnwinding:
+		return res, nil, nil
+	}
+
+	a.state = asyncifyNormal
+	pending := a.pending
+	a.pending = nil
+	if _, err := a.vm.ExecCodeRaw(a.stopUnwind); err != nil {
+		return 0, nil, err
+	}
+	mem := a.vm.memory
+	top := binary.LittleEndian.Uint32(mem[a.data:])
+	if top < a.data+8 || top > a.end {
+		return 0, nil, ERR_ASYNCIFY
+	}
+	return 0, &AsyncifyState{
+		Func:    fnIndex,
+		Args:    append([]uint64(nil), args...),
+		Frames:  append([]byte(nil), mem[a.data+8:top]...),
+		pending: pending,
+	}, nil
+}
+
+// reset stops the unwinding or the rewinding of the module, if any.
+func (a *Asyncify) reset() {
+	state := a.state
+	a.state = asyncifyNormal
+	if state == asyncifyUnwinding {
+		a.vm.ExecCodeRaw(a.stopUnwind)
+	} else if state == asyncifyRewinding {
+		a.vm.ExecCodeRaw(a.stopRewind)
+	}
+}
+
+// Suspend is called by a host function to suspend the call it runs in,
+// and returns whether the call is being resumed. A host function
+// suspending the call returns right away, the call then unwinding for
+// Call or Resume to return its state. When the call is resumed, the host
+// function is called again, and returns the result passed to Resume. The
+// result of the host function is set by Suspend in both cases.
+func (a *Asyncify) Suspend() bool {
+	vm := a.vm
+	resumed := a.state == asyncifyRewinding
+	if resumed {
+		a.state = asyncifyNormal
+		a.callNested(a.stopRewind)
+	} else {
+		binary.LittleEndian.PutUint32(vm.memory[a.data:], a.data+8)
+		binary.LittleEndian.PutUint32(vm.memory[a.data+4:], a.end)
+		vm.wrote(uint64(a.data), 8)
+		a.callNested(a.startUnwind, uint64(a.data))
+		a.state = asyncifyUnwinding
+	}
+	if vm.envFunc.envFuncRtn {
+		if resumed {
+			vm.pushUint64(a.result.Value)
+		} else {
+			vm.pushUint64(0)
+		}
+	}
+	return resumed
+}
+
+// callNested calls a function of the module from a host function, whose
+// context is restored afterwards.
+func (a *Asyncify) callNested(fnIndex int64, args ...uint64) {
+	vm := a.vm
+	ctx := vm.ctx
+	defer func() { vm.ctx = ctx }()
+	if _, err := vm.ExecCodeRaw(fnIndex, args...); err != nil {
+		panic(err)
+	}
+}
+
+// An AsyncifyState serialized by MarshalBinary has the following layout:
+//
+//	magic   [4]byte "\x00bva"
+//	version uint32  asyncifyVersion
+//	func    uint64
+//	args    uint32 count, uint64 values
+//	frames  uint32 length, bytes
+//
+// All integers are little endian.
+const (
+	asyncifyMagic   = "\x00bva"
+	asyncifyVersion = 1
+)
+
+// MarshalBinary encodes s, for UnmarshalBinary to read it back.
+func (s *AsyncifyState) MarshalBinary() ([]byte, error) {
+	w := &compiledWriter{}
+	w.WriteString(asyncifyMagic)
+	w.uint32(asyncifyVersion)
+	w.uint64(uint64(s.Func))
+	w.values(s.Args)
+	w.bytes(s.Frames)
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a state encoded by MarshalBinary.
+func (s *AsyncifyState) UnmarshalBinary(data []byte) error {
+	r := &compiledReader{data: data}
+	if string(r.next(4)) != asyncifyMagic || r.uint32() != asyncifyVersion {
+		return ERR_ASYNCIFY_FORMAT
+	}
+	s.Func = int64(r.uint64())
+	s.Args = r.values()
+	s.Frames = append([]byte(nil), r.bytes()...)
+	if r.err != nil || len(r.data) != 0 {
+		return ERR_ASYNCIFY_FORMAT
+	}
+	return nil
+}
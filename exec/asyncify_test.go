@@ -0,0 +1,101 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestAsyncify(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/asyncify.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var async *Asyncify
+	suspended := 0
+	imports := NewEnvFunc()
+	imports.Register("oracle", func(vm *VM) (bool, error) {
+		if !async.Suspend() {
+			suspended++
+		}
+		return true, nil
+	})
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+
+	if _, err := vm.Asyncify(1024, 4); err != ERR_ASYNCIFY {
+		t.Fatalf("Asyncify with a small buffer: got=%v, want=%v", err, ERR_ASYNCIFY)
+	}
+	if async, err = vm.Asyncify(1024, 1024); err != nil {
+		t.Fatal(err)
+	}
+
+	// run(x) returns x + 2*oracle(), the oracle suspending the call
+	run, _ := vm.exportedFunc("run")
+	res, state, err := async.Call(run, 5)
+	if err != nil || state == nil || res != 0 || suspended != 1 {
+		t.Fatalf("Call: got=%d, %+v, %v", res, state, err)
+	}
+	if want := []byte{5, 0, 0, 0}; !bytes.Equal(state.Frames, want) {
+		t.Errorf("unexpected frames: got=%v, want=%v", state.Frames, want)
+	}
+
+	// the state is resumed after a round trip through its serialization
+	data, err := state.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &AsyncifyState{}
+	if err := restored.UnmarshalBinary(data); err != nil || !reflect.DeepEqual(restored, state) {
+		t.Fatalf("UnmarshalBinary: got=%+v, %v", restored, err)
+	}
+	if err := new(AsyncifyState).UnmarshalBinary(data[:len(data)-1]); err != ERR_ASYNCIFY_FORMAT {
+		t.Errorf("UnmarshalBinary of truncated data: got=%v, want=%v", err, ERR_ASYNCIFY_FORMAT)
+	}
+
+	// the memory is clobbered meanwhile
+	copy(vm.Memory()[1024:], make([]byte, 16))
+	res, state, err = async.Resume(restored, 7)
+	if err != nil || state != nil || res != 19 || suspended != 1 {
+		t.Fatalf("Resume: got=%d, %+v, %v", res, state, err)
+	}
+	if state, err := vm.ExecCode(int64(module.Export.Entries["asyncify_get_state"].Index)); err != nil || state != uint32(0) {
+		t.Errorf("asyncify_get_state: got=%v, %v", state, err)
+	}
+
+	other := readTestModule(t, "testdata/canon.wasm")
+	otherVM, err := NewVM(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := otherVM.Asyncify(1024, 1024); err != ERR_ASYNCIFY {
+		t.Errorf("Asyncify of a module not asyncified: got=%v, want=%v", err, ERR_ASYNCIFY)
+	}
+}
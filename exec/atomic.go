@@ -0,0 +1,293 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"time"
+
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// ErrUnalignedAtomic is the error value used while trapping the VM when an
+// atomic operator accesses an address which isn't a multiple of its size.
+var ErrUnalignedAtomic = newTrap(TrapUnalignedAtomic, "exec: unaligned atomic")
+
+// ErrExpectedSharedMemory is the error value used while trapping the VM
+// when memory.atomic.wait waits on a memory which isn't shared, since no
+// other agent could wake it up.
+var ErrExpectedSharedMemory = newTrap(TrapExpectedSharedMemory, "exec: expected shared memory")
+
+// atomicSizes are the sizes in bytes of the accesses of the atomic loads,
+// stores and read-modify-write operators, in the order of their
+// sub-opcodes, and atomicWide whether they operate on i64 values.
+var (
+	atomicSizes = [7]int{4, 8, 1, 2, 1, 2, 4}
+	atomicWide  = [7]bool{false, true, false, false, true, true, true}
+)
+
+// atomicRMW are the read-modify-write operations, in the order of their
+// sub-opcodes, returning the value stored given the value loaded and the
+// operand. cmpxchg is handled separately.
+var atomicRMW = [...]func(old, v uint64) uint64{
+	func(old, v uint64) uint64 { return old + v },
+	func(old, v uint64) uint64 { return old - v },
+	func(old, v uint64) uint64 { return old & v },
+	func(old, v uint64) uint64 { return old | v },
+	func(old, v uint64) uint64 { return old ^ v },
+	func(old, v uint64) uint64 { return v },
+}
+
+// atomic runs the operator prefixed by ops.PrefixAtomic, whose sub-opcode
+// follows the prefix as a uint32. The atomic operators lock a shared
+// memory, which makes them sequentially consistent.
+func (vm *VM) atomic() {
+	start := vm.ctx.pc - 1
+	sub := vm.fetchUint32()
+	if vm.atomicCosts != nil {
+		vm.consumeGas(GasMemory, vm.atomicCosts[sub])
+	}
+
+	switch {
+	case sub == ops.MemoryAtomicNotify:
+		vm.atomicNotify(start)
+	case sub == ops.MemoryAtomicWait32:
+		vm.atomicWait(start, 4)
+	case sub == ops.MemoryAtomicWait64:
+		vm.atomicWait(start, 8)
+	case sub == ops.AtomicFence:
+		// the other atomic operators already order the accesses
+	case sub >= ops.I32AtomicLoad && sub <= ops.I64AtomicLoad32u:
+		vm.atomicLoad(start, int(sub-ops.I32AtomicLoad))
+	case sub >= ops.I32AtomicStore && sub <= ops.I64AtomicStore32:
+		vm.atomicStore(start, int(sub-ops.I32AtomicStore))
+	case sub >= ops.I32AtomicRmwAdd && sub <= ops.I64AtomicRmw32CmpxchgU:
+		vm.atomicRMW(start, int(sub-ops.I32AtomicRmwAdd))
+	default:
+		panic(ops.InvalidPrefixedOpcodeError{Prefix: ops.PrefixAtomic, Sub: sub})
+	}
+}
+
+// atomicAddress pops the address operand of an atomic operator accessing
+// size bytes, and returns the address it accesses, adding the offset
+// following the operator in the code. It traps if the access is out of
+// bounds or unaligned. start is the offset of the operator in the code.
+func (vm *VM) atomicAddress(start int64, size int) uint64 {
+	addr, overflow := vm.fetchEffectiveAddr()
+	if overflow || addr+uint64(size) > uint64(len(vm.memory)) {
+		panic(&MemoryAccessError{
+			Address:    addr,
+			Size:       size,
+			MemorySize: len(vm.memory),
+			Func:       vm.ctx.curFunc,
+			Offset:     start,
+			Name:       vm.funcName(vm.ctx.curFunc),
+			Source:     vm.sourceLine(vm.ctx.curFunc, start),
+		})
+	}
+	if addr%uint64(size) != 0 {
+		panic(ErrUnalignedAtomic)
+	}
+	return addr
+}
+
+func (vm *VM) loadSized(addr uint64, size int) uint64 {
+	switch size {
+	case 1:
+		return uint64(vm.memory[addr])
+	case 2:
+		return uint64(endianess.Uint16(vm.memory[addr:]))
+	case 4:
+		return uint64(endianess.Uint32(vm.memory[addr:]))
+	}
+	return endianess.Uint64(vm.memory[addr:])
+}
+
+func (vm *VM) storeSized(addr uint64, size int, v uint64) {
+	if vm.written != nil {
+		vm.wrote(addr, uint64(size))
+	}
+	switch size {
+	case 1:
+		vm.memory[addr] = byte(v)
+	case 2:
+		endianess.PutUint16(vm.memory[addr:], uint16(v))
+	case 4:
+		endianess.PutUint32(vm.memory[addr:], uint32(v))
+	default:
+		endianess.PutUint64(vm.memory[addr:], v)
+	}
+}
+
+// sizeMask returns the mask of the low bits of a value of size bytes.
+func sizeMask(size int) uint64 {
+	return ^uint64(0) >> uint(64-8*size)
+}
+
+// atomicLoad runs the atomic load of the given index in atomicSizes.
+func (vm *VM) atomicLoad(start int64, index int) {
+	size := atomicSizes[index]
+	vm.lockMemory()
+	defer vm.unlockMemory()
+	vm.pushUint64(vm.loadSized(vm.atomicAddress(start, size), size))
+}
+
+// atomicStore runs the atomic store of the given index in atomicSizes.
+func (vm *VM) atomicStore(start int64, index int) {
+	size := atomicSizes[index]
+	v := vm.popUint64()
+	vm.lockMemory()
+	defer vm.unlockMemory()
+	vm.storeSized(vm.atomicAddress(start, size), size, v)
+}
+
+// atomicRMW runs the read-modify-write operator of the given index from
+// the first one, i32.atomic.rmw.add, pushing the value loaded.
+func (vm *VM) atomicRMW(start int64, index int) {
+	size, op := atomicSizes[index%7], index/7
+	v := vm.popUint64() & sizeMask(size)
+	var expected uint64
+	if op == len(atomicRMW) {
+		// cmpxchg stores its second operand if the value loaded is the
+		// first one
+		expected = vm.popUint64() & sizeMask(size)
+	}
+	vm.lockMemory()
+	defer vm.unlockMemory()
+	addr := vm.atomicAddress(start, size)
+	old := vm.loadSized(addr, size)
+	switch {
+	case op < len(atomicRMW):
+		vm.storeSized(addr, size, atomicRMW[op](old, v))
+	case old == expected:
+		vm.storeSized(addr, size, v)
+	}
+	vm.pushUint64(old)
+}
+
+// atomicWait suspends the goroutine of the VM until memory.atomic.notify
+// wakes it up, if the value of size bytes at the address of the operand
+// is the expected one, or until the timeout in nanoseconds expires, if it
+// isn't negative. It pushes 0 if woken up, 1 if the value wasn't the
+// expected one, and 2 on timeout.
+func (vm *VM) atomicWait(start int64, size int) {
+	timeout := vm.popInt64()
+	expected := vm.popUint64() & sizeMask(size)
+	s := vm.shared
+	if s == nil || s.store != nil && !s.store.limits.Shared() {
+		panic(ErrExpectedSharedMemory)
+	}
+
+	woken := make(chan struct{})
+	var addr uint64
+	if !func() bool {
+		vm.lockMemory()
+		defer vm.unlockMemory()
+		addr = vm.atomicAddress(start, size)
+		if vm.loadSized(addr, size) != expected {
+			return false
+		}
+		if s.waiters == nil {
+			s.waiters = make(map[uint64][]chan struct{})
+		}
+		s.waiters[addr] = append(s.waiters[addr], woken)
+		return true
+	}() {
+		vm.pushInt32(1)
+		return
+	}
+
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(time.Duration(timeout))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	// a call which can be interrupted polls for its interruption, since
+	// no safepoint is reached while it waits
+	var poll <-chan time.Time
+	if vm.interruptible != 0 || vm.epochTicks != 0 {
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	var interrupted error
+	for waiting := true; waiting; {
+		select {
+		case <-woken:
+			vm.pushInt32(0)
+			return
+		case <-expired:
+			waiting = false
+		case <-poll:
+			if interrupted = vm.interruption(); interrupted != nil {
+				waiting = false
+			}
+		}
+	}
+
+	// the waiter may have been woken up in the meantime
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	waiters := s.waiters[addr]
+	for i, ch := range waiters {
+		if ch == woken {
+			s.waiters[addr] = append(waiters[:i:i], waiters[i+1:]...)
+			if len(s.waiters[addr]) == 0 {
+				delete(s.waiters, addr)
+			}
+			if interrupted != nil {
+				panic(interrupted)
+			}
+			vm.pushInt32(2)
+			return
+		}
+	}
+	if interrupted != nil {
+		panic(interrupted)
+	}
+	vm.pushInt32(0)
+}
+
+// atomicNotify wakes up to count agents waiting on the address of the
+// operand, in the order they started waiting, and pushes their number. A
+// memory which isn't shared has no waiters.
+func (vm *VM) atomicNotify(start int64) {
+	count := vm.popUint32()
+	vm.lockMemory()
+	defer vm.unlockMemory()
+	addr := vm.atomicAddress(start, 4)
+	s := vm.shared
+	if s == nil {
+		vm.pushInt32(0)
+		return
+	}
+	waiters := s.waiters[addr]
+	n := len(waiters)
+	if uint64(count) < uint64(n) {
+		n = int(count)
+	}
+	for _, ch := range waiters[:n] {
+		close(ch)
+	}
+	if n == len(waiters) {
+		delete(s.waiters, addr)
+	} else {
+		s.waiters[addr] = waiters[n:]
+	}
+	vm.pushInt32(int32(n))
+}
@@ -0,0 +1,161 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+// CallSpec is a call of a batch, see (*Instance).CallBatch.
+type CallSpec struct {
+	Name string        // The name of the exported function
+	Args []interface{} // The arguments, converted like the ones of Call
+}
+
+// CallResult is the outcome of a call of a batch.
+type CallResult struct {
+	Results []interface{} // Boxed like the ones of Call
+	Err     error
+	// GasUsed is the gas consumed by the call, if the batch is metered.
+	// Events are the events it emitted, if the VM of the batch collects
+	// them, none if the batch is rolled back.
+	GasUsed uint64
+	Events  []Event
+}
+
+// BatchConfig configures the calls of a batch.
+type BatchConfig struct {
+	// Gas is the gas budget shared by the calls, metered according to
+	// Schedule, or the default schedule if nil. The calls are unmetered if
+	// Gas is zero.
+	Gas      uint64
+	Schedule *GasSchedule
+	// Prepare, if not nil, sets up the VM running the calls before the
+	// first one, with a contract context, a state store or a chain
+	// context, or to collect the events of the calls.
+	Prepare func(vm *VM)
+}
+
+// CallBatch runs the calls one after the other on a single VM of inst,
+// like Call, for the multicall transactions not to pay for an instance per
+// call, and returns their outcomes in their order. The batch is atomic:
+// the calls share the gas budget of config, and a call failing, including
+// running out of the gas the previous calls left, stops the batch and rolls
+// all of them back. inst is brought back to its state before the batch,
+// the storage writes of the calls are discarded, and the calls which
+// didn't run fail with ERR_BATCH_ABORTED. The storage writes are kept
+// apart until all the calls succeed, and then written to the contract
+// database and the StateStore of the VM, a failing write failing the last
+// call and rolling back inst, though the writes before it are committed.
+// The state of inst is captured
+// once before the first call, see Snapshot, an instance which can't be
+// snapshotted failing the first call and aborting the others.
+func (inst *Instance) CallBatch(calls []CallSpec, config BatchConfig) []CallResult {
+	results := make([]CallResult, len(calls))
+	if len(calls) == 0 {
+		return results
+	}
+	snapshot, err := inst.Snapshot()
+	if err != nil {
+		abortBatch(results, 0, err)
+		return results
+	}
+
+	vm := inst.NewVM()
+	if config.Prepare != nil {
+		config.Prepare(vm)
+	}
+	if config.Gas != 0 {
+		schedule := config.Schedule
+		if schedule == nil {
+			schedule = DefaultGasSchedule()
+		}
+		vm.SetGasMeter(NewGasMeter(config.Gas), schedule)
+	}
+	var journal *stateJournal
+	if ctx := vm.contract; ctx != nil && ctx.ContractDB != nil {
+		journal = newStateJournal(ctx.ContractDB)
+		batchContext := *ctx
+		batchContext.ContractDB = journal
+		vm.contract = &batchContext
+	}
+	var store *storeJournal
+	if vm.stateStore != nil {
+		store = newStoreJournal(vm.stateStore)
+		vm.stateStore = store
+	}
+
+	for i, call := range calls {
+		res := &results[i]
+		res.Results, res.Err = inst.callBatched(vm, call)
+		res.GasUsed, res.Events = vm.GasUsed(), vm.Events()
+		if res.Err != nil {
+			inst.rollbackBatch(results, i+1, snapshot)
+			return results
+		}
+	}
+	if store != nil {
+		err = store.commit()
+	}
+	if err == nil && journal != nil {
+		err = journal.commit()
+	}
+	if err != nil {
+		// the last call fails, the commit being part of the batch
+		results[len(results)-1].Err = err
+		inst.rollbackBatch(results, len(results), snapshot)
+	}
+	return results
+}
+
+// callBatched runs call on vm, returning its trap as an error.
+func (inst *Instance) callBatched(vm *VM, call CallSpec) (results []interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if !isTrap(r) {
+				panic(r)
+			}
+			results, err = nil, r.(error)
+		}
+	}()
+	return inst.call(vm, call.Name, call.Args)
+}
+
+// rollbackBatch brings inst back to snapshot, the state before a batch
+// whose call n-1 failed, and marks the results of the following calls as
+// aborted and the events of the calls as discarded. The calls are failed
+// with the error of Restore if it fails.
+func (inst *Instance) rollbackBatch(results []CallResult, n int, snapshot []byte) {
+	abortBatch(results, n, nil)
+	for i := range results[:n] {
+		results[i].Events = nil
+	}
+	if err := inst.Restore(snapshot); err != nil {
+		for i := range results[:n] {
+			results[i].Results, results[i].Err = nil, err
+		}
+	}
+}
+
+// abortBatch fails the call n of a batch with err, if not nil, and the
+// following ones with ERR_BATCH_ABORTED.
+func abortBatch(results []CallResult, n int, err error) {
+	if err != nil {
+		results[n].Err = err
+		n++
+	}
+	for i := n; i < len(results); i++ {
+		results[i].Err = ERR_BATCH_ABORTED
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bottos-project/bottos/common/types"
+	"github.com/bottos-project/bottos/contract"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestCallBatch(t *testing.T) {
+	compiled, err := CompileModule(readTestModule(t, "testdata/instance-snapshot.wasm"), VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	// bump increments a global, stored at 16, and load reads the memory
+	results := inst.CallBatch([]CallSpec{{Name: "bump"}, {Name: "bump"}, {Name: "load", Args: []interface{}{16}}}, BatchConfig{Gas: 1000})
+	var gas uint64
+	for i, want := range []uint32{1, 2, 2} {
+		res := results[i]
+		if res.Err != nil || len(res.Results) != 1 || res.Results[0] != want || res.GasUsed == 0 {
+			t.Fatalf("call %d: got=%+v, want=%d", i, res, want)
+		}
+		gas += res.GasUsed
+	}
+	bump := results[0].GasUsed
+
+	// a call trapping rolls back the batch
+	results = inst.CallBatch([]CallSpec{{Name: "bump"}, {Name: "load", Args: []interface{}{1 << 20}}, {Name: "bump"}}, BatchConfig{})
+	if results[0].Err != nil || results[0].Results[0] != uint32(3) || results[2].Err != ERR_BATCH_ABORTED {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if _, ok := results[1].Err.(*TrapError); !ok {
+		t.Errorf("got=%v, want a trap", results[1].Err)
+	}
+	// the gas budget is shared by the calls
+	results = inst.CallBatch([]CallSpec{{Name: "bump"}, {Name: "bump"}}, BatchConfig{Gas: bump + bump/2})
+	if results[0].Err != nil || !errors.Is(results[1].Err, ErrOutOfGas) {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if res, err := inst.Call("bump"); err != nil || res[0] != uint32(3) {
+		t.Errorf("bump after the rollbacks: got=%v %v, want=3", res, err)
+	}
+	// an unknown export or invalid arguments fail their call
+	results = inst.CallBatch([]CallSpec{{Name: "missing"}, {Name: "bump"}}, BatchConfig{})
+	if results[0].Err != ERR_UNKNOWN_EXPORT || results[1].Err != ERR_BATCH_ABORTED {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if results := inst.CallBatch(nil, BatchConfig{}); len(results) != 0 {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+func TestCallBatchStorage(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/storage.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnvFunc()
+	RegisterStorage(env, StorageConfig{MaxKeySize: 4, MaxValueSize: 8, CallGas: 10, WriteByteGas: 5})
+	inst, err := compiled.Instantiate(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	store := memStateStore{}
+	config := BatchConfig{Gas: 1000, Prepare: func(vm *VM) {
+		vm.SetStateStore(store)
+		vm.SetContract(&contract.Context{Trx: &types.Transaction{Contract: "c"}})
+	}}
+
+	// the keys are at 100 and 102, the values at 200 and 202
+	copy(inst.Memory()[100:], "k1k2")
+	copy(inst.Memory()[200:], "v1v2")
+	set := func(key, value int) CallSpec {
+		return CallSpec{Name: "set", Args: []interface{}{key, 2, value, 2}}
+	}
+	results := inst.CallBatch([]CallSpec{set(100, 200), set(102, 202)}, config)
+	for i, res := range results {
+		if res.Err != nil || res.Results[0] != uint32(0) {
+			t.Fatalf("set %d: %+v", i, res)
+		}
+	}
+	if string(store["c/k1"]) != "v1" || string(store["c/k2"]) != "v2" {
+		t.Errorf("unexpected store %q", store)
+	}
+
+	// the writes of a batch running out of gas are discarded
+	config.Gas = results[0].GasUsed + results[0].GasUsed/2
+	results = inst.CallBatch([]CallSpec{set(100, 202), set(102, 200)}, config)
+	if results[0].Err != nil || !errors.Is(results[1].Err, ErrOutOfGas) {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if string(store["c/k1"]) != "v1" || string(store["c/k2"]) != "v2" {
+		t.Errorf("unexpected store %q", store)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "math/big"
+
+// DefaultBigIntPowGas is the gas of u128_pow and u256_pow of a
+// BigIntConfig setting none.
+const DefaultBigIntPowGas = 1000
+
+// BigIntConfig configures the big integer host functions.
+type BigIntConfig struct {
+	// CallGas is the gas charged for every call but the exponentiations,
+	// HOST_CALL_GAS if zero, and PowGas the one of the exponentiations,
+	// DefaultBigIntPowGas if zero.
+	CallGas uint64
+	PowGas  uint64
+}
+
+// BIGINT_DIV_ZERO is the status returned by the divisions of the big
+// integer host functions by zero, see RegisterBigInt.
+const BIGINT_DIV_ZERO = -1
+
+// RegisterBigInt registers the big integer host functions into env, which
+// compute on the unsigned integers of 128 and 256 bits held by the memory
+// of the VM calling them, in 16 and 32 bytes in little-endian order:
+//
+//	int32_t u256_add(uint8_t a[32], uint8_t b[32], uint8_t out[32]);
+//	int32_t u256_sub(uint8_t a[32], uint8_t b[32], uint8_t out[32]);
+//	int32_t u256_mul(uint8_t a[32], uint8_t b[32], uint8_t out[32]);
+//	int32_t u256_div(uint8_t a[32], uint8_t b[32], uint8_t out[32]);
+//	int32_t u256_mod(uint8_t a[32], uint8_t b[32], uint8_t out[32]);
+//	int32_t u256_pow(uint8_t a[32], uint8_t b[32], uint8_t out[32]);
+//	int32_t u256_cmp(uint8_t a[32], uint8_t b[32]);
+//
+// and the same u128_ functions on 16 bytes. add, sub, mul and pow write
+// the result modulo 2¹²⁸ or 2²⁵⁶ to out, which may be a or b, and return
+// 1 if it wrapped around and 0 otherwise. div and mod write the quotient
+// and the remainder of a by b and return 0, or BIGINT_DIV_ZERO, leaving
+// out unchanged, if b is zero. cmp returns -1, 0 or 1 as a is less than,
+// equal to or greater than b. The gas of the calls is fixed, see
+// BigIntConfig, and buffers out of the bounds of the memory trap the VM.
+func RegisterBigInt(env *EnvFunc, config BigIntConfig) {
+	if config.CallGas == 0 {
+		config.CallGas = HOST_CALL_GAS
+	}
+	if config.PowGas == 0 {
+		config.PowGas = DefaultBigIntPowGas
+	}
+	for _, prefix := range []string{"u128_", "u256_"} {
+		b := &bigIntFuncs{config: config, size: 16}
+		if prefix == "u256_" {
+			b.size = 32
+		}
+		b.modulus = new(big.Int).Lsh(big.NewInt(1), uint(8*b.size))
+		env.Register(prefix+"add", b.op(config.CallGas, b.add))
+		env.Register(prefix+"sub", b.op(config.CallGas, b.sub))
+		env.Register(prefix+"mul", b.op(config.CallGas, b.mul))
+		env.Register(prefix+"div", b.op(config.CallGas, b.div))
+		env.Register(prefix+"mod", b.op(config.CallGas, b.mod))
+		env.Register(prefix+"pow", b.op(config.PowGas, b.pow))
+		env.Register(prefix+"cmp", b.cmp)
+	}
+}
+
+type bigIntFuncs struct {
+	config BigIntConfig
+	// the size of the integers in bytes, and 2 to the power of their bits
+	size    int
+	modulus *big.Int
+}
+
+// load returns the integer at ptr.
+func (b *bigIntFuncs) load(vm *VM, ptr uint32) *big.Int {
+	buf := make([]byte, b.size)
+	src := vm.hostBytes(ptr, uint32(b.size))
+	for i := range buf {
+		buf[i] = src[b.size-1-i]
+	}
+	return new(big.Int).SetBytes(buf)
+}
+
+// store stores x, which must fit, at ptr.
+func (b *bigIntFuncs) store(vm *VM, ptr uint32, x *big.Int) {
+	buf := x.FillBytes(make([]byte, b.size))
+	dst := vm.hostOutput(ptr, uint32(b.size))
+	for i := range buf {
+		dst[i] = buf[b.size-1-i]
+	}
+}
+
+// wrap reduces x modulo the modulus of b, and returns whether it had to.
+func (b *bigIntFuncs) wrap(x *big.Int) bool {
+	if x.Sign() >= 0 && x.Cmp(b.modulus) < 0 {
+		return false
+	}
+	x.Mod(x, b.modulus)
+	return true
+}
+
+// op returns the host function of the operation f costing gas, which
+// sets res to the result of x and y and returns the status of the call.
+func (b *bigIntFuncs) op(gas uint64, f func(res, x, y *big.Int) int32) func(vm *VM) (bool, error) {
+	return func(vm *VM) (bool, error) {
+		params := vm.GetFuncParams()
+		if len(params) != 3 {
+			return false, ERR_PARAM_COUNT
+		}
+		x, y := b.load(vm, uint32(params[0])), b.load(vm, uint32(params[1]))
+		vm.hostBytes(uint32(params[2]), uint32(b.size))
+		if vm.gasMeter != nil {
+			vm.ChargeGas(gas)
+		}
+		res := new(big.Int)
+		status := f(res, x, y)
+		if status != BIGINT_DIV_ZERO {
+			b.store(vm, uint32(params[2]), res)
+		}
+		vm.SetFuncResult(uint64(uint32(status)))
+		return true, nil
+	}
+}
+
+// overflow returns the status of an operation wrapping around or not.
+func overflow(wrapped bool) int32 {
+	if wrapped {
+		return 1
+	}
+	return 0
+}
+
+func (b *bigIntFuncs) add(res, x, y *big.Int) int32 {
+	return overflow(b.wrap(res.Add(x, y)))
+}
+
+func (b *bigIntFuncs) sub(res, x, y *big.Int) int32 {
+	return overflow(b.wrap(res.Sub(x, y)))
+}
+
+func (b *bigIntFuncs) mul(res, x, y *big.Int) int32 {
+	return overflow(b.wrap(res.Mul(x, y)))
+}
+
+func (b *bigIntFuncs) div(res, x, y *big.Int) int32 {
+	if y.Sign() == 0 {
+		return BIGINT_DIV_ZERO
+	}
+	res.Quo(x, y)
+	return 0
+}
+
+func (b *bigIntFuncs) mod(res, x, y *big.Int) int32 {
+	if y.Sign() == 0 {
+		return BIGINT_DIV_ZERO
+	}
+	res.Rem(x, y)
+	return 0
+}
+
+// pow computes x to the power of y, which wraps around unless the result
+// has no more bits than the integers, the exponentiation modulo 2ⁿ being
+// computed in all cases without the full power.
+func (b *bigIntFuncs) pow(res, x, y *big.Int) int32 {
+	res.Exp(x, y, b.modulus)
+	bits := 8 * b.size
+	switch {
+	case x.Sign() == 0 || x.Cmp(big.NewInt(1)) == 0 || y.Sign() == 0:
+		return 0
+	case y.BitLen() > 16:
+		// x >= 2 and y >= 2¹⁶
+		return 1
+	}
+	// the power has at least (x.BitLen()-1)·y+1 bits and at most
+	// x.BitLen()·y, and is computed in full in between
+	e := int(y.Int64())
+	if (x.BitLen()-1)*e+1 > bits {
+		return 1
+	}
+	if x.BitLen()*e <= bits {
+		return 0
+	}
+	return overflow(new(big.Int).Exp(x, y, nil).BitLen() > bits)
+}
+
+func (b *bigIntFuncs) cmp(vm *VM) (bool, error) {
+	params := vm.GetFuncParams()
+	if len(params) != 2 {
+		return false, ERR_PARAM_COUNT
+	}
+	x, y := b.load(vm, uint32(params[0])), b.load(vm, uint32(params[1]))
+	if vm.gasMeter != nil {
+		vm.ChargeGas(b.config.CallGas)
+	}
+	vm.SetFuncResult(uint64(uint32(int32(x.Cmp(y)))))
+	return true, nil
+}
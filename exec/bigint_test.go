@@ -0,0 +1,150 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestBigInt(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/bigint.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnvFunc()
+	RegisterBigInt(env, BigIntConfig{CallGas: 10, PowGas: 50})
+	inst, err := compiled.Instantiate(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+
+	// the operands are at 100 and 200, and the result at 300, in
+	// little-endian order
+	const a, b, out = 100, 200, 300
+	put := func(ptr int, x *big.Int, size int) {
+		buf := x.FillBytes(make([]byte, size))
+		for i := range buf {
+			vm.Memory()[ptr+i] = buf[size-1-i]
+		}
+	}
+	get := func(ptr, size int) *big.Int {
+		buf := make([]byte, size)
+		for i := range buf {
+			buf[i] = vm.Memory()[ptr+size-1-i]
+		}
+		return new(big.Int).SetBytes(buf)
+	}
+	call := func(name string, x, y *big.Int) (int32, *big.Int) {
+		t.Helper()
+		size := 32
+		if name[:4] == "u128" {
+			size = 16
+		}
+		put(a, x, size)
+		put(b, y, size)
+		put(out, big.NewInt(0xbad), size)
+		args := []uint64{a, b, out}
+		if name[5:] == "cmp" {
+			args = args[:2]
+		}
+		res, err := vm.ExecCode(int64(module.Export.Entries[name].Index), args...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return int32(res.(uint32)), get(out, size)
+	}
+	n := func(s string) *big.Int {
+		x, ok := new(big.Int).SetString(s, 0)
+		if !ok {
+			t.Fatalf("bad number %s", s)
+		}
+		return x
+	}
+	max256 := "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	max128 := "0xffffffffffffffffffffffffffffffff"
+
+	for _, tc := range []struct {
+		name   string
+		x, y   string
+		status int32
+		want   string
+	}{
+		{"u256_add", "1", "2", 0, "3"},
+		{"u256_add", max256, "2", 1, "1"},
+		{"u128_add", max128, "1", 1, "0"},
+		{"u128_add", max256[:33], "1", 0, "0x10000000000000000000000000000000"},
+		{"u256_sub", "5", "3", 0, "2"},
+		{"u256_sub", "3", "5", 1, "0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"},
+		{"u256_mul", "0x100000000000000000000000000000000", "0x100000000000000000000000000000000", 1, "0"},
+		{"u256_mul", "0x100000000000000000000000000000000", "0xffffffffffffffffffffffffffffffff", 0, "0xffffffffffffffffffffffffffffffff00000000000000000000000000000000"},
+		{"u128_mul", "0x10000000000000000", "0x10000000000000000", 1, "0"},
+		{"u256_div", "100", "7", 0, "14"},
+		{"u256_div", "100", "0", BIGINT_DIV_ZERO, "0xbad"},
+		{"u256_mod", "100", "7", 0, "2"},
+		{"u256_mod", "100", "0", BIGINT_DIV_ZERO, "0xbad"},
+		{"u256_pow", "2", "255", 0, "0x8000000000000000000000000000000000000000000000000000000000000000"},
+		{"u256_pow", "2", "256", 1, "0"},
+		{"u256_pow", "3", "0", 0, "1"},
+		{"u256_pow", "1", max256, 0, "1"},
+		{"u256_pow", "0", max256, 0, "0"},
+		{"u256_pow", "3", max256, 1, "0x" + new(big.Int).Exp(big.NewInt(3), n(max256), new(big.Int).Lsh(big.NewInt(1), 256)).Text(16)},
+		{"u128_pow", "10", "38", 0, "100000000000000000000000000000000000000"},
+		{"u128_pow", "10", "39", 1, new(big.Int).Mod(new(big.Int).Exp(big.NewInt(10), big.NewInt(39), nil), n("0x100000000000000000000000000000000")).String()},
+		{"u256_cmp", "1", "2", -1, "0xbad"},
+		{"u256_cmp", max256, max256, 0, "0xbad"},
+		{"u128_cmp", "2", "1", 1, "0xbad"},
+	} {
+		status, res := call(tc.name, n(tc.x), n(tc.y))
+		if status != tc.status || res.Cmp(n(tc.want)) != 0 {
+			t.Errorf("%s(%s, %s): got=%d %#x, want=%d %s", tc.name, tc.x, tc.y, status, res, tc.status, tc.want)
+		}
+	}
+
+	// the wrapping of the powers whose size is only known once computed
+	max := n(max128)
+	for x := int64(2); x < 40; x++ {
+		for y := int64(1); y < 130; y++ {
+			full := new(big.Int).Exp(big.NewInt(x), big.NewInt(y), nil)
+			want := int32(0)
+			if full.Cmp(max) > 0 {
+				want = 1
+			}
+			if status, _ := call("u128_pow", big.NewInt(x), big.NewInt(y)); status != want {
+				t.Fatalf("u128_pow(%d, %d): got=%d, want=%d", x, y, status, want)
+			}
+		}
+	}
+
+	meter := NewGasMeter(1000)
+	vm.SetGasMeter(meter, nil)
+	call("u256_add", big.NewInt(1), big.NewInt(1))
+	call("u256_pow", big.NewInt(2), big.NewInt(2))
+	if got := meter.Used(); got != 10+50 {
+		t.Errorf("gas: got=%d, want=%d", got, 10+50)
+	}
+}
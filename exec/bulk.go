@@ -0,0 +1,173 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"math"
+
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// ErrOutOfBoundsTableAccess is the error value used while trapping the VM
+// when a bulk memory operator accesses a table or an element segment
+// past its end.
+var ErrOutOfBoundsTableAccess = newTrap(TrapOutOfBoundsTable, "exec: out of bounds table access")
+
+// misc runs the operator prefixed by ops.PrefixMisc, whose sub-opcode
+// follows the prefix as a uint32.
+func (vm *VM) misc() {
+	start := vm.ctx.pc - 1
+	sub := vm.fetchUint32()
+	if vm.miscCosts != nil {
+		vm.consumeGas(miscGasCategory(sub), vm.miscCosts[sub])
+	}
+
+	switch sub {
+	case ops.MemoryInit:
+		index, memory := vm.fetchUint32(), vm.fetchUint32()
+		vm.swapMemory(memory)
+		defer vm.swapMemory(memory)
+		n, src, dst := vm.popUint32(), vm.popUint32(), vm.popAddr()
+		data := vm.dataSegments[index]
+		if uint64(src)+uint64(n) > uint64(len(data)) {
+			panic(ErrOutOfBoundsMemoryAccess)
+		}
+		vm.checkBulkMemory(start, vm.memory, dst, uint64(n))
+		vm.chargeBulk(GasMemory, uint64(n))
+		copy(vm.memory[dst:], data[src:src+n])
+		vm.wrote(dst, uint64(n))
+	case ops.DataDrop:
+		vm.dataSegments[vm.fetchUint32()] = nil
+	case ops.MemoryCopy:
+		dstMemory, srcMemory := vm.fetchUint32(), vm.fetchUint32()
+		dstMem, dst64 := vm.memoryAt(dstMemory)
+		srcMem, src64 := vm.memoryAt(srcMemory)
+		var n uint64
+		if dst64 && src64 {
+			n = vm.popUint64()
+		} else {
+			n = uint64(vm.popUint32())
+		}
+		src, dst := vm.popAddress(src64), vm.popAddress(dst64)
+		vm.checkBulkMemory(start, srcMem, src, n)
+		vm.checkBulkMemory(start, dstMem, dst, n)
+		vm.chargeBulk(GasMemory, n)
+		copy(dstMem[dst:dst+n], srcMem[src:src+n])
+		vm.wroteAt(dstMemory, dst, n)
+	case ops.MemoryFill:
+		memory := vm.fetchUint32()
+		vm.swapMemory(memory)
+		defer vm.swapMemory(memory)
+		n, val, dst := vm.popAddr(), byte(vm.popUint32()), vm.popAddr()
+		vm.checkBulkMemory(start, vm.memory, dst, n)
+		vm.chargeBulk(GasMemory, n)
+		mem := vm.memory[dst : dst+n]
+		for i := range mem {
+			mem[i] = val
+		}
+		vm.wrote(dst, n)
+	case ops.TableInit:
+		index := vm.fetchUint32()
+		table := vm.tables[vm.fetchUint32()]
+		n, src, dst := vm.popUint32(), vm.popUint32(), vm.popUint32()
+		elems := vm.elemSegments[index]
+		if uint64(src)+uint64(n) > uint64(len(elems)) || uint64(dst)+uint64(n) > uint64(len(table)) {
+			panic(ErrOutOfBoundsTableAccess)
+		}
+		vm.chargeBulk(GasTable, uint64(n))
+		copy(table[dst:], elems[src:src+n])
+		vm.resetCallSites()
+	case ops.ElemDrop:
+		vm.elemSegments[vm.fetchUint32()] = nil
+	case ops.TableCopy:
+		dstTable := vm.tables[vm.fetchUint32()]
+		srcTable := vm.tables[vm.fetchUint32()]
+		n, src, dst := vm.popUint32(), vm.popUint32(), vm.popUint32()
+		if uint64(src)+uint64(n) > uint64(len(srcTable)) || uint64(dst)+uint64(n) > uint64(len(dstTable)) {
+			panic(ErrOutOfBoundsTableAccess)
+		}
+		vm.chargeBulk(GasTable, uint64(n))
+		copy(dstTable[dst:dst+n], srcTable[src:src+n])
+		vm.resetCallSites()
+	case ops.TableGrow:
+		vm.tableGrow()
+	case ops.TableSize:
+		index := vm.fetchUint32()
+		if vm.linked != nil && vm.linked[index] != nil {
+			vm.pushUint32(uint32(len(vm.linked[index].elems)))
+			break
+		}
+		vm.pushUint32(uint32(len(vm.tables[index])))
+	case ops.TableFill:
+		table := vm.tables[vm.fetchUint32()]
+		n, ref, dst := vm.popUint32(), vm.popUint32(), vm.popUint32()
+		if uint64(dst)+uint64(n) > uint64(len(table)) {
+			panic(ErrOutOfBoundsTableAccess)
+		}
+		vm.chargeBulk(GasTable, uint64(n))
+		elems := table[dst : dst+n]
+		for i := range elems {
+			elems[i] = ref
+		}
+		vm.resetCallSites()
+	default:
+		panic(ops.InvalidPrefixedOpcodeError{Prefix: ops.PrefixMisc, Sub: sub})
+	}
+}
+
+// checkBulkMemory traps the VM if the n bytes at addr aren't all in the
+// linear memory mem. start is the offset of the operator in the code.
+func (vm *VM) checkBulkMemory(start int64, mem []byte, addr, n uint64) {
+	if size := uint64(len(mem)); addr > size || size-addr < n {
+		panic(&MemoryAccessError{
+			Address:    addr,
+			Size:       int(n),
+			MemorySize: len(mem),
+			Func:       vm.ctx.curFunc,
+			Offset:     start,
+			Name:       vm.funcName(vm.ctx.curFunc),
+			Source:     vm.sourceLine(vm.ctx.curFunc, start),
+		})
+	}
+}
+
+// chargeBulk charges the BulkByte cost of the schedule for n bytes or
+// table elements, saturating at the largest uint64, in the given category.
+func (vm *VM) chargeBulk(category GasCategory, n uint64) {
+	if vm.bulkByteCost == 0 || vm.gasMeter == nil {
+		return
+	}
+	if n > math.MaxUint64/vm.bulkByteCost {
+		vm.consumeGas(category, math.MaxUint64)
+		return
+	}
+	vm.consumeGas(category, n*vm.bulkByteCost)
+}
+
+// popAddr pops an address or a size operand of the bulk memory operators,
+// an i64 on a 64-bit memory.
+func (vm *VM) popAddr() uint64 {
+	return vm.popAddress(vm.memory64)
+}
+
+// popAddress pops an address operand, an i64 if memory64 is true.
+func (vm *VM) popAddress(memory64 bool) uint64 {
+	if memory64 {
+		return vm.popUint64()
+	}
+	return uint64(vm.popUint32())
+}
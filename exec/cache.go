@@ -0,0 +1,142 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// ModuleCache is a least recently used cache of compiled modules, keyed by
+// the sha256 hash of their wasm bytes. It is bounded both by the number of
+// modules and by their total size, and is safe for concurrent use.
+type ModuleCache struct {
+	config     VMConfig
+	resolve    wasm.ResolveFunc
+	maxEntries int
+	maxSize    int
+
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // most recently used first
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type cacheEntry struct {
+	hash   [sha256.Size]byte
+	module *Module
+	size   int
+}
+
+// NewModuleCache returns a cache compiling modules with config, and
+// resolving their imports with resolve. It holds at most maxEntries
+// modules, whose total size (wasm and compiled code) is at most maxSize
+// bytes.
+func NewModuleCache(config VMConfig, resolve wasm.ResolveFunc, maxEntries, maxSize int) *ModuleCache {
+	return &ModuleCache{
+		config:     config,
+		resolve:    resolve,
+		maxEntries: maxEntries,
+		maxSize:    maxSize,
+		lru:        list.New(),
+		entries:    make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// Load returns the compiled module for code, decoding, validating and
+// compiling it if it isn't in the cache yet. Its signature is verified
+// first if the config of c has TrustedKeys.
+func (c *ModuleCache) Load(code []byte) (*Module, error) {
+	hash := sha256.Sum256(code)
+
+	c.mu.Lock()
+	elem, ok := c.entries[hash]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if sink := c.config.Metrics; sink != nil {
+		if ok {
+			sink.Count(MetricCacheHits, "", 1)
+		} else {
+			sink.Count(MetricCacheMisses, "", 1)
+		}
+	}
+	if ok {
+		return elem.Value.(*cacheEntry).module, nil
+	}
+
+	if len(c.config.TrustedKeys) != 0 {
+		if err := VerifySignature(code, c.config.TrustedKeys); err != nil {
+			return nil, err
+		}
+	}
+	module, err := wasm.ReadModule(bytes.NewReader(code), c.resolve)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := CompileModule(module, c.config)
+	if err != nil {
+		return nil, err
+	}
+
+	c.add(&cacheEntry{hash: hash, module: compiled, size: len(code) + compiled.codeSize()})
+	return compiled, nil
+}
+
+func (c *ModuleCache) add(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[entry.hash]; ok {
+		// compiled concurrently by another caller
+		c.lru.MoveToFront(elem)
+		return
+	}
+	if entry.size > c.maxSize {
+		return
+	}
+
+	c.entries[entry.hash] = c.lru.PushFront(entry)
+	c.size += entry.size
+	for c.lru.Len() > c.maxEntries || c.size > c.maxSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		evicted := oldest.Value.(*cacheEntry)
+		delete(c.entries, evicted.hash)
+		c.size -= evicted.size
+	}
+}
+
+// Len returns the number of modules in the cache.
+func (c *ModuleCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Size returns the total size of the modules in the cache.
+func (c *ModuleCache) Size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
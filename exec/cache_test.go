@@ -0,0 +1,95 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func readTestCode(t *testing.T, path string) []byte {
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestModuleCache(t *testing.T) {
+	fac := readTestCode(t, "testdata/spec/fac.wasm")
+	brTable := readTestCode(t, "testdata/spec/br_table.wasm")
+	globals := readTestCode(t, "testdata/spec/globals.wasm")
+
+	cache := NewModuleCache(VMConfig{}, nil, 2, 1<<20)
+	first, err := cache.Load(fac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cache.Load(fac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("module wasn't reused from the cache")
+	}
+
+	for _, code := range [][]byte{brTable, fac, globals} {
+		if _, err := cache.Load(code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("unexpected cache length: got=%d, want=2", cache.Len())
+	}
+	// br_table is the least recently used module
+	if m, _ := cache.Load(fac); m != first {
+		t.Error("recently used module was evicted")
+	}
+
+	if _, err := cache.Load([]byte("\x00asm")); err == nil {
+		t.Error("expected an error for an invalid module")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("invalid module was cached")
+	}
+}
+
+func TestModuleCacheSize(t *testing.T) {
+	fac := readTestCode(t, "testdata/spec/fac.wasm")
+	forward := readTestCode(t, "testdata/spec/forward.wasm")
+
+	cache := NewModuleCache(VMConfig{}, nil, 16, 1<<20)
+	if _, err := cache.Load(fac); err != nil {
+		t.Fatal(err)
+	}
+	size := cache.Size()
+	if size <= len(fac) {
+		t.Fatalf("cache size doesn't include the compiled code: %d", size)
+	}
+
+	// the smaller forward module evicts fac
+	cache = NewModuleCache(VMConfig{}, nil, 16, size)
+	for _, code := range [][]byte{fac, forward} {
+		if _, err := cache.Load(code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cache.Len() != 1 || cache.Size() > size {
+		t.Errorf("cache exceeds its size: len=%d, size=%d, max=%d", cache.Len(), cache.Size(), size)
+	}
+}
@@ -29,33 +29,160 @@
 
 package exec
 
-import "errors"
+import (
+	"fmt"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// allocValues returns n values for the frame of a call, which must be
+// released with releaseValues once the call returns. The values aren't
+// zeroed.
+func (vm *VM) allocValues(n int) []uint64 {
+	top := vm.valuesTop + n
+	if max := vm.config.MaxValueStackHeight; max != 0 && top > max {
+		panic(StackOverflowError{Limit: "value stack height", Max: max})
+	}
+	if top > len(vm.values) {
+		// the calls in progress keep using the previous array, the
+		// frames are only ever released down to their own index
+		vm.values = make([]uint64, 2*top)
+	}
+	values := vm.values[vm.valuesTop:top:top]
+	vm.valuesTop = top
+	return values
+}
+
+// releaseValues releases the values allocated since valuesTop was top.
+func (vm *VM) releaseValues(top int) {
+	vm.valuesTop = top
+}
+
+// DefaultMaxCallDepth is the call depth used when VMConfig.MaxCallDepth is
+// zero, low enough for the Go stack of the interpreter not to overflow.
+const DefaultMaxCallDepth = 16384
+
+// StackOverflowError is the error value used while trapping the VM when a
+// call exceeds the call depth or the value stack height allowed by its
+// VMConfig.
+type StackOverflowError struct {
+	// Limit is the name of the exceeded limit, and Max its value.
+	Limit string
+	Max   int
+}
+
+func (e StackOverflowError) Error() string {
+	return fmt.Sprintf("exec: stack overflow: %s exceeds %d", e.Limit, e.Max)
+}
+
+func (e StackOverflowError) TrapCode() TrapCode {
+	return TrapStackOverflow
+}
+
+// enterCall accounts for a new frame, trapping the VM when it exceeds the
+// call depth. The frame must be left by decrementing vm.depth.
+func (vm *VM) enterCall() {
+	max := vm.config.MaxCallDepth
+	if max == 0 {
+		max = DefaultMaxCallDepth
+	}
+	if vm.depth >= max {
+		panic(StackOverflowError{Limit: "call depth", Max: max})
+	}
+	vm.depth++
+}
 
 func (vm *VM) doCall(compiled compiledFunction, index int64) {
-	newStack := make([]uint64, compiled.maxDepth)
-	locals   := make([]uint64, compiled.totalLocalVars)
+	vm.enterCall()
+	top      := vm.valuesTop
+	values   := vm.allocValues(compiled.maxDepth + compiled.totalLocalVars)
+	newStack := values[:0:compiled.maxDepth]
+	locals   := values[compiled.maxDepth:]
 
 	for i := compiled.args - 1; i >= 0; i-- {
 		locals[i] = vm.popUint64()
 	}
+	for i := compiled.args; i < len(locals); i++ {
+		locals[i] = 0
+	}
 
-	// save execution context
-	prevCtxt := vm.ctx
+	// save execution context, the frames of the callers can be captured
+	// by a pause
+	vm.frames = append(vm.frames, vm.ctx)
 
 	vm.ctx = context{
-		stack:   newStack,
-		locals:  locals,
-		code:    compiled.code,
-		pc:      0,
-		curFunc: index,
+		stack:    newStack,
+		locals:   locals,
+		code:     compiled.code,
+		pc:       0,
+		curFunc:  index,
+		gasStart: vm.meteredGas(),
+	}
+	if !compiled.funcProp.EnvFunc {
+		vm.safepoint()
 	}
 
-	rtrn := vm.execCode(compiled)
+	compiled, rtrn := vm.tailCalls(compiled, vm.execCode(compiled), top)
+	vm.returnFrom(compiled, rtrn, top)
+}
+
+// tailCalls runs the functions tail called by the current context, which
+// returned rtrn, in its frame: the values allocated since valuesTop was top
+// are reused for each callee. It returns the function that returned last
+// along with its result.
+func (vm *VM) tailCalls(compiled compiledFunction, rtrn uint64, top int) (compiledFunction, uint64) {
+	for vm.tailCall {
+		vm.tailCall = false
+		index  := vm.tailCallee
+		callee := vm.function(int64(index))
+
+		// the arguments are moved from the stack of the caller to the
+		// locals of the callee, which may overlap
+		args := vm.ctx.stack[len(vm.ctx.stack)-callee.args:]
+		vm.releaseValues(top)
+		values := vm.allocValues(callee.maxDepth + callee.totalLocalVars)
+		locals := values[callee.maxDepth:]
+		copy(locals, args)
+		for i := callee.args; i < len(locals); i++ {
+			locals[i] = 0
+		}
+
+		vm.ctx = context{
+			stack:    values[:0:callee.maxDepth],
+			locals:   locals,
+			code:     callee.code,
+			pc:       0,
+			curFunc:  int64(index),
+			gasStart: vm.ctx.gasStart,
+		}
+		if !callee.funcProp.EnvFunc {
+			vm.safepoint()
+		}
+		compiled, rtrn = callee, vm.execCode(callee)
+	}
+	return compiled, rtrn
+}
+
+// returnFrom restores the context of the caller of compiled, which
+// returned rtrn, releasing the values allocated since valuesTop was top,
+// and pushes the results of the call on the stack of the caller.
+func (vm *VM) returnFrom(compiled compiledFunction, rtrn uint64, top int) {
+	var results []uint64
+	if compiled.results > 1 {
+		// the results are left on the stack of the callee, whose
+		// values aren't reused before the next call
+		results = vm.ctx.stack[len(vm.ctx.stack)-compiled.results:]
+	}
 
 	// restore execution context
-	vm.ctx = prevCtxt
+	vm.ctx    = vm.frames[len(vm.frames)-1]
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	vm.releaseValues(top)
+	vm.depth--
 
-	if compiled.returns {
+	if results != nil {
+		vm.ctx.stack = append(vm.ctx.stack, results...)
+	} else if compiled.returns {
 		vm.pushUint64(rtrn)
 	}
 }
@@ -64,47 +191,157 @@ var (
 	// ErrSignatureMismatch is the error value used while trapping the VM when
 	// a signature mismatch between the table entry and the type entry is found
 	// in a call_indirect operation.
-	ErrSignatureMismatch = errors.New("exec: signature mismatch in call_indirect")
+	ErrSignatureMismatch = newTrap(TrapSignatureMismatch, "exec: signature mismatch in call_indirect")
 	// ErrUndefinedElementIndex is the error value used while trapping the VM when
 	// an invalid index to the module's table space is used as an operand to
 	// call_indirect
-	ErrUndefinedElementIndex = errors.New("exec: undefined element index")
+	ErrUndefinedElementIndex = newTrap(TrapUndefinedElement, "exec: undefined element index")
 )
 
 func (vm *VM) call() {
 	index := vm.fetchUint32()
-	vm.doCall(vm.compiledFuncs[index], int64(index))
+	vm.doCall(vm.function(int64(index)), int64(index))
 }
 
-func (vm *VM) callIndirect() {
-	index := vm.fetchUint32()
-	fnExpect := vm.module.Types.Entries[index]
-	_ = vm.fetchUint32() // reserved (https://github.com/WebAssembly/design/blob/27ac254c854994103c24834a994be16f74f54186/BinaryEncoding.md#call-operators-described-here)
-	tableIndex := vm.popUint32()
-	if int(tableIndex) >= len(vm.module.TableIndexSpace[0]) {
-		panic(ErrUndefinedElementIndex)
+// function returns the function of the VM with the given index, trapping
+// with its error if it fails to compile on its first call.
+func (vm *VM) function(index int64) compiledFunction {
+	if vm.compiledFuncs[index].pending {
+		if err := vm.loadFunction(index); err != nil {
+			panic(err)
+		}
 	}
-	elemIndex := vm.module.TableIndexSpace[0][tableIndex]
-	fnActual := vm.module.FunctionIndexSpace[elemIndex]
+	return vm.compiledFuncs[index]
+}
 
-	if len(fnExpect.ParamTypes) != len(fnActual.Sig.ParamTypes) {
-		panic(ErrSignatureMismatch)
+// loadFunction replaces the function of inst with the given index, if it
+// is left to compile on its first call, with its compiled code.
+func (inst *Instance) loadFunction(index int64) error {
+	if !inst.compiledFuncs[index].pending {
+		return nil
 	}
-	if len(fnExpect.ReturnTypes) != len(fnActual.Sig.ReturnTypes) {
-		panic(ErrSignatureMismatch)
+	fn, err := inst.compiled.function(int(index))
+	if err != nil {
+		return err
 	}
+	fn.callSites = make([]callSiteCache, len(fn.callSites))
+	inst.compiledFuncs[index] = fn
+	return nil
+}
+
+// callSiteCache is the inline cache of a single call_indirect site. It
+// remembers the last table slot taken by the site together with the
+// function it resolved to, whose signature is already known to match.
+type callSiteCache struct {
+	valid      bool
+	tableIndex uint32
+	elemIndex  uint32
+}
 
-	for i := range fnExpect.ParamTypes {
-		if fnExpect.ParamTypes[i] != fnActual.Sig.ParamTypes[i] {
-			panic(ErrSignatureMismatch)
+// internSignatures assigns an integer id to every distinct function
+// signature of the module, so that signature checks in call_indirect
+// become a single integer comparison. It returns the ids indexed by
+// type index and by function index.
+func internSignatures(module *wasm.Module) (typeIDs []uint32, funcTypeIDs []uint32) {
+	ids := make(map[string]uint32)
+	intern := func(sig *wasm.FunctionSig) uint32 {
+		// the value types take 4 bytes, the references to other types
+		// being their indices
+		key := make([]byte, 0, 4*(len(sig.ParamTypes)+len(sig.ReturnTypes)+1))
+		for _, t := range sig.ParamTypes {
+			key = appendValueType(key, t)
 		}
+		key = append(key, 0, 0, 0, 0)
+		for _, t := range sig.ReturnTypes {
+			key = appendValueType(key, t)
+		}
+		id, ok := ids[string(key)]
+		if !ok {
+			id = uint32(len(ids))
+			ids[string(key)] = id
+		}
+		return id
 	}
 
-	for i := range fnExpect.ReturnTypes {
-		if fnExpect.ReturnTypes[i] != fnActual.Sig.ReturnTypes[i] {
-			panic(ErrSignatureMismatch)
+	if module.Types != nil {
+		typeIDs = make([]uint32, len(module.Types.Entries))
+		for i := range module.Types.Entries {
+			typeIDs[i] = intern(&module.Types.Entries[i])
 		}
 	}
 
-	vm.doCall(vm.compiledFuncs[elemIndex], int64(elemIndex))
+	funcTypeIDs = make([]uint32, len(module.FunctionIndexSpace))
+	for i, fn := range module.FunctionIndexSpace {
+		funcTypeIDs[i] = intern(fn.Sig)
+	}
+
+	return typeIDs, funcTypeIDs
+}
+
+// appendValueType appends the 4 bytes of t to key.
+func appendValueType(key []byte, t wasm.ValueType) []byte {
+	return append(key, byte(t), byte(t>>8), byte(t>>16), byte(t>>24))
+}
+
+func (vm *VM) callIndirect() {
+	if elemIndex, ok := vm.resolveIndirect(); ok {
+		vm.doCall(vm.function(int64(elemIndex)), int64(elemIndex))
+	}
+}
+
+func (vm *VM) callRef() {
+	index := vm.resolveRef()
+	vm.doCall(vm.function(int64(index)), int64(index))
+}
+
+// resolveRef reads the immediate of a call_ref or return_call_ref and pops
+// its operand, returning the index of the function to call. The type of
+// the function is known to match by validation.
+func (vm *VM) resolveRef() uint32 {
+	vm.fetchUint32() // type index
+	index := vm.popUint32()
+	if index == uint32(wasm.NullRef) {
+		panic(ErrNullReference)
+	}
+	return index
+}
+
+// resolveIndirect reads the immediates of a call_indirect or
+// return_call_indirect and pops its operand, returning the index of the
+// function to call and true, or false if it called the function of
+// another instance through a table of a Store, see resolveLinked.
+func (vm *VM) resolveIndirect() (uint32, bool) {
+	index      := vm.fetchUint32()
+	site       := vm.fetchUint32() // call site index, see compile.BytecodeMetadata
+	tableIdx   := vm.fetchUint32()
+	table      := vm.tables[tableIdx]
+	tableIndex := vm.popUint32()
+
+	if vm.linked != nil && vm.linked[tableIdx] != nil {
+		// the other instances may change the table
+		return vm.resolveLinked(vm.linked[tableIdx], index, tableIndex)
+	}
+
+	cache := &vm.compiledFuncs[vm.ctx.curFunc].callSites[site]
+	if cache.valid && cache.tableIndex == tableIndex {
+		return cache.elemIndex, true
+	}
+
+	if int(tableIndex) >= len(table) {
+		panic(ErrUndefinedElementIndex)
+	}
+	elemIndex := table[tableIndex]
+	if int(elemIndex) >= len(vm.compiledFuncs) {
+		panic(ErrUndefinedElementIndex)
+	}
+
+	if vm.funcTypeIDs[elemIndex] != vm.typeIDs[index] {
+		panic(ErrSignatureMismatch)
+	}
+
+	cache.valid      = true
+	cache.tableIndex = tableIndex
+	cache.elemIndex  = elemIndex
+
+	return elemIndex, true
 }
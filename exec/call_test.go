@@ -0,0 +1,181 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestInternSignatures(t *testing.T) {
+	i32, i64 := wasm.ValueTypeI32, wasm.ValueTypeI64
+	module := &wasm.Module{
+		Types: &wasm.SectionTypes{
+			Entries: []wasm.FunctionSig{
+				{ParamTypes: []wasm.ValueType{i32, i32}, ReturnTypes: []wasm.ValueType{i32}},
+				{ParamTypes: []wasm.ValueType{i32}, ReturnTypes: []wasm.ValueType{i32, i32}},
+				{ParamTypes: []wasm.ValueType{i32, i32}, ReturnTypes: []wasm.ValueType{i32}},
+				{ParamTypes: []wasm.ValueType{i64}},
+			},
+		},
+	}
+	module.FunctionIndexSpace = []wasm.Function{
+		{Sig: &wasm.FunctionSig{ParamTypes: []wasm.ValueType{i64}}},
+		{Sig: &module.Types.Entries[0]},
+	}
+
+	typeIDs, funcTypeIDs := internSignatures(module)
+	if typeIDs[0] != typeIDs[2] {
+		t.Errorf("identical signatures got different ids: %d, %d", typeIDs[0], typeIDs[2])
+	}
+	if typeIDs[0] == typeIDs[1] || typeIDs[1] == typeIDs[3] {
+		t.Errorf("distinct signatures share an id: %v", typeIDs)
+	}
+	if funcTypeIDs[0] != typeIDs[3] || funcTypeIDs[1] != typeIDs[0] {
+		t.Errorf("unexpected function signature ids: got=%v, types=%v", funcTypeIDs, typeIDs)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	facRec := int64(module.Export.Entries["fac-rec"].Index)
+
+	for _, tc := range []struct {
+		config VMConfig
+		ok     uint64
+		err    StackOverflowError
+	}{
+		{VMConfig{}, 1000, StackOverflowError{"call depth", DefaultMaxCallDepth}},
+		{VMConfig{MaxCallDepth: 100}, 99, StackOverflowError{"call depth", 100}},
+		{VMConfig{MaxValueStackHeight: 1000}, 50, StackOverflowError{"value stack height", 1000}},
+		{VMConfig{AOT: true, MaxCallDepth: 100}, 99, StackOverflowError{"call depth", 100}},
+	} {
+		vm, err := NewVMWithConfig(module, tc.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = vm.ExecCode(facRec, tc.ok); err != nil {
+			t.Fatal(err)
+		}
+		func() {
+			defer func() {
+				if err := trapValue(recover()); err != tc.err {
+					t.Errorf("%+v: unexpected trap: %v", tc.config, err)
+				}
+			}()
+			vm.ExecCode(facRec, 1<<20)
+		}()
+		// the VM is usable after the trap
+		if _, err = vm.ExecCode(facRec, tc.ok); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNativeCalls(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	facRec := int64(module.Export.Entries["fac-rec"].Index)
+	vm, err := NewVMWithConfig(module, VMConfig{AOT: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm.compiledFuncs[facRec].native == nil {
+		t.Skip("fac-rec isn't compiled to native code on this platform")
+	}
+	interpreted, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []uint64{0, 1, 5, 25, 1000} {
+		want, err := interpreted.ExecCode(facRec, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := vm.ExecCode(facRec, n); err != nil || got != want {
+			t.Errorf("fac-rec(%d): got=%v, %v, want=%v", n, got, err, want)
+		}
+	}
+}
+
+func BenchmarkNativeCalls(b *testing.B) {
+	module := readTestModule(b, "testdata/spec/fac.wasm")
+	facRec := int64(module.Export.Entries["fac-rec"].Index)
+	for _, aot := range []bool{false, true} {
+		vm, err := NewVMWithConfig(module, VMConfig{AOT: aot})
+		if err != nil {
+			b.Fatal(err)
+		}
+		name := "interpreted"
+		if aot {
+			name = "native"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := vm.ExecCode(facRec, 1000); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiValue(t *testing.T) {
+	module := readTestModule(t, "testdata/multi-value.wasm")
+	if err := validate.VerifyModule(module); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, config := range []VMConfig{{}, {AOT: true}, {InlineThreshold: 16}, {BlockMetering: true}} {
+		vm, err := NewVMWithConfig(module, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range []struct {
+			fn   string
+			args []uint64
+			want []interface{}
+		}{
+			{"pair", nil, []interface{}{uint32(1), uint64(2)}},
+			{"swap", []uint64{3, 4}, []interface{}{uint32(4), uint32(3)}},
+			{"br-multi", []uint64{1}, []interface{}{uint32(1), uint32(2)}},
+			{"br-multi", []uint64{0}, []interface{}{uint32(3), uint32(4)}},
+			{"return-multi", []uint64{6}, []interface{}{uint32(6), uint32(5)}},
+			{"br-table-multi", []uint64{0}, []interface{}{uint32(1), uint32(2)}},
+		} {
+			index := int64(module.Export.Entries[tc.fn].Index)
+			res, err := vm.ExecCode(index, tc.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(res, tc.want) {
+				t.Errorf("%+v: %s%v: got=%v, want=%v", config, tc.fn, tc.args, res, tc.want)
+			}
+		}
+
+		values, err := vm.ExecCodeValues(int64(module.Export.Entries["pair"].Index))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, []uint64{1, 2}) {
+			t.Errorf("%+v: raw results: got=%v, want=[1 2]", config, values)
+		}
+	}
+}
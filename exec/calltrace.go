@@ -0,0 +1,202 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/bottos-project/bottos/vm/wasm/demangle"
+)
+
+// The types of the frames of a call trace.
+const (
+	CallTypeCall     = "CALL"      // a call, or the outermost call
+	CallTypeTailCall = "TAIL_CALL" // a tail call, replacing the frame before it
+	CallTypeHost     = "HOST"      // a call to a host function
+)
+
+// CallFrame is a function call of a call trace, see CallTracer, along with
+// the calls it made. Its JSON encoding follows the callTracer of the EVM,
+// the values and amounts of gas being hexadecimal strings:
+//
+//	{"type": "CALL", "func": 3, "name": "transfer", "args": ["0x10"],
+//	 "results": ["0x1"], "gasBefore": "0x0", "gasAfter": "0x2a",
+//	 "gasUsed": "0x2a", "calls": [...]}
+type CallFrame struct {
+	Type string
+	// Func is the index of the called function, and Name its demangled
+	// name in the name section, or the method of a host function.
+	Func int64
+	Name string
+	// Args and Results are the raw bits of the slots of the arguments and
+	// results, see disasm.Slots. A frame replaced by a tail call has no
+	// results.
+	Args    []uint64
+	Results []uint64
+	// GasBefore and GasAfter are the gas consumed from the gas meter of
+	// the VM when the call started and ended, see (*VM).GasMeter.
+	GasBefore uint64
+	GasAfter  uint64
+	// Error is the error the call failed with, like its trap, or "" if it
+	// returned.
+	Error string
+	Calls []*CallFrame
+}
+
+// GasUsed returns the gas consumed by the call, refunds included.
+func (f *CallFrame) GasUsed() uint64 {
+	if f.GasAfter < f.GasBefore {
+		return 0
+	}
+	return f.GasAfter - f.GasBefore
+}
+
+// callFrameJSON is the JSON encoding of a CallFrame.
+type callFrameJSON struct {
+	Type      string       `json:"type"`
+	Func      int64        `json:"func"`
+	Name      string       `json:"name,omitempty"`
+	Args      []string     `json:"args"`
+	Results   []string     `json:"results,omitempty"`
+	GasBefore string       `json:"gasBefore"`
+	GasAfter  string       `json:"gasAfter"`
+	GasUsed   string       `json:"gasUsed"`
+	Error     string       `json:"error,omitempty"`
+	Calls     []*CallFrame `json:"calls,omitempty"`
+}
+
+// MarshalJSON encodes f as described by CallFrame.
+func (f *CallFrame) MarshalJSON() ([]byte, error) {
+	return json.Marshal(callFrameJSON{
+		Type:      f.Type,
+		Func:      f.Func,
+		Name:      f.Name,
+		Args:      hexValues(f.Args),
+		Results:   hexValues(f.Results),
+		GasBefore: hexValue(f.GasBefore),
+		GasAfter:  hexValue(f.GasAfter),
+		GasUsed:   hexValue(f.GasUsed()),
+		Error:     f.Error,
+		Calls:     f.Calls,
+	})
+}
+
+func hexValue(v uint64) string {
+	return "0x" + strconv.FormatUint(v, 16)
+}
+
+func hexValues(values []uint64) []string {
+	if values == nil {
+		return nil
+	}
+	hex := make([]string, len(values))
+	for i, v := range values {
+		hex[i] = hexValue(v)
+	}
+	return hex
+}
+
+// CallTracer records the function calls of the VMs it is set on as trees
+// of CallFrame, for block explorers and debugging RPCs, see
+// (*VM).SetCallTracer. A CallTracer must be used by a single goroutine.
+//
+// The functions inlined into their callers aren't traced, like the
+// frames of a call resumed by (*VM).Resume, whose calls are traced as
+// outermost calls.
+type CallTracer struct {
+	calls []*CallFrame
+	// the frames of the calls in progress, from the outermost one, and
+	// whether the innermost one was replaced by a tail call
+	open     []*CallFrame
+	tailCall bool
+}
+
+// NewCallTracer returns a CallTracer which traced no call yet.
+func NewCallTracer() *CallTracer {
+	return &CallTracer{}
+}
+
+// Calls returns the outermost calls traced by t, in the order they
+// started.
+func (t *CallTracer) Calls() []*CallFrame {
+	return t.calls
+}
+
+// Reset forgets the calls traced by t.
+func (t *CallTracer) Reset() {
+	t.calls, t.open, t.tailCall = nil, nil, false
+}
+
+// SetCallTracer sets the tracer recording the function calls of the
+// following calls of vm. Nil removes it, tracing costing a single test
+// per function call when disabled.
+func (vm *VM) SetCallTracer(t *CallTracer) {
+	vm.callTracer = t
+}
+
+// execTraced runs compiled like execCode, tracing its call in the call
+// tracer of vm. The current context is the one of the call.
+func (vm *VM) execTraced(compiled compiledFunction) (rtrn uint64) {
+	t := vm.callTracer
+	frame := &CallFrame{
+		Type:      CallTypeCall,
+		Func:      vm.ctx.curFunc,
+		Name:      demangle.Demangle(vm.funcName(vm.ctx.curFunc)),
+		Args:      append([]uint64(nil), vm.ctx.locals[:compiled.args]...),
+		GasBefore: vm.meteredGas(),
+	}
+	switch {
+	case compiled.funcProp.EnvFunc:
+		frame.Type, frame.Name = CallTypeHost, compiled.funcProp.Method
+	case t.tailCall:
+		frame.Type = CallTypeTailCall
+	}
+	t.tailCall = false
+	if n := len(t.open); n != 0 {
+		t.open[n-1].Calls = append(t.open[n-1].Calls, frame)
+	} else {
+		t.calls = append(t.calls, frame)
+	}
+	t.open = append(t.open, frame)
+
+	defer func() {
+		t.open = t.open[:len(t.open)-1]
+		frame.GasAfter = vm.meteredGas()
+		if r := recover(); r != nil {
+			// the traps and exceptions keep unwinding the call
+			frame.Error = fmt.Sprint(r)
+			panic(r)
+		}
+		switch {
+		case frame.Error != "":
+		case vm.tailCall:
+			t.tailCall = true
+		case compiled.results > 1:
+			frame.Results = append([]uint64(nil), vm.ctx.stack[len(vm.ctx.stack)-compiled.results:]...)
+		case compiled.returns:
+			frame.Results = []uint64{rtrn}
+		}
+	}()
+	rtrn, err := vm.runFunction(compiled)
+	if err != nil {
+		frame.Error = err.Error()
+	}
+	return rtrn
+}
@@ -0,0 +1,111 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestCallTracer(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/calltrace.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// oracle(p) returns p+1
+	imports := NewEnvFunc()
+	imports.RegisterWithCost("oracle", func(vm *VM) (bool, error) {
+		vm.SetFuncResult(vm.GetFuncParams()[0] + 1)
+		return true, nil
+	}, FlatCost(HOST_CALL_GAS))
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	vm.SetGasMeter(NewGasMeter(1<<20), DefaultGasSchedule())
+
+	tracer := NewCallTracer()
+	vm.SetCallTracer(tracer)
+	run := int64(module.Export.Entries["run"].Index)
+	if res, err := vm.ExecCode(run, 3); err != nil || res != uint32(16) {
+		t.Fatalf("run: got=%v, %v", res, err)
+	}
+	fail := int64(module.Export.Entries["fail"].Index)
+	func() {
+		defer func() { recover() }()
+		vm.ExecCode(fail, 5)
+	}()
+	vm.SetCallTracer(nil)
+	vm.ExecCode(run, 3)
+
+	// run(3) calls oracle(3), then twice(4) calling double(4) and tail
+	// calling double(8)
+	calls := tracer.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("got %d calls, want 2", len(calls))
+	}
+	top := calls[0]
+	if top.Type != CallTypeCall || top.Func != run || top.Args[0] != 3 || top.Results[0] != 16 || top.Error != "" {
+		t.Errorf("unexpected call: %+v", top)
+	}
+	var kinds []string
+	for _, c := range top.Calls {
+		kinds = append(kinds, c.Type)
+	}
+	if len(top.Calls) != 3 {
+		t.Fatalf("unexpected calls: %v", kinds)
+	}
+	oracle, twice, tail := top.Calls[0], top.Calls[1], top.Calls[2]
+	if oracle.Type != CallTypeHost || oracle.Name != "oracle" || oracle.Args[0] != 3 || oracle.Results[0] != 4 {
+		t.Errorf("unexpected host call: %+v", oracle)
+	}
+	if twice.Type != CallTypeCall || twice.Results != nil || len(twice.Calls) != 1 || twice.Calls[0].Results[0] != 8 {
+		t.Errorf("unexpected call: %+v", twice)
+	}
+	if tail.Type != CallTypeTailCall || tail.Args[0] != 8 || tail.Results[0] != 16 {
+		t.Errorf("unexpected tail call: %+v", tail)
+	}
+
+	if top.GasBefore != 0 || top.GasUsed() == 0 || oracle.GasBefore < top.GasBefore || tail.GasAfter > top.GasAfter {
+		t.Errorf("unexpected gas: %+v, %+v, %+v", top, oracle, tail)
+	}
+
+	// the trap fails fail, but not double
+	if calls[1].Error == "" || len(calls[1].Calls) != 1 || calls[1].Calls[0].Error != "" {
+		t.Errorf("unexpected failed call: %+v", calls[1])
+	}
+
+	data, err := json.Marshal(top.Calls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"HOST","func":0,"name":"oracle","args":["0x3"],"results":["0x4"],"gasBefore":"` + hexValue(oracle.GasBefore) +
+		`","gasAfter":"` + hexValue(oracle.GasAfter) + `","gasUsed":"` + hexValue(oracle.GasUsed()) + `"}`
+	if string(data) != want {
+		t.Errorf("got=%s\nwant=%s", data, want)
+	}
+}
@@ -0,0 +1,502 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"encoding/binary"
+	"math"
+	"unicode/utf8"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// ABIKind is the kind of an ABIType.
+type ABIKind uint8
+
+// The kinds of the types of the canonical ABI supported by CanonicalABI.
+const (
+	ABIBool ABIKind = iota
+	ABIS8
+	ABIU8
+	ABIS16
+	ABIU16
+	ABIS32
+	ABIU32
+	ABIS64
+	ABIU64
+	ABIF32
+	ABIF64
+	ABIChar
+	ABIString
+	ABIList
+	ABIRecord
+	ABIResult
+)
+
+// ABIType is a value type of the component model, laid out in linear
+// memory by the canonical ABI. Elem is the element type of a list, Fields
+// the field types of a record, and Ok and Err the optional payload types
+// of a result.
+//
+// The values of the types are Go values of the matching types: bool,
+// int8 to uint64, float32, float64, rune and string, []interface{} for
+// the lists and the records, []byte for the lists of ABIU8, and Result for
+// the results.
+type ABIType struct {
+	Kind    ABIKind
+	Elem    *ABIType
+	Fields  []*ABIType
+	Ok, Err *ABIType
+}
+
+// Result is the value of a result type: the payload Value of the error
+// case if IsErr is set, of the ok case otherwise, nil without payload.
+type Result struct {
+	IsErr bool
+	Value interface{}
+}
+
+// layout returns the size and the alignment of the values of t.
+func (t *ABIType) layout() (size, align uint32) {
+	switch t.Kind {
+	case ABIBool, ABIS8, ABIU8:
+		return 1, 1
+	case ABIS16, ABIU16:
+		return 2, 2
+	case ABIS32, ABIU32, ABIF32, ABIChar:
+		return 4, 4
+	case ABIS64, ABIU64, ABIF64:
+		return 8, 8
+	case ABIString, ABIList:
+		// a pointer and a length
+		return 8, 4
+	case ABIRecord:
+		align = 1
+		for _, f := range t.Fields {
+			fieldSize, fieldAlign := f.layout()
+			size = alignTo(size, fieldAlign) + fieldSize
+			if fieldAlign > align {
+				align = fieldAlign
+			}
+		}
+		return alignTo(size, align), align
+	case ABIResult:
+		// a discriminant byte, then the payload of either case
+		var payloadSize, payloadAlign uint32 = 0, 1
+		for _, p := range []*ABIType{t.Ok, t.Err} {
+			if p == nil {
+				continue
+			}
+			s, a := p.layout()
+			if s > payloadSize {
+				payloadSize = s
+			}
+			if a > payloadAlign {
+				payloadAlign = a
+			}
+		}
+		return alignTo(alignTo(1, payloadAlign)+payloadSize, payloadAlign), payloadAlign
+	}
+	return 0, 1
+}
+
+// payloadOffset returns the offset of the payload of the result type t.
+func (t *ABIType) payloadOffset() uint32 {
+	_, align := t.layout()
+	return alignTo(1, align)
+}
+
+func alignTo(n, align uint32) uint32 {
+	return (n + align - 1) &^ (align - 1)
+}
+
+// DefaultRealloc is the name of the function allocating memory exported
+// by the modules built for the canonical ABI.
+const DefaultRealloc = "cabi_realloc"
+
+// CanonicalABI lifts and lowers values between the host and the first
+// linear memory of a VM following the canonical ABI of the component
+// model, the strings being encoded in UTF-8. The memory holding the
+// lowered values is allocated by the realloc function of the module.
+type CanonicalABI struct {
+	vm      *VM
+	realloc int64
+}
+
+// CanonicalABI returns the canonical ABI of vm, allocating memory with
+// the function the module exports as realloc, DefaultRealloc if empty.
+// It returns ERR_CANON_REALLOC if the module doesn't export such a
+// function, of type (i32, i32, i32, i32) -> i32.
+func (vm *VM) CanonicalABI(realloc string) (*CanonicalABI, error) {
+	if realloc == "" {
+		realloc = DefaultRealloc
+	}
+	module := vm.module
+	if module.Export == nil {
+		return nil, ERR_CANON_REALLOC
+	}
+	entry, ok := module.Export.Entries[realloc]
+	if !ok || entry.Kind != wasm.ExternalFunction {
+		return nil, ERR_CANON_REALLOC
+	}
+	fn := module.GetFunction(int(entry.Index))
+	i32 := wasm.ValueTypeI32
+	if fn == nil || !sameTypes(fn.Sig.ParamTypes, []wasm.ValueType{i32, i32, i32, i32}) ||
+		!sameTypes(fn.Sig.ReturnTypes, []wasm.ValueType{i32}) {
+		return nil, ERR_CANON_REALLOC
+	}
+	return &CanonicalABI{vm: vm, realloc: int64(entry.Index)}, nil
+}
+
+// alloc allocates size bytes aligned to align in the guest memory, and
+// returns their address.
+func (abi *CanonicalABI) alloc(size, align uint32) (uint32, error) {
+	res, err := abi.vm.ExecCodeRaw(abi.realloc, 0, 0, uint64(align), uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	ptr := uint32(res)
+	if ptr%align != 0 || uint64(ptr)+uint64(size) > uint64(len(abi.vm.memory)) {
+		return 0, ERR_CANON_MEMORY
+	}
+	return ptr, nil
+}
+
+// bytes returns the n bytes of the memory at ptr.
+func (abi *CanonicalABI) bytes(ptr, n uint32) ([]byte, error) {
+	abi.vm.syncMemory()
+	if uint64(ptr)+uint64(n) > uint64(len(abi.vm.memory)) {
+		return nil, ERR_CANON_MEMORY
+	}
+	return abi.vm.memory[ptr : ptr+n], nil
+}
+
+// output returns the n bytes of the memory at ptr like bytes, for them to
+// be written.
+func (abi *CanonicalABI) output(ptr, n uint32) ([]byte, error) {
+	mem, err := abi.bytes(ptr, n)
+	if err == nil {
+		abi.vm.wrote(uint64(ptr), uint64(n))
+	}
+	return mem, err
+}
+
+// Lower allocates the memory holding a value of type t, stores v in it,
+// and returns its address. It returns ERR_CANON_VALUE if v isn't a value
+// of type t.
+func (abi *CanonicalABI) Lower(t *ABIType, v interface{}) (uint32, error) {
+	size, align := t.layout()
+	ptr, err := abi.alloc(size, align)
+	if err != nil {
+		return 0, err
+	}
+	return ptr, abi.Store(t, ptr, v)
+}
+
+// LowerString stores s in newly allocated memory, and returns its address
+// and its length in bytes, the way strings are passed as arguments.
+func (abi *CanonicalABI) LowerString(s string) (uint32, uint32, error) {
+	ptr, err := abi.alloc(uint32(len(s)), 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	mem, err := abi.output(ptr, uint32(len(s)))
+	if err != nil {
+		return 0, 0, err
+	}
+	copy(mem, s)
+	return ptr, uint32(len(s)), nil
+}
+
+// LiftString returns the string of n bytes at ptr. It returns
+// ERR_CANON_MEMORY if the string is out of bounds or isn't valid UTF-8.
+func (abi *CanonicalABI) LiftString(ptr, n uint32) (string, error) {
+	mem, err := abi.bytes(ptr, n)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(mem) {
+		return "", ERR_CANON_MEMORY
+	}
+	return string(mem), nil
+}
+
+// Store stores v, a value of type t, at ptr. The strings and the lists
+// are stored in newly allocated memory.
+func (abi *CanonicalABI) Store(t *ABIType, ptr uint32, v interface{}) error {
+	size, align := t.layout()
+	if ptr%align != 0 {
+		return ERR_CANON_MEMORY
+	}
+	if _, err := abi.bytes(ptr, size); err != nil {
+		return err
+	}
+
+	var bits uint64
+	switch t.Kind {
+	case ABIString:
+		s, ok := v.(string)
+		if !ok {
+			return ERR_CANON_VALUE
+		}
+		data, n, err := abi.LowerString(s)
+		if err != nil {
+			return err
+		}
+		return abi.storePair(ptr, data, n)
+	case ABIList:
+		return abi.storeList(t, ptr, v)
+	case ABIRecord:
+		fields, ok := v.([]interface{})
+		if !ok || len(fields) != len(t.Fields) {
+			return ERR_CANON_VALUE
+		}
+		offset := uint32(0)
+		for i, f := range t.Fields {
+			fieldSize, fieldAlign := f.layout()
+			offset = alignTo(offset, fieldAlign)
+			if err := abi.Store(f, ptr+offset, fields[i]); err != nil {
+				return err
+			}
+			offset += fieldSize
+		}
+		return nil
+	case ABIResult:
+		r, ok := v.(Result)
+		if !ok {
+			return ERR_CANON_VALUE
+		}
+		payload := t.Ok
+		if r.IsErr {
+			payload, bits = t.Err, 1
+		}
+		if err := abi.storeBits(ptr, 1, bits); err != nil {
+			return err
+		}
+		if payload == nil {
+			if r.Value != nil {
+				return ERR_CANON_VALUE
+			}
+			return nil
+		}
+		return abi.Store(payload, ptr+t.payloadOffset(), r.Value)
+	}
+
+	bits, ok := scalarBits(t.Kind, v)
+	if !ok {
+		return ERR_CANON_VALUE
+	}
+	return abi.storeBits(ptr, size, bits)
+}
+
+// scalarBits returns the bits stored for the scalar value v of the given
+// kind, and whether v is such a value.
+func scalarBits(kind ABIKind, v interface{}) (uint64, bool) {
+	switch v := v.(type) {
+	case bool:
+		if kind != ABIBool {
+			return 0, false
+		}
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case int8:
+		return uint64(v), kind == ABIS8
+	case uint8:
+		return uint64(v), kind == ABIU8
+	case int16:
+		return uint64(v), kind == ABIS16
+	case uint16:
+		return uint64(v), kind == ABIU16
+	case int32:
+		// rune is an alias of int32
+		if kind == ABIChar {
+			return uint64(v), v >= 0 && utf8.ValidRune(v)
+		}
+		return uint64(v), kind == ABIS32
+	case uint32:
+		return uint64(v), kind == ABIU32
+	case int64:
+		return uint64(v), kind == ABIS64
+	case uint64:
+		return v, kind == ABIU64
+	case float32:
+		return uint64(math.Float32bits(v)), kind == ABIF32
+	case float64:
+		return math.Float64bits(v), kind == ABIF64
+	}
+	return 0, false
+}
+
+func (abi *CanonicalABI) storeBits(ptr, size uint32, bits uint64) error {
+	mem, err := abi.output(ptr, size)
+	if err != nil {
+		return err
+	}
+	switch size {
+	case 1:
+		mem[0] = byte(bits)
+	case 2:
+		binary.LittleEndian.PutUint16(mem, uint16(bits))
+	case 4:
+		binary.LittleEndian.PutUint32(mem, uint32(bits))
+	case 8:
+		binary.LittleEndian.PutUint64(mem, bits)
+	}
+	return nil
+}
+
+// storePair stores the address and the length of a string or a list.
+func (abi *CanonicalABI) storePair(ptr, data, n uint32) error {
+	if err := abi.storeBits(ptr, 4, uint64(data)); err != nil {
+		return err
+	}
+	return abi.storeBits(ptr+4, 4, uint64(n))
+}
+
+func (abi *CanonicalABI) storeList(t *ABIType, ptr uint32, v interface{}) error {
+	elemSize, elemAlign := t.Elem.layout()
+	if b, ok := v.([]byte); ok && t.Elem.Kind == ABIU8 {
+		data, err := abi.alloc(uint32(len(b)), 1)
+		if err != nil {
+			return err
+		}
+		mem, err := abi.output(data, uint32(len(b)))
+		if err != nil {
+			return err
+		}
+		copy(mem, b)
+		return abi.storePair(ptr, data, uint32(len(b)))
+	}
+	elems, ok := v.([]interface{})
+	if !ok {
+		return ERR_CANON_VALUE
+	}
+	if uint64(len(elems))*uint64(elemSize) > math.MaxUint32 {
+		return ERR_CANON_VALUE
+	}
+	data, err := abi.alloc(uint32(len(elems))*elemSize, elemAlign)
+	if err != nil {
+		return err
+	}
+	for i, elem := range elems {
+		if err := abi.Store(t.Elem, data+uint32(i)*elemSize, elem); err != nil {
+			return err
+		}
+	}
+	return abi.storePair(ptr, data, uint32(len(elems)))
+}
+
+// Lift returns the value of type t at ptr. It returns ERR_CANON_MEMORY if
+// the memory doesn't hold a valid value.
+func (abi *CanonicalABI) Lift(t *ABIType, ptr uint32) (interface{}, error) {
+	size, align := t.layout()
+	if ptr%align != 0 {
+		return nil, ERR_CANON_MEMORY
+	}
+	mem, err := abi.bytes(ptr, size)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.Kind {
+	case ABIBool:
+		return mem[0] != 0, nil
+	case ABIS8:
+		return int8(mem[0]), nil
+	case ABIU8:
+		return mem[0], nil
+	case ABIS16:
+		return int16(binary.LittleEndian.Uint16(mem)), nil
+	case ABIU16:
+		return binary.LittleEndian.Uint16(mem), nil
+	case ABIS32:
+		return int32(binary.LittleEndian.Uint32(mem)), nil
+	case ABIU32:
+		return binary.LittleEndian.Uint32(mem), nil
+	case ABIS64:
+		return int64(binary.LittleEndian.Uint64(mem)), nil
+	case ABIU64:
+		return binary.LittleEndian.Uint64(mem), nil
+	case ABIF32:
+		return math.Float32frombits(binary.LittleEndian.Uint32(mem)), nil
+	case ABIF64:
+		return math.Float64frombits(binary.LittleEndian.Uint64(mem)), nil
+	case ABIChar:
+		c := binary.LittleEndian.Uint32(mem)
+		if c > utf8.MaxRune || !utf8.ValidRune(rune(c)) {
+			return nil, ERR_CANON_MEMORY
+		}
+		return rune(c), nil
+	case ABIString:
+		return abi.LiftString(binary.LittleEndian.Uint32(mem), binary.LittleEndian.Uint32(mem[4:]))
+	case ABIList:
+		return abi.liftList(t, binary.LittleEndian.Uint32(mem), binary.LittleEndian.Uint32(mem[4:]))
+	case ABIRecord:
+		fields := make([]interface{}, len(t.Fields))
+		offset := uint32(0)
+		for i, f := range t.Fields {
+			fieldSize, fieldAlign := f.layout()
+			offset = alignTo(offset, fieldAlign)
+			if fields[i], err = abi.Lift(f, ptr+offset); err != nil {
+				return nil, err
+			}
+			offset += fieldSize
+		}
+		return fields, nil
+	case ABIResult:
+		r := Result{}
+		payload := t.Ok
+		switch mem[0] {
+		case 0:
+		case 1:
+			r.IsErr, payload = true, t.Err
+		default:
+			return nil, ERR_CANON_MEMORY
+		}
+		if payload != nil {
+			if r.Value, err = abi.Lift(payload, ptr+t.payloadOffset()); err != nil {
+				return nil, err
+			}
+		}
+		return r, nil
+	}
+	return nil, ERR_CANON_VALUE
+}
+
+func (abi *CanonicalABI) liftList(t *ABIType, data, n uint32) (interface{}, error) {
+	elemSize, elemAlign := t.Elem.layout()
+	if data%elemAlign != 0 || uint64(n)*uint64(elemSize) > math.MaxUint32 {
+		return nil, ERR_CANON_MEMORY
+	}
+	mem, err := abi.bytes(data, n*elemSize)
+	if err != nil {
+		return nil, err
+	}
+	if t.Elem.Kind == ABIU8 {
+		return append([]byte(nil), mem...), nil
+	}
+	elems := make([]interface{}, n)
+	for i := range elems {
+		if elems[i], err = abi.Lift(t.Elem, data+uint32(i)*elemSize); err != nil {
+			return nil, err
+		}
+	}
+	return elems, nil
+}
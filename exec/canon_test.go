@@ -0,0 +1,96 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalABI(t *testing.T) {
+	module := readTestModule(t, "testdata/canon.wasm")
+	vm, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.CanonicalABI("sum"); err != ERR_CANON_REALLOC {
+		t.Fatalf("unexpected error: got=%v, want=%v", err, ERR_CANON_REALLOC)
+	}
+	abi, err := vm.CanonicalABI("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(name string, args ...uint64) uint32 {
+		t.Helper()
+		res, err := vm.ExecCode(int64(module.Export.Entries[name].Index), args...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return res.(uint32)
+	}
+
+	// the module sums the fields of the record it is passed
+	u32 := &ABIType{Kind: ABIU32}
+	record := &ABIType{Kind: ABIRecord, Fields: []*ABIType{u32, {Kind: ABIList, Elem: u32}}}
+	ptr, err := abi.Lower(record, []interface{}{uint32(1), []interface{}{uint32(2), uint32(3), uint32(4)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := call("sum", uint64(ptr)); got != 10 {
+		t.Errorf("sum: got=%d, want=10", got)
+	}
+
+	// and returns a result<string, u8>
+	result := &ABIType{Kind: ABIResult, Ok: &ABIType{Kind: ABIString}, Err: &ABIType{Kind: ABIU8}}
+	if got, err := abi.Lift(result, call("greet")); err != nil || got != (Result{Value: "hello"}) {
+		t.Errorf("greet: got=%v, %v", got, err)
+	}
+
+	// the values round-trip through the memory
+	typ := &ABIType{Kind: ABIRecord, Fields: []*ABIType{
+		{Kind: ABIBool},
+		{Kind: ABIChar},
+		{Kind: ABIS16},
+		{Kind: ABIF64},
+		{Kind: ABIList, Elem: &ABIType{Kind: ABIString}},
+		{Kind: ABIList, Elem: &ABIType{Kind: ABIU8}},
+		{Kind: ABIResult, Err: &ABIType{Kind: ABIString}},
+		{Kind: ABIS8},
+	}}
+	value := []interface{}{true, 'é', int16(-3), 2.5, []interface{}{"a", "bc"}, []byte{1, 2}, Result{IsErr: true, Value: "failed"}, int8(-1)}
+	if ptr, err = abi.Lower(typ, value); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := abi.Lift(typ, ptr); err != nil || !reflect.DeepEqual(got, value) {
+		t.Errorf("round trip: got=%v, %v", got, err)
+	}
+
+	if _, err := abi.Lower(typ, value[:1]); err != ERR_CANON_VALUE {
+		t.Errorf("unexpected error: got=%v, want=%v", err, ERR_CANON_VALUE)
+	}
+	if _, err := abi.Lower(&ABIType{Kind: ABIChar}, rune(0xd800)); err != ERR_CANON_VALUE {
+		t.Errorf("unexpected error: got=%v, want=%v", err, ERR_CANON_VALUE)
+	}
+	// the module holds invalid UTF-8 at 48
+	if _, err := abi.LiftString(48, 2); err != ERR_CANON_MEMORY {
+		t.Errorf("unexpected error: got=%v, want=%v", err, ERR_CANON_MEMORY)
+	}
+	if _, err := abi.LiftString(65535, 2); err != ERR_CANON_MEMORY {
+		t.Errorf("unexpected error: got=%v, want=%v", err, ERR_CANON_MEMORY)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+// ChainContext is the state of the chain a call runs in, provided by the
+// embedder for every execution to the chain context host functions, see
+// RegisterChainContext and SetChainContext.
+type ChainContext struct {
+	BlockHeight uint64
+	// BlockTimestamp is the time of the block, in seconds since the Unix
+	// epoch.
+	BlockTimestamp uint64
+	// Caller is the account calling the contract, and Contract the
+	// account of the contract.
+	Caller   string
+	Contract string
+	// TxHash is the hash of the transaction the call runs in.
+	TxHash []byte
+	// Value is the value transferred to the contract by the call.
+	Value uint64
+}
+
+// ChainContextConfig configures the chain context host functions.
+type ChainContextConfig struct {
+	// CallGas is the gas charged for every call, and ByteGas for every
+	// byte copied to the memory, HOST_CALL_GAS and HOST_BYTE_GAS if zero.
+	CallGas uint64
+	ByteGas uint64
+}
+
+// RegisterChainContext registers the chain context host functions into
+// env, which read the ChainContext of the VM calling them, see
+// SetChainContext:
+//
+//	uint64_t block_height(void);
+//	uint64_t block_timestamp(void);
+//	uint64_t value_transferred(void);
+//	uint32_t caller_account(char *buf, uint32_t len);
+//	uint32_t contract_account(char *buf, uint32_t len);
+//	uint32_t tx_hash(uint8_t *buf, uint32_t len);
+//
+// caller_account, contract_account and tx_hash copy at most len bytes of
+// the account or hash to buf, and return its whole length. Buffers out of
+// the bounds of the memory trap the VM, and so does the lack of a
+// ChainContext, with ErrNoChainContext.
+func RegisterChainContext(env *EnvFunc, config ChainContextConfig) {
+	if config.CallGas == 0 {
+		config.CallGas = HOST_CALL_GAS
+	}
+	if config.ByteGas == 0 {
+		config.ByteGas = HOST_BYTE_GAS
+	}
+	c := &chainFuncs{config}
+	env.Register("block_height", c.blockHeight)
+	env.Register("block_timestamp", c.blockTimestamp)
+	env.Register("value_transferred", c.valueTransferred)
+	env.Register("caller_account", c.callerAccount)
+	env.Register("contract_account", c.contractAccount)
+	env.Register("tx_hash", c.txHash)
+}
+
+// ErrNoChainContext is the error value used while trapping the VM when a
+// chain context host function is called by a VM without a ChainContext.
+var ErrNoChainContext = newTrap(TrapHostError, "exec: no chain context")
+
+// SetChainContext sets the ChainContext of vm for its following calls,
+// which the chain context host functions read, see RegisterChainContext.
+// The contracts it calls with a ContractCaller run with the same context,
+// but for their caller being the contract of vm, their contract being
+// the callee, and no value transferred.
+func (vm *VM) SetChainContext(ctx *ChainContext) {
+	vm.chainContext = ctx
+}
+
+// ChainContext returns the ChainContext of vm, if any.
+func (vm *VM) ChainContext() *ChainContext {
+	return vm.chainContext
+}
+
+// calleeChainContext returns the chain context of a call of the contract
+// at addr from a contract running with ctx, if any.
+func calleeChainContext(ctx *ChainContext, addr string) *ChainContext {
+	if ctx == nil {
+		return nil
+	}
+	callee := *ctx
+	callee.Caller, callee.Contract, callee.Value = ctx.Contract, addr, 0
+	return &callee
+}
+
+type chainFuncs struct {
+	config ChainContextConfig
+}
+
+// begin checks that the host function has the given number of parameters,
+// charges the call, and returns the chain context of vm.
+func (c *chainFuncs) begin(vm *VM, params int) (*ChainContext, error) {
+	if len(vm.GetFuncParams()) != params {
+		return nil, ERR_PARAM_COUNT
+	}
+	if vm.chainContext == nil {
+		panic(ErrNoChainContext)
+	}
+	if vm.gasMeter != nil {
+		vm.ChargeGas(c.config.CallGas)
+	}
+	return vm.chainContext, nil
+}
+
+func (c *chainFuncs) blockHeight(vm *VM) (bool, error) {
+	ctx, err := c.begin(vm, 0)
+	if err != nil {
+		return false, err
+	}
+	vm.SetFuncResult(ctx.BlockHeight)
+	return true, nil
+}
+
+func (c *chainFuncs) blockTimestamp(vm *VM) (bool, error) {
+	ctx, err := c.begin(vm, 0)
+	if err != nil {
+		return false, err
+	}
+	vm.SetFuncResult(ctx.BlockTimestamp)
+	return true, nil
+}
+
+func (c *chainFuncs) valueTransferred(vm *VM) (bool, error) {
+	ctx, err := c.begin(vm, 0)
+	if err != nil {
+		return false, err
+	}
+	vm.SetFuncResult(ctx.Value)
+	return true, nil
+}
+
+func (c *chainFuncs) callerAccount(vm *VM) (bool, error) {
+	ctx, err := c.begin(vm, 2)
+	if err != nil {
+		return false, err
+	}
+	c.result(vm, []byte(ctx.Caller))
+	return true, nil
+}
+
+func (c *chainFuncs) contractAccount(vm *VM) (bool, error) {
+	ctx, err := c.begin(vm, 2)
+	if err != nil {
+		return false, err
+	}
+	c.result(vm, []byte(ctx.Contract))
+	return true, nil
+}
+
+func (c *chainFuncs) txHash(vm *VM) (bool, error) {
+	ctx, err := c.begin(vm, 2)
+	if err != nil {
+		return false, err
+	}
+	c.result(vm, ctx.TxHash)
+	return true, nil
+}
+
+// result copies at most len bytes of b to the buffer buf given by the
+// parameters of the host function, and returns the length of b from it.
+func (c *chainFuncs) result(vm *VM, b []byte) {
+	params := vm.GetFuncParams()
+	n := copy(vm.hostOutput(uint32(params[0]), uint32(params[1])), b)
+	if vm.gasMeter != nil {
+		vm.ChargeGas(byteGas(c.config.ByteGas, n))
+	}
+	vm.SetFuncResult(uint64(uint32(len(b))))
+}
@@ -0,0 +1,104 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestChainContext(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/chain.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnvFunc()
+	RegisterChainContext(env, ChainContextConfig{CallGas: 10, ByteGas: 2})
+	inst, err := compiled.Instantiate(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	call := func(name string, args ...uint64) interface{} {
+		t.Helper()
+		res, err := vm.ExecCode(int64(module.Export.Entries[name].Index), args...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return res
+	}
+
+	func() {
+		defer func() {
+			if r := trapValue(recover()); r != ErrNoChainContext {
+				t.Errorf("unexpected trap without a chain context: %v", r)
+			}
+		}()
+		call("block_height")
+	}()
+
+	vm.SetChainContext(&ChainContext{
+		BlockHeight:    42,
+		BlockTimestamp: 1700000000,
+		Caller:         "alice",
+		Contract:       "token",
+		TxHash:         []byte{1, 2, 3, 4},
+		Value:          7,
+	})
+	for name, want := range map[string]uint64{"block_height": 42, "block_timestamp": 1700000000, "value_transferred": 7} {
+		if got := call(name); got != want {
+			t.Errorf("%s: got=%v, want=%v", name, got, want)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"caller_account", "alice"},
+		{"contract_account", "token"},
+		{"tx_hash", "\x01\x02\x03\x04"},
+	} {
+		if got := call(tc.name, 100, 64); got != uint32(len(tc.want)) || string(vm.Memory()[100:100+len(tc.want)]) != tc.want {
+			t.Errorf("%s: got=%v %q, want=%d %q", tc.name, got, vm.Memory()[100:100+len(tc.want)], len(tc.want), tc.want)
+		}
+	}
+	// a short buffer gets the start of the account, and its whole length
+	copy(vm.Memory()[200:], "....")
+	if got := call("caller_account", 200, 2); got != uint32(5) || string(vm.Memory()[200:204]) != "al.." {
+		t.Errorf("short buffer: got=%v %q", got, vm.Memory()[200:204])
+	}
+
+	meter := NewGasMeter(1000)
+	vm.SetGasMeter(meter, nil)
+	call("contract_account", 100, 64)
+	if got := meter.Used(); got != 10+2*5 {
+		t.Errorf("gas: got=%d, want=%d", got, 10+2*5)
+	}
+
+	callee := calleeChainContext(vm.ChainContext(), "bank")
+	if callee.Caller != "token" || callee.Contract != "bank" || callee.Value != 0 || callee.BlockHeight != 42 {
+		t.Errorf("unexpected callee context: %+v", callee)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "crypto/sha256"
+
+// Checkpoint is the state of a call which ran out of the gas budget of a
+// block, from which ResumeBudget resumes it in a later block, possibly in
+// another process once serialized with MarshalBinary. Unlike a
+// Continuation, it doesn't hold the memory of the instance, but its diff
+// from the state the call started from, which the instance is brought
+// back to between the blocks, so only the memory the call changed is
+// persisted.
+type Checkpoint struct {
+	fingerprint [sha256.Size]byte
+
+	Frames []Frame
+	// Diff brings the instance from the state the call started from to
+	// the state of the paused call.
+	Diff *StateDiff
+
+	memPos  uint64
+	memType map[uint64]*typeInfo
+}
+
+// ExecCodeBudget calls the function with the given index and arguments
+// like ExecCode, pausing the call at the first safepoint once it consumed
+// budget units of gas from the meter of vm. The result of a call which
+// completes is returned, and the Checkpoint of a call which paused, to be
+// resumed by ResumeBudget. Since a call only pauses at a safepoint, it
+// may consume more than budget, and functions compiled to native code
+// run to completion. The meter of vm still bounds the gas of the call,
+// which traps with ErrOutOfGas past its limit. ERR_BUDGET_UNMETERED is
+// returned if vm has no gas meter.
+//
+// The instance is left in the state of the paused call: it must be
+// brought back to the state the call started from, for instance by
+// Reset or Restore, before the call is resumed.
+func (vm *VM) ExecCodeBudget(fnIndex int64, budget uint64, args ...uint64) (interface{}, *Checkpoint, error) {
+	if vm.gasMeter == nil {
+		return nil, nil, ERR_BUDGET_UNMETERED
+	}
+	memory, globals := append([]byte(nil), vm.memory...), append([]uint64(nil), vm.globals...)
+	defer vm.setBudget(budget)()
+	res, err := vm.ExecCode(fnIndex, args...)
+	return vm.checkpointResult(res, err, memory, globals)
+}
+
+// ResumeBudget resumes the call paused in cp like ExecCodeBudget, pausing
+// it again once it consumed budget units of gas. The instance of vm must
+// be in the state the call started from, otherwise ERR_STATE_MISMATCH is
+// returned, and in an instance of the module the call was paused in,
+// compiled with the same configuration, otherwise
+// ERR_CONTINUATION_MISMATCH is. The diff of a new checkpoint is still
+// from the state the call started from.
+func (vm *VM) ResumeBudget(cp *Checkpoint, budget uint64) (interface{}, *Checkpoint, error) {
+	if vm.closed {
+		return nil, nil, ERR_INSTANCE_CLOSED
+	}
+	if vm.gasMeter == nil {
+		return nil, nil, ERR_BUDGET_UNMETERED
+	}
+	if err := vm.checkFrames(cp.fingerprint, cp.Frames); err != nil {
+		return nil, nil, err
+	}
+	if cp.Diff == nil {
+		return nil, nil, ERR_STATE_MISMATCH
+	}
+	memory, globals := append([]byte(nil), vm.memory...), append([]uint64(nil), vm.globals...)
+	if err := vm.Instance.ApplyDiff(cp.Diff); err != nil {
+		return nil, nil, err
+	}
+	c := &Continuation{
+		fingerprint: cp.fingerprint,
+		Frames:      cp.Frames,
+		Memory:      vm.memory,
+		Globals:     append([]uint64(nil), vm.globals...),
+		memPos:      cp.memPos,
+		memType:     cp.memType,
+	}
+	defer vm.setBudget(budget)()
+	res, err := vm.Resume(c)
+	return vm.checkpointResult(res, err, memory, globals)
+}
+
+// setBudget pauses the call of vm once it consumed budget units of gas,
+// and returns the function restoring the previous budget.
+func (vm *VM) setBudget(budget uint64) func() {
+	prev := vm.budgetEnd
+	vm.budgetEnd = vm.gasMeter.used + budget
+	if vm.budgetEnd < budget {
+		vm.budgetEnd = ^uint64(0)
+	}
+	return func() { vm.budgetEnd = prev }
+}
+
+// checkpointResult returns the result of a call started in the state of
+// the given memory and globals, or its checkpoint if it paused.
+func (vm *VM) checkpointResult(res interface{}, err error, memory []byte, globals []uint64) (interface{}, *Checkpoint, error) {
+	if err != ErrPaused {
+		return res, nil, err
+	}
+	c := vm.paused
+	return nil, &Checkpoint{
+		fingerprint: c.fingerprint,
+		Frames:      c.Frames,
+		Diff:        diffMemory(memory, c.Memory, globals, c.Globals),
+		memPos:      c.memPos,
+		memType:     c.memType,
+	}, nil
+}
+
+// A serialized checkpoint has the following layout:
+//
+//	magic       [4]byte  "\x00bvk"
+//	version     uint32   checkpointVersion
+//	fingerprint [32]byte see codeFingerprint
+//	payload
+//
+// The payload holds the frames, followed by the diff of the state and the
+// memory bookkeeping of the instance. All integers are little endian.
+const (
+	checkpointMagic   = "\x00bvk"
+	checkpointVersion = 1
+)
+
+// MarshalBinary encodes cp, for UnmarshalBinary to read it back.
+func (cp *Checkpoint) MarshalBinary() ([]byte, error) {
+	w := &compiledWriter{}
+	w.WriteString(checkpointMagic)
+	w.uint32(checkpointVersion)
+	w.Write(cp.fingerprint[:])
+
+	w.frames(cp.Frames)
+	w.uint64(cp.Diff.OldSize)
+	w.uint64(cp.Diff.NewSize)
+	w.uint32(uint32(len(cp.Diff.Memory)))
+	for _, c := range cp.Diff.Memory {
+		w.uint64(c.Addr)
+		w.bytes(c.Old)
+		w.bytes(c.New)
+	}
+	w.uint32(uint32(len(cp.Diff.Globals)))
+	for _, g := range cp.Diff.Globals {
+		w.uint64(uint64(g.Slot))
+		w.uint64(g.Old)
+		w.uint64(g.New)
+	}
+	w.memType(cp.memPos, cp.memType)
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a checkpoint encoded by MarshalBinary.
+func (cp *Checkpoint) UnmarshalBinary(data []byte) error {
+	r := &compiledReader{data: data}
+	if string(r.next(4)) != checkpointMagic || r.uint32() != checkpointVersion {
+		return ERR_CONTINUATION_FORMAT
+	}
+	copy(cp.fingerprint[:], r.next(sha256.Size))
+
+	cp.Frames = r.frames()
+	cp.Diff = &StateDiff{OldSize: r.uint64(), NewSize: r.uint64()}
+	// every change takes at least 16 bytes, and every global 24
+	for i, n := 0, r.count(16); i < n; i++ {
+		cp.Diff.Memory = append(cp.Diff.Memory, MemoryChange{
+			Addr: r.uint64(),
+			Old:  append([]byte(nil), r.bytes()...),
+			New:  append([]byte(nil), r.bytes()...),
+		})
+	}
+	for i, n := 0, r.count(24); i < n; i++ {
+		cp.Diff.Globals = append(cp.Diff.Globals, GlobalChange{Slot: int(r.uint64()), Old: r.uint64(), New: r.uint64()})
+	}
+	cp.memPos, cp.memType = r.memType()
+	if r.err != nil || len(r.data) != 0 {
+		return ERR_CONTINUATION_FORMAT
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestExecCodeBudget(t *testing.T) {
+	module := readTestModule(t, "testdata/checkpoint.wasm")
+	fill := int64(module.Export.Entries["fill"].Index)
+	count := int64(module.Export.Entries["count"].Index)
+	vm, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = vm.ExecCodeBudget(fill, 1000, 10); err != ERR_BUDGET_UNMETERED {
+		t.Fatalf("unexpected error without a gas meter: %v", err)
+	}
+	base, err := vm.Instance.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// run the call a block at a time, bringing the instance back to its
+	// base state between the blocks, and resuming it in another VM from
+	// the serialized checkpoint
+	other, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vms := []*VM{vm, other}
+	for _, vm := range vms {
+		vm.SetGasMeter(NewGasMeter(1<<40), DefaultGasSchedule())
+	}
+	res, cp, err := vm.ExecCodeBudget(fill, 1000, 3000)
+	blocks := 1
+	for ; err == nil && cp != nil; blocks++ {
+		if cp.Diff.Empty() {
+			t.Fatal("empty diff")
+		}
+		data, err := cp.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cp = &Checkpoint{}
+		if err = cp.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		vm = vms[blocks%2]
+		if err = vm.Instance.Restore(base); err != nil {
+			t.Fatal(err)
+		}
+		used := vm.GasMeter().Used()
+		res, cp, err = vm.ResumeBudget(cp, 1000)
+		if cp != nil && vm.GasMeter().Used()-used > 1100 {
+			t.Errorf("block %d: the call exceeded its budget: %d", blocks, vm.GasMeter().Used()-used)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uint32(3000 * 2999 / 2); res != want {
+		t.Errorf("unexpected result: got=%v, want=%v", res, want)
+	}
+	if blocks < 10 {
+		t.Errorf("the call only ran for %d blocks", blocks)
+	}
+	if res, err = vm.ExecCode(count); err != nil || res != uint32(3000) {
+		t.Errorf("unexpected count: got=%v, want=%v (%v)", res, 3000, err)
+	}
+	if got, want := len(vm.Memory()), 2*65536; got != want {
+		t.Errorf("unexpected memory size: got=%d, want=%d", got, want)
+	}
+	// the last values stored at the addresses
+	for addr, want := range map[int]uint32{0: 2048, 4: 2049, 4092: 2047} {
+		if got := uint32(vm.Memory()[addr]) | uint32(vm.Memory()[addr+1])<<8; got != want {
+			t.Errorf("unexpected memory at %d: got=%d, want=%d", addr, got, want)
+		}
+	}
+
+	// a checkpoint only applies to an instance in the base state
+	if err = vm.Instance.Restore(base); err != nil {
+		t.Fatal(err)
+	}
+	_, cp, err = vm.ExecCodeBudget(fill, 1000, 3000)
+	if err != nil || cp == nil {
+		t.Fatalf("unexpected result: %v, %v", cp, err)
+	}
+	if _, _, err = vm.ResumeBudget(cp, 1000); err != ERR_STATE_MISMATCH {
+		t.Errorf("unexpected error resuming in another state: %v", err)
+	}
+}
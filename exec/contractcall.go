@@ -0,0 +1,377 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"sync"
+
+	"github.com/bottos-project/bottos/contract"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// CodeStore resolves the code of the contracts called by a ContractCaller.
+type CodeStore interface {
+	// Code returns the wasm code of the contract at addr.
+	Code(addr string) ([]byte, error)
+}
+
+// CodeStoreFunc is a function used as a CodeStore.
+type CodeStoreFunc func(addr string) ([]byte, error)
+
+func (f CodeStoreFunc) Code(addr string) ([]byte, error) {
+	return f(addr)
+}
+
+// DefaultContractCallDepth is the depth of the contract calls allowed by
+// a ContractCaller whose config sets none.
+const DefaultContractCallDepth = 8
+
+// ContractCallConfig configures a ContractCaller.
+type ContractCallConfig struct {
+	// Schedule is the gas schedule of the callees. A nil schedule only
+	// charges the gas charged by the callees through the env.gas
+	// function, as for the modules instrumented by InstrumentGas.
+	Schedule *GasSchedule
+	// Reserve is the gas kept by the caller on every call, whatever the
+	// gas it forwards, for it to handle the failure of the callee.
+	Reserve uint64
+	// MaxDepth is the depth of nested calls allowed, the first callee
+	// being at depth 1, DefaultContractCallDepth if zero.
+	MaxDepth int
+	// PoolSize is the number of idle instances kept per contract.
+	PoolSize int
+	// Realloc is the function the callees export to allocate the memory
+	// of their arguments, DefaultRealloc if empty.
+	Realloc string
+	// Reentrancy is the policy of the contracts whose instance sets none,
+	// denying reentrancy by default.
+	Reentrancy ReentrancyPolicy
+}
+
+// ContractCaller runs the calls of a contract to another one: the code of
+// the callee is resolved by a CodeStore and compiled through a
+// ModuleCache, and the call runs on an instance of a pool kept per
+// contract, reset between the calls.
+//
+// A callee method is an export of type (i32, i32) -> i32 taking the
+// address and length of its arguments, copied to memory allocated by its
+// realloc function, see CanonicalABI, and returning the address of the
+// address and length of its result, the way the canonical ABI returns a
+// list<u8>.
+//
+// It is safe for concurrent use, the calls of a chain of contracts
+// running on the goroutine of the outermost one.
+type ContractCaller struct {
+	store   CodeStore
+	cache   *ModuleCache
+	imports *EnvFunc
+	config  ContractCallConfig
+
+	mu    sync.Mutex
+	pools map[*Module]*InstancePool
+}
+
+// NewContractCaller returns a caller resolving the code of the contracts
+// with store, compiling them with cache, and instantiating them with
+// imports, which usually registers the callContract function of the
+// caller, see Register, for the callees to call other contracts.
+func NewContractCaller(store CodeStore, cache *ModuleCache, imports *EnvFunc, config ContractCallConfig) *ContractCaller {
+	if config.MaxDepth == 0 {
+		config.MaxDepth = DefaultContractCallDepth
+	}
+	return &ContractCaller{
+		store:   store,
+		cache:   cache,
+		imports: imports,
+		config:  config,
+		pools:   make(map[*Module]*InstancePool),
+	}
+}
+
+// contractBytes is the type of the arguments and results of the methods
+// of the callees.
+var contractBytes = &ABIType{Kind: ABIList, Elem: &ABIType{Kind: ABIU8}}
+
+// CallContract calls the method of the contract at addr with args, on
+// behalf of the contract run by vm, nil for a call made by the host, and
+// returns its result.
+//
+// The callee consumes at most gas, taken from the meter of vm, which the
+// gas it consumed is charged to. A zero gas forwards all the gas left but
+// the reserve of the config, and the call fails with ErrOutOfGas if no
+// more than the reserve is left. A call made by the host, or by an
+// unmetered vm, isn't metered if gas is zero.
+//
+// The callee runs with the contract context of vm, for the contract at
+// addr and sent by the contract of vm. Its storage writes are kept apart
+// until it returns, and then written to the StateStore and the contract
+// database of vm, or to its overlay during a dry run, see EstimateGas. A callee trapping,
+// including running out of gas, doesn't trap vm: the call returns the
+// TrapError, and the effects of the callee are rolled back, its storage
+// writes and events being discarded and its instance reset. It returns
+// ERR_CONTRACT_DEPTH for calls nested deeper than the MaxDepth of the
+// config, ERR_CONTRACT_REENTRANCY for calls reentering a contract against
+// its ReentrancyPolicy, and ERR_CONTRACT_METHOD if the callee doesn't export method
+// with the type of a method.
+func (c *ContractCaller) CallContract(vm *VM, addr, method string, args []byte, gas uint64) (res []byte, err error) {
+	depth := 1
+	if vm != nil {
+		depth = vm.contractDepth + 1
+	}
+	// the gas used by the callee, for the receipt of vm
+	var used uint64
+	if vm != nil && vm.receipts != nil && vm.receipts.collect {
+		defer vm.receipts.endCall(vm.receipts.beginCall(addr, method, depth), &res, &err, &used)
+	}
+	if depth > c.config.MaxDepth {
+		return nil, ERR_CONTRACT_DEPTH
+	}
+	var frame *contractFrame
+	if vm != nil {
+		frame = vm.callerFrame()
+		if err := c.checkReentrancy(frame, addr); err != nil {
+			return nil, err
+		}
+	}
+	metered := vm != nil && vm.gasMeter != nil
+	if metered {
+		left := vm.gasMeter.Remaining()
+		if left <= c.config.Reserve {
+			return nil, ErrOutOfGas
+		}
+		if gas == 0 || gas > left-c.config.Reserve {
+			gas = left - c.config.Reserve
+		}
+	}
+
+	code, err := c.store.Code(addr)
+	if err != nil {
+		return nil, err
+	}
+	module, err := c.cache.Load(code)
+	if err != nil {
+		return nil, err
+	}
+	pool := c.pool(module)
+	inst, err := pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer pool.Put(inst)
+
+	callee := inst.NewVM()
+	callee.contractDepth = depth
+	callee.contractFrame = &contractFrame{addr: addr, inst: inst, caller: frame}
+	if vm != nil {
+		callee.chainContext = calleeChainContext(vm.chainContext, addr)
+	}
+	var journal *stateJournal
+	var store *storeJournal
+	if vm != nil {
+		log := vm.eventLog()
+		callee.events = log
+		callee.receipts = vm.receipts
+		mark := log.mark()
+		defer func() {
+			if err != nil {
+				log.rollback(mark)
+			}
+		}()
+		callee.contract, journal = calleeContext(vm.contract, addr, method, args)
+		if vm.stateStore != nil {
+			store = newStoreJournal(vm.stateStore)
+			callee.stateStore = store
+		}
+		if vm.overlay != nil {
+			callee.overlay = make(stateOverlay, len(vm.overlay))
+			for key, v := range vm.overlay {
+				callee.overlay[key] = v
+			}
+		}
+	}
+	if gas != 0 {
+		meter := NewGasMeter(gas)
+		callee.SetGasMeter(meter, c.config.Schedule)
+		if metered {
+			defer func() { vm.consumeGas(GasHost, meter.Used()) }()
+		}
+	}
+	res, err = c.run(callee, method, args)
+	used = callee.GasUsed()
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		if err := store.commit(); err != nil {
+			return nil, err
+		}
+	}
+	if journal != nil {
+		if err := journal.commit(); err != nil {
+			return nil, err
+		}
+	}
+	for key, v := range callee.overlay {
+		vm.overlay[key] = v
+	}
+	return res, nil
+}
+
+// pool returns the pool of the instances of module.
+func (c *ContractCaller) pool(module *Module) *InstancePool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pool, ok := c.pools[module]
+	if !ok {
+		pool = NewInstancePool(module, c.imports, c.config.PoolSize)
+		c.pools[module] = pool
+	}
+	return pool
+}
+
+// calleeContext returns the context of a call of the contract at addr
+// from a contract running with ctx, if any, and the journal keeping the
+// storage writes of the call, if ctx has a contract database.
+func calleeContext(ctx *contract.Context, addr, method string, args []byte) (*contract.Context, *stateJournal) {
+	if ctx == nil || ctx.Trx == nil {
+		return ctx, nil
+	}
+	trx := *ctx.Trx
+	trx.Sender, trx.Contract, trx.Method = ctx.Trx.Contract, addr, method
+	trx.Param = append([]byte(nil), args...)
+	callee := &contract.Context{RoleIntf: ctx.RoleIntf, ContractDB: ctx.ContractDB, Trx: &trx}
+	if ctx.ContractDB == nil {
+		return callee, nil
+	}
+	journal := newStateJournal(ctx.ContractDB)
+	callee.ContractDB = journal
+	return callee, journal
+}
+
+// run calls method on callee with args, the traps of the callee being
+// returned as errors.
+func (c *ContractCaller) run(callee *VM, method string, args []byte) (res []byte, err error) {
+	module := callee.module
+	if module.Export == nil {
+		return nil, ERR_CONTRACT_METHOD
+	}
+	entry, ok := module.Export.Entries[method]
+	if !ok || entry.Kind != wasm.ExternalFunction {
+		return nil, ERR_CONTRACT_METHOD
+	}
+	fn := module.GetFunction(int(entry.Index))
+	i32 := wasm.ValueTypeI32
+	if fn == nil || !sameTypes(fn.Sig.ParamTypes, []wasm.ValueType{i32, i32}) ||
+		!sameTypes(fn.Sig.ReturnTypes, []wasm.ValueType{i32}) {
+		return nil, ERR_CONTRACT_METHOD
+	}
+	abi, err := callee.CanonicalABI(c.config.Realloc)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if !isTrap(r) {
+				panic(r)
+			}
+			res, err = nil, r.(error)
+		}
+	}()
+	ptr, n, err := abi.LowerString(string(args))
+	if err != nil {
+		return nil, err
+	}
+	ret, err := callee.ExecCodeRaw(int64(entry.Index), uint64(ptr), uint64(n))
+	if err != nil {
+		return nil, err
+	}
+	v, err := abi.Lift(contractBytes, uint32(ret))
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// The statuses returned by the callContract host function for the calls
+// failing, see Register.
+const (
+	CONTRACT_CALL_FAILED    = -1 - iota // the call returned an error, or the callee trapped
+	CONTRACT_CALL_DEPTH                 // the call is nested too deep
+	CONTRACT_CALL_REENTRANT             // the call reenters a contract which denies it
+)
+
+// Register registers the callContract host function into env, for the
+// modules instantiated with env to call other contracts through c:
+//
+//	int32_t callContract(char *addr, uint32_t addr_len, char *method, uint32_t method_len,
+//	                     uint8_t *args, uint32_t args_len, uint64_t gas,
+//	                     uint8_t *result, uint32_t result_len);
+//
+// calls method of the contract at addr with args, forwarding gas as
+// CallContract does. It copies at most result_len bytes of the result to
+// result, and returns the length of the whole result, or a negative
+// CONTRACT_CALL status. Arguments out of the bounds of the memory trap
+// the caller.
+func (c *ContractCaller) Register(env *EnvFunc) {
+	env.RegisterWithCost("callContract", c.callContract, ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1, 3, 5))
+}
+
+func (c *ContractCaller) callContract(vm *VM) (bool, error) {
+	params := vm.envFunc.envFuncParam
+	if len(params) != 9 {
+		return false, ERR_PARAM_COUNT
+	}
+	addr := vm.hostBytes(uint32(params[0]), uint32(params[1]))
+	method := vm.hostBytes(uint32(params[2]), uint32(params[3]))
+	args := vm.hostBytes(uint32(params[4]), uint32(params[5]))
+	gas := params[6]
+	// checked before the call, which may grow the memory of vm
+	vm.hostBytes(uint32(params[7]), uint32(params[8]))
+
+	status := int64(CONTRACT_CALL_FAILED)
+	res, err := c.CallContract(vm, string(addr), string(method), args, gas)
+	switch {
+	case err == nil:
+		copy(vm.hostOutput(uint32(params[7]), uint32(params[8])), res)
+		status = int64(len(res))
+	case err == ERR_CONTRACT_DEPTH:
+		status = CONTRACT_CALL_DEPTH
+	case err == ERR_CONTRACT_REENTRANCY:
+		status = CONTRACT_CALL_REENTRANT
+	}
+	vm.SetFuncResult(uint64(uint32(status)))
+	return true, nil
+}
+
+// hostBytes returns the n bytes of the memory of vm at ptr, for a host
+// function, trapping if they are out of bounds.
+func (vm *VM) hostBytes(ptr, n uint32) []byte {
+	if uint64(ptr)+uint64(n) > uint64(len(vm.memory)) {
+		panic(ErrOutOfBoundsMemoryAccess)
+	}
+	return vm.memory[ptr : ptr+n]
+}
+
+// hostOutput returns the n bytes of the memory of vm at ptr like
+// hostBytes, for a host function writing them.
+func (vm *VM) hostOutput(ptr, n uint32) []byte {
+	b := vm.hostBytes(ptr, n)
+	vm.wrote(uint64(ptr), uint64(n))
+	return b
+}
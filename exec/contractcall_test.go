@@ -0,0 +1,275 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/bottos-project/bottos/common/types"
+	"github.com/bottos-project/bottos/contract"
+)
+
+func TestContractCall(t *testing.T) {
+	code, err := os.ReadFile("testdata/contract-call.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errMissing := errors.New("missing contract")
+	store := CodeStoreFunc(func(addr string) ([]byte, error) {
+		if addr == "missing" {
+			return nil, errMissing
+		}
+		return code, nil
+	})
+	cache := NewModuleCache(VMConfig{}, importer, 4, 1<<20)
+	env := NewEnvFunc()
+	caller := NewContractCaller(store, cache, env, ContractCallConfig{
+		Schedule: DefaultGasSchedule(),
+		Reserve:  100,
+		MaxDepth: 3,
+		PoolSize: 2,
+		// loop calls itself
+		Reentrancy: ReentrancyPolicy{Mode: ReentrancyAllow},
+	})
+	caller.Register(env)
+
+	for _, test := range []struct {
+		addr, method string
+		args         []byte
+		want         []byte
+	}{
+		{"a", "echo", []byte("args"), []byte("args")},
+		{"a", "echo", nil, []byte{}},
+		// the status of the call, and the result of echo called with "hi"
+		{"a", "relay", []byte("b"), []byte{2, 0, 0, 0, 'h', 'i'}},
+		{"a", "relay", []byte("missing"), []byte{0xff, 0xff, 0xff, 0xff}},
+		// the third call fails, nested too deep
+		{"a", "loop", []byte("a"), []byte{8, 0, 0, 0, 4, 0, 0, 0, 0xfe, 0xff, 0xff, 0xff}},
+	} {
+		res, err := caller.CallContract(nil, test.addr, test.method, test.args, 0)
+		if err != nil {
+			t.Fatalf("%s(%q): %v", test.method, test.args, err)
+		}
+		if !bytes.Equal(res, test.want) {
+			t.Errorf("%s(%q): got=%v, want=%v", test.method, test.args, res, test.want)
+		}
+	}
+
+	for _, test := range []struct {
+		addr, method string
+		want         error
+	}{
+		{"missing", "echo", errMissing},
+		{"a", "nope", ERR_CONTRACT_METHOD},
+		{"a", "cabi_realloc", ERR_CONTRACT_METHOD},
+	} {
+		if _, err := caller.CallContract(nil, test.addr, test.method, nil, 0); err != test.want {
+			t.Errorf("%s.%s: got=%v, want=%v", test.addr, test.method, err, test.want)
+		}
+	}
+
+	// the gas consumed by the callees is charged to the caller, which keeps
+	// the reserve when forwarding all its gas
+	module, err := cache.Load(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := module.Instantiate(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	meter := NewGasMeter(10000)
+	vm.SetGasMeter(meter, nil)
+	if _, err := caller.CallContract(vm, "a", "spin", nil, 500); !errors.Is(err, ErrOutOfGas) {
+		t.Fatalf("spin: got=%v, want=%v", err, ErrOutOfGas)
+	}
+	if got := meter.Used(); got != 500 {
+		t.Errorf("gas: got=%d, want=500", got)
+	}
+	if _, err := caller.CallContract(vm, "a", "spin", nil, 0); !errors.Is(err, ErrOutOfGas) {
+		t.Fatalf("spin: got=%v, want=%v", err, ErrOutOfGas)
+	}
+	if got := meter.Remaining(); got != 100 {
+		t.Errorf("reserve: got=%d, want=100", got)
+	}
+	if _, err := caller.CallContract(vm, "a", "echo", nil, 0); err != ErrOutOfGas {
+		t.Errorf("echo: got=%v, want=%v", err, ErrOutOfGas)
+	}
+}
+
+func TestContractCallReentrancy(t *testing.T) {
+	code, err := os.ReadFile("testdata/contract-call.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := CodeStoreFunc(func(addr string) ([]byte, error) { return code, nil })
+	cache := NewModuleCache(VMConfig{}, importer, 4, 1<<20)
+	for _, test := range []struct {
+		policy ReentrancyPolicy
+		want   []byte
+	}{
+		// the status of the first nested call
+		{ReentrancyPolicy{}, []byte{0xfd, 0xff, 0xff, 0xff}},
+		// the status of the second one, reentering a twice
+		{ReentrancyPolicy{Mode: ReentrancyLimit, MaxDepth: 1}, []byte{4, 0, 0, 0, 0xfd, 0xff, 0xff, 0xff}},
+		// the status of the one nested too deep
+		{ReentrancyPolicy{Mode: ReentrancyLimit, MaxDepth: 5}, []byte{8, 0, 0, 0, 4, 0, 0, 0, 0xfe, 0xff, 0xff, 0xff}},
+	} {
+		env := NewEnvFunc()
+		caller := NewContractCaller(store, cache, env, ContractCallConfig{MaxDepth: 3, Reentrancy: test.policy})
+		caller.Register(env)
+		res, err := caller.CallContract(nil, "a", "loop", []byte("a"), 0)
+		if err != nil {
+			t.Fatalf("%+v: %v", test.policy, err)
+		}
+		if !bytes.Equal(res, test.want) {
+			t.Errorf("%+v: got=%v, want=%v", test.policy, res, test.want)
+		}
+	}
+
+	// the policy of the instance of the caller overrides the one of the
+	// config
+	env := NewEnvFunc()
+	caller := NewContractCaller(store, cache, env, ContractCallConfig{})
+	caller.Register(env)
+	module, err := cache.Load(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := module.Instantiate(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	vm.SetContract(&contract.Context{Trx: &types.Transaction{Contract: "a"}})
+	if _, err := caller.CallContract(vm, "b", "echo", nil, 0); err != nil {
+		t.Errorf("b: %v", err)
+	}
+	if _, err := caller.CallContract(vm, "a", "echo", nil, 0); err != ERR_CONTRACT_REENTRANCY {
+		t.Errorf("a: got=%v, want=%v", err, ERR_CONTRACT_REENTRANCY)
+	}
+	inst.SetReentrancyPolicy(ReentrancyPolicy{Mode: ReentrancyAllow})
+	if _, err := caller.CallContract(vm, "a", "echo", nil, 0); err != nil {
+		t.Errorf("allowed a: %v", err)
+	}
+}
+
+// mapContractDB is a contract database keeping the values in memory.
+type mapContractDB map[string]string
+
+func (db mapContractDB) GetStrValue(contract, object, key string) (string, error) {
+	v, ok := db[contract+"/"+object+"/"+key]
+	if !ok {
+		return "", ERR_FINE_MAP
+	}
+	return v, nil
+}
+
+func (db mapContractDB) SetStrValue(contract, object, key, value string) error {
+	db[contract+"/"+object+"/"+key] = value
+	return nil
+}
+
+func (db mapContractDB) RemoveStrValue(contract, object, key string) error {
+	delete(db, contract+"/"+object+"/"+key)
+	return nil
+}
+
+func (db mapContractDB) GetBinValue(contract, object, key string) ([]byte, error) {
+	v, err := db.GetStrValue(contract, object, "bin:"+key)
+	return []byte(v), err
+}
+
+func (db mapContractDB) SetBinValue(contract, object, key string, value []byte) error {
+	return db.SetStrValue(contract, object, "bin:"+key, string(value))
+}
+
+func (db mapContractDB) RemoveBinValue(contract, object, key string) error {
+	return db.RemoveStrValue(contract, object, "bin:"+key)
+}
+
+func TestContractCallRollback(t *testing.T) {
+	code, err := os.ReadFile("testdata/contract-journal.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewModuleCache(VMConfig{}, importer, 4, 1<<20)
+	env := NewEnvFunc()
+	caller := NewContractCaller(CodeStoreFunc(func(string) ([]byte, error) {
+		return code, nil
+	}), cache, env, ContractCallConfig{})
+	caller.Register(env)
+
+	module, err := cache.Load(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := module.Instantiate(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	db := mapContractDB{}
+	vm := inst.NewVM()
+	vm.SetContract(&contract.Context{ContractDB: db, Trx: &types.Transaction{Contract: "host"}})
+
+	if _, err := caller.CallContract(vm, "a", "put", []byte("v1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := caller.CallContract(vm, "a", "put", []byte("!v2"), 0); !errors.Is(err, ErrOutOfBoundsMemoryAccess) {
+		t.Fatalf("put: got=%v, want=%v", err, ErrOutOfBoundsMemoryAccess)
+	}
+	// the failing nested call is rolled back, its caller going on
+	res, err := caller.CallContract(vm, "a", "nest", []byte("b!v3"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, []byte{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("nest: got=%v, want the status of a failed call", res)
+	}
+	if _, err := caller.CallContract(vm, "c", "nest", []byte("dv4"), 0); err != nil {
+		t.Fatal(err)
+	}
+	want := mapContractDB{"a/o/k": "v1", "a/o/n": "nest", "c/o/n": "nest", "d/o/k": "v4"}
+	if len(db) != len(want) {
+		t.Errorf("got=%v, want=%v", db, want)
+	}
+	for key, v := range want {
+		if db[key] != v {
+			t.Errorf("%s: got=%q, want=%q", key, db[key], v)
+		}
+	}
+
+	// the writes go to the overlay during a dry run
+	vm.overlay = make(stateOverlay)
+	if _, err := caller.CallContract(vm, "a", "put", []byte("v5"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := caller.CallContract(vm, "a", "put", []byte("!v6"), 0); err == nil {
+		t.Fatal("put: no error")
+	}
+	if v, err := vm.getStrValue("a", "o", "k"); err != nil || v != "v5" || db["a/o/k"] != "v1" {
+		t.Errorf("overlay: got=%q, %v, database=%q, want=v5, v1", v, err, db["a/o/k"])
+	}
+}
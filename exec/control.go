@@ -29,14 +29,12 @@
 
 package exec
 
-import "errors"
-
 // ErrUnreachable is the error value used while trapping the VM when
 // an unreachable operator is reached during execution.
-var ErrUnreachable = errors.New("exec: reached unreachable")
+var ErrUnreachable = newTrap(TrapUnreachable, "exec: reached unreachable")
 
 func (vm *VM) unreachable() {
-	//panic(ErrUnreachable)
+	panic(ErrUnreachable)
 }
 
 func (vm *VM) nop() {}
@@ -37,24 +37,40 @@ import (
 	"fmt"
 )
 
+// truncFloat returns the integer part of f, converted to an integer of the
+// range [min, max) by the trunc operators. It traps with
+// ErrInvalidConversion for a NaN and ErrIntegerOverflow for a float whose
+// integer part is out of the range, for the result not to depend on the
+// conversion of the hardware.
+func truncFloat(f, min, max float64) float64 {
+	if f != f {
+		panic(ErrInvalidConversion)
+	}
+	t := math.Trunc(f)
+	if t < min || t >= max {
+		panic(ErrIntegerOverflow)
+	}
+	return t
+}
+
 func (vm *VM) i32Wrapi64() {
 	vm.pushUint32(uint32(vm.popUint64()))
 }
 
 func (vm *VM) i32TruncSF32() {
-	vm.pushInt32(int32(math.Trunc(float64(vm.popFloat32()))))
+	vm.pushInt32(int32(truncFloat(float64(vm.popFloat32()), -1<<31, 1<<31)))
 }
 
 func (vm *VM) i32TruncUF32() {
-	vm.pushUint32(uint32(math.Trunc(float64(vm.popFloat32()))))
+	vm.pushUint32(uint32(truncFloat(float64(vm.popFloat32()), 0, 1<<32)))
 }
 
 func (vm *VM) i32TruncSF64() {
-	vm.pushInt32(int32(math.Trunc(vm.popFloat64())))
+	vm.pushInt32(int32(truncFloat(vm.popFloat64(), -1<<31, 1<<31)))
 }
 
 func (vm *VM) i32TruncUF64() {
-	vm.pushUint32(uint32(math.Trunc(vm.popFloat64())))
+	vm.pushUint32(uint32(truncFloat(vm.popFloat64(), 0, 1<<32)))
 }
 
 func (vm *VM) i64ExtendSI32() {
@@ -66,19 +82,19 @@ func (vm *VM) i64ExtendUI32() {
 }
 
 func (vm *VM) i64TruncSF32() {
-	vm.pushInt64(int64(math.Trunc(float64(vm.popFloat32()))))
+	vm.pushInt64(int64(truncFloat(float64(vm.popFloat32()), -1<<63, 1<<63)))
 }
 
 func (vm *VM) i64TruncUF32() {
-	vm.pushUint64(uint64(math.Trunc(float64(vm.popFloat32()))))
+	vm.pushUint64(uint64(truncFloat(float64(vm.popFloat32()), 0, 1<<64)))
 }
 
 func (vm *VM) i64TruncSF64() {
-	vm.pushInt64(int64(math.Trunc(vm.popFloat64())))
+	vm.pushInt64(int64(truncFloat(vm.popFloat64(), -1<<63, 1<<63)))
 }
 
 func (vm *VM) i64TruncUF64() {
-	vm.pushUint64(uint64(math.Trunc(vm.popFloat64())))
+	vm.pushUint64(uint64(truncFloat(vm.popFloat64(), 0, 1<<64)))
 }
 
 func (vm *VM) f32ConvertSI32() {
@@ -0,0 +1,208 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+
+	"github.com/bottos-project/bottos/vm/wasm/demangle"
+)
+
+// Coverage counts the runs of the instructions of a module by the calls of
+// the VMs it is set on, see (*VM).SetCoverage, for instance to report the
+// code a test suite ran with WriteLCOV. The VMs may run concurrently.
+//
+// Like for SetDebugHook, the instructions inlined into a function are
+// counted at their call: a module is best covered without
+// VMConfig.InlineThreshold.
+type Coverage struct {
+	module *Module
+	// the runs of the instructions of each function, indexed like the
+	// sourceOffsets of its compiled code
+	counts [][]uint64
+}
+
+// InstructionCount is an instruction of a module, the index of its
+// function and its offset in the module like the Offset of a
+// disasm.Instruction, and the number of times it ran.
+type InstructionCount struct {
+	Func   int64
+	Offset int64
+	Count  uint64
+}
+
+// NewCoverage returns a Coverage of the instructions of m, none of which
+// ran yet. The functions of m left to compile on their first call are
+// compiled first, those failing to having no instructions.
+func NewCoverage(m *Module) *Coverage {
+	funcs := m.allFuncs()
+	c := &Coverage{module: m, counts: make([][]uint64, len(funcs))}
+	for i, fn := range funcs {
+		c.counts[i] = make([]uint64, len(fn.sourceOffsets))
+	}
+	return c
+}
+
+// SetCoverage sets the coverage counting the instructions the following
+// calls of vm run, which must be a coverage of the module of vm, otherwise
+// ERR_COVERAGE_MODULE is returned. Nil removes it. Like for SetDebugHook,
+// functions compiled to native code are interpreted while it is set.
+func (vm *VM) SetCoverage(c *Coverage) error {
+	if c != nil && c.module != vm.compiled {
+		return ERR_COVERAGE_MODULE
+	}
+	vm.coverage = c
+	vm.setHooked()
+	return nil
+}
+
+// count counts a run of the instruction of the function fn whose compiled
+// code starts at its sourceOffsets[i].
+func (c *Coverage) count(fn int64, i int) {
+	if counts := c.counts[fn]; i < len(counts) {
+		atomic.AddUint64(&counts[i], 1)
+	}
+}
+
+// Instructions returns the instructions of the module and the number of
+// times they ran, in the order of the module. The instructions without
+// compiled code, like the end of a block, are left out.
+func (c *Coverage) Instructions() []InstructionCount {
+	var instrs []InstructionCount
+	for fn, counts := range c.counts {
+		if len(counts) == 0 {
+			continue
+		}
+		compiled, _ := c.module.function(fn)
+		base := c.module.module.FunctionIndexSpace[fn].Body.Offset
+		for i := range counts {
+			n := atomic.LoadUint64(&counts[i])
+			offset := base + int64(compiled.sourceOffsets[i].Offset)
+			// an instruction compiled to several pieces of code counts
+			// as the run of its first one
+			if last := len(instrs) - 1; last >= 0 && instrs[last].Func == int64(fn) && instrs[last].Offset == offset {
+				continue
+			}
+			instrs = append(instrs, InstructionCount{Func: int64(fn), Offset: offset, Count: n})
+		}
+	}
+	return instrs
+}
+
+// coverageFile is the coverage of the lines of a source file, and of the
+// functions starting in it.
+type coverageFile struct {
+	lines map[int]uint64
+	funcs []coverageFunc
+}
+
+// coverageFunc is a function of a coverageFile, and the number of times
+// it was called.
+type coverageFunc struct {
+	name  string
+	line  int
+	calls uint64
+}
+
+// WriteLCOV writes the coverage c to w in the lcov tracefile format, which
+// genhtml and most coverage tools read. The instructions are mapped to
+// their source lines through the line information of the module,
+// see (*Module).SourceLine, a line being run as many times as its
+// instruction run the most. The instructions without a source line, all
+// of them for a module without line information, are reported in the
+// file named module, their offset in the module standing for their line.
+// The functions are named after the name section of the module,
+// demangled, and located at their first instruction.
+func (c *Coverage) WriteLCOV(w io.Writer, module string) error {
+	table := c.module.lineTable()
+	files := make(map[string]*coverageFile)
+	fileOf := func(name string) *coverageFile {
+		f := files[name]
+		if f == nil {
+			f = &coverageFile{lines: make(map[int]uint64)}
+			files[name] = f
+		}
+		return f
+	}
+	last := int64(-1)
+	for _, instr := range c.Instructions() {
+		name, line := module, int(instr.Offset)
+		if table != nil {
+			if l, ok := table.Lookup(instr.Offset); ok {
+				name, line = l.File, l.Line
+			}
+		}
+		f := fileOf(name)
+		if n, ok := f.lines[line]; !ok || instr.Count > n {
+			f.lines[line] = instr.Count
+		}
+		if instr.Func != last {
+			f.funcs = append(f.funcs, coverageFunc{name: c.funcName(instr.Func), line: line, calls: instr.Count})
+			last = instr.Func
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := files[name]
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", name)
+		hit := 0
+		for _, fn := range f.funcs {
+			fmt.Fprintf(bw, "FN:%d,%s\n", fn.line, fn.name)
+		}
+		for _, fn := range f.funcs {
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", fn.calls, fn.name)
+			if fn.calls != 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", len(f.funcs), hit)
+		lines := make([]int, 0, len(f.lines))
+		for line := range f.lines {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+		hit = 0
+		for _, line := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, f.lines[line])
+			if f.lines[line] != 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+	}
+	return bw.Flush()
+}
+
+// funcName returns the name of the function with the given index for the
+// coverage reports: its demangled name in the name section, if any.
+func (c *Coverage) funcName(fn int64) string {
+	if name := c.module.module.FunctionIndexSpace[fn].Name; name != "" {
+		return demangle.Demangle(name)
+	}
+	return fmt.Sprintf("function_%d", fn)
+}
@@ -0,0 +1,84 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	module := readTestModule(t, "testdata/dwarf.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	c := NewCoverage(compiled)
+	if err := vm.SetCoverage(c); err != nil {
+		t.Fatal(err)
+	}
+	load := int64(module.Export.Entries["load"].Index)
+	for i := 0; i < 2; i++ {
+		if _, err := vm.ExecCode(load, 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, instr := range c.Instructions() {
+		want := uint64(0)
+		if instr.Func == load {
+			want = 2
+		}
+		if instr.Count != want {
+			t.Errorf("%+v: got=%d runs, want=%d", instr, instr.Count, want)
+		}
+	}
+
+	// load ran lines 141 and 142, fill none of its lines
+	var buf bytes.Buffer
+	if err := c.WriteLCOV(&buf, "token.wasm"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"SF:/src/token/lib.rs\n", "FNDA:2,function_0\n", "FNDA:0,function_1\n", "DA:142,2\n", "DA:153,0\n", "LF:4\nLH:2\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("missing %q in\n%s", want, &buf)
+		}
+	}
+
+	// a module without line information is reported by offsets
+	other, err := CompileModule(readTestModule(t, "testdata/load.wasm"), VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.SetCoverage(NewCoverage(other)); err != ERR_COVERAGE_MODULE {
+		t.Errorf("got=%v, want=%v", err, ERR_COVERAGE_MODULE)
+	}
+	buf.Reset()
+	if err := NewCoverage(other).WriteLCOV(&buf, "load.wasm"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "SF:load.wasm\n") || !strings.Contains(buf.String(), "LH:0\n") {
+		t.Errorf("unexpected report:\n%s", &buf)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/crypto"
+)
+
+// DefaultCryptoVerifyGas is the gas of the verification of a signature of
+// a CryptoConfig setting none.
+const DefaultCryptoVerifyGas = 3000
+
+// CryptoConfig configures the crypto host functions.
+type CryptoConfig struct {
+	// CallGas is the gas charged for every call and ByteGas for every
+	// byte hashed or signed, HOST_CALL_GAS and HOST_BYTE_GAS if zero.
+	CallGas uint64
+	ByteGas uint64
+	// VerifyGas is the gas charged in addition for every signature
+	// verified or recovered, DefaultCryptoVerifyGas if zero.
+	VerifyGas uint64
+}
+
+// CRYPTO_INVALID is the status returned by the crypto host functions for
+// the invalid sizes and signatures, see RegisterCrypto.
+const CRYPTO_INVALID = -1
+
+// RegisterCrypto registers the crypto host functions into env, which hash
+// and verify the bytes of the memory of the VM calling them:
+//
+//	int32_t sha256(uint8_t *data, uint32_t len, uint8_t out[32]);
+//	int32_t keccak256(uint8_t *data, uint32_t len, uint8_t out[32]);
+//	int32_t ripemd160(uint8_t *data, uint32_t len, uint8_t out[20]);
+//	int32_t blake2b(uint8_t *data, uint32_t len, uint8_t *out, uint32_t out_len);
+//	int32_t ecrecover(uint8_t hash[32], uint8_t sig[65], uint8_t out[64]);
+//	int32_t ed25519_verify(uint8_t pub[32], uint8_t *msg, uint32_t msg_len, uint8_t sig[64]);
+//
+// The hashes write their digest to out and return zero, blake2b returning
+// CRYPTO_INVALID for an out_len which isn't from 1 to 64. keccak256 is the
+// hash of Ethereum, not SHA3-256. ecrecover writes to out the x and y of
+// the secp256k1 public key which signed hash with sig, r then s then the
+// recovery id, from 0 to 3 or from 27 to 30, and returns zero, or
+// CRYPTO_INVALID if no key can be recovered. ed25519_verify returns 1 if
+// sig is a valid signature of msg by pub and 0 otherwise. The gas is
+// charged before the work, see CryptoConfig, and buffers out of the
+// bounds of the memory trap the VM.
+func RegisterCrypto(env *EnvFunc, config CryptoConfig) {
+	if config.CallGas == 0 {
+		config.CallGas = HOST_CALL_GAS
+	}
+	if config.ByteGas == 0 {
+		config.ByteGas = HOST_BYTE_GAS
+	}
+	if config.VerifyGas == 0 {
+		config.VerifyGas = DefaultCryptoVerifyGas
+	}
+	c := &cryptoFuncs{config}
+	env.Register("sha256", c.hash(func(b []byte) []byte { h := sha256.Sum256(b); return h[:] }))
+	env.Register("keccak256", c.hash(func(b []byte) []byte { h := crypto.Keccak256(b); return h[:] }))
+	env.Register("ripemd160", c.hash(func(b []byte) []byte { h := crypto.Ripemd160(b); return h[:] }))
+	env.Register("blake2b", c.blake2b)
+	env.Register("ecrecover", c.ecrecover)
+	env.Register("ed25519_verify", c.ed25519Verify)
+}
+
+type cryptoFuncs struct {
+	config CryptoConfig
+}
+
+// charge charges the gas of a call with n bytes, and of a verification if
+// verify is set.
+func (c *cryptoFuncs) charge(vm *VM, n int, verify bool) {
+	if vm.gasMeter == nil {
+		return
+	}
+	vm.ChargeGas(c.config.CallGas)
+	vm.ChargeGas(byteGas(c.config.ByteGas, n))
+	if verify {
+		vm.ChargeGas(c.config.VerifyGas)
+	}
+}
+
+// status returns status from the host function.
+func (c *cryptoFuncs) status(vm *VM, status int32) {
+	vm.SetFuncResult(uint64(uint32(status)))
+}
+
+// hash returns the host function of the hash function sum.
+func (c *cryptoFuncs) hash(sum func([]byte) []byte) func(vm *VM) (bool, error) {
+	size := uint32(len(sum(nil)))
+	return func(vm *VM) (bool, error) {
+		params := vm.GetFuncParams()
+		if len(params) != 3 {
+			return false, ERR_PARAM_COUNT
+		}
+		data := vm.hostBytes(uint32(params[0]), uint32(params[1]))
+		out := vm.hostOutput(uint32(params[2]), size)
+		c.charge(vm, len(data), false)
+		copy(out, sum(data))
+		vm.SetFuncResult(0)
+		return true, nil
+	}
+}
+
+func (c *cryptoFuncs) blake2b(vm *VM) (bool, error) {
+	params := vm.GetFuncParams()
+	if len(params) != 4 {
+		return false, ERR_PARAM_COUNT
+	}
+	data := vm.hostBytes(uint32(params[0]), uint32(params[1]))
+	out := vm.hostOutput(uint32(params[2]), uint32(params[3]))
+	c.charge(vm, len(data), false)
+	if len(out) < 1 || len(out) > 64 {
+		c.status(vm, CRYPTO_INVALID)
+		return true, nil
+	}
+	copy(out, crypto.Blake2b(data, len(out)))
+	vm.SetFuncResult(0)
+	return true, nil
+}
+
+func (c *cryptoFuncs) ecrecover(vm *VM) (bool, error) {
+	params := vm.GetFuncParams()
+	if len(params) != 3 {
+		return false, ERR_PARAM_COUNT
+	}
+	var hash [32]byte
+	copy(hash[:], vm.hostBytes(uint32(params[0]), 32))
+	sig := vm.hostBytes(uint32(params[1]), 65)
+	out := vm.hostOutput(uint32(params[2]), 64)
+	c.charge(vm, 0, true)
+	pub, err := crypto.Ecrecover(hash, sig)
+	if err != nil {
+		c.status(vm, CRYPTO_INVALID)
+		return true, nil
+	}
+	copy(out, pub)
+	vm.SetFuncResult(0)
+	return true, nil
+}
+
+func (c *cryptoFuncs) ed25519Verify(vm *VM) (bool, error) {
+	params := vm.GetFuncParams()
+	if len(params) != 4 {
+		return false, ERR_PARAM_COUNT
+	}
+	pub := vm.hostBytes(uint32(params[0]), ed25519.PublicKeySize)
+	msg := vm.hostBytes(uint32(params[1]), uint32(params[2]))
+	sig := vm.hostBytes(uint32(params[3]), ed25519.SignatureSize)
+	c.charge(vm, len(msg), true)
+	ok := uint64(0)
+	if ed25519.Verify(ed25519.PublicKey(pub), msg, sig) {
+		ok = 1
+	}
+	vm.SetFuncResult(ok)
+	return true, nil
+}
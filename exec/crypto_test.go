@@ -0,0 +1,133 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestCrypto(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/crypto.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnvFunc()
+	RegisterCrypto(env, CryptoConfig{CallGas: 10, ByteGas: 2, VerifyGas: 500})
+	inst, err := compiled.Instantiate(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+
+	// the inputs are at 100, 200 and 300, and the output at 1000
+	const in1, in2, in3, out = 100, 200, 300, 1000
+	call := func(name string, args ...uint64) int32 {
+		t.Helper()
+		res, err := vm.ExecCode(int64(module.Export.Entries[name].Index), args...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return int32(res.(uint32))
+	}
+	output := func(n int) string {
+		return hex.EncodeToString(vm.Memory()[out : out+n])
+	}
+
+	copy(vm.Memory()[in1:], "abc")
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"sha256", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"keccak256", "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+		{"ripemd160", "8eb208f7e05d987a9b044a8e98c6b087f15a0bfc"},
+	} {
+		if status := call(tc.name, in1, 3, out); status != 0 || output(len(tc.want)/2) != tc.want {
+			t.Errorf("%s: got=%d %s, want=0 %s", tc.name, status, output(len(tc.want)/2), tc.want)
+		}
+	}
+	want := "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"
+	if status := call("blake2b", in1, 3, out, 64); status != 0 || output(64) != want {
+		t.Errorf("blake2b: got=%d %s, want=0 %s", status, output(64), want)
+	}
+	if status := call("blake2b", in1, 3, out, 65); status != CRYPTO_INVALID {
+		t.Errorf("blake2b of 65 bytes: got=%d, want=%d", status, CRYPTO_INVALID)
+	}
+
+	// the signature whose r is the x of the base point G, whose y is even,
+	// and whose s is e + r, recovers G
+	n, _ := new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	gx, _ := hex.DecodeString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	gy := "483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"
+	hash := bytes.Repeat([]byte{0x42}, 32)
+	s := new(big.Int).Add(new(big.Int).SetBytes(hash), new(big.Int).SetBytes(gx))
+	s.Mod(s, n)
+	sig := append(append(gx, s.FillBytes(make([]byte, 32))...), 27)
+	copy(vm.Memory()[in1:], hash)
+	copy(vm.Memory()[in2:], sig)
+	if status := call("ecrecover", in1, in2, out); status != 0 || output(64) != hex.EncodeToString(gx)+gy {
+		t.Errorf("ecrecover: got=%d %s, want=0 %x%s", status, output(64), gx, gy)
+	}
+	vm.Memory()[in2+64] = 31
+	if status := call("ecrecover", in1, in2, out); status != CRYPTO_INVALID {
+		t.Errorf("ecrecover with v=31: got=%d, want=%d", status, CRYPTO_INVALID)
+	}
+
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+	msg := []byte("message")
+	copy(vm.Memory()[in1:], priv.Public().(ed25519.PublicKey))
+	copy(vm.Memory()[in2:], msg)
+	copy(vm.Memory()[in3:], ed25519.Sign(priv, msg))
+	if got := call("ed25519_verify", in1, in2, uint64(len(msg)), in3); got != 1 {
+		t.Errorf("ed25519_verify: got=%d, want=1", got)
+	}
+	vm.Memory()[in2] ^= 1
+	if got := call("ed25519_verify", in1, in2, uint64(len(msg)), in3); got != 0 {
+		t.Errorf("ed25519_verify of a modified message: got=%d, want=0", got)
+	}
+
+	// the call and the bytes, then the call and the verification
+	meter := NewGasMeter(10000)
+	vm.SetGasMeter(meter, nil)
+	call("keccak256", in1, 100, out)
+	if got := meter.Used(); got != 10+2*100 {
+		t.Errorf("keccak256 gas: got=%d, want=%d", got, 10+2*100)
+	}
+	call("ecrecover", in1, in2, out)
+	if got := meter.Used(); got != 210+10+500 {
+		t.Errorf("ecrecover gas: got=%d, want=%d", got, 210+10+500)
+	}
+
+	defer func() {
+		if err := trapValue(recover()); err != ErrOutOfBoundsMemoryAccess {
+			t.Errorf("got=%v, want=%v", err, ErrOutOfBoundsMemoryAccess)
+		}
+	}()
+	call("sha256", in1, 1<<16, out)
+}
@@ -0,0 +1,116 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "sort"
+
+// SetDebugHook sets the function called by the interpreter before each
+// instruction of the following calls of vm, with the index of the function
+// of the instruction and its offset in the module, like the Offset of a
+// disasm.Instruction. The hook runs on the goroutine of the call, which it
+// can inspect with Frames, Globals and Memory. Nil removes the hook.
+//
+// Functions compiled to native code are interpreted while a hook is set.
+// The instructions inlined into a function are reported once, at their
+// call, so modules are best debugged without VMConfig.InlineThreshold.
+func (vm *VM) SetDebugHook(hook func(fn, offset int64)) {
+	vm.debugHook = hook
+	vm.setHooked()
+}
+
+// setHooked records whether vm has functions to call before each
+// instruction.
+func (vm *VM) setHooked() {
+	vm.hooked = vm.debugHook != nil || vm.trace != nil || vm.coverage != nil || vm.profile != nil ||
+		vm.stats != nil || vm.watchFunc != nil && len(vm.watchpoints) != 0 || vm.audit != nil || len(vm.readOnly) != 0 ||
+		vm.alignCheck != AlignCheckOff
+}
+
+// instructionHooks calls the debug hook and trace function of vm, counts
+// the instruction in its coverage, profile and statistics and checks its
+// watchpoints and audited ranges, if the pc of the current context is at
+// the start of an instruction.
+func (vm *VM) instructionHooks() {
+	compiled := &vm.compiledFuncs[vm.ctx.curFunc]
+	offsets := compiled.sourceOffsets
+	pc := vm.ctx.pc
+	i := sort.Search(len(offsets), func(i int) bool { return offsets[i].Compiled >= pc })
+	if i == len(offsets) || offsets[i].Compiled != pc {
+		return
+	}
+	body := compiled.funcProp.Body
+	offset := body.Offset + int64(offsets[i].Offset)
+	if vm.debugHook != nil {
+		vm.debugHook(vm.ctx.curFunc, offset)
+	}
+	if vm.trace != nil {
+		var op byte
+		if offsets[i].Offset < len(body.Code) {
+			op = body.Code[offsets[i].Offset]
+		}
+		vm.trace(vm.ctx.curFunc, offset, op, len(vm.ctx.stack))
+	}
+	if vm.coverage != nil {
+		vm.coverage.count(vm.ctx.curFunc, i)
+	}
+	if vm.profile != nil {
+		vm.profile.funcs[vm.ctx.curFunc].Instructions++
+	}
+	if vm.stats != nil {
+		vm.stats.Instructions++
+		vm.stats.observe(vm)
+	}
+	if (vm.watchFunc != nil && len(vm.watchpoints) != 0 || vm.audit != nil || len(vm.readOnly) != 0 || vm.alignCheck != AlignCheckOff) && offsets[i].Offset < len(body.Code) {
+		vm.checkWatchpoints(offset, body.Code[offsets[i].Offset:])
+	}
+}
+
+// Frames returns the frames of the calls in progress of vm, from the
+// outermost one, or nil if there is none. The PC of the frame of a caller
+// is the one following its call. The locals and stacks are copies.
+func (vm *VM) Frames() []Frame {
+	if vm.activeCalls == 0 {
+		return nil
+	}
+	frames := make([]Frame, 0, len(vm.frames)+1)
+	for _, ctx := range append(vm.frames[:len(vm.frames):len(vm.frames)], vm.ctx) {
+		frames = append(frames, Frame{
+			Func:   ctx.curFunc,
+			PC:     ctx.pc,
+			Locals: append([]uint64(nil), ctx.locals...),
+			Stack:  append([]uint64(nil), ctx.stack...),
+		})
+	}
+	return frames
+}
+
+// Globals returns the values of the globals of the instance of vm, laid
+// out in slots, see disasm.GlobalSlots. The slice is the one of the
+// instance.
+func (vm *VM) Globals() []uint64 {
+	return vm.globals
+}
+
+// CallDepth returns the number of frames of the calls in progress of vm,
+// the length of Frames, without copying them.
+func (vm *VM) CallDepth() int {
+	if vm.activeCalls == 0 {
+		return 0
+	}
+	return len(vm.frames) + 1
+}
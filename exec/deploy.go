@@ -0,0 +1,166 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// DeployPolicy is what ValidateForDeployment requires of the contracts.
+type DeployPolicy struct {
+	// Limits are the limits the module is decoded with, the
+	// wasm.DefaultDecodeLimits if zero.
+	Limits wasm.DecodeLimits
+	// Policy restricts the features of the module, such as floats.
+	Policy validate.Policy
+	// AllowedImports, if not nil, are the only env functions the module
+	// may import. The modules other than env can't be imported.
+	AllowedImports []string
+	// RequiredExports are the functions the module must export, like
+	// "apply".
+	RequiredExports []string
+	// MaxCodeSize and MaxFunctionSize, if not zero, are the largest sizes
+	// in bytes of the code of all the functions of the module and of each
+	// of them, and MaxTableSize the largest initial size of its tables.
+	MaxCodeSize     int
+	MaxFunctionSize int
+	MaxTableSize    uint32
+}
+
+// The kinds of the violations of a DeployPolicy.
+const (
+	ViolationDecode     = "decode"     // the module can't be decoded within the limits
+	ViolationValidation = "validation" // the module isn't valid
+	ViolationImport     = "import"     // the module imports something not allowed
+	ViolationPolicy     = "policy"     // the module breaks the validate.Policy
+	ViolationExport     = "export"     // a required export is missing
+	ViolationSize       = "size"       // the module is larger than allowed
+)
+
+// DeployViolation is a requirement of a DeployPolicy a module breaks.
+type DeployViolation struct {
+	// Kind is the kind of the violation, one of the Violation constants.
+	Kind string
+	// Function is the index of the function breaking the requirement, and
+	// Offset the offset of its instruction in the body, or -1.
+	Function int
+	Offset   int
+	Reason   string
+}
+
+func (v DeployViolation) Error() string {
+	if v.Function < 0 {
+		return fmt.Sprintf("exec: %s violation: %s", v.Kind, v.Reason)
+	}
+	if v.Offset < 0 {
+		return fmt.Sprintf("exec: %s violation in function %d: %s", v.Kind, v.Function, v.Reason)
+	}
+	return fmt.Sprintf("exec: %s violation in function %d at offset %d: %s", v.Kind, v.Function, v.Offset, v.Reason)
+}
+
+// ValidateForDeployment checks the wasm bytes code of a contract against
+// policy before it is deployed, and returns all the requirements it
+// breaks, none if it can be deployed. A module which can't be decoded
+// only breaks that one, and the policy is only checked for the valid
+// ones, the imports, exports and sizes being checked in all cases.
+func ValidateForDeployment(code []byte, policy DeployPolicy) []DeployViolation {
+	var violations []DeployViolation
+	flag := func(kind string, fn int, format string, args ...interface{}) {
+		violations = append(violations, DeployViolation{Kind: kind, Function: fn, Offset: -1, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	limits := policy.Limits
+	if limits == (wasm.DecodeLimits{}) {
+		limits = wasm.DefaultDecodeLimits
+	}
+	resolve := func(name string) (*wasm.Module, error) {
+		return nil, DeployViolation{Kind: ViolationImport, Function: -1, Offset: -1, Reason: fmt.Sprintf("import of module %q", name)}
+	}
+	module, err := wasm.ReadModuleWithLimits(bytes.NewReader(code), resolve, limits)
+	if err != nil {
+		if v, ok := err.(DeployViolation); ok {
+			return append(violations, v)
+		}
+		flag(ViolationDecode, -1, "%v", err)
+		return violations
+	}
+
+	if policy.AllowedImports != nil && module.Import != nil {
+		allowed := make(map[string]bool, len(policy.AllowedImports))
+		for _, name := range policy.AllowedImports {
+			allowed[name] = true
+		}
+		for _, entry := range module.Import.Entries {
+			if entry.Kind != wasm.ExternalFunction || !allowed[entry.FieldName] {
+				flag(ViolationImport, -1, "import of %s.%s", entry.ModuleName, entry.FieldName)
+			}
+		}
+	}
+
+	for _, name := range policy.RequiredExports {
+		var entry wasm.ExportEntry
+		ok := false
+		if module.Export != nil {
+			entry, ok = module.Export.Entries[name]
+		}
+		if !ok || entry.Kind != wasm.ExternalFunction {
+			flag(ViolationExport, -1, "function %s isn't exported", name)
+		}
+	}
+
+	codeSize := 0
+	for i, fn := range module.FunctionIndexSpace {
+		if fn.EnvFunc || fn.Body == nil {
+			continue
+		}
+		size := len(fn.Body.Code)
+		codeSize += size
+		if policy.MaxFunctionSize != 0 && size > policy.MaxFunctionSize {
+			flag(ViolationSize, i, "the code is %d bytes, more than %d", size, policy.MaxFunctionSize)
+		}
+	}
+	if policy.MaxCodeSize != 0 && codeSize > policy.MaxCodeSize {
+		flag(ViolationSize, -1, "the code is %d bytes, more than %d", codeSize, policy.MaxCodeSize)
+	}
+	if policy.MaxTableSize != 0 {
+		for i, table := range module.Tables() {
+			if table.Limits.Initial > policy.MaxTableSize {
+				flag(ViolationSize, -1, "table %d has %d elements, more than %d", i, table.Limits.Initial, policy.MaxTableSize)
+			}
+		}
+	}
+
+	found, err := validate.VerifyModuleWithPolicy(module, policy.Policy)
+	var invalid validate.Error
+	if errors.As(err, &invalid) {
+		return append(violations, DeployViolation{Kind: ViolationValidation, Function: invalid.Function, Offset: invalid.Offset, Reason: invalid.Err.Error()})
+	}
+	if err != nil {
+		flag(ViolationValidation, -1, "%v", err)
+		return violations
+	}
+	for _, v := range found {
+		violations = append(violations, DeployViolation{Kind: ViolationPolicy, Function: v.Function, Offset: v.Offset, Reason: v.Reason})
+	}
+	return violations
+}
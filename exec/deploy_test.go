@@ -0,0 +1,115 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestValidateForDeployment(t *testing.T) {
+	storage := readTestCode(t, "testdata/storage.wasm")
+	nan := readTestCode(t, "testdata/nan.wasm")
+	// a module importing m.f
+	foreign := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		0x01, 0x04, 0x01, 0x60, 0x00, 0x00,
+		0x02, 0x07, 0x01, 0x01, 'm', 0x01, 'f', 0x00, 0x00,
+	}
+	// a module whose function leaves an i32 on the stack
+	invalid := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		0x01, 0x04, 0x01, 0x60, 0x00, 0x00,
+		0x03, 0x02, 0x01, 0x00,
+		0x0a, 0x06, 0x01, 0x04, 0x00, 0x41, 0x00, 0x0b,
+	}
+	kinds := func(violations []DeployViolation) map[string]int {
+		counts := make(map[string]int)
+		for _, v := range violations {
+			counts[v.Kind]++
+		}
+		return counts
+	}
+
+	if violations := ValidateForDeployment(storage, DeployPolicy{}); len(violations) != 0 {
+		t.Errorf("admitted module: %v", violations)
+	}
+
+	violations := ValidateForDeployment(storage, DeployPolicy{
+		AllowedImports:  []string{"storage_get", "storage_set", "storage_remove"},
+		RequiredExports: []string{"apply", "get"},
+		MaxFunctionSize: 10,
+		MaxCodeSize:     39,
+	})
+	want := map[string]int{ViolationImport: 1, ViolationExport: 1, ViolationSize: 2}
+	if got := kinds(violations); !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v: %v", got, want, violations)
+	}
+	for _, v := range violations {
+		switch v.Kind {
+		case ViolationImport:
+			if v.Reason != "import of env.storage_iterate" {
+				t.Errorf("import: %v", v)
+			}
+		case ViolationExport:
+			if v.Reason != "function apply isn't exported" {
+				t.Errorf("export: %v", v)
+			}
+		case ViolationSize:
+			// iterate passes 6 arguments, and all the functions take 40 bytes
+			if v.Function != 7 && v.Function != -1 {
+				t.Errorf("size: %v", v)
+			}
+		}
+	}
+
+	violations = ValidateForDeployment(nan, DeployPolicy{Policy: validate.Policy{NoFloats: true}})
+	if len(violations) == 0 {
+		t.Error("floats: no violation")
+	}
+	for _, v := range violations {
+		if v.Kind != ViolationPolicy {
+			t.Errorf("floats: %v", v)
+		}
+	}
+
+	// the invalid instruction is located
+	violations = ValidateForDeployment(invalid, DeployPolicy{})
+	if len(violations) != 1 || violations[0].Kind != ViolationValidation || violations[0].Function != 0 || violations[0].Offset < 0 {
+		t.Errorf("invalid: got=%v, want a validation violation in function 0", violations)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		code   []byte
+		policy DeployPolicy
+		want   string
+	}{
+		{"garbage", []byte("not wasm"), DeployPolicy{}, ViolationDecode},
+		{"limits", storage, DeployPolicy{Limits: wasm.DecodeLimits{MaxFunctions: 1}}, ViolationDecode},
+		{"foreign import", foreign, DeployPolicy{}, ViolationImport},
+	} {
+		violations := ValidateForDeployment(tc.code, tc.policy)
+		if len(violations) != 1 || violations[0].Kind != tc.want {
+			t.Errorf("%s: got=%v, want a single %s violation", tc.name, violations, tc.want)
+		}
+	}
+}
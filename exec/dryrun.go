@@ -0,0 +1,116 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "math"
+
+// EstimateGas runs the function fnIndex of vm with args like ExecCode, and
+// returns the gas it consumes according to schedule, without any side
+// effect: the call runs on a copy of the instance of vm with an unlimited
+// meter, and its storage writes are kept in an overlay, seen by the reads
+// of the call, which is discarded. The gas of the transactions sent by the
+// call isn't included.
+func (vm *VM) EstimateGas(schedule *GasSchedule, fnIndex int64, args ...uint64) (uint64, error) {
+	inst, err := vm.Instance.Clone()
+	if err != nil {
+		return 0, err
+	}
+	defer inst.Close()
+
+	dryRun := inst.NewVM()
+	dryRun.contract = vm.contract
+	dryRun.callDep, dryRun.callWid = vm.callDep, vm.callWid
+	dryRun.overlay = make(stateOverlay)
+	if vm.stateStore != nil {
+		dryRun.stateStore = newStoreJournal(vm.stateStore)
+	}
+	dryRun.SetGasMeter(NewGasMeter(math.MaxUint64), schedule)
+	if _, err = dryRun.ExecCodeRaw(fnIndex, args...); err != nil {
+		return 0, err
+	}
+	return dryRun.GasUsed(), nil
+}
+
+// stateOverlay holds the storage writes of a dry run, on top of the
+// contract database.
+type stateOverlay map[stateKey]stateValue
+
+type stateKey struct {
+	contract, object, key string
+	binary                bool
+}
+
+type stateValue struct {
+	value   []byte
+	removed bool
+}
+
+// The functions below access the contract database of vm, through its
+// overlay during a dry run.
+
+func (vm *VM) getStrValue(contract, object, key string) (string, error) {
+	if v, ok := vm.overlay[stateKey{contract, object, key, false}]; ok {
+		if v.removed {
+			return "", ERR_FINE_MAP
+		}
+		return string(v.value), nil
+	}
+	return vm.contract.ContractDB.GetStrValue(contract, object, key)
+}
+
+func (vm *VM) setStrValue(contract, object, key, value string) error {
+	if vm.overlay != nil {
+		vm.overlay[stateKey{contract, object, key, false}] = stateValue{value: []byte(value)}
+		return nil
+	}
+	return vm.contract.ContractDB.SetStrValue(contract, object, key, value)
+}
+
+func (vm *VM) removeStrValue(contract, object, key string) error {
+	if vm.overlay != nil {
+		vm.overlay[stateKey{contract, object, key, false}] = stateValue{removed: true}
+		return nil
+	}
+	return vm.contract.ContractDB.RemoveStrValue(contract, object, key)
+}
+
+func (vm *VM) getBinValue(contract, object, key string) ([]byte, error) {
+	if v, ok := vm.overlay[stateKey{contract, object, key, true}]; ok {
+		if v.removed {
+			return nil, ERR_FINE_MAP
+		}
+		return append([]byte(nil), v.value...), nil
+	}
+	return vm.contract.ContractDB.GetBinValue(contract, object, key)
+}
+
+func (vm *VM) setBinValue(contract, object, key string, value []byte) error {
+	if vm.overlay != nil {
+		vm.overlay[stateKey{contract, object, key, true}] = stateValue{value: append([]byte(nil), value...)}
+		return nil
+	}
+	return vm.contract.ContractDB.SetBinValue(contract, object, key, value)
+}
+
+func (vm *VM) removeBinValue(contract, object, key string) error {
+	if vm.overlay != nil {
+		vm.overlay[stateKey{contract, object, key, true}] = stateValue{removed: true}
+		return nil
+	}
+	return vm.contract.ContractDB.RemoveBinValue(contract, object, key)
+}
@@ -0,0 +1,84 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEstimateGas(t *testing.T) {
+	const getX, setX = 2, 4
+	vm, err := NewVM(readTestModule(t, "testdata/spec/globals.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.Memory()[0] = 0xff
+
+	estimate, err := vm.EstimateGas(DefaultGasSchedule(), setX, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := vm.ExecCode(getX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.(uint32) != uint32(0xfffffff4) {
+		t.Errorf("the dry run changed a global: %d", x)
+	}
+	if vm.GasMeter() != nil {
+		t.Error("the dry run changed the meter of the VM")
+	}
+
+	vm.SetGasMeter(NewGasMeter(1<<20), DefaultGasSchedule())
+	if _, err = vm.ExecCode(setX, 7); err != nil {
+		t.Fatal(err)
+	}
+	if estimate == 0 || estimate != vm.GasUsed() {
+		t.Errorf("unexpected estimate: got=%d, want=%d", estimate, vm.GasUsed())
+	}
+	if vm.Memory()[0] != 0xff {
+		t.Error("the memory of the VM changed")
+	}
+}
+
+func TestStateOverlay(t *testing.T) {
+	vm := &VM{overlay: make(stateOverlay)}
+	if err := vm.setStrValue("c", "o", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := vm.getStrValue("c", "o", "k"); err != nil || v != "v" {
+		t.Errorf("unexpected value: %q, %v", v, err)
+	}
+	value := []byte("bin")
+	if err := vm.setBinValue("c", "o", "k", value); err != nil {
+		t.Fatal(err)
+	}
+	value[0] = 'x'
+	if v, err := vm.getBinValue("c", "o", "k"); err != nil || !bytes.Equal(v, []byte("bin")) {
+		t.Errorf("unexpected binary value: %q, %v", v, err)
+	}
+
+	vm.removeStrValue("c", "o", "k")
+	if _, err := vm.getStrValue("c", "o", "k"); err != ERR_FINE_MAP {
+		t.Errorf("unexpected error reading a removed value: %v", err)
+	}
+	if _, err := vm.getBinValue("c", "o", "k"); err != nil {
+		t.Errorf("removing a string value removed a binary value: %v", err)
+	}
+}
@@ -31,10 +31,10 @@ package exec
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"github.com/bottos-project/bottos/common/types"
 	"github.com/bottos-project/bottos/contract"
-	log "github.com/cihub/seelog"
 )
 
 // EnvFunc defines env for func execution
@@ -47,6 +47,13 @@ type EnvFunc struct {
 
 	envFuncParamIdx int
 	envMethod       string
+
+	// the host functions called by the VM, indexed by function index, so
+	// that envFuncMap is only searched on the first call, see hostFunc
+	envFuncCache []func(*VM) (bool, error)
+
+	// the tags the modules import from "env", see RegisterTag
+	envTags map[string]*Tag
 }
 
 // NewEnvFunc new an EnvFunc
@@ -57,28 +64,30 @@ func NewEnvFunc() *EnvFunc {
 	}
 
 	//env function for C/C++
-	envFunc.Register("printi",           printi)
-	envFunc.Register("prints",           prints)
-	envFunc.Register("getStrValue",      getStrValue)
-	envFunc.Register("setStrValue",      setStrValue)
-	envFunc.Register("removeStrValue",   removeStrValue)
-	envFunc.Register("getStringValue",   getStrValue)
-	envFunc.Register("setStringValue",   setStrValue)
-	envFunc.Register("removeStringValue",removeStrValue)
-	envFunc.Register("getParam",         getParam)
-	envFunc.Register("getMethod",        getMethod)
-	envFunc.Register("callTrx",          callTrx)
-	envFunc.Register("assert",           assert)
-	envFunc.Register("getCtxName",       getCtxName)
-	envFunc.Register("getSender",        getSender)
-	envFunc.Register("malloc",           malloc)
-	envFunc.Register("memset",           memset)
-	envFunc.Register("memcpy",           memcpy)
-	envFunc.Register("strcat_s",         strcat_s)
-	envFunc.Register("strcpy_s",         strcpy_s)
-	envFunc.Register("isAccountExist",   isAccountExist)
-
-	envFunc.Register("getMethodJs",       getMethodJs)
+	envFunc.RegisterWithCost("printi",            printi,         FlatCost(HOST_CALL_GAS))
+	envFunc.RegisterWithCost("prints",            prints,         ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1))
+	envFunc.RegisterWithCost("getStrValue",       getStrValue,    ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1, 3, 5, 7))
+	envFunc.RegisterWithCost("setStrValue",       setStrValue,    ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1, 3, 5))
+	envFunc.RegisterWithCost("removeStrValue",    removeStrValue, ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1, 3))
+	envFunc.RegisterWithCost("getStringValue",    getStrValue,    ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1, 3, 5, 7))
+	envFunc.RegisterWithCost("setStringValue",    setStrValue,    ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1, 3, 5))
+	envFunc.RegisterWithCost("removeStringValue", removeStrValue, ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1, 3))
+	envFunc.RegisterWithCost("getParam",          getParam,       ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1))
+	envFunc.RegisterWithCost("getMethod",         getMethod,      ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1))
+	envFunc.RegisterWithCost("callTrx",           callTrx,        ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 3))
+	envFunc.RegisterWithCost("assert",            assert,         FlatCost(HOST_CALL_GAS))
+	envFunc.RegisterWithCost("getCtxName",        getCtxName,     ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1))
+	envFunc.RegisterWithCost("getSender",         getSender,      ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1))
+	envFunc.RegisterWithCost("malloc",            malloc,         ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 0))
+	envFunc.RegisterWithCost("memset",            memset,         ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 2))
+	envFunc.RegisterWithCost("memcpy",            memcpy,         ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 2))
+	envFunc.RegisterWithCost("strcat_s",          strcat_s,       ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1))
+	envFunc.RegisterWithCost("strcpy_s",          strcpy_s,       ByteCost(HOST_CALL_GAS, HOST_BYTE_GAS, 1))
+	envFunc.RegisterWithCost("isAccountExist",    isAccountExist, FlatCost(HOST_CALL_GAS))
+
+	envFunc.RegisterWithCost("getMethodJs",       getMethodJs,    FlatCost(HOST_CALL_GAS))
+
+	envFunc.Register(GAS_FUNCTION,       chargeGas)
 
 	return &envFunc
 }
@@ -90,6 +99,161 @@ func (env *EnvFunc) Register(method string, handler func(*VM) (bool, error)) {
 	}
 }
 
+// HostCost computes the gas charged for a call to a host function from
+// its arguments.
+type HostCost func(args []uint64) uint64
+
+const (
+	// HOST_CALL_GAS config the gas charged for every call to a host function
+	HOST_CALL_GAS = 100
+	// HOST_BYTE_GAS config the gas charged per byte handled by a host function
+	HOST_BYTE_GAS = 1
+)
+
+// FlatCost returns a HostCost charging amount for every call.
+func FlatCost(amount uint64) HostCost {
+	return func([]uint64) uint64 {
+		return amount
+	}
+}
+
+// ByteCost returns a HostCost charging base, plus perByte for every byte
+// of the buffers whose lengths are the arguments at the indices lengths.
+func ByteCost(base, perByte uint64, lengths ...int) HostCost {
+	return func(args []uint64) uint64 {
+		var n uint64
+		for _, i := range lengths {
+			if i < len(args) {
+				n += uint64(uint32(args[i]))
+			}
+		}
+		if perByte != 0 && n > (math.MaxUint64-base)/perByte {
+			return math.MaxUint64
+		}
+		return base + n*perByte
+	}
+}
+
+// RegisterWithCost registers a method like Register, charging the gas
+// computed by cost from its arguments before every call when the VM is
+// metered, see VM.ChargeGas.
+func (env *EnvFunc) RegisterWithCost(method string, handler func(*VM) (bool, error), cost HostCost) {
+	env.Register(method, func(vm *VM) (bool, error) {
+		if vm.gasMeter != nil {
+			vm.ChargeGas(cost(vm.GetFuncParams()))
+		}
+		return handler(vm)
+	})
+}
+
+// RegisterFunc registers a method like Register, whose handler fn takes
+// the arguments of the call and returns its result as raw 64-bit words,
+// one of:
+//
+//	func(*VM) (uint64, error)
+//	func(*VM, uint64) (uint64, error)
+//	func(*VM, uint64, uint64) (uint64, error)
+//	func(*VM, uint64, uint64, uint64) (uint64, error)
+//	func(*VM, uint64, uint64, uint64, uint64) (uint64, error)
+//
+// The trampoline calling fn is chosen once by its signature: it reads the
+// arguments off the locals of the call, and pushes the result if the
+// import returns one, without the slices of GetFuncParams. A call with
+// another number of arguments fails with ERR_PARAM_COUNT. It panics if
+// fn has another type.
+func (env *EnvFunc) RegisterFunc(method string, fn interface{}) {
+	env.Register(method, trampoline(fn))
+}
+
+// RegisterFuncWithCost registers a method like RegisterFunc, charging the
+// gas computed by cost from its arguments like RegisterWithCost.
+func (env *EnvFunc) RegisterFuncWithCost(method string, fn interface{}, cost HostCost) {
+	env.RegisterWithCost(method, trampoline(fn), cost)
+}
+
+// trampoline returns the handler calling fn, see RegisterFunc.
+func trampoline(fn interface{}) func(*VM) (bool, error) {
+	switch fn := fn.(type) {
+	case func(*VM) (uint64, error):
+		return func(vm *VM) (bool, error) {
+			if len(vm.ctx.locals) != 0 {
+				return false, ERR_PARAM_COUNT
+			}
+			v, err := fn(vm)
+			return hostResult(vm, v, err)
+		}
+	case func(*VM, uint64) (uint64, error):
+		return func(vm *VM) (bool, error) {
+			l := vm.ctx.locals
+			if len(l) != 1 {
+				return false, ERR_PARAM_COUNT
+			}
+			v, err := fn(vm, l[0])
+			return hostResult(vm, v, err)
+		}
+	case func(*VM, uint64, uint64) (uint64, error):
+		return func(vm *VM) (bool, error) {
+			l := vm.ctx.locals
+			if len(l) != 2 {
+				return false, ERR_PARAM_COUNT
+			}
+			v, err := fn(vm, l[0], l[1])
+			return hostResult(vm, v, err)
+		}
+	case func(*VM, uint64, uint64, uint64) (uint64, error):
+		return func(vm *VM) (bool, error) {
+			l := vm.ctx.locals
+			if len(l) != 3 {
+				return false, ERR_PARAM_COUNT
+			}
+			v, err := fn(vm, l[0], l[1], l[2])
+			return hostResult(vm, v, err)
+		}
+	case func(*VM, uint64, uint64, uint64, uint64) (uint64, error):
+		return func(vm *VM) (bool, error) {
+			l := vm.ctx.locals
+			if len(l) != 4 {
+				return false, ERR_PARAM_COUNT
+			}
+			v, err := fn(vm, l[0], l[1], l[2], l[3])
+			return hostResult(vm, v, err)
+		}
+	}
+	panic(fmt.Sprintf("exec: unsupported host function type %T", fn))
+}
+
+// hostResult pushes the result v of a host function called by a
+// trampoline to the stack of vm, unless it failed with err.
+func hostResult(vm *VM, v uint64, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	vm.SetFuncResult(v)
+	return true, nil
+}
+
+// hostFunc returns the host function imported by compiled, the function of
+// the current context of vm, or nil if it isn't registered. The function
+// found is cached for the next calls.
+func (vm *VM) hostFunc(compiled compiledFunction) func(*VM) (bool, error) {
+	env := vm.envFunc
+	index := int(vm.ctx.curFunc)
+	if index < len(env.envFuncCache) && env.envFuncCache[index] != nil {
+		return env.envFuncCache[index]
+	}
+	fc, ok := env.envFuncMap[compiled.funcProp.Method]
+	if !ok {
+		return nil
+	}
+	if index >= len(env.envFuncCache) {
+		cache := make([]func(*VM) (bool, error), index+1)
+		copy(cache, env.envFuncCache)
+		env.envFuncCache = cache
+	}
+	env.envFuncCache[index] = fc
+	return fc
+}
+
 // GetEnvFuncMap retrieve a method from FuncMap
 func (env *EnvFunc) GetEnvFuncMap() map[string]func(*VM) (bool, error) {
 	return env.envFuncMap
@@ -116,7 +280,7 @@ func getStrValue(vm *VM) (bool, error) {
 
 	if valueBufPos >= vmLen || valueBufPos + valueBufLen >= vmLen {
 		fmt.Println("VM::getStrValue *ERROR* Out of bound")
-		log.Infof("*ERROR* Out of bound \n")
+		vm.logger().Infof("*ERROR* Out of bound \n")
 		if vm.envFunc.envFuncRtn {
 			vm.pushUint64(uint64(VM_NULL))
 		}
@@ -136,8 +300,8 @@ func getStrValue(vm *VM) (bool, error) {
 		return true, nil
 	}
 
-	log.Infof(string(contract), len(contract), string(object), len(object), string(key), len(key))
-	value, err := contractCtx.ContractDB.GetStrValue(string(contract), string(object), string(key))
+	vm.logger().Infof(string(contract), len(contract), string(object), len(object), string(key), len(key))
+	value, err := vm.getStrValue(string(contract), string(object), string(key))
 
 	var valueLen uint64 = 0
 	if err == nil {
@@ -149,6 +313,7 @@ func getStrValue(vm *VM) (bool, error) {
 			valueLen = 0
 		}
 		vm.memory[valueBufPos+valueLen] = 0
+		vm.wrote(uint64(valueBufPos), uint64(valueLen)+1)
 	}
 
 	//1. recover the vm context
@@ -158,7 +323,7 @@ func getStrValue(vm *VM) (bool, error) {
 		vm.pushUint64(uint64(valueLen))
 	}
 
-	log.Infof("VM: from contract:%v, method:%v, func get_test_str:(contract=%v, objname=%v, key=%v, value=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, contract, object, key, value)
+	vm.logger().Infof("VM: from contract:%v, method:%v, func get_test_str:(contract=%v, objname=%v, key=%v, value=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, contract, object, key, value)
 
 	return true, nil
 }
@@ -192,9 +357,9 @@ func setStrValue(vm *VM) (bool, error) {
 		return true, nil
 	}
 
-	log.Infof(string(object), len(object), string(key), len(key), string(value), len(value))
+	vm.logger().Infof(string(object), len(object), string(key), len(key), string(value), len(value))
 	result := 1
-	err = contractCtx.ContractDB.SetStrValue(contractCtx.Trx.Contract, string(object), string(key), string(value))
+	err = vm.setStrValue(contractCtx.Trx.Contract, string(object), string(key), string(value))
 	if err != nil {
 		result = 0
 	}
@@ -206,7 +371,7 @@ func setStrValue(vm *VM) (bool, error) {
 		vm.pushUint64(uint64(result))
 	}
 
-	log.Infof("VM: from contract:%v, method:%v, func setStrValue:(objname=%v, key=%v, value=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, object, key, value)
+	vm.logger().Infof("VM: from contract:%v, method:%v, func setStrValue:(objname=%v, key=%v, value=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, object, key, value)
 
 	return true, nil
 }
@@ -234,8 +399,8 @@ func removeStrValue(vm *VM) (bool, error) {
 		return true, nil
 	}
 
-	log.Infof(string(object), len(object), string(key), len(key))
-	err = contractCtx.ContractDB.RemoveStrValue(contractCtx.Trx.Contract, string(object), string(key))
+	vm.logger().Infof(string(object), len(object), string(key), len(key))
+	err = vm.removeStrValue(contractCtx.Trx.Contract, string(object), string(key))
 
 	result := 1
 	if err != nil {
@@ -247,7 +412,7 @@ func removeStrValue(vm *VM) (bool, error) {
 		vm.pushUint64(uint64(result))
 	}
 
-	log.Infof("VM: from contract:%v, method:%v, func removeStrValue:(objname=%v, key=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, object, key)
+	vm.logger().Infof("VM: from contract:%v, method:%v, func removeStrValue:(objname=%v, key=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, object, key)
 
 	return true, nil
 }
@@ -282,14 +447,15 @@ func getBinValue(vm *VM) (bool, error) {
 		return true, nil
 	}
 
-	log.Infof(string(contract), len(contract), string(object), len(object), string(key), len(key))
+	vm.logger().Infof(string(contract), len(contract), string(object), len(object), string(key), len(key))
 	var valueLen uint64 = 0
-	value, err := contractCtx.ContractDB.GetBinValue(string(contract), string(object), string(key))
+	value, err := vm.getBinValue(string(contract), string(object), string(key))
 	if err == nil {
 		valueLen = uint64(len(value))
 		// check buf len
 		if valueLen <= valueBufLen {
 			copy(vm.memory[valueBufPos:valueBufPos+valueLen], value)
+			vm.wrote(uint64(valueBufPos), uint64(valueLen))
 		} else {
 			valueLen = 0
 		}
@@ -302,7 +468,7 @@ func getBinValue(vm *VM) (bool, error) {
 		vm.pushUint64(uint64(valueLen))
 	}
 
-	log.Infof("VM: from contract:%v, method:%v, func get_bin_value:(contract=%v, objname=%v, key=%v, value=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, contract, object, key, value)
+	vm.logger().Infof("VM: from contract:%v, method:%v, func get_bin_value:(contract=%v, objname=%v, key=%v, value=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, contract, object, key, value)
 
 	return true, nil
 }
@@ -335,8 +501,8 @@ func setBinValue(vm *VM) (bool, error) {
 		return true, nil
 	}
 
-	log.Infof(string(object), len(object), string(key), len(key), string(value), len(value))
-	err = contractCtx.ContractDB.SetBinValue(contractCtx.Trx.Contract, string(object), string(key), value)
+	vm.logger().Infof(string(object), len(object), string(key), len(key), string(value), len(value))
+	err = vm.setBinValue(contractCtx.Trx.Contract, string(object), string(key), value)
 
 	result := 1
 	if err != nil {
@@ -350,7 +516,7 @@ func setBinValue(vm *VM) (bool, error) {
 		vm.pushUint64(uint64(result))
 	}
 
-	log.Infof("VM: from contract:%v, method:%v, func setBinValue:(objname=%v, key=%v, value=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, object, key, value)
+	vm.logger().Infof("VM: from contract:%v, method:%v, func setBinValue:(objname=%v, key=%v, value=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, object, key, value)
 
 	return true, nil
 }
@@ -377,8 +543,8 @@ func removeBinValue(vm *VM) (bool, error) {
 		return true, nil
 	}
 
-	log.Infof(string(object), len(object), string(key), len(key))
-	err = contractCtx.ContractDB.RemoveBinValue(contractCtx.Trx.Contract, string(object), string(key))
+	vm.logger().Infof(string(object), len(object), string(key), len(key))
+	err = vm.removeBinValue(contractCtx.Trx.Contract, string(object), string(key))
 
 	result := 1
 	if err != nil {
@@ -390,7 +556,14 @@ func removeBinValue(vm *VM) (bool, error) {
 		vm.pushUint64(uint64(result))
 	}
 
-	log.Infof("VM: from contract:%v, method:%v, func removeBinValue:(objname=%v, key=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, object, key)
+	vm.logger().Infof("VM: from contract:%v, method:%v, func removeBinValue:(objname=%v, key=%v)\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, object, key)
+
+	return true, nil
+}
+
+//void     gas(uint32_t amount);
+func chargeGas(vm *VM) (bool, error) {
+	vm.ChargeGas(uint64(uint32(vm.envFunc.envFuncParam[0])))
 
 	return true, nil
 }
@@ -401,7 +574,7 @@ func printi(vm *VM) (bool, error) {
 	value       := vm.envFunc.envFuncParam[0]
 
 	fmt.Printf("VM: from contract: %v, method: %v, func printi: %v\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, value)
-	log.Infof("VM: from contract:%v, method:%v, func printi: %v\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, value)
+	vm.logger().Infof("VM: from contract:%v, method:%v, func printi: %v\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, value)
 
 	return true, nil
 }
@@ -410,7 +583,7 @@ func printi64(vm *VM) (bool, error) {
 	contractCtx := vm.GetContract()
 	value       := vm.envFunc.envFuncParam[0]
 	fmt.Printf("VM: from contract: %v, method: %v, func printi64: %v\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, value)
-	log.Infof("VM: from contract:%v, method:%v, func printi64: %v\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, value)
+	vm.logger().Infof("VM: from contract:%v, method:%v, func printi64: %v\n", contractCtx.Trx.Contract, contractCtx.Trx.Method, value)
 
 	return true, nil
 }
@@ -423,13 +596,13 @@ func prints(vm *VM) (bool, error) {
 	value , err := Convert(vm , pos , len)
 	if err != nil {
 		fmt.Println("*ERROR* vm::prints failed to convert parameter in prints , err: ", err)
-		log.Infof("*ERROR* vm::prints failed to convert parameter in prints , err: ", err)
+		vm.logger().Infof("*ERROR* vm::prints failed to convert parameter in prints , err: ", err)
 		return true, nil
 	}
 
 	param := string(value)
 	fmt.Println("VM: func prints: ", param)
-	log.Infof("VM: func prints: %v\n", param)
+	vm.logger().Infof("VM: func prints: %v\n", param)
 	return true, nil
 }
 
@@ -445,7 +618,7 @@ func getMethod(vm *VM) (bool, error) {
 	vmLen  := uint64(len(vm.memory))
     if pos >= vmLen || pos + length >= vmLen {
 		fmt.Println("VM::getMethod *ERROR* Out of bound")
-		log.Infof("*ERROR* Out of bound \n")
+		vm.logger().Infof("*ERROR* Out of bound \n")
 		if vm.envFunc.envFuncRtn {
 			vm.pushUint64(uint64(VM_NULL))
 		}
@@ -455,13 +628,14 @@ func getMethod(vm *VM) (bool, error) {
 	contractCtx := vm.GetContract()
 	methodLen   := uint64(len(contractCtx.Trx.Method))
 	if methodLen > length {
-		log.Infof("*ERROR* Invaild string length \n")
+		vm.logger().Infof("*ERROR* Invaild string length \n")
 		if vm.envFunc.envFuncRtn {
 			vm.pushUint64(uint64(VM_NULL))
 		}
 		return true, nil
 	}
 
+	vm.wrote(uint64(pos), uint64(methodLen))
 	if uint64(copy(vm.memory[pos:pos + methodLen], []byte(contractCtx.Trx.Method))) != methodLen {
 		if vm.envFunc.envFuncRtn {
 			vm.pushUint64(uint64(VM_NULL))
@@ -492,7 +666,7 @@ func getParam(vm *VM) (bool, error) {
 	paramLen := uint64(len(contractCtx.Trx.Param))
 	if bufPos >= vmLen || bufPos + bufLen >= vmLen {
 		fmt.Println("VM::getParam *ERROR* Out of bound")
-		log.Infof("*ERROR* Out of bound \n")
+		vm.logger().Infof("*ERROR* Out of bound \n")
 		if vm.envFunc.envFuncRtn {
 			vm.pushUint64(uint64(VM_NULL))
 		}
@@ -500,7 +674,7 @@ func getParam(vm *VM) (bool, error) {
 	}
 
 	if bufLen <= paramLen {
-		log.Infof("*ERROR* Invaild string length \n")
+		vm.logger().Infof("*ERROR* Invaild string length \n")
 		if vm.envFunc.envFuncRtn {
 			vm.pushUint64(uint64(VM_NULL))
 		}
@@ -508,6 +682,7 @@ func getParam(vm *VM) (bool, error) {
 	}
 
 	copy(vm.memory[bufPos : bufPos + paramLen], contractCtx.Trx.Param)
+	vm.wrote(uint64(bufPos), uint64(paramLen))
 
 	vm.ctx = vm.envFunc.envFuncCtx
 	if vm.envFunc.envFuncRtn {
@@ -593,7 +768,7 @@ func assert(vm *VM) (bool, error) {
 	cond := params[0]
 	if cond != 1 {
 		errStr := "*ERROR* failed to execute safe-function !!!"
-		log.Infof(errStr)
+		vm.logger().Infof(errStr)
 		panic(errStr)
 	}
 
@@ -611,7 +786,7 @@ func getCtxName(vm *VM) (bool, error) {
 	vmLen  := uint64(len(vm.memory))
 	if pos >= vmLen || pos + length >= vmLen {
 		fmt.Println("VM::getCtxName *ERROR* Out of bound")
-		log.Infof("*ERROR* Out of bound \n")
+		vm.logger().Infof("*ERROR* Out of bound \n")
 		if vm.envFunc.envFuncRtn {
 			vm.pushUint64(uint64(VM_NULL))
 		}
@@ -619,7 +794,7 @@ func getCtxName(vm *VM) (bool, error) {
 	}
 
 	if length < ctxNameLen + 1 {
-		log.Infof("*ERROR* Invaild string length \n")
+		vm.logger().Infof("*ERROR* Invaild string length \n")
 		if vm.envFunc.envFuncRtn {
 			vm.pushInt32(int32(VM_NULL))
 		}
@@ -628,6 +803,7 @@ func getCtxName(vm *VM) (bool, error) {
 
 	copy(vm.memory[pos:pos+ctxNameLen], []byte(ctxName))
 	vm.memory[pos+ctxNameLen] = 0
+	vm.wrote(uint64(pos), uint64(ctxNameLen)+1)
 	if vm.envFunc.envFuncRtn {
 		vm.pushInt32(int32(ctxNameLen))
 	}
@@ -646,7 +822,7 @@ func getSender(vm *VM) (bool, error) {
 	vmLen  := uint64(len(vm.memory))
 	if pos >= vmLen || pos + length >= vmLen {
 		fmt.Println("VM::getSender *ERROR* Out of bound")
-		log.Infof("*ERROR* Out of bound \n")
+		vm.logger().Infof("*ERROR* Out of bound \n")
 		if vm.envFunc.envFuncRtn {
 			vm.pushUint64(uint64(VM_NULL))
 		}
@@ -654,7 +830,7 @@ func getSender(vm *VM) (bool, error) {
 	}
 
 	if length < senderNameLen + 1 {
-		log.Infof("*ERROR* Invaild string length \n")
+		vm.logger().Infof("*ERROR* Invaild string length \n")
 		if vm.envFunc.envFuncRtn {
 			vm.pushInt32(int32(VM_NULL))
 		}
@@ -663,6 +839,7 @@ func getSender(vm *VM) (bool, error) {
 
 	copy(vm.memory[pos:pos+senderNameLen], []byte(senderName))
 	vm.memory[pos+senderNameLen] = 0
+	vm.wrote(uint64(pos), uint64(senderNameLen)+1)
 	if vm.envFunc.envFuncRtn {
 		vm.pushInt32(int32(senderNameLen))
 	}
@@ -684,7 +861,7 @@ func memset(vm *VM) (bool, error) {
 	vmLen   := uint64(len(vm.memory))
 	if pos >= vmLen || pos + count >= vmLen {
 		fmt.Println("VM::memset *ERROR* Out of bound")
-		log.Infof("*ERROR* Out of bound \n")
+		vm.logger().Infof("*ERROR* Out of bound \n")
 		if vm.envFunc.envFuncRtn {
 			vm.pushUint64(uint64(VM_NULL))
 		}
@@ -698,6 +875,7 @@ func memset(vm *VM) (bool, error) {
 	}
 
 	copy(vm.memory[pos:pos + count], tempMem)
+	vm.wrote(uint64(pos), uint64(count))
 
 	if vm.envFunc.envFuncRtn {
 		vm.pushInt32(int32(pos))
@@ -732,6 +910,7 @@ func memcpy(vm *VM) (bool, error) {
 	}
 
 	copy(vm.memory[dst:dst + length], vm.memory[src:src + length])
+	vm.wrote(uint64(dst), uint64(length))
 	if vm.envFunc.envFuncRtn {
 		vm.pushUint64(uint64(dst))
 	}
@@ -765,6 +944,7 @@ func strcat_s(vm *VM) (bool, error) {
 
 	copy(vm.memory[dstPoint:dstPoint + srcLen],vm.memory[src:src + srcLen])
 	vm.memory[dstPoint + srcLen] = 0
+	vm.wrote(uint64(dstPoint), uint64(srcLen)+1)
 	if vm.envFunc.envFuncRtn {
 		vm.pushUint32(uint32(VM_NOERROR))
 	}
@@ -794,6 +974,7 @@ func strcpy_s(vm *VM) (bool, error) {
 
 	copy(vm.memory[dst:dst + srcLen],vm.memory[src:src + srcLen])
 	vm.memory[dst + srcLen] = 0
+	vm.wrote(uint64(dst), uint64(srcLen)+1)
 
 	if vm.envFunc.envFuncRtn {
 		vm.pushUint32(uint32(VM_NOERROR))
@@ -819,7 +1000,7 @@ func isAccountExist(vm *VM) (bool, error) {
 	accountName := BytesToString(accountNameByte)
 
 	if contractCtx == nil || contractCtx.RoleIntf == nil {
-		log.Infof("*ERROR* param is empty when call isAccountExist !!! ")
+		vm.logger().Infof("*ERROR* param is empty when call isAccountExist !!! ")
 		if vm.envFunc.envFuncRtn {
 			vm.pushUint64(uint64(VM_FALSE))
 		}
@@ -828,7 +1009,7 @@ func isAccountExist(vm *VM) (bool, error) {
 
 	accountObj, err := contractCtx.RoleIntf.GetAccount(accountName)
 	if err != nil {
-		log.Infof("*ERROR* Failed to get account by name !!! ", err.Error())
+		vm.logger().Infof("*ERROR* Failed to get account by name !!! ", err.Error())
 		if vm.envFunc.envFuncRtn {
 			vm.pushUint64(uint64(VM_FALSE))
 		}
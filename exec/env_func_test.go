@@ -0,0 +1,90 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestRegisterFunc(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/host-call.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticks := 0
+	imports := NewEnvFunc()
+	imports.RegisterFunc("mix", func(vm *VM, a, b uint64) (uint64, error) {
+		return a<<32 | b, nil
+	})
+	imports.RegisterFuncWithCost("tick", func(vm *VM) (uint64, error) {
+		ticks++
+		return 2, nil
+	}, FlatCost(10))
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+
+	mix := int64(module.Export.Entries["mix"].Index)
+	if res, err := vm.ExecCode(mix, 7, 9); err != nil || res.(uint64) != 7<<32|9 {
+		t.Errorf("mix: got=%v, %v", res, err)
+	}
+
+	// the host calls don't allocate once the VM has warmed up
+	sum := int64(module.Export.Entries["sum"].Index)
+	if _, err := vm.ExecCodeRaw(sum, 10); err != nil {
+		t.Fatal(err)
+	}
+	var res uint64
+	allocs := testing.AllocsPerRun(100, func() {
+		res, _ = vm.ExecCodeRaw(sum, 10)
+	})
+	if res != 20 || ticks != 1020 {
+		t.Errorf("sum: got=%d after %d ticks", res, ticks)
+	}
+	if allocs != 0 {
+		t.Errorf("unexpected allocations: %v", allocs)
+	}
+
+	// the cost is charged before the calls
+	vm.SetGasMeter(NewGasMeter(1<<20), DefaultGasSchedule())
+	if _, err := vm.ExecCodeRaw(sum, 3); err != nil {
+		t.Fatal(err)
+	}
+	if used := vm.GasUsed(); used < 30 {
+		t.Errorf("gas: got=%d", used)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("registered a function of an unsupported type")
+			}
+		}()
+		imports.RegisterFunc("bad", func(vm *VM, a uint32) uint32 { return a })
+	}()
+}
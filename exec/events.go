@@ -0,0 +1,201 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+// Event is an event emitted by a contract, see RegisterEvents, for the
+// embedder to report it in the receipt of the call.
+type Event struct {
+	// Contract is the contract which emitted the event, the one of the
+	// contract context of the VM, see SetContract, or "".
+	Contract string
+	Topic    string
+	Data     []byte
+}
+
+// The limits of the events of an EventConfig setting none.
+const (
+	DefaultEventCount     = 64
+	DefaultEventTopicSize = 256
+	DefaultEventDataSize  = 16 * 1024
+	DefaultEventLogSize   = 64 * 1024
+)
+
+// EventConfig configures the emit_event host function.
+type EventConfig struct {
+	// MaxTopicSize and MaxDataSize are the largest topics and data of an
+	// event in bytes, MaxEvents the largest number of events of a call and
+	// MaxLogSize the largest total size of their topics and data, the
+	// defaults if zero.
+	MaxTopicSize int
+	MaxDataSize  int
+	MaxEvents    int
+	MaxLogSize   int
+	// CallGas is the gas charged for every event and ByteGas for every
+	// byte of its topic and data, HOST_CALL_GAS and HOST_BYTE_GAS if zero.
+	CallGas uint64
+	ByteGas uint64
+}
+
+// The statuses returned by emit_event, see RegisterEvents.
+const (
+	EVENT_TOO_LARGE = -1 - iota // the topic or the data is larger than allowed
+	EVENT_LIMIT                 // the call emitted as many events or bytes as allowed
+)
+
+// RegisterEvents registers the emit_event host function into env, which
+// appends an event to the events of the call of the VM calling it:
+//
+//	int32_t emit_event(uint8_t *topic, uint32_t topic_len, uint8_t *data, uint32_t data_len);
+//
+// It returns zero, EVENT_TOO_LARGE for a topic or data larger than config
+// allows, and EVENT_LIMIT once the call emitted as many events or bytes as
+// config allows, the event being dropped. The events are only kept by the
+// VMs collecting them, see CollectEvents, but are limited and charged the
+// same way otherwise, for the calls not to depend on it. Buffers out of
+// the bounds of the memory trap the VM.
+func RegisterEvents(env *EnvFunc, config EventConfig) {
+	if config.MaxTopicSize == 0 {
+		config.MaxTopicSize = DefaultEventTopicSize
+	}
+	if config.MaxDataSize == 0 {
+		config.MaxDataSize = DefaultEventDataSize
+	}
+	if config.MaxEvents == 0 {
+		config.MaxEvents = DefaultEventCount
+	}
+	if config.MaxLogSize == 0 {
+		config.MaxLogSize = DefaultEventLogSize
+	}
+	if config.CallGas == 0 {
+		config.CallGas = HOST_CALL_GAS
+	}
+	if config.ByteGas == 0 {
+		config.ByteGas = HOST_BYTE_GAS
+	}
+	e := &eventFuncs{config}
+	env.Register("emit_event", e.emit)
+}
+
+// eventLog holds the events of the current call of a VM, and of the
+// contracts it calls, see CallContract. The events are counted even if
+// they aren't collected.
+type eventLog struct {
+	collect bool
+	events  []Event
+	// the number of events, and the total size of their topics and data
+	count int
+	size  int
+}
+
+// eventLog returns the event log of vm, created if it has none.
+func (vm *VM) eventLog() *eventLog {
+	if vm.events == nil {
+		vm.events = &eventLog{}
+	}
+	return vm.events
+}
+
+// reset discards the events of the previous call.
+func (l *eventLog) reset() {
+	l.events, l.count, l.size = nil, 0, 0
+}
+
+// mark returns the state of l, which rollback restores.
+func (l *eventLog) mark() eventLog {
+	return *l
+}
+
+// rollback discards the events emitted since mark was taken.
+func (l *eventLog) rollback(mark eventLog) {
+	l.events, l.count, l.size = l.events[:len(mark.events)], mark.count, mark.size
+}
+
+// CollectEvents sets whether the events emitted by the following calls of
+// vm are collected, returned by Events once each call is done. The
+// contracts it calls with a ContractCaller add their events to the ones
+// of vm, unless they fail.
+func (vm *VM) CollectEvents(enable bool) {
+	vm.eventLog().collect = enable
+}
+
+// Events returns the events emitted by the last call of vm, in their
+// order, if they were collected, see CollectEvents. A call failing keeps
+// the events emitted before it failed, which a receipt shouldn't report.
+func (vm *VM) Events() []Event {
+	if vm.events == nil || !vm.events.collect {
+		return nil
+	}
+	return vm.events.events
+}
+
+// ExecCodeEvents calls the function with the given index like ExecCode,
+// and returns the events it emitted along with its result, none if it
+// fails.
+func (vm *VM) ExecCodeEvents(fnIndex int64, args ...uint64) (interface{}, []Event, error) {
+	if vm.events == nil || !vm.events.collect {
+		vm.CollectEvents(true)
+		defer vm.CollectEvents(false)
+	}
+	res, err := vm.ExecCode(fnIndex, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, vm.Events(), nil
+}
+
+type eventFuncs struct {
+	config EventConfig
+}
+
+func (e *eventFuncs) emit(vm *VM) (bool, error) {
+	params := vm.GetFuncParams()
+	if len(params) != 4 {
+		return false, ERR_PARAM_COUNT
+	}
+	topic := vm.hostBytes(uint32(params[0]), uint32(params[1]))
+	data := vm.hostBytes(uint32(params[2]), uint32(params[3]))
+	if vm.gasMeter != nil {
+		vm.ChargeGas(e.config.CallGas)
+		vm.ChargeGas(byteGas(e.config.ByteGas, len(topic)+len(data)))
+	}
+	if len(topic) > e.config.MaxTopicSize || len(data) > e.config.MaxDataSize {
+		e.status(vm, EVENT_TOO_LARGE)
+		return true, nil
+	}
+	log := vm.eventLog()
+	if log.count >= e.config.MaxEvents || log.size+len(topic)+len(data) > e.config.MaxLogSize {
+		e.status(vm, EVENT_LIMIT)
+		return true, nil
+	}
+	log.count++
+	log.size += len(topic) + len(data)
+	if log.collect {
+		contract := ""
+		if vm.contract != nil && vm.contract.Trx != nil {
+			contract = vm.contract.Trx.Contract
+		}
+		log.events = append(log.events, Event{Contract: contract, Topic: string(topic), Data: append([]byte(nil), data...)})
+	}
+	e.status(vm, 0)
+	return true, nil
+}
+
+// status returns status from the host function.
+func (e *eventFuncs) status(vm *VM, status int32) {
+	vm.SetFuncResult(uint64(uint32(status)))
+}
@@ -0,0 +1,121 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/common/types"
+	"github.com/bottos-project/bottos/contract"
+)
+
+func TestEvents(t *testing.T) {
+	code, err := os.ReadFile("testdata/events.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewModuleCache(VMConfig{}, importer, 4, 1<<20)
+	env := NewEnvFunc()
+	RegisterEvents(env, EventConfig{MaxTopicSize: 4, MaxDataSize: 8, MaxEvents: 3, MaxLogSize: 20, CallGas: 10, ByteGas: 2})
+	caller := NewContractCaller(CodeStoreFunc(func(string) ([]byte, error) { return code, nil }), cache, env, ContractCallConfig{})
+	caller.Register(env)
+	module, err := cache.Load(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := module.Instantiate(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	vm.SetContract(&contract.Context{Trx: &types.Transaction{Contract: "c"}})
+
+	// the topic is at 100 and the data at 200
+	const topic, data = 100, 200
+	index := func(name string) int64 {
+		export, _ := module.Export(name)
+		return int64(export.Index)
+	}
+	emit := func(tp, d string) (int32, []Event) {
+		t.Helper()
+		copy(vm.Memory()[topic:], tp)
+		copy(vm.Memory()[data:], d)
+		res, events, err := vm.ExecCodeEvents(index("emit"), topic, uint64(len(tp)), data, uint64(len(d)))
+		if err != nil {
+			t.Fatalf("emit: %v", err)
+		}
+		return int32(res.(uint32)), events
+	}
+	if status, events := emit("t", "d1"); status != 0 || !reflect.DeepEqual(events, []Event{{"c", "t", []byte("d1")}}) {
+		t.Errorf("emit: got=%d %v", status, events)
+	}
+	// the events of the previous call are gone
+	if status, events := emit("u", "d2"); status != 0 || !reflect.DeepEqual(events, []Event{{"c", "u", []byte("d2")}}) {
+		t.Errorf("second emit: got=%d %v", status, events)
+	}
+	if status, events := emit("topic", ""); status != EVENT_TOO_LARGE || len(events) != 0 {
+		t.Errorf("long topic: got=%d %v", status, events)
+	}
+	if status, _ := emit("t", "long data"); status != EVENT_TOO_LARGE {
+		t.Errorf("long data: got=%d, want=%d", status, EVENT_TOO_LARGE)
+	}
+	if events := vm.Events(); events != nil {
+		t.Errorf("uncollected events: %v", events)
+	}
+
+	// the events of the callees add to the ones of the caller unless they
+	// fail, within the limits of the call
+	nest := func(args string) (int32, []Event) {
+		t.Helper()
+		copy(vm.Memory()[data:], args)
+		res, events, err := vm.ExecCodeEvents(index("nest"), data, uint64(len(args)))
+		if err != nil {
+			t.Fatalf("nest: %v", err)
+		}
+		// the result is the status of the call, 4 bytes at the pointer at res
+		ptr := binary.LittleEndian.Uint32(vm.Memory()[res.(uint32):])
+		return int32(binary.LittleEndian.Uint32(vm.Memory()[ptr:])), events
+	}
+	status, events := nest("ay")
+	want := []Event{{"c", "nest", []byte("ay")}, {"a", "log", []byte("y")}}
+	if status != 0 || !reflect.DeepEqual(events, want) {
+		t.Errorf("nest: got=%d %v, want=0 %v", status, events, want)
+	}
+	status, events = nest("a!y")
+	want = []Event{{"c", "nest", []byte("a!y")}}
+	if status != CONTRACT_CALL_FAILED || !reflect.DeepEqual(events, want) {
+		t.Errorf("failing nest: got=%d %v, want=%d %v", status, events, CONTRACT_CALL_FAILED, want)
+	}
+	// the event of the callee would make the log larger than 20 bytes
+	status, events = nest("a1234567")
+	want = []Event{{"c", "nest", []byte("a1234567")}}
+	if status != 0 || !reflect.DeepEqual(events, want) {
+		t.Errorf("limited nest: got=%d %v, want=0 %v", status, events, want)
+	}
+
+	meter := NewGasMeter(1000)
+	vm.SetGasMeter(meter, nil)
+	emit("t", "ddd")
+	if got := meter.Used(); got != 10+2*4 {
+		t.Errorf("gas: got=%d, want=%d", got, 10+2*4)
+	}
+}
@@ -59,6 +59,9 @@ var ERR_GET_STORE_POS            = errors.New("*ERROR* failed to get the positio
 var ERR_CREATE_VM                = errors.New("*ERROR* failed to create a new VM instance")
 var ERR_GET_VM                   = errors.New("*ERROR* failed to get a VM instance from memory")
 var ERR_FIND_VM_METHOD           = errors.New("*ERROR* failed to find the method from the wasm module")
+// ERR_FIND_VM_TAG is returned by Instantiate when a tag the module imports
+// from "env" isn't registered, or has other parameters.
+var ERR_FIND_VM_TAG              = errors.New("*ERROR* failed to find the tag from the wasm module")
 var ERR_PARAM_COUNT              = errors.New("*ERROR* parameters count is not right")
 var ERR_UNSUPPORT_TYPE           = errors.New("*ERROR* unsupport type")
 var ERR_OUT_BOUNDS               = errors.New("*ERROR* (array) index out of bounds")
@@ -67,10 +70,148 @@ var ERR_EMPTY_INVALID_PARAM      = errors.New("*ERROR* empty parameter or invali
 var ERR_INVALID_WASM             = errors.New("*ERROR* invalid wasm module")
 var ERR_DATA_INDEX               = errors.New("*ERROR* failed to get data index from memory")
 var ERR_FINE_MAP                 = errors.New("*ERROR* the specified value can't be found by the key from the map")
-// ErrMultipleLinearMemories is returned by (*VM).NewVM when the module
-// has more then one entries in the linear memory space.
-var ERR_MULTIPLE_LINEAR_MEMORIES = errors.New("*ERROR* more than one linear memories in module")
+// ErrMultipleLinearMemories is returned by (*VM).NewVM when a memory of
+// the module other than the first one is shared: only the first memory
+// can be shared with other instances, see Instance.Spawn.
+var ERR_MULTIPLE_LINEAR_MEMORIES = errors.New("*ERROR* only the first linear memory can be shared")
 // ErrInvalidArgumentCount is returned by (*VM).ExecCode when an invalid
 // number of arguments to the WebAssembly function are passed to it.
 var ERR_INVALID_ARGUMENT_COUNT   = errors.New("*ERROR* invalid number of arguments to function")
-
+// ERR_COMPILED_FORMAT is returned by DeserializeCompiled when the data
+// isn't a compiled module artifact.
+var ERR_COMPILED_FORMAT          = errors.New("*ERROR* invalid compiled module artifact")
+var ERR_COMPILED_VERSION         = errors.New("*ERROR* unsupported compiled module artifact version")
+var ERR_COMPILED_CHECKSUM        = errors.New("*ERROR* compiled module artifact checksum mismatch")
+var ERR_COMPILED_MISMATCH        = errors.New("*ERROR* compiled module artifact doesn't match the module")
+// ERR_INSTANCE_CLOSED is returned when calling a function of a closed
+// instance, or closing it again.
+var ERR_INSTANCE_CLOSED          = errors.New("*ERROR* the instance is closed")
+// ERR_GAS_SCHEDULE_SCHEMA is returned by ParseGasSchedule when the document
+// uses an unsupported version of the format.
+var ERR_GAS_SCHEDULE_SCHEMA      = errors.New("*ERROR* unsupported gas schedule schema")
+// ERR_GAS_INSTRUMENTED is returned by InstrumentGas when the module
+// already imports the gas function.
+var ERR_GAS_INSTRUMENTED         = errors.New("*ERROR* the module already imports the gas function")
+// ERR_RESOURCE_LIMIT is returned when creating an instance whose memory or
+// table is denied by the ResourceLimiter.
+var ERR_RESOURCE_LIMIT           = errors.New("*ERROR* the resources of the instance exceed the limits")
+// ERR_CONTINUATION_FORMAT is returned by Continuation.UnmarshalBinary when
+// the data isn't a serialized continuation, and ERR_CONTINUATION_MISMATCH
+// by Resume when the continuation doesn't belong to the module of the VM.
+var ERR_CONTINUATION_FORMAT      = errors.New("*ERROR* invalid serialized continuation")
+var ERR_CONTINUATION_MISMATCH    = errors.New("*ERROR* the continuation doesn't match the module")
+// ERR_MEMORY_NOT_SHARED is returned by Instance.Spawn when the memory of
+// the instance isn't declared shared, and ERR_MEMORY_SHARED by Reset when
+// the memory is shared with other instances.
+var ERR_MEMORY_NOT_SHARED        = errors.New("*ERROR* the memory of the instance is not shared")
+var ERR_MEMORY_SHARED            = errors.New("*ERROR* the memory is shared with other instances")
+// ERR_RELAXED_SIMD is returned by CompileModule when the module uses the
+// relaxed SIMD operators without VMConfig.RelaxedSIMD.
+var ERR_RELAXED_SIMD             = errors.New("*ERROR* the relaxed SIMD operators are disabled")
+// ERR_CANON_REALLOC is returned by (*VM).CanonicalABI when the module
+// doesn't export the realloc function, ERR_CANON_VALUE when lowering a
+// value not matching its type, and ERR_CANON_MEMORY when the memory
+// doesn't hold a valid value, or the allocated memory is out of bounds.
+var ERR_CANON_REALLOC            = errors.New("*ERROR* the module doesn't export a valid realloc function")
+var ERR_CANON_VALUE              = errors.New("*ERROR* the value doesn't match its canonical ABI type")
+var ERR_CANON_MEMORY             = errors.New("*ERROR* invalid canonical ABI value in memory")
+// ERR_ASYNCIFY is returned by (*VM).Asyncify when the module isn't
+// asyncified or the buffer of the frames is invalid, ERR_ASYNCIFY_STATE
+// when a call is made while another one is unwinding or rewinding, or a
+// resumed call doesn't reach a host function, and ERR_ASYNCIFY_FORMAT by
+// AsyncifyState.UnmarshalBinary for invalid data.
+var ERR_ASYNCIFY                 = errors.New("*ERROR* the module is not asyncified")
+var ERR_ASYNCIFY_STATE           = errors.New("*ERROR* invalid asyncify call state")
+var ERR_ASYNCIFY_FORMAT          = errors.New("*ERROR* invalid serialized asyncify state")
+// ERR_DATA_OVERLAP is returned by Instantiate when active data segments
+// overlap, see VMConfig.DisjointDataSegments.
+var ERR_DATA_OVERLAP             = errors.New("*ERROR* active data segments overlap")
+// ERR_UNKNOWN_EXPORT is returned by Instance.Call when the module doesn't
+// export a function with the given name.
+var ERR_UNKNOWN_EXPORT           = errors.New("*ERROR* the module doesn't export the function")
+// ERR_JSON_SIGNATURE is returned by (*VM).CallJSON when the types of the
+// parameters and the result of a method don't match the export it calls.
+var ERR_JSON_SIGNATURE           = errors.New("*ERROR* the method doesn't match the signature of the export")
+// ERR_INVALID_TRACE is returned by (*VM).Replay when the trace isn't one
+// recorded by a Recorder, or is truncated.
+var ERR_INVALID_TRACE            = errors.New("*ERROR* invalid execution trace")
+// ERR_SNAPSHOTS_DISABLED is returned by (*VM).Snapshot and (*VM).Restore
+// when the package isn't built with the wasmdebug build tag, and
+// ERR_SNAPSHOT_CALL by Snapshot without a call in progress, or within a
+// call nested in a host function.
+var ERR_SNAPSHOTS_DISABLED       = errors.New("*ERROR* snapshots require the wasmdebug build tag")
+var ERR_SNAPSHOT_CALL            = errors.New("*ERROR* no call in progress to snapshot")
+// ERR_SNAPSHOT_REFS is returned by Instance.Snapshot when the instance
+// holds externref handles or GC objects, ERR_SNAPSHOT_FORMAT by Restore
+// for invalid data, and ERR_SNAPSHOT_MISMATCH for a snapshot of another
+// module, or whose sizes are out of its limits.
+var ERR_SNAPSHOT_REFS            = errors.New("*ERROR* the instance holds references which can't be snapshotted")
+var ERR_SNAPSHOT_FORMAT          = errors.New("*ERROR* invalid instance snapshot")
+var ERR_SNAPSHOT_MISMATCH        = errors.New("*ERROR* the snapshot doesn't match the instance")
+// ERR_STATE_MISMATCH is returned by Instance.ApplyDiff when the instance
+// isn't in the old state of the diff.
+var ERR_STATE_MISMATCH           = errors.New("*ERROR* the instance isn't in the old state of the diff")
+// ERR_NOT_FORK is returned by Instance.Promote for an instance which isn't
+// a fork, and ERR_FORK_STALE when the instance it was forked from changed
+// since.
+var ERR_NOT_FORK                 = errors.New("*ERROR* the instance isn't a fork")
+var ERR_FORK_STALE               = errors.New("*ERROR* the instance forked changed since the fork")
+// ERR_CONTRACT_DEPTH is returned by ContractCaller.CallContract for calls
+// nested too deep, and ERR_CONTRACT_METHOD when the callee doesn't export
+// the method called.
+var ERR_CONTRACT_DEPTH           = errors.New("*ERROR* the contract calls are nested too deep")
+var ERR_CONTRACT_METHOD          = errors.New("*ERROR* the contract doesn't export the method")
+// ERR_COVERAGE_MODULE is returned by (*VM).SetCoverage for a coverage of
+// another module.
+var ERR_COVERAGE_MODULE          = errors.New("*ERROR* the coverage is of another module")
+// ERR_MODULE_UNSIGNED is returned by VerifySignature for a module without a
+// signature section, or whose signature section isn't the last one,
+// ERR_MODULE_UNTRUSTED for a module signed by a key which isn't trusted,
+// and ERR_MODULE_SIGNATURE for an invalid signature.
+var ERR_MODULE_UNSIGNED          = errors.New("*ERROR* the module isn't signed")
+var ERR_MODULE_UNTRUSTED         = errors.New("*ERROR* the module isn't signed by a trusted key")
+var ERR_MODULE_SIGNATURE         = errors.New("*ERROR* invalid module signature")
+// ERR_CONTRACT_REENTRANCY is returned by ContractCaller.CallContract for
+// the calls reentering a contract against its ReentrancyPolicy.
+var ERR_CONTRACT_REENTRANCY      = errors.New("*ERROR* the contract can't be reentered")
+// ERR_BUDGET_UNMETERED is returned by (*VM).ExecCodeBudget and
+// (*VM).ResumeBudget for a VM without a gas meter.
+var ERR_BUDGET_UNMETERED         = errors.New("*ERROR* the budget of an unmetered call")
+// ERR_RECEIPT_FORMAT is returned by (*Receipt).UnmarshalBinary for data
+// which isn't a serialized receipt.
+var ERR_RECEIPT_FORMAT           = errors.New("*ERROR* invalid receipt format")
+// ERR_GUEST_ALLOCATOR is returned by (*VM).GuestAllocator when the module
+// doesn't export the allocator functions, and by the AssemblyScriptABI
+// lowering values for a module not exporting its runtime. ERR_GUEST_OBJECT
+// is returned by the AssemblyScriptABI for an address which doesn't hold
+// an object of the expected class.
+var ERR_GUEST_ALLOCATOR          = errors.New("*ERROR* the module doesn't export a valid allocator")
+var ERR_GUEST_OBJECT             = errors.New("*ERROR* invalid guest object in memory")
+// ERR_READ_ONLY_INLINED is returned by (*VM).SetReadOnlyMemory for a
+// module compiled with VMConfig.InlineThreshold.
+var ERR_READ_ONLY_INLINED        = errors.New("*ERROR* read-only memory needs the functions not to be inlined")
+// ERR_NO_ABI is returned by (*VM).CallJSON without an ABI for a module
+// which doesn't embed one.
+var ERR_NO_ABI                   = errors.New("*ERROR* the module has no abi section")
+// ERR_UPGRADE_MEMORY is returned by (*Module).Upgrade for a memory which
+// the new version can't start with, ERR_MIGRATE_SIGNATURE for a migrate
+// function of an invalid type, and ERR_MIGRATION_FAILED for a migration
+// returning a non zero status.
+var ERR_UPGRADE_MEMORY           = errors.New("*ERROR* the memory doesn't fit the new version of the contract")
+var ERR_MIGRATE_SIGNATURE        = errors.New("*ERROR* invalid migrate function signature")
+var ERR_MIGRATION_FAILED         = errors.New("*ERROR* the migration failed")
+// ERR_IMMUTABLE_GLOBAL is returned by (Global).Set for a global which
+// isn't mutable.
+var ERR_IMMUTABLE_GLOBAL         = errors.New("*ERROR* the global is immutable")
+// ERR_STORE_DEFINITION is returned by the Store for a field it already
+// defines or invalid limits, ERR_STORE_IMPORT by Module.InstantiateIn for
+// an import not matching the definition of the store, ERR_STORE_CLOSED
+// once the store is closed, and ERR_STORE_INSTANCE by Instance.Clone for
+// an instance of a store.
+var ERR_STORE_DEFINITION         = errors.New("*ERROR* invalid or duplicate definition in the store")
+var ERR_STORE_IMPORT             = errors.New("*ERROR* the import doesn't match its definition in the store")
+var ERR_STORE_CLOSED             = errors.New("*ERROR* the store is closed")
+var ERR_STORE_INSTANCE           = errors.New("*ERROR* the instance shares the state of a store")
+// ERR_BATCH_ABORTED is the error of the calls of a batch following a call
+// which failed, see (*Instance).CallBatch.
+var ERR_BATCH_ABORTED            = errors.New("*ERROR* the call wasn't run, a previous call of the batch failed")
@@ -0,0 +1,137 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestHostExceptions(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/exception-host.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.VerifyModule(module); err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tags imported from "env" must be registered
+	if _, err := compiled.Instantiate(nil); err != ERR_FIND_VM_TAG {
+		t.Fatalf("Instantiate without the tag: got=%v, want=%v", err, ERR_FIND_VM_TAG)
+	}
+	imports := NewEnvFunc()
+	imports.RegisterTag("host_error", NewTag(wasm.ValueTypeI64))
+	if _, err := compiled.Instantiate(imports); err != ERR_FIND_VM_TAG {
+		t.Fatalf("Instantiate with a mismatched tag: got=%v, want=%v", err, ERR_FIND_VM_TAG)
+	}
+
+	hostError := NewTag(wasm.ValueTypeI32)
+	var thrown *Tag
+	imports = NewEnvFunc()
+	imports.RegisterTag("host_error", hostError)
+	imports.Register("raise", func(vm *VM) (bool, error) {
+		vm.Throw(thrown, 8)
+		return true, nil
+	})
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+
+	if tag, ok := inst.ExportedTag("host_error"); !ok || tag != hostError {
+		t.Errorf("ExportedTag(host_error): got=%p, want=%p", tag, hostError)
+	}
+	local, ok := inst.ExportedTag("local")
+	if !ok {
+		t.Fatal("ExportedTag(local): not found")
+	}
+	if _, ok := inst.ExportedTag("catch-host"); ok {
+		t.Error("ExportedTag(catch-host): found a function")
+	}
+
+	// the exceptions trap the VM like the other errors
+	call := func(name string) (res interface{}, r interface{}) {
+		defer func() {
+			if r == nil {
+				r = recover()
+			}
+		}()
+		res, err := vm.ExecCode(int64(module.Export.Entries[name].Index))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return res, nil
+	}
+
+	// the exceptions of the host functions are caught by the tag
+	for _, tc := range []struct {
+		name string
+		tag  *Tag
+	}{
+		{"catch-host", hostError},
+		{"catch-local", local},
+	} {
+		thrown = tc.tag
+		if res, r := call(tc.name); r != nil || res != uint32(8) {
+			t.Errorf("%s: got=%v, %v, want=8", tc.name, res, r)
+		}
+	}
+	thrown = local
+	if _, r := call("catch-host"); TrapCodeOf(r) != TrapUncaughtException {
+		t.Errorf("catch-host with another tag: got=%v, want an uncaught exception", r)
+	}
+
+	// the uncaught exceptions of the module are returned to the host
+	for _, tc := range []struct {
+		name  string
+		tag   *Tag
+		value uint64
+	}{
+		{"throw-host", hostError, 5},
+		{"throw-local", local, 6},
+	} {
+		_, r := call(tc.name)
+		exc, ok := trapValue(r).(*Exception)
+		if !ok {
+			t.Fatalf("%s: unexpected trap: %v", tc.name, r)
+		}
+		if exc.Tag != tc.tag || len(exc.Values) != 1 || exc.Values[0] != tc.value {
+			t.Errorf("%s: got=%+v, want the value %d", tc.name, exc, tc.value)
+		}
+	}
+
+	// the tags are created for every instance
+	clone, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clone.Close()
+	if tag, _ := clone.ExportedTag("local"); tag == local {
+		t.Error("ExportedTag(local): shared between instances")
+	}
+}
@@ -269,6 +269,13 @@ func panics(fn func()) (panicked bool, msg string) {
 	defer func() {
 		r := recover()
 		panicked = r != nil
+		if trap, ok := r.(*exec.TrapError); ok {
+			r = trap.Err
+		}
+		// the spec tests only know the bare out of bounds trap message
+		if _, ok := r.(*exec.MemoryAccessError); ok {
+			r = exec.ErrOutOfBoundsMemoryAccess
+		}
 		msg = fmt.Sprint(r)
 	}()
 
@@ -276,7 +283,16 @@ func panics(fn func()) (panicked bool, msg string) {
 	return
 }
 
-func runTest(fileName string, testCases []testCase, t testing.TB) {
+// vmFactory creates the VM running the tests of a module.
+type vmFactory func(module *wasm.Module) (*exec.VM, error)
+
+func withConfig(config exec.VMConfig) vmFactory {
+	return func(module *wasm.Module) (*exec.VM, error) {
+		return exec.NewVMWithConfig(module, config)
+	}
+}
+
+func runTest(fileName string, testCases []testCase, newVM vmFactory, t testing.TB) {
 	file, err := os.Open(fileName)
 	if err != nil {
 		t.Fatal(err)
@@ -291,7 +307,7 @@ func runTest(fileName string, testCases []testCase, t testing.TB) {
 		t.Fatalf("%s: %v", fileName, err)
 	}
 
-	vm, err := exec.NewVM(module)
+	vm, err := newVM(module)
 	if err != nil {
 		t.Fatalf("%s: %v", fileName, err)
 	}
@@ -361,7 +377,7 @@ func runTest(fileName string, testCases []testCase, t testing.TB) {
 	}
 }
 
-func testModules(t *testing.T, dir string) {
+func testModules(t *testing.T, dir string, newVM vmFactory) {
 	files := []file{}
 	file, err := os.Open(filepath.Join(dir, "modules.json"))
 	if err != nil {
@@ -383,7 +399,63 @@ func testModules(t *testing.T, dir string) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			runTest(path, testCases, t)
+			runTest(path, testCases, newVM, t)
+		})
+	}
+}
+
+// TestSpecConcurrentInstances runs the tests of each module in several
+// goroutines at once, each against its own instance of a single compiled
+// module. Run it with -race to check instances share no mutable state.
+func TestSpecConcurrentInstances(t *testing.T) {
+	files := []file{}
+	file, err := os.Open(filepath.Join(specTestsDir, "modules.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	err = json.NewDecoder(file).Decode(&files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		fileName := filepath.Join(specTestsDir, file.FileName)
+		testCases := file.Tests
+		t.Run(fileName, func(t *testing.T) {
+			t.Parallel()
+			path, err := filepath.Abs(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			module, err := wasm.ReadModule(f, nil)
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			compiled, err := exec.CompileModule(module, exec.VMConfig{AOT: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			newVM := func(*wasm.Module) (*exec.VM, error) {
+				inst, err := compiled.Instantiate(nil)
+				if err != nil {
+					return nil, err
+				}
+				return inst.NewVM(), nil
+			}
+			for i := 0; i < 4; i++ {
+				t.Run(strconv.Itoa(i), func(t *testing.T) {
+					t.Parallel()
+					runTest(path, testCases, newVM, t)
+				})
+			}
 		})
 	}
 }
@@ -409,15 +481,76 @@ func BenchmarkModules(b *testing.B) {
 			if err != nil {
 				b.Fatal(err)
 			}
-			runTest(path, testCases, b)
+			runTest(path, testCases, exec.NewVM, b)
 		})
 	}
 }
 
 func TestNonSpec(t *testing.T) {
-	testModules(t, nonSpecTestsDir)
+	testModules(t, nonSpecTestsDir, withConfig(exec.VMConfig{}))
 }
 
 func TestSpec(t *testing.T) {
-	testModules(t, specTestsDir)
+	testModules(t, specTestsDir, withConfig(exec.VMConfig{}))
+}
+
+func TestSpecStaticMemoryBounds(t *testing.T) {
+	testModules(t, specTestsDir, withConfig(exec.VMConfig{StaticMemoryBounds: true}))
+}
+
+func TestSpecMappedMemory(t *testing.T) {
+	testModules(t, specTestsDir, withConfig(exec.VMConfig{MappedMemory: true}))
+	testModules(t, specTestsDir, withConfig(exec.VMConfig{MappedMemory: true, AOT: true}))
+}
+
+func TestSpecGas(t *testing.T) {
+	for _, config := range []exec.VMConfig{{AOT: true}, {AOT: true, BlockMetering: true, InlineThreshold: 16}} {
+		config := config
+		newVM := func(module *wasm.Module) (*exec.VM, error) {
+			vm, err := exec.NewVMWithConfig(module, config)
+			if err != nil {
+				return nil, err
+			}
+			vm.SetGasMeter(exec.NewGasMeter(math.MaxUint64), exec.DefaultGasSchedule())
+			return vm, nil
+		}
+		testModules(t, specTestsDir, newVM)
+		testModules(t, nonSpecTestsDir, newVM)
+	}
+	// block metered modules run without a meter
+	testModules(t, specTestsDir, compileSerialized(exec.VMConfig{AOT: true, BlockMetering: true}))
+}
+
+func TestSpecAOT(t *testing.T) {
+	testModules(t, specTestsDir, withConfig(exec.VMConfig{AOT: true}))
+	testModules(t, nonSpecTestsDir, withConfig(exec.VMConfig{AOT: true}))
+}
+
+func TestSpecInline(t *testing.T) {
+	testModules(t, specTestsDir, withConfig(exec.VMConfig{InlineThreshold: 16}))
+	testModules(t, nonSpecTestsDir, withConfig(exec.VMConfig{InlineThreshold: 16}))
+}
+
+// compileSerialized creates VMs from modules that went through a
+// serialization round trip.
+func compileSerialized(config exec.VMConfig) vmFactory {
+	return func(module *wasm.Module) (*exec.VM, error) {
+		compiled, err := exec.CompileModule(module, config)
+		if err != nil {
+			return nil, err
+		}
+		data, err := compiled.CompileSerialize()
+		if err != nil {
+			return nil, err
+		}
+		if compiled, err = exec.DeserializeCompiled(data, module); err != nil {
+			return nil, err
+		}
+		return exec.NewVMFromModule(compiled)
+	}
+}
+
+func TestSpecCompileSerialize(t *testing.T) {
+	testModules(t, specTestsDir, compileSerialized(exec.VMConfig{}))
+	testModules(t, specTestsDir, compileSerialized(exec.VMConfig{AOT: true, InlineThreshold: 16}))
 }
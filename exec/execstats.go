@@ -0,0 +1,111 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+// ExecStats are the statistics of a call of a VM, including its nested
+// calls, for instance to report them in a receipt or to tune the limits
+// of the calls, see (*VM).CollectStats.
+type ExecStats struct {
+	// Instructions is the number of instructions of the module run by the
+	// interpreter, the instructions inlined into a function being counted
+	// once, at their call.
+	Instructions uint64
+	// GasUsed is the gas consumed by the call, see (*VM).GasUsed.
+	GasUsed uint64
+	// MaxStackDepth is the largest number of values held by the operand
+	// stacks of the frames of the call at once, and MaxCallDepth the
+	// largest number of its frames, host functions included.
+	MaxStackDepth int
+	MaxCallDepth  int
+	// MemoryPeak is the size in bytes of the memory of the instance at the
+	// end of the call, which a call can only grow.
+	MemoryPeak uint64
+	// HostCalls is the number of host functions called.
+	HostCalls uint64
+}
+
+// execStats collects the ExecStats of the current call of a VM.
+type execStats struct {
+	ExecStats
+	// the call depth of the VM before the call, and the number of
+	// callers whose stacks hold callerValues values
+	baseDepth    int
+	callers      int
+	callerValues int
+}
+
+// CollectStats sets whether the statistics of the following calls of vm
+// are collected, returned by Stats once each call is done. Functions
+// compiled to native code are interpreted while they are collected.
+func (vm *VM) CollectStats(enable bool) {
+	if !enable {
+		vm.stats = nil
+	} else if vm.stats == nil {
+		vm.stats = &execStats{}
+	}
+	vm.setHooked()
+}
+
+// Stats returns the statistics of the last call of vm, if they were
+// collected, see CollectStats. The statistics of a call in progress are
+// the ones so far, but its gas and memory.
+func (vm *VM) Stats() ExecStats {
+	if vm.stats == nil {
+		return ExecStats{}
+	}
+	return vm.stats.ExecStats
+}
+
+// ExecCodeStats calls the function with the given index like ExecCode,
+// and returns the statistics of the call along with its result.
+func (vm *VM) ExecCodeStats(fnIndex int64, args ...uint64) (interface{}, ExecStats, error) {
+	if vm.stats == nil {
+		vm.CollectStats(true)
+		defer vm.CollectStats(false)
+	}
+	res, err := vm.ExecCode(fnIndex, args...)
+	return res, vm.Stats(), err
+}
+
+// begin resets s for a new outermost call of vm.
+func (s *execStats) begin(vm *VM) {
+	*s = execStats{baseDepth: vm.depth, callers: len(vm.frames)}
+}
+
+// end records the gas and memory of the call of vm once it is done.
+func (s *execStats) end(vm *VM) {
+	s.GasUsed = vm.gasUsed
+	s.MemoryPeak = uint64(len(vm.memory))
+}
+
+// observe records the depths of the stacks of the call of vm.
+func (s *execStats) observe(vm *VM) {
+	if depth := vm.depth - s.baseDepth; depth > s.MaxCallDepth {
+		s.MaxCallDepth = depth
+	}
+	// the values of the callers only change with the frames
+	if len(vm.frames) != s.callers {
+		s.callers, s.callerValues = len(vm.frames), 0
+		for i := range vm.frames {
+			s.callerValues += len(vm.frames[i].stack)
+		}
+	}
+	if values := s.callerValues + len(vm.ctx.stack); values > s.MaxStackDepth {
+		s.MaxStackDepth = values
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestExecStats(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/calltrace.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := NewEnvFunc()
+	imports.Register("oracle", func(vm *VM) (bool, error) {
+		vm.SetFuncResult(vm.GetFuncParams()[0] + 1)
+		return true, nil
+	})
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	vm.SetGasMeter(NewGasMeter(1000000), DefaultGasSchedule())
+	run := int64(module.Export.Entries["run"].Index)
+
+	// run calls oracle and twice, which calls double and tail calls it,
+	// each function running 3 instructions
+	res, stats, err := vm.ExecCodeStats(run, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.(uint32) != 16 {
+		t.Errorf("unexpected result: %v", res)
+	}
+	want := ExecStats{
+		Instructions:  12,
+		GasUsed:       vm.GasUsed(),
+		MaxStackDepth: 2,
+		MaxCallDepth:  3,
+		MemoryPeak:    uint64(len(vm.Memory())),
+		HostCalls:     1,
+	}
+	if stats != want || stats.GasUsed == 0 {
+		t.Errorf("got=%+v, want=%+v", stats, want)
+	}
+	// the statistics are only collected for that call
+	if vm.Stats() != (ExecStats{}) {
+		t.Errorf("unexpected statistics: %+v", vm.Stats())
+	}
+
+	vm.CollectStats(true)
+	for i := 0; i < 2; i++ {
+		if _, err := vm.ExecCode(run, 3); err != nil {
+			t.Fatal(err)
+		}
+		if vm.Stats() != want {
+			t.Errorf("got=%+v, want=%+v", vm.Stats(), want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "github.com/bottos-project/bottos/vm/wasm/wasm"
+
+// Export is an export of a module, along with the signature of the
+// function it exports.
+type Export struct {
+	Name string
+	Kind wasm.External
+	// Index is the index of the exported entry in its index space, which
+	// is the index ExecCode takes for a function.
+	Index uint32
+	// Sig is the signature of an exported function, nil for the other
+	// kinds of exports.
+	Sig *wasm.FunctionSig
+}
+
+// Exports returns the exports of m, in the order of the export section.
+func (m *Module) Exports() []Export {
+	entries := m.module.Exports()
+	exports := make([]Export, len(entries))
+	for i, entry := range entries {
+		exports[i] = m.export(entry)
+	}
+	return exports
+}
+
+// Export returns the export of m with the given name, and false if there
+// is none.
+func (m *Module) Export(name string) (Export, bool) {
+	if m.module.Export == nil {
+		return Export{}, false
+	}
+	entry, ok := m.module.Export.Entries[name]
+	if !ok {
+		return Export{}, false
+	}
+	return m.export(entry), true
+}
+
+func (m *Module) export(entry wasm.ExportEntry) Export {
+	export := Export{Name: entry.FieldStr, Kind: entry.Kind, Index: entry.Index}
+	if entry.Kind == wasm.ExternalFunction {
+		if fn := m.module.GetFunction(int(entry.Index)); fn != nil {
+			export.Sig = fn.Sig
+		}
+	}
+	return export
+}
+
+// ExportedFunctions returns the functions exported by the module of inst,
+// in the order of the export section.
+func (inst *Instance) ExportedFunctions() []Export {
+	var funcs []Export
+	for _, export := range inst.compiled.Exports() {
+		if export.Kind == wasm.ExternalFunction {
+			funcs = append(funcs, export)
+		}
+	}
+	return funcs
+}
+
+// ExportedFunction returns the function exported as name by the module of
+// inst, and false if there is no such function.
+func (inst *Instance) ExportedFunction(name string) (Export, bool) {
+	export, ok := inst.compiled.Export(name)
+	if !ok || export.Kind != wasm.ExternalFunction || export.Sig == nil {
+		return Export{}, false
+	}
+	return export, true
+}
+
+// ExportedMemory returns the accessor of the memory exported as name by the
+// module of inst, and false if there is no such memory.
+func (inst *Instance) ExportedMemory(name string) (Memory, bool) {
+	export, ok := inst.compiled.Export(name)
+	if !ok || export.Kind != wasm.ExternalMemory || int(export.Index) >= len(inst.compiled.module.Memories()) {
+		return Memory{}, false
+	}
+	return Memory{inst: inst, index: export.Index}, true
+}
+
+// ExportedTable returns the accessor of the table exported as name by the
+// module of inst, and false if there is no such table.
+func (inst *Instance) ExportedTable(name string) (Table, bool) {
+	export, ok := inst.compiled.Export(name)
+	if !ok || export.Kind != wasm.ExternalTable || int(export.Index) >= len(inst.compiled.module.Tables()) {
+		return Table{}, false
+	}
+	return Table{inst: inst, index: int(export.Index)}, true
+}
+
+// ExportedGlobal returns the accessor of the global exported as name by the
+// module of inst, and false if there is no such global.
+func (inst *Instance) ExportedGlobal(name string) (Global, bool) {
+	export, ok := inst.compiled.Export(name)
+	if !ok || export.Kind != wasm.ExternalGlobal || int(export.Index) >= len(inst.compiled.module.GlobalIndexSpace) {
+		return Global{}, false
+	}
+	return Global{inst: inst, index: int(export.Index)}, true
+}
@@ -0,0 +1,131 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExportedHandles(t *testing.T) {
+	module := readTestModule(t, "testdata/exports.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(name string, args ...interface{}) uint32 {
+		res, err := inst.Call(name, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res[0].(uint32)
+	}
+
+	// the second memory, grown by the host and written to
+	scratch, ok := inst.ExportedMemory("scratch")
+	if !ok || scratch.Pages() != 1 {
+		t.Fatalf("scratch: %v, %d pages", ok, scratch.Pages())
+	}
+	if prev, ok := scratch.Grow(1); !ok || prev != 1 || call("size") != 2 {
+		t.Errorf("grow: got=%d, %v, size %d", prev, ok, call("size"))
+	}
+	if _, ok := scratch.Grow(1); ok {
+		t.Error("grew past the maximum")
+	}
+	if err := scratch.WriteUint32(wasmPageSize+8, 0xcafe); err != nil {
+		t.Fatal(err)
+	}
+	if v := call("load", wasmPageSize+8); v != 0xcafe {
+		t.Errorf("load: got=%#x", v)
+	}
+	if mem, ok := inst.ExportedMemory("mem"); !ok || mem.Size() != wasmPageSize || len(inst.Memory()) != wasmPageSize {
+		t.Errorf("mem: %v, size %d", ok, mem.Size())
+	}
+
+	// the globals
+	counter, ok := inst.ExportedGlobal("counter")
+	if !ok {
+		t.Fatal("no counter")
+	}
+	if err := counter.Set(41); err != nil {
+		t.Fatal(err)
+	}
+	if v := call("bump"); v != 42 {
+		t.Errorf("bump: got=%d", v)
+	}
+	if v, err := counter.Get(); err != nil || v != uint32(42) {
+		t.Errorf("counter: got=%v, %v", v, err)
+	}
+	if err := counter.Set(1.5); err == nil {
+		t.Error("set a float to an i32 global")
+	}
+	version, _ := inst.ExportedGlobal("version")
+	if v, err := version.Get(); err != nil || v != uint64(3) || version.Type().Mutable {
+		t.Errorf("version: got=%v, %v", v, err)
+	}
+	if err := version.Set(4); err != ERR_IMMUTABLE_GLOBAL {
+		t.Errorf("set version: %v", err)
+	}
+
+	// the table
+	funcs, ok := inst.ExportedTable("funcs")
+	if !ok {
+		t.Fatal("no funcs")
+	}
+	if prev, ok := funcs.Grow(1, TableElement{Func: 0}); !ok || prev != 1 || call("dispatch", 1) != 43 {
+		t.Errorf("grow: got=%d, %v", prev, ok)
+	}
+	if _, ok := funcs.Grow(2, TableElement{Null: true}); ok {
+		t.Error("grew past the maximum")
+	}
+	if err := funcs.Set(0, TableElement{Func: 9}); err != InvalidFunctionIndexError(9) {
+		t.Errorf("set: %v", err)
+	}
+	if err := funcs.Set(0, TableElement{Null: true}); err != nil {
+		t.Fatal(err)
+	}
+	trapped := func() (err error) {
+		defer func() { err, _ = recover().(error) }()
+		inst.Call("dispatch", 0)
+		return nil
+	}()
+	if trapped == nil {
+		t.Error("called a null element")
+	}
+
+	for _, name := range []string{"bump", "missing"} {
+		if _, ok := inst.ExportedGlobal(name); ok {
+			t.Errorf("global %s", name)
+		}
+	}
+
+	// the handles fail once the instance is closed
+	inst.Close()
+	if _, err := counter.Get(); err != ERR_INSTANCE_CLOSED {
+		t.Errorf("closed counter: %v", err)
+	}
+	if _, err := scratch.ReadUint32(0); !errors.Is(err, ErrOutOfBoundsMemoryAccess) {
+		t.Errorf("closed scratch: %v", err)
+	}
+	if _, ok := scratch.Grow(0); ok || funcs.Len() != 0 {
+		t.Error("closed handles still access the instance")
+	}
+}
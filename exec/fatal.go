@@ -0,0 +1,143 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/bottos-project/bottos/vm/wasm/demangle"
+)
+
+// FatalVMError is returned by (*VM).ExecCode when the interpreter or a
+// host function panics by itself, for instance on an index out of range,
+// instead of trapping the VM. Such a panic is a bug, which is reported as
+// an error rather than crashing the node.
+type FatalVMError struct {
+	// Func is the index of the function the call was running, Offset the
+	// offset in its compiled code past the instruction that panicked, and
+	// CodeOffset the offset of the instruction in the module, see
+	// (*Module).CodeOffset, or zero if it is unknown, like in a host
+	// function.
+	Func       int64
+	Offset     int64
+	CodeOffset int64
+	// Name is the name of the function in the name section, if any, and
+	// Source the source line of the instruction, like lib.rs:142, if the
+	// module has line information, see (*Module).SourceLine.
+	Name   string
+	Source string
+	// Value is the value the call panicked with, and Stack the stack trace
+	// of the panic.
+	Value interface{}
+	Stack []byte
+}
+
+func (e *FatalVMError) Error() string {
+	return fmt.Sprintf("exec: fatal error in %s at offset %d%s: %v", describeFunc(e.Func, e.Name), e.Offset, describeSource(e.Source), e.Value)
+}
+
+func (e *FatalVMError) TrapCode() TrapCode {
+	return TrapFatal
+}
+
+// Unwrap returns the value the call panicked with, if it is an error.
+func (e *FatalVMError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// funcName returns the name of the function of vm with the given index in
+// the name section, if any.
+func (vm *VM) funcName(index int64) string {
+	if index < 0 || int(index) >= len(vm.module.FunctionIndexSpace) {
+		return ""
+	}
+	return vm.module.FunctionIndexSpace[index].Name
+}
+
+// describeFunc returns the function with the given index and name, for
+// the error messages, its name being demangled.
+func describeFunc(index int64, name string) string {
+	if name != "" {
+		return fmt.Sprintf("function %d (%s)", index, demangle.Demangle(name))
+	}
+	return fmt.Sprintf("function %d", index)
+}
+
+// describeSource returns the source line of an instruction, for the error
+// messages.
+func describeSource(source string) string {
+	if source != "" {
+		return " (" + source + ")"
+	}
+	return ""
+}
+
+// recoverCall ends a call started by ExecCodeRaw or Resume whose outermost
+// caller frame is frames[base]: a paused call returns ErrPaused, and a
+// panic which doesn't trap the VM returns a FatalVMError in err. Traps
+// keep unwinding, as a TrapError. It must be deferred by the functions
+// starting a call.
+func (vm *VM) recoverCall(base int, err *error) {
+	atomic.StoreUint32(&vm.pausing, 0)
+	r := recover()
+	switch {
+	case r == nil:
+	case r == errPause:
+		vm.capturePause(base)
+		*err = ErrPaused
+	case isTrap(r):
+		err := vm.trapError(r.(error))
+		if sink := vm.config.Metrics; sink != nil && vm.activeCalls == 1 {
+			sink.Count(MetricTraps, TrapCodeOf(err).String(), 1)
+		}
+		panic(err)
+	default:
+		fatal := &FatalVMError{
+			Func:   vm.ctx.curFunc,
+			Offset: vm.ctx.pc,
+			Name:   vm.funcName(vm.ctx.curFunc),
+			Source: vm.sourceLine(vm.ctx.curFunc, vm.ctx.pc-1),
+			Value:  r,
+			Stack:  debug.Stack(),
+		}
+		fatal.CodeOffset, _ = vm.compiled.CodeOffset(vm.ctx.curFunc, vm.ctx.pc-1)
+		vm.logger().Errorf("VM: %v\n%s", fatal, fatal.Stack)
+		if sink := vm.config.Metrics; sink != nil && vm.activeCalls == 1 {
+			sink.Count(MetricTraps, TrapFatal.String(), 1)
+		}
+		*err = fatal
+	}
+}
+
+// isTrap returns whether the panic value r traps the VM, as opposed to a
+// panic of the interpreter or a host function.
+func isTrap(r interface{}) bool {
+	err, ok := r.(error)
+	if !ok {
+		return false
+	}
+	if _, ok := err.(runtime.Error); ok {
+		// the integer divisions are left to the runtime to trap
+		return err.Error() == "runtime error: integer divide by zero"
+	}
+	return true
+}
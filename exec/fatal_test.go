@@ -0,0 +1,121 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/log"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// testLogger records the messages logged at the error level or above.
+type testLogger struct {
+	errors []string
+}
+
+func (l *testLogger) Enabled(level log.Level) bool { return level >= log.LevelError }
+
+func (l *testLogger) Log(level log.Level, msg string) {
+	l.errors = append(l.errors, msg)
+}
+
+func TestFatalVMError(t *testing.T) {
+	code, err := InstrumentGas(readTestCode(t, "testdata/spec/fac.wasm"), DefaultGasSchedule())
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, err := wasm.ReadModule(bytes.NewReader(code), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := &testLogger{}
+	compiled, err := CompileModule(module, VMConfig{Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	facIter := int64(module.Export.Entries["fac-iter"].Index)
+
+	var fault func()
+	imports := NewEnvFunc()
+	imports.envFuncMap[GAS_FUNCTION] = func(vm *VM) (bool, error) {
+		if fault != nil {
+			fault()
+		}
+		return true, nil
+	}
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+
+	for _, f := range []func(){
+		func() {
+			var values []uint64
+			_ = values[len(vm.Memory())]
+		},
+		func() { panic("host function failed") },
+	} {
+		fault = f
+		_, err = vm.ExecCode(facIter, 20)
+		fatal, ok := err.(*FatalVMError)
+		if !ok {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// the host function is the first function of the module, which has
+		// no code
+		if fatal.Func != 0 || fatal.CodeOffset != 0 || len(fatal.Stack) == 0 {
+			t.Errorf("unexpected error details: %+v", fatal)
+		}
+		if _, ok := fatal.Value.(runtime.Error); ok != (fatal.Unwrap() != nil) {
+			t.Errorf("unexpected wrapped error: %v", fatal.Unwrap())
+		}
+	}
+	// the fatal errors are logged to the logger of the VM
+	if len(logger.errors) != 2 || !strings.Contains(logger.errors[1], "host function failed") {
+		t.Errorf("unexpected logged errors: %q", logger.errors)
+	}
+
+	// traps still unwind, and the VM is usable afterwards
+	fault = func() { vm.ChargeGas(1) }
+	vm.SetGasMeter(NewGasMeter(0), nil)
+	func() {
+		defer func() {
+			if err := trapValue(recover()); err != ErrOutOfGas {
+				t.Errorf("unexpected trap: %v", err)
+			}
+		}()
+		vm.ExecCode(facIter, 20)
+	}()
+	fault = nil
+	vm.SetGasMeter(nil, nil)
+	if _, err = vm.ExecCode(facIter, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	// the name of the function is demangled in the message
+	fatal := &FatalVMError{Func: 2, Offset: 7, Name: "_ZN4core3fmt5write17h0f3ba4b6a1b4c6d2E", Value: "fault"}
+	if want := "exec: fatal error in function 2 (core::fmt::write) at offset 7: fault"; fatal.Error() != want {
+		t.Errorf("got=%q, want=%q", fatal.Error(), want)
+	}
+}
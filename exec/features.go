@@ -0,0 +1,87 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// implementedFeatures are the target features, named like in the
+// target_features section, of the proposals the VM implements.
+var implementedFeatures = []string{
+	"atomics", "bulk-memory", "exception-handling", "extended-const", "gc",
+	"memory64", "multimemory", "multivalue", "mutable-globals",
+	"reference-types", "relaxed-simd", "simd128", "tail-call",
+}
+
+// UnsupportedFeatureError is returned by CheckTargetFeatures for a target
+// feature a module uses, which the VM doesn't enable.
+type UnsupportedFeatureError string
+
+func (e UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("exec: target feature %q is not enabled", string(e))
+}
+
+// EnabledFeatures returns the target features enabled by config, sorted:
+// the ones of the proposals the VM implements, less the ones config
+// disables, such as relaxed-simd unless config.RelaxedSIMD is set.
+func EnabledFeatures(config VMConfig) []string {
+	disabled := map[string]bool{"relaxed-simd": !config.RelaxedSIMD}
+	if config.Policy != nil {
+		if config.Policy.NoSIMD {
+			disabled["simd128"], disabled["relaxed-simd"] = true, true
+		}
+		if config.Policy.NoThreads {
+			disabled["atomics"] = true
+		}
+	}
+	var features []string
+	for _, feature := range implementedFeatures {
+		if !disabled[feature] {
+			features = append(features, feature)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+// CheckTargetFeatures checks that the features the target_features section
+// of module says it uses, or requires, are enabled by config, so that a
+// module built for features the VM lacks is rejected before it is
+// compiled. It returns an UnsupportedFeatureError for the first feature
+// which isn't, or the error reading the section. The modules without the
+// section pass.
+func CheckTargetFeatures(module *wasm.Module, config VMConfig) error {
+	features, err := module.TargetFeatures()
+	if err != nil {
+		return err
+	}
+	enabled := make(map[string]bool)
+	for _, feature := range EnabledFeatures(config) {
+		enabled[feature] = true
+	}
+	for _, feature := range features {
+		if feature.Prefix != wasm.FeatureDisallowed && !enabled[feature.Name] {
+			return UnsupportedFeatureError(feature.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestCheckTargetFeatures(t *testing.T) {
+	module := &wasm.Module{}
+	if err := CheckTargetFeatures(module, VMConfig{}); err != nil {
+		t.Errorf("no section: %v", err)
+	}
+	module.AddCustomSection("target_features", []byte("\x03+\x07simd128+\x07atomics-\x08sign-ext"))
+	for _, tc := range []struct {
+		config VMConfig
+		err    error
+	}{
+		{VMConfig{}, nil},
+		{VMConfig{Policy: &validate.Policy{NoSIMD: true}}, UnsupportedFeatureError("simd128")},
+		{VMConfig{Policy: &validate.Policy{NoThreads: true}}, UnsupportedFeatureError("atomics")},
+	} {
+		if err := CheckTargetFeatures(module, tc.config); err != tc.err {
+			t.Errorf("%+v: got=%v, want=%v", tc.config, err, tc.err)
+		}
+	}
+
+	module.SetCustomSection("target_features", []byte("\x01=\x0crelaxed-simd"))
+	if err := CheckTargetFeatures(module, VMConfig{}); err != UnsupportedFeatureError("relaxed-simd") {
+		t.Errorf("got=%v", err)
+	}
+	if err := CheckTargetFeatures(module, VMConfig{RelaxedSIMD: true}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteFolded writes the samples of s to w as folded stacks, the input of
+// flamegraph.pl and most flame graph tools: a line per distinct call
+// stack, its frames from the outermost one separated by semicolons,
+// followed by the number of times it was sampled. The frames are named
+// like by WriteProfile, the host functions the calls nested in them run
+// from being marked by a [host] suffix.
+func (s *Sampler) WriteFolded(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, key := range s.keys {
+		sample := s.samples[key]
+		names := s.frameNames(sample)
+		fmt.Fprintf(bw, "%s %d\n", strings.Join(names, ";"), sample.count)
+	}
+	return bw.Flush()
+}
+
+// frameNames returns the names of the frames of sample, from the
+// outermost one.
+func (s *Sampler) frameNames(sample *stackSample) []string {
+	names := make([]string, len(sample.frames))
+	for i, frame := range sample.frames {
+		// the separators of the folded stacks can't be part of a name
+		name := strings.Replace(s.vm.frameName(frame.fn), ";", ":", -1)
+		names[len(names)-1-i] = name
+	}
+	return names
+}
+
+// flameNode is a frame of a flame graph, and the frames it called.
+type flameNode struct {
+	name     string
+	count    int64
+	children map[string]*flameNode
+}
+
+func (n *flameNode) child(name string) *flameNode {
+	c := n.children[name]
+	if c == nil {
+		c = &flameNode{name: name, children: make(map[string]*flameNode)}
+		n.children[name] = c
+	}
+	return c
+}
+
+// The layout of the flame graphs, in pixels.
+const (
+	flameWidth       = 1200
+	flameFrameHeight = 16
+	flameMargin      = 10
+	flameCharWidth   = 7 // the width of a character of the 12px font
+)
+
+// WriteFlameGraph writes the samples of s to w as an SVG flame graph
+// with the given title: a frame is as wide as the number of samples it
+// appears in, and its callees are stacked above it, in alphabetical
+// order. Hovering a frame shows its name and samples. The host functions
+// are colored apart from the functions of the module.
+func (s *Sampler) WriteFlameGraph(w io.Writer, title string) error {
+	root := &flameNode{name: "all", children: make(map[string]*flameNode)}
+	depth := 0
+	for _, key := range s.keys {
+		sample := s.samples[key]
+		root.count += sample.count
+		node := root
+		for _, name := range s.frameNames(sample) {
+			node = node.child(name)
+			node.count += sample.count
+		}
+		if len(sample.frames) > depth {
+			depth = len(sample.frames)
+		}
+	}
+
+	height := (depth+1)*flameFrameHeight + 3*flameMargin + flameFrameHeight
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" standalone="no"?>`+"\n")
+	fmt.Fprintf(bw, `<svg version="1.1" width="%d" height="%d" xmlns="http://www.w3.org/2000/svg" font-family="Verdana" font-size="12">`+"\n",
+		flameWidth, height)
+	fmt.Fprintf(bw, `<rect x="0" y="0" width="%d" height="%d" fill="#eeeeee"/>`+"\n", flameWidth, height)
+	fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle" font-size="17">%s</text>`+"\n",
+		flameWidth/2, 2*flameMargin, html.EscapeString(title))
+	if root.count != 0 {
+		scale := float64(flameWidth-2*flameMargin) / float64(root.count)
+		bottom := height - flameMargin - flameFrameHeight
+		writeFlameNode(bw, root, root.count, flameMargin, bottom, scale)
+	}
+	fmt.Fprintf(bw, "</svg>\n")
+	return bw.Flush()
+}
+
+// writeFlameNode writes the frame n at x, y, and its callees above it.
+func writeFlameNode(w *bufio.Writer, n *flameNode, total int64, x float64, y int, scale float64) {
+	width := float64(n.count) * scale
+	fmt.Fprintf(w, `<g><title>%s (%d samples, %.2f%%)</title>`, html.EscapeString(n.name), n.count, 100*float64(n.count)/float64(total))
+	fmt.Fprintf(w, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s" rx="2" ry="2"/>`,
+		x, y, width, flameFrameHeight-1, flameColor(n.name))
+	if chars := int(width) / flameCharWidth; chars >= 3 {
+		label := n.name
+		if len(label) > chars {
+			label = label[:chars-2] + ".."
+		}
+		fmt.Fprintf(w, `<text x="%.1f" y="%d">%s</text>`, x+3, y+flameFrameHeight-4, html.EscapeString(label))
+	}
+	fmt.Fprintf(w, "</g>\n")
+
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := n.children[name]
+		writeFlameNode(w, child, total, x, y-flameFrameHeight, scale)
+		x += float64(child.count) * scale
+	}
+}
+
+// flameColor returns the color of the frames with the given name: a warm
+// color derived from the name, or a blue one for a host function.
+func flameColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	if strings.HasSuffix(name, " [host]") {
+		return fmt.Sprintf("rgb(%d,%d,230)", 80+v%50, 130+v>>8%60)
+	}
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+v%50, 80+v>>8%150, v>>16%55)
+}
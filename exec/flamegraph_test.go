@@ -0,0 +1,73 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlameGraph(t *testing.T) {
+	inst, module := newSpinInstance(t)
+	defer inst.Close()
+	vm := inst.NewVM()
+	nested := int64(module.Export.Entries["nested"].Index)
+	s := vm.StartSampling(time.Millisecond)
+	for i := 0; i < 1000 && s.Samples() < 5; i++ {
+		if _, err := vm.ExecCode(nested, 100000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Stop()
+
+	// run is called by the host function back, called by nested
+	var buf bytes.Buffer
+	if err := s.WriteFolded(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	var total int64
+	for _, line := range lines {
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 || line[:i] != "function 3;back [host];function 2;function 1" {
+			t.Fatalf("unexpected folded stacks:\n%s", &buf)
+		}
+		count, err := strconv.ParseInt(line[i+1:], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += count
+	}
+	if total != s.Samples() {
+		t.Errorf("got=%d samples, want=%d", total, s.Samples())
+	}
+
+	buf.Reset()
+	if err := s.WriteFlameGraph(&buf, "spin <test>"); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	for _, want := range []string{"<svg ", "spin &lt;test&gt;", "<title>back [host] (", "<title>function 1 (", "</svg>\n"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("missing %q in\n%s", want, svg)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "bytes"
+
+// forkPageSize is the granularity at which Promote compares the memories
+// of a fork with the ones of the instance it was forked from.
+const forkPageSize = 4096
+
+// Fork returns a fork of inst: a copy of its state, like Clone, to run
+// speculative calls against, such as fee estimations or transactions
+// scheduled in parallel. The fork is discarded by closing it, or its
+// state becomes the one of inst with Promote, which only writes back the
+// pages of its memories which changed. inst must not be called, reset
+// or restored until then for the fork to be promoted, though it can be
+// forked again, and the forks of the same state promoted one after the
+// other. The memories of the fork are copied eagerly rather than paged
+// in on write, so forking costs a copy of them. The memory of inst
+// can't be shared, see Spawn.
+func (inst *Instance) Fork() (*Instance, error) {
+	if inst.shared != nil {
+		return nil, ERR_MEMORY_SHARED
+	}
+	fork, err := inst.Clone()
+	if err != nil {
+		return nil, err
+	}
+	fork.forkOf, fork.forkGeneration = inst, inst.generation
+	return fork, nil
+}
+
+// Promote makes the state of the fork inst the state of the instance it
+// was forked from: the pages of its memories which differ are copied to
+// the instance, whose memories grow or shrink to their size in inst, and
+// its tables, globals, segments and references replace the ones of the
+// instance. inst stays a fork of the instance, in sync with it, so it can
+// go on and be promoted again. It returns ERR_NOT_FORK if inst isn't a
+// fork, ERR_FORK_STALE, leaving the instance unchanged, if the instance
+// was called, reset or restored since inst was forked or last promoted,
+// and ERR_RESOURCE_LIMIT if a memory of the instance fails to grow, which
+// leaves it partially promoted.
+func (inst *Instance) Promote() error {
+	base := inst.forkOf
+	switch {
+	case inst.closed:
+		return ERR_INSTANCE_CLOSED
+	case base == nil:
+		return ERR_NOT_FORK
+	case base.closed:
+		return ERR_INSTANCE_CLOSED
+	case base.generation != inst.forkGeneration:
+		return ERR_FORK_STALE
+	}
+
+	base.generation++
+	for i := 0; i <= len(inst.memories); i++ {
+		inst.swapMemory(uint32(i))
+		base.swapMemory(uint32(i))
+		ok := base.promoteMemory(inst.memory)
+		base.swapMemory(uint32(i))
+		inst.swapMemory(uint32(i))
+		if !ok {
+			return ERR_RESOURCE_LIMIT
+		}
+	}
+	base.tables = make([][]uint32, len(inst.tables))
+	for i, elems := range inst.tables {
+		base.tables[i] = append([]uint32(nil), elems...)
+	}
+	base.resetCallSites()
+	copy(base.globals, inst.globals)
+	base.externs = append(base.externs[:0], inst.externs...)
+	base.freeHandles = append(base.freeHandles[:0], inst.freeHandles...)
+	base.allocated, base.liveObjects = inst.allocated, inst.liveObjects
+	base.copyObjects()
+	copy(base.dataSegments, inst.dataSegments)
+	copy(base.elemSegments, inst.elemSegments)
+	base.memPos = inst.memPos
+	base.memType = make(map[uint64]*typeInfo, len(inst.memType))
+	for addr, info := range inst.memType {
+		copied := *info
+		base.memType[addr] = &copied
+	}
+	base.reportMemory()
+	inst.forkGeneration = base.generation
+	return nil
+}
+
+// promoteMemory brings the memory of inst to the size of memory, and
+// copies the pages of memory which differ from the ones of inst. It
+// returns false if the memory fails to grow.
+func (inst *Instance) promoteMemory(memory []byte) bool {
+	if len(memory) > len(inst.memory) {
+		if inst.growMemory(uint32((len(memory)-len(inst.memory))/inst.pageSize)) < 0 {
+			return false
+		}
+	} else if len(memory) < len(inst.memory) {
+		inst.memory = inst.memory[:len(memory)]
+		inst.invalidateViews()
+	}
+	for start := 0; start < len(memory); start += forkPageSize {
+		end := start + forkPageSize
+		if end > len(memory) {
+			end = len(memory)
+		}
+		if !bytes.Equal(inst.memory[start:end], memory[start:end]) {
+			copy(inst.memory[start:end], memory[start:end])
+			inst.wrote(uint64(start), uint64(end-start))
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestFork(t *testing.T) {
+	module := readTestModule(t, "testdata/instance-snapshot.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	call := func(inst *Instance, name string, args ...interface{}) interface{} {
+		t.Helper()
+		res, err := inst.Call(name, args...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(res) == 0 {
+			return nil
+		}
+		return res[0]
+	}
+	fork := func() *Instance {
+		t.Helper()
+		fork, err := inst.Fork()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { fork.Close() })
+		return fork
+	}
+
+	call(inst, "bump")
+	if err := inst.Promote(); err != ERR_NOT_FORK {
+		t.Fatalf("promote: got=%v, want=%v", err, ERR_NOT_FORK)
+	}
+
+	// a discarded fork leaves the instance unchanged
+	discarded := fork()
+	call(discarded, "bump")
+	call(discarded, "grow")
+	discarded.Close()
+	if got := call(inst, "load", 16); got != uint32(1) || inst.MemoryPages() != 1 {
+		t.Fatalf("discarded: got=%v, %d pages, want=1, 1 page", got, inst.MemoryPages())
+	}
+
+	// the forks of the same state are promoted one after the other
+	first, second := fork(), fork()
+	call(first, "bump")
+	call(first, "grow")
+	call(first, "growtable")
+	call(first, "init")
+	call(first, "drop")
+	if err := first.Promote(); err != nil {
+		t.Fatal(err)
+	}
+	if got := call(inst, "load", 16); got != uint32(2) {
+		t.Errorf("memory: got=%v, want=2", got)
+	}
+	if got := call(inst, "load", 100); got != uint32(0x6c6c6568) {
+		t.Errorf("segment: got=%#x, want=0x6c6c6568", got)
+	}
+	if got := inst.MemoryPages(); got != 2 {
+		t.Errorf("pages: got=%d, want=2", got)
+	}
+	if got := inst.Tables()[0].Size; got != 3 {
+		t.Errorf("table: got=%d, want=3", got)
+	}
+	// the segment is dropped in the instance
+	for i, segment := range inst.dataSegments {
+		if segment != nil {
+			t.Errorf("segment %d isn't dropped", i)
+		}
+	}
+	// the instance was called since the second fork
+	if err := second.Promote(); err != ERR_FORK_STALE {
+		t.Fatalf("promote: got=%v, want=%v", err, ERR_FORK_STALE)
+	}
+
+	// a promoted fork goes on in sync with the instance
+	next := fork()
+	call(next, "bump")
+	if err := next.Promote(); err != nil {
+		t.Fatal(err)
+	}
+	call(next, "bump")
+	if err := next.Promote(); err != nil {
+		t.Fatal(err)
+	}
+	if got := call(inst, "bump"); got != uint32(5) {
+		t.Errorf("global: got=%v, want=5", got)
+	}
+
+	inst.Close()
+	if err := next.Promote(); err != ERR_INSTANCE_CLOSED {
+		t.Errorf("promote: got=%v, want=%v", err, ERR_INSTANCE_CLOSED)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+// ErrOutOfFuel is the trap raised when a call runs out of fuel.
+var ErrOutOfFuel = newTrap(TrapOutOfFuel, "exec: out of fuel")
+
+// SetFuel limits the number of instructions every following call of vm
+// may run to fuel, the calls trapping with ErrOutOfFuel past it. Zero
+// removes the limit.
+//
+// Unlike gas, fuel doesn't price the instructions: it counts the
+// instructions of the compiled code run by the interpreter, including the
+// ones of nested calls, to bound the execution of queries and tests. It is
+// independent of the gas meter, and functions compiled to native code are
+// interpreted while it is set.
+func (vm *VM) SetFuel(fuel uint64) {
+	vm.fuel, vm.fuelLeft = fuel, fuel
+}
+
+// Fuel returns the fuel of the calls of vm, zero if it is unlimited.
+func (vm *VM) Fuel() uint64 {
+	return vm.fuel
+}
+
+// FuelUsed returns the number of instructions run by the last call of vm,
+// if its fuel was limited.
+func (vm *VM) FuelUsed() uint64 {
+	return vm.fuel - vm.fuelLeft
+}
+
+// consumeFuel consumes the fuel of an instruction, trapping the VM when
+// it runs out of fuel.
+func (vm *VM) consumeFuel() {
+	if vm.fuelLeft == 0 {
+		panic(ErrOutOfFuel)
+	}
+	vm.fuelLeft--
+}
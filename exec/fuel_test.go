@@ -0,0 +1,68 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestFuel(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	facIter := int64(module.Export.Entries["fac-iter"].Index)
+
+	vm, err := NewVMWithConfig(module, VMConfig{AOT: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.SetFuel(1 << 20)
+	if _, err = vm.ExecCode(facIter, 20); err != nil {
+		t.Fatal(err)
+	}
+	used := vm.FuelUsed()
+	if used == 0 {
+		t.Fatal("no fuel used")
+	}
+
+	// the fuel is not shared between calls, and a meter doesn't change it
+	vm.SetGasMeter(NewGasMeter(1<<20), DefaultGasSchedule())
+	vm.SetFuel(used)
+	for i := 0; i < 2; i++ {
+		if _, err = vm.ExecCode(facIter, 20); err != nil {
+			t.Fatal(err)
+		}
+		if vm.FuelUsed() != used {
+			t.Errorf("unexpected fuel used: got=%d, want=%d", vm.FuelUsed(), used)
+		}
+	}
+
+	vm.SetFuel(used - 1)
+	func() {
+		defer func() {
+			if err := trapValue(recover()); err != ErrOutOfFuel {
+				t.Errorf("unexpected trap: %v", err)
+			}
+		}()
+		vm.ExecCode(facIter, 20)
+	}()
+
+	vm.SetFuel(0)
+	if _, err = vm.ExecCode(facIter, 20); err != nil {
+		t.Fatal(err)
+	}
+	if vm.FuelUsed() != 0 {
+		t.Errorf("unexpected fuel used without a limit: %d", vm.FuelUsed())
+	}
+}
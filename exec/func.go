@@ -35,6 +35,7 @@ import (
 	"reflect"
 
 	"github.com/bottos-project/bottos/vm/wasm/exec/internal/compile"
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/native"
 	"github.com/bottos-project/bottos/vm/wasm/wasm"
 )
 
@@ -45,11 +46,18 @@ type function interface {
 type compiledFunction struct {
 	code           []byte //it means the internal call order for a method
 	branchTables   []*compile.BranchTable
-	maxDepth       int           // maximum stack depth reached while executing the function body
-	totalLocalVars int           // number of local variables used by the function
-	args           int           // number of arguments the function accepts
-	returns        bool          // whether the function returns a value
-	funcProp       wasm.Function //record function's properties
+	callSites      []callSiteCache        // inline caches for the call_indirect sites in code
+	native         *native.Code           // code compiled ahead of time, nil if the function is interpreted
+	basicBlocks    [][]byte               // opcodes of the basic blocks of code, see VMConfig.BlockMetering
+	handlers       []compile.Handler      // exception handlers of the try blocks of code, innermost first
+	sourceOffsets  []compile.SourceOffset // the instructions code was compiled from, see (*Module).CodeOffset
+	maxDepth       int                    // maximum stack depth reached while executing the function body
+	totalLocalVars int                    // number of local variables used by the function
+	args           int                    // number of arguments the function accepts
+	returns        bool                   // whether the function returns a value
+	results        int                    // number of values the function returns
+	funcProp       wasm.Function          //record function's properties
+	pending        bool                   // whether the function is left to compile on its first call, see VMConfig.LazyCompile
 }
 
 type goFunction struct {
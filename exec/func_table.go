@@ -196,6 +196,18 @@ func (vm *VM) newFuncTable() {
 
 	vm.funcTable[ops.Drop] = vm.drop
 	vm.funcTable[ops.Select] = vm.selectOp
+	vm.funcTable[ops.SelectTyped] = vm.selectTyped
+
+	vm.funcTable[ops.Throw] = vm.throw
+	vm.funcTable[ops.Rethrow] = vm.rethrow
+
+	vm.funcTable[ops.RefNull] = vm.refNull
+	vm.funcTable[ops.RefIsNull] = vm.refIsNull
+	vm.funcTable[ops.RefFunc] = vm.refFunc
+	vm.funcTable[ops.RefAsNonNull] = vm.refAsNonNull
+	vm.funcTable[ops.RefEq] = vm.refEq
+	vm.funcTable[ops.TableGet] = vm.tableGet
+	vm.funcTable[ops.TableSet] = vm.tableSet
 
 	vm.funcTable[ops.GetLocal] = vm.getLocal
 	vm.funcTable[ops.SetLocal] = vm.setLocal
@@ -208,4 +220,10 @@ func (vm *VM) newFuncTable() {
 
 	vm.funcTable[ops.Call] = vm.call
 	vm.funcTable[ops.CallIndirect] = vm.callIndirect
+	vm.funcTable[ops.CallRef] = vm.callRef
+
+	vm.funcTable[ops.PrefixMisc] = vm.misc
+	vm.funcTable[ops.PrefixSIMD] = vm.simd
+	vm.funcTable[ops.PrefixAtomic] = vm.atomic
+	vm.funcTable[ops.PrefixGC] = vm.gc
 }
@@ -0,0 +1,123 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// fuzzLimits are the decode limits of the modules run by FuzzExec, low
+// enough for a module to be decoded quickly.
+var fuzzLimits = wasm.DecodeLimits{
+	MaxModuleSize:     1 << 20,
+	MaxFunctions:      1 << 10,
+	MaxLocalsPerFunc:  1 << 10,
+	MaxGlobals:        1 << 10,
+	MaxImports:        1 << 10,
+	MaxDataSegments:   1 << 10,
+	MaxBrTableTargets: 1 << 10,
+	MaxNameLength:     1 << 10,
+	MaxTableElements:  1 << 16,
+}
+
+// fuzzLimiter denies the instances of the modules run by FuzzExec more
+// than a few pages of memory and a few thousand table elements.
+type fuzzLimiter struct{}
+
+func (fuzzLimiter) MemoryGrowing(current, desired, maximum uint64) (bool, error) {
+	return desired <= 16*65536, nil
+}
+
+func (fuzzLimiter) TableGrowing(current, desired, maximum uint32) (bool, error) {
+	return desired <= 1<<12, nil
+}
+
+func (fuzzLimiter) InstanceCreating(m *exec.Module) error {
+	return nil
+}
+
+// FuzzExec instantiates the arbitrary modules the decoder and validator
+// accept and calls their exported functions with zero arguments, each
+// call with little gas and fuel. The calls may trap but never panic
+// otherwise.
+func FuzzExec(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.wasm"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range files {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(raw)
+	}
+
+	config := exec.VMConfig{
+		MaxExecutionTime: 100 * time.Millisecond,
+		MaxCallDepth:     100,
+		MaxGrowPages:     16,
+		ResourceLimiter:  fuzzLimiter{},
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := wasm.ReadModuleWithLimits(bytes.NewReader(data), nil, fuzzLimits)
+		if err != nil {
+			return
+		}
+		compiled, err := exec.CompileModule(m, config)
+		if err != nil {
+			return
+		}
+		inst, err := fuzzInstantiate(compiled)
+		if err != nil {
+			return
+		}
+		defer inst.Close()
+		for _, e := range inst.ExportedFunctions() {
+			if e.Sig == nil {
+				continue
+			}
+			vm := inst.NewVM()
+			vm.SetGasMeter(exec.NewGasMeter(10000), exec.DefaultGasSchedule())
+			vm.SetFuel(10000)
+			fuzzCall(vm, int64(e.Index), make([]uint64, disasm.Slots(e.Sig.ParamTypes...)))
+		}
+	})
+}
+
+// fuzzInstantiate instantiates compiled, returning the trap of its start
+// function as an error.
+func fuzzInstantiate(compiled *exec.Module) (inst *exec.Instance, err error) {
+	defer exec.RecoverTrap(&err)
+	return compiled.Instantiate(exec.NewEnvFunc())
+}
+
+// fuzzCall calls the function with the given index on vm, returning its
+// trap as an error.
+func fuzzCall(vm *exec.VM, fnIndex int64, args []uint64) (err error) {
+	defer exec.RecoverTrap(&err)
+	_, err = vm.ExecCode(fnIndex, args...)
+	return err
+}
@@ -0,0 +1,435 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/compile"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// ErrOutOfGas is the error value used while trapping the VM when the gas
+// meter of the VM runs out of gas.
+var ErrOutOfGas = newTrap(TrapOutOfGas, "exec: out of gas")
+
+// GasSchedule is the cost in gas of every operator, indexed by opcode.
+type GasSchedule struct {
+	// Version identifies the schedule, so that a chain can switch to a
+	// new schedule at a given height.
+	Version uint32
+	Costs   [256]uint64
+	// MemoryGrow is the cost of the pages added by memory.grow, charged on
+	// top of the cost of the operator.
+	MemoryGrow MemoryGrowCost
+	// Misc is the cost of the operators prefixed by ops.PrefixMisc, such
+	// as the bulk memory operators, indexed by sub-opcode.
+	Misc [32]uint64
+	// SIMD is the cost of the operators prefixed by ops.PrefixSIMD,
+	// indexed by sub-opcode.
+	SIMD [512]uint64
+	// Atomic is the cost of the operators prefixed by ops.PrefixAtomic,
+	// indexed by sub-opcode.
+	Atomic [128]uint64
+	// GC is the cost of the operators prefixed by ops.PrefixGC, indexed by
+	// sub-opcode.
+	GC [32]uint64
+	// BulkByte is the cost of every byte or table element written by the
+	// bulk memory operators, charged on top of the cost of the operator.
+	BulkByte uint64
+}
+
+// MemoryGrowCost is the cost in gas of the linear memory: a memory of n
+// pages costs PerPage*n + Quadratic*n*n, and growing the memory charges
+// the difference between the costs of its new and previous sizes. The
+// quadratic term makes large memories increasingly expensive.
+type MemoryGrowCost struct {
+	PerPage   uint64 `json:"per_page"`
+	Quadratic uint64 `json:"quadratic"`
+}
+
+// charge returns the cost of growing a memory from previous to current
+// pages, saturating at the largest uint64.
+func (c MemoryGrowCost) charge(previous, current uint64) uint64 {
+	n := current - previous
+	// current*current-previous*previous, which fits in a uint64 for the
+	// at most 1<<16 pages of a memory
+	squares := (current + previous) * n
+	if c.PerPage != 0 && n > math.MaxUint64/c.PerPage {
+		return math.MaxUint64
+	}
+	if c.Quadratic != 0 && squares > math.MaxUint64/c.Quadratic {
+		return math.MaxUint64
+	}
+	linear, quadratic := c.PerPage*n, c.Quadratic*squares
+	if linear > math.MaxUint64-quadratic {
+		return math.MaxUint64
+	}
+	return linear + quadratic
+}
+
+// chargedPages returns the number of 64 KiB pages charged for a memory of
+// size bytes, a partial page being charged as a whole one.
+func chargedPages(size uint64) uint64 {
+	return (size + wasmPageSize - 1) / wasmPageSize
+}
+
+// gasScheduleSchema is the version of the format of the gas schedule
+// documents read by ParseGasSchedule.
+const gasScheduleSchema = 1
+
+// gasScheduleDocument is the JSON representation of a GasSchedule, the
+// costs being indexed by operator name.
+type gasScheduleDocument struct {
+	Schema     int               `json:"schema"`
+	Version    uint32            `json:"version"`
+	Costs      map[string]uint64 `json:"costs"`
+	MemoryGrow *MemoryGrowCost   `json:"memory_grow,omitempty"`
+	BulkByte   uint64            `json:"bulk_byte,omitempty"`
+}
+
+// UnknownGasOperatorError is returned by ParseGasSchedule when the schedule
+// gives the cost of an unknown operator.
+type UnknownGasOperatorError string
+
+func (e UnknownGasOperatorError) Error() string {
+	return fmt.Sprintf("exec: gas schedule: unknown operator %q", string(e))
+}
+
+// MissingGasCostError is returned by ParseGasSchedule when the schedule
+// doesn't give the cost of an operator.
+type MissingGasCostError string
+
+func (e MissingGasCostError) Error() string {
+	return fmt.Sprintf("exec: gas schedule: missing cost of operator %q", string(e))
+}
+
+// ParseGasSchedule reads a gas schedule from a JSON document of the form
+//
+//	{"schema": 1, "version": 2, "costs": {"unreachable": 1, "nop": 1, ...}}
+//
+// where schema is the version of the format, and version the version of
+// the schedule. The document must give the cost of every operator,
+// including the prefixed bulk memory, SIMD, atomic and GC operators. An
+// optional "memory_grow" object of the form {"per_page": 10, "quadratic":
+// 1} gives the MemoryGrow cost, and an optional "bulk_byte" number the
+// BulkByte cost, which both default to zero.
+func ParseGasSchedule(data []byte) (*GasSchedule, error) {
+	var doc gasScheduleDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Schema != gasScheduleSchema {
+		return nil, ERR_GAS_SCHEDULE_SCHEMA
+	}
+
+	schedule := &GasSchedule{Version: doc.Version, BulkByte: doc.BulkByte}
+	if doc.MemoryGrow != nil {
+		schedule.MemoryGrow = *doc.MemoryGrow
+	}
+	for name, cost := range doc.Costs {
+		op, ok := opsByName[name]
+		if !ok {
+			return nil, UnknownGasOperatorError(name)
+		}
+		switch op.Code {
+		case ops.PrefixMisc:
+			schedule.Misc[op.Sub] = cost
+		case ops.PrefixSIMD:
+			schedule.SIMD[op.Sub] = cost
+		case ops.PrefixAtomic:
+			schedule.Atomic[op.Sub] = cost
+		case ops.PrefixGC:
+			schedule.GC[op.Sub] = cost
+		default:
+			schedule.Costs[op.Code] = cost
+		}
+	}
+	for _, table := range [][]ops.Op{opsByCode, miscOps, simdOps, atomicOps, gcOps} {
+		for _, op := range table {
+			if _, ok := doc.Costs[op.Name]; !ok {
+				return nil, MissingGasCostError(op.Name)
+			}
+		}
+	}
+	return schedule, nil
+}
+
+// MarshalJSON encodes s as a document read by ParseGasSchedule.
+func (s *GasSchedule) MarshalJSON() ([]byte, error) {
+	doc := gasScheduleDocument{
+		Schema:   gasScheduleSchema,
+		Version:  s.Version,
+		Costs:    make(map[string]uint64, len(opsByCode)+len(miscOps)+len(simdOps)+len(atomicOps)+len(gcOps)),
+		BulkByte: s.BulkByte,
+	}
+	for _, op := range opsByCode {
+		doc.Costs[op.Name] = s.Costs[op.Code]
+	}
+	for _, op := range miscOps {
+		doc.Costs[op.Name] = s.Misc[op.Sub]
+	}
+	for _, op := range simdOps {
+		doc.Costs[op.Name] = s.SIMD[op.Sub]
+	}
+	for _, op := range atomicOps {
+		doc.Costs[op.Name] = s.Atomic[op.Sub]
+	}
+	for _, op := range gcOps {
+		doc.Costs[op.Name] = s.GC[op.Sub]
+	}
+	if s.MemoryGrow != (MemoryGrowCost{}) {
+		doc.MemoryGrow = &s.MemoryGrow
+	}
+	return json.Marshal(doc)
+}
+
+// opsByCode and opsByName are the operators the schedules give a cost to,
+// and miscOps, simdOps, atomicOps and gcOps the ones prefixed by
+// ops.PrefixMisc, ops.PrefixSIMD, ops.PrefixAtomic and ops.PrefixGC.
+var opsByCode, miscOps, simdOps, atomicOps, gcOps, opsByName = gasOperators()
+
+func gasOperators() ([]ops.Op, []ops.Op, []ops.Op, []ops.Op, []ops.Op, map[string]ops.Op) {
+	var byCode, misc, simd, atomic, gc []ops.Op
+	byName := make(map[string]ops.Op)
+	for code := 0; code < 256; code++ {
+		if op, err := ops.New(byte(code)); err == nil {
+			byCode = append(byCode, op)
+			byName[op.Name] = op
+		}
+	}
+	for sub := uint32(0); sub < uint32(len(GasSchedule{}.Misc)); sub++ {
+		if op, err := ops.NewPrefixed(ops.PrefixMisc, sub); err == nil {
+			misc = append(misc, op)
+			byName[op.Name] = op
+		}
+	}
+	for sub := uint32(0); sub < uint32(len(GasSchedule{}.SIMD)); sub++ {
+		if op, err := ops.NewPrefixed(ops.PrefixSIMD, sub); err == nil {
+			simd = append(simd, op)
+			byName[op.Name] = op
+		}
+	}
+	for sub := uint32(0); sub < uint32(len(GasSchedule{}.Atomic)); sub++ {
+		if op, err := ops.NewPrefixed(ops.PrefixAtomic, sub); err == nil {
+			atomic = append(atomic, op)
+			byName[op.Name] = op
+		}
+	}
+	for sub := uint32(0); sub < uint32(len(GasSchedule{}.GC)); sub++ {
+		if op, err := ops.NewPrefixed(ops.PrefixGC, sub); err == nil {
+			gc = append(gc, op)
+			byName[op.Name] = op
+		}
+	}
+	return byCode, misc, simd, atomic, gc, byName
+}
+
+// DefaultGasSchedule returns a schedule where every operator costs one
+// unit of gas.
+func DefaultGasSchedule() *GasSchedule {
+	schedule := &GasSchedule{}
+	for _, op := range opsByCode {
+		schedule.Costs[op.Code] = 1
+	}
+	for _, op := range miscOps {
+		schedule.Misc[op.Sub] = 1
+	}
+	for _, op := range simdOps {
+		schedule.SIMD[op.Sub] = 1
+	}
+	for _, op := range atomicOps {
+		schedule.Atomic[op.Sub] = 1
+	}
+	for _, op := range gcOps {
+		schedule.GC[op.Sub] = 1
+	}
+	return schedule
+}
+
+// compiledCosts returns the cost of every opcode of the compiled bytecode.
+func (s *GasSchedule) compiledCosts() *[256]uint64 {
+	costs := s.Costs
+	// the control operators are compiled to jumps, some of which reuse the
+	// opcodes of structured control operators
+	costs[compile.OpJmp] = s.Costs[ops.Br]
+	costs[compile.OpJmpZ] = s.Costs[ops.If]
+	costs[compile.OpJmpNz] = s.Costs[ops.BrIf]
+	costs[compile.OpDiscard] = 0
+	costs[compile.OpDiscardPreserveTop] = 0
+	costs[compile.OpDiscardPreserve] = 0
+	// the access following the prefixes is charged instead
+	costs[compile.OpUnchecked] = 0
+	costs[compile.OpMemory] = 0
+	costs[compile.OpMeter] = 0
+	// the operator following the prefix is charged instead, see misc
+	costs[ops.PrefixMisc] = 0
+	costs[ops.PrefixSIMD] = 0
+	costs[ops.PrefixAtomic] = 0
+	costs[ops.PrefixGC] = 0
+	return &costs
+}
+
+// GasMeter accounts for the gas consumed by the calls of a VM, up to a
+// limit. A meter can be shared by several VMs running one after the
+// other, for instance by the nested calls of a transaction.
+type GasMeter struct {
+	limit uint64
+	used  uint64
+}
+
+// NewGasMeter returns a meter allowing limit units of gas to be consumed.
+func NewGasMeter(limit uint64) *GasMeter {
+	return &GasMeter{limit: limit}
+}
+
+// Consume consumes amount units of gas. If less than amount is left, all
+// the gas left is consumed, and Consume returns ErrOutOfGas.
+func (m *GasMeter) Consume(amount uint64) error {
+	if amount > m.limit-m.used {
+		m.used = m.limit
+		return ErrOutOfGas
+	}
+	m.used += amount
+	return nil
+}
+
+// Used returns the gas consumed so far.
+func (m *GasMeter) Used() uint64 {
+	return m.used
+}
+
+// Limit returns the gas limit of the meter.
+func (m *GasMeter) Limit() uint64 {
+	return m.limit
+}
+
+// Remaining returns the gas left.
+func (m *GasMeter) Remaining() uint64 {
+	return m.limit - m.used
+}
+
+// Refund gives back amount units of gas, up to the gas consumed so far.
+func (m *GasMeter) Refund(amount uint64) {
+	if amount > m.used {
+		amount = m.used
+	}
+	m.used -= amount
+}
+
+// SetGasMeter attaches meter to vm: the following calls consume gas from
+// it, according to schedule, and trap with ErrOutOfGas once it runs out.
+// A nil meter disables metering.
+//
+// With a nil schedule, only the gas charged by the module itself through
+// the env.gas function is consumed, as for the modules instrumented by
+// InstrumentGas. Otherwise, functions compiled to native code are
+// interpreted while metering, since native code can't be metered.
+func (vm *VM) SetGasMeter(meter *GasMeter, schedule *GasSchedule) {
+	vm.blockCosts, vm.blockOpCosts = nil, nil
+	vm.growCost, vm.miscCosts, vm.bulkByteCost = MemoryGrowCost{}, nil, 0
+	vm.simdCosts, vm.atomicCosts, vm.gcCosts = nil, nil, nil
+	if meter == nil || schedule == nil {
+		vm.gasMeter, vm.gasCosts = meter, nil
+		return
+	}
+	vm.gasMeter, vm.gasCosts = meter, schedule.compiledCosts()
+	vm.growCost = schedule.MemoryGrow
+	vm.miscCosts, vm.bulkByteCost = &schedule.Misc, schedule.BulkByte
+	vm.simdCosts, vm.atomicCosts, vm.gcCosts = &schedule.SIMD, &schedule.Atomic, &schedule.GC
+	if vm.compiled.config.BlockMetering {
+		vm.blockCosts = vm.compiled.blockCosts(vm.gasCosts)
+		vm.blockOpCosts, vm.gasCosts = vm.gasCosts, nil
+	}
+}
+
+// blockCosts returns the cost of every basic block of the functions of m,
+// indexed by function, for the costs of every compiled opcode.
+func (m *Module) blockCosts(costs *[256]uint64) [][]uint64 {
+	blockCosts := make([][]uint64, len(m.funcs))
+	for i, fn := range m.funcs {
+		blockCosts[i] = make([]uint64, len(fn.basicBlocks))
+		for j, block := range fn.basicBlocks {
+			for _, op := range block {
+				blockCosts[i][j] += costs[op]
+			}
+		}
+	}
+	return blockCosts
+}
+
+// GasMeter returns the gas meter attached to vm, if any.
+func (vm *VM) GasMeter() *GasMeter {
+	return vm.gasMeter
+}
+
+// GasUsed returns the gas consumed by the last call of vm, less the gas
+// refunded during the call.
+func (vm *VM) GasUsed() uint64 {
+	return vm.gasUsed
+}
+
+// GasRemaining returns the gas left to vm, or zero if it isn't metered.
+func (vm *VM) GasRemaining() uint64 {
+	if vm.gasMeter == nil {
+		return 0
+	}
+	return vm.gasMeter.Remaining()
+}
+
+// ChargeGas consumes amount units of gas from the meter of vm, if any, for
+// the host functions to charge for their work. Like an instruction, it
+// traps the VM with ErrOutOfGas once out of gas, so it must only be called
+// by host functions.
+func (vm *VM) ChargeGas(amount uint64) {
+	if vm.gasMeter != nil {
+		vm.consumeGas(GasHost, amount)
+	}
+}
+
+// RefundGas gives back amount units of gas to the meter of vm, if any, up
+// to the gas consumed so far, for instance when a host function frees
+// storage. The refunded gas can be used by the rest of the call.
+func (vm *VM) RefundGas(amount uint64) {
+	if vm.gasMeter != nil {
+		vm.gasMeter.Refund(amount)
+	}
+}
+
+// metered returns whether the instructions run by vm are accounted for,
+// or can be interrupted, debugged, traced or sampled, or whether their
+// writes to the memory are tracked, which native code can't do.
+func (vm *VM) metered() bool {
+	return vm.gasCosts != nil || vm.blockCosts != nil || vm.fuel != 0 ||
+		vm.interruptible != 0 || vm.epochTicks != 0 || vm.hooked || vm.sampler != nil ||
+		vm.written != nil
+}
+
+// consumeGas consumes amount units of gas, of the given category for the
+// gas breakdown, trapping the VM when it runs out of gas.
+func (vm *VM) consumeGas(category GasCategory, amount uint64) {
+	if vm.gasBreakdown != nil {
+		vm.consumeTrackedGas(category, amount)
+		return
+	}
+	if err := vm.gasMeter.Consume(amount); err != nil {
+		panic(err)
+	}
+}
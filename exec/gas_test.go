@@ -0,0 +1,338 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+func TestGasMetering(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	facIter := int64(module.Export.Entries["fac-iter"].Index)
+	facRec := int64(module.Export.Entries["fac-rec"].Index)
+
+	var used uint64
+	for _, config := range []VMConfig{{}, {AOT: true}} {
+		vm, err := NewVMWithConfig(module, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meter := NewGasMeter(1 << 20)
+		vm.SetGasMeter(meter, DefaultGasSchedule())
+
+		if _, err := vm.ExecCode(facIter, 20); err != nil {
+			t.Fatal(err)
+		}
+		if vm.GasUsed() == 0 || vm.GasUsed() != meter.Used() {
+			t.Fatalf("aot=%v: unexpected gas used: %d, meter=%d", config.AOT, vm.GasUsed(), meter.Used())
+		}
+		if used == 0 {
+			used = vm.GasUsed()
+		} else if vm.GasUsed() != used {
+			t.Errorf("aot=%v: native code was metered differently: got=%d, want=%d", config.AOT, vm.GasUsed(), used)
+		}
+
+		// a longer computation costs more
+		if _, err := vm.ExecCode(facIter, 25); err != nil {
+			t.Fatal(err)
+		}
+		if vm.GasUsed() <= used || meter.Used() != used+vm.GasUsed() {
+			t.Errorf("aot=%v: unexpected gas used: %d, meter=%d", config.AOT, vm.GasUsed(), meter.Used())
+		}
+	}
+
+	vm, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meter := NewGasMeter(used - 1)
+	vm.SetGasMeter(meter, DefaultGasSchedule())
+	func() {
+		defer func() {
+			if err := trapValue(recover()); err != ErrOutOfGas {
+				t.Errorf("unexpected trap: %v", err)
+			}
+		}()
+		vm.ExecCode(facIter, 20)
+	}()
+	if meter.Used() != meter.Limit() || vm.GasUsed() != meter.Limit() {
+		t.Errorf("unexpected gas used after running out: %d, meter=%d", vm.GasUsed(), meter.Used())
+	}
+
+	// calls are charged
+	vm.SetGasMeter(NewGasMeter(1<<20), DefaultGasSchedule())
+	if _, err := vm.ExecCode(facRec, 20); err != nil {
+		t.Fatal(err)
+	}
+	recUsed := vm.GasUsed()
+	schedule := DefaultGasSchedule()
+	schedule.Costs[0x10] = 100 // call
+	vm.SetGasMeter(NewGasMeter(1<<20), schedule)
+	if _, err := vm.ExecCode(facRec, 20); err != nil {
+		t.Fatal(err)
+	}
+	if vm.GasUsed() != recUsed+20*99 {
+		t.Errorf("unexpected gas used with costly calls: got=%d, want=%d", vm.GasUsed(), recUsed+20*99)
+	}
+
+	vm.SetGasMeter(nil, nil)
+	if _, err := vm.ExecCode(facRec, 20); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockMetering(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	facIter := int64(module.Export.Entries["fac-iter"].Index)
+	facRec := int64(module.Export.Entries["fac-rec"].Index)
+
+	// without traps, charging whole blocks costs as much as charging
+	// every instruction
+	schedule := DefaultGasSchedule()
+	schedule.Costs[0x10] = 100 // call
+	for _, fn := range []int64{facIter, facRec} {
+		var used [2]uint64
+		for i, config := range []VMConfig{{}, {BlockMetering: true, AOT: true}} {
+			vm, err := NewVMWithConfig(module, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vm.SetGasMeter(NewGasMeter(1<<20), schedule)
+			res, err := vm.ExecCode(fn, 20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != uint64(2432902008176640000) {
+				t.Errorf("unexpected result: %v", res)
+			}
+			used[i] = vm.GasUsed()
+		}
+		if used[0] == 0 || used[0] != used[1] {
+			t.Errorf("function %d: unexpected gas used with block metering: got=%d, want=%d", fn, used[1], used[0])
+		}
+	}
+
+	vm, err := NewVMWithConfig(module, VMConfig{BlockMetering: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.SetGasMeter(NewGasMeter(100), schedule)
+	func() {
+		defer func() {
+			if err := trapValue(recover()); err != ErrOutOfGas {
+				t.Errorf("unexpected trap: %v", err)
+			}
+		}()
+		vm.ExecCode(facIter, 20)
+	}()
+}
+
+func TestGasScheduleDocument(t *testing.T) {
+	// The checked in schedule must give the cost of every operator: an
+	// operator added to the interpreter needs a cost before shipping.
+	data, err := ioutil.ReadFile("testdata/gas/schedule-v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := ParseGasSchedule(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.Version != 1 {
+		t.Errorf("unexpected version: %d", schedule.Version)
+	}
+	want := DefaultGasSchedule()
+	want.Version = 1
+	if *schedule != *want {
+		t.Errorf("schedule doesn't match the default schedule")
+	}
+	for code := 0; code < 256; code++ {
+		if _, err := ops.New(byte(code)); err == nil && schedule.Costs[code] == 0 {
+			t.Errorf("operator %#x has no cost", code)
+		}
+	}
+	for _, table := range []struct {
+		prefix byte
+		costs  []uint64
+	}{
+		{ops.PrefixMisc, schedule.Misc[:]},
+		{ops.PrefixSIMD, schedule.SIMD[:]},
+		{ops.PrefixAtomic, schedule.Atomic[:]},
+		{ops.PrefixGC, schedule.GC[:]},
+	} {
+		for sub, cost := range table.costs {
+			if _, err := ops.NewPrefixed(table.prefix, uint32(sub)); err == nil && cost == 0 {
+				t.Errorf("operator %#x %#x has no cost", table.prefix, sub)
+			}
+		}
+	}
+
+	schedule.Version = 2
+	schedule.MemoryGrow = MemoryGrowCost{PerPage: 3, Quadratic: 1}
+	schedule.SIMD[ops.V128Load] = 7
+	data, err = json.Marshal(schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ParseGasSchedule(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *decoded != *schedule {
+		t.Errorf("schedule changed after a round trip")
+	}
+
+	// the prefixed operators need a cost as well
+	var doc gasScheduleDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	delete(doc.Costs, "v128.load")
+	if data, err = json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseGasSchedule(data); err != MissingGasCostError("v128.load") {
+		t.Errorf("unexpected error: got=%v, want=%v", err, MissingGasCostError("v128.load"))
+	}
+}
+
+func TestGasScheduleErrors(t *testing.T) {
+	for _, tc := range []struct {
+		doc string
+		err error
+	}{
+		{`{"schema": 2, "version": 1, "costs": {}}`, ERR_GAS_SCHEDULE_SCHEMA},
+		{`{"schema": 1, "version": 1, "costs": {"i32.foo": 1}}`, UnknownGasOperatorError("i32.foo")},
+		{`{"schema": 1, "version": 1, "costs": {"nop": 1}}`, MissingGasCostError("unreachable")},
+	} {
+		if _, err := ParseGasSchedule([]byte(tc.doc)); err != tc.err {
+			t.Errorf("%s: unexpected error: got=%v, want=%v", tc.doc, err, tc.err)
+		}
+	}
+}
+
+func TestHostGas(t *testing.T) {
+	code, err := InstrumentGas(readTestCode(t, "testdata/spec/fac.wasm"), DefaultGasSchedule())
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, err := wasm.ReadModule(bytes.NewReader(code), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var charged uint64
+	imports := NewEnvFunc()
+	imports.envFuncMap[GAS_FUNCTION] = func(vm *VM) (bool, error) {
+		amount := uint64(uint32(vm.GetFuncParams()[0]))
+		vm.ChargeGas(2 * amount)
+		vm.RefundGas(amount)
+		charged += amount
+		return true, nil
+	}
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	vm := inst.NewVM()
+	meter := NewGasMeter(1 << 20)
+	vm.SetGasMeter(meter, nil)
+	if _, err = vm.ExecCode(int64(module.Export.Entries["fac-iter"].Index), 20); err != nil {
+		t.Fatal(err)
+	}
+	if charged == 0 || vm.GasUsed() != charged {
+		t.Errorf("unexpected gas used: got=%d, want=%d", vm.GasUsed(), charged)
+	}
+	if vm.GasRemaining() != meter.Limit()-charged || meter.Remaining() != vm.GasRemaining() {
+		t.Errorf("unexpected gas remaining: %d, meter=%d", vm.GasRemaining(), meter.Remaining())
+	}
+
+	// refunds are bounded by the gas consumed
+	vm.RefundGas(1 << 30)
+	if meter.Used() != 0 || vm.GasRemaining() != meter.Limit() {
+		t.Errorf("unexpected gas used after a refund: %d", meter.Used())
+	}
+
+	vm.SetGasMeter(nil, nil)
+	vm.ChargeGas(1)
+	vm.RefundGas(1)
+	if vm.GasRemaining() != 0 {
+		t.Errorf("unexpected gas remaining without a meter: %d", vm.GasRemaining())
+	}
+}
+
+func TestHostCost(t *testing.T) {
+	code, err := InstrumentGas(readTestCode(t, "testdata/spec/fac.wasm"), DefaultGasSchedule())
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, err := wasm.ReadModule(bytes.NewReader(code), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls, want uint64
+	imports := NewEnvFunc()
+	delete(imports.envFuncMap, GAS_FUNCTION)
+	imports.RegisterWithCost(GAS_FUNCTION, func(vm *VM) (bool, error) {
+		calls++
+		want += 10 + 3*uint64(uint32(vm.GetFuncParams()[0]))
+		return true, nil
+	}, ByteCost(10, 3, 0))
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	vm := inst.NewVM()
+	vm.SetGasMeter(NewGasMeter(1<<20), nil)
+	if _, err = vm.ExecCode(int64(module.Export.Entries["fac-iter"].Index), 20); err != nil {
+		t.Fatal(err)
+	}
+	if calls == 0 || vm.GasUsed() != want {
+		t.Errorf("unexpected gas used: got=%d, want=%d", vm.GasUsed(), want)
+	}
+
+	if got := FlatCost(7)([]uint64{1 << 20}); got != 7 {
+		t.Errorf("unexpected flat cost: %d", got)
+	}
+	if got := ByteCost(1, 2, 0, 2, 5)([]uint64{3, 100, 4}); got != 15 {
+		t.Errorf("unexpected byte cost: %d", got)
+	}
+	if got := ByteCost(1, math.MaxUint64, 0)([]uint64{2}); got != math.MaxUint64 {
+		t.Errorf("byte cost did not saturate: %d", got)
+	}
+}
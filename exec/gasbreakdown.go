@@ -0,0 +1,172 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"fmt"
+
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// GasCategory is a category of operators, which the gas consumed by the
+// calls of a VM is broken down by, see (*VM).TrackGasBreakdown.
+type GasCategory int
+
+const (
+	// GasControl is the gas of the control operators, calls and
+	// exceptions included.
+	GasControl GasCategory = iota
+	// GasVariable is the gas of the operators on locals and globals, and
+	// of drop and select.
+	GasVariable
+	// GasMemory is the gas of the loads and stores, of the pages added by
+	// memory.grow, and of the bulk and atomic memory operators.
+	GasMemory
+	// GasArithmetic is the gas of the numeric operators, constants and
+	// conversions included.
+	GasArithmetic
+	// GasTable is the gas of the table and reference operators.
+	GasTable
+	// GasSIMD and GasGC are the gas of the SIMD and GC operators.
+	GasSIMD
+	GasGC
+	// GasHost is the gas charged by the host functions, see
+	// (*VM).ChargeGas, which includes the gas charged by the modules
+	// instrumented by InstrumentGas.
+	GasHost
+
+	NumGasCategories
+)
+
+var gasCategoryNames = [NumGasCategories]string{
+	"control", "variable", "memory", "arithmetic", "table", "simd", "gc", "host",
+}
+
+func (c GasCategory) String() string {
+	if c < 0 || c >= NumGasCategories {
+		return fmt.Sprintf("GasCategory(%d)", int(c))
+	}
+	return gasCategoryNames[c]
+}
+
+// GasBreakdown is the gas consumed by category, refunds aside.
+type GasBreakdown [NumGasCategories]uint64
+
+// Total returns the gas consumed in all the categories.
+func (b GasBreakdown) Total() uint64 {
+	var total uint64
+	for _, gas := range b {
+		total += gas
+	}
+	return total
+}
+
+// gasCategories is the category of every opcode of the compiled bytecode.
+// The prefixed operators are categorized by their sub-opcode, see
+// miscGasCategory.
+var gasCategories = func() (categories [256]GasCategory) {
+	for code := range categories {
+		switch {
+		case code >= int(ops.Drop) && code <= int(ops.SetGlobal):
+			categories[code] = GasVariable
+		case code == int(ops.TableGet) || code == int(ops.TableSet):
+			categories[code] = GasTable
+		case code >= int(ops.I32Load) && code <= int(ops.GrowMemory):
+			categories[code] = GasMemory
+		case code >= int(ops.I32Const) && code <= int(ops.F64ReinterpretI64):
+			categories[code] = GasArithmetic
+		case code >= int(ops.RefNull) && code <= int(ops.RefAsNonNull):
+			categories[code] = GasTable
+		default:
+			// the structured control operators, whose opcodes are reused
+			// by the jumps and discards of the compiled bytecode, and the
+			// branches on null references
+			categories[code] = GasControl
+		}
+	}
+	return categories
+}()
+
+// miscGasCategory returns the category of the operator prefixed by
+// ops.PrefixMisc with the given sub-opcode: the saturating truncations,
+// the bulk memory operators, then the table operators.
+func miscGasCategory(sub uint32) GasCategory {
+	switch {
+	case sub < 0x08:
+		return GasArithmetic
+	case sub < 0x0c:
+		return GasMemory
+	}
+	return GasTable
+}
+
+// TrackGasBreakdown sets whether the gas consumed by the following calls
+// of vm is broken down by category, for GasBreakdown to report it. The
+// gas of the calls is added to the breakdown until ResetGasBreakdown.
+// With VMConfig.BlockMetering, the basic blocks are charged operator by
+// operator while the gas is broken down.
+func (vm *VM) TrackGasBreakdown(enable bool) {
+	if !enable {
+		vm.gasBreakdown = nil
+		return
+	}
+	if vm.gasTracked == nil {
+		vm.gasTracked = &GasBreakdown{}
+	}
+	vm.gasBreakdown = vm.gasTracked
+}
+
+// GasBreakdown returns the gas consumed by category by the calls of vm
+// since TrackGasBreakdown, or ResetGasBreakdown.
+func (vm *VM) GasBreakdown() GasBreakdown {
+	if vm.gasTracked == nil {
+		return GasBreakdown{}
+	}
+	return *vm.gasTracked
+}
+
+// ResetGasBreakdown clears the gas breakdown of vm.
+func (vm *VM) ResetGasBreakdown() {
+	if vm.gasTracked != nil {
+		*vm.gasTracked = GasBreakdown{}
+	}
+}
+
+// consumeTrackedGas consumes gas like consumeGas, adding the gas consumed
+// to the breakdown: all the gas left when it runs out of gas.
+func (vm *VM) consumeTrackedGas(category GasCategory, amount uint64) {
+	used := vm.gasMeter.used
+	err := vm.gasMeter.Consume(amount)
+	vm.gasBreakdown[category] += vm.gasMeter.used - used
+	if err != nil {
+		panic(err)
+	}
+}
+
+// consumeBlockGas consumes the gas of a basic block of the function of the
+// current context, operator by operator while the gas is broken down.
+func (vm *VM) consumeBlockGas(block uint32) {
+	if vm.gasBreakdown == nil {
+		// the category is only used by the breakdown
+		vm.consumeGas(GasControl, vm.blockCosts[vm.ctx.curFunc][block])
+		return
+	}
+	for _, op := range vm.compiledFuncs[vm.ctx.curFunc].basicBlocks[block] {
+		vm.consumeTrackedGas(gasCategories[op], vm.blockOpCosts[op])
+	}
+}
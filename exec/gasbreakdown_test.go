@@ -0,0 +1,94 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestGasBreakdown(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/gas-breakdown.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule := DefaultGasSchedule()
+	schedule.MemoryGrow.PerPage = 10
+	imports := NewEnvFunc()
+	imports.RegisterWithCost("cost", func(vm *VM) (bool, error) { return true, nil }, FlatCost(100))
+
+	for _, blockMetering := range []bool{false, true} {
+		compiled, err := CompileModule(module, VMConfig{BlockMetering: blockMetering})
+		if err != nil {
+			t.Fatal(err)
+		}
+		inst, err := compiled.Instantiate(imports)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer inst.Close()
+		vm := inst.NewVM()
+		vm.SetGasMeter(NewGasMeter(1000), schedule)
+		run := int64(module.Export.Entries["run"].Index)
+
+		vm.TrackGasBreakdown(true)
+		if _, err := vm.ExecCode(run, 8); err != nil {
+			t.Fatal(err)
+		}
+		// the host function charges 100, and the page grown 10 on top of
+		// the store and memory.grow. The call, and the ends of run and of
+		// the compiled body of the host function are control operators.
+		want := GasBreakdown{GasControl: 3, GasVariable: 3, GasMemory: 12, GasArithmetic: 2, GasHost: 100}
+		if got := vm.GasBreakdown(); got != want || got.Total() != vm.GasUsed() {
+			t.Errorf("block metering %v: got=%v, want=%v, used %d", blockMetering, got, want, vm.GasUsed())
+		}
+
+		// the breakdown adds up the calls until it is reset
+		vm.TrackGasBreakdown(false)
+		vm.ExecCode(run, 8)
+		vm.TrackGasBreakdown(true)
+		vm.ExecCode(run, 8)
+		if got := vm.GasBreakdown(); got[GasHost] != 200 {
+			t.Errorf("block metering %v: unexpected breakdown %v", blockMetering, got)
+		}
+		vm.ResetGasBreakdown()
+		if got := vm.GasBreakdown(); got.Total() != 0 {
+			t.Errorf("block metering %v: unexpected breakdown %v", blockMetering, got)
+		}
+
+		// the gas left is consumed when running out of gas
+		vm.SetGasMeter(NewGasMeter(50), schedule)
+		func() {
+			defer func() {
+				if err := trapValue(recover()); err != ErrOutOfGas {
+					t.Errorf("unexpected trap: %v", err)
+				}
+			}()
+			vm.ExecCode(run, 8)
+		}()
+		if got := vm.GasBreakdown(); got.Total() != 50 || got[GasHost] == 0 {
+			t.Errorf("block metering %v: unexpected breakdown %v", blockMetering, got)
+		}
+	}
+
+	if GasMemory.String() != "memory" {
+		t.Errorf("unexpected category name %q", GasMemory)
+	}
+}
@@ -0,0 +1,413 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+var (
+	// ErrNullReference is the error value used while trapping the VM when
+	// a GC operator accesses a null reference.
+	ErrNullReference = newTrap(TrapNullReference, "exec: null reference")
+	// ErrCastFailure is the error value used while trapping the VM when a
+	// ref.cast fails.
+	ErrCastFailure = newTrap(TrapCastFailure, "exec: cast failure")
+	// ErrOutOfBoundsArrayAccess is the error value used while trapping the
+	// VM when an array is accessed past its end.
+	ErrOutOfBoundsArrayAccess = newTrap(TrapOutOfBoundsArray, "exec: out of bounds array access")
+	// ErrArrayTooLarge is the error value used while trapping the VM when
+	// an array of more than maxArrayLength elements is allocated.
+	ErrArrayTooLarge = newTrap(TrapResourceLimit, "exec: array too large")
+)
+
+// maxArrayLength is the largest number of elements of an array.
+const maxArrayLength = 1 << 24
+
+// minCollection is the number of objects allocated before the first
+// collection of an instance, see collectObjects.
+const minCollection = 1024
+
+// gcObject is a struct or an array of the GC proposal. Like the Go values
+// of externrefs, the objects are referenced by their handle in the externs
+// of the instance, so that converting between externref and anyref leaves
+// references unchanged. The objects are Go values, reclaimed by the Go
+// garbage collector once collectObjects releases their handle.
+type gcObject struct {
+	typ uint32 // the index of the type of the object
+	// the values of the fields of a struct, or the elements of an array,
+	// the packed values being zero extended
+	fields []uint64
+}
+
+// i31 is the value of an i31ref. Equal values have the same handle, see
+// i31Handle, for ref.eq to compare handles.
+type i31 uint32
+
+// gc runs the operator prefixed by ops.PrefixGC, whose sub-opcode follows
+// the prefix as a uint32.
+func (vm *VM) gc() {
+	sub := vm.fetchUint32()
+	if vm.gcCosts != nil {
+		vm.consumeGas(GasGC, vm.gcCosts[sub])
+	}
+
+	switch sub {
+	case ops.StructNew, ops.StructNewDefault:
+		typ := vm.fetchUint32()
+		fields := vm.module.Types.Entries[typ].Fields
+		obj := &gcObject{typ: typ, fields: make([]uint64, len(fields))}
+		for i := len(fields) - 1; i >= 0; i-- {
+			if sub == ops.StructNewDefault {
+				obj.fields[i] = defaultValue(fields[i].Type)
+			} else {
+				obj.fields[i] = pack(fields[i].Type, vm.popUint64())
+			}
+		}
+		vm.pushUint32(vm.newHandle(obj))
+	case ops.StructGet, ops.StructGetS, ops.StructGetU:
+		typ, field := vm.fetchUint32(), vm.fetchUint32()
+		obj := vm.object(vm.popUint32())
+		t := vm.module.Types.Entries[typ].Fields[field].Type
+		vm.pushUint64(unpack(t, obj.fields[field], sub == ops.StructGetS))
+	case ops.StructSet:
+		typ, field := vm.fetchUint32(), vm.fetchUint32()
+		v := vm.popUint64()
+		obj := vm.object(vm.popUint32())
+		obj.fields[field] = pack(vm.module.Types.Entries[typ].Fields[field].Type, v)
+	case ops.ArrayNew, ops.ArrayNewDefault:
+		typ := vm.fetchUint32()
+		t := vm.module.Types.Entries[typ].Fields[0].Type
+		n := vm.popUint32()
+		v := defaultValue(t)
+		if sub == ops.ArrayNew {
+			v = pack(t, vm.popUint64())
+		}
+		obj := vm.newArray(typ, n)
+		for i := range obj.fields {
+			obj.fields[i] = v
+		}
+		vm.pushUint32(vm.newHandle(obj))
+	case ops.ArrayNewFixed:
+		typ, n := vm.fetchUint32(), vm.fetchUint32()
+		t := vm.module.Types.Entries[typ].Fields[0].Type
+		obj := vm.newArray(typ, n)
+		for i := len(obj.fields) - 1; i >= 0; i-- {
+			obj.fields[i] = pack(t, vm.popUint64())
+		}
+		vm.pushUint32(vm.newHandle(obj))
+	case ops.ArrayGet, ops.ArrayGetS, ops.ArrayGetU:
+		typ := vm.fetchUint32()
+		i := vm.popUint32()
+		obj := vm.object(vm.popUint32())
+		vm.checkArray(obj, i, 1)
+		t := vm.module.Types.Entries[typ].Fields[0].Type
+		vm.pushUint64(unpack(t, obj.fields[i], sub == ops.ArrayGetS))
+	case ops.ArraySet:
+		typ := vm.fetchUint32()
+		v, i := vm.popUint64(), vm.popUint32()
+		obj := vm.object(vm.popUint32())
+		vm.checkArray(obj, i, 1)
+		obj.fields[i] = pack(vm.module.Types.Entries[typ].Fields[0].Type, v)
+	case ops.ArrayLen:
+		vm.pushUint32(uint32(len(vm.object(vm.popUint32()).fields)))
+	case ops.ArrayFill:
+		typ := vm.fetchUint32()
+		n, v, i := vm.popUint32(), vm.popUint64(), vm.popUint32()
+		obj := vm.object(vm.popUint32())
+		vm.checkArray(obj, i, n)
+		vm.chargeBulk(GasGC, uint64(n))
+		v = pack(vm.module.Types.Entries[typ].Fields[0].Type, v)
+		elems := obj.fields[i : i+n]
+		for j := range elems {
+			elems[j] = v
+		}
+	case ops.ArrayCopy:
+		vm.fetchUint32()
+		vm.fetchUint32()
+		n, srcIndex := vm.popUint32(), vm.popUint32()
+		src := vm.object(vm.popUint32())
+		dstIndex := vm.popUint32()
+		dst := vm.object(vm.popUint32())
+		vm.checkArray(src, srcIndex, n)
+		vm.checkArray(dst, dstIndex, n)
+		vm.chargeBulk(GasGC, uint64(n))
+		copy(dst.fields[dstIndex:dstIndex+n], src.fields[srcIndex:srcIndex+n])
+	case ops.RefTest, ops.RefTestNull:
+		t := wasm.ValueType(vm.fetchInt32())
+		if vm.refTest(vm.popUint32(), t, sub == ops.RefTestNull) {
+			vm.pushUint32(1)
+		} else {
+			vm.pushUint32(0)
+		}
+	case ops.RefCast, ops.RefCastNull:
+		t := wasm.ValueType(vm.fetchInt32())
+		ref := vm.popUint32()
+		if !vm.refTest(ref, t, sub == ops.RefCastNull) {
+			panic(ErrCastFailure)
+		}
+		vm.pushUint32(ref)
+	case ops.AnyConvertExtern, ops.ExternConvertAny:
+		// the handles are shared by both hierarchies
+	case ops.RefI31:
+		vm.pushUint32(vm.i31Handle(i31(vm.popUint32() & 0x7fffffff)))
+	case ops.I31GetS, ops.I31GetU:
+		ref := vm.popUint32()
+		if ref == uint32(wasm.NullRef) {
+			panic(ErrNullReference)
+		}
+		v := uint32(vm.externs[ref].(i31))
+		if sub == ops.I31GetS {
+			v = uint32(int32(v<<1) >> 1)
+		}
+		vm.pushUint32(v)
+	default:
+		panic(ops.InvalidPrefixedOpcodeError{Prefix: ops.PrefixGC, Sub: sub})
+	}
+}
+
+func (vm *VM) refEq() {
+	if vm.popUint32() == vm.popUint32() {
+		vm.pushUint32(1)
+	} else {
+		vm.pushUint32(0)
+	}
+}
+
+// object returns the struct or array referenced by ref, trapping the VM if
+// ref is null.
+func (vm *VM) object(ref uint32) *gcObject {
+	if ref == uint32(wasm.NullRef) {
+		panic(ErrNullReference)
+	}
+	return vm.externs[ref].(*gcObject)
+}
+
+// newArray returns an array of type typ with n elements, trapping the VM
+// if n is larger than maxArrayLength.
+func (vm *VM) newArray(typ, n uint32) *gcObject {
+	if n > maxArrayLength {
+		panic(ErrArrayTooLarge)
+	}
+	vm.chargeBulk(GasGC, uint64(n))
+	return &gcObject{typ: typ, fields: make([]uint64, n)}
+}
+
+// checkArray traps the VM if the n elements of obj from index i aren't all
+// in the array.
+func (vm *VM) checkArray(obj *gcObject, i, n uint32) {
+	if uint64(i)+uint64(n) > uint64(len(obj.fields)) {
+		panic(ErrOutOfBoundsArrayAccess)
+	}
+}
+
+// refTest returns whether ref is a reference of type t, or null if
+// nullable is true.
+func (vm *VM) refTest(ref uint32, t wasm.ValueType, nullable bool) bool {
+	if ref == uint32(wasm.NullRef) {
+		return nullable
+	}
+	if t >= 0 {
+		sig := &vm.module.Types.Entries[t]
+		if !sig.IsStruct() && !sig.IsArray() {
+			// the function references are function indices
+			return vm.funcTypeIDs[ref] == vm.typeIDs[t]
+		}
+		obj, ok := vm.externs[ref].(*gcObject)
+		return ok && vm.module.Subtype(wasm.ValueType(obj.typ), t)
+	}
+	switch t {
+	case wasm.ValueTypeAnyref, wasm.ValueTypeFuncref, wasm.ValueTypeExternref:
+		return true
+	case wasm.ValueTypeI31ref:
+		_, ok := vm.externs[ref].(i31)
+		return ok
+	case wasm.ValueTypeEqref, wasm.ValueTypeStructref, wasm.ValueTypeArrayref:
+		switch v := vm.externs[ref].(type) {
+		case i31:
+			return t == wasm.ValueTypeEqref
+		case *gcObject:
+			sig := &vm.module.Types.Entries[v.typ]
+			return t == wasm.ValueTypeEqref || sig.IsStruct() == (t == wasm.ValueTypeStructref)
+		}
+	}
+	return false
+}
+
+// defaultValue returns the value of the fields of type t created by
+// struct.new_default and array.new_default.
+func defaultValue(t wasm.ValueType) uint64 {
+	if t.IsRef() {
+		return uint64(wasm.NullRef)
+	}
+	return 0
+}
+
+// pack returns the value v stored in a field of type t.
+func pack(t wasm.ValueType, v uint64) uint64 {
+	switch t {
+	case wasm.ValueTypeI8:
+		return v & 0xff
+	case wasm.ValueTypeI16:
+		return v & 0xffff
+	}
+	return v
+}
+
+// unpack returns the value of a field of type t storing v, sign extended
+// if signed is true.
+func unpack(t wasm.ValueType, v uint64, signed bool) uint64 {
+	if !signed {
+		return v
+	}
+	switch t {
+	case wasm.ValueTypeI8:
+		return uint64(uint32(int32(int8(v))))
+	case wasm.ValueTypeI16:
+		return uint64(uint32(int32(int16(v))))
+	}
+	return v
+}
+
+// newHandle returns a new handle referencing v in the externs of inst,
+// reusing the handles released by collectObjects.
+func (inst *Instance) newHandle(v interface{}) uint32 {
+	inst.allocated++
+	if n := len(inst.freeHandles); n > 0 {
+		handle := inst.freeHandles[n-1]
+		inst.freeHandles = inst.freeHandles[:n-1]
+		inst.externs[handle] = v
+		return handle
+	}
+	inst.externs = append(inst.externs, v)
+	return uint32(len(inst.externs) - 1)
+}
+
+// i31Handle returns the handle of the i31ref of value v.
+func (inst *Instance) i31Handle(v i31) uint32 {
+	if handle, ok := inst.i31s[v]; ok {
+		return handle
+	}
+	if inst.i31s == nil {
+		inst.i31s = make(map[i31]uint32)
+	}
+	handle := inst.newHandle(v)
+	inst.i31s[v] = handle
+	return handle
+}
+
+// collectionDue returns whether enough objects were allocated since the
+// last collection for collectObjects to run. The objects are collected at
+// the end of the outermost call into the instance, since the values of the
+// stacks of the calls in progress can't be told from references.
+func (inst *Instance) collectionDue() bool {
+	return inst.allocated >= minCollection && inst.allocated >= inst.liveObjects
+}
+
+// collectObjects releases the handles of the structs, arrays and i31refs
+// no longer referenced by the globals, the tables, the other objects or
+// the given results, for their handles to be reused. The Go values given
+// to ExternRef are always kept. A host holding the handle of an object
+// between calls must store it in a global or a table of the module for
+// the handle to stay valid.
+func (inst *Instance) collectObjects(results []uint64) {
+	module := inst.compiled.module
+	marked := make([]bool, len(inst.externs))
+	var pending []uint32
+	mark := func(ref uint64) {
+		if ref < uint64(len(marked)) && !marked[ref] {
+			marked[ref] = true
+			pending = append(pending, uint32(ref))
+		}
+	}
+
+	for _, ref := range results {
+		mark(ref)
+	}
+	slots := disasm.GlobalSlots(module)
+	for i, global := range module.GlobalIndexSpace {
+		if inst.handleType(global.Type.Type) {
+			mark(inst.globals[slots[i]])
+		}
+	}
+	for i, table := range module.Tables() {
+		if inst.handleType(wasm.ValueType(table.ElementType)) {
+			for _, ref := range inst.tables[i] {
+				mark(uint64(ref))
+			}
+		}
+	}
+	for handle, v := range inst.externs {
+		switch v.(type) {
+		case *gcObject, i31, nil:
+		default:
+			mark(uint64(handle))
+		}
+	}
+
+	for len(pending) > 0 {
+		handle := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		obj, ok := inst.externs[handle].(*gcObject)
+		if !ok {
+			continue
+		}
+		sig := &module.Types.Entries[obj.typ]
+		for i, v := range obj.fields {
+			t := sig.Fields[0].Type
+			if sig.IsStruct() {
+				t = sig.Fields[i].Type
+			}
+			if inst.handleType(t) {
+				mark(v)
+			}
+		}
+	}
+
+	inst.liveObjects = 0
+	for handle, v := range inst.externs {
+		switch v := v.(type) {
+		case *gcObject, i31:
+			if marked[handle] {
+				inst.liveObjects++
+				continue
+			}
+			if v, ok := v.(i31); ok {
+				delete(inst.i31s, v)
+			}
+			inst.externs[handle] = nil
+			inst.freeHandles = append(inst.freeHandles, uint32(handle))
+		}
+	}
+	inst.allocated = 0
+}
+
+// handleType returns whether the values of type t are handles in the
+// externs of inst, rather than function indices.
+func (inst *Instance) handleType(t wasm.ValueType) bool {
+	switch {
+	case t >= 0:
+		sig := &inst.compiled.module.Types.Entries[t]
+		return sig.IsStruct() || sig.IsArray()
+	case t == wasm.ValueTypeFuncref, t == wasm.ValueTypeNullfuncref:
+		return false
+	}
+	return t.IsRef()
+}
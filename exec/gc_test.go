@@ -0,0 +1,70 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestCollectObjects(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/gc.wasm")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.VerifyModule(module); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(name string) uint32 {
+		t.Helper()
+		res, err := vm.ExecCode(int64(module.Export.Entries[name].Index))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return res.(uint32)
+	}
+
+	call("keep")
+	for i := 0; i < 10; i++ {
+		call("garbage")
+	}
+	// the handles of the unreachable objects are reused, while the
+	// object referenced by the global survives the collections
+	if n := len(vm.externs); n > 2*minCollection+3000 {
+		t.Fatalf("len(externs) = %d after the collections", n)
+	}
+	if got := call("kept"); got != 22 {
+		t.Fatalf("kept: got=%d, want=22", got)
+	}
+
+	// the objects of a clone are its own
+	clone, err := vm.Instance.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := clone.NewVM().ExecCode(int64(module.Export.Entries["struct-set"].Index)); err != nil || got != uint32(9) {
+		t.Fatalf("struct-set on the clone: got=%v, err=%v", got, err)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// Global accesses a global of an instance, for the embedders reading and
+// setting the globals the module exports, see ExportedGlobal. The values
+// are boxed like the arguments and results of Instance.Call. A Global is
+// tied to the instance: its accesses fail once the instance is closed.
+type Global struct {
+	inst  *Instance
+	index int
+}
+
+// Global returns the accessor of the global of inst with the given index
+// in the global index space.
+func (inst *Instance) Global(index int) Global {
+	return Global{inst: inst, index: index}
+}
+
+// Type returns the type of the value of the global, and whether it is
+// mutable, or a nil type if the module has no such global.
+func (g Global) Type() *wasm.GlobalVar {
+	globals := g.inst.compiled.module.GlobalIndexSpace
+	if g.index < 0 || g.index >= len(globals) {
+		return nil
+	}
+	return globals[g.index].Type
+}
+
+// slot returns the first slot of the value of the global in the globals
+// of the instance, and false if it has no such global or is closed.
+func (g Global) slot() (int, bool) {
+	if g.Type() == nil || g.inst.globals == nil {
+		return 0, false
+	}
+	return int(disasm.GlobalSlots(g.inst.compiled.module)[g.index]), true
+}
+
+// Get returns the value of the global: a uint32, uint64, float32,
+// float64, wasm.V128 or wasm.Ref.
+func (g Global) Get() (interface{}, error) {
+	slot, ok := g.slot()
+	if !ok {
+		return nil, ERR_INSTANCE_CLOSED
+	}
+	if t := g.Type().Type; t == wasm.ValueTypeV128 {
+		return v128Value(g.inst.globals[slot], g.inst.globals[slot+1]), nil
+	}
+	return boxValue(g.Type().Type, g.inst.globals[slot])
+}
+
+// Set sets the value of a mutable global, which takes the same Go values
+// as the parameters of Instance.Call. It returns ERR_IMMUTABLE_GLOBAL for
+// a global which isn't mutable.
+func (g Global) Set(v interface{}) error {
+	slot, ok := g.slot()
+	if !ok {
+		return ERR_INSTANCE_CLOSED
+	}
+	t := g.Type()
+	if !t.Mutable {
+		return ERR_IMMUTABLE_GLOBAL
+	}
+	if t.Type == wasm.ValueTypeV128 {
+		v128, ok := v.(wasm.V128)
+		if !ok {
+			return ArgumentTypeError{Type: t.Type, Value: v}
+		}
+		g.inst.globals[slot], g.inst.globals[slot+1] = endianess.Uint64(v128[:8]), endianess.Uint64(v128[8:])
+		return nil
+	}
+	bits, ok := unboxValue(t.Type, v)
+	if !ok {
+		return ArgumentTypeError{Type: t.Type, Value: v}
+	}
+	g.inst.globals[slot] = bits
+	return nil
+}
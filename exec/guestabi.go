@@ -0,0 +1,328 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// The functions marshalling the strings and the byte arrays passed
+// between the host and the modules by the conventions of the languages
+// they are written in, besides the canonical ABI (see CanonicalABI): the
+// (pointer, length) pairs and the C strings of the memory of any module,
+// the allocator functions exported by the C and Rust modules, see
+// GuestAllocator, and the objects of the AssemblyScript runtime, see
+// AssemblyScriptABI.
+
+// PackPtrLen returns the pointer and the length of a (pointer, length)
+// pair packed in an i64, the pointer in the high 32 bits, the way the
+// modules return a slice from a function with a single result.
+func PackPtrLen(ptr, n uint32) uint64 {
+	return uint64(ptr)<<32 | uint64(n)
+}
+
+// UnpackPtrLen returns the pointer and the length packed in v by
+// PackPtrLen.
+func UnpackPtrLen(v uint64) (ptr, n uint32) {
+	return uint32(v >> 32), uint32(v)
+}
+
+// ReadPtrLen returns a copy of the bytes of the (pointer, length) pair
+// stored at offset, two 32-bit integers, the way the slices and the
+// strings are laid out in memory, or returned through an out pointer.
+func (m Memory) ReadPtrLen(offset uint32) ([]byte, error) {
+	ptr, err := m.ReadUint32(offset)
+	if err != nil {
+		return nil, err
+	}
+	n, err := m.ReadUint32(offset + 4)
+	if err != nil {
+		return nil, err
+	}
+	return m.ReadBytes(ptr, n)
+}
+
+// WritePtrLen stores the (pointer, length) pair of ptr and n at offset.
+func (m Memory) WritePtrLen(offset, ptr, n uint32) error {
+	b, err := m.Slice(offset, 8)
+	if err != nil {
+		return err
+	}
+	endianess.PutUint32(b, ptr)
+	endianess.PutUint32(b[4:], n)
+	return nil
+}
+
+// DefaultAlloc and DefaultDealloc are the names of the functions
+// allocating and freeing memory conventionally exported by the modules
+// written in Rust, and DefaultMalloc and DefaultFree the ones of the
+// modules written in C.
+const (
+	DefaultAlloc   = "alloc"
+	DefaultDealloc = "dealloc"
+	DefaultMalloc  = "malloc"
+	DefaultFree    = "free"
+)
+
+// GuestAllocator passes byte arrays and strings to a module through the
+// functions it exports to allocate and free its memory: the malloc and
+// free of C, or the alloc and dealloc a Rust module exports for the host
+// to pass it a Vec<u8>, which it rebuilds with Vec::from_raw_parts, and
+// to free the vectors it returns after std::mem::forget.
+//
+// The functions of GuestAllocator call the module and must not be called
+// by a host function in the middle of an access to the memory, see
+// UnsafeView.
+type GuestAllocator struct {
+	vm       *VM
+	alloc    int64
+	free     int64 // -1 if the module exports none
+	freeSize bool  // whether free takes the size of the memory freed
+}
+
+// GuestAllocator returns the allocator of vm calling the functions the
+// module exports as alloc, of type (i32) -> i32, and as free, of type
+// (i32) -> () like the free of C or (i32, i32) -> () like the dealloc
+// of Rust, taking the size of the memory freed. The allocator frees no
+// memory if free is empty. It returns ERR_GUEST_ALLOCATOR if the module
+// doesn't export such functions.
+func (vm *VM) GuestAllocator(alloc, free string) (*GuestAllocator, error) {
+	i32 := wasm.ValueTypeI32
+	a := &GuestAllocator{vm: vm, free: -1}
+	export, ok := vm.ExportedFunction(alloc)
+	if !ok || !sameTypes(export.Sig.ParamTypes, []wasm.ValueType{i32}) || !sameTypes(export.Sig.ReturnTypes, []wasm.ValueType{i32}) {
+		return nil, ERR_GUEST_ALLOCATOR
+	}
+	a.alloc = int64(export.Index)
+	if free == "" {
+		return a, nil
+	}
+	export, ok = vm.ExportedFunction(free)
+	if !ok || len(export.Sig.ReturnTypes) != 0 {
+		return nil, ERR_GUEST_ALLOCATOR
+	}
+	switch {
+	case sameTypes(export.Sig.ParamTypes, []wasm.ValueType{i32}):
+	case sameTypes(export.Sig.ParamTypes, []wasm.ValueType{i32, i32}):
+		a.freeSize = true
+	default:
+		return nil, ERR_GUEST_ALLOCATOR
+	}
+	a.free = int64(export.Index)
+	return a, nil
+}
+
+// Alloc allocates n bytes in the memory of the module, and returns their
+// address. It returns ERR_GUEST_ALLOCATOR if the allocation fails or
+// returns memory out of bounds.
+func (a *GuestAllocator) Alloc(n uint32) (uint32, error) {
+	res, err := a.vm.ExecCodeRaw(a.alloc, uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	ptr := uint32(res)
+	if ptr == 0 && n != 0 || uint64(ptr)+uint64(n) > uint64(a.vm.LinearMemory().Size()) {
+		return 0, ERR_GUEST_ALLOCATOR
+	}
+	return ptr, nil
+}
+
+// Free frees the n bytes at ptr, allocated by the module or by Alloc.
+func (a *GuestAllocator) Free(ptr, n uint32) error {
+	if a.free < 0 {
+		return nil
+	}
+	args := []uint64{uint64(ptr)}
+	if a.freeSize {
+		args = append(args, uint64(n))
+	}
+	_, err := a.vm.ExecCodeRaw(a.free, args...)
+	return err
+}
+
+// LowerBytes copies b to newly allocated memory, and returns its address
+// and its length.
+func (a *GuestAllocator) LowerBytes(b []byte) (ptr, n uint32, err error) {
+	if ptr, err = a.Alloc(uint32(len(b))); err != nil {
+		return 0, 0, err
+	}
+	return ptr, uint32(len(b)), a.vm.LinearMemory().WriteBytes(ptr, b)
+}
+
+// LowerString copies s to newly allocated memory, and returns its address
+// and its length in bytes.
+func (a *GuestAllocator) LowerString(s string) (ptr, n uint32, err error) {
+	if ptr, err = a.Alloc(uint32(len(s))); err != nil {
+		return 0, 0, err
+	}
+	return ptr, uint32(len(s)), a.vm.LinearMemory().WriteString(ptr, s)
+}
+
+// LowerCString copies s, followed by a NUL byte, to newly allocated
+// memory, and returns its address. It returns ERR_CANON_VALUE if s holds
+// a NUL byte.
+func (a *GuestAllocator) LowerCString(s string) (uint32, error) {
+	if strings.IndexByte(s, 0) >= 0 {
+		return 0, ERR_CANON_VALUE
+	}
+	ptr, err := a.Alloc(uint32(len(s)) + 1)
+	if err != nil {
+		return 0, err
+	}
+	mem := a.vm.LinearMemory()
+	if err := mem.WriteString(ptr, s); err != nil {
+		return 0, err
+	}
+	return ptr, mem.WriteUint8(ptr+uint32(len(s)), 0)
+}
+
+// TakeBytes returns a copy of the n bytes at ptr, which the module gave
+// up, and frees them: a Rust vector returned with std::mem::forget, or a
+// buffer returned by malloc.
+func (a *GuestAllocator) TakeBytes(ptr, n uint32) ([]byte, error) {
+	b, err := a.vm.LinearMemory().ReadBytes(ptr, n)
+	if err != nil {
+		return nil, err
+	}
+	return b, a.Free(ptr, n)
+}
+
+// The class identifiers of the objects of the AssemblyScript runtime.
+const (
+	asArrayBufferID = 1
+	asStringID      = 2
+)
+
+// AssemblyScriptABI lifts and lowers the strings and the array buffers of
+// the modules compiled by AssemblyScript, which are objects of its
+// runtime: their address is preceded by a header holding the identifier
+// of their class and their size in bytes, and the strings are encoded in
+// UTF-16. The objects are allocated by the __new function the module
+// exports with --exportRuntime, and pinned with __pin, if exported, not
+// to be collected before the module holds them: the objects lowered must
+// be unpinned with Unpin once passed.
+type AssemblyScriptABI struct {
+	vm         *VM
+	alloc      int64 // -1 if the module doesn't export its runtime
+	pin, unpin int64
+}
+
+// AssemblyScriptABI returns the AssemblyScript ABI of vm. The values of
+// a module which doesn't export its runtime can only be lifted: lowering
+// them returns ERR_GUEST_ALLOCATOR.
+func (vm *VM) AssemblyScriptABI() *AssemblyScriptABI {
+	abi := &AssemblyScriptABI{vm: vm, alloc: -1, pin: -1, unpin: -1}
+	i32 := wasm.ValueTypeI32
+	find := func(name string, params, results []wasm.ValueType) int64 {
+		export, ok := vm.ExportedFunction(name)
+		if !ok || !sameTypes(export.Sig.ParamTypes, params) || !sameTypes(export.Sig.ReturnTypes, results) {
+			return -1
+		}
+		return int64(export.Index)
+	}
+	abi.alloc = find("__new", []wasm.ValueType{i32, i32}, []wasm.ValueType{i32})
+	abi.pin = find("__pin", []wasm.ValueType{i32}, []wasm.ValueType{i32})
+	abi.unpin = find("__unpin", []wasm.ValueType{i32}, nil)
+	return abi
+}
+
+// object returns the bytes of the object of class id at ptr.
+func (abi *AssemblyScriptABI) object(ptr, id uint32) ([]byte, error) {
+	if ptr < 8 {
+		return nil, ERR_GUEST_OBJECT
+	}
+	mem := abi.vm.LinearMemory()
+	header, err := mem.Slice(ptr-8, 8)
+	if err != nil {
+		return nil, err
+	}
+	if endianess.Uint32(header) != id {
+		return nil, ERR_GUEST_OBJECT
+	}
+	return mem.ReadBytes(ptr, endianess.Uint32(header[4:]))
+}
+
+// newObject allocates and pins an object of class id holding b, and
+// returns its address.
+func (abi *AssemblyScriptABI) newObject(b []byte, id uint32) (uint32, error) {
+	if abi.alloc < 0 {
+		return 0, ERR_GUEST_ALLOCATOR
+	}
+	res, err := abi.vm.ExecCodeRaw(abi.alloc, uint64(len(b)), uint64(id))
+	if err != nil {
+		return 0, err
+	}
+	ptr := uint32(res)
+	if abi.pin >= 0 {
+		if _, err := abi.vm.ExecCodeRaw(abi.pin, uint64(ptr)); err != nil {
+			return 0, err
+		}
+	}
+	return ptr, abi.vm.LinearMemory().WriteBytes(ptr, b)
+}
+
+// Unpin unpins the object at ptr lowered by abi, for the runtime to
+// collect it once the module doesn't hold it anymore.
+func (abi *AssemblyScriptABI) Unpin(ptr uint32) error {
+	if abi.unpin < 0 {
+		return nil
+	}
+	_, err := abi.vm.ExecCodeRaw(abi.unpin, uint64(ptr))
+	return err
+}
+
+// LiftString returns the string at ptr. It returns ERR_GUEST_OBJECT if ptr
+// isn't the address of a string.
+func (abi *AssemblyScriptABI) LiftString(ptr uint32) (string, error) {
+	b, err := abi.object(ptr, asStringID)
+	if err != nil {
+		return "", err
+	}
+	if len(b)%2 != 0 {
+		return "", ERR_GUEST_OBJECT
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = endianess.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// LowerString allocates a string holding s, and returns its address.
+func (abi *AssemblyScriptABI) LowerString(s string) (uint32, error) {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		endianess.PutUint16(b[2*i:], u)
+	}
+	return abi.newObject(b, asStringID)
+}
+
+// LiftArrayBuffer returns a copy of the bytes of the ArrayBuffer at ptr.
+// It returns ERR_GUEST_OBJECT if ptr isn't the address of an ArrayBuffer.
+func (abi *AssemblyScriptABI) LiftArrayBuffer(ptr uint32) ([]byte, error) {
+	return abi.object(ptr, asArrayBufferID)
+}
+
+// LowerArrayBuffer allocates an ArrayBuffer holding b, and returns its
+// address.
+func (abi *AssemblyScriptABI) LowerArrayBuffer(b []byte) (uint32, error) {
+	return abi.newObject(b, asArrayBufferID)
+}
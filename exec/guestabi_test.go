@@ -0,0 +1,157 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newGuestABIVM(t *testing.T) *VM {
+	compiled, err := CompileModule(readTestModule(t, "testdata/guest-abi.wasm"), VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { inst.Close() })
+	return inst.NewVM()
+}
+
+// callExport calls the function exported as name, and returns its raw
+// result.
+func callExport(t *testing.T, vm *VM, name string, args ...uint64) uint64 {
+	t.Helper()
+	export, ok := vm.ExportedFunction(name)
+	if !ok {
+		t.Fatalf("no export %s", name)
+	}
+	res, err := vm.ExecCodeRaw(int64(export.Index), args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestGuestAllocator(t *testing.T) {
+	vm := newGuestABIVM(t)
+	if _, err := vm.GuestAllocator("sum", ""); err != ERR_GUEST_ALLOCATOR {
+		t.Errorf("allocator of the wrong type: got=%v", err)
+	}
+	if _, err := vm.GuestAllocator(DefaultAlloc, "sum"); err != ERR_GUEST_ALLOCATOR {
+		t.Errorf("free of the wrong type: got=%v", err)
+	}
+	rust, err := vm.GuestAllocator(DefaultAlloc, DefaultDealloc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ptr, n, err := rust.LowerBytes([]byte{1, 2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := callExport(t, vm, "sum", uint64(ptr), uint64(n)); sum != 10 {
+		t.Errorf("sum of the lowered bytes: got=%d, want=10", sum)
+	}
+	ptr, n = UnpackPtrLen(callExport(t, vm, "iota", 5))
+	b, err := rust.TakeBytes(ptr, n)
+	if err != nil || !bytes.Equal(b, []byte{0, 1, 2, 3, 4}) {
+		t.Errorf("TakeBytes: got=%v, %v", b, err)
+	}
+	if freed := callExport(t, vm, "freed"); freed != 5 {
+		t.Errorf("dealloc freed %d bytes, want 5", freed)
+	}
+	if PackPtrLen(ptr, n) != uint64(ptr)<<32|5 {
+		t.Errorf("PackPtrLen(%d, %d) = %#x", ptr, n, PackPtrLen(ptr, n))
+	}
+
+	c, err := vm.GuestAllocator(DefaultMalloc, DefaultFree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptr, err = c.LowerCString("bottos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := vm.LinearMemory()
+	if s, err := mem.ReadCString(ptr, 64); err != nil || s != "bottos" {
+		t.Errorf("lowered C string: got=%q, %v", s, err)
+	}
+	if _, err := c.LowerCString("a\x00b"); err != ERR_CANON_VALUE {
+		t.Errorf("C string with a NUL byte: got=%v", err)
+	}
+
+	ptr, n, err = c.LowerString("pair")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.WritePtrLen(64, ptr, n); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := mem.ReadPtrLen(64); err != nil || string(b) != "pair" {
+		t.Errorf("ReadPtrLen: got=%q, %v", b, err)
+	}
+	if err := mem.WriteUint32(68, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.ReadPtrLen(64); err == nil {
+		t.Error("ReadPtrLen of a slice out of bounds succeeded")
+	}
+}
+
+func TestAssemblyScriptABI(t *testing.T) {
+	vm := newGuestABIVM(t)
+	abi := vm.AssemblyScriptABI()
+
+	if s, err := abi.LiftString(264); err != nil || s != "hi" {
+		t.Errorf("LiftString: got=%q, %v", s, err)
+	}
+	if b, err := abi.LiftArrayBuffer(296); err != nil || !bytes.Equal(b, []byte{1, 2, 3}) {
+		t.Errorf("LiftArrayBuffer: got=%v, %v", b, err)
+	}
+	if _, err := abi.LiftString(296); err != ERR_GUEST_OBJECT {
+		t.Errorf("LiftString of an ArrayBuffer: got=%v", err)
+	}
+	if _, err := abi.LiftString(4); err != ERR_GUEST_OBJECT {
+		t.Errorf("LiftString of a null address: got=%v", err)
+	}
+
+	ptr, err := abi.LowerString("héllo, 世界 🙂")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := abi.LiftString(ptr); err != nil || s != "héllo, 世界 🙂" {
+		t.Errorf("lifting a lowered string: got=%q, %v", s, err)
+	}
+	buf, err := abi.LowerArrayBuffer([]byte{9, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := abi.LiftArrayBuffer(buf); err != nil || !bytes.Equal(b, []byte{9, 8}) {
+		t.Errorf("lifting a lowered ArrayBuffer: got=%v, %v", b, err)
+	}
+	if pins := callExport(t, vm, "pins"); pins != 2 {
+		t.Errorf("%d objects pinned, want 2", pins)
+	}
+	abi.Unpin(ptr)
+	abi.Unpin(buf)
+	if pins := callExport(t, vm, "pins"); pins != 0 {
+		t.Errorf("%d objects pinned after Unpin, want 0", pins)
+	}
+}
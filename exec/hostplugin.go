@@ -0,0 +1,116 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// HostModuleProvider is implemented by the optional host modules a node
+// loads at startup from Go plugins, such as oracles or privacy
+// precompiles, see LoadHostModules.
+type HostModuleProvider interface {
+	// Name returns the name of the module, for the errors and the logs.
+	Name() string
+	// Register registers the host functions of the module into env, like
+	// RegisterChainContext.
+	Register(env *EnvFunc) error
+}
+
+// HostModuleSymbol is the symbol a plugin exports its HostModuleProvider
+// as: a variable holding a provider, or a function returning one.
+const HostModuleSymbol = "HostModule"
+
+// HostPluginError is returned for a plugin which couldn't be loaded, or
+// whose host module failed to register.
+type HostPluginError struct {
+	Path string
+	Err  error
+}
+
+func (e HostPluginError) Error() string {
+	return fmt.Sprintf("exec: host plugin %s: %v", e.Path, e.Err)
+}
+
+func (e HostPluginError) Unwrap() error {
+	return e.Err
+}
+
+// LoadHostModule opens the Go plugin at path, built with
+// -buildmode=plugin against the same version of this package, and
+// returns the HostModuleProvider it exports as HostModuleSymbol. Plugins
+// are only supported on the platforms of the plugin package, with cgo,
+// and are never unloaded.
+func LoadHostModule(path string) (HostModuleProvider, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, HostPluginError{path, err}
+	}
+	sym, err := p.Lookup(HostModuleSymbol)
+	if err != nil {
+		return nil, HostPluginError{path, err}
+	}
+	provider, err := hostModuleOf(sym)
+	if err != nil {
+		return nil, HostPluginError{path, err}
+	}
+	return provider, nil
+}
+
+// hostModuleOf returns the HostModuleProvider of sym, the symbol exported
+// by a plugin as HostModuleSymbol.
+func hostModuleOf(sym plugin.Symbol) (HostModuleProvider, error) {
+	switch sym := sym.(type) {
+	case *HostModuleProvider:
+		if *sym != nil {
+			return *sym, nil
+		}
+	case func() HostModuleProvider:
+		if provider := sym(); provider != nil {
+			return provider, nil
+		}
+	case HostModuleProvider:
+		// a variable of a type implementing the interface, whose
+		// address is the symbol
+		return sym, nil
+	default:
+		return nil, fmt.Errorf("%s is a %T, not a HostModuleProvider", HostModuleSymbol, sym)
+	}
+	return nil, fmt.Errorf("%s is nil", HostModuleSymbol)
+}
+
+// LoadHostModules loads the host modules of the plugins at the given
+// paths, see LoadHostModule, and registers them into env in this order.
+// The host functions already registered, by the VM or by a previous
+// module, aren't replaced. It returns the modules registered before the
+// first error.
+func LoadHostModules(env *EnvFunc, paths ...string) ([]HostModuleProvider, error) {
+	var providers []HostModuleProvider
+	for _, path := range paths {
+		provider, err := LoadHostModule(path)
+		if err != nil {
+			return providers, err
+		}
+		if err := provider.Register(env); err != nil {
+			return providers, HostPluginError{path, fmt.Errorf("module %s: %w", provider.Name(), err)}
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
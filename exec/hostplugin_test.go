@@ -0,0 +1,59 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+type testHostModule struct{}
+
+func (testHostModule) Name() string { return "test" }
+
+func (testHostModule) Register(env *EnvFunc) error {
+	env.Register("test_host", func(vm *VM) (bool, error) { return true, nil })
+	return nil
+}
+
+func TestHostModuleOf(t *testing.T) {
+	var provider HostModuleProvider = testHostModule{}
+	var module testHostModule
+	for _, sym := range []interface{}{
+		&provider,
+		func() HostModuleProvider { return provider },
+		&module,
+	} {
+		if got, err := hostModuleOf(sym); err != nil || got.Name() != "test" {
+			t.Errorf("%T: got=%v, %v", sym, got, err)
+		}
+	}
+	var missing HostModuleProvider
+	for _, sym := range []interface{}{&missing, func() HostModuleProvider { return nil }, new(int)} {
+		if _, err := hostModuleOf(sym); err == nil {
+			t.Errorf("%T: no error", sym)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "missing.so")
+	var pluginErr HostPluginError
+	if _, err := LoadHostModules(NewEnvFunc(), path); !errors.As(err, &pluginErr) || pluginErr.Path != path {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
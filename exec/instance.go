@@ -0,0 +1,692 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/log"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// Instance holds the mutable state of one instantiation of a Module: its
+// linear memory, globals and tables. The compiled Module it was created
+// from is never modified, so any number of instances can be created from
+// it with Instantiate.
+type Instance struct {
+	compiled *Module
+	imports  map[string]func(*VM) (bool, error)
+
+	memory []byte
+	// the address space reserved for the memory when it is mapped, see
+	// VMConfig.MappedMemory
+	mapping []byte
+	// the number of bytes of the mapping that are accessible
+	committed int
+	// the state of the memory when it is declared shared, see Spawn
+	shared *sharedMemory
+	// whether the memory is indexed by i64 addresses, as defined by the
+	// memory64 proposal
+	memory64 bool
+	// the size in bytes of the pages of the memory, 64 KiB unless it
+	// declares another one, as defined by the custom-page-sizes proposal
+	pageSize int
+	// the memories after the first one, see swapMemory
+	memories []linearMemory
+	// the callbacks of the invalidation of the views of the memory, see
+	// (Memory).OnInvalidate
+	viewHooks []*viewHook
+	// the epochs of the last writes to the pages of the memory, nil unless
+	// its writes are tracked, and the epoch of the writes, see trackWrites
+	written    []uint64
+	writeEpoch uint64
+	globals    []uint64
+	// the length of the memory when instantiated, see Reset
+	initialMemory int
+	// the size the memory can grow to
+	maxMemory uint64
+	// the elements of the tables, indexed by table index: function
+	// indices in funcref tables, and handles in externref tables, see
+	// ExternRef
+	tables [][]uint32
+	// the Go values of the externref handles, indexed by handle, which
+	// also reference the objects of the GC proposal, see gcObject
+	externs []interface{}
+	// the handles of the i31ref values, the handles released by
+	// collectObjects, and the number of objects allocated since and left
+	// by the last collection
+	i31s        map[i31]uint32
+	freeHandles []uint32
+	allocated   int
+	liveObjects int
+	// the number of calls into the instance in progress, the objects
+	// being collected at the end of the outermost one
+	activeCalls int
+	// the passive data and element segments, nil once dropped by data.drop
+	// or elem.drop, or for the active segments already copied
+	dataSegments [][]byte
+	elemSegments [][]uint32
+	// the exception tags, indexed by tag index
+	tags []*Tag
+	// the compiled functions of the module, with their own call_indirect
+	// caches since those depend on the table
+	compiledFuncs []compiledFunction
+
+	memPos uint64
+	// define a map relationship between memory address and data's type
+	memType map[uint64]*typeInfo
+
+	// the pages of the memory reported to VMConfig.Metrics, see
+	// reportMemory
+	reportedPages int
+	// the number of calls, resets and restores of the instance, and for a
+	// fork the instance it was forked from and its generation since the
+	// fork was last in sync with it, see Fork
+	generation     uint64
+	forkOf         *Instance
+	forkGeneration uint64
+	// the policy of the calls reentering the contract the instance runs,
+	// see SetReentrancyPolicy
+	reentrancy *ReentrancyPolicy
+	// the store the instance was instantiated in, see InstantiateIn, the
+	// tables it imports from the store, indexed by table index, and the
+	// values of the globals it imports from the store, by global index
+	store         *Store
+	linked        []*storeTable
+	linkedGlobals map[uint32]uint64
+
+	closed bool
+	// whether the owner of the instance is responsible for closing it,
+	// instead of the VM it was created for by NewVMFromModule
+	closeExpected bool
+}
+
+// Instantiate creates a new instance of m, resolving the functions the
+// module imports from "env" against imports. A nil imports uses the
+// default env functions, see NewEnvFunc. If the module defines a start
+// function, it will be executed.
+func (m *Module) Instantiate(imports *EnvFunc) (*Instance, error) {
+	return m.instantiate(nil, imports)
+}
+
+// instantiate creates a new instance of m, linked to the store s if it
+// isn't nil, see InstantiateIn.
+func (m *Module) instantiate(s *Store, imports *EnvFunc) (*Instance, error) {
+	module := m.module
+
+	if imports == nil {
+		imports = NewEnvFunc()
+	}
+
+	inst := &Instance{
+		compiled: m,
+		imports:  imports.envFuncMap,
+	}
+
+	if len(module.LinearMemoryIndexSpace) <= 0 {
+		return nil, ERR_INVALID_WASM
+	}
+	if m.config.DisjointDataSegments {
+		if err := checkDataOverlap(module); err != nil {
+			return nil, err
+		}
+	}
+
+	// only the first memory can be shared, see Spawn
+	memories := module.Memories()
+	for i, mem := range memories {
+		if i > 0 && mem.Limits.Shared() {
+			return nil, ERR_MULTIPLE_LINEAR_MEMORIES
+		}
+	}
+
+	tags, err := newTags(module, imports)
+	if err != nil {
+		return nil, err
+	}
+	inst.tags = tags
+
+	var linked *storeMemory
+	if s != nil {
+		inst.store = s
+		if linked, err = s.link(inst); err != nil {
+			return nil, err
+		}
+	}
+	if linked != nil {
+		inst.linkMemory(linked)
+	} else if err := inst.allocateMemory(); err != nil {
+		return nil, err
+	}
+	inst.memories = newMemories(memories)
+	runtime.SetFinalizer(inst, (*Instance).finalize)
+
+	if err := inst.init(); err != nil {
+		inst.Close()
+		return nil, err
+	}
+
+	inst.closeExpected = true
+	if sink := m.config.Metrics; sink != nil {
+		sink.Count(MetricInstantiations, "", 1)
+		inst.reportMemory()
+	}
+	return inst, nil
+}
+
+// allocateMemory allocates the first memory of inst, zeroed.
+func (inst *Instance) allocateMemory() error {
+	m, module := inst.compiled, inst.compiled.module
+	size, capacity, maxSize := wasmPageSize, wasmPageSize, uint64(maxMemoryPages*wasmPageSize)
+	inst.pageSize = wasmPageSize
+	if limits, ok := module.MemoryLimits(); ok {
+		size, maxSize = memorySize(limits)
+		capacity = size
+		inst.memory64 = limits.Memory64()
+		inst.pageSize = limits.PageSize()
+		if m.staticMemorySize != 0 || limits.Shared() {
+			// the memory never moves nor shrinks, so the initial
+			// memory stays addressable until the instance is discarded
+			capacity = int(maxSize)
+		}
+		if limits.Shared() {
+			inst.shared = &sharedMemory{size: size, refs: 1}
+		}
+	}
+	if err := m.limitInstance(uint64(size), maxSize); err != nil {
+		return err
+	}
+	// the reservation must fit in the address space
+	if m.config.MappedMemory && maxSize >= uint64(size) && maxSize+memoryGuardSize <= uint64(^uint(0)>>1) {
+		// the platform may not support it, fall back to the heap
+		if mapping, err := mapMemory(size, int(maxSize)); err == nil {
+			inst.mapping = mapping
+			inst.committed = size
+			inst.memory = mapping[:size:maxSize]
+		}
+	}
+	if inst.mapping == nil {
+		if pool := m.config.MemoryPool; pool != nil {
+			inst.memory = pool.Get(size, capacity)
+		} else {
+			inst.memory = make([]byte, size, capacity)
+		}
+	}
+
+	inst.initialMemory = len(inst.memory)
+	inst.maxMemory = maxSize
+	return nil
+}
+
+// checkDataOverlap returns ERR_DATA_OVERLAP if active data segments of
+// module overlap in a memory. The offsets were already checked when
+// reading the module.
+func checkDataOverlap(module *wasm.Module) error {
+	segments, err := module.DataSegments()
+	if err != nil {
+		return err
+	}
+	type span struct {
+		index      uint32
+		start, end uint64
+	}
+	var spans []span
+	for _, segment := range segments {
+		if segment.Mode != wasm.SegmentActive || len(segment.Data) == 0 {
+			continue
+		}
+		spans = append(spans, span{segment.Memory, segment.Offset, segment.End()})
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].index != spans[j].index {
+			return spans[i].index < spans[j].index
+		}
+		return spans[i].start < spans[j].start
+	})
+	for i := 1; i < len(spans); i++ {
+		if spans[i].index == spans[i-1].index && spans[i].start < spans[i-1].end {
+			return ERR_DATA_OVERLAP
+		}
+	}
+	return nil
+}
+
+// init sets the memory, tables and globals of inst to their initial
+// values, and runs the start function of the module. The memory must be
+// zeroed.
+func (inst *Instance) init() error {
+	module := inst.compiled.module
+
+	indexSpaceLen := len(module.LinearMemoryIndexSpace[0])
+	if inst.shared != nil && inst.shared.store != nil {
+		// the memory of the store holds the data of other instances
+		if err := inst.copyDataSegments(); err != nil {
+			return err
+		}
+	} else if copy(inst.memory, module.LinearMemoryIndexSpace[0]) != indexSpaceLen {
+		return ERR_CREATE_VM
+	}
+	inst.memPos = uint64(indexSpaceLen)
+	for i, mem := range inst.memories {
+		data := module.LinearMemoryIndexSpace[i+1]
+		if copy(mem.memory, data) != len(data) {
+			return ERR_CREATE_VM
+		}
+	}
+
+	inst.memType = make(map[uint64]*typeInfo)
+
+	if module.Data != nil {
+		for _, funcList := range module.Data.Entries {
+			// the types are only tracked in the first memory
+			if funcList.Mode != wasm.SegmentActive || funcList.Index != 0 {
+				continue
+			}
+			value, err := module.ExecInitExpr(funcList.Offset)
+			if err != nil {
+				return err
+			}
+
+			// the offsets of a 64-bit memory are i64 values
+			var index int64
+			switch value := value.(type) {
+			case int32:
+				index = int64(value)
+			case int64:
+				index = value
+			default:
+				return ERR_DATA_INDEX
+			}
+
+			// if it contains multi-function(splited by '0')
+			if !bytes.Contains(funcList.Data, []byte{byte(0)}) {
+				inst.memType[uint64(index)] = &typeInfo{Type: String, Len: uint64(len(funcList.Data))}
+			} else {
+				var idx = int(index)
+				funcArray := bytes.Split(funcList.Data, []byte{byte(0)})
+				for _, function := range funcArray {
+					inst.memType[uint64(idx)] = &typeInfo{Type: String, Len: uint64(len(function) + 1)}
+					idx += len(function) + 1
+				}
+			}
+		}
+	} else {
+		inst.memPos = uint64(len(inst.memory) / 2)
+	}
+
+	if err := inst.initState(); err != nil {
+		return err
+	}
+
+	if module.Start != nil {
+		if _, err := inst.NewVM().ExecCode(int64(module.Start.Index)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// initState sets the tables, segments and globals of inst to their
+// initial values, leaving its memory alone.
+func (inst *Instance) initState() error {
+	module := inst.compiled.module
+
+	inst.tables = make([][]uint32, len(module.TableIndexSpace))
+	for i, elems := range module.TableIndexSpace {
+		inst.tables[i] = append([]uint32(nil), elems...)
+	}
+	inst.externs, inst.i31s, inst.freeHandles = nil, nil, nil
+	inst.allocated, inst.liveObjects = 0, 0
+
+	inst.dataSegments, inst.elemSegments = nil, nil
+	if module.Data != nil {
+		inst.dataSegments = make([][]byte, len(module.Data.Entries))
+		for i, segment := range module.Data.Entries {
+			if segment.Mode == wasm.SegmentPassive {
+				inst.dataSegments[i] = segment.Data
+			}
+		}
+	}
+	if module.Elements != nil {
+		inst.elemSegments = make([][]uint32, len(module.Elements.Entries))
+		for i, segment := range module.Elements.Entries {
+			if segment.Mode == wasm.SegmentPassive {
+				inst.elemSegments[i] = segment.Elems
+			}
+		}
+	}
+
+	if inst.compiledFuncs == nil {
+		inst.compiledFuncs = make([]compiledFunction, len(inst.compiled.funcs))
+		for i, fn := range inst.compiled.funcs {
+			fn.callSites = make([]callSiteCache, len(fn.callSites))
+			inst.compiledFuncs[i] = fn
+		}
+	} else {
+		inst.resetCallSites()
+	}
+
+	// the globals are laid out in slots, see disasm.Slots
+	slots := disasm.GlobalSlots(module)
+	if inst.globals == nil {
+		inst.globals = make([]uint64, slots[len(module.GlobalIndexSpace)])
+	}
+	for i, global := range module.GlobalIndexSpace {
+		val, err := module.ExecInitExpr(global.Init)
+		if err != nil {
+			return err
+		}
+		slot := slots[i]
+		switch v := val.(type) {
+		case int32:
+			inst.globals[slot] = uint64(v)
+		case int64:
+			inst.globals[slot] = uint64(v)
+		case float32:
+			inst.globals[slot] = uint64(math.Float32bits(v))
+		case float64:
+			inst.globals[slot] = uint64(math.Float64bits(v))
+		case wasm.Ref:
+			inst.globals[slot] = uint64(v)
+		case wasm.V128:
+			inst.globals[slot] = endianess.Uint64(v[:8])
+			inst.globals[slot+1] = endianess.Uint64(v[8:])
+		}
+	}
+
+	if inst.store != nil {
+		return inst.initLinked()
+	}
+	return nil
+}
+
+// resetCallSites clears the call_indirect caches of inst, which hold
+// elements of the tables.
+func (inst *Instance) resetCallSites() {
+	for _, fn := range inst.compiledFuncs {
+		for i := range fn.callSites {
+			fn.callSites[i] = callSiteCache{}
+		}
+	}
+}
+
+// Reset restores inst to the state it had right after being instantiated:
+// the memory is cleared and shrunk back to its initial size, the data
+// segments, tables and globals are initialized again, and the start
+// function runs again. Reset lets an instance be reused for another
+// call instead of instantiating the module again, see InstancePool. A
+// shared memory can't be reset while other instances share it, see Spawn.
+func (inst *Instance) Reset() error {
+	if inst.closed {
+		return ERR_INSTANCE_CLOSED
+	}
+	if s := inst.shared; s != nil {
+		s.mu.Lock()
+		if s.refs > 1 {
+			s.mu.Unlock()
+			return ERR_MEMORY_SHARED
+		}
+		s.size = inst.initialMemory
+		s.mu.Unlock()
+	}
+	memory := inst.memory[:inst.initialMemory]
+	for i := range memory {
+		memory[i] = 0
+	}
+	inst.memory = memory
+	inst.invalidateViews()
+	for i := range inst.memories {
+		mem := &inst.memories[i]
+		mem.memory = mem.memory[:mem.initialMemory]
+		for j := range mem.memory {
+			mem.memory[j] = 0
+		}
+	}
+
+	if limit := inst.compiled.config.RetainedMemory; limit > 0 && inst.heldMemory() > limit {
+		inst.ReleaseMemory()
+	}
+
+	inst.generation++
+	err := inst.init()
+	inst.wroteAll()
+	inst.reportMemory()
+	return err
+}
+
+// heldMemory returns the number of bytes of memory held by inst for its
+// linear memory.
+func (inst *Instance) heldMemory() int {
+	if inst.mapping != nil {
+		return inst.committed
+	}
+	return cap(inst.memory)
+}
+
+// ReleaseMemory returns the memory held by inst past the current size of
+// its linear memory, which is left over when the memory shrinks back with
+// Reset after it grew, or when its capacity was doubled. The content of
+// the linear memory is preserved. It returns the number of bytes released.
+func (inst *Instance) ReleaseMemory() int {
+	size := len(inst.memory)
+	switch {
+	case inst.shared != nil:
+		// the memory never moves, see sharedMemory
+		return 0
+	case inst.mapping != nil:
+		if inst.committed <= size || decommitMemory(inst.mapping[size:inst.committed]) != nil {
+			return 0
+		}
+		released := inst.committed - size
+		inst.committed = size
+		return released
+	case inst.compiled.staticMemorySize != 0:
+		// the memory was allocated to its maximum size on purpose
+		return 0
+	case cap(inst.memory) > size:
+		released := cap(inst.memory) - size
+		memory := make([]byte, size)
+		copy(memory, inst.memory)
+		inst.memory = memory
+		inst.invalidateViews()
+		return released
+	}
+	return 0
+}
+
+// Close releases the resources held by inst: its memory is returned to
+// the memory pool of its module or unmapped, and the host functions it
+// imports are detached. Calling a function of inst afterwards fails with
+// ERR_INSTANCE_CLOSED. Instances must be closed once they aren't needed
+// anymore, the ones garbage collected without being closed are logged.
+func (inst *Instance) Close() error {
+	if inst.closed {
+		return ERR_INSTANCE_CLOSED
+	}
+	inst.closed = true
+	runtime.SetFinalizer(inst, nil)
+	inst.reportMemory()
+
+	switch {
+	case inst.shared != nil && !inst.shared.release():
+		// the memory is released with the last instance sharing it
+	case inst.shared != nil && inst.shared.store != nil:
+		// the memory belongs to the store
+	case inst.mapping != nil:
+		unmapMemory(inst.mapping)
+	case inst.compiled.config.MemoryPool != nil && inst.memory != nil:
+		inst.compiled.config.MemoryPool.Put(inst.memory)
+	}
+	inst.memory, inst.mapping, inst.committed = nil, nil, 0
+	inst.invalidateViews()
+	inst.viewHooks = nil
+	inst.memories = nil
+	inst.imports = nil
+	inst.globals, inst.tables, inst.externs = nil, nil, nil
+	inst.i31s, inst.freeHandles = nil, nil
+	inst.dataSegments, inst.elemSegments = nil, nil
+	inst.compiledFuncs = nil
+	inst.memType = nil
+	return nil
+}
+
+// finalize closes an instance that is garbage collected without being
+// closed.
+func (inst *Instance) finalize() {
+	if inst.closeExpected {
+		log.Of(inst.compiled.config.Logger).Warnf("VM: an instance was garbage collected without being closed, %d bytes of memory leaked until now", inst.heldMemory())
+	}
+	inst.Close()
+}
+
+// Clone returns a new instance of the module of inst, with a copy of the
+// current memory, tables and globals of inst. The memory of the copy is
+// allocated on the heap. An instance of a Store can't be cloned.
+func (inst *Instance) Clone() (*Instance, error) {
+	if inst.closed {
+		return nil, ERR_INSTANCE_CLOSED
+	}
+	if inst.store != nil {
+		return nil, ERR_STORE_INSTANCE
+	}
+	if err := inst.compiled.limitInstance(uint64(len(inst.memory)), inst.maxMemory); err != nil {
+		return nil, err
+	}
+
+	inst.syncMemory()
+	capacity := len(inst.memory)
+	if inst.compiled.staticMemorySize != 0 || inst.shared != nil {
+		capacity = cap(inst.memory)
+	}
+	clone := &Instance{
+		compiled:      inst.compiled,
+		imports:       inst.imports,
+		memory:        make([]byte, len(inst.memory), capacity),
+		globals:       append([]uint64(nil), inst.globals...),
+		memory64:      inst.memory64,
+		pageSize:      inst.pageSize,
+		memories:      copyMemories(inst.memories),
+		initialMemory: inst.initialMemory,
+		maxMemory:     inst.maxMemory,
+		tables:        make([][]uint32, len(inst.tables)),
+		externs:       append([]interface{}(nil), inst.externs...),
+		freeHandles:   append([]uint32(nil), inst.freeHandles...),
+		allocated:     inst.allocated,
+		liveObjects:   inst.liveObjects,
+		dataSegments:  append([][]byte(nil), inst.dataSegments...),
+		elemSegments:  append([][]uint32(nil), inst.elemSegments...),
+		tags:          inst.tags,
+		compiledFuncs: make([]compiledFunction, len(inst.compiledFuncs)),
+		memPos:        inst.memPos,
+		memType:       make(map[uint64]*typeInfo, len(inst.memType)),
+	}
+	if inst.shared != nil {
+		// the copy is shared with the instances spawned from the clone
+		clone.shared = &sharedMemory{size: len(clone.memory), refs: 1}
+	}
+	copy(clone.memory, inst.memory)
+	for i, elems := range inst.tables {
+		clone.tables[i] = append([]uint32(nil), elems...)
+	}
+	for i, fn := range inst.compiledFuncs {
+		fn.callSites = make([]callSiteCache, len(fn.callSites))
+		clone.compiledFuncs[i] = fn
+	}
+	for addr, info := range inst.memType {
+		copied := *info
+		clone.memType[addr] = &copied
+	}
+	clone.copyObjects()
+
+	runtime.SetFinalizer(clone, (*Instance).finalize)
+	clone.closeExpected = true
+	return clone, nil
+}
+
+// copyObjects replaces the GC objects inst holds by copies, for inst not
+// to share them with the instance its handles were copied from, and
+// indexes its i31ref handles. The objects are mutable, the references
+// between them are handles which stay valid in the copy.
+func (inst *Instance) copyObjects() {
+	inst.i31s = nil
+	for handle, v := range inst.externs {
+		switch v := v.(type) {
+		case *gcObject:
+			inst.externs[handle] = &gcObject{typ: v.typ, fields: append([]uint64(nil), v.fields...)}
+		case i31:
+			if inst.i31s == nil {
+				inst.i31s = make(map[i31]uint32)
+			}
+			inst.i31s[v] = uint32(handle)
+		}
+	}
+}
+
+// Module returns the compiled module inst was instantiated from.
+func (inst *Instance) Module() *Module {
+	return inst.compiled
+}
+
+// Memory returns the linear memory of the instance. The whole memory
+// counts as written, see UnsafeView.
+func (inst *Instance) Memory() []byte {
+	inst.wroteAll()
+	return inst.memory
+}
+
+// NewVM returns a new execution context for inst. VMs created from the
+// same instance share its memory, globals and tables, and must not
+// execute concurrently.
+func (inst *Instance) NewVM() *VM {
+	module := inst.compiled.module
+
+	vm := &VM{
+		Instance:    inst,
+		config:      inst.compiled.config,
+		module:      module,
+		envFunc:     &EnvFunc{envFuncMap: inst.imports},
+		vmLock:      new(sync.Mutex),
+		typeIDs:     inst.compiled.typeIDs,
+		funcTypeIDs: inst.compiled.funcTypeIDs,
+	}
+
+	//it need modify if adding python or compiler change
+	if module.Other == nil {
+		vm.sourceFile = CPP
+	} else {
+		vm.sourceFile = JS
+	}
+	vm.newFuncTable()
+	if vm.config.SoftFloat {
+		vm.useSoftFloat()
+	}
+	if vm.config.CanonicalNaN {
+		vm.canonicalizeNaNs()
+	}
+	if vm.compiled.stackSlot >= 0 {
+		vm.checkGuestStack()
+	}
+
+	return vm
+}
@@ -0,0 +1,176 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestInstantiateIsolation(t *testing.T) {
+	compiled, err := CompileModule(readTestModule(t, "testdata/spec/globals.wasm"), VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const getX, setX = 2, 4
+	a, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Module() != compiled || b.Module() != compiled {
+		t.Fatal("instances don't share their compiled module")
+	}
+
+	if _, err := a.NewVM().ExecCode(setX, 7); err != nil {
+		t.Fatal(err)
+	}
+	a.Memory()[0] = 0xff
+
+	for _, test := range []struct {
+		name string
+		inst *Instance
+		x    uint32
+	}{
+		{"a", a, 7},
+		{"b", b, uint32(0xfffffff4)}, // -12
+	} {
+		x, err := test.inst.NewVM().ExecCode(getX)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x.(uint32) != test.x {
+			t.Errorf("%s: unexpected global value: got=%d, want=%d", test.name, x, test.x)
+		}
+	}
+	if b.Memory()[0] != 0 {
+		t.Error("memory writes leaked to another instance")
+	}
+}
+
+func TestInstanceClose(t *testing.T) {
+	pool := NewMemoryPool(16 * wasmPageSize)
+	compiled, err := CompileModule(readTestModule(t, "testdata/spec/globals.wasm"), VMConfig{MemoryPool: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := inst.NewVM()
+	if err := inst.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Idle() == 0 {
+		t.Error("memory wasn't returned to the pool")
+	}
+
+	if _, err := vm.ExecCode(2); err != ERR_INSTANCE_CLOSED {
+		t.Errorf("unexpected error calling a closed instance: %v", err)
+	}
+	if err := inst.Reset(); err != ERR_INSTANCE_CLOSED {
+		t.Errorf("unexpected error resetting a closed instance: %v", err)
+	}
+	if err := inst.Close(); err != ERR_INSTANCE_CLOSED {
+		t.Errorf("unexpected error closing an instance twice: %v", err)
+	}
+}
+
+func TestDisjointDataSegments(t *testing.T) {
+	// a page of memory, and the segments "ab" at 0 and "c" at 1
+	code := []byte("\x00asm\x01\x00\x00\x00" +
+		"\x05\x03\x01\x00\x01" +
+		"\x0b\x0e\x02\x00\x41\x00\x0b\x02ab\x00\x41\x01\x0b\x01c")
+	module, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	if got := string(inst.memory[:2]); got != "ac" {
+		t.Errorf("memory: got=%q, want=%q", got, "ac")
+	}
+
+	compiled, err = CompileModule(module, VMConfig{DisjointDataSegments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := compiled.Instantiate(nil); err != ERR_DATA_OVERLAP {
+		t.Errorf("got=%v, want=%v", err, ERR_DATA_OVERLAP)
+	}
+}
+
+func TestInstanceCall(t *testing.T) {
+	// a function exported as add, adding its two i32 parameters
+	code := []byte("\x00asm\x01\x00\x00\x00" +
+		"\x01\x07\x01\x60\x02\x7f\x7f\x01\x7f" +
+		"\x03\x02\x01\x00" +
+		"\x05\x03\x01\x00\x01" +
+		"\x07\x07\x01\x03add\x00\x00" +
+		"\x0a\x09\x01\x07\x00\x20\x00\x20\x01\x6a\x0b")
+	module, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := inst.Call("add", 2, int8(-3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != uint32(0xffffffff) {
+		t.Errorf("add: got=%v, want=[%d]", res, uint32(0xffffffff))
+	}
+	for _, tc := range []struct {
+		name string
+		args []interface{}
+		err  error
+	}{
+		{"add", []interface{}{1.5, 1}, ArgumentTypeError{Index: 0, Type: wasm.ValueTypeI32, Value: 1.5}},
+		{"add", []interface{}{1, int64(1) << 32}, ArgumentTypeError{Index: 1, Type: wasm.ValueTypeI32, Value: int64(1) << 32}},
+		{"add", []interface{}{1}, ERR_INVALID_ARGUMENT_COUNT},
+		{"sub", []interface{}{1, 2}, ERR_UNKNOWN_EXPORT},
+	} {
+		if _, err := inst.Call(tc.name, tc.args...); err != tc.err {
+			t.Errorf("%s%v: got=%v, want=%v", tc.name, tc.args, err, tc.err)
+		}
+	}
+}
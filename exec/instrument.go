@@ -0,0 +1,726 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"io"
+	"math"
+
+	"github.com/bottos-project/bottos/vm/wasm/transform"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// GAS_FUNCTION is the name of the env function called by the code
+// instrumented by InstrumentGas, with the cost of the block being entered.
+const GAS_FUNCTION = "gas"
+
+// InstrumentGas rewrites the binary code of a module so that it meters
+// itself: every basic block starts by calling the imported env.gas
+// function with the cost of its operators according to schedule, and
+// the module is re-encoded. Instrumented modules are run with a nil
+// schedule (see SetGasMeter), which keeps the interpreter loop free of
+// metering.
+//
+// A block is charged on entry for all its operators, including the ones
+// it doesn't run because of a branch or a trap. The function indices
+// shift by one past the imported functions, so the name section is
+// rewritten too, and dropped if it can't be read. The BulkByte cost of the
+// schedule depends on the operands, and isn't charged by instrumented code.
+func InstrumentGas(code []byte, schedule *GasSchedule) ([]byte, error) {
+	module, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		return nil, err
+	}
+	if module.Code == nil {
+		return code, nil
+	}
+
+	in := &instrumenter{module: module, costs: &schedule.Costs, miscCosts: &schedule.Misc, simdCosts: &schedule.SIMD, atomicCosts: &schedule.Atomic, gcCosts: &schedule.GC}
+	if err = in.init(); err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(code)+len(code)/4))
+	out.Write(code[:8]) // magic and version
+
+	others := module.Other
+	for _, id := range sectionOrder {
+		s := in.section(id)
+		for s != nil && len(others) > 0 && others[0].Start < s.Start {
+			in.writeCustomSection(out, others[0])
+			others = others[1:]
+		}
+
+		payload, err := in.rewriteSection(id, s)
+		if err != nil {
+			return nil, err
+		}
+		if payload != nil {
+			writeSection(out, id, payload)
+		}
+	}
+	for _, s := range others {
+		in.writeCustomSection(out, s)
+	}
+
+	return out.Bytes(), nil
+}
+
+// GasPass returns the pass of a transform.Pipeline instrumenting the
+// module with the costs of schedule, see InstrumentGas.
+func GasPass(schedule *GasSchedule) transform.Pass {
+	return transform.BinaryPass("gas", func(code []byte) ([]byte, error) {
+		return InstrumentGas(code, schedule)
+	})
+}
+
+// sectionOrder is the order of the known sections in a module, the data
+// count section coming before the code using it.
+var sectionOrder = []wasm.SectionID{
+	wasm.SectionIDType, wasm.SectionIDImport, wasm.SectionIDFunction,
+	wasm.SectionIDTable, wasm.SectionIDMemory, wasm.SectionIDTag, wasm.SectionIDGlobal,
+	wasm.SectionIDExport, wasm.SectionIDStart, wasm.SectionIDElement,
+	wasm.SectionIDDataCount, wasm.SectionIDCode, wasm.SectionIDData,
+}
+
+// instrumenter holds the state of InstrumentGas.
+type instrumenter struct {
+	module      *wasm.Module
+	costs       *[256]uint64
+	miscCosts   *[32]uint64
+	simdCosts   *[512]uint64
+	atomicCosts *[128]uint64
+	gcCosts     *[32]uint64
+
+	gasType    uint32 // index of the signature of the gas function
+	newGasType bool   // whether the signature is added to the module
+	gasFunc    uint32 // index of the gas function
+}
+
+func (in *instrumenter) init() error {
+	if in.module.Import != nil {
+		for _, entry := range in.module.Import.Entries {
+			if entry.Kind != wasm.ExternalFunction {
+				continue
+			}
+			if entry.ModuleName == "env" && entry.FieldName == GAS_FUNCTION {
+				return ERR_GAS_INSTRUMENTED
+			}
+			in.gasFunc++
+		}
+	}
+
+	in.gasType, in.newGasType = uint32(len(in.module.Types.Entries)), true
+	for i, sig := range in.module.Types.Entries {
+		if len(sig.ParamTypes) == 1 && sig.ParamTypes[0] == wasm.ValueTypeI32 && len(sig.ReturnTypes) == 0 {
+			in.gasType, in.newGasType = uint32(i), false
+			break
+		}
+	}
+	return nil
+}
+
+// section returns the section id of the module, or nil.
+func (in *instrumenter) section(id wasm.SectionID) *wasm.Section {
+	m := in.module
+	switch {
+	case id == wasm.SectionIDType && m.Types != nil:
+		return &m.Types.Section
+	case id == wasm.SectionIDImport && m.Import != nil:
+		return &m.Import.Section
+	case id == wasm.SectionIDFunction && m.Function != nil:
+		return &m.Function.Section
+	case id == wasm.SectionIDTable && m.Table != nil:
+		return &m.Table.Section
+	case id == wasm.SectionIDMemory && m.Memory != nil:
+		return &m.Memory.Section
+	case id == wasm.SectionIDTag && m.Tag != nil:
+		return &m.Tag.Section
+	case id == wasm.SectionIDGlobal && m.Global != nil:
+		return &m.Global.Section
+	case id == wasm.SectionIDExport && m.Export != nil:
+		return &m.Export.Section
+	case id == wasm.SectionIDStart && m.Start != nil:
+		return &m.Start.Section
+	case id == wasm.SectionIDElement && m.Elements != nil:
+		return &m.Elements.Section
+	case id == wasm.SectionIDCode && m.Code != nil:
+		return &m.Code.Section
+	case id == wasm.SectionIDData && m.Data != nil:
+		return &m.Data.Section
+	case id == wasm.SectionIDDataCount && m.DataCount != nil:
+		return &m.DataCount.Section
+	}
+	return nil
+}
+
+// rewriteSection returns the instrumented payload of the section id, or
+// nil if the instrumented module has no such section.
+func (in *instrumenter) rewriteSection(id wasm.SectionID, s *wasm.Section) ([]byte, error) {
+	var buf bytes.Buffer
+	switch id {
+	case wasm.SectionIDType:
+		if !in.newGasType {
+			return s.Bytes, nil
+		}
+		// func (param i32)
+		return appendEntry(s.Bytes, []byte{0x60, 1, 0x7f, 0})
+
+	case wasm.SectionIDImport:
+		writeName(&buf, "env")
+		writeName(&buf, GAS_FUNCTION)
+		buf.WriteByte(byte(wasm.ExternalFunction))
+		leb128.WriteVarUint32(&buf, in.gasType)
+		if s == nil {
+			return append([]byte{1}, buf.Bytes()...), nil
+		}
+		return appendEntry(s.Bytes, buf.Bytes())
+
+	case wasm.SectionIDExport:
+		if s == nil {
+			return nil, nil
+		}
+		return in.rewriteExports(s.Bytes)
+
+	case wasm.SectionIDGlobal:
+		if s == nil {
+			return nil, nil
+		}
+		// the initializer expressions may reference functions
+		leb128.WriteVarUint32(&buf, uint32(len(in.module.Global.Globals)))
+		for _, global := range in.module.Global.Globals {
+			writeValueType(&buf, global.Type.Type)
+			if global.Type.Mutable {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+			in.writeInitExpr(&buf, global.Init)
+		}
+		return buf.Bytes(), nil
+
+	case wasm.SectionIDStart:
+		if s == nil {
+			return nil, nil
+		}
+		leb128.WriteVarUint32(&buf, in.funcIndex(in.module.Start.Index))
+		return buf.Bytes(), nil
+
+	case wasm.SectionIDElement:
+		if s == nil {
+			return nil, nil
+		}
+		leb128.WriteVarUint32(&buf, uint32(len(in.module.Elements.Entries)))
+		for _, segment := range in.module.Elements.Entries {
+			writeElementHeader(&buf, segment)
+			leb128.WriteVarUint32(&buf, uint32(len(segment.Elems)))
+			for _, elem := range segment.Elems {
+				switch {
+				case !segment.Exprs:
+					leb128.WriteVarUint32(&buf, in.funcIndex(elem))
+				case elem == uint32(wasm.NullRef):
+					buf.WriteByte(ops.RefNull)
+					leb128.WriteVarint64(&buf, int64(segment.Type))
+					buf.WriteByte(ops.End)
+				default:
+					buf.WriteByte(ops.RefFunc)
+					leb128.WriteVarUint32(&buf, in.funcIndex(elem))
+					buf.WriteByte(ops.End)
+				}
+			}
+		}
+		return buf.Bytes(), nil
+
+	case wasm.SectionIDCode:
+		leb128.WriteVarUint32(&buf, uint32(len(in.module.Code.Bodies)))
+		for _, body := range in.module.Code.Bodies {
+			if err := in.writeBody(&buf, body); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	}
+
+	if s == nil {
+		return nil, nil
+	}
+	return s.Bytes, nil
+}
+
+// writeElementHeader writes the flags of segment, followed by its table
+// index, offset and element kind or type when its encoding has them.
+func writeElementHeader(buf *bytes.Buffer, segment wasm.ElementSegment) {
+	var flags byte
+	if segment.Exprs {
+		flags = 4
+	}
+	switch {
+	case segment.Mode == wasm.SegmentPassive:
+		buf.WriteByte(flags | 1)
+	case segment.Mode == wasm.SegmentDeclarative:
+		buf.WriteByte(flags | 3)
+	case segment.Index == 0:
+		buf.WriteByte(flags)
+		buf.Write(segment.Offset)
+		return
+	default:
+		buf.WriteByte(flags | 2)
+		leb128.WriteVarUint32(buf, segment.Index)
+		buf.Write(segment.Offset)
+	}
+	if segment.Exprs {
+		writeValueType(buf, segment.Type)
+	} else {
+		buf.WriteByte(0)
+	}
+}
+
+// writeInitExpr writes the initializer expression expr, with the index of
+// the function a ref.func references shifted.
+func (in *instrumenter) writeInitExpr(buf *bytes.Buffer, expr []byte) {
+	if len(expr) == 0 || expr[0] != ops.RefFunc {
+		buf.Write(expr)
+		return
+	}
+	r := bytes.NewReader(expr[1:])
+	index, _ := leb128.ReadVarUint32(r)
+	buf.WriteByte(ops.RefFunc)
+	leb128.WriteVarUint32(buf, in.funcIndex(index))
+	buf.Write(expr[len(expr)-r.Len():])
+}
+
+// funcIndex returns the index of the function index after instrumentation.
+func (in *instrumenter) funcIndex(index uint32) uint32 {
+	if index >= in.gasFunc {
+		return index + 1
+	}
+	return index
+}
+
+func (in *instrumenter) rewriteExports(payload []byte) ([]byte, error) {
+	// the exports are read back from the section, to keep their order
+	var buf bytes.Buffer
+	r := bytes.NewReader(payload)
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	leb128.WriteVarUint32(&buf, count)
+	for i := uint32(0); i < count; i++ {
+		name, err := readName(r)
+		if err != nil {
+			return nil, err
+		}
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		index, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		if wasm.External(kind) == wasm.ExternalFunction {
+			index = in.funcIndex(index)
+		}
+		buf.Write(name)
+		buf.WriteByte(kind)
+		leb128.WriteVarUint32(&buf, index)
+	}
+	return buf.Bytes(), nil
+}
+
+// meteredBlock is a straight sequence of operators, charged on entry.
+type meteredBlock struct {
+	start int
+	cost  uint64
+}
+
+func (in *instrumenter) writeBody(w *bytes.Buffer, body wasm.FunctionBody) error {
+	// split the code in blocks ending with a control operator, and compute
+	// their cost
+	blocks := []meteredBlock{{}}
+	r := bytes.NewReader(body.Code)
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		cost := in.costs[op]
+		if op == ops.PrefixMisc || op == ops.PrefixSIMD || op == ops.PrefixAtomic || op == ops.PrefixGC {
+			// peek at the sub-opcode, skipped along with the immediates
+			sub, err := leb128.ReadVarUint32(bytes.NewReader(body.Code[len(body.Code)-r.Len():]))
+			if err != nil {
+				return err
+			}
+			if _, err := ops.NewPrefixed(op, sub); err != nil {
+				return err
+			}
+			switch op {
+			case ops.PrefixMisc:
+				cost = in.miscCosts[sub]
+			case ops.PrefixSIMD:
+				cost = in.simdCosts[sub]
+			case ops.PrefixGC:
+				cost = in.gcCosts[sub]
+			default:
+				cost = in.atomicCosts[sub]
+			}
+		} else if _, err := ops.New(op); err != nil {
+			return err
+		}
+		if err := skipImmediates(r, op); err != nil {
+			return err
+		}
+		blocks[len(blocks)-1].cost += cost
+		switch op {
+		case ops.Block, ops.Loop, ops.If, ops.Else, ops.End, ops.BrIf,
+			ops.BrOnNull, ops.BrOnNonNull, ops.Try, ops.Catch, ops.CatchAll, ops.Delegate:
+			blocks = append(blocks, meteredBlock{start: len(body.Code) - r.Len()})
+		}
+	}
+
+	var code bytes.Buffer
+	leb128.WriteVarUint32(&code, uint32(len(body.Locals)))
+	for _, local := range body.Locals {
+		leb128.WriteVarUint32(&code, local.Count)
+		writeValueType(&code, local.Type)
+	}
+
+	r = bytes.NewReader(body.Code)
+	for pc := 0; pc < len(body.Code); pc = len(body.Code) - r.Len() {
+		if len(blocks) > 0 && blocks[0].start == pc {
+			in.writeCharge(&code, blocks[0].cost)
+			blocks = blocks[1:]
+		}
+
+		op, _ := r.ReadByte()
+		if op == ops.Call || op == ops.ReturnCall || op == ops.RefFunc {
+			index, _ := leb128.ReadVarUint32(r)
+			code.WriteByte(op)
+			leb128.WriteVarUint32(&code, in.funcIndex(index))
+			continue
+		}
+		skipImmediates(r, op)
+		code.Write(body.Code[pc : len(body.Code)-r.Len()])
+	}
+	code.WriteByte(ops.End)
+
+	leb128.WriteVarUint32(w, uint32(code.Len()))
+	w.Write(code.Bytes())
+	return nil
+}
+
+// writeCharge writes the call to the gas function charging cost.
+func (in *instrumenter) writeCharge(w *bytes.Buffer, cost uint64) {
+	for cost > 0 {
+		amount := cost
+		if amount > math.MaxUint32 {
+			amount = math.MaxUint32
+		}
+		w.WriteByte(ops.I32Const)
+		leb128.WriteVarint64(w, int64(int32(uint32(amount))))
+		w.WriteByte(ops.Call)
+		leb128.WriteVarUint32(w, in.gasFunc)
+		cost -= amount
+	}
+}
+
+// skipImmediates skips the immediate arguments of op.
+func skipImmediates(r *bytes.Reader, op byte) error {
+	var err error
+	switch {
+	case op == ops.Block, op == ops.Loop, op == ops.If, op == ops.Try:
+		// block types are type indices for multiple values
+		_, err = wasm.ReadBlockType(r)
+	case op == ops.CurrentMemory, op == ops.GrowMemory:
+		// the memory index
+		_, err = leb128.ReadVarUint32(r)
+	case op == ops.Br, op == ops.BrIf, op == ops.Call, op == ops.ReturnCall,
+		op == ops.BrOnNull, op == ops.BrOnNonNull, op == ops.CallRef, op == ops.ReturnCallRef,
+		op == ops.Catch, op == ops.Throw, op == ops.Rethrow, op == ops.Delegate,
+		op >= ops.GetLocal && op <= ops.SetGlobal:
+		_, err = leb128.ReadVarUint32(r)
+	case op == ops.BrTable:
+		var n uint32
+		if n, err = leb128.ReadVarUint32(r); err != nil {
+			return err
+		}
+		for i := uint64(0); i <= uint64(n) && err == nil; i++ {
+			_, err = leb128.ReadVarUint32(r)
+		}
+	case op == ops.CallIndirect, op == ops.ReturnCallIndirect:
+		// the type and table indices
+		if _, err = leb128.ReadVarUint32(r); err == nil {
+			_, err = leb128.ReadVarUint32(r)
+		}
+	case op == ops.RefFunc, op == ops.TableGet, op == ops.TableSet:
+		_, err = leb128.ReadVarUint32(r)
+	case op == ops.RefNull:
+		_, err = leb128.ReadVarint32(r)
+	case op == ops.SelectTyped:
+		var n uint32
+		if n, err = leb128.ReadVarUint32(r); err != nil {
+			return err
+		}
+		for i := uint32(0); i < n && err == nil; i++ {
+			_, err = wasm.ReadValueType(r)
+		}
+	case op >= ops.I32Load && op <= ops.I64Store32:
+		err = skipMemArg(r)
+	case op == ops.I32Const:
+		_, err = leb128.ReadVarint32(r)
+	case op == ops.I64Const:
+		_, err = leb128.ReadVarint64(r)
+	case op == ops.F32Const:
+		err = skipBytes(r, 4)
+	case op == ops.F64Const:
+		err = skipBytes(r, 8)
+	case op == ops.PrefixMisc:
+		// the sub-opcode, followed by one or two indices
+		var sub uint32
+		if sub, err = leb128.ReadVarUint32(r); err != nil {
+			return err
+		}
+		if _, err = leb128.ReadVarUint32(r); err != nil {
+			return err
+		}
+		switch sub {
+		case ops.MemoryInit, ops.MemoryCopy, ops.TableInit, ops.TableCopy:
+			_, err = leb128.ReadVarUint32(r)
+		}
+	case op == ops.PrefixSIMD:
+		// the sub-opcode, followed by a memory immediate, a lane index, or
+		// both, or by 16 bytes
+		var sub uint32
+		if sub, err = leb128.ReadVarUint32(r); err != nil {
+			return err
+		}
+		memory := sub <= ops.V128Store || sub >= ops.V128Load8Lane && sub <= ops.V128Load64Zero
+		if memory {
+			if err = skipMemArg(r); err != nil {
+				return err
+			}
+		}
+		switch {
+		case sub == ops.V128Const, sub == ops.I8x16Shuffle:
+			err = skipBytes(r, 16)
+		case sub >= ops.I8x16ExtractLaneS && sub <= ops.F64x2ReplaceLane,
+			sub >= ops.V128Load8Lane && sub <= ops.V128Store64Lane:
+			err = skipBytes(r, 1)
+		}
+	case op == ops.PrefixAtomic:
+		// the sub-opcode, followed by a memory immediate, or the reserved
+		// byte of atomic.fence
+		var sub uint32
+		if sub, err = leb128.ReadVarUint32(r); err != nil {
+			return err
+		}
+		if sub == ops.AtomicFence {
+			return skipBytes(r, 1)
+		}
+		err = skipMemArg(r)
+	case op == ops.PrefixGC:
+		// the sub-opcode, followed by up to two indices, or by a heap type
+		var sub uint32
+		if sub, err = leb128.ReadVarUint32(r); err != nil {
+			return err
+		}
+		n := 0
+		switch sub {
+		case ops.StructNew, ops.StructNewDefault, ops.ArrayNew, ops.ArrayNewDefault,
+			ops.ArrayGet, ops.ArrayGetS, ops.ArrayGetU, ops.ArraySet, ops.ArrayFill,
+			ops.RefTest, ops.RefTestNull, ops.RefCast, ops.RefCastNull:
+			n = 1
+		case ops.StructGet, ops.StructGetS, ops.StructGetU, ops.StructSet, ops.ArrayNewFixed, ops.ArrayCopy:
+			n = 2
+		}
+		for i := 0; i < n && err == nil; i++ {
+			_, err = leb128.ReadVarint32(r)
+		}
+	}
+	return err
+}
+
+// writeValueType writes the value type t, the references to a type of the
+// types section being written as nullable references to it.
+func writeValueType(w *bytes.Buffer, t wasm.ValueType) {
+	if t >= 0 {
+		w.WriteByte(0x63)
+	}
+	leb128.WriteVarint64(w, int64(t))
+}
+
+// skipMemArg skips a memory immediate: its alignment, followed by a memory
+// index if its bit 6 is set, and its offset, which may be a varuint64 on a
+// 64-bit memory.
+func skipMemArg(r *bytes.Reader) error {
+	align, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return err
+	}
+	if align&0x40 != 0 {
+		if _, err := leb128.ReadVarUint32(r); err != nil {
+			return err
+		}
+	}
+	_, err = leb128.ReadVarUint64(r)
+	return err
+}
+
+func skipBytes(r *bytes.Reader, n int) error {
+	if r.Len() < n {
+		return io.ErrUnexpectedEOF
+	}
+	_, err := r.Seek(int64(n), io.SeekCurrent)
+	return err
+}
+
+func (in *instrumenter) writeCustomSection(w *bytes.Buffer, s wasm.Section) {
+	payload := s.Bytes
+	if s.Name == "name" {
+		var err error
+		if payload, err = in.rewriteNames(payload); err != nil {
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	writeName(&buf, s.Name)
+	buf.Write(payload)
+	writeSection(w, wasm.SectionIDCustom, buf.Bytes())
+}
+
+// rewriteNames shifts the function indices of the function and local
+// names subsections of a name section.
+func (in *instrumenter) rewriteNames(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	r := bytes.NewReader(payload)
+	for r.Len() > 0 {
+		id, _ := r.ReadByte()
+		size, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		if r.Len() < int(size) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		sub := payload[len(payload)-r.Len():][:size]
+		r.Seek(int64(size), io.SeekCurrent)
+
+		switch id {
+		case 1: // function names
+			sub, err = in.rewriteNameMap(sub, func(r *bytes.Reader, w *bytes.Buffer) error {
+				name, err := readName(r)
+				w.Write(name)
+				return err
+			})
+		case 2: // local names
+			sub, err = in.rewriteNameMap(sub, func(r *bytes.Reader, w *bytes.Buffer) error {
+				count, err := leb128.ReadVarUint32(r)
+				if err != nil {
+					return err
+				}
+				leb128.WriteVarUint32(w, count)
+				for i := uint32(0); i < count; i++ {
+					index, err := leb128.ReadVarUint32(r)
+					if err != nil {
+						return err
+					}
+					name, err := readName(r)
+					if err != nil {
+						return err
+					}
+					leb128.WriteVarUint32(w, index)
+					w.Write(name)
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		buf.WriteByte(id)
+		leb128.WriteVarUint32(&buf, uint32(len(sub)))
+		buf.Write(sub)
+	}
+	return buf.Bytes(), nil
+}
+
+// rewriteNameMap shifts the function indices of a map from function
+// indices to values copied by value.
+func (in *instrumenter) rewriteNameMap(payload []byte, value func(*bytes.Reader, *bytes.Buffer) error) ([]byte, error) {
+	var buf bytes.Buffer
+	r := bytes.NewReader(payload)
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	leb128.WriteVarUint32(&buf, count)
+	for i := uint32(0); i < count; i++ {
+		index, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		leb128.WriteVarUint32(&buf, in.funcIndex(index))
+		if err = value(r, &buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// appendEntry appends entry to the vector payload.
+func appendEntry(payload, entry []byte) ([]byte, error) {
+	r := bytes.NewReader(payload)
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	leb128.WriteVarUint32(&buf, count+1)
+	buf.Write(payload[len(payload)-r.Len():])
+	buf.Write(entry)
+	return buf.Bytes(), nil
+}
+
+func writeSection(w *bytes.Buffer, id wasm.SectionID, payload []byte) {
+	leb128.WriteVarUint32(w, uint32(id))
+	leb128.WriteVarUint32(w, uint32(len(payload)))
+	w.Write(payload)
+}
+
+func writeName(w *bytes.Buffer, name string) {
+	leb128.WriteVarUint32(w, uint32(len(name)))
+	w.WriteString(name)
+}
+
+// readName reads a name, and returns its encoding.
+func readName(r *bytes.Reader) ([]byte, error) {
+	n, size, err := leb128.ReadVarUint32Size(r)
+	if err != nil {
+		return nil, err
+	}
+	if uint32(r.Len()) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	r.Seek(-int64(size), io.SeekCurrent)
+	name := make([]byte, int(size)+int(n))
+	_, err = io.ReadFull(r, name)
+	return name, err
+}
@@ -0,0 +1,170 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/transform"
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestInstrumentGas(t *testing.T) {
+	code := readTestCode(t, "testdata/spec/fac.wasm")
+	instrumented, err := InstrumentGas(code, DefaultGasSchedule())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = InstrumentGas(instrumented, DefaultGasSchedule()); err != ERR_GAS_INSTRUMENTED {
+		t.Errorf("unexpected error instrumenting twice: %v", err)
+	}
+
+	module, err := wasm.ReadModule(bytes.NewReader(instrumented), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = validate.VerifyModule(module); err != nil {
+		t.Fatal(err)
+	}
+	facIter := int64(module.Export.Entries["fac-iter"].Index)
+	facRec := int64(module.Export.Entries["fac-rec"].Index)
+
+	// the pass of a pipeline instruments the module alike
+	pipeline := transform.New(GasPass(DefaultGasSchedule()))
+	pipeline.Resolve = importer
+	piped, err := pipeline.Run(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipedModule, err := wasm.ReadModule(bytes.NewReader(piped), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, body := range module.Code.Bodies {
+		if !bytes.Equal(pipedModule.Code.Bodies[i].Code, body.Code) {
+			t.Errorf("function %d: the gas pass differs from InstrumentGas", i)
+		}
+	}
+
+	for _, config := range []VMConfig{{}, {AOT: true}} {
+		vm, err := NewVMWithConfig(module, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meter := NewGasMeter(1 << 20)
+		vm.SetGasMeter(meter, nil)
+
+		for _, fn := range []int64{facIter, facRec} {
+			res, err := vm.ExecCode(fn, 20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != uint64(2432902008176640000) {
+				t.Errorf("aot=%v: unexpected result: %v", config.AOT, res)
+			}
+			if vm.GasUsed() == 0 || vm.GasUsed() > meter.Used() {
+				t.Errorf("aot=%v: unexpected gas used: %d, meter=%d", config.AOT, vm.GasUsed(), meter.Used())
+			}
+		}
+
+		// the instrumented module traps once out of gas
+		vm.SetGasMeter(NewGasMeter(vm.GasUsed()-1), nil)
+		func() {
+			defer func() {
+				if err := trapValue(recover()); err != ErrOutOfGas {
+					t.Errorf("aot=%v: unexpected trap: %v", config.AOT, err)
+				}
+			}()
+			vm.ExecCode(facRec, 20)
+		}()
+	}
+}
+
+func TestInstrumentGasSpec(t *testing.T) {
+	files, err := filepath.Glob("testdata/spec/*.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		code, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		module, err := wasm.ReadModule(bytes.NewReader(code), importer)
+		if err != nil || validate.VerifyModule(module) != nil {
+			continue
+		}
+
+		instrumented, err := InstrumentGas(code, DefaultGasSchedule())
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		module, err = wasm.ReadModule(bytes.NewReader(instrumented), importer)
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		if err = validate.VerifyModule(module); err != nil {
+			t.Errorf("%s: instrumented module is invalid: %v", file, err)
+		}
+	}
+}
+
+func TestOptimizations(t *testing.T) {
+	code := readTestCode(t, "testdata/optimize.wasm")
+	optimized, err := transform.New(transform.Optimizations()...).Run(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range [][]byte{code, optimized} {
+		module, err := wasm.ReadModule(bytes.NewReader(code), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vm, err := NewVM(module)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, err := vm.ExecCode(int64(module.Export.Entries["run"].Index), 5); err != nil || res != uint32(50) {
+			t.Errorf("run: got=%v %v, want=50", res, err)
+		}
+	}
+
+	// the unused function removed traps if it is called anyway
+	module, err := wasm.ReadModule(bytes.NewReader(optimized), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r interface{}
+	func() {
+		defer func() { r = recover() }()
+		vm.ExecCode(1)
+	}()
+	if code := TrapCodeOf(r); code != TrapUnreachable {
+		t.Errorf("got trap %v (%v), want %v", code, r, TrapUnreachable)
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sort"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// An instance snapshot taken by Instance.Snapshot has the following
+// layout:
+//
+//	magic       [4]byte  "\x00bvs"
+//	version     uint32   instanceSnapshotVersion
+//	fingerprint [32]byte see moduleFingerprint
+//	payload
+//
+// The payload holds the memories, the tables, the globals, whether the
+// passive segments were dropped, and the memory bookkeeping of the
+// instance. All integers are little endian.
+const (
+	instanceSnapshotMagic   = "\x00bvs"
+	instanceSnapshotVersion = 1
+)
+
+// Snapshot captures the state of inst between two calls, for Restore to
+// bring an instance of the same module back to it: the content of its
+// memories, its tables and globals, and the segments it dropped. The
+// snapshot is a versioned binary blob which can be stored, for the
+// contracts whose memory persists across calls, or to recover a long
+// computation after a crash. It returns ERR_SNAPSHOT_REFS if inst holds
+// externref handles or objects of the GC proposal, which are Go values.
+func (inst *Instance) Snapshot() ([]byte, error) {
+	if inst.closed {
+		return nil, ERR_INSTANCE_CLOSED
+	}
+	for _, v := range inst.externs {
+		if v != nil {
+			return nil, ERR_SNAPSHOT_REFS
+		}
+	}
+	inst.syncMemory()
+
+	w := &compiledWriter{}
+	w.WriteString(instanceSnapshotMagic)
+	w.uint32(instanceSnapshotVersion)
+	fingerprint := moduleFingerprint(inst.compiled.module)
+	w.Write(fingerprint[:])
+
+	w.uint32(uint32(1 + len(inst.memories)))
+	w.bytes(inst.memory)
+	for _, mem := range inst.memories {
+		w.bytes(mem.memory)
+	}
+	w.uint32(uint32(len(inst.tables)))
+	for _, elems := range inst.tables {
+		w.uint32(uint32(len(elems)))
+		for _, elem := range elems {
+			w.uint32(elem)
+		}
+	}
+	w.values(inst.globals)
+	w.uint32(uint32(len(inst.dataSegments)))
+	for _, data := range inst.dataSegments {
+		w.bool(data == nil)
+	}
+	w.uint32(uint32(len(inst.elemSegments)))
+	for _, elems := range inst.elemSegments {
+		w.bool(elems == nil)
+	}
+
+	w.uint64(inst.memPos)
+	addrs := make([]uint64, 0, len(inst.memType))
+	for addr := range inst.memType {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	w.uint32(uint32(len(addrs)))
+	for _, addr := range addrs {
+		w.uint64(addr)
+		w.uint64(uint64(inst.memType[addr].Type))
+		w.uint64(inst.memType[addr].Len)
+	}
+	return w.Bytes(), nil
+}
+
+// instanceSnapshot is a decoded snapshot of an instance.
+type instanceSnapshot struct {
+	memories     [][]byte
+	tables       [][]uint32
+	globals      []uint64
+	droppedData  []bool
+	droppedElems []bool
+	memPos       uint64
+	memType      map[uint64]*typeInfo
+}
+
+// Restore brings inst back to the state captured by snapshot, taken by
+// Snapshot from an instance of the same module: its memories grow or
+// shrink to their size in the snapshot, and their content, tables, globals
+// and segments are replaced by the ones of the snapshot. The externref
+// handles and objects inst holds are released. It returns
+// ERR_SNAPSHOT_FORMAT for invalid data, ERR_SNAPSHOT_MISMATCH for a
+// snapshot of another module, or whose sizes are out of the limits of
+// the module, and the error of the ResourceLimiter of the module, or
+// ERR_RESOURCE_LIMIT, for a memory or table it forbids to grow. inst is
+// left unchanged on an error, but for a memory failing to be allocated,
+// which leaves inst partially restored.
+func (inst *Instance) Restore(snapshot []byte) error {
+	if inst.closed {
+		return ERR_INSTANCE_CLOSED
+	}
+	s, err := decodeInstanceSnapshot(snapshot, inst.compiled.module)
+	if err != nil {
+		return err
+	}
+	if err := inst.checkSnapshot(s); err != nil {
+		return err
+	}
+
+	inst.generation++
+	inst.syncMemory()
+	for i, data := range s.memories {
+		inst.swapMemory(uint32(i))
+		if len(data) > len(inst.memory) {
+			if inst.growMemory(uint32((len(data)-len(inst.memory))/inst.pageSize)) < 0 {
+				inst.swapMemory(uint32(i))
+				return ERR_RESOURCE_LIMIT
+			}
+		} else {
+			if len(data) < len(inst.memory) {
+				inst.invalidateViews()
+			}
+			inst.memory = inst.memory[:len(data)]
+			if sh := inst.shared; sh != nil {
+				sh.mu.Lock()
+				sh.size = len(data)
+				sh.mu.Unlock()
+			}
+		}
+		copy(inst.memory, data)
+		inst.swapMemory(uint32(i))
+	}
+	inst.wroteAll()
+	inst.tables = s.tables
+	inst.resetCallSites()
+	copy(inst.globals, s.globals)
+	inst.externs, inst.i31s, inst.freeHandles = nil, nil, nil
+	inst.allocated, inst.liveObjects = 0, 0
+
+	module := inst.compiled.module
+	for i, dropped := range s.droppedData {
+		inst.dataSegments[i] = nil
+		if segment := module.Data.Entries[i]; !dropped && segment.Mode == wasm.SegmentPassive {
+			inst.dataSegments[i] = segment.Data
+		}
+	}
+	for i, dropped := range s.droppedElems {
+		inst.elemSegments[i] = nil
+		if segment := module.Elements.Entries[i]; !dropped && segment.Mode == wasm.SegmentPassive {
+			inst.elemSegments[i] = segment.Elems
+		}
+	}
+	inst.memPos, inst.memType = s.memPos, s.memType
+	inst.reportMemory()
+	return nil
+}
+
+// decodeInstanceSnapshot decodes a snapshot taken by Instance.Snapshot
+// from an instance of module.
+func decodeInstanceSnapshot(data []byte, module *wasm.Module) (*instanceSnapshot, error) {
+	r := &compiledReader{data: data}
+	if string(r.next(4)) != instanceSnapshotMagic || r.uint32() != instanceSnapshotVersion {
+		return nil, ERR_SNAPSHOT_FORMAT
+	}
+	fingerprint := moduleFingerprint(module)
+	if !bytes.Equal(r.next(sha256.Size), fingerprint[:]) {
+		if r.err != nil {
+			return nil, ERR_SNAPSHOT_FORMAT
+		}
+		return nil, ERR_SNAPSHOT_MISMATCH
+	}
+
+	s := &instanceSnapshot{}
+	// every memory takes at least 4 bytes, and so does every table
+	s.memories = make([][]byte, r.count(4))
+	for i := range s.memories {
+		s.memories[i] = r.bytes()
+	}
+	s.tables = make([][]uint32, r.count(4))
+	for i := range s.tables {
+		s.tables[i] = make([]uint32, r.count(4))
+		for j := range s.tables[i] {
+			s.tables[i][j] = r.uint32()
+		}
+	}
+	s.globals = r.values()
+	s.droppedData = make([]bool, r.count(1))
+	for i := range s.droppedData {
+		s.droppedData[i] = r.bool()
+	}
+	s.droppedElems = make([]bool, r.count(1))
+	for i := range s.droppedElems {
+		s.droppedElems[i] = r.bool()
+	}
+
+	s.memPos = r.uint64()
+	s.memType = make(map[uint64]*typeInfo)
+	for i, n := 0, r.count(24); i < n; i++ {
+		addr := r.uint64()
+		s.memType[addr] = &typeInfo{Type: Type(r.uint64()), Len: r.uint64()}
+	}
+	if r.err != nil || len(r.data) != 0 {
+		return nil, ERR_SNAPSHOT_FORMAT
+	}
+	return s, nil
+}
+
+// checkSnapshot checks that the state of s fits the memories, tables and
+// globals of inst, and asks the ResourceLimiter of its module, if any,
+// whether they can grow to their size in s.
+func (inst *Instance) checkSnapshot(s *instanceSnapshot) error {
+	if len(s.memories) != 1+len(inst.memories) || len(s.tables) != len(inst.tables) ||
+		len(s.globals) != len(inst.globals) || len(s.droppedData) != len(inst.dataSegments) ||
+		len(s.droppedElems) != len(inst.elemSegments) {
+		return ERR_SNAPSHOT_MISMATCH
+	}
+	limiter := inst.compiled.config.ResourceLimiter
+	for i, data := range s.memories {
+		current, initial, pageSize, max := len(inst.memory), inst.initialMemory, inst.pageSize, inst.maxMemory
+		if i > 0 {
+			mem := inst.memories[i-1]
+			current, initial, pageSize, max = len(mem.memory), mem.initialMemory, mem.pageSize, mem.maxMemory
+		}
+		size := len(data)
+		if size < initial || uint64(size) > max || size%pageSize != 0 {
+			return ERR_SNAPSHOT_MISMATCH
+		}
+		if size <= current {
+			if i == 0 && inst.shared != nil && size < current {
+				// the memory of the other instances can't shrink
+				inst.shared.mu.Lock()
+				refs := inst.shared.refs
+				inst.shared.mu.Unlock()
+				if refs > 1 {
+					return ERR_MEMORY_SHARED
+				}
+			}
+			continue
+		}
+		if limiter != nil {
+			if ok, err := limiter.MemoryGrowing(uint64(current), uint64(size), max); err != nil {
+				return err
+			} else if !ok {
+				return ERR_RESOURCE_LIMIT
+			}
+		}
+	}
+	for i, usage := range inst.Tables() {
+		size := uint32(len(s.tables[i]))
+		if size < uint32(len(inst.compiled.module.TableIndexSpace[i])) || size > usage.Max {
+			return ERR_SNAPSHOT_MISMATCH
+		}
+		if limiter != nil && size > usage.Size {
+			if ok, err := limiter.TableGrowing(usage.Size, size, usage.Max); err != nil {
+				return err
+			} else if !ok {
+				return ERR_RESOURCE_LIMIT
+			}
+		}
+	}
+	return nil
+}
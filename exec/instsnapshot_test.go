@@ -0,0 +1,109 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestInstanceSnapshot(t *testing.T) {
+	module := readTestModule(t, "testdata/instance-snapshot.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newInstance := func() *Instance {
+		inst, err := compiled.Instantiate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { inst.Close() })
+		return inst
+	}
+	call := func(inst *Instance, name string, args ...interface{}) interface{} {
+		t.Helper()
+		res, err := inst.Call(name, args...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(res) == 0 {
+			return nil
+		}
+		return res[0]
+	}
+
+	inst := newInstance()
+	call(inst, "bump")
+	call(inst, "bump")
+	call(inst, "grow")
+	call(inst, "growtable")
+	snapshot, err := inst.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the memory grows, and the segment is dropped, after the snapshot
+	call(inst, "bump")
+	call(inst, "grow")
+	call(inst, "drop")
+	// check restores the state of the snapshot into inst
+	check := func(inst *Instance) {
+		t.Helper()
+		if err := inst.Restore(snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if got := call(inst, "load", 16); got != uint32(2) {
+			t.Errorf("memory: got=%v, want=2", got)
+		}
+		if got := inst.MemoryPages(); got != 2 {
+			t.Errorf("pages: got=%d, want=2", got)
+		}
+		if got := inst.Tables()[0].Size; got != 3 {
+			t.Errorf("table: got=%d, want=3", got)
+		}
+		if got := call(inst, "bump"); got != uint32(3) {
+			t.Errorf("global: got=%v, want=3", got)
+		}
+		// the segment isn't dropped in the snapshot
+		call(inst, "init")
+		if got := call(inst, "load", 100); got != uint32(0x6c6c6568) {
+			t.Errorf("data: got=%#x, want=%#x", got, 0x6c6c6568)
+		}
+	}
+	check(inst)
+	check(newInstance())
+
+	if err := inst.Restore(snapshot[:len(snapshot)-1]); err != ERR_SNAPSHOT_FORMAT {
+		t.Errorf("truncated snapshot: err=%v", err)
+	}
+	otherModule, err := CompileModule(readTestModule(t, "testdata/usage.wasm"), VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := otherModule.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := other.Restore(snapshot); err != ERR_SNAPSHOT_MISMATCH {
+		t.Errorf("other module: err=%v", err)
+	}
+
+	inst.ExternRef("host value")
+	if _, err := inst.Snapshot(); err != ERR_SNAPSHOT_REFS {
+		t.Errorf("externref: err=%v", err)
+	}
+}
@@ -60,6 +60,7 @@ import (
 	"encoding/binary"
 
 	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
 	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
 )
 
@@ -74,7 +75,8 @@ import (
 // operator. A block with a signature will push a value of that type on the parent
 // stack (that is, the stack of the parent block where this block started). The
 // OpDiscardPreserveTop operator allows us to preserve this value while
-// discarding the remaining ones.
+// discarding the remaining ones, and OpDiscardPreserve does the same for the
+// several values of a block with multiple results.
 
 // Branches are rewritten as
 //     <jmp> <addr>
@@ -90,21 +92,100 @@ var (
 	// stack is not zero. It also discards elements and optionally preserves
 	// the topmost value on the stack
 	OpJmpNz byte = 0x0d
+	// OpJmpNull jumps to the given address if the reference at the top of
+	// the stack is null, and OpJmpNonNull if it isn't. The reference is
+	// popped when it is null.
+	OpJmpNull    byte = 0xd6
+	OpJmpNonNull byte = 0xd5
 	// OpDiscard discards a given number of elements from the execution stack.
 	OpDiscard byte = 0x0b
 	// OpDiscardPreserveTop discards a given number of elements from the
 	// execution stack, while preserving the value on the top of the stack.
 	OpDiscardPreserveTop byte = 0x05
+	// OpDiscardPreserve discards a given number of elements from the
+	// execution stack, while preserving the given number of values on
+	// the top of the stack. It is followed by the 8 byte number of values
+	// to preserve, and the 8 byte number of elements to discard.
+	OpDiscardPreserve byte = 0x06
+	// OpUnchecked precedes a memory access instruction whose effective
+	// address has been proven to be in bounds, the VM executes the access
+	// without checking it against the size of the linear memory.
+	OpUnchecked byte = 0x02
+	// OpMeter starts a basic block, see Options.BasicBlocks. It is followed
+	// by the 4 byte index of the block.
+	OpMeter byte = 0x04
+	// OpMemory precedes a memory instruction accessing a memory other than
+	// the first one, which the VM executes on that memory. It is followed
+	// by the 4 byte index of the memory.
+	OpMemory byte = 0x07
 )
 
+// Options control the optional optimizations performed by Compile.
+type Options struct {
+	// StaticMemorySize is the number of bytes of linear memory that are
+	// guaranteed to be addressable for the whole lifetime of the function.
+	// Memory accesses with a constant effective address below it are
+	// compiled without a bounds check. Zero disables the optimization.
+	StaticMemorySize uint64
+	// BasicBlocks starts every basic block (a straight sequence of
+	// instructions only entered at its start) with an OpMeter instruction,
+	// and records the opcodes of its instructions, for the VM to charge
+	// their cost at once.
+	BasicBlocks bool
+	// Locals is the number of local slots of the function, after which
+	// the locals holding the exceptions caught by rethrown handlers are
+	// laid out, see Handler.
+	Locals int
+}
+
+// accessWidth returns the number of bytes accessed by a load or
+// store instruction.
+func accessWidth(op byte) uint64 {
+	switch op {
+	case ops.I32Load8s, ops.I32Load8u, ops.I64Load8s, ops.I64Load8u, ops.I32Store8, ops.I64Store8:
+		return 1
+	case ops.I32Load16s, ops.I32Load16u, ops.I64Load16s, ops.I64Load16u, ops.I32Store16, ops.I64Store16:
+		return 2
+	case ops.I32Load, ops.F32Load, ops.I64Load32s, ops.I64Load32u, ops.I32Store, ops.F32Store, ops.I64Store32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// staticAddress returns the constant base address of the memory access at
+// disassembly[i], if the address operand is pushed by an i32.const right
+// before the access (or before the single instruction pushing the stored
+// value).
+func staticAddress(disassembly []disasm.Instr, i int) (uint32, bool) {
+	op := disassembly[i].Op
+	j := i - 1
+	if op.Returns == wasm.ValueType(wasm.BlockTypeEmpty) {
+		// stores have the value operand on top of the address
+		if j < 0 {
+			return 0, false
+		}
+		switch disassembly[j].Op.Code {
+		case ops.I32Const, ops.I64Const, ops.F32Const, ops.F64Const, ops.GetLocal, ops.GetGlobal:
+			j--
+		default:
+			return 0, false
+		}
+	}
+	if j < 0 || disassembly[j].Unreachable || disassembly[j].Op.Code != ops.I32Const {
+		return 0, false
+	}
+	return uint32(disassembly[j].Immediates[0].(int32)), true
+}
+
 // Target is the "target" of a br_table instruction.
 // Unlike other control instructions, br_table does jumps and discarding all
 // by itself.
 type Target struct {
-	Addr        int64 // The absolute address of the target
-	Discard     int64 // The number of elements to discard
-	PreserveTop bool  // Whether the top of the stack is to be preserved
-	Return      bool  // Whether to return in order to take this branch/target
+	Addr     int64 // The absolute address of the target
+	Discard  int64 // The number of elements to discard
+	Preserve int   // The number of values on the top of the stack to preserve
+	Return   bool  // Whether to return in order to take this branch/target
 }
 
 // BranchTable is the structure pointed to by a rewritten br_table instruction.
@@ -112,11 +193,86 @@ type Target struct {
 //     br_table <table_index>
 // where <table_index> is the index to an array of
 // BranchTable objects stored by the VM.
+//
+// Targets is a dense jump table: br_table pops an int value and jumps to
+// Targets[val], and the default target is stored as the last element, so
+// any val >= len(Targets)-1 is clamped to it with a single bounds check.
 type BranchTable struct {
-	Targets       []Target // A list of targets, br_table pops an int value, and jumps to Targets[val]
-	DefaultTarget Target   // If val > len(Targets), the VM will jump here
-	patchedAddrs  []int64  // A list of already patched addresses
-	blocksLen     int      // The length of the blocks map in Compile when this table was initialized
+	Targets []Target
+}
+
+// Target returns the target taken by br_table for the given operand.
+func (table *BranchTable) Target(val uint32) *Target {
+	last := uint32(len(table.Targets) - 1)
+	if val > last {
+		val = last
+	}
+	return &table.Targets[val]
+}
+
+// Handler describes the exception handlers of a try block. An exception
+// thrown while running the body of the block, between the addresses Start
+// (excluded) and End (included), is caught by the first of Catches with
+// its tag, or else by CatchAll. The stack is unwound to Height slots
+// before jumping to the handler, and the exception is stored in the local
+// slot Local if the handler rethrows it. The exceptions thrown in the body
+// of a try block ending with delegate skip the next Skip handlers instead.
+// A rewritten throw or rethrow instruction is of the format:
+//     throw <tag_index>
+//     rethrow <local_slot>
+type Handler struct {
+	Start, End int64
+	Height     int64
+	Catches    []Catch
+	CatchAll   int64 // -1 without catch_all
+	Local      int64 // -1 if the exception isn't rethrown
+	Delegate   bool
+	Skip       int
+}
+
+// Catch is a catch clause of a try block, jumping to Addr for the
+// exceptions with the tag at index Tag.
+type Catch struct {
+	Tag  uint32
+	Addr int64
+}
+
+// tablePatch refers to a br_table target whose address is only known
+// once the block it branches to is closed.
+type tablePatch struct {
+	table *BranchTable
+	index int
+}
+
+// BytecodeMetadata describes the side tables produced while compiling a
+// function body, which the VM needs in addition to the compiled bytecode.
+type BytecodeMetadata struct {
+	BranchTables []*BranchTable
+	// The number of call_indirect sites in the compiled body. A rewritten
+	// call_indirect instruction is of the format:
+	//     call_indirect <type_index> <site_index> <table_index>
+	// where <site_index> indexes the per-function inline cache kept by the
+	// VM.
+	CallIndirectSites int
+	// The opcodes of the instructions of every basic block, indexed by the
+	// immediate of its OpMeter instruction, if Options.BasicBlocks is set.
+	BasicBlocks [][]byte
+	// The handlers of the try blocks, the innermost ones coming first,
+	// and the number of local slots they take after Options.Locals.
+	Handlers []Handler
+	Locals   int
+	// SourceOffsets maps the compiled bytecode back to the instructions
+	// it was compiled from, in the order of the bytecode.
+	SourceOffsets []SourceOffset
+}
+
+// SourceOffset is the start of the compiled code of an instruction: the
+// bytecode from Compiled up to the next SourceOffset comes from the
+// instruction at Offset in the code of the function, see
+// disasm.Instr.Offset.
+type SourceOffset struct {
+	Compiled int64
+	Offset   int
 }
 
 // block stores the information relevant for a block created by a control operator
@@ -145,33 +301,162 @@ type block struct {
 	patchOffsets []int64 // A list of offsets in the bytecode stream that need to be patched with the correct jump addresses
 
 	discard      disasm.StackInfo // Information about the stack created in this block, used while creating Discard instructions
-	branchTables []*BranchTable   // All branch tables that were defined in this block.
+	tablePatches []tablePatch     // br_table targets branching to this block that need to be patched with its address
+
+	// The handlers of a block created by a 'try' operator, and whether
+	// its body ended with the first catch
+	handler  *Handler
+	catching bool
 }
 
 // Compile rewrites WebAssembly bytecode from its disassembly.
 // TODO(vibhavp): Add options for optimizing code. Operators like i32.reinterpret/f32
 // are no-ops, and can be safely removed.
-func Compile(disassembly []disasm.Instr) ([]byte, []*BranchTable) {
+func Compile(disassembly []disasm.Instr, opts Options) ([]byte, *BytecodeMetadata) {
 	buffer := new(bytes.Buffer)
 	branchTables := []*BranchTable{}
+	callIndirectSites := 0
+	var handlers []Handler
+	exceptionLocals := 0
+
+	var basicBlocks [][]byte
+	meterEnd := int64(-1) // the offset following the last OpMeter
+	// writeOp writes op, recording it in the current basic block.
+	writeOp := func(op byte) {
+		buffer.WriteByte(op)
+		if n := len(basicBlocks); n != 0 {
+			basicBlocks[n-1] = append(basicBlocks[n-1], op)
+		}
+	}
+	// startBlock starts a new basic block at the current offset, and
+	// returns the address to jump to for entering it.
+	startBlock := func() int64 {
+		if !opts.BasicBlocks {
+			return int64(buffer.Len())
+		}
+		if int64(buffer.Len()) == meterEnd {
+			// the current block is still empty
+			return meterEnd - 5
+		}
+		start := int64(buffer.Len())
+		buffer.WriteByte(OpMeter)
+		binary.Write(buffer, binary.LittleEndian, uint32(len(basicBlocks)))
+		basicBlocks = append(basicBlocks, nil)
+		meterEnd = int64(buffer.Len())
+		return start
+	}
+
+	// writeDiscard writes the instruction unwinding the stack as described
+	// by info.
+	writeDiscard := func(info *disasm.StackInfo) {
+		switch info.Preserve {
+		case 0:
+			writeOp(OpDiscard)
+		case 1:
+			writeOp(OpDiscardPreserveTop)
+		default:
+			writeOp(OpDiscardPreserve)
+			binary.Write(buffer, binary.LittleEndian, int64(info.Preserve))
+		}
+		binary.Write(buffer, binary.LittleEndian, info.StackTopDiff)
+	}
+	// writeVariable writes the access of a local or global variable to
+	// the given slot.
+	writeVariable := func(op byte, slot uint32) {
+		writeOp(op)
+		binary.Write(buffer, binary.LittleEndian, slot)
+	}
 
 	curBlockDepth := -1
 	blocks := make(map[int]*block) // maps nesting depths (labels) to blocks
 
 	blocks[-1] = &block{}
-	for _, instr := range disassembly {
+	startBlock()
+	var sourceOffsets []SourceOffset
+	for i, instr := range disassembly {
 		if instr.Unreachable {
 			continue
 		}
+		if instr.Offset >= 0 {
+			n := len(sourceOffsets)
+			switch {
+			case n != 0 && sourceOffsets[n-1].Offset == instr.Offset:
+			case n != 0 && sourceOffsets[n-1].Compiled == int64(buffer.Len()):
+				// the previous instruction compiled to nothing
+				sourceOffsets[n-1].Offset = instr.Offset
+			default:
+				sourceOffsets = append(sourceOffsets, SourceOffset{Compiled: int64(buffer.Len()), Offset: instr.Offset})
+			}
+		}
+		if instr.Memory != 0 {
+			writeOp(OpMemory)
+			binary.Write(buffer, binary.LittleEndian, instr.Memory)
+		}
 		switch instr.Op.Code {
 		case ops.I32Load, ops.I64Load, ops.F32Load, ops.F64Load, ops.I32Load8s, ops.I32Load8u, ops.I32Load16s, ops.I32Load16u, ops.I64Load8s, ops.I64Load8u, ops.I64Load16s, ops.I64Load16u, ops.I64Load32s, ops.I64Load32u, ops.I32Store, ops.I64Store, ops.F32Store, ops.F64Store, ops.I32Store8, ops.I32Store16, ops.I64Store8, ops.I64Store16, ops.I64Store32:
 			// memory_immediate has two fields, the alignment and the offset.
 			// The former is simply an optimization hint and can be safely
 			// discarded.
-			instr.Immediates = []interface{}{instr.Immediates[1].(uint32)}
+			// The offset is a uint64 on a 64-bit memory, whose accesses
+			// are always checked.
+			instr.Immediates = instr.Immediates[1:]
+			// only the first memory can be static
+			offset, ok := instr.Immediates[0].(uint32)
+			if base, static := staticAddress(disassembly, i); ok && static && instr.Memory == 0 {
+				end := uint64(base) + uint64(offset) + accessWidth(instr.Op.Code)
+				if end <= opts.StaticMemorySize {
+					writeOp(OpUnchecked)
+				}
+			}
+		case ops.GetLocal, ops.SetLocal, ops.TeeLocal, ops.GetGlobal, ops.SetGlobal:
+			// the variables are indexed by slot, and a v128 variable is
+			// accessed as its two slots
+			op, slot := instr.Op.Code, instr.Slot
+			if !instr.Wide {
+				writeVariable(op, slot)
+				continue
+			}
+			switch op {
+			case ops.GetLocal, ops.GetGlobal:
+				writeVariable(op, slot)
+				writeVariable(op, slot+1)
+			case ops.SetLocal, ops.SetGlobal:
+				writeVariable(op, slot+1)
+				writeVariable(op, slot)
+			case ops.TeeLocal:
+				writeVariable(ops.SetLocal, slot+1)
+				writeVariable(ops.TeeLocal, slot)
+				writeVariable(ops.GetLocal, slot+1)
+			}
+			continue
+		case ops.Drop:
+			if instr.Wide {
+				writeOp(ops.Drop)
+			}
+		case ops.Select, ops.SelectTyped:
+			// the VM selects v128 values by their type immediate
+			if instr.Wide {
+				writeOp(ops.SelectTyped)
+				binary.Write(buffer, binary.LittleEndian, wasm.ValueTypeV128)
+				continue
+			}
+		case ops.PrefixSIMD:
+			// the alignment of memory accesses is discarded like above
+			if sub := instr.Op.Sub; sub <= ops.V128Store || sub >= ops.V128Load8Lane && sub <= ops.V128Load64Zero {
+				instr.Immediates = instr.Immediates[1:]
+			}
+		case ops.PrefixAtomic:
+			// the VM checks the alignment of the address instead, and
+			// atomic.fence has no operand
+			instr.Immediates = instr.Immediates[1:]
+		case ops.CallIndirect, ops.ReturnCallIndirect:
+			// the index of this call site is inserted before the table
+			// index, see BytecodeMetadata.
+			instr.Immediates = []interface{}{instr.Immediates[0].(uint32), uint32(callIndirectSites), instr.Immediates[1].(uint32)}
+			callIndirectSites++
 		case ops.If:
 			curBlockDepth++
-			buffer.WriteByte(OpJmpZ)
+			writeOp(OpJmpZ)
 			blocks[curBlockDepth] = &block{
 				ifBlock:        true,
 				elseAddrOffset: int64(buffer.Len()),
@@ -179,12 +464,13 @@ func Compile(disassembly []disasm.Instr) ([]byte, []*BranchTable) {
 			// the address to jump to if the condition for `if` is false
 			// (i.e when the value on the top of the stack is 0)
 			binary.Write(buffer, binary.LittleEndian, int64(0))
+			startBlock()
 			continue
 		case ops.Loop:
 			// there is no condition for entering a loop block
 			curBlockDepth++
 			blocks[curBlockDepth] = &block{
-				offset:    int64(buffer.Len()),
+				offset:    startBlock(),
 				ifBlock:   false,
 				loopBlock: true,
 				discard:   *instr.NewStack,
@@ -197,22 +483,67 @@ func Compile(disassembly []disasm.Instr) ([]byte, []*BranchTable) {
 				discard: *instr.NewStack,
 			}
 			continue
+		case ops.Try:
+			curBlockDepth++
+			blocks[curBlockDepth] = &block{
+				handler: &Handler{
+					Start:    int64(buffer.Len()),
+					Height:   int64(instr.Block.StackDepth),
+					CatchAll: -1,
+					Local:    -1,
+				},
+			}
+			continue
+		case ops.Catch, ops.CatchAll:
+			// try ... catch ... end is compiled like if ... else ... end,
+			// the body and each handler jumping to the end of the block
+			block := blocks[curBlockDepth]
+			if !block.catching {
+				block.handler.End = int64(buffer.Len())
+				block.catching = true
+			}
+			startBlock()
+			if instr.NewStack != nil && instr.NewStack.StackTopDiff != 0 {
+				writeDiscard(instr.NewStack)
+			}
+			writeOp(OpJmp)
+			block.patchOffsets = append(block.patchOffsets, int64(buffer.Len()))
+			binary.Write(buffer, binary.LittleEndian, int64(0))
+
+			addr := startBlock()
+			if instr.Op.Code == ops.Catch {
+				tag := instr.Immediates[0].(uint32)
+				block.handler.Catches = append(block.handler.Catches, Catch{Tag: tag, Addr: addr})
+			} else {
+				block.handler.CatchAll = addr
+			}
+			continue
+		case ops.Rethrow:
+			// the exception is kept in a local of the handler it was
+			// caught by
+			label := int(instr.Immediates[0].(uint32))
+			handler := blocks[curBlockDepth-label].handler
+			if handler.Local < 0 {
+				handler.Local = int64(opts.Locals + exceptionLocals)
+				exceptionLocals++
+			}
+			writeOp(ops.Rethrow)
+			binary.Write(buffer, binary.LittleEndian, uint32(handler.Local))
+			continue
 		case ops.Else:
 			ifInstr := disassembly[instr.Block.ElseIfIndex] // the corresponding `if` instruction for this else
+			// the jump out of the if branch isn't run if the branch
+			// ends with a branch itself
+			startBlock()
 			if ifInstr.NewStack != nil && ifInstr.NewStack.StackTopDiff != 0 {
 				// add code for jumping out of a taken if branch
-				if ifInstr.NewStack.PreserveTop {
-					buffer.WriteByte(OpDiscardPreserveTop)
-				} else {
-					buffer.WriteByte(OpDiscard)
-				}
-				binary.Write(buffer, binary.LittleEndian, ifInstr.NewStack.StackTopDiff)
+				writeDiscard(ifInstr.NewStack)
 			}
-			buffer.WriteByte(OpJmp)
+			writeOp(OpJmp)
 			ifBlockEndOffset := int64(buffer.Len())
 			binary.Write(buffer, binary.LittleEndian, int64(0))
 
-			curOffset := int64(buffer.Len())
+			curOffset := startBlock()
 			ifBlock := blocks[curBlockDepth]
 			code := buffer.Bytes()
 
@@ -221,26 +552,39 @@ func Compile(disassembly []disasm.Instr) ([]byte, []*BranchTable) {
 			ifBlock.ifBlock = false
 			ifBlock.patchOffsets = append(ifBlock.patchOffsets, ifBlockEndOffset)
 			continue
-		case ops.End:
+		case ops.End, ops.Delegate:
 			depth := curBlockDepth
 			block := blocks[depth]
 
+			if handler := block.handler; handler != nil {
+				if !block.catching {
+					handler.End = int64(buffer.Len())
+				}
+				if instr.Op.Code == ops.Delegate {
+					// the handlers of the try blocks whose body
+					// encloses this one, up to the label, are skipped
+					label := int(instr.Immediates[0].(uint32))
+					handler.Delegate = true
+					for i := 0; i < label; i++ {
+						if outer := blocks[depth-1-i]; outer.handler != nil && !outer.catching {
+							handler.Skip++
+						}
+					}
+				}
+				if handler.Delegate || block.catching {
+					handlers = append(handlers, *handler)
+				}
+			}
+
 			if instr.NewStack.StackTopDiff != 0 {
 				// when exiting a block, discard elements to
-				// restore stack height.
-				if instr.NewStack.PreserveTop {
-					// this is true when the block has a
-					// signature, and therefore pushes
-					// a value on to the stack
-					buffer.WriteByte(OpDiscardPreserveTop)
-				} else {
-					buffer.WriteByte(OpDiscard)
-				}
-				binary.Write(buffer, binary.LittleEndian, instr.NewStack.StackTopDiff)
+				// restore stack height, preserving the results
+				// of the block.
+				writeDiscard(instr.NewStack)
 			}
 
 			if !block.loopBlock { // is a normal block
-				block.offset = int64(buffer.Len())
+				block.offset = startBlock()
 				if block.ifBlock {
 					code := buffer.Bytes()
 					buffer = patchOffset(code, block.elseAddrOffset, int64(block.offset))
@@ -252,8 +596,8 @@ func Compile(disassembly []disasm.Instr) ([]byte, []*BranchTable) {
 				buffer = patchOffset(code, offset, block.offset)
 			}
 
-			for _, table := range block.branchTables {
-				table.patchTable(table.blocksLen-depth-1, int64(block.offset))
+			for _, patch := range block.tablePatches {
+				patch.table.Targets[patch.index].Addr = block.offset
 			}
 
 			delete(blocks, curBlockDepth)
@@ -261,14 +605,9 @@ func Compile(disassembly []disasm.Instr) ([]byte, []*BranchTable) {
 			continue
 		case ops.Br:
 			if instr.NewStack != nil && instr.NewStack.StackTopDiff != 0 {
-				if instr.NewStack.PreserveTop {
-					buffer.WriteByte(OpDiscardPreserveTop)
-				} else {
-					buffer.WriteByte(OpDiscard)
-				}
-				binary.Write(buffer, binary.LittleEndian, instr.NewStack.StackTopDiff)
+				writeDiscard(instr.NewStack)
 			}
-			buffer.WriteByte(OpJmp)
+			writeOp(OpJmp)
 			label := int(instr.Immediates[0].(uint32))
 			block := blocks[curBlockDepth-int(label)]
 			block.patchOffsets = append(block.patchOffsets, int64(buffer.Len()))
@@ -276,16 +615,32 @@ func Compile(disassembly []disasm.Instr) ([]byte, []*BranchTable) {
 			binary.Write(buffer, binary.LittleEndian, int64(0))
 			continue
 		case ops.BrIf:
-			buffer.WriteByte(OpJmpNz)
 			label := int(instr.Immediates[0].(uint32))
 			block := blocks[curBlockDepth-int(label)]
+			if instr.NewStack != nil && instr.NewStack.Preserve > 1 && instr.NewStack.StackTopDiff != 0 {
+				// OpJmpNz only preserves the top of the stack, the
+				// branch is compiled to
+				//     jmpz <next> <discard-preserve> jmp <addr>
+				writeOp(OpJmpZ)
+				nextOffset := int64(buffer.Len())
+				binary.Write(buffer, binary.LittleEndian, int64(0))
+				startBlock()
+				writeDiscard(instr.NewStack)
+				writeOp(OpJmp)
+				block.patchOffsets = append(block.patchOffsets, int64(buffer.Len()))
+				binary.Write(buffer, binary.LittleEndian, int64(0))
+				next := startBlock()
+				buffer = patchOffset(buffer.Bytes(), nextOffset, next)
+				continue
+			}
+			writeOp(OpJmpNz)
 			block.patchOffsets = append(block.patchOffsets, int64(buffer.Len()))
 			// write the jump address
 			binary.Write(buffer, binary.LittleEndian, int64(0))
 
 			var stackTopDiff int64
 			// write whether we need to preserve the top
-			if instr.NewStack == nil || !instr.NewStack.PreserveTop || instr.NewStack.StackTopDiff == 0 {
+			if instr.NewStack == nil || instr.NewStack.Preserve == 0 || instr.NewStack.StackTopDiff == 0 {
 				buffer.WriteByte(byte(0))
 			} else {
 				stackTopDiff = instr.NewStack.StackTopDiff
@@ -293,41 +648,71 @@ func Compile(disassembly []disasm.Instr) ([]byte, []*BranchTable) {
 			}
 			// write the number of elements on the stack we need to discard
 			binary.Write(buffer, binary.LittleEndian, stackTopDiff)
+			startBlock()
+			continue
+		case ops.BrOnNull, ops.BrOnNonNull:
+			// the branch is compiled to
+			//     jmpnonnull <next> <discard> jmp <addr>
+			// or, for br_on_non_null,
+			//     jmpnull <next> <discard-preserve> jmp <addr>
+			label := int(instr.Immediates[0].(uint32))
+			block := blocks[curBlockDepth-int(label)]
+			if instr.Op.Code == ops.BrOnNull {
+				writeOp(OpJmpNonNull)
+			} else {
+				writeOp(OpJmpNull)
+			}
+			nextOffset := int64(buffer.Len())
+			binary.Write(buffer, binary.LittleEndian, int64(0))
+			startBlock()
+			if instr.NewStack != nil && instr.NewStack.StackTopDiff != 0 {
+				writeDiscard(instr.NewStack)
+			}
+			writeOp(OpJmp)
+			block.patchOffsets = append(block.patchOffsets, int64(buffer.Len()))
+			binary.Write(buffer, binary.LittleEndian, int64(0))
+			next := startBlock()
+			buffer = patchOffset(buffer.Bytes(), nextOffset, next)
 			continue
 		case ops.BrTable:
+			// The immediates are the number of targets, followed by the
+			// labels of the targets, and the default label.
+			// instr.Branches holds the stack information in the same order.
+			targetCount := int(instr.Immediates[0].(uint32))
 			branchTable := &BranchTable{
-				// we subtract one for the implicit block created by
-				// the function body
-				blocksLen: len(blocks) - 1,
+				Targets: make([]Target, targetCount+1),
 			}
-			targetCount := instr.Immediates[0].(uint32)
-			branchTable.Targets = make([]Target, targetCount)
 			for i := range branchTable.Targets {
-				// The first immediates is the number of targets, so we ignore that
-				label := int64(instr.Immediates[i+1].(uint32))
-				branchTable.Targets[i].Addr = label
+				label := int(instr.Immediates[i+1].(uint32))
 				branch := instr.Branches[i]
+				target := &branchTable.Targets[i]
+
+				target.Return = branch.IsReturn
+				target.Discard = branch.StackTopDiff
+				target.Preserve = branch.Preserve
+				if target.Return {
+					continue
+				}
 
-				branchTable.Targets[i].Return = branch.IsReturn
-				branchTable.Targets[i].Discard = branch.StackTopDiff
-				branchTable.Targets[i].PreserveTop = branch.PreserveTop
+				block := blocks[curBlockDepth-label]
+				if block.loopBlock {
+					// the continuation of a loop is already known
+					target.Addr = block.offset
+				} else {
+					block.tablePatches = append(block.tablePatches, tablePatch{branchTable, i})
+				}
 			}
-			defaultLabel := int64(instr.Immediates[len(instr.Immediates)-1].(uint32))
-			branchTable.DefaultTarget.Addr = defaultLabel
-			defaultBranch := instr.Branches[targetCount]
-			branchTable.DefaultTarget.Return = defaultBranch.IsReturn
-			branchTable.DefaultTarget.Discard = defaultBranch.StackTopDiff
-			branchTable.DefaultTarget.PreserveTop = defaultBranch.PreserveTop
 			branchTables = append(branchTables, branchTable)
-			for _, block := range blocks {
-				block.branchTables = append(block.branchTables, branchTable)
-			}
 
-			buffer.WriteByte(ops.BrTable)
+			writeOp(ops.BrTable)
 			binary.Write(buffer, binary.LittleEndian, int64(len(branchTables)-1))
+			continue
 		}
 
-		buffer.WriteByte(instr.Op.Code)
+		writeOp(instr.Op.Code)
+		if instr.Op.Code == ops.PrefixMisc || instr.Op.Code == ops.PrefixSIMD || instr.Op.Code == ops.PrefixAtomic || instr.Op.Code == ops.PrefixGC {
+			binary.Write(buffer, binary.LittleEndian, instr.Op.Sub)
+		}
 		for _, imm := range instr.Immediates {
 			err := binary.Write(buffer, binary.LittleEndian, imm)
 			if err != nil {
@@ -338,19 +723,25 @@ func Compile(disassembly []disasm.Instr) ([]byte, []*BranchTable) {
 
 	// writing nop as the last instructions allows us to branch out of the
 	// function (ie, return)
-	addr := buffer.Len()
-	buffer.WriteByte(ops.Nop)
+	addr := startBlock()
+	writeOp(ops.Nop)
 
 	// patch all references to the "root" block of the function body
 	for _, offset := range blocks[-1].patchOffsets {
 		code := buffer.Bytes()
 		buffer = patchOffset(code, offset, int64(addr))
 	}
-
-	for _, table := range branchTables {
-		table.patchedAddrs = nil
+	for _, patch := range blocks[-1].tablePatches {
+		patch.table.Targets[patch.index].Addr = int64(addr)
+	}
+	return buffer.Bytes(), &BytecodeMetadata{
+		BranchTables:      branchTables,
+		CallIndirectSites: callIndirectSites,
+		BasicBlocks:       basicBlocks,
+		Handlers:          handlers,
+		Locals:            exceptionLocals,
+		SourceOffsets:     sourceOffsets,
 	}
-	return buffer.Bytes(), branchTables
 }
 
 // replace the address starting at start with addr
@@ -365,30 +756,3 @@ func patchOffset(code []byte, start int64, addr int64) *bytes.Buffer {
 	buf.Write(code)
 	return buf
 }
-
-func (table *BranchTable) patchTable(block int, addr int64) {
-	if block < 0 {
-		panic("Invalid block value")
-	}
-
-	for i, target := range table.Targets {
-		if !table.isAddr(target.Addr) && target.Addr == int64(block) {
-			table.Targets[i].Addr = addr
-		}
-	}
-
-	if table.DefaultTarget.Addr == int64(block) {
-		table.DefaultTarget.Addr = addr
-	}
-	table.patchedAddrs = append(table.patchedAddrs, addr)
-}
-
-// Whether the given value is an instruction (or the block depth)
-func (table *BranchTable) isAddr(addr int64) bool {
-	for _, t := range table.patchedAddrs {
-		if t == addr {
-			return true
-		}
-	}
-	return false
-}
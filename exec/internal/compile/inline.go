@@ -0,0 +1,159 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package compile
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// InlineCandidate is a small leaf function whose body can be substituted
+// for the call instructions referencing it.
+type InlineCandidate struct {
+	Code     []disasm.Instr // the function body, without the trailing end
+	Params   int            // number of slots of the parameters of the function
+	Locals   int            // number of slots of the locals of the function, including the parameters
+	MaxDepth int            // maximum stack depth reached by the function body
+}
+
+// NewInlineCandidate returns the InlineCandidate for the function fn, or nil
+// if fn is not a leaf function of at most threshold instructions. A leaf
+// function has straight-line code: it neither calls other functions nor
+// contains any control operators.
+func NewInlineCandidate(fn wasm.Function, disassembly *disasm.Disassembly, threshold int) *InlineCandidate {
+	if fn.EnvFunc || len(disassembly.Code) > threshold {
+		return nil
+	}
+
+	for _, instr := range disassembly.Code {
+		if instr.Unreachable {
+			return nil
+		}
+		switch instr.Op.Code {
+		case ops.Unreachable, ops.Block, ops.Loop, ops.If, ops.Else, ops.End, ops.Br, ops.BrIf, ops.BrTable, ops.Return, ops.Call, ops.CallIndirect, ops.ReturnCall, ops.ReturnCallIndirect,
+			ops.CallRef, ops.ReturnCallRef, ops.BrOnNull, ops.BrOnNonNull,
+			ops.Try, ops.Catch, ops.CatchAll, ops.Delegate, ops.Throw, ops.Rethrow:
+			return nil
+		}
+	}
+
+	locals := disasm.Slots(fn.Sig.ParamTypes...)
+	for _, entry := range fn.Body.Locals {
+		locals += int(entry.Count) * disasm.Slots(entry.Type)
+	}
+
+	return &InlineCandidate{
+		Code:     disassembly.Code,
+		Params:   disasm.Slots(fn.Sig.ParamTypes...),
+		Locals:   locals,
+		MaxDepth: disassembly.MaxDepth,
+	}
+}
+
+// Inline replaces every reachable call to a function with a non-nil entry
+// in candidates by the body of that function. The parameters and locals of
+// an inlined function are stored in locals appended to the ones of the
+// caller, whose number of slots is given by locals.
+// It returns the new disassembly, along with the number of additional
+// locals and stack slots the caller needs.
+func Inline(disassembly []disasm.Instr, locals int, candidates []*InlineCandidate) ([]disasm.Instr, int, int) {
+	var extraLocals, extraDepth int
+	inlined := false
+
+	code := make([]disasm.Instr, 0, len(disassembly))
+	indices := make([]int, len(disassembly)) // maps old indices in disassembly to the new ones in code
+	for i, instr := range disassembly {
+		indices[i] = len(code)
+		if instr.Op.Code != ops.Call || instr.Unreachable {
+			code = append(code, instr)
+			continue
+		}
+		index := int(instr.Immediates[0].(uint32))
+		if index >= len(candidates) || candidates[index] == nil {
+			code = append(code, instr)
+			continue
+		}
+
+		callee := candidates[index]
+		inlined = true
+		start := len(code)
+		// pop the arguments into the parameters of the callee, one slot
+		// at a time
+		for p := callee.Params - 1; p >= 0; p-- {
+			code = append(code, newInstr(ops.SetLocal, uint32(locals+p)))
+		}
+		// locals are zeroed on every call
+		for l := callee.Params; l < callee.Locals; l++ {
+			code = append(code, newInstr(ops.I64Const, int64(0)))
+			code = append(code, newInstr(ops.SetLocal, uint32(locals+l)))
+		}
+		for _, calleeInstr := range callee.Code {
+			switch calleeInstr.Op.Code {
+			case ops.GetLocal, ops.SetLocal, ops.TeeLocal:
+				calleeInstr.Slot += uint32(locals)
+			}
+			code = append(code, calleeInstr)
+		}
+		// the inlined code is located at the call
+		for j := start; j < len(code); j++ {
+			code[j].Offset = instr.Offset
+		}
+
+		if callee.Locals > extraLocals {
+			extraLocals = callee.Locals
+		}
+		if callee.MaxDepth+1 > extraDepth {
+			extraDepth = callee.MaxDepth + 1
+		}
+	}
+
+	if !inlined {
+		return disassembly, 0, 0
+	}
+
+	// fix the indices to accompanying control operators
+	for i, instr := range code {
+		if instr.Block == nil {
+			continue
+		}
+		block := *instr.Block
+		block.IfElseIndex = indices[block.IfElseIndex]
+		block.ElseIfIndex = indices[block.ElseIfIndex]
+		block.EndIndex = indices[block.EndIndex]
+		block.BlockStartIndex = indices[block.BlockStartIndex]
+		code[i].Block = &block
+	}
+
+	return code, extraLocals, extraDepth
+}
+
+func newInstr(code byte, immediate interface{}) disasm.Instr {
+	op, err := ops.New(code)
+	if err != nil {
+		panic(err)
+	}
+	instr := disasm.Instr{
+		Op:         op,
+		Immediates: []interface{}{immediate},
+	}
+	if code == ops.SetLocal {
+		instr.Slot = immediate.(uint32)
+	}
+	return instr
+}
@@ -0,0 +1,150 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestHashes(t *testing.T) {
+	long := "12345678901234567890123456789012345678901234567890123456789012345678901234567890"
+	for _, tc := range []struct {
+		name string
+		hash func([]byte) []byte
+		in   string
+		want string
+	}{
+		{"keccak256", keccak, "", "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{"keccak256", keccak, "abc", "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+		{"keccak256", keccak, "The quick brown fox jumps over the lazy dog", "4d741b6f1eb29cb2a9b9911c82f56fa8d73b04959d3d9d222895df6c0b28aa15"},
+		{"blake2b-512", blake512, "", "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+		{"blake2b-512", blake512, "abc", "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{"blake2b-256", blake256, "", "0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8"},
+		{"ripemd160", ripemd, "", "9c1185a5c5e9fc54612808977ee8f548b2258d31"},
+		{"ripemd160", ripemd, "abc", "8eb208f7e05d987a9b044a8e98c6b087f15a0bfc"},
+		{"ripemd160", ripemd, long, "9b752e45573d4b39f4dbd3323cab82bf63326bfb"},
+	} {
+		if got := hex.EncodeToString(tc.hash([]byte(tc.in))); got != tc.want {
+			t.Errorf("%s(%q) = %s, want %s", tc.name, tc.in, got, tc.want)
+		}
+	}
+}
+
+func keccak(b []byte) []byte   { h := Keccak256(b); return h[:] }
+func blake512(b []byte) []byte { return Blake2b(b, 64) }
+func blake256(b []byte) []byte { return Blake2b(b, 32) }
+func ripemd(b []byte) []byte   { h := Ripemd160(b); return h[:] }
+
+// sign signs hash with the private key d and the nonce k, returning the
+// signature in the encoding of Ecrecover.
+func sign(hash [32]byte, d, k *big.Int) []byte {
+	R := mul(secpG, k)
+	r := new(big.Int).Mod(R.x, secpN)
+	s := new(big.Int).Mul(r, d)
+	s.Add(s, new(big.Int).SetBytes(hash[:]))
+	s.Mul(s, new(big.Int).ModInverse(k, secpN))
+	s.Mod(s, secpN)
+	sig := make([]byte, 65)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:64])
+	sig[64] = byte(R.y.Bit(0))
+	if R.x.Cmp(secpN) >= 0 {
+		sig[64] |= 2
+	}
+	return sig
+}
+
+func TestEcrecover(t *testing.T) {
+	if !secpG.onCurve() {
+		t.Fatal("G is not on the curve")
+	}
+	if !mul(secpG, secpN).infinity() {
+		t.Fatal("n·G is not infinity")
+	}
+
+	hash := Keccak256([]byte("hello"))
+	for _, d := range []*big.Int{big.NewInt(1), big.NewInt(42), fromHex("c85ef7d79691fe79573b1a7064c19c1a9819ebdbd1faaab1a8ec92344438aaf4")} {
+		Q := mul(secpG, d)
+		want := make([]byte, 64)
+		Q.x.FillBytes(want[:32])
+		Q.y.FillBytes(want[32:])
+
+		sig := sign(hash, d, fromHex("4b688df40bcedbe641ddb16ff0a1842d9c67ea1c3bf63f3e0471baa664531d1a"))
+		pub, err := Ecrecover(hash, sig)
+		if err != nil || !bytes.Equal(pub, want) {
+			t.Errorf("Ecrecover with key %v = %x, %v, want %x", d, pub, err, want)
+		}
+		sig[64] += 27
+		if pub, err := Ecrecover(hash, sig); err != nil || !bytes.Equal(pub, want) {
+			t.Errorf("Ecrecover with key %v and v+27 = %x, %v, want %x", d, pub, err, want)
+		}
+		sig[64] ^= 1
+		if pub, _ := Ecrecover(hash, sig); bytes.Equal(pub, want) {
+			t.Errorf("Ecrecover with key %v and the wrong parity recovered the key", d)
+		}
+	}
+
+	for _, sig := range [][]byte{
+		make([]byte, 64),
+		make([]byte, 65),
+		append(secpN.Bytes(), append(bytes.Repeat([]byte{1}, 32), 0)...),
+		append(bytes.Repeat([]byte{1}, 64), 5),
+	} {
+		if _, err := Ecrecover(hash, sig); err != ErrInvalidSignature {
+			t.Errorf("Ecrecover(%x) = %v, want ErrInvalidSignature", sig, err)
+		}
+	}
+}
+
+func TestEcrecoverVectors(t *testing.T) {
+	// Signatures from other implementations, checked against the address
+	// of the key they recover: the ValidKey input of the ecrecover
+	// precompile tests of go-ethereum, and the example transaction of
+	// EIP-155, whose v of 37 is a parity of 0 on chain 1.
+	for _, tc := range []struct {
+		hash, sig, address string
+	}{
+		{
+			"38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e",
+			"38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e789d1dd423d25f0772d2748d60f7e4b81bb14d086eba8e8e8efb6dcff8a4ae021b",
+			"ceaccac640adf55b2028469bd36ba501f28b699d",
+		},
+		{
+			"daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53",
+			"28ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa63627667cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d8300",
+			"9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f",
+		},
+	} {
+		var hash [32]byte
+		h, _ := hex.DecodeString(tc.hash)
+		copy(hash[:], h)
+		sig, _ := hex.DecodeString(tc.sig)
+		pub, err := Ecrecover(hash, sig)
+		if err != nil {
+			t.Errorf("Ecrecover(%s) = %v", tc.sig, err)
+			continue
+		}
+		address := Keccak256(pub)
+		if got := hex.EncodeToString(address[12:]); got != tc.address {
+			t.Errorf("Ecrecover(%s) recovered the address %s, want %s", tc.sig, got, tc.address)
+		}
+	}
+}
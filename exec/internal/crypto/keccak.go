@@ -0,0 +1,104 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package crypto implements the hash functions and the signature schemes
+// of the crypto host functions which the standard library lacks: the
+// Keccak-256 hash of Ethereum, BLAKE2b, RIPEMD-160, and the recovery of
+// the secp256k1 public keys from ECDSA signatures.
+package crypto
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// keccakRounds are the round constants of Keccak-f[1600].
+var keccakRounds = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a, 0x8000000080008000,
+	0x000000000000808b, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008a, 0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800a, 0x800000008000000a,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+// keccakRotations are the rotations of the lanes by the rho step, in the
+// order the pi step moves them, given by keccakLanes.
+var (
+	keccakRotations = [24]int{1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44}
+	keccakLanes     = [24]int{10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1}
+)
+
+// keccakF applies the Keccak-f[1600] permutation to the state a.
+func keccakF(a *[25]uint64) {
+	var c [5]uint64
+	for _, rc := range keccakRounds {
+		// theta
+		for i := range c {
+			c[i] = a[i] ^ a[i+5] ^ a[i+10] ^ a[i+15] ^ a[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			d := c[(i+4)%5] ^ bits.RotateLeft64(c[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				a[j+i] ^= d
+			}
+		}
+		// rho and pi
+		t := a[1]
+		for i, lane := range keccakLanes {
+			a[lane], t = bits.RotateLeft64(t, keccakRotations[i]), a[lane]
+		}
+		// chi
+		for j := 0; j < 25; j += 5 {
+			copy(c[:], a[j:j+5])
+			for i := 0; i < 5; i++ {
+				a[j+i] ^= ^c[(i+1)%5] & c[(i+2)%5]
+			}
+		}
+		// iota
+		a[0] ^= rc
+	}
+}
+
+// Keccak256 returns the Keccak-256 hash of data, with the padding of the
+// original Keccak submission used by Ethereum rather than the one of
+// SHA3-256.
+func Keccak256(data []byte) [32]byte {
+	const rate = 136
+	var a [25]uint64
+	absorb := func(block []byte) {
+		for i := 0; i < rate/8; i++ {
+			a[i] ^= binary.LittleEndian.Uint64(block[8*i:])
+		}
+		keccakF(&a)
+	}
+	for len(data) >= rate {
+		absorb(data[:rate])
+		data = data[rate:]
+	}
+	var last [rate]byte
+	copy(last[:], data)
+	last[len(data)] ^= 0x01
+	last[rate-1] ^= 0x80
+	absorb(last[:])
+
+	var sum [32]byte
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint64(sum[8*i:], a[i])
+	}
+	return sum
+}
@@ -0,0 +1,125 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// The message words, rotations and constants of the left and the right
+// lines of RIPEMD-160.
+var (
+	ripemdR = [80]uint8{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		7, 4, 13, 1, 10, 6, 15, 3, 12, 0, 9, 5, 2, 14, 11, 8,
+		3, 10, 14, 4, 9, 15, 8, 1, 2, 7, 0, 6, 13, 11, 5, 12,
+		1, 9, 11, 10, 0, 8, 12, 4, 13, 3, 7, 15, 14, 5, 6, 2,
+		4, 0, 5, 9, 7, 12, 2, 10, 14, 1, 3, 8, 11, 6, 15, 13,
+	}
+	ripemdRR = [80]uint8{
+		5, 14, 7, 0, 9, 2, 11, 4, 13, 6, 15, 8, 1, 10, 3, 12,
+		6, 11, 3, 7, 0, 13, 5, 10, 14, 15, 8, 12, 4, 9, 1, 2,
+		15, 5, 1, 3, 7, 14, 6, 9, 11, 8, 12, 2, 10, 0, 4, 13,
+		8, 6, 4, 1, 3, 11, 15, 0, 5, 12, 2, 13, 9, 7, 10, 14,
+		12, 15, 10, 4, 1, 5, 8, 7, 6, 2, 13, 14, 0, 3, 9, 11,
+	}
+	ripemdS = [80]uint8{
+		11, 14, 15, 12, 5, 8, 7, 9, 11, 13, 14, 15, 6, 7, 9, 8,
+		7, 6, 8, 13, 11, 9, 7, 15, 7, 12, 15, 9, 11, 7, 13, 12,
+		11, 13, 6, 7, 14, 9, 13, 15, 14, 8, 13, 6, 5, 12, 7, 5,
+		11, 12, 14, 15, 14, 15, 9, 8, 9, 14, 5, 6, 8, 6, 5, 12,
+		9, 15, 5, 11, 6, 8, 13, 12, 5, 12, 13, 14, 11, 8, 5, 6,
+	}
+	ripemdSS = [80]uint8{
+		8, 9, 9, 11, 13, 15, 15, 5, 7, 7, 8, 11, 14, 14, 12, 6,
+		9, 13, 15, 7, 12, 8, 9, 11, 7, 7, 12, 7, 6, 15, 13, 11,
+		9, 7, 15, 11, 8, 6, 6, 14, 12, 13, 5, 14, 13, 13, 7, 5,
+		15, 5, 8, 11, 14, 14, 6, 14, 6, 9, 12, 9, 12, 5, 15, 8,
+		8, 5, 12, 9, 12, 5, 14, 6, 8, 13, 6, 5, 15, 13, 11, 11,
+	}
+	ripemdK  = [5]uint32{0x00000000, 0x5a827999, 0x6ed9eba1, 0x8f1bbcdc, 0xa953fd4e}
+	ripemdKK = [5]uint32{0x50a28be6, 0x5c4dd124, 0x6d703ef3, 0x7a6d76e9, 0x00000000}
+)
+
+// ripemdF is the boolean function of the round j/16 of the left line, the
+// right line using them in the reverse order.
+func ripemdF(round int, x, y, z uint32) uint32 {
+	switch round {
+	case 0:
+		return x ^ y ^ z
+	case 1:
+		return x&y | ^x&z
+	case 2:
+		return (x | ^y) ^ z
+	case 3:
+		return x&z | y&^z
+	default:
+		return x ^ (y | ^z)
+	}
+}
+
+// ripemdBlock hashes the 64-byte block into h.
+func ripemdBlock(h *[5]uint32, block []byte) {
+	var x [16]uint32
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(block[4*i:])
+	}
+	a, b, c, d, e := h[0], h[1], h[2], h[3], h[4]
+	aa, bb, cc, dd, ee := a, b, c, d, e
+	for j := 0; j < 80; j++ {
+		round := j / 16
+		t := bits.RotateLeft32(a+ripemdF(round, b, c, d)+x[ripemdR[j]]+ripemdK[round], int(ripemdS[j])) + e
+		a, b, c, d, e = e, t, b, bits.RotateLeft32(c, 10), d
+		t = bits.RotateLeft32(aa+ripemdF(4-round, bb, cc, dd)+x[ripemdRR[j]]+ripemdKK[round], int(ripemdSS[j])) + ee
+		aa, bb, cc, dd, ee = ee, t, bb, bits.RotateLeft32(cc, 10), dd
+	}
+	t := h[1] + c + dd
+	h[1] = h[2] + d + ee
+	h[2] = h[3] + e + aa
+	h[3] = h[4] + a + bb
+	h[4] = h[0] + b + cc
+	h[0] = t
+}
+
+// Ripemd160 returns the RIPEMD-160 hash of data.
+func Ripemd160(data []byte) [20]byte {
+	h := [5]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476, 0xc3d2e1f0}
+	length := uint64(len(data)) * 8
+	for len(data) >= 64 {
+		ripemdBlock(&h, data[:64])
+		data = data[64:]
+	}
+	var tail [128]byte
+	n := copy(tail[:], data)
+	tail[n] = 0x80
+	size := 64
+	if n >= 56 {
+		size = 128
+	}
+	binary.LittleEndian.PutUint64(tail[size-8:], length)
+	for i := 0; i < size; i += 64 {
+		ripemdBlock(&h, tail[i:i+64])
+	}
+
+	var sum [20]byte
+	for i, x := range h {
+		binary.LittleEndian.PutUint32(sum[4*i:], x)
+	}
+	return sum
+}
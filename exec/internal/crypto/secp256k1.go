@@ -0,0 +1,174 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"errors"
+	"math/big"
+)
+
+// ErrInvalidSignature is returned by Ecrecover for the signatures from
+// which no public key can be recovered.
+var ErrInvalidSignature = errors.New("crypto: invalid secp256k1 signature")
+
+// The parameters of secp256k1, the curve y² = x³ + 7 over the field of
+// order secpP, whose base point secpG has the order secpN.
+var (
+	secpP  = fromHex("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f")
+	secpN  = fromHex("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+	secpG  = point{fromHex("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"), fromHex("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")}
+	secpB  = big.NewInt(7)
+	secpSq = new(big.Int).Rsh(new(big.Int).Add(secpP, big.NewInt(1)), 2)
+)
+
+func fromHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("crypto: invalid constant " + s)
+	}
+	return n
+}
+
+// point is an affine point of secp256k1, the point at infinity having a
+// nil x.
+type point struct {
+	x, y *big.Int
+}
+
+func (a point) infinity() bool {
+	return a.x == nil
+}
+
+// onCurve reports whether a is a point of secp256k1 other than infinity.
+func (a point) onCurve() bool {
+	if a.infinity() {
+		return false
+	}
+	lhs := new(big.Int).Mul(a.y, a.y)
+	lhs.Mod(lhs, secpP)
+	return lhs.Cmp(curveRHS(a.x)) == 0
+}
+
+// curveRHS returns x³ + 7 modulo secpP.
+func curveRHS(x *big.Int) *big.Int {
+	r := new(big.Int).Mul(x, x)
+	r.Mul(r, x)
+	r.Add(r, secpB)
+	return r.Mod(r, secpP)
+}
+
+// add returns a + b.
+func add(a, b point) point {
+	if a.infinity() {
+		return b
+	}
+	if b.infinity() {
+		return a
+	}
+	var slope *big.Int
+	if a.x.Cmp(b.x) == 0 {
+		if a.y.Cmp(b.y) != 0 || a.y.Sign() == 0 {
+			return point{}
+		}
+		// the tangent, 3x² / 2y
+		num := new(big.Int).Mul(a.x, a.x)
+		num.Mul(num, big.NewInt(3))
+		den := new(big.Int).Lsh(a.y, 1)
+		slope = num.Mul(num, den.ModInverse(den, secpP))
+	} else {
+		num := new(big.Int).Sub(b.y, a.y)
+		den := new(big.Int).Sub(b.x, a.x)
+		den.Mod(den, secpP)
+		slope = num.Mul(num, den.ModInverse(den, secpP))
+	}
+	slope.Mod(slope, secpP)
+	x := new(big.Int).Mul(slope, slope)
+	x.Sub(x, a.x)
+	x.Sub(x, b.x)
+	x.Mod(x, secpP)
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, slope)
+	y.Sub(y, a.y)
+	y.Mod(y, secpP)
+	return point{x, y}
+}
+
+// mul returns k·a, by double-and-add.
+func mul(a point, k *big.Int) point {
+	var r point
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = add(r, r)
+		if k.Bit(i) == 1 {
+			r = add(r, a)
+		}
+	}
+	return r
+}
+
+// Ecrecover returns the uncompressed public key, x then y in 64 bytes,
+// whose private key signed hash with sig, the 32 bytes of r, the 32 bytes
+// of s and the recovery id v, from 0 to 3 or from 27 to 30 as Ethereum
+// encodes it.
+func Ecrecover(hash [32]byte, sig []byte) ([]byte, error) {
+	if len(sig) != 65 {
+		return nil, ErrInvalidSignature
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 3 || r.Sign() == 0 || s.Sign() == 0 || r.Cmp(secpN) >= 0 || s.Cmp(secpN) >= 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	// R, the point whose x is r, or r + n for the ids 2 and 3
+	x := new(big.Int).Set(r)
+	if v&2 != 0 {
+		x.Add(x, secpN)
+	}
+	if x.Cmp(secpP) >= 0 {
+		return nil, ErrInvalidSignature
+	}
+	y := new(big.Int).Exp(curveRHS(x), secpSq, secpP)
+	if y.Bit(0) != uint(v&1) {
+		y.Sub(secpP, y)
+	}
+	R := point{x, y}
+	if !R.onCurve() {
+		return nil, ErrInvalidSignature
+	}
+
+	// Q = r⁻¹(sR - eG)
+	e := new(big.Int).SetBytes(hash[:])
+	rInv := new(big.Int).ModInverse(r, secpN)
+	u1 := new(big.Int).Neg(e)
+	u1.Mul(u1, rInv)
+	u1.Mod(u1, secpN)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, secpN)
+	Q := add(mul(secpG, u1), mul(R, u2))
+	if Q.infinity() {
+		return nil, ErrInvalidSignature
+	}
+	pub := make([]byte, 64)
+	Q.x.FillBytes(pub[:32])
+	Q.y.FillBytes(pub[32:])
+	return pub, nil
+}
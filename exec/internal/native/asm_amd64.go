@@ -0,0 +1,196 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import "encoding/binary"
+
+// amd64 general purpose registers, numbered as in their encoding.
+const (
+	rax = 0
+	rcx = 1
+	rdx = 2
+	rsi = 6
+	rdi = 7
+	r8  = 8
+	r9  = 9
+	r10 = 10
+	r11 = 11
+)
+
+// amd64 condition codes, as used by jcc, setcc and cmovcc.
+const (
+	ccB  = 0x2 // below (unsigned <)
+	ccAE = 0x3 // above or equal (unsigned >=)
+	ccE  = 0x4 // equal
+	ccNE = 0x5 // not equal
+	ccBE = 0x6 // below or equal (unsigned <=)
+	ccA  = 0x7 // above (unsigned >)
+	ccL  = 0xc // less (signed <)
+	ccGE = 0xd // greater or equal (signed >=)
+	ccLE = 0xe // less or equal (signed <=)
+	ccG  = 0xf // greater (signed >)
+)
+
+// assembler encodes the small subset of amd64 instructions the compiler
+// needs.
+type assembler struct {
+	buf []byte
+}
+
+func (a *assembler) pos() int {
+	return len(a.buf)
+}
+
+func (a *assembler) emit(b ...byte) {
+	a.buf = append(a.buf, b...)
+}
+
+func (a *assembler) emit32(v uint32) {
+	a.buf = append(a.buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (a *assembler) emit64(v uint64) {
+	a.emit32(uint32(v))
+	a.emit32(uint32(v >> 32))
+}
+
+// patch32 writes v at the given position.
+func (a *assembler) patch32(at int, v int32) {
+	binary.LittleEndian.PutUint32(a.buf[at:], uint32(v))
+}
+
+// rex emits a REX prefix when one is needed for the given operand size and
+// register operands.
+func (a *assembler) rex(w bool, reg, index, base int) {
+	b := byte(0x40)
+	if w {
+		b |= 0x8
+	}
+	if reg >= 8 {
+		b |= 0x4
+	}
+	if index >= 8 {
+		b |= 0x2
+	}
+	if base >= 8 {
+		b |= 0x1
+	}
+	if b != 0x40 {
+		a.emit(b)
+	}
+}
+
+// regOp emits opcode with a register-direct ModRM operand. reg is either a
+// register or an opcode extension.
+func (a *assembler) regOp(w bool, opcode []byte, reg, rm int) {
+	a.rex(w, reg, 0, rm)
+	a.emit(opcode...)
+	a.emit(0xc0 | byte(reg&7)<<3 | byte(rm&7))
+}
+
+// memOp emits opcode with a [base+disp32] ModRM operand. base must be
+// neither rsp nor r12, which require a SIB byte.
+func (a *assembler) memOp(w bool, opcode []byte, reg, base int, disp int32) {
+	a.rex(w, reg, 0, base)
+	a.emit(opcode...)
+	a.emit(0x80 | byte(reg&7)<<3 | byte(base&7))
+	a.emit32(uint32(disp))
+}
+
+// heapOp emits opcode with a [r8+rax] operand, addressing the linear memory.
+func (a *assembler) heapOp(w bool, opcode []byte, reg int) {
+	a.rex(w, reg, rax, r8)
+	a.emit(opcode...)
+	a.emit(0x04|byte(reg&7)<<3, 0x00)
+}
+
+// load emits mov dst, [base+disp].
+func (a *assembler) load(dst, base int, disp int32) {
+	a.memOp(true, []byte{0x8b}, dst, base, disp)
+}
+
+// load32 emits mov dst32, [base+disp], zero extending the value.
+func (a *assembler) load32(dst, base int, disp int32) {
+	a.memOp(false, []byte{0x8b}, dst, base, disp)
+}
+
+// store emits mov [base+disp], src.
+func (a *assembler) store(base int, disp int32, src int) {
+	a.memOp(true, []byte{0x89}, src, base, disp)
+}
+
+// aluImm emits the group 1 instruction selected by ext (0 for add, 5 for
+// sub, 7 for cmp) with a register and a 32-bit immediate operand.
+func (a *assembler) aluImm(w bool, ext, reg int, imm int32) {
+	a.regOp(w, []byte{0x81}, ext, reg)
+	a.emit32(uint32(imm))
+}
+
+// movImm64 emits mov reg, imm64.
+func (a *assembler) movImm64(reg int, v uint64) {
+	a.rex(true, 0, 0, reg)
+	a.emit(0xb8 | byte(reg&7))
+	a.emit64(v)
+}
+
+// movImm32 emits mov reg32, imm32, zero extending the value.
+func (a *assembler) movImm32(reg int, v uint32) {
+	a.rex(false, 0, 0, reg)
+	a.emit(0xb8 | byte(reg&7))
+	a.emit32(v)
+}
+
+// jcc emits a conditional jump with a zero displacement, and returns the
+// position of the displacement to patch.
+func (a *assembler) jcc(cc byte) int {
+	a.emit(0x0f, 0x80|cc)
+	a.emit32(0)
+	return a.pos() - 4
+}
+
+// jmp emits an unconditional jump with a zero displacement, and returns the
+// position of the displacement to patch.
+func (a *assembler) jmp() int {
+	a.emit(0xe9)
+	a.emit32(0)
+	return a.pos() - 4
+}
+
+// setcc emits setcc al followed by movzx eax, al.
+func (a *assembler) setcc(cc byte) {
+	a.emit(0x0f, 0x90|cc, 0xc0)
+	a.emit(0x0f, 0xb6, 0xc0)
+}
+
+// cmov emits cmovcc dst, src.
+func (a *assembler) cmov(w bool, cc byte, dst, src int) {
+	a.regOp(w, []byte{0x0f, 0x40 | cc}, dst, src)
+}
+
+// leaRIP emits lea reg, [rip+disp32] with a zero displacement, and returns
+// the position of the displacement to patch.
+func (a *assembler) leaRIP(reg int) int {
+	a.rex(true, reg, 0, 0)
+	a.emit(0x8d, 0x05|byte(reg&7)<<3)
+	a.emit32(0)
+	return a.pos() - 4
+}
+
+func (a *assembler) ret() {
+	a.emit(0xc3)
+}
@@ -0,0 +1,283 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+//go:build linux && arm64
+
+package native
+
+import "encoding/binary"
+
+// arm64 general purpose registers. Register 31 is the zero register in the
+// instructions below.
+const (
+	x0  = 0
+	x1  = 1
+	x2  = 2
+	x3  = 3
+	x4  = 4
+	x5  = 5
+	x6  = 6
+	x7  = 7
+	x8  = 8
+	x9  = 9
+	x10 = 10
+	xzr = 31
+)
+
+// arm64 condition codes, as used by b.cond, csel and cset.
+const (
+	condEQ = 0x0 // equal
+	condNE = 0x1 // not equal
+	condHS = 0x2 // unsigned higher or same (unsigned >=)
+	condLO = 0x3 // unsigned lower (unsigned <)
+	condHI = 0x8 // unsigned higher (unsigned >)
+	condLS = 0x9 // unsigned lower or same (unsigned <=)
+	condGE = 0xa // signed greater or equal
+	condLT = 0xb // signed less
+	condGT = 0xc // signed greater
+	condLE = 0xd // signed less or equal
+)
+
+// Opcodes of the 32-bit forms of the data processing instructions taking
+// three registers, the sf bit selects their 64-bit form.
+const (
+	opADD  = 0x0b000000
+	opSUB  = 0x4b000000
+	opSUBS = 0x6b000000
+	opAND  = 0x0a000000
+	opORR  = 0x2a000000
+	opEOR  = 0x4a000000
+	opMUL  = 0x1b007c00 // madd with the zero register as addend
+	opLSLV = 0x1ac02000
+	opLSRV = 0x1ac02400
+	opASRV = 0x1ac02800
+	opRORV = 0x1ac02c00
+	opCSEL = 0x1a800000
+
+	sf = 1 << 31
+)
+
+// Opcodes of the loads and stores addressing the linear memory, with a
+// register offset.
+const (
+	opLDRB   = 0x38606800
+	opLDRSBW = 0x38e06800 // sign extends to 32 bits
+	opLDRSBX = 0x38a06800 // sign extends to 64 bits
+	opLDRH   = 0x78606800
+	opLDRSHW = 0x78e06800
+	opLDRSHX = 0x78a06800
+	opLDRW   = 0xb8606800
+	opLDRSW  = 0xb8a06800
+	opLDRX   = 0xf8606800
+	opSTRB   = 0x38206800
+	opSTRH   = 0x78206800
+	opSTRW   = 0xb8206800
+	opSTRX   = 0xf8206800
+)
+
+// assembler encodes the small subset of arm64 instructions the compiler
+// needs. x10 holds the immediates which don't fit in an instruction.
+type assembler struct {
+	buf []byte
+}
+
+func (a *assembler) pos() int {
+	return len(a.buf)
+}
+
+func (a *assembler) emit(ins uint32) {
+	a.buf = append(a.buf, byte(ins), byte(ins>>8), byte(ins>>16), byte(ins>>24))
+}
+
+// patch makes the branch or adr instruction at the given position target
+// the given position. It returns false if the target is out of the range
+// of the instruction.
+func (a *assembler) patch(at, target int) bool {
+	ins := binary.LittleEndian.Uint32(a.buf[at:])
+	offset := target - at
+	switch {
+	case ins&0xfc000000 == 0x14000000: // b
+		if offset < -1<<27 || offset >= 1<<27 {
+			return false
+		}
+		ins |= uint32(offset>>2) & 0x3ffffff
+	case ins&0x9f000000 == 0x10000000: // adr
+		if offset < -1<<20 || offset >= 1<<20 {
+			return false
+		}
+		ins |= uint32(offset&3)<<29 | uint32(offset>>2)&0x7ffff<<5
+	default: // b.cond, cbz and cbnz
+		if offset < -1<<20 || offset >= 1<<20 {
+			return false
+		}
+		ins |= uint32(offset>>2) & 0x7ffff << 5
+	}
+	binary.LittleEndian.PutUint32(a.buf[at:], ins)
+	return true
+}
+
+// rrr emits the data processing instruction opcode with the registers rd,
+// rn and rm.
+func (a *assembler) rrr(w bool, opcode uint32, rd, rn, rm int) {
+	if w {
+		opcode |= sf
+	}
+	a.emit(opcode | uint32(rm)<<16 | uint32(rn)<<5 | uint32(rd))
+}
+
+// movImm emits movz and movk instructions setting reg to v.
+func (a *assembler) movImm(reg int, v uint64) {
+	a.emit(0xd2800000 | uint32(v&0xffff)<<5 | uint32(reg)) // movz
+	for hw := uint32(1); hw < 4; hw++ {
+		if chunk := uint32(v>>(16*hw)) & 0xffff; chunk != 0 {
+			a.emit(0xf2800000 | hw<<21 | chunk<<5 | uint32(reg)) // movk
+		}
+	}
+}
+
+// addImm emits add rd, rn, imm. The 32-bit form zero extends the result.
+func (a *assembler) addImm(w bool, rd, rn int, imm uint32) {
+	if imm < 1<<12 {
+		ins := uint32(0x11000000)
+		if w {
+			ins |= sf
+		}
+		a.emit(ins | imm<<10 | uint32(rn)<<5 | uint32(rd))
+		return
+	}
+	a.movImm(x10, uint64(imm))
+	a.rrr(w, opADD, rd, rn, x10)
+}
+
+// subImm emits sub rd, rn, imm on 64 bits.
+func (a *assembler) subImm(rd, rn int, imm uint32) {
+	if imm < 1<<12 {
+		a.emit(0xd1000000 | imm<<10 | uint32(rn)<<5 | uint32(rd))
+		return
+	}
+	a.movImm(x10, uint64(imm))
+	a.rrr(true, opSUB, rd, rn, x10)
+}
+
+// subsImm emits subs rd, rn, imm on 64 bits, setting the flags, imm being
+// less than 4096.
+func (a *assembler) subsImm(rd, rn int, imm uint32) {
+	a.emit(0xf1000000 | imm<<10 | uint32(rn)<<5 | uint32(rd))
+}
+
+// cmpImm emits cmp rn, imm, imm being less than 4096.
+func (a *assembler) cmpImm(w bool, rn int, imm uint32) {
+	ins := uint32(0x7100001f)
+	if w {
+		ins |= sf
+	}
+	a.emit(ins | imm<<10 | uint32(rn)<<5)
+}
+
+// cmp emits cmp rn, rm.
+func (a *assembler) cmp(w bool, rn, rm int) {
+	a.rrr(w, opSUBS, xzr, rn, rm)
+}
+
+// csel emits csel rd, rn, rm, cond, setting rd to rn if cond holds and to
+// rm otherwise.
+func (a *assembler) csel(w bool, rd, rn, rm int, cond uint32) {
+	a.rrr(w, opCSEL|cond<<12, rd, rn, rm)
+}
+
+// cset emits cset rd, cond, setting rd to 1 if cond holds and to 0
+// otherwise.
+func (a *assembler) cset(rd int, cond uint32) {
+	a.emit(0x9a9f07e0 | (cond^1)<<12 | uint32(rd)) // csinc rd, xzr, xzr, !cond
+}
+
+// load emits ldr dst, [base+disp].
+func (a *assembler) load(dst, base int, disp int32) {
+	switch {
+	case disp >= 0 && disp%8 == 0 && disp < 8<<12:
+		a.emit(0xf9400000 | uint32(disp/8)<<10 | uint32(base)<<5 | uint32(dst))
+	case disp >= -256 && disp < 256:
+		a.emit(0xf8400000 | uint32(disp)&0x1ff<<12 | uint32(base)<<5 | uint32(dst)) // ldur
+	default:
+		a.movImm(x10, uint64(int64(disp)))
+		a.emit(opLDRX | x10<<16 | uint32(base)<<5 | uint32(dst))
+	}
+}
+
+// store emits str src, [base+disp].
+func (a *assembler) store(base int, disp int32, src int) {
+	switch {
+	case disp >= 0 && disp%8 == 0 && disp < 8<<12:
+		a.emit(0xf9000000 | uint32(disp/8)<<10 | uint32(base)<<5 | uint32(src))
+	case disp >= -256 && disp < 256:
+		a.emit(0xf8000000 | uint32(disp)&0x1ff<<12 | uint32(base)<<5 | uint32(src)) // stur
+	default:
+		a.movImm(x10, uint64(int64(disp)))
+		a.emit(opSTRX | x10<<16 | uint32(base)<<5 | uint32(src))
+	}
+}
+
+// loadPre emits ldr dst, [base, #disp]!, which updates base to base+disp
+// before loading.
+func (a *assembler) loadPre(dst, base int, disp int32) {
+	a.emit(0xf8400c00 | uint32(disp)&0x1ff<<12 | uint32(base)<<5 | uint32(dst))
+}
+
+// storePost emits str src, [base], #disp, which updates base to base+disp
+// after storing.
+func (a *assembler) storePost(base int, disp int32, src int) {
+	a.emit(0xf8000400 | uint32(disp)&0x1ff<<12 | uint32(base)<<5 | uint32(src))
+}
+
+// heapOp emits the load or store opcode of reg with a [x3+x7] operand,
+// addressing the linear memory.
+func (a *assembler) heapOp(opcode uint32, reg int) {
+	a.emit(opcode | x7<<16 | x3<<5 | uint32(reg))
+}
+
+// b emits an unconditional branch, and returns its position to patch.
+func (a *assembler) b() int {
+	a.emit(0x14000000)
+	return a.pos() - 4
+}
+
+// bcond emits a conditional branch, and returns its position to patch.
+func (a *assembler) bcond(cond uint32) int {
+	a.emit(0x54000000 | cond)
+	return a.pos() - 4
+}
+
+// cbz emits a branch taken if the low 32 bits of reg are zero, or nonzero
+// if nz is set, and returns its position to patch.
+func (a *assembler) cbz(nz bool, reg int) int {
+	ins := uint32(0x34000000)
+	if nz {
+		ins |= 1 << 24
+	}
+	a.emit(ins | uint32(reg))
+	return a.pos() - 4
+}
+
+// adr emits adr reg, with a zero offset, and returns its position to
+// patch.
+func (a *assembler) adr(reg int) int {
+	a.emit(0x10000000 | uint32(reg))
+	return a.pos() - 4
+}
+
+func (a *assembler) ret() {
+	a.emit(0xd65f03c0)
+}
@@ -0,0 +1,33 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build linux
+
+#include "textflag.h"
+
+// func callNative(f *frame) uint64
+TEXT ·callNative(SB), NOSPLIT, $0-16
+	MOVQ f+0(FP), R11
+	MOVQ 8(R11), SI
+	MOVQ 16(R11), DI
+	MOVQ 24(R11), R8
+	MOVQ 32(R11), R9
+	MOVQ 40(R11), R10
+	MOVQ 0(R11), AX
+	CALL AX
+	MOVQ AX, ret+8(FP)
+	RET
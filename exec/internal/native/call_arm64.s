@@ -0,0 +1,32 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+//go:build linux
+
+#include "textflag.h"
+
+// func callNative(f *frame) uint64
+TEXT ·callNative(SB), NOSPLIT, $0-16
+	MOVD f+0(FP), R6
+	MOVD 8(R6), R1
+	MOVD 16(R6), R2
+	MOVD 24(R6), R3
+	MOVD 32(R6), R4
+	MOVD 40(R6), R5
+	MOVD 0(R6), R0
+	CALL (R0)
+	MOVD R0, ret+8(FP)
+	RET
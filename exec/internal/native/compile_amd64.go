@@ -0,0 +1,395 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build linux && amd64
+
+package native
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/compile"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// Register usage of native code:
+//   rsi: address of the next free slot of the operand stack
+//   rdi: address of the locals
+//   r8:  address of the linear memory
+//   r9:  length of the linear memory
+//   r10: address of the globals
+//   r11: address of the frame
+//   rax, rcx, rdx: scratch registers
+// On return, rax holds the Trap and the frame holds the stack pointer, and
+// for a call the address to resume at, the index of the callee and the
+// bytecode address following the call.
+
+type binop struct {
+	w      bool
+	opcode []byte // opcode and ModRM of the instruction computing rax = rax op rcx
+}
+
+var binops = map[byte]binop{
+	ops.I32Add:  {false, []byte{0x01, 0xc8}},
+	ops.I32Sub:  {false, []byte{0x29, 0xc8}},
+	ops.I32Mul:  {false, []byte{0x0f, 0xaf, 0xc1}},
+	ops.I32And:  {false, []byte{0x21, 0xc8}},
+	ops.I32Or:   {false, []byte{0x09, 0xc8}},
+	ops.I32Xor:  {false, []byte{0x31, 0xc8}},
+	ops.I32Rotl: {false, []byte{0xd3, 0xc0}},
+	ops.I32Rotr: {false, []byte{0xd3, 0xc8}},
+	ops.I64Add:  {true, []byte{0x01, 0xc8}},
+	ops.I64Sub:  {true, []byte{0x29, 0xc8}},
+	ops.I64Mul:  {true, []byte{0x0f, 0xaf, 0xc1}},
+	ops.I64And:  {true, []byte{0x21, 0xc8}},
+	ops.I64Or:   {true, []byte{0x09, 0xc8}},
+	ops.I64Xor:  {true, []byte{0x31, 0xc8}},
+	ops.I64Rotl: {true, []byte{0xd3, 0xc0}},
+	ops.I64Rotr: {true, []byte{0xd3, 0xc8}},
+}
+
+type compare struct {
+	w  bool
+	cc byte
+}
+
+var compares = map[byte]compare{
+	ops.I32Eq:  {false, ccE},
+	ops.I32Ne:  {false, ccNE},
+	ops.I32LtS: {false, ccL},
+	ops.I32LtU: {false, ccB},
+	ops.I32GtS: {false, ccG},
+	ops.I32GtU: {false, ccA},
+	ops.I32LeS: {false, ccLE},
+	ops.I32LeU: {false, ccBE},
+	ops.I32GeS: {false, ccGE},
+	ops.I32GeU: {false, ccAE},
+	ops.I64Eq:  {true, ccE},
+	ops.I64Ne:  {true, ccNE},
+	ops.I64LtS: {true, ccL},
+	ops.I64LtU: {true, ccB},
+	ops.I64GtS: {true, ccG},
+	ops.I64GtU: {true, ccA},
+	ops.I64LeS: {true, ccLE},
+	ops.I64LeU: {true, ccBE},
+	ops.I64GeS: {true, ccGE},
+	ops.I64GeU: {true, ccAE},
+}
+
+type shift struct {
+	w   bool
+	ext int // opcode extension of the shift instruction
+}
+
+var shifts = map[byte]shift{
+	ops.I32Shl:  {false, 4},
+	ops.I32ShrU: {false, 5},
+	ops.I32ShrS: {false, 7},
+	ops.I64Shl:  {true, 4},
+	ops.I64ShrU: {true, 5},
+	ops.I64ShrS: {true, 7},
+}
+
+type memAccess struct {
+	store  bool
+	width  int32
+	w      bool
+	opcode []byte
+}
+
+var memAccesses = map[byte]memAccess{
+	ops.I32Load:    {false, 4, false, []byte{0x8b}},
+	ops.F32Load:    {false, 4, false, []byte{0x8b}},
+	ops.I64Load32u: {false, 4, false, []byte{0x8b}},
+	ops.I64Load:    {false, 8, true, []byte{0x8b}},
+	ops.F64Load:    {false, 8, true, []byte{0x8b}},
+	ops.I32Load8s:  {false, 1, false, []byte{0x0f, 0xbe}},
+	ops.I64Load8s:  {false, 1, true, []byte{0x0f, 0xbe}},
+	ops.I32Load8u:  {false, 1, false, []byte{0x0f, 0xb6}},
+	ops.I64Load8u:  {false, 1, false, []byte{0x0f, 0xb6}},
+	ops.I32Load16s: {false, 2, false, []byte{0x0f, 0xbf}},
+	ops.I64Load16s: {false, 2, true, []byte{0x0f, 0xbf}},
+	ops.I32Load16u: {false, 2, false, []byte{0x0f, 0xb7}},
+	ops.I64Load16u: {false, 2, false, []byte{0x0f, 0xb7}},
+	ops.I64Load32s: {false, 4, true, []byte{0x63}},
+	ops.I32Store:   {true, 4, false, []byte{0x89}},
+	ops.F32Store:   {true, 4, false, []byte{0x89}},
+	ops.I64Store32: {true, 4, false, []byte{0x89}},
+	ops.I64Store:   {true, 8, true, []byte{0x89}},
+	ops.F64Store:   {true, 8, true, []byte{0x89}},
+	ops.I32Store8:  {true, 1, false, []byte{0x88}},
+	ops.I64Store8:  {true, 1, false, []byte{0x88}},
+	ops.I32Store16: {true, 2, false, []byte{0x66, 0x89}},
+	ops.I64Store16: {true, 2, false, []byte{0x66, 0x89}},
+}
+
+type fixup struct {
+	at     int   // position of the displacement in the machine code
+	target int64 // bytecode address
+}
+
+type compiler struct {
+	assembler
+	labels map[int64]int // maps bytecode addresses to machine code positions
+	jumps  []fixup       // jumps to bytecode addresses
+	yields []fixup       // jumps to the yield stub resuming at a bytecode address
+	traps  []int         // jumps to the out of bounds trap stub
+}
+
+// Compile lowers code, which was produced by compile.Compile for a function
+// with the given number of locals, in a module with the given number of
+// globals and the given functions, to native code. It returns
+// ErrUnsupported if code uses an instruction the backend can't lower.
+func Compile(code []byte, locals, globals int, funcs []Func) (*Code, error) {
+	instrs, err := decode(code)
+	if err != nil {
+		return nil, err
+	}
+	heights, maxHeight, err := stackHeights(instrs, locals, globals, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{labels: make(map[int64]int, len(instrs))}
+	for i, in := range instrs {
+		c.labels[in.pc] = c.pos()
+		if heights[i] == -1 {
+			// unreachable code
+			continue
+		}
+		c.instr(in)
+	}
+	c.epilogue(TrapNone)
+
+	for _, f := range c.jumps {
+		c.patch32(f.at, int32(c.labels[f.target]-(f.at+4)))
+	}
+	for _, f := range c.yields {
+		c.patch32(f.at, int32(c.pos()-(f.at+4)))
+		// resume at the jump target
+		at := c.leaRIP(rax)
+		c.patch32(at, int32(c.labels[f.target]-(at+4)))
+		c.store(r11, frameEntry, rax)
+		c.epilogue(trapYield)
+	}
+	if len(c.traps) != 0 {
+		for _, at := range c.traps {
+			c.patch32(at, int32(c.pos()-(at+4)))
+		}
+		c.epilogue(TrapOutOfBounds)
+	}
+
+	return Load(c.buf, maxHeight)
+}
+
+// epilogue saves the stack pointer and returns the given trap.
+func (c *compiler) epilogue(trap Trap) {
+	c.store(r11, frameSP, rsi)
+	c.movImm32(rax, uint32(trap))
+	c.ret()
+}
+
+// jump emits a jump to the bytecode address target. Backward jumps first
+// decrement the budget of the frame, and yield once it is exhausted.
+func (c *compiler) jump(target, pc int64) {
+	if target <= pc {
+		c.memOp(true, []byte{0x83}, 5, r11, frameBudget)
+		c.emit(1)
+		c.yields = append(c.yields, fixup{c.jcc(ccE), target})
+	}
+	c.jumps = append(c.jumps, fixup{c.jmp(), target})
+}
+
+// call emits the code exiting to the Caller for a call, and resuming after
+// it.
+func (c *compiler) call(in instr) {
+	c.movImm32(rax, uint32(in.imm))
+	c.store(r11, frameCallee, rax)
+	c.movImm32(rax, uint32(in.pc+5))
+	c.store(r11, framePC, rax)
+	at := c.leaRIP(rax)
+	c.store(r11, frameEntry, rax)
+	c.epilogue(trapCall)
+	c.patch32(at, int32(c.pos()-(at+4)))
+}
+
+// discard emits the code for dropping n values from the stack, preserving
+// the top value if preserve is set.
+func (c *compiler) discard(n int64, preserve bool) {
+	if preserve {
+		c.load(rax, rsi, -8)
+		c.aluImm(true, 5, rsi, int32(n*8))
+		c.store(rsi, 0, rax)
+		c.aluImm(true, 0, rsi, 8)
+	} else if n != 0 {
+		c.aluImm(true, 5, rsi, int32(n*8))
+	}
+}
+
+func (c *compiler) push(src int) {
+	c.store(rsi, 0, src)
+	c.aluImm(true, 0, rsi, 8)
+}
+
+func (c *compiler) pop(dst int) {
+	c.aluImm(true, 5, rsi, 8)
+	c.load(dst, rsi, 0)
+}
+
+func (c *compiler) instr(in instr) {
+	switch op := in.op; {
+	case op == ops.Nop:
+	case op == ops.Return:
+		c.epilogue(TrapNone)
+	case op == compile.OpJmp:
+		c.jump(in.imm, in.pc)
+	case op == compile.OpJmpZ:
+		c.aluImm(true, 5, rsi, 8)
+		c.load32(rax, rsi, 0)
+		c.emit(0x85, 0xc0) // test eax, eax
+		skip := c.jcc(ccNE)
+		c.jump(in.imm, in.pc)
+		c.patch32(skip, int32(c.pos()-(skip+4)))
+	case op == compile.OpJmpNz:
+		c.aluImm(true, 5, rsi, 8)
+		c.load32(rax, rsi, 0)
+		c.emit(0x85, 0xc0) // test eax, eax
+		skip := c.jcc(ccE)
+		c.discard(in.discard, in.preserve)
+		c.jump(in.imm, in.pc)
+		c.patch32(skip, int32(c.pos()-(skip+4)))
+	case op == ops.Call:
+		c.call(in)
+	case op == compile.OpDiscard:
+		c.discard(in.imm, false)
+	case op == compile.OpDiscardPreserveTop:
+		c.discard(in.imm, true)
+	case op == ops.I32Const, op == ops.F32Const:
+		c.movImm32(rax, uint32(in.imm))
+		c.push(rax)
+	case op == ops.I64Const, op == ops.F64Const:
+		c.movImm64(rax, uint64(in.imm))
+		c.push(rax)
+	case op == ops.GetLocal:
+		c.load(rax, rdi, int32(in.imm*8))
+		c.push(rax)
+	case op == ops.SetLocal:
+		c.pop(rax)
+		c.store(rdi, int32(in.imm*8), rax)
+	case op == ops.TeeLocal:
+		c.load(rax, rsi, -8)
+		c.store(rdi, int32(in.imm*8), rax)
+	case op == ops.GetGlobal:
+		c.load(rax, r10, int32(in.imm*8))
+		c.push(rax)
+	case op == ops.SetGlobal:
+		c.pop(rax)
+		c.store(r10, int32(in.imm*8), rax)
+	case op == ops.Drop:
+		c.aluImm(true, 5, rsi, 8)
+	case op == ops.Select:
+		c.load(rcx, rsi, -8)
+		c.load(rdx, rsi, -16)
+		c.load(rax, rsi, -24)
+		c.emit(0x85, 0xc9) // test ecx, ecx
+		c.cmov(true, ccE, rax, rdx)
+		c.store(rsi, -24, rax)
+		c.aluImm(true, 5, rsi, 16)
+	case isMemAccess(op):
+		c.memAccess(in)
+	case op == ops.I32Eqz, op == ops.I64Eqz:
+		c.load(rax, rsi, -8)
+		c.regOp(op == ops.I64Eqz, []byte{0x85}, rax, rax) // test
+		c.setcc(ccE)
+		c.store(rsi, -8, rax)
+	case op == ops.I64ExtendSI32:
+		c.load(rax, rsi, -8)
+		c.regOp(true, []byte{0x63}, rax, rax) // movsxd rax, eax
+		c.store(rsi, -8, rax)
+	case op == ops.I64ExtendUI32:
+		c.load32(rax, rsi, -8)
+		c.store(rsi, -8, rax)
+	case isUnop(op):
+		// i32.wrap and the reinterpret operators leave the bits unchanged
+	default:
+		c.binop(op)
+	}
+}
+
+// binop emits the code for an instruction popping two values and pushing
+// one. The semantics of the interpreter are kept: comparisons and 32-bit
+// operators only use the low 32 bits of their operands, and shifts by at
+// least the width of the operand yield 0 (or the sign for shr_s) instead of
+// using the count modulo the width.
+func (c *compiler) binop(op byte) {
+	c.load(rcx, rsi, -8)
+	c.load(rax, rsi, -16)
+	if b, ok := binops[op]; ok {
+		c.rex(b.w, 0, 0, 0)
+		c.emit(b.opcode...)
+	} else if cmp, ok := compares[op]; ok {
+		c.regOp(cmp.w, []byte{0x39}, rcx, rax) // cmp rax, rcx
+		c.setcc(cmp.cc)
+	} else {
+		s := shifts[op]
+		width := int32(32)
+		if s.w {
+			width = 64
+		}
+		if s.ext == 7 {
+			c.movImm32(rdx, uint32(width-1))
+			c.aluImm(s.w, 7, rcx, width)
+			c.cmov(false, ccAE, rcx, rdx)
+			c.regOp(s.w, []byte{0xd3}, s.ext, rax)
+		} else {
+			c.regOp(s.w, []byte{0xd3}, s.ext, rax)
+			c.emit(0x31, 0xd2) // xor edx, edx
+			c.aluImm(s.w, 7, rcx, width)
+			c.cmov(s.w, ccAE, rax, rdx)
+		}
+	}
+	c.store(rsi, -16, rax)
+	c.aluImm(true, 5, rsi, 8)
+}
+
+// memAccess emits a load or store, along with its bounds check.
+func (c *compiler) memAccess(in instr) {
+	m := memAccesses[in.op]
+	base := int32(-8)
+	if m.store {
+		c.load(rdx, rsi, -8)
+		base = -16
+	}
+	// the effective address wraps around like in the interpreter
+	c.load32(rax, rsi, base)
+	c.aluImm(false, 0, rax, int32(uint32(in.imm)))
+	if !in.unchecked {
+		c.emit(0x48, 0x8d, 0x48, byte(m.width-1)) // lea rcx, [rax+width-1]
+		c.regOp(true, []byte{0x39}, r9, rcx)      // cmp rcx, r9
+		c.traps = append(c.traps, c.jcc(ccAE))
+	}
+	if m.store {
+		if m.opcode[0] == 0x66 {
+			c.emit(0x66)
+			c.heapOp(m.w, m.opcode[1:], rdx)
+		} else {
+			c.heapOp(m.w, m.opcode, rdx)
+		}
+		c.aluImm(true, 5, rsi, 16)
+	} else {
+		c.heapOp(m.w, m.opcode, rax)
+		c.store(rsi, -8, rax)
+	}
+}
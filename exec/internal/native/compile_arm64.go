@@ -0,0 +1,397 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+//go:build linux && arm64
+
+package native
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/compile"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// Register usage of native code:
+//   x1:  address of the next free slot of the operand stack
+//   x2:  address of the locals
+//   x3:  address of the linear memory
+//   x4:  length of the linear memory
+//   x5:  address of the globals
+//   x6:  address of the frame
+//   x7, x8, x9, x10: scratch registers
+// On return, x0 holds the Trap and the frame holds the stack pointer, and
+// for a call the address to resume at, the index of the callee and the
+// bytecode address following the call. The link register, the frame
+// pointer and the registers reserved by Go are left untouched.
+
+type binop struct {
+	w      bool
+	opcode uint32 // instruction computing x7 = x7 op x8
+	negate bool   // negate x8 first, rotating left by rotating right
+}
+
+var binops = map[byte]binop{
+	ops.I32Add:  {false, opADD, false},
+	ops.I32Sub:  {false, opSUB, false},
+	ops.I32Mul:  {false, opMUL, false},
+	ops.I32And:  {false, opAND, false},
+	ops.I32Or:   {false, opORR, false},
+	ops.I32Xor:  {false, opEOR, false},
+	ops.I32Rotl: {false, opRORV, true},
+	ops.I32Rotr: {false, opRORV, false},
+	ops.I64Add:  {true, opADD, false},
+	ops.I64Sub:  {true, opSUB, false},
+	ops.I64Mul:  {true, opMUL, false},
+	ops.I64And:  {true, opAND, false},
+	ops.I64Or:   {true, opORR, false},
+	ops.I64Xor:  {true, opEOR, false},
+	ops.I64Rotl: {true, opRORV, true},
+	ops.I64Rotr: {true, opRORV, false},
+}
+
+type compare struct {
+	w    bool
+	cond uint32
+}
+
+var compares = map[byte]compare{
+	ops.I32Eq:  {false, condEQ},
+	ops.I32Ne:  {false, condNE},
+	ops.I32LtS: {false, condLT},
+	ops.I32LtU: {false, condLO},
+	ops.I32GtS: {false, condGT},
+	ops.I32GtU: {false, condHI},
+	ops.I32LeS: {false, condLE},
+	ops.I32LeU: {false, condLS},
+	ops.I32GeS: {false, condGE},
+	ops.I32GeU: {false, condHS},
+	ops.I64Eq:  {true, condEQ},
+	ops.I64Ne:  {true, condNE},
+	ops.I64LtS: {true, condLT},
+	ops.I64LtU: {true, condLO},
+	ops.I64GtS: {true, condGT},
+	ops.I64GtU: {true, condHI},
+	ops.I64LeS: {true, condLE},
+	ops.I64LeU: {true, condLS},
+	ops.I64GeS: {true, condGE},
+	ops.I64GeU: {true, condHS},
+}
+
+type shift struct {
+	w      bool
+	opcode uint32
+}
+
+var shifts = map[byte]shift{
+	ops.I32Shl:  {false, opLSLV},
+	ops.I32ShrU: {false, opLSRV},
+	ops.I32ShrS: {false, opASRV},
+	ops.I64Shl:  {true, opLSLV},
+	ops.I64ShrU: {true, opLSRV},
+	ops.I64ShrS: {true, opASRV},
+}
+
+type memAccess struct {
+	store  bool
+	width  int32
+	opcode uint32
+}
+
+var memAccesses = map[byte]memAccess{
+	ops.I32Load:    {false, 4, opLDRW},
+	ops.F32Load:    {false, 4, opLDRW},
+	ops.I64Load32u: {false, 4, opLDRW},
+	ops.I64Load:    {false, 8, opLDRX},
+	ops.F64Load:    {false, 8, opLDRX},
+	ops.I32Load8s:  {false, 1, opLDRSBW},
+	ops.I64Load8s:  {false, 1, opLDRSBX},
+	ops.I32Load8u:  {false, 1, opLDRB},
+	ops.I64Load8u:  {false, 1, opLDRB},
+	ops.I32Load16s: {false, 2, opLDRSHW},
+	ops.I64Load16s: {false, 2, opLDRSHX},
+	ops.I32Load16u: {false, 2, opLDRH},
+	ops.I64Load16u: {false, 2, opLDRH},
+	ops.I64Load32s: {false, 4, opLDRSW},
+	ops.I32Store:   {true, 4, opSTRW},
+	ops.F32Store:   {true, 4, opSTRW},
+	ops.I64Store32: {true, 4, opSTRW},
+	ops.I64Store:   {true, 8, opSTRX},
+	ops.F64Store:   {true, 8, opSTRX},
+	ops.I32Store8:  {true, 1, opSTRB},
+	ops.I64Store8:  {true, 1, opSTRB},
+	ops.I32Store16: {true, 2, opSTRH},
+	ops.I64Store16: {true, 2, opSTRH},
+}
+
+type fixup struct {
+	at     int   // position of the branch in the machine code
+	target int64 // bytecode address
+}
+
+type compiler struct {
+	assembler
+	labels map[int64]int // maps bytecode addresses to machine code positions
+	jumps  []fixup       // jumps to bytecode addresses
+	yields []fixup       // jumps to the yield stub resuming at a bytecode address
+	traps  []int         // jumps to the out of bounds trap stub
+	far    bool          // a branch doesn't reach its target
+}
+
+// Compile lowers code, which was produced by compile.Compile for a function
+// with the given number of locals, in a module with the given number of
+// globals and the given functions, to native code. It returns
+// ErrUnsupported if code uses an instruction the backend can't lower, or
+// if the machine code is too large for its conditional branches.
+func Compile(code []byte, locals, globals int, funcs []Func) (*Code, error) {
+	instrs, err := decode(code)
+	if err != nil {
+		return nil, err
+	}
+	heights, maxHeight, err := stackHeights(instrs, locals, globals, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{labels: make(map[int64]int, len(instrs))}
+	for i, in := range instrs {
+		c.labels[in.pc] = c.pos()
+		if heights[i] == -1 {
+			// unreachable code
+			continue
+		}
+		c.instr(in)
+	}
+	c.epilogue(TrapNone)
+
+	for _, f := range c.jumps {
+		c.branch(f.at, c.labels[f.target])
+	}
+	for _, f := range c.yields {
+		c.branch(f.at, c.pos())
+		// resume at the jump target
+		c.branch(c.adr(x7), c.labels[f.target])
+		c.store(x6, frameEntry, x7)
+		c.epilogue(trapYield)
+	}
+	if len(c.traps) != 0 {
+		for _, at := range c.traps {
+			c.branch(at, c.pos())
+		}
+		c.epilogue(TrapOutOfBounds)
+	}
+	if c.far {
+		return nil, ErrUnsupported
+	}
+
+	return Load(c.buf, maxHeight)
+}
+
+// branch patches the branch at the given position to target the given
+// position, recording whether it is out of range.
+func (c *compiler) branch(at, target int) {
+	if !c.patch(at, target) {
+		c.far = true
+	}
+}
+
+// epilogue saves the stack pointer and returns the given trap.
+func (c *compiler) epilogue(trap Trap) {
+	c.store(x6, frameSP, x1)
+	c.movImm(x0, uint64(trap))
+	c.ret()
+}
+
+// jump emits a jump to the bytecode address target. Backward jumps first
+// decrement the budget of the frame, and yield once it is exhausted.
+func (c *compiler) jump(target, pc int64) {
+	if target <= pc {
+		c.load(x7, x6, frameBudget)
+		c.subsImm(x7, x7, 1)
+		c.store(x6, frameBudget, x7)
+		c.yields = append(c.yields, fixup{c.bcond(condEQ), target})
+	}
+	c.jumps = append(c.jumps, fixup{c.b(), target})
+}
+
+// call emits the code exiting to the Caller for a call, and resuming after
+// it.
+func (c *compiler) call(in instr) {
+	c.movImm(x7, uint64(uint32(in.imm)))
+	c.store(x6, frameCallee, x7)
+	c.movImm(x7, uint64(in.pc+5))
+	c.store(x6, framePC, x7)
+	at := c.adr(x7)
+	c.store(x6, frameEntry, x7)
+	c.epilogue(trapCall)
+	c.branch(at, c.pos())
+}
+
+// discard emits the code for dropping n values from the stack, preserving
+// the top value if preserve is set.
+func (c *compiler) discard(n int64, preserve bool) {
+	if preserve {
+		c.load(x7, x1, -8)
+		c.subImm(x1, x1, uint32(n*8))
+		c.push(x7)
+	} else if n != 0 {
+		c.subImm(x1, x1, uint32(n*8))
+	}
+}
+
+func (c *compiler) push(src int) {
+	c.storePost(x1, 8, src)
+}
+
+func (c *compiler) pop(dst int) {
+	c.loadPre(dst, x1, -8)
+}
+
+func (c *compiler) instr(in instr) {
+	switch op := in.op; {
+	case op == ops.Nop:
+	case op == ops.Return:
+		c.epilogue(TrapNone)
+	case op == compile.OpJmp:
+		c.jump(in.imm, in.pc)
+	case op == compile.OpJmpZ:
+		c.pop(x7)
+		skip := c.cbz(true, x7)
+		c.jump(in.imm, in.pc)
+		c.branch(skip, c.pos())
+	case op == compile.OpJmpNz:
+		c.pop(x7)
+		skip := c.cbz(false, x7)
+		c.discard(in.discard, in.preserve)
+		c.jump(in.imm, in.pc)
+		c.branch(skip, c.pos())
+	case op == ops.Call:
+		c.call(in)
+	case op == compile.OpDiscard:
+		c.discard(in.imm, false)
+	case op == compile.OpDiscardPreserveTop:
+		c.discard(in.imm, true)
+	case op == ops.I32Const, op == ops.F32Const:
+		c.movImm(x7, uint64(uint32(in.imm)))
+		c.push(x7)
+	case op == ops.I64Const, op == ops.F64Const:
+		c.movImm(x7, uint64(in.imm))
+		c.push(x7)
+	case op == ops.GetLocal:
+		c.load(x7, x2, int32(in.imm*8))
+		c.push(x7)
+	case op == ops.SetLocal:
+		c.pop(x7)
+		c.store(x2, int32(in.imm*8), x7)
+	case op == ops.TeeLocal:
+		c.load(x7, x1, -8)
+		c.store(x2, int32(in.imm*8), x7)
+	case op == ops.GetGlobal:
+		c.load(x7, x5, int32(in.imm*8))
+		c.push(x7)
+	case op == ops.SetGlobal:
+		c.pop(x7)
+		c.store(x5, int32(in.imm*8), x7)
+	case op == ops.Drop:
+		c.subImm(x1, x1, 8)
+	case op == ops.Select:
+		c.load(x8, x1, -8)
+		c.load(x9, x1, -16)
+		c.load(x7, x1, -24)
+		c.cmpImm(false, x8, 0)
+		c.csel(true, x7, x7, x9, condNE)
+		c.store(x1, -24, x7)
+		c.subImm(x1, x1, 16)
+	case isMemAccess(op):
+		c.memAccess(in)
+	case op == ops.I32Eqz, op == ops.I64Eqz:
+		c.load(x7, x1, -8)
+		c.cmpImm(op == ops.I64Eqz, x7, 0)
+		c.cset(x7, condEQ)
+		c.store(x1, -8, x7)
+	case op == ops.I64ExtendSI32:
+		c.load(x7, x1, -8)
+		c.emit(0x93407c00 | x7<<5 | x7) // sxtw x7, w7
+		c.store(x1, -8, x7)
+	case op == ops.I64ExtendUI32:
+		c.load(x7, x1, -8)
+		c.rrr(false, opORR, x7, xzr, x7) // mov w7, w7
+		c.store(x1, -8, x7)
+	case isUnop(op):
+		// i32.wrap and the reinterpret operators leave the bits unchanged
+	default:
+		c.binop(op)
+	}
+}
+
+// binop emits the code for an instruction popping two values and pushing
+// one. The semantics of the interpreter are kept: comparisons and 32-bit
+// operators only use the low 32 bits of their operands, and shifts by at
+// least the width of the operand yield 0 (or the sign for shr_s) instead of
+// using the count modulo the width.
+func (c *compiler) binop(op byte) {
+	c.load(x8, x1, -8)
+	c.load(x7, x1, -16)
+	if b, ok := binops[op]; ok {
+		if b.negate {
+			c.rrr(b.w, opSUB, x8, xzr, x8)
+		}
+		c.rrr(b.w, b.opcode, x7, x7, x8)
+	} else if cmp, ok := compares[op]; ok {
+		c.cmp(cmp.w, x7, x8)
+		c.cset(x7, cmp.cond)
+	} else {
+		s := shifts[op]
+		width := uint32(32)
+		if s.w {
+			width = 64
+		}
+		c.cmpImm(s.w, x8, width)
+		if s.opcode == opASRV {
+			c.movImm(x9, uint64(width-1))
+			c.csel(s.w, x8, x9, x8, condHS)
+			c.rrr(s.w, s.opcode, x7, x7, x8)
+		} else {
+			c.rrr(s.w, s.opcode, x7, x7, x8)
+			c.csel(s.w, x7, xzr, x7, condHS)
+		}
+	}
+	c.store(x1, -16, x7)
+	c.subImm(x1, x1, 8)
+}
+
+// memAccess emits a load or store, along with its bounds check.
+func (c *compiler) memAccess(in instr) {
+	m := memAccesses[in.op]
+	base := int32(-8)
+	if m.store {
+		c.load(x9, x1, -8)
+		base = -16
+	}
+	// the effective address wraps around like in the interpreter
+	c.load(x7, x1, base)
+	c.addImm(false, x7, x7, uint32(in.imm))
+	if !in.unchecked {
+		c.addImm(true, x8, x7, uint32(m.width-1))
+		c.cmp(true, x8, x4)
+		c.traps = append(c.traps, c.bcond(condHS))
+	}
+	if m.store {
+		c.heapOp(m.opcode, x9)
+		c.subImm(x1, x1, 16)
+	} else {
+		c.heapOp(m.opcode, x7)
+		c.store(x1, -8, x7)
+	}
+}
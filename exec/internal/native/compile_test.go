@@ -0,0 +1,139 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build linux && (amd64 || arm64)
+
+package native
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/compile"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+type bytecode struct {
+	bytes.Buffer
+}
+
+func (b *bytecode) op(op byte, imms ...interface{}) *bytecode {
+	b.WriteByte(op)
+	for _, imm := range imms {
+		binary.Write(b, binary.LittleEndian, imm)
+	}
+	return b
+}
+
+func TestLoopYields(t *testing.T) {
+	// sums the integers from 1 to local 0 into local 1
+	b := &bytecode{}
+	b.op(ops.GetLocal, uint32(0))
+	b.op(compile.OpJmpZ, int64(59))
+	b.op(ops.GetLocal, uint32(1)).op(ops.GetLocal, uint32(0)).op(ops.I64Add).op(ops.SetLocal, uint32(1))
+	b.op(ops.GetLocal, uint32(0)).op(ops.I64Const, int64(1)).op(ops.I64Sub).op(ops.SetLocal, uint32(0))
+	b.op(compile.OpJmp, int64(0))
+	if b.Len() != 59 {
+		t.Fatalf("unexpected bytecode length %d", b.Len())
+	}
+	b.op(ops.GetLocal, uint32(1)).op(ops.Return)
+
+	code, err := Compile(b.Bytes(), 2, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.MaxStack != 2 {
+		t.Fatalf("unexpected max stack height: got=%d, want=2", code.MaxStack)
+	}
+
+	const n = 3 * yieldInterval
+	stack := make([]uint64, code.MaxStack)
+	sp, trap := code.Run(stack, []uint64{n, 0}, nil, nil, nil)
+	if trap != TrapNone || sp != 1 {
+		t.Fatalf("unexpected result: sp=%d, trap=%d", sp, trap)
+	}
+	if want := uint64(n * (n + 1) / 2); stack[0] != want {
+		t.Fatalf("unexpected sum: got=%d, want=%d", stack[0], want)
+	}
+}
+
+func TestOutOfBounds(t *testing.T) {
+	memory := make([]byte, 16)
+	for _, test := range []struct {
+		addr   int32
+		offset uint32
+		trap   Trap
+	}{
+		{12, 0, TrapNone},
+		{13, 0, TrapOutOfBounds},
+		{8, 4, TrapNone},
+		{8, 5, TrapOutOfBounds},
+		{-1, 1, TrapNone}, // the effective address wraps around
+	} {
+		b := &bytecode{}
+		b.op(ops.I32Const, test.addr).op(ops.I32Load, test.offset)
+		code, err := Compile(b.Bytes(), 0, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, trap := code.Run(make([]uint64, code.MaxStack), nil, memory, nil, nil); trap != test.trap {
+			t.Errorf("i32.load %d offset=%d: unexpected trap: got=%d, want=%d", test.addr, test.offset, trap, test.trap)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	// stores 7 + f0(local 0, 2) at address 0, f0 growing the memory
+	b := &bytecode{}
+	b.op(ops.I32Const, int32(0))
+	b.op(ops.I32Const, int32(7))
+	b.op(ops.GetLocal, uint32(0)).op(ops.I32Const, int32(2)).op(ops.Call, uint32(0))
+	b.op(ops.I32Add).op(ops.I32Store, uint32(0))
+	funcs := []Func{{Args: 2, Results: 1}}
+	code, err := Compile(b.Bytes(), 1, 0, funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.MaxStack != 4 {
+		t.Fatalf("unexpected max stack height: got=%d, want=4", code.MaxStack)
+	}
+
+	memory := make([]byte, 0)
+	call := func(index uint32, pc int64, stack []uint64) ([]uint64, []byte) {
+		if index != 0 || pc != 25 || len(stack) != 4 {
+			t.Fatalf("unexpected call: index=%d, pc=%d, stack=%v", index, pc, stack)
+		}
+		memory = make([]byte, 8)
+		return append(stack[:2], stack[2]*stack[3]), memory
+	}
+	sp, trap := code.Run(make([]uint64, code.MaxStack), []uint64{5}, nil, nil, call)
+	if trap != TrapNone || sp != 0 {
+		t.Fatalf("unexpected result: sp=%d, trap=%d", sp, trap)
+	}
+	if got := binary.LittleEndian.Uint32(memory); got != 17 {
+		t.Fatalf("unexpected result: got=%d, want=17", got)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	b := &bytecode{}
+	b.op(ops.I32Const, int32(1)).op(ops.I32Const, int32(0)).op(ops.I32DivS)
+	if _, err := Compile(b.Bytes(), 0, 0, nil); err != ErrUnsupported {
+		t.Fatalf("unexpected error: got=%v, want=%v", err, ErrUnsupported)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package native is an ahead-of-time backend lowering the bytecode produced
+// by the compile package to native machine code.
+//
+// The backend is a template compiler: the operand stack and the locals stay
+// in memory, and every instruction is lowered to a fixed machine code
+// sequence. It supports the integer, variable, memory access and control
+// instructions, and direct calls, functions using any other instruction
+// are rejected with ErrUnsupported and keep being interpreted by the VM.
+// Memory accesses are guarded by bounds checks, which exit the native code
+// with a Trap. Calls exit the native code too, for the VM to run the callee
+// with a Caller, and resume it once the callee returned.
+//
+// Native code is only generated on linux/amd64 and linux/arm64, on every
+// other platform Compile returns ErrUnsupported.
+package native
+
+import "errors"
+
+// ErrUnsupported is returned by Compile when the bytecode can not be lowered
+// to native code on the current platform.
+var ErrUnsupported = errors.New("native: unsupported bytecode")
+
+// Trap is the reason native code stopped executing.
+type Trap uint64
+
+const (
+	// TrapNone means the code returned normally.
+	TrapNone Trap = iota
+	// TrapOutOfBounds means the code accessed the linear memory out of bounds.
+	TrapOutOfBounds
+	// trapYield means the code exhausted its budget of backward jumps,
+	// and needs to be resumed.
+	trapYield
+	// trapCall means the code calls a function, and needs to be resumed
+	// once the Caller returned.
+	trapCall
+)
+
+// Func is the number of value slots of the arguments and results of a
+// function native code may call.
+type Func struct {
+	Args, Results int
+}
+
+// Caller calls the function with the given index for native code, the
+// operand stack of the code holding its arguments on the top of stack.
+// pc is the address of the bytecode instruction following the call. It
+// returns the stack holding the results of the function instead of its
+// arguments, along with the linear memory, which the function may have
+// grown.
+type Caller func(index uint32, pc int64, stack []uint64) ([]uint64, []byte)
+
+// yieldInterval is the number of backward jumps native code takes before
+// yielding back to Go, so that the goroutine running it can be preempted.
+const yieldInterval = 1 << 16
+
+// Code is a function body compiled to native machine code.
+type Code struct {
+	// MaxStack is the maximum height of the operand stack reached by the code.
+	MaxStack int
+
+	mem   []byte  // executable mapping holding the machine code
+	entry uintptr // address of the first instruction
+}
+
+// MachineCode returns the machine code of c, which is position independent.
+func (c *Code) MachineCode() []byte {
+	return c.mem
+}
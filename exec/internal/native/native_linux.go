@@ -0,0 +1,415 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build linux && (amd64 || arm64)
+
+package native
+
+import (
+	"encoding/binary"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/compile"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// frame is shared between Run and the native code, the offsets of its
+// fields are hardcoded in the trampoline and in the generated code.
+type frame struct {
+	entry   uintptr // address execution starts (or resumes) at
+	sp      uintptr // address of the next free stack slot
+	locals  uintptr
+	memory  uintptr
+	memLen  uintptr
+	globals uintptr
+	budget  uint64 // backward jumps left until the code yields
+	callee  uint64 // index of the function called
+	pc      uint64 // bytecode address following the call
+}
+
+const (
+	frameEntry  = 0
+	frameSP     = 8
+	frameBudget = 48
+	frameCallee = 56
+	framePC     = 64
+)
+
+// callNative loads the registers from f and calls f.entry.
+//
+//go:noescape
+func callNative(f *frame) uint64
+
+// instr is a decoded bytecode instruction.
+type instr struct {
+	pc        int64
+	op        byte
+	imm       int64 // constant bits, index, offset, jump target or discard count
+	preserve  bool  // OpJmpNz, OpDiscardPreserveTop
+	discard   int64 // OpJmpNz
+	unchecked bool  // memory access prefixed by OpUnchecked
+}
+
+func decode(code []byte) ([]instr, error) {
+	var instrs []instr
+	pc := 0
+	imm := func(n int) (int64, error) {
+		if pc+n > len(code) {
+			return 0, ErrUnsupported
+		}
+		var v int64
+		switch n {
+		case 1:
+			v = int64(code[pc])
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(code[pc:])))
+		case 8:
+			v = int64(binary.LittleEndian.Uint64(code[pc:]))
+		}
+		pc += n
+		return v, nil
+	}
+
+	for pc < len(code) {
+		in := instr{pc: int64(pc), op: code[pc]}
+		pc++
+		if in.op == compile.OpUnchecked {
+			if pc >= len(code) {
+				return nil, ErrUnsupported
+			}
+			in.op = code[pc]
+			in.unchecked = true
+			pc++
+			if _, ok := memAccesses[in.op]; !ok {
+				return nil, ErrUnsupported
+			}
+		}
+
+		var err error
+		switch op := in.op; {
+		case op == compile.OpMeter:
+			// native code isn't metered
+			_, err = imm(4)
+			in.op = ops.Nop
+		case op == compile.OpJmp, op == compile.OpJmpZ, op == compile.OpDiscard, op == compile.OpDiscardPreserveTop:
+			in.imm, err = imm(8)
+			in.preserve = op == compile.OpDiscardPreserveTop
+		case op == compile.OpJmpNz:
+			var preserve int64
+			if in.imm, err = imm(8); err != nil {
+				return nil, err
+			}
+			if preserve, err = imm(1); err != nil {
+				return nil, err
+			}
+			in.preserve = preserve != 0
+			in.discard, err = imm(8)
+		case op == ops.I32Const, op == ops.F32Const:
+			in.imm, err = imm(4)
+		case op == ops.I64Const, op == ops.F64Const:
+			in.imm, err = imm(8)
+		case op == ops.GetLocal, op == ops.SetLocal, op == ops.TeeLocal, op == ops.GetGlobal, op == ops.SetGlobal,
+			op == ops.Call:
+			in.imm, err = imm(4)
+			in.imm = int64(uint32(in.imm))
+		case isMemAccess(op):
+			in.imm, err = imm(4)
+			in.imm = int64(uint32(in.imm))
+		case op == ops.Nop, op == ops.Return, op == ops.Drop, op == ops.Select, isUnop(op),
+			isBinop(op):
+		default:
+			return nil, ErrUnsupported
+		}
+		if err != nil {
+			return nil, err
+		}
+		instrs = append(instrs, in)
+	}
+	return instrs, nil
+}
+
+func isMemAccess(op byte) bool {
+	_, ok := memAccesses[op]
+	return ok
+}
+
+// isUnop returns whether op pops one value and pushes one value.
+func isUnop(op byte) bool {
+	switch op {
+	case ops.I32Eqz, ops.I64Eqz, ops.I32WrapI64, ops.I64ExtendSI32, ops.I64ExtendUI32,
+		ops.I32ReinterpretF32, ops.I64ReinterpretF64, ops.F32ReinterpretI32, ops.F64ReinterpretI64:
+		return true
+	}
+	return false
+}
+
+// isBinop returns whether op pops two values and pushes one value.
+func isBinop(op byte) bool {
+	_, isArith := binops[op]
+	_, isCompare := compares[op]
+	_, isShift := shifts[op]
+	return isArith || isCompare || isShift
+}
+
+// stackHeights computes the height of the operand stack before every
+// instruction. It fails if the stack underflows, if a jump doesn't target
+// an instruction, if the heights at a join point disagree, or if a call
+// doesn't target one of funcs, which never happens with bytecode compiled
+// from a valid module.
+func stackHeights(instrs []instr, locals, globals int, funcs []Func) ([]int, int, error) {
+	index := make(map[int64]int, len(instrs)) // maps addresses to instruction indices
+	for i, in := range instrs {
+		index[in.pc] = i
+	}
+
+	heights := make([]int, len(instrs))
+	for i := range heights {
+		heights[i] = -1
+	}
+	maxHeight := 0
+	var work []int
+	flow := func(i, height int) error {
+		if height < 0 {
+			return ErrUnsupported
+		}
+		if i == len(instrs) {
+			return nil
+		}
+		if heights[i] == -1 {
+			heights[i] = height
+			if height > maxHeight {
+				maxHeight = height
+			}
+			work = append(work, i)
+		} else if heights[i] != height {
+			return ErrUnsupported
+		}
+		return nil
+	}
+	jump := func(target int64, height int) error {
+		i, ok := index[target]
+		if !ok {
+			return ErrUnsupported
+		}
+		return flow(i, height)
+	}
+
+	if len(instrs) == 0 {
+		return heights, 0, nil
+	}
+	flow(0, 0)
+	for len(work) != 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		in := instrs[i]
+		h := heights[i]
+
+		var err error
+		switch op := in.op; {
+		case op == ops.Return:
+			continue
+		case op == compile.OpJmp:
+			err = jump(in.imm, h)
+			continue
+		case op == compile.OpJmpZ:
+			if err = jump(in.imm, h-1); err == nil {
+				err = flow(i+1, h-1)
+			}
+		case op == compile.OpJmpNz:
+			taken := h - 1 - int(in.discard)
+			if in.preserve {
+				if h-1 < 1 {
+					return nil, 0, ErrUnsupported
+				}
+				taken++
+			}
+			if err = jump(in.imm, taken); err == nil {
+				err = flow(i+1, h-1)
+			}
+		case op == compile.OpDiscard:
+			err = flow(i+1, h-int(in.imm))
+		case op == compile.OpDiscardPreserveTop:
+			if h < 1 {
+				return nil, 0, ErrUnsupported
+			}
+			err = flow(i+1, h-int(in.imm)+1)
+		case op == ops.I32Const, op == ops.F32Const, op == ops.I64Const, op == ops.F64Const:
+			err = flow(i+1, h+1)
+		case op == ops.GetLocal, op == ops.GetGlobal:
+			if (op == ops.GetLocal && in.imm >= int64(locals)) || (op == ops.GetGlobal && in.imm >= int64(globals)) {
+				return nil, 0, ErrUnsupported
+			}
+			err = flow(i+1, h+1)
+		case op == ops.SetLocal, op == ops.TeeLocal, op == ops.SetGlobal:
+			if (op != ops.SetGlobal && in.imm >= int64(locals)) || (op == ops.SetGlobal && in.imm >= int64(globals)) {
+				return nil, 0, ErrUnsupported
+			}
+			if h < 1 {
+				return nil, 0, ErrUnsupported
+			}
+			if op == ops.TeeLocal {
+				err = flow(i+1, h)
+			} else {
+				err = flow(i+1, h-1)
+			}
+		case op == ops.Call:
+			if in.imm >= int64(len(funcs)) || h < funcs[in.imm].Args {
+				return nil, 0, ErrUnsupported
+			}
+			err = flow(i+1, h-funcs[in.imm].Args+funcs[in.imm].Results)
+		case op == ops.Nop:
+			err = flow(i+1, h)
+		case op == ops.Drop:
+			err = flow(i+1, h-1)
+		case op == ops.Select:
+			if h < 3 {
+				return nil, 0, ErrUnsupported
+			}
+			err = flow(i+1, h-2)
+		case isMemAccess(op):
+			if memAccesses[op].store {
+				if h < 2 {
+					return nil, 0, ErrUnsupported
+				}
+				err = flow(i+1, h-2)
+			} else {
+				if h < 1 {
+					return nil, 0, ErrUnsupported
+				}
+				err = flow(i+1, h)
+			}
+		case isUnop(op):
+			if h < 1 {
+				return nil, 0, ErrUnsupported
+			}
+			err = flow(i+1, h)
+		case isBinop(op):
+			if h < 2 {
+				return nil, 0, ErrUnsupported
+			}
+			err = flow(i+1, h-1)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return heights, maxHeight, nil
+}
+
+// Load copies machine code, as returned by Code.MachineCode, to an
+// executable mapping. The machine code is executed as is, it must come
+// from a trusted source. On arm64, the kernel makes the instruction cache
+// coherent with the copied code when the mapping becomes executable.
+func Load(code []byte, maxStack int) (*Code, error) {
+	if len(code) == 0 {
+		return nil, ErrUnsupported
+	}
+	mem, err := syscall.Mmap(-1, 0, len(code), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, err
+	}
+	copy(mem, code)
+	if err = syscall.Mprotect(mem, syscall.PROT_READ|syscall.PROT_EXEC); err != nil {
+		syscall.Munmap(mem)
+		return nil, err
+	}
+
+	c := &Code{
+		MaxStack: maxStack,
+		mem:      mem,
+		entry:    uintptr(unsafe.Pointer(&mem[0])),
+	}
+	runtime.SetFinalizer(c, func(c *Code) {
+		syscall.Munmap(c.mem)
+	})
+	return c, nil
+}
+
+// Run executes the code, calling functions with call. stack must hold at
+// least MaxStack values, and locals the number of locals the code was
+// compiled for. It returns the height of the stack once the code returned,
+// along with the trap that stopped it.
+func (c *Code) Run(stack, locals []uint64, memory []byte, globals []uint64, call Caller) (int, Trap) {
+	// the frame only holds the addresses of the slices, they must not live
+	// on the goroutine stack, which may move while yielding
+	if neverTrue {
+		escapedValues, escapedValues, escapedBytes, escapedValues = stack, locals, memory, globals
+	}
+
+	// the frame itself is passed to callNative on every resume, so it can
+	// stay on the goroutine stack
+	f := &frame{
+		entry:   c.entry,
+		sp:      uint64sAddr(stack),
+		locals:  uint64sAddr(locals),
+		memory:  bytesAddr(memory),
+		memLen:  uintptr(len(memory)),
+		globals: uint64sAddr(globals),
+	}
+	base := f.sp
+
+	trap := trapYield
+	for trap == trapYield || trap == trapCall {
+		f.budget = yieldInterval
+		trap = Trap(callNative(f))
+		switch trap {
+		case trapYield:
+			// give the scheduler a chance to preempt us
+			runtime.Gosched()
+		case trapCall:
+			var results []uint64
+			results, memory = call(uint32(f.callee), int64(f.pc), stack[:(f.sp-base)/8])
+			f.sp = base + uintptr(copy(stack, results))*8
+			f.memory, f.memLen = bytesAddr(memory), uintptr(len(memory))
+		}
+	}
+
+	runtime.KeepAlive(c)
+	runtime.KeepAlive(stack)
+	runtime.KeepAlive(locals)
+	runtime.KeepAlive(memory)
+	runtime.KeepAlive(globals)
+	return int((f.sp - base) / 8), trap
+}
+
+// neverTrue and the escaped variables make the arguments of Run escape to
+// the heap, without storing them.
+var (
+	neverTrue     bool
+	escapedValues []uint64
+	escapedBytes  []byte
+)
+
+// uint64sAddr returns the address of the first element of s, or 0 if s is
+// empty.
+func uint64sAddr(s []uint64) uintptr {
+	if len(s) == 0 {
+		return 0
+	}
+	return uintptr(unsafe.Pointer(&s[0]))
+}
+
+// bytesAddr returns the address of the first element of s, or 0 if s is
+// empty.
+func bytesAddr(s []byte) uintptr {
+	if len(s) == 0 {
+		return 0
+	}
+	return uintptr(unsafe.Pointer(&s[0]))
+}
@@ -0,0 +1,35 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !(linux && (amd64 || arm64))
+
+package native
+
+// Compile always fails on this platform.
+func Compile(code []byte, locals, globals int, funcs []Func) (*Code, error) {
+	return nil, ErrUnsupported
+}
+
+// Load always fails on this platform.
+func Load(code []byte, maxStack int) (*Code, error) {
+	return nil, ErrUnsupported
+}
+
+// Run never runs on this platform, since Compile never returns a Code.
+func (c *Code) Run(stack, locals []uint64, memory []byte, globals []uint64, call Caller) (int, Trap) {
+	panic(ErrUnsupported)
+}
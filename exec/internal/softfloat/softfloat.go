@@ -0,0 +1,485 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package softfloat implements the IEEE 754 binary32 and binary64
+// operations of WebAssembly with integer arithmetic only, so that their
+// results are the same bits on every platform. The floats are passed as
+// their bits, the results are rounded to nearest, ties to even, and the
+// NaNs produced are the canonical ones, positive quiet NaNs with an empty
+// payload, whatever the NaN operands.
+package softfloat
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// The errors of the conversions of floats to integers: ErrNaN for a NaN,
+// and ErrOverflow for a value whose integer part isn't representable.
+var (
+	ErrNaN      = errors.New("softfloat: NaN converted to an integer")
+	ErrOverflow = errors.New("softfloat: integer overflow")
+)
+
+// format describes a binary floating point format by the number of bits
+// of its fraction and of its exponent. The floats of both formats are
+// handled in the low bits of an uint64.
+type format struct {
+	frac, exp uint
+}
+
+var (
+	binary32 = format{frac: 23, exp: 8}
+	binary64 = format{frac: 52, exp: 11}
+)
+
+func (f format) bias() int            { return 1<<(f.exp-1) - 1 }
+func (f format) signBit() uint64      { return 1 << (f.frac + f.exp) }
+func (f format) expMask() uint64      { return (1<<f.exp - 1) << f.frac }
+func (f format) fracMask() uint64     { return 1<<f.frac - 1 }
+func (f format) one() uint64          { return uint64(f.bias()) << f.frac }
+func (f format) nan() uint64          { return f.expMask() | 1<<(f.frac-1) }
+func (f format) isNaN(x uint64) bool  { return x&^f.signBit() > f.expMask() }
+func (f format) isInf(x uint64) bool  { return x&^f.signBit() == f.expMask() }
+func (f format) isZero(x uint64) bool { return x&^f.signBit() == 0 }
+
+// unpack returns the sign bit of the finite non-zero float x, and m and e
+// such that its magnitude is m * 2^e, m having its leading bit at 62.
+func (f format) unpack(x uint64) (sign uint64, e int, m uint64) {
+	sign = x & f.signBit()
+	biased := int(x >> f.frac & (1<<f.exp - 1))
+	m = x & f.fracMask()
+	if biased == 0 {
+		biased = 1
+	} else {
+		m |= 1 << f.frac
+	}
+	n := bits.LeadingZeros64(m) - 1
+	return sign, biased - f.bias() - int(f.frac) - n, m << uint(n)
+}
+
+// jam shifts m right by n bits, setting the low bit of the result if
+// any of the bits shifted out was set, for the rounding to know that the
+// result is inexact.
+func jam(m uint64, n uint) uint64 {
+	if n >= 64 {
+		if m != 0 {
+			return 1
+		}
+		return 0
+	}
+	if m&(1<<n-1) != 0 {
+		return m>>n | 1
+	}
+	return m >> n
+}
+
+// round returns the float of format f nearest to m * 2^e, ties to even,
+// with the sign bit sign, m not being zero. The low bit of m may have been
+// set by jam, when the value is in fact a little above m * 2^e.
+func (f format) round(sign uint64, e int, m uint64) uint64 {
+	if n := bits.LeadingZeros64(m) - 1; n >= 0 {
+		m <<= uint(n)
+		e -= n
+	} else {
+		m = jam(m, 1)
+		e++
+	}
+	// m has its leading bit at 62, exp is the exponent of that bit, and
+	// shift the number of bits of m below the last one of the result,
+	// which is more for a subnormal
+	exp := e + 62
+	shift := 62 - int(f.frac)
+	if minExp := 1 - f.bias(); exp < minExp {
+		shift += minExp - exp
+		exp = minExp
+	}
+	var r uint64
+	if shift < 64 {
+		r = m >> uint(shift)
+		rem, half := m&(1<<uint(shift)-1), uint64(1)<<uint(shift-1)
+		if rem > half || rem == half && r&1 != 0 {
+			r++
+		}
+	}
+	if r >= 1<<(f.frac+1) {
+		r >>= 1
+		exp++
+	}
+	switch {
+	case exp > f.bias():
+		return sign | f.expMask()
+	case r < 1<<f.frac:
+		// a subnormal or a zero
+		return sign | r
+	}
+	return sign | uint64(exp+f.bias())<<f.frac | r&f.fracMask()
+}
+
+func (f format) add(a, b uint64) uint64 {
+	switch {
+	case f.isNaN(a) || f.isNaN(b):
+		return f.nan()
+	case f.isInf(a):
+		if f.isInf(b) && a != b {
+			return f.nan()
+		}
+		return a
+	case f.isInf(b):
+		return b
+	case f.isZero(a):
+		if f.isZero(b) {
+			// -0 only when both are
+			return a & b
+		}
+		return b
+	case f.isZero(b):
+		return a
+	}
+	sa, ea, ma := f.unpack(a)
+	sb, eb, mb := f.unpack(b)
+	// make room for the carry, the low bits of ma and mb are zero
+	ma, mb = ma>>1, mb>>1
+	if ea < eb || ea == eb && ma < mb {
+		sa, ea, ma, sb, eb, mb = sb, eb, mb, sa, ea, ma
+	}
+	mb = jam(mb, uint(ea-eb))
+	if sa == sb {
+		return f.round(sa, ea+1, ma+mb)
+	}
+	if ma == mb {
+		return 0
+	}
+	return f.round(sa, ea+1, ma-mb)
+}
+
+func (f format) sub(a, b uint64) uint64 {
+	return f.add(a, b^f.signBit())
+}
+
+func (f format) mul(a, b uint64) uint64 {
+	sign := (a ^ b) & f.signBit()
+	switch {
+	case f.isNaN(a) || f.isNaN(b):
+		return f.nan()
+	case f.isInf(a) || f.isInf(b):
+		if f.isZero(a) || f.isZero(b) {
+			return f.nan()
+		}
+		return sign | f.expMask()
+	case f.isZero(a) || f.isZero(b):
+		return sign
+	}
+	_, ea, ma := f.unpack(a)
+	_, eb, mb := f.unpack(b)
+	hi, lo := bits.Mul64(ma, mb)
+	if lo != 0 {
+		hi |= 1
+	}
+	return f.round(sign, ea+eb+64, hi)
+}
+
+func (f format) div(a, b uint64) uint64 {
+	sign := (a ^ b) & f.signBit()
+	switch {
+	case f.isNaN(a) || f.isNaN(b):
+		return f.nan()
+	case f.isInf(a):
+		if f.isInf(b) {
+			return f.nan()
+		}
+		return sign | f.expMask()
+	case f.isInf(b):
+		return sign
+	case f.isZero(b):
+		if f.isZero(a) {
+			return f.nan()
+		}
+		return sign | f.expMask()
+	case f.isZero(a):
+		return sign
+	}
+	_, ea, ma := f.unpack(a)
+	_, eb, mb := f.unpack(b)
+	// ma * 2^63 / mb is in (2^62, 2^64)
+	q, r := bits.Div64(ma>>1, ma<<63, mb)
+	if r != 0 {
+		q |= 1
+	}
+	return f.round(sign, ea-eb-63, q)
+}
+
+func (f format) sqrt(a uint64) uint64 {
+	switch {
+	case f.isNaN(a):
+		return f.nan()
+	case f.isZero(a):
+		return a
+	case a&f.signBit() != 0:
+		return f.nan()
+	case f.isInf(a):
+		return a
+	}
+	_, e, m := f.unpack(a)
+	if e&1 != 0 {
+		m <<= 1
+		e--
+	}
+	// the square root of m * 2^64, which has 64 bits, bit by bit
+	var r uint64
+	for bit := 63; bit >= 0; bit-- {
+		t := r | 1<<uint(bit)
+		if hi, lo := bits.Mul64(t, t); hi < m || hi == m && lo == 0 {
+			r = t
+		}
+	}
+	if hi, lo := bits.Mul64(r, r); hi != m || lo != 0 {
+		r |= 1
+	}
+	return f.round(0, (e-64)/2, r)
+}
+
+// min and max follow WebAssembly: a NaN operand makes a NaN, and -0 is
+// below +0.
+func (f format) min(a, b uint64) uint64 {
+	switch {
+	case f.isNaN(a) || f.isNaN(b):
+		return f.nan()
+	case f.isZero(a) && f.isZero(b):
+		return a | b
+	case f.lt(b, a):
+		return b
+	}
+	return a
+}
+
+func (f format) max(a, b uint64) uint64 {
+	switch {
+	case f.isNaN(a) || f.isNaN(b):
+		return f.nan()
+	case f.isZero(a) && f.isZero(b):
+		return a & b
+	case f.lt(a, b):
+		return b
+	}
+	return a
+}
+
+func (f format) eq(a, b uint64) bool {
+	if f.isNaN(a) || f.isNaN(b) {
+		return false
+	}
+	return a == b || f.isZero(a) && f.isZero(b)
+}
+
+func (f format) lt(a, b uint64) bool {
+	if f.isNaN(a) || f.isNaN(b) || f.isZero(a) && f.isZero(b) {
+		return false
+	}
+	na, nb := a&f.signBit() != 0, b&f.signBit() != 0
+	switch {
+	case na != nb:
+		return na
+	case na:
+		return a > b
+	}
+	return a < b
+}
+
+func (f format) le(a, b uint64) bool {
+	return f.lt(a, b) || f.eq(a, b)
+}
+
+// The directions in which roundInt rounds.
+const (
+	toZero = iota
+	down
+	up
+	nearest
+)
+
+// roundInt rounds a to an integral value in the given direction, nearest
+// rounding ties to even.
+func (f format) roundInt(a uint64, dir int) uint64 {
+	if f.isNaN(a) {
+		return f.nan()
+	}
+	sign := a & f.signBit()
+	e := int(a>>f.frac&(1<<f.exp-1)) - f.bias()
+	switch {
+	case e >= int(f.frac) || f.isZero(a):
+		// integral already, or infinite
+		return a
+	case e < 0:
+		// 0 < |a| < 1
+		switch {
+		case dir == down && sign != 0, dir == up && sign == 0,
+			dir == nearest && e == -1 && a&f.fracMask() != 0:
+			return sign | f.one()
+		}
+		return sign
+	}
+	n := uint(int(f.frac) - e)
+	rem := a & (1<<n - 1)
+	if rem == 0 {
+		return a
+	}
+	r := a &^ (1<<n - 1)
+	half := uint64(1) << (n - 1)
+	switch {
+	case dir == down && sign != 0, dir == up && sign == 0,
+		dir == nearest && (rem > half || rem == half && r&(1<<n) != 0):
+		// a carry out of the fraction increments the exponent
+		r += 1 << n
+	}
+	return r
+}
+
+func (f format) fromUint(x uint64) uint64 {
+	if x == 0 {
+		return 0
+	}
+	return f.round(0, 0, x)
+}
+
+func (f format) fromInt(x int64) uint64 {
+	if x >= 0 {
+		return f.fromUint(uint64(x))
+	}
+	return f.round(f.signBit(), 0, uint64(-x))
+}
+
+// convert converts a of format f to the format to.
+func (f format) convert(a uint64, to format) uint64 {
+	var sign uint64
+	if a&f.signBit() != 0 {
+		sign = to.signBit()
+	}
+	switch {
+	case f.isNaN(a):
+		return to.nan()
+	case f.isInf(a):
+		return sign | to.expMask()
+	case f.isZero(a):
+		return sign
+	}
+	_, e, m := f.unpack(a)
+	return to.round(sign, e, m)
+}
+
+// toInt truncates a to an integer of size bits, signed or not, returned
+// in two's complement on 64 bits.
+func (f format) toInt(a uint64, size uint, signed bool) (uint64, error) {
+	switch {
+	case f.isNaN(a):
+		return 0, ErrNaN
+	case f.isInf(a):
+		return 0, ErrOverflow
+	}
+	neg := a&f.signBit() != 0
+	e := int(a>>f.frac&(1<<f.exp-1)) - f.bias()
+	if f.isZero(a) || e < 0 {
+		return 0, nil
+	}
+	if e >= 64 {
+		return 0, ErrOverflow
+	}
+	m := a&f.fracMask() | 1<<f.frac
+	if e < int(f.frac) {
+		m >>= uint(int(f.frac) - e)
+	} else {
+		m <<= uint(e - int(f.frac))
+	}
+	var max uint64
+	switch {
+	case signed && neg:
+		max = 1 << (size - 1)
+	case signed:
+		max = 1<<(size-1) - 1
+	case neg:
+		max = 0
+	default:
+		max = 1<<(size-1) - 1 + 1<<(size-1)
+	}
+	if m > max {
+		return 0, ErrOverflow
+	}
+	if neg {
+		return -m, nil
+	}
+	return m, nil
+}
+
+// The binary32 operations, on the bits of the floats.
+
+func F32Add(a, b uint32) uint32  { return uint32(binary32.add(uint64(a), uint64(b))) }
+func F32Sub(a, b uint32) uint32  { return uint32(binary32.sub(uint64(a), uint64(b))) }
+func F32Mul(a, b uint32) uint32  { return uint32(binary32.mul(uint64(a), uint64(b))) }
+func F32Div(a, b uint32) uint32  { return uint32(binary32.div(uint64(a), uint64(b))) }
+func F32Min(a, b uint32) uint32  { return uint32(binary32.min(uint64(a), uint64(b))) }
+func F32Max(a, b uint32) uint32  { return uint32(binary32.max(uint64(a), uint64(b))) }
+func F32Sqrt(a uint32) uint32    { return uint32(binary32.sqrt(uint64(a))) }
+func F32Ceil(a uint32) uint32    { return uint32(binary32.roundInt(uint64(a), up)) }
+func F32Floor(a uint32) uint32   { return uint32(binary32.roundInt(uint64(a), down)) }
+func F32Trunc(a uint32) uint32   { return uint32(binary32.roundInt(uint64(a), toZero)) }
+func F32Nearest(a uint32) uint32 { return uint32(binary32.roundInt(uint64(a), nearest)) }
+func F32Eq(a, b uint32) bool     { return binary32.eq(uint64(a), uint64(b)) }
+func F32Lt(a, b uint32) bool     { return binary32.lt(uint64(a), uint64(b)) }
+func F32Le(a, b uint32) bool     { return binary32.le(uint64(a), uint64(b)) }
+
+// F32FromInt and F32FromUint return the f32 nearest to x.
+func F32FromInt(x int64) uint32   { return uint32(binary32.fromInt(x)) }
+func F32FromUint(x uint64) uint32 { return uint32(binary32.fromUint(x)) }
+
+// F32ToInt truncates a to an integer of size bits, signed or not, see
+// ErrNaN and ErrOverflow.
+func F32ToInt(a uint32, size uint, signed bool) (uint64, error) {
+	return binary32.toInt(uint64(a), size, signed)
+}
+
+// F32ToF64 promotes a to a f64, which is exact.
+func F32ToF64(a uint32) uint64 { return binary32.convert(uint64(a), binary64) }
+
+// The binary64 operations, on the bits of the floats.
+
+func F64Add(a, b uint64) uint64  { return binary64.add(a, b) }
+func F64Sub(a, b uint64) uint64  { return binary64.sub(a, b) }
+func F64Mul(a, b uint64) uint64  { return binary64.mul(a, b) }
+func F64Div(a, b uint64) uint64  { return binary64.div(a, b) }
+func F64Min(a, b uint64) uint64  { return binary64.min(a, b) }
+func F64Max(a, b uint64) uint64  { return binary64.max(a, b) }
+func F64Sqrt(a uint64) uint64    { return binary64.sqrt(a) }
+func F64Ceil(a uint64) uint64    { return binary64.roundInt(a, up) }
+func F64Floor(a uint64) uint64   { return binary64.roundInt(a, down) }
+func F64Trunc(a uint64) uint64   { return binary64.roundInt(a, toZero) }
+func F64Nearest(a uint64) uint64 { return binary64.roundInt(a, nearest) }
+func F64Eq(a, b uint64) bool     { return binary64.eq(a, b) }
+func F64Lt(a, b uint64) bool     { return binary64.lt(a, b) }
+func F64Le(a, b uint64) bool     { return binary64.le(a, b) }
+
+// F64FromInt and F64FromUint return the f64 nearest to x.
+func F64FromInt(x int64) uint64   { return binary64.fromInt(x) }
+func F64FromUint(x uint64) uint64 { return binary64.fromUint(x) }
+
+// F64ToInt truncates a to an integer of size bits, signed or not, see
+// ErrNaN and ErrOverflow.
+func F64ToInt(a uint64, size uint, signed bool) (uint64, error) {
+	return binary64.toInt(a, size, signed)
+}
+
+// F64ToF32 demotes a to the nearest f32.
+func F64ToF32(a uint64) uint32 { return uint32(binary64.convert(a, binary32)) }
@@ -0,0 +1,292 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package softfloat
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// The operations are checked against the hardware, the NaNs only having
+// to be NaNs on both sides.
+
+var specials32 = []uint32{
+	0, 1 << 31, 1, 0x007fffff, 0x00800000, 0x3f800000, 0x3f000000, 0x3fc00000,
+	0x40200000, 0x4b000000, 0x4b7fffff, 0x4effffff, 0x4f000000, 0x4f800000,
+	0x5f000000, 0x5f800000, 0x7f7fffff, 0x7f800000, 0x7fc00000, 0x7fa00001,
+	0x34000000, 0x33800000, 0x3effffff,
+}
+
+var specials64 = []uint64{
+	0, 1 << 63, 1, 0x000fffffffffffff, 0x0010000000000000, 0x3ff0000000000000,
+	0x3fe0000000000000, 0x3ff8000000000000, 0x4004000000000000, 0x4330000000000000,
+	0x433fffffffffffff, 0x41dfffffffc00000, 0x41e0000000000000, 0x41f0000000000000,
+	0x43e0000000000000, 0x43f0000000000000, 0x7fefffffffffffff, 0x7ff0000000000000,
+	0x7ff8000000000000, 0x7ff4000000000001, 0x3ca0000000000000, 0x3fdfffffffffffff,
+}
+
+// values32 and values64 return the specials and their negations, then n
+// random floats, half of them with random bits and half with exponents
+// close to each other, for the additions not to be trivial.
+func values32(r *rand.Rand, n int) []uint32 {
+	var values []uint32
+	for _, x := range specials32 {
+		values = append(values, x, x^1<<31)
+	}
+	for i := 0; i < n; i++ {
+		x := r.Uint32()
+		if i%2 == 0 {
+			x = x&0x807fffff | uint32(120+r.Intn(16))<<23
+		}
+		values = append(values, x)
+	}
+	return values
+}
+
+func values64(r *rand.Rand, n int) []uint64 {
+	var values []uint64
+	for _, x := range specials64 {
+		values = append(values, x, x^1<<63)
+	}
+	for i := 0; i < n; i++ {
+		x := r.Uint64()
+		if i%2 == 0 {
+			x = x&0x800fffffffffffff | uint64(1016+r.Intn(16))<<52
+		}
+		values = append(values, x)
+	}
+	return values
+}
+
+func same32(x, y uint32) bool {
+	fx, fy := math.Float32frombits(x), math.Float32frombits(y)
+	return x == y || fx != fx && fy != fy
+}
+
+func same64(x, y uint64) bool {
+	return x == y || math.IsNaN(math.Float64frombits(x)) && math.IsNaN(math.Float64frombits(y))
+}
+
+func f32(x uint32) float32 { return math.Float32frombits(x) }
+func b32(f float32) uint32 { return math.Float32bits(f) }
+func f64(x uint64) float64 { return math.Float64frombits(x) }
+func b64(f float64) uint64 { return math.Float64bits(f) }
+
+// wasmMin and wasmMax are math.Min and math.Max, except for an infinite
+// operand and a NaN, which make a NaN.
+func wasmMin(x, y float64) float64 {
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return math.NaN()
+	}
+	return math.Min(x, y)
+}
+
+func wasmMax(x, y float64) float64 {
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return math.NaN()
+	}
+	return math.Max(x, y)
+}
+
+func TestBinary32(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	values := values32(r, 600)
+	binops := map[string][2]func(a, b uint32) uint32{
+		"add": {F32Add, func(a, b uint32) uint32 { return b32(f32(a) + f32(b)) }},
+		"sub": {F32Sub, func(a, b uint32) uint32 { return b32(f32(a) - f32(b)) }},
+		"mul": {F32Mul, func(a, b uint32) uint32 { return b32(f32(a) * f32(b)) }},
+		"div": {F32Div, func(a, b uint32) uint32 { return b32(f32(a) / f32(b)) }},
+		"min": {F32Min, func(a, b uint32) uint32 { return b32(float32(wasmMin(float64(f32(a)), float64(f32(b))))) }},
+		"max": {F32Max, func(a, b uint32) uint32 { return b32(float32(wasmMax(float64(f32(a)), float64(f32(b))))) }},
+	}
+	cmps := map[string][2]func(a, b uint32) bool{
+		"eq": {F32Eq, func(a, b uint32) bool { return f32(a) == f32(b) }},
+		"lt": {F32Lt, func(a, b uint32) bool { return f32(a) < f32(b) }},
+		"le": {F32Le, func(a, b uint32) bool { return f32(a) <= f32(b) }},
+	}
+	for _, a := range values {
+		for _, b := range values {
+			for name, op := range binops {
+				if got, want := op[0](a, b), op[1](a, b); !same32(got, want) {
+					t.Fatalf("%s(%#x, %#x) = %#x, want %#x", name, a, b, got, want)
+				}
+			}
+			for name, op := range cmps {
+				if got, want := op[0](a, b), op[1](a, b); got != want {
+					t.Fatalf("%s(%#x, %#x) = %v, want %v", name, a, b, got, want)
+				}
+			}
+		}
+	}
+
+	unops := map[string][2]func(a uint32) uint32{
+		"sqrt":    {F32Sqrt, func(a uint32) uint32 { return b32(float32(math.Sqrt(float64(f32(a))))) }},
+		"ceil":    {F32Ceil, func(a uint32) uint32 { return b32(float32(math.Ceil(float64(f32(a))))) }},
+		"floor":   {F32Floor, func(a uint32) uint32 { return b32(float32(math.Floor(float64(f32(a))))) }},
+		"trunc":   {F32Trunc, func(a uint32) uint32 { return b32(float32(math.Trunc(float64(f32(a))))) }},
+		"nearest": {F32Nearest, func(a uint32) uint32 { return b32(float32(math.RoundToEven(float64(f32(a))))) }},
+	}
+	for _, a := range values32(r, 100000) {
+		for name, op := range unops {
+			if got, want := op[0](a), op[1](a); !same32(got, want) {
+				t.Fatalf("%s(%#x) = %#x, want %#x", name, a, got, want)
+			}
+		}
+		if got, want := F32ToF64(a), b64(float64(f32(a))); !same64(got, want) {
+			t.Fatalf("promote(%#x) = %#x, want %#x", a, got, want)
+		}
+		checkToInt(t, float64(f32(a)), func(size uint, signed bool) (uint64, error) {
+			return F32ToInt(a, size, signed)
+		})
+	}
+}
+
+func TestBinary64(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	values := values64(r, 600)
+	binops := map[string][2]func(a, b uint64) uint64{
+		"add": {F64Add, func(a, b uint64) uint64 { return b64(f64(a) + f64(b)) }},
+		"sub": {F64Sub, func(a, b uint64) uint64 { return b64(f64(a) - f64(b)) }},
+		"mul": {F64Mul, func(a, b uint64) uint64 { return b64(f64(a) * f64(b)) }},
+		"div": {F64Div, func(a, b uint64) uint64 { return b64(f64(a) / f64(b)) }},
+		"min": {F64Min, func(a, b uint64) uint64 { return b64(wasmMin(f64(a), f64(b))) }},
+		"max": {F64Max, func(a, b uint64) uint64 { return b64(wasmMax(f64(a), f64(b))) }},
+	}
+	cmps := map[string][2]func(a, b uint64) bool{
+		"eq": {F64Eq, func(a, b uint64) bool { return f64(a) == f64(b) }},
+		"lt": {F64Lt, func(a, b uint64) bool { return f64(a) < f64(b) }},
+		"le": {F64Le, func(a, b uint64) bool { return f64(a) <= f64(b) }},
+	}
+	for _, a := range values {
+		for _, b := range values {
+			for name, op := range binops {
+				if got, want := op[0](a, b), op[1](a, b); !same64(got, want) {
+					t.Fatalf("%s(%#x, %#x) = %#x, want %#x", name, a, b, got, want)
+				}
+			}
+			for name, op := range cmps {
+				if got, want := op[0](a, b), op[1](a, b); got != want {
+					t.Fatalf("%s(%#x, %#x) = %v, want %v", name, a, b, got, want)
+				}
+			}
+		}
+	}
+
+	unops := map[string][2]func(a uint64) uint64{
+		"sqrt":    {F64Sqrt, func(a uint64) uint64 { return b64(math.Sqrt(f64(a))) }},
+		"ceil":    {F64Ceil, func(a uint64) uint64 { return b64(math.Ceil(f64(a))) }},
+		"floor":   {F64Floor, func(a uint64) uint64 { return b64(math.Floor(f64(a))) }},
+		"trunc":   {F64Trunc, func(a uint64) uint64 { return b64(math.Trunc(f64(a))) }},
+		"nearest": {F64Nearest, func(a uint64) uint64 { return b64(math.RoundToEven(f64(a))) }},
+	}
+	for _, a := range values64(r, 100000) {
+		for name, op := range unops {
+			if got, want := op[0](a), op[1](a); !same64(got, want) {
+				t.Fatalf("%s(%#x) = %#x, want %#x", name, a, got, want)
+			}
+		}
+		if got, want := F64ToF32(a), b32(float32(f64(a))); !same32(got, want) {
+			t.Fatalf("demote(%#x) = %#x, want %#x", a, got, want)
+		}
+		checkToInt(t, f64(a), func(size uint, signed bool) (uint64, error) {
+			return F64ToInt(a, size, signed)
+		})
+	}
+}
+
+// checkToInt checks the truncations of f to the integers of every size,
+// signed or not, computed by toInt.
+func checkToInt(t *testing.T, f float64, toInt func(size uint, signed bool) (uint64, error)) {
+	t.Helper()
+	trunc := math.Trunc(f)
+	for _, c := range []struct {
+		size     uint
+		signed   bool
+		min, max float64 // the range of trunc
+	}{
+		{32, true, math.MinInt32, math.MaxInt32},
+		{32, false, 0, math.MaxUint32},
+		{64, true, math.MinInt64, 1 << 63},
+		{64, false, 0, 1 << 64},
+	} {
+		got, err := toInt(c.size, c.signed)
+		switch {
+		case math.IsNaN(f):
+			if err != ErrNaN {
+				t.Fatalf("trunc %v to %d bits = %v", f, c.size, err)
+			}
+		// the max of 64 bits is not representable: 1<<63 and 1<<64 are out
+		case trunc < c.min || trunc > c.max || c.size == 64 && trunc == c.max:
+			if err != ErrOverflow {
+				t.Fatalf("trunc %v to %d bits = %#x, %v, want an overflow", f, c.size, got, err)
+			}
+		default:
+			var want uint64
+			switch {
+			case c.signed:
+				want = uint64(int64(trunc))
+			default:
+				want = uint64(trunc)
+			}
+			if c.size == 32 {
+				got, want = uint64(uint32(got)), uint64(uint32(want))
+			}
+			if err != nil || got != want {
+				t.Fatalf("trunc %v to %d bits = %#x, %v, want %#x", f, c.size, got, err, want)
+			}
+		}
+	}
+}
+
+func TestFromInt(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	ints := []uint64{0, 1, 1<<24 + 1, 1<<53 + 1, 1<<63 - 1, 1 << 63, 1<<64 - 1, 1<<63 + 1<<39 + 1}
+	for i := 0; i < 100000; i++ {
+		ints = append(ints, r.Uint64()>>uint(r.Intn(64)))
+	}
+	for _, x := range ints {
+		if got, want := F32FromUint(x), b32(float32(x)); got != want {
+			t.Fatalf("f32 of %d = %#x, want %#x", x, got, want)
+		}
+		if got, want := F64FromUint(x), b64(float64(x)); got != want {
+			t.Fatalf("f64 of %d = %#x, want %#x", x, got, want)
+		}
+		if got, want := F32FromInt(int64(x)), b32(float32(int64(x))); got != want {
+			t.Fatalf("f32 of %d = %#x, want %#x", int64(x), got, want)
+		}
+		if got, want := F64FromInt(int64(x)), b64(float64(int64(x))); got != want {
+			t.Fatalf("f64 of %d = %#x, want %#x", int64(x), got, want)
+		}
+	}
+}
+
+// The NaNs made are the canonical ones.
+func TestCanonicalNaN(t *testing.T) {
+	nan32, nan64 := uint32(0xffa00001), uint64(0xfff4000000000001)
+	for _, got := range []uint32{F32Add(nan32, 0), F32Sqrt(b32(-1)), F32Min(0, nan32), F64ToF32(nan64)} {
+		if got != 0x7fc00000 {
+			t.Errorf("NaN = %#x", got)
+		}
+	}
+	for _, got := range []uint64{F64Mul(nan64, 0), F64Div(0, 0), F64Nearest(nan64), F32ToF64(nan32)} {
+		if got != 0x7ff8000000000000 {
+			t.Errorf("NaN = %#x", got)
+		}
+	}
+}
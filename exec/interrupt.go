@@ -0,0 +1,230 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	stdcontext "context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrEpochDeadline is the cause of the InterruptedError trapping the VM
+// when the engine epoch reaches the deadline of the call, see
+// SetEpochDeadline.
+var ErrEpochDeadline = errors.New("exec: epoch deadline reached")
+
+// engineEpoch is the epoch of the engine, shared by every VM.
+var engineEpoch uint64
+
+// EngineIncrementEpoch increments the epoch of the engine, interrupting the
+// calls of every VM whose epoch deadline is reached. It is cheap enough to
+// be called by a ticker, and can be called from any goroutine.
+func EngineIncrementEpoch() {
+	atomic.AddUint64(&engineEpoch, 1)
+}
+
+// EngineEpoch returns the current epoch of the engine.
+func EngineEpoch() uint64 {
+	return atomic.LoadUint64(&engineEpoch)
+}
+
+// SetEpochDeadline makes the following calls of vm trap with an
+// InterruptedError caused by ErrEpochDeadline once the engine epoch was
+// incremented ticks times since the start of the call. Zero disables the
+// deadline. Unlike a context, the deadline costs no goroutine per call:
+// the epoch is only checked at the calls and loop back-edges, so
+// functions compiled to native code are interpreted.
+func (vm *VM) SetEpochDeadline(ticks uint64) {
+	vm.epochTicks = ticks
+}
+
+// InterruptedError is the error value used while trapping the VM when its
+// execution is interrupted from another goroutine, for instance because
+// the context of ExecCodeContext is done. Err is the cause of the
+// interruption.
+type InterruptedError struct {
+	Err error
+}
+
+func (e InterruptedError) Error() string {
+	return "exec: interrupted: " + e.Err.Error()
+}
+
+// Unwrap returns the cause of the interruption.
+func (e InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+func (e InterruptedError) TrapCode() TrapCode {
+	return TrapInterrupted
+}
+
+// TimeoutError is returned by (*VM).ExecCode when the call ran for longer
+// than VMConfig.MaxExecutionTime.
+type TimeoutError time.Duration
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("exec: execution exceeded %v", time.Duration(e))
+}
+
+func (e TimeoutError) TrapCode() TrapCode {
+	return TrapTimeout
+}
+
+// the states of VM.interrupted
+const (
+	interruptNone uint32 = iota
+	interruptPending
+	interruptSet
+)
+
+// interrupt asks the execution of vm to trap with an InterruptedError
+// caused by err at the next safepoint. Only the first interruption of a
+// call is kept. It can be called from any goroutine.
+func (vm *VM) interrupt(err error) {
+	if atomic.CompareAndSwapUint32(&vm.interrupted, interruptNone, interruptPending) {
+		vm.interruptErr = err
+		atomic.StoreUint32(&vm.interrupted, interruptSet)
+	}
+}
+
+// interruption returns the InterruptedError the execution of vm must trap
+// with, if it was interrupted or its epoch deadline is reached.
+func (vm *VM) interruption() error {
+	if atomic.LoadUint32(&vm.interrupted) == interruptSet {
+		return InterruptedError{vm.interruptErr}
+	}
+	if vm.epochTicks != 0 && atomic.LoadUint64(&engineEpoch) >= vm.epochDeadline {
+		return InterruptedError{ErrEpochDeadline}
+	}
+	return nil
+}
+
+// safepoint traps the VM if its execution was interrupted, or unwinds the
+// call if it was paused, and samples its call stack if a sample is due. It is called at the calls and loop back-edges
+// only, which any long running execution goes through, once the state of
+// the call is consistent: a jump is taken, or the frame of a callee is set
+// up.
+func (vm *VM) safepoint() {
+	if err := vm.interruption(); err != nil {
+		panic(err)
+	}
+	if atomic.LoadUint32(&vm.pausing) != 0 || vm.budgetEnd != 0 && vm.gasMeter.used >= vm.budgetEnd {
+		panic(errPause)
+	}
+	if atomic.LoadUint32(&vm.sampleDue) != 0 {
+		vm.sample()
+	}
+}
+
+// ExecCodeContext calls the function with the given index and arguments
+// like ExecCode, aborting the execution once ctx is done: the call then
+// returns an InterruptedError wrapping ctx.Err(). Functions compiled to
+// native code are interpreted when ctx can be done, since native code
+// can't be interrupted.
+func (vm *VM) ExecCodeContext(ctx stdcontext.Context, fnIndex int64, args ...uint64) (res interface{}, err error) {
+	err = vm.runContext(ctx, func() (err error) {
+		res, err = vm.ExecCode(fnIndex, args...)
+		return err
+	})
+	return res, err
+}
+
+// CallJSONContext calls a method like CallJSON, aborting the execution
+// once ctx is done like ExecCodeContext.
+func (vm *VM) CallJSONContext(ctx stdcontext.Context, abi *JSONABI, payload []byte) (res []byte, err error) {
+	err = vm.runContext(ctx, func() (err error) {
+		res, err = vm.CallJSON(abi, payload)
+		return err
+	})
+	return res, err
+}
+
+// runContext runs call, which calls vm, interrupting it once ctx is done
+// and returning the InterruptedError it is interrupted with.
+func (vm *VM) runContext(ctx stdcontext.Context, call func() error) (err error) {
+	if err := ctx.Err(); err != nil {
+		return InterruptedError{err}
+	}
+	if done := ctx.Done(); done != nil {
+		defer vm.watch(done, ctx.Err)()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			var trap InterruptedError
+			if e, ok := r.(error); !ok || !errors.As(e, &trap) {
+				panic(r)
+			}
+			err = trap
+		}
+	}()
+	return call()
+}
+
+// watch interrupts vm with the error returned by cause once done is
+// closed, until the returned function is called, which forgets the
+// interruption.
+func (vm *VM) watch(done <-chan struct{}, cause func() error) func() {
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			vm.interrupt(cause())
+		case <-stop:
+		}
+		close(stopped)
+	}()
+	vm.interruptible++
+	return func() {
+		close(stop)
+		<-stopped
+		vm.interruptible--
+		vm.clearInterrupt()
+	}
+}
+
+// clearInterrupt forgets the interruption of the last call, once nothing
+// can interrupt it anymore.
+func (vm *VM) clearInterrupt() {
+	vm.interruptErr = nil
+	atomic.StoreUint32(&vm.interrupted, interruptNone)
+}
+
+// execTimed runs the call of ExecCodeRaw with a watchdog interrupting it
+// after VMConfig.MaxExecutionTime, in which case it returns a TimeoutError.
+func (vm *VM) execTimed(fnIndex int64, args []uint64) (res uint64, err error) {
+	timeout := TimeoutError(vm.config.MaxExecutionTime)
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), vm.config.MaxExecutionTime)
+	defer cancel()
+	defer vm.watch(ctx.Done(), func() error { return timeout })()
+
+	vm.timed = true
+	defer func() {
+		vm.timed = false
+		if r := recover(); r != nil {
+			var trap InterruptedError
+			if e, ok := r.(error); !ok || !errors.As(e, &trap) || trap.Err != timeout {
+				panic(r)
+			}
+			res, err = 0, timeout
+		}
+	}()
+	return vm.ExecCodeRaw(fnIndex, args...)
+}
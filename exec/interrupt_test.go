@@ -0,0 +1,163 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	stdcontext "context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExecCodeContext(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	facIter := int64(module.Export.Entries["fac-iter"].Index)
+
+	vm, err := NewVMWithConfig(module, VMConfig{AOT: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a loop running for ages is aborted at its back-edge
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = vm.ExecCodeContext(ctx, facIter, 1<<62)
+	if !errors.Is(err, stdcontext.DeadlineExceeded) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := err.(InterruptedError); !ok {
+		t.Errorf("unexpected error type: %T", err)
+	}
+
+	// a done context doesn't start the call
+	if _, err = vm.ExecCodeContext(ctx, facIter, 20); !errors.Is(err, stdcontext.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the interruption doesn't outlive the call
+	ctx, cancel = stdcontext.WithCancel(stdcontext.Background())
+	want, err := vm.ExecCode(facIter, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := vm.ExecCodeContext(ctx, facIter, 20)
+	if err != nil || res != want {
+		t.Errorf("unexpected result: %v, %v", res, err)
+	}
+	cancel()
+	if res, err = vm.ExecCode(facIter, 20); err != nil || res != want {
+		t.Errorf("unexpected result after cancel: %v, %v", res, err)
+	}
+}
+
+func TestCallJSONContext(t *testing.T) {
+	vm, err := NewVM(readTestModule(t, "testdata/spec/fac.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	abi, err := ParseJSONABI([]byte(`{"methods": [{"name": "fac", "export": "fac-iter", "params": [{"name": "n", "type": "u64"}], "result": "u64"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = vm.CallJSONContext(ctx, abi, []byte(`{"method": "fac", "args": [4611686018427387904]}`)); !errors.Is(err, stdcontext.DeadlineExceeded) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err := vm.CallJSONContext(stdcontext.Background(), abi, []byte(`{"method": "fac", "args": [5]}`))
+	if err != nil || string(res) != `{"result":120}` {
+		t.Errorf("unexpected result: %s, %v", res, err)
+	}
+}
+
+func TestEpochDeadline(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	facIter := int64(module.Export.Entries["fac-iter"].Index)
+
+	vm, err := NewVMWithConfig(module, VMConfig{AOT: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.SetEpochDeadline(2)
+
+	// the deadline is relative to the start of every call
+	EngineIncrementEpoch()
+	if _, err = vm.ExecCode(facIter, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				EngineIncrementEpoch()
+			case <-done:
+				return
+			}
+		}
+	}()
+	func() {
+		defer func() {
+			if err := trapValue(recover()); err != (InterruptedError{ErrEpochDeadline}) {
+				t.Errorf("unexpected trap: %v", err)
+			}
+		}()
+		vm.ExecCode(facIter, 1<<62)
+	}()
+
+	vm.SetEpochDeadline(0)
+	if _, err = vm.ExecCode(facIter, 20); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxExecutionTime(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	facIter := int64(module.Export.Entries["fac-iter"].Index)
+
+	vm, err := NewVMWithConfig(module, VMConfig{AOT: true, MaxExecutionTime: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = vm.ExecCode(facIter, 20); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err = vm.ExecCode(facIter, 1<<62); err != TimeoutError(20*time.Millisecond) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the call was interrupted after %v", elapsed)
+	}
+
+	// a timeout isn't out of gas, and the context still applies
+	vm.SetGasMeter(NewGasMeter(1<<62), DefaultGasSchedule())
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+	if _, err = vm.ExecCodeContext(ctx, facIter, 20); !errors.Is(err, stdcontext.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err = vm.ExecCode(facIter, 1<<62); err != TimeoutError(20*time.Millisecond) || err == ErrOutOfGas {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
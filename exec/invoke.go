@@ -0,0 +1,167 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// ArgumentTypeError is returned by Instance.Call for an argument which
+// can't be converted to the type of its parameter, and by (Global).Set,
+// with a zero Index, for a value which can't be converted to the type of
+// the global.
+type ArgumentTypeError struct {
+	Index int            // The index of the argument
+	Type  wasm.ValueType // The type of the parameter
+	Value interface{}
+}
+
+func (e ArgumentTypeError) Error() string {
+	return fmt.Sprintf("exec: argument %d: can't convert %v (%T) to %v", e.Index, e.Value, e.Value, e.Type)
+}
+
+// Call calls the function exported as name with the given arguments, on a
+// new VM of inst, and returns its results.
+//
+// An i32 parameter takes any Go integer within the int32 or uint32 range,
+// and an i64 one any Go integer within the int64 or uint64 range. The f32
+// and f64 parameters take a float32 or a float64, the v128 ones a
+// wasm.V128, and the reference ones a wasm.Ref. The results are boxed like
+// the ones of ExecCode: uint32, uint64, float32, float64, wasm.V128 or
+// wasm.Ref.
+func (inst *Instance) Call(name string, args ...interface{}) ([]interface{}, error) {
+	return inst.call(inst.NewVM(), name, args)
+}
+
+// call calls the function of inst exported as name with args on vm, like
+// Call.
+func (inst *Instance) call(vm *VM, name string, args []interface{}) ([]interface{}, error) {
+	export, ok := inst.ExportedFunction(name)
+	if !ok {
+		return nil, ERR_UNKNOWN_EXPORT
+	}
+	sig := export.Sig
+	if len(args) != len(sig.ParamTypes) {
+		return nil, ERR_INVALID_ARGUMENT_COUNT
+	}
+
+	values := make([]uint64, 0, len(args))
+	for i, t := range sig.ParamTypes {
+		if t == wasm.ValueTypeV128 {
+			v, ok := args[i].(wasm.V128)
+			if !ok {
+				return nil, ArgumentTypeError{Index: i, Type: t, Value: args[i]}
+			}
+			values = append(values, endianess.Uint64(v[:8]), endianess.Uint64(v[8:]))
+			continue
+		}
+		v, ok := unboxValue(t, args[i])
+		if !ok {
+			return nil, ArgumentTypeError{Index: i, Type: t, Value: args[i]}
+		}
+		values = append(values, v)
+	}
+
+	res, err := vm.ExecCodeValues(int64(export.Index), values...)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, len(sig.ReturnTypes))
+	for i, t := range sig.ReturnTypes {
+		if t == wasm.ValueTypeV128 {
+			results[i] = v128Value(res[0], res[1])
+			res = res[2:]
+			continue
+		}
+		if results[i], err = boxValue(t, res[0]); err != nil {
+			return nil, err
+		}
+		res = res[1:]
+	}
+	return results, nil
+}
+
+// unboxValue returns the raw bits of the Go value v as a value of type t,
+// and false if v doesn't fit in t.
+func unboxValue(t wasm.ValueType, v interface{}) (uint64, bool) {
+	if n, ok := v.(uint); ok {
+		v = uint64(n)
+	}
+	switch t {
+	case wasm.ValueTypeI32:
+		if n, ok := signedValue(v); ok && n >= math.MinInt32 && n <= math.MaxUint32 {
+			return uint64(uint32(n)), true
+		}
+		if n, ok := v.(uint64); ok && n <= math.MaxUint32 {
+			return n, true
+		}
+	case wasm.ValueTypeI64:
+		if n, ok := signedValue(v); ok {
+			return uint64(n), true
+		}
+		if n, ok := v.(uint64); ok {
+			return n, true
+		}
+	case wasm.ValueTypeF32:
+		switch f := v.(type) {
+		case float32:
+			return uint64(math.Float32bits(f)), true
+		case float64:
+			return uint64(math.Float32bits(float32(f))), true
+		}
+	case wasm.ValueTypeF64:
+		switch f := v.(type) {
+		case float32:
+			return math.Float64bits(float64(f)), true
+		case float64:
+			return math.Float64bits(f), true
+		}
+	default:
+		if ref, ok := v.(wasm.Ref); ok && t.IsRef() {
+			return uint64(ref), true
+		}
+	}
+	return 0, false
+}
+
+// signedValue returns the Go integer v as an int64, and false if v isn't
+// an integer of a type whose values all fit in an int64.
+func signedValue(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	}
+	return 0, false
+}
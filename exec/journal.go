@@ -0,0 +1,199 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"strings"
+
+	"github.com/bottos-project/bottos/contract"
+)
+
+// stateJournal is a contract database keeping the storage writes of a
+// contract call on top of db, which its reads see, for them to be
+// committed to db once the call returns, or discarded if it fails. The
+// journals of nested calls are stacked, a call committing to the journal
+// of its caller.
+type stateJournal struct {
+	db     contract.ContractDB
+	writes stateOverlay
+	// the keys written, in the order of their first write, for the commit
+	// to be deterministic
+	keys []stateKey
+}
+
+func newStateJournal(db contract.ContractDB) *stateJournal {
+	return &stateJournal{db: db, writes: make(stateOverlay)}
+}
+
+func (j *stateJournal) write(key stateKey, v stateValue) error {
+	if _, ok := j.writes[key]; !ok {
+		j.keys = append(j.keys, key)
+	}
+	j.writes[key] = v
+	return nil
+}
+
+func (j *stateJournal) GetStrValue(contract, object, key string) (string, error) {
+	if v, ok := j.writes[stateKey{contract, object, key, false}]; ok {
+		if v.removed {
+			return "", ERR_FINE_MAP
+		}
+		return string(v.value), nil
+	}
+	return j.db.GetStrValue(contract, object, key)
+}
+
+func (j *stateJournal) SetStrValue(contract, object, key, value string) error {
+	return j.write(stateKey{contract, object, key, false}, stateValue{value: []byte(value)})
+}
+
+func (j *stateJournal) RemoveStrValue(contract, object, key string) error {
+	return j.write(stateKey{contract, object, key, false}, stateValue{removed: true})
+}
+
+func (j *stateJournal) GetBinValue(contract, object, key string) ([]byte, error) {
+	if v, ok := j.writes[stateKey{contract, object, key, true}]; ok {
+		if v.removed {
+			return nil, ERR_FINE_MAP
+		}
+		return append([]byte(nil), v.value...), nil
+	}
+	return j.db.GetBinValue(contract, object, key)
+}
+
+func (j *stateJournal) SetBinValue(contract, object, key string, value []byte) error {
+	return j.write(stateKey{contract, object, key, true}, stateValue{value: append([]byte(nil), value...)})
+}
+
+func (j *stateJournal) RemoveBinValue(contract, object, key string) error {
+	return j.write(stateKey{contract, object, key, true}, stateValue{removed: true})
+}
+
+// commit writes the writes of j to its database, in the order of their
+// first write. A failing write stops the commit, the previous ones being
+// committed.
+func (j *stateJournal) commit() error {
+	for _, key := range j.keys {
+		v := j.writes[key]
+		var err error
+		switch {
+		case key.binary && v.removed:
+			err = j.db.RemoveBinValue(key.contract, key.object, key.key)
+		case key.binary:
+			err = j.db.SetBinValue(key.contract, key.object, key.key, v.value)
+		case v.removed:
+			err = j.db.RemoveStrValue(key.contract, key.object, key.key)
+		default:
+			err = j.db.SetStrValue(key.contract, key.object, key.key, string(v.value))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeJournal is a StateStore keeping the writes of a contract call on
+// top of store, like stateJournal does for a contract database.
+type storeJournal struct {
+	store  StateStore
+	writes map[storeKey]stateValue
+	keys   []storeKey
+}
+
+type storeKey struct {
+	contract, key string
+}
+
+func newStoreJournal(store StateStore) *storeJournal {
+	return &storeJournal{store: store, writes: make(map[storeKey]stateValue)}
+}
+
+func (j *storeJournal) write(key storeKey, v stateValue) error {
+	if _, ok := j.writes[key]; !ok {
+		j.keys = append(j.keys, key)
+	}
+	j.writes[key] = v
+	return nil
+}
+
+func (j *storeJournal) Get(contract string, key []byte) ([]byte, bool, error) {
+	if v, ok := j.writes[storeKey{contract, string(key)}]; ok {
+		if v.removed {
+			return nil, false, nil
+		}
+		return append([]byte(nil), v.value...), true, nil
+	}
+	return j.store.Get(contract, key)
+}
+
+func (j *storeJournal) Set(contract string, key, value []byte) error {
+	return j.write(storeKey{contract, string(key)}, stateValue{value: append([]byte(nil), value...)})
+}
+
+func (j *storeJournal) Remove(contract string, key []byte) error {
+	return j.write(storeKey{contract, string(key)}, stateValue{removed: true})
+}
+
+func (j *storeJournal) Next(contract string, prefix, start []byte) ([]byte, bool, error) {
+	// the smallest key of the store which isn't written to j
+	var next []byte
+	found := false
+	for from := start; ; {
+		key, ok, err := j.store.Next(contract, prefix, from)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			break
+		}
+		if _, written := j.writes[storeKey{contract, string(key)}]; !written {
+			next, found = key, true
+			break
+		}
+		from = append(append([]byte(nil), key...), 0)
+	}
+	// and the smallest key set in j
+	for _, key := range j.keys {
+		if key.contract != contract || j.writes[key].removed ||
+			!strings.HasPrefix(key.key, string(prefix)) || key.key < string(start) {
+			continue
+		}
+		if !found || key.key < string(next) {
+			next, found = []byte(key.key), true
+		}
+	}
+	return next, found, nil
+}
+
+// commit writes the writes of j to its store, like stateJournal.commit.
+func (j *storeJournal) commit() error {
+	for _, key := range j.keys {
+		v := j.writes[key]
+		var err error
+		if v.removed {
+			err = j.store.Remove(key.contract, []byte(key.key))
+		} else {
+			err = j.store.Set(key.contract, []byte(key.key), v.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,644 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// JSONABI describes the methods a module exposes to CallJSON: the exports
+// they call, and the canonical ABI types of their parameters and result.
+type JSONABI struct {
+	methods map[string]*jsonMethod
+	names   []string // the names of the methods, in the order of the document
+	events  []*jsonEvent
+}
+
+type jsonMethod struct {
+	export     string
+	params     []*jsonType
+	paramNames []string
+	result     *jsonType
+}
+
+// JSONMethod describes a method of a JSONABI, for the tools generating
+// code calling it.
+type JSONMethod struct {
+	Name       string
+	Export     string
+	Params     []*ABIType
+	ParamNames []string
+	Result     *ABIType // nil if the method has no result
+}
+
+// Methods returns the methods of abi, in the order of its document.
+func (abi *JSONABI) Methods() []JSONMethod {
+	methods := make([]JSONMethod, len(abi.names))
+	for i, name := range abi.names {
+		m := abi.methods[name]
+		methods[i] = JSONMethod{Name: name, Export: m.export, ParamNames: m.paramNames}
+		for _, t := range m.params {
+			methods[i].Params = append(methods[i].Params, t.abi)
+		}
+		if m.result != nil {
+			methods[i].Result = m.result.abi
+		}
+	}
+	return methods
+}
+
+// jsonEvent is an event of a JSONABI, whose fields are the fields of a
+// record type.
+type jsonEvent struct {
+	name   string
+	fields *jsonType
+}
+
+// JSONEvent describes the schema of an event of a JSONABI, whose topic is
+// its name, see RegisterEvents.
+type JSONEvent struct {
+	Name       string
+	Fields     []*ABIType
+	FieldNames []string
+}
+
+// Events returns the events of abi, in the order of its document.
+func (abi *JSONABI) Events() []JSONEvent {
+	events := make([]JSONEvent, len(abi.events))
+	for i, e := range abi.events {
+		events[i] = JSONEvent{Name: e.name, Fields: e.fields.abi.Fields, FieldNames: e.fields.fields}
+	}
+	return events
+}
+
+// jsonType is an ABIType along with the names of the fields of a record,
+// which are the keys of the JSON objects of its values.
+type jsonType struct {
+	abi     *ABIType
+	elem    *jsonType
+	fields  []string
+	members []*jsonType // the types of the fields of a record
+	ok, err *jsonType
+}
+
+// jsonABIDocument is the JSON representation of a JSONABI.
+type jsonABIDocument struct {
+	Methods []struct {
+		Name   string `json:"name"`
+		Export string `json:"export"`
+		Params []struct {
+			Name string          `json:"name"`
+			Type json.RawMessage `json:"type"`
+		} `json:"params"`
+		Result json.RawMessage `json:"result"`
+	} `json:"methods"`
+	Events []struct {
+		Name   string          `json:"name"`
+		Fields json.RawMessage `json:"fields"`
+	} `json:"events,omitempty"`
+}
+
+// InvalidABITypeError is returned by ParseJSONABI for a type it can't read.
+type InvalidABITypeError string
+
+func (e InvalidABITypeError) Error() string {
+	return fmt.Sprintf("exec: json abi: invalid type %s", string(e))
+}
+
+// UnknownJSONMethodError is returned by CallJSON for a method the ABI
+// doesn't describe.
+type UnknownJSONMethodError string
+
+func (e UnknownJSONMethodError) Error() string {
+	return fmt.Sprintf("exec: json call: unknown method %q", string(e))
+}
+
+// JSONArgumentError is returned by CallJSON for an argument which isn't a
+// JSON value of the type of its parameter.
+type JSONArgumentError struct {
+	Method string
+	Index  int
+}
+
+func (e JSONArgumentError) Error() string {
+	return fmt.Sprintf("exec: json call: %s: invalid argument %d", e.Method, e.Index)
+}
+
+// ParseJSONABI reads a JSONABI from a JSON document of the form
+//
+//	{"methods": [{"name": "transfer", "export": "transfer",
+//	  "params": [{"name": "to", "type": "string"}, {"name": "amount", "type": "u64"}],
+//	  "result": {"result": {"err": "string"}}}]}
+//
+// where export defaults to the name of the method, and the result is
+// optional. The document may also list the schemas of the events of the
+// module, as {"events": [{"name": "transfer", "fields": [{"name": "to",
+// "type": "string"}]}]}, the fields being the ones of a record. A type is the name of a scalar or string type ("bool", "s8" to
+// "u64", "f32", "f64", "char", "string"), or an object {"list": type},
+// {"record": [{"name": "x", "type": type}, ...]} or {"result": {"ok":
+// type, "err": type}}, the ok and err types being optional.
+func ParseJSONABI(data []byte) (*JSONABI, error) {
+	var doc jsonABIDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	abi := &JSONABI{methods: make(map[string]*jsonMethod, len(doc.Methods))}
+	for _, m := range doc.Methods {
+		method := &jsonMethod{export: m.Export}
+		if method.export == "" {
+			method.export = m.Name
+		}
+		for _, p := range m.Params {
+			t, err := parseJSONType(p.Type)
+			if err != nil {
+				return nil, err
+			}
+			method.params = append(method.params, t)
+			method.paramNames = append(method.paramNames, p.Name)
+		}
+		if len(m.Result) != 0 && string(m.Result) != "null" {
+			t, err := parseJSONType(m.Result)
+			if err != nil {
+				return nil, err
+			}
+			method.result = t
+		}
+		if _, ok := abi.methods[m.Name]; !ok {
+			abi.names = append(abi.names, m.Name)
+		}
+		abi.methods[m.Name] = method
+	}
+	for _, e := range doc.Events {
+		if len(e.Fields) == 0 || string(e.Fields) == "null" {
+			e.Fields = json.RawMessage("[]")
+		}
+		raw, err := json.Marshal(map[string]json.RawMessage{"record": e.Fields})
+		if err != nil {
+			return nil, err
+		}
+		fields, err := parseJSONType(raw)
+		if err != nil {
+			return nil, err
+		}
+		abi.events = append(abi.events, &jsonEvent{name: e.Name, fields: fields})
+	}
+	return abi, nil
+}
+
+// abiKinds are the kinds of the types named by a string in a JSONABI.
+var abiKinds = map[string]ABIKind{
+	"bool": ABIBool, "s8": ABIS8, "u8": ABIU8, "s16": ABIS16, "u16": ABIU16,
+	"s32": ABIS32, "u32": ABIU32, "s64": ABIS64, "u64": ABIU64,
+	"f32": ABIF32, "f64": ABIF64, "char": ABIChar, "string": ABIString,
+}
+
+func parseJSONType(raw json.RawMessage) (*jsonType, error) {
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		kind, ok := abiKinds[name]
+		if !ok {
+			return nil, InvalidABITypeError(raw)
+		}
+		return &jsonType{abi: &ABIType{Kind: kind}}, nil
+	}
+
+	var obj struct {
+		List   json.RawMessage `json:"list"`
+		Record []struct {
+			Name string          `json:"name"`
+			Type json.RawMessage `json:"type"`
+		} `json:"record"`
+		Result *struct {
+			Ok  json.RawMessage `json:"ok"`
+			Err json.RawMessage `json:"err"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, InvalidABITypeError(raw)
+	}
+	switch {
+	case obj.List != nil && obj.Record == nil && obj.Result == nil:
+		elem, err := parseJSONType(obj.List)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonType{abi: &ABIType{Kind: ABIList, Elem: elem.abi}, elem: elem}, nil
+	case obj.Record != nil && obj.List == nil && obj.Result == nil:
+		t := &jsonType{abi: &ABIType{Kind: ABIRecord}}
+		for _, f := range obj.Record {
+			member, err := parseJSONType(f.Type)
+			if err != nil {
+				return nil, err
+			}
+			t.abi.Fields = append(t.abi.Fields, member.abi)
+			t.fields = append(t.fields, f.Name)
+			t.members = append(t.members, member)
+		}
+		return t, nil
+	case obj.Result != nil && obj.List == nil && obj.Record == nil:
+		t := &jsonType{abi: &ABIType{Kind: ABIResult}}
+		var err error
+		if obj.Result.Ok != nil {
+			if t.ok, err = parseJSONType(obj.Result.Ok); err != nil {
+				return nil, err
+			}
+			t.abi.Ok = t.ok.abi
+		}
+		if obj.Result.Err != nil {
+			if t.err, err = parseJSONType(obj.Result.Err); err != nil {
+				return nil, err
+			}
+			t.abi.Err = t.err.abi
+		}
+		return t, nil
+	}
+	return nil, InvalidABITypeError(raw)
+}
+
+// coreTypes returns the types of the core values passing a value of type
+// t: the scalars are passed as such, the strings and the lists as their
+// address and length, and the records and the results as the address of
+// their lowered value.
+func (t *jsonType) coreTypes() []wasm.ValueType {
+	switch t.abi.Kind {
+	case ABIS64, ABIU64:
+		return []wasm.ValueType{wasm.ValueTypeI64}
+	case ABIF32:
+		return []wasm.ValueType{wasm.ValueTypeF32}
+	case ABIF64:
+		return []wasm.ValueType{wasm.ValueTypeF64}
+	case ABIString, ABIList:
+		return []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}
+	}
+	return []wasm.ValueType{wasm.ValueTypeI32}
+}
+
+// scalar returns whether the values of t are passed and returned as
+// core values rather than through the memory.
+func (t *jsonType) scalar() bool {
+	switch t.abi.Kind {
+	case ABIString, ABIList, ABIRecord, ABIResult:
+		return false
+	}
+	return true
+}
+
+// CallJSON calls the method of abi named by a JSON payload of the form
+//
+//	{"method": "transfer", "args": ["bob", 10]}
+//
+// and returns its result as a JSON document {"result": value}, the value
+// being null if the method has no result. The arguments are lowered to
+// the memory of vm through its canonical ABI (see CanonicalABI) when they
+// aren't scalars, and a result which isn't a scalar is lifted from the
+// address the export returns. Records are JSON objects keyed by field
+// name, results objects with an "ok" or "err" key, and chars strings of a
+// single character. A nil abi is the ABI embedded in the module of vm,
+// see EmbedABI, and ERR_NO_ABI is returned if it has none.
+func (vm *VM) CallJSON(abi *JSONABI, payload []byte) ([]byte, error) {
+	if abi == nil {
+		var err error
+		if abi, err = vm.compiled.ABI(); err != nil {
+			return nil, err
+		}
+		if abi == nil {
+			return nil, ERR_NO_ABI
+		}
+	}
+	var call struct {
+		Method string            `json:"method"`
+		Args   []json.RawMessage `json:"args"`
+	}
+	if err := json.Unmarshal(payload, &call); err != nil {
+		return nil, err
+	}
+	method, ok := abi.methods[call.Method]
+	if !ok {
+		return nil, UnknownJSONMethodError(call.Method)
+	}
+	if len(call.Args) != len(method.params) {
+		return nil, ERR_INVALID_ARGUMENT_COUNT
+	}
+
+	export, ok := vm.ExportedFunction(method.export)
+	if !ok {
+		return nil, ERR_UNKNOWN_EXPORT
+	}
+	var params, results []wasm.ValueType
+	for _, t := range method.params {
+		params = append(params, t.coreTypes()...)
+	}
+	if method.result != nil {
+		results = method.result.coreTypes()[:1]
+	}
+	if !sameTypes(export.Sig.ParamTypes, params) || !sameTypes(export.Sig.ReturnTypes, results) {
+		return nil, ERR_JSON_SIGNATURE
+	}
+
+	// the canonical ABI is only needed for the values in memory
+	var canon *CanonicalABI
+	canonical := func() (*CanonicalABI, error) {
+		var err error
+		if canon == nil {
+			canon, err = vm.CanonicalABI("")
+		}
+		return canon, err
+	}
+
+	var args []uint64
+	for i, t := range method.params {
+		v, err := t.goValue(call.Args[i])
+		if err != nil {
+			return nil, JSONArgumentError{Method: call.Method, Index: i}
+		}
+		if t.scalar() {
+			bits, _ := scalarBits(t.abi.Kind, v)
+			if t.abi.Kind != ABIS64 && t.abi.Kind != ABIU64 && t.abi.Kind != ABIF64 {
+				bits = uint64(uint32(bits))
+			}
+			args = append(args, bits)
+			continue
+		}
+		c, err := canonical()
+		if err != nil {
+			return nil, err
+		}
+		ptr, err := c.Lower(t.abi, v)
+		if err != nil {
+			return nil, err
+		}
+		if t.abi.Kind == ABIString || t.abi.Kind == ABIList {
+			// the address and the length stored at ptr
+			pair, err := c.bytes(ptr, 8)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, uint64(binary.LittleEndian.Uint32(pair)), uint64(binary.LittleEndian.Uint32(pair[4:])))
+			continue
+		}
+		args = append(args, uint64(ptr))
+	}
+
+	res, err := vm.ExecCodeRaw(int64(export.Index), args...)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	if t := method.result; t != nil {
+		var v interface{}
+		if t.scalar() {
+			v, err = liftScalar(t.abi.Kind, res)
+		} else {
+			var c *CanonicalABI
+			if c, err = canonical(); err == nil {
+				v, err = c.Lift(t.abi, uint32(res))
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = t.jsonValue(v)
+	}
+	return json.Marshal(struct {
+		Result interface{} `json:"result"`
+	}{result})
+}
+
+// liftScalar returns the value of the scalar kind returned as the core
+// value res.
+func liftScalar(kind ABIKind, res uint64) (interface{}, error) {
+	switch kind {
+	case ABIBool:
+		return uint32(res) != 0, nil
+	case ABIS8:
+		return int8(res), nil
+	case ABIU8:
+		return uint8(res), nil
+	case ABIS16:
+		return int16(res), nil
+	case ABIU16:
+		return uint16(res), nil
+	case ABIS32:
+		return int32(res), nil
+	case ABIU32:
+		return uint32(res), nil
+	case ABIS64:
+		return int64(res), nil
+	case ABIF32:
+		return math.Float32frombits(uint32(res)), nil
+	case ABIF64:
+		return math.Float64frombits(res), nil
+	case ABIChar:
+		if c := uint32(res); c <= utf8.MaxRune && utf8.ValidRune(rune(c)) {
+			return rune(c), nil
+		}
+		return nil, ERR_CANON_VALUE
+	}
+	return res, nil
+}
+
+// goValue returns the Go value of type t, see ABIType, of the JSON value
+// raw.
+func (t *jsonType) goValue(raw json.RawMessage) (interface{}, error) {
+	switch kind := t.abi.Kind; kind {
+	case ABIBool:
+		var b bool
+		err := json.Unmarshal(raw, &b)
+		return b, err
+	case ABIS8, ABIS16, ABIS32, ABIS64:
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, err
+		}
+		bits := map[ABIKind]int{ABIS8: 8, ABIS16: 16, ABIS32: 32, ABIS64: 64}[kind]
+		i, err := strconv.ParseInt(string(n), 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case ABIS8:
+			return int8(i), nil
+		case ABIS16:
+			return int16(i), nil
+		case ABIS32:
+			return int32(i), nil
+		}
+		return i, nil
+	case ABIU8, ABIU16, ABIU32, ABIU64:
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, err
+		}
+		bits := map[ABIKind]int{ABIU8: 8, ABIU16: 16, ABIU32: 32, ABIU64: 64}[kind]
+		u, err := strconv.ParseUint(string(n), 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case ABIU8:
+			return uint8(u), nil
+		case ABIU16:
+			return uint16(u), nil
+		case ABIU32:
+			return uint32(u), nil
+		}
+		return u, nil
+	case ABIF32, ABIF64:
+		var f float64
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return nil, err
+		}
+		if kind == ABIF32 {
+			return float32(f), nil
+		}
+		return f, nil
+	case ABIChar:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		c, n := utf8.DecodeRuneInString(s)
+		if n == 0 || n != len(s) || c == utf8.RuneError {
+			return nil, ERR_CANON_VALUE
+		}
+		return c, nil
+	case ABIString:
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case ABIList:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			v, err := t.elem.goValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		if t.elem.abi.Kind == ABIU8 {
+			b := make([]byte, len(values))
+			for i, v := range values {
+				b[i] = v.(uint8)
+			}
+			return b, nil
+		}
+		return values, nil
+	case ABIRecord:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(t.fields))
+		for i, name := range t.fields {
+			field, ok := obj[name]
+			if !ok {
+				return nil, ERR_CANON_VALUE
+			}
+			v, err := t.members[i].goValue(field)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	case ABIResult:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, err
+		}
+		if len(obj) != 1 {
+			return nil, ERR_CANON_VALUE
+		}
+		r := Result{}
+		payload := t.ok
+		value, ok := obj["ok"]
+		if !ok {
+			if value, ok = obj["err"]; !ok {
+				return nil, ERR_CANON_VALUE
+			}
+			r.IsErr, payload = true, t.err
+		}
+		if payload == nil {
+			if string(value) != "null" {
+				return nil, ERR_CANON_VALUE
+			}
+			return r, nil
+		}
+		v, err := payload.goValue(value)
+		if err != nil {
+			return nil, err
+		}
+		r.Value = v
+		return r, nil
+	}
+	return nil, ERR_CANON_VALUE
+}
+
+// jsonValue returns the value marshalled to JSON for the Go value v of
+// type t.
+func (t *jsonType) jsonValue(v interface{}) interface{} {
+	switch t.abi.Kind {
+	case ABIChar:
+		return string(v.(rune))
+	case ABIList:
+		if b, ok := v.([]byte); ok {
+			// not base64 like the []byte marshalled by encoding/json
+			values := make([]int, len(b))
+			for i := range b {
+				values[i] = int(b[i])
+			}
+			return values
+		}
+		elems := v.([]interface{})
+		values := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			values[i] = t.elem.jsonValue(elem)
+		}
+		return values
+	case ABIRecord:
+		fields := v.([]interface{})
+		obj := make(map[string]interface{}, len(fields))
+		for i, name := range t.fields {
+			obj[name] = t.members[i].jsonValue(fields[i])
+		}
+		return obj
+	case ABIResult:
+		r := v.(Result)
+		key, payload := "ok", t.ok
+		if r.IsErr {
+			key, payload = "err", t.err
+		}
+		var value interface{}
+		if payload != nil {
+			value = payload.jsonValue(r.Value)
+		}
+		return map[string]interface{}{key: value}
+	}
+	return v
+}
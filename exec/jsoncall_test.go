@@ -0,0 +1,58 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestCallJSON(t *testing.T) {
+	vm, err := NewVM(readTestModule(t, "testdata/canon.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	abi, err := ParseJSONABI([]byte(`{"methods": [
+		{"name": "sum", "params": [{"name": "r", "type": {"record": [
+			{"name": "first", "type": "u32"},
+			{"name": "rest", "type": {"list": "u32"}}]}}], "result": "u32"},
+		{"name": "hello", "export": "greet", "result": {"result": {"ok": "string", "err": "u8"}}},
+		{"name": "bad", "export": "greet", "result": "u64"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		payload, result string
+		err             error
+	}{
+		{`{"method": "sum", "args": [{"first": 1, "rest": [2, 3, 4]}]}`, `{"result":10}`, nil},
+		{`{"method": "hello", "args": []}`, `{"result":{"ok":"hello"}}`, nil},
+		{`{"method": "sum", "args": [{"first": -1, "rest": []}]}`, "", JSONArgumentError{Method: "sum", Index: 0}},
+		{`{"method": "sum", "args": []}`, "", ERR_INVALID_ARGUMENT_COUNT},
+		{`{"method": "bad", "args": []}`, "", ERR_JSON_SIGNATURE},
+		{`{"method": "transfer", "args": []}`, "", UnknownJSONMethodError("transfer")},
+	} {
+		res, err := vm.CallJSON(abi, []byte(tc.payload))
+		if err != tc.err || string(res) != tc.result {
+			t.Errorf("%s: got=%s, %v, want=%s, %v", tc.payload, res, err, tc.result, tc.err)
+		}
+	}
+
+	if _, err := ParseJSONABI([]byte(`{"methods": [{"name": "f", "params": [{"name": "x", "type": "u128"}]}]}`)); err != InvalidABITypeError(`"u128"`) {
+		t.Errorf("u128: got=%v", err)
+	}
+}
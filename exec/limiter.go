@@ -0,0 +1,116 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"math"
+)
+
+// ResourceLimiter is installed with VMConfig.ResourceLimiter to approve or
+// deny the resources used by the instances of a module. Its methods are
+// asked before the resources are allocated; they can deny the request, or
+// veto it with their own error.
+type ResourceLimiter interface {
+	// MemoryGrowing is asked before the linear memory of an instance grows
+	// from current to desired bytes, maximum being the size the module
+	// lets it grow to. When instantiating, current is zero. If it returns
+	// false, memory.grow returns -1, and the instantiation fails with
+	// ERR_RESOURCE_LIMIT. An error traps the VM, or is returned by the
+	// instantiation.
+	MemoryGrowing(current, desired, maximum uint64) (bool, error)
+	// TableGrowing is asked before a table of an instance grows from
+	// current to desired elements, like MemoryGrowing: if it returns
+	// false, table.grow returns -1.
+	TableGrowing(current, desired, maximum uint32) (bool, error)
+	// InstanceCreating is asked before an instance of m is created, by
+	// Instantiate or Instance.Clone. An error fails the creation.
+	InstanceCreating(m *Module) error
+}
+
+// limitInstance asks the ResourceLimiter of m, if any, whether an instance
+// of m with memory bytes of memory, up to maxMemory, can be created. The
+// memories other than the first one are asked for with their initial size.
+func (m *Module) limitInstance(memory, maxMemory uint64) error {
+	limiter := m.config.ResourceLimiter
+	if limiter == nil {
+		return nil
+	}
+	if err := limiter.InstanceCreating(m); err != nil {
+		return err
+	}
+
+	if ok, err := limiter.MemoryGrowing(0, memory, maxMemory); err != nil {
+		return err
+	} else if !ok {
+		return ERR_RESOURCE_LIMIT
+	}
+	// the other memories, see linearMemory
+	memories := m.module.Memories()
+	for i := 1; i < len(memories); i++ {
+		size, maxSize := memorySize(memories[i].Limits)
+		if ok, err := limiter.MemoryGrowing(0, uint64(size), maxSize); err != nil {
+			return err
+		} else if !ok {
+			return ERR_RESOURCE_LIMIT
+		}
+	}
+
+	tables := m.module.Tables()
+	for i, elems := range m.module.TableIndexSpace {
+		maxTable := uint32(math.MaxUint32)
+		if i < len(tables) && tables[i].Limits.Flags&0x1 != 0 {
+			maxTable = tables[i].Limits.Maximum
+		}
+		if ok, err := limiter.TableGrowing(0, uint32(len(elems)), maxTable); err != nil {
+			return err
+		} else if !ok {
+			return ERR_RESOURCE_LIMIT
+		}
+	}
+	return nil
+}
+
+// limitTableGrowth asks the ResourceLimiter of vm, if any, whether a table
+// can grow from current to desired elements. A veto traps the VM.
+func (vm *VM) limitTableGrowth(current, desired, maximum uint32) bool {
+	limiter := vm.config.ResourceLimiter
+	if limiter == nil {
+		return true
+	}
+	ok, err := limiter.TableGrowing(current, desired, maximum)
+	if err != nil {
+		panic(err)
+	}
+	return ok
+}
+
+// limitMemoryGrowth asks the ResourceLimiter of vm, if any, whether its
+// memory can grow by n pages. A veto traps the VM. A replayed call grows
+// as its trace says instead, see Replay.
+func (vm *VM) limitMemoryGrowth(n uint32) bool {
+	limiter := vm.config.ResourceLimiter
+	if limiter == nil || vm.replayer != nil {
+		return true
+	}
+	current := uint64(len(vm.memory))
+	ok, err := limiter.MemoryGrowing(current, current+uint64(n)*uint64(vm.pageSize), vm.maxMemory)
+	if err != nil {
+		panic(err)
+	}
+	return ok
+}
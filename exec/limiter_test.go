@@ -0,0 +1,121 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"errors"
+	"testing"
+)
+
+type testLimiter struct {
+	maxMemory uint64
+	maxTable  uint32
+	veto      error
+	grows     [][2]uint64
+	instances int
+}
+
+func (l *testLimiter) MemoryGrowing(current, desired, maximum uint64) (bool, error) {
+	l.grows = append(l.grows, [2]uint64{current, desired})
+	if l.veto != nil && current != 0 {
+		return false, l.veto
+	}
+	return desired <= l.maxMemory, nil
+}
+
+func (l *testLimiter) TableGrowing(current, desired, maximum uint32) (bool, error) {
+	return desired <= l.maxTable, nil
+}
+
+func (l *testLimiter) InstanceCreating(m *Module) error {
+	l.instances++
+	return nil
+}
+
+func TestResourceLimiter(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/resizing.wasm")
+	grow := int64(module.Export.Entries["grow"].Index)
+
+	limiter := &testLimiter{maxMemory: 2 * wasmPageSize, maxTable: 16}
+	vm, err := NewVMWithConfig(module, VMConfig{ResourceLimiter: limiter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limiter.instances != 1 {
+		t.Errorf("unexpected instances: %d", limiter.instances)
+	}
+	for _, tc := range []struct {
+		pages uint64
+		res   int32
+	}{
+		{2, 0},
+		{1, -1},
+	} {
+		res, err := vm.ExecCode(grow, tc.pages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int32(res.(uint32)) != tc.res {
+			t.Errorf("grow(%d): got=%d, want=%d", tc.pages, res, tc.res)
+		}
+	}
+	want := [][2]uint64{{0, 0}, {0, 2 * wasmPageSize}, {2 * wasmPageSize, 3 * wasmPageSize}}
+	if len(limiter.grows) != len(want) {
+		t.Fatalf("unexpected requests: %v", limiter.grows)
+	}
+	for i := range want {
+		if limiter.grows[i] != want[i] {
+			t.Errorf("unexpected requests: got=%v, want=%v", limiter.grows, want)
+		}
+	}
+
+	if _, err := vm.Instance.Clone(); err != nil {
+		t.Fatal(err)
+	}
+	limiter.maxMemory = wasmPageSize
+	if _, err := vm.Instance.Clone(); err != ERR_RESOURCE_LIMIT {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// a veto traps the VM with the limiter's error
+	limiter.maxMemory = 8 * wasmPageSize
+	limiter.veto = errors.New("denied")
+	func() {
+		defer func() {
+			if err := trapValue(recover()); err != limiter.veto {
+				t.Errorf("unexpected trap: %v", err)
+			}
+		}()
+		vm.ExecCode(grow, 1)
+	}()
+}
+
+func TestResourceLimiterTable(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/call_indirect.wasm")
+	if len(module.TableIndexSpace) == 0 {
+		t.Fatal("module has no table")
+	}
+	limiter := &testLimiter{maxMemory: wasmPageSize, maxTable: 1}
+	if _, err := NewVMWithConfig(module, VMConfig{ResourceLimiter: limiter}); err != ERR_RESOURCE_LIMIT {
+		t.Errorf("unexpected error: %v", err)
+	}
+	limiter.maxTable = uint32(len(module.TableIndexSpace[0]))
+	if _, err := NewVMWithConfig(module, VMConfig{ResourceLimiter: limiter}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrUnterminatedString is returned by (Memory).ReadCString for a string
+// with no NUL byte within its maximum length.
+var ErrUnterminatedString = errors.New("exec: unterminated string in memory")
+
+// MemoryRangeError is returned by the accessors of Memory for a range of
+// bytes which isn't in the memory. It matches ErrOutOfBoundsMemoryAccess
+// with errors.Is, and a host function panicking with it traps the VM with
+// TrapOutOfBoundsMemory, like an out of bounds load.
+type MemoryRangeError struct {
+	Offset     uint32
+	Length     uint64
+	MemorySize int
+}
+
+func (e *MemoryRangeError) Error() string {
+	return fmt.Sprintf("%v: offset %d, length %d, memory size %d", ErrOutOfBoundsMemoryAccess, e.Offset, e.Length, e.MemorySize)
+}
+
+// Is reports whether target is ErrOutOfBoundsMemoryAccess.
+func (e *MemoryRangeError) Is(target error) bool {
+	return target == ErrOutOfBoundsMemoryAccess
+}
+
+// TrapCode returns TrapOutOfBoundsMemory.
+func (e *MemoryRangeError) TrapCode() TrapCode { return TrapOutOfBoundsMemory }
+
+// Memory accesses the linear memory of an instance, for the host
+// functions and the embedders, checking the bounds of every access rather
+// than panicking like the slices of (*VM).Memory. The offsets are the
+// addresses of the module, and the values are little endian. A Memory
+// follows the growth of the memory, and is tied to the instance: its
+// accesses fail once the instance is closed.
+//
+//	func greet(vm *exec.VM) (bool, error) {
+//		params := vm.GetFuncParams()
+//		name, err := vm.LinearMemory().ReadString(uint32(params[0]), uint32(params[1]))
+//		if err != nil {
+//			panic(err) // traps the call
+//		}
+//		...
+//	}
+type Memory struct {
+	inst  *Instance
+	index uint32
+}
+
+// LinearMemory returns the accessor of the first linear memory of inst,
+// see ExportedMemory for the others.
+func (inst *Instance) LinearMemory() Memory {
+	return Memory{inst: inst}
+}
+
+// memory returns the bytes of the memory, nil once the instance is
+// closed.
+func (m Memory) memory() []byte {
+	if m.index != 0 && int(m.index) > len(m.inst.memories) {
+		return nil
+	}
+	memory, _ := m.inst.memoryAt(m.index)
+	return memory
+}
+
+// Size returns the length of the memory in bytes.
+func (m Memory) Size() int {
+	return len(m.memory())
+}
+
+// Pages returns the size of the memory in pages, as memory.size gives it.
+func (m Memory) Pages() uint64 {
+	pageSize := m.inst.pageSize
+	if m.index != 0 && int(m.index) <= len(m.inst.memories) {
+		pageSize = m.inst.memories[m.index-1].pageSize
+	}
+	if pageSize == 0 {
+		return 0
+	}
+	return uint64(m.Size() / pageSize)
+}
+
+// Grow grows the memory by n pages like memory.grow, though neither
+// limited by the config of a VM nor charged, and returns its previous
+// size in pages, or false if it can't grow that much. Growing the memory
+// invalidates its views, see UnsafeView.
+func (m Memory) Grow(n uint32) (uint64, bool) {
+	if m.inst.closed || m.index != 0 && int(m.index) > len(m.inst.memories) {
+		return 0, false
+	}
+	m.inst.syncMemory()
+	m.inst.swapMemory(m.index)
+	prev := m.inst.growMemory(n)
+	m.inst.swapMemory(m.index)
+	return uint64(uint32(prev)), prev != -1
+}
+
+// Slice returns the n bytes at offset like UnsafeView, with an error
+// rather than a panic if they aren't in the memory. ReadBytes returns a
+// copy.
+func (m Memory) Slice(offset, n uint32) ([]byte, error) {
+	return m.output(offset, uint64(n))
+}
+
+// UnsafeView returns the n bytes at offset in the memory itself, without
+// copying them, for the host functions hashing or verifying megabytes of
+// memory: the writes to the view modify the memory. The view is only
+// valid until the memory grows, or is reset, restored or released, which
+// may move or shrink it, see OnInvalidate, and must not be used
+// afterwards, in particular past a call back into the module. The views
+// of a shared memory stay valid when another instance grows it, since it
+// never moves. The bytes of the view count as written for the pages
+// StateHasher rehashes. UnsafeView panics with a MemoryRangeError if the
+// bytes aren't in the memory, which traps the call of a host function.
+func (m Memory) UnsafeView(offset, n uint32) []byte {
+	b, err := m.output(offset, uint64(n))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+type viewHook struct {
+	f func()
+}
+
+// OnInvalidate registers f to be called when the views of the memory are
+// invalidated, see UnsafeView, for the host functions caching views
+// across calls to drop them. f is called when the memory grows, shrinks
+// back with Reset, Restore or Promote, is moved by ReleaseMemory or is
+// released by Close. It returns a function unregistering f.
+func (m Memory) OnInvalidate(f func()) (remove func()) {
+	hook := &viewHook{f: f}
+	m.inst.viewHooks = append(m.inst.viewHooks, hook)
+	return func() {
+		for i, h := range m.inst.viewHooks {
+			if h == hook {
+				m.inst.viewHooks = append(m.inst.viewHooks[:i:i], m.inst.viewHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// invalidateViews calls the callbacks of the invalidation of the views of
+// the memory of inst.
+func (inst *Instance) invalidateViews() {
+	if len(inst.viewHooks) == 0 {
+		return
+	}
+	for _, hook := range append([]*viewHook(nil), inst.viewHooks...) {
+		hook.f()
+	}
+}
+
+// bytes returns the n bytes at offset in the memory.
+func (m Memory) bytes(offset uint32, n uint64) ([]byte, error) {
+	memory := m.memory()
+	if uint64(offset)+n > uint64(len(memory)) {
+		return nil, &MemoryRangeError{Offset: offset, Length: n, MemorySize: len(memory)}
+	}
+	end := uint64(offset) + n
+	return memory[offset:end:end], nil
+}
+
+// output returns the n bytes at offset in the memory like bytes, for them
+// to be written.
+func (m Memory) output(offset uint32, n uint64) ([]byte, error) {
+	b, err := m.bytes(offset, n)
+	if err == nil {
+		m.inst.wroteAt(m.index, uint64(offset), n)
+	}
+	return b, err
+}
+
+// ReadBytes returns a copy of the n bytes at offset.
+func (m Memory) ReadBytes(offset, n uint32) ([]byte, error) {
+	b, err := m.bytes(offset, uint64(n))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// ReadString returns the n bytes at offset as a string.
+func (m Memory) ReadString(offset, n uint32) (string, error) {
+	b, err := m.bytes(offset, uint64(n))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ReadCString returns the string at offset terminated by a NUL byte, of
+// at most max bytes without the NUL.
+func (m Memory) ReadCString(offset, max uint32) (string, error) {
+	memory := m.memory()
+	if uint64(offset) >= uint64(len(memory)) {
+		return "", &MemoryRangeError{Offset: offset, Length: 1, MemorySize: len(memory)}
+	}
+	b := memory[offset:]
+	if uint64(len(b)) > uint64(max)+1 {
+		b = b[:uint64(max)+1]
+	}
+	n := bytes.IndexByte(b, 0)
+	switch {
+	case n >= 0:
+		return string(b[:n]), nil
+	case uint64(len(b)) > uint64(max):
+		return "", ErrUnterminatedString
+	default:
+		// the string runs past the end of the memory
+		return "", &MemoryRangeError{Offset: offset, Length: uint64(len(b)) + 1, MemorySize: len(memory)}
+	}
+}
+
+// ReadUint8 returns the byte at offset.
+func (m Memory) ReadUint8(offset uint32) (uint8, error) {
+	b, err := m.bytes(offset, 1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// ReadUint16 returns the 16-bit integer at offset.
+func (m Memory) ReadUint16(offset uint32) (uint16, error) {
+	b, err := m.bytes(offset, 2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(b), nil
+}
+
+// ReadUint32 returns the 32-bit integer at offset.
+func (m Memory) ReadUint32(offset uint32) (uint32, error) {
+	b, err := m.bytes(offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// ReadUint64 returns the 64-bit integer at offset.
+func (m Memory) ReadUint64(offset uint32) (uint64, error) {
+	b, err := m.bytes(offset, 8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+// ReadFloat32 returns the 32-bit float at offset.
+func (m Memory) ReadFloat32(offset uint32) (float32, error) {
+	v, err := m.ReadUint32(offset)
+	return math.Float32frombits(v), err
+}
+
+// ReadFloat64 returns the 64-bit float at offset.
+func (m Memory) ReadFloat64(offset uint32) (float64, error) {
+	v, err := m.ReadUint64(offset)
+	return math.Float64frombits(v), err
+}
+
+// WriteBytes writes b at offset. Nothing is written if b doesn't fit.
+func (m Memory) WriteBytes(offset uint32, b []byte) error {
+	dst, err := m.output(offset, uint64(len(b)))
+	if err != nil {
+		return err
+	}
+	copy(dst, b)
+	return nil
+}
+
+// WriteString writes the bytes of s at offset, without a NUL byte.
+func (m Memory) WriteString(offset uint32, s string) error {
+	dst, err := m.output(offset, uint64(len(s)))
+	if err != nil {
+		return err
+	}
+	copy(dst, s)
+	return nil
+}
+
+// WriteUint8 writes the byte v at offset.
+func (m Memory) WriteUint8(offset uint32, v uint8) error {
+	b, err := m.output(offset, 1)
+	if err != nil {
+		return err
+	}
+	b[0] = v
+	return nil
+}
+
+// WriteUint16 writes the 16-bit integer v at offset.
+func (m Memory) WriteUint16(offset uint32, v uint16) error {
+	b, err := m.output(offset, 2)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint16(b, v)
+	return nil
+}
+
+// WriteUint32 writes the 32-bit integer v at offset.
+func (m Memory) WriteUint32(offset uint32, v uint32) error {
+	b, err := m.output(offset, 4)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(b, v)
+	return nil
+}
+
+// WriteUint64 writes the 64-bit integer v at offset.
+func (m Memory) WriteUint64(offset uint32, v uint64) error {
+	b, err := m.output(offset, 8)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint64(b, v)
+	return nil
+}
+
+// WriteFloat32 writes the 32-bit float v at offset.
+func (m Memory) WriteFloat32(offset uint32, v float32) error {
+	return m.WriteUint32(offset, math.Float32bits(v))
+}
+
+// WriteFloat64 writes the 64-bit float v at offset.
+func (m Memory) WriteFloat64(offset uint32, v float64) error {
+	return m.WriteUint64(offset, math.Float64bits(v))
+}
@@ -0,0 +1,156 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLinearMemory(t *testing.T) {
+	compiled, err := CompileModule(readTestModule(t, "testdata/instance-snapshot.wasm"), VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	mem := inst.LinearMemory()
+	size := uint32(mem.Size())
+
+	if err := mem.WriteUint32(16, 0xdeadbeef); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.WriteFloat64(24, 1.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.WriteString(32, "hello\x00"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := mem.ReadUint16(16); err != nil || v != 0xbeef {
+		t.Errorf("ReadUint16: got=%#x, %v", v, err)
+	}
+	if v, err := mem.ReadUint64(16); err != nil || v != 0xdeadbeef {
+		t.Errorf("ReadUint64: got=%#x, %v", v, err)
+	}
+	if v, err := mem.ReadFloat64(24); err != nil || v != 1.5 {
+		t.Errorf("ReadFloat64: got=%v, %v", v, err)
+	}
+	if s, err := mem.ReadString(32, 5); err != nil || s != "hello" {
+		t.Errorf("ReadString: got=%q, %v", s, err)
+	}
+	if s, err := mem.ReadCString(32, 5); err != nil || s != "hello" {
+		t.Errorf("ReadCString: got=%q, %v", s, err)
+	}
+	if _, err := mem.ReadCString(32, 4); err != ErrUnterminatedString {
+		t.Errorf("ReadCString of a longer string: got=%v", err)
+	}
+
+	// ReadBytes copies, Slice doesn't
+	b, _ := mem.ReadBytes(32, 5)
+	s, _ := mem.Slice(32, 5)
+	b[0], s[1] = 'j', 'a'
+	if got, _ := mem.ReadString(32, 5); got != "hallo" {
+		t.Errorf("got=%q after writing the slices, want=%q", got, "hallo")
+	}
+
+	for _, access := range []func() error{
+		func() error { _, err := mem.ReadUint32(size - 3); return err },
+		func() error { _, err := mem.ReadBytes(size, 1); return err },
+		func() error { _, err := mem.ReadBytes(^uint32(0), 2); return err },
+		func() error { return mem.WriteUint64(size-4, 1) },
+		func() error { return mem.WriteBytes(size-1, []byte{1, 2}) },
+		func() error { _, err := mem.ReadCString(size, 8); return err },
+	} {
+		err := access()
+		var rangeErr *MemoryRangeError
+		if !errors.As(err, &rangeErr) || !errors.Is(err, ErrOutOfBoundsMemoryAccess) || TrapCodeOf(err) != TrapOutOfBoundsMemory {
+			t.Errorf("out of bounds access: got=%v", err)
+		}
+	}
+	if err := mem.WriteUint8(size-1, 0xff); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.ReadCString(size-1, 8); !errors.Is(err, ErrOutOfBoundsMemoryAccess) {
+		t.Errorf("ReadCString past the end: got=%v", err)
+	}
+	if v, err := mem.ReadUint8(size - 1); err != nil || v != 0xff {
+		t.Errorf("ReadUint8 of the last byte: got=%#x, %v", v, err)
+	}
+
+	// the accessor follows the growth of the memory
+	if inst.growMemory(1) < 0 {
+		t.Fatal("the memory can't grow")
+	}
+	if mem.Size() <= int(size) {
+		t.Fatalf("size after growth: got=%d", mem.Size())
+	}
+	if err := mem.WriteUint64(size, 7); err != nil {
+		t.Errorf("write to the new page: %v", err)
+	}
+}
+
+func TestUnsafeView(t *testing.T) {
+	compiled, err := CompileModule(readTestModule(t, "testdata/instance-snapshot.wasm"), VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	mem := inst.LinearMemory()
+	size := uint32(mem.Size())
+
+	view := mem.UnsafeView(8, 4)
+	view[0] = 42
+	if v, _ := mem.ReadUint8(8); v != 42 {
+		t.Errorf("the view doesn't alias the memory: got=%d", v)
+	}
+	func() {
+		defer func() {
+			if _, ok := recover().(*MemoryRangeError); !ok {
+				t.Error("UnsafeView out of bounds didn't panic with a MemoryRangeError")
+			}
+		}()
+		mem.UnsafeView(size-2, 4)
+	}()
+
+	var first, second int
+	remove := mem.OnInvalidate(func() { first++ })
+	mem.OnInvalidate(func() { second++ })
+	if inst.growMemory(0) < 0 || first != 0 {
+		t.Errorf("growing by 0 pages invalidated the views %d times", first)
+	}
+	if inst.growMemory(1) < 0 || first != 1 || second != 1 {
+		t.Errorf("growing invalidated the views %d and %d times, want 1", first, second)
+	}
+	remove()
+	if err := inst.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if first != 1 || second != 2 {
+		t.Errorf("reset invalidated the views %d and %d times, want 1 and 2", first, second)
+	}
+	inst.ReleaseMemory()
+	if second != 3 {
+		t.Errorf("releasing the memory invalidated the views %d times, want 3", second)
+	}
+}
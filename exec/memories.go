@@ -0,0 +1,144 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"math"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// linearMemory is the state of a linear memory of an instance other than
+// its first one, whose state is held by the fields of Instance themselves
+// for the instructions to access it directly. An instruction accessing
+// another memory runs with that memory swapped in, see swapMemory. Only
+// the first memory can be mapped, pooled or shared.
+type linearMemory struct {
+	memory []byte
+	// whether the memory is indexed by i64 addresses
+	memory64 bool
+	// the size in bytes of the pages of the memory
+	pageSize int
+	// the length of the memory when instantiated, see Reset
+	initialMemory int
+	// the size the memory can grow to
+	maxMemory uint64
+	// the epochs of the last writes to the pages of the memory, see
+	// trackWrites
+	written []uint64
+	// the state of the first memory while another one is swapped in, and
+	// unset otherwise
+	mapping   []byte
+	committed int
+	shared    *sharedMemory
+}
+
+// memorySize returns the initial size of a memory of the given limits and
+// the size it can grow to, in bytes. A memory of 1-byte pages can't hold
+// more than math.MaxUint32 pages, the largest size memory.size returns.
+func memorySize(limits wasm.ResizableLimits) (int, uint64) {
+	pageSize := uint64(limits.PageSize())
+	maxPages := uint64(maxMemoryPages) * wasmPageSize / pageSize
+	if limits.Memory64() {
+		maxPages = maxMemory64Pages * wasmPageSize / pageSize
+	} else if maxPages > math.MaxUint32 {
+		maxPages = math.MaxUint32
+	}
+	if limits.Flags&0x1 != 0 && uint64(limits.Maximum) < maxPages {
+		maxPages = uint64(limits.Maximum)
+	}
+	return int(uint64(limits.Initial) * pageSize), maxPages * pageSize
+}
+
+// newMemories allocates the memories after the first one of the given
+// memories of a module.
+func newMemories(memories []wasm.Memory) []linearMemory {
+	if len(memories) <= 1 {
+		return nil
+	}
+	linear := make([]linearMemory, len(memories)-1)
+	for i, mem := range memories[1:] {
+		size, maxSize := memorySize(mem.Limits)
+		linear[i] = linearMemory{
+			memory:        make([]byte, size),
+			memory64:      mem.Limits.Memory64(),
+			pageSize:      mem.Limits.PageSize(),
+			initialMemory: size,
+			maxMemory:     maxSize,
+		}
+	}
+	return linear
+}
+
+// copyMemories returns a copy of memories, as they currently are, whose
+// writes aren't tracked.
+func copyMemories(memories []linearMemory) []linearMemory {
+	if memories == nil {
+		return nil
+	}
+	copied := make([]linearMemory, len(memories))
+	for i, mem := range memories {
+		mem.memory = append([]byte(nil), mem.memory...)
+		mem.written = nil
+		copied[i] = mem
+	}
+	return copied
+}
+
+// swapMemory exchanges the first memory of inst with the one at index,
+// for the instructions to access the latter as if it was the first one.
+// Swapping them again restores them. It does nothing for index 0.
+func (inst *Instance) swapMemory(index uint32) {
+	if index == 0 {
+		return
+	}
+	m := &inst.memories[index-1]
+	inst.memory, m.memory = m.memory, inst.memory
+	inst.memory64, m.memory64 = m.memory64, inst.memory64
+	inst.pageSize, m.pageSize = m.pageSize, inst.pageSize
+	inst.initialMemory, m.initialMemory = m.initialMemory, inst.initialMemory
+	inst.maxMemory, m.maxMemory = m.maxMemory, inst.maxMemory
+	inst.mapping, m.mapping = m.mapping, inst.mapping
+	inst.committed, m.committed = m.committed, inst.committed
+	inst.shared, m.shared = m.shared, inst.shared
+	inst.written, m.written = m.written, inst.written
+}
+
+// memoryAt returns the memory at index, and whether it is indexed by i64
+// addresses.
+func (inst *Instance) memoryAt(index uint32) ([]byte, bool) {
+	if index == 0 {
+		inst.syncMemory()
+		return inst.memory, inst.memory64
+	}
+	m := inst.memories[index-1]
+	return m.memory, m.memory64
+}
+
+// memoryAccess runs the memory instruction following compile.OpMemory on
+// the memory at index.
+func (vm *VM) memoryAccess(index uint32) {
+	vm.swapMemory(index)
+	defer vm.swapMemory(index)
+
+	op := vm.ctx.code[vm.ctx.pc]
+	vm.ctx.pc++
+	if vm.gasCosts != nil {
+		vm.consumeGas(gasCategories[op], vm.gasCosts[op])
+	}
+	vm.funcTable[op]()
+}
@@ -31,9 +31,11 @@ package exec
 
 import (
 	"encoding/binary"
-	"errors"
+	"fmt"
 	"math"
 	"reflect"
+
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
 )
 
 // Type define one variable type
@@ -67,105 +69,200 @@ type typeInfo struct {
 
 // ErrOutOfBoundsMemoryAccess is the error value used while trapping the VM
 // when it detects an out of bounds access to the linear memory.
-var ErrOutOfBoundsMemoryAccess = errors.New("exec: out of bounds memory access")
+var ErrOutOfBoundsMemoryAccess = newTrap(TrapOutOfBoundsMemory, "exec: out of bounds memory access")
 
 func (vm *VM) fetchBaseAddr() int {
+	if vm.memory64 {
+		return int(vm.fetchUint64() + vm.popUint64())
+	}
 	return int(vm.fetchUint32() + uint32(vm.popInt32()))
 }
 
+// effectiveAddr returns the effective address of the next memory access,
+// the offset following the operator added to the address operand on the
+// top of the stack, without consuming them. On a 64-bit memory, the offset
+// is a uint64 and the address an i64, whose sum may overflow.
+func (vm *VM) effectiveAddr() (addr uint64, overflow bool) {
+	operand := vm.ctx.stack[len(vm.ctx.stack)-1]
+	if vm.memory64 {
+		offset := endianess.Uint64(vm.ctx.code[vm.ctx.pc:])
+		addr = offset + operand
+		return addr, addr < offset
+	}
+	return uint64(endianess.Uint32(vm.ctx.code[vm.ctx.pc:])) + uint64(uint32(operand)), false
+}
+
+// fetchEffectiveAddr returns the effective address of the next memory
+// access like effectiveAddr, consuming the offset and the address operand.
+func (vm *VM) fetchEffectiveAddr() (uint64, bool) {
+	addr, overflow := vm.effectiveAddr()
+	if vm.memory64 {
+		vm.ctx.pc += 8
+	} else {
+		vm.ctx.pc += 4
+	}
+	vm.ctx.stack = vm.ctx.stack[:len(vm.ctx.stack)-1]
+	return addr, overflow
+}
+
 // inBounds returns true when the next vm.fetchBaseAddr() + offset
 // indices are in bounds accesses to the linear memory.
 func (vm *VM) inBounds(offset int) bool {
+	if vm.memory64 {
+		addr, overflow := vm.effectiveAddr()
+		size := uint64(len(vm.memory))
+		return !overflow && addr < size && size-addr > uint64(offset)
+	}
 	addr := endianess.Uint32(vm.ctx.code[vm.ctx.pc:]) + uint32(vm.ctx.stack[len(vm.ctx.stack)-1])
 	return int(addr)+offset < len(vm.memory)
 }
 
+// MemoryAccessError is the error value used while trapping the VM when a
+// load or store accesses the linear memory out of bounds. It matches
+// ErrOutOfBoundsMemoryAccess with errors.Is.
+type MemoryAccessError struct {
+	// Address is the effective address of the access, the static offset
+	// of the instruction added to its dynamic operand.
+	Address uint64
+	// Size is the number of bytes accessed, and MemorySize the length of
+	// the linear memory at the time of the access.
+	Size       int
+	MemorySize int
+	// Func is the index of the function performing the access, and Offset
+	// that of the load or store in its compiled code.
+	Func   int64
+	Offset int64
+	// Name is the name of the function in the name section, if any, and
+	// Source the source line of the load or store, if the module has line
+	// information, see (*Module).SourceLine.
+	Name   string
+	Source string
+}
+
+func (e *MemoryAccessError) Error() string {
+	return fmt.Sprintf("%v: address %d, size %d, memory size %d, in %s at offset %d%s",
+		ErrOutOfBoundsMemoryAccess, e.Address, e.Size, e.MemorySize, describeFunc(e.Func, e.Name), e.Offset, describeSource(e.Source))
+}
+
+// Is reports whether target is ErrOutOfBoundsMemoryAccess.
+func (e *MemoryAccessError) Is(target error) bool {
+	return target == ErrOutOfBoundsMemoryAccess
+}
+
+// TrapCode returns TrapOutOfBoundsMemory.
+func (e *MemoryAccessError) TrapCode() TrapCode { return TrapOutOfBoundsMemory }
+
+// memoryAccessError returns the error of a size bytes access to the next
+// vm.fetchBaseAddr(), without consuming its operands.
+func (vm *VM) memoryAccessError(size int) *MemoryAccessError {
+	addr, _ := vm.effectiveAddr()
+	return &MemoryAccessError{
+		Address:    addr,
+		Size:       size,
+		MemorySize: len(vm.memory),
+		Func:       vm.ctx.curFunc,
+		Offset:     vm.ctx.pc - 1,
+		Name:       vm.funcName(vm.ctx.curFunc),
+		Source:     vm.sourceLine(vm.ctx.curFunc, vm.ctx.pc-1),
+	}
+}
+
 // curMem returns a slice to the memeory segment pointed to by
 // the current base address on the bytecode stream.
 func (vm *VM) curMem() []byte {
 	return vm.memory[vm.fetchBaseAddr():]
 }
 
+// storeMem returns the memory from the effective address of a store of n
+// bytes like curMem, recording the write, see trackWrites.
+func (vm *VM) storeMem(n uint64) []byte {
+	addr := vm.fetchBaseAddr()
+	if vm.written != nil {
+		vm.wrote(uint64(addr), n)
+	}
+	return vm.memory[addr:]
+}
+
 func (vm *VM) i32Load() {
 	if !vm.inBounds(3) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(4))
 	}
 	vm.pushUint32(endianess.Uint32(vm.curMem()))
 }
 
 func (vm *VM) i32Load8s() {
 	if !vm.inBounds(0) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(1))
 	}
 	vm.pushInt32(int32(int8(vm.memory[vm.fetchBaseAddr()])))
 }
 
 func (vm *VM) i32Load8u() {
 	if !vm.inBounds(0) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(1))
 	}
 	vm.pushUint32(uint32(uint8(vm.memory[vm.fetchBaseAddr()])))
 }
 
 func (vm *VM) i32Load16s() {
 	if !vm.inBounds(1) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(2))
 	}
 	vm.pushInt32(int32(int16(endianess.Uint16(vm.curMem()))))
 }
 
 func (vm *VM) i32Load16u() {
 	if !vm.inBounds(1) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(2))
 	}
 	vm.pushUint32(uint32(endianess.Uint16(vm.curMem())))
 }
 
 func (vm *VM) i64Load() {
 	if !vm.inBounds(7) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(8))
 	}
 	vm.pushUint64(endianess.Uint64(vm.curMem()))
 }
 
 func (vm *VM) i64Load8s() {
 	if !vm.inBounds(0) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(1))
 	}
 	vm.pushInt64(int64(int8(vm.memory[vm.fetchBaseAddr()])))
 }
 
 func (vm *VM) i64Load8u() {
 	if !vm.inBounds(0) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(1))
 	}
 	vm.pushUint64(uint64(uint8(vm.memory[vm.fetchBaseAddr()])))
 }
 
 func (vm *VM) i64Load16s() {
 	if !vm.inBounds(1) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(2))
 	}
 	vm.pushInt64(int64(int16(endianess.Uint16(vm.curMem()))))
 }
 
 func (vm *VM) i64Load16u() {
 	if !vm.inBounds(1) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(2))
 	}
 	vm.pushUint64(uint64(endianess.Uint16(vm.curMem())))
 }
 
 func (vm *VM) i64Load32s() {
 	if !vm.inBounds(3) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(4))
 	}
 	vm.pushInt64(int64(int32(endianess.Uint32(vm.curMem()))))
 }
 
 func (vm *VM) i64Load32u() {
 	if !vm.inBounds(3) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(4))
 	}
 	vm.pushUint64(uint64(endianess.Uint32(vm.curMem())))
 }
@@ -173,14 +270,14 @@ func (vm *VM) i64Load32u() {
 func (vm *VM) f32Store() {
 	v := math.Float32bits(vm.popFloat32())
 	if !vm.inBounds(3) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(4))
 	}
-	endianess.PutUint32(vm.curMem(), v)
+	endianess.PutUint32(vm.storeMem(4), v)
 }
 
 func (vm *VM) f32Load() {
 	if !vm.inBounds(3) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(4))
 	}
 	vm.pushFloat32(math.Float32frombits(endianess.Uint32(vm.curMem())))
 }
@@ -188,14 +285,14 @@ func (vm *VM) f32Load() {
 func (vm *VM) f64Store() {
 	v := math.Float64bits(vm.popFloat64())
 	if !vm.inBounds(7) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(8))
 	}
-	endianess.PutUint64(vm.curMem(), v)
+	endianess.PutUint64(vm.storeMem(8), v)
 }
 
 func (vm *VM) f64Load() {
 	if !vm.inBounds(7) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(8))
 	}
 	vm.pushFloat64(math.Float64frombits(endianess.Uint64(vm.curMem())))
 }
@@ -203,70 +300,246 @@ func (vm *VM) f64Load() {
 func (vm *VM) i32Store() {
 	v := vm.popUint32()
 	if !vm.inBounds(3) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(4))
 	}
-	endianess.PutUint32(vm.curMem(), v)
+	endianess.PutUint32(vm.storeMem(4), v)
 }
 
 func (vm *VM) i32Store8() {
 	v := byte(uint8(vm.popUint32()))
 	if !vm.inBounds(0) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(1))
 	}
-	vm.memory[vm.fetchBaseAddr()] = v
+	vm.storeMem(1)[0] = v
 }
 
 func (vm *VM) i32Store16() {
 	v := uint16(vm.popUint32())
 	if !vm.inBounds(1) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(2))
 	}
-	endianess.PutUint16(vm.curMem(), v)
+	endianess.PutUint16(vm.storeMem(2), v)
 }
 
 func (vm *VM) i64Store() {
 	v := vm.popUint64()
 	if !vm.inBounds(7) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(8))
 	}
-	endianess.PutUint64(vm.curMem(), v)
+	endianess.PutUint64(vm.storeMem(8), v)
 }
 
 func (vm *VM) i64Store8() {
 	v := byte(uint8(vm.popUint64()))
 	if !vm.inBounds(0) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(1))
 	}
-	vm.memory[vm.fetchBaseAddr()] = v
+	vm.storeMem(1)[0] = v
 }
 
 func (vm *VM) i64Store16() {
 	v := uint16(vm.popUint64())
 	if !vm.inBounds(1) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(2))
 	}
-	endianess.PutUint16(vm.curMem(), v)
+	endianess.PutUint16(vm.storeMem(2), v)
 }
 
 func (vm *VM) i64Store32() {
 	v := uint32(vm.popUint64())
 	if !vm.inBounds(3) {
-		panic(ErrOutOfBoundsMemoryAccess)
+		panic(vm.memoryAccessError(4))
+	}
+	endianess.PutUint32(vm.storeMem(4), v)
+}
+
+// uncheckedMemAccess executes the load or store op without checking its
+// effective address, see compile.OpUnchecked.
+func (vm *VM) uncheckedMemAccess(op byte) {
+	switch op {
+	case ops.I32Load:
+		vm.pushUint32(endianess.Uint32(vm.curMem()))
+	case ops.I32Load8s:
+		vm.pushInt32(int32(int8(vm.memory[vm.fetchBaseAddr()])))
+	case ops.I32Load8u:
+		vm.pushUint32(uint32(uint8(vm.memory[vm.fetchBaseAddr()])))
+	case ops.I32Load16s:
+		vm.pushInt32(int32(int16(endianess.Uint16(vm.curMem()))))
+	case ops.I32Load16u:
+		vm.pushUint32(uint32(endianess.Uint16(vm.curMem())))
+	case ops.I64Load:
+		vm.pushUint64(endianess.Uint64(vm.curMem()))
+	case ops.I64Load8s:
+		vm.pushInt64(int64(int8(vm.memory[vm.fetchBaseAddr()])))
+	case ops.I64Load8u:
+		vm.pushUint64(uint64(uint8(vm.memory[vm.fetchBaseAddr()])))
+	case ops.I64Load16s:
+		vm.pushInt64(int64(int16(endianess.Uint16(vm.curMem()))))
+	case ops.I64Load16u:
+		vm.pushUint64(uint64(endianess.Uint16(vm.curMem())))
+	case ops.I64Load32s:
+		vm.pushInt64(int64(int32(endianess.Uint32(vm.curMem()))))
+	case ops.I64Load32u:
+		vm.pushUint64(uint64(endianess.Uint32(vm.curMem())))
+	case ops.F32Load:
+		vm.pushFloat32(math.Float32frombits(endianess.Uint32(vm.curMem())))
+	case ops.F64Load:
+		vm.pushFloat64(math.Float64frombits(endianess.Uint64(vm.curMem())))
+	case ops.I32Store:
+		v := vm.popUint32()
+		endianess.PutUint32(vm.storeMem(4), v)
+	case ops.I32Store8:
+		v := byte(uint8(vm.popUint32()))
+		vm.storeMem(1)[0] = v
+	case ops.I32Store16:
+		v := uint16(vm.popUint32())
+		endianess.PutUint16(vm.storeMem(2), v)
+	case ops.I64Store:
+		v := vm.popUint64()
+		endianess.PutUint64(vm.storeMem(8), v)
+	case ops.I64Store8:
+		v := byte(uint8(vm.popUint64()))
+		vm.storeMem(1)[0] = v
+	case ops.I64Store16:
+		v := uint16(vm.popUint64())
+		endianess.PutUint16(vm.storeMem(2), v)
+	case ops.I64Store32:
+		v := uint32(vm.popUint64())
+		endianess.PutUint32(vm.storeMem(4), v)
+	case ops.F32Store:
+		v := math.Float32bits(vm.popFloat32())
+		endianess.PutUint32(vm.storeMem(4), v)
+	case ops.F64Store:
+		v := math.Float64bits(vm.popFloat64())
+		endianess.PutUint64(vm.storeMem(8), v)
+	default:
+		vm.funcTable[op]()
 	}
-	endianess.PutUint32(vm.curMem(), v)
 }
 
 func (vm *VM) currentMemory() {
 	_ = vm.fetchInt8() // reserved (https://github.com/WebAssembly/design/blob/27ac254c854994103c24834a994be16f74f54186/BinaryEncoding.md#memory-related-operators-described-here)
-	vm.pushInt32(int32(len(vm.memory) / wasmPageSize))
+	vm.syncMemory()
+	if vm.memory64 {
+		vm.pushInt64(int64(len(vm.memory) / vm.pageSize))
+		return
+	}
+	vm.pushInt32(int32(len(vm.memory) / vm.pageSize))
 }
 
 func (vm *VM) growMemory() {
 	_ = vm.fetchInt8() // reserved (https://github.com/WebAssembly/design/blob/27ac254c854994103c24834a994be16f74f54186/BinaryEncoding.md#memory-related-operators-described-here)
-	curLen := len(vm.memory) / wasmPageSize
-	n := vm.popInt32()
-	vm.memory = append(vm.memory, make([]byte, n*wasmPageSize)...) //auto extend range
-	vm.pushInt32(int32(curLen))
+	if vm.memory64 {
+		// the delta and the result are i64 values
+		n := vm.popUint64()
+		if n > math.MaxUint32 {
+			vm.pushInt64(-1)
+			return
+		}
+		vm.pushInt64(int64(vm.grow(uint32(n))))
+		return
+	}
+	vm.pushInt32(vm.grow(vm.popUint32()))
+}
+
+// grow runs memory.grow for n pages, and returns its result.
+func (vm *VM) grow(n uint32) (prev int32) {
+	if vm.replayer != nil {
+		return vm.replayGrow(n)
+	}
+	if vm.recording() {
+		defer vm.recordGrow(n, vm.meteredGas(), &prev)
+	}
+	return vm.growPages(n)
+}
+
+// growPages grows the memory of vm by n pages for memory.grow, within the
+// limits of the call, and returns the previous size of the memory in
+// pages, or -1.
+func (vm *VM) growPages(n uint32) int32 {
+	vm.syncMemory()
+	if max := vm.config.MaxGrowPages; max != 0 && uint64(vm.grownPages)+uint64(n) > uint64(max) {
+		return -1
+	}
+	if !vm.limitMemoryGrowth(n) {
+		return -1
+	}
+	if vm.gasMeter != nil && n != 0 {
+		// the pages are charged before being allocated, unless the memory
+		// can't grow that much anyway. They are charged by 64 KiB, whatever
+		// the page size of the memory.
+		size := uint64(len(vm.memory))
+		newSize := size + uint64(n)*uint64(vm.pageSize)
+		if newSize <= vm.maxMemory {
+			vm.consumeGas(GasMemory, vm.growCost.charge(chargedPages(size), chargedPages(newSize)))
+		}
+	}
+	prev := vm.Instance.growMemory(n)
+	if prev >= 0 {
+		vm.grownPages += n
+		if vm.config.OnMemoryGrow != nil {
+			vm.config.OnMemoryGrow(vm, uint32(prev), uint32(prev)+n)
+		}
+	}
+	return prev
+}
+
+// growMemory grows the memory of inst by n pages. It returns the previous
+// size of the memory in pages, or -1 if the memory can't grow that much.
+func (inst *Instance) growMemory(n uint32) int32 {
+	if s := inst.shared; s != nil {
+		// the memory grows in place, see sharedMemory
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		inst.memory = inst.memory[:s.size]
+		defer func() { s.size = len(inst.memory) }()
+	}
+	pages   := uint64(len(inst.memory) / inst.pageSize)
+	newSize := (pages + uint64(n)) * uint64(inst.pageSize)
+	if newSize > inst.maxMemory || newSize > uint64(^uint(0)>>1) {
+		return -1
+	}
+
+	size := int(newSize)
+	switch {
+	case inst.mapping != nil:
+		// the memory grows in place, inside its reserved address space
+		if size > inst.committed {
+			if commitMemory(inst.mapping, size) != nil {
+				return -1
+			}
+			inst.committed = size
+		}
+		fallthrough
+	case size <= cap(inst.memory):
+		// the bytes past the length may have been used before a Reset
+		grown := inst.memory[len(inst.memory):size]
+		for i := range grown {
+			grown[i] = 0
+		}
+		inst.memory = inst.memory[:size]
+	default:
+		capacity := 2 * cap(inst.memory)
+		if capacity < size {
+			capacity = size
+		} else if uint64(capacity) > inst.maxMemory {
+			capacity = int(inst.maxMemory)
+		}
+		memory := make([]byte, size, capacity)
+		copy(memory, inst.memory)
+		inst.memory = memory
+	}
+	if inst.written != nil {
+		inst.written = extendPages(inst.written, newSize)
+	}
+	if sink := inst.compiled.config.Metrics; sink != nil {
+		sink.Count(MetricGrownPages, "", uint64(n))
+	}
+	if n != 0 {
+		inst.invalidateViews()
+	}
+
+	return int32(pages)
 }
 
 // GetData retrieve data
@@ -344,6 +617,7 @@ func (vm *VM) storageMemory(b []byte, t Type) (uint64 , error) {
 	}
 	copy(vm.memory[index : index + uint64(len(b))], b)
 	vm.memory[index + uint64(len(b))] = 0
+	vm.wrote(index, uint64(len(b))+1)
 
 	return index, nil
 }
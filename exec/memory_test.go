@@ -0,0 +1,203 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGrowMemory(t *testing.T) {
+	type grow struct {
+		pages uint32
+		res   int32
+	}
+	for _, test := range []struct {
+		file  string
+		grows []grow
+	}{
+		{"resizing.wasm", []grow{{1, 0}, {0, 1}, {maxMemoryPages, -1}, {0xffffffff, -1}, {2, 1}}},
+		// (memory 1 1)
+		{"memory_redundancy.wasm", []grow{{0, 1}, {1, -1}}},
+	} {
+		for _, config := range []VMConfig{{}, {MappedMemory: true}, {StaticMemoryBounds: true}} {
+			var notified [][2]uint32
+			config.OnMemoryGrow = func(vm *VM, previous, current uint32) {
+				notified = append(notified, [2]uint32{previous, current})
+			}
+			vm, err := NewVMWithConfig(readTestModule(t, "testdata/spec/"+test.file), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want [][2]uint32
+			for _, grow := range test.grows {
+				prev := len(vm.Memory()) / wasmPageSize
+				vm.ctx.stack = []uint64{uint64(grow.pages)}
+				vm.ctx.code = []byte{0}
+				vm.ctx.pc = 0
+				vm.growMemory()
+
+				res := vm.popInt32()
+				if res != grow.res {
+					t.Errorf("%s: grow(%d): got=%d, want=%d", test.file, grow.pages, res, grow.res)
+				}
+				size := prev
+				if res >= 0 {
+					size += int(grow.pages)
+					want = append(want, [2]uint32{uint32(prev), uint32(size)})
+				}
+				if len(vm.Memory()) != size*wasmPageSize {
+					t.Errorf("%s: grow(%d): unexpected memory size %d", test.file, grow.pages, len(vm.Memory()))
+				}
+			}
+			if len(notified) != len(want) {
+				t.Errorf("%s: unexpected notifications: got=%v, want=%v", test.file, notified, want)
+			}
+		}
+	}
+}
+
+func TestReleaseMemory(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/resizing.wasm")
+	grow := int64(module.Export.Entries["grow"].Index)
+	store := int64(module.Export.Entries["store_at_zero"].Index)
+	load := int64(module.Export.Entries["load_at_zero"].Index)
+
+	for _, config := range []VMConfig{{}, {MappedMemory: true}} {
+		vm, err := NewVMWithConfig(module, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := vm.ExecCode(grow, 4); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := vm.ExecCode(store); err != nil {
+			t.Fatal(err)
+		}
+		if released := vm.ReleaseMemory(); released != 0 {
+			t.Errorf("mapped=%v: released used memory: %d", config.MappedMemory, released)
+		}
+		if v, _ := vm.ExecCode(load); v.(uint32) != 2 {
+			t.Errorf("mapped=%v: memory wasn't preserved: %v", config.MappedMemory, v)
+		}
+
+		if err := vm.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		if released := vm.ReleaseMemory(); released != 4*wasmPageSize {
+			t.Errorf("mapped=%v: unexpected released memory: %d", config.MappedMemory, released)
+		}
+		if released := vm.ReleaseMemory(); released != 0 {
+			t.Errorf("mapped=%v: memory released twice: %d", config.MappedMemory, released)
+		}
+
+		config.RetainedMemory = wasmPageSize
+		vm, err = NewVMWithConfig(module, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := vm.ExecCode(grow, 4); err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		if held := vm.heldMemory(); held != 0 {
+			t.Errorf("mapped=%v: Reset retained %d bytes", config.MappedMemory, held)
+		}
+	}
+}
+
+func TestMemoryGrowLimits(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/resizing.wasm")
+	grow := int64(module.Export.Entries["grow"].Index)
+
+	vm, err := NewVMWithConfig(module, VMConfig{MaxGrowPages: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule := DefaultGasSchedule()
+	schedule.MemoryGrow = MemoryGrowCost{PerPage: 10, Quadratic: 1}
+	vm.SetGasMeter(NewGasMeter(1<<20), schedule)
+
+	if _, err := vm.ExecCode(grow, 0); err != nil {
+		t.Fatal(err)
+	}
+	base := vm.GasUsed()
+	for _, tc := range []struct {
+		pages uint64
+		res   int32
+		gas   uint64
+	}{
+		{2, 0, 10*2 + 2*2},
+		{1, 2, 10*1 + 3*3 - 2*2},
+		// the cap applies to every call, whatever the size of the memory
+		{3, 3, 10*3 + 6*6 - 3*3},
+		{4, -1, 0},
+	} {
+		res, err := vm.ExecCode(grow, tc.pages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int32(res.(uint32)) != tc.res {
+			t.Errorf("grow(%d): got=%d, want=%d", tc.pages, res, tc.res)
+		}
+		if gas := vm.GasUsed() - base; gas != tc.gas {
+			t.Errorf("grow(%d): unexpected gas: got=%d, want=%d", tc.pages, gas, tc.gas)
+		}
+	}
+
+	if got := (MemoryGrowCost{Quadratic: 1 << 40}).charge(0, maxMemoryPages); got != ^uint64(0) {
+		t.Errorf("cost did not saturate: %d", got)
+	}
+}
+
+func TestMemoryAccessError(t *testing.T) {
+	vm, err := NewVM(readTestModule(t, "testdata/spec/memory_redundancy.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// i64.load offset=8 of address 65530, in a single page memory
+	vm.ctx.code = []byte{0, 8, 0, 0, 0}
+	vm.ctx.pc = 1
+	vm.ctx.stack = []uint64{65530}
+	vm.ctx.curFunc = 2
+
+	var r interface{}
+	func() {
+		defer func() { r = recover() }()
+		vm.i64Load()
+	}()
+
+	merr, ok := r.(*MemoryAccessError)
+	if !ok {
+		t.Fatalf("got=%v, want a MemoryAccessError", r)
+	}
+	want := MemoryAccessError{Address: 65538, Size: 8, MemorySize: wasmPageSize, Func: 2, Offset: 0}
+	if *merr != want {
+		t.Errorf("got=%+v, want=%+v", *merr, want)
+	}
+	if !errors.Is(merr, ErrOutOfBoundsMemoryAccess) {
+		t.Error("MemoryAccessError does not match ErrOutOfBoundsMemoryAccess")
+	}
+	if code := TrapCodeOf(merr); code != TrapOutOfBoundsMemory {
+		t.Errorf("trap code: got=%v, want=%v", code, TrapOutOfBoundsMemory)
+	}
+}
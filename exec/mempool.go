@@ -0,0 +1,89 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "sync"
+
+// MemoryPool recycles linear memories between instances, so that
+// instantiating a module under load doesn't allocate a new memory every
+// time. Memories are kept by capacity, and zeroed when leased again. It
+// is safe for concurrent use.
+type MemoryPool struct {
+	maxIdle int
+
+	mu   sync.Mutex
+	idle int // total capacity of the idle memories
+	free map[int][][]byte
+}
+
+// NewMemoryPool returns a pool keeping idle memories of at most maxIdle
+// bytes in total.
+func NewMemoryPool(maxIdle int) *MemoryPool {
+	return &MemoryPool{
+		maxIdle: maxIdle,
+		free:    make(map[int][][]byte),
+	}
+}
+
+// Get returns a zeroed memory of size bytes, with a capacity of capacity
+// bytes. Both must be multiples of the page size.
+func (p *MemoryPool) Get(size, capacity int) []byte {
+	p.mu.Lock()
+	memories := p.free[capacity]
+	if n := len(memories); n != 0 {
+		mem := memories[n-1]
+		memories[n-1] = nil
+		p.free[capacity] = memories[:n-1]
+		p.idle -= capacity
+		p.mu.Unlock()
+
+		// the bytes past the length of a memory are overwritten when it
+		// grows, only the leased part needs to be cleared
+		mem = mem[:size]
+		for i := range mem {
+			mem[i] = 0
+		}
+		return mem
+	}
+	p.mu.Unlock()
+
+	return make([]byte, size, capacity)
+}
+
+// Put returns mem to the pool. mem must not be used anymore by the caller.
+func (p *MemoryPool) Put(mem []byte) {
+	capacity := cap(mem)
+	if capacity == 0 || capacity%wasmPageSize != 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.idle+capacity > p.maxIdle {
+		return
+	}
+	p.free[capacity] = append(p.free[capacity], mem[:0])
+	p.idle += capacity
+}
+
+// Idle returns the total capacity of the idle memories in the pool.
+func (p *MemoryPool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.idle
+}
@@ -0,0 +1,82 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestMemoryPool(t *testing.T) {
+	pool := NewMemoryPool(4 * wasmPageSize)
+
+	mem := pool.Get(wasmPageSize, 2*wasmPageSize)
+	if len(mem) != wasmPageSize || cap(mem) != 2*wasmPageSize {
+		t.Fatalf("unexpected memory: len=%d, cap=%d", len(mem), cap(mem))
+	}
+	mem = append(mem, make([]byte, wasmPageSize)...)
+	mem[0], mem[len(mem)-1] = 1, 1
+	pool.Put(mem)
+	if pool.Idle() != 2*wasmPageSize {
+		t.Fatalf("unexpected idle size: %d", pool.Idle())
+	}
+
+	reused := pool.Get(2*wasmPageSize, 2*wasmPageSize)
+	if &reused[0] != &mem[0] {
+		t.Fatal("memory wasn't reused")
+	}
+	for i, b := range reused {
+		if b != 0 {
+			t.Fatalf("memory wasn't zeroed at %d", i)
+		}
+	}
+
+	pool.Put(reused)
+	pool.Put(make([]byte, 0, 4*wasmPageSize))
+	if pool.Idle() != 2*wasmPageSize {
+		t.Errorf("pool exceeds its size: %d", pool.Idle())
+	}
+}
+
+func TestInstanceMemoryPool(t *testing.T) {
+	pool := NewMemoryPool(16 * wasmPageSize)
+	compiled, err := CompileModule(readTestModule(t, "testdata/spec/globals.wasm"), VMConfig{MemoryPool: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instances := NewInstancePool(compiled, nil, 0)
+	inst, err := instances.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := inst.Memory()
+	memory[0] = 0xff
+	instances.Put(inst)
+	if pool.Idle() != cap(memory) {
+		t.Fatalf("memory wasn't returned to the pool: idle=%d", pool.Idle())
+	}
+
+	inst, err = compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &inst.Memory()[0] != &memory[0] {
+		t.Error("memory wasn't leased from the pool")
+	}
+	if inst.Memory()[0] != 0 {
+		t.Error("leased memory wasn't zeroed")
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+)
+
+// MerkleConfig configures a StateHasher.
+type MerkleConfig struct {
+	// ChunkSize is the size in bytes of the chunks of memory hashed as the
+	// leaves of the trees, 4096 if zero.
+	ChunkSize int
+	// Hash returns the hash function of the trees, sha256.New if nil.
+	Hash func() hash.Hash
+}
+
+// The prefixes of the hashed nodes, for a node of a kind to never be
+// taken for one of another kind.
+const (
+	merkleLeaf byte = iota
+	merkleNode
+	merkleMemory
+	merkleGlobals
+	merkleState
+)
+
+// StateHasher computes a Merkle root over the memories and globals of an
+// instance, for a chain to commit to the state of a contract. Every memory
+// is split into chunks of MerkleConfig.ChunkSize bytes, the last one being
+// shorter if the size of the memory isn't a multiple of it, and
+//
+//	leaf    = H(0x00 || chunk)
+//	node    = H(0x01 || left || right), a node without sibling being
+//	          promoted to the next level as it is
+//	memory  = H(0x02 || size || root of the leaves), size as an uint64
+//	globals = H(0x03 || the slots of the globals, as uint64s)
+//	state   = H(0x04 || memory 0 || memory 1 ... || globals)
+//
+// All integers are little endian, and the root of an empty memory is the
+// leaf of an empty chunk.
+//
+// The hasher has the instance track the pages of its memories written,
+// see UnsafeView, so that Root only hashes the chunks dirtied since the
+// previous root and the nodes above them, the writes being tracked by
+// pages of 4096 bytes, the chunks of a memory shared
+// with other instances being always rehashed. While the writes are
+// tracked, the functions compiled to native code are interpreted. The
+// hasher must not be used while a call of the instance is in progress.
+type StateHasher struct {
+	inst      *Instance
+	chunkSize int
+	hash      hash.Hash
+	memories  []merkleTree
+	// the epoch of the writes of the previous root, see writeMark
+	mark uint64
+	// the number of chunks hashed by the last call to Root
+	hashed int
+}
+
+// merkleTree is the tree of a memory: the size of the memory last hashed,
+// and the hashes of the levels of the tree, from the leaves to the root.
+type merkleTree struct {
+	size   int
+	levels [][][]byte
+}
+
+// NewStateHasher returns a hasher of the state of inst, configured by
+// config. The first call to Root hashes the whole state.
+func NewStateHasher(inst *Instance, config MerkleConfig) *StateHasher {
+	h := &StateHasher{inst: inst, chunkSize: config.ChunkSize, hash: sha256.New()}
+	if h.chunkSize <= 0 {
+		h.chunkSize = 4096
+	}
+	if config.Hash != nil {
+		h.hash = config.Hash()
+	}
+	inst.trackWrites()
+	return h
+}
+
+// Root returns the Merkle root of the current state of the instance,
+// rehashing the chunks changed since the previous root. It returns
+// ERR_INSTANCE_CLOSED once the instance is closed.
+func (h *StateHasher) Root() ([]byte, error) {
+	inst := h.inst
+	if inst.closed {
+		return nil, ERR_INSTANCE_CLOSED
+	}
+	h.hashed = 0
+	if len(h.memories) != 1+len(inst.memories) {
+		h.memories = make([]merkleTree, 1+len(inst.memories))
+	}
+	since := h.mark
+	h.mark = inst.writeMark()
+
+	var roots [][]byte
+	for i := range h.memories {
+		memory, _ := inst.memoryAt(uint32(i))
+		roots = append(roots, h.update(&h.memories[i], memory, inst.writtenPages(uint32(i)), since))
+	}
+	h.hash.Reset()
+	h.hash.Write([]byte{merkleGlobals})
+	var slot [8]byte
+	for _, v := range inst.globals {
+		binary.LittleEndian.PutUint64(slot[:], v)
+		h.hash.Write(slot[:])
+	}
+	roots = append(roots, h.hash.Sum(nil))
+
+	h.hash.Reset()
+	h.hash.Write([]byte{merkleState})
+	for _, root := range roots {
+		h.hash.Write(root)
+	}
+	return h.hash.Sum(nil), nil
+}
+
+// update brings t up to date with memory, whose pages have the epochs of
+// written, and returns the root of the memory. Only the chunks written
+// since mark are rehashed.
+func (h *StateHasher) update(t *merkleTree, memory []byte, written []uint64, mark uint64) []byte {
+	chunks := (len(memory) + h.chunkSize - 1) / h.chunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	var dirty []int
+	if len(t.levels) == 0 || len(t.levels[0]) != chunks || t.size != len(memory) {
+		// the memory was resized, only the chunks it already had whole may
+		// be unchanged
+		leaves := make([][]byte, chunks)
+		if len(t.levels) != 0 {
+			copy(leaves, t.levels[0])
+		}
+		t.levels = [][][]byte{leaves}
+		if t.size > len(memory) {
+			t.size = len(memory)
+		}
+		for i := t.size / h.chunkSize; i < chunks; i++ {
+			leaves[i] = nil
+		}
+		t.size = len(memory)
+	}
+	leaves := t.levels[0]
+	for i := range leaves {
+		start, end := i*h.chunkSize, (i+1)*h.chunkSize
+		if end > len(memory) {
+			end = len(memory)
+		}
+		if leaves[i] != nil && !writtenSince(written, start, end, mark) {
+			continue
+		}
+		h.hash.Reset()
+		h.hash.Write([]byte{merkleLeaf})
+		h.hash.Write(memory[start:end])
+		leaves[i] = h.hash.Sum(nil)
+		h.hashed++
+		dirty = append(dirty, i)
+	}
+
+	// the nodes above the dirty leaves, level by level, all of them if
+	// the levels are to be built
+	rebuild := len(t.levels) == 1
+	for level := 0; len(t.levels[level]) > 1; level++ {
+		below := t.levels[level]
+		if rebuild {
+			t.levels = append(t.levels, make([][]byte, (len(below)+1)/2))
+			dirty = dirty[:0]
+			for i := 0; i < len(below); i += 2 {
+				dirty = append(dirty, i)
+			}
+		}
+		nodes := t.levels[level+1]
+		var parents []int
+		for _, i := range dirty {
+			parent := i / 2
+			if len(parents) != 0 && parents[len(parents)-1] == parent {
+				continue
+			}
+			parents = append(parents, parent)
+			if 2*parent+1 == len(below) {
+				nodes[parent] = below[2*parent]
+				continue
+			}
+			h.hash.Reset()
+			h.hash.Write([]byte{merkleNode})
+			h.hash.Write(below[2*parent])
+			h.hash.Write(below[2*parent+1])
+			nodes[parent] = h.hash.Sum(nil)
+		}
+		dirty = parents
+	}
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(memory)))
+	h.hash.Reset()
+	h.hash.Write([]byte{merkleMemory})
+	h.hash.Write(size[:])
+	h.hash.Write(t.levels[len(t.levels)-1][0])
+	return h.hash.Sum(nil)
+}
@@ -0,0 +1,129 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"testing"
+)
+
+func TestStateHasher(t *testing.T) {
+	module := readTestModule(t, "testdata/instance-snapshot.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	// the layout of the tree, the memory being split into 3 chunks
+	sum := func(parts ...[]byte) []byte {
+		h := sha256.Sum256(bytes.Join(parts, nil))
+		return h[:]
+	}
+	memory := inst.Memory()
+	size, slots := make([]byte, 8), make([]byte, 8*len(inst.globals))
+	binary.LittleEndian.PutUint64(size, uint64(len(memory)))
+	for i, v := range inst.globals {
+		binary.LittleEndian.PutUint64(slots[8*i:], v)
+	}
+	leaf := func(chunk []byte) []byte { return sum([]byte{0}, chunk) }
+	node := sum([]byte{1}, leaf(memory[:21846]), leaf(memory[21846:43692]))
+	node = sum([]byte{1}, node, leaf(memory[43692:]))
+	want := sum([]byte{4}, sum([]byte{2}, size, node), sum([]byte{3}, slots))
+	if got, _ := NewStateHasher(inst, MerkleConfig{ChunkSize: 21846}).Root(); !bytes.Equal(got, want) {
+		t.Errorf("root: got=%x, want=%x", got, want)
+	}
+
+	h := NewStateHasher(inst, MerkleConfig{})
+	root, err := h.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.hashed != 16 {
+		t.Errorf("first root: %d chunks hashed, want 16", h.hashed)
+	}
+	// check returns the root of h once the state of inst changed, which
+	// must hash the given number of chunks, and be the root of a new
+	// hasher of the same state
+	check := func(what string, hashed int) []byte {
+		t.Helper()
+		got, err := h.Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.hashed != hashed {
+			t.Errorf("%s: %d chunks hashed, want %d", what, h.hashed, hashed)
+		}
+		if want, _ := NewStateHasher(inst, MerkleConfig{}).Root(); !bytes.Equal(got, want) {
+			t.Errorf("%s: got=%x, want=%x", what, got, want)
+		}
+		return got
+	}
+	if got := check("unchanged", 0); !bytes.Equal(got, root) {
+		t.Errorf("unchanged: the root changed")
+	}
+	snapshot, err := inst.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inst.Call("bump"); err != nil {
+		t.Fatal(err)
+	}
+	if got := check("bump", 1); bytes.Equal(got, root) {
+		t.Errorf("bump: the root didn't change")
+	}
+	// the writes of the host are found as well, the whole memory counting
+	// as written once handed out
+	if err := inst.LinearMemory().WriteUint16(8191, 1); err != nil {
+		t.Fatal(err)
+	}
+	check("host write", 2)
+	inst.LinearMemory().UnsafeView(9000, 1)[0] = 1
+	check("view", 1)
+	inst.Memory()[5000] = 2
+	check("memory", 16)
+	if _, err := inst.Call("grow"); err != nil {
+		t.Fatal(err)
+	}
+	check("grow", 16)
+	if _, ok := inst.LinearMemory().Grow(1); !ok {
+		t.Fatal("grow: failed")
+	}
+	check("host grow", 16)
+	if err := inst.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if got := check("restore", 16); !bytes.Equal(got, root) {
+		t.Errorf("restore: got=%x, want=%x", got, root)
+	}
+
+	if got, _ := NewStateHasher(inst, MerkleConfig{Hash: sha512.New}).Root(); len(got) != sha512.Size {
+		t.Errorf("sha512: got a root of %d bytes", len(got))
+	}
+	inst.Close()
+	if _, err := h.Root(); err != ERR_INSTANCE_CLOSED {
+		t.Errorf("closed: err=%v", err)
+	}
+}
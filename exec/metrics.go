@@ -0,0 +1,236 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsSink receives the metrics of the VMs whose VMConfig.Metrics it
+// is, at the events named by the Metric constants: instantiations, start
+// and end of the calls, traps, memory growth, and the loads of the module
+// caches compiling with such a config. Its methods may be called from
+// several goroutines at once. The VMs make no call when VMConfig.Metrics
+// is nil, so the metrics cost nothing unless a sink is set.
+//
+// Only the outermost calls count, not the ones nested in a host function.
+// The pages of the instances are updated when they are created, reset
+// and closed, and at the end of their calls.
+type MetricsSink interface {
+	// Count adds n to the counter name, label being the label of the
+	// counter, like the reason of a trap, or "".
+	Count(name, label string, n uint64)
+	// Gauge adds delta to the gauge name.
+	Gauge(name string, delta int64)
+	// Observe records value in the histogram name.
+	Observe(name string, value float64)
+}
+
+// The metrics a MetricsSink receives.
+const (
+	MetricInstantiations    = "instantiations"             // counter, the instances created
+	MetricCalls             = "calls"                      // counter, the calls started
+	MetricActiveCalls       = "active_calls"               // gauge, the calls in progress
+	MetricExecutionDuration = "execution_duration_seconds" // histogram, the wall time of the calls
+	MetricGasConsumed       = "gas_consumed"               // counter, the gas consumed by the calls
+	MetricTraps             = "traps"                      // counter, the calls trapping, labeled by TrapCode
+	MetricGrownPages        = "grown_pages"                // counter, the pages added by memory.grow
+	MetricMemoryPages       = "memory_pages"               // gauge, the pages of the instances
+	MetricCacheHits         = "module_cache_hits"          // counter, the modules found in a cache
+	MetricCacheMisses       = "module_cache_misses"        // counter, the modules compiled by a cache
+)
+
+// NopMetricsSink is a MetricsSink ignoring the metrics, to embed in the
+// sinks only interested in some of them.
+type NopMetricsSink struct{}
+
+func (NopMetricsSink) Count(name, label string, n uint64) {}
+func (NopMetricsSink) Gauge(name string, delta int64)     {}
+func (NopMetricsSink) Observe(name string, value float64) {}
+
+// Metrics is a MetricsSink collecting the metrics in memory, to expose
+// them in the Prometheus text format, see WriteTo and ServeHTTP. It can
+// be shared by several configs. The metrics are prefixed by wasm_vm_, and
+// the counters suffixed by _total, like wasm_vm_traps_total{reason}.
+type Metrics struct {
+	instantiations uint64
+	calls          uint64
+	activeCalls    int64
+	// the calls by bucket of metricsBuckets, the last one being +Inf, and
+	// their total duration in nanoseconds
+	durations  [len(metricsBuckets) + 1]uint64
+	duration   uint64
+	gas        uint64
+	traps      [len(trapNames)]uint64
+	grownPages uint64
+	pages      int64
+	hits       uint64
+	misses     uint64
+}
+
+// metricsBuckets are the upper bounds of the buckets of the histogram of
+// the duration of the calls, in seconds.
+var metricsBuckets = [...]float64{
+	0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// NewMetrics returns a Metrics which collected nothing yet.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+func (m *Metrics) Count(name, label string, n uint64) {
+	switch name {
+	case MetricInstantiations:
+		atomic.AddUint64(&m.instantiations, n)
+	case MetricCalls:
+		atomic.AddUint64(&m.calls, n)
+	case MetricGasConsumed:
+		atomic.AddUint64(&m.gas, n)
+	case MetricTraps:
+		code := TrapUnknown
+		for c, name := range trapNames {
+			if name == label {
+				code = TrapCode(c)
+			}
+		}
+		atomic.AddUint64(&m.traps[code], n)
+	case MetricGrownPages:
+		atomic.AddUint64(&m.grownPages, n)
+	case MetricCacheHits:
+		atomic.AddUint64(&m.hits, n)
+	case MetricCacheMisses:
+		atomic.AddUint64(&m.misses, n)
+	}
+}
+
+func (m *Metrics) Gauge(name string, delta int64) {
+	switch name {
+	case MetricActiveCalls:
+		atomic.AddInt64(&m.activeCalls, delta)
+	case MetricMemoryPages:
+		atomic.AddInt64(&m.pages, delta)
+	}
+}
+
+func (m *Metrics) Observe(name string, value float64) {
+	if name != MetricExecutionDuration {
+		return
+	}
+	i := 0
+	for i < len(metricsBuckets) && value > metricsBuckets[i] {
+		i++
+	}
+	atomic.AddUint64(&m.durations[i], 1)
+	atomic.AddUint64(&m.duration, uint64(value*float64(time.Second)))
+}
+
+// reportMemory reports the change of the pages of inst since they were
+// last reported to the metrics sink of its config, if any. The pages of
+// a closed instance are gone.
+func (inst *Instance) reportMemory() {
+	sink := inst.compiled.config.Metrics
+	if sink == nil {
+		return
+	}
+	pages := 0
+	if !inst.closed {
+		pages = len(inst.memory) / inst.pageSize
+	}
+	if pages != inst.reportedPages {
+		sink.Gauge(MetricMemoryPages, int64(pages-inst.reportedPages))
+		inst.reportedPages = pages
+	}
+}
+
+// WriteTo writes the metrics of m to w in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	metric("wasm_vm_instantiations_total", "counter", "The number of instances created.")
+	fmt.Fprintf(bw, "wasm_vm_instantiations_total %d\n", atomic.LoadUint64(&m.instantiations))
+
+	metric("wasm_vm_calls_total", "counter", "The number of calls started.")
+	fmt.Fprintf(bw, "wasm_vm_calls_total %d\n", atomic.LoadUint64(&m.calls))
+	metric("wasm_vm_active_calls", "gauge", "The number of calls in progress.")
+	fmt.Fprintf(bw, "wasm_vm_active_calls %d\n", atomic.LoadInt64(&m.activeCalls))
+
+	metric("wasm_vm_execution_duration_seconds", "histogram", "The wall time of the calls.")
+	var count uint64
+	for i := range m.durations {
+		count += atomic.LoadUint64(&m.durations[i])
+		le := "+Inf"
+		if i < len(metricsBuckets) {
+			le = strconv.FormatFloat(metricsBuckets[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(bw, "wasm_vm_execution_duration_seconds_bucket{le=%q} %d\n", le, count)
+	}
+	sum := time.Duration(atomic.LoadUint64(&m.duration)).Seconds()
+	fmt.Fprintf(bw, "wasm_vm_execution_duration_seconds_sum %s\n", strconv.FormatFloat(sum, 'g', -1, 64))
+	fmt.Fprintf(bw, "wasm_vm_execution_duration_seconds_count %d\n", count)
+
+	metric("wasm_vm_gas_consumed_total", "counter", "The gas consumed by the calls.")
+	fmt.Fprintf(bw, "wasm_vm_gas_consumed_total %d\n", atomic.LoadUint64(&m.gas))
+
+	metric("wasm_vm_traps_total", "counter", "The number of calls trapping, by reason.")
+	for code := TrapUnknown; int(code) < len(m.traps); code++ {
+		fmt.Fprintf(bw, "wasm_vm_traps_total{reason=%q} %d\n", code, atomic.LoadUint64(&m.traps[code]))
+	}
+
+	metric("wasm_vm_grown_pages_total", "counter", "The number of pages added by memory.grow.")
+	fmt.Fprintf(bw, "wasm_vm_grown_pages_total %d\n", atomic.LoadUint64(&m.grownPages))
+	metric("wasm_vm_memory_pages", "gauge", "The pages of the linear memories of the instances.")
+	fmt.Fprintf(bw, "wasm_vm_memory_pages %d\n", atomic.LoadInt64(&m.pages))
+
+	metric("wasm_vm_module_cache_hits_total", "counter", "The number of modules found in a module cache.")
+	fmt.Fprintf(bw, "wasm_vm_module_cache_hits_total %d\n", atomic.LoadUint64(&m.hits))
+	metric("wasm_vm_module_cache_misses_total", "counter", "The number of modules compiled by a module cache.")
+	fmt.Fprintf(bw, "wasm_vm_module_cache_misses_total %d\n", atomic.LoadUint64(&m.misses))
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics of m in the Prometheus text format, for
+// m to be registered as the handler of a metrics endpoint.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,126 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	cache := NewModuleCache(VMConfig{Metrics: metrics}, nil, 2, 1<<20)
+	fac := readTestCode(t, "testdata/spec/fac.wasm")
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Load(fac); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compiled, err := cache.Load(fac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := inst.NewVM()
+	facIter := int64(compiled.module.Export.Entries["fac-iter"].Index)
+	vm.SetGasMeter(NewGasMeter(1<<20), DefaultGasSchedule())
+	if _, err := vm.ExecCode(facIter, 20); err != nil {
+		t.Fatal(err)
+	}
+	gas := vm.GasUsed()
+	vm.SetGasMeter(NewGasMeter(10), DefaultGasSchedule())
+	func() {
+		defer func() { recover() }()
+		vm.ExecCode(facIter, 20)
+	}()
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, nil)
+	want := []string{
+		"wasm_vm_instantiations_total 1",
+		`wasm_vm_execution_duration_seconds_bucket{le="+Inf"} 2`,
+		"wasm_vm_execution_duration_seconds_count 2",
+		`wasm_vm_traps_total{reason="out_of_gas"} 1`,
+		`wasm_vm_traps_total{reason="unreachable"} 0`,
+		"wasm_vm_memory_pages 1",
+		"wasm_vm_module_cache_hits_total 2",
+		"wasm_vm_module_cache_misses_total 1",
+	}
+	for _, line := range want {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("missing %q in\n%s", line, rec.Body)
+		}
+	}
+	// the failed call consumed all the gas of its meter
+	if line := fmt.Sprintf("wasm_vm_gas_consumed_total %d\n", gas+10); !strings.Contains(rec.Body.String(), line) {
+		t.Errorf("missing %q in\n%s", line, rec.Body)
+	}
+
+	inst.Close()
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	if !strings.Contains(buf.String(), "wasm_vm_memory_pages 0\n") {
+		t.Errorf("the pages of the closed instance are left:\n%s", &buf)
+	}
+}
+
+// countingSink counts the events of the counters.
+type countingSink struct {
+	NopMetricsSink
+	counts map[string]uint64
+}
+
+func (s *countingSink) Count(name, label string, n uint64) {
+	if label != "" {
+		name += "/" + label
+	}
+	s.counts[name] += n
+}
+
+func TestMetricsSink(t *testing.T) {
+	sink := &countingSink{counts: make(map[string]uint64)}
+	module := readTestModule(t, "testdata/state.wasm")
+	compiled, err := CompileModule(module, VMConfig{Metrics: sink})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	grow := int64(module.Export.Entries["grow"].Index)
+	for i := 0; i < 2; i++ {
+		if _, err := vm.ExecCode(grow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]uint64{MetricInstantiations: 1, MetricCalls: 2, MetricGrownPages: 2, MetricGasConsumed: 0}
+	for name, n := range want {
+		if sink.counts[name] != n {
+			t.Errorf("%s: got=%d, want=%d", name, sink.counts[name], n)
+		}
+	}
+}
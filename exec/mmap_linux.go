@@ -0,0 +1,63 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build linux
+
+package exec
+
+import "syscall"
+
+// mapMemory reserves the address space of a linear memory of at most
+// maxSize bytes, followed by a guard region, and commits its first size
+// bytes. Accessing the memory past the committed bytes faults. It returns
+// the whole mapping, which must be released with unmapMemory.
+func mapMemory(size, maxSize int) ([]byte, error) {
+	mapping, err := syscall.Mmap(-1, 0, maxSize+memoryGuardSize, syscall.PROT_NONE, syscall.MAP_PRIVATE|syscall.MAP_ANON|syscall.MAP_NORESERVE)
+	if err != nil {
+		return nil, err
+	}
+	if err := commitMemory(mapping, size); err != nil {
+		syscall.Munmap(mapping)
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// commitMemory makes the first size bytes of mapping accessible.
+func commitMemory(mapping []byte, size int) error {
+	if size == 0 {
+		return nil
+	}
+	return syscall.Mprotect(mapping[:size], syscall.PROT_READ|syscall.PROT_WRITE)
+}
+
+// decommitMemory returns the pages of region, a part of a mapping, to the
+// operating system, and makes them inaccessible again.
+func decommitMemory(region []byte) error {
+	if len(region) == 0 {
+		return nil
+	}
+	if err := syscall.Madvise(region, syscall.MADV_DONTNEED); err != nil {
+		return err
+	}
+	return syscall.Mprotect(region, syscall.PROT_NONE)
+}
+
+// unmapMemory releases a mapping returned by mapMemory.
+func unmapMemory(mapping []byte) error {
+	return syscall.Munmap(mapping)
+}
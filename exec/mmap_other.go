@@ -0,0 +1,40 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !linux
+
+package exec
+
+import "errors"
+
+var errMapUnsupported = errors.New("exec: mapped memories are not supported on this platform")
+
+func mapMemory(size, maxSize int) ([]byte, error) {
+	return nil, errMapUnsupported
+}
+
+func commitMemory(mapping []byte, size int) error {
+	return errMapUnsupported
+}
+
+func decommitMemory(region []byte) error {
+	return errMapUnsupported
+}
+
+func unmapMemory(mapping []byte) error {
+	return errMapUnsupported
+}
@@ -0,0 +1,56 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestMappedMemoryGrow(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/resizing.wasm")
+	vm, err := NewVMWithConfig(module, VMConfig{MappedMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm.mapping == nil {
+		t.Skip("mapped memories are not supported on this platform")
+	}
+
+	grow := int64(module.Export.Entries["grow"].Index)
+	store := int64(module.Export.Entries["store_at_page_size"].Index)
+	for i, want := range []uint32{0, 2} {
+		res, err := vm.ExecCode(grow, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.(uint32) != want {
+			t.Fatalf("grow %d: got=%d, want=%d", i, res, want)
+		}
+		if &vm.mapping[0] != &vm.memory[0] {
+			t.Fatalf("grow %d: memory was moved", i)
+		}
+	}
+	if _, err := vm.ExecCode(store); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if vm.mapping != nil || vm.memory != nil {
+		t.Error("memory wasn't released")
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"sync"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/compile"
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/native"
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// Module is a WebAssembly module whose functions have been compiled for
+// execution. Compiling a module is the expensive part of creating a VM,
+// the same Module can then be instantiated any number of times with
+// Instantiate.
+//
+// A Module is never modified once compiled, and is safe for concurrent
+// use: it can be instantiated from several goroutines at once, and its
+// instances share no mutable state, so they can execute in parallel. A
+// single Instance, and the VMs created from it, must only be used by one
+// goroutine at a time.
+type Module struct {
+	module *wasm.Module
+	config VMConfig
+	funcs  []compiledFunction
+
+	// the size of the memory that is always addressable, see
+	// VMConfig.StaticMemoryBounds
+	staticMemorySize uint64
+
+	typeIDs     []uint32
+	funcTypeIDs []uint32
+
+	// the stack usage of the functions, see StackUsage
+	stack stackAnalysis
+	// the source lines of the code, see SourceLine
+	lines lineTable
+
+	// the functions compiled on their first call, see VMConfig.LazyCompile
+	lazy []lazyFunction
+
+	// the number of global slots, whether native code may access the
+	// memory of the instances, and the functions it may call, for the AOT
+	// backend
+	globalSlots  int
+	nativeMemory bool
+	nativeFuncs  []native.Func
+
+	// the global slot of the shadow stack pointer and the lowest address
+	// of the shadow stack, see VMConfig.GuestStackCheck, the slot being
+	// -1 if unchecked
+	stackSlot  int
+	stackLimit uint32
+}
+
+// CompileModule validates, disassembles and compiles every function of
+// module, using the provided config. An invalid module is rejected with a
+// validate.Error before any of its code can run, and a module breaking
+// config.Policy with its first validate.PolicyError. With
+// config.LazyCompile, the functions are only validated and compiled on
+// their first call, see CompileAll.
+func CompileModule(module *wasm.Module, config VMConfig) (*Module, error) {
+	lazy := config.LazyCompile && !config.CheckStackUsage && !config.BlockMetering
+	if lazy {
+		if config.Policy != nil {
+			if violations := config.Policy.CheckModule(module); len(violations) != 0 {
+				return nil, violations[0]
+			}
+		}
+	} else if config.Policy != nil {
+		violations, err := validate.VerifyModuleWithPolicy(module, *config.Policy)
+		if err != nil {
+			return nil, err
+		}
+		if len(violations) != 0 {
+			return nil, violations[0]
+		}
+	} else if err := validate.VerifyModule(module); err != nil {
+		return nil, err
+	}
+	m := &Module{
+		module: module,
+		config: config,
+		funcs:  make([]compiledFunction, len(module.FunctionIndexSpace)),
+	}
+	m.typeIDs, m.funcTypeIDs = internSignatures(module)
+
+	// only the first memory may be static, if the module defines it
+	memories := module.Memories()
+	if config.StaticMemoryBounds && module.Memory != nil && len(memories) != 0 && len(memories) == len(module.Memory.Entries) {
+		limits := memories[0].Limits
+		if limits.Flags&0x1 != 0 && limits.Maximum >= limits.Initial && !limits.Memory64() {
+			m.staticMemorySize = uint64(limits.Initial) * uint64(limits.PageSize())
+		}
+	}
+
+	// native code only accesses a single 32-bit memory
+	m.nativeMemory = len(memories) <= 1
+	if limits, ok := module.MemoryLimits(); ok && limits.Memory64() {
+		m.nativeMemory = false
+	}
+	m.globalSlots = int(disasm.GlobalSlots(module)[len(module.GlobalIndexSpace)])
+	if config.AOT {
+		m.nativeFuncs = make([]native.Func, len(module.FunctionIndexSpace))
+		for i, fn := range module.FunctionIndexSpace {
+			m.nativeFuncs[i] = native.Func{Args: disasm.Slots(fn.Sig.ParamTypes...), Results: disasm.Slots(fn.Sig.ReturnTypes...)}
+		}
+	}
+	m.setGuestStack()
+
+	if lazy {
+		m.lazy = make([]lazyFunction, len(module.FunctionIndexSpace))
+		for i, fn := range module.FunctionIndexSpace {
+			m.funcs[i] = compiledFunction{
+				pending:  true,
+				args:     disasm.Slots(fn.Sig.ParamTypes...),
+				returns:  len(fn.Sig.ReturnTypes) != 0,
+				results:  disasm.Slots(fn.Sig.ReturnTypes...),
+				funcProp: fn,
+			}
+		}
+		return m, nil
+	}
+
+	disassemblies := make([]*disasm.Disassembly, len(module.FunctionIndexSpace))
+	for i := range module.FunctionIndexSpace {
+		var err error
+		if disassemblies[i], err = m.disassemble(i); err != nil {
+			return nil, err
+		}
+	}
+
+	var candidates []*compile.InlineCandidate
+	if config.InlineThreshold > 0 {
+		candidates = make([]*compile.InlineCandidate, len(module.FunctionIndexSpace))
+		for i, fn := range module.FunctionIndexSpace {
+			candidates[i] = compile.NewInlineCandidate(fn, disassemblies[i], config.InlineThreshold)
+		}
+	}
+
+	for i := range module.FunctionIndexSpace {
+		m.funcs[i] = m.compileFunction(i, disassemblies[i], candidates)
+	}
+
+	if config.CheckStackUsage {
+		if err := m.checkStackUsage(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Disassemble returns the instructions of the function of m with the given
+// index, located by their offsets in the module, see
+// disasm.DisassembleFunction.
+func (m *Module) Disassemble(index int) ([]disasm.Instruction, error) {
+	return disasm.DisassembleFunction(m.module, index)
+}
+
+// disassemble disassembles the function of m with the given index,
+// rejecting the relaxed SIMD operators unless m.config allows them.
+func (m *Module) disassemble(i int) (*disasm.Disassembly, error) {
+	disassembly, err := disasm.Disassemble(m.module.FunctionIndexSpace[i], m.module)
+	if err != nil {
+		return nil, err
+	}
+	if !m.config.RelaxedSIMD {
+		for _, instr := range disassembly.Code {
+			if instr.Op.Code == ops.PrefixSIMD && ops.IsRelaxedSIMD(instr.Op.Sub) {
+				return nil, ERR_RELAXED_SIMD
+			}
+		}
+	}
+	return disassembly, nil
+}
+
+// compileFunction compiles the function of m with the given index from its
+// disassembly, inlining the calls to candidates if it isn't nil.
+func (m *Module) compileFunction(i int, disassembly *disasm.Disassembly, candidates []*compile.InlineCandidate) compiledFunction {
+	fn := m.module.FunctionIndexSpace[i]
+
+	// the locals are laid out in slots, see disasm.Slots
+	totalLocalVars := 0
+	totalLocalVars += disasm.Slots(fn.Sig.ParamTypes...)
+	for _, entry := range fn.Body.Locals {
+		totalLocalVars += int(entry.Count) * disasm.Slots(entry.Type)
+	}
+
+	instrs := disassembly.Code
+	maxDepth := disassembly.MaxDepth
+	if results := disasm.Slots(fn.Sig.ReturnTypes...); fn.EnvFunc && maxDepth < results {
+		// the host function pushes its results on the stack of its frame
+		maxDepth = results
+	}
+	if candidates != nil {
+		var extraLocals, extraDepth int
+		instrs, extraLocals, extraDepth = compile.Inline(instrs, totalLocalVars, candidates)
+		totalLocalVars += extraLocals
+		maxDepth += extraDepth
+	}
+
+	code, meta := compile.Compile(instrs, compile.Options{
+		StaticMemorySize: m.staticMemorySize,
+		BasicBlocks:      m.config.BlockMetering,
+		Locals:           totalLocalVars,
+	})
+	// the handlers rethrowing exceptions keep them in locals
+	totalLocalVars += meta.Locals
+	compiled := compiledFunction{
+		code:           code,
+		branchTables:   meta.BranchTables,
+		callSites:      make([]callSiteCache, meta.CallIndirectSites),
+		basicBlocks:    meta.BasicBlocks,
+		handlers:       meta.Handlers,
+		sourceOffsets:  meta.SourceOffsets,
+		maxDepth:       maxDepth,
+		totalLocalVars: totalLocalVars,
+		args:           disasm.Slots(fn.Sig.ParamTypes...),
+		returns:        len(fn.Sig.ReturnTypes) != 0,
+		results:        disasm.Slots(fn.Sig.ReturnTypes...),
+		funcProp:       fn,
+	}
+
+	// native code only returns the value on the top of its stack, doesn't
+	// catch exceptions and doesn't check the stack pointer
+	if m.config.AOT && !fn.EnvFunc && compiled.results <= 1 && meta.Handlers == nil && m.nativeMemory && !m.setsStackPointer(instrs) {
+		// functions the backend can't lower are interpreted
+		if nativeCode, err := native.Compile(code, totalLocalVars, m.globalSlots, m.nativeFuncs); err == nil {
+			compiled.native = nativeCode
+		}
+	}
+	return compiled
+}
+
+// lazyFunction is a function of a module compiled on its first call, see
+// VMConfig.LazyCompile.
+type lazyFunction struct {
+	once     sync.Once
+	compiled compiledFunction
+	err      error
+}
+
+// function returns the function of m with the given index, validating and
+// compiling it first if it was left to compile on its first call.
+func (m *Module) function(i int) (compiledFunction, error) {
+	if !m.funcs[i].pending {
+		return m.funcs[i], nil
+	}
+	lazy := &m.lazy[i]
+	lazy.once.Do(func() {
+		lazy.compiled, lazy.err = m.compileLazily(i)
+	})
+	return lazy.compiled, lazy.err
+}
+
+// compileLazily validates and compiles the function of m with the given
+// index, which isn't inlined into.
+func (m *Module) compileLazily(i int) (compiledFunction, error) {
+	if m.config.Policy != nil {
+		violations, err := validate.VerifyFunctionWithPolicy(m.module, i, *m.config.Policy)
+		if err != nil {
+			return compiledFunction{}, err
+		}
+		if len(violations) != 0 {
+			return compiledFunction{}, violations[0]
+		}
+	} else if err := validate.VerifyFunction(m.module, i); err != nil {
+		return compiledFunction{}, err
+	}
+	disassembly, err := m.disassemble(i)
+	if err != nil {
+		return compiledFunction{}, err
+	}
+	return m.compileFunction(i, disassembly, nil), nil
+}
+
+// CompileAll validates and compiles the functions of m left to compile on
+// their first call by VMConfig.LazyCompile, and returns the error of the
+// function with the lowest index failing to. It does nothing for a module
+// compiled eagerly.
+func (m *Module) CompileAll() error {
+	for i := range m.funcs {
+		if _, err := m.function(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allFuncs returns the compiled functions of m, compiling the ones left to
+// compile on their first call: those failing to compile are left empty.
+func (m *Module) allFuncs() []compiledFunction {
+	if m.lazy == nil {
+		return m.funcs
+	}
+	funcs := make([]compiledFunction, len(m.funcs))
+	for i := range funcs {
+		funcs[i], _ = m.function(i)
+	}
+	return funcs
+}
+
+// Wasm returns the decoded module m was compiled from.
+func (m *Module) Wasm() *wasm.Module {
+	return m.module
+}
+
+// codeSize returns the size of the compiled code of m, the functions left
+// to compile on their first call aside.
+func (m *Module) codeSize() int {
+	size := 0
+	for _, fn := range m.funcs {
+		size += len(fn.code)
+		if fn.native != nil {
+			size += len(fn.native.MachineCode())
+		}
+	}
+	return size
+}
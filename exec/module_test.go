@@ -0,0 +1,354 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+func TestCompileModuleValidates(t *testing.T) {
+	i32, i64 := wasm.ValueTypeI32, wasm.ValueTypeI64
+	for _, tc := range []struct {
+		name    string
+		results []wasm.ValueType
+		code    []byte
+		err     error
+	}{
+		{"unreachable add", []wasm.ValueType{i32}, []byte{0x00, 0x6a}, nil},
+		{"unreachable block", []wasm.ValueType{i32}, []byte{0x02, 0x7f, 0x00, 0x0b}, nil},
+		{"unreachable select", []wasm.ValueType{i32}, []byte{0x00, 0x41, 0x01, 0x1b}, nil},
+		{"set mutable global", nil, []byte{0x41, 0x00, 0x24, 0x00}, nil},
+		{"pop parent operand", nil, []byte{0x41, 0x01, 0x02, 0x40, 0x1a, 0x0b, 0x1a}, validate.ErrStackUnderflow},
+		{"missing result", []wasm.ValueType{i32}, nil, validate.ErrStackUnderflow},
+		{"extra result", nil, []byte{0x41, 0x01}, validate.ErrStackHeight},
+		{"extra block result", nil, []byte{0x02, 0x40, 0x41, 0x01, 0x0b}, validate.ErrStackHeight},
+		{"unclosed block", nil, []byte{0x02, 0x40}, validate.ErrUnclosedBlock},
+		{"if without else", []wasm.ValueType{i32}, []byte{0x41, 0x01, 0x04, 0x7f, 0x41, 0x02, 0x0b}, validate.ErrMissingElse},
+		{"set immutable global", nil, []byte{0x41, 0x00, 0x24, 0x01}, validate.ImmutableGlobalError(1)},
+		{"unreachable mistyped", []wasm.ValueType{i32}, []byte{0x00, 0x42, 0x00}, validate.InvalidTypeError{Wanted: i32, Got: i64}},
+	} {
+		module := &wasm.Module{
+			Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{{ReturnTypes: tc.results}}},
+			Function: &wasm.SectionFunctions{Types: []uint32{0}},
+			Code:     &wasm.SectionCode{},
+			GlobalIndexSpace: []wasm.GlobalEntry{
+				{Type: &wasm.GlobalVar{Type: i32, Mutable: true}},
+				{Type: &wasm.GlobalVar{Type: i32}},
+			},
+		}
+		module.FunctionIndexSpace = []wasm.Function{
+			{Sig: &module.Types.Entries[0], Body: &wasm.FunctionBody{Code: tc.code}},
+		}
+
+		_, err := CompileModule(module, VMConfig{})
+		if tc.err == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+		if verr, ok := err.(validate.Error); !ok || !reflect.DeepEqual(verr.Err, tc.err) {
+			t.Errorf("%s: got=%v, want=%v", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestCompileModuleNamesFunctions(t *testing.T) {
+	module := stackModule([]byte{0x41, 0x01})
+	module.FunctionIndexSpace[0].Name = "leaky"
+	_, err := CompileModule(module, VMConfig{})
+	want := "error while validating function 0 (leaky) at offset 2: " + validate.ErrStackHeight.Error()
+	if err == nil || err.Error() != want {
+		t.Errorf("got=%v, want=%v", err, want)
+	}
+}
+
+func TestCompileModuleStrictLEB128(t *testing.T) {
+	// a function running i32.const 0, the immediate being padded
+	code := []byte("\x00asm\x01\x00\x00\x00" +
+		"\x01\x04\x01\x60\x00\x00" +
+		"\x03\x02\x01\x00" +
+		"\x0a\x08\x01\x06\x00\x41\x80\x00\x1a\x0b")
+	module, err := wasm.ReadModuleWithLimits(bytes.NewReader(code), nil, wasm.DecodeLimits{StrictLEB128: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CompileModule(module, VMConfig{})
+	if verr, ok := err.(validate.Error); !ok || verr.Err != leb128.ErrNonCanonical {
+		t.Errorf("got=%v, want=%v", err, leb128.ErrNonCanonical)
+	}
+}
+
+func TestCompileModulePolicy(t *testing.T) {
+	floats := []byte{0x43, 0x00, 0x00, 0x00, 0x00, 0x1a} // f32.const 0, drop
+	ints := []byte{0x41, 0x00, 0x1a}                     // i32.const 0, drop
+	for _, tc := range []struct {
+		name   string
+		code   []byte
+		memory wasm.ResizableLimits
+		policy *validate.Policy
+		err    error
+	}{
+		{"no policy", floats, wasm.ResizableLimits{Initial: 1}, nil, nil},
+		{"floats", floats, wasm.ResizableLimits{Initial: 1}, &validate.Policy{NoFloats: true},
+			validate.PolicyError{Function: 0, Offset: 0, Reason: "f32.const uses floats"}},
+		{"ints", ints, wasm.ResizableLimits{Initial: 1}, &validate.Policy{NoFloats: true}, nil},
+		{"unbounded memory", ints, wasm.ResizableLimits{Initial: 1}, &validate.Policy{MaxMemoryPages: 16},
+			validate.PolicyError{Function: -1, Offset: -1, Reason: "memory 0 may grow past 16 pages"}},
+		{"bounded memory", ints, wasm.ResizableLimits{Flags: 1, Initial: 1, Maximum: 16}, &validate.Policy{MaxMemoryPages: 16}, nil},
+	} {
+		module := &wasm.Module{
+			Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{{}}},
+			Function: &wasm.SectionFunctions{Types: []uint32{0}},
+			Memory:   &wasm.SectionMemories{Entries: []wasm.Memory{{Limits: tc.memory}}},
+			Code:     &wasm.SectionCode{},
+		}
+		module.FunctionIndexSpace = []wasm.Function{
+			{Sig: &module.Types.Entries[0], Body: &wasm.FunctionBody{Code: tc.code}},
+		}
+
+		_, err := CompileModule(module, VMConfig{Policy: tc.policy})
+		if err != tc.err {
+			t.Errorf("%s: got=%v, want=%v", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestCompileModuleFirstInvalidFunction(t *testing.T) {
+	module := &wasm.Module{
+		Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{{}}},
+		Function: &wasm.SectionFunctions{},
+		Code:     &wasm.SectionCode{},
+	}
+	for i := 0; i < 1000; i++ {
+		code := []byte{0x41, 0x00, 0x1a} // i32.const 0, drop
+		if i >= 500 && i%7 == 0 {
+			code = []byte{0x1a} // drop from an empty stack
+		}
+		module.Function.Types = append(module.Function.Types, 0)
+		module.FunctionIndexSpace = append(module.FunctionIndexSpace, wasm.Function{
+			Sig:  &module.Types.Entries[0],
+			Body: &wasm.FunctionBody{Code: code},
+		})
+	}
+
+	for n := 0; n < 10; n++ {
+		_, err := CompileModule(module, VMConfig{})
+		if verr, ok := err.(validate.Error); !ok || verr.Function != 504 {
+			t.Fatalf("got=%v, want an error in function 504", err)
+		}
+	}
+}
+
+func TestLazyCompile(t *testing.T) {
+	module := stackModule(
+		[]byte{0x10, 0x02}, // a: calls c
+		[]byte{0x41, 0x01}, // b: leaves an extra value
+		nil,                // c: does nothing
+		[]byte{0x10, 0x01}, // d: calls b
+	)
+	module.LinearMemoryIndexSpace = make([][]byte, 1)
+	if _, err := CompileModule(module, VMConfig{}); err == nil {
+		t.Fatal("compiled an invalid module")
+	}
+	m, err := CompileModule(module, VMConfig{LazyCompile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := m.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := inst.NewVM()
+	if _, err = vm.ExecCode(0); err != nil {
+		t.Fatal(err)
+	}
+	for i, pending := range []bool{false, true, false, true} {
+		if vm.compiledFuncs[i].pending != pending {
+			t.Errorf("function %d: pending=%v, want %v", i, !pending, pending)
+		}
+	}
+
+	// the invalid function fails once called
+	want := validate.Error{Offset: 2, Function: 1, Err: validate.ErrStackHeight}
+	if _, err = vm.ExecCode(1); !reflect.DeepEqual(err, want) {
+		t.Errorf("got=%v, want=%v", err, want)
+	}
+	func() {
+		defer func() {
+			if r := trapValue(recover()); !reflect.DeepEqual(r, want) {
+				t.Errorf("call: got=%v, want=%v", r, want)
+			}
+		}()
+		vm.ExecCode(3)
+	}()
+	if err = m.CompileAll(); !reflect.DeepEqual(err, want) {
+		t.Errorf("CompileAll: got=%v, want=%v", err, want)
+	}
+
+	// the functions of a valid module compile lazily to the same code
+	module = stackModule([]byte{0x10, 0x01}, []byte{0x41, 0x01, 0x1a})
+	eager, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err = CompileModule(module, VMConfig{LazyCompile: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.CompileAll(); err != nil {
+		t.Fatal(err)
+	}
+	for i, fn := range m.allFuncs() {
+		if !bytes.Equal(fn.code, eager.funcs[i].code) {
+			t.Errorf("function %d: code=%x, want %x", i, fn.code, eager.funcs[i].code)
+		}
+	}
+}
+
+func TestModuleExports(t *testing.T) {
+	i32 := wasm.ValueTypeI32
+	module := &wasm.Module{
+		Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{{}, {ParamTypes: []wasm.ValueType{i32}, ReturnTypes: []wasm.ValueType{i32}}}},
+		Function: &wasm.SectionFunctions{Types: []uint32{0, 1}},
+		Memory:   &wasm.SectionMemories{Entries: []wasm.Memory{{Limits: wasm.ResizableLimits{Initial: 1}}}},
+		Code:     &wasm.SectionCode{},
+		Export: &wasm.SectionExports{
+			Entries: map[string]wasm.ExportEntry{
+				"id":     {FieldStr: "id", Kind: wasm.ExternalFunction, Index: 1},
+				"memory": {FieldStr: "memory", Kind: wasm.ExternalMemory, Index: 0},
+			},
+			Names: []string{"memory", "id"},
+		},
+	}
+	module.FunctionIndexSpace = []wasm.Function{
+		{Sig: &module.Types.Entries[0], Body: &wasm.FunctionBody{Code: []byte{}}},
+		{Sig: &module.Types.Entries[1], Body: &wasm.FunctionBody{Code: []byte{0x20, 0x00}}},
+	}
+	module.LinearMemoryIndexSpace = make([][]byte, 1)
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Export{
+		{Name: "memory", Kind: wasm.ExternalMemory, Index: 0},
+		{Name: "id", Kind: wasm.ExternalFunction, Index: 1, Sig: &module.Types.Entries[1]},
+	}
+	if got := compiled.Exports(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v, want=%v", got, want)
+	}
+	if got, ok := compiled.Export("memory"); !ok || got != want[0] {
+		t.Errorf("memory: got=%v, %v", got, ok)
+	}
+	if _, ok := compiled.Export("missing"); ok {
+		t.Error("missing: unexpectedly found")
+	}
+
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := inst.ExportedFunctions(); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("exported functions: got=%v, want=%v", got, want[1:])
+	}
+	if _, ok := inst.ExportedFunction("memory"); ok {
+		t.Error("memory: unexpectedly found as a function")
+	}
+}
+
+func TestModuleDisassemble(t *testing.T) {
+	// a function running i32.const 5, drop, nop, its code at offset 23
+	code := []byte("\x00asm\x01\x00\x00\x00" +
+		"\x01\x04\x01\x60\x00\x00" +
+		"\x03\x02\x01\x00" +
+		"\x0a\x08\x01\x06\x00\x41\x05\x1a\x01\x0b")
+	module, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instrs, err := m.Disassemble(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		offset int64
+		name   string
+		imms   []interface{}
+	}{
+		{23, "i32.const", []interface{}{int32(5)}},
+		{25, "drop", []interface{}{}},
+		{26, "nop", []interface{}{}},
+	}
+	if len(instrs) != len(want) {
+		t.Fatalf("got %d instructions, want %d", len(instrs), len(want))
+	}
+	for i, instr := range instrs {
+		if instr.Offset != want[i].offset || instr.Op.Name != want[i].name || !reflect.DeepEqual(instr.Immediates, want[i].imms) {
+			t.Errorf("instruction %d: got=%d %s %v, want %d %s %v", i, instr.Offset, instr.Op.Name, instr.Immediates, want[i].offset, want[i].name, want[i].imms)
+		}
+	}
+	if _, err = m.Disassemble(1); err != disasm.ErrInvalidFunctionIndex {
+		t.Errorf("got=%v, want=%v", err, disasm.ErrInvalidFunctionIndex)
+	}
+}
+
+func TestModuleStats(t *testing.T) {
+	// a function exported as f, running a br_table with three targets
+	code := []byte("\x00asm\x01\x00\x00\x00" +
+		"\x01\x05\x01\x60\x01\x7f\x00" +
+		"\x03\x02\x01\x00" +
+		"\x05\x04\x01\x01\x01\x02" +
+		"\x07\x05\x01\x01f\x00\x00" +
+		"\x0a\x0e\x01\x0c\x00\x02\x40\x20\x00\x0e\x02\x00\x00\x00\x0b\x0b")
+	module, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := m.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	max := uint32(2)
+	want := &ModuleStats{
+		Functions:          1,
+		CodeSizes:          []int{10},
+		CodeSize:           10,
+		Exports:            1,
+		Memories:           []LimitsStats{{Initial: 1, Maximum: &max}},
+		MaxBrTable:         3,
+		MaxBrTableFunction: 0,
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got=%+v, want=%+v", stats, want)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"math"
+
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// The canonical NaNs, the positive quiet NaNs with an empty payload, which
+// the float operators produce with VMConfig.CanonicalNaN.
+const (
+	canonicalNaN32 = 0x7fc00000
+	canonicalNaN64 = 0x7ff8000000000000
+)
+
+// nanOps32 and nanOps64 are the scalar operators whose f32 and f64 results
+// are NaNs made up by the hardware, or carrying the payload of an operand
+// the way it does. abs, neg and copysign only change the sign bit, and
+// the loads, constants and reinterpretations keep the bits as they are.
+var (
+	nanOps32 = []byte{
+		ops.F32Add, ops.F32Sub, ops.F32Mul, ops.F32Div, ops.F32Min, ops.F32Max,
+		ops.F32Sqrt, ops.F32Ceil, ops.F32Floor, ops.F32Trunc, ops.F32Nearest,
+		ops.F32DemoteF64,
+	}
+	nanOps64 = []byte{
+		ops.F64Add, ops.F64Sub, ops.F64Mul, ops.F64Div, ops.F64Min, ops.F64Max,
+		ops.F64Sqrt, ops.F64Ceil, ops.F64Floor, ops.F64Trunc, ops.F64Nearest,
+		ops.F64PromoteF32,
+	}
+)
+
+// simdNaNLanes is the size in bytes of the lanes of the results of the SIMD
+// operators like the ones of nanOps32 and nanOps64, indexed by sub-opcode,
+// and zero for the other operators. pmin and pmax return one of their
+// operands, as a comparison does.
+var simdNaNLanes = func() (lanes [512]uint8) {
+	for _, sub := range []uint32{
+		ops.F32x4Add, ops.F32x4Sub, ops.F32x4Mul, ops.F32x4Div, ops.F32x4Min, ops.F32x4Max,
+		ops.F32x4Sqrt, ops.F32x4Ceil, ops.F32x4Floor, ops.F32x4Trunc, ops.F32x4Nearest,
+		ops.F32x4DemoteF64x2Zero, ops.F32x4RelaxedMadd, ops.F32x4RelaxedNmadd,
+		ops.F32x4RelaxedMin, ops.F32x4RelaxedMax,
+	} {
+		lanes[sub] = 4
+	}
+	for _, sub := range []uint32{
+		ops.F64x2Add, ops.F64x2Sub, ops.F64x2Mul, ops.F64x2Div, ops.F64x2Min, ops.F64x2Max,
+		ops.F64x2Sqrt, ops.F64x2Ceil, ops.F64x2Floor, ops.F64x2Trunc, ops.F64x2Nearest,
+		ops.F64x2PromoteLowF32x4, ops.F64x2RelaxedMadd, ops.F64x2RelaxedNmadd,
+		ops.F64x2RelaxedMin, ops.F64x2RelaxedMax,
+	} {
+		lanes[sub] = 8
+	}
+	return lanes
+}()
+
+// canonicalizeNaNs makes the operators of nanOps32 and nanOps64 of the
+// function table of vm canonicalize their NaN results.
+func (vm *VM) canonicalizeNaNs() {
+	for _, op := range nanOps32 {
+		run := vm.funcTable[op]
+		vm.funcTable[op] = func() {
+			run()
+			top := &vm.ctx.stack[len(vm.ctx.stack)-1]
+			*top = canonicalBits32(*top)
+		}
+	}
+	for _, op := range nanOps64 {
+		run := vm.funcTable[op]
+		vm.funcTable[op] = func() {
+			run()
+			top := &vm.ctx.stack[len(vm.ctx.stack)-1]
+			*top = canonicalBits64(*top)
+		}
+	}
+}
+
+// canonicalizeV128 canonicalizes the NaN lanes of the v128 on top of the
+// stack, whose lanes are size bytes long.
+func (vm *VM) canonicalizeV128(size uint8) {
+	stack := vm.ctx.stack[len(vm.ctx.stack)-2:]
+	for i, bits := range stack {
+		if size == 8 {
+			stack[i] = canonicalBits64(bits)
+		} else {
+			stack[i] = canonicalBits32(bits>>32)<<32 | canonicalBits32(bits&math.MaxUint32)
+		}
+	}
+}
+
+// canonicalBits32 returns the bits of the f32 whose bits are the low ones
+// of bits, replaced by the canonical NaN if it is a NaN.
+func canonicalBits32(bits uint64) uint64 {
+	if f := math.Float32frombits(uint32(bits)); f != f {
+		return canonicalNaN32
+	}
+	return bits
+}
+
+// canonicalBits64 returns bits, replaced by the canonical NaN if they are
+// the bits of a NaN f64.
+func canonicalBits64(bits uint64) uint64 {
+	if math.IsNaN(math.Float64frombits(bits)) {
+		return canonicalNaN64
+	}
+	return bits
+}
@@ -0,0 +1,77 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCanonicalNaN(t *testing.T) {
+	module := readTestModule(t, "testdata/nan.wasm")
+	compiled, err := CompileModule(module, VMConfig{CanonicalNaN: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+
+	negOne := math.Float64bits(-1)
+	for _, tc := range []struct {
+		name string
+		args []uint64
+		want interface{}
+	}{
+		{"div32", []uint64{0, 0}, uint32(canonicalNaN32)},
+		{"div32", []uint64{uint64(math.Float32bits(6)), uint64(math.Float32bits(4))}, math.Float32bits(1.5)},
+		{"add32", []uint64{0xffc00123}, uint32(canonicalNaN32)},
+		{"add32", []uint64{0x7f800001}, uint32(canonicalNaN32)},
+		// the sign of a NaN is still flipped by neg
+		{"neg32", []uint64{0x7fc00123}, uint32(0xffc00123)},
+		{"sqrt64", []uint64{negOne}, uint64(canonicalNaN64)},
+		{"add64", []uint64{0xfff8000000000123}, uint64(canonicalNaN64)},
+		{"add64", []uint64{math.Float64bits(1)}, math.Float64bits(2)},
+		{"addx4", []uint64{0xffc00001}, uint32(canonicalNaN32)},
+		{"addx4", []uint64{uint64(math.Float32bits(2))}, math.Float32bits(3)},
+	} {
+		res, err := vm.ExecCode(int64(module.Export.Entries[tc.name].Index), tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != tc.want {
+			t.Errorf("%s%#x: got=%#x, want=%#x", tc.name, tc.args, res, tc.want)
+		}
+	}
+
+	// the setting is kept by the compiled artifacts
+	data, err := compiled.CompileSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deserialized, err := DeserializeCompiled(data, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deserialized.config.CanonicalNaN {
+		t.Error("CanonicalNaN lost by the compiled artifact")
+	}
+}
@@ -59,6 +59,9 @@ func (vm *VM) i32Mul() {
 func (vm *VM) i32DivS() {
 	v2 := vm.popInt32()
 	v1 := vm.popInt32()
+	if v1 == math.MinInt32 && v2 == -1 {
+		panic(ErrIntegerOverflow)
+	}
 	vm.pushInt32(v1 / v2)
 }
 
@@ -219,6 +222,9 @@ func (vm *VM) i64Mul() {
 func (vm *VM) i64DivS() {
 	v2 := vm.popInt64()
 	v1 := vm.popInt64()
+	if v1 == math.MinInt64 && v2 == -1 {
+		panic(ErrIntegerOverflow)
+	}
 	vm.pushInt64(v1 / v2)
 }
 
@@ -345,7 +351,7 @@ func (vm *VM) i64GeU() {
 // float32 operators
 
 func (vm *VM) f32Abs() {
-	vm.pushFloat32(float32(math.Abs(float64(vm.popFloat32()))))
+	vm.pushUint32(vm.popUint32() &^ (1 << 31))
 }
 
 func (vm *VM) f32Neg() {
@@ -365,8 +371,7 @@ func (vm *VM) f32Trunc() {
 }
 
 func (vm *VM) f32Nearest() {
-	f := vm.popFloat32()
-	vm.pushFloat32(float32(int32(f + float32(math.Copysign(0.5, float64(f))))))
+	vm.pushFloat32(float32(math.RoundToEven(float64(vm.popFloat32()))))
 }
 
 func (vm *VM) f32Sqrt() {
@@ -394,15 +399,17 @@ func (vm *VM) f32Div() {
 }
 
 func (vm *VM) f32Min() {
-	vm.pushFloat32(float32(math.Min(float64(vm.popFloat32()), float64(vm.popFloat32()))))
+	vm.pushFloat32(float32(floatMin(float64(vm.popFloat32()), float64(vm.popFloat32()))))
 }
 
 func (vm *VM) f32Max() {
-	vm.pushFloat32(float32(math.Max(float64(vm.popFloat32()), float64(vm.popFloat32()))))
+	vm.pushFloat32(float32(floatMax(float64(vm.popFloat32()), float64(vm.popFloat32()))))
 }
 
 func (vm *VM) f32Copysign() {
-	vm.pushFloat32(float32(math.Copysign(float64(vm.popFloat32()), float64(vm.popFloat32()))))
+	v2 := vm.popUint32()
+	v1 := vm.popUint32()
+	vm.pushUint32(v1&^(1<<31) | v2&(1<<31))
 }
 
 func (vm *VM) f32Eq() {
@@ -460,8 +467,7 @@ func (vm *VM) f64Trunc() {
 }
 
 func (vm *VM) f64Nearest() {
-	f := vm.popFloat64()
-	vm.pushFloat64(float64(int64(f + math.Copysign(0.5, f))))
+	vm.pushFloat64(math.RoundToEven(vm.popFloat64()))
 }
 
 func (vm *VM) f64Sqrt() {
@@ -489,15 +495,34 @@ func (vm *VM) f64Div() {
 }
 
 func (vm *VM) f64Min() {
-	vm.pushFloat64(math.Min(vm.popFloat64(), vm.popFloat64()))
+	vm.pushFloat64(floatMin(vm.popFloat64(), vm.popFloat64()))
 }
 
 func (vm *VM) f64Max() {
-	vm.pushFloat64(math.Max(vm.popFloat64(), vm.popFloat64()))
+	vm.pushFloat64(floatMax(vm.popFloat64(), vm.popFloat64()))
+}
+
+// floatMin and floatMax return the minimum and the maximum of a and b, a
+// NaN if either is one, unlike math.Min and math.Max which give the
+// infinities precedence over the NaNs, -0 being less than +0.
+func floatMin(a, b float64) float64 {
+	if a != a || b != b {
+		return a + b
+	}
+	return math.Min(a, b)
+}
+
+func floatMax(a, b float64) float64 {
+	if a != a || b != b {
+		return a + b
+	}
+	return math.Max(a, b)
 }
 
 func (vm *VM) f64Copysign() {
-	vm.pushFloat64(math.Copysign(vm.popFloat64(), vm.popFloat64()))
+	v2 := vm.popFloat64()
+	v1 := vm.popFloat64()
+	vm.pushFloat64(math.Copysign(v1, v2))
 }
 
 func (vm *VM) f64Eq() {
@@ -0,0 +1,138 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wat"
+)
+
+// numericTraps is a module exporting the operators which trap on some of
+// their operands, exported under their names.
+const numericTraps = `(module
+  (func (export "unreachable") unreachable)
+  (func (export "i32.div_s") (param i32 i32) (result i32) (i32.div_s (local.get 0) (local.get 1)))
+  (func (export "i32.rem_s") (param i32 i32) (result i32) (i32.rem_s (local.get 0) (local.get 1)))
+  (func (export "i64.div_s") (param i64 i64) (result i64) (i64.div_s (local.get 0) (local.get 1)))
+  (func (export "i32.trunc_f32_s") (param f32) (result i32) (i32.trunc_f32_s (local.get 0)))
+  (func (export "i32.trunc_f32_u") (param f32) (result i32) (i32.trunc_f32_u (local.get 0)))
+  (func (export "i32.trunc_f64_s") (param f64) (result i32) (i32.trunc_f64_s (local.get 0)))
+  (func (export "i32.trunc_f64_u") (param f64) (result i32) (i32.trunc_f64_u (local.get 0)))
+  (func (export "i64.trunc_f32_s") (param f32) (result i64) (i64.trunc_f32_s (local.get 0)))
+  (func (export "i64.trunc_f32_u") (param f32) (result i64) (i64.trunc_f32_u (local.get 0)))
+  (func (export "i64.trunc_f64_s") (param f64) (result i64) (i64.trunc_f64_s (local.get 0)))
+  (func (export "i64.trunc_f64_u") (param f64) (result i64) (i64.trunc_f64_u (local.get 0))))`
+
+// numericTrapTest is a call of an export of numericTraps, and either its
+// result or the code of its trap.
+type numericTrapTest struct {
+	name string
+	args []interface{}
+	want interface{}
+	trap exec.TrapCode
+}
+
+var numericTrapTests = []numericTrapTest{
+	{name: "unreachable", trap: exec.TrapUnreachable},
+	{"i32.div_s", []interface{}{math.MinInt32, -1}, nil, exec.TrapIntegerOverflow},
+	{"i32.div_s", []interface{}{1, 0}, nil, exec.TrapIntegerDivByZero},
+	{"i32.div_s", []interface{}{math.MinInt32, 1}, uint32(1 << 31), 0},
+	{"i32.rem_s", []interface{}{math.MinInt32, -1}, uint32(0), 0},
+	{"i64.div_s", []interface{}{int64(math.MinInt64), -1}, nil, exec.TrapIntegerOverflow},
+	{"i64.div_s", []interface{}{int64(math.MinInt64), 2}, uint64(3 << 62), 0},
+
+	{"i32.trunc_f32_s", []interface{}{float32(math.NaN())}, nil, exec.TrapInvalidConversion},
+	{"i32.trunc_f32_s", []interface{}{float32(1 << 31)}, nil, exec.TrapIntegerOverflow},
+	{"i32.trunc_f32_s", []interface{}{float32(-1 << 31)}, uint32(1 << 31), 0},
+	{"i32.trunc_f32_s", []interface{}{float32(math.Inf(-1))}, nil, exec.TrapIntegerOverflow},
+	{"i32.trunc_f32_u", []interface{}{float32(-1)}, nil, exec.TrapIntegerOverflow},
+	{"i32.trunc_f32_u", []interface{}{float32(-0.9)}, uint32(0), 0},
+	{"i32.trunc_f32_u", []interface{}{float32(1 << 32)}, nil, exec.TrapIntegerOverflow},
+	{"i32.trunc_f64_s", []interface{}{math.NaN()}, nil, exec.TrapInvalidConversion},
+	{"i32.trunc_f64_s", []interface{}{-2147483648.9}, uint32(1 << 31), 0},
+	{"i32.trunc_f64_s", []interface{}{-2147483649.0}, nil, exec.TrapIntegerOverflow},
+	{"i32.trunc_f64_s", []interface{}{2147483647.9}, uint32(math.MaxInt32), 0},
+	{"i32.trunc_f64_u", []interface{}{4294967295.9}, uint32(math.MaxUint32), 0},
+	{"i32.trunc_f64_u", []interface{}{4294967296.0}, nil, exec.TrapIntegerOverflow},
+	{"i32.trunc_f64_u", []interface{}{-math.NaN()}, nil, exec.TrapInvalidConversion},
+	{"i64.trunc_f32_s", []interface{}{float32(1 << 63)}, nil, exec.TrapIntegerOverflow},
+	{"i64.trunc_f32_s", []interface{}{float32(-1 << 63)}, uint64(1 << 63), 0},
+	{"i64.trunc_f32_u", []interface{}{float32(math.NaN())}, nil, exec.TrapInvalidConversion},
+	{"i64.trunc_f32_u", []interface{}{float32(math.Inf(1))}, nil, exec.TrapIntegerOverflow},
+	{"i64.trunc_f64_s", []interface{}{9.3e18}, nil, exec.TrapIntegerOverflow},
+	{"i64.trunc_f64_s", []interface{}{-9.2e18}, uint64(math.MaxUint64 - 9.2e18 + 1), 0},
+	{"i64.trunc_f64_u", []interface{}{18446744073709549568.0}, uint64(18446744073709549568), 0},
+	{"i64.trunc_f64_u", []interface{}{18446744073709551616.0}, nil, exec.TrapIntegerOverflow},
+	{"i64.trunc_f64_u", []interface{}{math.NaN()}, nil, exec.TrapInvalidConversion},
+}
+
+// runNumericTraps runs numericTrapTests on an instance of numericTraps
+// compiled with config.
+func runNumericTraps(t *testing.T, config exec.VMConfig) {
+	t.Helper()
+	module, err := wat.Parse([]byte(numericTraps), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := exec.CompileModule(module, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	for _, test := range numericTrapTests {
+		var res []interface{}
+		var err error
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					err, _ = r.(error)
+				}
+			}()
+			res, err = inst.Call(test.name, test.args...)
+		}()
+		if code := exec.TrapCodeOf(err); code != test.trap {
+			t.Errorf("%s%v: got trap %v (%v), want %v", test.name, test.args, code, err, test.trap)
+			continue
+		}
+		if test.trap == exec.TrapNone && (len(res) != 1 || res[0] != test.want) {
+			t.Errorf("%s%v: got=%v, want=%v", test.name, test.args, res, test.want)
+		}
+	}
+}
+
+func TestNumericTraps(t *testing.T) {
+	runNumericTraps(t, exec.VMConfig{})
+}
+
+func TestNumericTrapsCanonicalNaN(t *testing.T) {
+	// the truncations of the NaNs and the floats out of range trap
+	// instead of giving the result of the conversion of the hardware,
+	// which differs between amd64 and arm64
+	runNumericTraps(t, exec.VMConfig{CanonicalNaN: true})
+}
+
+func TestNumericTrapsSoftFloat(t *testing.T) {
+	runNumericTraps(t, exec.VMConfig{SoftFloat: true})
+}
@@ -0,0 +1,188 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ParallelTx is a transaction run by a Scheduler, which reads and writes
+// the state only through store, usually set as the StateStore of the VMs
+// it runs, see SetStateStore. An error fails the transaction, whose
+// writes are discarded, and so does a trap of the VMs it runs, which is
+// returned as its error.
+type ParallelTx func(store StateStore) error
+
+// run runs tx on store, returning the trap of a VM it runs as its error.
+func (tx ParallelTx) run(store StateStore) (err error) {
+	defer RecoverTrap(&err)
+	return tx(store)
+}
+
+// ParallelResult is the outcome of the transactions run by a Scheduler.
+type ParallelResult struct {
+	// Errors are the errors of the transactions, by index, nil for the
+	// ones which succeeded.
+	Errors []error
+	// Reexecuted are the indices of the transactions run again once the
+	// transactions before them were committed, because they read the
+	// writes of one of them.
+	Reexecuted []int
+}
+
+// Scheduler runs transactions concurrently on top of a StateStore, with
+// the same outcome as if they ran one after the other in their order.
+//
+// The transactions first all run at once, by as many goroutines as the
+// scheduler has workers, against the state before them, their writes
+// being kept apart while the keys they read are recorded. Their writes
+// are then committed in their order: a transaction which read a key one
+// of the transactions before it wrote, or iterated over a range where
+// one of them wrote, conflicts with it, and is run again against the
+// state committed so far before its writes are committed. The VMs of
+// the transactions each run their own instance, so they only share the
+// state of the store.
+type Scheduler struct {
+	store   StateStore
+	workers int
+}
+
+// NewScheduler returns a scheduler running the transactions on top of
+// store, which must be safe for concurrent reads, with the given number
+// of goroutines, runtime.GOMAXPROCS if zero.
+func NewScheduler(store StateStore, workers int) *Scheduler {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &Scheduler{store: store, workers: workers}
+}
+
+// Run runs txs and commits the writes of the ones succeeding to the store
+// of s. It only returns an error if the store fails to write them.
+func (s *Scheduler) Run(txs []ParallelTx) (ParallelResult, error) {
+	result := ParallelResult{Errors: make([]error, len(txs))}
+	runs := make([]*trackingStore, len(txs))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < s.workers && w < len(txs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				runs[i] = newTrackingStore(s.store)
+				result.Errors[i] = txs[i].run(runs[i])
+			}
+		}()
+	}
+	for i := range txs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	// the keys written since the transactions first ran
+	written := make(map[storeKey]bool)
+	for i, run := range runs {
+		journal := run.journal
+		if run.conflicts(written) {
+			result.Reexecuted = append(result.Reexecuted, i)
+			journal = newStoreJournal(s.store)
+			result.Errors[i] = txs[i].run(journal)
+		}
+		if result.Errors[i] != nil {
+			continue
+		}
+		if err := journal.commit(); err != nil {
+			return result, err
+		}
+		for _, key := range journal.keys {
+			written[key] = true
+		}
+	}
+	return result, nil
+}
+
+// trackingStore is a StateStore keeping the writes of a transaction apart
+// from store, and recording the keys it reads.
+type trackingStore struct {
+	journal *storeJournal
+	reads   map[storeKey]bool
+	ranges  []storeRange
+}
+
+// storeRange is a call of Next, which read the keys of contract starting
+// with prefix from start to key, or past the last one if not found.
+type storeRange struct {
+	contract      string
+	prefix, start string
+	key           string
+	found         bool
+}
+
+func newTrackingStore(store StateStore) *trackingStore {
+	return &trackingStore{journal: newStoreJournal(store), reads: make(map[storeKey]bool)}
+}
+
+func (s *trackingStore) Get(contract string, key []byte) ([]byte, bool, error) {
+	// the keys written by the transaction don't depend on the store
+	k := storeKey{contract, string(key)}
+	if _, ok := s.journal.writes[k]; !ok {
+		s.reads[k] = true
+	}
+	return s.journal.Get(contract, key)
+}
+
+func (s *trackingStore) Set(contract string, key, value []byte) error {
+	return s.journal.Set(contract, key, value)
+}
+
+func (s *trackingStore) Remove(contract string, key []byte) error {
+	return s.journal.Remove(contract, key)
+}
+
+func (s *trackingStore) Next(contract string, prefix, start []byte) ([]byte, bool, error) {
+	key, found, err := s.journal.Next(contract, prefix, start)
+	if err == nil {
+		s.ranges = append(s.ranges, storeRange{contract, string(prefix), string(start), string(key), found})
+	}
+	return key, found, err
+}
+
+// conflicts reports whether the transaction read one of the written keys.
+func (s *trackingStore) conflicts(written map[storeKey]bool) bool {
+	if len(written) == 0 {
+		return false
+	}
+	for key := range s.reads {
+		if written[key] {
+			return true
+		}
+	}
+	for _, r := range s.ranges {
+		for key := range written {
+			if key.contract == r.contract && strings.HasPrefix(key.key, r.prefix) &&
+				key.key >= r.start && (!r.found || key.key <= r.key) {
+				return true
+			}
+		}
+	}
+	return false
+}
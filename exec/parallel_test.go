@@ -0,0 +1,206 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestScheduler(t *testing.T) {
+	// increment adds 1 to the counter at key, and fails past limit
+	increment := func(key string, limit int) ParallelTx {
+		return func(store StateStore) error {
+			v, _, err := store.Get("c", []byte(key))
+			if err != nil {
+				return err
+			}
+			n, _ := strconv.Atoi(string(v))
+			if n >= limit {
+				return errors.New("limit")
+			}
+			return store.Set("c", []byte(key), []byte(strconv.Itoa(n+1)))
+		}
+	}
+
+	// the transactions on their own keys don't conflict
+	store := memStateStore{}
+	var txs []ParallelTx
+	for i := 0; i < 16; i++ {
+		txs = append(txs, increment(fmt.Sprint("k", i), 10))
+	}
+	result, err := NewScheduler(store, 4).Run(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Reexecuted) != 0 || len(store) != 16 {
+		t.Errorf("independent: reexecuted %v, %d keys", result.Reexecuted, len(store))
+	}
+
+	// the ones on the same counter run again but the first, even the ones
+	// past the limit, which fail without writing anything
+	store = memStateStore{}
+	txs = nil
+	for i := 0; i < 8; i++ {
+		txs = append(txs, increment("n", 5))
+	}
+	result, err = NewScheduler(store, 0).Run(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(store["c/n"]); got != "5" {
+		t.Errorf("counter: got=%s, want=5", got)
+	}
+	if want := []int{1, 2, 3, 4, 5, 6, 7}; !reflect.DeepEqual(result.Reexecuted, want) {
+		t.Errorf("reexecuted: got=%v, want=%v", result.Reexecuted, want)
+	}
+	for i, err := range result.Errors {
+		if (err != nil) != (i >= 5) {
+			t.Errorf("tx %d: %v", i, err)
+		}
+	}
+
+	// iterating over a range conflicts with the keys written in it
+	store = memStateStore{"c/a1": []byte("x"), "c/b": []byte("y")}
+	var listed []string
+	list := func(prefix string) ParallelTx {
+		return func(store StateStore) error {
+			listed = nil
+			for start := ""; ; {
+				key, ok, err := store.Next("c", []byte(prefix), []byte(start))
+				if err != nil || !ok {
+					return err
+				}
+				listed = append(listed, string(key))
+				start = string(key) + "\x00"
+			}
+		}
+	}
+	write := func(key string) ParallelTx {
+		return func(store StateStore) error {
+			return store.Set("c", []byte(key), []byte("z"))
+		}
+	}
+	result, err = NewScheduler(store, 1).Run([]ParallelTx{write("a2"), write("c"), list("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{2}; !reflect.DeepEqual(result.Reexecuted, want) {
+		t.Errorf("range: reexecuted got=%v, want=%v", result.Reexecuted, want)
+	}
+	if want := []string{"a1", "a2"}; !reflect.DeepEqual(listed, want) {
+		t.Errorf("range: listed got=%v, want=%v", listed, want)
+	}
+	result, err = NewScheduler(store, 1).Run([]ParallelTx{write("c2"), list("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Reexecuted) != 0 {
+		t.Errorf("disjoint range: reexecuted %v", result.Reexecuted)
+	}
+
+	// a trap fails the transaction like an error, in the parallel run as
+	// in the serial one, and its writes are discarded
+	trap := &TrapError{Err: ErrOutOfBoundsMemoryAccess}
+	trapping := func(store StateStore) error {
+		if _, _, err := store.Get("c", []byte("t")); err != nil {
+			return err
+		}
+		if err := store.Set("c", []byte("t"), []byte("trap")); err != nil {
+			return err
+		}
+		panic(trap)
+	}
+	store = memStateStore{}
+	result, err = NewScheduler(store, 2).Run([]ParallelTx{increment("t", 10), trapping, increment("t", 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(store["c/t"]); got != "2" {
+		t.Errorf("trap: got=%s, want=2", got)
+	}
+	if result.Errors[0] != nil || result.Errors[1] != error(trap) || result.Errors[2] != nil {
+		t.Errorf("trap: errors %v", result.Errors)
+	}
+}
+
+func TestSchedulerVMs(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/storage.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnvFunc()
+	RegisterStorage(env, StorageConfig{})
+
+	// every transaction copies the value of the key of the previous one to
+	// its own key with a byte more, so that they all run again but the
+	// first
+	const key, value = 100, 200
+	var txs []ParallelTx
+	for i := 0; i < 8; i++ {
+		i := i
+		txs = append(txs, func(store StateStore) error {
+			inst, err := compiled.Instantiate(env)
+			if err != nil {
+				return err
+			}
+			defer inst.Close()
+			vm := inst.NewVM()
+			vm.SetStateStore(store)
+			mem := vm.Memory()
+			mem[key] = byte('0' + i - 1)
+			n, err := vm.ExecCode(int64(module.Export.Entries["get"].Index), key, 1, value, 8)
+			if err != nil {
+				return err
+			}
+			if int32(n.(uint32)) == STORAGE_NOT_FOUND {
+				copy(mem[value:], "v")
+				n = uint32(1)
+			}
+			mem[key] = byte('0' + i)
+			_, err = vm.ExecCode(int64(module.Export.Entries["set"].Index), key, 1, value, uint64(n.(uint32))+1)
+			return err
+		})
+	}
+	store := memStateStore{}
+	result, err := NewScheduler(store, 4).Run(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, err := range result.Errors {
+		if err != nil {
+			t.Errorf("tx %d: %v", i, err)
+		}
+	}
+	if len(result.Reexecuted) != 7 {
+		t.Errorf("reexecuted: %v", result.Reexecuted)
+	}
+	if got := string(store["/7"]); got != "v\x00\x00\x00\x00\x00\x00\x00\x00" {
+		t.Errorf("got=%q", got)
+	}
+}
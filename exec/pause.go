@@ -0,0 +1,351 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sort"
+	"sync/atomic"
+)
+
+// ErrPaused is returned by (*VM).ExecCode and (*VM).Resume when the call
+// was paused by Pause. The state of the call is then returned by
+// Continuation.
+var ErrPaused = errors.New("exec: call paused")
+
+// errPause is the value used while unwinding a call paused at a safepoint.
+var errPause = errors.New("exec: pausing")
+
+// Frame is the state of a call in progress: the index of its function,
+// the offset of its next instruction in the compiled code, and the values
+// of its locals and operand stack.
+type Frame struct {
+	Func   int64
+	PC     int64
+	Locals []uint64
+	Stack  []uint64
+}
+
+// Continuation is the state of a paused call, from which it can be resumed
+// by Resume, possibly by another VM in another process once serialized
+// with MarshalBinary. It holds the frames of the call, from the outermost
+// one, and the state of the instance the call runs in.
+type Continuation struct {
+	// the compiled code the pcs of the frames point to, see
+	// codeFingerprint
+	fingerprint [sha256.Size]byte
+
+	Frames  []Frame
+	Memory  []byte
+	Globals []uint64
+
+	memPos  uint64
+	memType map[uint64]*typeInfo
+}
+
+// Pause asks the call in progress of vm to pause at the next safepoint,
+// that is the next call or loop back-edge, for ExecCode to return
+// ErrPaused. It can be called from any goroutine. Functions compiled to
+// native code have no safepoints, and run to completion.
+func (vm *VM) Pause() {
+	atomic.StoreUint32(&vm.pausing, 1)
+}
+
+// Continuation returns the state of the last call of vm paused by Pause,
+// or nil if it wasn't paused.
+func (vm *VM) Continuation() *Continuation {
+	return vm.paused
+}
+
+// capturePause captures the state of the call whose outermost caller
+// frame is frames[base], once the call unwound to its start after pausing.
+func (vm *VM) capturePause(base int) {
+	vm.paused = vm.captureCall(base)
+	vm.paused.fingerprint = vm.compiled.codeFingerprint()
+	vm.paused.Memory = append([]byte(nil), vm.memory...)
+}
+
+// captureCall captures the state of the call whose outermost caller frame
+// is frames[base], but its memory and the fingerprint of its code: the
+// frames from the outermost one, whose innermost one is the current
+// context, and the globals of the instance.
+func (vm *VM) captureCall(base int) *Continuation {
+	c := &Continuation{
+		Globals: append([]uint64(nil), vm.globals...),
+		memPos:  vm.memPos,
+		memType: make(map[uint64]*typeInfo, len(vm.memType)),
+	}
+	for addr, info := range vm.memType {
+		copied := *info
+		c.memType[addr] = &copied
+	}
+	// the frames of the callers hold the context saved by their call, the
+	// innermost frame is the current context
+	for _, ctx := range append(vm.frames[base:len(vm.frames):len(vm.frames)], vm.ctx) {
+		c.Frames = append(c.Frames, Frame{
+			Func:   ctx.curFunc,
+			PC:     ctx.pc,
+			Locals: append([]uint64(nil), ctx.locals...),
+			Stack:  append([]uint64(nil), ctx.stack...),
+		})
+	}
+	return c
+}
+
+// Resume resumes the call captured by c, first restoring the memory and
+// globals of the instance of vm to their state in c. vm must be an
+// instance of the module the call was paused in, compiled with the same
+// configuration, otherwise ERR_CONTINUATION_MISMATCH is returned. Like a
+// new call, the resumed call starts with the full fuel of vm, and can be
+// paused again.
+func (vm *VM) Resume(c *Continuation) (interface{}, error) {
+	res, err := vm.resume(c)
+	if err != nil {
+		return nil, err
+	}
+	return vm.boxResult(c.Frames[0].Func, res)
+}
+
+func (vm *VM) resume(c *Continuation) (res uint64, err error) {
+	if vm.closed {
+		return 0, ERR_INSTANCE_CLOSED
+	}
+	if err := vm.checkContinuation(c); err != nil {
+		return 0, err
+	}
+	if len(c.Memory) > len(vm.memory) && vm.Instance.growMemory(uint32((len(c.Memory)-len(vm.memory))/vm.pageSize)) < 0 {
+		return 0, ERR_CONTINUATION_MISMATCH
+	}
+	copy(vm.memory, c.Memory)
+	vm.wroteAll()
+	copy(vm.globals, c.Globals)
+	vm.memPos = c.memPos
+	vm.memType = make(map[uint64]*typeInfo, len(c.memType))
+	for addr, info := range c.memType {
+		copied := *info
+		vm.memType[addr] = &copied
+	}
+
+	defer vm.endCall(vm.beginCall())
+	defer vm.recoverCall(len(vm.frames), &err)
+
+	// rebuild the frames, the contexts of the callers being saved like
+	// doCall does
+	base := len(vm.frames)
+	tops := make([]int, len(c.Frames))
+	depths := make([]int, len(c.Frames))
+	for i, frame := range c.Frames {
+		vm.enterCall()
+		compiled := &vm.compiledFuncs[frame.Func]
+		tops[i] = vm.valuesTop
+		depths[i] = vm.depth
+		values := vm.allocValues(compiled.maxDepth + compiled.totalLocalVars)
+		if i > 0 {
+			vm.frames = append(vm.frames, vm.ctx)
+		}
+		vm.ctx = context{
+			stack:    values[:len(frame.Stack):compiled.maxDepth],
+			locals:   values[compiled.maxDepth:],
+			code:     compiled.code,
+			pc:       frame.PC,
+			curFunc:  frame.Func,
+			gasStart: vm.meteredGas(),
+		}
+		copy(vm.ctx.stack, frame.Stack)
+		copy(vm.ctx.locals, frame.Locals)
+	}
+
+	// run the innermost frame, then return into its callers, which aren't
+	// run by interpretCatching and unwind the exceptions themselves
+	var exc *Exception
+	for i := len(c.Frames) - 1; ; i-- {
+		compiled := vm.compiledFuncs[vm.ctx.curFunc]
+		if exc == nil || vm.catch(compiled, exc) {
+			compiled, res, exc = vm.resumeFrame(compiled, tops[i])
+		}
+		if exc == nil {
+			if i == 0 {
+				return res, nil
+			}
+			vm.returnFrom(compiled, res, tops[i])
+			continue
+		}
+		if i == 0 {
+			panic(exc)
+		}
+		vm.ctx = vm.frames[base+i-1]
+		vm.frames = vm.frames[:base+i-1]
+		vm.depth = depths[i-1]
+		vm.releaseValues(tops[i])
+	}
+}
+
+// resumeFrame runs the current context of a resumed call and its tail
+// calls, recovering the exception it unwinds with.
+func (vm *VM) resumeFrame(compiled compiledFunction, top int) (_ compiledFunction, res uint64, exc *Exception) {
+	defer recoverException(&exc)
+	compiled, res = vm.tailCalls(compiled, vm.interpret(compiled), top)
+	return compiled, res, nil
+}
+
+// checkContinuation returns ERR_CONTINUATION_MISMATCH if c can't be
+// resumed by vm.
+func (vm *VM) checkContinuation(c *Continuation) error {
+	if len(c.Globals) != len(vm.globals) || len(c.Memory)%vm.pageSize != 0 ||
+		len(c.Memory) < len(vm.memory) {
+		return ERR_CONTINUATION_MISMATCH
+	}
+	return vm.checkFrames(c.fingerprint, c.Frames)
+}
+
+// checkFrames returns ERR_CONTINUATION_MISMATCH if the frames of a call
+// paused in the code with the given fingerprint can't be resumed by vm.
+func (vm *VM) checkFrames(fingerprint [sha256.Size]byte, frames []Frame) error {
+	if len(frames) == 0 || fingerprint != vm.compiled.codeFingerprint() {
+		return ERR_CONTINUATION_MISMATCH
+	}
+	for _, frame := range frames {
+		if frame.Func < 0 || int(frame.Func) >= len(vm.compiledFuncs) {
+			return ERR_CONTINUATION_MISMATCH
+		}
+		if vm.loadFunction(frame.Func) != nil {
+			return ERR_CONTINUATION_MISMATCH
+		}
+		compiled := &vm.compiledFuncs[frame.Func]
+		if compiled.funcProp.EnvFunc || frame.PC < 0 || int(frame.PC) > len(compiled.code) ||
+			len(frame.Locals) != compiled.totalLocalVars || len(frame.Stack) > compiled.maxDepth {
+			return ERR_CONTINUATION_MISMATCH
+		}
+	}
+	return nil
+}
+
+// codeFingerprint hashes the compiled code of m, which the pcs of the
+// frames of a Continuation point to.
+func (m *Module) codeFingerprint() [sha256.Size]byte {
+	w := &compiledWriter{}
+	funcs := m.allFuncs()
+	w.uint32(uint32(len(funcs)))
+	for _, fn := range funcs {
+		w.bytes(fn.code)
+		w.uint32(uint32(fn.maxDepth))
+		w.uint32(uint32(fn.totalLocalVars))
+	}
+	return sha256.Sum256(w.Bytes())
+}
+
+// A serialized continuation has the following layout:
+//
+//	magic       [4]byte  "\x00bvc"
+//	version     uint32   continuationVersion
+//	fingerprint [32]byte see codeFingerprint
+//	payload
+//
+// The payload holds the frames, followed by the memory, globals and memory
+// bookkeeping of the instance. All integers are little endian.
+const (
+	continuationMagic   = "\x00bvc"
+	continuationVersion = 1
+)
+
+// MarshalBinary encodes c, for UnmarshalBinary to read it back.
+func (c *Continuation) MarshalBinary() ([]byte, error) {
+	w := &compiledWriter{}
+	w.WriteString(continuationMagic)
+	w.uint32(continuationVersion)
+	w.Write(c.fingerprint[:])
+
+	w.frames(c.Frames)
+	w.bytes(c.Memory)
+	w.values(c.Globals)
+	w.memType(c.memPos, c.memType)
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a continuation encoded by MarshalBinary.
+func (c *Continuation) UnmarshalBinary(data []byte) error {
+	r := &compiledReader{data: data}
+	if string(r.next(4)) != continuationMagic || r.uint32() != continuationVersion {
+		return ERR_CONTINUATION_FORMAT
+	}
+	copy(c.fingerprint[:], r.next(sha256.Size))
+
+	c.Frames = r.frames()
+	c.Memory = append([]byte(nil), r.bytes()...)
+	c.Globals = r.values()
+	c.memPos, c.memType = r.memType()
+	if r.err != nil || len(r.data) != 0 {
+		return ERR_CONTINUATION_FORMAT
+	}
+	return nil
+}
+
+// frames writes the frames of a paused call.
+func (w *compiledWriter) frames(frames []Frame) {
+	w.uint32(uint32(len(frames)))
+	for _, frame := range frames {
+		w.uint64(uint64(frame.Func))
+		w.uint64(uint64(frame.PC))
+		w.values(frame.Locals)
+		w.values(frame.Stack)
+	}
+}
+
+// memType writes the memory bookkeeping of an instance, sorted by address.
+func (w *compiledWriter) memType(memPos uint64, memType map[uint64]*typeInfo) {
+	w.uint64(memPos)
+	addrs := make([]uint64, 0, len(memType))
+	for addr := range memType {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	w.uint32(uint32(len(addrs)))
+	for _, addr := range addrs {
+		w.uint64(addr)
+		w.uint64(uint64(memType[addr].Type))
+		w.uint64(memType[addr].Len)
+	}
+}
+
+// frames reads the frames written by (*compiledWriter).frames.
+func (r *compiledReader) frames() []Frame {
+	// every frame takes at least 24 bytes
+	frames := make([]Frame, r.count(24))
+	for i := range frames {
+		frames[i] = Frame{
+			Func:   int64(r.uint64()),
+			PC:     int64(r.uint64()),
+			Locals: r.values(),
+			Stack:  r.values(),
+		}
+	}
+	return frames
+}
+
+// memType reads the memory bookkeeping written by
+// (*compiledWriter).memType.
+func (r *compiledReader) memType() (uint64, map[uint64]*typeInfo) {
+	memPos := r.uint64()
+	memType := make(map[uint64]*typeInfo)
+	for i, n := 0, r.count(24); i < n; i++ {
+		addr := r.uint64()
+		memType[addr] = &typeInfo{Type: Type(r.uint64()), Len: r.uint64()}
+	}
+	return memPos, memType
+}
@@ -0,0 +1,105 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestPauseResume(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+
+	for _, test := range []struct {
+		name string
+		aot  bool
+	}{
+		{"fac-iter", false},
+		{"fac-rec", false},
+		{"fac-opt", false},
+		// the native callers are resumed by the interpreter
+		{"fac-rec", true},
+	} {
+		name := test.name
+		fn := int64(module.Export.Entries[name].Index)
+		vms := make([]*VM, 2)
+		for i := range vms {
+			vm, err := NewVMWithConfig(module, VMConfig{AOT: test.aot})
+			if err != nil {
+				t.Fatal(err)
+			}
+			vms[i] = vm
+		}
+		want, err := vms[0].ExecCode(fn, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// pause at every safepoint, resuming the call in the other VM from
+		// a serialized continuation
+		vms[0].Pause()
+		res, err := vms[0].ExecCode(fn, 20)
+		pauses := 0
+		for ; err == ErrPaused; pauses++ {
+			data, err := vms[pauses%2].Continuation().MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &Continuation{}
+			if err = c.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			vm := vms[(pauses+1)%2]
+			vm.Pause()
+			res, err = vm.Resume(c)
+			if err != ErrPaused && err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if err == nil {
+				break
+			}
+		}
+		if res != want {
+			t.Errorf("%s: unexpected result: got=%v, want=%v", name, res, want)
+		}
+		if pauses < 10 {
+			t.Errorf("%s: the call only paused %d times", name, pauses)
+		}
+	}
+}
+
+func TestResumeMismatch(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	vm, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.Pause()
+	if _, err = vm.ExecCode(int64(module.Export.Entries["fac-iter"].Index), 20); err != ErrPaused {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := vm.Continuation()
+
+	other, err := NewVM(readTestModule(t, "testdata/spec/loop.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.Resume(c); err != ERR_CONTINUATION_MISMATCH {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err = (&Continuation{}).UnmarshalBinary([]byte("\x00bvc")); err != ERR_CONTINUATION_FORMAT {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "sync"
+
+// InstancePool keeps instances of a Module for reuse across calls. An
+// instance is reset when it is returned to the pool, so that the next
+// call gets it in its freshly instantiated state without allocating a
+// new linear memory. It is safe for concurrent use.
+type InstancePool struct {
+	module  *Module
+	imports *EnvFunc
+	max     int
+
+	mu   sync.Mutex
+	free []*Instance
+}
+
+// NewInstancePool returns a pool of instances of module, resolving their
+// imports with imports as Instantiate does. At most max idle instances
+// are kept.
+func NewInstancePool(module *Module, imports *EnvFunc, max int) *InstancePool {
+	return &InstancePool{
+		module:  module,
+		imports: imports,
+		max:     max,
+	}
+}
+
+// Get returns an idle instance from the pool, or instantiates the module
+// when there is none.
+func (p *InstancePool) Get() (*Instance, error) {
+	p.mu.Lock()
+	if n := len(p.free); n != 0 {
+		inst := p.free[n-1]
+		p.free[n-1] = nil
+		p.free = p.free[:n-1]
+		p.mu.Unlock()
+		return inst, nil
+	}
+	p.mu.Unlock()
+
+	return p.module.Instantiate(p.imports)
+}
+
+// Put resets inst and returns it to the pool. inst must have been
+// returned by Get, and must not be used anymore by the caller. Instances
+// that can't be reset, or that exceed the pool size, are closed.
+func (p *InstancePool) Put(inst *Instance) {
+	if inst.compiled != p.module {
+		return
+	}
+	if err := inst.Reset(); err != nil {
+		inst.Close()
+		return
+	}
+
+	p.mu.Lock()
+	if len(p.free) < p.max {
+		p.free = append(p.free, inst)
+		inst = nil
+	}
+	p.mu.Unlock()
+
+	if inst != nil {
+		inst.Close()
+	}
+}
+
+// Len returns the number of idle instances in the pool.
+func (p *InstancePool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.free)
+}
@@ -0,0 +1,71 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestInstancePool(t *testing.T) {
+	compiled, err := CompileModule(readTestModule(t, "testdata/spec/globals.wasm"), VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const getX, setX = 2, 4
+	pool := NewInstancePool(compiled, nil, 1)
+	inst, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inst.NewVM().ExecCode(setX, 7); err != nil {
+		t.Fatal(err)
+	}
+	inst.Memory()[0] = 0xff
+	memory := inst.Memory()
+	pool.Put(inst)
+
+	reused, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused != inst {
+		t.Fatal("instance wasn't reused")
+	}
+	if &reused.Memory()[0] != &memory[0] {
+		t.Error("memory was reallocated")
+	}
+	if reused.Memory()[0] != 0 {
+		t.Error("memory wasn't reset")
+	}
+	x, err := reused.NewVM().ExecCode(getX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.(uint32) != uint32(0xfffffff4) { // -12
+		t.Errorf("global wasn't reset: got=%d", x)
+	}
+
+	other, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Put(reused)
+	pool.Put(other)
+	if pool.Len() != 1 {
+		t.Errorf("pool exceeds its size: %d", pool.Len())
+	}
+}
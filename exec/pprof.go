@@ -0,0 +1,192 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+)
+
+// WriteProfile writes the samples of s to w as a gzipped pprof profile,
+// see https://github.com/google/pprof/blob/main/proto/profile.proto. Each
+// sample counts once, and for the interval of s in wall time. The
+// locations are the instructions of the frames, their address being their
+// offset in the module, mapped to their source lines if the module has line
+// information, see (*Module).SourceLine. The functions are
+// named after the name section, demangled, and the host functions after
+// their method. It must be called once s is stopped.
+func (s *Sampler) WriteProfile(w io.Writer) error {
+	p := &pprofBuilder{
+		vm:        s.vm,
+		strings:   map[string]int64{"": 0},
+		strs:      []string{""},
+		locations: make(map[sampledFrame]uint64),
+		functions: make(map[int64]uint64),
+	}
+	var samples, profile protoBuffer
+	profile.message(1, p.valueType("samples", "count"))
+	profile.message(1, p.valueType("wall", "nanoseconds"))
+	period := p.valueType("wall", "nanoseconds")
+	for _, key := range s.keys {
+		sample := s.samples[key]
+		var ids []uint64
+		for _, frame := range sample.frames {
+			ids = append(ids, p.location(frame))
+		}
+		var msg protoBuffer
+		msg.packed(1, ids)
+		msg.packed(2, []uint64{uint64(sample.count), uint64(sample.count * int64(s.interval))})
+		samples.message(2, &msg)
+	}
+	profile.Write(samples.buf)
+	for _, loc := range p.locs {
+		profile.message(4, &loc)
+	}
+	for _, fn := range p.funcs {
+		profile.message(5, &fn)
+	}
+	for _, str := range p.strs {
+		profile.bytes(6, []byte(str))
+	}
+	profile.varint(9, uint64(s.start.UnixNano()))
+	profile.varint(10, uint64(s.duration))
+	profile.message(11, period)
+	profile.varint(12, uint64(s.interval))
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(profile.buf); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// pprofBuilder builds the locations, functions and string table of a
+// pprof profile, whose ids start at 1.
+type pprofBuilder struct {
+	vm        *VM
+	strings   map[string]int64
+	strs      []string
+	locations map[sampledFrame]uint64
+	locs      []protoBuffer
+	functions map[int64]uint64
+	funcs     []protoBuffer
+}
+
+// str returns the index of str in the string table.
+func (p *pprofBuilder) str(str string) int64 {
+	i, ok := p.strings[str]
+	if !ok {
+		i = int64(len(p.strs))
+		p.strings[str] = i
+		p.strs = append(p.strs, str)
+	}
+	return i
+}
+
+func (p *pprofBuilder) valueType(typ, unit string) *protoBuffer {
+	var msg protoBuffer
+	msg.varint(1, uint64(p.str(typ)))
+	msg.varint(2, uint64(p.str(unit)))
+	return &msg
+}
+
+// location returns the id of the location of frame, adding it first.
+func (p *pprofBuilder) location(frame sampledFrame) uint64 {
+	if id, ok := p.locations[frame]; ok {
+		return id
+	}
+	id := uint64(len(p.locs) + 1)
+	p.locations[frame] = id
+	var file string
+	var line int64
+	if frame.offset >= 0 {
+		if table := p.vm.compiled.lineTable(); table != nil {
+			if l, ok := table.Lookup(frame.offset); ok {
+				file, line = l.File, int64(l.Line)
+			}
+		}
+	}
+	var loc, ln protoBuffer
+	loc.varint(1, id)
+	if frame.offset >= 0 {
+		loc.varint(3, uint64(frame.offset))
+	}
+	ln.varint(1, p.function(frame.fn, file))
+	ln.varint(2, uint64(line))
+	loc.message(4, &ln)
+	p.locs = append(p.locs, loc)
+	return id
+}
+
+// function returns the id of the function with the given index, adding it
+// first with the source file of its first location.
+func (p *pprofBuilder) function(fn int64, file string) uint64 {
+	if id, ok := p.functions[fn]; ok {
+		return id
+	}
+	id := uint64(len(p.funcs) + 1)
+	p.functions[fn] = id
+	var msg protoBuffer
+	msg.varint(1, id)
+	msg.varint(2, uint64(p.str(p.vm.frameName(fn))))
+	msg.varint(4, uint64(p.str(file)))
+	p.funcs = append(p.funcs, msg)
+	return id
+}
+
+// protoBuffer encodes a protocol buffers message.
+type protoBuffer struct {
+	buf []byte
+}
+
+func (b *protoBuffer) Write(data []byte) {
+	b.buf = append(b.buf, data...)
+}
+
+func (b *protoBuffer) key(field, wireType int) {
+	b.buf = binary.AppendUvarint(b.buf, uint64(field<<3|wireType))
+}
+
+// varint encodes an integer field, left out if it is zero.
+func (b *protoBuffer) varint(field int, v uint64) {
+	if v != 0 {
+		b.key(field, 0)
+		b.buf = binary.AppendUvarint(b.buf, v)
+	}
+}
+
+// bytes encodes a string, bytes or message field.
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, 2)
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(data)))
+	b.buf = append(b.buf, data...)
+}
+
+func (b *protoBuffer) message(field int, msg *protoBuffer) {
+	b.bytes(field, msg.buf)
+}
+
+// packed encodes a packed repeated integer field.
+func (b *protoBuffer) packed(field int, values []uint64) {
+	var data []byte
+	for _, v := range values {
+		data = binary.AppendUvarint(data, v)
+	}
+	b.bytes(field, data)
+}
@@ -0,0 +1,127 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"time"
+
+	"github.com/bottos-project/bottos/vm/wasm/demangle"
+)
+
+// FunctionProfile is the profile of a function of a VM, see
+// (*VM).EnableProfiling.
+type FunctionProfile struct {
+	// Func is the index of the function, and Name its demangled name in
+	// the name section, or the method of a host function.
+	Func int64
+	Name string
+	// Calls is the number of times the function was called, and
+	// Instructions the number of its instructions that ran, those inlined
+	// into it counting once, at their call.
+	Calls        uint64
+	Instructions uint64
+	// Time is the wall time spent running the function, its callees
+	// excluded, if the profile is timed.
+	Time time.Duration
+}
+
+// profile is the profile of the functions of a VM.
+type profile struct {
+	timed bool
+	funcs []FunctionProfile
+	// the time spent in the callees of the timed calls in progress, from
+	// the outermost one
+	callees []time.Duration
+}
+
+// EnableProfiling starts counting the calls and instructions of each
+// function run by the following calls of vm, and the wall time they take
+// if timed, until DisableProfiling, for Profile to return them. The counts
+// add up to the ones of the previous profiling, until ResetProfile.
+//
+// Like for SetDebugHook, functions compiled to native code are
+// interpreted while profiling. Timing costs two reads of the clock per
+// function call.
+func (vm *VM) EnableProfiling(timed bool) {
+	if vm.profiled == nil {
+		vm.profiled = &profile{funcs: make([]FunctionProfile, len(vm.compiledFuncs))}
+	}
+	vm.profile = vm.profiled
+	vm.profile.timed = timed
+	vm.setHooked()
+}
+
+// DisableProfiling stops profiling the calls of vm, keeping their profile.
+func (vm *VM) DisableProfiling() {
+	vm.profile = nil
+	vm.setHooked()
+}
+
+// ResetProfile forgets the profile of the previous calls of vm.
+func (vm *VM) ResetProfile() {
+	if vm.profiled != nil {
+		vm.profiled.funcs = make([]FunctionProfile, len(vm.compiledFuncs))
+	}
+}
+
+// Profile returns the profile of the functions called by vm since
+// profiling was first enabled, or reset, in the order of their indices.
+// The functions which weren't called are left out.
+func (vm *VM) Profile() []FunctionProfile {
+	if vm.profiled == nil {
+		return nil
+	}
+	var funcs []FunctionProfile
+	for i, f := range vm.profiled.funcs {
+		if f.Calls == 0 {
+			continue
+		}
+		f.Func = int64(i)
+		if compiled := &vm.compiledFuncs[i]; compiled.funcProp.EnvFunc {
+			f.Name = compiled.funcProp.Method
+		} else {
+			f.Name = demangle.Demangle(vm.funcName(int64(i)))
+		}
+		funcs = append(funcs, f)
+	}
+	return funcs
+}
+
+// runProfiled runs compiled like runFunction, counting its call in the
+// profile of vm, and timing it if the profile is timed.
+func (vm *VM) runProfiled(compiled compiledFunction) (uint64, error) {
+	p := vm.profile
+	f := &p.funcs[vm.ctx.curFunc]
+	f.Calls++
+	if !p.timed {
+		return vm.runCode(compiled)
+	}
+	n := len(p.callees)
+	p.callees = append(p.callees, 0)
+	start := time.Now()
+	defer func() {
+		// the time of a call which traps counts too
+		elapsed := time.Since(start)
+		f.Time += elapsed - p.callees[n]
+		p.callees = p.callees[:n]
+		if n > 0 {
+			p.callees[n-1] += elapsed
+		}
+	}()
+	return vm.runCode(compiled)
+}
@@ -0,0 +1,92 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestProfile(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/calltrace.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := NewEnvFunc()
+	imports.Register("oracle", func(vm *VM) (bool, error) {
+		vm.SetFuncResult(vm.GetFuncParams()[0] + 1)
+		return true, nil
+	})
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	run := int64(module.Export.Entries["run"].Index)
+
+	if vm.Profile() != nil {
+		t.Fatal("got a profile before profiling")
+	}
+	vm.EnableProfiling(true)
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := vm.ExecCode(run, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := time.Since(start)
+	vm.DisableProfiling()
+	vm.ExecCode(run, 3)
+
+	// run calls oracle and twice, which calls double twice
+	profile := vm.Profile()
+	wantCalls := []uint64{2, 4, 2, 2}
+	if len(profile) != len(wantCalls) {
+		t.Fatalf("unexpected profile: %+v", profile)
+	}
+	var total time.Duration
+	for i, f := range profile {
+		if f.Func != int64(i) || f.Calls != wantCalls[i] {
+			t.Errorf("unexpected profile of function %d: %+v", i, f)
+		}
+		total += f.Time
+	}
+	if profile[0].Name != "oracle" || profile[0].Instructions != 0 {
+		t.Errorf("unexpected host function profile: %+v", profile[0])
+	}
+	// double runs the same instructions on each call
+	if n := profile[1].Instructions; n < 3*4 || n%4 != 0 {
+		t.Errorf("double ran %d instructions", n)
+	}
+	if total == 0 || total > elapsed {
+		t.Errorf("got=%v of calls, in %v", total, elapsed)
+	}
+
+	vm.ResetProfile()
+	if profile := vm.Profile(); profile != nil {
+		t.Errorf("unexpected profile: %+v", profile)
+	}
+}
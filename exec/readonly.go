@@ -0,0 +1,88 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import "fmt"
+
+// ErrReadOnlyMemory is the error value matched by the ReadOnlyMemoryError
+// of the writes to the read-only ranges of a memory.
+var ErrReadOnlyMemory = newTrap(TrapReadOnlyMemory, "exec: write to read-only memory")
+
+// MemoryRange is a range of bytes of a linear memory.
+type MemoryRange struct {
+	Memory uint32 // The index of the memory
+	Addr   uint64
+	Size   uint64
+}
+
+// ReadOnlyMemoryError is the error value used while trapping the VM when
+// an instruction writes to a read-only range of a memory, see
+// SetReadOnlyMemory. It matches ErrReadOnlyMemory with errors.Is.
+type ReadOnlyMemoryError struct {
+	Range  MemoryRange
+	Access MemoryAccess
+}
+
+func (e *ReadOnlyMemoryError) Error() string {
+	return fmt.Sprintf("%v: address %d, size %d, in range [%d, %d) of memory %d, in function %d at offset %d",
+		ErrReadOnlyMemory, e.Access.Addr, e.Access.Size, e.Range.Addr, e.Range.Addr+e.Range.Size, e.Range.Memory, e.Access.Func, e.Access.Offset)
+}
+
+// Is reports whether target is ErrReadOnlyMemory.
+func (e *ReadOnlyMemoryError) Is(target error) bool {
+	return target == ErrReadOnlyMemory
+}
+
+// TrapCode returns TrapReadOnlyMemory.
+func (e *ReadOnlyMemoryError) TrapCode() TrapCode { return TrapReadOnlyMemory }
+
+// SetReadOnlyMemory makes the given ranges of the memories of vm
+// read-only for the module, replacing the ranges set before: the
+// instructions writing to them, including the bulk memory and atomic
+// operators, trap with a ReadOnlyMemoryError, for instance to keep the
+// input of a call the host wrote to the memory immutable, or to catch the
+// bugs of a contract. The host functions can still write to the ranges.
+// No ranges make the whole memory writable again.
+//
+// The writes are checked before each instruction, like the watchpoints,
+// see SetWatchFunc: functions compiled to native code are interpreted
+// while vm has read-only ranges. Since the instructions inlined into a
+// function can't be checked, SetReadOnlyMemory returns
+// ERR_READ_ONLY_INLINED for a module compiled with
+// VMConfig.InlineThreshold.
+func (vm *VM) SetReadOnlyMemory(ranges ...MemoryRange) error {
+	if len(ranges) != 0 && vm.config.InlineThreshold != 0 {
+		return ERR_READ_ONLY_INLINED
+	}
+	vm.readOnly = nil
+	for _, r := range ranges {
+		if r.Size != 0 {
+			vm.readOnly = append(vm.readOnly, r)
+		}
+	}
+	vm.setHooked()
+	return nil
+}
+
+// checkReadOnly traps the write access if it touches a read-only range.
+func (vm *VM) checkReadOnly(access MemoryAccess) {
+	for _, r := range vm.readOnly {
+		if r.Memory == access.Memory && access.Size != 0 && access.Addr < r.Addr+r.Size && r.Addr < access.Addr+access.Size {
+			panic(&ReadOnlyMemoryError{Range: r, Access: access})
+		}
+	}
+}
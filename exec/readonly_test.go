@@ -0,0 +1,111 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadOnlyMemory(t *testing.T) {
+	for _, config := range []VMConfig{{}, {AOT: true}} {
+		compiled, err := CompileModule(readTestModule(t, "testdata/guest-abi.wasm"), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inst, err := compiled.Instantiate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer inst.Close()
+		vm := inst.NewVM()
+		iota, _ := vm.ExportedFunction("iota")
+
+		// iota allocates from 1024 on, 8 bytes aligned, and writes its bytes one
+		// by one
+		if err := vm.SetReadOnlyMemory(MemoryRange{Addr: 1034, Size: 2}, MemoryRange{Memory: 1, Addr: 0, Size: 1 << 16}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := vm.ExecCode(int64(iota.Index), 6); err != nil {
+			t.Fatalf("write below the range: %v", err)
+		}
+		trapped := func() (err error) {
+			defer func() { err, _ = recover().(error) }()
+			vm.ExecCode(int64(iota.Index), 8)
+			return nil
+		}()
+		var roErr *ReadOnlyMemoryError
+		if !errors.As(trapped, &roErr) || !errors.Is(trapped, ErrReadOnlyMemory) || TrapCodeOf(trapped) != TrapReadOnlyMemory {
+			t.Fatalf("write to the range: got=%v", trapped)
+		}
+		if roErr.Access.Addr != 1034 || roErr.Access.Size != 1 || roErr.Range.Addr != 1034 {
+			t.Errorf("write to the range: got=%+v", roErr)
+		}
+		if v, _ := vm.LinearMemory().ReadUint16(1034); v != 0 {
+			t.Errorf("the read-only range was written: %#x", v)
+		}
+
+		// the host can still write to the range
+		if err := vm.LinearMemory().WriteUint16(1034, 0xbeef); err != nil {
+			t.Fatal(err)
+		}
+		vm.SetReadOnlyMemory()
+		if _, err := vm.ExecCode(int64(iota.Index), 8); err != nil {
+			t.Fatalf("write once writable again: %v", err)
+		}
+	}
+
+	compiled, err := CompileModule(readTestModule(t, "testdata/guest-abi.wasm"), VMConfig{InlineThreshold: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	if err := inst.NewVM().SetReadOnlyMemory(MemoryRange{Size: 1}); err != ERR_READ_ONLY_INLINED {
+		t.Errorf("read-only memory with inlining: got=%v", err)
+	}
+}
+
+func TestReadOnlyMemoryBulk(t *testing.T) {
+	module := readTestModule(t, "testdata/dwarf.wasm")
+	vm, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill := int64(module.Export.Entries["fill"].Index)
+	vm.SetReadOnlyMemory(MemoryRange{Addr: 100, Size: 4})
+	for _, tc := range []struct {
+		args    []uint64
+		trapped bool
+	}{
+		{[]uint64{90, 10}, false},
+		{[]uint64{103, 8}, true},
+		{[]uint64{102, 0}, false},
+	} {
+		err := func() (err error) {
+			defer func() { err, _ = recover().(error) }()
+			_, err = vm.ExecCode(fill, tc.args...)
+			return err
+		}()
+		if trapped := errors.Is(err, ErrReadOnlyMemory); trapped != tc.trapped {
+			t.Errorf("fill%v: got=%v", tc.args, err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "encoding/binary"
+
+// Receipt is the outcome of a call of a VM, in a form every node running
+// the same call agrees on, for explorers and indexers to rely on: see
+// CollectReceipts, and MarshalBinary for its serialized form. It holds no
+// error message, which may change from a version of the VM to another,
+// but its TrapCode.
+type Receipt struct {
+	// Status is TrapNone if the call succeeded, or its TrapCode.
+	Status  TrapCode
+	GasUsed uint64
+	// ReturnData holds the results of the call, 8 little endian bytes
+	// every value, see ExecCodeRaw.
+	ReturnData []byte
+	// Events are the events emitted by a successful call, see
+	// RegisterEvents.
+	Events []Event
+	// Calls are the contract calls made by the call, see
+	// ContractCaller, in the order they started.
+	Calls []CallSummary
+}
+
+// CallSummary is a contract call made by a call, see Receipt. The calls
+// failing are summarized as well, along with the calls they made, even
+// though their effects are rolled back.
+type CallSummary struct {
+	Contract string
+	Method   string
+	// Depth is the nesting of the call, 1 for the calls made by the call
+	// of the receipt.
+	Depth int
+	// Status is TrapNone if the call succeeded, or its TrapCode.
+	Status     TrapCode
+	GasUsed    uint64
+	ReturnData []byte
+}
+
+// receiptLog holds the receipt of the last call of a VM, and the contract
+// calls of its current call, shared with the VMs of the contracts it
+// calls.
+type receiptLog struct {
+	collect bool
+	receipt *Receipt
+	calls   []CallSummary
+}
+
+// CollectReceipts sets whether the following calls of vm made by ExecCode
+// or ExecCodeRaw record a Receipt, returned by Receipt once each call is
+// done. The events of the calls are collected as well, see CollectEvents.
+func (vm *VM) CollectReceipts(enable bool) {
+	if vm.receipts == nil {
+		vm.receipts = &receiptLog{}
+	}
+	vm.receipts.collect = enable
+	if enable {
+		vm.CollectEvents(true)
+	}
+}
+
+// Receipt returns the receipt of the last call of vm, if it was
+// collected, see CollectReceipts. A call trapping has a receipt too.
+func (vm *VM) Receipt() *Receipt {
+	if vm.receipts == nil || !vm.receipts.collect {
+		return nil
+	}
+	return vm.receipts.receipt
+}
+
+// recordReceipt records the receipt of the call of the function with the
+// given index, whose result and error are given, or the trap it unwinds
+// with. It must be deferred by ExecCodeRaw, to run once the call ended.
+func (vm *VM) recordReceipt(fnIndex int64, res *uint64, err *error) {
+	r := recover()
+	l := vm.receipts
+	receipt := &Receipt{Status: TrapCodeOf(*err), GasUsed: vm.gasUsed, Calls: l.calls}
+	if r != nil {
+		receipt.Status = TrapCodeOf(r)
+	}
+	if receipt.Status == TrapNone {
+		for _, v := range vm.resultValues(fnIndex, *res) {
+			receipt.ReturnData = binary.LittleEndian.AppendUint64(receipt.ReturnData, v)
+		}
+		receipt.Events = vm.Events()
+	}
+	l.receipt, l.calls = receipt, nil
+	if r != nil {
+		panic(r)
+	}
+}
+
+// beginCall summarizes a contract call starting, and returns its index in
+// the calls of l.
+func (l *receiptLog) beginCall(addr, method string, depth int) int {
+	l.calls = append(l.calls, CallSummary{Contract: addr, Method: method, Depth: depth})
+	return len(l.calls) - 1
+}
+
+// endCall completes the summary of the call at index i of the calls of l,
+// once it returned res or err, having used the given gas.
+func (l *receiptLog) endCall(i int, res *[]byte, err *error, gasUsed *uint64) {
+	call := &l.calls[i]
+	call.Status, call.GasUsed = TrapCodeOf(*err), *gasUsed
+	if *err == nil {
+		call.ReturnData = append([]byte(nil), *res...)
+	}
+}
+
+// A serialized receipt has the following layout:
+//
+//	magic   [4]byte "\x00bvr"
+//	version uint32  receiptVersion
+//	payload
+//
+// The payload holds the status, gas used and return data of the call,
+// followed by its events, each with its contract, topic and data, and by
+// its contract calls, each with its contract, method, depth, status, gas
+// used and return data. Strings and byte slices are prefixed with their
+// length, and lists with their number of elements. All integers are
+// little endian.
+const (
+	receiptMagic   = "\x00bvr"
+	receiptVersion = 1
+)
+
+// MarshalBinary encodes r, for UnmarshalBinary to read it back. Receipts
+// with the same contents have the same encoding.
+func (r *Receipt) MarshalBinary() ([]byte, error) {
+	w := &compiledWriter{}
+	w.WriteString(receiptMagic)
+	w.uint32(receiptVersion)
+
+	w.uint32(uint32(r.Status))
+	w.uint64(r.GasUsed)
+	w.bytes(r.ReturnData)
+	w.uint32(uint32(len(r.Events)))
+	for _, e := range r.Events {
+		w.bytes([]byte(e.Contract))
+		w.bytes([]byte(e.Topic))
+		w.bytes(e.Data)
+	}
+	w.uint32(uint32(len(r.Calls)))
+	for _, call := range r.Calls {
+		w.bytes([]byte(call.Contract))
+		w.bytes([]byte(call.Method))
+		w.uint32(uint32(call.Depth))
+		w.uint32(uint32(call.Status))
+		w.uint64(call.GasUsed)
+		w.bytes(call.ReturnData)
+	}
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a receipt encoded by MarshalBinary. It returns
+// ERR_RECEIPT_FORMAT for invalid data.
+func (r *Receipt) UnmarshalBinary(data []byte) error {
+	rd := &compiledReader{data: data}
+	if string(rd.next(4)) != receiptMagic || rd.uint32() != receiptVersion {
+		return ERR_RECEIPT_FORMAT
+	}
+	*r = Receipt{
+		Status:     TrapCode(rd.uint32()),
+		GasUsed:    rd.uint64(),
+		ReturnData: receiptBytes(rd),
+	}
+	// every event takes at least 12 bytes, and every call 28
+	for i, n := 0, rd.count(12); i < n; i++ {
+		r.Events = append(r.Events, Event{Contract: string(rd.bytes()), Topic: string(rd.bytes()), Data: receiptBytes(rd)})
+	}
+	for i, n := 0, rd.count(28); i < n; i++ {
+		r.Calls = append(r.Calls, CallSummary{
+			Contract:   string(rd.bytes()),
+			Method:     string(rd.bytes()),
+			Depth:      int(rd.uint32()),
+			Status:     TrapCode(rd.uint32()),
+			GasUsed:    rd.uint64(),
+			ReturnData: receiptBytes(rd),
+		})
+	}
+	if rd.err != nil || len(rd.data) != 0 {
+		return ERR_RECEIPT_FORMAT
+	}
+	return nil
+}
+
+// receiptBytes reads a copy of the byte slice of a receipt, nil if empty.
+func receiptBytes(r *compiledReader) []byte {
+	if b := r.bytes(); len(b) != 0 {
+		return append([]byte(nil), b...)
+	}
+	return nil
+}
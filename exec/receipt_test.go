@@ -0,0 +1,119 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/common/types"
+	"github.com/bottos-project/bottos/contract"
+)
+
+func TestReceipt(t *testing.T) {
+	code, err := os.ReadFile("testdata/events.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewModuleCache(VMConfig{}, importer, 4, 1<<20)
+	env := NewEnvFunc()
+	RegisterEvents(env, EventConfig{})
+	caller := NewContractCaller(CodeStoreFunc(func(string) ([]byte, error) { return code, nil }), cache, env, ContractCallConfig{})
+	caller.Register(env)
+	module, err := cache.Load(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := module.Instantiate(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	vm.SetContract(&contract.Context{Trx: &types.Transaction{Contract: "c"}})
+	export, _ := module.Export("nest")
+	nest := int64(export.Index)
+
+	const data = 200
+	copy(vm.Memory()[data:], "ay")
+	if _, err = vm.ExecCode(nest, data, 2); err != nil {
+		t.Fatal(err)
+	}
+	if vm.Receipt() != nil {
+		t.Error("uncollected receipt")
+	}
+
+	vm.CollectReceipts(true)
+	vm.SetGasMeter(NewGasMeter(1<<20), DefaultGasSchedule())
+	res, err := vm.ExecCode(nest, data, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt := vm.Receipt()
+	ret := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ret, uint64(res.(uint32)))
+	want := &Receipt{
+		Status:     TrapNone,
+		GasUsed:    vm.GasUsed(),
+		ReturnData: ret,
+		Events:     []Event{{"c", "nest", []byte("ay")}, {"a", "log", []byte("y")}},
+		Calls:      []CallSummary{{Contract: "a", Method: "log", Depth: 1, Status: TrapNone, GasUsed: receipt.Calls[0].GasUsed}},
+	}
+	if !reflect.DeepEqual(receipt, want) {
+		t.Errorf("unexpected receipt: got=%+v, want=%+v", receipt, want)
+	}
+	if used := receipt.Calls[0].GasUsed; used == 0 || used >= receipt.GasUsed {
+		t.Errorf("unexpected gas used by the callee: %d of %d", used, receipt.GasUsed)
+	}
+
+	encoded, err := receipt.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Receipt{}
+	if err = decoded.UnmarshalBinary(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, receipt) {
+		t.Errorf("unexpected decoded receipt: got=%+v, want=%+v", decoded, receipt)
+	}
+	if err = decoded.UnmarshalBinary(encoded[:len(encoded)-1]); err != ERR_RECEIPT_FORMAT {
+		t.Errorf("unexpected error decoding a truncated receipt: %v", err)
+	}
+
+	// a failing callee is summarized, but its events are rolled back
+	copy(vm.Memory()[data:], "a!y")
+	if _, err = vm.ExecCode(nest, data, 3); err != nil {
+		t.Fatal(err)
+	}
+	receipt = vm.Receipt()
+	if len(receipt.Events) != 1 || len(receipt.Calls) != 1 || receipt.Calls[0].Status != TrapOutOfBoundsMemory {
+		t.Errorf("unexpected receipt of a failing callee: %+v", receipt)
+	}
+
+	// a trapping call has a receipt without results nor events
+	func() {
+		defer func() { recover() }()
+		vm.ExecCode(nest, 1<<20, 2)
+	}()
+	if receipt = vm.Receipt(); receipt.Status != TrapOutOfBoundsMemory || receipt.ReturnData != nil || receipt.Events != nil {
+		t.Errorf("unexpected receipt of a trapping call: %+v", receipt)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+// ReentrancyMode is whether a contract may be called again while one of
+// its calls is in progress, see ReentrancyPolicy.
+type ReentrancyMode int
+
+const (
+	// ReentrancyDeny fails the calls reentering the contract.
+	ReentrancyDeny ReentrancyMode = iota
+	// ReentrancyAllow allows them, within the depth of the calls.
+	ReentrancyAllow
+	// ReentrancyLimit allows the contract to be reentered at most
+	// MaxDepth times by a chain of calls.
+	ReentrancyLimit
+)
+
+// ReentrancyPolicy is whether the contract calls made by a ContractCaller
+// may reenter a contract, calling it back while one of its calls is in
+// progress further up the chain of calls, like a callee calling its
+// caller. The policy of the instance running the innermost call of the
+// contract applies, see SetReentrancyPolicy, the one of the config of the
+// caller otherwise, which denies reentrancy if it sets none.
+type ReentrancyPolicy struct {
+	Mode     ReentrancyMode
+	MaxDepth int
+}
+
+// SetReentrancyPolicy sets the policy of the calls reentering the contract
+// while inst runs it, in place of the one of the ContractCaller.
+func (inst *Instance) SetReentrancyPolicy(policy ReentrancyPolicy) {
+	inst.reentrancy = &policy
+}
+
+// contractFrame is a call of a chain of contract calls, see CallContract.
+type contractFrame struct {
+	addr   string
+	inst   *Instance
+	caller *contractFrame
+}
+
+// callerFrame returns the frame of the contract run by vm, the outermost
+// one of a chain of calls if vm isn't run by a ContractCaller.
+func (vm *VM) callerFrame() *contractFrame {
+	if vm.contractFrame != nil {
+		return vm.contractFrame
+	}
+	addr := ""
+	if vm.contract != nil && vm.contract.Trx != nil {
+		addr = vm.contract.Trx.Contract
+	}
+	return &contractFrame{addr: addr, inst: vm.Instance}
+}
+
+// checkReentrancy returns ERR_CONTRACT_REENTRANCY if a call of the contract
+// at addr from the one of frame reenters it against its policy.
+func (c *ContractCaller) checkReentrancy(frame *contractFrame, addr string) error {
+	var innermost *contractFrame
+	entries := 0
+	for f := frame; f != nil; f = f.caller {
+		if f.addr != addr {
+			continue
+		}
+		if innermost == nil {
+			innermost = f
+		}
+		entries++
+	}
+	if innermost == nil {
+		return nil
+	}
+	policy := c.config.Reentrancy
+	if innermost.inst != nil && innermost.inst.reentrancy != nil {
+		policy = *innermost.inst.reentrancy
+	}
+	switch policy.Mode {
+	case ReentrancyAllow:
+		return nil
+	case ReentrancyLimit:
+		if entries <= policy.MaxDepth {
+			return nil
+		}
+	}
+	return ERR_CONTRACT_REENTRANCY
+}
@@ -0,0 +1,123 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"math"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// The relaxed SIMD operators may give different results on different
+// platforms in the proposal, which the VMs of a chain can't afford. They
+// are only compiled with VMConfig.RelaxedSIMD, and lowered to the same
+// results everywhere:
+//   - relaxed_swizzle is i8x16.swizzle, the lanes of out of range indices
+//     are zero
+//   - relaxed_trunc are the trunc_sat operators, NaN is converted to zero
+//     and the other values are saturated
+//   - relaxed_madd and relaxed_nmadd are computed as a*b+c and -(a*b)+c,
+//     rounding the product before the sum: they are never fused
+//   - relaxed_laneselect is v128.bitselect, selecting every bit whatever
+//     the lanes of the mask
+//   - relaxed_min and relaxed_max are f32x4.min, f64x2.max etc., with NaN
+//     propagation and -0 below +0
+//   - relaxed_q15mulr_s is i16x8.q15mulr_sat_s
+//   - relaxed_dot multiplies the lanes of both operands as signed
+//     integers, the pairs of products wrapping to 16 bits, and
+//     relaxed_dot_add sums the four products of every 32-bit lane without
+//     intermediate wrapping before adding the third operand
+
+// initRelaxedSIMD registers the relaxed SIMD operators, once the SIMD
+// operators they reuse are.
+func initRelaxedSIMD() {
+	simdFuncs[ops.I8x16RelaxedSwizzle] = (*VM).i8x16Swizzle
+	simdFuncs[ops.I32x4RelaxedTruncF32x4S] = simdFuncs[ops.I32x4TruncSatF32x4S]
+	simdFuncs[ops.I32x4RelaxedTruncF32x4U] = simdFuncs[ops.I32x4TruncSatF32x4U]
+	simdFuncs[ops.I32x4RelaxedTruncF64x2SZero] = simdFuncs[ops.I32x4TruncSatF64x2SZero]
+	simdFuncs[ops.I32x4RelaxedTruncF64x2UZero] = simdFuncs[ops.I32x4TruncSatF64x2UZero]
+	simdFuncs[ops.F32x4RelaxedMadd] = f32Ternop(func(a, b, c float32) float32 { return float32(a*b) + c })
+	simdFuncs[ops.F32x4RelaxedNmadd] = f32Ternop(func(a, b, c float32) float32 { return -float32(a*b) + c })
+	simdFuncs[ops.F64x2RelaxedMadd] = f64Ternop(func(a, b, c float64) float64 { return float64(a*b) + c })
+	simdFuncs[ops.F64x2RelaxedNmadd] = f64Ternop(func(a, b, c float64) float64 { return -float64(a*b) + c })
+	for _, sub := range []uint32{ops.I8x16RelaxedLaneselect, ops.I16x8RelaxedLaneselect, ops.I32x4RelaxedLaneselect, ops.I64x2RelaxedLaneselect} {
+		simdFuncs[sub] = (*VM).v128Bitselect
+	}
+	simdFuncs[ops.F32x4RelaxedMin] = simdFuncs[ops.F32x4Min]
+	simdFuncs[ops.F32x4RelaxedMax] = simdFuncs[ops.F32x4Max]
+	simdFuncs[ops.F64x2RelaxedMin] = simdFuncs[ops.F64x2Min]
+	simdFuncs[ops.F64x2RelaxedMax] = simdFuncs[ops.F64x2Max]
+	simdFuncs[ops.I16x8RelaxedQ15mulrS] = simdFuncs[ops.I16x8Q15mulrSatS]
+	simdFuncs[ops.I16x8RelaxedDotI8x16I7x16S] = (*VM).i16x8RelaxedDot
+	simdFuncs[ops.I32x4RelaxedDotI8x16I7x16AddS] = (*VM).i32x4RelaxedDotAdd
+}
+
+// f32Ternop and f64Ternop return the implementation of the lanewise
+// operators on three float operands.
+func f32Ternop(f func(a, b, c float32) float32) func(*VM) {
+	return func(vm *VM) {
+		c, b, a := vm.popV128(), vm.popV128(), vm.popV128()
+		var r wasm.V128
+		for i := 0; i < 4; i++ {
+			x := f(math.Float32frombits(uint32(lane(&a, 32, i))), math.Float32frombits(uint32(lane(&b, 32, i))), math.Float32frombits(uint32(lane(&c, 32, i))))
+			setLane(&r, 32, i, uint64(math.Float32bits(x)))
+		}
+		vm.pushV128(r)
+	}
+}
+
+func f64Ternop(f func(a, b, c float64) float64) func(*VM) {
+	return func(vm *VM) {
+		c, b, a := vm.popV128(), vm.popV128(), vm.popV128()
+		var r wasm.V128
+		for i := 0; i < 2; i++ {
+			x := f(math.Float64frombits(lane(&a, 64, i)), math.Float64frombits(lane(&b, 64, i)), math.Float64frombits(lane(&c, 64, i)))
+			setLane(&r, 64, i, math.Float64bits(x))
+		}
+		vm.pushV128(r)
+	}
+}
+
+// relaxedProduct returns the product of the lanes i of a and b, both as
+// signed 8-bit integers.
+func relaxedProduct(a, b *wasm.V128, i int) int64 {
+	return signed(lane(a, 8, i), 8) * signed(lane(b, 8, i), 8)
+}
+
+func (vm *VM) i16x8RelaxedDot() {
+	b, a := vm.popV128(), vm.popV128()
+	var r wasm.V128
+	for i := 0; i < 8; i++ {
+		setLane(&r, 16, i, uint64(relaxedProduct(&a, &b, 2*i)+relaxedProduct(&a, &b, 2*i+1)))
+	}
+	vm.pushV128(r)
+}
+
+func (vm *VM) i32x4RelaxedDotAdd() {
+	c, b, a := vm.popV128(), vm.popV128(), vm.popV128()
+	var r wasm.V128
+	for i := 0; i < 4; i++ {
+		sum := int64(int32(lane(&c, 32, i)))
+		for j := 4 * i; j < 4*i+4; j++ {
+			sum += relaxedProduct(&a, &b, j)
+		}
+		setLane(&r, 32, i, uint64(sum))
+	}
+	vm.pushV128(r)
+}
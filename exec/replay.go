@@ -0,0 +1,602 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Recorder records the nondeterministic inputs of the calls of a VM to a
+// compact trace, see Record: the results of the host functions, the gas
+// they charge and the pages of the memories they write, and the outcomes of
+// memory.grow, which depend on the ResourceLimiter and on the memory left
+// to the node. Replaying the trace re-executes the calls without the host,
+// to reproduce them offline, for instance when nodes diverge on a
+// transaction.
+type Recorder struct {
+	trace traceWriter
+	// whether a call is being recorded, the epoch of the writes before the
+	// host function it calls, see writeMark, and the ranges of memory the
+	// host function wrote
+	calling bool
+	mark    uint64
+	ranges  [][2]int
+}
+
+// NewRecorder returns a Recorder with an empty trace.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Trace returns a copy of the trace of the calls recorded so far, to be
+// replayed by Replay.
+func (r *Recorder) Trace() []byte {
+	return append([]byte(nil), r.trace.buf...)
+}
+
+// Record records the next calls of vm to r, until it is called with a nil
+// r. Only the calls started by ExecCode and the like are recorded: the
+// calls nested in a host function are part of the host function for the
+// trace. The calls which pause can't be replayed. The writes to the
+// memories of the instance are tracked from then on, like for a
+// StateHasher, for the trace to only hold the pages the host functions
+// wrote.
+func (vm *VM) Record(r *Recorder) {
+	if r != nil {
+		vm.trackWrites()
+	}
+	vm.recorder = r
+}
+
+// recording returns whether the current call is recorded, the calls nested
+// in host functions aside.
+func (vm *VM) recording() bool {
+	return vm.recorder != nil && vm.recorder.calling && vm.activeCalls == 1
+}
+
+// The events of a trace, each starting with its kind.
+const (
+	// a call: the function, the arguments and the state of the gas meter
+	traceCall byte = 1 + iota
+	// a host function: the outcome, the results, the gas it consumed and
+	// the pages of every memory it wrote
+	traceHost
+	// a memory.grow: the pages, the outcome, the result and the gas it
+	// consumed
+	traceGrow
+	// the end of a call: the result, the gas it consumed and the outcome
+	traceReturn
+)
+
+var traceEvents = map[byte]string{
+	traceCall:   "call",
+	traceHost:   "host function",
+	traceGrow:   "memory.grow",
+	traceReturn: "return",
+}
+
+// The outcomes of a call, a host function or a memory.grow.
+const (
+	outcomeOK    byte = iota
+	outcomeError      // returned an error, or the host function failed
+	outcomeTrap       // trapped the VM
+	outcomePanic      // panicked without trapping the VM, see FatalVMError
+)
+
+// outcomeOf returns the outcome of a call which returned err, or panicked
+// with p, along with the code and the message of its error.
+func outcomeOf(err error, p interface{}) (byte, TrapCode, string) {
+	switch {
+	case p != nil && isTrap(p):
+		err := p.(error)
+		return outcomeTrap, TrapCodeOf(err), err.Error()
+	case p != nil:
+		return outcomePanic, TrapFatal, fmt.Sprint(p)
+	case err != nil:
+		return outcomeError, TrapCodeOf(err), err.Error()
+	}
+	return outcomeOK, TrapNone, ""
+}
+
+// describeOutcome describes an outcome for a DivergenceError.
+func describeOutcome(outcome byte, msg string) string {
+	switch outcome {
+	case outcomeError:
+		return "error: " + msg
+	case outcomeTrap:
+		return "trap: " + msg
+	case outcomePanic:
+		return "panic: " + msg
+	}
+	return "success"
+}
+
+// recordCall runs the call of the function fnIndex with args like
+// ExecCodeRaw, recording its inputs and its end.
+func (vm *VM) recordCall(fnIndex int64, args []uint64) (res uint64, err error) {
+	r := vm.recorder
+	w := &r.trace
+	w.byte(traceCall)
+	w.uvarint(uint64(fnIndex))
+	w.values(args)
+	metered := vm.gasMeter != nil
+	w.bool(metered)
+	if metered {
+		w.uvarint(vm.gasMeter.used)
+		w.uvarint(vm.gasMeter.limit)
+	}
+
+	r.calling = true
+	defer func() {
+		p := recover()
+		r.calling = false
+		w.byte(traceReturn)
+		w.uvarint(res)
+		if metered {
+			w.uvarint(vm.gasUsed)
+		}
+		w.outcome(outcomeOf(err, p))
+		if p != nil {
+			panic(p)
+		}
+	}()
+	return vm.ExecCodeRaw(fnIndex, args...)
+}
+
+// recordHost records the host function called by the current context,
+// whose stack was depth values high, gas being the gas consumed before the
+// call and err the error of the call. It must be deferred by ExecEnvFunc.
+func (vm *VM) recordHost(gas uint64, depth int, err *error) {
+	p := recover()
+	r := vm.recorder
+	w := &r.trace
+	w.byte(traceHost)
+	w.uvarint(uint64(vm.ctx.curFunc))
+	w.outcome(outcomeOf(*err, p))
+	var results []uint64
+	if len(vm.ctx.stack) > depth {
+		results = vm.ctx.stack[depth:]
+	}
+	w.values(results)
+	w.varint(int64(vm.meteredGas() - gas))
+	r.writeMemories(vm.Instance)
+	if p != nil {
+		panic(p)
+	}
+}
+
+// recordGrow records a memory.grow of n pages which returned prev, gas
+// being the gas consumed before. It must be deferred by grow.
+func (vm *VM) recordGrow(n uint32, gas uint64, prev *int32) {
+	p := recover()
+	w := &vm.recorder.trace
+	w.byte(traceGrow)
+	w.uvarint(uint64(n))
+	w.outcome(outcomeOf(nil, p))
+	w.varint(int64(*prev))
+	w.varint(int64(vm.meteredGas() - gas))
+	if p != nil {
+		panic(p)
+	}
+}
+
+// writeMemories writes the number of memories of inst, and for each of
+// them its size and the pages written since r.mark, the pages it grew to
+// being zeros unless written.
+func (r *Recorder) writeMemories(inst *Instance) {
+	w := &r.trace
+	w.uvarint(uint64(1 + len(inst.memories)))
+	for i := 0; i <= len(inst.memories); i++ {
+		memory, _ := inst.memoryAt(uint32(i))
+		ranges := writtenRanges(r.ranges[:0], inst.writtenPages(uint32(i)), len(memory), r.mark)
+		r.ranges = ranges
+
+		w.uvarint(uint64(len(memory)))
+		w.uvarint(uint64(len(ranges)))
+		end := 0
+		for _, rg := range ranges {
+			w.uvarint(uint64(rg[0] - end))
+			w.bytes(memory[rg[0]:rg[1]])
+			end = rg[1]
+		}
+	}
+}
+
+// DivergenceError is returned by Replay when a replayed call doesn't run
+// like the recorded one.
+type DivergenceError struct {
+	// Call is the index of the call in the trace, and Event what diverged,
+	// like "result" or "memory.grow".
+	Call  int
+	Event string
+	// Recorded and Replayed describe what the recorded and the replayed
+	// calls did.
+	Recorded string
+	Replayed string
+}
+
+func (e *DivergenceError) Error() string {
+	return fmt.Sprintf("exec: replay of call %d diverges at %s: recorded %s, replayed %s", e.Call, e.Event, e.Recorded, e.Replayed)
+}
+
+// Replay re-executes the calls recorded to trace by a Recorder, in order,
+// feeding them the recorded inputs instead of calling the host functions
+// and asking the ResourceLimiter. vm must be a new instance of the module
+// the calls were recorded from, with the same configuration and gas
+// schedule; its meter, if any, is set to the recorded state before each
+// call. Replay returns a DivergenceError for the first call which doesn't
+// run like the recorded one, for instance on another version of the
+// interpreter, ERR_INVALID_TRACE for an invalid trace, and nil once every
+// call has been replayed.
+func (vm *VM) Replay(trace []byte) error {
+	r := &traceReader{data: trace}
+	recorder := vm.recorder
+	vm.recorder, vm.replayer = nil, r
+	defer func() {
+		vm.recorder, vm.replayer = recorder, nil
+	}()
+	for ; len(r.data) != 0; r.call++ {
+		if err := vm.replayCall(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayCall replays the next call of r. Reading the trace panics with
+// ERR_INVALID_TRACE or a DivergenceError, see (*traceReader).check.
+func (vm *VM) replayCall(r *traceReader) (err error) {
+	defer func() {
+		switch p := recover().(type) {
+		case nil:
+		case *DivergenceError:
+			err = p
+		case error:
+			if p != ERR_INVALID_TRACE {
+				panic(p)
+			}
+			err = p
+		default:
+			panic(p)
+		}
+	}()
+	if r.byte() != traceCall {
+		r.err = ERR_INVALID_TRACE
+	}
+	fnIndex := int64(r.uvarint())
+	args := r.values()
+	metered := r.bool()
+	var used, limit uint64
+	if metered {
+		used, limit = r.uvarint(), r.uvarint()
+	}
+	r.check()
+	if metered != (vm.gasMeter != nil) {
+		return r.diverge("gas meter", metered, vm.gasMeter != nil)
+	}
+	if metered {
+		vm.gasMeter.used, vm.gasMeter.limit = used, limit
+	}
+
+	res, p, callErr := vm.execReplayed(fnIndex, args)
+	if err, ok := p.(error); ok {
+		var divergence *DivergenceError
+		if errors.As(err, &divergence) {
+			return divergence
+		}
+		if errors.Is(err, ERR_INVALID_TRACE) {
+			return ERR_INVALID_TRACE
+		}
+	}
+	outcome, _, msg := outcomeOf(callErr, p)
+
+	r.expect(traceReturn, "return")
+	wantRes := r.uvarint()
+	var wantGas uint64
+	if metered {
+		wantGas = r.uvarint()
+	}
+	wantOutcome, _, wantMsg := r.outcome()
+	r.check()
+	switch {
+	case outcome != wantOutcome || msg != wantMsg:
+		return r.diverge("outcome", describeOutcome(wantOutcome, wantMsg), describeOutcome(outcome, msg))
+	case res != wantRes:
+		return r.diverge("result", wantRes, res)
+	case metered && vm.gasUsed != wantGas:
+		return r.diverge("gas", wantGas, vm.gasUsed)
+	}
+	return nil
+}
+
+// execReplayed calls the function fnIndex with args, returning the value
+// the call panicked with, if any.
+func (vm *VM) execReplayed(fnIndex int64, args []uint64) (res uint64, p interface{}, err error) {
+	defer func() {
+		p = recover()
+	}()
+	res, err = vm.ExecCodeRaw(fnIndex, args...)
+	return res, nil, err
+}
+
+// replayHost replays the host function called by the current context:
+// the memory it wrote, the gas it consumed and its outcome and results.
+func (vm *VM) replayHost() error {
+	r := vm.replayer
+	r.expect(traceHost, traceEvents[traceHost])
+	if fn := int64(r.uvarint()); fn != vm.ctx.curFunc {
+		r.check()
+		panic(r.diverge(traceEvents[traceHost], describeFunc(fn, vm.funcName(fn)), describeFunc(vm.ctx.curFunc, vm.funcName(vm.ctx.curFunc))))
+	}
+	outcome, code, msg := r.outcome()
+	results := r.values()
+	gas := r.varint()
+	memories := r.uvarint()
+	r.check()
+	if current := uint64(1 + len(vm.memories)); memories != current {
+		panic(r.diverge("memories", memories, current))
+	}
+	for i := uint32(0); i < uint32(memories); i++ {
+		vm.replayMemory(r, i)
+	}
+	vm.replayGas(gas)
+	if outcome == outcomeTrap || outcome == outcomePanic {
+		replayPanic(outcome, code, msg)
+	}
+	vm.ctx.stack = append(vm.ctx.stack, results...)
+	if outcome == outcomeError {
+		return ERR_CALL_ENV_METHOD
+	}
+	return nil
+}
+
+// replayGrow replays a memory.grow of n pages: the memory only grows if the
+// recorded one did.
+func (vm *VM) replayGrow(n uint32) int32 {
+	r := vm.replayer
+	r.expect(traceGrow, traceEvents[traceGrow])
+	if pages := uint32(r.uvarint()); pages != n {
+		r.check()
+		panic(r.diverge(traceEvents[traceGrow], fmt.Sprintf("%d pages", pages), fmt.Sprintf("%d pages", n)))
+	}
+	outcome, code, msg := r.outcome()
+	prev := int32(r.varint())
+	gas := r.varint()
+	r.check()
+	if outcome != outcomeOK || prev < 0 {
+		vm.replayGas(gas)
+		if outcome != outcomeOK {
+			replayPanic(outcome, code, msg)
+		}
+		return -1
+	}
+	if got := vm.growPages(n); got != prev {
+		panic(r.diverge(traceEvents[traceGrow], prev, got))
+	}
+	return prev
+}
+
+// replayGas consumes the gas a host function or a memory.grow consumed, or
+// gives back the gas it refunded.
+func (vm *VM) replayGas(gas int64) {
+	switch {
+	case vm.gasMeter == nil:
+	case gas > 0:
+		vm.consumeGas(GasHost, uint64(gas))
+	case gas < 0:
+		vm.gasMeter.Refund(uint64(-gas))
+	}
+}
+
+// replayPanic panics like a recorded host function or memory.grow did.
+func replayPanic(outcome byte, code TrapCode, msg string) {
+	if outcome == outcomeTrap {
+		if code >= TrapCustom && code-TrapCustom <= math.MaxUint16 {
+			panic(HostTrap(uint16(code-TrapCustom), msg))
+		}
+		panic(newTrap(code, msg))
+	}
+	panic(msg)
+}
+
+// replayMemory applies the size and the ranges of the memory at index
+// read from r.
+func (vm *VM) replayMemory(r *traceReader, index uint32) {
+	vm.swapMemory(index)
+	defer vm.swapMemory(index)
+
+	size := r.uvarint()
+	r.check()
+	if current := uint64(len(vm.memory)); size != current {
+		pageSize := uint64(vm.pageSize)
+		if size < current || (size-current)%pageSize != 0 || vm.Instance.growMemory(uint32((size-current)/pageSize)) < 0 {
+			panic(r.diverge("memory size", size, current))
+		}
+	}
+	offset := uint64(0)
+	for n, i := r.uvarint(), uint64(0); i < n; i++ {
+		offset += r.uvarint()
+		b := r.bytes()
+		r.check()
+		if offset > size || uint64(len(b)) > size-offset {
+			panic(ERR_INVALID_TRACE)
+		}
+		vm.wrote(offset, uint64(len(b)))
+		offset += uint64(copy(vm.memory[offset:], b))
+	}
+	r.check()
+}
+
+// traceWriter writes the events of a trace, the integers as varints.
+type traceWriter struct {
+	buf []byte
+}
+
+func (w *traceWriter) byte(b byte) {
+	w.buf = append(w.buf, b)
+}
+
+func (w *traceWriter) bool(v bool) {
+	if v {
+		w.byte(1)
+	} else {
+		w.byte(0)
+	}
+}
+
+func (w *traceWriter) uvarint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *traceWriter) varint(v int64) {
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+func (w *traceWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *traceWriter) values(v []uint64) {
+	w.uvarint(uint64(len(v)))
+	for _, x := range v {
+		w.uvarint(x)
+	}
+}
+
+// outcome writes an outcome, and the code and the message of its error.
+func (w *traceWriter) outcome(outcome byte, code TrapCode, msg string) {
+	w.byte(outcome)
+	if outcome != outcomeOK {
+		w.uvarint(uint64(code))
+		w.bytes([]byte(msg))
+	}
+}
+
+// traceReader reads the events written by traceWriter for Replay. After
+// the first error, every read returns a zero value and err is set.
+type traceReader struct {
+	data []byte
+	err  error
+	// the index of the call being replayed
+	call int
+}
+
+func (r *traceReader) byte() byte {
+	if r.err != nil || len(r.data) == 0 {
+		r.err = ERR_INVALID_TRACE
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *traceReader) bool() bool {
+	return r.byte() != 0
+}
+
+func (r *traceReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = ERR_INVALID_TRACE
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *traceReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = ERR_INVALID_TRACE
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *traceReader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil || n > uint64(len(r.data)) {
+		r.err = ERR_INVALID_TRACE
+		return nil
+	}
+	b := r.data[:n:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *traceReader) values() []uint64 {
+	// every value takes at least a byte
+	n := r.uvarint()
+	if r.err != nil || n > uint64(len(r.data)) {
+		r.err = ERR_INVALID_TRACE
+		return nil
+	}
+	v := make([]uint64, n)
+	for i := range v {
+		v[i] = r.uvarint()
+	}
+	return v
+}
+
+func (r *traceReader) outcome() (byte, TrapCode, string) {
+	outcome := r.byte()
+	if outcome == outcomeOK {
+		return outcomeOK, TrapNone, ""
+	}
+	code := TrapCode(r.uvarint())
+	return outcome, code, string(r.bytes())
+}
+
+// check panics with ERR_INVALID_TRACE if a read failed.
+func (r *traceReader) check() {
+	if r.err != nil {
+		panic(ERR_INVALID_TRACE)
+	}
+}
+
+// expect reads the kind of the next event, which the replayed call
+// reaches as the event named event, and panics with a DivergenceError if
+// the recorded call reached another one.
+func (r *traceReader) expect(kind byte, event string) {
+	recorded := r.byte()
+	r.check()
+	if recorded != kind {
+		name, ok := traceEvents[recorded]
+		if !ok {
+			panic(ERR_INVALID_TRACE)
+		}
+		panic(r.diverge("event", name, event))
+	}
+}
+
+// diverge returns the DivergenceError of the call being replayed at event.
+func (r *traceReader) diverge(event string, recorded, replayed interface{}) *DivergenceError {
+	return &DivergenceError{Call: r.call, Event: event, Recorded: fmt.Sprint(recorded), Replayed: fmt.Sprint(replayed)}
+}
@@ -0,0 +1,86 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wat"
+)
+
+// replayMemories is a module whose run(p) returns oracle(p) plus the value
+// at p in its second memory, which oracle writes.
+const replayMemories = `(module
+  (import "env" "oracle" (func $oracle (param i32) (result i32)))
+  (memory 1)
+  (memory $b (export "b") 1)
+  (func (export "run") (param i32) (result i32)
+    (i32.add (call $oracle (local.get 0)) (i32.load $b (local.get 0)))))`
+
+func TestReplayMemories(t *testing.T) {
+	// the env imports are resolved to host functions without resolve
+	module, err := wat.Parse([]byte(replayMemories), func(name string) (*wasm.Module, error) {
+		return nil, fmt.Errorf("unexpected import of %s", name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := exec.CompileModule(module, exec.VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// oracle(p) writes 7 at p in the second memory, and returns 5
+	imports := exec.NewEnvFunc()
+	imports.Register("oracle", func(vm *exec.VM) (bool, error) {
+		b, _ := vm.ExportedMemory("b")
+		if err := b.WriteUint32(uint32(vm.GetFuncParams()[0]), 7); err != nil {
+			return false, err
+		}
+		vm.SetFuncResult(5)
+		return true, nil
+	})
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	recorder := exec.NewRecorder()
+	vm.Record(recorder)
+	if res, err := vm.ExecCode(int64(module.Export.Entries["run"].Index), 16); err != nil || res != uint32(12) {
+		t.Fatalf("run: got=%v, %v, want=12", res, err)
+	}
+	vm.Record(nil)
+
+	replayed, err := exec.NewVMWithConfig(module, exec.VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replayed.Replay(recorder.Trace()); err != nil {
+		t.Fatal(err)
+	}
+	recorded, _ := vm.ExportedMemory("b")
+	want, _ := recorded.ReadBytes(0, uint32(recorded.Size()))
+	memory, _ := replayed.ExportedMemory("b")
+	if got, _ := memory.ReadBytes(0, uint32(memory.Size())); !bytes.Equal(got, want) {
+		t.Error("the replayed second memory differs from the recorded one")
+	}
+}
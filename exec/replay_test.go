@@ -0,0 +1,115 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// newReplayVM returns a metered VM of testdata/replay.wasm, whose oracle
+// import isn't registered.
+func newReplayVM(t *testing.T, module *wasm.Module) *VM {
+	vm, err := NewVMWithConfig(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.SetGasMeter(NewGasMeter(0), DefaultGasSchedule())
+	return vm
+}
+
+func TestReplay(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/replay.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := int64(module.Export.Entries["run"].Index)
+	compiled, err := CompileModule(module, VMConfig{ResourceLimiter: &testLimiter{maxMemory: 2 * wasmPageSize}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// oracle(p) writes 7 at p, and returns 5
+	imports := NewEnvFunc()
+	imports.RegisterWithCost("oracle", func(vm *VM) (bool, error) {
+		if err := vm.LinearMemory().WriteUint32(uint32(vm.GetFuncParams()[0]), 7); err != nil {
+			return false, err
+		}
+		vm.SetFuncResult(5)
+		return true, nil
+	}, FlatCost(HOST_CALL_GAS))
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	vm.SetGasMeter(NewGasMeter(1<<20), DefaultGasSchedule())
+
+	// run(p) returns oracle(p) plus the value at p plus the result of
+	// memory.grow, which the limiter denies the second time
+	recorder := NewRecorder()
+	vm.Record(recorder)
+	for _, want := range []uint32{13, 11} {
+		if res, err := vm.ExecCode(run, 16); err != nil || res != want {
+			t.Fatalf("run: got=%v, %v, want=%d", res, err, want)
+		}
+	}
+	vm.Record(nil)
+	trace := recorder.Trace()
+	// only the page the oracle wrote is recorded, for both calls
+	if len(trace) > 3<<writePageShift {
+		t.Errorf("trace of %d bytes, want at most 2 pages and the events", len(trace))
+	}
+
+	// the calls are replayed without the oracle and the limiter
+	replayed := newReplayVM(t, module)
+	if err := replayed.Replay(trace); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(replayed.Memory(), vm.Memory()) {
+		t.Error("the replayed memory differs from the recorded one")
+	}
+	if replayed.GasMeter().Used() != vm.GasMeter().Used() {
+		t.Errorf("replayed gas: got=%d, want=%d", replayed.GasMeter().Used(), vm.GasMeter().Used())
+	}
+
+	// the oracle leaves the pages it doesn't write to the memory
+	replayed = newReplayVM(t, module)
+	replayed.Memory()[1<<writePageShift] = 1
+	if err := replayed.Replay(trace); err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Memory()[1<<writePageShift] != 1 {
+		t.Error("the replay wrote a page the oracle didn't")
+	}
+
+	// the memory grows like the recorded one
+	replayed = newReplayVM(t, module)
+	replayed.Instance.growMemory(1)
+	var divergence *DivergenceError
+	if err := replayed.Replay(trace); !errors.As(err, &divergence) || divergence.Call != 0 || divergence.Event != "memory size" {
+		t.Errorf("replay of a diverging call: %v", err)
+	}
+
+	if err := newReplayVM(t, module).Replay(trace[:len(trace)-1]); err != ERR_INVALID_TRACE {
+		t.Errorf("replay of a truncated trace: got=%v, want=%v", err, ERR_INVALID_TRACE)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/bottos-project/bottos/vm/wasm/demangle"
+)
+
+// Sampler samples the call stacks of the calls of a VM periodically, to
+// profile where they spend their time without tracing them, see
+// (*VM).StartSampling. Its profile is written in the pprof format by
+// WriteProfile, for go tool pprof or speedscope to visualize.
+//
+// The stacks are sampled at the safepoints of the calls following a tick,
+// that is their next call or loop back-edge, so the time of a long
+// stretch of straight code is attributed to the end of the stretch. The
+// instructions inlined into a function are seen at their call.
+type Sampler struct {
+	vm       *VM
+	interval time.Duration
+	start    time.Time
+	duration time.Duration
+	// the samples of each distinct stack, by their key, see sample, and
+	// the keys in the order of their first sample
+	samples map[string]*stackSample
+	keys    []string
+	// the host functions in progress, see enterHost
+	hosts []hostFrame
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// stackSample is a call stack and the number of times it was sampled.
+type stackSample struct {
+	frames []sampledFrame
+	count  int64
+}
+
+// hostFrame is a host function in progress: its index, and the number of
+// frames of its callers, from which the calls it makes run.
+type hostFrame struct {
+	fn    int64
+	depth int
+}
+
+// sampledFrame is a frame of a sampled call stack: the index of its
+// function, and the offset in the module of its current instruction, or
+// -1 if it is unknown.
+type sampledFrame struct {
+	fn, offset int64
+}
+
+// StartSampling starts sampling the call stacks of the following calls of
+// vm every interval, until Stop. Functions compiled to native code are
+// interpreted while sampling, since they have no safepoint.
+func (vm *VM) StartSampling(interval time.Duration) *Sampler {
+	s := &Sampler{
+		vm:       vm,
+		interval: interval,
+		start:    time.Now(),
+		samples:  make(map[string]*stackSample),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	vm.sampler = s
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		defer close(s.stopped)
+		for {
+			select {
+			case <-ticker.C:
+				atomic.StoreUint32(&vm.sampleDue, 1)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// Stop stops sampling the calls of the VM of s. It must be called by the
+// goroutine running the calls, once none is in progress.
+func (s *Sampler) Stop() {
+	if s.vm.sampler != s {
+		return
+	}
+	close(s.stop)
+	<-s.stopped
+	s.duration = time.Since(s.start)
+	s.vm.sampler = nil
+	atomic.StoreUint32(&s.vm.sampleDue, 0)
+}
+
+// Samples returns the number of stacks sampled by s.
+func (s *Sampler) Samples() int64 {
+	var n int64
+	for _, sample := range s.samples {
+		n += sample.count
+	}
+	return n
+}
+
+// sample adds the call stack of vm to the samples of its sampler.
+func (vm *VM) sample() {
+	atomic.StoreUint32(&vm.sampleDue, 0)
+	s := vm.sampler
+	if s == nil {
+		return
+	}
+	contexts := append(vm.frames[:len(vm.frames):len(vm.frames)], vm.ctx)
+	frames := make([]sampledFrame, 0, len(contexts))
+	key := make([]byte, 0, 16*len(contexts))
+	// from the innermost frame, whose pc is at its next instruction, the
+	// ones of its callers being past their call. The calls made by a host
+	// function replace its context, which is added back below them.
+	hosts := s.hosts
+	for i := len(contexts) - 1; i >= 0; i-- {
+		ctx := &contexts[i]
+		pc := ctx.pc
+		if i != len(contexts)-1 {
+			pc--
+		}
+		offset, ok := vm.compiled.CodeOffset(ctx.curFunc, pc)
+		if !ok {
+			offset = -1
+		}
+		frames = append(frames, sampledFrame{fn: ctx.curFunc, offset: offset})
+		key = binary.AppendVarint(key, ctx.curFunc)
+		key = binary.AppendVarint(key, offset)
+		for n := len(hosts); n != 0 && hosts[n-1].depth == i; n-- {
+			frames = append(frames, sampledFrame{fn: hosts[n-1].fn, offset: -1})
+			key = binary.AppendVarint(key, hosts[n-1].fn)
+			key = binary.AppendVarint(key, -1)
+			hosts = hosts[:n-1]
+		}
+	}
+	sample := s.samples[string(key)]
+	if sample == nil {
+		sample = &stackSample{frames: frames}
+		s.samples[string(key)] = sample
+		s.keys = append(s.keys, string(key))
+	}
+	sample.count++
+}
+
+// enterHost records the call of the host function of the current context
+// for the samples of the calls it makes, until leaveHost.
+func (s *Sampler) enterHost(vm *VM) *Sampler {
+	s.hosts = append(s.hosts, hostFrame{fn: vm.ctx.curFunc, depth: len(vm.frames)})
+	return s
+}
+
+// leaveHost ends the host function call recorded by enterHost.
+func (s *Sampler) leaveHost() {
+	s.hosts = s.hosts[:len(s.hosts)-1]
+}
+
+// frameName returns the name of the function of vm with the given index in
+// the profiles: its demangled name in the name section, its method for a
+// host function, marked by a [host] suffix, or its index.
+func (vm *VM) frameName(fn int64) string {
+	if compiled := &vm.compiledFuncs[fn]; compiled.funcProp.EnvFunc {
+		return compiled.funcProp.Method + " [host]"
+	}
+	if name := vm.funcName(fn); name != "" {
+		return demangle.Demangle(name)
+	}
+	return fmt.Sprintf("function %d", fn)
+}
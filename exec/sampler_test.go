@@ -0,0 +1,129 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// newSpinInstance returns an instance of testdata/spin.wasm, whose host
+// function back(n) calls run(n).
+func newSpinInstance(t *testing.T) (*Instance, *wasm.Module) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/spin.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := int64(module.Export.Entries["run"].Index)
+	imports := NewEnvFunc()
+	imports.Register("back", func(vm *VM) (bool, error) {
+		_, err := vm.ExecCode(run, vm.GetFuncParams()[0])
+		return err == nil, err
+	})
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inst, module
+}
+
+func TestSampler(t *testing.T) {
+	inst, module := newSpinInstance(t)
+	defer inst.Close()
+	vm := inst.NewVM()
+	run := int64(module.Export.Entries["run"].Index)
+	s := vm.StartSampling(time.Millisecond)
+	for i := 0; i < 1000 && s.Samples() < 5; i++ {
+		if _, err := vm.ExecCode(run, 100000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Stop()
+	if s.Samples() < 5 {
+		t.Fatalf("got %d samples", s.Samples())
+	}
+	// the loop of spin is its only safepoint
+	for _, sample := range s.samples {
+		if len(sample.frames) != 2 || sample.frames[0].fn != 1 || sample.frames[1].fn != run {
+			t.Errorf("unexpected stack: %+v", sample.frames)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := s.WriteProfile(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// count the samples, and read the string table
+	var samples int
+	var strs []string
+	for len(data) != 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		var v uint64
+		switch key & 7 {
+		case 0:
+			v, n = binary.Uvarint(data)
+			data = data[n:]
+		case 2:
+			v, n = binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < v {
+				t.Fatalf("invalid profile")
+			}
+			switch key >> 3 {
+			case 2:
+				samples++
+			case 6:
+				strs = append(strs, string(data[n:n+int(v)]))
+			}
+			data = data[n+int(v):]
+		default:
+			t.Fatalf("unexpected field %d", key)
+		}
+	}
+	if samples != len(s.samples) {
+		t.Errorf("got %d samples, want %d", samples, len(s.samples))
+	}
+	want := []string{"", "samples", "count", "wall", "nanoseconds", "function 1", "function 2"}
+	if len(strs) != len(want) {
+		t.Fatalf("got=%q, want=%q", strs, want)
+	}
+	for i := range want {
+		if strs[i] != want[i] {
+			t.Errorf("got=%q, want=%q", strs, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"runtime"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/compile"
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/native"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// A serialized compiled module has the following layout:
+//
+//	magic    [4]byte  "\x00bvm"
+//	version  uint32   compiledVersion
+//	checksum [32]byte sha256 of the payload
+//	payload
+//
+// The payload starts with the fingerprint of the module it was compiled
+// from, followed by the config, and the compiled functions. All integers
+// are little endian.
+const (
+	compiledMagic   = "\x00bvm"
+	compiledVersion = 10
+)
+
+// CompileSerialize returns the compiled form of m as bytes, which can be
+// turned back into a Module with DeserializeCompiled without compiling the
+// module again. Native code is included, and only reused on the same
+// platform. The functions left to compile on their first call by
+// VMConfig.LazyCompile are compiled first.
+func (m *Module) CompileSerialize() ([]byte, error) {
+	if err := m.CompileAll(); err != nil {
+		return nil, err
+	}
+	w := &compiledWriter{}
+	fingerprint := moduleFingerprint(m.module)
+	w.Write(fingerprint[:])
+	w.bytes([]byte(runtime.GOOS + "/" + runtime.GOARCH))
+
+	w.bool(m.config.StaticMemoryBounds)
+	w.uint32(uint32(m.config.InlineThreshold))
+	w.bool(m.config.AOT)
+	w.bool(m.config.BlockMetering)
+	w.bool(m.config.RelaxedSIMD)
+	w.bool(m.config.CanonicalNaN)
+	w.bool(m.config.SoftFloat)
+	w.bool(m.config.GuestStackCheck)
+	w.uint64(m.staticMemorySize)
+
+	funcs := m.allFuncs()
+	w.uint32(uint32(len(funcs)))
+	for _, fn := range funcs {
+		w.bytes(fn.code)
+		w.uint32(uint32(len(fn.branchTables)))
+		for _, table := range fn.branchTables {
+			w.uint32(uint32(len(table.Targets)))
+			for _, target := range table.Targets {
+				w.uint64(uint64(target.Addr))
+				w.uint64(uint64(target.Discard))
+				w.uint32(uint32(target.Preserve))
+				w.bool(target.Return)
+			}
+		}
+		w.uint32(uint32(len(fn.callSites)))
+		w.uint32(uint32(len(fn.basicBlocks)))
+		for _, block := range fn.basicBlocks {
+			w.bytes(block)
+		}
+		w.uint32(uint32(len(fn.handlers)))
+		for _, handler := range fn.handlers {
+			w.uint64(uint64(handler.Start))
+			w.uint64(uint64(handler.End))
+			w.uint64(uint64(handler.Height))
+			w.uint32(uint32(len(handler.Catches)))
+			for _, catch := range handler.Catches {
+				w.uint32(catch.Tag)
+				w.uint64(uint64(catch.Addr))
+			}
+			w.uint64(uint64(handler.CatchAll))
+			w.uint64(uint64(handler.Local))
+			w.bool(handler.Delegate)
+			w.uint32(uint32(handler.Skip))
+		}
+		w.uint32(uint32(len(fn.sourceOffsets)))
+		for _, offset := range fn.sourceOffsets {
+			w.uint64(uint64(offset.Compiled))
+			w.uint32(uint32(offset.Offset))
+		}
+		w.uint32(uint32(fn.maxDepth))
+		w.uint32(uint32(fn.totalLocalVars))
+		w.bool(fn.native != nil)
+		if fn.native != nil {
+			w.uint32(uint32(fn.native.MaxStack))
+			w.bytes(fn.native.MachineCode())
+		}
+	}
+
+	payload := w.Bytes()
+	checksum := sha256.Sum256(payload)
+
+	out := bytes.NewBuffer(make([]byte, 0, len(payload)+40))
+	out.WriteString(compiledMagic)
+	binary.Write(out, binary.LittleEndian, uint32(compiledVersion))
+	out.Write(checksum[:])
+	out.Write(payload)
+	return out.Bytes(), nil
+}
+
+// DeserializeCompiled reads a Module serialized by CompileSerialize. module
+// must be the decoded module the artifact was compiled from, otherwise
+// ERR_COMPILED_MISMATCH is returned. Native code is executed as is, so
+// artifacts must come from a trusted source, like the node's own storage.
+func DeserializeCompiled(data []byte, module *wasm.Module) (*Module, error) {
+	if len(data) < 40 || string(data[:4]) != compiledMagic {
+		return nil, ERR_COMPILED_FORMAT
+	}
+	if binary.LittleEndian.Uint32(data[4:]) != compiledVersion {
+		return nil, ERR_COMPILED_VERSION
+	}
+	payload := data[40:]
+	if checksum := sha256.Sum256(payload); !bytes.Equal(checksum[:], data[8:40]) {
+		return nil, ERR_COMPILED_CHECKSUM
+	}
+
+	r := &compiledReader{data: payload}
+	fingerprint := moduleFingerprint(module)
+	if !bytes.Equal(r.next(len(fingerprint)), fingerprint[:]) {
+		return nil, ERR_COMPILED_MISMATCH
+	}
+	samePlatform := string(r.bytes()) == runtime.GOOS+"/"+runtime.GOARCH
+
+	m := &Module{module: module}
+	m.config.StaticMemoryBounds = r.bool()
+	m.config.InlineThreshold = int(r.uint32())
+	m.config.AOT = r.bool()
+	m.config.BlockMetering = r.bool()
+	m.config.RelaxedSIMD = r.bool()
+	m.config.CanonicalNaN = r.bool()
+	m.config.SoftFloat = r.bool()
+	m.config.GuestStackCheck = r.bool()
+	m.staticMemorySize = r.uint64()
+
+	if n := r.uint32(); r.err == nil && int(n) != len(module.FunctionIndexSpace) {
+		return nil, ERR_COMPILED_MISMATCH
+	}
+	m.funcs = make([]compiledFunction, len(module.FunctionIndexSpace))
+	for i, fn := range module.FunctionIndexSpace {
+		compiled := compiledFunction{
+			code:     r.bytes(),
+			args:     disasm.Slots(fn.Sig.ParamTypes...),
+			returns:  len(fn.Sig.ReturnTypes) != 0,
+			results:  disasm.Slots(fn.Sig.ReturnTypes...),
+			funcProp: fn,
+		}
+		compiled.branchTables = make([]*compile.BranchTable, r.count(4))
+		for j := range compiled.branchTables {
+			table := &compile.BranchTable{Targets: make([]compile.Target, r.count(21))}
+			for k := range table.Targets {
+				table.Targets[k] = compile.Target{
+					Addr:     int64(r.uint64()),
+					Discard:  int64(r.uint64()),
+					Preserve: int(r.uint32()),
+					Return:   r.bool(),
+				}
+			}
+			compiled.branchTables[j] = table
+		}
+		// every call_indirect site takes more than a byte of code
+		sites := int(r.uint32())
+		if sites > len(compiled.code) {
+			return nil, ERR_COMPILED_FORMAT
+		}
+		compiled.callSites = make([]callSiteCache, sites)
+		if n := r.count(4); n != 0 {
+			compiled.basicBlocks = make([][]byte, n)
+			for j := range compiled.basicBlocks {
+				compiled.basicBlocks[j] = r.bytes()
+			}
+		}
+		if n := r.count(45); n != 0 {
+			compiled.handlers = make([]compile.Handler, n)
+			for j := range compiled.handlers {
+				handler := &compiled.handlers[j]
+				handler.Start = int64(r.uint64())
+				handler.End = int64(r.uint64())
+				handler.Height = int64(r.uint64())
+				handler.Catches = make([]compile.Catch, r.count(12))
+				for k := range handler.Catches {
+					handler.Catches[k] = compile.Catch{Tag: r.uint32(), Addr: int64(r.uint64())}
+				}
+				handler.CatchAll = int64(r.uint64())
+				handler.Local = int64(r.uint64())
+				handler.Delegate = r.bool()
+				handler.Skip = int(r.uint32())
+			}
+		}
+		if n := r.count(12); n != 0 {
+			compiled.sourceOffsets = make([]compile.SourceOffset, n)
+			for j := range compiled.sourceOffsets {
+				compiled.sourceOffsets[j] = compile.SourceOffset{Compiled: int64(r.uint64()), Offset: int(r.uint32())}
+			}
+		}
+		compiled.maxDepth = int(r.uint32())
+		compiled.totalLocalVars = int(r.uint32())
+		if r.bool() {
+			maxStack := int(r.uint32())
+			machineCode := r.bytes()
+			if samePlatform && r.err == nil {
+				// fall back to the interpreter if the code can't be mapped
+				compiled.native, _ = native.Load(machineCode, maxStack)
+			}
+		}
+		if r.err != nil {
+			return nil, ERR_COMPILED_FORMAT
+		}
+		m.funcs[i] = compiled
+	}
+	if r.err != nil || len(r.data) != 0 {
+		return nil, ERR_COMPILED_FORMAT
+	}
+
+	m.typeIDs, m.funcTypeIDs = internSignatures(module)
+	m.setGuestStack()
+	return m, nil
+}
+
+// moduleFingerprint hashes the functions of module, which is enough to
+// tell whether a compiled artifact belongs to it.
+func moduleFingerprint(module *wasm.Module) [sha256.Size]byte {
+	w := &compiledWriter{}
+	w.uint32(uint32(len(module.FunctionIndexSpace)))
+	w.uint32(uint32(len(module.GlobalIndexSpace)))
+	for _, fn := range module.FunctionIndexSpace {
+		w.bool(fn.EnvFunc)
+		w.bytes([]byte(fn.Method))
+		w.uint32(uint32(len(fn.Sig.ParamTypes)))
+		for _, t := range fn.Sig.ParamTypes {
+			w.uint32(uint32(t))
+		}
+		w.uint32(uint32(len(fn.Sig.ReturnTypes)))
+		for _, t := range fn.Sig.ReturnTypes {
+			w.uint32(uint32(t))
+		}
+		if fn.Body == nil {
+			w.uint32(0)
+			continue
+		}
+		// a body failing to decode is hashed as an empty one
+		fn.Body.Decode()
+		w.uint32(uint32(len(fn.Body.Locals)))
+		for _, entry := range fn.Body.Locals {
+			w.uint32(entry.Count)
+			w.WriteByte(byte(entry.Type))
+		}
+		w.bytes(fn.Body.Code)
+	}
+	return sha256.Sum256(w.Bytes())
+}
+
+type compiledWriter struct {
+	bytes.Buffer
+}
+
+func (w *compiledWriter) uint32(v uint32) {
+	binary.Write(w, binary.LittleEndian, v)
+}
+
+func (w *compiledWriter) uint64(v uint64) {
+	binary.Write(w, binary.LittleEndian, v)
+}
+
+func (w *compiledWriter) bool(v bool) {
+	if v {
+		w.WriteByte(1)
+	} else {
+		w.WriteByte(0)
+	}
+}
+
+func (w *compiledWriter) bytes(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.Write(b)
+}
+
+func (w *compiledWriter) values(v []uint64) {
+	w.uint32(uint32(len(v)))
+	for _, x := range v {
+		w.uint64(x)
+	}
+}
+
+// compiledReader reads the values written by compiledWriter. After the
+// first error, every read returns a zero value and err is set.
+type compiledReader struct {
+	data []byte
+	err  error
+}
+
+func (r *compiledReader) next(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.data) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.data[:n:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *compiledReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *compiledReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *compiledReader) bool() bool {
+	if b := r.next(1); b != nil {
+		return b[0] != 0
+	}
+	return false
+}
+
+func (r *compiledReader) bytes() []byte {
+	return r.next(int(r.uint32()))
+}
+
+func (r *compiledReader) values() []uint64 {
+	v := make([]uint64, r.count(8))
+	for i := range v {
+		v[i] = r.uint64()
+	}
+	return v
+}
+
+// count reads the length of a list whose elements take at least size
+// bytes each, and bounds it by the remaining data.
+func (r *compiledReader) count(size int) int {
+	n := int(r.uint32())
+	if n > len(r.data)/size {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func readTestModule(t testing.TB, path string) *wasm.Module {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	module, err := wasm.ReadModule(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return module
+}
+
+func TestDeserializeCompiledErrors(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := compiled.CompileSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := func(i int, b byte) []byte {
+		c := append([]byte(nil), data...)
+		c[i] ^= b
+		return c
+	}
+	for _, test := range []struct {
+		name   string
+		data   []byte
+		module *wasm.Module
+		err    error
+	}{
+		{"truncated", data[:20], module, ERR_COMPILED_FORMAT},
+		{"magic", corrupt(1, 0xff), module, ERR_COMPILED_FORMAT},
+		{"version", corrupt(4, 0xff), module, ERR_COMPILED_VERSION},
+		{"checksum", corrupt(len(data)-1, 0x01), module, ERR_COMPILED_CHECKSUM},
+		{"module", data, readTestModule(t, "testdata/spec/br_table.wasm"), ERR_COMPILED_MISMATCH},
+	} {
+		if _, err := DeserializeCompiled(test.data, test.module); err != test.err {
+			t.Errorf("%s: unexpected error: got=%v, want=%v", test.name, err, test.err)
+		}
+	}
+
+	if _, err := DeserializeCompiled(data, module); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
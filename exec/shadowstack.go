@@ -0,0 +1,188 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"fmt"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// ErrGuestStackOverflow is the error value matched by the
+// GuestStackOverflowError of the overflows of a shadow stack.
+var ErrGuestStackOverflow = newTrap(TrapGuestStackOverflow, "exec: guest stack overflow")
+
+// GuestStackOverflowError is the error value used while trapping the VM
+// when a module sets its shadow stack pointer below the lowest address of
+// its shadow stack, see VMConfig.GuestStackCheck. It matches
+// ErrGuestStackOverflow with errors.Is.
+type GuestStackOverflowError struct {
+	// StackPointer is the value the module set, and Limit the lowest
+	// address of the stack.
+	StackPointer uint32
+	Limit        uint32
+	// Func is the index of the function setting the stack pointer, and
+	// Name its name in the name section, if any.
+	Func int64
+	Name string
+}
+
+func (e *GuestStackOverflowError) Error() string {
+	return fmt.Sprintf("%v: stack pointer %d below %d, in %s", ErrGuestStackOverflow, int32(e.StackPointer), e.Limit, describeFunc(e.Func, e.Name))
+}
+
+// Is reports whether target is ErrGuestStackOverflow.
+func (e *GuestStackOverflowError) Is(target error) bool {
+	return target == ErrGuestStackOverflow
+}
+
+// TrapCode returns TrapGuestStackOverflow.
+func (e *GuestStackOverflowError) TrapCode() TrapCode { return TrapGuestStackOverflow }
+
+// stackPointerName is the name of the global holding the shadow stack
+// pointer of the modules linked by wasm-ld, and dataEndName the one of the
+// global holding the end of their data.
+const (
+	stackPointerName = "__stack_pointer"
+	dataEndName      = "__data_end"
+)
+
+// setGuestStack finds the shadow stack pointer of the module of m and the
+// lowest address of its stack, if m checks it.
+//
+// The stack pointer is the global exported, imported or named
+// __stack_pointer, or else the first mutable i32 global the module
+// defines, the way wasm-ld lays the globals out. The stack grows down
+// from the initial value of the pointer to the end of the data below it,
+// which is __data_end if exported: a stack laid out first, with
+// --stack-first as Rust does, ends at address 0, the pointer wrapping
+// around to a negative value when it overflows.
+func (m *Module) setGuestStack() {
+	m.stackSlot = -1
+	if !m.config.GuestStackCheck {
+		return
+	}
+	module := m.module
+	index, ok := stackPointer(module)
+	if !ok || index >= len(module.GlobalIndexSpace) {
+		return
+	}
+	global := module.GlobalIndexSpace[index]
+	if global.Type == nil || global.Type.Type != wasm.ValueTypeI32 || !global.Type.Mutable {
+		return
+	}
+	v, err := module.ExecInitExpr(global.Init)
+	top, isI32 := v.(int32)
+	if err != nil || !isI32 || top < 0 {
+		return
+	}
+
+	var limit int64
+	below := func(start int64, end int64) {
+		if start < int64(top) && end <= int64(top) && end > limit {
+			limit = end
+		}
+	}
+	for _, e := range module.Exports() {
+		if e.FieldStr == dataEndName && e.Kind == wasm.ExternalGlobal && int(e.Index) < len(module.GlobalIndexSpace) {
+			if v, err := module.ExecInitExpr(module.GlobalIndexSpace[e.Index].Init); err == nil {
+				if end, ok := v.(int32); ok {
+					below(0, int64(uint32(end)))
+				}
+			}
+		}
+	}
+	if segments, err := module.DataSegments(); err == nil {
+		for _, segment := range segments {
+			if segment.Mode == wasm.SegmentActive && segment.Memory == 0 && len(segment.Data) != 0 {
+				below(int64(segment.Offset), int64(segment.End()))
+			}
+		}
+	}
+	m.stackSlot = int(disasm.GlobalSlots(module)[index])
+	m.stackLimit = uint32(limit)
+}
+
+// stackPointer returns the index of the shadow stack pointer of module.
+func stackPointer(module *wasm.Module) (int, bool) {
+	for _, e := range module.Exports() {
+		if e.FieldStr == stackPointerName && e.Kind == wasm.ExternalGlobal {
+			return int(e.Index), true
+		}
+	}
+	imported := 0
+	if module.Import != nil {
+		for _, entry := range module.Import.Entries {
+			if entry.Kind != wasm.ExternalGlobal {
+				continue
+			}
+			if entry.FieldName == stackPointerName {
+				return imported, true
+			}
+			imported++
+		}
+	}
+	for index, name := range module.Names().Entries[wasm.NamesGlobals] {
+		if name == stackPointerName {
+			return int(index), true
+		}
+	}
+	for i, global := range module.GlobalIndexSpace[imported:] {
+		if global.Type != nil && global.Type.Type == wasm.ValueTypeI32 && global.Type.Mutable {
+			return imported + i, true
+		}
+	}
+	return 0, false
+}
+
+// setsStackPointer returns whether instrs set the checked shadow stack
+// pointer of m.
+func (m *Module) setsStackPointer(instrs []disasm.Instr) bool {
+	if m.stackSlot < 0 {
+		return false
+	}
+	for _, instr := range instrs {
+		if instr.Op.Code == ops.SetGlobal && int(instr.Slot) == m.stackSlot {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGuestStack makes vm check the values global.set gives the shadow
+// stack pointer.
+func (vm *VM) checkGuestStack() {
+	vm.funcTable[ops.SetGlobal] = vm.setGlobalChecked
+}
+
+// setGlobalChecked runs global.set, trapping when it sets the shadow stack
+// pointer below the lowest address of the stack.
+func (vm *VM) setGlobalChecked() {
+	index := vm.fetchUint32()
+	v := vm.popUint64()
+	if int(index) == vm.compiled.stackSlot && int32(v) < int32(vm.compiled.stackLimit) {
+		panic(&GuestStackOverflowError{
+			StackPointer: uint32(v),
+			Limit:        vm.compiled.stackLimit,
+			Func:         vm.ctx.curFunc,
+			Name:         vm.funcName(vm.ctx.curFunc),
+		})
+	}
+	vm.globals[int(index)] = v
+}
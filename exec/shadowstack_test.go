@@ -0,0 +1,87 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestGuestStackCheck(t *testing.T) {
+	module := readTestModule(t, "testdata/shadow-stack.wasm")
+	recurse := int64(module.Export.Entries["recurse"].Index)
+	data := binary.LittleEndian.Uint32([]byte("0123"))
+
+	for _, config := range []VMConfig{{GuestStackCheck: true}, {GuestStackCheck: true, AOT: true}} {
+		vm, err := NewVMWithConfig(module, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the stack holds 15 frames between 2048 and the end of the data
+		if res, err := vm.ExecCode(recurse, 14); err != nil || res != data {
+			t.Fatalf("15 frames: got=%v, %v", res, err)
+		}
+		trapped := func() (err error) {
+			defer func() { err, _ = recover().(error) }()
+			vm.ExecCode(recurse, 15)
+			return nil
+		}()
+		var overflow *GuestStackOverflowError
+		if !errors.As(trapped, &overflow) || !errors.Is(trapped, ErrGuestStackOverflow) || TrapCodeOf(trapped) != TrapGuestStackOverflow {
+			t.Fatalf("16 frames: got=%v", trapped)
+		}
+		if overflow.StackPointer != 1024 || overflow.Limit != 1040 || overflow.Func != recurse {
+			t.Errorf("16 frames: got=%+v", overflow)
+		}
+	}
+
+	// unchecked, the stack silently overwrites the data
+	vm, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := vm.ExecCode(recurse, 15); err != nil || res == data {
+		t.Fatalf("16 frames unchecked: got=%v, %v", res, err)
+	}
+}
+
+func TestGuestStackLayout(t *testing.T) {
+	module := readTestModule(t, "testdata/shadow-stack.wasm")
+	compiled, err := CompileModule(module, VMConfig{GuestStackCheck: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compiled.stackSlot != 0 || compiled.stackLimit != 1040 {
+		t.Errorf("stack pointer in slot %d, limit %d, want 0 and 1040", compiled.stackSlot, compiled.stackLimit)
+	}
+	// the module serialized checks its stack as well
+	data, err := compiled.CompileSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := DeserializeCompiled(data, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.config.GuestStackCheck || loaded.stackSlot != 0 || loaded.stackLimit != 1040 {
+		t.Errorf("deserialized: stack pointer in slot %d, limit %d", loaded.stackSlot, loaded.stackLimit)
+	}
+	if compiled, err = CompileModule(module, VMConfig{}); err != nil || compiled.stackSlot != -1 {
+		t.Errorf("unchecked: stack pointer in slot %d, %v", compiled.stackSlot, err)
+	}
+}
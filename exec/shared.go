@@ -0,0 +1,132 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"runtime"
+	"sync"
+)
+
+// sharedMemory is the state of a linear memory declared shared, which an
+// instance shares with the instances spawned from it by Spawn, running on
+// other goroutines. The memory never moves: its capacity is its maximum
+// size, so that growing it only changes its length, which every instance
+// catches up with, see syncMemory.
+type sharedMemory struct {
+	// mu guards the fields below, the atomic operators and memory.grow
+	mu sync.Mutex
+	// the length of the memory
+	size int
+	// the number of instances sharing the memory
+	refs int
+	// the agents waiting in memory.atomic.wait, by address, in the order
+	// they started waiting
+	waiters map[uint64][]chan struct{}
+	// the memory of a Store owning the memory, which isn't necessarily
+	// declared shared, and is never released to a MemoryPool
+	store *storeMemory
+}
+
+// release removes an instance from the ones sharing s, and returns whether
+// it was the last one.
+func (s *sharedMemory) release() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs--
+	return s.refs == 0
+}
+
+// syncMemory catches up with the length of the shared memory of inst, if
+// any, which other instances may have grown. It is called when a call
+// starts, by memory.size and memory.grow, and by the atomic operators.
+func (inst *Instance) syncMemory() {
+	if s := inst.shared; s != nil {
+		s.mu.Lock()
+		inst.memory = inst.memory[:s.size]
+		s.mu.Unlock()
+	}
+}
+
+// lockMemory locks the shared memory of inst, if any, for an atomic
+// operator, and catches up with its length.
+func (inst *Instance) lockMemory() {
+	if s := inst.shared; s != nil {
+		s.mu.Lock()
+		inst.memory = inst.memory[:s.size]
+	}
+}
+
+func (inst *Instance) unlockMemory() {
+	if s := inst.shared; s != nil {
+		s.mu.Unlock()
+	}
+}
+
+// Spawn returns a new instance of the module of inst sharing its linear
+// memory, which must be declared shared, to run a thread on another
+// goroutine. The memory isn't initialized again and the start function
+// doesn't run, but the new instance has its own tables and globals, set
+// to their initial values. The other memories of inst, which can't be
+// shared, are copied.
+//
+// The instances sharing a memory may run concurrently. The atomic
+// operators and memory.grow are serialized, while the other accesses to
+// the memory race as they do between wasm threads. The memory is released
+// once all the instances sharing it are closed.
+func (inst *Instance) Spawn() (*Instance, error) {
+	if inst.closed {
+		return nil, ERR_INSTANCE_CLOSED
+	}
+	s := inst.shared
+	if s == nil {
+		return nil, ERR_MEMORY_NOT_SHARED
+	}
+	s.mu.Lock()
+	s.refs++
+	memory := inst.memory[:s.size]
+	s.mu.Unlock()
+
+	spawned := &Instance{
+		compiled:      inst.compiled,
+		imports:       inst.imports,
+		memory:        memory,
+		mapping:       inst.mapping,
+		committed:     inst.committed,
+		shared:        s,
+		memory64:      inst.memory64,
+		pageSize:      inst.pageSize,
+		memories:      copyMemories(inst.memories),
+		initialMemory: inst.initialMemory,
+		maxMemory:     inst.maxMemory,
+		tags:          inst.tags,
+		memPos:        inst.memPos,
+		memType:       make(map[uint64]*typeInfo, len(inst.memType)),
+	}
+	for addr, info := range inst.memType {
+		copied := *info
+		spawned.memType[addr] = &copied
+	}
+	runtime.SetFinalizer(spawned, (*Instance).finalize)
+
+	if err := spawned.initState(); err != nil {
+		spawned.Close()
+		return nil, err
+	}
+	spawned.closeExpected = true
+	return spawned, nil
+}
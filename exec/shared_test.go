@@ -0,0 +1,98 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpawn(t *testing.T) {
+	module := readTestModule(t, "testdata/atomic.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	thread, err := inst.Spawn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer thread.Close()
+
+	call := func(inst *Instance, name string) interface{} {
+		res, err := inst.NewVM().ExecCode(int64(module.Export.Entries[name].Index))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return res
+	}
+
+	// the thread waits until notified by the main instance
+	woken := make(chan interface{})
+	go func() { woken <- call(thread, "wait-flag") }()
+	for call(inst, "notify-flag") == uint32(0) {
+	}
+	if res := <-woken; res != uint32(0) {
+		t.Errorf("wait-flag: got=%v, want=0", res)
+	}
+
+	// the stores and the growth of the memory are shared
+	call(inst, "store-load")
+	if got := thread.Memory()[8]; got != 0xff {
+		t.Errorf("store shared: got=%#x, want=0xff", got)
+	}
+	call(inst, "grow")
+	if res := call(thread, "size"); res != uint32(2) {
+		t.Errorf("size: got=%v, want=2", res)
+	}
+
+	if err := inst.Reset(); err != ERR_MEMORY_SHARED {
+		t.Errorf("Reset: got=%v, want=%v", err, ERR_MEMORY_SHARED)
+	}
+	unshared, err := NewVM(readTestModule(t, "testdata/atomic-unshared.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unshared.Spawn(); err != ERR_MEMORY_NOT_SHARED {
+		t.Errorf("Spawn: got=%v, want=%v", err, ERR_MEMORY_NOT_SHARED)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	module := readTestModule(t, "testdata/atomic.wasm")
+	compiled, err := CompileModule(module, VMConfig{MaxExecutionTime: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	// nothing notifies the waiter, which is interrupted like a loop
+	_, err = inst.NewVM().ExecCode(int64(module.Export.Entries["wait-flag"].Index))
+	if err != TimeoutError(20*time.Millisecond) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"io"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+// SIGNATURE_SECTION is the name of the custom section holding the
+// signature of a module, see SignModule.
+const SIGNATURE_SECTION = "signature"
+
+// SignModule returns the wasm bytes code signed with key, by appending a
+// signature section to them: a custom section named SIGNATURE_SECTION
+// holding the public key of key then the ed25519 signature of the bytes
+// before the section. The signature section of a module already signed is
+// replaced.
+func SignModule(code []byte, key ed25519.PrivateKey) ([]byte, error) {
+	signed, _, err := moduleSignature(code)
+	if err != nil {
+		return nil, err
+	}
+	var payload bytes.Buffer
+	writeName(&payload, SIGNATURE_SECTION)
+	payload.Write(key.Public().(ed25519.PublicKey))
+	payload.Write(ed25519.Sign(key, signed))
+
+	out := bytes.NewBuffer(make([]byte, 0, len(signed)+payload.Len()+8))
+	out.Write(signed)
+	writeSection(out, wasm.SectionIDCustom, payload.Bytes())
+	return out.Bytes(), nil
+}
+
+// VerifySignature checks that the wasm bytes code are signed by one of the
+// trusted keys, see SignModule, before they are even decoded. It returns
+// ERR_MODULE_UNSIGNED if the module has no signature section or if it
+// isn't the last section, ERR_MODULE_UNTRUSTED if the key of the section
+// isn't one of trusted, and ERR_MODULE_SIGNATURE if the signature isn't
+// valid, as for a module whose bytes were changed since it was signed.
+func VerifySignature(code []byte, trusted []ed25519.PublicKey) error {
+	signed, sig, err := moduleSignature(code)
+	if err != nil {
+		return err
+	}
+	if sig == nil {
+		return ERR_MODULE_UNSIGNED
+	}
+	if len(sig) != ed25519.PublicKeySize+ed25519.SignatureSize {
+		return ERR_MODULE_SIGNATURE
+	}
+	key := ed25519.PublicKey(sig[:ed25519.PublicKeySize])
+	for _, k := range trusted {
+		if k.Equal(key) {
+			if !ed25519.Verify(key, signed, sig[ed25519.PublicKeySize:]) {
+				return ERR_MODULE_SIGNATURE
+			}
+			return nil
+		}
+	}
+	return ERR_MODULE_UNTRUSTED
+}
+
+// moduleSignature walks the sections of code, and returns the bytes before
+// its last section and the payload of the section if it is a signature
+// section, or all of code and nil if it isn't. A signature section
+// elsewhere makes the module unsigned.
+func moduleSignature(code []byte) ([]byte, []byte, error) {
+	if len(code) < 8 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	if binary.LittleEndian.Uint32(code) != wasm.Magic {
+		return nil, nil, wasm.ErrInvalidMagic
+	}
+	r := bytes.NewReader(code[8:])
+	var start int
+	var sig []byte
+	for r.Len() > 0 {
+		if sig != nil {
+			return nil, nil, ERR_MODULE_UNSIGNED
+		}
+		start = len(code) - r.Len()
+		id, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		size, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if uint32(r.Len()) < size {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		end := len(code) - r.Len() + int(size)
+		if wasm.SectionID(id) == wasm.SectionIDCustom {
+			payload := code[end-int(size) : end]
+			n, k, err := leb128.ReadVarUint32Size(bytes.NewReader(payload))
+			if err != nil {
+				return nil, nil, err
+			}
+			if uint64(k)+uint64(n) > uint64(len(payload)) {
+				return nil, nil, io.ErrUnexpectedEOF
+			}
+			if string(payload[k:int(k)+int(n)]) == SIGNATURE_SECTION {
+				sig = payload[int(k)+int(n):]
+			}
+		}
+		r.Seek(int64(end-8), io.SeekStart)
+	}
+	if sig == nil {
+		return code, nil, nil
+	}
+	return code[:start], sig, nil
+}
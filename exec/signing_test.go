@@ -0,0 +1,83 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestModuleSigning(t *testing.T) {
+	code := readTestCode(t, "testdata/spec/fac.wasm")
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize))
+	trusted := []ed25519.PublicKey{key.Public().(ed25519.PublicKey)}
+
+	signed, err := SignModule(code, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(signed[:len(code)], code) {
+		t.Fatal("signing changed the module")
+	}
+	if err := VerifySignature(signed, trusted); err != nil {
+		t.Errorf("signed: %v", err)
+	}
+	if err := VerifySignature(code, trusted); err != ERR_MODULE_UNSIGNED {
+		t.Errorf("unsigned: got=%v, want=%v", err, ERR_MODULE_UNSIGNED)
+	}
+
+	// signing again replaces the signature
+	resigned, err := SignModule(signed, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resigned) != len(signed) {
+		t.Errorf("resigned: got=%d bytes, want=%d", len(resigned), len(signed))
+	}
+	if err := VerifySignature(resigned, trusted); err != ERR_MODULE_UNTRUSTED {
+		t.Errorf("untrusted: got=%v, want=%v", err, ERR_MODULE_UNTRUSTED)
+	}
+
+	tampered := append([]byte(nil), signed...)
+	tampered[len(code)-1] ^= 1
+	if err := VerifySignature(tampered, trusted); err != ERR_MODULE_SIGNATURE {
+		t.Errorf("tampered: got=%v, want=%v", err, ERR_MODULE_SIGNATURE)
+	}
+	// a section after the signature isn't signed
+	appended := append(append([]byte(nil), signed...), 0, 2, 1, 'x')
+	if err := VerifySignature(appended, trusted); err != ERR_MODULE_UNSIGNED {
+		t.Errorf("appended: got=%v, want=%v", err, ERR_MODULE_UNSIGNED)
+	}
+	if err := VerifySignature(signed[:len(signed)-1], trusted); err == nil {
+		t.Error("truncated: no error")
+	}
+
+	cache := NewModuleCache(VMConfig{TrustedKeys: trusted}, nil, 2, 1<<20)
+	if _, err := cache.Load(code); err != ERR_MODULE_UNSIGNED {
+		t.Errorf("cache: got=%v, want=%v", err, ERR_MODULE_UNSIGNED)
+	}
+	module, err := cache.Load(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other := module.Wasm().Other; len(other) == 0 || other[len(other)-1].Name != SIGNATURE_SECTION {
+		t.Errorf("the signature section wasn't kept: %v", other)
+	}
+}
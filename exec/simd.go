@@ -0,0 +1,845 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// A v128 value takes two slots of the stack, its low 64 bits below its
+// high 64 bits. The SIMD operators are emulated lane by lane.
+
+// simdFuncs are the implementations of the SIMD operators, indexed by
+// sub-opcode.
+var simdFuncs [512]func(vm *VM)
+
+// simd runs the operator prefixed by ops.PrefixSIMD, whose sub-opcode
+// follows the prefix as a uint32.
+func (vm *VM) simd() {
+	sub := vm.fetchUint32()
+	if vm.simdCosts != nil {
+		vm.consumeGas(GasSIMD, vm.simdCosts[sub])
+	}
+	if vm.config.SoftFloat && softSIMDFuncs[sub] != nil {
+		softSIMDFuncs[sub](vm)
+	} else {
+		simdFuncs[sub](vm)
+	}
+	if vm.config.CanonicalNaN && simdNaNLanes[sub] != 0 {
+		vm.canonicalizeV128(simdNaNLanes[sub])
+	}
+}
+
+func v128Value(lo, hi uint64) wasm.V128 {
+	var v wasm.V128
+	endianess.PutUint64(v[:8], lo)
+	endianess.PutUint64(v[8:], hi)
+	return v
+}
+
+func (vm *VM) popV128() wasm.V128 {
+	hi := vm.popUint64()
+	return v128Value(vm.popUint64(), hi)
+}
+
+func (vm *VM) pushV128(v wasm.V128) {
+	vm.pushUint64(endianess.Uint64(v[:8]))
+	vm.pushUint64(endianess.Uint64(v[8:]))
+}
+
+func (vm *VM) selectV128() {
+	c := vm.popUint32()
+	v2 := vm.popV128()
+	v1 := vm.popV128()
+	if c != 0 {
+		vm.pushV128(v1)
+	} else {
+		vm.pushV128(v2)
+	}
+}
+
+// fetchLane reads a lane index immediate.
+func (vm *VM) fetchLane() int {
+	lane := vm.ctx.code[vm.ctx.pc]
+	vm.ctx.pc++
+	return int(lane)
+}
+
+// lane returns the lane i of v, of the given number of bits, zero extended.
+func lane(v *wasm.V128, size, i int) uint64 {
+	switch size {
+	case 8:
+		return uint64(v[i])
+	case 16:
+		return uint64(endianess.Uint16(v[2*i:]))
+	case 32:
+		return uint64(endianess.Uint32(v[4*i:]))
+	default:
+		return endianess.Uint64(v[8*i:])
+	}
+}
+
+// setLane sets the lane i of v, of the given number of bits, to the low
+// bits of x.
+func setLane(v *wasm.V128, size, i int, x uint64) {
+	switch size {
+	case 8:
+		v[i] = byte(x)
+	case 16:
+		endianess.PutUint16(v[2*i:], uint16(x))
+	case 32:
+		endianess.PutUint32(v[4*i:], uint32(x))
+	default:
+		endianess.PutUint64(v[8*i:], x)
+	}
+}
+
+// signed returns the lane x of the given number of bits, sign extended.
+func signed(x uint64, size int) int64 {
+	shift := uint(64 - size)
+	return int64(x<<shift) >> shift
+}
+
+// saturateS and saturateU clamp x to the range of the signed and unsigned
+// integers of the given number of bits.
+func saturateS(x int64, size int) uint64 {
+	max := int64(1)<<uint(size-1) - 1
+	switch {
+	case x > max:
+		x = max
+	case x < -max-1:
+		x = -max - 1
+	}
+	return uint64(x)
+}
+
+func saturateU(x int64, size int) uint64 {
+	max := int64(1)<<uint(size) - 1
+	switch {
+	case x > max:
+		x = max
+	case x < 0:
+		x = 0
+	}
+	return uint64(x)
+}
+
+func mask(b bool) uint64 {
+	if b {
+		return math.MaxUint64
+	}
+	return 0
+}
+
+// unop and binop return the operators applying f to every lane of the
+// given number of bits of their operands.
+func unop(size int, f func(x uint64) uint64) func(*VM) {
+	return func(vm *VM) {
+		v := vm.popV128()
+		for i := 0; i < 128/size; i++ {
+			setLane(&v, size, i, f(lane(&v, size, i)))
+		}
+		vm.pushV128(v)
+	}
+}
+
+func binop(size int, f func(x, y uint64) uint64) func(*VM) {
+	return func(vm *VM) {
+		b, a := vm.popV128(), vm.popV128()
+		for i := 0; i < 128/size; i++ {
+			setLane(&a, size, i, f(lane(&a, size, i), lane(&b, size, i)))
+		}
+		vm.pushV128(a)
+	}
+}
+
+// binopS is binop for f taking the lanes as signed integers.
+func binopS(size int, f func(x, y int64) int64) func(*VM) {
+	return binop(size, func(x, y uint64) uint64 {
+		return uint64(f(signed(x, size), signed(y, size)))
+	})
+}
+
+// cmp and cmpS return the comparisons setting the lanes for which f is
+// true, f taking the lanes as unsigned or signed integers.
+func cmp(size int, f func(x, y uint64) bool) func(*VM) {
+	return binop(size, func(x, y uint64) uint64 { return mask(f(x, y)) })
+}
+
+func cmpS(size int, f func(x, y int64) bool) func(*VM) {
+	return binop(size, func(x, y uint64) uint64 {
+		return mask(f(signed(x, size), signed(y, size)))
+	})
+}
+
+// shift returns the shift of the lanes of the given number of bits by the
+// i32 operand, modulo the lane size.
+func shift(size int, f func(x uint64, n uint) uint64) func(*VM) {
+	return func(vm *VM) {
+		n := uint(vm.popUint32()) % uint(size)
+		v := vm.popV128()
+		for i := 0; i < 128/size; i++ {
+			setLane(&v, size, i, f(lane(&v, size, i), n))
+		}
+		vm.pushV128(v)
+	}
+}
+
+func f32Unop(f func(x float32) float32) func(*VM) {
+	return unop(32, func(x uint64) uint64 {
+		return uint64(math.Float32bits(f(math.Float32frombits(uint32(x)))))
+	})
+}
+
+func f32Binop(f func(x, y float32) float32) func(*VM) {
+	return binop(32, func(x, y uint64) uint64 {
+		return uint64(math.Float32bits(f(math.Float32frombits(uint32(x)), math.Float32frombits(uint32(y)))))
+	})
+}
+
+func f32Cmp(f func(x, y float32) bool) func(*VM) {
+	return binop(32, func(x, y uint64) uint64 {
+		return mask(f(math.Float32frombits(uint32(x)), math.Float32frombits(uint32(y))))
+	})
+}
+
+func f64Unop(f func(x float64) float64) func(*VM) {
+	return unop(64, func(x uint64) uint64 {
+		return math.Float64bits(f(math.Float64frombits(x)))
+	})
+}
+
+func f64Binop(f func(x, y float64) float64) func(*VM) {
+	return binop(64, func(x, y uint64) uint64 {
+		return math.Float64bits(f(math.Float64frombits(x), math.Float64frombits(y)))
+	})
+}
+
+func f64Cmp(f func(x, y float64) bool) func(*VM) {
+	return binop(64, func(x, y uint64) uint64 {
+		return mask(f(math.Float64frombits(x), math.Float64frombits(y)))
+	})
+}
+
+// convert returns the operator setting the lanes of the given number of
+// bits of its result to f applied to the lanes of from bits of its operand,
+// starting at the lane first. The lanes of the result past the converted
+// ones are zeroed.
+func convert(size, from, first, n int, f func(x uint64) uint64) func(*VM) {
+	return func(vm *VM) {
+		v := vm.popV128()
+		var r wasm.V128
+		for i := 0; i < n; i++ {
+			setLane(&r, size, i, f(lane(&v, from, first+i)))
+		}
+		vm.pushV128(r)
+	}
+}
+
+// extend returns the operator extending the low or high half of the lanes
+// of the given number of bits of its operand to lanes twice as large.
+func extend(size int, high, sign bool) func(*VM) {
+	first := 0
+	if high {
+		first = 64 / size
+	}
+	return convert(2*size, size, first, 64/size, func(x uint64) uint64 {
+		if sign {
+			return uint64(signed(x, size))
+		}
+		return x
+	})
+}
+
+// extmul returns the operator multiplying the extended low or high half of
+// the lanes of the given number of bits of its operands.
+func extmul(size int, high, sign bool) func(*VM) {
+	first := 0
+	if high {
+		first = 64 / size
+	}
+	return func(vm *VM) {
+		b, a := vm.popV128(), vm.popV128()
+		var r wasm.V128
+		for i := 0; i < 64/size; i++ {
+			x, y := lane(&a, size, first+i), lane(&b, size, first+i)
+			if sign {
+				x, y = uint64(signed(x, size)), uint64(signed(y, size))
+			}
+			setLane(&r, 2*size, i, x*y)
+		}
+		vm.pushV128(r)
+	}
+}
+
+// extaddPairwise returns the operator adding the pairs of adjacent lanes
+// of the given number of bits of its operand into lanes twice as large.
+func extaddPairwise(size int, sign bool) func(*VM) {
+	return func(vm *VM) {
+		v := vm.popV128()
+		var r wasm.V128
+		for i := 0; i < 64/size; i++ {
+			x, y := lane(&v, size, 2*i), lane(&v, size, 2*i+1)
+			if sign {
+				x, y = uint64(signed(x, size)), uint64(signed(y, size))
+			}
+			setLane(&r, 2*size, i, x+y)
+		}
+		vm.pushV128(r)
+	}
+}
+
+// narrow returns the operator narrowing the signed lanes of the given
+// number of bits of its operands to lanes half as large, with saturation.
+func narrow(size int, sign bool) func(*VM) {
+	return func(vm *VM) {
+		b, a := vm.popV128(), vm.popV128()
+		var r wasm.V128
+		n := 128 / size
+		for i := 0; i < 2*n; i++ {
+			src := &a
+			if i >= n {
+				src = &b
+			}
+			x := signed(lane(src, size, i%n), size)
+			if sign {
+				setLane(&r, size/2, i, saturateS(x, size/2))
+			} else {
+				setLane(&r, size/2, i, saturateU(x, size/2))
+			}
+		}
+		vm.pushV128(r)
+	}
+}
+
+// allTrue returns the operator testing whether all the lanes of the given
+// number of bits of its operand are non-zero.
+func allTrue(size int) func(*VM) {
+	return func(vm *VM) {
+		v := vm.popV128()
+		for i := 0; i < 128/size; i++ {
+			if lane(&v, size, i) == 0 {
+				vm.pushInt32(0)
+				return
+			}
+		}
+		vm.pushInt32(1)
+	}
+}
+
+// bitmask returns the operator gathering the high bits of the lanes of
+// the given number of bits of its operand.
+func bitmask(size int) func(*VM) {
+	return func(vm *VM) {
+		v := vm.popV128()
+		var m uint32
+		for i := 0; i < 128/size; i++ {
+			m |= uint32(lane(&v, size, i)>>uint(size-1)) << uint(i)
+		}
+		vm.pushUint32(m)
+	}
+}
+
+// splat returns the operator setting all the lanes of the given number of
+// bits to its scalar operand.
+func splat(size int) func(*VM) {
+	return func(vm *VM) {
+		x := vm.popUint64()
+		var v wasm.V128
+		for i := 0; i < 128/size; i++ {
+			setLane(&v, size, i, x)
+		}
+		vm.pushV128(v)
+	}
+}
+
+// extractLane returns the operator pushing a lane of the given number of
+// bits, sign extended to an i32 if sign is set.
+func extractLane(size int, sign bool) func(*VM) {
+	return func(vm *VM) {
+		i := vm.fetchLane()
+		v := vm.popV128()
+		x := lane(&v, size, i)
+		if sign {
+			x = uint64(uint32(signed(x, size)))
+		}
+		vm.pushUint64(x)
+	}
+}
+
+func replaceLane(size int) func(*VM) {
+	return func(vm *VM) {
+		i := vm.fetchLane()
+		x := vm.popUint64()
+		v := vm.popV128()
+		setLane(&v, size, i, x)
+		vm.pushV128(v)
+	}
+}
+
+// simdMemory returns the n bytes of linear memory accessed by a SIMD load
+// or store, whose address operand is on the top of the stack, trapping if
+// they are out of bounds.
+func (vm *VM) simdMemory(n int) []byte {
+	vm.checkSIMDMemory(n)
+	return vm.curMem()[:n]
+}
+
+// simdStoreMemory returns the n bytes a store writes like simdMemory,
+// recording the write.
+func (vm *VM) simdStoreMemory(n int) []byte {
+	vm.checkSIMDMemory(n)
+	return vm.storeMem(uint64(n))[:n]
+}
+
+// checkSIMDMemory traps the VM if the n bytes of the next access aren't
+// in the memory.
+func (vm *VM) checkSIMDMemory(n int) {
+	if !vm.inBounds(n - 1) {
+		err := vm.memoryAccessError(n)
+		err.Offset = vm.ctx.pc - 5 // the prefix and the sub-opcode
+		panic(err)
+	}
+}
+
+// loadExtend returns the load of 8 bytes extended to lanes of the given
+// number of bits.
+func loadExtend(size int, sign bool) func(*VM) {
+	return func(vm *VM) {
+		mem := vm.simdMemory(8)
+		var src, v wasm.V128
+		copy(src[:], mem)
+		for i := 0; i < 64/size; i++ {
+			x := lane(&src, size, i)
+			if sign {
+				x = uint64(signed(x, size))
+			}
+			setLane(&v, 2*size, i, x)
+		}
+		vm.pushV128(v)
+	}
+}
+
+func loadSplat(size int) func(*VM) {
+	return func(vm *VM) {
+		var src, v wasm.V128
+		copy(src[:], vm.simdMemory(size/8))
+		x := lane(&src, size, 0)
+		for i := 0; i < 128/size; i++ {
+			setLane(&v, size, i, x)
+		}
+		vm.pushV128(v)
+	}
+}
+
+func loadZero(size int) func(*VM) {
+	return func(vm *VM) {
+		var v wasm.V128
+		copy(v[:], vm.simdMemory(size/8))
+		vm.pushV128(v)
+	}
+}
+
+func loadLane(size int) func(*VM) {
+	return func(vm *VM) {
+		v := vm.popV128()
+		mem := vm.simdMemory(size / 8)
+		copy(v[vm.fetchLane()*size/8:], mem)
+		vm.pushV128(v)
+	}
+}
+
+func storeLane(size int) func(*VM) {
+	return func(vm *VM) {
+		v := vm.popV128()
+		mem := vm.simdStoreMemory(size / 8)
+		i := vm.fetchLane()
+		copy(mem, v[i*size/8:(i+1)*size/8])
+	}
+}
+
+func (vm *VM) v128Load() {
+	var v wasm.V128
+	copy(v[:], vm.simdMemory(16))
+	vm.pushV128(v)
+}
+
+func (vm *VM) v128Store() {
+	v := vm.popV128()
+	copy(vm.simdStoreMemory(16), v[:])
+}
+
+func (vm *VM) v128Const() {
+	var v wasm.V128
+	copy(v[:], vm.ctx.code[vm.ctx.pc:])
+	vm.ctx.pc += 16
+	vm.pushV128(v)
+}
+
+func (vm *VM) i8x16Shuffle() {
+	var lanes wasm.V128
+	copy(lanes[:], vm.ctx.code[vm.ctx.pc:])
+	vm.ctx.pc += 16
+	b, a := vm.popV128(), vm.popV128()
+	var r wasm.V128
+	for i, l := range lanes {
+		if l < 16 {
+			r[i] = a[l]
+		} else {
+			r[i] = b[l-16]
+		}
+	}
+	vm.pushV128(r)
+}
+
+func (vm *VM) i8x16Swizzle() {
+	s, a := vm.popV128(), vm.popV128()
+	var r wasm.V128
+	for i, l := range s {
+		if l < 16 {
+			r[i] = a[l]
+		}
+	}
+	vm.pushV128(r)
+}
+
+func (vm *VM) v128AnyTrue() {
+	v := vm.popV128()
+	vm.pushBool(v != wasm.V128{})
+}
+
+func (vm *VM) v128Bitselect() {
+	c, b, a := vm.popV128(), vm.popV128(), vm.popV128()
+	for i := range a {
+		a[i] = a[i]&c[i] | b[i]&^c[i]
+	}
+	vm.pushV128(a)
+}
+
+func (vm *VM) i32x4DotI16x8S() {
+	b, a := vm.popV128(), vm.popV128()
+	var r wasm.V128
+	for i := 0; i < 4; i++ {
+		lo := signed(lane(&a, 16, 2*i), 16) * signed(lane(&b, 16, 2*i), 16)
+		hi := signed(lane(&a, 16, 2*i+1), 16) * signed(lane(&b, 16, 2*i+1), 16)
+		setLane(&r, 32, i, uint64(lo+hi))
+	}
+	vm.pushV128(r)
+}
+
+// truncSat32 converts f to a signed or unsigned 32 bits integer, with
+// saturation, NaN being converted to zero.
+func truncSat32(f float64, sign bool) uint64 {
+	switch {
+	case f != f:
+		return 0
+	case sign && f <= math.MinInt32:
+		return uint64(uint32(1 << 31))
+	case sign && f >= math.MaxInt32:
+		return math.MaxInt32
+	case sign:
+		return uint64(uint32(int32(f)))
+	case f <= 0:
+		return 0
+	case f >= math.MaxUint32:
+		return math.MaxUint32
+	}
+	return uint64(uint32(f))
+}
+
+// nearest rounds f to the nearest integer, ties to even.
+func nearest(f float64) float64 {
+	return math.RoundToEven(f)
+}
+
+func intAbs(size int) func(*VM) {
+	return unop(size, func(x uint64) uint64 {
+		if v := signed(x, size); v < 0 {
+			return uint64(-v)
+		}
+		return x
+	})
+}
+
+func init() {
+	simdFuncs[ops.V128Load] = (*VM).v128Load
+	simdFuncs[ops.V128Load8x8S] = loadExtend(8, true)
+	simdFuncs[ops.V128Load8x8U] = loadExtend(8, false)
+	simdFuncs[ops.V128Load16x4S] = loadExtend(16, true)
+	simdFuncs[ops.V128Load16x4U] = loadExtend(16, false)
+	simdFuncs[ops.V128Load32x2S] = loadExtend(32, true)
+	simdFuncs[ops.V128Load32x2U] = loadExtend(32, false)
+	simdFuncs[ops.V128Load8Splat] = loadSplat(8)
+	simdFuncs[ops.V128Load16Splat] = loadSplat(16)
+	simdFuncs[ops.V128Load32Splat] = loadSplat(32)
+	simdFuncs[ops.V128Load64Splat] = loadSplat(64)
+	simdFuncs[ops.V128Store] = (*VM).v128Store
+	simdFuncs[ops.V128Const] = (*VM).v128Const
+	simdFuncs[ops.I8x16Shuffle] = (*VM).i8x16Shuffle
+	simdFuncs[ops.I8x16Swizzle] = (*VM).i8x16Swizzle
+	simdFuncs[ops.I8x16Splat] = splat(8)
+	simdFuncs[ops.I16x8Splat] = splat(16)
+	simdFuncs[ops.I32x4Splat] = splat(32)
+	simdFuncs[ops.I64x2Splat] = splat(64)
+	simdFuncs[ops.F32x4Splat] = splat(32)
+	simdFuncs[ops.F64x2Splat] = splat(64)
+
+	simdFuncs[ops.I8x16ExtractLaneS] = extractLane(8, true)
+	simdFuncs[ops.I8x16ExtractLaneU] = extractLane(8, false)
+	simdFuncs[ops.I8x16ReplaceLane] = replaceLane(8)
+	simdFuncs[ops.I16x8ExtractLaneS] = extractLane(16, true)
+	simdFuncs[ops.I16x8ExtractLaneU] = extractLane(16, false)
+	simdFuncs[ops.I16x8ReplaceLane] = replaceLane(16)
+	simdFuncs[ops.I32x4ExtractLane] = extractLane(32, false)
+	simdFuncs[ops.I32x4ReplaceLane] = replaceLane(32)
+	simdFuncs[ops.I64x2ExtractLane] = extractLane(64, false)
+	simdFuncs[ops.I64x2ReplaceLane] = replaceLane(64)
+	simdFuncs[ops.F32x4ExtractLane] = extractLane(32, false)
+	simdFuncs[ops.F32x4ReplaceLane] = replaceLane(32)
+	simdFuncs[ops.F64x2ExtractLane] = extractLane(64, false)
+	simdFuncs[ops.F64x2ReplaceLane] = replaceLane(64)
+
+	// the integer comparisons, in the same order for every lane size
+	for size, sub := range map[int]uint32{8: ops.I8x16Eq, 16: ops.I16x8Eq, 32: ops.I32x4Eq} {
+		simdFuncs[sub] = cmp(size, func(x, y uint64) bool { return x == y })
+		simdFuncs[sub+1] = cmp(size, func(x, y uint64) bool { return x != y })
+		simdFuncs[sub+2] = cmpS(size, func(x, y int64) bool { return x < y })
+		simdFuncs[sub+3] = cmp(size, func(x, y uint64) bool { return x < y })
+		simdFuncs[sub+4] = cmpS(size, func(x, y int64) bool { return x > y })
+		simdFuncs[sub+5] = cmp(size, func(x, y uint64) bool { return x > y })
+		simdFuncs[sub+6] = cmpS(size, func(x, y int64) bool { return x <= y })
+		simdFuncs[sub+7] = cmp(size, func(x, y uint64) bool { return x <= y })
+		simdFuncs[sub+8] = cmpS(size, func(x, y int64) bool { return x >= y })
+		simdFuncs[sub+9] = cmp(size, func(x, y uint64) bool { return x >= y })
+	}
+	simdFuncs[ops.I64x2Eq] = cmp(64, func(x, y uint64) bool { return x == y })
+	simdFuncs[ops.I64x2Ne] = cmp(64, func(x, y uint64) bool { return x != y })
+	simdFuncs[ops.I64x2LtS] = cmpS(64, func(x, y int64) bool { return x < y })
+	simdFuncs[ops.I64x2GtS] = cmpS(64, func(x, y int64) bool { return x > y })
+	simdFuncs[ops.I64x2LeS] = cmpS(64, func(x, y int64) bool { return x <= y })
+	simdFuncs[ops.I64x2GeS] = cmpS(64, func(x, y int64) bool { return x >= y })
+
+	simdFuncs[ops.F32x4Eq] = f32Cmp(func(x, y float32) bool { return x == y })
+	simdFuncs[ops.F32x4Ne] = f32Cmp(func(x, y float32) bool { return x != y })
+	simdFuncs[ops.F32x4Lt] = f32Cmp(func(x, y float32) bool { return x < y })
+	simdFuncs[ops.F32x4Gt] = f32Cmp(func(x, y float32) bool { return x > y })
+	simdFuncs[ops.F32x4Le] = f32Cmp(func(x, y float32) bool { return x <= y })
+	simdFuncs[ops.F32x4Ge] = f32Cmp(func(x, y float32) bool { return x >= y })
+	simdFuncs[ops.F64x2Eq] = f64Cmp(func(x, y float64) bool { return x == y })
+	simdFuncs[ops.F64x2Ne] = f64Cmp(func(x, y float64) bool { return x != y })
+	simdFuncs[ops.F64x2Lt] = f64Cmp(func(x, y float64) bool { return x < y })
+	simdFuncs[ops.F64x2Gt] = f64Cmp(func(x, y float64) bool { return x > y })
+	simdFuncs[ops.F64x2Le] = f64Cmp(func(x, y float64) bool { return x <= y })
+	simdFuncs[ops.F64x2Ge] = f64Cmp(func(x, y float64) bool { return x >= y })
+
+	simdFuncs[ops.V128Not] = unop(64, func(x uint64) uint64 { return ^x })
+	simdFuncs[ops.V128And] = binop(64, func(x, y uint64) uint64 { return x & y })
+	simdFuncs[ops.V128Andnot] = binop(64, func(x, y uint64) uint64 { return x &^ y })
+	simdFuncs[ops.V128Or] = binop(64, func(x, y uint64) uint64 { return x | y })
+	simdFuncs[ops.V128Xor] = binop(64, func(x, y uint64) uint64 { return x ^ y })
+	simdFuncs[ops.V128Bitselect] = (*VM).v128Bitselect
+	simdFuncs[ops.V128AnyTrue] = (*VM).v128AnyTrue
+
+	simdFuncs[ops.V128Load8Lane] = loadLane(8)
+	simdFuncs[ops.V128Load16Lane] = loadLane(16)
+	simdFuncs[ops.V128Load32Lane] = loadLane(32)
+	simdFuncs[ops.V128Load64Lane] = loadLane(64)
+	simdFuncs[ops.V128Store8Lane] = storeLane(8)
+	simdFuncs[ops.V128Store16Lane] = storeLane(16)
+	simdFuncs[ops.V128Store32Lane] = storeLane(32)
+	simdFuncs[ops.V128Store64Lane] = storeLane(64)
+	simdFuncs[ops.V128Load32Zero] = loadZero(32)
+	simdFuncs[ops.V128Load64Zero] = loadZero(64)
+
+	simdFuncs[ops.F32x4DemoteF64x2Zero] = convert(32, 64, 0, 2, func(x uint64) uint64 {
+		return uint64(math.Float32bits(float32(math.Float64frombits(x))))
+	})
+	simdFuncs[ops.F64x2PromoteLowF32x4] = convert(64, 32, 0, 2, func(x uint64) uint64 {
+		return math.Float64bits(float64(math.Float32frombits(uint32(x))))
+	})
+
+	// the integer arithmetic, the lanes wrapping around unless saturated
+	for size, sub := range map[int]uint32{8: ops.I8x16Abs, 16: ops.I16x8Abs, 32: ops.I32x4Abs, 64: ops.I64x2Abs} {
+		simdFuncs[sub] = intAbs(size)
+		simdFuncs[sub+1] = unop(size, func(x uint64) uint64 { return -x })
+		simdFuncs[sub+3] = allTrue(size)
+		simdFuncs[sub+4] = bitmask(size)
+	}
+	for size, sub := range map[int]uint32{8: ops.I8x16Shl, 16: ops.I16x8Shl, 32: ops.I32x4Shl, 64: ops.I64x2Shl} {
+		size := size
+		simdFuncs[sub] = shift(size, func(x uint64, n uint) uint64 { return x << n })
+		simdFuncs[sub+1] = shift(size, func(x uint64, n uint) uint64 { return uint64(signed(x, size) >> n) })
+		simdFuncs[sub+2] = shift(size, func(x uint64, n uint) uint64 { return x >> n })
+		simdFuncs[sub+3] = binop(size, func(x, y uint64) uint64 { return x + y })
+	}
+	simdFuncs[ops.I16x8Mul] = binop(16, func(x, y uint64) uint64 { return x * y })
+	simdFuncs[ops.I32x4Sub] = binop(32, func(x, y uint64) uint64 { return x - y })
+	simdFuncs[ops.I32x4Mul] = binop(32, func(x, y uint64) uint64 { return x * y })
+	simdFuncs[ops.I64x2Sub] = binop(64, func(x, y uint64) uint64 { return x - y })
+	simdFuncs[ops.I64x2Mul] = binop(64, func(x, y uint64) uint64 { return x * y })
+	for size, sub := range map[int]uint32{8: ops.I8x16Add, 16: ops.I16x8Add} {
+		size := size
+		simdFuncs[sub+1] = binopS(size, func(x, y int64) int64 { return int64(saturateS(x+y, size)) })
+		simdFuncs[sub+2] = binop(size, func(x, y uint64) uint64 { return saturateU(int64(x+y), size) })
+		simdFuncs[sub+3] = binop(size, func(x, y uint64) uint64 { return x - y })
+		simdFuncs[sub+4] = binopS(size, func(x, y int64) int64 { return int64(saturateS(x-y, size)) })
+		simdFuncs[sub+5] = binop(size, func(x, y uint64) uint64 { return saturateU(int64(x)-int64(y), size) })
+	}
+	for size, sub := range map[int]uint32{8: ops.I8x16MinS, 16: ops.I16x8MinS, 32: ops.I32x4MinS} {
+		simdFuncs[sub] = binopS(size, func(x, y int64) int64 {
+			if x < y {
+				return x
+			}
+			return y
+		})
+		simdFuncs[sub+1] = binop(size, func(x, y uint64) uint64 {
+			if x < y {
+				return x
+			}
+			return y
+		})
+		simdFuncs[sub+2] = binopS(size, func(x, y int64) int64 {
+			if x > y {
+				return x
+			}
+			return y
+		})
+		simdFuncs[sub+3] = binop(size, func(x, y uint64) uint64 {
+			if x > y {
+				return x
+			}
+			return y
+		})
+	}
+	simdFuncs[ops.I8x16AvgrU] = binop(8, func(x, y uint64) uint64 { return (x + y + 1) / 2 })
+	simdFuncs[ops.I16x8AvgrU] = binop(16, func(x, y uint64) uint64 { return (x + y + 1) / 2 })
+	simdFuncs[ops.I8x16Popcnt] = unop(8, func(x uint64) uint64 { return uint64(bits.OnesCount64(x)) })
+	simdFuncs[ops.I16x8Q15mulrSatS] = binopS(16, func(x, y int64) int64 {
+		return int64(saturateS((x*y+0x4000)>>15, 16))
+	})
+	simdFuncs[ops.I32x4DotI16x8S] = (*VM).i32x4DotI16x8S
+
+	simdFuncs[ops.I8x16NarrowI16x8S] = narrow(16, true)
+	simdFuncs[ops.I8x16NarrowI16x8U] = narrow(16, false)
+	simdFuncs[ops.I16x8NarrowI32x4S] = narrow(32, true)
+	simdFuncs[ops.I16x8NarrowI32x4U] = narrow(32, false)
+
+	// the extensions, in the same order for every lane size
+	for size, sub := range map[int]uint32{8: ops.I16x8ExtendLowI8x16S, 16: ops.I32x4ExtendLowI16x8S, 32: ops.I64x2ExtendLowI32x4S} {
+		simdFuncs[sub] = extend(size, false, true)
+		simdFuncs[sub+1] = extend(size, true, true)
+		simdFuncs[sub+2] = extend(size, false, false)
+		simdFuncs[sub+3] = extend(size, true, false)
+	}
+	for size, sub := range map[int]uint32{8: ops.I16x8ExtmulLowI8x16S, 16: ops.I32x4ExtmulLowI16x8S, 32: ops.I64x2ExtmulLowI32x4S} {
+		simdFuncs[sub] = extmul(size, false, true)
+		simdFuncs[sub+1] = extmul(size, true, true)
+		simdFuncs[sub+2] = extmul(size, false, false)
+		simdFuncs[sub+3] = extmul(size, true, false)
+	}
+	simdFuncs[ops.I16x8ExtaddPairwiseI8x16S] = extaddPairwise(8, true)
+	simdFuncs[ops.I16x8ExtaddPairwiseI8x16U] = extaddPairwise(8, false)
+	simdFuncs[ops.I32x4ExtaddPairwiseI16x8S] = extaddPairwise(16, true)
+	simdFuncs[ops.I32x4ExtaddPairwiseI16x8U] = extaddPairwise(16, false)
+
+	// the sign of floats is set on their bits, which preserves NaNs
+	simdFuncs[ops.F32x4Abs] = unop(32, func(x uint64) uint64 { return x &^ (1 << 31) })
+	simdFuncs[ops.F32x4Neg] = unop(32, func(x uint64) uint64 { return x ^ (1 << 31) })
+	simdFuncs[ops.F64x2Abs] = unop(64, func(x uint64) uint64 { return x &^ (1 << 63) })
+	simdFuncs[ops.F64x2Neg] = unop(64, func(x uint64) uint64 { return x ^ (1 << 63) })
+	for sub, f := range map[uint32]func(float64) float64{
+		ops.F32x4Ceil: math.Ceil, ops.F32x4Floor: math.Floor, ops.F32x4Trunc: math.Trunc,
+		ops.F32x4Nearest: nearest, ops.F32x4Sqrt: math.Sqrt,
+	} {
+		f := f
+		simdFuncs[sub] = f32Unop(func(x float32) float32 { return float32(f(float64(x))) })
+	}
+	for sub, f := range map[uint32]func(float64) float64{
+		ops.F64x2Ceil: math.Ceil, ops.F64x2Floor: math.Floor, ops.F64x2Trunc: math.Trunc,
+		ops.F64x2Nearest: nearest, ops.F64x2Sqrt: math.Sqrt,
+	} {
+		simdFuncs[sub] = f64Unop(f)
+	}
+	simdFuncs[ops.F32x4Add] = f32Binop(func(x, y float32) float32 { return x + y })
+	simdFuncs[ops.F32x4Sub] = f32Binop(func(x, y float32) float32 { return x - y })
+	simdFuncs[ops.F32x4Mul] = f32Binop(func(x, y float32) float32 { return x * y })
+	simdFuncs[ops.F32x4Div] = f32Binop(func(x, y float32) float32 { return x / y })
+	simdFuncs[ops.F32x4Min] = f32Binop(func(x, y float32) float32 { return float32(math.Min(float64(x), float64(y))) })
+	simdFuncs[ops.F32x4Max] = f32Binop(func(x, y float32) float32 { return float32(math.Max(float64(x), float64(y))) })
+	simdFuncs[ops.F32x4Pmin] = f32Binop(func(x, y float32) float32 {
+		if y < x {
+			return y
+		}
+		return x
+	})
+	simdFuncs[ops.F32x4Pmax] = f32Binop(func(x, y float32) float32 {
+		if x < y {
+			return y
+		}
+		return x
+	})
+	simdFuncs[ops.F64x2Add] = f64Binop(func(x, y float64) float64 { return x + y })
+	simdFuncs[ops.F64x2Sub] = f64Binop(func(x, y float64) float64 { return x - y })
+	simdFuncs[ops.F64x2Mul] = f64Binop(func(x, y float64) float64 { return x * y })
+	simdFuncs[ops.F64x2Div] = f64Binop(func(x, y float64) float64 { return x / y })
+	simdFuncs[ops.F64x2Min] = f64Binop(math.Min)
+	simdFuncs[ops.F64x2Max] = f64Binop(math.Max)
+	simdFuncs[ops.F64x2Pmin] = f64Binop(func(x, y float64) float64 {
+		if y < x {
+			return y
+		}
+		return x
+	})
+	simdFuncs[ops.F64x2Pmax] = f64Binop(func(x, y float64) float64 {
+		if x < y {
+			return y
+		}
+		return x
+	})
+
+	simdFuncs[ops.I32x4TruncSatF32x4S] = convert(32, 32, 0, 4, func(x uint64) uint64 {
+		return truncSat32(float64(math.Float32frombits(uint32(x))), true)
+	})
+	simdFuncs[ops.I32x4TruncSatF32x4U] = convert(32, 32, 0, 4, func(x uint64) uint64 {
+		return truncSat32(float64(math.Float32frombits(uint32(x))), false)
+	})
+	simdFuncs[ops.F32x4ConvertI32x4S] = convert(32, 32, 0, 4, func(x uint64) uint64 {
+		return uint64(math.Float32bits(float32(int32(x))))
+	})
+	simdFuncs[ops.F32x4ConvertI32x4U] = convert(32, 32, 0, 4, func(x uint64) uint64 {
+		return uint64(math.Float32bits(float32(uint32(x))))
+	})
+	simdFuncs[ops.I32x4TruncSatF64x2SZero] = convert(32, 64, 0, 2, func(x uint64) uint64 {
+		return truncSat32(math.Float64frombits(x), true)
+	})
+	simdFuncs[ops.I32x4TruncSatF64x2UZero] = convert(32, 64, 0, 2, func(x uint64) uint64 {
+		return truncSat32(math.Float64frombits(x), false)
+	})
+	simdFuncs[ops.F64x2ConvertLowI32x4S] = convert(64, 32, 0, 2, func(x uint64) uint64 {
+		return math.Float64bits(float64(int32(x)))
+	})
+	simdFuncs[ops.F64x2ConvertLowI32x4U] = convert(64, 32, 0, 2, func(x uint64) uint64 {
+		return math.Float64bits(float64(uint32(x)))
+	})
+
+	initRelaxedSIMD()
+}
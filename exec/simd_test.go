@@ -0,0 +1,118 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestV128(t *testing.T) {
+	module := readTestModule(t, "testdata/simd.wasm")
+	if err := validate.VerifyModule(module); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := func(name string) int64 { return int64(module.Export.Entries[name].Index) }
+
+	// a v128 argument is passed as its low and high 64 bits
+	res, err := vm.ExecCode(index("add"), 1|2<<32, 3|4<<32, 10|20<<32, 30|40<<32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := wasm.V128{11, 0, 0, 0, 22, 0, 0, 0, 33, 0, 0, 0, 44, 0, 0, 0}
+	if res != want {
+		t.Errorf("add: got=%v, want=%v", res, want)
+	}
+	if res, err := vm.ExecCode(index("all-true"), 1|1<<32, 0|1<<32); err != nil || res != uint32(0) {
+		t.Errorf("all-true: got=%v, %v, want=0", res, err)
+	}
+
+	var r interface{}
+	func() {
+		defer func() { r = recover() }()
+		vm.ExecCode(index("load-oob"), 65530)
+	}()
+	merr, ok := trapValue(r).(*MemoryAccessError)
+	if !ok {
+		t.Fatalf("load-oob: got=%v, want a MemoryAccessError", r)
+	}
+	if merr.Address != 65530 || merr.Size != 16 {
+		t.Errorf("load-oob: got=%+v, want an access of 16 bytes at 65530", *merr)
+	}
+}
+
+func TestRelaxedSIMD(t *testing.T) {
+	module := readTestModule(t, "testdata/relaxed-simd.wasm")
+	if err := validate.VerifyModule(module); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompileModule(module, VMConfig{}); err != ERR_RELAXED_SIMD {
+		t.Fatalf("CompileModule without RelaxedSIMD: got=%v, want=%v", err, ERR_RELAXED_SIMD)
+	}
+	vm, err := NewVMWithConfig(module, VMConfig{RelaxedSIMD: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lanes := func(size int, values ...uint64) wasm.V128 {
+		var v wasm.V128
+		for i, x := range values {
+			setLane(&v, size, i, x)
+		}
+		return v
+	}
+	f32 := func(f float32) uint64 { return uint64(math.Float32bits(f)) }
+	f64 := math.Float64bits
+	i32 := func(x int32) uint64 { return uint64(uint32(x)) }
+	var swizzled wasm.V128
+	binary.LittleEndian.PutUint32(swizzled[:], 150|10<<24)
+	for i := 4; i < 16; i++ {
+		swizzled[i] = 20
+	}
+
+	for _, tc := range []struct {
+		name string
+		want wasm.V128
+	}{
+		// the product of the last lanes is rounded before the sum
+		{"madd", lanes(32, f32(3.25), f32(5), f32(7), 0)},
+		{"nmadd", lanes(64, f64(-7), f64(-14))},
+		{"swizzle", swizzled},
+		{"trunc", lanes(32, 0, i32(math.MaxInt32), i32(math.MinInt32), i32(-3))},
+		{"laneselect", lanes(64, 0x0f0f0f0f0f0f0f0f, 0x0f0f0f0f0f0f0f0f)},
+		{"min", lanes(32, f32(float32(math.Copysign(0, -1))), f32(-1), uint64(math.Float32bits(float32(math.NaN()))), f32(2))},
+		{"dot", lanes(16, 0x8000, 0xfffb)},
+		{"dot-add", lanes(32, 65537, 12)},
+	} {
+		res, err := vm.ExecCode(int64(module.Export.Entries[tc.name].Index))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if res != tc.want {
+			t.Errorf("%s: got=%v, want=%v", tc.name, res, tc.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build wasmdebug
+
+package exec
+
+import "bytes"
+
+// SnapshotsEnabled is whether the package is built with the wasmdebug
+// build tag, which enables the snapshots of the calls in progress.
+const SnapshotsEnabled = true
+
+// snapshotPageSize is the size of the pages of memory a snapshot shares
+// with the previous one while they are unchanged.
+const snapshotPageSize = 4096
+
+// Snapshot is the state of a call in progress captured by (*VM).Snapshot,
+// from which the call can run again with Restore, for a debugger to step
+// backwards: its frames, the memory and globals of its instance, and the
+// gas it consumed. Snapshots take a copy of the memory, but for the pages
+// unchanged since the previous snapshot, which are shared with it.
+type Snapshot struct {
+	call  *Continuation
+	pages [][]byte
+	// the gas consumed by the meter, if any
+	metered bool
+	gas     uint64
+}
+
+// Snapshot captures the state of the call in progress of vm, between two
+// of its instructions, from a debug hook or a trace function. The pages of
+// memory unchanged since prev, if not nil, are shared with it. It returns
+// ERR_SNAPSHOT_CALL without a call in progress, or within a call nested in
+// a host function.
+func (vm *VM) Snapshot(prev *Snapshot) (*Snapshot, error) {
+	if vm.activeCalls != 1 || vm.ctx.code == nil {
+		return nil, ERR_SNAPSHOT_CALL
+	}
+	s := &Snapshot{
+		call:    vm.captureCall(0),
+		pages:   make([][]byte, (len(vm.memory)+snapshotPageSize-1)/snapshotPageSize),
+		metered: vm.gasMeter != nil,
+		gas:     vm.meteredGas(),
+	}
+	if prev != nil {
+		s.call.fingerprint = prev.call.fingerprint
+	} else {
+		s.call.fingerprint = vm.compiled.codeFingerprint()
+	}
+	for i := range s.pages {
+		end := (i + 1) * snapshotPageSize
+		if end > len(vm.memory) {
+			end = len(vm.memory)
+		}
+		page := vm.memory[i*snapshotPageSize : end]
+		if prev != nil && i < len(prev.pages) && bytes.Equal(prev.pages[i], page) {
+			s.pages[i] = prev.pages[i]
+		} else {
+			s.pages[i] = append([]byte(nil), page...)
+		}
+	}
+	return s, nil
+}
+
+// Restore runs the call captured by s again, from the instruction it was
+// captured before, like Resume: the memory and globals of the instance of
+// vm are restored to their state in s first, and its gas meter, if any, to
+// the gas consumed then. The tables and the fuel aren't restored.
+func (vm *VM) Restore(s *Snapshot) (interface{}, error) {
+	c := *s.call
+	c.Memory = make([]byte, 0, len(s.pages)*snapshotPageSize)
+	for _, page := range s.pages {
+		c.Memory = append(c.Memory, page...)
+	}
+	if len(c.Memory) < len(vm.memory) {
+		// the memory shrinks back to its size in s
+		if vm.shared != nil {
+			return nil, ERR_MEMORY_SHARED
+		}
+		vm.memory = vm.memory[:len(c.Memory)]
+	}
+	if s.metered && vm.gasMeter != nil {
+		vm.gasMeter.used = s.gas
+	}
+	return vm.Resume(&c)
+}
+
+// size returns the size of the memory of s.
+func (s *Snapshot) size() int {
+	if len(s.pages) == 0 {
+		return 0
+	}
+	return (len(s.pages)-1)*snapshotPageSize + len(s.pages[len(s.pages)-1])
+}
+
+// page returns the page of s with the given index, nil past the memory.
+func (s *Snapshot) page(i int) []byte {
+	if i < len(s.pages) {
+		return s.pages[i]
+	}
+	return nil
+}
+
+// read returns a copy of the bytes of the memory of s from start to end,
+// the bytes past the memory being zeros.
+func (s *Snapshot) read(start, end int) []byte {
+	b := make([]byte, end-start)
+	for i := start / snapshotPageSize; i*snapshotPageSize < end && i < len(s.pages); i++ {
+		offset := i*snapshotPageSize - start
+		page := s.pages[i]
+		if offset < 0 {
+			page = page[-offset:]
+			offset = 0
+		}
+		copy(b[offset:], page)
+	}
+	return b
+}
+
+// DiffSnapshots returns the diff between the states of the instance
+// captured by two snapshots of its calls, the pages they share being
+// unchanged.
+func DiffSnapshots(old, new *Snapshot) *StateDiff {
+	var ranges [][2]int
+	for i := range new.pages {
+		if oldPage := old.page(i); len(oldPage) != 0 && &oldPage[0] == &new.pages[i][0] {
+			continue
+		}
+		ranges = appendMemoryDiff(ranges, i*snapshotPageSize, old.page(i), new.pages[i])
+	}
+	return newStateDiff(old.size(), new.size(), ranges, func(start, end int) ([]byte, []byte) {
+		return old.read(start, end), new.read(start, end)
+	}, old.call.Globals, new.call.Globals)
+}
@@ -0,0 +1,43 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !wasmdebug
+
+package exec
+
+// SnapshotsEnabled is whether the package is built with the wasmdebug
+// build tag, which enables the snapshots of the calls in progress.
+const SnapshotsEnabled = false
+
+// Snapshot is the state of a call in progress, which is only captured with
+// the wasmdebug build tag.
+type Snapshot struct{}
+
+// Snapshot returns ERR_SNAPSHOTS_DISABLED without the wasmdebug build tag.
+func (vm *VM) Snapshot(prev *Snapshot) (*Snapshot, error) {
+	return nil, ERR_SNAPSHOTS_DISABLED
+}
+
+// Restore returns ERR_SNAPSHOTS_DISABLED without the wasmdebug build tag.
+func (vm *VM) Restore(s *Snapshot) (interface{}, error) {
+	return nil, ERR_SNAPSHOTS_DISABLED
+}
+
+// DiffSnapshots returns nil without the wasmdebug build tag.
+func DiffSnapshots(old, new *Snapshot) *StateDiff {
+	return nil
+}
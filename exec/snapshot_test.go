@@ -0,0 +1,131 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build wasmdebug
+
+package exec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	module := readTestModule(t, "testdata/dwarf.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	fill := int64(module.Export.Entries["fill"].Index)
+
+	if _, err := vm.Snapshot(nil); err != ERR_SNAPSHOT_CALL {
+		t.Errorf("Snapshot without a call: got=%v, want=%v", err, ERR_SNAPSHOT_CALL)
+	}
+
+	// the snapshots are taken before the first two instructions of fill
+	var snapshots []*Snapshot
+	vm.SetDebugHook(func(fn, offset int64) {
+		if len(snapshots) < 2 {
+			var prev *Snapshot
+			if len(snapshots) != 0 {
+				prev = snapshots[0]
+			}
+			s, err := vm.Snapshot(prev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			snapshots = append(snapshots, s)
+		}
+	})
+	vm.Memory()[100], vm.Memory()[104] = 0xff, 0xee
+	if _, err := vm.ExecCode(fill, 100, 4); err != nil {
+		t.Fatal(err)
+	}
+	vm.SetDebugHook(nil)
+	if len(snapshots) != 2 {
+		t.Fatalf("unexpected snapshots: %d", len(snapshots))
+	}
+	for i, page := range snapshots[1].pages {
+		if &page[0] != &snapshots[0].pages[i][0] {
+			t.Errorf("page %d isn't shared", i)
+		}
+	}
+
+	// fill zeroes the memory again, the bytes it doesn't write being
+	// restored
+	vm.Memory()[100], vm.Memory()[104] = 0x22, 0x11
+	if _, err := vm.Restore(snapshots[1]); err != nil {
+		t.Fatal(err)
+	}
+	if m := vm.Memory(); m[100] != 0 || m[104] != 0xee {
+		t.Errorf("unexpected memory: %x", m[100:105])
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	module := readTestModule(t, "testdata/dwarf.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	fill := int64(module.Export.Entries["fill"].Index)
+
+	// the snapshots are taken at the start of two calls of fill
+	var snapshots []*Snapshot
+	vm.SetDebugHook(func(fn, offset int64) {
+		if vm.Frames()[0].PC == 0 {
+			var prev *Snapshot
+			if len(snapshots) != 0 {
+				prev = snapshots[0]
+			}
+			s, err := vm.Snapshot(prev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			snapshots = append(snapshots, s)
+		}
+	})
+	copy(vm.Memory()[100:], []byte{0xff, 0xff, 0xff})
+	for i := 0; i < 2; i++ {
+		if _, err := vm.ExecCode(fill, 100, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("unexpected snapshots: %d", len(snapshots))
+	}
+	want := &StateDiff{
+		OldSize: wasmPageSize,
+		NewSize: wasmPageSize,
+		Memory:  []MemoryChange{{Addr: 100, Old: []byte{0xff, 0xff}, New: []byte{0, 0}}},
+	}
+	if d := DiffSnapshots(snapshots[0], snapshots[1]); !reflect.DeepEqual(d, want) {
+		t.Errorf("got=%+v, want=%+v", d, want)
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"math"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/softfloat"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// ErrInvalidConversion and ErrIntegerOverflow are the error values used
+// while trapping the VM when a float converted to an integer is a NaN, or
+// its integer part is out of the range of the integer type.
+// ErrIntegerOverflow is also the one of the signed division of the
+// smallest integer by -1.
+var (
+	ErrInvalidConversion = newTrap(TrapInvalidConversion, "exec: invalid conversion to integer")
+	ErrIntegerOverflow   = newTrap(TrapIntegerOverflow, "exec: integer overflow")
+)
+
+// useSoftFloat replaces the float operators of the function table of vm by
+// their implementations in package softfloat, see VMConfig.SoftFloat. The
+// SIMD ones are replaced by the operators of softSIMDFuncs.
+func (vm *VM) useSoftFloat() {
+	t := &vm.funcTable
+	for op, f := range map[byte]func(a, b uint32) uint32{
+		ops.F32Add: softfloat.F32Add, ops.F32Sub: softfloat.F32Sub,
+		ops.F32Mul: softfloat.F32Mul, ops.F32Div: softfloat.F32Div,
+		ops.F32Min: softfloat.F32Min, ops.F32Max: softfloat.F32Max,
+		ops.F32Copysign: func(a, b uint32) uint32 { return a&^(1<<31) | b&(1<<31) },
+	} {
+		f := f
+		t[op] = func() {
+			b := vm.popUint32()
+			vm.pushUint32(f(vm.popUint32(), b))
+		}
+	}
+	for op, f := range map[byte]func(a uint32) uint32{
+		ops.F32Sqrt: softfloat.F32Sqrt, ops.F32Ceil: softfloat.F32Ceil,
+		ops.F32Floor: softfloat.F32Floor, ops.F32Trunc: softfloat.F32Trunc,
+		ops.F32Nearest: softfloat.F32Nearest,
+		ops.F32Abs:     func(a uint32) uint32 { return a &^ (1 << 31) },
+		ops.F32Neg:     func(a uint32) uint32 { return a ^ 1<<31 },
+	} {
+		f := f
+		t[op] = func() { vm.pushUint32(f(vm.popUint32())) }
+	}
+	for op, f := range map[byte]func(a, b uint32) bool{
+		ops.F32Eq: softfloat.F32Eq,
+		ops.F32Ne: func(a, b uint32) bool { return !softfloat.F32Eq(a, b) },
+		ops.F32Lt: softfloat.F32Lt,
+		ops.F32Gt: func(a, b uint32) bool { return softfloat.F32Lt(b, a) },
+		ops.F32Le: softfloat.F32Le,
+		ops.F32Ge: func(a, b uint32) bool { return softfloat.F32Le(b, a) },
+	} {
+		f := f
+		t[op] = func() {
+			b := vm.popUint32()
+			vm.pushBool(f(vm.popUint32(), b))
+		}
+	}
+
+	for op, f := range map[byte]func(a, b uint64) uint64{
+		ops.F64Add: softfloat.F64Add, ops.F64Sub: softfloat.F64Sub,
+		ops.F64Mul: softfloat.F64Mul, ops.F64Div: softfloat.F64Div,
+		ops.F64Min: softfloat.F64Min, ops.F64Max: softfloat.F64Max,
+		ops.F64Copysign: func(a, b uint64) uint64 { return a&^(1<<63) | b&(1<<63) },
+	} {
+		f := f
+		t[op] = func() {
+			b := vm.popUint64()
+			vm.pushUint64(f(vm.popUint64(), b))
+		}
+	}
+	for op, f := range map[byte]func(a uint64) uint64{
+		ops.F64Sqrt: softfloat.F64Sqrt, ops.F64Ceil: softfloat.F64Ceil,
+		ops.F64Floor: softfloat.F64Floor, ops.F64Trunc: softfloat.F64Trunc,
+		ops.F64Nearest: softfloat.F64Nearest,
+		ops.F64Abs:     func(a uint64) uint64 { return a &^ (1 << 63) },
+		ops.F64Neg:     func(a uint64) uint64 { return a ^ 1<<63 },
+	} {
+		f := f
+		t[op] = func() { vm.pushUint64(f(vm.popUint64())) }
+	}
+	for op, f := range map[byte]func(a, b uint64) bool{
+		ops.F64Eq: softfloat.F64Eq,
+		ops.F64Ne: func(a, b uint64) bool { return !softfloat.F64Eq(a, b) },
+		ops.F64Lt: softfloat.F64Lt,
+		ops.F64Gt: func(a, b uint64) bool { return softfloat.F64Lt(b, a) },
+		ops.F64Le: softfloat.F64Le,
+		ops.F64Ge: func(a, b uint64) bool { return softfloat.F64Le(b, a) },
+	} {
+		f := f
+		t[op] = func() {
+			b := vm.popUint64()
+			vm.pushBool(f(vm.popUint64(), b))
+		}
+	}
+
+	// the conversions to integers, which trap for the floats out of
+	// range like the hardware ones
+	for op, c := range map[byte]struct {
+		from64, signed bool
+		size           uint
+	}{
+		ops.I32TruncSF32: {false, true, 32}, ops.I32TruncUF32: {false, false, 32},
+		ops.I32TruncSF64: {true, true, 32}, ops.I32TruncUF64: {true, false, 32},
+		ops.I64TruncSF32: {false, true, 64}, ops.I64TruncUF32: {false, false, 64},
+		ops.I64TruncSF64: {true, true, 64}, ops.I64TruncUF64: {true, false, 64},
+	} {
+		c := c
+		t[op] = func() {
+			var x uint64
+			var err error
+			if c.from64 {
+				x, err = softfloat.F64ToInt(vm.popUint64(), c.size, c.signed)
+			} else {
+				x, err = softfloat.F32ToInt(vm.popUint32(), c.size, c.signed)
+			}
+			switch err {
+			case softfloat.ErrNaN:
+				panic(ErrInvalidConversion)
+			case softfloat.ErrOverflow:
+				panic(ErrIntegerOverflow)
+			}
+			if c.size == 32 {
+				x = uint64(uint32(x))
+			}
+			vm.pushUint64(x)
+		}
+	}
+
+	t[ops.F32ConvertSI32] = func() { vm.pushUint32(softfloat.F32FromInt(int64(vm.popInt32()))) }
+	t[ops.F32ConvertUI32] = func() { vm.pushUint32(softfloat.F32FromUint(uint64(vm.popUint32()))) }
+	t[ops.F32ConvertSI64] = func() { vm.pushUint32(softfloat.F32FromInt(vm.popInt64())) }
+	t[ops.F32ConvertUI64] = func() { vm.pushUint32(softfloat.F32FromUint(vm.popUint64())) }
+	t[ops.F32DemoteF64] = func() { vm.pushUint32(softfloat.F64ToF32(vm.popUint64())) }
+	t[ops.F64ConvertSI32] = func() { vm.pushUint64(softfloat.F64FromInt(int64(vm.popInt32()))) }
+	t[ops.F64ConvertUI32] = func() { vm.pushUint64(softfloat.F64FromUint(uint64(vm.popUint32()))) }
+	t[ops.F64ConvertSI64] = func() { vm.pushUint64(softfloat.F64FromInt(vm.popInt64())) }
+	t[ops.F64ConvertUI64] = func() { vm.pushUint64(softfloat.F64FromUint(vm.popUint64())) }
+	t[ops.F64PromoteF32] = func() { vm.pushUint64(softfloat.F32ToF64(vm.popUint32())) }
+}
+
+// softSIMDFuncs are the SIMD operators on floats run with
+// VMConfig.SoftFloat instead of the ones of simdFuncs, indexed by
+// sub-opcode. The ones only setting the sign bit are shared.
+var softSIMDFuncs [512]func(vm *VM)
+
+func init() {
+	for sub, f := range map[uint32]func(a, b uint32) uint32{
+		ops.F32x4Add: softfloat.F32Add, ops.F32x4Sub: softfloat.F32Sub,
+		ops.F32x4Mul: softfloat.F32Mul, ops.F32x4Div: softfloat.F32Div,
+		ops.F32x4Min: softfloat.F32Min, ops.F32x4Max: softfloat.F32Max,
+		ops.F32x4RelaxedMin: softfloat.F32Min, ops.F32x4RelaxedMax: softfloat.F32Max,
+		ops.F32x4Pmin: func(a, b uint32) uint32 {
+			if softfloat.F32Lt(b, a) {
+				return b
+			}
+			return a
+		},
+		ops.F32x4Pmax: func(a, b uint32) uint32 {
+			if softfloat.F32Lt(a, b) {
+				return b
+			}
+			return a
+		},
+	} {
+		f := f
+		softSIMDFuncs[sub] = binop(32, func(x, y uint64) uint64 { return uint64(f(uint32(x), uint32(y))) })
+	}
+	for sub, f := range map[uint32]func(a uint32) uint32{
+		ops.F32x4Sqrt: softfloat.F32Sqrt, ops.F32x4Ceil: softfloat.F32Ceil,
+		ops.F32x4Floor: softfloat.F32Floor, ops.F32x4Trunc: softfloat.F32Trunc,
+		ops.F32x4Nearest: softfloat.F32Nearest,
+	} {
+		f := f
+		softSIMDFuncs[sub] = unop(32, func(x uint64) uint64 { return uint64(f(uint32(x))) })
+	}
+	for sub, f := range map[uint32]func(a, b uint32) bool{
+		ops.F32x4Eq: softfloat.F32Eq,
+		ops.F32x4Ne: func(a, b uint32) bool { return !softfloat.F32Eq(a, b) },
+		ops.F32x4Lt: softfloat.F32Lt,
+		ops.F32x4Gt: func(a, b uint32) bool { return softfloat.F32Lt(b, a) },
+		ops.F32x4Le: softfloat.F32Le,
+		ops.F32x4Ge: func(a, b uint32) bool { return softfloat.F32Le(b, a) },
+	} {
+		f := f
+		softSIMDFuncs[sub] = cmp(32, func(x, y uint64) bool { return f(uint32(x), uint32(y)) })
+	}
+
+	for sub, f := range map[uint32]func(a, b uint64) uint64{
+		ops.F64x2Add: softfloat.F64Add, ops.F64x2Sub: softfloat.F64Sub,
+		ops.F64x2Mul: softfloat.F64Mul, ops.F64x2Div: softfloat.F64Div,
+		ops.F64x2Min: softfloat.F64Min, ops.F64x2Max: softfloat.F64Max,
+		ops.F64x2RelaxedMin: softfloat.F64Min, ops.F64x2RelaxedMax: softfloat.F64Max,
+		ops.F64x2Pmin: func(a, b uint64) uint64 {
+			if softfloat.F64Lt(b, a) {
+				return b
+			}
+			return a
+		},
+		ops.F64x2Pmax: func(a, b uint64) uint64 {
+			if softfloat.F64Lt(a, b) {
+				return b
+			}
+			return a
+		},
+	} {
+		softSIMDFuncs[sub] = binop(64, f)
+	}
+	for sub, f := range map[uint32]func(a uint64) uint64{
+		ops.F64x2Sqrt: softfloat.F64Sqrt, ops.F64x2Ceil: softfloat.F64Ceil,
+		ops.F64x2Floor: softfloat.F64Floor, ops.F64x2Trunc: softfloat.F64Trunc,
+		ops.F64x2Nearest: softfloat.F64Nearest,
+	} {
+		softSIMDFuncs[sub] = unop(64, f)
+	}
+	for sub, f := range map[uint32]func(a, b uint64) bool{
+		ops.F64x2Eq: softfloat.F64Eq,
+		ops.F64x2Ne: func(a, b uint64) bool { return !softfloat.F64Eq(a, b) },
+		ops.F64x2Lt: softfloat.F64Lt,
+		ops.F64x2Gt: func(a, b uint64) bool { return softfloat.F64Lt(b, a) },
+		ops.F64x2Le: softfloat.F64Le,
+		ops.F64x2Ge: func(a, b uint64) bool { return softfloat.F64Le(b, a) },
+	} {
+		softSIMDFuncs[sub] = cmp(64, f)
+	}
+
+	// the relaxed madd and nmadd, never fused, see initRelaxedSIMD
+	softSIMDFuncs[ops.F32x4RelaxedMadd] = softTernop(32, func(a, b, c uint64) uint64 {
+		return uint64(softfloat.F32Add(softfloat.F32Mul(uint32(a), uint32(b)), uint32(c)))
+	})
+	softSIMDFuncs[ops.F32x4RelaxedNmadd] = softTernop(32, func(a, b, c uint64) uint64 {
+		return uint64(softfloat.F32Add(softfloat.F32Mul(uint32(a), uint32(b))^1<<31, uint32(c)))
+	})
+	softSIMDFuncs[ops.F64x2RelaxedMadd] = softTernop(64, func(a, b, c uint64) uint64 {
+		return softfloat.F64Add(softfloat.F64Mul(a, b), c)
+	})
+	softSIMDFuncs[ops.F64x2RelaxedNmadd] = softTernop(64, func(a, b, c uint64) uint64 {
+		return softfloat.F64Add(softfloat.F64Mul(a, b)^1<<63, c)
+	})
+
+	softSIMDFuncs[ops.F32x4DemoteF64x2Zero] = convert(32, 64, 0, 2, func(x uint64) uint64 {
+		return uint64(softfloat.F64ToF32(x))
+	})
+	softSIMDFuncs[ops.F64x2PromoteLowF32x4] = convert(64, 32, 0, 2, func(x uint64) uint64 {
+		return softfloat.F32ToF64(uint32(x))
+	})
+	softSIMDFuncs[ops.F32x4ConvertI32x4S] = convert(32, 32, 0, 4, func(x uint64) uint64 {
+		return uint64(softfloat.F32FromInt(int64(int32(x))))
+	})
+	softSIMDFuncs[ops.F32x4ConvertI32x4U] = convert(32, 32, 0, 4, func(x uint64) uint64 {
+		return uint64(softfloat.F32FromUint(uint64(uint32(x))))
+	})
+	softSIMDFuncs[ops.F64x2ConvertLowI32x4S] = convert(64, 32, 0, 2, func(x uint64) uint64 {
+		return softfloat.F64FromInt(int64(int32(x)))
+	})
+	softSIMDFuncs[ops.F64x2ConvertLowI32x4U] = convert(64, 32, 0, 2, func(x uint64) uint64 {
+		return softfloat.F64FromUint(uint64(uint32(x)))
+	})
+	for _, sub := range []uint32{ops.I32x4TruncSatF32x4S, ops.I32x4RelaxedTruncF32x4S} {
+		softSIMDFuncs[sub] = convert(32, 32, 0, 4, func(x uint64) uint64 {
+			n, err := softfloat.F32ToInt(uint32(x), 32, true)
+			return softTruncSat32(n, err, x&(1<<31) != 0, true)
+		})
+	}
+	for _, sub := range []uint32{ops.I32x4TruncSatF32x4U, ops.I32x4RelaxedTruncF32x4U} {
+		softSIMDFuncs[sub] = convert(32, 32, 0, 4, func(x uint64) uint64 {
+			n, err := softfloat.F32ToInt(uint32(x), 32, false)
+			return softTruncSat32(n, err, x&(1<<31) != 0, false)
+		})
+	}
+	for _, sub := range []uint32{ops.I32x4TruncSatF64x2SZero, ops.I32x4RelaxedTruncF64x2SZero} {
+		softSIMDFuncs[sub] = convert(32, 64, 0, 2, func(x uint64) uint64 {
+			n, err := softfloat.F64ToInt(x, 32, true)
+			return softTruncSat32(n, err, x&(1<<63) != 0, true)
+		})
+	}
+	for _, sub := range []uint32{ops.I32x4TruncSatF64x2UZero, ops.I32x4RelaxedTruncF64x2UZero} {
+		softSIMDFuncs[sub] = convert(32, 64, 0, 2, func(x uint64) uint64 {
+			n, err := softfloat.F64ToInt(x, 32, false)
+			return softTruncSat32(n, err, x&(1<<63) != 0, false)
+		})
+	}
+}
+
+// softTernop returns the operator applying f to the lanes of the given
+// number of bits of its three operands.
+func softTernop(size int, f func(a, b, c uint64) uint64) func(*VM) {
+	return func(vm *VM) {
+		c, b, a := vm.popV128(), vm.popV128(), vm.popV128()
+		var r wasm.V128
+		for i := 0; i < 128/size; i++ {
+			setLane(&r, size, i, f(lane(&a, size, i), lane(&b, size, i), lane(&c, size, i)))
+		}
+		vm.pushV128(r)
+	}
+}
+
+// softTruncSat32 is truncSat32 for the integer n converted by softfloat,
+// the float being negative if neg.
+func softTruncSat32(n uint64, err error, neg, signed bool) uint64 {
+	switch {
+	case err == softfloat.ErrNaN:
+		return 0
+	case err == nil:
+		return uint64(uint32(n))
+	case signed && neg:
+		return uint64(uint32(1 << 31))
+	case signed:
+		return math.MaxInt32
+	case neg:
+		return 0
+	}
+	return math.MaxUint32
+}
@@ -0,0 +1,188 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+	"github.com/bottos-project/bottos/vm/wasm/wat"
+)
+
+// floatOps returns the scalar numeric operators taking or returning
+// floats, the comparisons, arithmetic and conversions.
+func floatOps() []ops.Op {
+	isFloat := func(t wasm.ValueType) bool { return t == wasm.ValueTypeF32 || t == wasm.ValueTypeF64 }
+	var list []ops.Op
+	for code := ops.F32Eq; code <= ops.F64ReinterpretI64; code++ {
+		op, err := ops.New(code)
+		if err != nil || op.Returns == 0 {
+			continue
+		}
+		float := isFloat(op.Returns)
+		for _, t := range op.Args {
+			float = float || isFloat(t)
+		}
+		if float && len(op.Args) != 0 {
+			list = append(list, op)
+		}
+	}
+	return list
+}
+
+// The operators of the software floats give the results of the hardware,
+// and trap on the same operands, but for the bits of the NaNs.
+func TestSoftFloatConformance(t *testing.T) {
+	// a module exporting every operator on floats under its name
+	floatOps := floatOps()
+	names := map[wasm.ValueType]string{wasm.ValueTypeI32: "i32", wasm.ValueTypeI64: "i64", wasm.ValueTypeF32: "f32", wasm.ValueTypeF64: "f64"}
+	var src strings.Builder
+	src.WriteString("(module\n")
+	for _, op := range floatOps {
+		fmt.Fprintf(&src, "  (func (export %q) (param", op.Name)
+		for _, t := range op.Args {
+			fmt.Fprintf(&src, " %s", names[t])
+		}
+		fmt.Fprintf(&src, ") (result %s)", names[op.Returns])
+		for i := range op.Args {
+			fmt.Fprintf(&src, " local.get %d", i)
+		}
+		fmt.Fprintf(&src, " %s)\n", op.Name)
+	}
+	src.WriteString(")")
+	module, err := wat.Parse([]byte(src.String()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vms [2]*exec.VM
+	for i, config := range []exec.VMConfig{{}, {SoftFloat: true}} {
+		compiled, err := exec.CompileModule(module, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inst, err := compiled.Instantiate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer inst.Close()
+		vms[i] = inst.NewVM()
+	}
+	call := func(vm *exec.VM, fn int64, args []uint64) (res uint64, trap exec.TrapCode) {
+		defer func() {
+			if r := recover(); r != nil {
+				trap = exec.TrapCodeOf(r)
+			}
+		}()
+		res, err := vm.ExecCodeRaw(fn, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, exec.TrapNone
+	}
+
+	r := rand.New(rand.NewSource(1))
+	f64 := func() uint64 {
+		switch r.Intn(5) {
+		case 0:
+			return []uint64{0, 1 << 63, 1, math.Float64bits(math.Inf(1)), 0x7ff8000000000000, 0xfff4000000000001,
+				math.Float64bits(2.5), math.Float64bits(-0.5), math.Float64bits(1 << 31), math.Float64bits(1 << 63),
+				math.Float64bits(-1 << 63), math.Float64bits(1 << 64), math.Float64bits(-1)}[r.Intn(13)]
+		case 1:
+			// a subnormal
+			return r.Uint64() & 0x800fffffffffffff
+		case 2:
+			// any float, NaNs included
+			return r.Uint64()
+		}
+		// a float around the ranges of the integers
+		return r.Uint64()&0x800fffffffffffff | uint64(1000+r.Intn(80))<<52
+	}
+	f32 := func() uint64 {
+		switch r.Intn(5) {
+		case 0:
+			return []uint64{0, 1 << 31, 1, uint64(math.Float32bits(float32(math.Inf(-1)))), 0x7fc00000, 0xff800001,
+				uint64(math.Float32bits(2.5)), uint64(math.Float32bits(-0.5)), uint64(math.Float32bits(1 << 31)),
+				uint64(math.Float32bits(1 << 32)), uint64(math.Float32bits(-1 << 63)), uint64(math.Float32bits(1 << 64))}[r.Intn(12)]
+		case 1:
+			return uint64(r.Uint32() & 0x807fffff)
+		case 2:
+			return uint64(r.Uint32())
+		}
+		return uint64(r.Uint32()&0x807fffff | uint32(110+r.Intn(60))<<23)
+	}
+	arg := func(t wasm.ValueType) uint64 {
+		switch t {
+		case wasm.ValueTypeF32:
+			return f32()
+		case wasm.ValueTypeF64:
+			return f64()
+		case wasm.ValueTypeI32:
+			return uint64(r.Uint32() >> uint(r.Intn(32)))
+		}
+		return r.Uint64() >> uint(r.Intn(64))
+	}
+	isNaN := func(t wasm.ValueType, v uint64) bool {
+		switch t {
+		case wasm.ValueTypeF32:
+			f := math.Float32frombits(uint32(v))
+			return f != f
+		case wasm.ValueTypeF64:
+			return math.IsNaN(math.Float64frombits(v))
+		}
+		return false
+	}
+
+	traps := make(map[string]int)
+	for _, op := range floatOps {
+		fn := int64(module.Export.Entries[op.Name].Index)
+		for i := 0; i < 2000; i++ {
+			args := make([]uint64, len(op.Args))
+			for j, t := range op.Args {
+				args[j] = arg(t)
+			}
+			want, wantTrap := call(vms[0], fn, args)
+			got, gotTrap := call(vms[1], fn, args)
+			if gotTrap != wantTrap {
+				t.Fatalf("%s%#x: got trap %v, want %v", op.Name, args, gotTrap, wantTrap)
+			}
+			if wantTrap != exec.TrapNone {
+				traps[op.Name]++
+				continue
+			}
+			if op.Returns == wasm.ValueTypeI32 || op.Returns == wasm.ValueTypeF32 {
+				// only the low bits of the raw values of 32 bits count
+				got, want = uint64(uint32(got)), uint64(uint32(want))
+			}
+			if got != want && !(isNaN(op.Returns, got) && isNaN(op.Returns, want)) {
+				t.Fatalf("%s%#x: got=%#x, want=%#x", op.Name, args, got, want)
+			}
+		}
+	}
+	// the operands cover the truncations trapping
+	for _, op := range floatOps {
+		if strings.Contains(op.Name, "trunc_") && traps[op.Name] == 0 {
+			t.Errorf("%s never trapped", op.Name)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// newSoftFloatVMs returns VMs running testdata/softfloat.wasm with the
+// hardware floats and with VMConfig.SoftFloat.
+func newSoftFloatVMs(t *testing.T) (module *wasm.Module, hard, soft *VM) {
+	module = readTestModule(t, "testdata/softfloat.wasm")
+	var vms [2]*VM
+	for i, config := range []VMConfig{{}, {SoftFloat: true}} {
+		compiled, err := CompileModule(module, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inst, err := compiled.Instantiate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { inst.Close() })
+		vms[i] = inst.NewVM()
+	}
+	return module, vms[0], vms[1]
+}
+
+// The SIMD operators of the software floats give the results of the
+// hardware, but for the bits of the NaNs. The scalar ones are compared by
+// TestSoftFloatConformance.
+func TestSoftFloatSIMD(t *testing.T) {
+	module, hard, soft := newSoftFloatVMs(t)
+	r := rand.New(rand.NewSource(1))
+	f64 := func() uint64 {
+		switch r.Intn(4) {
+		case 0:
+			return []uint64{0, 1 << 63, 1, math.Float64bits(math.Inf(1)), 0x7ff8000000000000, math.Float64bits(2.5)}[r.Intn(6)]
+		case 1:
+			// a subnormal
+			return r.Uint64() & 0x800fffffffffffff
+		}
+		return r.Uint64()&0x800fffffffffffff | uint64(1000+r.Intn(48))<<52
+	}
+	isNaN := func(v interface{}) bool {
+		v64, ok := v.(uint64)
+		return ok && math.IsNaN(math.Float64frombits(v64))
+	}
+	index := int64(module.Export.Entries["divx2"].Index)
+	for i := 0; i < 2000; i++ {
+		args := []uint64{f64(), f64()}
+		want, err := hard.ExecCode(index, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := soft.ExecCode(index, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want && !(isNaN(got) && isNaN(want)) {
+			t.Fatalf("divx2%#x: got=%#x, want=%#x", args, got, want)
+		}
+	}
+}
+
+func TestSoftFloat(t *testing.T) {
+	module, _, soft := newSoftFloatVMs(t)
+	f64 := math.Float64bits
+	for _, tc := range []struct {
+		name string
+		args []uint64
+		want interface{}
+		err  error
+	}{
+		// the NaNs are canonical, and ties are rounded to even
+		{name: "add64", args: []uint64{0xfff8000000000123, f64(1)}, want: uint64(canonicalNaN64)},
+		{name: "nearest64", args: []uint64{f64(2.5)}, want: f64(2)},
+		{name: "nearest64", args: []uint64{f64(-3.5)}, want: f64(-4)},
+		{name: "trunc", args: []uint64{f64(-7.9)}, want: uint32(0xfffffff9)},
+		{name: "trunc", args: []uint64{f64(math.MaxInt32 + 1)}, err: ErrIntegerOverflow},
+		{name: "trunc", args: []uint64{canonicalNaN64}, err: ErrInvalidConversion},
+	} {
+		func() {
+			defer func() {
+				if err := trapValue(recover()); err != tc.err {
+					t.Errorf("%s%#x: unexpected trap: %v", tc.name, tc.args, err)
+				}
+			}()
+			res, err := soft.ExecCode(int64(module.Export.Entries[tc.name].Index), tc.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != tc.want {
+				t.Errorf("%s%#x: got=%#x, want=%#x", tc.name, tc.args, res, tc.want)
+			}
+		}()
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bottos-project/bottos/vm/wasm/debuginfo"
+)
+
+// lineTable holds the line table of a module, read on first use from its
+// DWARF sections or its embedded source map, unless a source map is set.
+type lineTable struct {
+	once  sync.Once
+	table *debuginfo.LineTable
+	// sourceMap holds the *debuginfo.LineTable of the source map set by
+	// SetSourceMap, if any
+	sourceMap atomic.Value
+}
+
+// CodeOffset returns the offset in the module of the instruction whose
+// compiled code holds the offset pc of the function with the given index,
+// like the Offset of a MemoryAccessError, and false if there is none. The
+// instructions inlined into a function are located at their call.
+func (m *Module) CodeOffset(fn, pc int64) (int64, bool) {
+	if fn < 0 || int(fn) >= len(m.funcs) {
+		return 0, false
+	}
+	compiled, err := m.function(int(fn))
+	if err != nil {
+		return 0, false
+	}
+	offsets := compiled.sourceOffsets
+	i := sort.Search(len(offsets), func(i int) bool { return offsets[i].Compiled > pc }) - 1
+	if i < 0 || pc >= int64(len(compiled.code)) {
+		return 0, false
+	}
+	return m.module.FunctionIndexSpace[fn].Body.Offset + int64(offsets[i].Offset), true
+}
+
+// SourceLine returns the source line of the instruction whose compiled
+// code holds the offset pc of the function with the given index, see
+// CodeOffset, and false if it is unknown. The lines are read from the
+// source map set by SetSourceMap, or else from the DWARF sections of the
+// module, see debuginfo.ReadLines, or from the source map embedded in its
+// sourceMappingURL section, see debuginfo.ReadSourceMap.
+func (m *Module) SourceLine(fn, pc int64) (debuginfo.Line, bool) {
+	table := m.lineTable()
+	if table == nil {
+		return debuginfo.Line{}, false
+	}
+	offset, ok := m.CodeOffset(fn, pc)
+	if !ok {
+		return debuginfo.Line{}, false
+	}
+	return table.Lookup(offset)
+}
+
+// SetSourceMap sets the JSON source map of the module, like the file
+// AssemblyScript writes next to it, whose URL is the one of its
+// sourceMappingURL section, see debuginfo.SourceMappingURL. Its lines take
+// precedence over the DWARF ones in the stack traces and the errors of the
+// module.
+func (m *Module) SetSourceMap(sourceMap []byte) error {
+	table, err := debuginfo.ReadSourceMap(m.module, sourceMap)
+	if err != nil {
+		return err
+	}
+	m.lines.sourceMap.Store(table)
+	return nil
+}
+
+// lineTable returns the line table of m, or nil if it has no valid line
+// information.
+func (m *Module) lineTable() *debuginfo.LineTable {
+	if table, ok := m.lines.sourceMap.Load().(*debuginfo.LineTable); ok {
+		return table
+	}
+	m.lines.once.Do(func() {
+		if m.lines.table, _ = debuginfo.ReadLines(m.module); m.lines.table == nil {
+			m.lines.table, _ = debuginfo.ReadSourceMap(m.module, nil)
+		}
+	})
+	return m.lines.table
+}
+
+// sourceLine returns the source line of the offset pc of the function of
+// vm with the given index, like lib.rs:142, or "" if it is unknown.
+func (vm *VM) sourceLine(fn, pc int64) string {
+	if line, ok := vm.compiled.SourceLine(fn, pc); ok {
+		return line.String()
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/debuginfo"
+)
+
+func TestSourceLine(t *testing.T) {
+	module := readTestModule(t, "testdata/dwarf.wasm")
+	for _, config := range []VMConfig{{}, {InlineThreshold: 16}} {
+		compiled, err := CompileModule(module, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inst, err := compiled.Instantiate(NewEnvFunc())
+		if err != nil {
+			t.Fatal(err)
+		}
+		vm := inst.NewVM()
+
+		for _, tc := range []struct {
+			name string
+			args []uint64
+			line string
+		}{
+			{"load", []uint64{65535}, "lib.rs:142"},
+			{"fill", []uint64{65530, 8}, "lib.rs:153"},
+		} {
+			fn := int64(module.Export.Entries[tc.name].Index)
+			var r interface{}
+			func() {
+				defer func() { r = recover() }()
+				vm.ExecCode(fn, tc.args...)
+			}()
+			merr, ok := trapValue(r).(*MemoryAccessError)
+			if !ok {
+				t.Fatalf("%s: got=%v, want a MemoryAccessError", tc.name, r)
+			}
+			if merr.Source != tc.line || !strings.HasSuffix(merr.Error(), "("+tc.line+")") {
+				t.Errorf("%s: unexpected error %q, source %q", tc.name, merr, merr.Source)
+			}
+			line, ok := compiled.SourceLine(merr.Func, merr.Offset)
+			if !ok || line.String() != tc.line {
+				t.Errorf("%s: got=%v %v, want=%s", tc.name, line, ok, tc.line)
+			}
+		}
+
+		// the first instruction of load is at the start of its body
+		offset, ok := compiled.CodeOffset(0, 0)
+		if want := module.FunctionIndexSpace[0].Body.Offset; !ok || offset != want {
+			t.Errorf("got=%d %v, want=%d", offset, ok, want)
+		}
+		if _, ok := compiled.CodeOffset(0, 1<<20); ok {
+			t.Error("got an offset past the end of the code")
+		}
+		inst.Close()
+	}
+
+	// a module without DWARF sections has no lines
+	compiled, err := CompileModule(readTestModule(t, "testdata/load.wasm"), VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line, ok := compiled.SourceLine(0, 0); ok {
+		t.Errorf("unexpected line %v", line)
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	// testdata/sourcemap.wasm names its source map file, whose lines
+	// aren't known until it is set
+	module := readTestModule(t, "testdata/sourcemap.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line, ok := compiled.SourceLine(0, 0); ok {
+		t.Errorf("unexpected line %v", line)
+	}
+	if err := compiled.SetSourceMap([]byte(`{"version": 2}`)); err == nil {
+		t.Error("set a source map of version 2")
+	}
+	if err := compiled.SetSourceMap(readTestCode(t, "testdata/sourcemap.wasm.map")); err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	var r interface{}
+	func() {
+		defer func() { r = recover() }()
+		inst.NewVM().ExecCode(int64(module.Export.Entries["run"].Index), 65536)
+	}()
+	trap, ok := r.(*TrapError)
+	if !ok {
+		t.Fatalf("got=%v, want a TrapError", r)
+	}
+	if merr, ok := trap.Err.(*MemoryAccessError); !ok || merr.Source != "index.ts:2" {
+		t.Errorf("unexpected error %v", trap.Err)
+	}
+	if len(trap.Stack) != 2 || trap.Stack[0].Source != "index.ts:2" || trap.Stack[1].Source != "index.ts:7" {
+		t.Fatalf("unexpected stack %+v", trap.Stack)
+	}
+	line, ok := compiled.SourceLine(trap.Stack[1].Func, 0)
+	if want := (debuginfo.Line{File: "assembly/index.ts", Line: 6, Column: 3}); !ok || line != want {
+		t.Errorf("got=%+v %v, want=%+v", line, ok, want)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// StackUsage is an upper bound on the stack used by a call of a function,
+// as accounted by the VM against VMConfig.MaxCallDepth and
+// VMConfig.MaxValueStackHeight.
+type StackUsage struct {
+	// Frames is the number of nested calls, the function's own included.
+	Frames int
+	// Values is the number of values the locals and operand stacks of the
+	// nested calls hold.
+	Values int
+	// Unbounded is true if the function may recurse, in which case Frames
+	// and Values only bound a single iteration of the recursion.
+	Unbounded bool
+}
+
+// StackUsageError is returned by CompileModule, when VMConfig.CheckStackUsage
+// is set, if a call of an exported function may exceed the call depth or
+// the value stack height allowed by the config.
+type StackUsageError struct {
+	// Export is the name of the function, Limit the name of the exceeded
+	// limit and Max its value.
+	Export string
+	Limit  string
+	Max    int
+}
+
+func (e StackUsageError) Error() string {
+	return fmt.Sprintf("exec: function %q may overflow the stack: %s exceeds %d", e.Export, e.Limit, e.Max)
+}
+
+func (e StackUsageError) TrapCode() TrapCode {
+	return TrapStackOverflow
+}
+
+// stackAnalysis holds the stack usage of every function of a module,
+// computed on first use.
+type stackAnalysis struct {
+	once  sync.Once
+	usage []StackUsage
+}
+
+// StackUsage returns an upper bound on the stack used by a call of the
+// function exported as name, and false if there is no such function.
+//
+// The bound follows the calls the function may make: a call_indirect or a
+// call_ref may call any function of the module with the right signature.
+// The functions of other modules reached through imported tables, and the
+// calls host functions make back into the VM, aren't accounted for.
+func (m *Module) StackUsage(name string) (StackUsage, bool) {
+	if m.module.Export == nil {
+		return StackUsage{}, false
+	}
+	entry, ok := m.module.Export.Entries[name]
+	if !ok || entry.Kind != wasm.ExternalFunction || int(entry.Index) >= len(m.funcs) {
+		return StackUsage{}, false
+	}
+	return m.stackUsage()[entry.Index], true
+}
+
+// checkStackUsage returns a StackUsageError if a call of an exported
+// function of m may exceed the limits of m.config.
+func (m *Module) checkStackUsage() error {
+	usage := m.stackUsage()
+	maxDepth := m.config.MaxCallDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxCallDepth
+	}
+	maxHeight := m.config.MaxValueStackHeight
+	for _, entry := range m.module.Exports() {
+		if entry.Kind != wasm.ExternalFunction || int(entry.Index) >= len(usage) {
+			continue
+		}
+		fn := usage[entry.Index]
+		switch {
+		case fn.Unbounded || fn.Frames > maxDepth:
+			return StackUsageError{Export: entry.FieldStr, Limit: "call depth", Max: maxDepth}
+		case maxHeight != 0 && fn.Values > maxHeight:
+			return StackUsageError{Export: entry.FieldStr, Limit: "value stack height", Max: maxHeight}
+		}
+	}
+	return nil
+}
+
+// stackUsage returns the stack usage of the functions of m, indexed by
+// function index.
+func (m *Module) stackUsage() []StackUsage {
+	m.stack.once.Do(func() {
+		m.stack.usage = analyzeStack(m)
+	})
+	return m.stack.usage
+}
+
+// stackCall is a call a function may make.
+type stackCall struct {
+	callee uint32
+	tail   bool
+}
+
+// analyzeStack computes the stack usage of the functions of m by a depth
+// first traversal of their call graph, a function calling one of the
+// functions being traversed making all of them unbounded.
+func analyzeStack(m *Module) []StackUsage {
+	module := m.module
+	bySig := make(map[uint32][]uint32)
+	for i, id := range m.funcTypeIDs {
+		bySig[id] = append(bySig[id], uint32(i))
+	}
+
+	calls := make([][]stackCall, len(module.FunctionIndexSpace))
+	unknown := make([]bool, len(module.FunctionIndexSpace))
+	for i, fn := range module.FunctionIndexSpace {
+		disassembly, err := disasm.Disassemble(fn, module)
+		if err != nil {
+			// the module compiled, a function can't be disassembled
+			// without a bug, whose calls are then unknown
+			unknown[i] = true
+			continue
+		}
+		for _, instr := range disassembly.Code {
+			if instr.Unreachable {
+				continue
+			}
+			op := instr.Op.Code
+			tail := op == ops.ReturnCall || op == ops.ReturnCallIndirect || op == ops.ReturnCallRef
+			switch op {
+			case ops.Call, ops.ReturnCall:
+				calls[i] = append(calls[i], stackCall{callee: instr.Immediates[0].(uint32), tail: tail})
+			case ops.CallIndirect, ops.ReturnCallIndirect, ops.CallRef, ops.ReturnCallRef:
+				for _, callee := range bySig[m.typeIDs[instr.Immediates[0].(uint32)]] {
+					calls[i] = append(calls[i], stackCall{callee: callee, tail: tail})
+				}
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	funcs := m.allFuncs()
+	state := make([]int, len(calls))
+	usage := make([]StackUsage, len(calls))
+	var visit func(i uint32)
+	visit = func(i uint32) {
+		state[i] = visiting
+		compiled := funcs[i]
+		own := compiled.maxDepth + compiled.totalLocalVars
+		if compiled.native != nil {
+			own += compiled.native.MaxStack
+		}
+		u := StackUsage{Frames: 1, Values: own, Unbounded: unknown[i]}
+		for _, call := range calls[i] {
+			switch state[call.callee] {
+			case unvisited:
+				visit(call.callee)
+			case visiting:
+				u.Unbounded = true
+				continue
+			}
+			callee := usage[call.callee]
+			u.Unbounded = u.Unbounded || callee.Unbounded
+			if call.tail {
+				// the frame of the caller is replaced by the callee's
+				u.Frames = maxInt(u.Frames, callee.Frames)
+				u.Values = maxInt(u.Values, callee.Values)
+			} else {
+				u.Frames = maxInt(u.Frames, 1+callee.Frames)
+				u.Values = maxInt(u.Values, own+callee.Values)
+			}
+		}
+		usage[i] = u
+		state[i] = visited
+	}
+	for i := range calls {
+		if state[i] == unvisited {
+			visit(uint32(i))
+		}
+	}
+	return usage
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,100 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// stackModule returns a module exporting the functions with the given
+// bodies, which take and return nothing.
+func stackModule(bodies ...[]byte) *wasm.Module {
+	module := &wasm.Module{
+		Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{{}}},
+		Function: &wasm.SectionFunctions{},
+		Code:     &wasm.SectionCode{},
+		Export:   &wasm.SectionExports{Entries: map[string]wasm.ExportEntry{}},
+	}
+	for i, code := range bodies {
+		name := string(rune('a' + i))
+		module.Function.Types = append(module.Function.Types, 0)
+		module.FunctionIndexSpace = append(module.FunctionIndexSpace, wasm.Function{
+			Sig:  &module.Types.Entries[0],
+			Body: &wasm.FunctionBody{Code: code},
+		})
+		module.Export.Entries[name] = wasm.ExportEntry{FieldStr: name, Kind: wasm.ExternalFunction, Index: uint32(i)}
+		module.Export.Names = append(module.Export.Names, name)
+	}
+	return module
+}
+
+func TestStackUsage(t *testing.T) {
+	module := stackModule(
+		[]byte{0x41, 0x01, 0x41, 0x02, 0x1a, 0x1a}, // a: two constants
+		[]byte{0x10, 0x00, 0x10, 0x00},             // b: calls a twice
+		[]byte{0x10, 0x01},                         // c: calls b
+		[]byte{0x12, 0x02},                         // d: tail calls c
+		[]byte{0x10, 0x04},                         // e: calls itself
+		[]byte{0x10, 0x04},                         // f: calls e
+	)
+	m, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]StackUsage{
+		"a": {Frames: 1, Values: 2},
+		"b": {Frames: 2, Values: 2},
+		"c": {Frames: 3, Values: 2},
+		"d": {Frames: 3, Values: 2},
+		"e": {Frames: 1, Unbounded: true},
+		"f": {Frames: 2, Unbounded: true},
+	} {
+		got, ok := m.StackUsage(name)
+		if !ok || got != want {
+			t.Errorf("%s: got %+v, %v, want %+v", name, got, ok, want)
+		}
+	}
+	if _, ok := m.StackUsage("g"); ok {
+		t.Error("found the stack usage of a missing export")
+	}
+}
+
+func TestCheckStackUsage(t *testing.T) {
+	bounded := stackModule([]byte{0x41, 0x01, 0x41, 0x02, 0x1a, 0x1a}, []byte{0x10, 0x00})
+	recursive := stackModule([]byte{0x10, 0x00})
+	for _, tc := range []struct {
+		module *wasm.Module
+		config VMConfig
+		err    error
+	}{
+		{bounded, VMConfig{CheckStackUsage: true}, nil},
+		{bounded, VMConfig{CheckStackUsage: true, MaxCallDepth: 2, MaxValueStackHeight: 2}, nil},
+		{bounded, VMConfig{CheckStackUsage: true, MaxCallDepth: 1}, StackUsageError{"b", "call depth", 1}},
+		{bounded, VMConfig{CheckStackUsage: true, MaxValueStackHeight: 1}, StackUsageError{"a", "value stack height", 1}},
+		{bounded, VMConfig{MaxCallDepth: 1}, nil},
+		{recursive, VMConfig{CheckStackUsage: true}, StackUsageError{"a", "call depth", DefaultMaxCallDepth}},
+		{recursive, VMConfig{}, nil},
+	} {
+		_, err := CompileModule(tc.module, tc.config)
+		if err != tc.err {
+			t.Errorf("%+v: got error %v, want %v", tc.config, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"fmt"
+	"io"
+)
+
+// StackFrame is a frame of the call stack of a trap, see TrapError.
+type StackFrame struct {
+	// Func is the index of the function of the frame, and Name its name
+	// in the name section, if any.
+	Func int64
+	Name string
+	// Offset is the offset in the module of the instruction the frame
+	// was running, the one trapping for the innermost frame and a call
+	// for the others, or -1 if it is unknown. Source is its source line,
+	// if the module has line information, see (*Module).SourceLine.
+	Offset int64
+	Source string
+	// Gas is the gas consumed since the frame was entered, its callees
+	// included, if the call is metered, see SetGasMeter.
+	Gas uint64
+}
+
+func (f StackFrame) String() string {
+	s := describeFunc(f.Func, f.Name)
+	if f.Offset >= 0 {
+		s += fmt.Sprintf(" at offset %#x", f.Offset)
+	}
+	return s + describeSource(f.Source) + fmt.Sprintf(", gas %d", f.Gas)
+}
+
+// TrapError is the value a call traps with: the error value the VM trapped
+// with, and the call stack of the trap. Its message is the one of the
+// error, which it wraps, and the %+v verb adds the call stack to it, a
+// frame per line:
+//
+//	exec: out of bounds memory access: address 65536, size 4, ...
+//		at function 2 (load) at offset 0x3e (lib.rs:142), gas 12
+//		at function 5 (main) at offset 0x61 (main.rs:7), gas 40
+//
+// The exceptions thrown by a call nested in a host function unwind as is,
+// for the callers of the host function to catch.
+type TrapError struct {
+	Err   error
+	Stack []StackFrame // From the innermost frame
+}
+
+func (e *TrapError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error value the VM trapped with.
+func (e *TrapError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TrapError) TrapCode() TrapCode {
+	return TrapCodeOf(e.Err)
+}
+
+// RecoverTrap returns the trap of a call as an error in err, for the
+// callers of ExecCode and the like to get traps as errors:
+//
+//	func run(vm *exec.VM, fn int64) (res interface{}, err error) {
+//		defer exec.RecoverTrap(&err)
+//		return vm.ExecCode(fn)
+//	}
+//
+// It must be deferred, and panics again with any other value.
+func RecoverTrap(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	trap, ok := r.(*TrapError)
+	if !ok {
+		panic(r)
+	}
+	*err = trap
+}
+
+// Format formats e like its message, followed by its call stack with the
+// %+v verb.
+func (e *TrapError) Format(s fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && s.Flag('+'):
+		io.WriteString(s, e.Error())
+		for _, frame := range e.Stack {
+			fmt.Fprintf(s, "\n\tat %v", frame)
+		}
+	case verb == 'q':
+		fmt.Fprintf(s, "%q", e.Error())
+	default:
+		io.WriteString(s, e.Error())
+	}
+}
+
+// trapError returns the value a call traps with for the error value err,
+// adding the call stack of vm to it, unless it already has one or is an
+// exception a caller of the host function running the call may catch.
+func (vm *VM) trapError(err error) error {
+	if _, ok := err.(*TrapError); ok {
+		return err
+	}
+	if _, ok := err.(*Exception); ok && vm.activeCalls > 1 {
+		return err
+	}
+	return &TrapError{Err: err, Stack: vm.callStack()}
+}
+
+// callStack returns the frames of the calls in progress of vm, from the
+// innermost one.
+func (vm *VM) callStack() []StackFrame {
+	used := vm.meteredGas()
+	contexts := append(vm.frames[:len(vm.frames):len(vm.frames)], vm.ctx)
+	stack := make([]StackFrame, 0, len(contexts))
+	for i := len(contexts) - 1; i >= 0; i-- {
+		ctx := contexts[i]
+		// the pc of a frame is past the start of its instruction
+		pc := ctx.pc - 1
+		frame := StackFrame{
+			Func:   ctx.curFunc,
+			Name:   vm.funcName(ctx.curFunc),
+			Offset: -1,
+			Source: vm.sourceLine(ctx.curFunc, pc),
+		}
+		if offset, ok := vm.compiled.CodeOffset(ctx.curFunc, pc); ok {
+			frame.Offset = offset
+		}
+		// refunds may give back gas consumed before the frame
+		if used > ctx.gasStart {
+			frame.Gas = used - ctx.gasStart
+		}
+		stack = append(stack, frame)
+	}
+	return stack
+}
+
+// meteredGas returns the gas consumed so far by the meter of vm, if it has
+// one.
+func (vm *VM) meteredGas() uint64 {
+	if vm.gasMeter == nil {
+		return 0
+	}
+	return vm.gasMeter.used
+}
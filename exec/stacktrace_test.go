@@ -0,0 +1,130 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// trapValue returns the error value the VM trapped with, if r is a
+// TrapError, and else r.
+func trapValue(r interface{}) interface{} {
+	if trap, ok := r.(*TrapError); ok {
+		return trap.Err
+	}
+	return r
+}
+
+func TestTrapError(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	facRec := int64(module.Export.Entries["fac-rec"].Index)
+	instrs, err := compiled.Disassemble(int(facRec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offsets := make(map[int64]bool)
+	for _, instr := range instrs {
+		offsets[instr.Offset] = true
+	}
+
+	// fac-rec runs out of gas 3 calls deep
+	meter := NewGasMeter(1 << 62)
+	vm.SetGasMeter(meter, DefaultGasSchedule())
+	var limit uint64
+	vm.SetTraceFunc(func(fnIndex, pc int64, opcode byte, stackDepth int) {
+		if limit == 0 && vm.CallDepth() == 3 {
+			limit = meter.Used()
+		}
+	})
+	if _, err := vm.ExecCode(facRec, 5); err != nil {
+		t.Fatal(err)
+	}
+	vm.SetTraceFunc(nil)
+	vm.SetGasMeter(NewGasMeter(limit), DefaultGasSchedule())
+
+	var r interface{}
+	func() {
+		defer func() { r = recover() }()
+		vm.ExecCode(facRec, 5)
+	}()
+	trap, ok := r.(*TrapError)
+	if !ok || trap.Err != ErrOutOfGas || TrapCodeOf(trap) != TrapOutOfGas {
+		t.Fatalf("got=%#v, want a TrapError", r)
+	}
+	if len(trap.Stack) != 3 {
+		t.Fatalf("unexpected stack: %+v", trap.Stack)
+	}
+	for i, frame := range trap.Stack {
+		if frame.Func != facRec || !offsets[frame.Offset] {
+			t.Errorf("frame %d: %+v", i, frame)
+		}
+		// the outer frames consumed the gas of the inner ones
+		if i > 0 && frame.Gas <= trap.Stack[i-1].Gas {
+			t.Errorf("frame %d: gas %d, inner frame %d", i, frame.Gas, trap.Stack[i-1].Gas)
+		}
+	}
+	if outer := trap.Stack[2]; outer.Gas != limit {
+		t.Errorf("outer frame: gas %d, want %d", outer.Gas, limit)
+	}
+
+	if msg := fmt.Sprint(trap); msg != ErrOutOfGas.Error() {
+		t.Errorf("%%v: got %q", msg)
+	}
+	lines := strings.Split(fmt.Sprintf("%+v", trap), "\n")
+	if len(lines) != 4 || lines[0] != ErrOutOfGas.Error() || !strings.HasPrefix(lines[1], "\tat function ") {
+		t.Errorf("%%+v: got %q", lines)
+	}
+	if got := DeterministicError(trap); got != "out_of_gas" {
+		t.Errorf("DeterministicError: got=%s", got)
+	}
+
+	// RecoverTrap returns the trap as an error, and lets other panics
+	// unwind
+	vm.SetGasMeter(NewGasMeter(limit), DefaultGasSchedule())
+	call := func() (err error) {
+		defer RecoverTrap(&err)
+		_, err = vm.ExecCode(facRec, 5)
+		return err
+	}
+	if err := call(); !errors.As(err, &trap) || trap.Err != ErrOutOfGas {
+		t.Errorf("RecoverTrap: got %v", err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != "fault" {
+				t.Errorf("RecoverTrap: got the panic %v", r)
+			}
+		}()
+		var err error
+		defer RecoverTrap(&err)
+		panic("fault")
+	}()
+}
@@ -0,0 +1,165 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "bytes"
+
+// StateDiff is the difference between two states of an instance: the
+// ranges of its memory and the globals which changed from the old state
+// to the new one. Applied to an instance in the old state, it brings it to
+// the new one, which makes it a minimal delta to commit the state of an
+// instance to storage.
+type StateDiff struct {
+	// OldSize and NewSize are the sizes of the memory in bytes. The bytes
+	// the memory grew by are zeros in the old state.
+	OldSize uint64
+	NewSize uint64
+	Memory  []MemoryChange
+	Globals []GlobalChange
+}
+
+// MemoryChange is a range of memory whose bytes changed, some of them
+// possibly unchanged between the changed ones: Old and New are its
+// contents in the old and the new state.
+type MemoryChange struct {
+	Addr uint64
+	Old  []byte
+	New  []byte
+}
+
+// GlobalChange is a global slot whose value changed, see disasm.GlobalSlots.
+type GlobalChange struct {
+	Slot int
+	Old  uint64
+	New  uint64
+}
+
+// Empty returns whether the states d was computed from are the same.
+func (d *StateDiff) Empty() bool {
+	return d.OldSize == d.NewSize && len(d.Memory) == 0 && len(d.Globals) == 0
+}
+
+// diffGap is the number of unchanged bytes under which two ranges of
+// changed memory are merged.
+const diffGap = 8
+
+// appendMemoryDiff appends to ranges the ranges of bytes of new differing
+// from old, the bytes past old being zeros, at offsets from base. A range
+// closer than diffGap to the last one of ranges is merged with it.
+func appendMemoryDiff(ranges [][2]int, base int, old, new []byte) [][2]int {
+	for i := 0; i < len(new); i++ {
+		if i%64 == 0 && i+64 <= len(old) && i+64 <= len(new) && bytes.Equal(new[i:i+64], old[i:i+64]) {
+			i += 63
+			continue
+		}
+		if i < len(old) && new[i] == old[i] || i >= len(old) && new[i] == 0 {
+			continue
+		}
+		if n := len(ranges); n != 0 && base+i-ranges[n-1][1] < diffGap {
+			ranges[n-1][1] = base + i + 1
+		} else {
+			ranges = append(ranges, [2]int{base + i, base + i + 1})
+		}
+	}
+	return ranges
+}
+
+// newStateDiff returns the diff of the globals from old to new, and of the
+// memory whose changed ranges are given, read by the function contents.
+func newStateDiff(oldSize, newSize int, ranges [][2]int, contents func(start, end int) (old, new []byte), oldGlobals, newGlobals []uint64) *StateDiff {
+	d := &StateDiff{OldSize: uint64(oldSize), NewSize: uint64(newSize)}
+	for _, r := range ranges {
+		old, new := contents(r[0], r[1])
+		d.Memory = append(d.Memory, MemoryChange{Addr: uint64(r[0]), Old: old, New: new})
+	}
+	for i := range newGlobals {
+		if i < len(oldGlobals) && oldGlobals[i] != newGlobals[i] {
+			d.Globals = append(d.Globals, GlobalChange{Slot: i, Old: oldGlobals[i], New: newGlobals[i]})
+		}
+	}
+	return d
+}
+
+// diffMemory returns the diff between the states given by their memory and
+// globals.
+func diffMemory(oldMemory, newMemory []byte, oldGlobals, newGlobals []uint64) *StateDiff {
+	ranges := appendMemoryDiff(nil, 0, oldMemory, newMemory)
+	return newStateDiff(len(oldMemory), len(newMemory), ranges, func(start, end int) ([]byte, []byte) {
+		return zeroExtended(oldMemory, start, end), append([]byte(nil), newMemory[start:end]...)
+	}, oldGlobals, newGlobals)
+}
+
+// zeroExtended returns a copy of the bytes of memory from start to end,
+// the bytes past memory being zeros.
+func zeroExtended(memory []byte, start, end int) []byte {
+	b := make([]byte, end-start)
+	if start < len(memory) {
+		copy(b, memory[start:])
+	}
+	return b
+}
+
+// DiffContinuations returns the diff between the states of the instance
+// captured by two continuations of the same instance, see Continuation.
+func DiffContinuations(old, new *Continuation) *StateDiff {
+	return diffMemory(old.Memory, new.Memory, old.Globals, new.Globals)
+}
+
+// ApplyDiff brings the memory and globals of inst from the old state of d
+// to its new one, growing its memory if needed. It returns
+// ERR_STATE_MISMATCH, leaving inst unchanged, if inst isn't in the old
+// state of d as far as d can tell.
+func (inst *Instance) ApplyDiff(d *StateDiff) error {
+	if uint64(len(inst.memory)) != d.OldSize || d.NewSize < d.OldSize || (d.NewSize-d.OldSize)%uint64(inst.pageSize) != 0 {
+		return ERR_STATE_MISMATCH
+	}
+	for _, c := range d.Memory {
+		if c.Addr > d.NewSize || uint64(len(c.New)) > d.NewSize-c.Addr || len(c.Old) != len(c.New) {
+			return ERR_STATE_MISMATCH
+		}
+		if c.Addr >= d.OldSize {
+			continue
+		}
+		// the bytes the memory grows by are zeros
+		old := c.Old
+		if uint64(len(old)) > d.OldSize-c.Addr {
+			old = old[:d.OldSize-c.Addr]
+		}
+		if !bytes.Equal(inst.memory[c.Addr:c.Addr+uint64(len(old))], old) {
+			return ERR_STATE_MISMATCH
+		}
+	}
+	for _, g := range d.Globals {
+		if g.Slot < 0 || g.Slot >= len(inst.globals) || inst.globals[g.Slot] != g.Old {
+			return ERR_STATE_MISMATCH
+		}
+	}
+
+	inst.generation++
+	if d.NewSize > d.OldSize && inst.growMemory(uint32((d.NewSize-d.OldSize)/uint64(inst.pageSize))) < 0 {
+		return ERR_STATE_MISMATCH
+	}
+	for _, c := range d.Memory {
+		copy(inst.memory[c.Addr:], c.New)
+		inst.wrote(c.Addr, uint64(len(c.New)))
+	}
+	for _, g := range d.Globals {
+		inst.globals[g.Slot] = g.New
+	}
+	return nil
+}
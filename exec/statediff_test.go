@@ -0,0 +1,80 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestStateDiff(t *testing.T) {
+	module := readTestModule(t, "testdata/state.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newInstance := func() *Instance {
+		inst, err := compiled.Instantiate(NewEnvFunc())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return inst
+	}
+	old, inst := newInstance(), newInstance()
+	defer old.Close()
+	defer inst.Close()
+
+	// store(addr, v) stores the byte v, counting the stores in the global
+	vm := inst.NewVM()
+	store := uint64(module.Export.Entries["store"].Index)
+	grow := uint64(module.Export.Entries["grow"].Index)
+	for _, call := range [][]uint64{{store, 10, 1}, {store, 12, 2}, {store, 5000, 3}, {grow}, {store, 70000, 4}} {
+		if _, err := vm.ExecCode(int64(call[0]), call[1:]...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := diffMemory(old.memory, inst.memory, old.globals, inst.globals)
+	want := &StateDiff{
+		OldSize: wasmPageSize,
+		NewSize: 2 * wasmPageSize,
+		Memory: []MemoryChange{
+			{Addr: 10, Old: []byte{0, 0, 0}, New: []byte{1, 0, 2}},
+			{Addr: 5000, Old: []byte{0}, New: []byte{3}},
+			{Addr: 70000, Old: []byte{0}, New: []byte{4}},
+		},
+		Globals: []GlobalChange{{Slot: 0, Old: 0, New: 4}},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Fatalf("got=%+v, want=%+v", d, want)
+	}
+
+	if err := old.ApplyDiff(d); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(old.memory, inst.memory) || !reflect.DeepEqual(old.globals, inst.globals) {
+		t.Error("the diff doesn't bring the old state to the new one")
+	}
+	if err := old.ApplyDiff(d); err != ERR_STATE_MISMATCH {
+		t.Errorf("applying the diff twice: got=%v, want=%v", err, ERR_STATE_MISMATCH)
+	}
+	if d := diffMemory(old.memory, inst.memory, old.globals, inst.globals); !d.Empty() {
+		t.Errorf("unexpected diff: %+v", d)
+	}
+}
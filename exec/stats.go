@@ -0,0 +1,106 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// ModuleStats summarizes the size and complexity of a module, see
+// Module.Stats. It marshals to JSON with the field names given in its
+// tags, for the documents checked by deployment pipelines.
+type ModuleStats struct {
+	// Functions is the number of functions defined by the module, and
+	// CodeSizes the size in bytes of the code of each of them, indexed
+	// like ExecCode's functions.
+	Functions int   `json:"functions"`
+	CodeSizes []int `json:"code_sizes"`
+	CodeSize  int   `json:"code_size"` // The sum of CodeSizes
+
+	Imports int `json:"imports"`
+	Exports int `json:"exports"`
+
+	Memories []LimitsStats `json:"memories"` // The limits of the memories, the imported ones first
+	Tables   []LimitsStats `json:"tables"`   // The limits of the tables, the imported ones first
+
+	// MaxBrTable is the largest number of targets of a br_table of the
+	// module, its default target included, and MaxBrTableFunction the
+	// function using it, -1 if the module has no br_table.
+	MaxBrTable         int `json:"max_br_table"`
+	MaxBrTableFunction int `json:"max_br_table_function"`
+}
+
+// LimitsStats is the initial and maximum sizes of a memory, in pages, or
+// of a table, in elements. Maximum is nil if the size is unbounded.
+type LimitsStats struct {
+	Initial uint32  `json:"initial"`
+	Maximum *uint32 `json:"maximum,omitempty"`
+}
+
+func limitsStats(limits wasm.ResizableLimits) LimitsStats {
+	stats := LimitsStats{Initial: limits.Initial}
+	if limits.Flags&1 != 0 {
+		max := limits.Maximum
+		stats.Maximum = &max
+	}
+	return stats
+}
+
+// Stats returns the statistics of m. The code of the functions is
+// disassembled to find the br_table operators, and Stats returns the error
+// disassembling a function left invalid by VMConfig.LazyCompile.
+func (m *Module) Stats() (*ModuleStats, error) {
+	module := m.module
+	stats := &ModuleStats{
+		Functions:          len(module.FunctionIndexSpace),
+		CodeSizes:          make([]int, len(module.FunctionIndexSpace)),
+		Exports:            len(module.Exports()),
+		MaxBrTableFunction: -1,
+	}
+	if module.Import != nil {
+		stats.Imports = len(module.Import.Entries)
+	}
+	for _, mem := range module.Memories() {
+		stats.Memories = append(stats.Memories, limitsStats(mem.Limits))
+	}
+	for _, table := range module.Tables() {
+		stats.Tables = append(stats.Tables, limitsStats(table.Limits))
+	}
+
+	for i := range module.FunctionIndexSpace {
+		instrs, err := disasm.DisassembleFunction(module, i)
+		if err != nil {
+			return nil, err
+		}
+		stats.CodeSizes[i] = len(module.FunctionIndexSpace[i].Body.Code)
+		stats.CodeSize += stats.CodeSizes[i]
+		for _, instr := range instrs {
+			if instr.Op.Code != ops.BrTable {
+				continue
+			}
+			// the count of the targets, followed by them and the default
+			if n := len(instr.Immediates) - 1; n > stats.MaxBrTable {
+				stats.MaxBrTable = n
+				stats.MaxBrTableFunction = i
+			}
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,259 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "math"
+
+// StateStore is the key-value storage of the contracts, provided by the
+// embedder to the storage host functions, see RegisterStorage. The keys
+// of every contract are apart from the ones of the other contracts.
+type StateStore interface {
+	// Get returns the value of key, and false if there is none.
+	Get(contract string, key []byte) ([]byte, bool, error)
+	// Set sets the value of key.
+	Set(contract string, key, value []byte) error
+	// Remove removes key, if any.
+	Remove(contract string, key []byte) error
+	// Next returns the smallest key starting with prefix which isn't less
+	// than start, in bytewise order, and false if there is none.
+	Next(contract string, prefix, start []byte) ([]byte, bool, error)
+}
+
+// The limits of the keys and values of a StorageConfig setting none.
+const (
+	DefaultStorageKeySize   = 1024
+	DefaultStorageValueSize = 64 * 1024
+)
+
+// StorageConfig configures the storage host functions.
+type StorageConfig struct {
+	// MaxKeySize and MaxValueSize are the largest keys and values in
+	// bytes, DefaultStorageKeySize and DefaultStorageValueSize if zero.
+	MaxKeySize   int
+	MaxValueSize int
+	// CallGas is the gas charged for every call, ReadByteGas for every
+	// byte of the keys given and of the values and keys read, and
+	// WriteByteGas for every byte of the values written, HOST_CALL_GAS
+	// and HOST_BYTE_GAS if zero.
+	CallGas      uint64
+	ReadByteGas  uint64
+	WriteByteGas uint64
+}
+
+// The statuses returned by the storage host functions, see
+// RegisterStorage.
+const (
+	STORAGE_NOT_FOUND = -1 - iota // no such key
+	STORAGE_TOO_LARGE             // the key or the value is larger than allowed
+)
+
+// RegisterStorage registers the storage host functions into env, which
+// read and write the StateStore of the VM calling them, see SetStateStore,
+// in the keys of its contract, see SetContract:
+//
+//	int32_t storage_get(uint8_t *key, uint32_t key_len, uint8_t *value, uint32_t value_len);
+//	int32_t storage_set(uint8_t *key, uint32_t key_len, uint8_t *value, uint32_t value_len);
+//	int32_t storage_remove(uint8_t *key, uint32_t key_len);
+//	int32_t storage_iterate(uint8_t *prefix, uint32_t prefix_len, uint8_t *start, uint32_t start_len,
+//	                        uint8_t *key, uint32_t key_len);
+//
+// storage_get copies at most value_len bytes of the value of key to value,
+// and returns the length of the whole value. storage_iterate copies the
+// smallest key starting with prefix which isn't less than start the same
+// way, for the keys to be iterated by passing the last key followed by a
+// zero byte as the next start. Both return STORAGE_NOT_FOUND without such
+// a key. storage_set and storage_remove return zero. They all return
+// STORAGE_TOO_LARGE for a key or a value larger than config allows.
+// Buffers out of the bounds of the memory trap the VM, and so does the
+// lack of a StateStore, with ErrNoStateStore. The errors of the store
+// fail the call.
+func RegisterStorage(env *EnvFunc, config StorageConfig) {
+	if config.MaxKeySize == 0 {
+		config.MaxKeySize = DefaultStorageKeySize
+	}
+	if config.MaxValueSize == 0 {
+		config.MaxValueSize = DefaultStorageValueSize
+	}
+	if config.CallGas == 0 {
+		config.CallGas = HOST_CALL_GAS
+	}
+	if config.ReadByteGas == 0 {
+		config.ReadByteGas = HOST_BYTE_GAS
+	}
+	if config.WriteByteGas == 0 {
+		config.WriteByteGas = HOST_BYTE_GAS
+	}
+	s := &storageFuncs{config}
+	env.Register("storage_get", s.get)
+	env.Register("storage_set", s.set)
+	env.Register("storage_remove", s.remove)
+	env.Register("storage_iterate", s.iterate)
+}
+
+// ErrNoStateStore is the error value used while trapping the VM when a
+// storage host function is called by a VM without a StateStore.
+var ErrNoStateStore = newTrap(TrapHostError, "exec: no state store")
+
+// SetStateStore sets the StateStore of vm, which the storage host
+// functions access, see RegisterStorage.
+func (vm *VM) SetStateStore(store StateStore) {
+	vm.stateStore = store
+}
+
+// StateStore returns the StateStore of vm, if any.
+func (vm *VM) StateStore() StateStore {
+	return vm.stateStore
+}
+
+type storageFuncs struct {
+	config StorageConfig
+}
+
+// begin charges the call with the given bytes read and written, and
+// returns the store of vm and the contract of its keys.
+func (s *storageFuncs) begin(vm *VM, read, written int) (StateStore, string) {
+	if vm.stateStore == nil {
+		panic(ErrNoStateStore)
+	}
+	s.charge(vm, read, written)
+	contract := ""
+	if vm.contract != nil && vm.contract.Trx != nil {
+		contract = vm.contract.Trx.Contract
+	}
+	return vm.stateStore, contract
+}
+
+// charge charges the gas of a call with the given bytes read and written.
+func (s *storageFuncs) charge(vm *VM, read, written int) {
+	if vm.gasMeter == nil {
+		return
+	}
+	vm.ChargeGas(s.config.CallGas)
+	vm.ChargeGas(byteGas(s.config.ReadByteGas, read))
+	vm.ChargeGas(byteGas(s.config.WriteByteGas, written))
+}
+
+// byteGas returns the gas of n bytes costing perByte, saturating at the
+// largest uint64.
+func byteGas(perByte uint64, n int) uint64 {
+	if perByte != 0 && uint64(n) > math.MaxUint64/perByte {
+		return math.MaxUint64
+	}
+	return perByte * uint64(n)
+}
+
+// result copies at most n bytes of b, charged as read, to the buffer at
+// ptr, and returns the length of b from the host function.
+func (s *storageFuncs) result(vm *VM, b []byte, ptr, n uint32) {
+	if vm.gasMeter != nil {
+		vm.ChargeGas(byteGas(s.config.ReadByteGas, len(b)))
+	}
+	copy(vm.hostOutput(ptr, n), b)
+	vm.SetFuncResult(uint64(uint32(len(b))))
+}
+
+// status returns status from the host function.
+func (s *storageFuncs) status(vm *VM, status int32) {
+	vm.SetFuncResult(uint64(uint32(status)))
+}
+
+func (s *storageFuncs) get(vm *VM) (bool, error) {
+	params := vm.GetFuncParams()
+	if len(params) != 4 {
+		return false, ERR_PARAM_COUNT
+	}
+	key := vm.hostBytes(uint32(params[0]), uint32(params[1]))
+	vm.hostBytes(uint32(params[2]), uint32(params[3]))
+	store, contract := s.begin(vm, len(key), 0)
+	if len(key) > s.config.MaxKeySize {
+		s.status(vm, STORAGE_TOO_LARGE)
+		return true, nil
+	}
+	value, ok, err := store.Get(contract, key)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		s.status(vm, STORAGE_NOT_FOUND)
+		return true, nil
+	}
+	s.result(vm, value, uint32(params[2]), uint32(params[3]))
+	return true, nil
+}
+
+func (s *storageFuncs) set(vm *VM) (bool, error) {
+	params := vm.GetFuncParams()
+	if len(params) != 4 {
+		return false, ERR_PARAM_COUNT
+	}
+	key := vm.hostBytes(uint32(params[0]), uint32(params[1]))
+	value := vm.hostBytes(uint32(params[2]), uint32(params[3]))
+	store, contract := s.begin(vm, len(key), len(value))
+	if len(key) > s.config.MaxKeySize || len(value) > s.config.MaxValueSize {
+		s.status(vm, STORAGE_TOO_LARGE)
+		return true, nil
+	}
+	if err := store.Set(contract, append([]byte(nil), key...), append([]byte(nil), value...)); err != nil {
+		return false, err
+	}
+	s.status(vm, 0)
+	return true, nil
+}
+
+func (s *storageFuncs) remove(vm *VM) (bool, error) {
+	params := vm.GetFuncParams()
+	if len(params) != 2 {
+		return false, ERR_PARAM_COUNT
+	}
+	key := vm.hostBytes(uint32(params[0]), uint32(params[1]))
+	store, contract := s.begin(vm, len(key), 0)
+	if len(key) > s.config.MaxKeySize {
+		s.status(vm, STORAGE_TOO_LARGE)
+		return true, nil
+	}
+	if err := store.Remove(contract, key); err != nil {
+		return false, err
+	}
+	s.status(vm, 0)
+	return true, nil
+}
+
+func (s *storageFuncs) iterate(vm *VM) (bool, error) {
+	params := vm.GetFuncParams()
+	if len(params) != 6 {
+		return false, ERR_PARAM_COUNT
+	}
+	prefix := vm.hostBytes(uint32(params[0]), uint32(params[1]))
+	start := vm.hostBytes(uint32(params[2]), uint32(params[3]))
+	vm.hostBytes(uint32(params[4]), uint32(params[5]))
+	store, contract := s.begin(vm, len(prefix)+len(start), 0)
+	if len(prefix) > s.config.MaxKeySize || len(start) > s.config.MaxKeySize+1 {
+		s.status(vm, STORAGE_TOO_LARGE)
+		return true, nil
+	}
+	key, ok, err := store.Next(contract, prefix, start)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		s.status(vm, STORAGE_NOT_FOUND)
+		return true, nil
+	}
+	s.result(vm, key, uint32(params[4]), uint32(params[5]))
+	return true, nil
+}
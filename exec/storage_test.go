@@ -0,0 +1,230 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bottos-project/bottos/common/types"
+	"github.com/bottos-project/bottos/contract"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// memStateStore is a StateStore keeping the values in memory.
+type memStateStore map[string][]byte
+
+func (s memStateStore) Get(contract string, key []byte) ([]byte, bool, error) {
+	v, ok := s[contract+"/"+string(key)]
+	return v, ok, nil
+}
+
+func (s memStateStore) Set(contract string, key, value []byte) error {
+	s[contract+"/"+string(key)] = value
+	return nil
+}
+
+func (s memStateStore) Remove(contract string, key []byte) error {
+	delete(s, contract+"/"+string(key))
+	return nil
+}
+
+func (s memStateStore) Next(contract string, prefix, start []byte) ([]byte, bool, error) {
+	var keys []string
+	for k := range s {
+		if key := strings.TrimPrefix(k, contract+"/"); key != k && strings.HasPrefix(key, string(prefix)) && key >= string(start) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, false, nil
+	}
+	sort.Strings(keys)
+	return []byte(keys[0]), true, nil
+}
+
+func TestStorage(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/storage.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnvFunc()
+	RegisterStorage(env, StorageConfig{MaxKeySize: 4, MaxValueSize: 8, CallGas: 10, WriteByteGas: 5})
+	inst, err := compiled.Instantiate(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	store := memStateStore{}
+	vm.SetStateStore(store)
+	vm.SetContract(&contract.Context{Trx: &types.Transaction{Contract: "c"}})
+
+	// the key is at 100, the value or the start at 200, and the buffer at 300
+	const key, value, buf = 100, 200, 300
+	call := func(name string, args ...uint64) int32 {
+		t.Helper()
+		res, err := vm.ExecCode(int64(module.Export.Entries[name].Index), args...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return int32(res.(uint32))
+	}
+	set := func(k, v string) int32 {
+		t.Helper()
+		copy(vm.Memory()[key:], k)
+		copy(vm.Memory()[value:], v)
+		return call("set", key, uint64(len(k)), value, uint64(len(v)))
+	}
+	get := func(k string, n int) (int32, string) {
+		t.Helper()
+		copy(vm.Memory()[key:], k)
+		status := call("get", key, uint64(len(k)), buf, uint64(n))
+		if status < 0 {
+			return status, ""
+		}
+		if int(status) < n {
+			n = int(status)
+		}
+		return status, string(vm.Memory()[buf : buf+n])
+	}
+	iterate := func(prefix, start string) string {
+		t.Helper()
+		copy(vm.Memory()[key:], prefix)
+		copy(vm.Memory()[value:], start)
+		status := call("iterate", key, uint64(len(prefix)), value, uint64(len(start)), buf, 16)
+		if status < 0 {
+			return ""
+		}
+		return string(vm.Memory()[buf : buf+int(status)])
+	}
+
+	for _, kv := range [][2]string{{"a1", "x"}, {"a2", "yy"}, {"b", "z"}} {
+		if status := set(kv[0], kv[1]); status != 0 {
+			t.Fatalf("set %s: %d", kv[0], status)
+		}
+	}
+	if got := string(store["c/a2"]); got != "yy" {
+		t.Errorf("store: got=%q, want=yy", got)
+	}
+	if status, v := get("a2", 16); status != 2 || v != "yy" {
+		t.Errorf("get: got=%d %q, want=2 yy", status, v)
+	}
+	if status, v := get("a2", 1); status != 2 || v != "y" {
+		t.Errorf("truncated get: got=%d %q, want=2 y", status, v)
+	}
+	if status, _ := get("a3", 16); status != STORAGE_NOT_FOUND {
+		t.Errorf("missing get: got=%d, want=%d", status, STORAGE_NOT_FOUND)
+	}
+
+	var keys []string
+	for start := ""; ; {
+		k := iterate("a", start)
+		if k == "" {
+			break
+		}
+		keys = append(keys, k)
+		start = k + "\x00"
+	}
+	if strings.Join(keys, ",") != "a1,a2" {
+		t.Errorf("iterate: got=%v, want=[a1 a2]", keys)
+	}
+
+	copy(vm.Memory()[key:], "a1")
+	if status := call("remove", key, 2); status != 0 {
+		t.Errorf("remove: %d", status)
+	}
+	if status, _ := get("a1", 16); status != STORAGE_NOT_FOUND {
+		t.Errorf("removed get: got=%d, want=%d", status, STORAGE_NOT_FOUND)
+	}
+	if status := set("long!", "v"); status != STORAGE_TOO_LARGE {
+		t.Errorf("long key: got=%d, want=%d", status, STORAGE_TOO_LARGE)
+	}
+	if status := set("k", "too long!"); status != STORAGE_TOO_LARGE {
+		t.Errorf("long value: got=%d, want=%d", status, STORAGE_TOO_LARGE)
+	}
+
+	// the call, the bytes of the key and value read, and the bytes written
+	meter := NewGasMeter(1000)
+	vm.SetGasMeter(meter, nil)
+	set("k", "vvv")
+	if got := meter.Used(); got != 10+1+3*5 {
+		t.Errorf("set gas: got=%d, want=%d", got, 10+1+3*5)
+	}
+	get("k", 16)
+	if got := meter.Used(); got != 26+10+1+3 {
+		t.Errorf("get gas: got=%d, want=%d", got, 26+10+1+3)
+	}
+
+	vm.SetStateStore(nil)
+	defer func() {
+		if err := trapValue(recover()); err != ErrNoStateStore {
+			t.Errorf("got=%v, want=%v", err, ErrNoStateStore)
+		}
+	}()
+	get("k", 16)
+}
+
+func TestStoreJournal(t *testing.T) {
+	store := memStateStore{"c/a": []byte("1"), "c/b": []byte("2"), "c/d": []byte("4"), "x/c": []byte("0")}
+	j := newStoreJournal(store)
+	j.Set("c", []byte("c"), []byte("3"))
+	j.Remove("c", []byte("b"))
+	j.Set("c", []byte("a"), []byte("10"))
+
+	var keys []string
+	for start := []byte(nil); ; {
+		key, ok, err := j.Next("c", nil, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		keys = append(keys, string(key))
+		start = append(key, 0)
+	}
+	if strings.Join(keys, ",") != "a,c,d" {
+		t.Errorf("keys: got=%v, want=[a c d]", keys)
+	}
+	if _, ok, _ := j.Get("c", []byte("b")); ok {
+		t.Error("a removed key is found")
+	}
+	if len(store) != 4 || string(store["c/a"]) != "1" {
+		t.Errorf("the store changed before the commit: %q", store)
+	}
+
+	if err := j.commit(); err != nil {
+		t.Fatal(err)
+	}
+	want := memStateStore{"c/a": []byte("10"), "c/c": []byte("3"), "c/d": []byte("4"), "x/c": []byte("0")}
+	if len(store) != len(want) {
+		t.Errorf("got=%q, want=%q", store, want)
+	}
+	for k, v := range want {
+		if !bytes.Equal(store[k], v) {
+			t.Errorf("%s: got=%q, want=%q", k, store[k], v)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"bytes"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// maxLinkedCalls is the number of calls from an instance to another
+// through the tables of a Store which may be nested.
+const maxLinkedCalls = 64
+
+// Store owns memories, tables and globals which the instances of several
+// modules import and share, like a main module and the side modules it
+// links dynamically, see InstantiateIn. Instead of starting with a copy of
+// the memory or table they import, like the instances of Instantiate, the
+// instances importing a memory of the store access that very memory, and
+// the ones importing a table call the functions of the other instances
+// through it. A Store and its instances must be used by one goroutine at a
+// time, unless the memory is declared shared, see Spawn.
+type Store struct {
+	memories map[string]*storeMemory
+	tables   map[string]*storeTable
+	globals  map[string]uint64
+	// the functions the elements of the tables reference, from any
+	// instance, and their references
+	funcs []storeFunc
+	refs  map[storeFunc]uint32
+	// the number of calls between instances in progress
+	depth  int
+	closed bool
+}
+
+// storeMemory is a memory of a Store, which its instances share like a
+// memory declared shared: it never moves, see sharedMemory.
+type storeMemory struct {
+	shared *sharedMemory
+	memory []byte
+	limits wasm.ResizableLimits
+}
+
+// storeTable is a funcref table of a Store, whose elements are references
+// to the functions of the store, or wasm.NullRef.
+type storeTable struct {
+	elems  []uint32
+	limits wasm.ResizableLimits
+}
+
+// storeFunc is a function of an instance of a Store.
+type storeFunc struct {
+	inst  *Instance
+	index uint32
+}
+
+// NewStore returns an empty Store.
+func NewStore() *Store {
+	return &Store{
+		memories: make(map[string]*storeMemory),
+		tables:   make(map[string]*storeTable),
+		globals:  make(map[string]uint64),
+		refs:     make(map[storeFunc]uint32),
+	}
+}
+
+// defined returns whether s defines field of module.
+func (s *Store) defined(module, field string) bool {
+	key := module + "." + field
+	_, memory := s.memories[key]
+	_, table := s.tables[key]
+	_, global := s.globals[key]
+	return memory || table || global
+}
+
+// DefineMemory adds to s a memory of the given limits, which the modules
+// import as field of module. The memory is allocated to its maximum size,
+// which the limits must set, so that it never moves. It returns
+// ERR_STORE_DEFINITION if s already defines the field, or for limits
+// without a maximum.
+func (s *Store) DefineMemory(module, field string, limits wasm.ResizableLimits) error {
+	if s.closed {
+		return ERR_STORE_CLOSED
+	}
+	if s.defined(module, field) || limits.Flags&0x1 == 0 || limits.Maximum < limits.Initial {
+		return ERR_STORE_DEFINITION
+	}
+	size, maxSize := memorySize(limits)
+	mem := &storeMemory{
+		shared: &sharedMemory{size: size, refs: 1},
+		memory: make([]byte, size, maxSize),
+		limits: limits,
+	}
+	mem.shared.store = mem
+	s.memories[module+"."+field] = mem
+	return nil
+}
+
+// DefineTable adds to s a funcref table of the given limits, which the
+// modules import as field of module, and whose elements start null. It
+// returns ERR_STORE_DEFINITION if s already defines the field.
+func (s *Store) DefineTable(module, field string, limits wasm.ResizableLimits) error {
+	if s.closed {
+		return ERR_STORE_CLOSED
+	}
+	if s.defined(module, field) || limits.Flags&0x1 != 0 && limits.Maximum < limits.Initial || limits.Initial > maxTableElements {
+		return ERR_STORE_DEFINITION
+	}
+	elems := make([]uint32, limits.Initial)
+	for i := range elems {
+		elems[i] = uint32(wasm.NullRef)
+	}
+	s.tables[module+"."+field] = &storeTable{elems: elems, limits: limits}
+	return nil
+}
+
+// DefineGlobal adds to s an immutable global whose value has the raw bits
+// value, which the modules import as field of module, for instance the
+// address of the data of a side module in the memory and the index of its
+// functions in the table: the active segments whose offset is the value
+// of the global are placed accordingly. It returns ERR_STORE_DEFINITION if
+// s already defines the field.
+func (s *Store) DefineGlobal(module, field string, value uint64) error {
+	if s.closed {
+		return ERR_STORE_CLOSED
+	}
+	if s.defined(module, field) {
+		return ERR_STORE_DEFINITION
+	}
+	s.globals[module+"."+field] = value
+	return nil
+}
+
+// Close releases the memories of s, which its instances keep until they
+// are closed too. No module can be instantiated in s afterwards.
+func (s *Store) Close() error {
+	if s.closed {
+		return ERR_STORE_CLOSED
+	}
+	s.closed = true
+	for _, m := range s.memories {
+		m.shared.release()
+	}
+	return nil
+}
+
+// InstantiateIn creates a new instance of m like Instantiate, the memory,
+// tables and globals the module imports being the ones s defines with the
+// same names, if any. Only the first memory of the module can be imported
+// from s, and only funcref tables. The data segments of the module are
+// copied to the memory of s, which isn't cleared, and its element
+// segments are set in the tables of s, at the offsets the globals of s
+// give them, if any. The instance can't be cloned, nor reset or forked
+// if it imports the memory of s, which is shared.
+//
+// The functions of the tables of s run on the instance defining them: the
+// call_indirect of an instance calling a function of another instance
+// runs it on a new VM of the other instance, with the gas meter of the
+// caller. The table.get and table.set of an instance on a table of s only
+// handle its own functions, trapping otherwise, and the other table
+// operators don't apply to the tables of s, which only the host grows,
+// see Table.Grow. It returns
+// ERR_STORE_IMPORT for an import not matching the definition of s.
+func (m *Module) InstantiateIn(s *Store, imports *EnvFunc) (*Instance, error) {
+	if s.closed {
+		return nil, ERR_STORE_CLOSED
+	}
+	return m.instantiate(s, imports)
+}
+
+// link binds the imports of inst to the definitions of s, returning the
+// memory it imports from s, if any.
+func (s *Store) link(inst *Instance) (*storeMemory, error) {
+	module := inst.compiled.module
+	if module.Import == nil {
+		return nil, nil
+	}
+	var linked *storeMemory
+	memories, tables, globals := 0, 0, uint32(0)
+	for _, entry := range module.Import.Entries {
+		key := entry.ModuleName + "." + entry.FieldName
+		switch t := entry.Type.(type) {
+		case wasm.MemoryImport:
+			if mem, ok := s.memories[key]; ok {
+				if memories != 0 || !mem.matches(t.Type.Limits) {
+					return nil, ERR_STORE_IMPORT
+				}
+				linked = mem
+			}
+			memories++
+		case wasm.TableImport:
+			if table, ok := s.tables[key]; ok {
+				if t.Type.ElementType != wasm.ElemTypeAnyFunc || !table.matches(t.Type.Limits) {
+					return nil, ERR_STORE_IMPORT
+				}
+				if inst.linked == nil {
+					inst.linked = make([]*storeTable, len(module.Tables()))
+				}
+				inst.linked[tables] = table
+			}
+			tables++
+		case wasm.GlobalVarImport:
+			if value, ok := s.globals[key]; ok {
+				if t.Type.Mutable {
+					return nil, ERR_STORE_IMPORT
+				}
+				if inst.linkedGlobals == nil {
+					inst.linkedGlobals = make(map[uint32]uint64)
+				}
+				inst.linkedGlobals[globals] = value
+			}
+			globals++
+		}
+	}
+	return linked, nil
+}
+
+// matches returns whether the memory can be imported as a memory of the
+// given limits.
+func (m *storeMemory) matches(limits wasm.ResizableLimits) bool {
+	m.shared.mu.Lock()
+	size := m.shared.size
+	m.shared.mu.Unlock()
+	return limits.Memory64() == m.limits.Memory64() && limits.PageSize() == m.limits.PageSize() &&
+		limits.Shared() == m.limits.Shared() && uint64(size) >= uint64(limits.Initial)*uint64(limits.PageSize()) &&
+		(limits.Flags&0x1 == 0 || m.limits.Maximum <= limits.Maximum)
+}
+
+// matches returns whether the table can be imported as a table of the
+// given limits.
+func (t *storeTable) matches(limits wasm.ResizableLimits) bool {
+	return uint64(len(t.elems)) >= uint64(limits.Initial) &&
+		(limits.Flags&0x1 == 0 || t.limits.Flags&0x1 != 0 && t.limits.Maximum <= limits.Maximum)
+}
+
+// maxElements returns the number of elements the table can grow to.
+func (t *storeTable) maxElements() uint32 {
+	if t.limits.Flags&0x1 != 0 && t.limits.Maximum < maxTableElements {
+		return t.limits.Maximum
+	}
+	return maxTableElements
+}
+
+// linkMemory makes the memory of s the first memory of inst.
+func (inst *Instance) linkMemory(m *storeMemory) {
+	s := m.shared
+	s.mu.Lock()
+	s.refs++
+	inst.memory = m.memory[:s.size]
+	s.mu.Unlock()
+	inst.shared = s
+	inst.memory64 = m.limits.Memory64()
+	inst.pageSize = m.limits.PageSize()
+	inst.initialMemory = len(inst.memory)
+	_, inst.maxMemory = memorySize(m.limits)
+}
+
+// funcRef returns the reference of the function of inst with the given
+// index in the tables of s.
+func (s *Store) funcRef(inst *Instance, index uint32) uint32 {
+	f := storeFunc{inst: inst, index: index}
+	ref, ok := s.refs[f]
+	if !ok {
+		ref = uint32(len(s.funcs))
+		s.funcs = append(s.funcs, f)
+		s.refs[f] = ref
+	}
+	return ref
+}
+
+// copyDataSegments copies the active data segments of the first memory of
+// the module of inst to its memory, which it imports from a Store.
+func (inst *Instance) copyDataSegments() error {
+	module := inst.compiled.module
+	if module.Data == nil {
+		return nil
+	}
+	for _, segment := range module.Data.Entries {
+		if segment.Mode != wasm.SegmentActive || segment.Index != 0 {
+			continue
+		}
+		offset, err := inst.segmentOffset(segment.Offset)
+		if err != nil {
+			return err
+		}
+		if offset > uint64(len(inst.memory)) || uint64(len(inst.memory))-offset < uint64(len(segment.Data)) {
+			return wasm.ErrDataSegmentOutOfBounds
+		}
+		copy(inst.memory[offset:], segment.Data)
+	}
+	return nil
+}
+
+// initLinked sets the elements of the active element segments of the
+// module of inst in the tables it imports from its Store, and the globals
+// it imports from it.
+func (inst *Instance) initLinked() error {
+	module := inst.compiled.module
+	s := inst.store
+	for i, table := range inst.linked {
+		if table != nil {
+			inst.tables[i] = nil
+		}
+	}
+	if module.Elements != nil && inst.linked != nil {
+		for i, segment := range module.Elements.Entries {
+			if segment.Mode != wasm.SegmentActive || int(segment.Index) >= len(inst.linked) || inst.linked[segment.Index] == nil {
+				continue
+			}
+			table := inst.linked[segment.Index]
+			offset, err := inst.segmentOffset(segment.Offset)
+			if err != nil {
+				return err
+			}
+			if offset > uint64(len(table.elems)) || uint64(len(table.elems))-offset < uint64(len(segment.Elems)) {
+				return wasm.ElementSegmentOutOfBoundsError{Segment: i, Offset: uint32(offset), Len: len(segment.Elems), TableSize: len(table.elems)}
+			}
+			for j, index := range segment.Elems {
+				ref := uint32(wasm.NullRef)
+				if index != uint32(wasm.NullRef) {
+					ref = s.funcRef(inst, index)
+				}
+				table.elems[offset+uint64(j)] = ref
+			}
+		}
+	}
+
+	// the imported globals are in the index space if the module was read
+	// with its imports resolved
+	imported := len(module.GlobalIndexSpace)
+	if module.Global != nil {
+		imported -= len(module.Global.Globals)
+	}
+	slots := disasm.GlobalSlots(module)
+	for index, value := range inst.linkedGlobals {
+		if int(index) < imported {
+			inst.globals[slots[index]] = value
+		}
+	}
+	return nil
+}
+
+// segmentOffset returns the offset of an active segment of the module of
+// inst, given by the constant expression expr, which may get a global the
+// instance imports from its Store.
+func (inst *Instance) segmentOffset(expr []byte) (uint64, error) {
+	if len(expr) > 2 && expr[0] == ops.GetGlobal && expr[len(expr)-1] == ops.End {
+		r := bytes.NewReader(expr[1 : len(expr)-1])
+		if index, err := leb128.ReadVarUint32(r); err == nil && r.Len() == 0 {
+			if value, ok := inst.linkedGlobals[index]; ok {
+				return value, nil
+			}
+		}
+	}
+	value, err := inst.compiled.module.ExecInitExpr(expr)
+	if err != nil {
+		return 0, err
+	}
+	switch value := value.(type) {
+	case int32:
+		return uint64(uint32(value)), nil
+	case int64:
+		return uint64(value), nil
+	}
+	return 0, ERR_DATA_INDEX
+}
+
+// resolveLinked returns the function of the instance of vm at index i of
+// a table of its Store, for a call_indirect of the type with the given
+// index, and true. If the function is the one of another instance, it
+// calls it and returns false.
+func (vm *VM) resolveLinked(table *storeTable, typeIndex, i uint32) (uint32, bool) {
+	if int(i) >= len(table.elems) || table.elems[i] == uint32(wasm.NullRef) {
+		panic(ErrUndefinedElementIndex)
+	}
+	f := vm.store.funcs[table.elems[i]]
+	sig := f.inst.compiled.module.FunctionIndexSpace[f.index].Sig
+	if !sameSignature(sig, &vm.module.Types.Entries[typeIndex]) {
+		panic(ErrSignatureMismatch)
+	}
+	if f.inst == vm.Instance {
+		return f.index, true
+	}
+	vm.callLinked(f, sig)
+	return 0, false
+}
+
+// callLinked calls the function f of another instance of the Store of vm,
+// with the signature sig, on a new VM of the instance metered by the gas
+// meter of vm, passing it the arguments on the stack of vm and pushing its
+// results.
+func (vm *VM) callLinked(f storeFunc, sig *wasm.FunctionSig) {
+	s := vm.store
+	if s.depth >= maxLinkedCalls {
+		panic(StackOverflowError{Limit: "linked call depth", Max: maxLinkedCalls})
+	}
+	args := make([]uint64, disasm.Slots(sig.ParamTypes...))
+	for i := len(args) - 1; i >= 0; i-- {
+		args[i] = vm.popUint64()
+	}
+	callee := f.inst.NewVM()
+	callee.inheritGas(vm)
+	s.depth++
+	defer func() { s.depth-- }()
+	res, err := callee.ExecCodeValues(int64(f.index), args...)
+	if err != nil {
+		panic(err)
+	}
+	// the callee may have grown the memory
+	vm.syncMemory()
+	for _, v := range res {
+		vm.pushUint64(v)
+	}
+}
+
+// inheritGas makes vm consume its gas from the meter of caller, at the
+// costs of caller.
+func (vm *VM) inheritGas(caller *VM) {
+	if caller.gasMeter == nil {
+		return
+	}
+	costs := caller.gasCosts
+	if costs == nil {
+		costs = caller.blockOpCosts
+	}
+	vm.gasMeter, vm.gasCosts = caller.gasMeter, costs
+	vm.growCost, vm.miscCosts, vm.bulkByteCost = caller.growCost, caller.miscCosts, caller.bulkByteCost
+	vm.simdCosts, vm.atomicCosts, vm.gcCosts = caller.simdCosts, caller.atomicCosts, caller.gcCosts
+	if costs != nil && vm.compiled.config.BlockMetering {
+		vm.blockCosts = vm.compiled.blockCosts(costs)
+		vm.blockOpCosts, vm.gasCosts = costs, nil
+	}
+}
+
+// sameSignature returns whether a and b are the same function type.
+func sameSignature(a, b *wasm.FunctionSig) bool {
+	if len(a.ParamTypes) != len(b.ParamTypes) || len(a.ReturnTypes) != len(b.ReturnTypes) {
+		return false
+	}
+	for i, t := range a.ParamTypes {
+		if b.ParamTypes[i] != t {
+			return false
+		}
+	}
+	for i, t := range a.ReturnTypes {
+		if b.ReturnTypes[i] != t {
+			return false
+		}
+	}
+	return true
+}
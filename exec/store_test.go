@@ -0,0 +1,175 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestStore(t *testing.T) {
+	mainModule := readTestModule(t, "testdata/store-main.wasm")
+	sideModule, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/store-side.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainCompiled, err := CompileModule(mainModule, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sideCompiled, err := CompileModule(sideModule, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore()
+	if err := store.DefineMemory("env", "memory", wasm.ResizableLimits{Flags: 1, Initial: 1, Maximum: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DefineTable("env", "table", wasm.ResizableLimits{Initial: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DefineGlobal("env", "memoryBase", 64); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DefineGlobal("env", "memory", 0); err != ERR_STORE_DEFINITION {
+		t.Errorf("redefined memory: %v", err)
+	}
+
+	main, err := mainCompiled.InstantiateIn(store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer main.Close()
+	side, err := sideCompiled.InstantiateIn(store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer side.Close()
+	call := func(inst *Instance, name string, args ...interface{}) uint32 {
+		res, err := inst.Call(name, args...)
+		if err != nil {
+			t.Fatalf("%s%v: %v", name, args, err)
+		}
+		return res[0].(uint32)
+	}
+
+	// the data of both modules is in the memory, the one of the side
+	// module at its base
+	for _, inst := range []*Instance{main, side} {
+		for addr, want := range map[uint32]string{16: "main", 64: "side"} {
+			if s, err := inst.LinearMemory().ReadString(addr, 4); err != nil || s != want {
+				t.Errorf("data at %d: got=%q, %v", addr, s, err)
+			}
+		}
+	}
+	if base := call(side, "base"); base != 64 {
+		t.Errorf("base: got=%d", base)
+	}
+
+	// the instances call each other through the table
+	if v := call(main, "dispatch", 0, 6, 7); v != 13 {
+		t.Errorf("main add: got=%d", v)
+	}
+	if v := call(main, "dispatch", 1, 6, 7); v != 42 {
+		t.Errorf("side mul from main: got=%d", v)
+	}
+	if v := call(side, "call", 0, 2, 3); v != 5 {
+		t.Errorf("main add from side: got=%d", v)
+	}
+
+	// and see the writes and the growth of the memory of each other
+	if size := call(main, "dispatch", 2, 128, 0xbeef); size != 1 {
+		t.Errorf("size: got=%d", size)
+	}
+	if v := call(main, "load", 128); v != 0xbeef {
+		t.Errorf("load: got=%#x", v)
+	}
+	if prev := call(main, "grow", 1); prev != 1 {
+		t.Errorf("grow: got=%d", prev)
+	}
+	if size := call(side, "call", 2, 0, 0); size != 2 || side.LinearMemory().Pages() != 2 {
+		t.Errorf("size after growth: got=%d", size)
+	}
+
+	// the gas of the functions of the side module is charged to the caller
+	vm := main.NewVM()
+	meter := NewGasMeter(1 << 20)
+	vm.SetGasMeter(meter, DefaultGasSchedule())
+	if _, err := vm.ExecCode(int64(mainModule.Export.Entries["dispatch"].Index), 0, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	local := meter.Used()
+	if _, err := vm.ExecCode(int64(mainModule.Export.Entries["dispatch"].Index), 1, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if meter.Used() < 2*local {
+		t.Errorf("gas: %d for a local call, %d with a linked one", local, meter.Used()-local)
+	}
+
+	// the table resolves the functions of both instances
+	table := main.Table(0)
+	if elem, err := table.Get(1); err != nil || elem.Instance != side || elem.Func != 0 {
+		t.Errorf("element 1: got=%+v, %v", elem, err)
+	}
+	if err := table.Set(3, TableElement{Func: 0, Instance: main}); err != nil {
+		t.Fatal(err)
+	}
+	if v := call(side, "call", 3, 20, 22); v != 42 {
+		t.Errorf("element 3: got=%d", v)
+	}
+	if prev, ok := side.Table(0).Grow(2, TableElement{Null: true}); !ok || prev != 4 || main.Table(0).Len() != 6 {
+		t.Errorf("grow: got=%d, %v", prev, ok)
+	}
+	trapped := func() (err error) {
+		defer func() { err, _ = recover().(error) }()
+		main.Call("dispatch", 5, 0, 0)
+		return nil
+	}()
+	if !errors.Is(trapped, ErrUndefinedElementIndex) {
+		t.Errorf("null element: %v", trapped)
+	}
+
+	if _, err := main.Clone(); err != ERR_STORE_INSTANCE {
+		t.Errorf("clone: %v", err)
+	}
+	if err := main.Reset(); err != ERR_MEMORY_SHARED {
+		t.Errorf("reset: %v", err)
+	}
+
+	// the imports must match the definitions
+	other := NewStore()
+	other.DefineMemory("env", "memory", wasm.ResizableLimits{Flags: 1, Initial: 1, Maximum: 8})
+	if _, err := mainCompiled.InstantiateIn(other, nil); err != ERR_STORE_IMPORT {
+		t.Errorf("larger maximum: %v", err)
+	}
+	other.Close()
+	if _, err := mainCompiled.InstantiateIn(other, nil); err != ERR_STORE_CLOSED {
+		t.Errorf("closed store: %v", err)
+	}
+
+	// the memory outlives the store
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if v := call(main, "load", 128); v != 0xbeef {
+		t.Errorf("load after close: got=%#x", v)
+	}
+}
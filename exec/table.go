@@ -0,0 +1,166 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// maxTableElements is the number of elements a table without a maximum
+// size can grow to, which bounds the memory table.grow allocates.
+const maxTableElements = 1 << 20
+
+// ExternRef returns the externref handle of v, for host functions to pass
+// v to the module. A nil v is the null reference. The handles stay valid
+// until the instance is reset.
+func (inst *Instance) ExternRef(v interface{}) uint64 {
+	if v == nil {
+		return uint64(wasm.NullRef)
+	}
+	inst.externs = append(inst.externs, v)
+	return uint64(len(inst.externs) - 1)
+}
+
+// ExternValue returns the Go value of the externref handle ref, as given
+// by the module to a host function or returned by ExecCode, or nil for the
+// null reference.
+func (inst *Instance) ExternValue(ref uint64) interface{} {
+	if ref >= uint64(len(inst.externs)) {
+		return nil
+	}
+	return inst.externs[ref]
+}
+
+func (vm *VM) selectTyped() {
+	// the operand type, v128 values taking two slots
+	if wasm.ValueType(vm.fetchInt32()) == wasm.ValueTypeV128 {
+		vm.selectV128()
+		return
+	}
+	vm.selectOp()
+}
+
+func (vm *VM) refNull() {
+	vm.ctx.pc += 4 // the reference type
+	vm.pushUint32(uint32(wasm.NullRef))
+}
+
+func (vm *VM) refIsNull() {
+	if vm.popUint32() == uint32(wasm.NullRef) {
+		vm.pushUint32(1)
+	} else {
+		vm.pushUint32(0)
+	}
+}
+
+func (vm *VM) refAsNonNull() {
+	if uint32(vm.ctx.stack[len(vm.ctx.stack)-1]) == uint32(wasm.NullRef) {
+		panic(ErrNullReference)
+	}
+}
+
+func (vm *VM) refFunc() {
+	vm.pushUint32(vm.fetchUint32())
+}
+
+func (vm *VM) tableGet() {
+	tableIdx := vm.fetchUint32()
+	table := vm.tables[tableIdx]
+	index := vm.popUint32()
+	if vm.linked != nil && vm.linked[tableIdx] != nil {
+		vm.pushUint32(vm.linkedGet(vm.linked[tableIdx], index))
+		return
+	}
+	if int(index) >= len(table) {
+		panic(ErrOutOfBoundsTableAccess)
+	}
+	vm.pushUint32(table[index])
+}
+
+func (vm *VM) tableSet() {
+	tableIdx := vm.fetchUint32()
+	table := vm.tables[tableIdx]
+	ref, index := vm.popUint32(), vm.popUint32()
+	if vm.linked != nil && vm.linked[tableIdx] != nil {
+		vm.linkedSet(vm.linked[tableIdx], index, ref)
+		return
+	}
+	if int(index) >= len(table) {
+		panic(ErrOutOfBoundsTableAccess)
+	}
+	table[index] = ref
+	vm.resetCallSites()
+}
+
+// tableGrow adds n elements to a table, pushing its previous size, or -1
+// if the table can't grow past its maximum size or the ResourceLimiter
+// denies it.
+func (vm *VM) tableGrow() {
+	index := vm.fetchUint32()
+	n, ref := vm.popUint32(), vm.popUint32()
+	table := vm.tables[index]
+	if vm.linked != nil && vm.linked[index] != nil {
+		// only the host grows the tables of a store
+		vm.pushInt32(-1)
+		return
+	}
+
+	maximum := uint32(maxTableElements)
+	if limits := vm.module.Tables()[index].Limits; limits.Flags&0x1 != 0 && limits.Maximum < maximum {
+		maximum = limits.Maximum
+	}
+	current := uint32(len(table))
+	if uint64(current)+uint64(n) > uint64(maximum) || !vm.limitTableGrowth(current, current+n, maximum) {
+		vm.pushInt32(-1)
+		return
+	}
+	vm.chargeBulk(GasTable, uint64(n))
+	for i := uint32(0); i < n; i++ {
+		table = append(table, ref)
+	}
+	vm.tables[index] = table
+	vm.pushUint32(current)
+}
+
+// linkedGet returns the element at index of a table of the Store of vm,
+// which must be null or a function of its instance.
+func (vm *VM) linkedGet(table *storeTable, index uint32) uint32 {
+	if int(index) >= len(table.elems) {
+		panic(ErrOutOfBoundsTableAccess)
+	}
+	ref := table.elems[index]
+	if ref == uint32(wasm.NullRef) {
+		return ref
+	}
+	f := vm.store.funcs[ref]
+	if f.inst != vm.Instance {
+		panic(ErrOutOfBoundsTableAccess)
+	}
+	return f.index
+}
+
+// linkedSet sets the element at index of a table of the Store of vm to
+// ref, null or a function of its instance.
+func (vm *VM) linkedSet(table *storeTable, index, ref uint32) {
+	if int(index) >= len(table.elems) {
+		panic(ErrOutOfBoundsTableAccess)
+	}
+	if ref != uint32(wasm.NullRef) {
+		ref = vm.store.funcRef(vm.Instance, ref)
+	}
+	table.elems[index] = ref
+}
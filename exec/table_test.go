@@ -0,0 +1,69 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestExternRef(t *testing.T) {
+	module := readTestModule(t, "testdata/reference-types.wasm")
+	if err := validate.VerifyModule(module); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(name string, args ...uint64) interface{} {
+		res, err := vm.ExecCode(int64(module.Export.Entries[name].Index), args...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return res
+	}
+
+	type host struct{ name string }
+	value := &host{"handle"}
+	ref := vm.ExternRef(value)
+	if res := call("extern-id", ref); vm.ExternValue(uint64(res.(wasm.Ref))) != value {
+		t.Errorf("extern-id: got=%v, want=%v", res, value)
+	}
+	if res := call("extern-is-null", ref); res != uint32(0) {
+		t.Errorf("extern-is-null: got=%v, want=0", res)
+	}
+	if res := call("extern-is-null", vm.ExternRef(nil)); res != uint32(1) {
+		t.Errorf("extern-is-null(null): got=%v, want=1", res)
+	}
+
+	// the handles stored in a table outlive the call
+	call("extern-store", ref)
+	if res := call("extern-load"); vm.ExternValue(uint64(res.(wasm.Ref))) != value {
+		t.Errorf("extern-load: got=%v, want=%v", res, value)
+	}
+
+	if err := vm.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if res := call("extern-load"); res != wasm.NullRef {
+		t.Errorf("extern-load after Reset: got=%v, want=null", res)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"fmt"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// TableRangeError is returned by the accessors of Table for an element
+// which isn't in the table, or for a table the instance doesn't have. It
+// matches ErrOutOfBoundsTableAccess with errors.Is.
+type TableRangeError struct {
+	Table int
+	Index uint32
+	Size  int
+}
+
+func (e *TableRangeError) Error() string {
+	return fmt.Sprintf("%v: table %d, index %d, table size %d", ErrOutOfBoundsTableAccess, e.Table, e.Index, e.Size)
+}
+
+// Is reports whether target is ErrOutOfBoundsTableAccess.
+func (e *TableRangeError) Is(target error) bool {
+	return target == ErrOutOfBoundsTableAccess
+}
+
+// TrapCode returns TrapOutOfBoundsTable.
+func (e *TableRangeError) TrapCode() TrapCode { return TrapOutOfBoundsTable }
+
+// TableElement is an element of a table, as resolved by (Table).Get.
+type TableElement struct {
+	// Null is whether the element is the null reference.
+	Null bool
+	// Func is the index of the function of a funcref element, which
+	// call_indirect calls, Sig its signature and Name its name in the name
+	// section, if any. Import is the module and field names of the import
+	// of a host function, as "env.name", empty for the functions of the
+	// module. Instance is the instance of the function, which is another
+	// instance than the one of the table for a table of a Store, see
+	// InstantiateIn.
+	Func     uint32
+	Sig      *wasm.FunctionSig
+	Name     string
+	Import   string
+	Instance *Instance
+	// Extern is the Go value of an externref element, see ExternRef.
+	Extern interface{}
+}
+
+// Table accesses a table of an instance, for the tools auditing the
+// targets of the call_indirect of a contract and the debuggers showing
+// them. A Table follows the growth and the updates of the table, and is
+// tied to the instance: its accesses fail once the instance is closed.
+type Table struct {
+	inst  *Instance
+	index int
+}
+
+// Table returns the accessor of the table of inst with the given index.
+func (inst *Instance) Table(index int) Table {
+	return Table{inst: inst, index: index}
+}
+
+// Len returns the number of elements of the table, zero if the instance
+// has no such table.
+func (t Table) Len() int {
+	if t.index < 0 || t.index >= len(t.inst.tables) {
+		return 0
+	}
+	if linked := t.linked(); linked != nil {
+		return len(linked.elems)
+	}
+	return len(t.inst.tables[t.index])
+}
+
+// linked returns the table of the Store of the instance the table is, if
+// any.
+func (t Table) linked() *storeTable {
+	if t.index < 0 || t.index >= len(t.inst.linked) {
+		return nil
+	}
+	return t.inst.linked[t.index]
+}
+
+// Type returns the type of the elements of the table.
+func (t Table) Type() wasm.ElemType {
+	tables := t.inst.compiled.module.Tables()
+	if t.index < 0 || t.index >= len(tables) {
+		return 0
+	}
+	return tables[t.index].ElementType
+}
+
+// Get returns the element of the table at index i.
+func (t Table) Get(i uint32) (TableElement, error) {
+	if int(i) >= t.Len() {
+		return TableElement{}, &TableRangeError{Table: t.index, Index: i, Size: t.Len()}
+	}
+	inst, ref := t.inst, uint32(wasm.NullRef)
+	if linked := t.linked(); linked != nil {
+		if ref = linked.elems[i]; ref != uint32(wasm.NullRef) {
+			f := t.inst.store.funcs[ref]
+			inst, ref = f.inst, f.index
+		}
+	} else {
+		ref = t.inst.tables[t.index][i]
+	}
+	if ref == uint32(wasm.NullRef) {
+		return TableElement{Null: true}, nil
+	}
+	if t.Type() == wasm.ElemTypeExternRef {
+		return TableElement{Extern: t.inst.ExternValue(uint64(ref))}, nil
+	}
+	elem := TableElement{Func: ref, Instance: inst}
+	module := inst.compiled.module
+	if fn := module.GetFunction(int(ref)); fn != nil {
+		elem.Sig, elem.Name = fn.Sig, fn.Name
+		if fn.EnvFunc {
+			elem.Import = importName(module, ref)
+		}
+	}
+	return elem, nil
+}
+
+// Set sets the element of the table at index i to elem: the null
+// reference if elem.Null is set, and otherwise the function elem.Func of
+// a funcref table, or the Go value elem.Extern of an externref table, see
+// ExternRef. The function is the one of elem.Instance, if set, in a table
+// of a Store, and the one of the instance of the table otherwise. It
+// returns an InvalidFunctionIndexError for a function the module doesn't
+// have.
+func (t Table) Set(i uint32, elem TableElement) error {
+	if int(i) >= t.Len() {
+		return &TableRangeError{Table: t.index, Index: i, Size: t.Len()}
+	}
+	ref, err := t.ref(elem)
+	if err != nil {
+		return err
+	}
+	if linked := t.linked(); linked != nil {
+		linked.elems[i] = ref
+		return nil
+	}
+	t.inst.tables[t.index][i] = ref
+	t.inst.resetCallSites()
+	return nil
+}
+
+// Grow adds n elements set to elem to the table, like table.grow though
+// neither limited by a ResourceLimiter nor charged, and returns its
+// previous size, or false if it can't grow past its maximum size.
+func (t Table) Grow(n uint32, elem TableElement) (uint32, bool) {
+	tables := t.inst.compiled.module.Tables()
+	if t.index < 0 || t.index >= len(t.inst.tables) || t.index >= len(tables) {
+		return 0, false
+	}
+	ref, err := t.ref(elem)
+	if err != nil {
+		return 0, false
+	}
+	if linked := t.linked(); linked != nil {
+		current := uint32(len(linked.elems))
+		if uint64(current)+uint64(n) > uint64(linked.maxElements()) {
+			return 0, false
+		}
+		for j := uint32(0); j < n; j++ {
+			linked.elems = append(linked.elems, ref)
+		}
+		return current, true
+	}
+	maximum := uint32(maxTableElements)
+	if limits := tables[t.index].Limits; limits.Flags&0x1 != 0 && limits.Maximum < maximum {
+		maximum = limits.Maximum
+	}
+	table := t.inst.tables[t.index]
+	current := uint32(len(table))
+	if uint64(current)+uint64(n) > uint64(maximum) {
+		return 0, false
+	}
+	for j := uint32(0); j < n; j++ {
+		table = append(table, ref)
+	}
+	t.inst.tables[t.index] = table
+	return current, true
+}
+
+// ref returns the reference of the table holding elem.
+func (t Table) ref(elem TableElement) (uint32, error) {
+	inst := t.inst
+	if elem.Instance != nil && t.linked() != nil {
+		inst = elem.Instance
+	}
+	switch {
+	case elem.Null:
+		return uint32(wasm.NullRef), nil
+	case t.Type() == wasm.ElemTypeExternRef:
+		return uint32(t.inst.ExternRef(elem.Extern)), nil
+	case int(elem.Func) >= len(inst.compiled.module.FunctionIndexSpace):
+		return 0, InvalidFunctionIndexError(elem.Func)
+	case t.linked() != nil:
+		return t.inst.store.funcRef(inst, elem.Func), nil
+	}
+	return elem.Func, nil
+}
+
+// Elements returns the elements of the table, in order.
+func (t Table) Elements() []TableElement {
+	elems := make([]TableElement, t.Len())
+	for i := range elems {
+		elems[i], _ = t.Get(uint32(i))
+	}
+	return elems
+}
+
+// importName returns the module and field names of the imported function
+// with the given index, as "module.field".
+func importName(module *wasm.Module, index uint32) string {
+	if module.Import == nil {
+		return ""
+	}
+	n := uint32(0)
+	for _, entry := range module.Import.Entries {
+		if entry.Kind != wasm.ExternalFunction {
+			continue
+		}
+		if n == index {
+			return entry.ModuleName + "." + entry.FieldName
+		}
+		n++
+	}
+	return ""
+}
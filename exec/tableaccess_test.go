@@ -0,0 +1,85 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestTableAccess(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/table.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	funcs := inst.Table(0)
+	if funcs.Len() != 4 || funcs.Type() != wasm.ElemTypeAnyFunc {
+		t.Fatalf("table 0: %d elements of type %d", funcs.Len(), funcs.Type())
+	}
+	for i, want := range []TableElement{
+		{Func: 1},
+		{Func: 0, Import: "env.getMethod"},
+		{Null: true},
+		{Func: 2},
+	} {
+		elem, err := funcs.Get(uint32(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elem.Null != want.Null || elem.Func != want.Func || elem.Import != want.Import {
+			t.Errorf("element %d: got=%+v, want=%+v", i, elem, want)
+		}
+		if !want.Null && (elem.Sig == nil || len(elem.Sig.ParamTypes) != 2 || len(elem.Sig.ReturnTypes) != 1) {
+			t.Errorf("element %d: signature %v", i, elem.Sig)
+		}
+	}
+	if elems := funcs.Elements(); len(elems) != 4 || elems[3].Func != 2 {
+		t.Errorf("elements: %+v", elems)
+	}
+	if _, err := funcs.Get(4); !errors.Is(err, ErrOutOfBoundsTableAccess) {
+		t.Errorf("element 4: %v", err)
+	}
+	if _, err := inst.Table(2).Get(0); !errors.Is(err, ErrOutOfBoundsTableAccess) {
+		t.Errorf("table 2: %v", err)
+	}
+
+	// the table follows the updates of the module
+	refs := inst.Table(1)
+	if elem, err := refs.Get(1); err != nil || !elem.Null {
+		t.Fatalf("table 1: got=%+v, %v", elem, err)
+	}
+	vm := inst.NewVM()
+	if _, err := vm.ExecCode(int64(module.Export.Entries["keep"].Index), 1, inst.ExternRef("object")); err != nil {
+		t.Fatal(err)
+	}
+	if elem, err := refs.Get(1); err != nil || elem.Null || elem.Extern != "object" {
+		t.Errorf("table 1: got=%+v, %v", elem, err)
+	}
+}
@@ -0,0 +1,76 @@
+(module
+  (type (;0;) (func (result i32)))
+  (type (;1;) (func (param i32)))
+  (type (;2;) (func))
+  (type (;3;) (func (param i32) (result i32)))
+  (import "env" "oracle" (func (;0;) (type 0)))
+  (func (;1;) (type 1) (param i32)
+    i32.const 1
+    global.set 0
+    local.get 0
+    global.set 1)
+  (func (;2;) (type 2)
+    i32.const 0
+    global.set 0)
+  (func (;3;) (type 1) (param i32)
+    i32.const 2
+    global.set 0
+    local.get 0
+    global.set 1)
+  (func (;4;) (type 2)
+    i32.const 0
+    global.set 0)
+  (func (;5;) (type 3) (param i32) (result i32)
+    (local i32)
+    global.get 0
+    i32.const 2
+    i32.eq
+    if
+      global.get 1
+      global.get 1
+      i32.load
+      i32.const 4
+      i32.sub
+      i32.store
+      global.get 1
+      i32.load
+      i32.load
+      local.set 0
+    end
+    call 0
+    local.set 1
+    global.get 0
+    i32.const 1
+    i32.eq
+    if
+      global.get 1
+      i32.load
+      local.get 0
+      i32.store
+      global.get 1
+      global.get 1
+      i32.load
+      i32.const 4
+      i32.add
+      i32.store
+      i32.const 0
+      return
+    end
+    local.get 0
+    local.get 1
+    i32.const 2
+    i32.mul
+    i32.add)
+  (func (;6;) (type 0) (result i32)
+    global.get 0)
+  (memory (;0;) 1)
+  (global (;0;) (mut i32) (i32.const 0))
+  (global (;1;) (mut i32) (i32.const 0))
+  (export "asyncify_start_unwind" (func 1))
+  (export "asyncify_stop_unwind" (func 2))
+  (export "asyncify_start_rewind" (func 3))
+  (export "asyncify_stop_rewind" (func 4))
+  (export "run" (func 5))
+  (export "asyncify_get_state" (func 6))
+  (export "memory" (memory 0))
+)
@@ -0,0 +1,24 @@
+(module
+  (type (;0;) (func (result i32)))
+  (type (;1;) (func (result i64)))
+  (type (;2;) (func (param i32) (result i32)))
+  (type (;3;) (func (param i32 i32) (result i32)))
+  (type (;4;) (func (param i32 i64) (result i32)))
+  (func (;0;) (type 0) (result i32)
+    i32.const 0
+    i32.atomic.load)
+  (func (;1;) (type 0) (result i32)
+    i32.const 0
+    i32.const 67305985
+    i64.const 0
+    memory.atomic.wait32)
+  (func (;2;) (type 0) (result i32)
+    i32.const 0
+    i32.const 1
+    memory.atomic.notify)
+  (memory (;0;) 1)
+  (export "load" (func 0))
+  (export "wait" (func 1))
+  (export "notify" (func 2))
+  (data (;0;) (i32.const 0) "\01\02\03\04\05\06\07\08")
+)
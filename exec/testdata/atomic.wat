@@ -0,0 +1,135 @@
+(module
+  (type (;0;) (func (result i32)))
+  (type (;1;) (func (result i64)))
+  (type (;2;) (func (param i32) (result i32)))
+  (type (;3;) (func (param i32 i32) (result i32)))
+  (type (;4;) (func (param i32 i64) (result i32)))
+  (func (;0;) (type 0) (result i32)
+    i32.const 0
+    i32.atomic.load)
+  (func (;1;) (type 1) (result i64)
+    i32.const 0
+    i64.atomic.load)
+  (func (;2;) (type 0) (result i32)
+    i32.const 0
+    i32.atomic.load8_u offset=3)
+  (func (;3;) (type 1) (result i64)
+    i32.const 8
+    i64.const -1
+    i64.atomic.store32
+    atomic.fence
+    i32.const 8
+    i64.atomic.load)
+  (func (;4;) (type 0) (result i32)
+    i32.const 16
+    i32.const 16
+    i32.atomic.rmw.add
+    i32.const 16
+    i32.atomic.load
+    i32.sub)
+  (func (;5;) (type 0) (result i32)
+    i32.const 24
+    i32.const 2
+    i32.atomic.store8
+    i32.const 24
+    i32.const 3
+    i32.atomic.rmw8.sub_u
+    i32.const 24
+    i32.atomic.load8_u
+    i32.add)
+  (func (;6;) (type 0) (result i32)
+    i32.const 28
+    i32.const 9
+    i32.atomic.rmw.xchg
+    drop
+    i32.const 28
+    i32.const 5
+    i32.atomic.rmw.xchg
+    i32.const 28
+    i32.atomic.load
+    i32.add)
+  (func (;7;) (type 2) (param i32) (result i32)
+    i32.const 32
+    i32.const 3
+    i32.atomic.store
+    i32.const 32
+    local.get 0
+    i32.const 7
+    i32.atomic.rmw.cmpxchg
+    i32.const 32
+    i32.atomic.load
+    i32.add)
+  (func (;8;) (type 0) (result i32)
+    i32.const 40
+    i32.const 513
+    i32.atomic.store16
+    i32.const 40
+    i32.const 66049
+    i32.const 5
+    i32.atomic.rmw16.cmpxchg_u
+    i32.const 40
+    i32.atomic.load16_u
+    i32.add)
+  (func (;9;) (type 0) (result i32)
+    i32.const 2
+    i32.atomic.load)
+  (func (;10;) (type 0) (result i32)
+    i32.const 65536
+    i32.atomic.load)
+  (func (;11;) (type 0) (result i32)
+    i32.const 0
+    i32.const 1
+    memory.atomic.notify)
+  (func (;12;) (type 0) (result i32)
+    i32.const 0
+    i32.const 0
+    i64.const -1
+    memory.atomic.wait32)
+  (func (;13;) (type 0) (result i32)
+    i32.const 0
+    i32.const 67305985
+    i64.const 1000
+    memory.atomic.wait32)
+  (func (;14;) (type 0) (result i32)
+    i32.const 0
+    i64.const 0
+    i64.const 0
+    memory.atomic.wait64)
+  (func (;15;) (type 0) (result i32)
+    i32.const 1
+    memory.grow
+    drop
+    memory.size)
+  (func (;16;) (type 0) (result i32)
+    memory.size)
+  (func (;17;) (type 0) (result i32)
+    i32.const 48
+    i32.const 0
+    i64.const -1
+    memory.atomic.wait32)
+  (func (;18;) (type 0) (result i32)
+    i32.const 48
+    i32.const 1
+    memory.atomic.notify)
+  (memory (;0;) 1 2 shared)
+  (export "load" (func 0))
+  (export "load64" (func 1))
+  (export "load8" (func 2))
+  (export "store-load" (func 3))
+  (export "add" (func 4))
+  (export "sub8" (func 5))
+  (export "xchg" (func 6))
+  (export "cmpxchg" (func 7))
+  (export "cmpxchg16" (func 8))
+  (export "unaligned" (func 9))
+  (export "atomic-oob" (func 10))
+  (export "notify" (func 11))
+  (export "wait-not-equal" (func 12))
+  (export "wait-timeout" (func 13))
+  (export "wait64-not-equal" (func 14))
+  (export "grow" (func 15))
+  (export "size" (func 16))
+  (export "wait-flag" (func 17))
+  (export "notify-flag" (func 18))
+  (data (;0;) (i32.const 0) "\01\02\03\04\05\06\07\08")
+)
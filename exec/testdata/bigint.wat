@@ -0,0 +1,101 @@
+(module
+  (type (;0;) (func (param i32 i32 i32) (result i32)))
+  (type (;1;) (func (param i32 i32) (result i32)))
+  (import "env" "u128_add" (func (;0;) (type 0)))
+  (import "env" "u128_sub" (func (;1;) (type 0)))
+  (import "env" "u128_mul" (func (;2;) (type 0)))
+  (import "env" "u128_div" (func (;3;) (type 0)))
+  (import "env" "u128_mod" (func (;4;) (type 0)))
+  (import "env" "u128_pow" (func (;5;) (type 0)))
+  (import "env" "u128_cmp" (func (;6;) (type 1)))
+  (import "env" "u256_add" (func (;7;) (type 0)))
+  (import "env" "u256_sub" (func (;8;) (type 0)))
+  (import "env" "u256_mul" (func (;9;) (type 0)))
+  (import "env" "u256_div" (func (;10;) (type 0)))
+  (import "env" "u256_mod" (func (;11;) (type 0)))
+  (import "env" "u256_pow" (func (;12;) (type 0)))
+  (import "env" "u256_cmp" (func (;13;) (type 1)))
+  (func (;14;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 0)
+  (func (;15;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 1)
+  (func (;16;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 2)
+  (func (;17;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 3)
+  (func (;18;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 4)
+  (func (;19;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 5)
+  (func (;20;) (type 1) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    call 6)
+  (func (;21;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 7)
+  (func (;22;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 8)
+  (func (;23;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 9)
+  (func (;24;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 10)
+  (func (;25;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 11)
+  (func (;26;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 12)
+  (func (;27;) (type 1) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    call 13)
+  (memory (;0;) 1)
+  (export "u128_add" (func 14))
+  (export "u128_sub" (func 15))
+  (export "u128_mul" (func 16))
+  (export "u128_div" (func 17))
+  (export "u128_mod" (func 18))
+  (export "u128_pow" (func 19))
+  (export "u128_cmp" (func 20))
+  (export "u256_add" (func 21))
+  (export "u256_sub" (func 22))
+  (export "u256_mul" (func 23))
+  (export "u256_div" (func 24))
+  (export "u256_mod" (func 25))
+  (export "u256_pow" (func 26))
+  (export "u256_cmp" (func 27))
+)
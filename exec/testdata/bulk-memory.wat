@@ -0,0 +1,89 @@
+(module
+  (type (;0;) (func (result i32)))
+  (type (;1;) (func (param i32) (result i32)))
+  (func (;0;) (type 0) (result i32)
+    i32.const 1)
+  (func (;1;) (type 0) (result i32)
+    i32.const 2)
+  (func (;2;) (type 1) (param i32) (result i32)
+    local.get 0
+    i32.const 44
+    i32.const 4
+    memory.fill
+    local.get 0
+    i32.load8_u offset=3)
+  (func (;3;) (type 0) (result i32)
+    i32.const 100
+    i32.const 0
+    i32.const 4
+    memory.init 0
+    i32.const 200
+    i32.const 100
+    i32.const 4
+    memory.copy
+    i32.const 200
+    i32.load)
+  (func (;4;) (type 1) (param i32) (result i32)
+    i32.const 0
+    i32.const 0
+    i32.const 2
+    table.init 0
+    local.get 0
+    call_indirect (type 0))
+  (func (;5;) (type 0) (result i32)
+    i32.const 0
+    i32.const 0
+    i32.const 2
+    table.init 0
+    i32.const 2
+    i32.const 0
+    i32.const 2
+    table.copy
+    i32.const 2
+    call_indirect (type 0))
+  (func (;6;) (type 0) (result i32)
+    i32.const 8
+    i32.load8_u)
+  (func (;7;) (type 0) (result i32)
+    i32.const 65535
+    i32.const 0
+    i32.const 2
+    memory.fill
+    i32.const 0)
+  (func (;8;) (type 0) (result i32)
+    i32.const 3
+    i32.const 0
+    i32.const 2
+    table.init 0
+    i32.const 0)
+  (func (;9;) (type 0) (result i32)
+    elem.drop 0
+    i32.const 0
+    i32.const 0
+    i32.const 1
+    table.init 0
+    i32.const 0)
+  (func (;10;) (type 0) (result i32)
+    data.drop 0
+    i32.const 0
+    i32.const 0
+    i32.const 1
+    memory.init 0
+    i32.const 0)
+  (table (;0;) 4 funcref)
+  (memory (;0;) 1)
+  (export "one" (func 0))
+  (export "two" (func 1))
+  (export "fill" (func 2))
+  (export "init-copy" (func 3))
+  (export "table-init" (func 4))
+  (export "table-copy" (func 5))
+  (export "active" (func 6))
+  (export "fill-oob" (func 7))
+  (export "table-oob" (func 8))
+  (export "elem-drop" (func 9))
+  (export "drop-init" (func 10))
+  (elem (;0;) func 1 0)
+  (data (;0;) "abcd")
+  (data (;1;) (i32.const 8) "zz")
+)
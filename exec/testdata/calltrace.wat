@@ -0,0 +1,23 @@
+(module
+  (type (;0;) (func (param i32) (result i32)))
+  (import "env" "oracle" (func (;0;) (type 0)))
+  (func (;1;) (type 0) (param i32) (result i32)
+    local.get 0
+    i32.const 2
+    i32.mul)
+  (func (;2;) (type 0) (param i32) (result i32)
+    local.get 0
+    call 1
+    return_call 1)
+  (func (;3;) (type 0) (param i32) (result i32)
+    local.get 0
+    call 0
+    call 2)
+  (func (;4;) (type 0) (param i32) (result i32)
+    local.get 0
+    call 1
+    i32.const 0
+    i32.div_u)
+  (export "run" (func 3))
+  (export "fail" (func 4))
+)
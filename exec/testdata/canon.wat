@@ -0,0 +1,65 @@
+(module
+  (type (;0;) (func (param i32 i32 i32 i32) (result i32)))
+  (type (;1;) (func (param i32) (result i32)))
+  (type (;2;) (func (result i32)))
+  (func (;0;) (type 0) (param i32 i32 i32 i32) (result i32)
+    (local i32)
+    global.get 0
+    local.get 2
+    i32.add
+    i32.const 1
+    i32.sub
+    i32.const 0
+    local.get 2
+    i32.sub
+    i32.and
+    local.tee 4
+    local.get 4
+    local.get 3
+    i32.add
+    global.set 0)
+  (func (;1;) (type 1) (param i32) (result i32)
+    (local i32 i32 i32)
+    local.get 0
+    i32.load
+    local.set 1
+    local.get 0
+    i32.load offset=4
+    local.set 2
+    local.get 0
+    i32.load offset=8
+    local.set 3
+    block
+      loop
+        local.get 3
+        i32.eqz
+        br_if 1
+        local.get 1
+        local.get 2
+        i32.load
+        i32.add
+        local.set 1
+        local.get 2
+        i32.const 4
+        i32.add
+        local.set 2
+        local.get 3
+        i32.const 1
+        i32.sub
+        local.set 3
+        br 0
+      end
+    end
+    local.get 1)
+  (func (;2;) (type 2) (result i32)
+    i32.const 16)
+  (memory (;0;) 1)
+  (global (;0;) (mut i32) (i32.const 1024))
+  (export "cabi_realloc" (func 0))
+  (export "sum" (func 1))
+  (export "greet" (func 2))
+  (export "memory" (memory 0))
+  (data (;0;) (i32.const 16) "\00\00\00\00 \00\00\00\05\00\00\00")
+  (data (;1;) (i32.const 32) "hello")
+  (data (;2;) (i32.const 48) "\ff\fe")
+)
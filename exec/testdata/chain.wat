@@ -0,0 +1,35 @@
+(module
+  (type (;0;) (func (result i64)))
+  (type (;1;) (func (param i32 i32) (result i32)))
+  (import "env" "block_height" (func (;0;) (type 0)))
+  (import "env" "block_timestamp" (func (;1;) (type 0)))
+  (import "env" "value_transferred" (func (;2;) (type 0)))
+  (import "env" "caller_account" (func (;3;) (type 1)))
+  (import "env" "contract_account" (func (;4;) (type 1)))
+  (import "env" "tx_hash" (func (;5;) (type 1)))
+  (func (;6;) (type 0) (result i64)
+    call 0)
+  (func (;7;) (type 0) (result i64)
+    call 1)
+  (func (;8;) (type 0) (result i64)
+    call 2)
+  (func (;9;) (type 1) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    call 3)
+  (func (;10;) (type 1) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    call 4)
+  (func (;11;) (type 1) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    call 5)
+  (memory (;0;) 1)
+  (export "block_height" (func 6))
+  (export "block_timestamp" (func 7))
+  (export "value_transferred" (func 8))
+  (export "caller_account" (func 9))
+  (export "contract_account" (func 10))
+  (export "tx_hash" (func 11))
+)
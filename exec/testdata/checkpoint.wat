@@ -0,0 +1,51 @@
+(module
+  (type (;0;) (func (param i32) (result i32)))
+  (type (;1;) (func (result i32)))
+  (func (;0;) (type 0) (param i32) (result i32)
+    (local i32 i32)
+    block
+      loop
+        local.get 1
+        local.get 0
+        i32.ge_u
+        br_if 1
+        local.get 1
+        local.get 0
+        i32.const 2
+        i32.div_u
+        i32.eq
+        if
+          i32.const 1
+          memory.grow
+          drop
+        end
+        local.get 1
+        i32.const 1023
+        i32.and
+        i32.const 4
+        i32.mul
+        local.get 1
+        i32.store
+        local.get 2
+        local.get 1
+        i32.add
+        local.set 2
+        global.get 0
+        i32.const 1
+        i32.add
+        global.set 0
+        local.get 1
+        i32.const 1
+        i32.add
+        local.set 1
+        br 0
+      end
+    end
+    local.get 2)
+  (func (;1;) (type 1) (result i32)
+    global.get 0)
+  (memory (;0;) 1)
+  (global (;0;) (mut i32) (i32.const 0))
+  (export "fill" (func 0))
+  (export "count" (func 1))
+)
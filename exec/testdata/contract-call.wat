@@ -0,0 +1,86 @@
+(module
+  (type (;0;) (func (param i32 i32 i32 i32 i32 i32 i64 i32 i32) (result i32)))
+  (type (;1;) (func (param i32 i32 i32 i32) (result i32)))
+  (type (;2;) (func (param i32 i32) (result i32)))
+  (type (;3;) (func (param i32 i32 i32 i32 i32) (result i32)))
+  (import "env" "callContract" (func (;0;) (type 0)))
+  (func (;1;) (type 1) (param i32 i32 i32 i32) (result i32)
+    (local i32)
+    global.get 0
+    local.set 4
+    global.get 0
+    local.get 3
+    i32.add
+    i32.const 7
+    i32.add
+    i32.const -8
+    i32.and
+    global.set 0
+    local.get 4)
+  (func (;2;) (type 2) (param i32 i32) (result i32)
+    i32.const 0
+    local.get 0
+    i32.store
+    i32.const 4
+    local.get 1
+    i32.store
+    i32.const 0)
+  (func (;3;) (type 2) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    call 2)
+  (func (;4;) (type 2) (param i32 i32) (result i32)
+    loop
+      br 0
+    end
+    i32.const 0)
+  (func (;5;) (type 3) (param i32 i32 i32 i32 i32) (result i32)
+    (local i32)
+    i32.const 1024
+    local.get 0
+    local.get 1
+    local.get 2
+    i32.const 4
+    local.get 3
+    local.get 4
+    i64.const 0
+    i32.const 1028
+    i32.const 1024
+    call 0
+    local.tee 5
+    i32.store
+    i32.const 1024
+    i32.const 4
+    local.get 5
+    i32.const 0
+    local.get 5
+    i32.const 0
+    i32.gt_s
+    select
+    i32.add
+    call 2)
+  (func (;6;) (type 2) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    i32.const 64
+    i32.const 80
+    i32.const 2
+    call 5)
+  (func (;7;) (type 2) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    i32.const 72
+    local.get 0
+    local.get 1
+    call 5)
+  (memory (;0;) 1)
+  (global (;0;) (mut i32) (i32.const 4096))
+  (export "cabi_realloc" (func 1))
+  (export "echo" (func 3))
+  (export "spin" (func 4))
+  (export "relay" (func 6))
+  (export "loop" (func 7))
+  (data (;0;) (i32.const 64) "echo")
+  (data (;1;) (i32.const 72) "loop")
+  (data (;2;) (i32.const 80) "hi")
+)
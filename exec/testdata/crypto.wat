@@ -0,0 +1,49 @@
+(module
+  (type (;0;) (func (param i32 i32 i32) (result i32)))
+  (type (;1;) (func (param i32 i32 i32 i32) (result i32)))
+  (import "env" "sha256" (func (;0;) (type 0)))
+  (import "env" "keccak256" (func (;1;) (type 0)))
+  (import "env" "ripemd160" (func (;2;) (type 0)))
+  (import "env" "blake2b" (func (;3;) (type 1)))
+  (import "env" "ecrecover" (func (;4;) (type 0)))
+  (import "env" "ed25519_verify" (func (;5;) (type 1)))
+  (func (;6;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 0)
+  (func (;7;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 1)
+  (func (;8;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 2)
+  (func (;9;) (type 1) (param i32 i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    local.get 3
+    call 3)
+  (func (;10;) (type 0) (param i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    call 4)
+  (func (;11;) (type 1) (param i32 i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    local.get 3
+    call 5)
+  (memory (;0;) 1)
+  (export "sha256" (func 6))
+  (export "keccak256" (func 7))
+  (export "ripemd160" (func 8))
+  (export "blake2b" (func 9))
+  (export "ecrecover" (func 10))
+  (export "ed25519_verify" (func 11))
+)
@@ -0,0 +1,34 @@
+(module
+  (type (;0;) (func (result i32)))
+  (func (;0;) (type 0) (result i32)
+    memory.size)
+  (func (;1;) (type 0) (result i32)
+    i32.const 1
+    i32.load8_u)
+  (func (;2;) (type 0) (result i32)
+    i32.const 3
+    i32.load8_u)
+  (func (;3;) (type 0) (result i32)
+    i32.const 5
+    memory.grow)
+  (func (;4;) (type 0) (result i32)
+    memory.size)
+  (func (;5;) (type 0) (result i32)
+    i32.const 7
+    i32.const 42
+    i32.store8
+    i32.const 7
+    i32.load8_u)
+  (func (;6;) (type 0) (result i32)
+    i32.const 3
+    memory.grow)
+  (memory (;0;) 3 10 (pagesize 1))
+  (export "size" (func 0))
+  (export "load" (func 1))
+  (export "load-oob" (func 2))
+  (export "grow" (func 3))
+  (export "size-grown" (func 4))
+  (export "store-grown" (func 5))
+  (export "grow-too-much" (func 6))
+  (data (;0;) (i32.const 1) "\11")
+)
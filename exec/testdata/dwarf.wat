@@ -0,0 +1,18 @@
+(module
+  (type (;0;) (func (param i32) (result i32)))
+  (type (;1;) (func (param i32 i32)))
+  (func (;0;) (type 0) (param i32) (result i32)
+    local.get 0
+    i32.load)
+  (func (;1;) (type 1) (param i32 i32)
+    local.get 0
+    i32.const 0
+    local.get 1
+    memory.fill)
+  (memory (;0;) 1)
+  (export "load" (func 0))
+  (export "fill" (func 1))
+  (@custom ".debug_abbrev" "\01\11\00\03\08\10\17\1b\08\00\00\00")
+  (@custom ".debug_info" "\1f\00\00\00\04\00\00\00\00\00\04\01lib.rs\00\00\00\00\00/src/token\00\00")
+  (@custom ".debug_line" "^\00\00\00\04\00\1e\00\00\00\01\01\01\fb\0e\0d\00\01\01\01\01\00\00\00\01\00\00\01\00lib.rs\00\00\00\00\00\00\05\02\00\00\00\00\03\e3\00\01\02\04\00\01\01\00\05\02\03\00\00\00\03\8c\01\01\02\02\03\01\01\02\04\00\01\01\00\05\02\0b\00\00\00\03\95\01\01\02\06\03\03\01\02\05\00\01\01")
+)
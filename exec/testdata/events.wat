@@ -0,0 +1,87 @@
+(module
+  (type (;0;) (func (param i32 i32 i32 i32) (result i32)))
+  (type (;1;) (func (param i32 i32 i32 i32 i32 i32 i64 i32 i32) (result i32)))
+  (type (;2;) (func (param i32 i32) (result i32)))
+  (import "env" "emit_event" (func (;0;) (type 0)))
+  (import "env" "callContract" (func (;1;) (type 1)))
+  (func (;2;) (type 0) (param i32 i32 i32 i32) (result i32)
+    (local i32)
+    global.get 0
+    local.set 4
+    global.get 0
+    local.get 3
+    i32.add
+    i32.const 7
+    i32.add
+    i32.const -8
+    i32.and
+    global.set 0
+    local.get 4)
+  (func (;3;) (type 2) (param i32 i32) (result i32)
+    i32.const 0
+    local.get 0
+    i32.store
+    i32.const 4
+    local.get 1
+    i32.store
+    i32.const 0)
+  (func (;4;) (type 0) (param i32 i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    local.get 3
+    call 0)
+  (func (;5;) (type 2) (param i32 i32) (result i32)
+    i32.const 64
+    i32.const 3
+    local.get 0
+    local.get 1
+    call 0
+    drop
+    local.get 0
+    i32.load8_u
+    i32.const 33
+    i32.eq
+    if
+      i32.const -1
+      i32.load
+      drop
+    end
+    local.get 0
+    i32.const 0
+    call 3)
+  (func (;6;) (type 2) (param i32 i32) (result i32)
+    i32.const 72
+    i32.const 4
+    local.get 0
+    local.get 1
+    call 0
+    drop
+    i32.const 1024
+    local.get 0
+    i32.const 1
+    i32.const 64
+    i32.const 3
+    local.get 0
+    i32.const 1
+    i32.add
+    local.get 1
+    i32.const 1
+    i32.sub
+    i64.const 0
+    i32.const 0
+    i32.const 0
+    call 1
+    i32.store
+    i32.const 1024
+    i32.const 4
+    call 3)
+  (memory (;0;) 1)
+  (global (;0;) (mut i32) (i32.const 4096))
+  (export "cabi_realloc" (func 2))
+  (export "emit" (func 4))
+  (export "log" (func 5))
+  (export "nest" (func 6))
+  (data (;0;) (i32.const 64) "log")
+  (data (;1;) (i32.const 72) "nest")
+)
@@ -0,0 +1,32 @@
+(module
+  (type (;0;) (func (result i32)))
+  (type (;1;) (func (param i32)))
+  (type (;2;) (func))
+  (import "env" "raise" (func (;0;) (type 2)))
+  (import "env" "host_error" (tag (;0;) (type 1)))
+  (func (;1;) (type 0) (result i32)
+    try (result i32)
+      call 0
+      i32.const 0
+    catch 0
+    end)
+  (func (;2;) (type 0) (result i32)
+    try (result i32)
+      call 0
+      i32.const 0
+    catch 1
+    end)
+  (func (;3;) (type 0) (result i32)
+    i32.const 5
+    throw 0)
+  (func (;4;) (type 0) (result i32)
+    i32.const 6
+    throw 1)
+  (tag (;1;) (type 1))
+  (export "catch-host" (func 1))
+  (export "catch-local" (func 2))
+  (export "throw-host" (func 3))
+  (export "throw-local" (func 4))
+  (export "host_error" (tag 0))
+  (export "local" (tag 1))
+)
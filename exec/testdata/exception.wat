@@ -0,0 +1,98 @@
+(module
+  (type (;0;) (func (result i32)))
+  (type (;1;) (func (param i32)))
+  (type (;2;) (func))
+  (func (;0;) (type 1) (param i32)
+    local.get 0
+    throw 0)
+  (func (;1;) (type 0) (result i32)
+    i32.const 1
+    try (result i32)
+      i32.const 41
+      throw 0
+    catch 0
+    end
+    i32.add)
+  (func (;2;) (type 0) (result i32)
+    try (result i32)
+      i32.const 5
+      call 0
+      i32.const 0
+    catch_all
+      i32.const 9
+    end)
+  (func (;3;) (type 0) (result i32)
+    try (result i32)
+      i32.const 13
+      call 0
+      i32.const 0
+    catch 0
+    end)
+  (func (;4;) (type 0) (result i32)
+    try (result i32)
+      throw 1
+    catch 0
+    catch 1
+      i32.const 77
+    end)
+  (func (;5;) (type 0) (result i32)
+    try (result i32)
+      i32.const 5
+    catch_all
+      i32.const 6
+    end)
+  (func (;6;) (type 0) (result i32)
+    try (result i32)
+      try (result i32)
+        i32.const 21
+        throw 0
+      catch 0
+        drop
+        rethrow 0
+      end
+    catch 0
+    end)
+  (func (;7;) (type 0) (result i32)
+    try (result i32)
+      try (result i32)
+        try (result i32)
+          i32.const 33
+          throw 0
+        delegate 1
+      catch 0
+        i32.const 100
+        i32.add
+      end
+    catch 0
+    end)
+  (func (;8;) (type 0) (result i32)
+    try (result i32)
+      try (result i32)
+        try (result i32)
+          i32.const 33
+          throw 0
+        delegate 0
+      catch 0
+        i32.const 100
+        i32.add
+      end
+    catch 0
+    end)
+  (func (;9;) (type 0) (result i32)
+    i32.const 3
+    call 0
+    i32.const 0)
+  (tag (;0;) (type 1))
+  (tag (;1;) (type 2))
+  (export "thrower" (func 0))
+  (export "throw-caught" (func 1))
+  (export "catch-all" (func 2))
+  (export "catch-across-calls" (func 3))
+  (export "catch-by-tag" (func 4))
+  (export "try-no-throw" (func 5))
+  (export "rethrow" (func 6))
+  (export "delegate-outer" (func 7))
+  (export "delegate-inner" (func 8))
+  (export "uncaught" (func 9))
+  (export "error" (tag 0))
+)
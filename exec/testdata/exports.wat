@@ -0,0 +1,33 @@
+(module
+  (type (;0;) (func (result i32)))
+  (type (;1;) (func (param i32) (result i32)))
+  (func (;0;) (type 0) (result i32)
+    global.get 0
+    i32.const 1
+    i32.add
+    global.set 0
+    global.get 0)
+  (func (;1;) (type 1) (param i32) (result i32)
+    local.get 0
+    i32.load 1)
+  (func (;2;) (type 0) (result i32)
+    memory.size 1)
+  (func (;3;) (type 1) (param i32) (result i32)
+    local.get 0
+    call_indirect (type 0))
+  (table (;0;) 1 3 funcref)
+  (memory (;0;) 1)
+  (memory (;1;) 1 2)
+  (global (;0;) (mut i32) (i32.const 7))
+  (global (;1;) i64 (i64.const 3))
+  (export "mem" (memory 0))
+  (export "scratch" (memory 1))
+  (export "funcs" (table 0))
+  (export "counter" (global 0))
+  (export "version" (global 1))
+  (export "bump" (func 0))
+  (export "load" (func 1))
+  (export "size" (func 2))
+  (export "dispatch" (func 3))
+  (elem (;0;) (i32.const 0) func 0)
+)
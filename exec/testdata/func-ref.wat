@@ -0,0 +1,110 @@
+(module
+  (type (;0;) (func (param i32) (result i32)))
+  (type (;1;) (func (result i32)))
+  (type (;2;) (func (param i32 (ref null 0)) (result i32)))
+  (type (;3;) (func (result i32 (ref null 0))))
+  (func (;0;) (type 0) (param i32) (result i32)
+    local.get 0
+    i32.const 2
+    i32.mul)
+  (func (;1;) (type 0) (param i32) (result i32)
+    local.get 0
+    i32.const 1
+    i32.add)
+  (func (;2;) (type 2) (param i32 (ref null 0)) (result i32)
+    local.get 0
+    local.get 1
+    call_ref 0)
+  (func (;3;) (type 1) (result i32)
+    i32.const 21
+    ref.func 0
+    call_ref 0)
+  (func (;4;) (type 1) (result i32)
+    i32.const 5
+    ref.func 1
+    call 2)
+  (func (;5;) (type 1) (result i32)
+    i32.const 1
+    ref.null 0
+    call_ref 0)
+  (func (;6;) (type 1) (result i32)
+    i32.const 4
+    ref.func 0
+    ref.as_non_null
+    call_ref 0)
+  (func (;7;) (type 1) (result i32)
+    ref.null 0
+    ref.as_non_null
+    drop
+    i32.const 0)
+  (func (;8;) (type 1) (result i32)
+    block (result i32)
+      i32.const 8
+      i32.const 100
+      ref.null 0
+      br_on_null 0
+      drop
+      drop
+      drop
+      i32.const 0
+    end)
+  (func (;9;) (type 1) (result i32)
+    block (result i32)
+      i32.const 100
+      ref.func 0
+      br_on_null 0
+      call_ref 0
+    end)
+  (func (;10;) (type 1) (result i32)
+    i32.const 3
+    block (result (ref null 0))
+      ref.func 1
+      br_on_non_null 0
+      ref.func 0
+    end
+    call_ref 0)
+  (func (;11;) (type 1) (result i32)
+    i32.const 3
+    block (result (ref null 0))
+      ref.null 0
+      br_on_non_null 0
+      ref.func 0
+    end
+    call_ref 0)
+  (func (;12;) (type 1) (result i32)
+    block (type 3)
+      i32.const 9
+      i32.const 3
+      ref.func 1
+      br_on_non_null 0
+      drop
+      drop
+      i32.const 0
+      ref.func 0
+    end
+    call_ref 0)
+  (func (;13;) (type 1) (result i32)
+    i32.const 20
+    ref.func 1
+    return_call_ref 0)
+  (func (;14;) (type 1) (result i32)
+    i32.const 1
+    global.get 0
+    call_ref 0)
+  (global (;0;) (ref null 0) (ref.func 1))
+  (export "double" (func 0))
+  (export "inc" (func 1))
+  (export "apply" (func 2))
+  (export "call-ref" (func 3))
+  (export "call-apply" (func 4))
+  (export "call-ref-null" (func 5))
+  (export "as-non-null" (func 6))
+  (export "as-non-null-null" (func 7))
+  (export "br-on-null" (func 8))
+  (export "br-on-null-fallthrough" (func 9))
+  (export "br-on-non-null" (func 10))
+  (export "br-on-non-null-fallthrough" (func 11))
+  (export "br-on-non-null-discard" (func 12))
+  (export "return-call-ref" (func 13))
+  (export "global-call-ref" (func 14))
+)
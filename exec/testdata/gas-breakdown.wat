@@ -0,0 +1,15 @@
+(module
+  (type (;0;) (func (param i32)))
+  (import "env" "cost" (func (;0;) (type 0)))
+  (func (;1;) (type 0) (param i32)
+    local.get 0
+    call 0
+    i32.const 0
+    local.get 0
+    i32.store
+    i32.const 1
+    memory.grow
+    drop)
+  (memory (;0;) 1)
+  (export "run" (func 1))
+)
@@ -0,0 +1,245 @@
+(module
+  (type (;0;) (struct (field (mut i32)) (field (mut i32))))
+  (type (;1;) (array (mut i8)))
+  (type (;2;) (sub 0 (struct (field (mut i32)) (field (mut i32)) (field (mut i32)))))
+  (type (;3;) (func (result i32)))
+  (type (;4;) (struct (field i32) (field (ref null 4))))
+  (func (;0;) (type 3) (result i32)
+    (local (ref null 0))
+    i32.const 3
+    i32.const 4
+    struct.new 0
+    local.set 0
+    local.get 0
+    struct.get 0 0
+    local.get 0
+    struct.get 0 1
+    i32.add)
+  (func (;1;) (type 3) (result i32)
+    (local (ref null 0))
+    struct.new_default 0
+    local.tee 0
+    i32.const 9
+    struct.set 0 1
+    local.get 0
+    struct.get 0 1)
+  (func (;2;) (type 3) (result i32)
+    (local (ref null 1))
+    i32.const 200
+    i32.const 4
+    array.new 1
+    local.set 0
+    local.get 0
+    i32.const 0
+    array.get_u 1
+    i32.const 2
+    i32.mul
+    local.get 0
+    i32.const 3
+    array.get_s 1
+    i32.add)
+  (func (;3;) (type 3) (result i32)
+    i32.const 1
+    i32.const 2
+    i32.const 3
+    array.new_fixed 1 3
+    array.len)
+  (func (;4;) (type 3) (result i32)
+    (local (ref null 1) (ref null 1))
+    i32.const 1
+    i32.const 2
+    i32.const 3
+    i32.const 4
+    array.new_fixed 1 4
+    local.set 0
+    i32.const 4
+    array.new_default 1
+    local.set 1
+    local.get 1
+    i32.const 1
+    local.get 0
+    i32.const 0
+    i32.const 3
+    array.copy 1 1
+    local.get 1
+    i32.const 3
+    array.get_u 1)
+  (func (;5;) (type 3) (result i32)
+    (local (ref null 1))
+    i32.const 5
+    array.new_default 1
+    local.tee 0
+    i32.const 1
+    i32.const 7
+    i32.const 3
+    array.fill 1
+    local.get 0
+    i32.const 3
+    array.get_u 1
+    local.get 0
+    i32.const 4
+    array.get_u 1
+    i32.const 10
+    i32.mul
+    i32.add)
+  (func (;6;) (type 3) (result i32)
+    i32.const 2
+    array.new_default 1
+    i32.const 2
+    array.get_u 1)
+  (func (;7;) (type 3) (result i32)
+    i32.const 0
+    array.new_default 1
+    array.len)
+  (func (;8;) (type 3) (result i32)
+    ref.null 0
+    struct.get 0 0)
+  (func (;9;) (type 3) (result i32)
+    i32.const -5
+    ref.i31
+    i31.get_s
+    i32.const 10
+    i32.add)
+  (func (;10;) (type 3) (result i32)
+    i32.const -5
+    ref.i31
+    i31.get_u)
+  (func (;11;) (type 3) (result i32)
+    i32.const 42
+    ref.i31
+    i32.const 42
+    ref.i31
+    ref.eq)
+  (func (;12;) (type 3) (result i32)
+    struct.new_default 0
+    struct.new_default 0
+    ref.eq)
+  (func (;13;) (type 3) (result i32)
+    (local anyref)
+    struct.new_default 2
+    local.set 0
+    local.get 0
+    ref.test (ref 0)
+    local.get 0
+    ref.test (ref 1)
+    i32.const 2
+    i32.mul
+    i32.add
+    local.get 0
+    ref.test (ref struct)
+    i32.const 4
+    i32.mul
+    i32.add
+    local.get 0
+    ref.test (ref eq)
+    i32.const 8
+    i32.mul
+    i32.add
+    local.get 0
+    ref.test (ref i31)
+    i32.const 16
+    i32.mul
+    i32.add
+    ref.null any
+    ref.test (ref null 0)
+    i32.const 32
+    i32.mul
+    i32.add)
+  (func (;14;) (type 3) (result i32)
+    struct.new_default 0
+    ref.cast (ref 2)
+    struct.get 0 0)
+  (func (;15;) (type 3) (result i32)
+    ref.null any
+    ref.cast (ref null 0)
+    ref.is_null)
+  (func (;16;) (type 3) (result i32)
+    i32.const 5
+    i32.const 6
+    struct.new 0
+    extern.convert_any
+    any.convert_extern
+    ref.cast (ref 0)
+    struct.get 0 1)
+  (func (;17;) (type 3) (result i32)
+    (local (ref null 4) i32 i32)
+    i32.const 1
+    local.set 1
+    loop
+      local.get 1
+      local.get 0
+      struct.new 4
+      local.set 0
+      local.get 1
+      i32.const 1
+      i32.add
+      local.tee 1
+      i32.const 101
+      i32.ne
+      br_if 0
+    end
+    block
+      loop
+        local.get 0
+        ref.is_null
+        br_if 1
+        local.get 2
+        local.get 0
+        struct.get 4 0
+        i32.add
+        local.set 2
+        local.get 0
+        struct.get 4 1
+        local.set 0
+        br 0
+      end
+    end
+    local.get 2)
+  (func (;18;) (type 3) (result i32)
+    i32.const 11
+    i32.const 22
+    struct.new 0
+    global.set 0
+    i32.const 0)
+  (func (;19;) (type 3) (result i32)
+    global.get 0
+    struct.get 0 1)
+  (func (;20;) (type 3) (result i32)
+    (local i32)
+    loop
+      i32.const 1
+      i32.const 2
+      struct.new 0
+      drop
+      local.get 0
+      i32.const 1
+      i32.add
+      local.tee 0
+      i32.const 3000
+      i32.ne
+      br_if 0
+    end
+    i32.const 0)
+  (global (;0;) (mut (ref null 0)) (ref.null 0))
+  (export "struct-get" (func 0))
+  (export "struct-set" (func 1))
+  (export "array-packed" (func 2))
+  (export "array-len" (func 3))
+  (export "array-copy" (func 4))
+  (export "array-fill" (func 5))
+  (export "array-oob" (func 6))
+  (export "array-immutable-len" (func 7))
+  (export "null-struct" (func 8))
+  (export "i31" (func 9))
+  (export "i31-u" (func 10))
+  (export "i31-eq" (func 11))
+  (export "ref-eq" (func 12))
+  (export "ref-test" (func 13))
+  (export "ref-cast-fail" (func 14))
+  (export "ref-cast-null" (func 15))
+  (export "extern-roundtrip" (func 16))
+  (export "linked-list" (func 17))
+  (export "keep" (func 18))
+  (export "kept" (func 19))
+  (export "garbage" (func 20))
+)
@@ -0,0 +1,137 @@
+(module
+  (type (;0;) (func (param i32) (result i32)))
+  (type (;1;) (func (param i32 i32)))
+  (type (;2;) (func (param i32)))
+  (type (;3;) (func (result i32)))
+  (type (;4;) (func (param i32 i32) (result i32)))
+  (type (;5;) (func (param i32) (result i64)))
+  (func (;0;) (type 0) (param i32) (result i32)
+    (local i32)
+    global.get 0
+    local.set 1
+    global.get 0
+    local.get 0
+    i32.add
+    i32.const 7
+    i32.add
+    i32.const -8
+    i32.and
+    global.set 0
+    local.get 1)
+  (func (;1;) (type 1) (param i32 i32)
+    global.get 1
+    local.get 1
+    i32.add
+    global.set 1)
+  (func (;2;) (type 0) (param i32) (result i32)
+    local.get 0
+    call 0)
+  (func (;3;) (type 2) (param i32))
+  (func (;4;) (type 3) (result i32)
+    global.get 1)
+  (func (;5;) (type 4) (param i32 i32) (result i32)
+    (local i32)
+    block
+      loop
+        local.get 1
+        i32.eqz
+        br_if 1
+        local.get 2
+        local.get 0
+        i32.load8_u
+        i32.add
+        local.set 2
+        local.get 0
+        i32.const 1
+        i32.add
+        local.set 0
+        local.get 1
+        i32.const 1
+        i32.sub
+        local.set 1
+        br 0
+      end
+    end
+    local.get 2)
+  (func (;6;) (type 5) (param i32) (result i64)
+    (local i32 i32)
+    local.get 0
+    call 0
+    local.set 1
+    block
+      loop
+        local.get 2
+        local.get 0
+        i32.ge_u
+        br_if 1
+        local.get 1
+        local.get 2
+        i32.add
+        local.get 2
+        i32.store8
+        local.get 2
+        i32.const 1
+        i32.add
+        local.set 2
+        br 0
+      end
+    end
+    local.get 1
+    i64.extend_i32_u
+    i64.const 32
+    i64.shl
+    local.get 0
+    i64.extend_i32_u
+    i64.or)
+  (func (;7;) (type 4) (param i32 i32) (result i32)
+    (local i32)
+    local.get 0
+    i32.const 20
+    i32.add
+    call 0
+    i32.const 20
+    i32.add
+    local.set 2
+    local.get 2
+    i32.const 8
+    i32.sub
+    local.get 1
+    i32.store
+    local.get 2
+    i32.const 4
+    i32.sub
+    local.get 0
+    i32.store
+    local.get 2)
+  (func (;8;) (type 0) (param i32) (result i32)
+    global.get 2
+    i32.const 1
+    i32.add
+    global.set 2
+    local.get 0)
+  (func (;9;) (type 2) (param i32)
+    global.get 2
+    i32.const 1
+    i32.sub
+    global.set 2)
+  (func (;10;) (type 3) (result i32)
+    global.get 2)
+  (memory (;0;) 1)
+  (global (;0;) (mut i32) (i32.const 1024))
+  (global (;1;) (mut i32) (i32.const 0))
+  (global (;2;) (mut i32) (i32.const 0))
+  (export "memory" (memory 0))
+  (export "alloc" (func 0))
+  (export "dealloc" (func 1))
+  (export "malloc" (func 2))
+  (export "free" (func 3))
+  (export "freed" (func 4))
+  (export "sum" (func 5))
+  (export "iota" (func 6))
+  (export "__new" (func 7))
+  (export "__pin" (func 8))
+  (export "__unpin" (func 9))
+  (export "pins" (func 10))
+  (data (;0;) (i32.const 256) "\02\00\00\00\04\00\00\00h\00i\00")
+  (data (;1;) (i32.const 288) "\01\00\00\00\03\00\00\00\01\02\03")
+)
@@ -0,0 +1,32 @@
+(module
+  (type (;0;) (func (param i32 i64) (result i64)))
+  (type (;1;) (func (result i32)))
+  (type (;2;) (func (param i32) (result i32)))
+  (import "env" "mix" (func (;0;) (type 0)))
+  (import "env" "tick" (func (;1;) (type 1)))
+  (func (;2;) (type 0) (param i32 i64) (result i64)
+    local.get 0
+    local.get 1
+    call 0)
+  (func (;3;) (type 2) (param i32) (result i32)
+    (local i32)
+    block
+      loop
+        local.get 0
+        i32.eqz
+        br_if 1
+        local.get 1
+        call 1
+        i32.add
+        local.set 1
+        local.get 0
+        i32.const 1
+        i32.sub
+        local.set 0
+        br 0
+      end
+    end
+    local.get 1)
+  (export "mix" (func 2))
+  (export "sum" (func 3))
+)
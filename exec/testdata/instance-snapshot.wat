@@ -0,0 +1,44 @@
+(module
+  (type (;0;) (func (result i32)))
+  (type (;1;) (func))
+  (type (;2;) (func (param i32) (result i32)))
+  (func (;0;) (type 0) (result i32)
+    i32.const 7)
+  (func (;1;) (type 0) (result i32)
+    global.get 0
+    i32.const 1
+    i32.add
+    global.set 0
+    i32.const 16
+    global.get 0
+    i32.store
+    global.get 0)
+  (func (;2;) (type 0) (result i32)
+    i32.const 1
+    memory.grow)
+  (func (;3;) (type 0) (result i32)
+    ref.null func
+    i32.const 1
+    table.grow)
+  (func (;4;) (type 1)
+    i32.const 100
+    i32.const 0
+    i32.const 5
+    memory.init 0)
+  (func (;5;) (type 1)
+    data.drop 0)
+  (func (;6;) (type 2) (param i32) (result i32)
+    local.get 0
+    i32.load)
+  (table (;0;) 2 10 funcref)
+  (memory (;0;) 1 4)
+  (global (;0;) (mut i32) (i32.const 0))
+  (export "bump" (func 1))
+  (export "grow" (func 2))
+  (export "growtable" (func 3))
+  (export "init" (func 4))
+  (export "drop" (func 5))
+  (export "load" (func 6))
+  (elem (;0;) (i32.const 0) func 0)
+  (data (;0;) "hello")
+)
@@ -0,0 +1,71 @@
+(module
+  (type (;0;) (func (result i64)))
+  (type (;1;) (func (result i32)))
+  (func (;0;) (type 0) (result i64)
+    i64.const 1000
+    i64.const 42
+    i64.store offset=8
+    i64.const 1000
+    i64.load offset=8)
+  (func (;1;) (type 0) (result i64)
+    memory.size)
+  (func (;2;) (type 0) (result i64)
+    i64.const 2
+    memory.grow
+    drop
+    memory.size)
+  (func (;3;) (type 0) (result i64)
+    i64.const 2
+    memory.grow)
+  (func (;4;) (type 0) (result i64)
+    i64.const 4294967296
+    memory.grow)
+  (func (;5;) (type 1) (result i32)
+    memory.size
+    i64.const 16
+    i64.shl
+    i32.load)
+  (func (;6;) (type 1) (result i32)
+    i64.const -1
+    i32.load offset=2)
+  (func (;7;) (type 1) (result i32)
+    i64.const 0
+    i32.load offset=4294967296)
+  (func (;8;) (type 1) (result i32)
+    i64.const 100
+    i32.const 7
+    i64.const 10
+    memory.fill
+    i64.const 200
+    i64.const 100
+    i64.const 10
+    memory.copy
+    i64.const 209
+    i32.load8_u)
+  (func (;9;) (type 1) (result i32)
+    memory.size
+    i64.const 16
+    i64.shl
+    i64.const -6
+    i64.add
+    i32.const 7
+    i64.const 10
+    memory.fill
+    i32.const 0)
+  (func (;10;) (type 1) (result i32)
+    i64.const 16
+    i32.load8_u)
+  (memory (;0;) i64 1)
+  (export "store-load" (func 0))
+  (export "size" (func 1))
+  (export "grow-size" (func 2))
+  (export "grow-result" (func 3))
+  (export "grow-too-much" (func 4))
+  (export "load-oob" (func 5))
+  (export "load-overflow" (func 6))
+  (export "large-offset" (func 7))
+  (export "fill-copy" (func 8))
+  (export "fill-oob" (func 9))
+  (export "data" (func 10))
+  (data (;0;) (i64.const 16) "*")
+)
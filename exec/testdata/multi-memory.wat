@@ -0,0 +1,88 @@
+(module
+  (type (;0;) (func (result i32)))
+  (type (;1;) (func (result i64)))
+  (func (;0;) (type 0) (result i32)
+    i32.const 8
+    i32.const 42
+    i32.store 1
+    i32.const 8
+    i32.load 1)
+  (func (;1;) (type 0) (result i32)
+    i32.const 8
+    i32.load)
+  (func (;2;) (type 0) (result i32)
+    i32.const 16
+    i32.load8_u 1)
+  (func (;3;) (type 0) (result i32)
+    i32.const 16
+    i32.load8_u)
+  (func (;4;) (type 0) (result i32)
+    memory.size 1)
+  (func (;5;) (type 0) (result i32)
+    i32.const 1
+    memory.grow 1)
+  (func (;6;) (type 0) (result i32)
+    i32.const 1
+    memory.grow 1)
+  (func (;7;) (type 0) (result i32)
+    memory.size)
+  (func (;8;) (type 0) (result i32)
+    i32.const 100
+    i32.const 8
+    i32.const 4
+    memory.copy 0 1
+    i32.const 100
+    i32.load)
+  (func (;9;) (type 0) (result i32)
+    i32.const 0
+    i32.const 9
+    i32.const 4
+    memory.fill 1
+    i32.const 3
+    i32.load8_u 1)
+  (func (;10;) (type 0) (result i32)
+    i32.const 200
+    i32.const 0
+    i32.const 2
+    memory.init 1 1
+    i32.const 201
+    i32.load8_u 1)
+  (func (;11;) (type 0) (result i32)
+    i32.const 131070
+    i32.load 1)
+  (func (;12;) (type 0) (result i32)
+    i32.const 65535
+    i32.const 0
+    i32.const 2
+    memory.copy 0 1
+    i32.const 0)
+  (func (;13;) (type 0) (result i32)
+    i64.const 0
+    i32.const 100
+    i32.const 4
+    memory.copy 2 0
+    i64.const 0
+    i32.load 2)
+  (func (;14;) (type 1) (result i64)
+    memory.size 2)
+  (memory (;0;) 1)
+  (memory (;1;) 1 2)
+  (memory (;2;) i64 1)
+  (export "store-1" (func 0))
+  (export "load-0" (func 1))
+  (export "data-1" (func 2))
+  (export "data-0" (func 3))
+  (export "size-1" (func 4))
+  (export "grow-1" (func 5))
+  (export "grow-1-max" (func 6))
+  (export "size-0" (func 7))
+  (export "copy" (func 8))
+  (export "fill-1" (func 9))
+  (export "init-1" (func 10))
+  (export "oob-1" (func 11))
+  (export "copy-oob" (func 12))
+  (export "copy-64" (func 13))
+  (export "size-64" (func 14))
+  (data (;0;) (memory 1) (i32.const 16) "\07")
+  (data (;1;) "\05\06")
+)
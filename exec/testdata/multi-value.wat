@@ -0,0 +1,80 @@
+(module
+  (type (;0;) (func (result i32 i64)))
+  (type (;1;) (func (param i32 i32) (result i32 i32)))
+  (type (;2;) (func (param i32 i32) (result i32)))
+  (type (;3;) (func (param i32) (result i32 i32)))
+  (type (;4;) (func (result i32 i32)))
+  (type (;5;) (func (param i32) (result i32)))
+  (func (;0;) (type 0) (result i32 i64)
+    i32.const 1
+    i64.const 2)
+  (func (;1;) (type 1) (param i32 i32) (result i32 i32)
+    local.get 1
+    local.get 0)
+  (func (;2;) (type 2) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    block (type 2)
+      i32.sub
+    end)
+  (func (;3;) (type 2) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    call 1
+    i32.sub)
+  (func (;4;) (type 3) (param i32) (result i32 i32)
+    block (type 4)
+      i32.const 9
+      i32.const 1
+      i32.const 2
+      local.get 0
+      br_if 0
+      drop
+      drop
+      drop
+      i32.const 3
+      i32.const 4
+    end)
+  (func (;5;) (type 5) (param i32) (result i32)
+    i32.const 0
+    loop (type 5)
+      local.get 0
+      i32.add
+      local.get 0
+      i32.const 1
+      i32.sub
+      local.tee 0
+      br_if 0
+    end)
+  (func (;6;) (type 3) (param i32) (result i32 i32)
+    i32.const 7
+    local.get 0
+    i32.const 5
+    return)
+  (func (;7;) (type 2) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 0
+    if (type 2)
+      i32.add
+    else
+      i32.sub
+    end)
+  (func (;8;) (type 3) (param i32) (result i32 i32)
+    block (type 4)
+      i32.const 9
+      i32.const 1
+      i32.const 2
+      local.get 0
+      br_table 0 0
+    end)
+  (export "pair" (func 0))
+  (export "swap" (func 1))
+  (export "block-params" (func 2))
+  (export "call-multi" (func 3))
+  (export "br-multi" (func 4))
+  (export "loop-params" (func 5))
+  (export "return-multi" (func 6))
+  (export "if-params" (func 7))
+  (export "br-table-multi" (func 8))
+)
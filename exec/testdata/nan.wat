@@ -0,0 +1,44 @@
+(module
+  (type (;0;) (func (param f32 f32) (result i32)))
+  (type (;1;) (func (param i32) (result i32)))
+  (type (;2;) (func (param f64) (result i64)))
+  (type (;3;) (func (param i64) (result i64)))
+  (func (;0;) (type 0) (param f32 f32) (result i32)
+    local.get 0
+    local.get 1
+    f32.div
+    i32.reinterpret_f32)
+  (func (;1;) (type 1) (param i32) (result i32)
+    local.get 0
+    f32.reinterpret_i32
+    f32.const 1
+    f32.add
+    i32.reinterpret_f32)
+  (func (;2;) (type 1) (param i32) (result i32)
+    local.get 0
+    f32.reinterpret_i32
+    f32.neg
+    i32.reinterpret_f32)
+  (func (;3;) (type 2) (param f64) (result i64)
+    local.get 0
+    f64.sqrt
+    i64.reinterpret_f64)
+  (func (;4;) (type 3) (param i64) (result i64)
+    local.get 0
+    f64.reinterpret_i64
+    f64.const 1
+    f64.add
+    i64.reinterpret_f64)
+  (func (;5;) (type 1) (param i32) (result i32)
+    local.get 0
+    i32x4.splat
+    v128.const i32x4 0x3f800000 0x3f800000 0x3f800000 0x3f800000
+    f32x4.add
+    i32x4.extract_lane 3)
+  (export "div32" (func 0))
+  (export "add32" (func 1))
+  (export "neg32" (func 2))
+  (export "sqrt64" (func 3))
+  (export "add64" (func 4))
+  (export "addx4" (func 5))
+)
@@ -0,0 +1,30 @@
+(module
+  (type (;0;) (func (param i32) (result i32)))
+  (type (;1;) (func (result i32)))
+  (func (;0;) (type 0) (param i32) (result i32)
+    local.get 0
+    i32.const 1
+    i32.add)
+  (func (;1;) (type 1) (result i32)
+    i32.const 5)
+  (func (;2;) (type 0) (param i32) (result i32)
+    local.get 0
+    i32.const 6
+    i32.const 7
+    i32.mul
+    i32.add
+    i32.const 1
+    if (result i32)
+      i32.const 2
+      call 0
+    else
+      i32.const 3
+    end
+    i32.add
+    i32.const 0
+    i32.eqz
+    br_if 0
+    drop
+    i32.const 9)
+  (export "run" (func 2))
+)
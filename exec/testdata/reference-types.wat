@@ -0,0 +1,92 @@
+(module
+  (type (;0;) (func (result i32)))
+  (type (;1;) (func (param i32) (result i32)))
+  (type (;2;) (func (param externref) (result externref)))
+  (type (;3;) (func (param externref) (result i32)))
+  (type (;4;) (func (param externref)))
+  (type (;5;) (func (result externref)))
+  (func (;0;) (type 0) (result i32)
+    i32.const 1)
+  (func (;1;) (type 0) (result i32)
+    i32.const 2)
+  (func (;2;) (type 0) (result i32)
+    ref.null func
+    ref.is_null)
+  (func (;3;) (type 0) (result i32)
+    ref.func 1
+    ref.is_null)
+  (func (;4;) (type 0) (result i32)
+    i32.const 1
+    call_indirect (type 0))
+  (func (;5;) (type 1) (param i32) (result i32)
+    local.get 0
+    ref.func 1
+    table.set
+    local.get 0
+    call_indirect (type 0))
+  (func (;6;) (type 0) (result i32)
+    table.size)
+  (func (;7;) (type 0) (result i32)
+    ref.null func
+    i32.const 2
+    table.grow
+    drop
+    table.size)
+  (func (;8;) (type 0) (result i32)
+    ref.null func
+    i32.const 1
+    table.grow)
+  (func (;9;) (type 0) (result i32)
+    i32.const 0
+    ref.func 0
+    i32.const 4
+    table.fill
+    i32.const 3
+    call_indirect (type 0))
+  (func (;10;) (type 0) (result i32)
+    i32.const 10
+    table.get
+    ref.is_null)
+  (func (;11;) (type 1) (param i32) (result i32)
+    ref.null func
+    ref.func 0
+    local.get 0
+    select (result funcref)
+    ref.is_null)
+  (func (;12;) (type 0) (result i32)
+    i32.const 0
+    table.get 1
+    ref.is_null)
+  (func (;13;) (type 2) (param externref) (result externref)
+    local.get 0)
+  (func (;14;) (type 3) (param externref) (result i32)
+    local.get 0
+    ref.is_null)
+  (func (;15;) (type 4) (param externref)
+    i32.const 0
+    local.get 0
+    table.set 1)
+  (func (;16;) (type 5) (result externref)
+    i32.const 0
+    table.get 1)
+  (table (;0;) 2 4 funcref)
+  (table (;1;) 1 externref)
+  (export "one" (func 0))
+  (export "two" (func 1))
+  (export "ref-is-null" (func 2))
+  (export "ref-func" (func 3))
+  (export "call-null" (func 4))
+  (export "table-set-call" (func 5))
+  (export "table-size" (func 6))
+  (export "table-grow" (func 7))
+  (export "table-grow-max" (func 8))
+  (export "table-fill" (func 9))
+  (export "table-get-oob" (func 10))
+  (export "select-typed" (func 11))
+  (export "extern-null" (func 12))
+  (export "extern-id" (func 13))
+  (export "extern-is-null" (func 14))
+  (export "extern-store" (func 15))
+  (export "extern-load" (func 16))
+  (elem (;0;) declare func 0 1)
+)
@@ -0,0 +1,46 @@
+(module
+  (type (;0;) (func (result v128)))
+  (func (;0;) (type 0) (result v128)
+    v128.const i32x4 0x3fc00000 0x40000000 0x40400000 0x3f800800
+    v128.const i32x4 0x40000000 0x40000000 0x40000000 0x3f800800
+    v128.const i32x4 0x3e800000 0x3f800000 0x3f800000 0xbf801000
+    f32x4.relaxed_madd)
+  (func (;1;) (type 0) (result v128)
+    v128.const i32x4 0x00000000 0x40000000 0x00000000 0x40080000
+    v128.const i32x4 0x00000000 0x40100000 0x00000000 0x40140000
+    v128.const i32x4 0x00000000 0x3ff00000 0x00000000 0x3ff00000
+    f64x2.relaxed_nmadd)
+  (func (;2;) (type 0) (result v128)
+    v128.const i32x4 0x1e140a00 0x463c3228 0x6e645a50 0x968c8278
+    v128.const i32x4 0x0180100f 0x02020202 0x02020202 0x02020202
+    i8x16.relaxed_swizzle)
+  (func (;3;) (type 0) (result v128)
+    v128.const i32x4 0x7fc00000 0x501502f9 0xd01502f9 0xc06ccccd
+    i32x4.relaxed_trunc_f32x4_s)
+  (func (;4;) (type 0) (result v128)
+    v128.const i32x4 0xffffffff 0xffffffff 0xffffffff 0xffffffff
+    v128.const i32x4 0x00000000 0x00000000 0x00000000 0x00000000
+    v128.const i32x4 0x0f0f0f0f 0x0f0f0f0f 0x0f0f0f0f 0x0f0f0f0f
+    i16x8.relaxed_laneselect)
+  (func (;5;) (type 0) (result v128)
+    v128.const i32x4 0x80000000 0x3f800000 0x7fc00000 0x40000000
+    v128.const i32x4 0x00000000 0xbf800000 0x3f800000 0x40400000
+    f32x4.relaxed_min)
+  (func (;6;) (type 0) (result v128)
+    v128.const i32x4 0x02018080 0x00000000 0x00000000 0x00000000
+    v128.const i32x4 0xfc038080 0x00000000 0x00000000 0x00000000
+    i16x8.relaxed_dot_i8x16_i7x16_s)
+  (func (;7;) (type 0) (result v128)
+    v128.const i32x4 0x80808080 0x04030201 0x00000000 0x00000000
+    v128.const i32x4 0x80808080 0xff010101 0x00000000 0x00000000
+    v128.const i32x4 0x00000001 0x0000000a 0x00000000 0x00000000
+    i32x4.relaxed_dot_i8x16_i7x16_add_s)
+  (export "madd" (func 0))
+  (export "nmadd" (func 1))
+  (export "swizzle" (func 2))
+  (export "trunc" (func 3))
+  (export "laneselect" (func 4))
+  (export "min" (func 5))
+  (export "dot" (func 6))
+  (export "dot-add" (func 7))
+)
@@ -0,0 +1,36 @@
+(module
+  (type (;0;) (func (param i32) (result i32)))
+  (func (;0;) (type 0) (param i32) (result i32)
+    global.get 0
+    i32.const 64
+    i32.sub
+    global.set 0
+    global.get 0
+    local.get 0
+    i64.extend_i32_u
+    i64.store
+    global.get 0
+    local.get 0
+    i64.extend_i32_u
+    i64.store offset=8
+    local.get 0
+    if
+      local.get 0
+      i32.const 1
+      i32.sub
+      call 0
+      drop
+    end
+    global.get 0
+    i32.const 64
+    i32.add
+    global.set 0
+    i32.const 1024
+    i32.load)
+  (memory (;0;) 1)
+  (global (;0;) (mut i32) (i32.const 2048))
+  (global (;1;) i32 (i32.const 1040))
+  (export "__data_end" (global 1))
+  (export "recurse" (func 0))
+  (data (;0;) (i32.const 1024) "0123456789abcdef")
+)
@@ -0,0 +1,157 @@
+(module
+  (type (;0;) (func (result i32)))
+  (type (;1;) (func (result i64)))
+  (type (;2;) (func (param v128 v128) (result v128)))
+  (type (;3;) (func (param i32) (result i32)))
+  (type (;4;) (func (result f32)))
+  (type (;5;) (func (param v128) (result i32)))
+  (func (;0;) (type 0) (result i32)
+    v128.const i32x4 0x00000001 0x00000002 0x00000003 0x00000004
+    v128.const i32x4 0x0000000a 0x00000014 0x0000001e 0x00000028
+    i32x4.add
+    i32x4.extract_lane 2)
+  (func (;1;) (type 0) (result i32)
+    i32.const 100
+    i8x16.splat
+    i32.const 100
+    i8x16.splat
+    i8x16.add_sat_s
+    i8x16.extract_lane_s 0)
+  (func (;2;) (type 0) (result i32)
+    i32.const 5
+    i8x16.splat
+    i32.const 10
+    i8x16.splat
+    i8x16.sub_sat_u
+    i8x16.extract_lane_u 3)
+  (func (;3;) (type 0) (result i32)
+    v128.const i32x4 0x03020100 0x07060504 0x0b0a0908 0x0f0e0d0c
+    v128.const i32x4 0x13121110 0x17161514 0x1b1a1918 0x1f1e1d1c
+    i8x16.shuffle 31 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15
+    i8x16.extract_lane_u 0)
+  (func (;4;) (type 1) (result i64)
+    (local v128)
+    v128.const i32x4 0x00000005 0x00000000 0x00000006 0x00000000
+    local.set 0
+    local.get 0
+    local.get 0
+    i64x2.add
+    local.tee 0
+    drop
+    local.get 0
+    i64x2.extract_lane 1)
+  (func (;5;) (type 1) (result i64)
+    global.get 0
+    v128.const i32x4 0x00000000 0x00000000 0x00000001 0x00000000
+    i64x2.add
+    global.set 0
+    global.get 0
+    i64x2.extract_lane 1)
+  (func (;6;) (type 3) (param i32) (result i32)
+    v128.const i32x4 0x00000001 0x00000000 0x00000000 0x00000000
+    v128.const i32x4 0x00000002 0x00000000 0x00000000 0x00000000
+    local.get 0
+    select
+    i32x4.extract_lane 0)
+  (func (;7;) (type 0) (result i32)
+    i32.const 7
+    v128.const i32x4 0x00000001 0x00000002 0x00000003 0x00000004
+    drop)
+  (func (;8;) (type 2) (param v128 v128) (result v128)
+    local.get 0
+    local.get 1
+    i32x4.add)
+  (func (;9;) (type 0) (result i32)
+    v128.const i32x4 0x00000001 0x00000002 0x00000003 0x00000004
+    v128.const i32x4 0xfffffffb 0x00000000 0xfffffffb 0x00000000
+    call 8
+    i32x4.bitmask)
+  (func (;10;) (type 0) (result i32)
+    block (result v128)
+      v128.const i32x4 0x00000003 0x00000000 0x00000000 0x00000000
+      i32.const 1
+      br_if 0
+      drop
+      v128.const i32x4 0x00000004 0x00000000 0x00000000 0x00000000
+    end
+    i32x4.extract_lane 0)
+  (func (;11;) (type 1) (result i64)
+    i32.const 32
+    i32.const 0
+    v128.load
+    v128.store
+    i32.const 32
+    i64.load offset=8)
+  (func (;12;) (type 0) (result i32)
+    i32.const 0
+    v128.load8x8_s
+    i16x8.extract_lane_s 0)
+  (func (;13;) (type 0) (result i32)
+    i32.const 0
+    v128.const i32x4 0x00000000 0x00000000 0x00000000 0x00000000
+    v128.load32_lane 3
+    i32x4.extract_lane 3)
+  (func (;14;) (type 3) (param i32) (result i32)
+    local.get 0
+    v128.load align=1
+    i32x4.extract_lane 0)
+  (func (;15;) (type 4) (result f32)
+    f32.const 1.5
+    f32x4.splat
+    f32.const -2
+    f32x4.splat
+    f32x4.min
+    f32x4.extract_lane 1)
+  (func (;16;) (type 0) (result i32)
+    i32.const 300
+    i16x8.splat
+    i32.const -3
+    i16x8.splat
+    i8x16.narrow_i16x8_u
+    i8x16.extract_lane_u 0)
+  (func (;17;) (type 0) (result i32)
+    i32.const -3
+    i16x8.splat
+    i32.const 4
+    i16x8.splat
+    i32x4.dot_i16x8_s
+    i32x4.extract_lane 0)
+  (func (;18;) (type 0) (result i32)
+    f32.const 3e+09
+    f32x4.splat
+    i32x4.trunc_sat_f32x4_s
+    i32x4.extract_lane 2)
+  (func (;19;) (type 0) (result i32)
+    i32.const -8
+    i32x4.splat
+    i32.const 33
+    i32x4.shr_s
+    i32x4.extract_lane 1)
+  (func (;20;) (type 5) (param v128) (result i32)
+    local.get 0
+    i32x4.all_true)
+  (memory (;0;) 1)
+  (global (;0;) (mut v128) (v128.const i32x4 0x00000002 0x00000000 0x00000028 0x00000000))
+  (export "i32x4-add" (func 0))
+  (export "add-sat-s" (func 1))
+  (export "sub-sat-u" (func 2))
+  (export "shuffle" (func 3))
+  (export "local" (func 4))
+  (export "global" (func 5))
+  (export "select" (func 6))
+  (export "drop" (func 7))
+  (export "add" (func 8))
+  (export "call" (func 9))
+  (export "block" (func 10))
+  (export "load-store" (func 11))
+  (export "load-extend" (func 12))
+  (export "load-lane" (func 13))
+  (export "load-oob" (func 14))
+  (export "f32x4-min" (func 15))
+  (export "narrow" (func 16))
+  (export "dot" (func 17))
+  (export "trunc-sat" (func 18))
+  (export "shift" (func 19))
+  (export "all-true" (func 20))
+  (data (;0;) (i32.const 0) "\ff\02\03\04\05\06\07\08\09\0a\0b\0c\0d\0e\0f\10")
+)
@@ -0,0 +1,89 @@
+(module
+  (type (;0;) (func (param i64 i64) (result i64)))
+  (type (;1;) (func (param i64) (result i64)))
+  (type (;2;) (func (param i64 i64) (result i32)))
+  (type (;3;) (func (param i32 i32) (result i32)))
+  (type (;4;) (func (param i64) (result i32)))
+  (type (;5;) (func (param i32) (result i64)))
+  (func (;0;) (type 0) (param i64 i64) (result i64)
+    local.get 0
+    f64.reinterpret_i64
+    local.get 1
+    f64.reinterpret_i64
+    f64.add
+    i64.reinterpret_f64)
+  (func (;1;) (type 0) (param i64 i64) (result i64)
+    local.get 0
+    f64.reinterpret_i64
+    local.get 1
+    f64.reinterpret_i64
+    f64.mul
+    i64.reinterpret_f64)
+  (func (;2;) (type 0) (param i64 i64) (result i64)
+    local.get 0
+    f64.reinterpret_i64
+    local.get 1
+    f64.reinterpret_i64
+    f64.div
+    i64.reinterpret_f64)
+  (func (;3;) (type 1) (param i64) (result i64)
+    local.get 0
+    f64.reinterpret_i64
+    f64.sqrt
+    i64.reinterpret_f64)
+  (func (;4;) (type 1) (param i64) (result i64)
+    local.get 0
+    f64.reinterpret_i64
+    f64.nearest
+    i64.reinterpret_f64)
+  (func (;5;) (type 2) (param i64 i64) (result i32)
+    local.get 0
+    f64.reinterpret_i64
+    local.get 1
+    f64.reinterpret_i64
+    f64.lt)
+  (func (;6;) (type 3) (param i32 i32) (result i32)
+    local.get 0
+    f32.reinterpret_i32
+    local.get 1
+    f32.reinterpret_i32
+    f32.sub
+    i32.reinterpret_f32)
+  (func (;7;) (type 4) (param i64) (result i32)
+    local.get 0
+    f64.reinterpret_i64
+    f32.demote_f64
+    i32.reinterpret_f32)
+  (func (;8;) (type 5) (param i32) (result i64)
+    local.get 0
+    f32.reinterpret_i32
+    f64.promote_f32
+    i64.reinterpret_f64)
+  (func (;9;) (type 4) (param i64) (result i32)
+    local.get 0
+    f32.convert_i64_u
+    i32.reinterpret_f32)
+  (func (;10;) (type 4) (param i64) (result i32)
+    local.get 0
+    f64.reinterpret_i64
+    i32.trunc_f64_s)
+  (func (;11;) (type 0) (param i64 i64) (result i64)
+    local.get 0
+    i64x2.splat
+    local.get 1
+    i64x2.splat
+    f64x2.div
+    i64x2.extract_lane 1)
+  (export "add64" (func 0))
+  (export "mul64" (func 1))
+  (export "div64" (func 2))
+  (export "sqrt64" (func 3))
+  (export "nearest64" (func 4))
+  (export "lt64" (func 5))
+  (export "sub32" (func 6))
+  (export "demote" (func 7))
+  (export "promote" (func 8))
+  (export "convert" (func 9))
+  (export "trunc" (func 10))
+  (export "divx2" (func 11))
+)
@@ -0,0 +1,14 @@
+(module
+  (type (;0;) (func (param i32) (result i32)))
+  (func (;0;) (type 0) (param i32) (result i32)
+    local.get 0
+    i32.load)
+  (func (;1;) (type 0) (param i32) (result i32)
+    i32.const 1
+    local.get 0
+    call 0
+    i32.add)
+  (memory (;0;) 1)
+  (export "run" (func 1))
+  (@custom "sourceMappingURL" "\12sourcemap.wasm.map")
+)
@@ -0,0 +1,20 @@
+(module
+  (type (;0;) (func (param i32)))
+  (import "env" "back" (func (;0;) (type 0)))
+  (func (;1;) (type 0) (param i32)
+    loop
+      local.get 0
+      i32.const 1
+      i32.sub
+      local.tee 0
+      br_if 0
+    end)
+  (func (;2;) (type 0) (param i32)
+    local.get 0
+    call 1)
+  (func (;3;) (type 0) (param i32)
+    local.get 0
+    call 0)
+  (export "run" (func 2))
+  (export "nested" (func 3))
+)
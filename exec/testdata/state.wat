@@ -0,0 +1,19 @@
+(module
+  (type (;0;) (func (param i32 i32)))
+  (type (;1;) (func (result i32)))
+  (func (;0;) (type 0) (param i32 i32)
+    local.get 0
+    local.get 1
+    i32.store8
+    global.get 0
+    i64.const 1
+    i64.add
+    global.set 0)
+  (func (;1;) (type 1) (result i32)
+    i32.const 1
+    memory.grow)
+  (memory (;0;) 1)
+  (global (;0;) (mut i64) (i64.const 0))
+  (export "store" (func 0))
+  (export "grow" (func 1))
+)
@@ -0,0 +1,38 @@
+(module
+  (type (;0;) (func (param i32 i32 i32 i32) (result i32)))
+  (type (;1;) (func (param i32 i32) (result i32)))
+  (type (;2;) (func (param i32 i32 i32 i32 i32 i32) (result i32)))
+  (import "env" "storage_get" (func (;0;) (type 0)))
+  (import "env" "storage_set" (func (;1;) (type 0)))
+  (import "env" "storage_remove" (func (;2;) (type 1)))
+  (import "env" "storage_iterate" (func (;3;) (type 2)))
+  (func (;4;) (type 0) (param i32 i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    local.get 3
+    call 0)
+  (func (;5;) (type 0) (param i32 i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    local.get 3
+    call 1)
+  (func (;6;) (type 1) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    call 2)
+  (func (;7;) (type 2) (param i32 i32 i32 i32 i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    local.get 2
+    local.get 3
+    local.get 4
+    local.get 5
+    call 3)
+  (memory (;0;) 1)
+  (export "get" (func 4))
+  (export "set" (func 5))
+  (export "remove" (func 6))
+  (export "iterate" (func 7))
+)
@@ -0,0 +1,27 @@
+(module
+  (type (;0;) (func (param i32 i32) (result i32)))
+  (type (;1;) (func (param i32 i32 i32) (result i32)))
+  (type (;2;) (func (param i32) (result i32)))
+  (import "env" "memory" (memory (;0;) 1 4))
+  (import "env" "table" (table (;0;) 4 funcref))
+  (func (;0;) (type 0) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    i32.add)
+  (func (;1;) (type 1) (param i32 i32 i32) (result i32)
+    local.get 1
+    local.get 2
+    local.get 0
+    call_indirect (type 0))
+  (func (;2;) (type 2) (param i32) (result i32)
+    local.get 0
+    i32.load)
+  (func (;3;) (type 2) (param i32) (result i32)
+    local.get 0
+    memory.grow)
+  (export "dispatch" (func 1))
+  (export "load" (func 2))
+  (export "grow" (func 3))
+  (elem (;0;) (i32.const 0) func 0)
+  (data (;0;) (i32.const 16) "main")
+)
@@ -0,0 +1,28 @@
+(module
+  (type (;0;) (func (param i32 i32) (result i32)))
+  (type (;1;) (func (param i32 i32 i32) (result i32)))
+  (type (;2;) (func (result i32)))
+  (import "env" "memoryBase" (global (;0;) i32))
+  (import "env" "memory" (memory (;0;) 1))
+  (import "env" "table" (table (;0;) 4 funcref))
+  (func (;0;) (type 0) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    i32.mul)
+  (func (;1;) (type 0) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    i32.store
+    memory.size)
+  (func (;2;) (type 1) (param i32 i32 i32) (result i32)
+    local.get 1
+    local.get 2
+    local.get 0
+    call_indirect (type 0))
+  (func (;3;) (type 2) (result i32)
+    global.get 0)
+  (export "call" (func 2))
+  (export "base" (func 3))
+  (elem (;0;) (i32.const 1) func 0 1)
+  (data (;0;) (i32.const 64) "side")
+)
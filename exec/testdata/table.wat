@@ -0,0 +1,30 @@
+(module
+  (type (;0;) (func (param i32 i32) (result i32)))
+  (type (;1;) (func (param i32 i32 i32) (result i32)))
+  (type (;2;) (func (param i32 externref)))
+  (import "env" "getMethod" (func (;0;) (type 0)))
+  (func (;1;) (type 0) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    i32.add)
+  (func (;2;) (type 0) (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    i32.sub)
+  (func (;3;) (type 1) (param i32 i32 i32) (result i32)
+    local.get 1
+    local.get 2
+    local.get 0
+    call_indirect (type 0))
+  (func (;4;) (type 2) (param i32 externref)
+    local.get 0
+    local.get 1
+    table.set 1)
+  (table (;0;) 4 funcref)
+  (table (;1;) 2 externref)
+  (export "refs" (table 1))
+  (export "dispatch" (func 3))
+  (export "keep" (func 4))
+  (elem (;0;) (i32.const 0) func 1 0)
+  (elem (;1;) (i32.const 3) func 2)
+)
@@ -0,0 +1,79 @@
+(module
+  (type (;0;) (func (param i32) (result i32)))
+  (type (;1;) (func (param i32 i64) (result i64)))
+  (type (;2;) (func (result i32)))
+  (type (;3;) (func (result i64)))
+  (func (;0;) (type 0) (param i32) (result i32)
+    local.get 0
+    i32.eqz
+    if
+      i32.const 1
+      return
+    end
+    local.get 0
+    i32.const 1
+    i32.sub
+    return_call 1)
+  (func (;1;) (type 0) (param i32) (result i32)
+    local.get 0
+    i32.eqz
+    if
+      i32.const 0
+      return
+    end
+    local.get 0
+    i32.const 1
+    i32.sub
+    return_call 0)
+  (func (;2;) (type 1) (param i32 i64) (result i64)
+    local.get 0
+    i32.eqz
+    if
+      local.get 1
+      return
+    end
+    local.get 0
+    i32.const 1
+    i32.sub
+    local.get 1
+    local.get 0
+    i64.extend_i32_u
+    i64.add
+    return_call 2)
+  (func (;3;) (type 2) (result i32)
+    i32.const 100000
+    call 0)
+  (func (;4;) (type 3) (result i64)
+    i32.const 100000
+    i64.const 0
+    call 2)
+  (func (;5;) (type 0) (param i32) (result i32)
+    local.get 0
+    i32.eqz
+    if
+      i32.const 42
+      return
+    end
+    local.get 0
+    i32.const 1
+    i32.sub
+    i32.const 0
+    return_call_indirect (type 0))
+  (func (;6;) (type 2) (result i32)
+    i32.const 100000
+    call 5)
+  (func (;7;) (type 2) (result i32)
+    i32.const 0
+    i32.const 1
+    return_call_indirect (type 0))
+  (table (;0;) 2 funcref)
+  (export "even" (func 0))
+  (export "odd" (func 1))
+  (export "sum" (func 2))
+  (export "even-100000" (func 3))
+  (export "sum-100000" (func 4))
+  (export "countdown" (func 5))
+  (export "countdown-100000" (func 6))
+  (export "tail-call-mismatch" (func 7))
+  (elem (;0;) (i32.const 0) func 5 2)
+)
@@ -0,0 +1,45 @@
+(module
+  (type (;0;) (func (param i32 i32 i32 i32) (result i32)))
+  (type (;1;) (func (result i32)))
+  (type (;2;) (func (param i32) (result i32)))
+  (import "env" "storage_get" (func (;0;) (type 0)))
+  (import "env" "storage_set" (func (;1;) (type 0)))
+  (func (;2;) (type 1) (result i32)
+    (local i32)
+    i32.const 16
+    i32.const 1
+    i32.const 64
+    i32.const 16
+    call 0
+    local.tee 0
+    i32.const 0
+    i32.lt_s
+    if
+      i32.const 1
+      return
+    end
+    i32.const 32
+    i32.const 1
+    i32.const 64
+    local.get 0
+    call 1
+    drop
+    i32.const 200
+    i32.load8_u
+    if
+      i32.const -1
+      i32.load
+      drop
+    end
+    i32.const 201
+    i32.load8_u)
+  (func (;3;) (type 2) (param i32) (result i32)
+    local.get 0
+    i32.load8_u)
+  (memory (;0;) 1 4)
+  (export "migrate" (func 2))
+  (export "read" (func 3))
+  (data (;0;) (i32.const 0) "new!")
+  (data (;1;) (i32.const 16) "k")
+  (data (;2;) (i32.const 32) "m")
+)
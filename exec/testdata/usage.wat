@@ -0,0 +1,16 @@
+(module
+  (type (;0;) (func (param i32) (result i32)))
+  (func (;0;) (type 0) (param i32) (result i32)
+    local.get 0
+    memory.grow)
+  (func (;1;) (type 0) (param i32) (result i32)
+    ref.null func
+    local.get 0
+    table.grow)
+  (table (;0;) 2 8 funcref)
+  (table (;1;) 0 externref)
+  (memory (;0;) 1 4)
+  (memory (;1;) 2)
+  (export "grow" (func 0))
+  (export "grow_table" (func 1))
+)
@@ -0,0 +1,230 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// Tag is an exception tag. The exceptions thrown with a tag are caught by
+// the catch clauses naming it, and carry values of the types of Params.
+// The tags defined by a module are created for every instance of it, the
+// ones it imports from "env" are registered with EnvFunc.RegisterTag.
+type Tag struct {
+	Params []wasm.ValueType
+}
+
+// NewTag returns a new tag for the exceptions carrying values of the given
+// types.
+func NewTag(params ...wasm.ValueType) *Tag {
+	return &Tag{Params: params}
+}
+
+// Exception is the value the VM unwinds with when the module or a host
+// function throws an exception. Unless a try block of the module catches
+// it, it traps the VM like the other errors, see TrapUncaughtException.
+type Exception struct {
+	Tag *Tag
+	// the values of the exception, laid out in slots like the arguments
+	// of ExecCodeRaw
+	Values []uint64
+}
+
+func (e *Exception) Error() string {
+	return "exec: uncaught exception"
+}
+
+func (e *Exception) TrapCode() TrapCode {
+	return TrapUncaughtException
+}
+
+// RegisterTag registers the tag a module imports from "env" with the given
+// name. The tag must have the parameters of the type of the import.
+func (env *EnvFunc) RegisterTag(name string, tag *Tag) {
+	if env.envTags == nil {
+		env.envTags = make(map[string]*Tag)
+	}
+	if _, ok := env.envTags[name]; !ok {
+		env.envTags[name] = tag
+	}
+}
+
+// newTags returns the tags of a new instance of module, indexed by tag
+// index, resolving the ones it imports from "env" against imports. The
+// tags imported from other modules are new tags, since their instances
+// aren't linked.
+func newTags(module *wasm.Module, imports *EnvFunc) ([]*Tag, error) {
+	var tags []*Tag
+	if module.Import != nil {
+		for _, entry := range module.Import.Entries {
+			imported, ok := entry.Type.(wasm.TagImport)
+			if !ok {
+				continue
+			}
+			params := module.Types.Entries[imported.Type.Type].ParamTypes
+			if entry.ModuleName != "env" {
+				tags = append(tags, NewTag(params...))
+				continue
+			}
+			tag := imports.envTags[entry.FieldName]
+			if tag == nil || !sameTypes(tag.Params, params) {
+				return nil, ERR_FIND_VM_TAG
+			}
+			tags = append(tags, tag)
+		}
+	}
+	if module.Tag != nil {
+		for _, entry := range module.Tag.Entries {
+			tags = append(tags, NewTag(module.Types.Entries[entry.Type].ParamTypes...))
+		}
+	}
+	return tags, nil
+}
+
+func sameTypes(a, b []wasm.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ExportedTag returns the tag the module of inst exports with the given
+// name, for the host to throw exceptions the module catches, or to tell
+// the exceptions the module throws apart.
+func (inst *Instance) ExportedTag(name string) (*Tag, bool) {
+	module := inst.compiled.module
+	if module.Export == nil {
+		return nil, false
+	}
+	entry, ok := module.Export.Entries[name]
+	if !ok || entry.Kind != wasm.ExternalTag || int(entry.Index) >= len(inst.tags) {
+		return nil, false
+	}
+	return inst.tags[entry.Index], true
+}
+
+// Throw throws an exception with the given tag and values from a host
+// function, unwinding the module like the throw operator. The values are
+// laid out in slots like the arguments of ExecCodeRaw, a v128 taking two.
+func (vm *VM) Throw(tag *Tag, values ...uint64) {
+	if len(values) != disasm.Slots(tag.Params...) {
+		panic(ERR_INVALID_ARGUMENT_COUNT)
+	}
+	panic(&Exception{Tag: tag, Values: append([]uint64(nil), values...)})
+}
+
+func (vm *VM) throw() {
+	tag := vm.tags[vm.fetchUint32()]
+	n := len(vm.ctx.stack) - disasm.Slots(tag.Params...)
+	values := append([]uint64(nil), vm.ctx.stack[n:]...)
+	vm.ctx.stack = vm.ctx.stack[:n]
+	panic(&Exception{Tag: tag, Values: values})
+}
+
+func (vm *VM) rethrow() {
+	// the exception is kept in a local by its handler, see
+	// compile.Handler
+	exc := vm.ExternValue(vm.ctx.locals[vm.fetchUint32()]).(*Exception)
+	panic(exc)
+}
+
+// interpretCatching runs the code of the current context like interpret,
+// running the handlers of compiled catching the exceptions thrown in the
+// body of its try blocks, either by its own code or by its callees.
+func (vm *VM) interpretCatching(compiled compiledFunction) uint64 {
+	frames, depth, top := len(vm.frames), vm.depth, vm.valuesTop
+	for {
+		res, exc := vm.interpretUntilThrow(compiled)
+		if exc == nil {
+			return res
+		}
+		// the callees which didn't catch the exception are unwound
+		if len(vm.frames) > frames {
+			vm.ctx = vm.frames[frames]
+		}
+		vm.frames = vm.frames[:frames]
+		vm.depth = depth
+		vm.releaseValues(top)
+		if !vm.catch(compiled, exc) {
+			panic(exc)
+		}
+	}
+}
+
+func (vm *VM) interpretUntilThrow(compiled compiledFunction) (res uint64, exc *Exception) {
+	defer recoverException(&exc)
+	return vm.interpretCode(compiled), nil
+}
+
+// recoverException recovers the exception the calling function unwinds
+// with into exc. Any other panic goes on.
+func recoverException(exc **Exception) {
+	if r := recover(); r != nil {
+		e, ok := r.(*Exception)
+		if !ok {
+			panic(r)
+		}
+		*exc = e
+	}
+}
+
+// catch jumps to the handler of compiled catching exc, thrown by the
+// instruction before the pc of the current context. It returns false if
+// no handler of compiled catches it.
+func (vm *VM) catch(compiled compiledFunction, exc *Exception) bool {
+	pc := vm.ctx.pc
+	skip := 0
+	for i := range compiled.handlers {
+		handler := &compiled.handlers[i]
+		if pc <= handler.Start || pc > handler.End {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if handler.Delegate {
+			skip = handler.Skip
+			continue
+		}
+
+		addr, values := handler.CatchAll, []uint64(nil)
+		for _, c := range handler.Catches {
+			if vm.tags[c.Tag] == exc.Tag {
+				addr, values = c.Addr, exc.Values
+				break
+			}
+		}
+		if addr < 0 {
+			continue
+		}
+		vm.ctx.stack = append(vm.ctx.stack[:handler.Height], values...)
+		if handler.Local >= 0 {
+			vm.ctx.locals[handler.Local] = vm.ExternRef(exc)
+		}
+		vm.ctx.pc = addr
+		return true
+	}
+	return false
+}
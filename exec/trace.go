@@ -0,0 +1,37 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+// TraceFunc is called by the interpreter before each instruction it runs,
+// see SetTraceFunc, with the index of the function of the instruction,
+// its offset in the module like the Offset of a disasm.Instruction, its
+// opcode, the prefix of a prefixed one, and the number of slots of the
+// operand stack of the frame, see disasm.Slots.
+type TraceFunc func(fnIndex, pc int64, opcode byte, stackDepth int)
+
+// SetTraceFunc sets the function tracing the instructions of the
+// following calls of vm. Nil removes it.
+//
+// Tracing costs the interpreter a single test per instruction when
+// disabled. When enabled, functions compiled to native code are
+// interpreted, and the instructions inlined into a function are traced
+// once, at their call, like for SetDebugHook.
+func (vm *VM) SetTraceFunc(trace TraceFunc) {
+	vm.trace = trace
+	vm.setHooked()
+}
@@ -0,0 +1,71 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestTraceFunc(t *testing.T) {
+	module := readTestModule(t, "testdata/spec/fac.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+
+	fn := int64(module.Export.Entries["fac-rec"].Index)
+	instrs, err := compiled.Disassemble(int(fn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opcodes := make(map[int64]byte, len(instrs))
+	for _, instr := range instrs {
+		opcodes[instr.Offset] = instr.Op.Code
+	}
+
+	var traced []int64
+	vm.SetTraceFunc(func(fnIndex, pc int64, opcode byte, stackDepth int) {
+		if fnIndex != fn {
+			t.Fatalf("traced function %d", fnIndex)
+		}
+		if op, ok := opcodes[pc]; !ok || op != opcode || stackDepth < 0 {
+			t.Fatalf("unexpected instruction at %d: %#x, stack depth %d", pc, opcode, stackDepth)
+		}
+		traced = append(traced, pc)
+	})
+	res, err := vm.ExecCode(fn, 3)
+	if err != nil || res != uint64(6) {
+		t.Fatalf("got=%v, %v", res, err)
+	}
+	if len(traced) == 0 || traced[0] != instrs[0].Offset {
+		t.Fatalf("unexpected trace: %v", traced)
+	}
+
+	vm.SetTraceFunc(nil)
+	n := len(traced)
+	if _, err := vm.ExecCode(fn, 3); err != nil {
+		t.Fatal(err)
+	}
+	if len(traced) != n {
+		t.Error("the instructions are still traced")
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+// TrapCode identifies the reason a call failed, so that consensus code can
+// map failures to receipt status codes. The values are part of the
+// consensus rules: they never change, and new codes are only appended.
+type TrapCode int
+
+const (
+	// TrapNone is the code of a successful call.
+	TrapNone TrapCode = 0
+	// TrapUnknown is the code of the errors not listed below.
+	TrapUnknown           TrapCode = 1
+	TrapUnreachable       TrapCode = 2
+	TrapOutOfBoundsMemory TrapCode = 3
+	TrapIntegerDivByZero  TrapCode = 4
+	TrapIntegerOverflow   TrapCode = 5
+	TrapInvalidConversion TrapCode = 6
+	TrapUndefinedElement  TrapCode = 7
+	TrapSignatureMismatch TrapCode = 8
+	TrapOutOfGas          TrapCode = 9
+	TrapOutOfFuel         TrapCode = 10
+	TrapStackOverflow     TrapCode = 11
+	TrapInterrupted       TrapCode = 12
+	TrapTimeout           TrapCode = 13
+	TrapUnresolvedImport  TrapCode = 14
+	TrapHostError         TrapCode = 15
+	TrapResourceLimit     TrapCode = 16
+	TrapFatal             TrapCode = 17
+	// TrapInvalidModule is the code of the modules failing to decode or to
+	// validate.
+	TrapInvalidModule TrapCode = 18
+	// TrapOutOfBoundsTable is the code of the table accesses of the bulk
+	// memory operators past the end of a table or segment.
+	TrapOutOfBoundsTable TrapCode = 19
+	// TrapUnalignedAtomic is the code of the atomic accesses to addresses
+	// which aren't a multiple of their size, and TrapExpectedSharedMemory
+	// the one of memory.atomic.wait on a memory which isn't shared.
+	TrapUnalignedAtomic      TrapCode = 20
+	TrapExpectedSharedMemory TrapCode = 21
+	// TrapUncaughtException is the code of the exceptions no try block
+	// of the module catches, see Exception.
+	TrapUncaughtException TrapCode = 22
+	// TrapNullReference is the code of the accesses to the fields of a
+	// null reference, TrapCastFailure the one of the failed ref.cast, and
+	// TrapOutOfBoundsArray the one of the accesses past the end of an
+	// array, as defined by the GC proposal.
+	TrapNullReference    TrapCode = 23
+	TrapCastFailure      TrapCode = 24
+	TrapOutOfBoundsArray TrapCode = 25
+	// TrapReadOnlyMemory is the code of the writes to the read-only
+	// ranges of a memory, see SetReadOnlyMemory.
+	TrapReadOnlyMemory TrapCode = 26
+	// TrapGuestStackOverflow is the code of the overflows of the shadow
+	// stack of a module, see VMConfig.GuestStackCheck.
+	TrapGuestStackOverflow TrapCode = 27
+	// TrapMisalignedAccess is the code of the memory accesses violating
+	// the alignment hint of their instruction, see SetAlignCheck.
+	TrapMisalignedAccess TrapCode = 28
+
+	// TrapCustom is the code of the first trap of the host functions,
+	// see HostTrap: the code of a HostTrapError is TrapCustom plus its
+	// own code, above the ones of the VM.
+	TrapCustom TrapCode = 1 << 16
+)
+
+var trapNames = [...]string{
+	TrapNone:                 "none",
+	TrapUnknown:              "unknown",
+	TrapUnreachable:          "unreachable",
+	TrapOutOfBoundsMemory:    "out_of_bounds_memory",
+	TrapIntegerDivByZero:     "integer_div_by_zero",
+	TrapIntegerOverflow:      "integer_overflow",
+	TrapInvalidConversion:    "invalid_conversion",
+	TrapUndefinedElement:     "undefined_element",
+	TrapSignatureMismatch:    "signature_mismatch",
+	TrapOutOfGas:             "out_of_gas",
+	TrapOutOfFuel:            "out_of_fuel",
+	TrapStackOverflow:        "stack_overflow",
+	TrapInterrupted:          "interrupted",
+	TrapTimeout:              "timeout",
+	TrapUnresolvedImport:     "unresolved_import",
+	TrapHostError:            "host_error",
+	TrapResourceLimit:        "resource_limit",
+	TrapFatal:                "fatal",
+	TrapInvalidModule:        "invalid_module",
+	TrapOutOfBoundsTable:     "out_of_bounds_table",
+	TrapUnalignedAtomic:      "unaligned_atomic",
+	TrapExpectedSharedMemory: "expected_shared_memory",
+	TrapUncaughtException:    "uncaught_exception",
+	TrapNullReference:        "null_reference",
+	TrapCastFailure:          "cast_failure",
+	TrapOutOfBoundsArray:     "out_of_bounds_array",
+	TrapReadOnlyMemory:       "read_only_memory",
+	TrapGuestStackOverflow:   "guest_stack_overflow",
+	TrapMisalignedAccess:     "misaligned_access",
+}
+
+func (c TrapCode) String() string {
+	if c >= TrapCustom && c-TrapCustom <= math.MaxUint16 {
+		return fmt.Sprintf("host_%d", c-TrapCustom)
+	}
+	if c < 0 || int(c) >= len(trapNames) {
+		return "unknown"
+	}
+	return trapNames[c]
+}
+
+// Trap is implemented by the errors of the VM, which give the code of
+// their reason.
+type Trap interface {
+	error
+	TrapCode() TrapCode
+}
+
+// trapError is an error value trapping the VM for a given reason.
+type trapError struct {
+	code TrapCode
+	msg  string
+}
+
+func newTrap(code TrapCode, msg string) error {
+	return &trapError{code: code, msg: msg}
+}
+
+func (e *trapError) Error() string {
+	return e.msg
+}
+
+func (e *trapError) TrapCode() TrapCode {
+	return e.code
+}
+
+// HostTrapError is the error of a host function aborting the call with a
+// code of its own, see HostTrap.
+type HostTrapError struct {
+	Code uint16
+	Msg  string
+}
+
+// HostTrap returns the error a host function returns, or panics with, to
+// abort the call with the given code and message, such as the insufficient
+// balance of a transfer. The error of the call and the status of its
+// receipt have the code TrapCustom+code, distinct from the ones of the VM.
+func HostTrap(code uint16, msg string) error {
+	return &HostTrapError{Code: code, Msg: msg}
+}
+
+func (e *HostTrapError) Error() string {
+	return e.Msg
+}
+
+// TrapCode returns TrapCustom plus the code of e.
+func (e *HostTrapError) TrapCode() TrapCode {
+	return TrapCustom + TrapCode(e.Code)
+}
+
+// Is tells whether target is a HostTrapError with the code of e, whatever
+// its message.
+func (e *HostTrapError) Is(target error) bool {
+	t, ok := target.(*HostTrapError)
+	return ok && t.Code == e.Code
+}
+
+// TrapCodeOf returns the code of the reason of err, which may be an error
+// returned by (*VM).ExecCode, or a value the VM trapped with.
+func TrapCodeOf(err interface{}) TrapCode {
+	if err == nil {
+		return TrapNone
+	}
+	e, ok := err.(error)
+	if !ok {
+		return TrapUnknown
+	}
+	var trap Trap
+	if errors.As(e, &trap) {
+		return trap.TrapCode()
+	}
+	switch e.(type) {
+	case validate.Error, validate.PolicyError, wasm.DecodeLimitError, wasm.SectionOrderError, wasm.CountMismatchError,
+		wasm.InvalidNameError, wasm.CustomSectionError, UnsupportedFeatureError:
+		return TrapInvalidModule
+	}
+	switch e {
+	case leb128.ErrOverflow, leb128.ErrNonCanonical:
+		return TrapInvalidModule
+	case ERR_FIND_VM_METHOD, ERR_FIND_VM_TAG:
+		return TrapUnresolvedImport
+	case ERR_CALL_ENV_METHOD:
+		return TrapHostError
+	case ERR_RESOURCE_LIMIT:
+		return TrapResourceLimit
+	}
+	if _, ok := e.(runtime.Error); ok && e.Error() == "runtime error: integer divide by zero" {
+		return TrapIntegerDivByZero
+	}
+	return TrapUnknown
+}
+
+// DeterministicError renders err through a fixed template, for the chains
+// hashing error messages into receipts: the name of its TrapCode, followed
+// for some errors by details which only depend on the module and the
+// config, never on pointers, map ordering, the platform nor the Go
+// runtime. The message of an error the template doesn't know is dropped.
+func DeterministicError(err interface{}) string {
+	if trap, ok := err.(*TrapError); ok {
+		err = trap.Err
+	}
+	code := TrapCodeOf(err)
+	switch e := err.(type) {
+	case StackOverflowError:
+		return fmt.Sprintf("%s: %s exceeds %d", code, e.Limit, e.Max)
+	case StackUsageError:
+		return fmt.Sprintf("%s: function %q: %s exceeds %d", code, e.Export, e.Limit, e.Max)
+	case *FatalVMError:
+		// the compiled code depends on the version of the interpreter
+		if e.CodeOffset == 0 {
+			return fmt.Sprintf("%s: function %d", code, e.Func)
+		}
+		return fmt.Sprintf("%s: function %d at offset %d", code, e.Func, e.CodeOffset)
+	case validate.Error:
+		return fmt.Sprintf("%s: function %d at offset %d: %s", code, e.Function, e.Offset, deterministicCause(e.Err))
+	case wasm.DecodeLimitError:
+		return fmt.Sprintf("%s: %s exceeds %d", code, e.Limit, e.Max)
+	case validate.PolicyError:
+		if e.Function < 0 {
+			return fmt.Sprintf("%s: %s", code, e.Reason)
+		}
+		return fmt.Sprintf("%s: function %d at offset %d: %s", code, e.Function, e.Offset, e.Reason)
+	case wasm.SectionOrderError:
+		if e.Duplicate {
+			return fmt.Sprintf("%s: duplicate %s section at offset %d", code, e.ID, e.Offset)
+		}
+		return fmt.Sprintf("%s: %s section at offset %d out of order", code, e.ID, e.Offset)
+	case *HostTrapError:
+		// the message is the one of the host function
+		return fmt.Sprintf("%s: %s", code, e.Msg)
+	case wasm.CountMismatchError:
+		return fmt.Sprintf("%s: %d function bodies for %d functions at offset %d", code, e.Bodies, e.Functions, e.Offset)
+	}
+	return code.String()
+}
+
+// deterministicCause renders the cause of a validation error, whose errors
+// only print numbers and operator or type names.
+func deterministicCause(err error) string {
+	switch err.(type) {
+	case validate.InvalidImmediateError, validate.UnmatchedOpError, validate.InvalidLabelError,
+		validate.InvalidLocalIndexError, validate.InvalidTypeError, validate.InvalidElementIndexError,
+		validate.NoSectionError, validate.InvalidDataIndexError, validate.ImmutableGlobalError:
+		return err.Error()
+	}
+	switch err {
+	case validate.ErrStackUnderflow, validate.ErrStackHeight, validate.ErrUnclosedBlock, validate.ErrMissingElse:
+		return err.Error()
+	}
+	return "invalid code"
+}
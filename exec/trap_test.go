@@ -0,0 +1,175 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	stdcontext "context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+func TestTrapCodeOf(t *testing.T) {
+	divByZero := func() (r interface{}) {
+		defer func() { r = recover() }()
+		a, b := 1, 0
+		return a / b
+	}
+
+	for _, tc := range []struct {
+		err  interface{}
+		code TrapCode
+	}{
+		{nil, TrapNone},
+		{errors.New("foo"), TrapUnknown},
+		{"host function failed", TrapUnknown},
+		{ErrUnreachable, TrapUnreachable},
+		{ErrOutOfBoundsMemoryAccess, TrapOutOfBoundsMemory},
+		{divByZero(), TrapIntegerDivByZero},
+		{ErrUndefinedElementIndex, TrapUndefinedElement},
+		{ErrOutOfBoundsTableAccess, TrapOutOfBoundsTable},
+		{ErrUnalignedAtomic, TrapUnalignedAtomic},
+		{ErrExpectedSharedMemory, TrapExpectedSharedMemory},
+		{ErrSignatureMismatch, TrapSignatureMismatch},
+		{ErrOutOfGas, TrapOutOfGas},
+		{ErrOutOfFuel, TrapOutOfFuel},
+		{StackOverflowError{"call depth", 1}, TrapStackOverflow},
+		{InterruptedError{stdcontext.Canceled}, TrapInterrupted},
+		{InterruptedError{ErrEpochDeadline}, TrapInterrupted},
+		{TimeoutError(time.Second), TrapTimeout},
+		{leb128.ErrNonCanonical, TrapInvalidModule},
+		{ERR_FIND_VM_METHOD, TrapUnresolvedImport},
+		{ERR_CALL_ENV_METHOD, TrapHostError},
+		{ERR_RESOURCE_LIMIT, TrapResourceLimit},
+		{&FatalVMError{Value: ErrOutOfGas}, TrapFatal},
+		{validate.Error{Err: validate.ErrStackUnderflow}, TrapInvalidModule},
+		{wasm.DecodeLimitError{Limit: "functions", Max: 1}, TrapInvalidModule},
+		{HostTrap(7, "insufficient balance"), TrapCustom + 7},
+	} {
+		if code := TrapCodeOf(tc.err); code != tc.code {
+			t.Errorf("%v: unexpected code: got=%v, want=%v", tc.err, code, tc.code)
+		}
+	}
+}
+
+func TestTrapCodeValues(t *testing.T) {
+	// the codes are part of the consensus rules, and must never change
+	for code, name := range []string{
+		"none", "unknown", "unreachable", "out_of_bounds_memory",
+		"integer_div_by_zero", "integer_overflow", "invalid_conversion",
+		"undefined_element", "signature_mismatch", "out_of_gas",
+		"out_of_fuel", "stack_overflow", "interrupted", "timeout",
+		"unresolved_import", "host_error", "resource_limit", "fatal",
+		"invalid_module", "out_of_bounds_table", "unaligned_atomic",
+		"expected_shared_memory",
+	} {
+		if got := TrapCode(code).String(); got != name {
+			t.Errorf("trap code %d: got=%s, want=%s", code, got, name)
+		}
+	}
+}
+
+func TestDeterministicError(t *testing.T) {
+	var nilMap map[string]int
+	fault := func() (r interface{}) {
+		defer func() { r = recover() }()
+		nilMap["x"] = 1
+		return nil
+	}
+
+	for _, tc := range []struct {
+		err  interface{}
+		want string
+	}{
+		{nil, "none"},
+		{ErrOutOfGas, "out_of_gas"},
+		{InterruptedError{stdcontext.DeadlineExceeded}, "interrupted"},
+		{TimeoutError(time.Second), "timeout"},
+		{StackOverflowError{"call depth", 100}, "stack_overflow: call depth exceeds 100"},
+		// the panic value and stack of a fatal error depend on the runtime
+		{&FatalVMError{Func: 3, Offset: 12, CodeOffset: 57, Value: fault(), Stack: []byte("goroutine 1")}, "fatal: function 3 at offset 57"},
+		{&FatalVMError{Func: 0, Offset: 2, Value: fault()}, "fatal: function 0"},
+		{validate.Error{Function: 1, Offset: 4, Err: validate.InvalidLocalIndexError(7)},
+			"invalid_module: function 1 at offset 4: invalid index for local variable 7"},
+		{validate.Error{Function: 1, Offset: 4, Err: errors.New("read 0xc000123456: EOF")},
+			"invalid_module: function 1 at offset 4: invalid code"},
+		{wasm.DecodeLimitError{Limit: "functions", Max: 1}, "invalid_module: functions exceeds 1"},
+		{wasm.SectionOrderError{ID: wasm.SectionIDType, Offset: 11, Duplicate: true}, "invalid_module: duplicate type section at offset 11"},
+		{wasm.CountMismatchError{Offset: 19, Functions: 2, Bodies: 1}, "invalid_module: 1 function bodies for 2 functions at offset 19"},
+		{errors.New("dial tcp 10.0.0.1:80"), "unknown"},
+		{HostTrap(7, "insufficient balance"), "host_7: insufficient balance"},
+	} {
+		if got := DeterministicError(tc.err); got != tc.want {
+			t.Errorf("%v: got=%q, want=%q", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestHostTrap(t *testing.T) {
+	code, err := InstrumentGas(readTestCode(t, "testdata/spec/fac.wasm"), DefaultGasSchedule())
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, err := wasm.ReadModule(bytes.NewReader(code), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	facIter := int64(module.Export.Entries["fac-iter"].Index)
+
+	var abort func() error
+	imports := NewEnvFunc()
+	imports.envFuncMap[GAS_FUNCTION] = func(vm *VM) (bool, error) {
+		return true, abort()
+	}
+	inst, err := compiled.Instantiate(imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	vm.CollectReceipts(true)
+
+	// the host function returns the trap, or panics with it
+	for _, f := range []func() error{
+		func() error { return HostTrap(7, "insufficient balance") },
+		func() error { panic(HostTrap(7, "insufficient balance")) },
+	} {
+		abort = f
+		trapped := func() (r interface{}) {
+			defer func() { r = trapValue(recover()) }()
+			vm.ExecCode(facIter, 20)
+			return nil
+		}()
+		err, _ := trapped.(error)
+		if !errors.Is(err, HostTrap(7, "")) || errors.Is(err, HostTrap(8, "")) || err.Error() != "insufficient balance" {
+			t.Errorf("unexpected trap: %v", trapped)
+		}
+		if receipt := vm.Receipt(); receipt == nil || receipt.Status != TrapCustom+7 || receipt.Status.String() != "host_7" {
+			t.Errorf("unexpected receipt: %+v", receipt)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"github.com/bottos-project/bottos/contract"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// DefaultMigrateGas is the gas of the migration of an UpgradeConfig
+// setting none.
+const DefaultMigrateGas = 10000000
+
+// UpgradeConfig configures the upgrade of a contract to a new version of
+// its module, see (*Module).Upgrade.
+type UpgradeConfig struct {
+	// Store and Contract are the StateStore and the contract context of
+	// the contract upgraded, whose storage the new version keeps, see
+	// RegisterStorage. Both may be nil.
+	Store    StateStore
+	Contract *contract.Context
+	// Memory is the memory the new instance starts with, such as the
+	// memory of the instance of the old version, or nil to start with the
+	// initial memory of the new module. It overwrites the data segments
+	// of the new module.
+	Memory []byte
+	// Migrate is the name of the export migrating the state of the old
+	// version, "migrate" if empty. The migration is skipped if the module
+	// doesn't export it.
+	Migrate string
+	// MigrateGas is the gas the migration can consume, DefaultMigrateGas
+	// if zero, according to Schedule, see SetGasMeter.
+	MigrateGas uint64
+	Schedule   *GasSchedule
+}
+
+// Upgrade instantiates m, the new version of a contract, against the state
+// of the contract: its storage, and optionally its memory, see
+// UpgradeConfig. It then runs the migrate function exported by m, with
+// its own gas budget, which takes no parameters and returns nothing or an
+// i32 status, a non zero status failing the migration with
+// ERR_MIGRATION_FAILED. The storage writes of the migration are only
+// committed to the store and the contract database of the config once it
+// succeeds: a migration trapping or failing leaves the storage of the
+// contract as it was, and the new instance is closed. It returns the new
+// instance and the gas consumed by the migration.
+//
+// It returns ERR_UPGRADE_MEMORY for a memory whose size isn't a multiple
+// of the page size of m, or which the memory of m can't grow to, and
+// ERR_MIGRATE_SIGNATURE for a migrate function of another type.
+func (m *Module) Upgrade(imports *EnvFunc, config UpgradeConfig) (inst *Instance, gasUsed uint64, err error) {
+	if config.Migrate == "" {
+		config.Migrate = "migrate"
+	}
+	if config.MigrateGas == 0 {
+		config.MigrateGas = DefaultMigrateGas
+	}
+	created, err := m.Instantiate(imports)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if err != nil {
+			created.Close()
+		}
+	}()
+	inst = created
+	if err := inst.restoreMemory(config.Memory); err != nil {
+		return nil, 0, err
+	}
+
+	export, ok := inst.ExportedFunction(config.Migrate)
+	if !ok {
+		return inst, 0, nil
+	}
+	if len(export.Sig.ParamTypes) != 0 || len(export.Sig.ReturnTypes) > 1 ||
+		len(export.Sig.ReturnTypes) == 1 && export.Sig.ReturnTypes[0] != wasm.ValueTypeI32 {
+		return nil, 0, ERR_MIGRATE_SIGNATURE
+	}
+	vm := inst.NewVM()
+	meter := NewGasMeter(config.MigrateGas)
+	vm.SetGasMeter(meter, config.Schedule)
+	var store *storeJournal
+	if config.Store != nil {
+		store = newStoreJournal(config.Store)
+		vm.SetStateStore(store)
+	}
+	var journal *stateJournal
+	if ctx := config.Contract; ctx != nil && ctx.ContractDB != nil {
+		journal = newStateJournal(ctx.ContractDB)
+		vm.SetContract(&contract.Context{RoleIntf: ctx.RoleIntf, ContractDB: journal, Trx: ctx.Trx})
+	} else {
+		vm.SetContract(ctx)
+	}
+
+	res, err := vm.migrate(int64(export.Index))
+	if err != nil {
+		return nil, meter.Used(), err
+	}
+	if status, ok := res.(uint32); ok && status != 0 {
+		return nil, meter.Used(), ERR_MIGRATION_FAILED
+	}
+	if store != nil {
+		if err := store.commit(); err != nil {
+			return nil, meter.Used(), err
+		}
+	}
+	if journal != nil {
+		if err := journal.commit(); err != nil {
+			return nil, meter.Used(), err
+		}
+	}
+	return inst, meter.Used(), nil
+}
+
+// restoreMemory sets the memory of inst to memory, if not nil, growing it
+// to its size.
+func (inst *Instance) restoreMemory(memory []byte) error {
+	if memory == nil {
+		return nil
+	}
+	if len(memory)%inst.pageSize != 0 {
+		return ERR_UPGRADE_MEMORY
+	}
+	if len(memory) > len(inst.memory) && inst.growMemory(uint32((len(memory)-len(inst.memory))/inst.pageSize)) < 0 {
+		return ERR_UPGRADE_MEMORY
+	}
+	inst.generation++
+	copy(inst.memory, memory)
+	inst.wroteAll()
+	return nil
+}
+
+// migrate calls the migrate function with the given index, the traps of
+// the migration being returned as errors.
+func (vm *VM) migrate(fnIndex int64) (res interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if !isTrap(r) {
+				panic(r)
+			}
+			res, err = nil, r.(error)
+		}
+	}()
+	return vm.ExecCode(fnIndex)
+}
@@ -0,0 +1,115 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bottos-project/bottos/common/types"
+	"github.com/bottos-project/bottos/contract"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestUpgrade(t *testing.T) {
+	module, err := wasm.ReadModule(bytes.NewReader(readTestCode(t, "testdata/upgrade.wasm")), importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnvFunc()
+	RegisterStorage(env, StorageConfig{})
+	ctx := &contract.Context{Trx: &types.Transaction{Contract: "c"}}
+	read := func(inst *Instance, addr uint64) uint32 {
+		t.Helper()
+		res, err := inst.NewVM().ExecCode(int64(module.Export.Entries["read"].Index), addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.(uint32)
+	}
+
+	// the migration copies the value of k to m, in the storage of the
+	// contract, and the memory of the old version overwrites the data
+	// segments
+	store := memStateStore{"c/k": []byte("v1")}
+	memory := oldMemory(2)
+	memory[0], memory[100] = 'o', 42
+	inst, gas, err := compiled.Upgrade(env, UpgradeConfig{Store: store, Contract: ctx, Memory: memory, Schedule: DefaultGasSchedule()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gas == 0 {
+		t.Error("the migration consumed no gas")
+	}
+	if got := string(store["c/m"]); got != "v1" {
+		t.Errorf("unexpected migrated value: got=%q, want=%q", got, "v1")
+	}
+	if got := len(inst.Memory()); got != 2*wasmPageSize {
+		t.Errorf("unexpected memory size: got=%d, want=%d", got, 2*wasmPageSize)
+	}
+	if got, want := [2]uint32{read(inst, 0), read(inst, 100)}, [2]uint32{'o', 42}; got != want {
+		t.Errorf("unexpected memory: got=%v, want=%v", got, want)
+	}
+	inst.Close()
+
+	// a migration trapping, failing or out of gas leaves the storage as it
+	// was
+	for _, tc := range []struct {
+		name   string
+		config UpgradeConfig
+		err    error
+		trap   TrapCode // the trap of a migration trapping
+	}{
+		{"trap", UpgradeConfig{Memory: failingMemory(200)}, nil, TrapOutOfBoundsMemory},
+		{"gas", UpgradeConfig{Memory: oldMemory(1), MigrateGas: 5, Schedule: DefaultGasSchedule()}, nil, TrapOutOfGas},
+		{"status", UpgradeConfig{Memory: failingMemory(201)}, ERR_MIGRATION_FAILED, TrapNone},
+		{"memory", UpgradeConfig{Memory: make([]byte, 100)}, ERR_UPGRADE_MEMORY, TrapNone},
+		{"limit", UpgradeConfig{Memory: make([]byte, 5*wasmPageSize)}, ERR_UPGRADE_MEMORY, TrapNone},
+		{"signature", UpgradeConfig{Migrate: "read"}, ERR_MIGRATE_SIGNATURE, TrapNone},
+	} {
+		store := memStateStore{"c/k": []byte("v1")}
+		tc.config.Store, tc.config.Contract = store, ctx
+		inst, _, err := compiled.Upgrade(env, tc.config)
+		if inst != nil || tc.trap == TrapNone && err != tc.err || tc.trap != TrapNone && TrapCodeOf(err) != tc.trap {
+			t.Errorf("%s: unexpected result: %v, %v", tc.name, inst, err)
+		}
+		if _, ok := store["c/m"]; ok {
+			t.Errorf("%s: the storage write is kept", tc.name)
+		}
+	}
+}
+
+// oldMemory returns a memory of the given pages holding the keys the
+// migration reads and writes.
+func oldMemory(pages int) []byte {
+	memory := make([]byte, pages*wasmPageSize)
+	memory[16], memory[32] = 'k', 'm'
+	return memory
+}
+
+// failingMemory returns a memory making the migration fail with the byte
+// at addr set.
+func failingMemory(addr int) []byte {
+	memory := oldMemory(1)
+	memory[addr] = 1
+	return memory
+}
@@ -0,0 +1,113 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "github.com/bottos-project/bottos/vm/wasm/wasm"
+
+// MemoryUsage is the size of a linear memory of an instance, see
+// Instance.Memories.
+type MemoryUsage struct {
+	// Index is the index of the memory in the module.
+	Index int
+	// Size is the current size of the memory in bytes, and Pages in pages
+	// of PageSize bytes. MaxPages is the number of pages the memory can
+	// grow to, its maximum or the largest memory its addresses can index.
+	Size     int
+	Pages    uint64
+	MaxPages uint64
+	PageSize int
+	// Held is the number of bytes held by the instance for the memory,
+	// which exceeds its size when it shrank with Reset or its capacity was
+	// doubled, see Instance.ReleaseMemory.
+	Held     int
+	Memory64 bool
+	Shared   bool
+}
+
+// TableUsage is the size of a table of an instance, in elements, see
+// Instance.Tables. Max is the number of elements the table can grow to.
+type TableUsage struct {
+	Index       int
+	ElementType wasm.ElemType
+	Size        uint32
+	Max         uint32
+}
+
+// MemorySize returns the size in bytes of the first linear memory of inst,
+// zero once it is closed.
+func (inst *Instance) MemorySize() int {
+	if inst.closed {
+		return 0
+	}
+	inst.syncMemory()
+	return len(inst.memory)
+}
+
+// MemoryPages returns the size in pages of the first linear memory of
+// inst.
+func (inst *Instance) MemoryPages() uint64 {
+	return uint64(inst.MemorySize() / inst.pageSize)
+}
+
+// Memories returns the sizes of the linear memories of inst, indexed by
+// memory index. Like the ones of Tables, they must not be taken while a
+// call of inst is in progress on another goroutine. A closed instance has
+// none.
+func (inst *Instance) Memories() []MemoryUsage {
+	if inst.closed {
+		return nil
+	}
+	inst.syncMemory()
+	usage := []MemoryUsage{{
+		Size:     len(inst.memory),
+		Pages:    uint64(len(inst.memory) / inst.pageSize),
+		MaxPages: inst.maxMemory / uint64(inst.pageSize),
+		PageSize: inst.pageSize,
+		Held:     inst.heldMemory(),
+		Memory64: inst.memory64,
+		Shared:   inst.shared != nil,
+	}}
+	for i, mem := range inst.memories {
+		usage = append(usage, MemoryUsage{
+			Index:    i + 1,
+			Size:     len(mem.memory),
+			Pages:    uint64(len(mem.memory) / mem.pageSize),
+			MaxPages: mem.maxMemory / uint64(mem.pageSize),
+			PageSize: mem.pageSize,
+			Held:     cap(mem.memory),
+			Memory64: mem.memory64,
+		})
+	}
+	return usage
+}
+
+// Tables returns the sizes of the tables of inst, indexed by table index.
+func (inst *Instance) Tables() []TableUsage {
+	types := inst.compiled.module.Tables()
+	usage := make([]TableUsage, len(inst.tables))
+	for i, table := range inst.tables {
+		usage[i] = TableUsage{Index: i, Size: uint32(len(table)), Max: maxTableElements}
+		if i < len(types) {
+			usage[i].ElementType = types[i].ElementType
+			if limits := types[i].Limits; limits.Flags&0x1 != 0 && limits.Maximum < maxTableElements {
+				usage[i].Max = limits.Maximum
+			}
+		}
+	}
+	return usage
+}
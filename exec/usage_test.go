@@ -0,0 +1,74 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestInstanceUsage(t *testing.T) {
+	module := readTestModule(t, "testdata/usage.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+	if _, err := vm.ExecCode(int64(module.Export.Entries["grow"].Index), 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.ExecCode(int64(module.Export.Entries["grow_table"].Index), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if inst.MemorySize() != 3*wasmPageSize || inst.MemoryPages() != 3 {
+		t.Errorf("unexpected memory size: %d bytes, %d pages", inst.MemorySize(), inst.MemoryPages())
+	}
+	memories := inst.Memories()
+	if len(memories) != 2 || memories[0].Held < memories[0].Size {
+		t.Fatalf("unexpected memories: %+v", memories)
+	}
+	memories[0].Held = 0
+	want := []MemoryUsage{
+		{Index: 0, Size: 3 * wasmPageSize, Pages: 3, MaxPages: 4, PageSize: wasmPageSize},
+		{Index: 1, Size: 2 * wasmPageSize, Pages: 2, MaxPages: maxMemoryPages, PageSize: wasmPageSize, Held: 2 * wasmPageSize},
+	}
+	if !reflect.DeepEqual(memories, want) {
+		t.Errorf("got=%+v, want=%+v", memories, want)
+	}
+
+	tables := []TableUsage{
+		{Index: 0, ElementType: wasm.ElemTypeAnyFunc, Size: 5, Max: 8},
+		{Index: 1, ElementType: wasm.ElemTypeExternRef, Size: 0, Max: maxTableElements},
+	}
+	if got := inst.Tables(); !reflect.DeepEqual(got, tables) {
+		t.Errorf("got=%+v, want=%+v", got, tables)
+	}
+
+	inst.Close()
+	if inst.MemorySize() != 0 || inst.Memories() != nil {
+		t.Errorf("unexpected memories of a closed instance: %+v", inst.Memories())
+	}
+}
@@ -24,15 +24,21 @@ package exec
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bottos-project/bottos/common/types"
 	"github.com/bottos-project/bottos/contract"
-	"github.com/bottos-project/bottos/vm/wasm/disasm"
 	"github.com/bottos-project/bottos/vm/wasm/exec/internal/compile"
+	"github.com/bottos-project/bottos/vm/wasm/exec/internal/native"
+	"github.com/bottos-project/bottos/vm/wasm/log"
+	"github.com/bottos-project/bottos/vm/wasm/validate"
 	"github.com/bottos-project/bottos/vm/wasm/wasm"
 	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
 )
@@ -46,51 +52,285 @@ const (
 
 // InvalidReturnTypeError is returned by (*VM).ExecCode when the module
 // specifies an invalid return type value for the executed function.
-type InvalidReturnTypeError int8
+type InvalidReturnTypeError int32
 
 func (e InvalidReturnTypeError) Error() string {
-	return fmt.Sprintf("Function has invalid return value_type: %d", int8(e))
+	return fmt.Sprintf("Function has invalid return value_type: %d", int32(e))
 }
 
 // InvalidFunctionIndexError is returned by (*VM).ExecCode when the function
-// index provided is invalid.
+// index provided is invalid, and by (Table).Set for such a function.
 type InvalidFunctionIndexError int64
 
 func (e InvalidFunctionIndexError) Error() string {
 	return fmt.Sprintf("Invalid index to function index space: %d", int64(e))
 }
 
+// VMConfig holds the options used when creating a VM.
+type VMConfig struct {
+	// StaticMemoryBounds trades memory for speed: when the module's memory
+	// declares a maximum size, the linear memory is allocated to that
+	// maximum up front, and memory accesses with a constant address inside
+	// the initial memory are compiled without bounds checks.
+	StaticMemoryBounds bool
+	// InlineThreshold is the maximum number of instructions of a leaf
+	// function (one without calls nor control operators) for its body to
+	// be inlined at its call sites. Zero disables inlining.
+	InlineThreshold int
+	// AOT compiles functions to native machine code, on the platforms
+	// supported by the native backend. Functions the backend can not
+	// lower are interpreted.
+	AOT bool
+	// BlockMetering makes the gas meter charge the cost of the instructions
+	// of a basic block on entering it, computed at compile time, instead of
+	// charging every instruction: the metering overhead drops to one charge
+	// per branch taken, and the instructions of a block not run because of
+	// a trap are charged anyway.
+	BlockMetering bool
+	// RelaxedSIMD allows the modules to use the relaxed SIMD operators,
+	// which are executed with a deterministic lowering, see
+	// initRelaxedSIMD. CompileModule rejects them otherwise.
+	RelaxedSIMD bool
+	// CanonicalNaN makes the float operators producing a NaN produce the
+	// canonical one, a positive quiet NaN with an empty payload, for the
+	// results of the modules using floats to be identical whatever the
+	// architecture, as a consensus requires. The sign and payload of the
+	// NaNs otherwise depend on the hardware, the other results being
+	// rounded to nearest, operator by operator, everywhere. The
+	// conversions to integers of the NaNs and of the floats out of range
+	// trap, with or without CanonicalNaN.
+	CanonicalNaN bool
+	// SoftFloat makes the float operators, scalar and SIMD, computed with
+	// integer arithmetic by package softfloat instead of the hardware, for
+	// the chains which want floats without any platform variance: the
+	// results are rounded to nearest, ties to even, and the NaNs produced
+	// are the canonical ones. The conversions to integers of a NaN or of a
+	// float out of range trap with TrapInvalidConversion and
+	// TrapIntegerOverflow, as they do without SoftFloat. The float
+	// operators run several times slower.
+	SoftFloat bool
+	// GuestStackCheck makes the modules compiled from C or Rust trap with
+	// a GuestStackOverflowError when their shadow stack, the stack they
+	// keep in their linear memory below the address in their
+	// __stack_pointer global, overflows into their data, instead of
+	// silently corrupting it. The functions setting the stack pointer
+	// aren't compiled to native code.
+	GuestStackCheck bool
+	// LazyCompile makes CompileModule leave every function to validate
+	// and compile on its first call, or on Module.CompileAll, so that
+	// loading a module whose functions are mostly never called is cheap.
+	// Calling a function failing validation then fails with its
+	// validate.Error, which traps the VM when another function calls it.
+	// The functions compiled lazily aren't inlined into, and the modules
+	// compiled with CheckStackUsage or BlockMetering are compiled eagerly.
+	LazyCompile bool
+
+	// The options below only apply to the instances of a module, and
+	// aren't part of a serialized module.
+
+	// MappedMemory reserves the address space of the linear memories up
+	// to their maximum size, followed by guard pages, on the platforms
+	// supporting it, so that the memory grows without being copied. It
+	// takes precedence over MemoryPool. The guard pages only catch stray
+	// accesses: the Go runtime can't recover from a fault in native code,
+	// so the AOT backend keeps checking the bounds of memory accesses.
+	MappedMemory bool
+	// MemoryPool, if not nil, is the pool the linear memories of the
+	// instances are leased from.
+	MemoryPool *MemoryPool
+	// RetainedMemory, if not zero, is the number of bytes of memory an
+	// instance may hold once Reset, above which Reset releases the memory
+	// past its initial size, see Instance.ReleaseMemory.
+	RetainedMemory int
+	// OnMemoryGrow, if not nil, is called after the linear memory of an
+	// instance grew from previous to current pages.
+	OnMemoryGrow func(vm *VM, previous, current uint32)
+	// MaxGrowPages, if not zero, is the number of pages memory.grow may
+	// add during a call of ExecCode, whatever the maximum size declared by
+	// the module: past it, memory.grow fails and returns -1.
+	MaxGrowPages uint32
+	// ResourceLimiter, if not nil, approves or denies the memory and table
+	// of the instances, and their creation.
+	ResourceLimiter ResourceLimiter
+	// MaxExecutionTime, if not zero, is the time a call of ExecCode may
+	// run for: a watchdog interrupts the calls running longer, which then
+	// return a TimeoutError. Functions compiled to native code are
+	// interpreted, since native code can't be interrupted.
+	MaxExecutionTime time.Duration
+	// MaxCallDepth is the number of nested calls a call of ExecCode may
+	// make, DefaultMaxCallDepth if zero. MaxValueStackHeight, if not zero,
+	// is the number of values the locals and operand stacks of the nested
+	// calls may hold. Past them, the VM traps with a StackOverflowError.
+	MaxCallDepth        int
+	MaxValueStackHeight int
+	// CheckStackUsage makes CompileModule fail with a StackUsageError
+	// when a call of an exported function may exceed MaxCallDepth or
+	// MaxValueStackHeight, recursive functions included, see
+	// Module.StackUsage.
+	CheckStackUsage bool
+	// Policy, if not nil, makes CompileModule reject the modules using the
+	// constructs it forbids, such as floats.
+	Policy *validate.Policy
+	// DisjointDataSegments makes Instantiate fail with ERR_DATA_OVERLAP
+	// when active data segments of the module overlap in a memory, the
+	// bytes of the later segments silently replacing the ones of the
+	// earlier ones otherwise.
+	DisjointDataSegments bool
+	// TrustedKeys, if not empty, makes the module caches reject the modules
+	// which aren't signed by one of these keys, see VerifySignature.
+	TrustedKeys []ed25519.PublicKey
+	// Metrics, if not nil, receives the metrics of the instances and their
+	// calls, and of the loads of the module caches, see MetricsSink.
+	Metrics MetricsSink
+	// Logger, if not nil, receives the log messages of the instances and
+	// their calls, instead of the default logger, see log.SetDefault.
+	Logger log.Logger
+}
+
 type context struct {
-	stack   []uint64
-	locals  []uint64
-	code    []byte
-	pc      int64
-	curFunc int64
+	stack    []uint64
+	locals   []uint64
+	code     []byte
+	pc       int64
+	curFunc  int64
+	// the gas consumed by the meter when the frame was entered, see
+	// StackFrame
+	gasStart uint64
 }
 
 // VM is the execution context for executing WebAssembly bytecode.
 type VM struct {
 	ctx context
+	// values backing the stacks and locals of the calls in progress, see
+	// allocValues
+	values    []uint64
+	valuesTop int
+	// the instance the VM executes, holding the memory, globals and tables
+	*Instance
 
 	module        *wasm.Module
-	globals       []uint64
-	memory        []byte
-	compiledFuncs []compiledFunction
+	config        VMConfig
+	// interned signature ids, indexed by type index and by function index
+	typeIDs       []uint32
+	funcTypeIDs   []uint32
 
 	funcTable     [256]func()
 
-	memPos        uint64
 	//To avoid the too much the number of recursion execution(dep) in contract
 	callDep       int
 	//To limit the too much the number of new contract execution(wid) in contract
 	callWid       int
-	// define a map relationship between memory address and data's type
-	memType       map[uint64]*typeInfo
+	// the depth of the contract call the VM runs, see ContractCaller
+	contractDepth int
+	// the call of the contract run by the VM, if run by a ContractCaller
+	contractFrame *contractFrame
 	//define env function
 	envFunc      *EnvFunc
+	// the gas meter and the cost of every compiled opcode, see SetGasMeter
+	gasMeter      *GasMeter
+	gasCosts      *[256]uint64
+	// the cost of every basic block, indexed by function, and of every
+	// compiled opcode, with BlockMetering
+	blockCosts    [][]uint64
+	blockOpCosts  *[256]uint64
+	// the cost of the pages added by memory.grow
+	growCost      MemoryGrowCost
+	// the cost of the bulk memory operators, and of the bytes or elements
+	// they write
+	miscCosts     *[32]uint64
+	bulkByteCost  uint64
+	// the cost of the SIMD operators
+	simdCosts     *[512]uint64
+	// the cost of the atomic operators
+	atomicCosts   *[128]uint64
+	// the cost of the GC operators
+	gcCosts       *[32]uint64
+	// the pages added by memory.grow during the current call, see
+	// VMConfig.MaxGrowPages
+	grownPages    uint32
+	// the number of instructions a call may run, and the ones left to the
+	// current call, see SetFuel
+	fuel          uint64
+	fuelLeft      uint64
+	// the functions called before each instruction, see SetDebugHook and
+	// SetTraceFunc, the watched memory ranges, see AddWatchpoint, the
+	// audited ones, see SetMemoryAudit, the coverage counting the
+	// instructions run, see SetCoverage, and whether any is set
+	debugHook     func(fn, offset int64)
+	trace         TraceFunc
+	watchFunc     WatchFunc
+	watchpoints   []Watchpoint
+	audit         *memoryAudit
+	// the ranges of the memories the module can't write, see
+	// SetReadOnlyMemory
+	readOnly      []MemoryRange
+	alignCheck    AlignCheck
+	alignFunc     AlignFunc
+	coverage      *Coverage
+	// the tracer of the function calls, see SetCallTracer, the profile
+	// of the functions while profiling, see EnableProfiling, and the one
+	// kept once profiling is disabled
+	callTracer    *CallTracer
+	profile       *profile
+	profiled      *profile
+	// the statistics of the current call, see CollectStats
+	stats         *execStats
+	// the gas consumed by category while it is tracked, and since tracking
+	// started, see TrackGasBreakdown
+	gasBreakdown  *GasBreakdown
+	gasTracked    *GasBreakdown
+	hooked        bool
+	// the state of an interruption of the call and its cause, set from
+	// other goroutines, and the number of sources able to interrupt the
+	// current call, see ExecCodeContext
+	interrupted   uint32
+	interruptErr  error
+	interruptible int
+	// the epochs a call may last, and the epoch the current call traps
+	// at, see SetEpochDeadline
+	epochTicks    uint64
+	epochDeadline uint64
+	// whether the current call is watched for MaxExecutionTime
+	timed         bool
+	// the number of frames of the calls in progress, and the contexts of
+	// the callers of the current context
+	depth         int
+	frames        []context
+	// whether the current context returned with a tail call, and the index
+	// of the function it calls, see tailCalls
+	tailCall      bool
+	tailCallee    uint32
+	// whether the current call is asked to pause, and the state of the last
+	// call paused, see Pause
+	pausing       uint32
+	paused        *Continuation
+	// the gas used by the meter at which the current call pauses, or zero,
+	// see ExecCodeBudget
+	budgetEnd     uint64
+	// the sampler of the call stacks, and whether a sample is due, set
+	// from its goroutine, see StartSampling
+	sampler       *Sampler
+	sampleDue     uint32
+	// the Asyncify running the calls of the VM, see RegisterAsync
+	asyncify      *Asyncify
+	gasUsed       uint64
 	funcInfo      FuncInfo
 
 	contract     *contract.Context
+	// the storage of the storage host functions, see RegisterStorage
+	stateStore    StateStore
+	// the state of the chain the calls run in, see SetChainContext
+	chainContext  *ChainContext
+	// the storage writes of a dry run, see EstimateGas
+	overlay       stateOverlay
+	// the events emitted by the calls, see CollectEvents
+	events        *eventLog
+	// the receipts of the calls, see CollectReceipts
+	receipts      *receiptLog
+	// the recorder of the calls, and the trace they are replayed from, see
+	// Record and Replay
+	recorder      *Recorder
+	replayer      *traceReader
 
 	vmLock       *sync.Mutex
 	//the channel be used to communcate with vm_engine
@@ -109,139 +349,65 @@ type VM struct {
 // As per the WebAssembly spec: https://github.com/WebAssembly/design/blob/27ac254c854994103c24834a994be16f74f54186/Semantics.md#linear-memory
 const wasmPageSize = 65536 // (64 KB)
 
+// maxMemoryPages is the number of pages of a memory without a maximum size,
+// which can be addressed by a 32 bits address.
+const maxMemoryPages = 65536
+
+// maxMemory64Pages is the number of pages of a 64-bit memory without a
+// maximum size, the largest memory a slice can hold.
+const maxMemory64Pages = uint64(^uint(0)>>1) / wasmPageSize
+
+// memoryGuardSize is the size of the inaccessible region mapped after the
+// end of a mapped memory.
+const memoryGuardSize = 16 * wasmPageSize
+
 var endianess = binary.LittleEndian
 
 // NewVM creates a new VM from a given module. If the module defines a
 // start function, it will be executed.
 func NewVM(module *wasm.Module) (*VM, error) {
+	return NewVMWithConfig(module, VMConfig{})
+}
 
-	var value interface{}
-	var err   error
-
-	var vm = &VM{
-		envFunc:  NewEnvFunc(),
-		memPos:   0,
-		memType:  make(map[uint64]*typeInfo),
-		memory:   make([]byte, wasmPageSize),
-		contract: nil,
-		vmLock:   new(sync.Mutex),
-		callDep:  0,
-		callWid:  0,
-	}
-
-	if len(module.LinearMemoryIndexSpace) <= 0 {
-		return nil, ERR_INVALID_WASM
-	}
-
-	if module.Memory != nil && len(module.Memory.Entries) != 0 {
-		if len(module.Memory.Entries) > 1 {
-			return nil, ERR_MULTIPLE_LINEAR_MEMORIES
-		}
-		vm.memory = make([]byte, uint(module.Memory.Entries[0].Limits.Initial)*wasmPageSize)
-	}
-
-	indexSpaceLen := len(module.LinearMemoryIndexSpace[0])
-	if copy(vm.memory, module.LinearMemoryIndexSpace[0]) == indexSpaceLen {
-		vm.memPos += uint64(len(module.LinearMemoryIndexSpace[0]))
-	}else{
-		return nil , ERR_CREATE_VM
-	}
-
-	//it need modify if adding python or compiler change
-	if module.Other == nil {
-		vm.sourceFile = CPP
-	} else {
-		vm.sourceFile = JS
-	}
-
-	if module.Data != nil {
-		for _, funcList := range module.Data.Entries {
-			if value, err = module.ExecInitExpr(funcList.Offset); err != nil {
-				return nil, err
-			}
-
-			index, ok := value.(int32)
-			if !ok {
-				return nil, ERR_DATA_INDEX
-			}
-
-			// if it contains multi-function(splited by '0')
-			if bytes.Contains(funcList.Data, []byte{byte(0)}) != true {
-				vm.memType[uint64(index)] = &typeInfo{Type: String, Len: uint64(len(funcList.Data))}
-			} else {
-				var idx = int(index)
-				funcArray := bytes.Split(funcList.Data, []byte{byte(0)})
-				for _, function := range funcArray {
-					vm.memType[uint64(idx)] = &typeInfo{Type: String, Len: uint64(len(function) + 1)}
-					idx += len(function) + 1
-				}
-			}
-		}
-	} else {
-		vm.memPos = uint64(len(vm.memory) / 2)
-	}
-
-	vm.compiledFuncs = make([]compiledFunction, len(module.FunctionIndexSpace))
-	vm.globals       = make([]uint64, len(module.GlobalIndexSpace))
-	vm.newFuncTable()
-	vm.module = module
-
-	for i, fn := range module.FunctionIndexSpace {
-		disassembly, err := disasm.Disassemble(fn, module)
-		if err != nil {
-			return nil, err
-		}
-
-		totalLocalVars := 0
-		totalLocalVars += len(fn.Sig.ParamTypes)
-		for _, entry := range fn.Body.Locals {
-			totalLocalVars += int(entry.Count)
-		}
-
-		code, table := compile.Compile(disassembly.Code)
-		vm.compiledFuncs[i] = compiledFunction{
-			code:           code,
-			branchTables:   table,
-			maxDepth:       disassembly.MaxDepth,
-			totalLocalVars: totalLocalVars,
-			args:           len(fn.Sig.ParamTypes),
-			returns:        len(fn.Sig.ReturnTypes) != 0,
-			funcProp:       fn,
-		}
+// NewVMWithConfig creates a new VM from a given module, using the
+// provided config. If the module defines a start function, it will
+// be executed.
+func NewVMWithConfig(module *wasm.Module, config VMConfig) (*VM, error) {
+	compiled, err := CompileModule(module, config)
+	if err != nil {
+		return nil, err
 	}
 
-	for i, global := range module.GlobalIndexSpace {
-		val, err := module.ExecInitExpr(global.Init)
-		if err != nil {
-			return nil, err
-		}
-		switch v := val.(type) {
-		case int32:
-			vm.globals[i] = uint64(v)
-		case int64:
-			vm.globals[i] = uint64(v)
-		case float32:
-			vm.globals[i] = uint64(math.Float32bits(v))
-		case float64:
-			vm.globals[i] = uint64(math.Float64bits(v))
-		}
-	}
+	return NewVMFromModule(compiled)
+}
 
-	if module.Start != nil {
-		_, err := vm.ExecCode(int64(module.Start.Index))
-		if err != nil {
-			return nil, err
-		}
+// NewVMFromModule creates a new VM from a compiled module, with a new
+// Instance of it using the default env functions. If the module defines a
+// start function, it will be executed.
+func NewVMFromModule(compiled *Module) (*VM, error) {
+	inst, err := compiled.Instantiate(nil)
+	if err != nil {
+		return nil, err
 	}
+	// the instance is released with the VM
+	inst.closeExpected = false
 
-	return vm, nil
+	return inst.NewVM(), nil
 }
 
-// Memory returns the linear memory space for the VM.
+// Memory returns the linear memory space for the VM. The whole memory
+// counts as written, see UnsafeView.
 func (vm *VM) Memory() []byte {
+	vm.wroteAll()
 	return vm.memory
 }
 
+// logger returns the printer of the log messages of vm, to its
+// VMConfig.Logger or the default logger.
+func (vm *VM) logger() log.Printer {
+	return log.Of(vm.config.Logger)
+}
+
 func (vm *VM) pushBool(v bool) {
 	if v {
 		vm.pushUint64(1)
@@ -340,65 +506,309 @@ func (vm *VM) pushFloat32(f float32) {
 
 // ExecCode calls the function with the given index and arguments.
 // fnIndex should be a valid index into the function index space of
-// the VM's module.
+// the VM's module. The results of a function returning several values
+// are returned as a []interface{}. A v128 argument is passed as two
+// values, its low then high 64 bits, and a v128 result is returned as a
+// wasm.V128. Boxing the result allocates for most values, so that only
+// the calls made with ExecCodeRaw are free of allocations.
 func (vm *VM) ExecCode(fnIndex int64, args ...uint64) (interface{}, error) {
-	if int(fnIndex) > len(vm.compiledFuncs) {
-		return nil, InvalidFunctionIndexError(fnIndex)
+	res, err := vm.ExecCodeRaw(fnIndex, args...)
+	if err != nil {
+		return nil, err
+	}
+	return vm.boxResult(fnIndex, res)
+}
+
+// boxResult returns the raw result res of the function with the given
+// index as a value of its return type, or as a []interface{} of the
+// values of its return types if it returns several values.
+func (vm *VM) boxResult(fnIndex int64, res uint64) (interface{}, error) {
+	var rtrn interface{}
+	rtrnTypes := vm.module.GetFunction(int(fnIndex)).Sig.ReturnTypes
+	switch {
+	case len(rtrnTypes) == 1 && rtrnTypes[0] != wasm.ValueTypeV128:
+		return boxValue(rtrnTypes[0], res)
+	case len(rtrnTypes) != 0:
+		values  := vm.resultValues(fnIndex, res)
+		results := make([]interface{}, len(rtrnTypes))
+		for i, t := range rtrnTypes {
+			if t == wasm.ValueTypeV128 {
+				results[i] = v128Value(values[0], values[1])
+				values = values[2:]
+				continue
+			}
+			var err error
+			if results[i], err = boxValue(t, values[0]); err != nil {
+				return nil, err
+			}
+			values = values[1:]
+		}
+		if len(results) == 1 {
+			return results[0], nil
+		}
+		rtrn = results
+	}
+
+	return rtrn, nil
+}
+
+// boxValue returns the raw value v as a value of type t.
+func boxValue(t wasm.ValueType, v uint64) (interface{}, error) {
+	switch t {
+	case wasm.ValueTypeI32:
+		return uint32(v), nil
+	case wasm.ValueTypeI64:
+		return uint64(v), nil
+	case wasm.ValueTypeF32:
+		return math.Float32frombits(uint32(v)), nil
+	case wasm.ValueTypeF64:
+		return math.Float64frombits(v), nil
+	default:
+		if t.IsRef() {
+			return wasm.Ref(v), nil
+		}
+		return nil, InvalidReturnTypeError(t)
 	}
+}
 
-	if len(vm.module.GetFunction(int(fnIndex)).Sig.ParamTypes) != len(args) {
-		return nil, ERR_INVALID_ARGUMENT_COUNT
+// ExecCodeValues calls the function with the given index and arguments
+// like ExecCodeRaw, but returns the raw bits of all of its results, for
+// functions returning several values or a v128.
+func (vm *VM) ExecCodeValues(fnIndex int64, args ...uint64) ([]uint64, error) {
+	res, err := vm.ExecCodeRaw(fnIndex, args...)
+	if err != nil {
+		return nil, err
+	}
+	return vm.resultValues(fnIndex, res), nil
+}
+
+// resultValues returns the results of the call to the function with the
+// given index that just returned res.
+func (vm *VM) resultValues(fnIndex int64, res uint64) []uint64 {
+	compiled := &vm.compiledFuncs[fnIndex]
+	switch {
+	case compiled.results > 1:
+		// the results are left on the stack of the call, which isn't
+		// reused before the next call
+		stack := vm.ctx.stack
+		return append([]uint64(nil), stack[len(stack)-compiled.results:]...)
+	case compiled.returns:
+		return []uint64{res}
+	}
+	return nil
+}
+
+// ExecCodeRaw calls the function with the given index and arguments like
+// ExecCode, but returns the raw bits of the result, which avoids boxing
+// it. Calls to functions with scalar arguments don't allocate once the
+// VM has warmed up.
+func (vm *VM) ExecCodeRaw(fnIndex int64, args ...uint64) (res uint64, err error) {
+	if vm.closed {
+		return 0, ERR_INSTANCE_CLOSED
+	}
+	if fnIndex < 0 || int(fnIndex) >= len(vm.compiledFuncs) {
+		return 0, InvalidFunctionIndexError(fnIndex)
+	}
+	if err := vm.loadFunction(fnIndex); err != nil {
+		return 0, err
 	}
 
-	compiled      := vm.compiledFuncs[fnIndex]
-	vm.ctx.stack   = make([]uint64, 0, compiled.maxDepth)
-	vm.ctx.locals  = make([]uint64, compiled.totalLocalVars) // number of local variables used by the function
+	compiled := &vm.compiledFuncs[fnIndex]
+	if compiled.args != len(args) {
+		return 0, ERR_INVALID_ARGUMENT_COUNT
+	}
+	if vm.config.MaxExecutionTime > 0 && !vm.timed {
+		return vm.execTimed(fnIndex, args)
+	}
+
+	if vm.recorder != nil && !vm.recorder.calling && vm.activeCalls == 0 {
+		return vm.recordCall(fnIndex, args)
+	}
+
+	// the receipt is recorded once the frame is released, even if the call
+	// traps; the callees of a contract call add to the receipt of their
+	// caller
+	if vm.receipts != nil && vm.receipts.collect && vm.activeCalls == 0 && vm.contractDepth == 0 {
+		vm.receipts.calls = nil
+		defer vm.recordReceipt(fnIndex, &res, &err)
+	}
+	// the frame is released even if the call traps
+	defer vm.endCall(vm.beginCall())
+	defer vm.recoverCall(len(vm.frames), &err)
+	vm.enterCall()
+	vm.syncMemory()
+	top           := vm.valuesTop
+	values        := vm.allocValues(compiled.maxDepth + compiled.totalLocalVars)
+	vm.ctx.stack   = values[:0:compiled.maxDepth]
+	vm.ctx.locals  = values[compiled.maxDepth:] // number of local variables used by the function
 	vm.ctx.pc      = 0
 	vm.ctx.code    = compiled.code
 	vm.ctx.curFunc = fnIndex
+	vm.ctx.gasStart = vm.meteredGas()
 
-	for i, arg := range args {
-		vm.ctx.locals[i] = arg
+	copy(vm.ctx.locals, args)
+	for i := len(args); i < len(vm.ctx.locals); i++ {
+		vm.ctx.locals[i] = 0
 	}
 
-	var rtrn interface{}
+	_, res = vm.tailCalls(*compiled, vm.execCode(*compiled), top)
+	if vm.activeCalls == 1 && vm.collectionDue() {
+		vm.collectObjects(vm.resultValues(fnIndex, res))
+	}
+	return res, nil
+}
 
-	res := vm.execCode(compiled)
-	if compiled.returns {
-		rtrnType := vm.module.GetFunction(int(fnIndex)).Sig.ReturnTypes[0]
-		switch rtrnType {
-		case wasm.ValueTypeI32:
-			rtrn = uint32(res)
-		case wasm.ValueTypeI64:
-			rtrn = uint64(res)
-		case wasm.ValueTypeF32:
-			rtrn = math.Float32frombits(uint32(res))
-		case wasm.ValueTypeF64:
-			rtrn = math.Float64frombits(res)
-		default:
-			return nil, InvalidReturnTypeError(rtrnType)
+// callMark is the state of a VM before a call, see beginCall, and the
+// time an outermost call started at, if its metrics are collected.
+type callMark struct {
+	top, depth, frames int
+	gasStart           uint64
+	start              time.Time
+}
+
+// beginCall resets the limits of vm for a new call started by ExecCodeRaw
+// or Resume, and returns the state endCall restores once the call ends.
+func (vm *VM) beginCall() callMark {
+	mark := callMark{top: vm.valuesTop, depth: vm.depth, frames: len(vm.frames)}
+	if sink := vm.config.Metrics; sink != nil && vm.activeCalls == 0 {
+		sink.Count(MetricCalls, "", 1)
+		sink.Gauge(MetricActiveCalls, 1)
+		mark.start = time.Now()
+	}
+	if vm.stats != nil && vm.activeCalls == 0 {
+		vm.stats.begin(vm)
+	}
+	if vm.activeCalls == 0 {
+		vm.generation++
+		// the callees of a contract call add to the events of their caller
+		if vm.events != nil && vm.contractDepth == 0 {
+			vm.events.reset()
 		}
 	}
+	vm.activeCalls++
+	if vm.gasMeter != nil {
+		mark.gasStart = vm.gasMeter.used
+	}
+	vm.fuelLeft = vm.fuel
+	vm.grownPages = 0
+	vm.paused = nil
+	if vm.epochTicks != 0 {
+		vm.epochDeadline = EngineEpoch() + vm.epochTicks
+	}
+	if vm.sampler != nil {
+		// the ticks between the calls sample nothing
+		atomic.StoreUint32(&vm.sampleDue, 0)
+	}
+	return mark
+}
 
-	return rtrn, nil
+// endCall releases the frames of a call started by ExecCodeRaw, and records
+// the gas it consumed.
+func (vm *VM) endCall(mark callMark) {
+	gasStart := mark.gasStart
+	vm.activeCalls--
+	vm.releaseValues(mark.top)
+	vm.depth = mark.depth
+	vm.frames = vm.frames[:mark.frames]
+	if vm.gasMeter != nil {
+		vm.gasUsed = 0
+		// refunds may give back gas consumed before the call
+		if vm.gasMeter.used > gasStart {
+			vm.gasUsed = vm.gasMeter.used - gasStart
+		}
+	}
+	if vm.stats != nil && vm.activeCalls == 0 {
+		vm.stats.end(vm)
+	}
+	if sink := vm.config.Metrics; sink != nil && vm.activeCalls == 0 {
+		sink.Gauge(MetricActiveCalls, -1)
+		sink.Observe(MetricExecutionDuration, time.Since(mark.start).Seconds())
+		sink.Count(MetricGasConsumed, "", vm.gasUsed)
+		vm.Instance.reportMemory()
+	}
 }
 
 func (vm *VM) execCode(compiled compiledFunction) uint64 {
+	if vm.callTracer != nil {
+		return vm.execTraced(compiled)
+	}
+	rtrn, _ := vm.runFunction(compiled)
+	return rtrn
+}
+
+// runFunction runs compiled, the function of the current context, and
+// returns the error of a host function along with the result.
+func (vm *VM) runFunction(compiled compiledFunction) (uint64, error) {
+	if vm.profile != nil {
+		return vm.runProfiled(compiled)
+	}
+	return vm.runCode(compiled)
+}
+
+// runCode runs compiled like runFunction, without profiling it.
+func (vm *VM) runCode(compiled compiledFunction) (uint64, error) {
 	if compiled.funcProp.EnvFunc == true {
 		err := vm.ExecEnvFunc(compiled)
 		if err != nil {
-			return uint64(VM_ERROR_FAIL_EXECUTE_ENVFUNC)
+			return uint64(VM_ERROR_FAIL_EXECUTE_ENVFUNC), err
 		}
 	}
+	return vm.execBody(compiled), nil
+}
+
+// execBody runs the code of compiled, as native code if it was compiled
+// to and the instructions needn't be accounted for.
+func (vm *VM) execBody(compiled compiledFunction) uint64 {
+	if compiled.native != nil && !vm.metered() {
+		return vm.execNative(compiled)
+	}
+	return vm.interpret(compiled)
+}
+
+// interpret runs the code of the current context from its pc.
+func (vm *VM) interpret(compiled compiledFunction) uint64 {
+	if compiled.handlers != nil {
+		return vm.interpretCatching(compiled)
+	}
+	return vm.interpretCode(compiled)
+}
+
+// interpretCode runs the code of the current context from its pc, letting
+// the exceptions unwind it.
+func (vm *VM) interpretCode(compiled compiledFunction) uint64 {
 outer:
 	for int(vm.ctx.pc) < len(vm.ctx.code) {
+		if vm.hooked {
+			vm.instructionHooks()
+		}
 		op := vm.ctx.code[vm.ctx.pc]
 		vm.ctx.pc++
+		if vm.gasCosts != nil {
+			vm.consumeGas(gasCategories[op], vm.gasCosts[op])
+		}
+		if vm.fuel != 0 {
+			vm.consumeFuel()
+		}
 		switch op {
 		case ops.Return:
 			break outer
+		case ops.ReturnCall:
+			vm.tailCallee, vm.tailCall = vm.fetchUint32(), true
+			break outer
+		case ops.ReturnCallIndirect:
+			// the function of another instance was called already
+			vm.tailCallee, vm.tailCall = vm.resolveIndirect()
+			break outer
+		case ops.ReturnCallRef:
+			vm.tailCallee, vm.tailCall = vm.resolveRef(), true
+			break outer
 		case compile.OpJmp:
-			vm.ctx.pc = vm.fetchInt64()
+			target := vm.fetchInt64()
+			backEdge := target < vm.ctx.pc
+			vm.ctx.pc = target
+			if backEdge {
+				vm.safepoint()
+			}
 			continue
 		case compile.OpJmpZ:
 			target := vm.fetchInt64()
@@ -411,6 +821,7 @@ outer:
 			preserveTop := vm.fetchBool()
 			discard := vm.fetchInt64()
 			if vm.popUint32() != 0 {
+				backEdge := target < vm.ctx.pc
 				vm.ctx.pc = target
 				var top uint64
 				if preserveTop {
@@ -420,32 +831,50 @@ outer:
 				if preserveTop {
 					vm.pushUint64(top)
 				}
+				if backEdge {
+					vm.safepoint()
+				}
+				continue
+			}
+		case compile.OpJmpNull, compile.OpJmpNonNull:
+			target := vm.fetchInt64()
+			null   := vm.ctx.stack[len(vm.ctx.stack)-1] == uint64(wasm.NullRef)
+			if null {
+				vm.ctx.stack = vm.ctx.stack[:len(vm.ctx.stack)-1]
+			}
+			if null == (op == compile.OpJmpNull) {
+				vm.ctx.pc = target
 				continue
 			}
 		case ops.BrTable:
 			index := vm.fetchInt64()
-			label := vm.popInt32()
-			table := vm.compiledFuncs[vm.ctx.curFunc].branchTables[index]
-			var target compile.Target
-			if label >= 0 && label < int32(len(table.Targets)) {
-				target = table.Targets[int32(label)]
-			} else {
-				target = table.DefaultTarget
-			}
+			label := vm.popUint32()
+			target := vm.compiledFuncs[vm.ctx.curFunc].branchTables[index].Target(label)
 
 			if target.Return {
 				break outer
 			}
+			backEdge := target.Addr < vm.ctx.pc
 			vm.ctx.pc = target.Addr
-			var top uint64
-			if target.PreserveTop {
-				top = vm.ctx.stack[len(vm.ctx.stack)-1]
-			}
-			vm.ctx.stack = vm.ctx.stack[:len(vm.ctx.stack)-int(target.Discard)]
-			if target.PreserveTop {
-				vm.pushUint64(top)
+			vm.unwind(int(target.Discard), target.Preserve)
+			if backEdge {
+				vm.safepoint()
 			}
 			continue
+		case compile.OpMeter:
+			block := vm.fetchUint32()
+			if vm.blockCosts != nil {
+				vm.consumeBlockGas(block)
+			}
+		case compile.OpUnchecked:
+			op = vm.ctx.code[vm.ctx.pc]
+			vm.ctx.pc++
+			if vm.gasCosts != nil {
+				vm.consumeGas(gasCategories[op], vm.gasCosts[op])
+			}
+			vm.uncheckedMemAccess(op)
+		case compile.OpMemory:
+			vm.memoryAccess(vm.fetchUint32())
 		case compile.OpDiscard:
 			place := vm.fetchInt64()
 			if len(vm.ctx.stack)-int(place) > 0 {
@@ -457,6 +886,11 @@ outer:
 			place := vm.fetchInt64()
 			vm.ctx.stack = vm.ctx.stack[:len(vm.ctx.stack)-int(place)]
 			vm.pushUint64(top)
+
+		case compile.OpDiscardPreserve:
+			preserve := vm.fetchInt64()
+			place    := vm.fetchInt64()
+			vm.unwind(int(place), int(preserve))
 		default:
 			vm.funcTable[op]()
 		}
@@ -469,8 +903,45 @@ outer:
 	return uint64(VM_NOERROR)
 }
 
+// unwind discards n elements from the stack, while preserving the given
+// number of values on its top.
+func (vm *VM) unwind(n, preserve int) {
+	height := len(vm.ctx.stack)
+	copy(vm.ctx.stack[height-n:], vm.ctx.stack[height-preserve:])
+	vm.ctx.stack = vm.ctx.stack[:height-n+preserve]
+}
+
+// execNative runs the native code of a function, with the locals of the
+// current context.
+func (vm *VM) execNative(compiled compiledFunction) uint64 {
+	stack     := vm.allocValues(compiled.native.MaxStack)
+	defer vm.releaseValues(vm.valuesTop - len(stack))
+	sp, trap  := compiled.native.Run(stack, vm.ctx.locals, vm.memory, vm.globals, vm.nativeCall)
+	if trap == native.TrapOutOfBounds {
+		// native code does not report the faulting access
+		panic(ErrOutOfBoundsMemoryAccess)
+	}
+
+	if compiled.returns && sp >= 1 {
+		return stack[sp-1]
+	}
+
+	return uint64(VM_NOERROR)
+}
+
+// nativeCall calls the function with the given index for native code, see
+// native.Caller. The context of the caller is left like the interpreter
+// leaves it at the call, for the callee to be paused.
+func (vm *VM) nativeCall(index uint32, pc int64, stack []uint64) ([]uint64, []byte) {
+	vm.ctx.pc    = pc
+	vm.ctx.stack = append(vm.ctx.stack[:0], stack...)
+	vm.doCall(vm.function(int64(index)), int64(index))
+	return vm.ctx.stack, vm.memory
+}
+
 // GetMemory get memory
 func (vm *VM) GetMemory() []byte {
+	vm.wroteAll()
 	return vm.memory
 }
 
@@ -482,8 +953,16 @@ func (vm *VM) GetFuncParams() []uint64 {
 	return params
 }
 
+// SetFuncResult sets the result of the host function being called, if its
+// import returns one, see GetFuncParams.
+func (vm *VM) SetFuncResult(v uint64) {
+	if vm.envFunc.envFuncRtn {
+		vm.pushUint64(v)
+	}
+}
+
 // ExecEnvFunc exec function
-func (vm *VM) ExecEnvFunc(compiled compiledFunction) error {
+func (vm *VM) ExecEnvFunc(compiled compiledFunction) (err error) {
 
 	vm.envFunc.envFuncParam = vm.ctx.locals
 	vm.envFunc.envFuncCtx   = vm.ctx
@@ -494,15 +973,35 @@ func (vm *VM) ExecEnvFunc(compiled compiledFunction) error {
 	} else {
 		vm.envFunc.envFuncRtn = false
 	}
+	if vm.stats != nil {
+		vm.stats.HostCalls++
+		vm.stats.observe(vm)
+	}
+	if vm.replayer != nil {
+		// the host function isn't called, its effects are in the trace
+		return vm.replayHost()
+	}
 
-	fc, ok := vm.envFunc.envFuncMap[compiled.funcProp.Method] //get env function
-	if !ok {
+	fc := vm.hostFunc(compiled) //get env function
+	if fc == nil {
 		fmt.Println("*ERROR* Failed to search the method: " + compiled.funcProp.Method)
 		return ERR_FIND_VM_METHOD
 	}
+	if vm.sampler != nil {
+		defer vm.sampler.enterHost(vm).leaveHost()
+	}
+	if vm.recording() {
+		vm.recorder.mark = vm.writeMark()
+		defer vm.recordHost(vm.meteredGas(), len(vm.ctx.stack), &err)
+	}
 
-	_, err := fc(vm)
+	_, err = fc(vm)
 	if err != nil {
+		var trap *HostTrapError
+		if errors.As(err, &trap) {
+			// the host function aborts the call
+			panic(trap)
+		}
 		vm.ctx = oldCtx
 		if compiled.returns {
 			vm.pushUint64(0)
@@ -26,10 +26,10 @@
 package exec
 
 import (
-	"bytes"
+	"crypto/ed25519"
 	"encoding/binary"
 	"errors"
-	log "github.com/cihub/seelog"
+	"github.com/bottos-project/bottos/vm/wasm/log"
 	"os"
 	"sync"
 	"time"
@@ -75,8 +75,25 @@ const (
 	SUB_WASM_FILE = "/opt/bin/go/sub.wasm"
 	// TST Test status
 	TST = true
+
+	// MODULE_CACHE_ENTRIES config the max number of compiled modules kept in memory
+	MODULE_CACHE_ENTRIES = 128
+	// MODULE_CACHE_SIZE config the max total size of compiled modules kept in memory
+	MODULE_CACHE_SIZE = 64 << 20
 )
 
+// moduleCache keeps the compiled contracts, so that calling the same
+// contract again doesn't decode, validate and compile it again
+var moduleCache = NewModuleCache(VMConfig{}, importer, MODULE_CACHE_ENTRIES, MODULE_CACHE_SIZE)
+
+// SetTrustedKeys makes the chain only run the contracts signed by one of
+// keys, see VerifySignature, or any contract if keys is empty. It replaces
+// the cache of the compiled contracts, and is meant to be called at
+// startup.
+func SetTrustedKeys(keys []ed25519.PublicKey) {
+	moduleCache = NewModuleCache(VMConfig{TrustedKeys: keys}, importer, MODULE_CACHE_ENTRIES, MODULE_CACHE_SIZE)
+}
+
 // ParamList define param array
 type ParamList struct {
 	Params []ParamInfo
@@ -245,18 +262,19 @@ func NewWASM1(ctx *contract.Context) *VM {
 	codeVersion = binary.LittleEndian.Uint32(accountObj.CodeVersion.Bytes())
 	wasmCode = accountObj.ContractCode
 
-	module, err := wasm.ReadModule(bytes.NewBuffer(wasmCode), importer)
+	compiled, err := moduleCache.Load(wasmCode)
 	if err != nil {
 		log.Infof("*ERROR* Failed to parse the wasm module !!! " + err.Error())
 		return nil
 	}
+	module := compiled.Wasm()
 	fmt.Println("module.Export: ",module.Export)
 	if module.Export == nil {
 		log.Infof("*ERROR* Failed to find export method from wasm module !!!")
 		return nil
 	}
 
-	vm, err := NewVM(module)
+	vm, err := NewVMFromModule(compiled)
 	if err != nil {
 		return nil
 	}
@@ -311,18 +329,18 @@ func NewWASM ( ctx *contract.Context ) *VM {
 		}
 	}
 
-	module, err := wasm.ReadModule(bytes.NewBuffer(wasm_code), importer)
+	compiled, err := moduleCache.Load(wasm_code)
 	if err != nil {
 		log.Infof("*ERROR* Failed to parse the wasm module !!! " + err.Error())
 		return nil
 	}
 
-	if module.Export == nil  {
+	if compiled.Wasm().Export == nil  {
 		log.Infof("*ERROR* Failed to find export method from wasm module !!!")
 		return nil
 	}
 
-	vm , err := NewVM(module)
+	vm , err := NewVMFromModule(compiled)
 	if err != nil {
 		return nil
 	}
@@ -394,6 +412,7 @@ func (engine *wasmEngine) Process(ctx *contract.Context, depth uint8, executionT
 
 		//if code's version in local memory is differsnt with the code's version , delete old one and update it
 		if vm.codeVersion != ctx.Trx.Version {
+			vm.Close()
 			delete(engine.vmMap , ctx.Trx.Contract)
 			vm = NewWASM(ctx)
 			if vm == nil {
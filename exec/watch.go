@@ -0,0 +1,322 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import (
+	"bytes"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// Watchpoint is a range of a linear memory whose accesses are reported to
+// the WatchFunc of a VM, see AddWatchpoint.
+type Watchpoint struct {
+	Memory uint32 // The index of the memory
+	Addr   uint64
+	Size   uint64
+	Read   bool // Whether the reads of the range are reported
+	Write  bool // Whether the writes of the range are reported
+}
+
+// overlaps returns whether w watches the access a.
+func (w Watchpoint) overlaps(a MemoryAccess) bool {
+	if w.Memory != a.Memory || !(w.Read && a.Read || w.Write && a.Write) {
+		return false
+	}
+	return a.Addr < w.Addr+w.Size && w.Addr < a.Addr+a.Size
+}
+
+// MemoryAccess is an access of an instruction to a linear memory. The
+// access of an instruction both reading and writing, like the atomic
+// read-modify-write operators, is both a read and a write.
+type MemoryAccess struct {
+	Func   int64 // The index of the function of the instruction
+	Offset int64 // The offset of the instruction in the module, like the Offset of a disasm.Instruction
+	Memory uint32
+	Addr   uint64
+	Size   uint64
+	Read   bool
+	Write  bool
+}
+
+// WatchFunc is called before an instruction accesses a range watched by
+// w. It runs on the goroutine of the call, and may inspect it like a
+// debug hook, see SetDebugHook. An access out of the bounds of the memory
+// is reported before the instruction traps.
+type WatchFunc func(w Watchpoint, access MemoryAccess)
+
+// SetWatchFunc sets the function the accesses to the watchpoints of vm are
+// reported to. Nil removes it.
+//
+// The accesses are checked before each instruction, like for
+// SetDebugHook: functions compiled to native code are interpreted while
+// vm has a WatchFunc and watchpoints, and the accesses of the
+// instructions inlined into a function aren't reported.
+func (vm *VM) SetWatchFunc(watch WatchFunc) {
+	vm.watchFunc = watch
+	vm.setHooked()
+}
+
+// AddWatchpoint adds w to the watchpoints of vm.
+func (vm *VM) AddWatchpoint(w Watchpoint) {
+	vm.watchpoints = append(vm.watchpoints, w)
+	vm.setHooked()
+}
+
+// RemoveWatchpoint removes w from the watchpoints of vm.
+func (vm *VM) RemoveWatchpoint(w Watchpoint) {
+	for i, watched := range vm.watchpoints {
+		if watched == w {
+			vm.watchpoints = append(vm.watchpoints[:i], vm.watchpoints[i+1:]...)
+			break
+		}
+	}
+	vm.setHooked()
+}
+
+// AuditFunc is called before an instruction accesses an audited range of
+// a VM, see SetMemoryAudit, with the bytes of the memory it reads or
+// overwrites, clipped to the bounds of the memory. data is only valid
+// during the call, and must not be modified.
+type AuditFunc func(access MemoryAccess, data []byte)
+
+// memoryAudit is the audit of the memory accesses of a VM.
+type memoryAudit struct {
+	audit  AuditFunc
+	ranges []Watchpoint
+}
+
+// SetMemoryAudit sets the function the accesses of vm to the given ranges
+// of its memories are reported to, for instance to track the bytes
+// derived from the input of a transaction, or to check that a module
+// doesn't write to the ranges it mustn't. Only the reads or the writes of
+// a range are reported, unless it sets both, and an access is reported
+// once, whatever the number of ranges it touches. The ranges are audited
+// independently of the watchpoints, like them before each instruction,
+// see SetWatchFunc. A nil audit removes it.
+func (vm *VM) SetMemoryAudit(audit AuditFunc, ranges ...Watchpoint) {
+	vm.audit = nil
+	if audit != nil {
+		vm.audit = &memoryAudit{audit: audit, ranges: append([]Watchpoint(nil), ranges...)}
+	}
+	vm.setHooked()
+}
+
+// checkWatchpoints reports the accesses of the instruction of code, at
+// offset in the module, to the watchpoints and audited ranges they touch,
+// traps the writes to the read-only ranges, and checks their alignment.
+func (vm *VM) checkWatchpoints(offset int64, code []byte) {
+	accesses, align := vm.memoryAccesses(code)
+	for _, access := range accesses {
+		access.Func, access.Offset = vm.ctx.curFunc, offset
+		if vm.watchFunc != nil {
+			for _, w := range vm.watchpoints {
+				if w.overlaps(access) {
+					vm.watchFunc(w, access)
+				}
+			}
+		}
+		if vm.audit != nil {
+			vm.audit.check(vm, access)
+		}
+		if access.Write {
+			vm.checkReadOnly(access)
+		}
+		if vm.alignCheck != AlignCheckOff {
+			vm.checkAlign(access, align)
+		}
+	}
+}
+
+// check reports access to the audit if it touches one of its ranges.
+func (a *memoryAudit) check(vm *VM, access MemoryAccess) {
+	for _, r := range a.ranges {
+		if r.overlaps(access) {
+			mem, _ := vm.memoryAt(access.Memory)
+			var data []byte
+			if access.Addr < uint64(len(mem)) {
+				end := uint64(len(mem))
+				if access.Size < end-access.Addr {
+					end = access.Addr + access.Size
+				}
+				data = mem[access.Addr:end:end]
+			}
+			a.audit(access, data)
+			return
+		}
+	}
+}
+
+// memoryAccesses returns the accesses to the linear memories of the next
+// instruction of the current context, whose encoding starts code, from
+// its immediates and operands, and the alignment its hint promises them,
+// in bytes, or 1 if it has none.
+func (vm *VM) memoryAccesses(code []byte) ([]MemoryAccess, uint64) {
+	if len(code) == 0 {
+		return nil, 1
+	}
+	var op ops.Op
+	var err error
+	r := bytes.NewReader(code[1:])
+	switch code[0] {
+	case ops.PrefixMisc, ops.PrefixSIMD, ops.PrefixAtomic:
+		var sub uint32
+		if sub, err = leb128.ReadVarUint32(r); err == nil {
+			op, err = ops.NewPrefixed(code[0], sub)
+		}
+	default:
+		op, err = ops.New(code[0])
+	}
+	if err != nil {
+		return nil, 1
+	}
+
+	if op.Code == ops.PrefixMisc {
+		return vm.bulkAccesses(op.Sub, r), 1
+	}
+	size, read, write := accessKind(op)
+	if size == 0 {
+		return nil, 1
+	}
+	// the memory immediate, see disasm.readMemArg
+	var memory uint32
+	align, err := leb128.ReadVarUint32(r)
+	if err == nil && align&0x40 != 0 {
+		memory, err = leb128.ReadVarUint32(r)
+	}
+	var offset uint64
+	if err == nil {
+		offset, err = leb128.ReadVarUint64(r)
+	}
+	if err != nil {
+		return nil, 1
+	}
+	// the address is the deepest operand
+	addr := vm.addressOperand(memory, len(vm.ctx.stack)-disasm.Slots(op.Args...))
+	// the atomic operators trap on their own when unaligned
+	hint := uint64(1) << (align &^ 0x40 & 63)
+	if op.Code == ops.PrefixAtomic {
+		hint = 1
+	}
+	return []MemoryAccess{{Memory: memory, Addr: addr + offset, Size: size, Read: read, Write: write}}, hint
+}
+
+// bulkAccesses returns the accesses of the bulk memory operator with the
+// given sub-opcode, whose immediates r reads.
+func (vm *VM) bulkAccesses(sub uint32, r *bytes.Reader) []MemoryAccess {
+	top := len(vm.ctx.stack)
+	immediate := func() uint32 {
+		v, _ := leb128.ReadVarUint32(r)
+		return v
+	}
+	switch sub {
+	case ops.MemoryInit:
+		immediate() // the data segment
+		memory := immediate()
+		return []MemoryAccess{{Memory: memory, Addr: vm.addressOperand(memory, top-3),
+			Size: uint64(uint32(vm.ctx.stack[top-1])), Write: true}}
+	case ops.MemoryCopy:
+		dst, src := immediate(), immediate()
+		n := vm.ctx.stack[top-1]
+		if !vm.memoryIs64(dst) || !vm.memoryIs64(src) {
+			n = uint64(uint32(n))
+		}
+		return []MemoryAccess{
+			{Memory: src, Addr: vm.addressOperand(src, top-2), Size: n, Read: true},
+			{Memory: dst, Addr: vm.addressOperand(dst, top-3), Size: n, Write: true},
+		}
+	case ops.MemoryFill:
+		memory := immediate()
+		return []MemoryAccess{{Memory: memory, Addr: vm.addressOperand(memory, top-3),
+			Size: vm.addressOperand(memory, top-1), Write: true}}
+	}
+	return nil
+}
+
+// addressOperand returns the operand of the current context at the given
+// index in its stack as an address of the memory with the given index.
+func (vm *VM) addressOperand(memory uint32, i int) uint64 {
+	if i < 0 || i >= len(vm.ctx.stack) {
+		return 0
+	}
+	if vm.memoryIs64(memory) {
+		return vm.ctx.stack[i]
+	}
+	return uint64(uint32(vm.ctx.stack[i]))
+}
+
+// memoryIs64 returns whether the memory with the given index is a 64-bit
+// memory.
+func (vm *VM) memoryIs64(index uint32) bool {
+	memories := vm.module.Memories()
+	return int(index) < len(memories) && memories[index].Limits.Memory64()
+}
+
+// accessSizes are the sizes of the accesses of the loads and stores from
+// i32.load to i64.store32, and of the atomic operators from
+// i32.atomic.load, repeating every 7 operators.
+var (
+	accessSizes       = [...]uint64{4, 8, 4, 8, 1, 1, 2, 2, 1, 1, 2, 2, 4, 4, 4, 8, 4, 8, 1, 2, 1, 2, 4}
+	atomicAccessSizes = [...]uint64{4, 8, 1, 2, 1, 2, 4}
+)
+
+// accessKind returns the size of the access to the memory of op, and
+// whether it reads or writes it, or a zero size if op has no memory
+// immediate.
+func accessKind(op ops.Op) (size uint64, read, write bool) {
+	switch op.Code {
+	case ops.PrefixSIMD:
+		switch {
+		case op.Sub == ops.V128Load || op.Sub == ops.V128Store:
+			size = 16
+		case op.Sub < ops.V128Load8Splat:
+			size = 8 // the extending loads
+		case op.Sub <= ops.V128Load64Splat:
+			size = 1 << (op.Sub - ops.V128Load8Splat)
+		case op.Sub >= ops.V128Load8Lane && op.Sub <= ops.V128Store64Lane:
+			size = 1 << ((op.Sub - ops.V128Load8Lane) % 4)
+		case op.Sub == ops.V128Load32Zero:
+			size = 4
+		case op.Sub == ops.V128Load64Zero:
+			size = 8
+		default:
+			return 0, false, false
+		}
+		write = op.Sub == ops.V128Store || op.Sub >= ops.V128Store8Lane && op.Sub <= ops.V128Store64Lane
+		return size, !write, write
+	case ops.PrefixAtomic:
+		switch {
+		case op.Sub == ops.MemoryAtomicNotify || op.Sub == ops.MemoryAtomicWait32:
+			return 4, true, false
+		case op.Sub == ops.MemoryAtomicWait64:
+			return 8, true, false
+		case op.Sub >= ops.I32AtomicLoad && op.Sub <= ops.I64AtomicRmw32CmpxchgU:
+			size = atomicAccessSizes[(op.Sub-ops.I32AtomicLoad)%7]
+			read = op.Sub < ops.I32AtomicStore || op.Sub > ops.I64AtomicStore32
+			return size, read, op.Sub >= ops.I32AtomicStore
+		}
+		return 0, false, false
+	}
+	if op.Code >= ops.I32Load && op.Code <= ops.I64Store32 {
+		store := op.Code >= ops.I32Store
+		return accessSizes[op.Code-ops.I32Load], !store, store
+	}
+	return 0, false, false
+}
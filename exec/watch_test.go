@@ -0,0 +1,151 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+import "testing"
+
+func TestWatchpoints(t *testing.T) {
+	module := readTestModule(t, "testdata/dwarf.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+
+	load := int64(module.Export.Entries["load"].Index)
+	fill := int64(module.Export.Entries["fill"].Index)
+	loadInstrs, err := compiled.Disassemble(int(load))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fillInstrs, err := compiled.Disassemble(int(fill))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var accesses []MemoryAccess
+	vm.SetWatchFunc(func(w Watchpoint, access MemoryAccess) {
+		accesses = append(accesses, access)
+	})
+	reads := Watchpoint{Addr: 100, Size: 4, Read: true}
+	writes := Watchpoint{Addr: 100, Size: 4, Write: true}
+	vm.AddWatchpoint(reads)
+	vm.AddWatchpoint(writes)
+
+	for _, tc := range []struct {
+		fn   int64
+		args []uint64
+		want []MemoryAccess
+	}{
+		{load, []uint64{98}, []MemoryAccess{{Func: load, Offset: loadInstrs[1].Offset, Addr: 98, Size: 4, Read: true}}},
+		{load, []uint64{104}, nil},
+		{load, []uint64{96}, nil},
+		{fill, []uint64{103, 8}, []MemoryAccess{{Func: fill, Offset: fillInstrs[3].Offset, Addr: 103, Size: 8, Write: true}}},
+		{fill, []uint64{90, 10}, nil},
+	} {
+		accesses = nil
+		if _, err := vm.ExecCode(tc.fn, tc.args...); err != nil {
+			t.Fatal(err)
+		}
+		if len(accesses) != len(tc.want) {
+			t.Errorf("%d%v: got=%+v, want=%+v", tc.fn, tc.args, accesses, tc.want)
+			continue
+		}
+		for i, access := range accesses {
+			if access != tc.want[i] {
+				t.Errorf("%d%v: got=%+v, want=%+v", tc.fn, tc.args, access, tc.want[i])
+			}
+		}
+	}
+
+	vm.RemoveWatchpoint(reads)
+	accesses = nil
+	if _, err := vm.ExecCode(load, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(accesses) != 0 {
+		t.Errorf("unexpected accesses: %+v", accesses)
+	}
+}
+
+func TestMemoryAudit(t *testing.T) {
+	module := readTestModule(t, "testdata/dwarf.wasm")
+	compiled, err := CompileModule(module, VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := compiled.Instantiate(NewEnvFunc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	vm := inst.NewVM()
+
+	load := int64(module.Export.Entries["load"].Index)
+	fill := int64(module.Export.Entries["fill"].Index)
+	copy(vm.Memory()[100:], "\x01\x02\x03\x04")
+
+	// the audit runs along with the watch function, and reports an access
+	// touching both ranges once
+	var accesses []MemoryAccess
+	var data [][]byte
+	vm.SetMemoryAudit(func(access MemoryAccess, d []byte) {
+		accesses = append(accesses, access)
+		data = append(data, append([]byte(nil), d...))
+	}, Watchpoint{Addr: 100, Size: 2, Read: true, Write: true}, Watchpoint{Addr: 102, Size: 2, Read: true})
+	watched := 0
+	vm.SetWatchFunc(func(w Watchpoint, access MemoryAccess) { watched++ })
+	vm.AddWatchpoint(Watchpoint{Addr: 100, Size: 4, Read: true})
+
+	if _, err := vm.ExecCode(load, 101); err != nil {
+		t.Fatal(err)
+	}
+	if len(accesses) != 1 || accesses[0].Addr != 101 || !accesses[0].Read || string(data[0]) != "\x02\x03\x04\x00" || watched != 1 {
+		t.Errorf("unexpected load accesses: %+v %q, watched %d times", accesses, data, watched)
+	}
+
+	// the writes of the second range aren't audited, and the overwritten
+	// bytes are reported
+	accesses, data = nil, nil
+	if _, err := vm.ExecCode(fill, 102, 4); err != nil {
+		t.Fatal(err)
+	}
+	if len(accesses) != 0 {
+		t.Errorf("unexpected fill accesses: %+v", accesses)
+	}
+	if _, err := vm.ExecCode(fill, 98, 4); err != nil {
+		t.Fatal(err)
+	}
+	if len(accesses) != 1 || !accesses[0].Write || string(data[0]) != "\x00\x00\x01\x02" {
+		t.Errorf("unexpected fill accesses: %+v %q", accesses, data)
+	}
+
+	vm.SetMemoryAudit(nil)
+	accesses = nil
+	if _, err := vm.ExecCode(load, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(accesses) != 0 {
+		t.Errorf("unexpected accesses: %+v", accesses)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package exec
+
+// The writes to the memories of an instance are tracked by pages once a
+// StateHasher or a Recorder asks for it, for them to only look at the
+// pages written since they last did rather than at the whole memories.
+// Every page holds the epoch of its last write, and every write is of the
+// current epoch of the instance: a page was written since an epoch
+// returned by writeMark if its own epoch is greater. The pages a memory
+// grows to are of epoch 0, since they are zeros.
+//
+// The instructions storing to the memories, the accessors of Memory and
+// the host functions of the package record their writes. The slices of
+// the memory handed out to the host functions, by (*VM).GetMemory,
+// (*Instance).Memory or (Memory).UnsafeView, count as written, and so do
+// the memories restored as a whole. The pages of a memory shared with
+// other instances are always considered written, since their writes
+// aren't seen by inst. While writes are tracked, the functions compiled
+// to native code are interpreted, since native code doesn't record them.
+
+// writePageShift is the base 2 logarithm of the size of the pages whose
+// writes are tracked.
+const writePageShift = 12
+
+// trackWrites starts tracking the writes to the memories of inst, all of
+// their pages counting as written at first.
+func (inst *Instance) trackWrites() {
+	if inst.written != nil {
+		return
+	}
+	inst.writeEpoch++
+	inst.written = stampPages([]uint64{}, 0, uint64(len(inst.memory)), inst.writeEpoch)
+	for i := range inst.memories {
+		mem := &inst.memories[i]
+		mem.written = stampPages([]uint64{}, 0, uint64(len(mem.memory)), inst.writeEpoch)
+	}
+}
+
+// writeMark returns the current epoch of the writes, the following ones
+// being of a greater epoch.
+func (inst *Instance) writeMark() uint64 {
+	mark := inst.writeEpoch
+	inst.writeEpoch++
+	return mark
+}
+
+// wrote records a write of n bytes at offset to the memory in use, see
+// swapMemory.
+func (inst *Instance) wrote(offset, n uint64) {
+	if inst.written != nil {
+		inst.written = stampPages(inst.written, offset, offset+n, inst.writeEpoch)
+	}
+}
+
+// wroteAt records a write of n bytes at offset to the memory at index,
+// none being swapped in.
+func (inst *Instance) wroteAt(index uint32, offset, n uint64) {
+	if index == 0 {
+		inst.wrote(offset, n)
+		return
+	}
+	if mem := &inst.memories[index-1]; mem.written != nil {
+		mem.written = stampPages(mem.written, offset, offset+n, inst.writeEpoch)
+	}
+}
+
+// wroteAll records a write to every memory of inst as a whole.
+func (inst *Instance) wroteAll() {
+	if inst.written == nil {
+		return
+	}
+	inst.written = stampPages(inst.written[:0], 0, uint64(len(inst.memory)), inst.writeEpoch)
+	for i := range inst.memories {
+		mem := &inst.memories[i]
+		mem.written = stampPages(mem.written[:0], 0, uint64(len(mem.memory)), inst.writeEpoch)
+	}
+}
+
+// writtenPages returns the epochs of the pages of the memory at index, or
+// nil if every page must be considered written.
+func (inst *Instance) writtenPages(index uint32) []uint64 {
+	if index == 0 {
+		if inst.shared != nil {
+			return nil
+		}
+		return inst.written
+	}
+	return inst.memories[index-1].written
+}
+
+// writtenSince reports whether any of the bytes from start to end of a
+// memory whose pages have the given epochs was written since mark. The
+// pages past the epochs, which the memory grew to without them being
+// tracked, count as written.
+func writtenSince(written []uint64, start, end int, mark uint64) bool {
+	if written == nil || start == end {
+		return written == nil
+	}
+	for page := start >> writePageShift; page <= (end-1)>>writePageShift; page++ {
+		if page >= len(written) || written[page] > mark {
+			return true
+		}
+	}
+	return false
+}
+
+// writtenRanges appends to ranges the ranges of the bytes of a memory of
+// size bytes whose pages have the given epochs which were written since
+// mark, by whole pages, and returns them.
+func writtenRanges(ranges [][2]int, written []uint64, size int, mark uint64) [][2]int {
+	pageSize := 1 << writePageShift
+	for start := 0; start < size; start += pageSize {
+		end := start + pageSize
+		if end > size {
+			end = size
+		}
+		if !writtenSince(written, start, end, mark) {
+			continue
+		}
+		if n := len(ranges); n != 0 && ranges[n-1][1] == start {
+			ranges[n-1][1] = end
+		} else {
+			ranges = append(ranges, [2]int{start, end})
+		}
+	}
+	return ranges
+}
+
+// extendPages appends the pages of epoch 0 missing up to size to the
+// epochs of the pages of a memory which grew, and returns them.
+func extendPages(written []uint64, size uint64) []uint64 {
+	for uint64(len(written))<<writePageShift < size {
+		written = append(written, 0)
+	}
+	return written
+}
+
+// stampPages sets the epoch of the pages holding the bytes from start to
+// end to epoch, and returns the epochs. The pages missing up to end are
+// appended, with epoch as well: they weren't tracked.
+func stampPages(written []uint64, start, end, epoch uint64) []uint64 {
+	if start == end {
+		return written
+	}
+	last := (end - 1) >> writePageShift
+	for uint64(len(written)) <= last {
+		written = append(written, epoch)
+	}
+	for page := start >> writePageShift; page <= last; page++ {
+		written[page] = epoch
+	}
+	return written
+}
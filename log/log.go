@@ -0,0 +1,221 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package log routes the log messages of the packages of the VM to a
+// Logger chosen by the embedder: the default one, see SetDefault, or the
+// one of a VM, see exec.VMConfig.Logger. The messages go to the default
+// logger of log/slog unless SetDefault is called.
+//
+//	log.SetDefault(log.NewSlog(slog.New(handler)))
+//	log.SetDefault(log.Discard)
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+const (
+	LevelTrace Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelCritical
+)
+
+var levelNames = [...]string{"trace", "debug", "info", "warn", "error", "critical"}
+
+func (l Level) String() string {
+	if l < 0 || int(l) >= len(levelNames) {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// Logger receives log messages. Its methods may be called from several
+// goroutines at once.
+type Logger interface {
+	// Enabled returns whether the messages of the given level are logged,
+	// for them not to be formatted otherwise.
+	Enabled(level Level) bool
+	// Log logs msg at the given level.
+	Log(level Level, msg string)
+}
+
+// Discard is a Logger ignoring the messages.
+var Discard Logger = discard{}
+
+type discard struct{}
+
+func (discard) Enabled(level Level) bool    { return false }
+func (discard) Log(level Level, msg string) {}
+
+// slogLogger is a Logger writing to a slog.Logger, or to the default one
+// of log/slog if nil.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlog returns a Logger writing the messages to l, or to the default
+// logger of log/slog at the time they are logged if l is nil. The trace
+// and critical messages are logged 4 levels below slog.LevelDebug and
+// above slog.LevelError.
+func NewSlog(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+var slogLevels = [...]slog.Level{
+	LevelTrace:    slog.LevelDebug - 4,
+	LevelDebug:    slog.LevelDebug,
+	LevelInfo:     slog.LevelInfo,
+	LevelWarn:     slog.LevelWarn,
+	LevelError:    slog.LevelError,
+	LevelCritical: slog.LevelError + 4,
+}
+
+func (s slogLogger) logger() *slog.Logger {
+	if s.l == nil {
+		return slog.Default()
+	}
+	return s.l
+}
+
+func (s slogLogger) Enabled(level Level) bool {
+	return s.logger().Enabled(context.Background(), slogLevel(level))
+}
+
+func (s slogLogger) Log(level Level, msg string) {
+	s.logger().Log(context.Background(), slogLevel(level), msg)
+}
+
+func slogLevel(level Level) slog.Level {
+	if level < 0 || int(level) >= len(slogLevels) {
+		return slog.LevelInfo
+	}
+	return slogLevels[level]
+}
+
+// loggerBox holds the default logger, an atomic.Value storing values of a
+// single concrete type.
+type loggerBox struct {
+	l Logger
+}
+
+var defaultLogger atomic.Value
+
+func init() {
+	defaultLogger.Store(loggerBox{NewSlog(nil)})
+}
+
+// SetDefault sets the logger of the packages of the VM, and of the VMs
+// without their own logger. Nil discards the messages.
+func SetDefault(l Logger) {
+	if l == nil {
+		l = Discard
+	}
+	defaultLogger.Store(loggerBox{l})
+}
+
+// Default returns the logger set by SetDefault.
+func Default() Logger {
+	return defaultLogger.Load().(loggerBox).l
+}
+
+// Printer formats the messages of a Logger, like the functions of the
+// package do for the default logger.
+type Printer struct {
+	l Logger
+}
+
+// Of returns the Printer of l, or of the default logger if l is nil.
+func Of(l Logger) Printer {
+	return Printer{l}
+}
+
+func (p Printer) logger() Logger {
+	if p.l == nil {
+		return Default()
+	}
+	return p.l
+}
+
+// print logs the operands formatted like fmt.Sprint does, at level.
+func (p Printer) print(level Level, v []interface{}) {
+	if l := p.logger(); l.Enabled(level) {
+		l.Log(level, fmt.Sprint(v...))
+	}
+}
+
+// printf logs the arguments formatted like fmt.Sprintf does, at level.
+func (p Printer) printf(level Level, format string, v []interface{}) {
+	if l := p.logger(); l.Enabled(level) {
+		l.Log(level, fmt.Sprintf(format, v...))
+	}
+}
+
+func (p Printer) Trace(v ...interface{})                 { p.print(LevelTrace, v) }
+func (p Printer) Tracef(format string, v ...interface{}) { p.printf(LevelTrace, format, v) }
+func (p Printer) Debugf(format string, v ...interface{}) { p.printf(LevelDebug, format, v) }
+func (p Printer) Info(v ...interface{})                  { p.print(LevelInfo, v) }
+func (p Printer) Infof(format string, v ...interface{})  { p.printf(LevelInfo, format, v) }
+
+// logError logs the message of err at level, and returns err.
+func (p Printer) logError(level Level, err error) error {
+	if l := p.logger(); l.Enabled(level) {
+		l.Log(level, err.Error())
+	}
+	return err
+}
+
+// Warnf, Errorf and Critical return the message as an error too, whether
+// it is logged or not.
+func (p Printer) Warnf(format string, v ...interface{}) error {
+	err := fmt.Errorf(format, v...)
+	return p.logError(LevelWarn, err)
+}
+
+func (p Printer) Errorf(format string, v ...interface{}) error {
+	err := fmt.Errorf(format, v...)
+	return p.logError(LevelError, err)
+}
+
+func (p Printer) Critical(v ...interface{}) error {
+	err := errors.New(fmt.Sprint(v...))
+	return p.logError(LevelCritical, err)
+}
+
+// Trace logs the operands to the default logger, formatted like fmt.Sprint
+// does, and the functions below do the same at their level.
+func Trace(v ...interface{}) { Of(nil).Trace(v...) }
+
+// Tracef logs the arguments to the default logger, formatted like
+// fmt.Sprintf does, and the functions below do the same at their level.
+func Tracef(format string, v ...interface{}) { Of(nil).Tracef(format, v...) }
+
+func Debugf(format string, v ...interface{})       { Of(nil).Debugf(format, v...) }
+func Info(v ...interface{})                        { Of(nil).Info(v...) }
+func Infof(format string, v ...interface{})        { Of(nil).Infof(format, v...) }
+func Warnf(format string, v ...interface{}) error  { return Of(nil).Warnf(format, v...) }
+func Errorf(format string, v ...interface{}) error { return Of(nil).Errorf(format, v...) }
+func Critical(v ...interface{}) error              { return Of(nil).Critical(v...) }
@@ -0,0 +1,71 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package log
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	p := Of(NewSlog(logger))
+	p.Tracef("loaded %d sections", 3)
+	p.Infof("loaded %d functions", 4)
+	if err := p.Errorf("bad opcode %#x", 0xff); err == nil || err.Error() != "bad opcode 0xff" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	p.Critical("out of ", "memory")
+
+	out := buf.String()
+	if strings.Contains(out, "sections") {
+		t.Errorf("trace message logged at the info level:\n%s", out)
+	}
+	for _, want := range []string{
+		`level=INFO msg="loaded 4 functions"`,
+		`level=ERROR msg="bad opcode 0xff"`,
+		`level=ERROR+4 msg="out of memory"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	defer SetDefault(Default())
+
+	var buf bytes.Buffer
+	SetDefault(NewSlog(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug - 4}))))
+	Trace("section ", 1)
+	if !strings.Contains(buf.String(), `level=DEBUG-4 msg="section 1"`) {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	buf.Reset()
+	SetDefault(nil)
+	if Default() != Discard {
+		t.Errorf("nil didn't set the Discard logger")
+	}
+	if err := Warnf("dropped %s", "table"); err == nil || buf.Len() != 0 {
+		t.Errorf("unexpected error %v or output %q", err, buf.String())
+	}
+}
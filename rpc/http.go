@@ -0,0 +1,172 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+)
+
+// maxHTTPPayload is the size limit of the body of an HTTP call.
+const maxHTTPPayload = 1 << 20
+
+// httpCall is the body of an HTTP call: the payload of exec.CallJSON and
+// the fields of a CallRequest.
+type httpCall struct {
+	Method      string            `json:"method"`
+	Args        []json.RawMessage `json:"args"`
+	GasLimit    uint64            `json:"gas_limit"`
+	TimeoutMs   uint64            `json:"timeout_ms"`
+	Caller      string            `json:"caller"`
+	Value       uint64            `json:"value"`
+	BlockHeight uint64            `json:"block_height"`
+}
+
+type httpResponse struct {
+	Result  json.RawMessage `json:"result,omitempty"`
+	Trap    string          `json:"trap,omitempty"`
+	GasUsed uint64          `json:"gas_used"`
+	Events  []httpEvent     `json:"events"`
+}
+
+type httpEvent struct {
+	Topic string          `json:"topic"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// HTTPHandler returns the HTTP endpoint of s, calling the methods of the
+// ABIs embedded in the loaded modules (see exec.EmbedABI) with JSON
+// arguments, for the local tests of contracts and the web playgrounds.
+// A request
+//
+//	POST /call/token
+//	{"method": "transfer", "args": ["bob", 10], "gas_limit": 100000, "caller": "alice"}
+//
+// calls the method of a new instance of the module token, the optional
+// fields being the ones of a CallRequest, and its response is
+//
+//	{"result": true, "gas_used": 5120, "events": [{"topic": "transfer", "data": ...}]}
+//
+// with the trap of the call instead of its result if it trapped. The data
+// of an event is a JSON document if it is one, and a string otherwise.
+// The requests which can't be run are answered with an HTTP error.
+func (s *Server) HTTPHandler() http.Handler {
+	return http.HandlerFunc(s.serveHTTP)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == http.MethodOptions {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST, OPTIONS")
+		httpError(w, http.StatusMethodNotAllowed, "the calls are POST requests")
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/call/")
+	if name == r.URL.Path || name == "" {
+		httpError(w, http.StatusNotFound, "the calls are posted to /call/{module}")
+		return
+	}
+	s.mu.Lock()
+	m, ok := s.modules[name]
+	s.mu.Unlock()
+	if !ok {
+		httpError(w, http.StatusNotFound, fmt.Sprintf("no module %q", name))
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPPayload))
+	if err != nil {
+		httpError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	var call httpCall
+	if err := json.Unmarshal(payload, &call); err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	inst, err := instantiate(m.compiled, s.config.Imports)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer inst.Close()
+
+	req := &CallRequest{
+		Export:      call.Method,
+		GasLimit:    call.GasLimit,
+		TimeoutMs:   call.TimeoutMs,
+		Caller:      call.Caller,
+		Value:       call.Value,
+		BlockHeight: call.BlockHeight,
+	}
+	vm := s.newVM(inst, s.config.Store, name, req)
+	ctx, cancel := s.withTimeout(r.Context(), req)
+	defer cancel()
+
+	res := httpResponse{Events: []httpEvent{}}
+	result, err := callJSON(ctx, vm, payload)
+	var trap exec.Trap
+	switch {
+	case err == nil:
+		var doc struct {
+			Result json.RawMessage `json:"result"`
+		}
+		json.Unmarshal(result, &doc)
+		res.Result = doc.Result
+	case errors.As(err, &trap):
+		res.Trap = err.Error()
+	default:
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	res.GasUsed = vm.GasUsed()
+	for _, e := range vm.Events() {
+		data := json.RawMessage(e.Data)
+		if !json.Valid(data) {
+			data, _ = json.Marshal(string(e.Data))
+		}
+		res.Events = append(res.Events, httpEvent{Topic: e.Topic, Data: data})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// callJSON calls the method of the JSON payload on vm until ctx is done,
+// returning its trap as an error.
+func callJSON(ctx context.Context, vm *exec.VM, payload []byte) (res []byte, err error) {
+	defer exec.RecoverTrap(&err)
+	return vm.CallJSONContext(ctx, nil, payload)
+}
+
+func httpError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{msg})
+}
@@ -0,0 +1,88 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wat"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	code, err := wat.Assemble([]byte(counter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	abi, err := exec.ParseJSONABI([]byte(`{"methods": [
+		{"name": "inc", "params": [{"name": "n", "type": "u64"}], "result": "u64"},
+		{"name": "spin"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, err = exec.EmbedABI(code, abi); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(Config{})
+	if _, err := s.LoadModule(context.Background(), &LoadModuleRequest{Name: "counter", Code: code}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s.HTTPHandler())
+	defer server.Close()
+
+	for _, tc := range []struct {
+		path, body string
+		status     int
+		response   string
+	}{
+		// every call runs on a new instance
+		{"/call/counter", `{"method": "inc", "args": [2], "gas_limit": 1000}`, http.StatusOK, `{"result":2,"gas_used":`},
+		{"/call/counter", `{"method": "inc", "args": [3]}`, http.StatusOK, `{"result":3,"gas_used":0,"events":[]}`},
+		{"/call/counter", `{"method": "spin", "args": [], "timeout_ms": 20}`, http.StatusOK, `{"trap":"exec: interrupted: context deadline exceeded"`},
+		{"/call/counter", `{"method": "inc", "args": ["two"]}`, http.StatusBadRequest, `{"error":"exec: json call: inc: invalid argument 0"}`},
+		{"/call/counter", `{"method": "dec", "args": []}`, http.StatusBadRequest, `{"error":`},
+		{"/call/counter", `{`, http.StatusBadRequest, `{"error":`},
+		{"/call/token", `{"method": "inc", "args": [1]}`, http.StatusNotFound, `{"error":"no module \"token\""}`},
+		{"/counter", `{"method": "inc", "args": [1]}`, http.StatusNotFound, `{"error":`},
+	} {
+		res, err := http.Post(server.URL+tc.path, "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body json.RawMessage
+		json.NewDecoder(res.Body).Decode(&body)
+		res.Body.Close()
+		if res.StatusCode != tc.status || !strings.HasPrefix(string(body), tc.response) {
+			t.Errorf("%s %s: got=%d %s, want=%d %s...", tc.path, tc.body, res.StatusCode, body, tc.status, tc.response)
+		}
+	}
+
+	res, err := http.Get(server.URL + "/call/counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET returned %d", res.StatusCode)
+	}
+}
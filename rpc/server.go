@@ -0,0 +1,346 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+// Package rpc is the gRPC service of the VM, see wasmvm.proto, for the
+// processes which run modules without linking the VM, like indexers and
+// simulation services. The clients load modules, instantiate them and
+// call the exports of the instances, every call being limited in gas and
+// time. The Go clients use NewVMClient, and the servers are created by
+// NewServer and registered with RegisterVMServer:
+//
+//	server := grpc.NewServer()
+//	rpc.RegisterVMServer(server, rpc.NewServer(rpc.Config{MaxGas: 1 << 30, MaxTimeout: time.Second}))
+//	server.Serve(listener)
+//
+// The server also has an HTTP endpoint calling the methods of the ABIs
+// embedded in its modules with JSON arguments, see HTTPHandler.
+//
+// The files wasmvm.pb.go and wasmvm_grpc.pb.go are generated from
+// wasmvm.proto by protoc-gen-go and protoc-gen-go-grpc.
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bottos-project/bottos/common/types"
+	"github.com/bottos-project/bottos/contract"
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrReadOnly is the error of the writes to the storage of a query.
+var ErrReadOnly = errors.New("rpc: the storage is read-only in a query")
+
+// Config configures a Server.
+type Config struct {
+	// VM is the config the modules are compiled with. Its
+	// MaxExecutionTime limits the start functions.
+	VM exec.VMConfig
+	// Imports are the host functions of the instances, the default env
+	// functions if nil.
+	Imports *exec.EnvFunc
+	// Store is the storage of the contracts of the instances, which have
+	// none if nil.
+	Store exec.StateStore
+	// Schedule is the gas schedule of the calls, the default one if nil.
+	Schedule *exec.GasSchedule
+	// MaxGas and MaxTimeout, if not zero, are the gas and the time a call
+	// may use, which a request may lower. The calls are unmetered if both
+	// MaxGas and the gas limit of the request are zero, and likewise
+	// unbounded in time.
+	MaxGas     uint64
+	MaxTimeout time.Duration
+}
+
+// Server is the VMServer running the modules of its clients. The calls of
+// an instance run one at a time, and the calls of different instances
+// concurrently.
+type Server struct {
+	UnimplementedVMServer
+
+	config    Config
+	mu        sync.Mutex
+	modules   map[string]*loadedModule
+	instances map[string]*instance
+	ids       uint64
+}
+
+type loadedModule struct {
+	module   *wasm.Module
+	compiled *exec.Module
+}
+
+type instance struct {
+	mu       sync.Mutex
+	inst     *exec.Instance
+	contract string
+}
+
+// NewServer returns a server using config.
+func NewServer(config Config) *Server {
+	if config.Imports == nil {
+		config.Imports = exec.NewEnvFunc()
+	}
+	if config.Schedule == nil {
+		config.Schedule = exec.DefaultGasSchedule()
+	}
+	return &Server{
+		config:    config,
+		modules:   make(map[string]*loadedModule),
+		instances: make(map[string]*instance),
+	}
+}
+
+// LoadModule decodes, validates and compiles the module of req, resolving
+// its imports from the modules loaded before it.
+func (s *Server) LoadModule(ctx context.Context, req *LoadModuleRequest) (*LoadModuleResponse, error) {
+	module, err := wasm.ReadModule(bytes.NewReader(req.Code), s.resolve)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	compiled, err := exec.CompileModule(module, s.config.VM)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := req.Name
+	if id == "" {
+		s.ids++
+		id = fmt.Sprintf("module-%d", s.ids)
+	}
+	if _, ok := s.modules[id]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "module %q already loaded", id)
+	}
+	s.modules[id] = &loadedModule{module: module, compiled: compiled}
+
+	res := &LoadModuleResponse{ModuleId: id}
+	for _, e := range compiled.Exports() {
+		if e.Kind != wasm.ExternalFunction || e.Sig == nil {
+			continue
+		}
+		export := &Export{Name: e.Name}
+		for _, t := range e.Sig.ParamTypes {
+			export.Params = append(export.Params, t.String())
+		}
+		for _, t := range e.Sig.ReturnTypes {
+			export.Results = append(export.Results, t.String())
+		}
+		res.Exports = append(res.Exports, export)
+	}
+	return res, nil
+}
+
+// resolve returns the loaded module with the identifier name.
+func (s *Server) resolve(name string) (*wasm.Module, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.modules[name]
+	if !ok {
+		return nil, fmt.Errorf("no module %q", name)
+	}
+	return m.module, nil
+}
+
+// Instantiate instantiates the loaded module of req.
+func (s *Server) Instantiate(ctx context.Context, req *InstantiateRequest) (*InstantiateResponse, error) {
+	s.mu.Lock()
+	m, ok := s.modules[req.ModuleId]
+	s.mu.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no module %q", req.ModuleId)
+	}
+	inst, err := instantiate(m.compiled, s.config.Imports)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	contract := req.Contract
+	if contract == "" {
+		contract = req.ModuleId
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids++
+	id := fmt.Sprintf("instance-%d", s.ids)
+	s.instances[id] = &instance{inst: inst, contract: contract}
+	return &InstantiateResponse{InstanceId: id}, nil
+}
+
+// instantiate instantiates compiled, returning the trap of its start
+// function as an error.
+func instantiate(compiled *exec.Module, imports *exec.EnvFunc) (inst *exec.Instance, err error) {
+	defer exec.RecoverTrap(&err)
+	return compiled.Instantiate(imports)
+}
+
+// Call calls an export of an instance, which keeps the changes of the
+// call.
+func (s *Server) Call(ctx context.Context, req *CallRequest) (*CallResponse, error) {
+	return s.call(ctx, req, false)
+}
+
+// Query calls an export of a copy of an instance, whose storage is
+// read-only.
+func (s *Server) Query(ctx context.Context, req *CallRequest) (*CallResponse, error) {
+	return s.call(ctx, req, true)
+}
+
+func (s *Server) call(ctx context.Context, req *CallRequest, query bool) (*CallResponse, error) {
+	s.mu.Lock()
+	in, ok := s.instances[req.InstanceId]
+	s.mu.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no instance %q", req.InstanceId)
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	inst, store := in.inst, s.config.Store
+	if query {
+		clone, err := inst.Clone()
+		if err != nil {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		defer clone.Close()
+		inst = clone
+		if store != nil {
+			store = readOnlyStore{store}
+		}
+	}
+	fn, ok := inst.ExportedFunction(req.Export)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no exported function %q", req.Export)
+	}
+	if slots := disasm.Slots(fn.Sig.ParamTypes...); len(req.Args) != slots {
+		return nil, status.Errorf(codes.InvalidArgument, "%s takes %d arguments, got %d", req.Export, slots, len(req.Args))
+	}
+
+	vm := s.newVM(inst, store, in.contract, req)
+	ctx, cancel := s.withTimeout(ctx, req)
+	defer cancel()
+
+	res := &CallResponse{}
+	if results, err := execCall(ctx, vm, int64(fn.Index), req.Args); err != nil {
+		res.Trap = err.Error()
+	} else {
+		res.Results = results
+	}
+	res.GasUsed = vm.GasUsed()
+	for _, e := range vm.Events() {
+		res.Events = append(res.Events, &Event{Topic: e.Topic, Data: e.Data})
+	}
+	return res, nil
+}
+
+// newVM returns a VM of inst running the call of req to the contract,
+// with the gas limit of the call.
+func (s *Server) newVM(inst *exec.Instance, store exec.StateStore, contractName string, req *CallRequest) *exec.VM {
+	vm := inst.NewVM()
+	if store != nil {
+		vm.SetStateStore(store)
+	}
+	vm.SetContract(&contract.Context{Trx: &types.Transaction{Sender: req.Caller, Contract: contractName, Method: req.Export}})
+	vm.SetChainContext(&exec.ChainContext{
+		BlockHeight:    req.BlockHeight,
+		BlockTimestamp: uint64(time.Now().Unix()),
+		Caller:         req.Caller,
+		Contract:       contractName,
+		Value:          req.Value,
+	})
+	vm.CollectEvents(true)
+	if gas := limit(req.GasLimit, s.config.MaxGas); gas != 0 {
+		vm.SetGasMeter(exec.NewGasMeter(gas), s.config.Schedule)
+	}
+	return vm
+}
+
+// withTimeout returns ctx done after the time limit of the call of req,
+// if any.
+func (s *Server) withTimeout(ctx context.Context, req *CallRequest) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(limit(req.TimeoutMs*uint64(time.Millisecond), uint64(s.config.MaxTimeout)))
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// limit returns the lower of the limits of a request and of the server,
+// the non zero one if the other is zero.
+func limit(request, server uint64) uint64 {
+	if server != 0 && (request == 0 || request > server) {
+		return server
+	}
+	return request
+}
+
+// execCall calls the function with the given index on vm until ctx is
+// done, and returns the raw bits of its results, or its trap as an error.
+func execCall(ctx context.Context, vm *exec.VM, fnIndex int64, args []uint64) (results []uint64, err error) {
+	defer exec.RecoverTrap(&err)
+	res, err := vm.ExecCodeContext(ctx, fnIndex, args...)
+	if err != nil {
+		return nil, err
+	}
+	return appendBits(nil, res), nil
+}
+
+// appendBits appends the raw bits of the result v of ExecCode to values.
+func appendBits(values []uint64, v interface{}) []uint64 {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, e := range v {
+			values = appendBits(values, e)
+		}
+	case uint32:
+		values = append(values, uint64(v))
+	case uint64:
+		values = append(values, v)
+	case float32:
+		values = append(values, uint64(math.Float32bits(v)))
+	case float64:
+		values = append(values, math.Float64bits(v))
+	case wasm.Ref:
+		values = append(values, uint64(v))
+	case wasm.V128:
+		values = append(values, binary.LittleEndian.Uint64(v[:8]), binary.LittleEndian.Uint64(v[8:]))
+	}
+	return values
+}
+
+// readOnlyStore is the storage of a query, failing its writes.
+type readOnlyStore struct {
+	exec.StateStore
+}
+
+func (readOnlyStore) Set(contract string, key, value []byte) error {
+	return ErrReadOnly
+}
+
+func (readOnlyStore) Remove(contract string, key []byte) error {
+	return ErrReadOnly
+}
@@ -0,0 +1,142 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bottos-project/bottos/vm/wasm/wat"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const counter = `(module
+	(global $n (mut i64) (i64.const 0))
+	(func (export "inc") (param i64) (result i64)
+		(global.set $n (i64.add (global.get $n) (local.get 0)))
+		(global.get $n))
+	(func (export "spin")
+		(loop (br 0))))`
+
+// dial serves s on an in-memory listener and returns a client of it.
+func dial(t *testing.T, s *Server) VMClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	RegisterVMServer(server, s)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewVMClient(conn)
+}
+
+func TestServer(t *testing.T) {
+	code, err := wat.Assemble([]byte(counter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dial(t, NewServer(Config{MaxGas: 1 << 20, MaxTimeout: 10 * time.Second}))
+	ctx := context.Background()
+
+	loaded, err := client.LoadModule(ctx, &LoadModuleRequest{Name: "counter", Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ModuleId != "counter" || len(loaded.Exports) != 2 || loaded.Exports[0].Name != "inc" ||
+		len(loaded.Exports[0].Params) != 1 || loaded.Exports[0].Params[0] != "i64" {
+		t.Fatalf("LoadModule returned %v", loaded)
+	}
+	if _, err := client.LoadModule(ctx, &LoadModuleRequest{Name: "counter", Code: code}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("loading a module twice returned %v", err)
+	}
+	if _, err := client.LoadModule(ctx, &LoadModuleRequest{Code: []byte("\x00asm")}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("loading a malformed module returned %v", err)
+	}
+	inst, err := client.Instantiate(ctx, &InstantiateRequest{ModuleId: "counter"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(query bool, args ...uint64) uint64 {
+		t.Helper()
+		req := &CallRequest{InstanceId: inst.InstanceId, Export: "inc", Args: args}
+		var res *CallResponse
+		if query {
+			res, err = client.Query(ctx, req)
+		} else {
+			res, err = client.Call(ctx, req)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Trap != "" || len(res.Results) != 1 || res.GasUsed == 0 {
+			t.Fatalf("inc returned %v", res)
+		}
+		return res.Results[0]
+	}
+	if n := call(false, 2); n != 2 {
+		t.Fatalf("the first call returned %d, want 2", n)
+	}
+	if n := call(true, 5); n != 7 {
+		t.Fatalf("the query returned %d, want 7", n)
+	}
+	if n := call(false, 1); n != 3 {
+		t.Fatalf("the call after the query returned %d, want 3", n)
+	}
+
+	res, err := client.Call(ctx, &CallRequest{InstanceId: inst.InstanceId, Export: "spin", GasLimit: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Trap == "" || res.GasUsed == 0 || res.GasUsed > 1000 {
+		t.Fatalf("a call out of gas returned %v", res)
+	}
+	res, err = client.Call(ctx, &CallRequest{InstanceId: inst.InstanceId, Export: "spin", GasLimit: 1 << 40, TimeoutMs: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Trap == "" {
+		t.Fatalf("a call out of time returned %v", res)
+	}
+
+	for _, req := range []*CallRequest{
+		{InstanceId: "none", Export: "inc", Args: []uint64{1}},
+		{InstanceId: inst.InstanceId, Export: "none"},
+	} {
+		if _, err := client.Call(ctx, req); status.Code(err) != codes.NotFound {
+			t.Errorf("calling %v returned %v", req, err)
+		}
+	}
+	if _, err := client.Call(ctx, &CallRequest{InstanceId: inst.InstanceId, Export: "inc"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("calling inc without arguments returned %v", err)
+	}
+	if _, err := client.Instantiate(ctx, &InstantiateRequest{ModuleId: "none"}); status.Code(err) != codes.NotFound {
+		t.Errorf("instantiating an unknown module returned %v", err)
+	}
+}
@@ -0,0 +1,645 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: wasmvm.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LoadModuleRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// name is the identifier of the module, which the modules loaded later
+	// import it as. The server names the module if empty.
+	Name          string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Code          []byte `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoadModuleRequest) Reset() {
+	*x = LoadModuleRequest{}
+	mi := &file_wasmvm_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoadModuleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoadModuleRequest) ProtoMessage() {}
+
+func (x *LoadModuleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wasmvm_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoadModuleRequest.ProtoReflect.Descriptor instead.
+func (*LoadModuleRequest) Descriptor() ([]byte, []int) {
+	return file_wasmvm_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LoadModuleRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *LoadModuleRequest) GetCode() []byte {
+	if x != nil {
+		return x.Code
+	}
+	return nil
+}
+
+// Export is a function exported by a module, with the types of its
+// parameters and results, like "i32".
+type Export struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Params        []string               `protobuf:"bytes,2,rep,name=params,proto3" json:"params,omitempty"`
+	Results       []string               `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Export) Reset() {
+	*x = Export{}
+	mi := &file_wasmvm_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Export) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Export) ProtoMessage() {}
+
+func (x *Export) ProtoReflect() protoreflect.Message {
+	mi := &file_wasmvm_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Export.ProtoReflect.Descriptor instead.
+func (*Export) Descriptor() ([]byte, []int) {
+	return file_wasmvm_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Export) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Export) GetParams() []string {
+	if x != nil {
+		return x.Params
+	}
+	return nil
+}
+
+func (x *Export) GetResults() []string {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type LoadModuleResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ModuleId      string                 `protobuf:"bytes,1,opt,name=module_id,json=moduleId,proto3" json:"module_id,omitempty"`
+	Exports       []*Export              `protobuf:"bytes,2,rep,name=exports,proto3" json:"exports,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoadModuleResponse) Reset() {
+	*x = LoadModuleResponse{}
+	mi := &file_wasmvm_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoadModuleResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoadModuleResponse) ProtoMessage() {}
+
+func (x *LoadModuleResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wasmvm_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoadModuleResponse.ProtoReflect.Descriptor instead.
+func (*LoadModuleResponse) Descriptor() ([]byte, []int) {
+	return file_wasmvm_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *LoadModuleResponse) GetModuleId() string {
+	if x != nil {
+		return x.ModuleId
+	}
+	return ""
+}
+
+func (x *LoadModuleResponse) GetExports() []*Export {
+	if x != nil {
+		return x.Exports
+	}
+	return nil
+}
+
+type InstantiateRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	ModuleId string                 `protobuf:"bytes,1,opt,name=module_id,json=moduleId,proto3" json:"module_id,omitempty"`
+	// contract is the account of the instance, in its storage and chain
+	// context, the module identifier if empty.
+	Contract      string `protobuf:"bytes,2,opt,name=contract,proto3" json:"contract,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InstantiateRequest) Reset() {
+	*x = InstantiateRequest{}
+	mi := &file_wasmvm_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InstantiateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InstantiateRequest) ProtoMessage() {}
+
+func (x *InstantiateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wasmvm_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InstantiateRequest.ProtoReflect.Descriptor instead.
+func (*InstantiateRequest) Descriptor() ([]byte, []int) {
+	return file_wasmvm_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *InstantiateRequest) GetModuleId() string {
+	if x != nil {
+		return x.ModuleId
+	}
+	return ""
+}
+
+func (x *InstantiateRequest) GetContract() string {
+	if x != nil {
+		return x.Contract
+	}
+	return ""
+}
+
+type InstantiateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId    string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InstantiateResponse) Reset() {
+	*x = InstantiateResponse{}
+	mi := &file_wasmvm_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InstantiateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InstantiateResponse) ProtoMessage() {}
+
+func (x *InstantiateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wasmvm_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InstantiateResponse.ProtoReflect.Descriptor instead.
+func (*InstantiateResponse) Descriptor() ([]byte, []int) {
+	return file_wasmvm_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *InstantiateResponse) GetInstanceId() string {
+	if x != nil {
+		return x.InstanceId
+	}
+	return ""
+}
+
+type CallRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
+	Export     string                 `protobuf:"bytes,2,opt,name=export,proto3" json:"export,omitempty"`
+	// args are the raw bits of the arguments: a v128 takes two, its low
+	// then high 64 bits.
+	Args []uint64 `protobuf:"varint,3,rep,packed,name=args,proto3" json:"args,omitempty"`
+	// gas_limit and timeout_ms limit the call, up to the limits of the
+	// server, which apply if they are zero.
+	GasLimit  uint64 `protobuf:"varint,4,opt,name=gas_limit,json=gasLimit,proto3" json:"gas_limit,omitempty"`
+	TimeoutMs uint64 `protobuf:"varint,5,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	// the chain context of the call
+	Caller        string `protobuf:"bytes,6,opt,name=caller,proto3" json:"caller,omitempty"`
+	Value         uint64 `protobuf:"varint,7,opt,name=value,proto3" json:"value,omitempty"`
+	BlockHeight   uint64 `protobuf:"varint,8,opt,name=block_height,json=blockHeight,proto3" json:"block_height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CallRequest) Reset() {
+	*x = CallRequest{}
+	mi := &file_wasmvm_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CallRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CallRequest) ProtoMessage() {}
+
+func (x *CallRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wasmvm_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CallRequest.ProtoReflect.Descriptor instead.
+func (*CallRequest) Descriptor() ([]byte, []int) {
+	return file_wasmvm_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CallRequest) GetInstanceId() string {
+	if x != nil {
+		return x.InstanceId
+	}
+	return ""
+}
+
+func (x *CallRequest) GetExport() string {
+	if x != nil {
+		return x.Export
+	}
+	return ""
+}
+
+func (x *CallRequest) GetArgs() []uint64 {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *CallRequest) GetGasLimit() uint64 {
+	if x != nil {
+		return x.GasLimit
+	}
+	return 0
+}
+
+func (x *CallRequest) GetTimeoutMs() uint64 {
+	if x != nil {
+		return x.TimeoutMs
+	}
+	return 0
+}
+
+func (x *CallRequest) GetCaller() string {
+	if x != nil {
+		return x.Caller
+	}
+	return ""
+}
+
+func (x *CallRequest) GetValue() uint64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *CallRequest) GetBlockHeight() uint64 {
+	if x != nil {
+		return x.BlockHeight
+	}
+	return 0
+}
+
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Topic         string                 `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_wasmvm_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_wasmvm_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_wasmvm_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Event) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *Event) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type CallResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// results are the raw bits of the results, like the arguments.
+	Results []uint64 `protobuf:"varint,1,rep,packed,name=results,proto3" json:"results,omitempty"`
+	// trap is the trap of the call, out of gas and time included, and is
+	// empty if it returned.
+	Trap          string   `protobuf:"bytes,2,opt,name=trap,proto3" json:"trap,omitempty"`
+	GasUsed       uint64   `protobuf:"varint,3,opt,name=gas_used,json=gasUsed,proto3" json:"gas_used,omitempty"`
+	Events        []*Event `protobuf:"bytes,4,rep,name=events,proto3" json:"events,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CallResponse) Reset() {
+	*x = CallResponse{}
+	mi := &file_wasmvm_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CallResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CallResponse) ProtoMessage() {}
+
+func (x *CallResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wasmvm_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CallResponse.ProtoReflect.Descriptor instead.
+func (*CallResponse) Descriptor() ([]byte, []int) {
+	return file_wasmvm_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CallResponse) GetResults() []uint64 {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *CallResponse) GetTrap() string {
+	if x != nil {
+		return x.Trap
+	}
+	return ""
+}
+
+func (x *CallResponse) GetGasUsed() uint64 {
+	if x != nil {
+		return x.GasUsed
+	}
+	return 0
+}
+
+func (x *CallResponse) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+var File_wasmvm_proto protoreflect.FileDescriptor
+
+const file_wasmvm_proto_rawDesc = "" +
+	"\n" +
+	"\fwasmvm.proto\x12\x06wasmvm\";\n" +
+	"\x11LoadModuleRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\fR\x04code\"N\n" +
+	"\x06Export\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06params\x18\x02 \x03(\tR\x06params\x12\x18\n" +
+	"\aresults\x18\x03 \x03(\tR\aresults\"[\n" +
+	"\x12LoadModuleResponse\x12\x1b\n" +
+	"\tmodule_id\x18\x01 \x01(\tR\bmoduleId\x12(\n" +
+	"\aexports\x18\x02 \x03(\v2\x0e.wasmvm.ExportR\aexports\"M\n" +
+	"\x12InstantiateRequest\x12\x1b\n" +
+	"\tmodule_id\x18\x01 \x01(\tR\bmoduleId\x12\x1a\n" +
+	"\bcontract\x18\x02 \x01(\tR\bcontract\"6\n" +
+	"\x13InstantiateResponse\x12\x1f\n" +
+	"\vinstance_id\x18\x01 \x01(\tR\n" +
+	"instanceId\"\xe7\x01\n" +
+	"\vCallRequest\x12\x1f\n" +
+	"\vinstance_id\x18\x01 \x01(\tR\n" +
+	"instanceId\x12\x16\n" +
+	"\x06export\x18\x02 \x01(\tR\x06export\x12\x12\n" +
+	"\x04args\x18\x03 \x03(\x04R\x04args\x12\x1b\n" +
+	"\tgas_limit\x18\x04 \x01(\x04R\bgasLimit\x12\x1d\n" +
+	"\n" +
+	"timeout_ms\x18\x05 \x01(\x04R\ttimeoutMs\x12\x16\n" +
+	"\x06caller\x18\x06 \x01(\tR\x06caller\x12\x14\n" +
+	"\x05value\x18\a \x01(\x04R\x05value\x12!\n" +
+	"\fblock_height\x18\b \x01(\x04R\vblockHeight\"1\n" +
+	"\x05Event\x12\x14\n" +
+	"\x05topic\x18\x01 \x01(\tR\x05topic\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"~\n" +
+	"\fCallResponse\x12\x18\n" +
+	"\aresults\x18\x01 \x03(\x04R\aresults\x12\x12\n" +
+	"\x04trap\x18\x02 \x01(\tR\x04trap\x12\x19\n" +
+	"\bgas_used\x18\x03 \x01(\x04R\agasUsed\x12%\n" +
+	"\x06events\x18\x04 \x03(\v2\r.wasmvm.EventR\x06events2\xf8\x01\n" +
+	"\x02VM\x12C\n" +
+	"\n" +
+	"LoadModule\x12\x19.wasmvm.LoadModuleRequest\x1a\x1a.wasmvm.LoadModuleResponse\x12F\n" +
+	"\vInstantiate\x12\x1a.wasmvm.InstantiateRequest\x1a\x1b.wasmvm.InstantiateResponse\x121\n" +
+	"\x04Call\x12\x13.wasmvm.CallRequest\x1a\x14.wasmvm.CallResponse\x122\n" +
+	"\x05Query\x12\x13.wasmvm.CallRequest\x1a\x14.wasmvm.CallResponseB.Z,github.com/bottos-project/bottos/vm/wasm/rpcb\x06proto3"
+
+var (
+	file_wasmvm_proto_rawDescOnce sync.Once
+	file_wasmvm_proto_rawDescData []byte
+)
+
+func file_wasmvm_proto_rawDescGZIP() []byte {
+	file_wasmvm_proto_rawDescOnce.Do(func() {
+		file_wasmvm_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_wasmvm_proto_rawDesc), len(file_wasmvm_proto_rawDesc)))
+	})
+	return file_wasmvm_proto_rawDescData
+}
+
+var file_wasmvm_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_wasmvm_proto_goTypes = []any{
+	(*LoadModuleRequest)(nil),   // 0: wasmvm.LoadModuleRequest
+	(*Export)(nil),              // 1: wasmvm.Export
+	(*LoadModuleResponse)(nil),  // 2: wasmvm.LoadModuleResponse
+	(*InstantiateRequest)(nil),  // 3: wasmvm.InstantiateRequest
+	(*InstantiateResponse)(nil), // 4: wasmvm.InstantiateResponse
+	(*CallRequest)(nil),         // 5: wasmvm.CallRequest
+	(*Event)(nil),               // 6: wasmvm.Event
+	(*CallResponse)(nil),        // 7: wasmvm.CallResponse
+}
+var file_wasmvm_proto_depIdxs = []int32{
+	1, // 0: wasmvm.LoadModuleResponse.exports:type_name -> wasmvm.Export
+	6, // 1: wasmvm.CallResponse.events:type_name -> wasmvm.Event
+	0, // 2: wasmvm.VM.LoadModule:input_type -> wasmvm.LoadModuleRequest
+	3, // 3: wasmvm.VM.Instantiate:input_type -> wasmvm.InstantiateRequest
+	5, // 4: wasmvm.VM.Call:input_type -> wasmvm.CallRequest
+	5, // 5: wasmvm.VM.Query:input_type -> wasmvm.CallRequest
+	2, // 6: wasmvm.VM.LoadModule:output_type -> wasmvm.LoadModuleResponse
+	4, // 7: wasmvm.VM.Instantiate:output_type -> wasmvm.InstantiateResponse
+	7, // 8: wasmvm.VM.Call:output_type -> wasmvm.CallResponse
+	7, // 9: wasmvm.VM.Query:output_type -> wasmvm.CallResponse
+	6, // [6:10] is the sub-list for method output_type
+	2, // [2:6] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_wasmvm_proto_init() }
+func file_wasmvm_proto_init() {
+	if File_wasmvm_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_wasmvm_proto_rawDesc), len(file_wasmvm_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_wasmvm_proto_goTypes,
+		DependencyIndexes: file_wasmvm_proto_depIdxs,
+		MessageInfos:      file_wasmvm_proto_msgTypes,
+	}.Build()
+	File_wasmvm_proto = out.File
+	file_wasmvm_proto_goTypes = nil
+	file_wasmvm_proto_depIdxs = nil
+}
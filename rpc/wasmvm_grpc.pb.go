@@ -0,0 +1,274 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: wasmvm.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	VM_LoadModule_FullMethodName  = "/wasmvm.VM/LoadModule"
+	VM_Instantiate_FullMethodName = "/wasmvm.VM/Instantiate"
+	VM_Call_FullMethodName        = "/wasmvm.VM/Call"
+	VM_Query_FullMethodName       = "/wasmvm.VM/Query"
+)
+
+// VMClient is the client API for VM service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// VM runs the modules loaded by its clients, for the processes which use
+// the VM without linking it.
+type VMClient interface {
+	// LoadModule decodes, validates and compiles a module.
+	LoadModule(ctx context.Context, in *LoadModuleRequest, opts ...grpc.CallOption) (*LoadModuleResponse, error)
+	// Instantiate creates an instance of a loaded module, running its start
+	// function.
+	Instantiate(ctx context.Context, in *InstantiateRequest, opts ...grpc.CallOption) (*InstantiateResponse, error)
+	// Call calls an exported function of an instance, which keeps the
+	// changes of the call to its memory, globals and storage.
+	Call(ctx context.Context, in *CallRequest, opts ...grpc.CallOption) (*CallResponse, error)
+	// Query calls an exported function of an instance like Call, on a copy
+	// of the instance, and fails the writes to the storage: the instance is
+	// left as it was.
+	Query(ctx context.Context, in *CallRequest, opts ...grpc.CallOption) (*CallResponse, error)
+}
+
+type vMClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVMClient(cc grpc.ClientConnInterface) VMClient {
+	return &vMClient{cc}
+}
+
+func (c *vMClient) LoadModule(ctx context.Context, in *LoadModuleRequest, opts ...grpc.CallOption) (*LoadModuleResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoadModuleResponse)
+	err := c.cc.Invoke(ctx, VM_LoadModule_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vMClient) Instantiate(ctx context.Context, in *InstantiateRequest, opts ...grpc.CallOption) (*InstantiateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(InstantiateResponse)
+	err := c.cc.Invoke(ctx, VM_Instantiate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vMClient) Call(ctx context.Context, in *CallRequest, opts ...grpc.CallOption) (*CallResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CallResponse)
+	err := c.cc.Invoke(ctx, VM_Call_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vMClient) Query(ctx context.Context, in *CallRequest, opts ...grpc.CallOption) (*CallResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CallResponse)
+	err := c.cc.Invoke(ctx, VM_Query_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// VMServer is the server API for VM service.
+// All implementations must embed UnimplementedVMServer
+// for forward compatibility.
+//
+// VM runs the modules loaded by its clients, for the processes which use
+// the VM without linking it.
+type VMServer interface {
+	// LoadModule decodes, validates and compiles a module.
+	LoadModule(context.Context, *LoadModuleRequest) (*LoadModuleResponse, error)
+	// Instantiate creates an instance of a loaded module, running its start
+	// function.
+	Instantiate(context.Context, *InstantiateRequest) (*InstantiateResponse, error)
+	// Call calls an exported function of an instance, which keeps the
+	// changes of the call to its memory, globals and storage.
+	Call(context.Context, *CallRequest) (*CallResponse, error)
+	// Query calls an exported function of an instance like Call, on a copy
+	// of the instance, and fails the writes to the storage: the instance is
+	// left as it was.
+	Query(context.Context, *CallRequest) (*CallResponse, error)
+	mustEmbedUnimplementedVMServer()
+}
+
+// UnimplementedVMServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedVMServer struct{}
+
+func (UnimplementedVMServer) LoadModule(context.Context, *LoadModuleRequest) (*LoadModuleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LoadModule not implemented")
+}
+func (UnimplementedVMServer) Instantiate(context.Context, *InstantiateRequest) (*InstantiateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Instantiate not implemented")
+}
+func (UnimplementedVMServer) Call(context.Context, *CallRequest) (*CallResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Call not implemented")
+}
+func (UnimplementedVMServer) Query(context.Context, *CallRequest) (*CallResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedVMServer) mustEmbedUnimplementedVMServer() {}
+func (UnimplementedVMServer) testEmbeddedByValue()            {}
+
+// UnsafeVMServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to VMServer will
+// result in compilation errors.
+type UnsafeVMServer interface {
+	mustEmbedUnimplementedVMServer()
+}
+
+func RegisterVMServer(s grpc.ServiceRegistrar, srv VMServer) {
+	// If the following call pancis, it indicates UnimplementedVMServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&VM_ServiceDesc, srv)
+}
+
+func _VM_LoadModule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoadModuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VMServer).LoadModule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VM_LoadModule_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VMServer).LoadModule(ctx, req.(*LoadModuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VM_Instantiate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InstantiateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VMServer).Instantiate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VM_Instantiate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VMServer).Instantiate(ctx, req.(*InstantiateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VM_Call_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CallRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VMServer).Call(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VM_Call_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VMServer).Call(ctx, req.(*CallRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VM_Query_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CallRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VMServer).Query(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VM_Query_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VMServer).Query(ctx, req.(*CallRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// VM_ServiceDesc is the grpc.ServiceDesc for VM service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var VM_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wasmvm.VM",
+	HandlerType: (*VMServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "LoadModule",
+			Handler:    _VM_LoadModule_Handler,
+		},
+		{
+			MethodName: "Instantiate",
+			Handler:    _VM_Instantiate_Handler,
+		},
+		{
+			MethodName: "Call",
+			Handler:    _VM_Call_Handler,
+		},
+		{
+			MethodName: "Query",
+			Handler:    _VM_Query_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "wasmvm.proto",
+}
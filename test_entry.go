@@ -24,6 +24,7 @@ import (
 	"github.com/bottos-project/bottos/contract"
 	"github.com/bottos-project/bottos/common/types"
 	log "github.com/cihub/seelog"
+	wasmlog "github.com/bottos-project/bottos/vm/wasm/log"
 	"github.com/bottos-project/bottos/contract/msgpack"
 )
 
@@ -597,6 +598,31 @@ func init() {
 		return
 	}
 	log.ReplaceLogger(logger)
+	wasmlog.SetDefault(seelogLogger{logger})
+}
+
+// seelogLogger routes the log messages of the VM to a seelog logger.
+type seelogLogger struct {
+	l log.LoggerInterface
+}
+
+func (s seelogLogger) Enabled(level wasmlog.Level) bool { return true }
+
+func (s seelogLogger) Log(level wasmlog.Level, msg string) {
+	switch level {
+	case wasmlog.LevelTrace:
+		s.l.Trace(msg)
+	case wasmlog.LevelDebug:
+		s.l.Debug(msg)
+	case wasmlog.LevelInfo:
+		s.l.Info(msg)
+	case wasmlog.LevelWarn:
+		s.l.Warn(msg)
+	case wasmlog.LevelError:
+		s.l.Error(msg)
+	default:
+		s.l.Critical(msg)
+	}
 }
 
 func Test5() {
@@ -0,0 +1,474 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package transform
+
+import (
+	"bytes"
+	"errors"
+	"math/bits"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// Optimizations returns the optimizer passes, in the order they are best
+// run: FoldConstants, RemoveUnreachableCode and RemoveUnusedFunctions.
+// They shrink the code the interpreter runs, such as the padding of the
+// modules compiled by AssemblyScript, without changing what it computes.
+func Optimizations() []Pass {
+	return []Pass{FoldConstants(), RemoveUnreachableCode(), RemoveUnusedFunctions()}
+}
+
+// ErrUnresolvedImports is returned by the optimizer passes for a module
+// whose imported functions aren't in its function index space, the
+// pipeline reading it without the resolver of its imports, see
+// Pipeline.Resolve.
+var ErrUnresolvedImports = errors.New("transform: the imported functions of the module aren't resolved")
+
+// instr is an instruction of a function body, with its encoding.
+type instr struct {
+	disasm.Instr
+	raw []byte
+}
+
+// bodies calls f with the function index and the instructions of every
+// function body of m, and replaces the code of the body with the one f
+// returns if it isn't nil.
+func bodies(m *wasm.Module, f func(index int, instrs []instr) ([]byte, error)) error {
+	if m.Code == nil {
+		return nil
+	}
+	imported := len(m.FunctionIndexSpace) - len(m.Code.Bodies)
+	if imported != importedFuncs(m) {
+		return ErrUnresolvedImports
+	}
+	for i := range m.Code.Bodies {
+		index := imported + i
+		d, err := disasm.Disassemble(m.FunctionIndexSpace[index], m)
+		if err != nil {
+			return err
+		}
+		code := m.Code.Bodies[i].Code
+		var instrs []instr
+		for j, in := range d.Code {
+			if in.Offset < 0 {
+				// the instructions added by Disassemble aren't encoded
+				continue
+			}
+			end := len(code)
+			for _, next := range d.Code[j+1:] {
+				if next.Offset >= 0 {
+					end = next.Offset
+					break
+				}
+			}
+			instrs = append(instrs, instr{in, code[in.Offset:end]})
+		}
+		rewritten, err := f(index, instrs)
+		if err != nil {
+			return err
+		}
+		if rewritten != nil {
+			m.Code.Bodies[i].Code = rewritten
+		}
+	}
+	return nil
+}
+
+// importedFuncs returns the number of functions m imports.
+func importedFuncs(m *wasm.Module) int {
+	n := 0
+	if m.Import != nil {
+		for _, entry := range m.Import.Entries {
+			if entry.Kind == wasm.ExternalFunction {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// blocks returns the indices of the else and end instructions closing the
+// blocks started at each index of instrs.
+func blocks(instrs []instr) (elses, ends map[int]int) {
+	elses, ends = make(map[int]int), make(map[int]int)
+	var starts []int
+	for i, in := range instrs {
+		switch in.Op.Code {
+		case ops.Block, ops.Loop, ops.If, ops.Try:
+			starts = append(starts, i)
+		case ops.Else:
+			elses[starts[len(starts)-1]] = i
+		case ops.End, ops.Delegate:
+			ends[starts[len(starts)-1]] = i
+			starts = starts[:len(starts)-1]
+		}
+	}
+	return elses, ends
+}
+
+// FoldConstants returns the pass computing the integer arithmetic and
+// comparisons whose operands are constants, dropping the constants
+// dropped, and simplifying the br_if and if whose conditions are: an if
+// becomes a block of the branch taken. The divisions and remainders,
+// which may trap, and the floating point operators are left as is.
+func FoldConstants() Pass {
+	return NewPass("fold-constants", func(m *wasm.Module) error {
+		return bodies(m, func(_ int, instrs []instr) ([]byte, error) {
+			return foldConstants(instrs), nil
+		})
+	})
+}
+
+// folded is an instruction of the code rewritten by foldConstants, which
+// pushes the constant value of type typ if typ isn't zero.
+type folded struct {
+	raw   []byte
+	typ   wasm.ValueType
+	value uint64
+}
+
+func foldConstants(instrs []instr) []byte {
+	elses, ends := blocks(instrs)
+	var out []folded
+	// constant returns the value of the constant of type typ the
+	// instruction n-th from the end of out pushes
+	constant := func(n int, typ wasm.ValueType) (uint64, bool) {
+		if len(out) < n || out[len(out)-n].typ != typ {
+			return 0, false
+		}
+		return out[len(out)-n].value, true
+	}
+	changed := false
+	for i := 0; i < len(instrs); i++ {
+		in := instrs[i]
+		op := in.Op.Code
+		switch {
+		case op == ops.I32Const:
+			out = append(out, folded{in.raw, wasm.ValueTypeI32, uint64(uint32(in.Immediates[0].(int32)))})
+			continue
+		case op == ops.I64Const:
+			out = append(out, folded{in.raw, wasm.ValueTypeI64, uint64(in.Immediates[0].(int64))})
+			continue
+		case op == ops.I32Eqz || op == ops.I64Eqz:
+			typ := wasm.ValueTypeI32
+			if op == ops.I64Eqz {
+				typ = wasm.ValueTypeI64
+			}
+			if v, ok := constant(1, typ); ok {
+				out[len(out)-1] = constant32(v == 0)
+				changed = true
+				continue
+			}
+		case op == ops.Drop:
+			if len(out) != 0 && out[len(out)-1].typ != 0 {
+				out = out[:len(out)-1]
+				changed = true
+				continue
+			}
+		case op == ops.BrIf:
+			if v, ok := constant(1, wasm.ValueTypeI32); ok {
+				out = out[:len(out)-1]
+				if v != 0 {
+					br := []byte{ops.Br}
+					br = append(br, in.raw[1:]...)
+					out = append(out, folded{raw: br})
+				}
+				changed = true
+				continue
+			}
+		case op == ops.If:
+			if v, ok := constant(1, wasm.ValueTypeI32); ok {
+				out = out[:len(out)-1]
+				block := []byte{ops.Block}
+				block = append(block, in.raw[1:]...)
+				out = append(out, folded{raw: block})
+				elseIndex, hasElse := elses[i]
+				switch {
+				case v != 0 && hasElse:
+					// the else branch is left out
+					instrs = append(instrs[:elseIndex:elseIndex], instrs[ends[i]:]...)
+					elses, ends = blocks(instrs)
+				case v == 0 && hasElse:
+					i = elseIndex
+				case v == 0:
+					i = ends[i] - 1
+				}
+				changed = true
+				continue
+			}
+		}
+		if typ, ok := binaryType(op); ok {
+			if a, ok := constant(2, typ); ok {
+				if b, ok := constant(1, typ); ok {
+					if v, vtyp, ok := foldBinary(op, a, b); ok {
+						out = append(out[:len(out)-2], constantValue(vtyp, v))
+						changed = true
+						continue
+					}
+				}
+			}
+		}
+		out = append(out, folded{raw: in.raw})
+	}
+	if !changed {
+		return nil
+	}
+	var code bytes.Buffer
+	for _, f := range out {
+		code.Write(f.raw)
+	}
+	return code.Bytes()
+}
+
+// binaryType returns the type of the operands of the integer binary
+// operator op, and false if op isn't one.
+func binaryType(op byte) (wasm.ValueType, bool) {
+	switch {
+	case op >= ops.I32Eq && op <= ops.I32GeU, op >= ops.I32Add && op <= ops.I32Rotr:
+		return wasm.ValueTypeI32, true
+	case op >= ops.I64Eq && op <= ops.I64GeU, op >= ops.I64Add && op <= ops.I64Rotr:
+		return wasm.ValueTypeI64, true
+	}
+	return 0, false
+}
+
+// foldBinary returns the value and the type of the result of the integer
+// binary operator op of operands a and b, and false for the operators
+// which may trap.
+func foldBinary(op byte, a, b uint64) (uint64, wasm.ValueType, bool) {
+	x, y := uint32(a), uint32(b)
+	switch op {
+	case ops.I32Eq:
+		return bool32(x == y), wasm.ValueTypeI32, true
+	case ops.I32Ne:
+		return bool32(x != y), wasm.ValueTypeI32, true
+	case ops.I32LtS:
+		return bool32(int32(x) < int32(y)), wasm.ValueTypeI32, true
+	case ops.I32LtU:
+		return bool32(x < y), wasm.ValueTypeI32, true
+	case ops.I32GtS:
+		return bool32(int32(x) > int32(y)), wasm.ValueTypeI32, true
+	case ops.I32GtU:
+		return bool32(x > y), wasm.ValueTypeI32, true
+	case ops.I32LeS:
+		return bool32(int32(x) <= int32(y)), wasm.ValueTypeI32, true
+	case ops.I32LeU:
+		return bool32(x <= y), wasm.ValueTypeI32, true
+	case ops.I32GeS:
+		return bool32(int32(x) >= int32(y)), wasm.ValueTypeI32, true
+	case ops.I32GeU:
+		return bool32(x >= y), wasm.ValueTypeI32, true
+	case ops.I32Add:
+		return uint64(x + y), wasm.ValueTypeI32, true
+	case ops.I32Sub:
+		return uint64(x - y), wasm.ValueTypeI32, true
+	case ops.I32Mul:
+		return uint64(x * y), wasm.ValueTypeI32, true
+	case ops.I32And:
+		return uint64(x & y), wasm.ValueTypeI32, true
+	case ops.I32Or:
+		return uint64(x | y), wasm.ValueTypeI32, true
+	case ops.I32Xor:
+		return uint64(x ^ y), wasm.ValueTypeI32, true
+	case ops.I32Shl:
+		return uint64(x << (y & 31)), wasm.ValueTypeI32, true
+	case ops.I32ShrS:
+		return uint64(uint32(int32(x) >> (y & 31))), wasm.ValueTypeI32, true
+	case ops.I32ShrU:
+		return uint64(x >> (y & 31)), wasm.ValueTypeI32, true
+	case ops.I32Rotl:
+		return uint64(bits.RotateLeft32(x, int(y&31))), wasm.ValueTypeI32, true
+	case ops.I32Rotr:
+		return uint64(bits.RotateLeft32(x, -int(y&31))), wasm.ValueTypeI32, true
+
+	case ops.I64Eq:
+		return bool32(a == b), wasm.ValueTypeI32, true
+	case ops.I64Ne:
+		return bool32(a != b), wasm.ValueTypeI32, true
+	case ops.I64LtS:
+		return bool32(int64(a) < int64(b)), wasm.ValueTypeI32, true
+	case ops.I64LtU:
+		return bool32(a < b), wasm.ValueTypeI32, true
+	case ops.I64GtS:
+		return bool32(int64(a) > int64(b)), wasm.ValueTypeI32, true
+	case ops.I64GtU:
+		return bool32(a > b), wasm.ValueTypeI32, true
+	case ops.I64LeS:
+		return bool32(int64(a) <= int64(b)), wasm.ValueTypeI32, true
+	case ops.I64LeU:
+		return bool32(a <= b), wasm.ValueTypeI32, true
+	case ops.I64GeS:
+		return bool32(int64(a) >= int64(b)), wasm.ValueTypeI32, true
+	case ops.I64GeU:
+		return bool32(a >= b), wasm.ValueTypeI32, true
+	case ops.I64Add:
+		return a + b, wasm.ValueTypeI64, true
+	case ops.I64Sub:
+		return a - b, wasm.ValueTypeI64, true
+	case ops.I64Mul:
+		return a * b, wasm.ValueTypeI64, true
+	case ops.I64And:
+		return a & b, wasm.ValueTypeI64, true
+	case ops.I64Or:
+		return a | b, wasm.ValueTypeI64, true
+	case ops.I64Xor:
+		return a ^ b, wasm.ValueTypeI64, true
+	case ops.I64Shl:
+		return a << (b & 63), wasm.ValueTypeI64, true
+	case ops.I64ShrS:
+		return uint64(int64(a) >> (b & 63)), wasm.ValueTypeI64, true
+	case ops.I64ShrU:
+		return a >> (b & 63), wasm.ValueTypeI64, true
+	case ops.I64Rotl:
+		return bits.RotateLeft64(a, int(b&63)), wasm.ValueTypeI64, true
+	case ops.I64Rotr:
+		return bits.RotateLeft64(a, -int(b&63)), wasm.ValueTypeI64, true
+	}
+	return 0, 0, false
+}
+
+func bool32(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// constant32 returns the i32.const of the boolean b.
+func constant32(b bool) folded {
+	return constantValue(wasm.ValueTypeI32, bool32(b))
+}
+
+// constantValue returns the constant instruction pushing v of type typ.
+func constantValue(typ wasm.ValueType, v uint64) folded {
+	var raw bytes.Buffer
+	if typ == wasm.ValueTypeI32 {
+		raw.WriteByte(ops.I32Const)
+		leb128.WriteVarint64(&raw, int64(int32(uint32(v))))
+	} else {
+		raw.WriteByte(ops.I64Const)
+		leb128.WriteVarint64(&raw, int64(v))
+	}
+	return folded{raw.Bytes(), typ, v}
+}
+
+// RemoveUnreachableCode returns the pass removing the instructions which
+// can't run, following a branch, a return, a throw or unreachable in their
+// block.
+func RemoveUnreachableCode() Pass {
+	return NewPass("remove-unreachable-code", func(m *wasm.Module) error {
+		return bodies(m, func(_ int, instrs []instr) ([]byte, error) {
+			var code bytes.Buffer
+			changed := false
+			for _, in := range instrs {
+				// the end and else of a block which is reachable are
+				// reachable
+				if in.Unreachable {
+					changed = true
+					continue
+				}
+				code.Write(in.raw)
+			}
+			if !changed {
+				return nil, nil
+			}
+			return code.Bytes(), nil
+		})
+	})
+}
+
+// RemoveUnusedFunctions returns the pass replacing the bodies of the
+// functions the module can't call by unreachable: the ones which aren't
+// exported, the start function, in an element segment, referenced by a
+// global, nor called or referenced by the other functions it keeps. The
+// indices of the functions don't change, and calling a function removed
+// anyway, by its index, traps with exec.TrapUnreachable.
+func RemoveUnusedFunctions() Pass {
+	return NewPass("remove-unused-functions", func(m *wasm.Module) error {
+		if m.Code == nil {
+			return nil
+		}
+		imported := importedFuncs(m)
+		if len(m.FunctionIndexSpace)-len(m.Code.Bodies) != imported {
+			return ErrUnresolvedImports
+		}
+		// the functions each function references
+		refs := make(map[int][]uint32)
+		err := bodies(m, func(index int, instrs []instr) ([]byte, error) {
+			for _, in := range instrs {
+				switch in.Op.Code {
+				case ops.Call, ops.ReturnCall, ops.RefFunc:
+					refs[index] = append(refs[index], in.Immediates[0].(uint32))
+				}
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		var work []uint32
+		for _, e := range m.Exports() {
+			if e.Kind == wasm.ExternalFunction {
+				work = append(work, e.Index)
+			}
+		}
+		if m.Start != nil {
+			work = append(work, m.Start.Index)
+		}
+		if m.Elements != nil {
+			for _, segment := range m.Elements.Entries {
+				for _, elem := range segment.Elems {
+					if elem != uint32(wasm.NullRef) {
+						work = append(work, elem)
+					}
+				}
+			}
+		}
+		if m.Global != nil {
+			for _, global := range m.Global.Globals {
+				if len(global.Init) > 1 && global.Init[0] == ops.RefFunc {
+					if index, err := leb128.ReadVarUint32(bytes.NewReader(global.Init[1:])); err == nil {
+						work = append(work, index)
+					}
+				}
+			}
+		}
+		used := make(map[uint32]bool)
+		for len(work) != 0 {
+			index := work[len(work)-1]
+			work = work[:len(work)-1]
+			if used[index] {
+				continue
+			}
+			used[index] = true
+			work = append(work, refs[int(index)]...)
+		}
+
+		for i := range m.Code.Bodies {
+			body := &m.Code.Bodies[i]
+			if !used[uint32(imported+i)] && !(len(body.Locals) == 0 && bytes.Equal(body.Code, []byte{ops.Unreachable})) {
+				body.Locals, body.Code = nil, []byte{ops.Unreachable}
+			}
+		}
+		return nil
+	})
+}
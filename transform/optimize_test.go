@@ -0,0 +1,132 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package transform
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// names returns the names of the instructions of the function index of m.
+func names(t *testing.T, m *wasm.Module, index int) []string {
+	d, err := disasm.Disassemble(m.FunctionIndexSpace[index], m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, in := range d.Code {
+		if in.Offset >= 0 {
+			names = append(names, in.Op.Name)
+		}
+	}
+	return names
+}
+
+func TestOptimizations(t *testing.T) {
+	code, err := ioutil.ReadFile("../exec/testdata/optimize.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := New(Optimizations()...).Run(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.ReadModule(bytes.NewReader(out), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 6*7 is folded, the true if becomes a block of its then branch, the
+	// true br_if a br, and the code following it is removed
+	want := []string{"get_local", "i32.const", "i32.add", "block", "i32.const", "call", "end", "i32.add", "br"}
+	if run := names(t, m, 2); !reflect.DeepEqual(run, want) {
+		t.Errorf("run=%q", run)
+	}
+	if n, m := len(names(t, before, 2)), len(want); n <= m {
+		t.Errorf("%d instructions before the optimizations, %d after", n, m)
+	}
+	// $helper is called by run, $unused by nothing
+	if helper := names(t, m, 0); !reflect.DeepEqual(helper, []string{"get_local", "i32.const", "i32.add"}) {
+		t.Errorf("helper=%q", helper)
+	}
+	if unused := names(t, m, 1); !reflect.DeepEqual(unused, []string{"unreachable"}) {
+		t.Errorf("unused=%q", unused)
+	}
+
+	// optimizing twice changes nothing
+	if again, err := New(Optimizations()...).Run(out); err != nil || !bytes.Equal(again, out) {
+		t.Errorf("optimizing the output again: %v", err)
+	}
+}
+
+func TestFoldConstants(t *testing.T) {
+	for _, test := range []struct {
+		code, want []byte
+	}{
+		// i32.const -1; i32.const 31; i32.shr_u
+		{[]byte{0x41, 0x7f, 0x41, 0x1f, 0x76}, []byte{0x41, 0x01}},
+		// i64.const 1; i64.const 63; i64.shl; i64.const 0; i64.lt_s
+		{[]byte{0x42, 0x01, 0x42, 0x3f, 0x86, 0x42, 0x00, 0x53}, []byte{0x41, 0x01}},
+		// i32.const 1; i32.const 0; i32.div_u is left as it traps
+		{[]byte{0x41, 0x01, 0x41, 0x00, 0x6e}, nil},
+		// i32.const 0; if; nop; end; i32.const 2
+		{[]byte{0x41, 0x00, 0x04, 0x40, 0x01, 0x0b, 0x41, 0x02}, []byte{0x02, 0x40, 0x0b, 0x41, 0x02}},
+		// i32.const 1; if; nop; else; unreachable; end; i32.const 2
+		{[]byte{0x41, 0x01, 0x04, 0x40, 0x01, 0x05, 0x00, 0x0b, 0x41, 0x02}, []byte{0x02, 0x40, 0x01, 0x0b, 0x41, 0x02}},
+		// block; i32.const 0; br_if 0; end; i32.const 2
+		{[]byte{0x02, 0x40, 0x41, 0x00, 0x0d, 0x00, 0x0b, 0x41, 0x02}, []byte{0x02, 0x40, 0x0b, 0x41, 0x02}},
+	} {
+		m := &wasm.Module{
+			Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{{ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}}},
+			Function: &wasm.SectionFunctions{Types: []uint32{0}},
+			Code:     &wasm.SectionCode{Bodies: []wasm.FunctionBody{{Code: test.code}}},
+		}
+		m.FunctionIndexSpace = []wasm.Function{{Sig: &m.Types.Entries[0], Body: &m.Code.Bodies[0]}}
+		code := append([]byte(nil), test.code...)
+		if err := FoldConstants().Run(m); err != nil {
+			t.Fatal(err)
+		}
+		want := test.want
+		if want == nil {
+			want = code
+		}
+		if got := m.Code.Bodies[0].Code; !bytes.Equal(got, want) {
+			t.Errorf("% x: got % x, want % x", code, got, want)
+		}
+	}
+
+	// the optimizer needs the imported functions in the index space
+	m := &wasm.Module{
+		Import: &wasm.SectionImports{Entries: []wasm.ImportEntry{{ModuleName: "env", FieldName: "f", Kind: wasm.ExternalFunction, Type: wasm.FuncImport{}}}},
+		Code:   &wasm.SectionCode{Bodies: []wasm.FunctionBody{{}}},
+	}
+	m.FunctionIndexSpace = []wasm.Function{{Body: &m.Code.Bodies[0]}}
+	if err := FoldConstants().Run(m); !errors.Is(err, ErrUnresolvedImports) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package transform runs pipelines of passes rewriting modules, such as
+// the injection of the gas metering, instrumentations or optimizations.
+// Every pass receives the decoded module, and may rewrite its function
+// bodies and sections in place: the module is then re-encoded, read back
+// so that its index spaces follow the changes, and validated, before the
+// next pass runs.
+package transform
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// Pass rewrites a decoded module in place.
+type Pass interface {
+	// Name returns the name of the pass, for the errors.
+	Name() string
+	// Run rewrites m. The index spaces of m aren't updated by the changes
+	// until the module is read back, after the pass.
+	Run(m *wasm.Module) error
+}
+
+// PassError is returned for a pass which failed, or which left an invalid
+// module.
+type PassError struct {
+	Pass string
+	Err  error
+}
+
+func (e PassError) Error() string {
+	return fmt.Sprintf("transform: pass %s: %v", e.Pass, e.Err)
+}
+
+func (e PassError) Unwrap() error {
+	return e.Err
+}
+
+// funcPass is the Pass of NewPass.
+type funcPass struct {
+	name string
+	run  func(m *wasm.Module) error
+}
+
+func (p funcPass) Name() string {
+	return p.name
+}
+
+func (p funcPass) Run(m *wasm.Module) error {
+	return p.run(m)
+}
+
+// NewPass returns the pass with the given name running run.
+func NewPass(name string, run func(m *wasm.Module) error) Pass {
+	return funcPass{name, run}
+}
+
+// BinaryPass returns the pass with the given name rewriting the encoding
+// of the module with rewrite, for the rewriters of binary modules, such as
+// exec.InstrumentGas. The module is replaced by the one rewrite returns.
+func BinaryPass(name string, rewrite func(code []byte) ([]byte, error)) Pass {
+	return NewPass(name, func(m *wasm.Module) error {
+		code, err := encode(m)
+		if err != nil {
+			return err
+		}
+		if code, err = rewrite(code); err != nil {
+			return err
+		}
+		out, err := wasm.ReadModule(bytes.NewReader(code), nil)
+		if err != nil {
+			return err
+		}
+		*m = *out
+		return nil
+	})
+}
+
+// StripCustomSections returns the pass removing the custom sections with
+// the given names, or all of them if none is given, such as the debugging
+// information the chain doesn't run.
+func StripCustomSections(names ...string) Pass {
+	return NewPass("strip-custom-sections", func(m *wasm.Module) error {
+		if len(names) == 0 {
+			m.Other = nil
+		}
+		for _, name := range names {
+			m.RemoveCustomSections(name)
+		}
+		return nil
+	})
+}
+
+// Pipeline runs passes in order on modules.
+type Pipeline struct {
+	// Resolve resolves the imports of the modules read, see
+	// wasm.ReadModule. The imports aren't resolved if it is nil.
+	Resolve wasm.ResolveFunc
+
+	passes []Pass
+}
+
+// New returns the pipeline running the given passes.
+func New(passes ...Pass) *Pipeline {
+	return &Pipeline{passes: passes}
+}
+
+// Add appends passes to the ones p runs.
+func (p *Pipeline) Add(passes ...Pass) {
+	p.passes = append(p.passes, passes...)
+}
+
+// Passes returns the names of the passes p runs, in order.
+func (p *Pipeline) Passes() []string {
+	names := make([]string, len(p.passes))
+	for i, pass := range p.passes {
+		names[i] = pass.Name()
+	}
+	return names
+}
+
+// Run runs the passes of p on the binary module code, and returns the
+// module they rewrote. The module is read back and validated after every
+// pass, the errors of which are PassErrors. A pipeline without passes
+// returns code as is.
+func (p *Pipeline) Run(code []byte) ([]byte, error) {
+	m, err := wasm.ReadModule(bytes.NewReader(code), p.Resolve)
+	if err != nil {
+		return nil, err
+	}
+	for _, pass := range p.passes {
+		if err = pass.Run(m); err != nil {
+			return nil, PassError{pass.Name(), err}
+		}
+		if code, err = encode(m); err != nil {
+			return nil, PassError{pass.Name(), err}
+		}
+		if m, err = wasm.ReadModule(bytes.NewReader(code), p.Resolve); err != nil {
+			return nil, PassError{pass.Name(), err}
+		}
+		if err = validate.VerifyModule(m); err != nil {
+			return nil, PassError{pass.Name(), err}
+		}
+	}
+	return code, nil
+}
+
+// encode returns the binary encoding of m.
+func encode(m *wasm.Module) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := m.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package transform
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+func TestPipeline(t *testing.T) {
+	code, err := ioutil.ReadFile("../exec/testdata/dwarf.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := New().Run(code); err != nil || !bytes.Equal(out, code) {
+		t.Errorf("no passes: %v", err)
+	}
+
+	// the passes see the changes of the previous ones
+	var sections [][]string
+	record := NewPass("record", func(m *wasm.Module) error {
+		sections = append(sections, m.CustomSectionNames())
+		return nil
+	})
+	p := New(record, StripCustomSections(".debug_line"), record)
+	p.Add(NewPass("tag", func(m *wasm.Module) error {
+		m.AddCustomSection("transformed", []byte{1})
+		return nil
+	}), StripCustomSections(), record)
+	if names := p.Passes(); !reflect.DeepEqual(names, []string{"record", "strip-custom-sections", "record", "tag", "strip-custom-sections", "record"}) {
+		t.Errorf("passes=%q", names)
+	}
+	out, err := p.Run(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 3 || len(sections[0]) == 0 || len(sections[2]) != 0 {
+		t.Fatalf("custom sections=%q", sections)
+	}
+	for _, name := range sections[1] {
+		if name == ".debug_line" {
+			t.Errorf("custom sections=%q", sections[1])
+		}
+	}
+	m, err := wasm.ReadModule(bytes.NewReader(out), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Other) != 0 || len(out) >= len(code) {
+		t.Errorf("%d custom sections left", len(m.Other))
+	}
+
+	// a pass leaving an invalid function fails the pipeline
+	var passErr PassError
+	_, err = New(NewPass("break", func(m *wasm.Module) error {
+		m.Code.Bodies[0].Code = []byte{0x6a} // i32.add
+		return nil
+	})).Run(code)
+	var validateErr validate.Error
+	if !errors.As(err, &passErr) || passErr.Pass != "break" || !errors.As(err, &validateErr) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	failure := errors.New("failure")
+	if _, err = New(BinaryPass("fail", func([]byte) ([]byte, error) { return nil, failure })).Run(code); !errors.Is(err, failure) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -42,16 +42,35 @@ type Error struct {
 	Offset   int // Byte offset in the bytecode vector where the error occurs.
 	Function int // Index into the function index space for the offending function.
 	Err      error
+	Name     string // The name of the function in the name section, if any.
 }
 
 // Error define the error func
 func (e Error) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("error while validating function %d (%s) at offset %d: %v", e.Function, e.Name, e.Offset, e.Err)
+	}
 	return fmt.Sprintf("error while validating function %d at offset %d: %v", e.Function, e.Offset, e.Err)
 }
 
 // ErrStackUnderflow define the error message
 var ErrStackUnderflow = errors.New("validate: stack underflow")
 
+// ErrTailCallResults is returned when a tail call calls a function whose
+// results differ from the ones of the calling function.
+var ErrTailCallResults = errors.New("validate: tail call results mismatch")
+
+// ErrStackHeight is returned when a block ends with more operands on the
+// stack than its results.
+var ErrStackHeight = errors.New("validate: extra operands at the end of a block")
+
+// ErrUnclosedBlock is returned when the function body ends inside a block.
+var ErrUnclosedBlock = errors.New("validate: block without end")
+
+// ErrMissingElse is returned for an if without else whose results differ
+// from its parameters.
+var ErrMissingElse = errors.New("validate: if without else changes the types of the stack")
+
 // InvalidImmediateError define invalid immediate error
 type InvalidImmediateError struct {
 	ImmType string
@@ -99,6 +118,13 @@ func (e InvalidTypeError) Error() string {
 	return fmt.Sprintf("invalid type, got: %v, wanted: %v", e.Got, e.Wanted)
 }
 
+// ImmutableGlobalError is returned when setting an immutable global.
+type ImmutableGlobalError uint32
+
+func (e ImmutableGlobalError) Error() string {
+	return fmt.Sprintf("global %d is immutable", uint32(e))
+}
+
 // InvalidElementIndexError define invalid element index error
 type InvalidElementIndexError uint32
 
@@ -107,6 +133,13 @@ func (e InvalidElementIndexError) Error() string {
 	return fmt.Sprintf("invalid element index %d", uint32(e))
 }
 
+// InvalidDataIndexError is returned for an out of range data segment index.
+type InvalidDataIndexError uint32
+
+func (e InvalidDataIndexError) Error() string {
+	return fmt.Sprintf("invalid data segment index %d", uint32(e))
+}
+
 // NoSectionError define section id
 type NoSectionError wasm.SectionID
 
@@ -0,0 +1,79 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+package validate_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// fuzzLimits are the decode limits of the modules validated by
+// FuzzValidate, low enough for a module to be decoded quickly.
+var fuzzLimits = wasm.DecodeLimits{
+	MaxModuleSize:     1 << 20,
+	MaxFunctions:      1 << 10,
+	MaxLocalsPerFunc:  1 << 10,
+	MaxGlobals:        1 << 10,
+	MaxImports:        1 << 10,
+	MaxDataSegments:   1 << 10,
+	MaxBrTableTargets: 1 << 10,
+	MaxNameLength:     1 << 10,
+	MaxTableElements:  1 << 16,
+}
+
+// FuzzValidate validates the arbitrary modules the decoder accepts, with
+// and without a policy, which may reject them but never panic.
+func FuzzValidate(f *testing.F) {
+	for _, pattern := range []string{"../exec/testdata/*.wasm", "../exec/testdata/spec/*.wasm", "../wasm/testdata/*.wasm"} {
+		files, err := filepath.Glob(filepath.FromSlash(pattern))
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, name := range files {
+			raw, err := ioutil.ReadFile(name)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(raw)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := wasm.ReadModuleWithLimits(bytes.NewReader(data), nil, fuzzLimits)
+		if err != nil {
+			return
+		}
+		err = validate.VerifyModule(m)
+		violations, policyErr := validate.VerifyModuleWithPolicy(m, validate.Policy{
+			NoFloats:       true,
+			NoSIMD:         true,
+			NoThreads:      true,
+			MaxMemoryPages: 16,
+		})
+		if (err == nil) != (policyErr == nil) {
+			t.Fatalf("verified with %v, with a policy with %v", err, policyErr)
+		}
+		if policyErr != nil && violations != nil {
+			t.Fatalf("violations of an invalid module: %v", violations)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package validate
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// validateGC checks the immediates and the operands of the GC operator op,
+// the operands of the operators whose types don't depend on immediates
+// being already checked.
+func (vm *mockVM) validateGC(op ops.Op) error {
+	if !op.Polymorphic {
+		return nil
+	}
+	switch op.Sub {
+	case ops.RefTest, ops.RefTestNull, ops.RefCast, ops.RefCastNull:
+		heap, err := vm.fetchVarInt()
+		if err != nil {
+			return err
+		}
+		t := wasm.ValueType(heap)
+		if !t.IsRef() || !vm.validType(t) {
+			return InvalidImmediateError{"heap type", op.Name}
+		}
+		if err := vm.popTypes(vm.topType(t)); err != nil {
+			return err
+		}
+		if op.Sub == ops.RefTest || op.Sub == ops.RefTestNull {
+			vm.pushOperand(wasm.ValueTypeI32)
+		} else {
+			vm.pushOperand(t)
+		}
+		return nil
+	}
+
+	index, err := vm.fetchVarUint()
+	if err != nil {
+		return err
+	}
+	if vm.module.Types == nil || int(index) >= len(vm.module.Types.Entries) {
+		return wasm.InvalidTypeIndexError(index)
+	}
+	sig := &vm.module.Types.Entries[index]
+	ref := wasm.ValueType(index)
+
+	switch op.Sub {
+	case ops.StructNew, ops.StructNewDefault, ops.StructGet, ops.StructGetS, ops.StructGetU, ops.StructSet:
+		if !sig.IsStruct() {
+			return InvalidImmediateError{"struct type index", op.Name}
+		}
+	default:
+		if !sig.IsArray() {
+			return InvalidImmediateError{"array type index", op.Name}
+		}
+	}
+
+	switch op.Sub {
+	case ops.StructNew:
+		for i := range sig.Fields {
+			if err := vm.popTypes(sig.Fields[len(sig.Fields)-1-i].Type.Unpacked()); err != nil {
+				return err
+			}
+		}
+		vm.pushOperand(ref)
+	case ops.StructNewDefault:
+		vm.pushOperand(ref)
+	case ops.StructGet, ops.StructGetS, ops.StructGetU, ops.StructSet:
+		field, err := vm.fetchVarUint()
+		if err != nil {
+			return err
+		}
+		if int(field) >= len(sig.Fields) {
+			return InvalidImmediateError{"field index", op.Name}
+		}
+		f := sig.Fields[field]
+		if op.Sub == ops.StructSet {
+			if !f.Mutable {
+				return InvalidImmediateError{"mutable field", op.Name}
+			}
+			return vm.popTypes(f.Type.Unpacked(), ref)
+		}
+		if err := vm.checkPacked(op, f.Type); err != nil {
+			return err
+		}
+		if err := vm.popTypes(ref); err != nil {
+			return err
+		}
+		vm.pushOperand(f.Type.Unpacked())
+	case ops.ArrayNew, ops.ArrayNewDefault, ops.ArrayNewFixed:
+		elem := sig.Fields[0].Type.Unpacked()
+		switch op.Sub {
+		case ops.ArrayNew:
+			err = vm.popTypes(wasm.ValueTypeI32, elem)
+		case ops.ArrayNewDefault:
+			err = vm.popTypes(wasm.ValueTypeI32)
+		default:
+			var n uint32
+			if n, err = vm.fetchVarUint(); err != nil {
+				return err
+			}
+			for i := uint32(0); i < n && err == nil; i++ {
+				err = vm.popTypes(elem)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		vm.pushOperand(ref)
+	case ops.ArrayGet, ops.ArrayGetS, ops.ArrayGetU:
+		if err := vm.checkPacked(op, sig.Fields[0].Type); err != nil {
+			return err
+		}
+		if err := vm.popTypes(wasm.ValueTypeI32, ref); err != nil {
+			return err
+		}
+		vm.pushOperand(sig.Fields[0].Type.Unpacked())
+	case ops.ArraySet, ops.ArrayFill, ops.ArrayCopy:
+		if !sig.Fields[0].Mutable {
+			return InvalidImmediateError{"mutable array", op.Name}
+		}
+		elem := sig.Fields[0].Type.Unpacked()
+		switch op.Sub {
+		case ops.ArraySet:
+			return vm.popTypes(elem, wasm.ValueTypeI32, ref)
+		case ops.ArrayFill:
+			return vm.popTypes(wasm.ValueTypeI32, elem, wasm.ValueTypeI32, ref)
+		}
+		src, err := vm.fetchVarUint()
+		if err != nil {
+			return err
+		}
+		if int(src) >= len(vm.module.Types.Entries) || !vm.module.Types.Entries[src].IsArray() {
+			return InvalidImmediateError{"array type index", op.Name}
+		}
+		srcElem := vm.module.Types.Entries[src].Fields[0].Type
+		if srcElem != sig.Fields[0].Type && !vm.subtype(srcElem, sig.Fields[0].Type) {
+			return InvalidTypeError{sig.Fields[0].Type, srcElem}
+		}
+		return vm.popTypes(wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueType(src), wasm.ValueTypeI32, ref)
+	}
+	return nil
+}
+
+// checkPacked returns an error if the sign extension of the get operator
+// op doesn't match whether the field of type t is packed: only the packed
+// fields are read by the _s and _u operators.
+func (vm *mockVM) checkPacked(op ops.Op, t wasm.ValueType) error {
+	packed := t != t.Unpacked()
+	plain := op.Sub == ops.StructGet || op.Sub == ops.ArrayGet
+	if packed == plain {
+		return InvalidImmediateError{"field of packed type if and only if extended", op.Name}
+	}
+	return nil
+}
+
+// topType returns the reference type every reference of the hierarchy of
+// t is a subtype of: anyref, funcref or externref.
+func (vm *mockVM) topType(t wasm.ValueType) wasm.ValueType {
+	switch {
+	case t >= 0:
+		if sig := vm.module.Types.Entries[t]; sig.IsStruct() || sig.IsArray() {
+			return wasm.ValueTypeAnyref
+		}
+		return wasm.ValueTypeFuncref
+	case t == wasm.ValueTypeFuncref, t == wasm.ValueTypeNullfuncref:
+		return wasm.ValueTypeFuncref
+	case t == wasm.ValueTypeExternref, t == wasm.ValueTypeNullexternref:
+		return wasm.ValueTypeExternref
+	}
+	return wasm.ValueTypeAnyref
+}
@@ -0,0 +1,163 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// Policy restricts the features a module may use beyond the ones it needs
+// to be valid, for the deployments which can't afford the constructs whose
+// results differ between platforms, such as the NaNs produced by floating
+// point instructions.
+type Policy struct {
+	// NoFloats rejects the f32 and f64 value types, and the instructions
+	// operating on floats, the SIMD ones on float lanes included.
+	NoFloats bool
+	// NoSIMD rejects the v128 value type and the SIMD instructions.
+	NoSIMD bool
+	// NoThreads rejects the shared memories and the atomic instructions.
+	NoThreads bool
+	// MaxMemoryPages, if not zero, is the maximum size in pages the
+	// memories must declare, which memory.grow can't grow them past.
+	MaxMemoryPages uint32
+}
+
+// PolicyError is a construct of a module breaking a Policy.
+type PolicyError struct {
+	// Function is the index of the function using the construct, and
+	// Offset the offset of its instruction in the body, or -1 for the
+	// constructs outside of the code.
+	Function int
+	Offset   int
+	Reason   string
+}
+
+func (e PolicyError) Error() string {
+	if e.Function < 0 {
+		return fmt.Sprintf("validate: policy violation: %s", e.Reason)
+	}
+	return fmt.Sprintf("validate: policy violation in function %d at offset %d: %s", e.Function, e.Offset, e.Reason)
+}
+
+// VerifyModuleWithPolicy verifies module like VerifyModule, and returns the
+// constructs of the valid module breaking policy: the ones outside of the
+// code first, then the instructions by function index and offset.
+func VerifyModuleWithPolicy(module *wasm.Module, policy Policy) ([]PolicyError, error) {
+	violations := policy.CheckModule(module)
+	err := verifyModule(module, &policy, func(fn int, found []PolicyError) {
+		for _, v := range found {
+			v.Function = fn
+			violations = append(violations, v)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return violations, nil
+}
+
+// VerifyFunctionWithPolicy verifies the function of module with the given
+// index like VerifyFunction, and returns the instructions of the valid
+// function breaking policy, by offset. The constructs of the module outside
+// of the code are left to Policy.CheckModule.
+func VerifyFunctionWithPolicy(module *wasm.Module, index int, policy Policy) ([]PolicyError, error) {
+	return verifyFunction(module, index, &policy)
+}
+
+// CheckModule returns the violations of p outside of the code of module,
+// the ones VerifyModuleWithPolicy returns first.
+func (p *Policy) CheckModule(module *wasm.Module) []PolicyError {
+	var violations []PolicyError
+	flag := func(format string, args ...interface{}) {
+		violations = append(violations, PolicyError{Function: -1, Offset: -1, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	if module.Types != nil {
+		for i, sig := range module.Types.Entries {
+			for _, t := range append(append([]wasm.ValueType{}, sig.ParamTypes...), sig.ReturnTypes...) {
+				if reason := p.valueType(t); reason != "" {
+					flag("type %d uses %s", i, reason)
+					break
+				}
+			}
+		}
+	}
+	for i, global := range module.GlobalIndexSpace {
+		if global.Type == nil {
+			continue
+		}
+		if reason := p.valueType(global.Type.Type); reason != "" {
+			flag("global %d uses %s", i, reason)
+		}
+	}
+	for i, fn := range module.FunctionIndexSpace {
+		if fn.Body == nil {
+			continue
+		}
+		for _, entry := range fn.Body.Locals {
+			if reason := p.valueType(entry.Type); reason != "" {
+				flag("local of function %d uses %s", i, reason)
+				break
+			}
+		}
+	}
+	for i, memory := range module.Memories() {
+		limits := memory.Limits
+		if p.NoThreads && limits.Shared() {
+			flag("memory %d is shared", i)
+		}
+		if p.MaxMemoryPages != 0 && (limits.Flags&0x1 == 0 || limits.Maximum > p.MaxMemoryPages) {
+			flag("memory %d may grow past %d pages", i, p.MaxMemoryPages)
+		}
+	}
+	return violations
+}
+
+// valueType returns why p forbids t, or an empty string.
+func (p *Policy) valueType(t wasm.ValueType) string {
+	switch {
+	case p.NoFloats && (t == wasm.ValueTypeF32 || t == wasm.ValueTypeF64):
+		return "floats"
+	case p.NoSIMD && t == wasm.ValueTypeV128:
+		return "SIMD"
+	}
+	return ""
+}
+
+// checkOp records the violation of vm.policy by the instruction op
+// starting at offset pc.
+func (vm *mockVM) checkOp(op ops.Op, pc int) {
+	p := vm.policy
+	var reason string
+	switch {
+	case p.NoFloats && (strings.Contains(op.Name, "f32") || strings.Contains(op.Name, "f64")):
+		reason = "floats"
+	case p.NoSIMD && op.Code == ops.PrefixSIMD:
+		reason = "SIMD"
+	case p.NoThreads && op.Code == ops.PrefixAtomic:
+		reason = "threads"
+	default:
+		return
+	}
+	vm.violations = append(vm.violations, PolicyError{Offset: pc, Reason: fmt.Sprintf("%s uses %s", op.Name, reason)})
+}
@@ -33,14 +33,21 @@ package validate
 import (
 	"bytes"
 	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
 
+	"github.com/bottos-project/bottos/vm/wasm/log"
 	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
 	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
-	log "github.com/cihub/seelog"
 )
 
-// vibhavp: TODO: We do not verify whether blocks don't access for the parent block, do that.
-func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Module) (*mockVM, error) {
+func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Module, policy *Policy) (*mockVM, error) {
+	// the errors decoding a body read lazily are at its start
+	if err := body.Decode(); err != nil {
+		return &mockVM{code: bytes.NewReader(nil)}, err
+	}
 	vm := &mockVM{
 		stack:    []operand{},
 		stackTop: 0,
@@ -51,6 +58,13 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 		polymorphic: false,
 		blocks:      []block{},
 		curFunc:     fn,
+		module:      module,
+		policy:      policy,
+	}
+	vm.memories = module.Memories()
+	vm.leb = vm.code
+	if module.DecodeLimits().StrictLEB128 {
+		vm.leb = leb128.StrictReader{Reader: vm.code}
 	}
 
 	localVariables := []operand{}
@@ -71,6 +85,7 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 	}
 
 	for {
+		start := vm.pc()
 		op, err := vm.code.ReadByte()
 		if err == io.EOF {
 			break
@@ -79,9 +94,22 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 		}
 
 		opStruct, err := ops.New(op)
+		if op == ops.PrefixMisc || op == ops.PrefixSIMD || op == ops.PrefixAtomic || op == ops.PrefixGC {
+			var sub uint32
+			if sub, err = vm.fetchVarUint(); err != nil {
+				return vm, err
+			}
+			opStruct, err = ops.NewPrefixed(op, sub)
+		}
 		if err != nil {
 			return vm, err
 		}
+		if opStruct, err = vm.memoryOp(opStruct); err != nil {
+			return vm, err
+		}
+		if vm.policy != nil {
+			vm.checkOp(opStruct, start)
+		}
 
 		log.Trace("PC: %d OP: %s polymorphic: %v", vm.pc(), opStruct.Name, vm.isPolymorphic())
 
@@ -92,19 +120,33 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 		}
 
 		switch op {
-		case ops.If, ops.Block, ops.Loop:
-			sig, err := vm.fetchVarInt()
+		case ops.If, ops.Block, ops.Loop, ops.Try:
+			blockType, err := wasm.ReadBlockType(vm.leb)
 			if err != nil {
 				return vm, err
 			}
 
-			switch wasm.ValueType(sig) {
-			case wasm.ValueTypeI32, wasm.ValueTypeI64, wasm.ValueTypeF32, wasm.ValueTypeF64, wasm.ValueType(wasm.BlockTypeEmpty):
-				vm.pushBlock(op, wasm.BlockType(sig))
-			default:
+			params, results, err := blockType.Signature(module)
+			if err != nil {
+				return vm, err
+			}
+			if blockType < 0 && blockType != wasm.BlockTypeEmpty && !vm.validType(results[0]) {
 				if !vm.isPolymorphic() {
 					return vm, InvalidImmediateError{"block_type", opStruct.Name}
 				}
+				continue
+			}
+
+			// the parameters of the block are moved to its own stack
+			if err := vm.checkTop(params); !vm.isPolymorphic() && err != nil {
+				return vm, err
+			}
+			for range params {
+				vm.popOperand()
+			}
+			vm.pushBlock(op, blockType, params, results)
+			for _, t := range params {
+				vm.pushOperand(t)
 			}
 
 		case ops.Else:
@@ -113,32 +155,69 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 				return vm, UnmatchedOpError(op)
 			}
 
-			if block.blockType != wasm.BlockTypeEmpty {
-				top, under := vm.topOperand()
-				if !vm.isPolymorphic() && (under || top.Type != wasm.ValueType(block.blockType)) {
-					return vm, InvalidTypeError{wasm.ValueType(block.blockType), top.Type}
-				}
-				vm.pushOperand(wasm.ValueType(block.blockType))
+			if err := vm.checkHeight(block.results); err != nil {
+				return vm, err
 			}
+			// the else branch starts again with the parameters of the
+			// block
 			vm.stackTop = block.stackTop
-		case ops.End:
-			isPolymorphic := vm.isPolymorphic()
-
-			block := vm.popBlock()
-			if block == nil {
+			block.op = op
+			block.polymorphic = false
+			for _, t := range block.params {
+				vm.pushOperand(t)
+			}
+		case ops.Catch, ops.CatchAll:
+			block := vm.topBlock()
+			if block == nil || block.op != ops.Try && block.op != ops.Catch {
 				return vm, UnmatchedOpError(op)
 			}
+			var params []wasm.ValueType
+			if op == ops.Catch {
+				tag, err := vm.fetchTag(module)
+				if err != nil {
+					return vm, err
+				}
+				params = tag.ParamTypes
+			}
 
-			if block.blockType != wasm.BlockTypeEmpty {
-				top, under := vm.topOperand()
-				if !isPolymorphic && (under || top.Type != wasm.ValueType(block.blockType)) {
-					return vm, InvalidTypeError{wasm.ValueType(block.blockType), top.Type}
+			if err := vm.checkHeight(block.results); err != nil {
+				return vm, err
+			}
+			// the handler starts with the values of the exception
+			vm.stackTop = block.stackTop
+			block.op = op
+			block.polymorphic = false
+			for _, t := range params {
+				vm.pushOperand(t)
+			}
+		case ops.End, ops.Delegate:
+			block := vm.topBlock()
+			if block == nil || op == ops.Delegate && block.op != ops.Try {
+				return vm, UnmatchedOpError(op)
+			}
+			if op == ops.Delegate {
+				// the label is one of the blocks enclosing the try
+				// block, or the function
+				depth, err := vm.fetchVarUint()
+				if err != nil {
+					return vm, err
 				}
-				vm.stackTop = block.stackTop
-				vm.pushOperand(wasm.ValueType(block.blockType))
-				vm.stackTop = block.stackTop + 1 // as we pushed an element
-			} else {
-				vm.stackTop = block.stackTop
+				if int(depth) >= len(vm.blocks) {
+					return vm, InvalidLabelError(depth)
+				}
+			}
+
+			if err := vm.checkHeight(block.results); err != nil {
+				return vm, err
+			}
+			// an if without else leaves its parameters as results
+			if block.op == ops.If && !sameTypes(block.params, block.results) {
+				return vm, ErrMissingElse
+			}
+			block = vm.popBlock()
+			vm.stackTop = block.stackTop
+			for _, t := range block.results {
+				vm.pushOperand(t)
 			}
 
 		case ops.BrIf, ops.Br:
@@ -185,19 +264,38 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			vm.setPolymorphic()
 
 		case ops.Return:
-			if len(fn.ReturnTypes) > 1 {
-				panic("not implemented")
+			if err := vm.checkTop(fn.ReturnTypes); !vm.isPolymorphic() && err != nil {
+				return vm, err
 			}
-			if len(fn.ReturnTypes) != 0 {
-				// only single returns supported for now
-				top, under := vm.popOperand()
-				if !vm.isPolymorphic() && (under || top.Type != fn.ReturnTypes[0]) {
-					return vm, InvalidTypeError{fn.ReturnTypes[0], top.Type}
+			vm.setPolymorphic()
+
+		case ops.Unreachable:
+			vm.setPolymorphic()
+
+		case ops.Throw:
+			tag, err := vm.fetchTag(module)
+			if err != nil {
+				return vm, err
+			}
+			for i := range tag.ParamTypes {
+				argType := tag.ParamTypes[len(tag.ParamTypes)-1-i]
+				operand, under := vm.popOperand()
+				if !vm.isPolymorphic() && (under || !vm.subtype(operand.Type, argType)) {
+					return vm, InvalidTypeError{argType, operand.Type}
 				}
 			}
 			vm.setPolymorphic()
 
-		case ops.Unreachable:
+		case ops.Rethrow:
+			// the label must be the one of a handler
+			depth, err := vm.fetchVarUint()
+			if err != nil {
+				return vm, err
+			}
+			block := vm.getBlockFromDepth(int(depth))
+			if block == nil || block.op != ops.Catch && block.op != ops.CatchAll {
+				return vm, InvalidLabelError(depth)
+			}
 			vm.setPolymorphic()
 
 		case ops.I32Const:
@@ -235,7 +333,7 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 				vm.pushOperand(v.Type)
 			} else { // == set_local or tee_local
 				top, under := vm.popOperand()
-				if !vm.isPolymorphic() && (under || top.Type != v.Type) {
+				if !vm.isPolymorphic() && (under || !vm.subtype(top.Type, v.Type)) {
 					return vm, InvalidTypeError{v.Type, top.Type}
 				}
 				if op == ops.TeeLocal {
@@ -256,31 +354,46 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			if op == ops.GetGlobal {
 				vm.pushOperand(gv.Type.Type)
 			} else {
+				if !gv.Type.Mutable {
+					return vm, ImmutableGlobalError(index)
+				}
 				val, under := vm.popOperand()
-				if !vm.isPolymorphic() && (under || val.Type != gv.Type.Type) {
+				if !vm.isPolymorphic() && (under || !vm.subtype(val.Type, gv.Type.Type)) {
 					return vm, InvalidTypeError{gv.Type.Type, val.Type}
 				}
 			}
 
 		case ops.I32Load, ops.I64Load, ops.F32Load, ops.F64Load, ops.I32Load8s, ops.I32Load8u, ops.I32Load16s, ops.I32Load16u, ops.I64Load8s, ops.I64Load8u, ops.I64Load16s, ops.I64Load16u, ops.I64Load32s, ops.I64Load32u, ops.I32Store, ops.I64Store, ops.F32Store, ops.F64Store, ops.I32Store8, ops.I32Store16, ops.I64Store8, ops.I64Store16, ops.I64Store32:
 			// read memory_immediate
-			// flags
-			_, err := vm.fetchVarUint()
-			if err != nil {
+			if _, err := vm.fetchMemArg(); err != nil {
 				return vm, err
 			}
-			// offset
-			_, err = vm.fetchVarUint()
-			if err != nil {
+		case ops.CurrentMemory, ops.GrowMemory:
+			if err := vm.fetchMemoryIndex(opStruct); err != nil {
 				return vm, err
 			}
-		case ops.CurrentMemory, ops.GrowMemory:
-			_, err := vm.fetchVarUint()
-			if err != nil {
+
+		case ops.PrefixMisc:
+			if err := vm.validateMisc(opStruct, module); err != nil {
+				return vm, err
+			}
+
+		case ops.PrefixSIMD:
+			if err := vm.validateSIMD(opStruct); err != nil {
 				return vm, err
 			}
 
-		case ops.Call:
+		case ops.PrefixAtomic:
+			if err := vm.validateAtomic(opStruct); err != nil {
+				return vm, err
+			}
+
+		case ops.PrefixGC:
+			if err := vm.validateGC(opStruct); err != nil {
+				return vm, err
+			}
+
+		case ops.Call, ops.ReturnCall:
 			index, err := vm.fetchVarUint()
 			if err != nil {
 				return vm, err
@@ -295,17 +408,23 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			for index := range fn.Sig.ParamTypes {
 				argType := fn.Sig.ParamTypes[len(fn.Sig.ParamTypes)-index-1]
 				operand, under := vm.popOperand()
-				if !vm.isPolymorphic() && (under || operand.Type != argType) {
+				if !vm.isPolymorphic() && (under || !vm.subtype(operand.Type, argType)) {
 					return vm, InvalidTypeError{argType, operand.Type}
 				}
 			}
 
-			if len(fn.Sig.ReturnTypes) > 0 {
-				vm.pushOperand(fn.Sig.ReturnTypes[0])
+			if op == ops.ReturnCall {
+				if err := vm.tailCall(fn.Sig.ReturnTypes); err != nil {
+					return vm, err
+				}
+				break
+			}
+			for _, t := range fn.Sig.ReturnTypes {
+				vm.pushOperand(t)
 			}
 
-		case ops.CallIndirect:
-			if module.Table == nil || len(module.Table.Entries) == 0 {
+		case ops.CallIndirect, ops.ReturnCallIndirect:
+			if len(module.Tables()) == 0 {
 				return vm, NoSectionError(wasm.SectionIDTable)
 			}
 			// The call_indirect process consists of getting two i32 values
@@ -324,6 +443,17 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			if err != nil {
 				return vm, err
 			}
+			if int(index) >= len(module.Types.Entries) {
+				return vm, wasm.InvalidTypeIndexError(index)
+			}
+			// the table index, which must hold functions
+			table, err := vm.fetchTableIndex(module)
+			if err != nil {
+				return vm, err
+			}
+			if !vm.subtype(wasm.ValueType(table.ElementType), wasm.ValueTypeFuncref) {
+				return vm, InvalidTypeError{wasm.ValueTypeFuncref, wasm.ValueType(table.ElementType)}
+			}
 
 			fnExpectSig := module.Types.Entries[index]
 
@@ -334,13 +464,53 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 			for index := range fnExpectSig.ParamTypes {
 				argType := fnExpectSig.ParamTypes[len(fnExpectSig.ParamTypes)-index-1]
 				operand, under := vm.popOperand()
-				if !vm.isPolymorphic() && (under || (operand.Type != argType)) {
+				if !vm.isPolymorphic() && (under || !vm.subtype(operand.Type, argType)) {
 					return vm, InvalidTypeError{argType, operand.Type}
 				}
 			}
 
-			if len(fnExpectSig.ReturnTypes) > 0 {
-				vm.pushOperand(fnExpectSig.ReturnTypes[0])
+			if op == ops.ReturnCallIndirect {
+				if err := vm.tailCall(fnExpectSig.ReturnTypes); err != nil {
+					return vm, err
+				}
+				break
+			}
+			for _, t := range fnExpectSig.ReturnTypes {
+				vm.pushOperand(t)
+			}
+
+		case ops.CallRef, ops.ReturnCallRef:
+			index, err := vm.fetchVarUint()
+			if err != nil {
+				return vm, err
+			}
+			if module.Types == nil || int(index) >= len(module.Types.Entries) {
+				return vm, wasm.InvalidTypeIndexError(index)
+			}
+			sig := module.Types.Entries[index]
+			if sig.IsStruct() || sig.IsArray() {
+				return vm, InvalidImmediateError{"function type index", opStruct.Name}
+			}
+
+			if operand, under := vm.popOperand(); !vm.isPolymorphic() && (under || !vm.subtype(operand.Type, wasm.ValueType(index))) {
+				return vm, InvalidTypeError{wasm.ValueType(index), operand.Type}
+			}
+			for index := range sig.ParamTypes {
+				argType := sig.ParamTypes[len(sig.ParamTypes)-index-1]
+				operand, under := vm.popOperand()
+				if !vm.isPolymorphic() && (under || !vm.subtype(operand.Type, argType)) {
+					return vm, InvalidTypeError{argType, operand.Type}
+				}
+			}
+
+			if op == ops.ReturnCallRef {
+				if err := vm.tailCall(sig.ReturnTypes); err != nil {
+					return vm, err
+				}
+				break
+			}
+			for _, t := range sig.ReturnTypes {
+				vm.pushOperand(t)
 			}
 
 		case ops.Drop:
@@ -348,39 +518,181 @@ func verifyBody(fn *wasm.FunctionSig, body *wasm.FunctionBody, module *wasm.Modu
 				return vm, ErrStackUnderflow
 			}
 
-		case ops.Select:
-			if vm.isPolymorphic() {
-				continue
+		case ops.Select, ops.SelectTyped:
+			var t wasm.ValueType
+			if op == ops.SelectTyped {
+				n, err := vm.fetchVarUint()
+				if err != nil {
+					return vm, err
+				}
+				if n != 1 {
+					return vm, InvalidImmediateError{"a single value type", opStruct.Name}
+				}
+				if t, err = wasm.ReadValueType(vm.leb); err != nil {
+					return vm, err
+				}
+				if !vm.validType(t) {
+					return vm, InvalidImmediateError{"value type", opStruct.Name}
+				}
 			}
-			operands := make([]operand, 2)
 			c, under := vm.popOperand()
-			if under || c.Type != wasm.ValueTypeI32 {
+			if !vm.isPolymorphic() && under || !under && c.Type != wasm.ValueTypeI32 {
 				return vm, InvalidTypeError{wasm.ValueTypeI32, c.Type}
 			}
 
+			// a polymorphic stack may lack the operands
+			var operands []operand
 			for i := 0; i < 2; i++ {
 				operand, under := vm.popOperand()
-				if !vm.isPolymorphic() && under {
-					return vm, ErrStackUnderflow
+				if under {
+					if !vm.isPolymorphic() {
+						return vm, ErrStackUnderflow
+					}
+					continue
 				}
-				operands[i] = operand
+				operands = append(operands, operand)
 			}
 
+			// references can only be selected by a typed select, whose
+			// operands may be subtypes of its type
+			if op == ops.SelectTyped {
+				for _, operand := range operands {
+					if !vm.subtype(operand.Type, t) {
+						return vm, InvalidTypeError{t, operand.Type}
+					}
+				}
+				vm.pushOperand(t)
+				break
+			}
 			// last 2 popped values should be of the same type
-			if operands[0].Type != operands[1].Type {
-				return vm, InvalidTypeError{operands[1].Type, operands[2].Type}
+			if len(operands) == 2 && operands[0].Type != operands[1].Type {
+				return vm, InvalidTypeError{operands[1].Type, operands[0].Type}
+			}
+			if len(operands) == 0 {
+				break
+			}
+			if operands[0].Type.IsRef() {
+				return vm, InvalidImmediateError{"a value type", opStruct.Name}
+			}
+
+			vm.pushOperand(operands[0].Type)
+
+		case ops.RefNull:
+			sig, err := vm.fetchVarInt()
+			if err != nil {
+				return vm, err
+			}
+			if t := wasm.ValueType(sig); !t.IsRef() || !vm.validType(t) {
+				return vm, InvalidImmediateError{"reference type", opStruct.Name}
+			}
+			vm.pushOperand(wasm.ValueType(sig))
+
+		case ops.RefIsNull:
+			if ref, under := vm.popOperand(); !vm.isPolymorphic() && (under || !ref.Type.IsRef()) {
+				return vm, InvalidTypeError{wasm.ValueTypeFuncref, ref.Type}
 			}
+			vm.pushOperand(wasm.ValueTypeI32)
 
-			vm.pushOperand(operands[1].Type)
+		case ops.RefFunc:
+			index, err := vm.fetchVarUint()
+			if err != nil {
+				return vm, err
+			}
+			if module.GetFunction(int(index)) == nil {
+				return vm, wasm.InvalidFunctionIndexError(index)
+			}
+			// the reference has the type of the function
+			if t, ok := module.FunctionType(int(index)); ok {
+				vm.popOperand()
+				vm.pushOperand(wasm.ValueType(t))
+			}
+
+		case ops.RefAsNonNull:
+			ref, under := vm.popOperand()
+			if !vm.isPolymorphic() && (under || !ref.Type.IsRef()) {
+				return vm, InvalidTypeError{wasm.ValueTypeFuncref, ref.Type}
+			}
+			vm.pushOperand(ref.Type)
+
+		case ops.BrOnNull, ops.BrOnNonNull:
+			depth, err := vm.fetchVarUint()
+			if err != nil {
+				return vm, err
+			}
+			ref, under := vm.popOperand()
+			if !vm.isPolymorphic() && (under || !ref.Type.IsRef()) {
+				return vm, InvalidTypeError{wasm.ValueTypeFuncref, ref.Type}
+			}
+			// br_on_null branches without the reference, and
+			// br_on_non_null with it
+			if op == ops.BrOnNonNull {
+				vm.pushOperand(ref.Type)
+			}
+			if err = vm.canBranch(int(depth)); !vm.isPolymorphic() && err != nil {
+				return vm, err
+			}
+			if op == ops.BrOnNull {
+				vm.pushOperand(ref.Type)
+			} else {
+				vm.popOperand()
+			}
+
+		case ops.TableGet, ops.TableSet:
+			table, err := vm.fetchTableIndex(module)
+			if err != nil {
+				return vm, err
+			}
+			t := wasm.ValueType(table.ElementType)
+			if op == ops.TableSet {
+				if err := vm.popTypes(t, wasm.ValueTypeI32); err != nil {
+					return vm, err
+				}
+			} else {
+				if err := vm.popTypes(wasm.ValueTypeI32); err != nil {
+					return vm, err
+				}
+				vm.pushOperand(t)
+			}
 		}
 	}
 
+	// the end of the function body is the end of its implicit block
+	if len(vm.blocks) != 0 {
+		return vm, ErrUnclosedBlock
+	}
+	if err := vm.checkHeight(fn.ReturnTypes); err != nil {
+		return vm, err
+	}
 	return vm, nil
 }
 
+// sameTypes returns whether a and b are the same list of types.
+func sameTypes(a, b []wasm.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // VerifyModule verifies the given module according to WebAssembly verification
 // specs.
 func VerifyModule(module *wasm.Module) error {
+	return verifyModule(module, nil, nil)
+}
+
+// verifyModule verifies the functions of module, checking their
+// instructions against policy if it isn't nil. done is called, if not nil,
+// with the violations of policy by each function verified, in order.
+//
+// The functions are verified by GOMAXPROCS workers. The error returned is
+// the one of the function with the lowest index, whatever the order the
+// workers find them in.
+func verifyModule(module *wasm.Module, policy *Policy, done func(fn int, violations []PolicyError)) error {
 	if module.Function == nil || module.Types == nil || len(module.Types.Entries) == 0 {
 		return nil
 	}
@@ -389,12 +701,318 @@ func VerifyModule(module *wasm.Module) error {
 	}
 
 	log.Trace("There are %d functions", len(module.Function.Types))
-	for i, fn := range module.FunctionIndexSpace {
-		if vm, err := verifyBody(fn.Sig, fn.Body, module); err != nil {
-			return Error{vm.pc(), i, err}
+	funcs := module.FunctionIndexSpace
+	results := make([]verifyResult, len(funcs))
+	var (
+		next   int64 = -1
+		failed int64 = int64(len(funcs)) // the lowest index of a failing function
+	)
+	worker := func() {
+		for {
+			i := int(atomic.AddInt64(&next, 1))
+			// the functions past one failing aren't worth verifying
+			if i >= len(funcs) || int64(i) > atomic.LoadInt64(&failed) {
+				return
+			}
+			if funcs[i].EnvFunc {
+				// env functions are provided by the host and have no body
+				continue
+			}
+			vm, err := verifyBody(funcs[i].Sig, funcs[i].Body, module, policy)
+			if err != nil {
+				results[i].err = Error{Offset: vm.pc(), Function: i, Err: err, Name: funcs[i].Name}
+				for {
+					lowest := atomic.LoadInt64(&failed)
+					if int64(i) >= lowest || atomic.CompareAndSwapInt64(&failed, lowest, int64(i)) {
+						break
+					}
+				}
+				continue
+			}
+			results[i].violations = vm.violations
+			log.Trace("No errors in function %d", i)
+		}
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(funcs) {
+		workers = len(funcs)
+	}
+	var wg sync.WaitGroup
+	for w := 1; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
+	}
+	worker()
+	wg.Wait()
+
+	if failed < int64(len(funcs)) {
+		return results[failed].err
+	}
+	if done != nil {
+		for i := range funcs {
+			if !funcs[i].EnvFunc {
+				done(i, results[i].violations)
+			}
+		}
+	}
+	return nil
+}
+
+// VerifyFunction verifies the function of module with the given index in
+// the function index space, like VerifyModule verifies all of them, so
+// that the functions of a module may be verified one by one, when they
+// are first needed.
+func VerifyFunction(module *wasm.Module, index int) error {
+	_, err := verifyFunction(module, index, nil)
+	return err
+}
+
+// verifyFunction verifies the function of module with the given index,
+// checking its instructions against policy if it isn't nil, and returns
+// the violations of policy it found.
+func verifyFunction(module *wasm.Module, index int, policy *Policy) ([]PolicyError, error) {
+	fn := module.GetFunction(index)
+	if fn == nil {
+		return nil, wasm.InvalidFunctionIndexError(index)
+	}
+	if fn.EnvFunc {
+		return nil, nil
+	}
+	vm, err := verifyBody(fn.Sig, fn.Body, module, policy)
+	if err != nil {
+		return nil, Error{Offset: vm.pc(), Function: index, Err: err, Name: fn.Name}
+	}
+	for i := range vm.violations {
+		vm.violations[i].Function = index
+	}
+	return vm.violations, nil
+}
+
+// verifyResult is the outcome of verifying a function body.
+type verifyResult struct {
+	err        error
+	violations []PolicyError
+}
+
+// validateMisc checks the immediates of the bulk memory operator op, whose
+// operands were already checked.
+func (vm *mockVM) validateMisc(op ops.Op, module *wasm.Module) error {
+	switch op.Sub {
+	case ops.MemoryInit, ops.DataDrop:
+		index, err := vm.fetchVarUint()
+		if err != nil {
+			return err
+		}
+		// the data count section allows validating the index before
+		// the data section is read
+		if module.DataCount == nil {
+			return NoSectionError(wasm.SectionIDDataCount)
+		}
+		if index >= module.DataCount.Count {
+			return InvalidDataIndexError(index)
+		}
+		if op.Sub == ops.MemoryInit {
+			return vm.fetchMemoryIndex(op)
+		}
+	case ops.MemoryCopy:
+		if err := vm.fetchMemoryIndex(op); err != nil {
+			return err
+		}
+		return vm.fetchMemoryIndex(op)
+	case ops.MemoryFill:
+		return vm.fetchMemoryIndex(op)
+	case ops.TableInit, ops.ElemDrop:
+		index, err := vm.fetchVarUint()
+		if err != nil {
+			return err
+		}
+		if module.Elements == nil || index >= uint32(len(module.Elements.Entries)) {
+			return InvalidElementIndexError(index)
+		}
+		if op.Sub == ops.TableInit {
+			table, err := vm.fetchTableIndex(module)
+			if err != nil {
+				return err
+			}
+			if t := module.Elements.Entries[index].Type; t != wasm.ValueType(table.ElementType) {
+				return InvalidTypeError{wasm.ValueType(table.ElementType), t}
+			}
+		}
+	case ops.TableCopy:
+		dst, err := vm.fetchTableIndex(module)
+		if err != nil {
+			return err
+		}
+		src, err := vm.fetchTableIndex(module)
+		if err != nil {
+			return err
+		}
+		if src.ElementType != dst.ElementType {
+			return InvalidTypeError{wasm.ValueType(dst.ElementType), wasm.ValueType(src.ElementType)}
+		}
+	case ops.TableGrow, ops.TableSize, ops.TableFill:
+		table, err := vm.fetchTableIndex(module)
+		if err != nil {
+			return err
+		}
+		t := wasm.ValueType(table.ElementType)
+		switch op.Sub {
+		case ops.TableGrow:
+			if err := vm.popTypes(wasm.ValueTypeI32, t); err != nil {
+				return err
+			}
+			vm.pushOperand(wasm.ValueTypeI32)
+		case ops.TableFill:
+			return vm.popTypes(wasm.ValueTypeI32, t, wasm.ValueTypeI32)
 		}
-		log.Trace("No errors in function %d", i)
 	}
+	return nil
+}
+
+// simdAccessSizes are the sizes in bytes of the memory accesses of the
+// SIMD operators, indexed by sub-opcode.
+var simdAccessSizes = map[uint32]uint32{
+	ops.V128Load: 16, ops.V128Store: 16,
+	ops.V128Load8x8S: 8, ops.V128Load8x8U: 8, ops.V128Load16x4S: 8,
+	ops.V128Load16x4U: 8, ops.V128Load32x2S: 8, ops.V128Load32x2U: 8,
+	ops.V128Load8Splat: 1, ops.V128Load16Splat: 2, ops.V128Load32Splat: 4, ops.V128Load64Splat: 8,
+	ops.V128Load8Lane: 1, ops.V128Load16Lane: 2, ops.V128Load32Lane: 4, ops.V128Load64Lane: 8,
+	ops.V128Store8Lane: 1, ops.V128Store16Lane: 2, ops.V128Store32Lane: 4, ops.V128Store64Lane: 8,
+	ops.V128Load32Zero: 4, ops.V128Load64Zero: 8,
+}
 
+// validateSIMD checks the immediates of the SIMD operator op, whose
+// operands were already checked.
+func (vm *mockVM) validateSIMD(op ops.Op) error {
+	lanes := uint32(0)
+	if size, ok := simdAccessSizes[op.Sub]; ok {
+		// the alignment, as a power of two, can't exceed the access size
+		align, err := vm.fetchMemArg()
+		if err != nil {
+			return err
+		}
+		if align > 31 || 1<<align > size {
+			return InvalidImmediateError{"an alignment up to the access size", op.Name}
+		}
+		if op.Sub >= ops.V128Load8Lane && op.Sub <= ops.V128Store64Lane {
+			lanes = 16 / size
+		}
+	}
+
+	switch {
+	case op.Sub == ops.V128Const:
+		_, err := vm.fetchBytes(16)
+		return err
+	case op.Sub == ops.I8x16Shuffle:
+		indices, err := vm.fetchBytes(16)
+		if err != nil {
+			return err
+		}
+		for _, i := range indices {
+			if i >= 32 {
+				return InvalidImmediateError{"lane indices below 32", op.Name}
+			}
+		}
+		return nil
+	case op.Sub >= ops.I8x16ExtractLaneS && op.Sub <= ops.I8x16ReplaceLane:
+		lanes = 16
+	case op.Sub >= ops.I16x8ExtractLaneS && op.Sub <= ops.I16x8ReplaceLane:
+		lanes = 8
+	case op.Sub >= ops.I32x4ExtractLane && op.Sub <= ops.I32x4ReplaceLane,
+		op.Sub >= ops.F32x4ExtractLane && op.Sub <= ops.F32x4ReplaceLane:
+		lanes = 4
+	case op.Sub >= ops.I64x2ExtractLane && op.Sub <= ops.I64x2ReplaceLane,
+		op.Sub >= ops.F64x2ExtractLane && op.Sub <= ops.F64x2ReplaceLane:
+		lanes = 2
+	}
+	if lanes == 0 {
+		return nil
+	}
+	lane, err := vm.code.ReadByte()
+	if err != nil {
+		return err
+	}
+	if uint32(lane) >= lanes {
+		return InvalidImmediateError{"a lane index below the lane count", op.Name}
+	}
+	return nil
+}
+
+// atomicAlignments are the alignments, as powers of two, of the memory
+// accesses of the atomic loads, stores and read-modify-write operators, in
+// the order of their sub-opcodes.
+var atomicAlignments = [7]uint32{2, 3, 0, 1, 0, 1, 2}
+
+// validateAtomic checks the immediates of the atomic operator op, whose
+// operands were already checked: the alignment of an atomic access must be
+// its size.
+func (vm *mockVM) validateAtomic(op ops.Op) error {
+	var align uint32
+	switch {
+	case op.Sub == ops.AtomicFence:
+		reserved, err := vm.code.ReadByte()
+		if err != nil {
+			return err
+		}
+		if reserved != 0 {
+			return InvalidImmediateError{"reserved byte 0", op.Name}
+		}
+		return nil
+	case op.Sub == ops.MemoryAtomicNotify, op.Sub == ops.MemoryAtomicWait32:
+		align = 2
+	case op.Sub == ops.MemoryAtomicWait64:
+		align = 3
+	default:
+		align = atomicAlignments[(op.Sub-ops.I32AtomicLoad)%7]
+	}
+	flags, err := vm.fetchMemArg()
+	if err != nil {
+		return err
+	}
+	if flags != align {
+		return InvalidImmediateError{"the natural alignment", op.Name}
+	}
 	return nil
 }
+
+// fetchMemoryIndex reads the memory index immediate of op. The first
+// memory can be accessed by a module without any, which gets a default
+// one.
+func (vm *mockVM) fetchMemoryIndex(op ops.Op) error {
+	index, err := vm.fetchVarUint()
+	if err != nil {
+		return err
+	}
+	return vm.checkMemory(index)
+}
+
+// fetchTag reads a tag index, and returns the signature of the tag.
+func (vm *mockVM) fetchTag(module *wasm.Module) (*wasm.FunctionSig, error) {
+	index, err := vm.fetchVarUint()
+	if err != nil {
+		return nil, err
+	}
+	tags := module.Tags()
+	if index >= uint32(len(tags)) {
+		return nil, wasm.InvalidTagIndexError(index)
+	}
+	return &module.Types.Entries[tags[index].Type], nil
+}
+
+// fetchTableIndex reads a table index immediate, returning the type of
+// the table.
+func (vm *mockVM) fetchTableIndex(module *wasm.Module) (wasm.Table, error) {
+	index, err := vm.fetchVarUint()
+	if err != nil {
+		return wasm.Table{}, err
+	}
+	tables := module.Tables()
+	if index >= uint32(len(tables)) {
+		return wasm.Table{}, wasm.InvalidTableIndexError(index)
+	}
+	return tables[index], nil
+}
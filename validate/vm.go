@@ -26,10 +26,10 @@ import (
 	"encoding/binary"
 	"io"
 
+	"github.com/bottos-project/bottos/vm/wasm/log"
 	"github.com/bottos-project/bottos/vm/wasm/wasm"
 	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
 	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
-	log "github.com/cihub/seelog"
 )
 
 // mockVM is a minimal implementation of a virtual machine to
@@ -40,35 +40,162 @@ type mockVM struct {
 	origLength int // the original length of the bytecode stream
 
 	code *bytes.Reader
+	// the reader of the integers of code, reading them strictly if the
+	// module was, see wasm.DecodeLimits.StrictLEB128
+	leb io.Reader
 
 	polymorphic bool    // whether the base implicit block has a polymorphic stack
 	blocks      []block // a stack of encountered blocks
 
 	curFunc *wasm.FunctionSig
+	// the types of the memories of the module, by memory index
+	memories []wasm.Memory
+	module   *wasm.Module
+
+	// the policy the instructions are checked against if not nil, and
+	// the instructions breaking it
+	policy     *Policy
+	violations []PolicyError
 }
 
 // a block reprsents an instruction sequence preceded by a control flow operator
 // it is used to verify that the block signature set by the operator is the correct
 // one when the block ends
 type block struct {
-	pc          int            // the pc where the control flow operator starting the block is located
-	stackTop    int            // stack top when the block started
-	blockType   wasm.BlockType // block_type signature of the control operator
-	op          byte           // opcode for the operator starting the new block
-	polymorphic bool           // whether the block has a polymorphic stack
-	loop        bool           // whether the block is the body of a loop instruction
+	pc          int              // the pc where the control flow operator starting the block is located
+	stackTop    int              // stack top when the block started
+	blockType   wasm.BlockType   // block_type signature of the control operator
+	params      []wasm.ValueType // types of the parameters of the block
+	results     []wasm.ValueType // types of the results of the block
+	op          byte             // opcode for the operator starting the new block
+	polymorphic bool             // whether the block has a polymorphic stack
+	loop        bool             // whether the block is the body of a loop instruction
 }
 
 func (vm *mockVM) fetchVarUint() (uint32, error) {
-	return leb128.ReadVarUint32(vm.code)
+	return leb128.ReadVarUint32(vm.leb)
+}
+
+// memIndexFlag is the bit of the alignment of a memory immediate set when
+// a memory index follows the alignment, as defined by the multi-memory
+// proposal.
+const memIndexFlag = 0x40
+
+// memory64 returns whether the memory at index is indexed by i64 addresses,
+// see ops.Op.Memory64.
+func (vm *mockVM) memory64(index uint32) bool {
+	return int(index) < len(vm.memories) && vm.memories[index].Limits.Memory64()
+}
+
+// checkMemory checks that the module has a memory at index. The first
+// memory can be accessed by a module without any, which gets a default
+// one.
+func (vm *mockVM) checkMemory(index uint32) error {
+	if index != 0 && int(index) >= len(vm.memories) {
+		return wasm.InvalidLinearMemoryIndexError(index)
+	}
+	return nil
+}
+
+// fetchMemArg reads a memory immediate and returns its alignment. A
+// memory index follows the alignment if its memIndexFlag bit is set, and
+// the offset is a varuint64 on a 64-bit memory.
+func (vm *mockVM) fetchMemArg() (uint32, error) {
+	align, err := vm.fetchVarUint()
+	if err != nil {
+		return 0, err
+	}
+	var index uint32
+	if align&memIndexFlag != 0 {
+		align &^= memIndexFlag
+		if index, err = vm.fetchVarUint(); err != nil {
+			return 0, err
+		}
+	}
+	if err := vm.checkMemory(index); err != nil {
+		return 0, err
+	}
+	if vm.memory64(index) {
+		_, err = leb128.ReadVarUint64(vm.leb)
+	} else {
+		_, err = vm.fetchVarUint()
+	}
+	return align, err
+}
+
+// memoryOp returns op with the types of its operands for the memories it
+// accesses, see ops.Op.Memory64. The memory indices are read ahead of the
+// immediates, which are checked once the operands are.
+func (vm *mockVM) memoryOp(op ops.Op) (ops.Op, error) {
+	pc := vm.pc()
+	indices, err := vm.peekMemories(op)
+	if err != nil {
+		return op, err
+	}
+	if _, err := vm.code.Seek(int64(pc), io.SeekStart); err != nil {
+		return op, err
+	}
+	switch {
+	case len(indices) == 2:
+		return op.MemoryCopy64(vm.memory64(indices[0]), vm.memory64(indices[1])), nil
+	case len(indices) == 1 && vm.memory64(indices[0]):
+		return op.Memory64(), nil
+	}
+	return op, nil
+}
+
+// peekMemories reads the indices of the memories accessed by op from its
+// immediates, the destination first for memory.copy.
+func (vm *mockVM) peekMemories(op ops.Op) ([]uint32, error) {
+	memArg := false
+	n := 0 // the number of memory indices
+	switch {
+	case op.Code >= ops.I32Load && op.Code <= ops.I64Store32:
+		memArg = true
+	case op.Code == ops.CurrentMemory, op.Code == ops.GrowMemory:
+		n = 1
+	case op.Code == ops.PrefixSIMD:
+		memArg = op.Sub <= ops.V128Store || op.Sub >= ops.V128Load8Lane && op.Sub <= ops.V128Load64Zero
+	case op.Code == ops.PrefixAtomic:
+		memArg = op.Sub != ops.AtomicFence
+	case op.Code == ops.PrefixMisc:
+		switch op.Sub {
+		case ops.MemoryInit:
+			// the data segment index comes first
+			if _, err := vm.fetchVarUint(); err != nil {
+				return nil, err
+			}
+			n = 1
+		case ops.MemoryFill:
+			n = 1
+		case ops.MemoryCopy:
+			n = 2
+		}
+	}
+	if memArg {
+		align, err := vm.fetchVarUint()
+		if err != nil || align&memIndexFlag == 0 {
+			return []uint32{0}, err
+		}
+		n = 1
+	}
+	indices := make([]uint32, n)
+	for i := range indices {
+		index, err := vm.fetchVarUint()
+		if err != nil {
+			return nil, err
+		}
+		indices[i] = index
+	}
+	return indices, nil
 }
 
 func (vm *mockVM) fetchVarInt() (int32, error) {
-	return leb128.ReadVarint32(vm.code)
+	return leb128.ReadVarint32(vm.leb)
 }
 
 func (vm *mockVM) fetchVarInt64() (int64, error) {
-	return leb128.ReadVarint64(vm.code)
+	return leb128.ReadVarint64(vm.leb)
 }
 
 func (vm *mockVM) fetchUint32() (uint32, error) {
@@ -89,15 +216,22 @@ func (vm *mockVM) fetchUint64() (uint64, error) {
 	return binary.LittleEndian.Uint64(buf[:]), nil
 }
 
-func (vm *mockVM) pushBlock(op byte, blockType wasm.BlockType) {
+func (vm *mockVM) fetchBytes(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(vm.code, buf)
+	return buf, err
+}
+
+func (vm *mockVM) pushBlock(op byte, blockType wasm.BlockType, params, results []wasm.ValueType) {
 	log.Trace("Pushing block %v", blockType)
 	vm.blocks = append(vm.blocks, block{
-		pc:          vm.pc(),
-		stackTop:    vm.stackTop,
-		blockType:   blockType,
-		polymorphic: vm.isPolymorphic(),
-		op:          op,
-		loop:        op == ops.Loop,
+		pc:        vm.pc(),
+		stackTop:  vm.stackTop,
+		blockType: blockType,
+		params:    params,
+		results:   results,
+		op:        op,
+		loop:      op == ops.Loop,
 	})
 }
 
@@ -113,32 +247,88 @@ func (vm *mockVM) getBlockFromDepth(depth int) *block {
 // Returns nil if depth is a valid nesting depth value that can be
 // branched to.
 func (vm *mockVM) canBranch(depth int) error {
-	blockType := wasm.BlockTypeEmpty
+	var types []wasm.ValueType
 
 	block := vm.getBlockFromDepth(depth)
-	// jumping to the start of a loop block doesn't push a value
-	// on the stack.
+	// jumping to the start of a loop block carries its parameters
+	// instead of its results.
 	if block == nil {
 		if depth == len(vm.blocks) {
 			//equivalent to a `return', as the function
 			//body is an "implicit" block
-			if len(vm.curFunc.ReturnTypes) != 0 {
-				blockType = wasm.BlockType(vm.curFunc.ReturnTypes[0])
-			}
+			types = vm.curFunc.ReturnTypes
 		} else {
 			return InvalidLabelError(uint32(depth))
 		}
-	} else if !block.loop {
-		blockType = block.blockType
+	} else if block.loop {
+		types = block.params
+	} else {
+		types = block.results
 	}
 
-	if blockType != wasm.BlockTypeEmpty {
-		top, under := vm.topOperand()
-		if under || top.Type != wasm.ValueType(blockType) {
-			return InvalidTypeError{wasm.ValueType(blockType), top.Type}
+	return vm.checkTop(types)
+}
+
+// checkTop returns an error if the operands on the top of the stack don't
+// have the given types, the last one being on the top.
+func (vm *mockVM) checkTop(types []wasm.ValueType) error {
+	for i := range types {
+		want := types[len(types)-1-i]
+		index := vm.stackTop - 1 - i
+		if index < vm.base() {
+			return ErrStackUnderflow
+		}
+		if got := vm.stack[index].Type; !vm.subtype(got, want) {
+			return InvalidTypeError{want, got}
 		}
 	}
+	return nil
+}
 
+// checkHeight returns an error if the operands of the current block aren't
+// exactly of the given types, as required at its end. A polymorphic stack
+// may lack operands, but not have extra or mistyped ones.
+func (vm *mockVM) checkHeight(types []wasm.ValueType) error {
+	height := vm.stackTop - vm.base()
+	if height > len(types) {
+		return ErrStackHeight
+	}
+	if height < len(types) && !vm.isPolymorphic() {
+		return ErrStackUnderflow
+	}
+	for i := 0; i < height; i++ {
+		want := types[len(types)-1-i]
+		if got := vm.stack[vm.stackTop-1-i].Type; !vm.subtype(got, want) {
+			return InvalidTypeError{want, got}
+		}
+	}
+	return nil
+}
+
+// tailCall checks that a function with the given results can be tail called
+// by the current function, after which the stack is polymorphic.
+func (vm *mockVM) tailCall(results []wasm.ValueType) error {
+	if len(results) != len(vm.curFunc.ReturnTypes) {
+		return ErrTailCallResults
+	}
+	for i, t := range results {
+		if !vm.subtype(t, vm.curFunc.ReturnTypes[i]) {
+			return ErrTailCallResults
+		}
+	}
+	vm.setPolymorphic()
+	return nil
+}
+
+// popTypes pops operands of the given types, the first one being on the
+// top of the stack.
+func (vm *mockVM) popTypes(types ...wasm.ValueType) error {
+	for _, t := range types {
+		operand, under := vm.popOperand()
+		if !vm.isPolymorphic() && (under || !vm.subtype(operand.Type, t)) {
+			return InvalidTypeError{t, operand.Type}
+		}
+	}
 	return nil
 }
 
@@ -163,9 +353,18 @@ func (vm *mockVM) topBlock() *block {
 	return &vm.blocks[len(vm.blocks)-1]
 }
 
+// base returns the height of the stack when the current block started,
+// below which its operands can't be popped.
+func (vm *mockVM) base() int {
+	if block := vm.topBlock(); block != nil {
+		return block.stackTop
+	}
+	return 0
+}
+
 func (vm *mockVM) topOperand() (o operand, under bool) {
 	stackTop := vm.stackTop - 1
-	if stackTop == -1 {
+	if stackTop < vm.base() {
 		under = true
 		return
 	}
@@ -176,7 +375,7 @@ func (vm *mockVM) topOperand() (o operand, under bool) {
 func (vm *mockVM) popOperand() (operand, bool) {
 	var o operand
 	stackTop := vm.stackTop - 1
-	if stackTop == -1 {
+	if stackTop < vm.base() {
 		return o, true
 	}
 	o = vm.stack[stackTop]
@@ -202,7 +401,7 @@ func (vm *mockVM) pushOperand(t wasm.ValueType) {
 func (vm *mockVM) adjustStack(op ops.Op) error {
 	for _, t := range op.Args {
 		op, under := vm.popOperand()
-		if !vm.isPolymorphic() && (under || op.Type != t) {
+		if !vm.isPolymorphic() && (under || !vm.subtype(op.Type, t)) {
 			return InvalidTypeError{t, op.Type}
 		}
 	}
@@ -214,11 +413,12 @@ func (vm *mockVM) adjustStack(op ops.Op) error {
 	return nil
 }
 
-// setPolymorphic sets the current block as having a polymorphic stack
-// blocks created under it will be polymorphic too. All type-checking
-// is ignored in a polymorhpic stack.
+// setPolymorphic sets the current block as having a polymorphic stack, its
+// operands being dropped. Missing operands are ignored by type-checking in
+// a polymorhpic stack, until the end of the block.
 // (See https://github.com/WebAssembly/design/blob/27ac254c854994103c24834a994be16f74f54186/Semantics.md#validation)
 func (vm *mockVM) setPolymorphic() {
+	vm.stackTop = vm.base()
 	if len(vm.blocks) == 0 {
 		vm.polymorphic = true
 	} else {
@@ -235,6 +435,28 @@ func (vm *mockVM) isPolymorphic() bool {
 	return vm.topBlock().polymorphic
 }
 
+// subtype returns whether the operands of type t can be used as operands
+// of type of, see wasm.Module.Subtype.
+func (vm *mockVM) subtype(t, of wasm.ValueType) bool {
+	return t == of || vm.module != nil && vm.module.Subtype(t, of)
+}
+
+// validType returns whether t is a value type, the references to a type
+// of the types section being valid if the module has the type.
+func (vm *mockVM) validType(t wasm.ValueType) bool {
+	switch {
+	case t >= 0:
+		return vm.module != nil && vm.module.Types != nil && int(t) < len(vm.module.Types.Entries)
+	case t.IsRef():
+		return true
+	}
+	switch t {
+	case wasm.ValueTypeI32, wasm.ValueTypeI64, wasm.ValueTypeF32, wasm.ValueTypeF64, wasm.ValueTypeV128:
+		return true
+	}
+	return false
+}
+
 func (vm *mockVM) pc() int {
 	return vm.origLength - vm.code.Len()
 }
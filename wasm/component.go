@@ -0,0 +1,728 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm/internal/readpos"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+// ComponentVersion is the version and layer following the magic number of
+// a component of the component model, read as a single uint32.
+const ComponentVersion uint32 = 0x0001000d
+
+// ErrComponent is returned by ReadModule for a component, which must be
+// read with ReadComponent.
+var ErrComponent = errors.New("wasm: the binary is a component, not a core module")
+
+// ErrNotComponent is returned by ReadComponent for a binary that isn't a
+// component.
+var ErrNotComponent = errors.New("wasm: the binary is not a component")
+
+// ErrComponentSectionSize is returned for a section of a component whose
+// contents don't match its size.
+var ErrComponentSectionSize = errors.New("wasm: component section size mismatch")
+
+// InvalidComponentCodeError is returned for an unknown code introducing a
+// construct of a component, named What.
+type InvalidComponentCodeError struct {
+	What string
+	Code byte
+}
+
+func (e InvalidComponentCodeError) Error() string {
+	return fmt.Sprintf("wasm: invalid %s code %#x", e.What, e.Code)
+}
+
+// Sort is the kind of a definition of a component: one of the core sorts,
+// for the definitions of core modules, or one of the sorts of the
+// component model.
+type Sort uint16
+
+// The core sorts have the codes of the binary format, the other sorts are
+// offset by 0x100.
+const (
+	SortCoreFunc     Sort = 0x00
+	SortCoreTable    Sort = 0x01
+	SortCoreMemory   Sort = 0x02
+	SortCoreGlobal   Sort = 0x03
+	SortCoreTag      Sort = 0x04
+	SortCoreType     Sort = 0x10
+	SortCoreModule   Sort = 0x11
+	SortCoreInstance Sort = 0x12
+	SortFunc         Sort = 0x101
+	SortValue        Sort = 0x102
+	SortType         Sort = 0x103
+	SortComponent    Sort = 0x104
+	SortInstance     Sort = 0x105
+)
+
+// InvalidSortError is returned for an unknown sort code.
+type InvalidSortError uint16
+
+func (e InvalidSortError) Error() string {
+	return fmt.Sprintf("wasm: invalid sort %#x", uint16(e))
+}
+
+func (s Sort) String() string {
+	n, ok := map[Sort]string{
+		SortCoreFunc:     "core func",
+		SortCoreTable:    "core table",
+		SortCoreMemory:   "core memory",
+		SortCoreGlobal:   "core global",
+		SortCoreTag:      "core tag",
+		SortCoreType:     "core type",
+		SortCoreModule:   "core module",
+		SortCoreInstance: "core instance",
+		SortFunc:         "func",
+		SortValue:        "value",
+		SortType:         "type",
+		SortComponent:    "component",
+		SortInstance:     "instance",
+	}[s]
+	if !ok {
+		return "unknown"
+	}
+	return n
+}
+
+func readCoreSort(r io.Reader) (Sort, error) {
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return 0, err
+	}
+	switch s := Sort(b[0]); s {
+	case SortCoreFunc, SortCoreTable, SortCoreMemory, SortCoreGlobal, SortCoreTag,
+		SortCoreType, SortCoreModule, SortCoreInstance:
+		return s, nil
+	default:
+		return 0, InvalidSortError(s)
+	}
+}
+
+func readSort(r io.Reader) (Sort, error) {
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return 0, err
+	}
+	if b[0] == 0x00 {
+		return readCoreSort(r)
+	}
+	s := 0x100 | Sort(b[0])
+	if s < SortFunc || s > SortInstance {
+		return 0, InvalidSortError(b[0])
+	}
+	return s, nil
+}
+
+// SortIndex is a named reference to a definition of a component: an
+// argument of an instantiation, or an export of an instance.
+type SortIndex struct {
+	Name  string
+	Sort  Sort
+	Index uint32
+}
+
+// InstanceExpr is an instance of a component, of a core module for the
+// core instances. It either instantiates the module or component at Index
+// with Args, the arguments of a core module all being core instances, or
+// bundles the definitions of Args as its exports if Inline is set.
+type InstanceExpr struct {
+	Inline bool
+	Index  uint32
+	Args   []SortIndex
+}
+
+// AliasTarget is the kind of definition an Alias refers to.
+type AliasTarget uint8
+
+const (
+	// AliasExport is an export of a component instance
+	AliasExport AliasTarget = 0x00
+	// AliasCoreExport is an export of a core instance
+	AliasCoreExport AliasTarget = 0x01
+	// AliasOuter is a definition of an enclosing component
+	AliasOuter AliasTarget = 0x02
+)
+
+// Alias introduces a definition of another component or instance in an
+// index space of a component. Instance is the index of the instance
+// exporting Name, or for an AliasOuter the number of enclosing components
+// to go through to find the definition at Index.
+type Alias struct {
+	Sort     Sort
+	Target   AliasTarget
+	Instance uint32
+	Name     string
+	Index    uint32
+}
+
+// InvalidAliasTargetError is returned for an unknown alias target.
+type InvalidAliasTargetError uint8
+
+func (e InvalidAliasTargetError) Error() string {
+	return fmt.Sprintf("wasm: invalid alias target %#x", uint8(e))
+}
+
+// CanonKind is the kind of a canonical definition, see Canon.
+type CanonKind uint8
+
+const (
+	// CanonLift lifts a core function into a function of the component
+	CanonLift CanonKind = 0x00
+	// CanonLower lowers a function of the component into a core function
+	CanonLower CanonKind = 0x01
+	// CanonResourceNew defines the core function creating a resource
+	CanonResourceNew CanonKind = 0x02
+	// CanonResourceDrop defines the core function dropping a resource
+	CanonResourceDrop CanonKind = 0x03
+	// CanonResourceRep defines the core function returning the
+	// representation of a resource
+	CanonResourceRep CanonKind = 0x04
+)
+
+// Canon is a function defined by the canonical ABI. Func is the core
+// function lifted by CanonLift, and the function lowered by CanonLower.
+// Type is the type of the lifted function, or the resource type of the
+// resource functions.
+type Canon struct {
+	Kind    CanonKind
+	Func    uint32
+	Type    uint32
+	Options []CanonOption
+}
+
+// CanonOption is an option of a lifted or lowered function, with the index
+// of the memory, the realloc function, the post-return function or the
+// callback function it refers to.
+type CanonOption struct {
+	Kind  uint8
+	Index uint32
+}
+
+// The options of the canonical functions.
+const (
+	CanonOptUTF8         uint8 = 0x00
+	CanonOptUTF16        uint8 = 0x01
+	CanonOptCompactUTF16 uint8 = 0x02
+	CanonOptMemory       uint8 = 0x03
+	CanonOptRealloc      uint8 = 0x04
+	CanonOptPostReturn   uint8 = 0x05
+	CanonOptAsync        uint8 = 0x06
+	CanonOptCallback     uint8 = 0x07
+)
+
+// InvalidCanonError is returned for an unknown or unsupported canonical
+// definition or option.
+type InvalidCanonError uint8
+
+func (e InvalidCanonError) Error() string {
+	return fmt.Sprintf("wasm: invalid or unsupported canonical definition %#x", uint8(e))
+}
+
+// ComponentStart is the start function of a component, called with the
+// values at Args and defining Results values.
+type ComponentStart struct {
+	Func    uint32
+	Args    []uint32
+	Results uint32
+}
+
+// ComponentImport is an import of a component.
+type ComponentImport struct {
+	Name string
+	Desc ExternDesc
+}
+
+// ComponentExport is an export of a component, whose type is ascribed by
+// Desc if set.
+type ComponentExport struct {
+	Name  string
+	Sort  Sort
+	Index uint32
+	Desc  *ExternDesc
+}
+
+// Component is a component of the component model, as read by
+// ReadComponent. Its definitions are listed per section kind, in the
+// order of the binary, their indices following the rules of the
+// component model.
+type Component struct {
+	// Modules are the core modules embedded in the component, and
+	// Components the nested components
+	Modules    []*Module
+	Components []*Component
+	// ModuleIndexSpace is the core module index space of the component,
+	// the core instances refer to. It holds the embedded modules, and nil
+	// for the imported, aliased or exported ones.
+	ModuleIndexSpace []*Module
+
+	CoreInstances []InstanceExpr
+	CoreTypes     []CoreType
+	Instances     []InstanceExpr
+	Aliases       []Alias
+	Types         []ComponentType
+	Canons        []Canon
+	Start         *ComponentStart
+	Imports       []ComponentImport
+	Exports       []ComponentExport
+
+	Other []Section // Other holds the custom sections if any
+}
+
+// The section IDs of a component, after the custom section.
+const (
+	componentSectionCoreModule   = 1
+	componentSectionCoreInstance = 2
+	componentSectionCoreType     = 3
+	componentSectionComponent    = 4
+	componentSectionInstance     = 5
+	componentSectionAlias        = 6
+	componentSectionType         = 7
+	componentSectionCanon        = 8
+	componentSectionStart        = 9
+	componentSectionImport       = 10
+	componentSectionExport       = 11
+)
+
+// ReadComponent reads a component from the reader r. Its core modules are
+// read with the DefaultDecodeLimits, without resolving their imports, and
+// the whole component must fit in their MaxModuleSize.
+func ReadComponent(r io.Reader) (*Component, error) {
+	return readComponent(r, DefaultDecodeLimits)
+}
+
+func readComponent(r io.Reader, limits DecodeLimits) (*Component, error) {
+	reader := &readpos.ReadPos{
+		R:      r,
+		CurPos: 0,
+	}
+	magic, err := readU32(reader)
+	if err != nil {
+		return nil, err
+	}
+	if magic != Magic {
+		return nil, ErrInvalidMagic
+	}
+	version, err := readU32(reader)
+	if err != nil {
+		return nil, err
+	}
+	if version != ComponentVersion {
+		return nil, ErrNotComponent
+	}
+
+	c := &Component{}
+	for {
+		id, err := leb128.ReadVarUint32(reader)
+		if err == io.EOF {
+			return c, nil
+		} else if err != nil {
+			return nil, err
+		}
+		size, err := leb128.ReadVarUint32(reader)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkLimit("module size", uint64(reader.CurPos)+uint64(size), limits.MaxModuleSize); err != nil {
+			return nil, err
+		}
+		payload, err := readBytes(reader, int(size))
+		if err != nil {
+			return nil, err
+		}
+		if err = c.readSection(id, payload, limits); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readSection reads the section id of the component from its payload.
+func (c *Component) readSection(id uint32, payload []byte, limits DecodeLimits) error {
+	switch id {
+	case uint32(SectionIDCustom):
+		r := bytes.NewReader(payload)
+		name, err := readName(r)
+		if err != nil {
+			return err
+		}
+		c.Other = append(c.Other, Section{ID: SectionIDCustom, PayloadLen: uint32(len(payload)), Name: name, Bytes: payload})
+		return nil
+	case componentSectionCoreModule:
+		m, err := ReadModuleWithLimits(bytes.NewReader(payload), nil, limits)
+		if err != nil {
+			return err
+		}
+		c.Modules = append(c.Modules, m)
+		c.ModuleIndexSpace = append(c.ModuleIndexSpace, m)
+		return nil
+	case componentSectionComponent:
+		nested, err := readComponent(bytes.NewReader(payload), limits)
+		if err != nil {
+			return err
+		}
+		c.Components = append(c.Components, nested)
+		return nil
+	case componentSectionStart:
+		r := bytes.NewReader(payload)
+		start, err := readComponentStart(r)
+		if err != nil {
+			return err
+		}
+		if r.Len() != 0 {
+			return ErrComponentSectionSize
+		}
+		c.Start = &start
+		return nil
+	}
+
+	r := bytes.NewReader(payload)
+	count, err := readCount(r)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		switch id {
+		case componentSectionCoreInstance:
+			inst, err := readCoreInstance(r)
+			if err != nil {
+				return err
+			}
+			c.CoreInstances = append(c.CoreInstances, inst)
+		case componentSectionCoreType:
+			t, err := readCoreType(r)
+			if err != nil {
+				return err
+			}
+			c.CoreTypes = append(c.CoreTypes, t)
+		case componentSectionInstance:
+			inst, err := readInstance(r)
+			if err != nil {
+				return err
+			}
+			c.Instances = append(c.Instances, inst)
+		case componentSectionAlias:
+			alias, err := readAlias(r)
+			if err != nil {
+				return err
+			}
+			c.Aliases = append(c.Aliases, alias)
+			c.defineModule(alias.Sort)
+		case componentSectionType:
+			t, err := readComponentType(r)
+			if err != nil {
+				return err
+			}
+			c.Types = append(c.Types, t)
+		case componentSectionCanon:
+			canon, err := readCanon(r)
+			if err != nil {
+				return err
+			}
+			c.Canons = append(c.Canons, canon)
+		case componentSectionImport:
+			name, desc, err := readExternDecl(r)
+			if err != nil {
+				return err
+			}
+			c.Imports = append(c.Imports, ComponentImport{Name: name, Desc: desc})
+			c.defineModule(desc.Sort)
+		case componentSectionExport:
+			export, err := readComponentExport(r)
+			if err != nil {
+				return err
+			}
+			c.Exports = append(c.Exports, export)
+			c.defineModule(export.Sort)
+		default:
+			return InvalidSectionIDError(id)
+		}
+	}
+	if r.Len() != 0 {
+		return ErrComponentSectionSize
+	}
+	return nil
+}
+
+// defineModule records in the core module index space a module defined by
+// a definition of the given sort other than an embedded module.
+func (c *Component) defineModule(sort Sort) {
+	if sort == SortCoreModule {
+		c.ModuleIndexSpace = append(c.ModuleIndexSpace, nil)
+	}
+}
+
+// readCount reads the length of a vector, which can't exceed the number of
+// bytes left in r.
+func readCount(r io.Reader) (uint32, error) {
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return 0, err
+	}
+	return count, checkCount(r, count)
+}
+
+// readExternName reads the name of an import or an export, the versions
+// of the component model before 0.2 prefixing interface names with 0x01.
+func readExternName(r io.Reader) (string, error) {
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return "", err
+	}
+	if b[0] != 0x00 && b[0] != 0x01 {
+		return "", InvalidComponentCodeError{"extern name", b[0]}
+	}
+	return readName(r)
+}
+
+func readSortIndex(r io.Reader, name string, core bool) (SortIndex, error) {
+	s := SortIndex{Name: name}
+	var err error
+	if core {
+		s.Sort, err = readCoreSort(r)
+	} else {
+		s.Sort, err = readSort(r)
+	}
+	if err != nil {
+		return s, err
+	}
+	s.Index, err = leb128.ReadVarUint32(r)
+	return s, err
+}
+
+func readCoreInstance(r io.Reader) (InstanceExpr, error) {
+	inst := InstanceExpr{}
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return inst, err
+	}
+	switch b[0] {
+	case 0x00:
+		if inst.Index, err = leb128.ReadVarUint32(r); err != nil {
+			return inst, err
+		}
+		count, err := readCount(r)
+		if err != nil {
+			return inst, err
+		}
+		for i := uint32(0); i < count; i++ {
+			name, err := readName(r)
+			if err != nil {
+				return inst, err
+			}
+			arg, err := readSortIndex(r, name, true)
+			if err != nil {
+				return inst, err
+			}
+			if arg.Sort != SortCoreInstance {
+				return inst, InvalidSortError(arg.Sort)
+			}
+			inst.Args = append(inst.Args, arg)
+		}
+	case 0x01:
+		inst.Inline = true
+		if inst.Args, err = readSortIndices(r, true, readName); err != nil {
+			return inst, err
+		}
+	default:
+		return inst, InvalidComponentCodeError{"core instance", b[0]}
+	}
+	return inst, nil
+}
+
+func readInstance(r io.Reader) (InstanceExpr, error) {
+	inst := InstanceExpr{}
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return inst, err
+	}
+	switch b[0] {
+	case 0x00:
+		if inst.Index, err = leb128.ReadVarUint32(r); err != nil {
+			return inst, err
+		}
+		inst.Args, err = readSortIndices(r, false, readName)
+	case 0x01:
+		inst.Inline = true
+		inst.Args, err = readSortIndices(r, false, readExternName)
+	default:
+		return inst, InvalidComponentCodeError{"instance", b[0]}
+	}
+	return inst, err
+}
+
+// readSortIndices reads a vector of named references, whose names are read
+// by readName.
+func readSortIndices(r io.Reader, core bool, readName func(io.Reader) (string, error)) ([]SortIndex, error) {
+	count, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]SortIndex, 0, count)
+	for i := uint32(0); i < count; i++ {
+		name, err := readName(r)
+		if err != nil {
+			return nil, err
+		}
+		s, err := readSortIndex(r, name, core)
+		if err != nil {
+			return nil, err
+		}
+		indices = append(indices, s)
+	}
+	return indices, nil
+}
+
+func readAlias(r io.Reader) (Alias, error) {
+	sort, err := readSort(r)
+	if err != nil {
+		return Alias{}, err
+	}
+	return readAliasTarget(r, sort)
+}
+
+func readAliasTarget(r io.Reader, sort Sort) (Alias, error) {
+	a := Alias{Sort: sort}
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return a, err
+	}
+	a.Target = AliasTarget(b[0])
+	if a.Instance, err = leb128.ReadVarUint32(r); err != nil {
+		return a, err
+	}
+	switch a.Target {
+	case AliasExport, AliasCoreExport:
+		a.Name, err = readName(r)
+	case AliasOuter:
+		a.Index, err = leb128.ReadVarUint32(r)
+	default:
+		return a, InvalidAliasTargetError(a.Target)
+	}
+	return a, err
+}
+
+func readCanon(r io.Reader) (Canon, error) {
+	c := Canon{}
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return c, err
+	}
+	c.Kind = CanonKind(b[0])
+	switch c.Kind {
+	case CanonLift, CanonLower:
+		if b, err = readBytes(r, 1); err != nil {
+			return c, err
+		}
+		if b[0] != 0x00 {
+			return c, InvalidCanonError(b[0])
+		}
+		if c.Func, err = leb128.ReadVarUint32(r); err != nil {
+			return c, err
+		}
+		if c.Options, err = readCanonOptions(r); err != nil {
+			return c, err
+		}
+		if c.Kind == CanonLift {
+			c.Type, err = leb128.ReadVarUint32(r)
+		}
+	case CanonResourceNew, CanonResourceDrop, CanonResourceRep:
+		c.Type, err = leb128.ReadVarUint32(r)
+	default:
+		return c, InvalidCanonError(c.Kind)
+	}
+	return c, err
+}
+
+func readCanonOptions(r io.Reader) ([]CanonOption, error) {
+	count, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+	options := make([]CanonOption, 0, count)
+	for i := uint32(0); i < count; i++ {
+		b, err := readBytes(r, 1)
+		if err != nil {
+			return nil, err
+		}
+		opt := CanonOption{Kind: b[0]}
+		switch opt.Kind {
+		case CanonOptUTF8, CanonOptUTF16, CanonOptCompactUTF16, CanonOptAsync:
+		case CanonOptMemory, CanonOptRealloc, CanonOptPostReturn, CanonOptCallback:
+			if opt.Index, err = leb128.ReadVarUint32(r); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, InvalidCanonError(opt.Kind)
+		}
+		options = append(options, opt)
+	}
+	return options, nil
+}
+
+func readComponentStart(r io.Reader) (ComponentStart, error) {
+	s := ComponentStart{}
+	var err error
+	if s.Func, err = leb128.ReadVarUint32(r); err != nil {
+		return s, err
+	}
+	if s.Args, err = readIndices(r); err != nil {
+		return s, err
+	}
+	s.Results, err = leb128.ReadVarUint32(r)
+	return s, err
+}
+
+func readComponentExport(r io.Reader) (ComponentExport, error) {
+	e := ComponentExport{}
+	name, err := readExternName(r)
+	if err != nil {
+		return e, err
+	}
+	s, err := readSortIndex(r, name, false)
+	if err != nil {
+		return e, err
+	}
+	e.Name, e.Sort, e.Index = s.Name, s.Sort, s.Index
+
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return e, err
+	}
+	switch b[0] {
+	case 0x00:
+	case 0x01:
+		desc, err := readExternDesc(r)
+		if err != nil {
+			return e, err
+		}
+		e.Desc = &desc
+	default:
+		return e, InvalidComponentCodeError{"export", b[0]}
+	}
+	return e, nil
+}
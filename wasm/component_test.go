@@ -0,0 +1,207 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wasm_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+	"github.com/bottos-project/bottos/vm/wasm/wat"
+)
+
+// componentModule is the core module of the test component.
+const componentModule = `(module
+  (func (export "f") (param i32) (result i32) (local.get 0))
+  (memory (export "mem") 1))`
+
+// componentSections are the sections of the test component following its
+// core module, by id, which the text format of package wat doesn't cover.
+var componentSections = []struct {
+	id      byte
+	payload string
+}{
+	// the core types: (func (param i32) (result i32)), and a module type
+	// declaring this type, importing it as env.g and exporting it as f
+	{3, "\x02" + "\x60\x01\x7f\x01\x7f" +
+		"\x50\x03" + "\x01\x60\x01\x7f\x01\x7f" + "\x00\x03env\x01g\x00\x00" + "\x03\x01f\x00\x00"},
+	// the core instance of the core module, without arguments
+	{2, "\x01" + "\x00\x00\x00"},
+	// the types: record {a: u32, b: string}, func (x: u32) -> type 0,
+	// a resource of rep i32 and destructor 0, own<type 2>, an instance
+	// type exporting g of type func (x: u32) -> type 0, result<string>
+	// and variant {none, some(type 0)}
+	{7, "\x07" + "\x72\x02\x01a\x79\x01b\x73" + "\x40\x01\x01x\x79\x00\x00" + "\x3f\x7f\x01\x00" + "\x69\x02" +
+		"\x42\x02" + "\x01\x40\x01\x01x\x79\x00\x00" + "\x04\x00\x01g\x01\x00" +
+		"\x6a\x01\x73\x00" + "\x71\x02\x04none\x00\x00\x04some\x01\x00\x00"},
+	// the import of the instance host, of type 4
+	{10, "\x01" + "\x00\x04host\x05\x04"},
+	// the aliases of the exports f and mem of the core instance, and of
+	// the export g of the instance host
+	{6, "\x03" + "\x00\x00\x01\x00\x01f" + "\x00\x02\x01\x00\x03mem" + "\x01\x00\x00\x01g"},
+	// the lifting of f to type 1 with the utf8 and memory options, the
+	// lowering of g, and resource.new of type 2
+	{8, "\x03" + "\x00\x00\x00\x02\x00\x03\x00\x01" + "\x01\x00\x00\x00" + "\x02\x02"},
+	// an empty nested component
+	{4, "\x00asm\x0d\x00\x01\x00"},
+	// an instance of the lifted function exported as run
+	{5, "\x01" + "\x01\x01\x00\x03run\x01\x01"},
+	// the exports of the lifted function as run, and of the core module
+	// as m
+	{11, "\x02" + "\x00\x03run\x01\x01\x01\x01\x01" + "\x00\x01m\x00\x11\x00\x00"},
+	// the start function 1, without arguments nor results
+	{9, "\x01\x00\x00"},
+}
+
+// testComponent returns the binary of the test component, with a
+// producers custom section.
+func testComponent(t *testing.T) []byte {
+	module, err := wat.Assemble([]byte(componentModule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("\x00asm\x0d\x00\x01\x00")
+	section := func(id byte, payload []byte) {
+		buf.WriteByte(id)
+		leb128.WriteVarUint32(&buf, uint32(len(payload)))
+		buf.Write(payload)
+	}
+	section(0, []byte("\x09producers\x01\x02"))
+	section(1, module)
+	for _, s := range componentSections {
+		section(s.id, []byte(s.payload))
+	}
+	return buf.Bytes()
+}
+
+func TestReadComponent(t *testing.T) {
+	raw := testComponent(t)
+	c, err := wasm.ReadComponent(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Modules) != 1 || c.Modules[0].Export.Entries["f"].Kind != wasm.ExternalFunction {
+		t.Fatalf("unexpected modules: %+v", c.Modules)
+	}
+	// the exported module is given its own index
+	if len(c.ModuleIndexSpace) != 2 || c.ModuleIndexSpace[0] != c.Modules[0] || c.ModuleIndexSpace[1] != nil {
+		t.Errorf("unexpected module index space: %v", c.ModuleIndexSpace)
+	}
+	if len(c.Components) != 1 || c.Components[0].Modules != nil {
+		t.Errorf("unexpected nested components: %+v", c.Components)
+	}
+	if len(c.Other) != 1 || c.Other[0].Name != "producers" {
+		t.Errorf("unexpected custom sections: %+v", c.Other)
+	}
+
+	if want := []wasm.InstanceExpr{{Index: 0}}; !reflect.DeepEqual(c.CoreInstances, want) {
+		t.Errorf("unexpected core instances: %+v", c.CoreInstances)
+	}
+	want := []wasm.InstanceExpr{{Inline: true, Args: []wasm.SortIndex{{Name: "run", Sort: wasm.SortFunc, Index: 1}}}}
+	if !reflect.DeepEqual(c.Instances, want) {
+		t.Errorf("unexpected instances: %+v", c.Instances)
+	}
+
+	if len(c.CoreTypes) != 2 || c.CoreTypes[0].Module || len(c.CoreTypes[0].Sig.ParamTypes) != 1 {
+		t.Fatalf("unexpected core types: %+v", c.CoreTypes)
+	}
+	if decls := c.CoreTypes[1].Decls; !c.CoreTypes[1].Module || len(decls) != 3 ||
+		decls[1].Import.ModuleName != "env" || decls[2].Kind != wasm.CoreModuleDeclExport || decls[2].Import.FieldName != "f" {
+		t.Errorf("unexpected module type: %+v", c.CoreTypes[1])
+	}
+
+	if len(c.Types) != 7 {
+		t.Fatalf("unexpected types: %+v", c.Types)
+	}
+	u32, str := wasm.ComponentValType{Primitive: wasm.PrimU32}, wasm.ComponentValType{Primitive: wasm.PrimString}
+	record := &wasm.DefValType{Kind: wasm.DefValRecord, Fields: []wasm.ComponentField{{"a", &u32}, {"b", &str}}}
+	if !reflect.DeepEqual(c.Types[0].Value, record) {
+		t.Errorf("unexpected record: %+v", c.Types[0].Value)
+	}
+	fn := &wasm.ComponentFuncType{
+		Params:  []wasm.ComponentField{{"x", &u32}},
+		Results: []wasm.ComponentField{{Type: &wasm.ComponentValType{Index: 0}}},
+	}
+	if !reflect.DeepEqual(c.Types[1].Func, fn) {
+		t.Errorf("unexpected func type: %+v", c.Types[1].Func)
+	}
+	if r := c.Types[2].Resource; r == nil || r.Rep != wasm.ValueTypeI32 || r.Dtor == nil || *r.Dtor != 0 {
+		t.Errorf("unexpected resource type: %+v", c.Types[2])
+	}
+	if v := c.Types[3].Value; v.Kind != wasm.DefValOwn || v.Resource != 2 {
+		t.Errorf("unexpected own type: %+v", v)
+	}
+	if d := c.Types[4].Decls; c.Types[4].Kind != wasm.ComponentTypeInstance || len(d) != 2 ||
+		d[1].Name != "g" || d[1].Desc != (wasm.ExternDesc{Sort: wasm.SortFunc, Index: 0}) {
+		t.Errorf("unexpected instance type: %+v", c.Types[4])
+	}
+	if v := c.Types[5].Value; v.Kind != wasm.DefValResult || *v.Ok != str || v.Err != nil {
+		t.Errorf("unexpected result type: %+v", v)
+	}
+	if v := c.Types[6].Value; v.Kind != wasm.DefValVariant || len(v.Fields) != 2 || v.Fields[0].Type != nil || *v.Fields[1].Type != (wasm.ComponentValType{}) {
+		t.Errorf("unexpected variant type: %+v", v)
+	}
+
+	if want := []wasm.ComponentImport{{Name: "host", Desc: wasm.ExternDesc{Sort: wasm.SortInstance, Index: 4}}}; !reflect.DeepEqual(c.Imports, want) {
+		t.Errorf("unexpected imports: %+v", c.Imports)
+	}
+	aliases := []wasm.Alias{
+		{Sort: wasm.SortCoreFunc, Target: wasm.AliasCoreExport, Name: "f"},
+		{Sort: wasm.SortCoreMemory, Target: wasm.AliasCoreExport, Name: "mem"},
+		{Sort: wasm.SortFunc, Target: wasm.AliasExport, Name: "g"},
+	}
+	if !reflect.DeepEqual(c.Aliases, aliases) {
+		t.Errorf("unexpected aliases: %+v", c.Aliases)
+	}
+	canons := []wasm.Canon{
+		{Kind: wasm.CanonLift, Type: 1, Options: []wasm.CanonOption{{Kind: wasm.CanonOptUTF8}, {Kind: wasm.CanonOptMemory}}},
+		{Kind: wasm.CanonLower, Options: []wasm.CanonOption{}},
+		{Kind: wasm.CanonResourceNew, Type: 2},
+	}
+	if !reflect.DeepEqual(c.Canons, canons) {
+		t.Errorf("unexpected canonical functions: %+v", c.Canons)
+	}
+	if c.Start == nil || c.Start.Func != 1 {
+		t.Errorf("unexpected start function: %+v", c.Start)
+	}
+	if len(c.Exports) != 2 || c.Exports[0].Desc == nil || *c.Exports[0].Desc != (wasm.ExternDesc{Sort: wasm.SortFunc, Index: 1}) ||
+		c.Exports[1].Sort != wasm.SortCoreModule || c.Exports[1].Desc != nil {
+		t.Errorf("unexpected exports: %+v", c.Exports)
+	}
+
+	// components and core modules are told apart
+	if _, err := wasm.ReadModule(bytes.NewReader(raw), nil); err != wasm.ErrComponent {
+		t.Errorf("unexpected error: got=%v, want=%v", err, wasm.ErrComponent)
+	}
+	if _, err := wasm.ReadComponent(bytes.NewReader([]byte("\x00asm\x01\x00\x00\x00"))); err != wasm.ErrNotComponent {
+		t.Errorf("unexpected error: got=%v, want=%v", err, wasm.ErrNotComponent)
+	}
+	// an alias section with a trailing byte
+	_, err = wasm.ReadComponent(bytes.NewReader([]byte("\x00asm\x0d\x00\x01\x00\x06\x07\x01\x01\x00\x00\x01g\x00")))
+	if err != wasm.ErrComponentSectionSize {
+		t.Errorf("unexpected error: got=%v, want=%v", err, wasm.ErrComponentSectionSize)
+	}
+}
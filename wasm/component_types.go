@@ -0,0 +1,668 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wasm
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+// PrimValType is a primitive value type of the component model.
+type PrimValType uint8
+
+// The primitive value types, with their codes of the binary format.
+const (
+	PrimBool         PrimValType = 0x7f
+	PrimS8           PrimValType = 0x7e
+	PrimU8           PrimValType = 0x7d
+	PrimS16          PrimValType = 0x7c
+	PrimU16          PrimValType = 0x7b
+	PrimS32          PrimValType = 0x7a
+	PrimU32          PrimValType = 0x79
+	PrimS64          PrimValType = 0x78
+	PrimU64          PrimValType = 0x77
+	PrimF32          PrimValType = 0x76
+	PrimF64          PrimValType = 0x75
+	PrimChar         PrimValType = 0x74
+	PrimString       PrimValType = 0x73
+	PrimErrorContext PrimValType = 0x64
+)
+
+func (t PrimValType) String() string {
+	n, ok := map[PrimValType]string{
+		PrimBool:         "bool",
+		PrimS8:           "s8",
+		PrimU8:           "u8",
+		PrimS16:          "s16",
+		PrimU16:          "u16",
+		PrimS32:          "s32",
+		PrimU32:          "u32",
+		PrimS64:          "s64",
+		PrimU64:          "u64",
+		PrimF32:          "f32",
+		PrimF64:          "f64",
+		PrimChar:         "char",
+		PrimString:       "string",
+		PrimErrorContext: "error-context",
+	}[t]
+	if !ok {
+		return "<unknown>"
+	}
+	return n
+}
+
+func isPrimValType(b byte) bool {
+	return b >= byte(PrimString) && b <= byte(PrimBool) || b == byte(PrimErrorContext)
+}
+
+// ComponentValType is a value type of the component model: a primitive
+// type, or the defined value type at Index if Primitive is zero.
+type ComponentValType struct {
+	Primitive PrimValType
+	Index     uint32
+}
+
+// readComponentValType reads a value type, whose type index is encoded as a
+// non-negative s33.
+func readComponentValType(r io.Reader) (ComponentValType, error) {
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return ComponentValType{}, err
+	}
+	if isPrimValType(b[0]) {
+		return ComponentValType{Primitive: PrimValType(b[0])}, nil
+	}
+	index, err := leb128.ReadVarint64(io.MultiReader(bytes.NewReader(b), r))
+	if err != nil {
+		return ComponentValType{}, err
+	}
+	if index < 0 || index > int64(^uint32(0)) {
+		return ComponentValType{}, InvalidComponentCodeError{"value type", b[0]}
+	}
+	return ComponentValType{Index: uint32(index)}, nil
+}
+
+// readOptionalValType reads a value type preceded by whether it is present.
+func readOptionalValType(r io.Reader) (*ComponentValType, error) {
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case 0x00:
+		return nil, nil
+	case 0x01:
+		t, err := readComponentValType(r)
+		if err != nil {
+			return nil, err
+		}
+		return &t, nil
+	default:
+		return nil, InvalidComponentCodeError{"optional value type", b[0]}
+	}
+}
+
+// DefValKind is the kind of a defined value type.
+type DefValKind uint8
+
+// The kinds of the defined value types, with their codes of the binary
+// format except for DefValPrimitive.
+const (
+	DefValPrimitive DefValKind = 0x00
+	DefValRecord    DefValKind = 0x72
+	DefValVariant   DefValKind = 0x71
+	DefValList      DefValKind = 0x70
+	DefValTuple     DefValKind = 0x6f
+	DefValFlags     DefValKind = 0x6e
+	DefValEnum      DefValKind = 0x6d
+	DefValOption    DefValKind = 0x6b
+	DefValResult    DefValKind = 0x6a
+	DefValOwn       DefValKind = 0x69
+	DefValBorrow    DefValKind = 0x68
+	DefValFixedList DefValKind = 0x67
+	DefValStream    DefValKind = 0x66
+	DefValFuture    DefValKind = 0x65
+)
+
+// ComponentField is a named value type: a field of a record, a case of a
+// variant, whose Type may be nil, or a parameter or a result of a function.
+type ComponentField struct {
+	Name string
+	Type *ComponentValType
+}
+
+// DefValType is a value type defined by a component. Fields holds the
+// fields of a record and the cases of a variant, Elems the elements of a
+// tuple, and Labels the labels of flags and enums. Elem is the element type
+// of lists, options, streams and futures, the latter two possibly having
+// none, and Length the length of a fixed-length list. Ok and Err are the
+// optional types of a result, and Resource the resource type of an own or
+// borrow handle.
+type DefValType struct {
+	Kind      DefValKind
+	Primitive PrimValType
+	Fields    []ComponentField
+	Elems     []ComponentValType
+	Labels    []string
+	Elem      *ComponentValType
+	Length    uint32
+	Ok, Err   *ComponentValType
+	Resource  uint32
+}
+
+func readDefValType(r io.Reader, code byte) (*DefValType, error) {
+	if isPrimValType(code) {
+		return &DefValType{Kind: DefValPrimitive, Primitive: PrimValType(code)}, nil
+	}
+	t := &DefValType{Kind: DefValKind(code)}
+	var err error
+	switch t.Kind {
+	case DefValRecord:
+		t.Fields, err = readComponentFields(r)
+	case DefValVariant:
+		count, err := readCount(r)
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < count; i++ {
+			name, err := readName(r)
+			if err != nil {
+				return nil, err
+			}
+			typ, err := readOptionalValType(r)
+			if err != nil {
+				return nil, err
+			}
+			// the refinement of the cases is no longer used
+			if b, err := readBytes(r, 1); err != nil {
+				return nil, err
+			} else if b[0] != 0x00 {
+				return nil, InvalidComponentCodeError{"variant case", b[0]}
+			}
+			t.Fields = append(t.Fields, ComponentField{Name: name, Type: typ})
+		}
+	case DefValList, DefValOption, DefValFixedList:
+		elem, err := readComponentValType(r)
+		if err != nil {
+			return nil, err
+		}
+		t.Elem = &elem
+		if t.Kind == DefValFixedList {
+			t.Length, err = leb128.ReadVarUint32(r)
+		}
+	case DefValTuple:
+		count, err := readCount(r)
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < count; i++ {
+			elem, err := readComponentValType(r)
+			if err != nil {
+				return nil, err
+			}
+			t.Elems = append(t.Elems, elem)
+		}
+	case DefValFlags, DefValEnum:
+		count, err := readCount(r)
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < count; i++ {
+			label, err := readName(r)
+			if err != nil {
+				return nil, err
+			}
+			t.Labels = append(t.Labels, label)
+		}
+	case DefValResult:
+		if t.Ok, err = readOptionalValType(r); err != nil {
+			return nil, err
+		}
+		t.Err, err = readOptionalValType(r)
+	case DefValOwn, DefValBorrow:
+		t.Resource, err = leb128.ReadVarUint32(r)
+	case DefValStream, DefValFuture:
+		t.Elem, err = readOptionalValType(r)
+	default:
+		return nil, InvalidComponentCodeError{"defined value type", code}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func readComponentFields(r io.Reader) ([]ComponentField, error) {
+	count, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]ComponentField, 0, count)
+	for i := uint32(0); i < count; i++ {
+		name, err := readName(r)
+		if err != nil {
+			return nil, err
+		}
+		t, err := readComponentValType(r)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, ComponentField{Name: name, Type: &t})
+	}
+	return fields, nil
+}
+
+// ComponentFuncType is the type of a function of a component. A single
+// unnamed result has an empty name.
+type ComponentFuncType struct {
+	Async   bool
+	Params  []ComponentField
+	Results []ComponentField
+}
+
+func readComponentFuncType(r io.Reader, async bool) (*ComponentFuncType, error) {
+	f := &ComponentFuncType{Async: async}
+	var err error
+	if f.Params, err = readComponentFields(r); err != nil {
+		return nil, err
+	}
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case 0x00:
+		t, err := readComponentValType(r)
+		if err != nil {
+			return nil, err
+		}
+		f.Results = []ComponentField{{Type: &t}}
+	case 0x01:
+		// named results, of which only the empty list remains
+		if f.Results, err = readComponentFields(r); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, InvalidComponentCodeError{"result list", b[0]}
+	}
+	return f, nil
+}
+
+// ResourceType is a resource type defined by a component, represented by
+// core values of type Rep and destroyed by the core function Dtor if any.
+type ResourceType struct {
+	Rep      ValueType
+	Dtor     *uint32
+	Callback *uint32
+}
+
+func readResourceType(r io.Reader, async bool) (*ResourceType, error) {
+	t := &ResourceType{}
+	var err error
+	if t.Rep, err = ReadValueType(r); err != nil {
+		return nil, err
+	}
+	if t.Rep != ValueTypeI32 {
+		return nil, InvalidComponentCodeError{"resource representation", byte(t.Rep) & 0x7f}
+	}
+	if t.Dtor, err = readOptionalIndex(r); err != nil {
+		return nil, err
+	}
+	if async {
+		if t.Callback, err = readOptionalIndex(r); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func readOptionalIndex(r io.Reader) (*uint32, error) {
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case 0x00:
+		return nil, nil
+	case 0x01:
+		i, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		return &i, nil
+	default:
+		return nil, InvalidComponentCodeError{"optional index", b[0]}
+	}
+}
+
+// ComponentTypeKind is the kind of a type defined by a component.
+type ComponentTypeKind uint8
+
+// The kinds of the types defined by a component.
+const (
+	ComponentTypeDefVal ComponentTypeKind = iota
+	ComponentTypeFunc
+	ComponentTypeComponent
+	ComponentTypeInstance
+	ComponentTypeResource
+)
+
+// ComponentType is a type defined by a component, described by the field
+// matching its kind. The component and instance types are described by
+// their declarations.
+type ComponentType struct {
+	Kind     ComponentTypeKind
+	Value    *DefValType
+	Func     *ComponentFuncType
+	Decls    []ComponentDecl
+	Resource *ResourceType
+}
+
+func readComponentType(r io.Reader) (ComponentType, error) {
+	t := ComponentType{}
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return t, err
+	}
+	switch b[0] {
+	case 0x40, 0x43:
+		t.Kind = ComponentTypeFunc
+		t.Func, err = readComponentFuncType(r, b[0] == 0x43)
+	case 0x41:
+		t.Kind = ComponentTypeComponent
+		t.Decls, err = readComponentDecls(r, true)
+	case 0x42:
+		t.Kind = ComponentTypeInstance
+		t.Decls, err = readComponentDecls(r, false)
+	case 0x3f, 0x3e:
+		t.Kind = ComponentTypeResource
+		t.Resource, err = readResourceType(r, b[0] == 0x3e)
+	default:
+		t.Kind = ComponentTypeDefVal
+		t.Value, err = readDefValType(r, b[0])
+	}
+	return t, err
+}
+
+// ComponentDeclKind is the kind of a declaration of a component or an
+// instance type.
+type ComponentDeclKind uint8
+
+// The kinds of declarations, with their codes of the binary format.
+const (
+	ComponentDeclCoreType ComponentDeclKind = 0x00
+	ComponentDeclType     ComponentDeclKind = 0x01
+	ComponentDeclAlias    ComponentDeclKind = 0x02
+	ComponentDeclImport   ComponentDeclKind = 0x03
+	ComponentDeclExport   ComponentDeclKind = 0x04
+)
+
+// ComponentDecl is a declaration of a component or an instance type: a
+// type, an alias, or an import or an export named Name of type Desc. Only
+// the component types declare imports.
+type ComponentDecl struct {
+	Kind     ComponentDeclKind
+	CoreType *CoreType
+	Type     *ComponentType
+	Alias    *Alias
+	Name     string
+	Desc     ExternDesc
+}
+
+func readComponentDecls(r io.Reader, imports bool) ([]ComponentDecl, error) {
+	count, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+	decls := make([]ComponentDecl, 0, count)
+	for i := uint32(0); i < count; i++ {
+		b, err := readBytes(r, 1)
+		if err != nil {
+			return nil, err
+		}
+		d := ComponentDecl{Kind: ComponentDeclKind(b[0])}
+		switch d.Kind {
+		case ComponentDeclCoreType:
+			t, err := readCoreType(r)
+			if err != nil {
+				return nil, err
+			}
+			d.CoreType = &t
+		case ComponentDeclType:
+			t, err := readComponentType(r)
+			if err != nil {
+				return nil, err
+			}
+			d.Type = &t
+		case ComponentDeclAlias:
+			a, err := readAlias(r)
+			if err != nil {
+				return nil, err
+			}
+			d.Alias = &a
+		case ComponentDeclImport, ComponentDeclExport:
+			if d.Kind == ComponentDeclImport && !imports {
+				return nil, InvalidComponentCodeError{"instance declaration", b[0]}
+			}
+			if d.Name, d.Desc, err = readExternDecl(r); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, InvalidComponentCodeError{"declaration", b[0]}
+		}
+		decls = append(decls, d)
+	}
+	return decls, nil
+}
+
+// ExternDesc is the type of an import or an export: the type at Index of a
+// definition of the given sort, SortCoreModule, SortFunc, SortComponent or
+// SortInstance. A type is either equal to the one at Index if Eq is set,
+// or a fresh resource type. A value is either equal to the one at Index if
+// Eq is set, or of type Value.
+type ExternDesc struct {
+	Sort  Sort
+	Index uint32
+	Eq    bool
+	Value ComponentValType
+}
+
+// readExternDecl reads the name and the type of an import or an export.
+func readExternDecl(r io.Reader) (string, ExternDesc, error) {
+	name, err := readExternName(r)
+	if err != nil {
+		return "", ExternDesc{}, err
+	}
+	desc, err := readExternDesc(r)
+	return name, desc, err
+}
+
+func readExternDesc(r io.Reader) (ExternDesc, error) {
+	d := ExternDesc{}
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return d, err
+	}
+	switch b[0] {
+	case 0x00:
+		if d.Sort, err = readCoreSort(r); err != nil {
+			return d, err
+		}
+		if d.Sort != SortCoreModule {
+			return d, InvalidSortError(d.Sort)
+		}
+		d.Index, err = leb128.ReadVarUint32(r)
+	case 0x01, 0x04, 0x05:
+		d.Sort = 0x100 | Sort(b[0])
+		d.Index, err = leb128.ReadVarUint32(r)
+	case 0x02:
+		d.Sort = SortValue
+		if b, err = readBytes(r, 1); err != nil {
+			return d, err
+		}
+		switch b[0] {
+		case 0x00:
+			d.Eq = true
+			d.Index, err = leb128.ReadVarUint32(r)
+		case 0x01:
+			d.Value, err = readComponentValType(r)
+		default:
+			return d, InvalidComponentCodeError{"value bound", b[0]}
+		}
+	case 0x03:
+		d.Sort = SortType
+		if b, err = readBytes(r, 1); err != nil {
+			return d, err
+		}
+		switch b[0] {
+		case 0x00:
+			d.Eq = true
+			d.Index, err = leb128.ReadVarUint32(r)
+		case 0x01:
+		default:
+			return d, InvalidComponentCodeError{"type bound", b[0]}
+		}
+	default:
+		return d, InvalidComponentCodeError{"extern descriptor", b[0]}
+	}
+	return d, err
+}
+
+// CoreType is a core type defined by a component: the function type Sig,
+// or the type of a core module if Module is set, described by its
+// declarations.
+type CoreType struct {
+	Sig    FunctionSig
+	Module bool
+	Decls  []CoreModuleDecl
+}
+
+// CoreModuleDeclKind is the kind of a declaration of a core module type.
+type CoreModuleDeclKind uint8
+
+// The kinds of the declarations of a core module type, with their codes of
+// the binary format.
+const (
+	CoreModuleDeclImport CoreModuleDeclKind = 0x00
+	CoreModuleDeclType   CoreModuleDeclKind = 0x01
+	CoreModuleDeclAlias  CoreModuleDeclKind = 0x02
+	CoreModuleDeclExport CoreModuleDeclKind = 0x03
+)
+
+// CoreModuleDecl is a declaration of a core module type: an import, a
+// type, an outer alias, or an export, described by an Import without a
+// module name.
+type CoreModuleDecl struct {
+	Kind   CoreModuleDeclKind
+	Import ImportEntry
+	Type   *CoreType
+	Alias  *Alias
+}
+
+// the code introducing a core module type, 0x50, which is also the one of
+// the subtypes of the GC proposal: the core types of a component don't
+// declare subtypes
+const typeModule = -0x30
+
+func readCoreType(r io.Reader) (CoreType, error) {
+	t := CoreType{}
+	form, err := leb128.ReadVarint32(r)
+	if err != nil {
+		return t, err
+	}
+	if form == 0x00 {
+		// the module types are prefixed to be told apart from the
+		// recursion groups of the GC proposal
+		if form, err = leb128.ReadVarint32(r); err != nil {
+			return t, err
+		}
+		if form != typeModule {
+			return t, InvalidComponentCodeError{"core type", byte(form) & 0x7f}
+		}
+	}
+	if form != typeModule {
+		t.Sig, err = readFunction(r, form)
+		return t, err
+	}
+
+	t.Module = true
+	count, err := readCount(r)
+	if err != nil {
+		return t, err
+	}
+	for i := uint32(0); i < count; i++ {
+		b, err := readBytes(r, 1)
+		if err != nil {
+			return t, err
+		}
+		d := CoreModuleDecl{Kind: CoreModuleDeclKind(b[0])}
+		switch d.Kind {
+		case CoreModuleDeclImport:
+			d.Import, err = readImportEntry(r, 0)
+		case CoreModuleDeclType:
+			var typ CoreType
+			if typ, err = readCoreType(r); err == nil {
+				d.Type = &typ
+			}
+		case CoreModuleDeclAlias:
+			var alias Alias
+			if alias, err = readCoreAlias(r); err == nil {
+				d.Alias = &alias
+			}
+		case CoreModuleDeclExport:
+			if d.Import.FieldName, err = readName(r); err == nil {
+				err = readImportDesc(r, &d.Import)
+			}
+		default:
+			return t, InvalidComponentCodeError{"core module declaration", b[0]}
+		}
+		if err != nil {
+			return t, err
+		}
+		t.Decls = append(t.Decls, d)
+	}
+	return t, nil
+}
+
+// readCoreAlias reads an alias of a core module type, which can only be an
+// outer alias.
+func readCoreAlias(r io.Reader) (Alias, error) {
+	sort, err := readCoreSort(r)
+	if err != nil {
+		return Alias{}, err
+	}
+	b, err := readBytes(r, 1)
+	if err != nil {
+		return Alias{}, err
+	}
+	if b[0] != 0x01 {
+		return Alias{}, InvalidAliasTargetError(b[0])
+	}
+	a := Alias{Sort: sort, Target: AliasOuter}
+	if a.Instance, err = leb128.ReadVarUint32(r); err != nil {
+		return a, err
+	}
+	a.Index, err = leb128.ReadVarUint32(r)
+	return a, err
+}
@@ -0,0 +1,133 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+import "bytes"
+
+// CustomSectionNames returns the names of the custom sections of the
+// module, once each, in the order the sections first appear.
+func (m *Module) CustomSectionNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, s := range m.Other {
+		if !seen[s.Name] {
+			seen[s.Name] = true
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// CustomSections returns the custom sections of the module with the given
+// name, in order. The Bytes of a section are its payload after the name.
+func (m *Module) CustomSections(name string) []Section {
+	var sections []Section
+	for _, s := range m.Other {
+		if s.Name == name {
+			sections = append(sections, s)
+		}
+	}
+	return sections
+}
+
+// CustomSection returns the payload, after the name, of the first custom
+// section of the module with the given name, and false if it has none.
+func (m *Module) CustomSection(name string) ([]byte, bool) {
+	for _, s := range m.Other {
+		if s.Name == name {
+			return s.Bytes, true
+		}
+	}
+	return nil, false
+}
+
+// AddCustomSection adds a custom section with the given name and payload
+// to the module, which Encode writes after all the other sections.
+func (m *Module) AddCustomSection(name string, payload []byte) {
+	start := m.end()
+	m.Other = append(m.Other, Section{
+		Start:      start,
+		End:        start,
+		ID:         SectionIDCustom,
+		PayloadLen: customPayloadLen(name, payload),
+		Name:       name,
+		Bytes:      payload,
+	})
+}
+
+// SetCustomSection replaces the payload of the first custom section of the
+// module with the given name, which keeps its place, and removes the other
+// ones with this name. It adds the section if the module has none.
+func (m *Module) SetCustomSection(name string, payload []byte) {
+	others := m.Other[:0]
+	found := false
+	for _, s := range m.Other {
+		if s.Name != name {
+			others = append(others, s)
+			continue
+		}
+		if !found {
+			found = true
+			s.Bytes = payload
+			s.PayloadLen = customPayloadLen(name, payload)
+			others = append(others, s)
+		}
+	}
+	m.Other = others
+	if !found {
+		m.AddCustomSection(name, payload)
+	}
+}
+
+// RemoveCustomSections removes the custom sections of the module with the
+// given name, and returns the number of sections removed.
+func (m *Module) RemoveCustomSections(name string) int {
+	others := m.Other[:0]
+	for _, s := range m.Other {
+		if s.Name != name {
+			others = append(others, s)
+		}
+	}
+	removed := len(m.Other) - len(others)
+	m.Other = others
+	return removed
+}
+
+// end returns the offset of the end of the last section of the module.
+func (m *Module) end() int64 {
+	var end int64
+	for _, id := range sectionIDs {
+		if s, _ := m.encoder(id); s != nil && s.End > end {
+			end = s.End
+		}
+	}
+	for _, s := range m.Other {
+		if s.End > end {
+			end = s.End
+		}
+	}
+	return end
+}
+
+// customPayloadLen returns the size of the payload of a custom section with
+// the given name and payload.
+func customPayloadLen(name string, payload []byte) uint32 {
+	var b bytes.Buffer
+	writeName(&b, name)
+	return uint32(b.Len() + len(payload))
+}
@@ -0,0 +1,72 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+import "reflect"
+
+// DataSegmentInfo describes a data segment of a module as it is decoded,
+// with the offset of an active segment evaluated.
+type DataSegmentInfo struct {
+	Segment    int // the index of the segment in the data section
+	Mode       SegmentMode
+	Memory     uint32 // the index of the memory of an active segment
+	OffsetExpr []byte // the initializer expression of the offset, nil for a passive segment
+	Offset     uint64 // the offset of an active segment in its memory
+	Data       []byte
+}
+
+// End returns the offset past the last byte of an active segment.
+func (s DataSegmentInfo) End() uint64 {
+	return s.Offset + uint64(len(s.Data))
+}
+
+// DataSegments returns the data segments of the module, in the order of
+// the data section. The offsets read imported globals with the values
+// given by the modules resolved while reading the module. The contents
+// are the ones of the module, which must not be modified.
+func (m *Module) DataSegments() ([]DataSegmentInfo, error) {
+	if m.Data == nil {
+		return nil, nil
+	}
+	segments := make([]DataSegmentInfo, len(m.Data.Entries))
+	for i, entry := range m.Data.Entries {
+		segments[i] = DataSegmentInfo{
+			Segment:    i,
+			Mode:       entry.Mode,
+			Memory:     entry.Index,
+			OffsetExpr: entry.Offset,
+			Data:       entry.Data,
+		}
+		if entry.Mode != SegmentActive {
+			continue
+		}
+		val, err := m.ExecInitExpr(entry.Offset)
+		if err != nil {
+			return nil, err
+		}
+		switch val := val.(type) {
+		case int32:
+			segments[i].Offset = uint64(uint32(val))
+		case int64:
+			segments[i].Offset = uint64(val)
+		default:
+			return nil, InvalidValueTypeInitExprError{reflect.Int32, reflect.ValueOf(val).Kind()}
+		}
+	}
+	return segments, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/bottos-project/bottos/vm/wasm/log"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/internal/readpos"
+)
+
+// Decoder reads a module from a stream section by section, so that each
+// section is decoded, and an invalid module rejected, as soon as it
+// arrives. ReadModuleWithLimits reads a module with a Decoder.
+type Decoder struct {
+	// DiscardSectionBytes leaves the Bytes of the sections other than the
+	// custom ones nil, so that the decoder buffers the payload of a
+	// section only as long as it decodes it. The instrumentation of
+	// exec.InstrumentGas needs the Bytes of the sections.
+	DiscardSectionBytes bool
+	// LazyCode leaves the function bodies encoded as they are read, for
+	// FunctionBody.Decode to decode on demand: reading the imports and
+	// exports of a module doesn't pay for decoding its code. The limits
+	// on the locals of a function are only checked once it is decoded.
+	LazyCode bool
+
+	r      *readpos.ReadPos
+	m      *Module
+	header bool // whether the header of the module was read
+	done   bool // whether the last section was read
+}
+
+// NewDecoder returns a decoder reading a module from r within limits.
+func NewDecoder(r io.Reader, limits DecodeLimits) *Decoder {
+	return &Decoder{
+		r: &readpos.ReadPos{R: r},
+		m: &Module{limits: limits},
+	}
+}
+
+// NewBytesDecoder returns a decoder reading the module encoded in data
+// within limits. The function bodies of the module refer to data rather
+// than to copies of it, so data must not be modified while they are used.
+func NewBytesDecoder(data []byte, limits DecodeLimits) *Decoder {
+	d := NewDecoder(bytes.NewReader(data), limits)
+	d.m.source = &source{data: data, pos: d.r}
+	return d
+}
+
+// source is the bytes of a module read by a NewBytesDecoder, along with
+// the position of the decoder in them.
+type source struct {
+	data []byte
+	pos  *readpos.ReadPos
+}
+
+// Module returns the module being read, which holds the sections read so
+// far. Its index spaces are only built by Finish.
+func (d *Decoder) Module() *Module {
+	return d.m
+}
+
+// Offset returns the number of bytes of the stream read so far.
+func (d *Decoder) Offset() int64 {
+	return d.r.CurPos
+}
+
+// Next reads the next section of the module, and returns it once decoded.
+// It returns io.EOF after the last section.
+func (d *Decoder) Next() (Section, error) {
+	if !d.header {
+		if err := d.readHeader(); err != nil {
+			if err == io.EOF {
+				// io.EOF only ends a complete module
+				err = io.ErrUnexpectedEOF
+			}
+			return Section{}, err
+		}
+		d.header = true
+	}
+	if d.done {
+		return Section{}, io.EOF
+	}
+	d.m.lazyCode = d.LazyCode
+	s, err := d.m.readSection(d.r, !d.DiscardSectionBytes)
+	if err != nil {
+		return Section{}, err
+	}
+	if s == nil {
+		d.done = true
+		return Section{}, io.EOF
+	}
+	return *s, nil
+}
+
+func (d *Decoder) readHeader() error {
+	magic, err := readU32(d.r)
+	if err != nil {
+		return err
+	}
+	if magic != Magic {
+		return ErrInvalidMagic
+	}
+	if d.m.Version, err = readU32(d.r); err != nil {
+		return err
+	}
+	if d.m.Version == ComponentVersion {
+		return ErrComponent
+	}
+	return nil
+}
+
+// Finish reads the sections left, checks that the module is complete, and
+// builds its index spaces like ReadModule, resolving its imports with
+// resolvePath.
+func (d *Decoder) Finish(resolvePath ResolveFunc) (*Module, error) {
+	for {
+		_, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m := d.m
+	m.source = nil
+	if m.Function != nil && len(m.Function.Types) != 0 && m.Code == nil {
+		return nil, CountMismatchError{Offset: d.r.CurPos, Functions: len(m.Function.Types)}
+	}
+	if m.DataCount != nil && m.DataCount.Count != 0 && m.Data == nil {
+		return nil, ErrDataCountMismatch
+	}
+
+	// the index space holds at least one memory, whose data is empty if
+	// the module has none
+	m.LinearMemoryIndexSpace = make([][]byte, 1)
+	if memories := m.Memories(); len(memories) > 1 {
+		m.LinearMemoryIndexSpace = make([][]byte, len(memories))
+	}
+	if tables := m.Tables(); len(tables) != 0 {
+		m.TableIndexSpace = make([][]uint32, len(tables))
+	}
+
+	if m.Import != nil && resolvePath != nil {
+		err := m.resolveImports(resolvePath) //resolvePath is importer() function
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, fn := range []func() error{
+		m.checkTags,
+		m.populateGlobals,
+		m.populateFunctions,
+		m.populateTables,
+		m.populateLinearMemory,
+	} {
+		if err := fn(); err != nil {
+			return nil, err
+		}
+
+	}
+	m.setFunctionNames()
+
+	log.Trace("There are %d entries in the function index space.", len(m.FunctionIndexSpace))
+	return m, nil
+}
@@ -19,5 +19,6 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package wasm provides functions for reading and parsing WebAssembly modules.
+// Package wasm provides functions for reading and parsing WebAssembly modules,
+// and the components of the component model, see ReadComponent.
 package wasm
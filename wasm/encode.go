@@ -0,0 +1,442 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+// Encode writes m to w in the binary format, from the entries of its
+// sections: the modules changed or built in memory can be encoded as well
+// as the ones read by ReadModule. The custom sections of m.Other keep
+// their place among the sections the module was read with, and follow
+// them otherwise.
+//
+// The types are written as a single recursion group if one of them
+// references a type by index, since the types section of m doesn't keep
+// its groups.
+func (m *Module) Encode(w io.Writer) error {
+	var out bytes.Buffer
+	binary.Write(&out, binary.LittleEndian, Magic)
+	version := m.Version
+	if version == 0 {
+		version = Version
+	}
+	binary.Write(&out, binary.LittleEndian, version)
+
+	others := m.Other
+	for _, id := range sectionIDs {
+		section, write := m.encoder(id)
+		if section == nil {
+			continue
+		}
+		for len(others) > 0 && others[0].Start < section.Start {
+			encodeCustomSection(&out, others[0])
+			others = others[1:]
+		}
+		var payload bytes.Buffer
+		if err := write(&payload); err != nil {
+			return err
+		}
+		writeSection(&out, id, payload.Bytes())
+	}
+	for _, s := range others {
+		encodeCustomSection(&out, s)
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// sectionIDs are the ids of the sections other than the custom ones, in
+// the order of the binary format.
+var sectionIDs = []SectionID{
+	SectionIDType, SectionIDImport, SectionIDFunction, SectionIDTable,
+	SectionIDMemory, SectionIDTag, SectionIDGlobal, SectionIDExport,
+	SectionIDStart, SectionIDElement, SectionIDDataCount, SectionIDCode,
+	SectionIDData,
+}
+
+// encoder returns the section id of m and the function writing its
+// payload, or nil if m has no such section.
+func (m *Module) encoder(id SectionID) (*Section, func(*bytes.Buffer) error) {
+	switch {
+	case id == SectionIDType && m.Types != nil:
+		return &m.Types.Section, m.encodeTypes
+	case id == SectionIDImport && m.Import != nil:
+		return &m.Import.Section, m.encodeImports
+	case id == SectionIDFunction && m.Function != nil:
+		return &m.Function.Section, m.encodeFunctions
+	case id == SectionIDTable && m.Table != nil:
+		return &m.Table.Section, m.encodeTables
+	case id == SectionIDMemory && m.Memory != nil:
+		return &m.Memory.Section, m.encodeMemories
+	case id == SectionIDTag && m.Tag != nil:
+		return &m.Tag.Section, m.encodeTags
+	case id == SectionIDGlobal && m.Global != nil:
+		return &m.Global.Section, m.encodeGlobals
+	case id == SectionIDExport && m.Export != nil:
+		return &m.Export.Section, m.encodeExports
+	case id == SectionIDStart && m.Start != nil:
+		return &m.Start.Section, m.encodeStart
+	case id == SectionIDElement && m.Elements != nil:
+		return &m.Elements.Section, m.encodeElements
+	case id == SectionIDDataCount && m.DataCount != nil:
+		return &m.DataCount.Section, m.encodeDataCount
+	case id == SectionIDCode && m.Code != nil:
+		return &m.Code.Section, m.encodeCode
+	case id == SectionIDData && m.Data != nil:
+		return &m.Data.Section, m.encodeData
+	}
+	return nil, nil
+}
+
+// EncodeError is returned by Encode for an entry it can't encode.
+type EncodeError struct {
+	Section SectionID
+	Reason  string
+}
+
+func (e EncodeError) Error() string {
+	return fmt.Sprintf("wasm: can't encode %s section: %s", e.Section, e.Reason)
+}
+
+func writeSection(w *bytes.Buffer, id SectionID, payload []byte) {
+	leb128.WriteVarUint32(w, uint32(id))
+	leb128.WriteVarUint32(w, uint32(len(payload)))
+	w.Write(payload)
+}
+
+func encodeCustomSection(w *bytes.Buffer, s Section) {
+	var payload bytes.Buffer
+	writeName(&payload, s.Name)
+	payload.Write(s.Bytes)
+	writeSection(w, SectionIDCustom, payload.Bytes())
+}
+
+func writeName(w *bytes.Buffer, name string) {
+	leb128.WriteVarUint32(w, uint32(len(name)))
+	w.WriteString(name)
+}
+
+// writeValueType writes the value type t, the references to a type of the
+// types section being written as nullable references to it.
+func writeValueType(w *bytes.Buffer, t ValueType) {
+	if t >= 0 {
+		leb128.WriteVarint64(w, refNullPrefix)
+	}
+	leb128.WriteVarint64(w, int64(t))
+}
+
+func writeValueTypes(w *bytes.Buffer, types []ValueType) {
+	leb128.WriteVarUint32(w, uint32(len(types)))
+	for _, t := range types {
+		writeValueType(w, t)
+	}
+}
+
+func writeLimits(w *bytes.Buffer, l ResizableLimits) {
+	leb128.WriteVarUint32(w, l.Flags)
+	leb128.WriteVarUint32(w, l.Initial)
+	if l.Flags&0x1 != 0 {
+		leb128.WriteVarUint32(w, l.Maximum)
+	}
+	if l.Flags&0x8 != 0 {
+		leb128.WriteVarUint32(w, l.PageSizeLog2)
+	}
+}
+
+func writeGlobalVar(w *bytes.Buffer, g GlobalVar) {
+	writeValueType(w, g.Type)
+	if g.Mutable {
+		w.WriteByte(1)
+	} else {
+		w.WriteByte(0)
+	}
+}
+
+func (m *Module) encodeTypes(w *bytes.Buffer) error {
+	entries := m.Types.Entries
+	// a type may only reference the types before it, or the ones of its
+	// recursion group
+	rec := false
+	for _, sig := range entries {
+		indexed := len(sig.Supertypes) != 0
+		for _, t := range append(append([]ValueType{}, sig.ParamTypes...), sig.ReturnTypes...) {
+			indexed = indexed || t >= 0
+		}
+		for _, field := range sig.Fields {
+			indexed = indexed || field.Type >= 0
+		}
+		rec = rec || indexed
+	}
+	if rec {
+		leb128.WriteVarUint32(w, 1)
+		leb128.WriteVarint64(w, typeRec)
+	}
+	leb128.WriteVarUint32(w, uint32(len(entries)))
+
+	for _, sig := range entries {
+		if len(sig.Supertypes) != 0 {
+			leb128.WriteVarint64(w, typeSub)
+			leb128.WriteVarUint32(w, uint32(len(sig.Supertypes)))
+			for _, index := range sig.Supertypes {
+				leb128.WriteVarUint32(w, index)
+			}
+		}
+		form := int(sig.Form)
+		if form == 0 {
+			form = TypeFunc
+		}
+		leb128.WriteVarint64(w, int64(form))
+		switch form {
+		case TypeFunc:
+			writeValueTypes(w, sig.ParamTypes)
+			writeValueTypes(w, sig.ReturnTypes)
+		case TypeStruct, TypeArray:
+			if form == TypeStruct {
+				leb128.WriteVarUint32(w, uint32(len(sig.Fields)))
+			} else if len(sig.Fields) != 1 {
+				return EncodeError{SectionIDType, "array type without a single element type"}
+			}
+			for _, field := range sig.Fields {
+				writeGlobalVar(w, GlobalVar{Type: field.Type, Mutable: field.Mutable})
+			}
+		default:
+			return EncodeError{SectionIDType, fmt.Sprintf("unknown type constructor %d", form)}
+		}
+	}
+	return nil
+}
+
+func (m *Module) encodeImports(w *bytes.Buffer) error {
+	leb128.WriteVarUint32(w, uint32(len(m.Import.Entries)))
+	for _, entry := range m.Import.Entries {
+		writeName(w, entry.ModuleName)
+		writeName(w, entry.FieldName)
+		w.WriteByte(byte(entry.Kind))
+		switch t := entry.Type.(type) {
+		case FuncImport:
+			leb128.WriteVarUint32(w, t.Type)
+		case TableImport:
+			writeValueType(w, ValueType(t.Type.ElementType))
+			writeLimits(w, t.Type.Limits)
+		case MemoryImport:
+			writeLimits(w, t.Type.Limits)
+		case GlobalVarImport:
+			writeGlobalVar(w, t.Type)
+		case TagImport:
+			w.WriteByte(t.Type.Attribute)
+			leb128.WriteVarUint32(w, t.Type.Type)
+		default:
+			return EncodeError{SectionIDImport, fmt.Sprintf("unknown type of import %s.%s", entry.ModuleName, entry.FieldName)}
+		}
+	}
+	return nil
+}
+
+func (m *Module) encodeFunctions(w *bytes.Buffer) error {
+	leb128.WriteVarUint32(w, uint32(len(m.Function.Types)))
+	for _, t := range m.Function.Types {
+		leb128.WriteVarUint32(w, t)
+	}
+	return nil
+}
+
+func (m *Module) encodeTables(w *bytes.Buffer) error {
+	leb128.WriteVarUint32(w, uint32(len(m.Table.Entries)))
+	for _, table := range m.Table.Entries {
+		writeValueType(w, ValueType(table.ElementType))
+		writeLimits(w, table.Limits)
+	}
+	return nil
+}
+
+func (m *Module) encodeMemories(w *bytes.Buffer) error {
+	leb128.WriteVarUint32(w, uint32(len(m.Memory.Entries)))
+	for _, memory := range m.Memory.Entries {
+		writeLimits(w, memory.Limits)
+	}
+	return nil
+}
+
+func (m *Module) encodeTags(w *bytes.Buffer) error {
+	leb128.WriteVarUint32(w, uint32(len(m.Tag.Entries)))
+	for _, tag := range m.Tag.Entries {
+		w.WriteByte(tag.Attribute)
+		leb128.WriteVarUint32(w, tag.Type)
+	}
+	return nil
+}
+
+func (m *Module) encodeGlobals(w *bytes.Buffer) error {
+	leb128.WriteVarUint32(w, uint32(len(m.Global.Globals)))
+	for i, global := range m.Global.Globals {
+		if global.Type == nil {
+			return EncodeError{SectionIDGlobal, fmt.Sprintf("global %d has no type", i)}
+		}
+		writeGlobalVar(w, *global.Type)
+		if err := writeInitExpr(w, SectionIDGlobal, global.Init); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeInitExpr writes the initializer expression expr, which ends with
+// an end operator.
+func writeInitExpr(w *bytes.Buffer, id SectionID, expr []byte) error {
+	if len(expr) == 0 || expr[len(expr)-1] != end {
+		return EncodeError{id, "initializer expression without end"}
+	}
+	w.Write(expr)
+	return nil
+}
+
+func (m *Module) encodeExports(w *bytes.Buffer) error {
+	exports := m.Exports()
+	leb128.WriteVarUint32(w, uint32(len(exports)))
+	for _, entry := range exports {
+		writeName(w, entry.FieldStr)
+		w.WriteByte(byte(entry.Kind))
+		leb128.WriteVarUint32(w, entry.Index)
+	}
+	return nil
+}
+
+func (m *Module) encodeStart(w *bytes.Buffer) error {
+	leb128.WriteVarUint32(w, m.Start.Index)
+	return nil
+}
+
+func (m *Module) encodeElements(w *bytes.Buffer) error {
+	leb128.WriteVarUint32(w, uint32(len(m.Elements.Entries)))
+	for _, segment := range m.Elements.Entries {
+		// the flags select the mode, an explicit table index and the
+		// encoding of the elements, see readElementSegment
+		var flags uint32
+		if segment.Exprs {
+			flags = 4
+		}
+		short := segment.Index == 0 && (!segment.Exprs || segment.Type == ValueTypeFuncref)
+		switch {
+		case segment.Mode == SegmentPassive:
+			flags |= 1
+		case segment.Mode == SegmentDeclarative:
+			flags |= 3
+		case !short:
+			flags |= 2
+		}
+		leb128.WriteVarUint32(w, flags)
+		if flags&^4 == 2 {
+			leb128.WriteVarUint32(w, segment.Index)
+		}
+		if segment.Mode == SegmentActive {
+			if err := writeInitExpr(w, SectionIDElement, segment.Offset); err != nil {
+				return err
+			}
+		}
+		switch {
+		case flags&^4 == 0:
+		case segment.Exprs:
+			writeValueType(w, segment.Type)
+		default:
+			w.WriteByte(0) // funcref
+		}
+
+		leb128.WriteVarUint32(w, uint32(len(segment.Elems)))
+		for _, elem := range segment.Elems {
+			switch {
+			case !segment.Exprs:
+				leb128.WriteVarUint32(w, elem)
+			case elem == uint32(NullRef):
+				w.WriteByte(refNull)
+				writeHeapType(w, segment.Type)
+				w.WriteByte(end)
+			default:
+				w.WriteByte(refFunc)
+				leb128.WriteVarUint32(w, elem)
+				w.WriteByte(end)
+			}
+		}
+	}
+	return nil
+}
+
+// writeHeapType writes the heap type of the references of type t.
+func writeHeapType(w *bytes.Buffer, t ValueType) {
+	leb128.WriteVarint64(w, int64(t))
+}
+
+func (m *Module) encodeDataCount(w *bytes.Buffer) error {
+	leb128.WriteVarUint32(w, m.DataCount.Count)
+	return nil
+}
+
+func (m *Module) encodeCode(w *bytes.Buffer) error {
+	leb128.WriteVarUint32(w, uint32(len(m.Code.Bodies)))
+	var body bytes.Buffer
+	for _, fn := range m.Code.Bodies {
+		if fn.lazy != nil && !fn.lazy.decoded {
+			// the body is written back as it was read
+			leb128.WriteVarUint32(w, uint32(len(fn.lazy.raw)))
+			w.Write(fn.lazy.raw)
+			continue
+		}
+		body.Reset()
+		leb128.WriteVarUint32(&body, uint32(len(fn.Locals)))
+		for _, local := range fn.Locals {
+			leb128.WriteVarUint32(&body, local.Count)
+			writeValueType(&body, local.Type)
+		}
+		body.Write(fn.Code)
+		body.WriteByte(end)
+
+		leb128.WriteVarUint32(w, uint32(body.Len()))
+		w.Write(body.Bytes())
+	}
+	return nil
+}
+
+func (m *Module) encodeData(w *bytes.Buffer) error {
+	leb128.WriteVarUint32(w, uint32(len(m.Data.Entries)))
+	for _, segment := range m.Data.Entries {
+		switch {
+		case segment.Mode == SegmentPassive:
+			w.WriteByte(1)
+		case segment.Index == 0:
+			w.WriteByte(0)
+		default:
+			w.WriteByte(2)
+			leb128.WriteVarUint32(w, segment.Index)
+		}
+		if segment.Mode == SegmentActive {
+			if err := writeInitExpr(w, SectionIDData, segment.Offset); err != nil {
+				return err
+			}
+		}
+		leb128.WriteVarUint32(w, uint32(len(segment.Data)))
+		w.Write(segment.Data)
+	}
+	return nil
+}
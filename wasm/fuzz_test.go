@@ -0,0 +1,98 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wasm_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wat"
+)
+
+// fuzzLimits are the decode limits of the fuzz targets, low enough for a
+// module to be decoded quickly whatever its counts.
+var fuzzLimits = wasm.DecodeLimits{
+	MaxModuleSize:     1 << 20,
+	MaxFunctions:      1 << 10,
+	MaxLocalsPerFunc:  1 << 10,
+	MaxGlobals:        1 << 10,
+	MaxImports:        1 << 10,
+	MaxDataSegments:   1 << 10,
+	MaxBrTableTargets: 1 << 10,
+	MaxNameLength:     1 << 10,
+	MaxTableElements:  1 << 16,
+}
+
+// fuzzImported is the module the modules decoded by FuzzDecodeModule
+// import from, exporting an entry of every kind.
+const fuzzImported = `(module
+  (func (export "f") (param i32) (result i32) (local.get 0))
+  (global (export "g") i32 (i32.const 1))
+  (table (export "t") 1 funcref)
+  (memory (export "m") 1)
+  (tag (export "e") (param i32)))`
+
+// FuzzDecodeModule decodes arbitrary modules, which may fail but never
+// panic, resolving their imports from "m" and "env".
+func FuzzDecodeModule(f *testing.F) {
+	imported, err := wat.Parse([]byte(fuzzImported), nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+	resolve := func(name string) (*wasm.Module, error) {
+		if name != "m" {
+			return nil, fmt.Errorf("no module %q", name)
+		}
+		return imported, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "*.wasm"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range files {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(raw)
+	}
+	for _, src := range []string{
+		`(import "m" "f" (func (param i32) (result i32))) (import "m" "g" (global i32))
+		 (import "m" "t" (table 1 funcref)) (import "m" "m" (memory 1)) (import "m" "e" (tag (param i32)))`,
+		`(import "env" "f" (func)) (import "env" "memory" (memory 1)) (import "env" "memoryBase" (global i32))`,
+		`(import "m" "missing" (func)) (import "other" "f" (func))`,
+	} {
+		code, err := wat.Assemble([]byte(src))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(code)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := wasm.ReadModuleWithLimits(bytes.NewReader(data), resolve, fuzzLimits)
+		if err == nil && m == nil {
+			t.Fatal("no module and no error")
+		}
+	})
+}
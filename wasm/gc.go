@@ -0,0 +1,125 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+// checkTypeIndices returns an error if a type of the types section
+// references a type past its end.
+func checkTypeIndices(types []FunctionSig) error {
+	check := func(t ValueType) error {
+		if t >= 0 && int(t) >= len(types) {
+			return InvalidTypeIndexError(t)
+		}
+		return nil
+	}
+	for _, sig := range types {
+		for _, t := range append(sig.ParamTypes, sig.ReturnTypes...) {
+			if err := check(t); err != nil {
+				return err
+			}
+		}
+		for _, field := range sig.Fields {
+			if err := check(field.Type); err != nil {
+				return err
+			}
+		}
+		for _, index := range sig.Supertypes {
+			if int(index) >= len(types) {
+				return InvalidTypeIndexError(index)
+			}
+		}
+	}
+	return nil
+}
+
+// Subtype returns whether the values of type t are also values of type of,
+// following the subtyping rules of the reference types of the GC proposal.
+// The references to a type of the types section are subtypes of the
+// references to its declared supertypes, and of the abstract reference
+// type of its kind.
+func (m *Module) Subtype(t, of ValueType) bool {
+	if t == of {
+		return true
+	}
+	if !t.IsRef() || !of.IsRef() {
+		return false
+	}
+	if t >= 0 {
+		sig := m.typeEntry(t)
+		if sig == nil {
+			return false
+		}
+		if of >= 0 {
+			// the function types are compared structurally, like
+			// call_indirect does
+			if other := m.typeEntry(of); other != nil && !sig.IsStruct() && !sig.IsArray() && !other.IsStruct() && !other.IsArray() {
+				if sameTypes(sig.ParamTypes, other.ParamTypes) && sameTypes(sig.ReturnTypes, other.ReturnTypes) {
+					return true
+				}
+			}
+			for _, super := range sig.Supertypes {
+				if m.Subtype(ValueType(super), of) {
+					return true
+				}
+			}
+			return false
+		}
+		switch {
+		case sig.IsStruct():
+			t = ValueTypeStructref
+		case sig.IsArray():
+			t = ValueTypeArrayref
+		default:
+			t = ValueTypeFuncref
+		}
+		return m.Subtype(t, of)
+	}
+
+	switch t {
+	case ValueTypeNullref:
+		return m.Subtype(of, ValueTypeAnyref)
+	case ValueTypeNullfuncref:
+		return m.Subtype(of, ValueTypeFuncref)
+	case ValueTypeNullexternref:
+		return of == ValueTypeExternref
+	case ValueTypeI31ref, ValueTypeStructref, ValueTypeArrayref:
+		return of == ValueTypeEqref || of == ValueTypeAnyref
+	case ValueTypeEqref:
+		return of == ValueTypeAnyref
+	}
+	return false
+}
+
+// typeEntry returns the type at the index t of the types section, or nil.
+func (m *Module) typeEntry(t ValueType) *FunctionSig {
+	if m.Types == nil || int(t) >= len(m.Types.Entries) {
+		return nil
+	}
+	return &m.Types.Entries[t]
+}
+
+func sameTypes(a, b []ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
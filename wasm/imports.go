@@ -24,7 +24,7 @@ package wasm
 import (
 	"errors"
 	"fmt"
-	log "github.com/cihub/seelog"
+	"github.com/bottos-project/bottos/vm/wasm/log"
 )
 
 // Import is an intreface implemented by types that can be imported by a WebAssembly module.
@@ -42,6 +42,7 @@ type ImportEntry struct {
 	// If Kind is Table, Type is a TableImport containing the type of the imported table
 	// If Kind is Memory, Type is a MemoryImport containing the type of the imported memory
 	// If the Kind is Global, Type is a GlobalVarImport
+	// If the Kind is Tag, Type is a TagImport
 	Type Import
 }
 
@@ -73,6 +74,13 @@ type GlobalVarImport struct {
 
 func (GlobalVarImport) isImport() {}
 
+// TagImport define imported exception tag
+type TagImport struct {
+	Type TagType
+}
+
+func (TagImport) isImport() {}
+
 var (
 	// ErrImportMutGlobal import global mutable variable
 	ErrImportMutGlobal = errors.New("wasm: cannot import global mutable variable")
@@ -124,7 +132,6 @@ func (module *Module) resolveImports(resolve ResolveFunc) error {
 
 	modules := make(map[string]*Module)
 
-	var funcs uint32
 	for _, importEntry := range module.Import.Entries {
 		//add support for "env" import
 		isEnv := false
@@ -136,21 +143,26 @@ func (module *Module) resolveImports(resolve ResolveFunc) error {
 			switch importEntry.Kind {
 			case ExternalFunction:
 				//get the function type
-				funcType := module.Types.Entries[importEntry.Type.(FuncImport).Type]
+				typeIndex := importEntry.Type.(FuncImport).Type
+				if module.Types == nil || int(typeIndex) >= len(module.Types.Entries) {
+					return InvalidTypeIndexError(typeIndex)
+				}
+				funcType := module.Types.Entries[typeIndex]
 
 				//todo complete the function sig and body
 				//todo verify the env function sig????
 
 				fn := &Function{EnvFunc: true, Method: importEntry.FieldName, Sig: &FunctionSig{ParamTypes: funcType.ParamTypes, ReturnTypes: funcType.ReturnTypes}, Body: &FunctionBody{}}
 				module.FunctionIndexSpace = append(module.FunctionIndexSpace, *fn)
-				module.Code.Bodies = append(module.Code.Bodies, *fn.Body)
-				module.imports.Funcs = append(module.imports.Funcs, funcs)
-				funcs++
+				if module.Code != nil {
+					module.Code.Bodies = append(module.Code.Bodies, *fn.Body)
+				}
+				module.imports.Funcs = append(module.imports.Funcs, importEntry.Type.(FuncImport).Type)
 			case ExternalGlobal:
 				//todo to support the memorybase global
 				if importEntry.FieldName == "memoryBase" || importEntry.FieldName == "tableBase" {
 					glb := &GlobalEntry{Type: &GlobalVar{Type: ValueTypeI32, Mutable: false},
-						Init:      []byte{getGlobal, byte(0), end}, //global 0 end
+						Init:      []byte{i32Const, 16, end}, // i32.const 16, the value of the env global
 						envGlobal: NewEnvGlobal(true, 16),
 					}
 					module.GlobalIndexSpace = append(module.GlobalIndexSpace, *glb)
@@ -158,15 +170,17 @@ func (module *Module) resolveImports(resolve ResolveFunc) error {
 				}
 
 			case ExternalTable:
-				//todo to support the table import
-				module.TableIndexSpace[0] = []uint32{uint32(0)}
+				// the table starts with null elements like the tables
+				// of the module, see populateTables
 				module.imports.Tables++
 			case ExternalMemory:
-				initMemSize := importEntry.Type.(MemoryImport).Type.Limits.Initial
-				//todo decide how to lazy alloc the memory???
-				memory := make([]byte, 65536*initMemSize)
-				module.LinearMemoryIndexSpace[0] = memory
+				// the memory is allocated when the module is instantiated,
+				// see MemoryLimits, the index space only holds the data
 				module.imports.Memories++
+			case ExternalTag:
+				// the tag is resolved when the module is
+				// instantiated, like the functions
+				module.imports.Tags++
 
 			default:
 				log.Info("not support import type")
@@ -211,9 +225,10 @@ func (module *Module) resolveImports(resolve ResolveFunc) error {
 					return InvalidFunctionIndexError(index)
 				}
 				module.FunctionIndexSpace = append(module.FunctionIndexSpace, *fn)
-				module.Code.Bodies = append(module.Code.Bodies, *fn.Body)
-				module.imports.Funcs = append(module.imports.Funcs, funcs)
-				funcs++
+				if module.Code != nil {
+					module.Code.Bodies = append(module.Code.Bodies, *fn.Body)
+				}
+				module.imports.Funcs = append(module.imports.Funcs, importEntry.Type.(FuncImport).Type)
 			case ExternalGlobal:
 				glb := importedModule.GetGlobal(int(index))
 				if glb == nil {
@@ -231,14 +246,21 @@ func (module *Module) resolveImports(resolve ResolveFunc) error {
 				if int(index) >= len(importedModule.TableIndexSpace) {
 					return InvalidTableIndexError(index)
 				}
-				module.TableIndexSpace[0] = importedModule.TableIndexSpace[0]
+				module.TableIndexSpace[module.imports.Tables] = importedModule.TableIndexSpace[index]
 				module.imports.Tables++
 			case ExternalMemory:
 				if int(index) >= len(importedModule.LinearMemoryIndexSpace) {
 					return InvalidLinearMemoryIndexError(index)
 				}
-				module.LinearMemoryIndexSpace[0] = importedModule.LinearMemoryIndexSpace[0]
+				module.LinearMemoryIndexSpace[module.imports.Memories] = importedModule.LinearMemoryIndexSpace[index]
 				module.imports.Memories++
+			case ExternalTag:
+				// tags have no state to share, the identity of the
+				// exceptions is the one of the importing instance
+				if int(index) >= len(importedModule.Tags()) {
+					return InvalidTagIndexError(index)
+				}
+				module.imports.Tags++
 			default:
 				return InvalidExternalError(exportEntry.Kind)
 			}
@@ -22,10 +22,11 @@
 package wasm
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 
-	log "github.com/cihub/seelog"
+	"github.com/bottos-project/bottos/vm/wasm/log"
 )
 
 // InvalidTableIndexError invalid table index type
@@ -52,6 +53,30 @@ func (e InvalidLinearMemoryIndexError) Error() string {
 	return fmt.Sprintf("wasm: Invalid linear memory index: %d", uint32(e))
 }
 
+// InvalidTagIndexError invalid exception tag index
+type InvalidTagIndexError uint32
+
+func (e InvalidTagIndexError) Error() string {
+	return fmt.Sprintf("wasm: Invalid tag index: %d", uint32(e))
+}
+
+// ErrTagResults is returned for a tag whose type has results.
+var ErrTagResults = errors.New("wasm: the type of a tag has results")
+
+// checkTags checks that the types of the tags of the module exist and have
+// no results.
+func (m *Module) checkTags() error {
+	for _, tag := range m.Tags() {
+		if m.Types == nil || int(tag.Type) >= len(m.Types.Entries) {
+			return InvalidTypeIndexError(tag.Type)
+		}
+		if len(m.Types.Entries[tag.Type].ReturnTypes) != 0 {
+			return ErrTagResults
+		}
+	}
+	return nil
+}
+
 // Functions for populating and looking up entries in a module's index space.
 // More info: http://webassembly.org/docs/modules/#function-index-space
 
@@ -90,6 +115,19 @@ func (m *Module) GetFunction(i int) *Function {
 	return &m.FunctionIndexSpace[i]
 }
 
+// FunctionType returns the index of the type of the function at index i in
+// the function index space, and whether the function exists.
+func (m *Module) FunctionType(i int) (uint32, bool) {
+	types := m.imports.Funcs
+	if m.Function != nil {
+		types = m.Function.Types
+	}
+	if i >= len(types) || i < 0 {
+		return 0, false
+	}
+	return types[i], true
+}
+
 func (m *Module) populateGlobals() error {
 	if m.Global == nil {
 		return nil
@@ -111,13 +149,28 @@ func (m *Module) GetGlobal(i int) *GlobalEntry {
 }
 
 func (m *Module) populateTables() error {
-	if m.Table == nil || len(m.Table.Entries) == 0 || m.Elements == nil || len(m.Elements.Entries) == 0 {
+	// the tables start with null elements
+	for i, table := range m.Tables() {
+		if m.TableIndexSpace[i] != nil {
+			continue
+		}
+		if err := checkLimit("table elements", uint64(table.Limits.Initial), m.limits.MaxTableElements); err != nil {
+			return err
+		}
+		elems := make([]uint32, table.Limits.Initial)
+		for j := range elems {
+			elems[j] = uint32(NullRef)
+		}
+		m.TableIndexSpace[i] = elems
+	}
+	if m.Elements == nil || len(m.Elements.Entries) == 0 {
 		return nil
 	}
 
-	for _, elem := range m.Elements.Entries {
-		// the MVP dictates that index should always be zero, we shuold
-		// probably check this
+	for i, elem := range m.Elements.Entries {
+		if elem.Mode != SegmentActive {
+			continue
+		}
 		if int(elem.Index) >= len(m.TableIndexSpace) {
 			return InvalidTableIndexError(elem.Index)
 		}
@@ -128,25 +181,37 @@ func (m *Module) populateTables() error {
 		}
 		offset, ok := val.(int32)
 		if !ok {
-			return InvalidValueTypeInitExprError{reflect.Int32, reflect.TypeOf(offset).Kind()}
+			return InvalidValueTypeInitExprError{reflect.Int32, reflect.ValueOf(val).Kind()}
 		}
 
+		// the segment must fit in the initial size of the table, the
+		// offset being unsigned
 		table := m.TableIndexSpace[int(elem.Index)]
-		if int(offset)+len(elem.Elems) > len(table) {
-			data := make([]uint32, int(offset)+len(elem.Elems))
-			copy(data[offset:], elem.Elems)
-			copy(data, table)
-			m.TableIndexSpace[int(elem.Index)] = data
-		} else {
-			copy(table[int(offset):], elem.Elems)
-			m.TableIndexSpace[int(elem.Index)] = table
+		if uint64(uint32(offset))+uint64(len(elem.Elems)) > uint64(len(table)) {
+			return ElementSegmentOutOfBoundsError{Segment: i, Offset: uint32(offset), Len: len(elem.Elems), TableSize: len(table)}
 		}
+		copy(table[uint32(offset):], elem.Elems)
 	}
 
 	log.Trace("There are %d entries in the table index space.", len(m.TableIndexSpace))
 	return nil
 }
 
+// ElementSegmentOutOfBoundsError is returned for an active element segment
+// extending past the initial size of its table, imported or not, which
+// couldn't be instantiated.
+type ElementSegmentOutOfBoundsError struct {
+	Segment   int // the index of the segment in the element section
+	Offset    uint32
+	Len       int
+	TableSize int
+}
+
+func (e ElementSegmentOutOfBoundsError) Error() string {
+	return fmt.Sprintf("wasm: element segment %d of %d elements at offset %d out of bounds of a table of %d elements",
+		e.Segment, e.Len, e.Offset, e.TableSize)
+}
+
 // GetTableElement returns an element from the tableindex  space indexed
 // by the integer index. It returns an error if index is invalid.
 func (m *Module) GetTableElement(index int) (uint32, error) {
@@ -161,20 +226,27 @@ func (m *Module) populateLinearMemory() error {
 	if m.Data == nil || len(m.Data.Entries) == 0 {
 		return nil
 	}
-	// each module can only have a single linear memory in the MVP
-
+	memories := m.Memories()
 	for _, entry := range m.Data.Entries {
-		if entry.Index != 0 {
+		if entry.Mode != SegmentActive {
+			continue
+		}
+		if int(entry.Index) >= len(m.LinearMemoryIndexSpace) {
 			return InvalidLinearMemoryIndexError(entry.Index)
 		}
+		// a module without memory gets a page of memory
+		limits := ResizableLimits{Initial: 1}
+		if int(entry.Index) < len(memories) {
+			limits = memories[entry.Index].Limits
+		}
 
 		val, err := m.ExecInitExpr(entry.Offset)
 		if err != nil {
 			return err
 		}
-		offset, ok := val.(int32)
-		if !ok {
-			return InvalidValueTypeInitExprError{reflect.Int32, reflect.TypeOf(offset).Kind()}
+		offset, err := dataOffset(limits, val, len(entry.Data))
+		if err != nil {
+			return err
 		}
 
 		memory := m.LinearMemoryIndexSpace[int(entry.Index)]
@@ -192,6 +264,39 @@ func (m *Module) populateLinearMemory() error {
 	return nil
 }
 
+// ErrDataSegmentOutOfBounds is returned for an active data segment
+// extending past the initial size of its memory, imported or not, which
+// couldn't be instantiated.
+var ErrDataSegmentOutOfBounds = errors.New("wasm: data segment out of bounds of the memory")
+
+// dataOffset returns the offset val of an active data segment of n bytes
+// in a memory of the given limits, an unsigned i32 or, for a 64-bit
+// memory, an i64. The segments must fit in the initial size of the
+// memory, which is the size of the memory they are copied to on
+// instantiation, so that a large offset doesn't allocate an index space
+// the memory can't hold.
+func dataOffset(limits ResizableLimits, val interface{}, n int) (int, error) {
+	var offset uint64
+	if !limits.Memory64() {
+		v, ok := val.(int32)
+		if !ok {
+			return 0, InvalidValueTypeInitExprError{reflect.Int32, reflect.ValueOf(val).Kind()}
+		}
+		offset = uint64(uint32(v))
+	} else {
+		v, ok := val.(int64)
+		if !ok {
+			return 0, InvalidValueTypeInitExprError{reflect.Int64, reflect.ValueOf(val).Kind()}
+		}
+		offset = uint64(v)
+	}
+	size := uint64(limits.Initial) * uint64(limits.PageSize())
+	if offset > size || size-offset < uint64(n) {
+		return 0, ErrDataSegmentOutOfBounds
+	}
+	return int(offset), nil
+}
+
 // GetLinearMemoryData function to get linear memory data
 func (m *Module) GetLinearMemoryData(index int) (byte, error) {
 	if index >= len(m.LinearMemoryIndexSpace[0]) {
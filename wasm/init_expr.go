@@ -23,6 +23,7 @@ package wasm
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -37,7 +38,21 @@ const (
 	f32Const  byte = 0x43
 	f64Const  byte = 0x44
 	getGlobal byte = 0x23
+	refNull   byte = 0xd0
+	refFunc   byte = 0xd2
 	end       byte = 0x0b
+
+	// the arithmetic operators of the extended-const proposal
+	i32Add byte = 0x6a
+	i32Sub byte = 0x6b
+	i32Mul byte = 0x6c
+	i64Add byte = 0x7c
+	i64Sub byte = 0x7d
+	i64Mul byte = 0x7e
+
+	// v128.const is the sub-opcode 0x0c of the SIMD prefix
+	simdPrefix byte   = 0xfd
+	v128Const  uint32 = 0x0c
 )
 
 // ErrEmptyInitExpr new empty init error
@@ -50,6 +65,15 @@ func (e InvalidInitExprOpError) Error() string {
 	return fmt.Sprintf("wasm: Invalid opcode in initializer expression: %#x", byte(e))
 }
 
+// ErrInitExprOperands is returned for an initializer expression whose
+// operators don't find operands of the types they expect, or that leaves
+// more than one value.
+var ErrInitExprOperands = errors.New("wasm: Initializer expression has mismatched operands")
+
+// ErrInitExprCycle is returned for the initializer expression of a global
+// that reads the global itself, directly or through other globals.
+var ErrInitExprCycle = errors.New("wasm: Initializer expression depends on itself")
+
 // InvalidGlobalIndexError invalid global index
 type InvalidGlobalIndexError uint32
 
@@ -60,7 +84,7 @@ func (e InvalidGlobalIndexError) Error() string {
 func readInitExpr(r io.Reader) ([]byte, error) {
 	b := make([]byte, 1)
 	buf := new(bytes.Buffer)
-	r = io.TeeReader(r, buf)
+	r = strictLike(r, io.TeeReader(r, buf))
 
 outer:
 	for {
@@ -87,11 +111,27 @@ outer:
 			if _, err := readU64(r); err != nil {
 				return nil, err
 			}
-		case getGlobal:
+		case getGlobal, refFunc:
 			_, err := leb128.ReadVarUint32(r)
 			if err != nil {
 				return nil, err
 			}
+		case refNull:
+			if _, err := ReadValueType(r); err != nil {
+				return nil, err
+			}
+		case simdPrefix:
+			sub, err := leb128.ReadVarUint32(r)
+			if err != nil {
+				return nil, err
+			}
+			if sub != v128Const {
+				return nil, InvalidInitExprOpError(b[0])
+			}
+			if _, err := io.ReadFull(r, make([]byte, 16)); err != nil {
+				return nil, err
+			}
+		case i32Add, i32Sub, i32Mul, i64Add, i64Sub, i64Mul:
 		case end:
 			break outer
 		default:
@@ -106,90 +146,207 @@ outer:
 	return buf.Bytes(), nil
 }
 
+// initValue is a value on the stack of an initializer expression. The
+// bits of a v128 value are split in lo and hi.
+type initValue struct {
+	typ    ValueType
+	lo, hi uint64
+}
+
 // ExecInitExpr executes an initializer expression and returns an interface{} value
-// which can either be int32, int64, float32 or float64.
+// which can either be int32, int64, float32, float64, V128 or a Ref.
 // It returns an error if the expression is invalid, and nil when the expression
 // yields no value.
+//
+// Besides the constants, the expression can read globals with global.get
+// and compute with the add, sub and mul operators of i32 and i64, as
+// defined by the extended-const proposal. A global read is either an env
+// global, or evaluated with its own initializer expression.
 func (m *Module) ExecInitExpr(expr []byte) (interface{}, error) {
-	var stack []uint64
-	var lastVal ValueType
+	v, ok, err := m.evalInitExpr(expr, 0)
+	if err != nil || !ok {
+		return nil, err
+	}
+	switch v.typ {
+	case ValueTypeI32:
+		return int32(v.lo), nil
+	case ValueTypeI64:
+		return int64(v.lo), nil
+	case ValueTypeF32:
+		return math.Float32frombits(uint32(v.lo)), nil
+	case ValueTypeF64:
+		return math.Float64frombits(v.lo), nil
+	case ValueTypeV128:
+		var val V128
+		binary.LittleEndian.PutUint64(val[:8], v.lo)
+		binary.LittleEndian.PutUint64(val[8:], v.hi)
+		return val, nil
+	default:
+		if v.typ.IsRef() {
+			return Ref(v.lo), nil
+		}
+		panic(fmt.Sprintf("Invalid value type produced by initializer expression: %d", int32(v.typ)))
+	}
+}
+
+// evalInitExpr evaluates the initializer expression expr, reached through
+// depth global.get operators. It returns false if the expression yields
+// no value.
+func (m *Module) evalInitExpr(expr []byte, depth int) (initValue, bool, error) {
+	var stack []initValue
 	r := bytes.NewReader(expr)
 
 	if r.Len() == 0 {
-		return nil, ErrEmptyInitExpr
+		return initValue{}, false, ErrEmptyInitExpr
 	}
 
+	push := func(t ValueType, v uint64) {
+		stack = append(stack, initValue{typ: t, lo: v})
+	}
+	// pop pops the two operands of a binary operator of type t
+	pop := func(t ValueType) (uint64, uint64, error) {
+		n := len(stack)
+		if n < 2 || stack[n-2].typ != t || stack[n-1].typ != t {
+			return 0, 0, ErrInitExprOperands
+		}
+		a, b := stack[n-2].lo, stack[n-1].lo
+		stack = stack[:n-2]
+		return a, b, nil
+	}
+
+loop:
 	for {
 		b, err := r.ReadByte()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, err
+			return initValue{}, false, err
 		}
 		switch b {
 		case i32Const:
 			i, err := leb128.ReadVarint32(r)
 			if err != nil {
-				return nil, err
+				return initValue{}, false, err
 			}
-			stack = append(stack, uint64(i))
-			lastVal = ValueTypeI32
+			push(ValueTypeI32, uint64(uint32(i)))
 		case i64Const:
 			i, err := leb128.ReadVarint64(r)
 			if err != nil {
-				return nil, err
+				return initValue{}, false, err
 			}
-			stack = append(stack, uint64(i))
-			lastVal = ValueTypeI64
+			push(ValueTypeI64, uint64(i))
 		case f32Const:
 			i, err := readU32(r)
 			if err != nil {
-				return nil, err
+				return initValue{}, false, err
 			}
-			stack = append(stack, uint64(i))
-			lastVal = ValueTypeF32
+			push(ValueTypeF32, uint64(i))
 		case f64Const:
 			i, err := readU64(r)
 			if err != nil {
-				return nil, err
+				return initValue{}, false, err
+			}
+			push(ValueTypeF64, i)
+		case i32Add, i32Sub, i32Mul:
+			x, y, err := pop(ValueTypeI32)
+			if err != nil {
+				return initValue{}, false, err
+			}
+			push(ValueTypeI32, uint64(uint32(arith(b, x, y))))
+		case i64Add, i64Sub, i64Mul:
+			x, y, err := pop(ValueTypeI64)
+			if err != nil {
+				return initValue{}, false, err
 			}
-			stack = append(stack, i)
-			lastVal = ValueTypeF64
+			push(ValueTypeI64, arith(b, x, y))
 		case getGlobal:
 			index, err := leb128.ReadVarUint32(r)
 			if err != nil {
-				return nil, err
+				return initValue{}, false, err
+			}
+			v, err := m.globalValue(index, depth)
+			if err != nil {
+				return initValue{}, false, err
+			}
+			stack = append(stack, v)
+		case refNull:
+			t, err := ReadValueType(r)
+			if err != nil {
+				return initValue{}, false, err
 			}
-			globalVar := m.GetGlobal(int(index))
-			if globalVar == nil {
-				return nil, InvalidGlobalIndexError(index)
+			push(t, uint64(NullRef))
+		case refFunc:
+			index, err := leb128.ReadVarUint32(r)
+			if err != nil {
+				return initValue{}, false, err
 			}
-			lastVal = globalVar.Type.Type
-			if globalVar.envGlobal.Env {
-				stack = append(stack, globalVar.envGlobal.Val)
+			push(ValueTypeFuncref, uint64(index))
+		case simdPrefix:
+			sub, err := leb128.ReadVarUint32(r)
+			if err != nil {
+				return initValue{}, false, err
 			}
+			if sub != v128Const {
+				return initValue{}, false, InvalidInitExprOpError(b)
+			}
+			var v V128
+			if _, err := io.ReadFull(r, v[:]); err != nil {
+				return initValue{}, false, err
+			}
+			stack = append(stack, initValue{
+				typ: ValueTypeV128,
+				lo:  binary.LittleEndian.Uint64(v[:8]),
+				hi:  binary.LittleEndian.Uint64(v[8:]),
+			})
 		case end:
-			break
+			break loop
 		default:
-			return nil, InvalidInitExprOpError(b)
+			return initValue{}, false, InvalidInitExprOpError(b)
 		}
 	}
 
-	if len(stack) == 0 {
-		return nil, nil
+	switch len(stack) {
+	case 0:
+		return initValue{}, false, nil
+	case 1:
+		return stack[0], true, nil
 	}
+	return initValue{}, false, ErrInitExprOperands
+}
 
-	v := stack[len(stack)-1]
-	switch lastVal {
-	case ValueTypeI32:
-		return int32(v), nil
-	case ValueTypeI64:
-		return int64(v), nil
-	case ValueTypeF32:
-		return math.Float32frombits(uint32(v)), nil
-	case ValueTypeF64:
-		return math.Float64frombits(uint64(v)), nil
+// arith computes x op y for the add, sub or mul operator op, of i32 or i64
+// operands.
+func arith(op byte, x, y uint64) uint64 {
+	switch op {
+	case i32Add, i64Add:
+		return x + y
+	case i32Sub, i64Sub:
+		return x - y
 	default:
-		panic(fmt.Sprintf("Invalid value type produced by initializer expression: %d", int8(lastVal)))
+		return x * y
+	}
+}
+
+// globalValue returns the initial value of the global at index, read by an
+// initializer expression reached through depth global.get operators.
+func (m *Module) globalValue(index uint32, depth int) (initValue, error) {
+	global := m.GetGlobal(int(index))
+	if global == nil {
+		return initValue{}, InvalidGlobalIndexError(index)
+	}
+	if env := global.envGlobal; env != nil && env.Env {
+		return initValue{typ: global.Type.Type, lo: env.Val}, nil
+	}
+	// a chain of globals longer than the index space must go in circles
+	if depth >= len(m.GlobalIndexSpace) {
+		return initValue{}, ErrInitExprCycle
+	}
+	v, ok, err := m.evalInitExpr(global.Init, depth+1)
+	if err != nil {
+		return initValue{}, err
+	}
+	if !ok || v.typ != global.Type.Type {
+		return initValue{}, ErrInitExprOperands
 	}
+	return v, nil
 }
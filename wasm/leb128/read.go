@@ -24,13 +24,37 @@
 package leb128
 
 import (
+	"errors"
 	"io"
 )
 
+// StrictReader reads from Reader, the functions of the package only
+// accepting the canonical encoding of the values read from it: the
+// encoding can't be longer than needed for the value, nor longer than the
+// integer type allows, and the value must fit the type. Lenient decoding
+// accepts several encodings of the same value, and silently truncates the
+// ones which don't fit.
+type StrictReader struct {
+	io.Reader
+}
+
+// ErrOverflow is returned when reading from a StrictReader a value which
+// doesn't fit the integer type, or whose encoding is longer than the type
+// allows.
+var ErrOverflow = errors.New("leb128: integer overflow")
+
+// ErrNonCanonical is returned when reading from a StrictReader a value
+// encoded with more bytes than needed.
+var ErrNonCanonical = errors.New("leb128: non-canonical integer encoding")
+
 // ReadVarUint32Size reads a LEB128 encoded unsigned 32-bit integer from r.
 // It returns the integer value, the size of the encoded value (in bytes), and
 // the error (if any).
 func ReadVarUint32Size(r io.Reader) (res uint32, size uint, err error) {
+	if _, ok := r.(StrictReader); ok {
+		v, size, err := readStrictUnsigned(r, 32)
+		return uint32(v), size, err
+	}
 	b := make([]byte, 1)
 	var shift uint
 	for {
@@ -56,10 +80,46 @@ func ReadVarUint32(r io.Reader) (uint32, error) {
 	return n, err
 }
 
+// ReadVarUint64Size reads a LEB128 encoded unsigned 64-bit integer from r.
+// It returns the integer value, the size of the encoded value (in bytes), and
+// the error (if any).
+func ReadVarUint64Size(r io.Reader) (res uint64, size uint, err error) {
+	if _, ok := r.(StrictReader); ok {
+		return readStrictUnsigned(r, 64)
+	}
+	b := make([]byte, 1)
+	var shift uint
+	for {
+		if _, err = io.ReadFull(r, b); err != nil {
+			return
+		}
+
+		size++
+
+		cur := uint64(b[0])
+		res |= (cur & 0x7f) << (shift)
+		if cur&0x80 == 0 {
+			return res, size, nil
+		}
+		shift += 7
+	}
+}
+
+// ReadVarUint64 reads a LEB128 encoded unsigned 64-bit integer from r, and
+// returns the integer value, and the error (if any).
+func ReadVarUint64(r io.Reader) (uint64, error) {
+	n, _, err := ReadVarUint64Size(r)
+	return n, err
+}
+
 // ReadVarint32Size reads a LEB128 encoded signed 32-bit integer from r, and
 // returns the integer value, the size of the encoded value, and the error
 // (if any)
 func ReadVarint32Size(r io.Reader) (res int32, size uint, err error) {
+	if _, ok := r.(StrictReader); ok {
+		res64, size, err := readStrictSigned(r, 32)
+		return int32(res64), size, err
+	}
 	res64, size, err := ReadVarint64Size(r)
 	res = int32(res64)
 	return
@@ -76,6 +136,9 @@ func ReadVarint32(r io.Reader) (int32, error) {
 // returns the integer value, the size of the encoded value, and the error
 // (if any)
 func ReadVarint64Size(r io.Reader) (res int64, size uint, err error) {
+	if _, ok := r.(StrictReader); ok {
+		return readStrictSigned(r, 64)
+	}
 	var shift uint
 	var sign int64 = -1
 	b := make([]byte, 1)
@@ -107,3 +170,70 @@ func ReadVarint64(r io.Reader) (int64, error) {
 	n, _, err := ReadVarint64Size(r)
 	return n, err
 }
+
+// readStrictUnsigned reads the canonical encoding of an unsigned integer of
+// the given number of bits.
+func readStrictUnsigned(r io.Reader, bits uint) (res uint64, size uint, err error) {
+	b := make([]byte, 1)
+	for shift := uint(0); ; shift += 7 {
+		if _, err = io.ReadFull(r, b); err != nil {
+			return 0, size, err
+		}
+		size++
+
+		cur := uint64(b[0] & 0x7f)
+		// the bits of the last byte beyond the type must be zeros
+		if shift+7 > bits && cur>>(bits-shift) != 0 {
+			return 0, size, ErrOverflow
+		}
+		res |= cur << shift
+		if b[0]&0x80 == 0 {
+			if cur == 0 && size > 1 {
+				return 0, size, ErrNonCanonical
+			}
+			return res, size, nil
+		}
+		if shift+7 >= bits {
+			return 0, size, ErrOverflow
+		}
+	}
+}
+
+// readStrictSigned reads the canonical encoding of a signed integer of the
+// given number of bits.
+func readStrictSigned(r io.Reader, bits uint) (res int64, size uint, err error) {
+	b := make([]byte, 1)
+	var prev byte
+	for shift := uint(0); ; shift += 7 {
+		if _, err = io.ReadFull(r, b); err != nil {
+			return 0, size, err
+		}
+		size++
+
+		cur := b[0] & 0x7f
+		last := b[0]&0x80 == 0
+		if shift+7 >= bits {
+			// the bits of the last byte from the sign bit of the type
+			// must all be copies of it
+			upper := cur >> (bits - shift - 1)
+			if !last || upper != 0 && upper != 0x7f>>(bits-shift-1) {
+				return 0, size, ErrOverflow
+			}
+		}
+		res |= int64(cur) << shift
+		if !last {
+			prev = cur
+			continue
+		}
+
+		// a last byte only extending the sign of the previous one is
+		// redundant
+		if size > 1 && (cur == 0 && prev&0x40 == 0 || cur == 0x7f && prev&0x40 != 0) {
+			return 0, size, ErrNonCanonical
+		}
+		if shift+7 < 64 && cur&0x40 != 0 {
+			res |= -1 << (shift + 7)
+		}
+		return res, size, nil
+	}
+}
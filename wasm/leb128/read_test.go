@@ -37,6 +37,16 @@ func TestReadVarUint32(t *testing.T) {
 
 }
 
+func TestReadVarUint64(t *testing.T) {
+	n, err := ReadVarUint64(bytes.NewReader([]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x01}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != uint64(1)<<35 {
+		t.Fatalf("got = %d; want = %d", n, uint64(1)<<35)
+	}
+}
+
 func TestReadVarint32(t *testing.T) {
 	n, err := ReadVarint32(bytes.NewReader([]byte{0xFF, 0x7e}))
 	if err != nil {
@@ -46,3 +56,57 @@ func TestReadVarint32(t *testing.T) {
 		t.Fatalf("got = %d; want = %d", n, -129)
 	}
 }
+
+func TestStrictReader(t *testing.T) {
+	for _, tc := range []struct {
+		read  func([]byte) (int64, error)
+		input []byte
+		want  int64
+		err   error
+	}{
+		{readUint32, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}, 0xffffffff, nil},
+		{readUint32, []byte{0x80, 0x00}, 0, ErrNonCanonical},
+		{readUint32, []byte{0xff, 0xff, 0xff, 0xff, 0x1f}, 0, ErrOverflow},
+		{readUint32, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, 0, ErrOverflow},
+		{readUint64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, -1, nil},
+		{readUint64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x03}, 0, ErrOverflow},
+		{readInt32, []byte{0xff, 0x7e}, -129, nil},
+		{readInt32, []byte{0x80, 0x80, 0x80, 0x80, 0x78}, -1 << 31, nil},
+		{readInt32, []byte{0xff, 0xff, 0xff, 0xff, 0x07}, 1<<31 - 1, nil},
+		{readInt32, []byte{0xff, 0x7f}, 0, ErrNonCanonical},
+		{readInt32, []byte{0xc0, 0x00}, 64, nil},
+		{readInt32, []byte{0x80, 0x00}, 0, ErrNonCanonical},
+		{readInt32, []byte{0xff, 0xff, 0xff, 0xff, 0x4f}, 0, ErrOverflow},
+		{readInt64, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x7f}, -1 << 63, nil},
+		{readInt64, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01}, 0, ErrOverflow},
+	} {
+		got, err := tc.read(tc.input)
+		if err != tc.err || err == nil && got != tc.want {
+			t.Errorf("%x: got=%d, %v, want=%d, %v", tc.input, got, err, tc.want, tc.err)
+		}
+	}
+
+	// lenient decoding accepts the padding
+	if n, err := ReadVarUint32(bytes.NewReader([]byte{0x80, 0x00})); err != nil || n != 0 {
+		t.Errorf("lenient padded zero: got=%d, %v", n, err)
+	}
+}
+
+func readUint32(b []byte) (int64, error) {
+	n, err := ReadVarUint32(StrictReader{bytes.NewReader(b)})
+	return int64(n), err
+}
+
+func readUint64(b []byte) (int64, error) {
+	n, err := ReadVarUint64(StrictReader{bytes.NewReader(b)})
+	return int64(n), err
+}
+
+func readInt32(b []byte) (int64, error) {
+	n, err := ReadVarint32(StrictReader{bytes.NewReader(b)})
+	return int64(n), err
+}
+
+func readInt64(b []byte) (int64, error) {
+	return ReadVarint64(StrictReader{bytes.NewReader(b)})
+}
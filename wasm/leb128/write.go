@@ -0,0 +1,77 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package leb128
+
+import (
+	"io"
+)
+
+// WriteVarUint32 writes the LEB128 encoding of v to w, and returns the
+// number of bytes written, and the error (if any).
+func WriteVarUint32(w io.Writer, v uint32) (int, error) {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			break
+		}
+	}
+	return w.Write(b)
+}
+
+// WriteVarUint64 writes the LEB128 encoding of v to w, and returns the
+// number of bytes written, and the error (if any).
+func WriteVarUint64(w io.Writer, v uint64) (int, error) {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			break
+		}
+	}
+	return w.Write(b)
+}
+
+// WriteVarint64 writes the signed LEB128 encoding of v to w, and returns
+// the number of bytes written, and the error (if any).
+func WriteVarint64(w io.Writer, v int64) (int, error) {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		s := c & 0x40
+		v >>= 7
+		if (v != -1 || s == 0) && (v != 0 || s != 0) {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if c&0x80 == 0 {
+			break
+		}
+	}
+	return w.Write(b)
+}
@@ -0,0 +1,78 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package leb128
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestWriteVarUint32(t *testing.T) {
+	for _, v := range []uint32{0, 1, 127, 128, 16256, math.MaxUint32} {
+		var buf bytes.Buffer
+		if _, err := WriteVarUint32(&buf, v); err != nil {
+			t.Fatal(err)
+		}
+		n, err := ReadVarUint32(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != v {
+			t.Errorf("got = %d; want = %d", n, v)
+		}
+	}
+}
+
+func TestWriteVarUint64(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, math.MaxUint32 + 1, math.MaxUint64} {
+		var buf bytes.Buffer
+		if _, err := WriteVarUint64(&buf, v); err != nil {
+			t.Fatal(err)
+		}
+		n, err := ReadVarUint64(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != v {
+			t.Errorf("got = %d; want = %d", n, v)
+		}
+	}
+}
+
+func TestWriteVarint64(t *testing.T) {
+	for _, v := range []int64{0, 1, -1, 63, 64, -64, -65, -129, math.MaxInt64, math.MinInt64} {
+		var buf bytes.Buffer
+		if _, err := WriteVarint64(&buf, v); err != nil {
+			t.Fatal(err)
+		}
+		n, err := ReadVarint64(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != v {
+			t.Errorf("got = %d; want = %d", n, v)
+		}
+	}
+
+	var buf bytes.Buffer
+	WriteVarint64(&buf, -129)
+	if !bytes.Equal(buf.Bytes(), []byte{0xff, 0x7e}) {
+		t.Errorf("unexpected encoding of -129: %x", buf.Bytes())
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+// DecodeLimits bounds the structures of the modules read by
+// ReadModuleWithLimits, so that a small crafted module can't make the
+// decoder allocate much more memory than its own size. A zero field
+// doesn't limit anything.
+type DecodeLimits struct {
+	// MaxModuleSize is the size of the binary module, in bytes.
+	MaxModuleSize int
+	// MaxFunctions is the number of functions defined by the module.
+	MaxFunctions int
+	// MaxLocalsPerFunc is the number of locals declared by a function,
+	// its parameters excluded.
+	MaxLocalsPerFunc int
+	// MaxGlobals is the number of globals defined by the module.
+	MaxGlobals int
+	// MaxImports is the number of imports of the module.
+	MaxImports int
+	// MaxDataSegments is the number of data segments of the module.
+	MaxDataSegments int
+	// MaxBrTableTargets is the number of targets of a br_table
+	// instruction, checked when disassembling the functions.
+	MaxBrTableTargets int
+	// MaxNameLength is the length in bytes of the module and field names
+	// of the imports, and of the names of the exports.
+	MaxNameLength int
+	// MaxTableElements is the initial number of elements of a table,
+	// allocated once the module is read.
+	MaxTableElements int
+	// StrictLEB128 rejects the integers of the module, including the
+	// immediates of its instructions once validated, which aren't
+	// encoded canonically, see leb128.StrictReader. Toolchains may pad
+	// the integers they relocate, which is only accepted by default.
+	StrictLEB128 bool
+}
+
+// DefaultDecodeLimits are the limits used by ReadModule, generous enough
+// for any module produced by a regular toolchain.
+var DefaultDecodeLimits = DecodeLimits{
+	MaxModuleSize:     16 << 20,
+	MaxFunctions:      1000000,
+	MaxLocalsPerFunc:  50000,
+	MaxGlobals:        1000000,
+	MaxImports:        100000,
+	MaxDataSegments:   100000,
+	MaxBrTableTargets: 65520,
+	MaxNameLength:     100000,
+	MaxTableElements:  10000000,
+}
+
+// DecodeLimitError is returned by ReadModuleWithLimits when the module
+// exceeds one of its DecodeLimits.
+type DecodeLimitError struct {
+	// Limit is the name of the exceeded limit, and Max its value.
+	Limit string
+	Max   int
+}
+
+func (e DecodeLimitError) Error() string {
+	return fmt.Sprintf("wasm: %s exceeds the limit of %d", e.Limit, e.Max)
+}
+
+// checkLimit returns a DecodeLimitError if n exceeds max, unless max is zero.
+func checkLimit(limit string, n uint64, max int) error {
+	if max != 0 && n > uint64(max) {
+		return DecodeLimitError{Limit: limit, Max: max}
+	}
+	return nil
+}
+
+// DecodeLimits returns the limits the module was read with.
+func (m *Module) DecodeLimits() DecodeLimits {
+	return m.limits
+}
+
+// checkCount returns io.ErrUnexpectedEOF if r, whose length is known when
+// it reads a section or a function body, is too short to hold count
+// entries of at least one byte each. Entries are allocated before being
+// read, so an unchecked count could allocate gigabytes.
+func checkCount(r io.Reader, count uint32) error {
+	var n int64
+	switch r := r.(type) {
+	case leb128.StrictReader:
+		return checkCount(r.Reader, count)
+	case *io.LimitedReader:
+		n = r.N
+	case *bytes.Buffer:
+		n = int64(r.Len())
+	case *bytes.Reader:
+		n = int64(r.Len())
+	default:
+		return nil
+	}
+	if int64(count) > n {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// strictLike returns r, read strictly if from is a leb128.StrictReader.
+func strictLike(from, r io.Reader) io.Reader {
+	if _, ok := from.(leb128.StrictReader); ok {
+		return leb128.StrictReader{Reader: r}
+	}
+	return r
+}
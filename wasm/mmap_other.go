@@ -0,0 +1,34 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !linux
+
+package wasm
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// mapFile reads the contents of f, the platform not supporting mappings.
+func mapFile(f *os.File) ([]byte, error) {
+	return ioutil.ReadAll(f)
+}
+
+func unmapFile(mapping []byte) error {
+	return nil
+}
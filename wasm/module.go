@@ -24,9 +24,8 @@ package wasm
 import (
 	"errors"
 	"io"
-
-	"github.com/bottos-project/bottos/vm/wasm/wasm/internal/readpos"
-	log "github.com/cihub/seelog"
+	"os"
+	"sort"
 )
 
 // ErrInvalidMagic invalid magic
@@ -45,6 +44,8 @@ type Function struct {
 	Body    *FunctionBody
 	EnvFunc bool
 	Method  string
+	// Name is the name of the function in the name section, if any
+	Name string
 }
 
 // Module represents a parsed WebAssembly module:
@@ -63,6 +64,11 @@ type Module struct {
 	Elements *SectionElements
 	Code     *SectionCode
 	Data     *SectionData
+	// DataCount is the number of data segments declared ahead of the code,
+	// for validating the indices used by memory.init and data.drop
+	DataCount *SectionDataCount
+	// Tag declares the exception tags of the module
+	Tag *SectionTags
 
 	// The function index space of the module
 	FunctionIndexSpace []Function
@@ -79,7 +85,20 @@ type Module struct {
 		Globals  int
 		Tables   int
 		Memories int
+		Tags     int
 	}
+
+	// the limits the module was read with
+	limits DecodeLimits
+	// whether the function bodies are left for FunctionBody.Decode, see
+	// Decoder.LazyCode
+	lazyCode bool
+	// the bytes of the module being read by a NewBytesDecoder
+	source *source
+	// the file mapped by LoadModuleFile, released by Close
+	mapping []byte
+	// the rank of the last section read, see sectionOrder
+	lastSection int
 }
 
 // EnvGlobal global environment
@@ -98,62 +117,150 @@ func NewEnvGlobal(env bool, val uint64) *EnvGlobal {
 	return e
 }
 
-// ResolveFunc is a function that takes a module name and
-// returns a valid resolved module.
-type ResolveFunc func(name string) (*Module, error)
-
-// ReadModule reads a module from the reader r. resolvePath must take a string
-// and a return a reader to the module pointed to by the string.
-func ReadModule(r io.Reader, resolvePath ResolveFunc) (*Module, error) {
-	reader := &readpos.ReadPos{
-		R:      r,
-		CurPos: 0,
+// Exports returns the exports of the module, in the order of the export
+// section. The entries added to the map of the section without their name
+// follow, sorted by name.
+func (m *Module) Exports() []ExportEntry {
+	if m.Export == nil {
+		return nil
 	}
-	m := &Module{}
-	magic, err := readU32(reader)
-	if err != nil {
-		return nil, err
+	exports := make([]ExportEntry, 0, len(m.Export.Entries))
+	listed := make(map[string]bool, len(m.Export.Names))
+	for _, name := range m.Export.Names {
+		if entry, ok := m.Export.Entries[name]; ok && !listed[name] {
+			exports = append(exports, entry)
+			listed[name] = true
+		}
 	}
-	if magic != Magic {
-		return nil, ErrInvalidMagic
+	var rest []string
+	for name := range m.Export.Entries {
+		if !listed[name] {
+			rest = append(rest, name)
+		}
 	}
-	if m.Version, err = readU32(reader); err != nil {
-		return nil, err
+	sort.Strings(rest)
+	for _, name := range rest {
+		exports = append(exports, m.Export.Entries[name])
+	}
+	return exports
+}
+
+// MemoryLimits returns the limits of the first linear memory of the
+// module, whether it is defined by the module or imported. It returns
+// false if the module has no linear memory.
+func (m *Module) MemoryLimits() (ResizableLimits, bool) {
+	memories := m.Memories()
+	if len(memories) == 0 {
+		return ResizableLimits{}, false
 	}
+	return memories[0].Limits, true
+}
 
-	for {
-		done, err := m.readSection(reader)
-		if err != nil {
-			return nil, err
-		} else if done {
-			break
+// Memories returns the types of the linear memories of the module, indexed
+// by memory index: the imported memories come first, followed by the ones
+// the module defines.
+func (m *Module) Memories() []Memory {
+	var memories []Memory
+	if m.Import != nil {
+		for _, entry := range m.Import.Entries {
+			if mem, ok := entry.Type.(MemoryImport); ok {
+				memories = append(memories, mem.Type)
+			}
 		}
 	}
+	if m.Memory != nil {
+		memories = append(memories, m.Memory.Entries...)
+	}
+	return memories
+}
 
-	m.LinearMemoryIndexSpace = make([][]byte, 1)
+// Tables returns the types of the tables of the module, indexed by table
+// index: the imported tables come first, followed by the ones the module
+// defines.
+func (m *Module) Tables() []Table {
+	var tables []Table
+	if m.Import != nil {
+		for _, entry := range m.Import.Entries {
+			if table, ok := entry.Type.(TableImport); ok {
+				tables = append(tables, table.Type)
+			}
+		}
+	}
 	if m.Table != nil {
-		m.TableIndexSpace = make([][]uint32, int(len(m.Table.Entries)))
+		tables = append(tables, m.Table.Entries...)
 	}
+	return tables
+}
 
-	if m.Import != nil && resolvePath != nil {
-		err := m.resolveImports(resolvePath) //resolvePath is importer() function
-		if err != nil {
-			return nil, err
+// Tags returns the types of the exception tags of the module, indexed by
+// tag index: the imported tags come first, followed by the ones the module
+// defines.
+func (m *Module) Tags() []TagType {
+	var tags []TagType
+	if m.Import != nil {
+		for _, entry := range m.Import.Entries {
+			if tag, ok := entry.Type.(TagImport); ok {
+				tags = append(tags, tag.Type)
+			}
 		}
 	}
+	if m.Tag != nil {
+		tags = append(tags, m.Tag.Entries...)
+	}
+	return tags
+}
 
-	for _, fn := range []func() error{
-		m.populateGlobals,
-		m.populateFunctions,
-		m.populateTables,
-		m.populateLinearMemory,
-	} {
-		if err := fn(); err != nil {
-			return nil, err
-		}
+// ResolveFunc is a function that takes a module name and
+// returns a valid resolved module.
+type ResolveFunc func(name string) (*Module, error)
+
+// ReadModule reads a module from the reader r. resolvePath must take a string
+// and a return a reader to the module pointed to by the string. The module
+// is read with the DefaultDecodeLimits.
+func ReadModule(r io.Reader, resolvePath ResolveFunc) (*Module, error) {
+	return ReadModuleWithLimits(r, resolvePath, DefaultDecodeLimits)
+}
+
+// ReadModuleWithLimits reads a module like ReadModule, failing with a
+// DecodeLimitError as soon as the module exceeds limits.
+func ReadModuleWithLimits(r io.Reader, resolvePath ResolveFunc, limits DecodeLimits) (*Module, error) {
+	return NewDecoder(r, limits).Finish(resolvePath)
+}
 
+// LoadModuleFile reads the module in the file at path like ReadModule,
+// mapping the file in memory on the platforms supporting it: the function
+// bodies refer to the mapped bytes rather than to copies of them, and must
+// not be modified. The mapping is released by Close.
+func LoadModuleFile(path string, resolvePath ResolveFunc) (*Module, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mapping, err := mapFile(f)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Trace("There are %d entries in the function index space.", len(m.FunctionIndexSpace))
+	d := NewBytesDecoder(mapping, DefaultDecodeLimits)
+	d.DiscardSectionBytes = true
+	m, err := d.Finish(resolvePath)
+	if err != nil {
+		unmapFile(mapping)
+		return nil, err
+	}
+	m.mapping = mapping
 	return m, nil
 }
+
+// Close releases the file mapped by LoadModuleFile, after which the
+// function bodies of the module must not be used. It does nothing for the
+// other modules.
+func (m *Module) Close() error {
+	if m.mapping == nil {
+		return nil
+	}
+	mapping := m.mapping
+	m.mapping = nil
+	return unmapFile(mapping)
+}
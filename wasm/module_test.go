@@ -23,11 +23,16 @@ package wasm_test
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"testing/iotest"
 
 	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
 )
 
 func TestReadModule(t *testing.T) {
@@ -54,3 +59,858 @@ func TestReadModule(t *testing.T) {
 		})
 	}
 }
+
+func TestDecodeLimits(t *testing.T) {
+	module := []byte("\x00asm\x01\x00\x00\x00" +
+		// type section: () -> ()
+		"\x01\x04\x01\x60\x00\x00" +
+		// function section: two functions
+		"\x03\x03\x02\x00\x00" +
+		// code section: two bodies declaring 100000 i32 locals
+		"\x0a\x0f\x02" +
+		"\x06\x01\xa0\x8d\x06\x7f\x0b" +
+		"\x06\x01\xa0\x8d\x06\x7f\x0b")
+
+	if _, err := wasm.ReadModuleWithLimits(bytes.NewReader(module), nil, wasm.DecodeLimits{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		limits wasm.DecodeLimits
+		err    error
+	}{
+		{wasm.DecodeLimits{MaxModuleSize: 20}, wasm.DecodeLimitError{Limit: "module size", Max: 20}},
+		{wasm.DecodeLimits{MaxFunctions: 1}, wasm.DecodeLimitError{Limit: "functions", Max: 1}},
+		{wasm.DecodeLimits{MaxLocalsPerFunc: 1000}, wasm.DecodeLimitError{Limit: "locals per function", Max: 1000}},
+		{wasm.DefaultDecodeLimits, wasm.DecodeLimitError{Limit: "locals per function", Max: wasm.DefaultDecodeLimits.MaxLocalsPerFunc}},
+	} {
+		if _, err := wasm.ReadModuleWithLimits(bytes.NewReader(module), nil, tc.limits); err != tc.err {
+			t.Errorf("%+v: unexpected error: got=%v, want=%v", tc.limits, err, tc.err)
+		}
+	}
+
+	// counts larger than the section can't allocate anything
+	for _, section := range []string{
+		"\x01\x05\xff\xff\xff\xff\x0f",
+		"\x0a\x07\x01\x05\xff\xff\xff\xff\x0f",
+	} {
+		_, err := wasm.ReadModuleWithLimits(bytes.NewReader([]byte("\x00asm\x01\x00\x00\x00"+section)), nil, wasm.DecodeLimits{})
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("%q: unexpected error: %v", section, err)
+		}
+	}
+}
+
+func TestSectionOrder(t *testing.T) {
+	const (
+		types     = "\x01\x04\x01\x60\x00\x00"
+		functions = "\x03\x03\x02\x00\x00"
+	)
+	for _, tc := range []struct {
+		name     string
+		sections string
+		err      error
+	}{
+		{"custom sections anywhere", "\x00\x02\x01a\x01\x01\x00\x00\x02\x01b\x03\x01\x00", nil},
+		{"tag before global", "\x0d\x01\x00\x06\x01\x00", nil},
+		{"duplicate type", "\x01\x01\x00\x01\x01\x00", wasm.SectionOrderError{ID: wasm.SectionIDType, Offset: 11, Duplicate: true}},
+		{"type after function", "\x03\x01\x00\x01\x01\x00", wasm.SectionOrderError{ID: wasm.SectionIDType, Offset: 11}},
+		{"tag after global", "\x06\x01\x00\x0d\x01\x00", wasm.SectionOrderError{ID: wasm.SectionIDTag, Offset: 11}},
+		{"missing body", types + functions + "\x0a\x04\x01\x02\x00\x0b", wasm.CountMismatchError{Offset: 19, Functions: 2, Bodies: 1}},
+		{"missing code", types + functions, wasm.CountMismatchError{Offset: 19, Functions: 2}},
+		{"truncated header", "\x01", io.ErrUnexpectedEOF},
+		{"truncated section", "\x01\x05\x01\x60", io.ErrUnexpectedEOF},
+		{"section longer than its contents", "\x01\x05\x01\x60\x00\x00\x00", wasm.ErrSectionSize},
+		{"truncated custom section", "\x00\x05\x02ab", wasm.ErrSectionSize},
+	} {
+		_, err := wasm.ReadModule(bytes.NewReader([]byte("\x00asm\x01\x00\x00\x00"+tc.sections)), nil)
+		if err != tc.err {
+			t.Errorf("%s: unexpected error: got=%v, want=%v", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	for _, tc := range []struct {
+		section string
+		limits  wasm.DecodeLimits
+		err     error
+	}{
+		// an export named "\xff\xfe"
+		{"\x07\x06\x01\x02\xff\xfe\x00\x00", wasm.DefaultDecodeLimits, wasm.InvalidNameError("\xff\xfe")},
+		// an import of env.longname
+		{"\x02\x10\x01\x03env\x08longname\x00\x00", wasm.DecodeLimits{MaxNameLength: 3}, wasm.DecodeLimitError{Limit: "name length", Max: 3}},
+	} {
+		_, err := wasm.ReadModuleWithLimits(bytes.NewReader([]byte("\x00asm\x01\x00\x00\x00"+tc.section)), nil, tc.limits)
+		if err != tc.err {
+			t.Errorf("%q: unexpected error: got=%v, want=%v", tc.section, err, tc.err)
+		}
+	}
+}
+
+func TestStrictLEB128(t *testing.T) {
+	for _, section := range []string{
+		// a type section whose length is padded
+		"\x01\x84\x00\x01\x60\x00\x00",
+		// a type section whose count is padded
+		"\x01\x05\x81\x00\x60\x00\x00",
+		// a function whose count of locals is padded
+		"\x01\x04\x01\x60\x00\x00\x03\x02\x01\x00\x0a\x07\x01\x05\x81\x00\x01\x7f\x0b",
+	} {
+		module := []byte("\x00asm\x01\x00\x00\x00" + section)
+		if _, err := wasm.ReadModule(bytes.NewReader(module), nil); err != nil {
+			t.Errorf("%q: unexpected error: %v", section, err)
+		}
+		_, err := wasm.ReadModuleWithLimits(bytes.NewReader(module), nil, wasm.DecodeLimits{StrictLEB128: true})
+		if err != leb128.ErrNonCanonical {
+			t.Errorf("%q: strict: got=%v, want=%v", section, err, leb128.ErrNonCanonical)
+		}
+	}
+}
+
+func TestExports(t *testing.T) {
+	const (
+		types     = "\x01\x04\x01\x60\x00\x00"
+		functions = "\x03\x02\x01\x00"
+		code      = "\x0a\x04\x01\x02\x00\x0b"
+	)
+	// the function exported as b, then as a
+	module := "\x00asm\x01\x00\x00\x00" + types + functions + "\x07\x09\x02\x01b\x00\x00\x01a\x00\x00" + code
+	m, err := wasm.ReadModule(bytes.NewReader([]byte(module)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the entries added by hand follow in name order
+	m.Export.Entries["d"] = wasm.ExportEntry{FieldStr: "d"}
+	m.Export.Entries["c"] = wasm.ExportEntry{FieldStr: "c"}
+	var names []string
+	for _, entry := range m.Exports() {
+		names = append(names, entry.FieldStr)
+	}
+	if got, want := fmt.Sprint(names), "[b a c d]"; got != want {
+		t.Errorf("exports: got=%s, want=%s", got, want)
+	}
+
+	module = "\x00asm\x01\x00\x00\x00" + types + functions + "\x07\x09\x02\x01a\x00\x00\x01a\x00\x00" + code
+	if _, err := wasm.ReadModule(bytes.NewReader([]byte(module)), nil); err != wasm.DuplicateExportError("a") {
+		t.Errorf("duplicate export: got=%v, want=%v", err, wasm.DuplicateExportError("a"))
+	}
+}
+
+func TestSegmentModes(t *testing.T) {
+	const header = "\x00asm\x01\x00\x00\x00" +
+		// memory section: one page
+		"\x05\x03\x01\x00\x01"
+	module := header +
+		// data count section: two segments
+		"\x0c\x01\x02" +
+		// data section: a passive segment, and an active one at 8 with an
+		// explicit memory index
+		"\x0b\x0d\x02" +
+		"\x01\x02ab" +
+		"\x02\x00\x41\x08\x0b\x02cd"
+
+	m, err := wasm.ReadModule(bytes.NewReader([]byte(module)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.DataCount == nil || m.DataCount.Count != 2 {
+		t.Fatalf("unexpected data count section: %+v", m.DataCount)
+	}
+	if entries := m.Data.Entries; entries[0].Mode != wasm.SegmentPassive || entries[0].Offset != nil || entries[1].Mode != wasm.SegmentActive {
+		t.Errorf("unexpected segments: %+v", entries)
+	}
+	// only the active segment is copied to the memory
+	if mem := m.LinearMemoryIndexSpace[0]; len(mem) != 10 || string(mem[8:]) != "cd" {
+		t.Errorf("unexpected initial memory: %q", mem)
+	}
+
+	for _, tc := range []struct {
+		module string
+		err    error
+	}{
+		{header + "\x0c\x01\x03" + module[len(header)+3:], wasm.ErrDataCountMismatch},
+		{header + "\x0c\x01\x01", wasm.ErrDataCountMismatch},
+		{header + "\x0b\x05\x01\x03\x02ab", wasm.InvalidSegmentFlagsError(3)},
+	} {
+		if _, err := wasm.ReadModule(bytes.NewReader([]byte(tc.module)), nil); err != tc.err {
+			t.Errorf("%q: unexpected error: got=%v, want=%v", tc.module, err, tc.err)
+		}
+	}
+}
+
+func TestDataSegmentBounds(t *testing.T) {
+	// a page of memory
+	const memory = "\x05\x03\x01\x00\x01"
+	for _, tc := range []struct {
+		data string
+		err  error
+	}{
+		// "ab" at 65534
+		{"\x0b\x0a\x01\x00\x41\xfe\xff\x03\x0b\x02ab", nil},
+		// "ab" at 65535
+		{"\x0b\x0a\x01\x00\x41\xff\xff\x03\x0b\x02ab", wasm.ErrDataSegmentOutOfBounds},
+		// "a" at -1, an unsigned offset
+		{"\x0b\x07\x01\x00\x41\x7f\x0b\x01a", wasm.ErrDataSegmentOutOfBounds},
+	} {
+		_, err := wasm.ReadModule(bytes.NewReader([]byte("\x00asm\x01\x00\x00\x00"+memory+tc.data)), nil)
+		if err != tc.err {
+			t.Errorf("%q: got=%v, want=%v", tc.data, err, tc.err)
+		}
+	}
+}
+
+func TestElementSegmentBounds(t *testing.T) {
+	const (
+		types     = "\x01\x04\x01\x60\x00\x00"
+		functions = "\x03\x02\x01\x00"
+		code      = "\x0a\x04\x01\x02\x00\x0b"
+		// a table of 2 elements, defined or imported from env
+		table       = "\x04\x04\x01\x70\x00\x02"
+		importTable = "\x02\x0f\x01\x03env\x05table\x01\x70\x00\x02"
+	)
+	// the host resolves the imports from env itself
+	resolve := func(name string) (*wasm.Module, error) {
+		return nil, fmt.Errorf("unexpected import from %s", name)
+	}
+	for _, tc := range []struct {
+		offset byte
+		err    error
+	}{
+		{0x01, nil},
+		{0x02, wasm.ElementSegmentOutOfBoundsError{Segment: 0, Offset: 2, Len: 1, TableSize: 2}},
+		{0x7f, wasm.ElementSegmentOutOfBoundsError{Segment: 0, Offset: 0xffffffff, Len: 1, TableSize: 2}},
+	} {
+		// the function at offset
+		elements := "\x09\x07\x01\x00\x41" + string(tc.offset) + "\x0b\x01\x00"
+		for _, module := range []string{
+			types + functions + table + elements + code,
+			types + importTable + functions + elements + code,
+		} {
+			m, err := wasm.ReadModule(bytes.NewReader([]byte("\x00asm\x01\x00\x00\x00"+module)), resolve)
+			if err != tc.err {
+				t.Errorf("offset %#x: got=%v, want=%v", tc.offset, err, tc.err)
+				continue
+			}
+			if err == nil && (len(m.TableIndexSpace[0]) != 2 || m.TableIndexSpace[0][1] != 0 || m.TableIndexSpace[0][0] != uint32(wasm.NullRef)) {
+				t.Errorf("offset %#x: unexpected table %v", tc.offset, m.TableIndexSpace[0])
+			}
+		}
+	}
+}
+
+func TestMultipleMemories(t *testing.T) {
+	const header = "\x00asm\x01\x00\x00\x00" +
+		// memory section: one page, and one page up to two
+		"\x05\x06\x02\x00\x01\x01\x01\x02"
+	// data section: an active segment at 4 in the second memory
+	module := header + "\x0b\x09\x01\x02\x01\x41\x04\x0b\x02ab"
+
+	m, err := wasm.ReadModule(bytes.NewReader([]byte(module)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memories := m.Memories()
+	if len(memories) != 2 || memories[1].Limits.Maximum != 2 {
+		t.Fatalf("unexpected memories: %+v", memories)
+	}
+	if limits, _ := m.MemoryLimits(); limits.Flags != 0 {
+		t.Errorf("unexpected limits of the first memory: %+v", limits)
+	}
+	if mem := m.LinearMemoryIndexSpace; len(mem) != 2 || len(mem[0]) != 0 || string(mem[1][4:]) != "ab" {
+		t.Errorf("unexpected initial memories: %q", mem)
+	}
+
+	// a segment of a third memory
+	module = header + "\x0b\x09\x01\x02\x02\x41\x04\x0b\x02ab"
+	if _, err := wasm.ReadModule(bytes.NewReader([]byte(module)), nil); err != wasm.InvalidLinearMemoryIndexError(2) {
+		t.Errorf("unexpected error: got=%v, want=%v", err, wasm.InvalidLinearMemoryIndexError(2))
+	}
+}
+
+func TestCustomPageSizes(t *testing.T) {
+	for _, tc := range []struct {
+		memory   string
+		pageSize int
+		err      error
+	}{
+		{"\x05\x04\x01\x08\x03\x00", 1, nil},
+		{"\x05\x04\x01\x08\x03\x10", 65536, nil},
+		{"\x05\x03\x01\x00\x03", 65536, nil},
+		{"\x05\x04\x01\x08\x03\x0c", 0, wasm.InvalidPageSizeError(12)},
+	} {
+		m, err := wasm.ReadModule(bytes.NewReader([]byte("\x00asm\x01\x00\x00\x00"+tc.memory)), nil)
+		if err != tc.err {
+			t.Errorf("%q: unexpected error: got=%v, want=%v", tc.memory, err, tc.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if limits, _ := m.MemoryLimits(); limits.PageSize() != tc.pageSize || limits.Initial != 3 {
+			t.Errorf("%q: unexpected limits: %+v", tc.memory, limits)
+		}
+	}
+
+	// the segments of a 64-bit memory of three 1-byte pages
+	const header = "\x00asm\x01\x00\x00\x00\x05\x04\x01\x0c\x03\x00"
+	if _, err := wasm.ReadModule(bytes.NewReader([]byte(header+"\x0b\x08\x01\x00\x42\x01\x0b\x02ab")), nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := wasm.ReadModule(bytes.NewReader([]byte(header+"\x0b\x08\x01\x00\x42\x02\x0b\x02ab")), nil); err != wasm.ErrDataSegmentOutOfBounds {
+		t.Errorf("unexpected error: got=%v, want=%v", err, wasm.ErrDataSegmentOutOfBounds)
+	}
+}
+
+func TestExtendedConstExprs(t *testing.T) {
+	module := "\x00asm\x01\x00\x00\x00" +
+		// global section: 10, global 0 * 5 - 2, 3 + 4 as an i64, and a
+		// global reading itself
+		"\x06\x1e\x04" +
+		"\x7f\x00\x41\x0a\x0b" +
+		"\x7f\x00\x23\x00\x41\x05\x6c\x41\x02\x6b\x0b" +
+		"\x7e\x00\x42\x03\x42\x04\x7c\x0b" +
+		"\x7f\x00\x23\x03\x0b"
+
+	m, err := wasm.ReadModule(bytes.NewReader([]byte(module)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []interface{}{int32(10), int32(48), int64(7)} {
+		if got, err := m.ExecInitExpr(m.GlobalIndexSpace[i].Init); err != nil || got != want {
+			t.Errorf("global %d: got=%v (%v), want=%v", i, got, err, want)
+		}
+	}
+
+	for _, tc := range []struct {
+		expr string
+		err  error
+	}{
+		{"\x23\x03\x0b", wasm.ErrInitExprCycle},
+		{"\x41\x01\x42\x01\x6a\x0b", wasm.ErrInitExprOperands},
+		{"\x41\x01\x6a\x0b", wasm.ErrInitExprOperands},
+		{"\x41\x01\x41\x02\x0b", wasm.ErrInitExprOperands},
+		{"\x23\x04\x0b", wasm.InvalidGlobalIndexError(4)},
+	} {
+		if _, err := m.ExecInitExpr([]byte(tc.expr)); err != tc.err {
+			t.Errorf("%q: unexpected error: got=%v, want=%v", tc.expr, err, tc.err)
+		}
+	}
+}
+
+func TestGCTypes(t *testing.T) {
+	module := "\x00asm\x01\x00\x00\x00" +
+		// type section: a rec group of struct { mut i32, (ref null 1) }
+		// and array (mut i8), and a final subtype of the struct adding an
+		// i64 field
+		"\x01\x1b\x02" +
+		"\x4e\x02" +
+		"\x5f\x02\x7f\x01\x63\x01\x00" +
+		"\x50\x00\x5e\x78\x01" +
+		"\x4f\x01\x00\x5f\x03\x7f\x01\x63\x01\x00\x7e\x00"
+
+	m, err := wasm.ReadModule(bytes.NewReader([]byte(module)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(m.Types.Entries); n != 3 {
+		t.Fatalf("len(Types.Entries) = %d, want 3", n)
+	}
+	if s := m.Types.Entries[0].Fields[1].Type.String(); s != "(ref null 1)" {
+		t.Errorf("field type: got=%s, want=(ref null 1)", s)
+	}
+	if !m.Types.Entries[0].IsStruct() || !m.Types.Entries[1].IsArray() {
+		t.Errorf("unexpected type forms: %v", m.Types.Entries)
+	}
+
+	for _, tc := range []struct {
+		t, of wasm.ValueType
+		want  bool
+	}{
+		{2, 0, true},
+		{0, 2, false},
+		{0, wasm.ValueTypeStructref, true},
+		{1, wasm.ValueTypeArrayref, true},
+		{1, wasm.ValueTypeStructref, false},
+		{wasm.ValueTypeI31ref, wasm.ValueTypeEqref, true},
+		{wasm.ValueTypeNullref, 1, true},
+		{wasm.ValueTypeExternref, wasm.ValueTypeAnyref, false},
+	} {
+		if got := m.Subtype(tc.t, tc.of); got != tc.want {
+			t.Errorf("Subtype(%v, %v): got=%v, want=%v", tc.t, tc.of, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		types string
+		err   error
+	}{
+		{"\x01\x07\x01\x5f\x01\x63\x05\x00", wasm.InvalidTypeIndexError(5)},
+		{"\x01\x04\x01\x5e\x7b\x00", wasm.ErrFieldTypeV128},
+	} {
+		_, err := wasm.ReadModule(bytes.NewReader([]byte("\x00asm\x01\x00\x00\x00"+tc.types)), nil)
+		if err != tc.err {
+			t.Errorf("%q: unexpected error: got=%v, want=%v", tc.types, err, tc.err)
+		}
+	}
+}
+
+func TestFunctionType(t *testing.T) {
+	module := "\x00asm\x01\x00\x00\x00" +
+		// type section: () -> () and (i32) -> ()
+		"\x01\x08\x02\x60\x00\x00\x60\x01\x7f\x00" +
+		// import section: env.f of type 1
+		"\x02\x09\x01\x03env\x01f\x00\x01" +
+		// function section: a function of type 0
+		"\x03\x02\x01\x00" +
+		"\x0a\x04\x01\x02\x00\x0b"
+
+	// the env imports don't need resolving
+	resolve := func(name string) (*wasm.Module, error) {
+		return nil, fmt.Errorf("unexpected import of %s", name)
+	}
+	m, err := wasm.ReadModule(bytes.NewReader([]byte(module)), resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []uint32{1, 0} {
+		if got, ok := m.FunctionType(i); !ok || got != want {
+			t.Errorf("FunctionType(%d): got=%d (%v), want=%d", i, got, ok, want)
+		}
+	}
+	if _, ok := m.FunctionType(2); ok {
+		t.Error("FunctionType(2) of a missing function")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	fnames, err := filepath.Glob(filepath.Join("testdata", "*.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	more, err := filepath.Glob(filepath.Join("..", "exec", "testdata", "*.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lossy := map[string]bool{"func-ref.wasm": true, "gc.wasm": true}
+	for _, fname := range append(fnames, more...) {
+		raw, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := wasm.ReadModule(bytes.NewReader(raw), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", fname, err)
+		}
+		var encoded bytes.Buffer
+		if err = m.Encode(&encoded); err != nil {
+			t.Fatalf("%s: %v", fname, err)
+		}
+		// the modules whose types don't keep their nullability nor their
+		// recursion groups are only encoded alike once read back
+		if lossy[filepath.Base(fname)] {
+			m, err = wasm.ReadModule(bytes.NewReader(encoded.Bytes()), nil)
+			if err != nil {
+				t.Fatalf("%s: reading the encoded module: %v", fname, err)
+			}
+			raw = encoded.Bytes()
+			encoded = bytes.Buffer{}
+			if err = m.Encode(&encoded); err != nil {
+				t.Fatalf("%s: %v", fname, err)
+			}
+		}
+		if !bytes.Equal(encoded.Bytes(), raw) {
+			t.Errorf("%s: the encoded module differs", fname)
+		}
+	}
+}
+
+func TestEncodeBuiltModule(t *testing.T) {
+	sig := wasm.FunctionSig{Form: int8(wasm.TypeFunc), ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}
+	m := &wasm.Module{
+		Types:    &wasm.SectionTypes{Entries: []wasm.FunctionSig{sig}},
+		Function: &wasm.SectionFunctions{Types: []uint32{0}},
+		Export: &wasm.SectionExports{
+			Entries: map[string]wasm.ExportEntry{"f": {FieldStr: "f", Kind: wasm.ExternalFunction}},
+		},
+		Code:  &wasm.SectionCode{Bodies: []wasm.FunctionBody{{Code: []byte{0x41, 0x2a}}}}, // i32.const 42
+		Other: []wasm.Section{{Name: "note", Bytes: []byte("hi")}},
+	}
+	var encoded bytes.Buffer
+	if err := m.Encode(&encoded); err != nil {
+		t.Fatal(err)
+	}
+	want := "\x00asm\x01\x00\x00\x00" +
+		"\x01\x05\x01\x60\x00\x01\x7f" +
+		"\x03\x02\x01\x00" +
+		"\x07\x05\x01\x01f\x00\x00" +
+		"\x0a\x06\x01\x04\x00\x41\x2a\x0b" +
+		"\x00\x07\x04notehi"
+	if encoded.String() != want {
+		t.Errorf("got %q, want %q", encoded.String(), want)
+	}
+	if _, err := wasm.ReadModule(bytes.NewReader(encoded.Bytes()), nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", "globals.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := wasm.ReadModule(bytes.NewReader(raw), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the module arrives a byte at a time
+	d := wasm.NewDecoder(iotest.OneByteReader(bytes.NewReader(raw)), wasm.DefaultDecodeLimits)
+	d.DiscardSectionBytes = true
+	var ids []wasm.SectionID
+	for {
+		s, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Bytes != nil {
+			t.Errorf("%s section: bytes kept", s.ID)
+		}
+		if s.End != d.Offset() {
+			t.Errorf("%s section: end=%d, offset=%d", s.ID, s.End, d.Offset())
+		}
+		ids = append(ids, s.ID)
+	}
+	if len(ids) == 0 || d.Offset() != int64(len(raw)) {
+		t.Fatalf("read %d sections, %d bytes of %d", len(ids), d.Offset(), len(raw))
+	}
+	m, err := d.Finish(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, encoded bytes.Buffer
+	if err = m.Encode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if err = want.Encode(&encoded); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), encoded.Bytes()) || len(m.GlobalIndexSpace) != len(want.GlobalIndexSpace) {
+		t.Error("the decoded module differs from the one read by ReadModule")
+	}
+
+	// an invalid section is rejected before the rest of the module is read
+	invalid := []byte("\x00asm\x01\x00\x00\x00\x01\x04\x01\x60\x00\x00\x03\x02\x01\x05")
+	d = wasm.NewDecoder(io.MultiReader(bytes.NewReader(invalid), iotest.TimeoutReader(bytes.NewReader(raw))), wasm.DefaultDecodeLimits)
+	if _, err = d.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Next(); err != wasm.InvalidTypeIndexError(5) {
+		t.Errorf("got=%v, want=%v", err, wasm.InvalidTypeIndexError(5))
+	}
+
+	if _, err := wasm.NewDecoder(bytes.NewReader([]byte("\x00asm")), wasm.DecodeLimits{}).Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated header: got=%v, want=%v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestLazyCode(t *testing.T) {
+	fnames, err := filepath.Glob(filepath.Join("testdata", "*.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fname := range fnames {
+		raw, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := wasm.ReadModule(bytes.NewReader(raw), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := wasm.NewDecoder(bytes.NewReader(raw), wasm.DefaultDecodeLimits)
+		d.LazyCode = true
+		m, err := d.Finish(nil)
+		if err != nil {
+			t.Fatalf("%s: %v", fname, err)
+		}
+		if m.Code == nil {
+			continue
+		}
+
+		// the bodies left encoded are written back as they were read
+		var got, encoded bytes.Buffer
+		if err = m.Encode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if err = want.Encode(&encoded); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), encoded.Bytes()) {
+			t.Errorf("%s: the lazily decoded module encodes differently", fname)
+		}
+
+		for i := range m.Code.Bodies {
+			body := &m.Code.Bodies[i]
+			if body.Code != nil {
+				t.Fatalf("%s: body %d decoded as it was read", fname, i)
+			}
+			if err = body.Decode(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(body.Locals, want.Code.Bodies[i].Locals) || !bytes.Equal(body.Code, want.Code.Bodies[i].Code) {
+				t.Errorf("%s: body %d differs from the one read eagerly", fname, i)
+			}
+		}
+	}
+
+	// the limits on the locals are checked once a body is decoded
+	module := []byte("\x00asm\x01\x00\x00\x00" +
+		"\x01\x04\x01\x60\x00\x00" + // type 0: [] -> []
+		"\x03\x02\x01\x00" + // function 0 of type 0
+		"\x0a\x06\x01\x04\x01\x03\x7f\x0b") // 3 i32 locals
+	limits := wasm.DefaultDecodeLimits
+	limits.MaxLocalsPerFunc = 2
+	d := wasm.NewDecoder(bytes.NewReader(module), limits)
+	d.LazyCode = true
+	m, err := d.Finish(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := wasm.DecodeLimitError{Limit: "locals per function", Max: 2}
+	if err = m.DecodeCode(); err != want {
+		t.Errorf("got=%v, want=%v", err, want)
+	}
+	if _, err = wasm.ReadModuleWithLimits(bytes.NewReader(module), nil, limits); err != want {
+		t.Errorf("eager: got=%v, want=%v", err, want)
+	}
+}
+
+func TestLoadModuleFile(t *testing.T) {
+	fnames, err := filepath.Glob(filepath.Join("testdata", "*.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fname := range fnames {
+		raw, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := wasm.ReadModule(bytes.NewReader(raw), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := wasm.LoadModuleFile(fname, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", fname, err)
+		}
+		var got, encoded bytes.Buffer
+		if err = m.Encode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if err = want.Encode(&encoded); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), encoded.Bytes()) {
+			t.Errorf("%s: the loaded module differs from the one read by ReadModule", fname)
+		}
+		if err = m.Close(); err != nil {
+			t.Errorf("%s: %v", fname, err)
+		}
+	}
+
+	if _, err := wasm.LoadModuleFile(filepath.Join("testdata", "missing.wasm"), nil); err == nil {
+		t.Error("loaded a missing file")
+	}
+
+	// the bodies read by a NewBytesDecoder refer to its bytes
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", "globals.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.NewBytesDecoder(raw, wasm.DefaultDecodeLimits).Finish(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Code.Bodies) == 0 || len(m.Code.Bodies[0].Code) == 0 {
+		t.Fatal("no code to check")
+	}
+	for i := range raw {
+		raw[i] = 0xff
+	}
+	if m.Code.Bodies[0].Code[0] != 0xff {
+		t.Error("the body was copied")
+	}
+}
+
+func TestCustomSections(t *testing.T) {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", "globals.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.ReadModule(bytes.NewReader(raw), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddCustomSection("abi", []byte("v1"))
+	m.AddCustomSection("audit", []byte("stamp"))
+	m.AddCustomSection("abi", []byte("extra"))
+
+	reread := func() *wasm.Module {
+		var b bytes.Buffer
+		if err := m.Encode(&b); err != nil {
+			t.Fatal(err)
+		}
+		m, err := wasm.ReadModule(&b, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	got := reread()
+	if names := got.CustomSectionNames(); fmt.Sprint(names) != "[abi audit]" {
+		t.Errorf("names=%v", names)
+	}
+	if sections := got.CustomSections("abi"); len(sections) != 2 || string(sections[1].Bytes) != "extra" {
+		t.Errorf("abi sections=%v", sections)
+	}
+	// the custom sections follow the ones the module was read with
+	if last := got.Other[len(got.Other)-1]; last.Start < got.Code.End {
+		t.Errorf("custom section at %d before the end of the code at %d", last.Start, got.Code.End)
+	}
+
+	m.SetCustomSection("abi", []byte("v2"))
+	if n := m.RemoveCustomSections("audit"); n != 1 {
+		t.Errorf("removed %d sections", n)
+	}
+	got = reread()
+	if payload, ok := got.CustomSection("abi"); !ok || string(payload) != "v2" || len(got.CustomSections("abi")) != 1 {
+		t.Errorf("abi=%q, %v", payload, ok)
+	}
+	if _, ok := got.CustomSection("audit"); ok {
+		t.Error("found a removed section")
+	}
+}
+
+func TestNameSection(t *testing.T) {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", "globals.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.ReadModule(bytes.NewReader(raw), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.FunctionIndexSpace) == 0 {
+		t.Fatal("no function to name")
+	}
+
+	// a name section naming the module, the first function and its first
+	// local, followed by a truncated subsection
+	var names, sub bytes.Buffer
+	writeName := func(w *bytes.Buffer, name string) {
+		leb128.WriteVarUint32(w, uint32(len(name)))
+		w.WriteString(name)
+	}
+	writeSub := func(id wasm.NameSubsection) {
+		names.WriteByte(byte(id))
+		leb128.WriteVarUint32(&names, uint32(sub.Len()))
+		names.Write(sub.Bytes())
+		sub.Reset()
+	}
+	writeName(&sub, "test")
+	writeSub(wasm.NamesModule)
+	sub.Write([]byte{1, 0})
+	writeName(&sub, "first")
+	writeSub(wasm.NamesFunctions)
+	sub.Write([]byte{1, 0, 1, 0})
+	writeName(&sub, "x")
+	writeSub(wasm.NamesLocals)
+	names.Write([]byte{byte(wasm.NamesGlobals), 10})
+	m.AddCustomSection("name", names.Bytes())
+
+	var b bytes.Buffer
+	if err = m.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = wasm.ReadModule(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	n := m.Names()
+	if n.Module != "test" || n.Function(0) != "first" || n.Local(0, 0) != "x" || n.Local(0, 1) != "" {
+		t.Errorf("names=%+v", n)
+	}
+	if _, ok := n.Entries[wasm.NamesGlobals]; ok {
+		t.Error("read a truncated subsection")
+	}
+	if m.FunctionIndexSpace[0].Name != "first" {
+		t.Errorf("function name=%q", m.FunctionIndexSpace[0].Name)
+	}
+}
+
+func TestProducersAndTargetFeatures(t *testing.T) {
+	m := &wasm.Module{}
+	if producers, err := m.Producers(); producers != nil || err != nil {
+		t.Errorf("no section: got %v, %v", producers, err)
+	}
+	m.AddCustomSection("producers", []byte("\x02"+
+		"\x08language\x01\x04Rust\x061.70.0"+
+		"\x0cprocessed-by\x02\x05rustc\x061.70.0\x08wasm-opt\x03116"))
+	m.AddCustomSection("target_features", []byte("\x03+\x07simd128=\x07atomics-\x0bbulk-memory"))
+	producers, err := m.Producers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(producers); got != "[{language [{Rust 1.70.0}]} {processed-by [{rustc 1.70.0} {wasm-opt 116}]}]" {
+		t.Errorf("producers=%s", got)
+	}
+	features, err := m.TargetFeatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []wasm.TargetFeature{{'+', "simd128"}, {'=', "atomics"}, {'-', "bulk-memory"}}
+	if !reflect.DeepEqual(features, want) {
+		t.Errorf("features=%v, want %v", features, want)
+	}
+
+	m.SetCustomSection("target_features", []byte("\x01*\x04simd"))
+	if _, err = m.TargetFeatures(); err == nil {
+		t.Error("read an invalid prefix")
+	}
+	m.SetCustomSection("producers", []byte("\x01\x08language\x02\x04Rust"))
+	if _, err = m.Producers(); err == nil {
+		t.Error("read a truncated section")
+	}
+}
+
+func TestDataSegments(t *testing.T) {
+	// a memory, a global of 32, and segments at 16, passive and at the
+	// global
+	module := "\x00asm\x01\x00\x00\x00\x05\x03\x01\x00\x01\x06\x06\x01\x7f\x00\x41\x20\x0b" +
+		"\x0b\x13\x03\x00\x41\x10\x0b\x02ab\x01\x03xyz\x00\x23\x00\x0b\x01c"
+	m, err := wasm.ReadModule(bytes.NewReader([]byte(module)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, err := m.DataSegments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []wasm.DataSegmentInfo{
+		{Segment: 0, Mode: wasm.SegmentActive, OffsetExpr: []byte("\x41\x10\x0b"), Offset: 16, Data: []byte("ab")},
+		{Segment: 1, Mode: wasm.SegmentPassive, Data: []byte("xyz")},
+		{Segment: 2, Mode: wasm.SegmentActive, OffsetExpr: []byte("\x23\x00\x0b"), Offset: 32, Data: []byte("c")},
+	}
+	if !reflect.DeepEqual(segments, want) {
+		t.Errorf("segments=%+v, want %+v", segments, want)
+	}
+	if end := segments[0].End(); end != 18 {
+		t.Errorf("end=%d", end)
+	}
+
+	if segments, err = (&wasm.Module{}).DataSegments(); err != nil || segments != nil {
+		t.Errorf("no data section: %v, %v", segments, err)
+	}
+}
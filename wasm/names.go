@@ -0,0 +1,161 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+import (
+	"bytes"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+// NameSubsection is the id of a subsection of the name section, naming
+// the entries of an index space, or the locals, labels or fields of
+// functions and types.
+type NameSubsection byte
+
+// The subsections of the name section.
+const (
+	NamesModule    NameSubsection = 0
+	NamesFunctions NameSubsection = 1
+	NamesLocals    NameSubsection = 2
+	NamesLabels    NameSubsection = 3
+	NamesTypes     NameSubsection = 4
+	NamesTables    NameSubsection = 5
+	NamesMemories  NameSubsection = 6
+	NamesGlobals   NameSubsection = 7
+	NamesElements  NameSubsection = 8
+	NamesData      NameSubsection = 9
+	NamesFields    NameSubsection = 10
+	NamesTags      NameSubsection = 11
+)
+
+// indirect returns whether the subsection names the entries of functions
+// or types rather than the ones of an index space.
+func (id NameSubsection) indirect() bool {
+	return id == NamesLocals || id == NamesLabels || id == NamesFields
+}
+
+// Names are the names the "name" custom section of a module gives to its
+// entries, for debugging.
+type Names struct {
+	Module string
+	// Entries maps the indices of the entries of an index space to their
+	// names, by the id of the subsection naming them. Indirect maps the
+	// indices of the functions, or types, to the names of their locals,
+	// labels or fields.
+	Entries  map[NameSubsection]map[uint32]string
+	Indirect map[NameSubsection]map[uint32]map[uint32]string
+}
+
+// Function returns the name of the function with the given index, or an
+// empty string.
+func (n *Names) Function(index uint32) string {
+	return n.Entries[NamesFunctions][index]
+}
+
+// Local returns the name of the local with the given index of a function,
+// or an empty string.
+func (n *Names) Local(function, local uint32) string {
+	return n.Indirect[NamesLocals][function][local]
+}
+
+// Names returns the names given by the name section of the module, which
+// are empty if it has none. Being debug information, a malformed section
+// is ignored past the last subsection read.
+func (m *Module) Names() *Names {
+	n := &Names{
+		Entries:  make(map[NameSubsection]map[uint32]string),
+		Indirect: make(map[NameSubsection]map[uint32]map[uint32]string),
+	}
+	payload, ok := m.CustomSection("name")
+	if !ok {
+		return n
+	}
+	r := bytes.NewReader(payload)
+	for r.Len() > 0 {
+		id, _ := r.ReadByte()
+		size, err := leb128.ReadVarUint32(r)
+		if err != nil || int(size) > r.Len() {
+			break
+		}
+		sub := make([]byte, size)
+		r.Read(sub)
+		sr := bytes.NewReader(sub)
+		switch id := NameSubsection(id); {
+		case id == NamesModule:
+			if name, err := readName(sr); err == nil {
+				n.Module = name
+			}
+		case id.indirect():
+			n.Indirect[id] = readIndirectNameMap(sr)
+		default:
+			n.Entries[id] = readNameMap(sr)
+		}
+	}
+	return n
+}
+
+// setFunctionNames sets the names of the functions of the index space of
+// the module from its name section.
+func (m *Module) setFunctionNames() {
+	if m.Function == nil {
+		return
+	}
+	names := m.Names().Entries[NamesFunctions]
+	if len(names) == 0 {
+		return
+	}
+	// the imported functions aren't in the index space unless resolved
+	first := len(m.Function.Types) - len(m.FunctionIndexSpace)
+	for i := range m.FunctionIndexSpace {
+		m.FunctionIndexSpace[i].Name = names[uint32(first+i)]
+	}
+}
+
+// readNameMap reads a map from indices to names, up to its first malformed
+// entry.
+func readNameMap(r *bytes.Reader) map[uint32]string {
+	names := make(map[uint32]string)
+	count, err := leb128.ReadVarUint32(r)
+	for i := uint32(0); err == nil && i < count; i++ {
+		var index uint32
+		var name string
+		if index, err = leb128.ReadVarUint32(r); err != nil {
+			break
+		}
+		if name, err = readName(r); err != nil {
+			break
+		}
+		names[index] = name
+	}
+	return names
+}
+
+// readIndirectNameMap reads a map from indices to name maps.
+func readIndirectNameMap(r *bytes.Reader) map[uint32]map[uint32]string {
+	maps := make(map[uint32]map[uint32]string)
+	count, err := leb128.ReadVarUint32(r)
+	for i := uint32(0); err == nil && i < count; i++ {
+		var index uint32
+		if index, err = leb128.ReadVarUint32(r); err != nil {
+			break
+		}
+		maps[index] = readNameMap(r)
+	}
+	return maps
+}
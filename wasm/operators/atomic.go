@@ -0,0 +1,103 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package operators
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// PrefixAtomic is the prefix byte of the atomic memory operators of the
+// threads proposal. Like PrefixMisc, the operator is given by the
+// varuint32 sub-opcode following it, and the memory operators are
+// followed by a memory immediate.
+const PrefixAtomic byte = 0xfe
+
+// Atomic operators, encoded as PrefixAtomic followed by the sub-opcode.
+var (
+	MemoryAtomicNotify     = newPrefixedOp(PrefixAtomic, 0x00, "memory.atomic.notify", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	MemoryAtomicWait32     = newPrefixedOp(PrefixAtomic, 0x01, "memory.atomic.wait32", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	MemoryAtomicWait64     = newPrefixedOp(PrefixAtomic, 0x02, "memory.atomic.wait64", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	AtomicFence            = newPrefixedOp(PrefixAtomic, 0x03, "atomic.fence", nil, noReturn)
+	I32AtomicLoad          = newPrefixedOp(PrefixAtomic, 0x10, "i32.atomic.load", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicLoad          = newPrefixedOp(PrefixAtomic, 0x11, "i64.atomic.load", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicLoad8u        = newPrefixedOp(PrefixAtomic, 0x12, "i32.atomic.load8_u", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I32AtomicLoad16u       = newPrefixedOp(PrefixAtomic, 0x13, "i32.atomic.load16_u", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicLoad8u        = newPrefixedOp(PrefixAtomic, 0x14, "i64.atomic.load8_u", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicLoad16u       = newPrefixedOp(PrefixAtomic, 0x15, "i64.atomic.load16_u", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicLoad32u       = newPrefixedOp(PrefixAtomic, 0x16, "i64.atomic.load32_u", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicStore         = newPrefixedOp(PrefixAtomic, 0x17, "i32.atomic.store", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, noReturn)
+	I64AtomicStore         = newPrefixedOp(PrefixAtomic, 0x18, "i64.atomic.store", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, noReturn)
+	I32AtomicStore8        = newPrefixedOp(PrefixAtomic, 0x19, "i32.atomic.store8", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, noReturn)
+	I32AtomicStore16       = newPrefixedOp(PrefixAtomic, 0x1a, "i32.atomic.store16", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, noReturn)
+	I64AtomicStore8        = newPrefixedOp(PrefixAtomic, 0x1b, "i64.atomic.store8", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, noReturn)
+	I64AtomicStore16       = newPrefixedOp(PrefixAtomic, 0x1c, "i64.atomic.store16", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, noReturn)
+	I64AtomicStore32       = newPrefixedOp(PrefixAtomic, 0x1d, "i64.atomic.store32", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, noReturn)
+	I32AtomicRmwAdd        = newPrefixedOp(PrefixAtomic, 0x1e, "i32.atomic.rmw.add", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmwAdd        = newPrefixedOp(PrefixAtomic, 0x1f, "i64.atomic.rmw.add", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmw8AddU      = newPrefixedOp(PrefixAtomic, 0x20, "i32.atomic.rmw8.add_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I32AtomicRmw16AddU     = newPrefixedOp(PrefixAtomic, 0x21, "i32.atomic.rmw16.add_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmw8AddU      = newPrefixedOp(PrefixAtomic, 0x22, "i64.atomic.rmw8.add_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw16AddU     = newPrefixedOp(PrefixAtomic, 0x23, "i64.atomic.rmw16.add_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw32AddU     = newPrefixedOp(PrefixAtomic, 0x24, "i64.atomic.rmw32.add_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmwSub        = newPrefixedOp(PrefixAtomic, 0x25, "i32.atomic.rmw.sub", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmwSub        = newPrefixedOp(PrefixAtomic, 0x26, "i64.atomic.rmw.sub", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmw8SubU      = newPrefixedOp(PrefixAtomic, 0x27, "i32.atomic.rmw8.sub_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I32AtomicRmw16SubU     = newPrefixedOp(PrefixAtomic, 0x28, "i32.atomic.rmw16.sub_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmw8SubU      = newPrefixedOp(PrefixAtomic, 0x29, "i64.atomic.rmw8.sub_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw16SubU     = newPrefixedOp(PrefixAtomic, 0x2a, "i64.atomic.rmw16.sub_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw32SubU     = newPrefixedOp(PrefixAtomic, 0x2b, "i64.atomic.rmw32.sub_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmwAnd        = newPrefixedOp(PrefixAtomic, 0x2c, "i32.atomic.rmw.and", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmwAnd        = newPrefixedOp(PrefixAtomic, 0x2d, "i64.atomic.rmw.and", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmw8AndU      = newPrefixedOp(PrefixAtomic, 0x2e, "i32.atomic.rmw8.and_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I32AtomicRmw16AndU     = newPrefixedOp(PrefixAtomic, 0x2f, "i32.atomic.rmw16.and_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmw8AndU      = newPrefixedOp(PrefixAtomic, 0x30, "i64.atomic.rmw8.and_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw16AndU     = newPrefixedOp(PrefixAtomic, 0x31, "i64.atomic.rmw16.and_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw32AndU     = newPrefixedOp(PrefixAtomic, 0x32, "i64.atomic.rmw32.and_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmwOr         = newPrefixedOp(PrefixAtomic, 0x33, "i32.atomic.rmw.or", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmwOr         = newPrefixedOp(PrefixAtomic, 0x34, "i64.atomic.rmw.or", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmw8OrU       = newPrefixedOp(PrefixAtomic, 0x35, "i32.atomic.rmw8.or_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I32AtomicRmw16OrU      = newPrefixedOp(PrefixAtomic, 0x36, "i32.atomic.rmw16.or_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmw8OrU       = newPrefixedOp(PrefixAtomic, 0x37, "i64.atomic.rmw8.or_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw16OrU      = newPrefixedOp(PrefixAtomic, 0x38, "i64.atomic.rmw16.or_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw32OrU      = newPrefixedOp(PrefixAtomic, 0x39, "i64.atomic.rmw32.or_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmwXor        = newPrefixedOp(PrefixAtomic, 0x3a, "i32.atomic.rmw.xor", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmwXor        = newPrefixedOp(PrefixAtomic, 0x3b, "i64.atomic.rmw.xor", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmw8XorU      = newPrefixedOp(PrefixAtomic, 0x3c, "i32.atomic.rmw8.xor_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I32AtomicRmw16XorU     = newPrefixedOp(PrefixAtomic, 0x3d, "i32.atomic.rmw16.xor_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmw8XorU      = newPrefixedOp(PrefixAtomic, 0x3e, "i64.atomic.rmw8.xor_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw16XorU     = newPrefixedOp(PrefixAtomic, 0x3f, "i64.atomic.rmw16.xor_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw32XorU     = newPrefixedOp(PrefixAtomic, 0x40, "i64.atomic.rmw32.xor_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmwXchg       = newPrefixedOp(PrefixAtomic, 0x41, "i32.atomic.rmw.xchg", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmwXchg       = newPrefixedOp(PrefixAtomic, 0x42, "i64.atomic.rmw.xchg", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmw8XchgU     = newPrefixedOp(PrefixAtomic, 0x43, "i32.atomic.rmw8.xchg_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I32AtomicRmw16XchgU    = newPrefixedOp(PrefixAtomic, 0x44, "i32.atomic.rmw16.xchg_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmw8XchgU     = newPrefixedOp(PrefixAtomic, 0x45, "i64.atomic.rmw8.xchg_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw16XchgU    = newPrefixedOp(PrefixAtomic, 0x46, "i64.atomic.rmw16.xchg_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw32XchgU    = newPrefixedOp(PrefixAtomic, 0x47, "i64.atomic.rmw32.xchg_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmwCmpxchg    = newPrefixedOp(PrefixAtomic, 0x48, "i32.atomic.rmw.cmpxchg", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmwCmpxchg    = newPrefixedOp(PrefixAtomic, 0x49, "i64.atomic.rmw.cmpxchg", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I32AtomicRmw8CmpxchgU  = newPrefixedOp(PrefixAtomic, 0x4a, "i32.atomic.rmw8.cmpxchg_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I32AtomicRmw16CmpxchgU = newPrefixedOp(PrefixAtomic, 0x4b, "i32.atomic.rmw16.cmpxchg_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32)
+	I64AtomicRmw8CmpxchgU  = newPrefixedOp(PrefixAtomic, 0x4c, "i64.atomic.rmw8.cmpxchg_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw16CmpxchgU = newPrefixedOp(PrefixAtomic, 0x4d, "i64.atomic.rmw16.cmpxchg_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+	I64AtomicRmw32CmpxchgU = newPrefixedOp(PrefixAtomic, 0x4e, "i64.atomic.rmw32.cmpxchg_u", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI64, wasm.ValueTypeI32}, wasm.ValueTypeI64)
+)
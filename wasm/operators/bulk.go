@@ -0,0 +1,37 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package operators
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// Bulk memory operators, encoded as PrefixMisc followed by the sub-opcode.
+var (
+	MemoryInit = newPrefixedOp(PrefixMisc, 0x08, "memory.init", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, noReturn)
+	DataDrop   = newPrefixedOp(PrefixMisc, 0x09, "data.drop", nil, noReturn)
+	MemoryCopy = newPrefixedOp(PrefixMisc, 0x0a, "memory.copy", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, noReturn)
+	MemoryFill = newPrefixedOp(PrefixMisc, 0x0b, "memory.fill", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, noReturn)
+	TableInit  = newPrefixedOp(PrefixMisc, 0x0c, "table.init", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, noReturn)
+	ElemDrop   = newPrefixedOp(PrefixMisc, 0x0d, "elem.drop", nil, noReturn)
+	TableCopy  = newPrefixedOp(PrefixMisc, 0x0e, "table.copy", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32}, noReturn)
+)
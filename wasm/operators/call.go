@@ -26,4 +26,12 @@ var (
 	Call = newPolymorphicOp(0x10, "call")
 	//CallIndirect op call indirect
 	CallIndirect = newPolymorphicOp(0x11, "call_indirect")
+	//ReturnCall op return call
+	ReturnCall = newPolymorphicOp(0x12, "return_call")
+	//ReturnCallIndirect op return call indirect
+	ReturnCallIndirect = newPolymorphicOp(0x13, "return_call_indirect")
+	//CallRef op call ref, calling the function referenced by its operand
+	CallRef = newPolymorphicOp(0x14, "call_ref")
+	//ReturnCallRef op return call ref
+	ReturnCallRef = newPolymorphicOp(0x15, "return_call_ref")
 )
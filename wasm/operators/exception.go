@@ -0,0 +1,33 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package operators
+
+// Exception handling operators. try, catch, catch_all and delegate delimit
+// blocks like block and else, throw and rethrow make the stack polymorphic.
+var (
+	Try      = newOp(0x06, "try", nil, noReturn)
+	Catch    = newOp(0x07, "catch", nil, noReturn)
+	Throw    = newPolymorphicOp(0x08, "throw")
+	Rethrow  = newPolymorphicOp(0x09, "rethrow")
+	Delegate = newOp(0x18, "delegate", nil, noReturn)
+	CatchAll = newOp(0x19, "catch_all", nil, noReturn)
+)
@@ -0,0 +1,66 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package operators
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// PrefixGC is the prefix byte of the operators of the GC proposal on
+// structs, arrays and unboxed scalars. Like PrefixMisc, the operator is
+// given by the varuint32 sub-opcode following it.
+const PrefixGC byte = 0xfb
+
+// GC operators, encoded as PrefixGC followed by the sub-opcode. The types
+// of the operands of most of them depend on the type index following the
+// sub-opcode. The array.new_data, array.new_elem, array.init_data,
+// array.init_elem, br_on_cast and br_on_cast_fail operators aren't
+// supported.
+var (
+	StructNew        = newPolymorphicPrefixedOp(PrefixGC, 0x00, "struct.new")
+	StructNewDefault = newPolymorphicPrefixedOp(PrefixGC, 0x01, "struct.new_default")
+	StructGet        = newPolymorphicPrefixedOp(PrefixGC, 0x02, "struct.get")
+	StructGetS       = newPolymorphicPrefixedOp(PrefixGC, 0x03, "struct.get_s")
+	StructGetU       = newPolymorphicPrefixedOp(PrefixGC, 0x04, "struct.get_u")
+	StructSet        = newPolymorphicPrefixedOp(PrefixGC, 0x05, "struct.set")
+	ArrayNew         = newPolymorphicPrefixedOp(PrefixGC, 0x06, "array.new")
+	ArrayNewDefault  = newPolymorphicPrefixedOp(PrefixGC, 0x07, "array.new_default")
+	ArrayNewFixed    = newPolymorphicPrefixedOp(PrefixGC, 0x08, "array.new_fixed")
+	ArrayGet         = newPolymorphicPrefixedOp(PrefixGC, 0x0b, "array.get")
+	ArrayGetS        = newPolymorphicPrefixedOp(PrefixGC, 0x0c, "array.get_s")
+	ArrayGetU        = newPolymorphicPrefixedOp(PrefixGC, 0x0d, "array.get_u")
+	ArraySet         = newPolymorphicPrefixedOp(PrefixGC, 0x0e, "array.set")
+	ArrayLen         = newPrefixedOp(PrefixGC, 0x0f, "array.len", []wasm.ValueType{wasm.ValueTypeArrayref}, wasm.ValueTypeI32)
+	ArrayFill        = newPolymorphicPrefixedOp(PrefixGC, 0x10, "array.fill")
+	ArrayCopy        = newPolymorphicPrefixedOp(PrefixGC, 0x11, "array.copy")
+	RefTest          = newPolymorphicPrefixedOp(PrefixGC, 0x14, "ref.test")
+	RefTestNull      = newPolymorphicPrefixedOp(PrefixGC, 0x15, "ref.test null")
+	RefCast          = newPolymorphicPrefixedOp(PrefixGC, 0x16, "ref.cast")
+	RefCastNull      = newPolymorphicPrefixedOp(PrefixGC, 0x17, "ref.cast null")
+	AnyConvertExtern = newPrefixedOp(PrefixGC, 0x1a, "any.convert_extern", []wasm.ValueType{wasm.ValueTypeExternref}, wasm.ValueTypeAnyref)
+	ExternConvertAny = newPrefixedOp(PrefixGC, 0x1b, "extern.convert_any", []wasm.ValueType{wasm.ValueTypeAnyref}, wasm.ValueTypeExternref)
+	RefI31           = newPrefixedOp(PrefixGC, 0x1c, "ref.i31", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeI31ref)
+	I31GetS          = newPrefixedOp(PrefixGC, 0x1d, "i31.get_s", []wasm.ValueType{wasm.ValueTypeI31ref}, wasm.ValueTypeI32)
+	I31GetU          = newPrefixedOp(PrefixGC, 0x1e, "i31.get_u", []wasm.ValueType{wasm.ValueTypeI31ref}, wasm.ValueTypeI32)
+
+	RefEq = newOp(0xd3, "ref.eq", []wasm.ValueType{wasm.ValueTypeEqref, wasm.ValueTypeEqref}, wasm.ValueTypeI32)
+)
@@ -0,0 +1,87 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package operators
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// Memory64 returns o as it operates on a 64-bit memory, as defined by the
+// memory64 proposal: its address operands, and the sizes taken by
+// memory.fill and memory.copy or returned by memory.size and memory.grow,
+// are i64 instead of i32. The other operators are returned as is.
+func (o Op) Memory64() Op {
+	var wide []int // the indices in Args of the i64 operands
+	switch {
+	case o.Code >= I32Load && o.Code <= I64Store32:
+		wide = []int{len(o.Args) - 1}
+	case o.Code == CurrentMemory:
+		o.Returns = wasm.ValueTypeI64
+	case o.Code == GrowMemory:
+		wide = []int{0}
+		o.Returns = wasm.ValueTypeI64
+	case o.Code == PrefixMisc:
+		switch o.Sub {
+		case MemoryInit:
+			wide = []int{2}
+		case MemoryCopy:
+			wide = []int{0, 1, 2}
+		case MemoryFill:
+			wide = []int{0, 2}
+		}
+	case o.Code == PrefixSIMD:
+		if o.Sub <= V128Store || o.Sub >= V128Load8Lane && o.Sub <= V128Load64Zero {
+			wide = []int{len(o.Args) - 1}
+		}
+	case o.Code == PrefixAtomic:
+		if o.Sub != AtomicFence {
+			wide = []int{len(o.Args) - 1}
+		}
+	}
+	if wide != nil {
+		args := append([]wasm.ValueType(nil), o.Args...)
+		for _, i := range wide {
+			args[i] = wasm.ValueTypeI64
+		}
+		o.Args = args
+	}
+	return o
+}
+
+// MemoryCopy64 returns memory.copy o as it copies between a destination
+// and a source memory that may differ, as defined by the multi-memory
+// proposal: each address is an i64 if its memory is 64-bit, and the
+// length only if both are.
+func (o Op) MemoryCopy64(dst64, src64 bool) Op {
+	args := append([]wasm.ValueType(nil), o.Args...)
+	if dst64 && src64 {
+		args[0] = wasm.ValueTypeI64
+	}
+	if src64 {
+		args[1] = wasm.ValueTypeI64
+	}
+	if dst64 {
+		args[2] = wasm.ValueTypeI64
+	}
+	o.Args = args
+	return o
+}
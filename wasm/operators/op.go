@@ -26,17 +26,27 @@ package operators
 import (
 	"fmt"
 	"github.com/bottos-project/bottos/vm/wasm/wasm"
-	log "github.com/cihub/seelog"
+	"github.com/bottos-project/bottos/vm/wasm/log"
 )
 
 var (
 	ops      [256]Op // an array of Op values mapped by wasm opcodes, used by New().
 	noReturn = wasm.ValueType(wasm.BlockTypeEmpty)
+
+	// prefixed operators mapped by their prefix byte and sub-opcode, used
+	// by NewPrefixed().
+	prefixedOps = map[byte]map[uint32]Op{}
 )
 
+// PrefixMisc is the prefix byte of the bulk memory operators. It isn't a
+// valid opcode by itself: the operator is given by the varuint32
+// sub-opcode following it.
+const PrefixMisc byte = 0xfc
+
 // Op describes a WASM operator.
 type Op struct {
-	Code byte   // The single-byte opcode
+	Code byte   // The single-byte opcode, or the prefix byte of a prefixed operator
+	Sub  uint32 // The sub-opcode of a prefixed operator
 	Name string // The name of the operator
 
 	// Whether this operator is polymorphic.
@@ -82,6 +92,34 @@ func newPolymorphicOp(code byte, name string) byte {
 	return code
 }
 
+func newPrefixedOp(prefix byte, sub uint32, name string, args []wasm.ValueType, returns wasm.ValueType) uint32 {
+	m, ok := prefixedOps[prefix]
+	if !ok {
+		m = map[uint32]Op{}
+		prefixedOps[prefix] = m
+	}
+	if m[sub].IsValid() {
+		panic(log.Errorf("Opcode %#x %#x is already assigned to %s", prefix, sub, m[sub].Name))
+	}
+
+	m[sub] = Op{
+		Code:    prefix,
+		Sub:     sub,
+		Name:    name,
+		Args:    args,
+		Returns: returns,
+	}
+	return sub
+}
+
+func newPolymorphicPrefixedOp(prefix byte, sub uint32, name string) uint32 {
+	sub = newPrefixedOp(prefix, sub, name, nil, 0)
+	op := prefixedOps[prefix][sub]
+	op.Polymorphic = true
+	prefixedOps[prefix][sub] = op
+	return sub
+}
+
 //InvalidOpcodeError op code error type
 type InvalidOpcodeError byte
 
@@ -103,3 +141,25 @@ func New(code byte) (Op, error) {
 	}
 	return op, nil
 }
+
+// InvalidPrefixedOpcodeError is returned for an unknown sub-opcode of a
+// prefixed operator.
+type InvalidPrefixedOpcodeError struct {
+	Prefix byte
+	Sub    uint32
+}
+
+func (e InvalidPrefixedOpcodeError) Error() string {
+	return fmt.Sprintf("Invalid opcode: %#x %#x", e.Prefix, e.Sub)
+}
+
+// NewPrefixed returns the Op object for the given prefix byte and
+// sub-opcode. If they don't name an operator, an
+// InvalidPrefixedOpcodeError is returned.
+func NewPrefixed(prefix byte, sub uint32) (Op, error) {
+	op, ok := prefixedOps[prefix][sub]
+	if !ok {
+		return op, InvalidPrefixedOpcodeError{prefix, sub}
+	}
+	return op, nil
+}
@@ -22,7 +22,10 @@
 package operators
 
 import (
+	"reflect"
 	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
 )
 
 func TestNew(t *testing.T) {
@@ -45,3 +48,77 @@ func TestNew(t *testing.T) {
 		t.Fatalf("0xff: operator %v is valid (should be invalid)", op2)
 	}
 }
+
+func TestNewPrefixed(t *testing.T) {
+	op, err := NewPrefixed(PrefixMisc, MemoryFill)
+	if err != nil {
+		t.Fatalf("unexpected error from NewPrefixed: %v", err)
+	}
+	if op.Name != "memory.fill" || op.Code != PrefixMisc || op.Sub != MemoryFill {
+		t.Fatalf("0xfc 0x0b: unexpected Op %v", op)
+	}
+
+	if _, err = NewPrefixed(PrefixMisc, 0xff); err == nil {
+		t.Fatalf("0xfc 0xff: expected error while getting Op value")
+	}
+	if _, err = New(PrefixMisc); err == nil {
+		t.Fatalf("0xfc: expected error while getting Op value")
+	}
+}
+
+func TestMemory64(t *testing.T) {
+	for _, tc := range []struct {
+		op      Op
+		args    []wasm.ValueType
+		returns wasm.ValueType
+	}{
+		{mustNew(I64Store), []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI64}, noReturn},
+		{mustNew(GrowMemory), []wasm.ValueType{wasm.ValueTypeI64}, wasm.ValueTypeI64},
+		{mustNewPrefixed(PrefixMisc, MemoryInit), []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI64}, noReturn},
+		{mustNewPrefixed(PrefixAtomic, MemoryAtomicWait32), []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeI32, wasm.ValueTypeI64}, wasm.ValueTypeI32},
+		{mustNew(I32Add), []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, wasm.ValueTypeI32},
+	} {
+		op := tc.op.Memory64()
+		if !reflect.DeepEqual(op.Args, tc.args) || op.Returns != tc.returns {
+			t.Errorf("%s: got=%v %v, want=%v %v", op.Name, op.Args, op.Returns, tc.args, tc.returns)
+		}
+	}
+	// the operators themselves are left untouched
+	if op := mustNew(I64Store); op.Args[1] != wasm.ValueTypeI32 {
+		t.Errorf("i64.store: address operand changed to %v", op.Args[1])
+	}
+}
+
+func TestMemoryCopy64(t *testing.T) {
+	i32, i64 := wasm.ValueTypeI32, wasm.ValueTypeI64
+	for _, tc := range []struct {
+		dst64, src64 bool
+		args         []wasm.ValueType
+	}{
+		{false, false, []wasm.ValueType{i32, i32, i32}},
+		{true, false, []wasm.ValueType{i32, i32, i64}},
+		{false, true, []wasm.ValueType{i32, i64, i32}},
+		{true, true, []wasm.ValueType{i64, i64, i64}},
+	} {
+		op := mustNewPrefixed(PrefixMisc, MemoryCopy).MemoryCopy64(tc.dst64, tc.src64)
+		if !reflect.DeepEqual(op.Args, tc.args) {
+			t.Errorf("dst64=%v src64=%v: got=%v, want=%v", tc.dst64, tc.src64, op.Args, tc.args)
+		}
+	}
+}
+
+func mustNew(code byte) Op {
+	op, err := New(code)
+	if err != nil {
+		panic(err)
+	}
+	return op
+}
+
+func mustNewPrefixed(prefix byte, sub uint32) Op {
+	op, err := NewPrefixed(prefix, sub)
+	if err != nil {
+		panic(err)
+	}
+	return op
+}
@@ -25,4 +25,7 @@ package operators
 var (
 	Drop   = newPolymorphicOp(0x1a, "drop")
 	Select = newPolymorphicOp(0x1b, "select")
+	// SelectTyped is a select whose operand type is given by an
+	// immediate, as needed by references.
+	SelectTyped = newPolymorphicOp(0x1c, "select.typed")
 )
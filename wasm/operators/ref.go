@@ -0,0 +1,45 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package operators
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// Reference and table operators. The types of the references depend on
+// immediates, which makes most of them polymorphic.
+var (
+	RefNull   = newPolymorphicOp(0xd0, "ref.null")
+	RefIsNull = newPolymorphicOp(0xd1, "ref.is_null")
+	RefFunc   = newOp(0xd2, "ref.func", nil, wasm.ValueTypeFuncref)
+
+	RefAsNonNull = newPolymorphicOp(0xd4, "ref.as_non_null")
+	BrOnNull     = newPolymorphicOp(0xd5, "br_on_null")
+	BrOnNonNull  = newPolymorphicOp(0xd6, "br_on_non_null")
+
+	TableGet = newPolymorphicOp(0x25, "table.get")
+	TableSet = newPolymorphicOp(0x26, "table.set")
+
+	TableGrow = newPolymorphicPrefixedOp(PrefixMisc, 0x0f, "table.grow")
+	TableSize = newPrefixedOp(PrefixMisc, 0x10, "table.size", nil, wasm.ValueTypeI32)
+	TableFill = newPolymorphicPrefixedOp(PrefixMisc, 0x11, "table.fill")
+)
@@ -0,0 +1,58 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package operators
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// Relaxed SIMD operators, encoded as PrefixSIMD followed by the sub-opcode.
+// Their results may depend on the platform in the proposal, the VM
+// executes them deterministically, see exec.VMConfig.RelaxedSIMD.
+var (
+	I8x16RelaxedSwizzle           = newPrefixedOp(PrefixSIMD, 0x100, "i8x16.relaxed_swizzle", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4RelaxedTruncF32x4S       = newPrefixedOp(PrefixSIMD, 0x101, "i32x4.relaxed_trunc_f32x4_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4RelaxedTruncF32x4U       = newPrefixedOp(PrefixSIMD, 0x102, "i32x4.relaxed_trunc_f32x4_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4RelaxedTruncF64x2SZero   = newPrefixedOp(PrefixSIMD, 0x103, "i32x4.relaxed_trunc_f64x2_s_zero", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4RelaxedTruncF64x2UZero   = newPrefixedOp(PrefixSIMD, 0x104, "i32x4.relaxed_trunc_f64x2_u_zero", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4RelaxedMadd              = newPrefixedOp(PrefixSIMD, 0x105, "f32x4.relaxed_madd", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4RelaxedNmadd             = newPrefixedOp(PrefixSIMD, 0x106, "f32x4.relaxed_nmadd", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2RelaxedMadd              = newPrefixedOp(PrefixSIMD, 0x107, "f64x2.relaxed_madd", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2RelaxedNmadd             = newPrefixedOp(PrefixSIMD, 0x108, "f64x2.relaxed_nmadd", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16RelaxedLaneselect        = newPrefixedOp(PrefixSIMD, 0x109, "i8x16.relaxed_laneselect", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8RelaxedLaneselect        = newPrefixedOp(PrefixSIMD, 0x10a, "i16x8.relaxed_laneselect", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4RelaxedLaneselect        = newPrefixedOp(PrefixSIMD, 0x10b, "i32x4.relaxed_laneselect", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2RelaxedLaneselect        = newPrefixedOp(PrefixSIMD, 0x10c, "i64x2.relaxed_laneselect", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4RelaxedMin               = newPrefixedOp(PrefixSIMD, 0x10d, "f32x4.relaxed_min", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4RelaxedMax               = newPrefixedOp(PrefixSIMD, 0x10e, "f32x4.relaxed_max", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2RelaxedMin               = newPrefixedOp(PrefixSIMD, 0x10f, "f64x2.relaxed_min", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2RelaxedMax               = newPrefixedOp(PrefixSIMD, 0x110, "f64x2.relaxed_max", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8RelaxedQ15mulrS          = newPrefixedOp(PrefixSIMD, 0x111, "i16x8.relaxed_q15mulr_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8RelaxedDotI8x16I7x16S    = newPrefixedOp(PrefixSIMD, 0x112, "i16x8.relaxed_dot_i8x16_i7x16_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4RelaxedDotI8x16I7x16AddS = newPrefixedOp(PrefixSIMD, 0x113, "i32x4.relaxed_dot_i8x16_i7x16_add_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+)
+
+// IsRelaxedSIMD returns whether the operator prefixed by PrefixSIMD with
+// the given sub-opcode is a relaxed SIMD operator.
+func IsRelaxedSIMD(sub uint32) bool {
+	return sub >= I8x16RelaxedSwizzle && sub <= I32x4RelaxedDotI8x16I7x16AddS
+}
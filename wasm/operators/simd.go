@@ -0,0 +1,271 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Copyright 2017 The go-interpreter Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package operators
+
+import (
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// PrefixSIMD is the prefix byte of the fixed-width SIMD operators, which
+// operate on v128 values. Like PrefixMisc, the operator is given by the
+// varuint32 sub-opcode following it.
+const PrefixSIMD byte = 0xfd
+
+// SIMD operators, encoded as PrefixSIMD followed by the sub-opcode.
+var (
+	V128Load                  = newPrefixedOp(PrefixSIMD, 0x00, "v128.load", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load8x8S              = newPrefixedOp(PrefixSIMD, 0x01, "v128.load8x8_s", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load8x8U              = newPrefixedOp(PrefixSIMD, 0x02, "v128.load8x8_u", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load16x4S             = newPrefixedOp(PrefixSIMD, 0x03, "v128.load16x4_s", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load16x4U             = newPrefixedOp(PrefixSIMD, 0x04, "v128.load16x4_u", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load32x2S             = newPrefixedOp(PrefixSIMD, 0x05, "v128.load32x2_s", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load32x2U             = newPrefixedOp(PrefixSIMD, 0x06, "v128.load32x2_u", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load8Splat            = newPrefixedOp(PrefixSIMD, 0x07, "v128.load8_splat", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load16Splat           = newPrefixedOp(PrefixSIMD, 0x08, "v128.load16_splat", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load32Splat           = newPrefixedOp(PrefixSIMD, 0x09, "v128.load32_splat", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load64Splat           = newPrefixedOp(PrefixSIMD, 0x0a, "v128.load64_splat", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Store                 = newPrefixedOp(PrefixSIMD, 0x0b, "v128.store", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeI32}, noReturn)
+	V128Const                 = newPrefixedOp(PrefixSIMD, 0x0c, "v128.const", nil, wasm.ValueTypeV128)
+	I8x16Shuffle              = newPrefixedOp(PrefixSIMD, 0x0d, "i8x16.shuffle", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16Swizzle              = newPrefixedOp(PrefixSIMD, 0x0e, "i8x16.swizzle", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16Splat                = newPrefixedOp(PrefixSIMD, 0x0f, "i8x16.splat", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	I16x8Splat                = newPrefixedOp(PrefixSIMD, 0x10, "i16x8.splat", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	I32x4Splat                = newPrefixedOp(PrefixSIMD, 0x11, "i32x4.splat", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	I64x2Splat                = newPrefixedOp(PrefixSIMD, 0x12, "i64x2.splat", []wasm.ValueType{wasm.ValueTypeI64}, wasm.ValueTypeV128)
+	F32x4Splat                = newPrefixedOp(PrefixSIMD, 0x13, "f32x4.splat", []wasm.ValueType{wasm.ValueTypeF32}, wasm.ValueTypeV128)
+	F64x2Splat                = newPrefixedOp(PrefixSIMD, 0x14, "f64x2.splat", []wasm.ValueType{wasm.ValueTypeF64}, wasm.ValueTypeV128)
+	I8x16ExtractLaneS         = newPrefixedOp(PrefixSIMD, 0x15, "i8x16.extract_lane_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I8x16ExtractLaneU         = newPrefixedOp(PrefixSIMD, 0x16, "i8x16.extract_lane_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I8x16ReplaceLane          = newPrefixedOp(PrefixSIMD, 0x17, "i8x16.replace_lane", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ExtractLaneS         = newPrefixedOp(PrefixSIMD, 0x18, "i16x8.extract_lane_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I16x8ExtractLaneU         = newPrefixedOp(PrefixSIMD, 0x19, "i16x8.extract_lane_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I16x8ReplaceLane          = newPrefixedOp(PrefixSIMD, 0x1a, "i16x8.replace_lane", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ExtractLane          = newPrefixedOp(PrefixSIMD, 0x1b, "i32x4.extract_lane", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I32x4ReplaceLane          = newPrefixedOp(PrefixSIMD, 0x1c, "i32x4.replace_lane", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2ExtractLane          = newPrefixedOp(PrefixSIMD, 0x1d, "i64x2.extract_lane", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI64)
+	I64x2ReplaceLane          = newPrefixedOp(PrefixSIMD, 0x1e, "i64x2.replace_lane", []wasm.ValueType{wasm.ValueTypeI64, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4ExtractLane          = newPrefixedOp(PrefixSIMD, 0x1f, "f32x4.extract_lane", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeF32)
+	F32x4ReplaceLane          = newPrefixedOp(PrefixSIMD, 0x20, "f32x4.replace_lane", []wasm.ValueType{wasm.ValueTypeF32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2ExtractLane          = newPrefixedOp(PrefixSIMD, 0x21, "f64x2.extract_lane", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeF64)
+	F64x2ReplaceLane          = newPrefixedOp(PrefixSIMD, 0x22, "f64x2.replace_lane", []wasm.ValueType{wasm.ValueTypeF64, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16Eq                   = newPrefixedOp(PrefixSIMD, 0x23, "i8x16.eq", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16Ne                   = newPrefixedOp(PrefixSIMD, 0x24, "i8x16.ne", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16LtS                  = newPrefixedOp(PrefixSIMD, 0x25, "i8x16.lt_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16LtU                  = newPrefixedOp(PrefixSIMD, 0x26, "i8x16.lt_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16GtS                  = newPrefixedOp(PrefixSIMD, 0x27, "i8x16.gt_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16GtU                  = newPrefixedOp(PrefixSIMD, 0x28, "i8x16.gt_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16LeS                  = newPrefixedOp(PrefixSIMD, 0x29, "i8x16.le_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16LeU                  = newPrefixedOp(PrefixSIMD, 0x2a, "i8x16.le_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16GeS                  = newPrefixedOp(PrefixSIMD, 0x2b, "i8x16.ge_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16GeU                  = newPrefixedOp(PrefixSIMD, 0x2c, "i8x16.ge_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8Eq                   = newPrefixedOp(PrefixSIMD, 0x2d, "i16x8.eq", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8Ne                   = newPrefixedOp(PrefixSIMD, 0x2e, "i16x8.ne", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8LtS                  = newPrefixedOp(PrefixSIMD, 0x2f, "i16x8.lt_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8LtU                  = newPrefixedOp(PrefixSIMD, 0x30, "i16x8.lt_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8GtS                  = newPrefixedOp(PrefixSIMD, 0x31, "i16x8.gt_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8GtU                  = newPrefixedOp(PrefixSIMD, 0x32, "i16x8.gt_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8LeS                  = newPrefixedOp(PrefixSIMD, 0x33, "i16x8.le_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8LeU                  = newPrefixedOp(PrefixSIMD, 0x34, "i16x8.le_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8GeS                  = newPrefixedOp(PrefixSIMD, 0x35, "i16x8.ge_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8GeU                  = newPrefixedOp(PrefixSIMD, 0x36, "i16x8.ge_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4Eq                   = newPrefixedOp(PrefixSIMD, 0x37, "i32x4.eq", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4Ne                   = newPrefixedOp(PrefixSIMD, 0x38, "i32x4.ne", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4LtS                  = newPrefixedOp(PrefixSIMD, 0x39, "i32x4.lt_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4LtU                  = newPrefixedOp(PrefixSIMD, 0x3a, "i32x4.lt_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4GtS                  = newPrefixedOp(PrefixSIMD, 0x3b, "i32x4.gt_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4GtU                  = newPrefixedOp(PrefixSIMD, 0x3c, "i32x4.gt_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4LeS                  = newPrefixedOp(PrefixSIMD, 0x3d, "i32x4.le_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4LeU                  = newPrefixedOp(PrefixSIMD, 0x3e, "i32x4.le_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4GeS                  = newPrefixedOp(PrefixSIMD, 0x3f, "i32x4.ge_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4GeU                  = newPrefixedOp(PrefixSIMD, 0x40, "i32x4.ge_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Eq                   = newPrefixedOp(PrefixSIMD, 0x41, "f32x4.eq", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Ne                   = newPrefixedOp(PrefixSIMD, 0x42, "f32x4.ne", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Lt                   = newPrefixedOp(PrefixSIMD, 0x43, "f32x4.lt", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Gt                   = newPrefixedOp(PrefixSIMD, 0x44, "f32x4.gt", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Le                   = newPrefixedOp(PrefixSIMD, 0x45, "f32x4.le", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Ge                   = newPrefixedOp(PrefixSIMD, 0x46, "f32x4.ge", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Eq                   = newPrefixedOp(PrefixSIMD, 0x47, "f64x2.eq", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Ne                   = newPrefixedOp(PrefixSIMD, 0x48, "f64x2.ne", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Lt                   = newPrefixedOp(PrefixSIMD, 0x49, "f64x2.lt", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Gt                   = newPrefixedOp(PrefixSIMD, 0x4a, "f64x2.gt", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Le                   = newPrefixedOp(PrefixSIMD, 0x4b, "f64x2.le", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Ge                   = newPrefixedOp(PrefixSIMD, 0x4c, "f64x2.ge", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	V128Not                   = newPrefixedOp(PrefixSIMD, 0x4d, "v128.not", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	V128And                   = newPrefixedOp(PrefixSIMD, 0x4e, "v128.and", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	V128Andnot                = newPrefixedOp(PrefixSIMD, 0x4f, "v128.andnot", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	V128Or                    = newPrefixedOp(PrefixSIMD, 0x50, "v128.or", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	V128Xor                   = newPrefixedOp(PrefixSIMD, 0x51, "v128.xor", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	V128Bitselect             = newPrefixedOp(PrefixSIMD, 0x52, "v128.bitselect", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	V128AnyTrue               = newPrefixedOp(PrefixSIMD, 0x53, "v128.any_true", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	V128Load8Lane             = newPrefixedOp(PrefixSIMD, 0x54, "v128.load8_lane", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load16Lane            = newPrefixedOp(PrefixSIMD, 0x55, "v128.load16_lane", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load32Lane            = newPrefixedOp(PrefixSIMD, 0x56, "v128.load32_lane", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load64Lane            = newPrefixedOp(PrefixSIMD, 0x57, "v128.load64_lane", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Store8Lane            = newPrefixedOp(PrefixSIMD, 0x58, "v128.store8_lane", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeI32}, noReturn)
+	V128Store16Lane           = newPrefixedOp(PrefixSIMD, 0x59, "v128.store16_lane", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeI32}, noReturn)
+	V128Store32Lane           = newPrefixedOp(PrefixSIMD, 0x5a, "v128.store32_lane", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeI32}, noReturn)
+	V128Store64Lane           = newPrefixedOp(PrefixSIMD, 0x5b, "v128.store64_lane", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeI32}, noReturn)
+	V128Load32Zero            = newPrefixedOp(PrefixSIMD, 0x5c, "v128.load32_zero", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	V128Load64Zero            = newPrefixedOp(PrefixSIMD, 0x5d, "v128.load64_zero", []wasm.ValueType{wasm.ValueTypeI32}, wasm.ValueTypeV128)
+	F32x4DemoteF64x2Zero      = newPrefixedOp(PrefixSIMD, 0x5e, "f32x4.demote_f64x2_zero", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2PromoteLowF32x4      = newPrefixedOp(PrefixSIMD, 0x5f, "f64x2.promote_low_f32x4", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16Abs                  = newPrefixedOp(PrefixSIMD, 0x60, "i8x16.abs", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16Neg                  = newPrefixedOp(PrefixSIMD, 0x61, "i8x16.neg", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16Popcnt               = newPrefixedOp(PrefixSIMD, 0x62, "i8x16.popcnt", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16AllTrue              = newPrefixedOp(PrefixSIMD, 0x63, "i8x16.all_true", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I8x16Bitmask              = newPrefixedOp(PrefixSIMD, 0x64, "i8x16.bitmask", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I8x16NarrowI16x8S         = newPrefixedOp(PrefixSIMD, 0x65, "i8x16.narrow_i16x8_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16NarrowI16x8U         = newPrefixedOp(PrefixSIMD, 0x66, "i8x16.narrow_i16x8_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Ceil                 = newPrefixedOp(PrefixSIMD, 0x67, "f32x4.ceil", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Floor                = newPrefixedOp(PrefixSIMD, 0x68, "f32x4.floor", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Trunc                = newPrefixedOp(PrefixSIMD, 0x69, "f32x4.trunc", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Nearest              = newPrefixedOp(PrefixSIMD, 0x6a, "f32x4.nearest", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16Shl                  = newPrefixedOp(PrefixSIMD, 0x6b, "i8x16.shl", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16ShrS                 = newPrefixedOp(PrefixSIMD, 0x6c, "i8x16.shr_s", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16ShrU                 = newPrefixedOp(PrefixSIMD, 0x6d, "i8x16.shr_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16Add                  = newPrefixedOp(PrefixSIMD, 0x6e, "i8x16.add", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16AddSatS              = newPrefixedOp(PrefixSIMD, 0x6f, "i8x16.add_sat_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16AddSatU              = newPrefixedOp(PrefixSIMD, 0x70, "i8x16.add_sat_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16Sub                  = newPrefixedOp(PrefixSIMD, 0x71, "i8x16.sub", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16SubSatS              = newPrefixedOp(PrefixSIMD, 0x72, "i8x16.sub_sat_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16SubSatU              = newPrefixedOp(PrefixSIMD, 0x73, "i8x16.sub_sat_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Ceil                 = newPrefixedOp(PrefixSIMD, 0x74, "f64x2.ceil", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Floor                = newPrefixedOp(PrefixSIMD, 0x75, "f64x2.floor", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16MinS                 = newPrefixedOp(PrefixSIMD, 0x76, "i8x16.min_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16MinU                 = newPrefixedOp(PrefixSIMD, 0x77, "i8x16.min_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16MaxS                 = newPrefixedOp(PrefixSIMD, 0x78, "i8x16.max_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16MaxU                 = newPrefixedOp(PrefixSIMD, 0x79, "i8x16.max_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Trunc                = newPrefixedOp(PrefixSIMD, 0x7a, "f64x2.trunc", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I8x16AvgrU                = newPrefixedOp(PrefixSIMD, 0x7b, "i8x16.avgr_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ExtaddPairwiseI8x16S = newPrefixedOp(PrefixSIMD, 0x7c, "i16x8.extadd_pairwise_i8x16_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ExtaddPairwiseI8x16U = newPrefixedOp(PrefixSIMD, 0x7d, "i16x8.extadd_pairwise_i8x16_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ExtaddPairwiseI16x8S = newPrefixedOp(PrefixSIMD, 0x7e, "i32x4.extadd_pairwise_i16x8_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ExtaddPairwiseI16x8U = newPrefixedOp(PrefixSIMD, 0x7f, "i32x4.extadd_pairwise_i16x8_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8Abs                  = newPrefixedOp(PrefixSIMD, 0x80, "i16x8.abs", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8Neg                  = newPrefixedOp(PrefixSIMD, 0x81, "i16x8.neg", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8Q15mulrSatS          = newPrefixedOp(PrefixSIMD, 0x82, "i16x8.q15mulr_sat_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8AllTrue              = newPrefixedOp(PrefixSIMD, 0x83, "i16x8.all_true", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I16x8Bitmask              = newPrefixedOp(PrefixSIMD, 0x84, "i16x8.bitmask", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I16x8NarrowI32x4S         = newPrefixedOp(PrefixSIMD, 0x85, "i16x8.narrow_i32x4_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8NarrowI32x4U         = newPrefixedOp(PrefixSIMD, 0x86, "i16x8.narrow_i32x4_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ExtendLowI8x16S      = newPrefixedOp(PrefixSIMD, 0x87, "i16x8.extend_low_i8x16_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ExtendHighI8x16S     = newPrefixedOp(PrefixSIMD, 0x88, "i16x8.extend_high_i8x16_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ExtendLowI8x16U      = newPrefixedOp(PrefixSIMD, 0x89, "i16x8.extend_low_i8x16_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ExtendHighI8x16U     = newPrefixedOp(PrefixSIMD, 0x8a, "i16x8.extend_high_i8x16_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8Shl                  = newPrefixedOp(PrefixSIMD, 0x8b, "i16x8.shl", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ShrS                 = newPrefixedOp(PrefixSIMD, 0x8c, "i16x8.shr_s", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ShrU                 = newPrefixedOp(PrefixSIMD, 0x8d, "i16x8.shr_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8Add                  = newPrefixedOp(PrefixSIMD, 0x8e, "i16x8.add", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8AddSatS              = newPrefixedOp(PrefixSIMD, 0x8f, "i16x8.add_sat_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8AddSatU              = newPrefixedOp(PrefixSIMD, 0x90, "i16x8.add_sat_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8Sub                  = newPrefixedOp(PrefixSIMD, 0x91, "i16x8.sub", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8SubSatS              = newPrefixedOp(PrefixSIMD, 0x92, "i16x8.sub_sat_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8SubSatU              = newPrefixedOp(PrefixSIMD, 0x93, "i16x8.sub_sat_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Nearest              = newPrefixedOp(PrefixSIMD, 0x94, "f64x2.nearest", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8Mul                  = newPrefixedOp(PrefixSIMD, 0x95, "i16x8.mul", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8MinS                 = newPrefixedOp(PrefixSIMD, 0x96, "i16x8.min_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8MinU                 = newPrefixedOp(PrefixSIMD, 0x97, "i16x8.min_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8MaxS                 = newPrefixedOp(PrefixSIMD, 0x98, "i16x8.max_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8MaxU                 = newPrefixedOp(PrefixSIMD, 0x99, "i16x8.max_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8AvgrU                = newPrefixedOp(PrefixSIMD, 0x9b, "i16x8.avgr_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ExtmulLowI8x16S      = newPrefixedOp(PrefixSIMD, 0x9c, "i16x8.extmul_low_i8x16_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ExtmulHighI8x16S     = newPrefixedOp(PrefixSIMD, 0x9d, "i16x8.extmul_high_i8x16_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ExtmulLowI8x16U      = newPrefixedOp(PrefixSIMD, 0x9e, "i16x8.extmul_low_i8x16_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I16x8ExtmulHighI8x16U     = newPrefixedOp(PrefixSIMD, 0x9f, "i16x8.extmul_high_i8x16_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4Abs                  = newPrefixedOp(PrefixSIMD, 0xa0, "i32x4.abs", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4Neg                  = newPrefixedOp(PrefixSIMD, 0xa1, "i32x4.neg", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4AllTrue              = newPrefixedOp(PrefixSIMD, 0xa3, "i32x4.all_true", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I32x4Bitmask              = newPrefixedOp(PrefixSIMD, 0xa4, "i32x4.bitmask", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I32x4ExtendLowI16x8S      = newPrefixedOp(PrefixSIMD, 0xa7, "i32x4.extend_low_i16x8_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ExtendHighI16x8S     = newPrefixedOp(PrefixSIMD, 0xa8, "i32x4.extend_high_i16x8_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ExtendLowI16x8U      = newPrefixedOp(PrefixSIMD, 0xa9, "i32x4.extend_low_i16x8_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ExtendHighI16x8U     = newPrefixedOp(PrefixSIMD, 0xaa, "i32x4.extend_high_i16x8_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4Shl                  = newPrefixedOp(PrefixSIMD, 0xab, "i32x4.shl", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ShrS                 = newPrefixedOp(PrefixSIMD, 0xac, "i32x4.shr_s", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ShrU                 = newPrefixedOp(PrefixSIMD, 0xad, "i32x4.shr_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4Add                  = newPrefixedOp(PrefixSIMD, 0xae, "i32x4.add", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4Sub                  = newPrefixedOp(PrefixSIMD, 0xb1, "i32x4.sub", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4Mul                  = newPrefixedOp(PrefixSIMD, 0xb5, "i32x4.mul", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4MinS                 = newPrefixedOp(PrefixSIMD, 0xb6, "i32x4.min_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4MinU                 = newPrefixedOp(PrefixSIMD, 0xb7, "i32x4.min_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4MaxS                 = newPrefixedOp(PrefixSIMD, 0xb8, "i32x4.max_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4MaxU                 = newPrefixedOp(PrefixSIMD, 0xb9, "i32x4.max_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4DotI16x8S            = newPrefixedOp(PrefixSIMD, 0xba, "i32x4.dot_i16x8_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ExtmulLowI16x8S      = newPrefixedOp(PrefixSIMD, 0xbc, "i32x4.extmul_low_i16x8_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ExtmulHighI16x8S     = newPrefixedOp(PrefixSIMD, 0xbd, "i32x4.extmul_high_i16x8_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ExtmulLowI16x8U      = newPrefixedOp(PrefixSIMD, 0xbe, "i32x4.extmul_low_i16x8_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4ExtmulHighI16x8U     = newPrefixedOp(PrefixSIMD, 0xbf, "i32x4.extmul_high_i16x8_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2Abs                  = newPrefixedOp(PrefixSIMD, 0xc0, "i64x2.abs", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2Neg                  = newPrefixedOp(PrefixSIMD, 0xc1, "i64x2.neg", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2AllTrue              = newPrefixedOp(PrefixSIMD, 0xc3, "i64x2.all_true", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I64x2Bitmask              = newPrefixedOp(PrefixSIMD, 0xc4, "i64x2.bitmask", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeI32)
+	I64x2ExtendLowI32x4S      = newPrefixedOp(PrefixSIMD, 0xc7, "i64x2.extend_low_i32x4_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2ExtendHighI32x4S     = newPrefixedOp(PrefixSIMD, 0xc8, "i64x2.extend_high_i32x4_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2ExtendLowI32x4U      = newPrefixedOp(PrefixSIMD, 0xc9, "i64x2.extend_low_i32x4_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2ExtendHighI32x4U     = newPrefixedOp(PrefixSIMD, 0xca, "i64x2.extend_high_i32x4_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2Shl                  = newPrefixedOp(PrefixSIMD, 0xcb, "i64x2.shl", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2ShrS                 = newPrefixedOp(PrefixSIMD, 0xcc, "i64x2.shr_s", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2ShrU                 = newPrefixedOp(PrefixSIMD, 0xcd, "i64x2.shr_u", []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2Add                  = newPrefixedOp(PrefixSIMD, 0xce, "i64x2.add", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2Sub                  = newPrefixedOp(PrefixSIMD, 0xd1, "i64x2.sub", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2Mul                  = newPrefixedOp(PrefixSIMD, 0xd5, "i64x2.mul", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2Eq                   = newPrefixedOp(PrefixSIMD, 0xd6, "i64x2.eq", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2Ne                   = newPrefixedOp(PrefixSIMD, 0xd7, "i64x2.ne", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2LtS                  = newPrefixedOp(PrefixSIMD, 0xd8, "i64x2.lt_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2GtS                  = newPrefixedOp(PrefixSIMD, 0xd9, "i64x2.gt_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2LeS                  = newPrefixedOp(PrefixSIMD, 0xda, "i64x2.le_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2GeS                  = newPrefixedOp(PrefixSIMD, 0xdb, "i64x2.ge_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2ExtmulLowI32x4S      = newPrefixedOp(PrefixSIMD, 0xdc, "i64x2.extmul_low_i32x4_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2ExtmulHighI32x4S     = newPrefixedOp(PrefixSIMD, 0xdd, "i64x2.extmul_high_i32x4_s", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2ExtmulLowI32x4U      = newPrefixedOp(PrefixSIMD, 0xde, "i64x2.extmul_low_i32x4_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I64x2ExtmulHighI32x4U     = newPrefixedOp(PrefixSIMD, 0xdf, "i64x2.extmul_high_i32x4_u", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Abs                  = newPrefixedOp(PrefixSIMD, 0xe0, "f32x4.abs", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Neg                  = newPrefixedOp(PrefixSIMD, 0xe1, "f32x4.neg", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Sqrt                 = newPrefixedOp(PrefixSIMD, 0xe3, "f32x4.sqrt", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Add                  = newPrefixedOp(PrefixSIMD, 0xe4, "f32x4.add", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Sub                  = newPrefixedOp(PrefixSIMD, 0xe5, "f32x4.sub", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Mul                  = newPrefixedOp(PrefixSIMD, 0xe6, "f32x4.mul", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Div                  = newPrefixedOp(PrefixSIMD, 0xe7, "f32x4.div", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Min                  = newPrefixedOp(PrefixSIMD, 0xe8, "f32x4.min", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Max                  = newPrefixedOp(PrefixSIMD, 0xe9, "f32x4.max", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Pmin                 = newPrefixedOp(PrefixSIMD, 0xea, "f32x4.pmin", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4Pmax                 = newPrefixedOp(PrefixSIMD, 0xeb, "f32x4.pmax", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Abs                  = newPrefixedOp(PrefixSIMD, 0xec, "f64x2.abs", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Neg                  = newPrefixedOp(PrefixSIMD, 0xed, "f64x2.neg", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Sqrt                 = newPrefixedOp(PrefixSIMD, 0xef, "f64x2.sqrt", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Add                  = newPrefixedOp(PrefixSIMD, 0xf0, "f64x2.add", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Sub                  = newPrefixedOp(PrefixSIMD, 0xf1, "f64x2.sub", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Mul                  = newPrefixedOp(PrefixSIMD, 0xf2, "f64x2.mul", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Div                  = newPrefixedOp(PrefixSIMD, 0xf3, "f64x2.div", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Min                  = newPrefixedOp(PrefixSIMD, 0xf4, "f64x2.min", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Max                  = newPrefixedOp(PrefixSIMD, 0xf5, "f64x2.max", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Pmin                 = newPrefixedOp(PrefixSIMD, 0xf6, "f64x2.pmin", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2Pmax                 = newPrefixedOp(PrefixSIMD, 0xf7, "f64x2.pmax", []wasm.ValueType{wasm.ValueTypeV128, wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4TruncSatF32x4S       = newPrefixedOp(PrefixSIMD, 0xf8, "i32x4.trunc_sat_f32x4_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4TruncSatF32x4U       = newPrefixedOp(PrefixSIMD, 0xf9, "i32x4.trunc_sat_f32x4_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4ConvertI32x4S        = newPrefixedOp(PrefixSIMD, 0xfa, "f32x4.convert_i32x4_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F32x4ConvertI32x4U        = newPrefixedOp(PrefixSIMD, 0xfb, "f32x4.convert_i32x4_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4TruncSatF64x2SZero   = newPrefixedOp(PrefixSIMD, 0xfc, "i32x4.trunc_sat_f64x2_s_zero", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	I32x4TruncSatF64x2UZero   = newPrefixedOp(PrefixSIMD, 0xfd, "i32x4.trunc_sat_f64x2_u_zero", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2ConvertLowI32x4S     = newPrefixedOp(PrefixSIMD, 0xfe, "f64x2.convert_low_i32x4_s", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+	F64x2ConvertLowI32x4U     = newPrefixedOp(PrefixSIMD, 0xff, "f64x2.convert_low_i32x4_u", []wasm.ValueType{wasm.ValueTypeV128}, wasm.ValueTypeV128)
+)
@@ -0,0 +1,154 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+// ProducerField is a field of the producers section, such as "language",
+// "processed-by" or "sdk", listing the tools of this kind which produced
+// the module.
+type ProducerField struct {
+	Name   string
+	Values []ProducerValue
+}
+
+// ProducerValue is a tool listed by a field of the producers section,
+// with its version.
+type ProducerValue struct {
+	Name    string
+	Version string
+}
+
+// The prefixes of the features of the target_features section.
+const (
+	// FeatureUsed is the prefix of a feature the module uses.
+	FeatureUsed = '+'
+	// FeatureRequired is the prefix of a feature the modules linked with
+	// the module must use.
+	FeatureRequired = '='
+	// FeatureDisallowed is the prefix of a feature the modules linked with
+	// the module must not use.
+	FeatureDisallowed = '-'
+)
+
+// TargetFeature is a feature of the target_features section, whose Prefix
+// tells whether the module uses, requires or disallows it.
+type TargetFeature struct {
+	Prefix byte
+	Name   string
+}
+
+// CustomSectionError is returned for a malformed custom section.
+type CustomSectionError struct {
+	Name   string
+	Reason string
+}
+
+func (e CustomSectionError) Error() string {
+	return fmt.Sprintf("wasm: malformed %s section: %s", e.Name, e.Reason)
+}
+
+// Producers returns the fields of the producers section of the module, or
+// nil if it has none.
+func (m *Module) Producers() ([]ProducerField, error) {
+	payload, ok := m.CustomSection("producers")
+	if !ok {
+		return nil, nil
+	}
+	r := bytes.NewReader(payload)
+	malformed := func(err error) error {
+		return CustomSectionError{Name: "producers", Reason: err.Error()}
+	}
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	if err = checkCount(r, count); err != nil {
+		return nil, malformed(err)
+	}
+	fields := make([]ProducerField, count)
+	for i := range fields {
+		if fields[i].Name, err = readName(r); err != nil {
+			return nil, malformed(err)
+		}
+		values, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return nil, malformed(err)
+		}
+		if err = checkCount(r, values); err != nil {
+			return nil, malformed(err)
+		}
+		fields[i].Values = make([]ProducerValue, values)
+		for j := range fields[i].Values {
+			value := &fields[i].Values[j]
+			if value.Name, err = readName(r); err != nil {
+				return nil, malformed(err)
+			}
+			if value.Version, err = readName(r); err != nil {
+				return nil, malformed(err)
+			}
+		}
+	}
+	if r.Len() != 0 {
+		return nil, CustomSectionError{Name: "producers", Reason: "trailing bytes"}
+	}
+	return fields, nil
+}
+
+// TargetFeatures returns the features of the target_features section of
+// the module, or nil if it has none.
+func (m *Module) TargetFeatures() ([]TargetFeature, error) {
+	payload, ok := m.CustomSection("target_features")
+	if !ok {
+		return nil, nil
+	}
+	r := bytes.NewReader(payload)
+	malformed := func(err error) error {
+		return CustomSectionError{Name: "target_features", Reason: err.Error()}
+	}
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	if err = checkCount(r, count); err != nil {
+		return nil, malformed(err)
+	}
+	features := make([]TargetFeature, count)
+	for i := range features {
+		if features[i].Prefix, err = r.ReadByte(); err != nil {
+			return nil, malformed(err)
+		}
+		switch features[i].Prefix {
+		case FeatureUsed, FeatureRequired, FeatureDisallowed:
+		default:
+			return nil, CustomSectionError{Name: "target_features", Reason: fmt.Sprintf("invalid prefix %q", features[i].Prefix)}
+		}
+		if features[i].Name, err = readName(r); err != nil {
+			return nil, malformed(err)
+		}
+	}
+	if r.Len() != 0 {
+		return nil, CustomSectionError{Name: "target_features", Reason: "trailing bytes"}
+	}
+	return features, nil
+}
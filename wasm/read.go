@@ -23,10 +23,24 @@ package wasm
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
+	"unicode/utf8"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
 )
 
+// InvalidNameError is returned for a name which isn't valid UTF-8.
+type InvalidNameError string
+
+func (e InvalidNameError) Error() string {
+	return fmt.Sprintf("wasm: name %q is not valid UTF-8", string(e))
+}
+
 func readBytes(r io.Reader, n int) ([]byte, error) {
+	if err := checkCount(r, uint32(n)); err != nil {
+		return nil, err
+	}
 	bytes := make([]byte, n)
 	_, err := io.ReadFull(r, bytes)
 	if err != nil {
@@ -44,6 +58,28 @@ func readString(r io.Reader, n int) (string, error) {
 	return string(bytes), nil
 }
 
+// readName reads a name, which must be valid UTF-8.
+func readName(r io.Reader) (string, error) {
+	return readNameLimit(r, 0)
+}
+
+// readNameLimit reads a name like readName, failing with a
+// DecodeLimitError if it's longer than max bytes.
+func readNameLimit(r io.Reader, max int) (string, error) {
+	n, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return "", err
+	}
+	if err = checkLimit("name length", uint64(n), max); err != nil {
+		return "", err
+	}
+	s, err := readString(r, int(n))
+	if err == nil && !utf8.ValidString(s) {
+		return "", InvalidNameError(s)
+	}
+	return s, err
+}
+
 func readU32(r io.Reader) (uint32, error) {
 	var buf [4]byte
 	_, err := io.ReadFull(r, buf[:])
@@ -27,10 +27,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sync"
 
+	"github.com/bottos-project/bottos/vm/wasm/log"
 	"github.com/bottos-project/bottos/vm/wasm/wasm/internal/readpos"
 	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
-	log "github.com/cihub/seelog"
 )
 
 // SectionID is a 1-byte code that encodes the section code of both known and custom sections.
@@ -61,22 +62,28 @@ const (
 	SectionIDCode SectionID = 10
 	// SectionIDData data id
 	SectionIDData SectionID = 11
+	// SectionIDDataCount data count id
+	SectionIDDataCount SectionID = 12
+	// SectionIDTag exception tag id
+	SectionIDTag SectionID = 13
 )
 
 func (s SectionID) String() string {
 	n, ok := map[SectionID]string{
-		SectionIDCustom:   "custom",
-		SectionIDType:     "type",
-		SectionIDImport:   "import",
-		SectionIDFunction: "function",
-		SectionIDTable:    "table",
-		SectionIDMemory:   "memory",
-		SectionIDGlobal:   "global",
-		SectionIDExport:   "export",
-		SectionIDStart:    "start",
-		SectionIDElement:  "element",
-		SectionIDCode:     "code",
-		SectionIDData:     "data",
+		SectionIDCustom:    "custom",
+		SectionIDType:      "type",
+		SectionIDImport:    "import",
+		SectionIDFunction:  "function",
+		SectionIDTable:     "table",
+		SectionIDMemory:    "memory",
+		SectionIDGlobal:    "global",
+		SectionIDExport:    "export",
+		SectionIDStart:     "start",
+		SectionIDElement:   "element",
+		SectionIDCode:      "code",
+		SectionIDData:      "data",
+		SectionIDDataCount: "data count",
+		SectionIDTag:       "tag",
 	}[s]
 	if !ok {
 		return "unknown"
@@ -114,6 +121,10 @@ func (e InvalidCodeIndexError) Error() string {
 // ErrUnsupportedSection unsupported section
 var ErrUnsupportedSection = errors.New("wasm: unsupported section")
 
+// ErrSectionSize is returned when the contents of a section don't take the
+// size declared in its header.
+var ErrSectionSize = errors.New("wasm: section size mismatch")
+
 // MissingSectionError missing section error
 type MissingSectionError SectionID
 
@@ -121,36 +132,95 @@ func (e MissingSectionError) Error() string {
 	return fmt.Sprintf("wasm: missing section %s", SectionID(e).String())
 }
 
-// reads a valid section from r. The first return value is true if and only if
-// the module has been completely read.
-func (m *Module) readSection(r *readpos.ReadPos) (bool, error) {
+// sectionOrder is the rank of every non-custom section in a module, whose
+// sections must come in increasing order of rank. The tag and data count
+// sections were added after the others, and don't follow the order of the
+// ids.
+var sectionOrder = map[SectionID]int{
+	SectionIDType:      1,
+	SectionIDImport:    2,
+	SectionIDFunction:  3,
+	SectionIDTable:     4,
+	SectionIDMemory:    5,
+	SectionIDTag:       6,
+	SectionIDGlobal:    7,
+	SectionIDExport:    8,
+	SectionIDStart:     9,
+	SectionIDElement:   10,
+	SectionIDDataCount: 11,
+	SectionIDCode:      12,
+	SectionIDData:      13,
+}
+
+// SectionOrderError is returned when a non-custom section comes after a
+// section it must precede, or after another section with the same id.
+type SectionOrderError struct {
+	ID        SectionID
+	Offset    int64 // the offset of the id of the section in the module
+	Duplicate bool
+}
+
+func (e SectionOrderError) Error() string {
+	if e.Duplicate {
+		return fmt.Sprintf("wasm: duplicate %s section at offset %d", e.ID, e.Offset)
+	}
+	return fmt.Sprintf("wasm: %s section at offset %d out of order", e.ID, e.Offset)
+}
+
+// readSection reads a valid section from r, and returns it, or nil once
+// the module has been completely read. The payload of a section other than
+// a custom one is only kept in its Bytes if keepBytes is set.
+func (m *Module) readSection(r *readpos.ReadPos, keepBytes bool) (*Section, error) {
 	var err error
 	var id uint32
 
+	// the integers of the header are read like the ones of the payload
+	var header io.Reader = r
+	if m.limits.StrictLEB128 {
+		header = leb128.StrictReader{Reader: r}
+	}
+
 	log.Trace("Reading section ID")
-	if id, err = leb128.ReadVarUint32(r); err != nil {
+	offset := r.CurPos
+	if id, err = leb128.ReadVarUint32(header); err != nil {
 		if err == io.EOF { // no bytes were read, the reader is empty
-			return true, nil
+			return nil, nil
 		}
-		return false, err
+		return nil, err
 	}
 	s := Section{ID: SectionID(id)}
+	if rank, ok := sectionOrder[s.ID]; ok {
+		if rank <= m.lastSection {
+			return nil, SectionOrderError{ID: s.ID, Offset: offset, Duplicate: rank == m.lastSection}
+		}
+		m.lastSection = rank
+	}
 
 	log.Trace("Reading payload length")
-	if s.PayloadLen, err = leb128.ReadVarUint32(r); err != nil {
-		return false, nil
+	if s.PayloadLen, err = leb128.ReadVarUint32(header); err != nil {
+		if err == io.EOF { // io.EOF only ends the module between sections
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
 	}
 
 	payloadDataLen := s.PayloadLen
+	if err = checkLimit("module size", uint64(r.CurPos)+uint64(s.PayloadLen), m.limits.MaxModuleSize); err != nil {
+		return nil, err
+	}
 
 	if s.ID == SectionIDCustom {
-		nameLen, nameLenSize, err := leb128.ReadVarUint32Size(r)
+		nameLen, nameLenSize, err := leb128.ReadVarUint32Size(header)
 		if err != nil {
-			return false, err
+			return nil, err
+		}
+		// the name is read before the payload is limited to its length
+		if uint64(nameLenSize)+uint64(nameLen) > uint64(s.PayloadLen) {
+			return nil, io.ErrUnexpectedEOF
 		}
 		payloadDataLen -= uint32(nameLenSize)
 		if s.Name, err = readString(r, int(nameLen)); err != nil {
-			return false, err
+			return nil, err
 		}
 
 		payloadDataLen -= uint32(len(s.Name))
@@ -159,102 +229,113 @@ func (m *Module) readSection(r *readpos.ReadPos) (bool, error) {
 	log.Trace("Section payload length: %d", payloadDataLen)
 
 	s.Start = r.CurPos
+	if err = checkLimit("module size", uint64(s.Start)+uint64(payloadDataLen), m.limits.MaxModuleSize); err != nil {
+		return nil, err
+	}
 
-	sectionBytes := new(bytes.Buffer)
-	sectionBytes.Grow(int(payloadDataLen))
-	sectionReader := io.LimitReader(io.TeeReader(r, sectionBytes), int64(payloadDataLen))
+	var sectionBytes *bytes.Buffer
+	payload := io.Reader(r)
+	if keepBytes || s.ID == SectionIDCustom {
+		sectionBytes = new(bytes.Buffer)
+		sectionBytes.Grow(int(payloadDataLen))
+		payload = io.TeeReader(r, sectionBytes)
+	}
+	sectionReader := strictLike(header, io.LimitReader(payload, int64(payloadDataLen)))
 
+	// the section of the module holding s once read
+	var section *Section
 	switch s.ID {
 	case SectionIDCustom:
 		log.Trace("section custom")
 		if err = m.readSectionCustom(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
 			m.Other = append(m.Other, s)
+			section = &m.Other[len(m.Other)-1]
 		}
 	case SectionIDType:
 		log.Trace("section type")
 		if err = m.readSectionTypes(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
-			m.Types.Section = s
+			section = &m.Types.Section
 		}
 	case SectionIDImport:
 		log.Trace("section import")
 		if err = m.readSectionImports(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
-			m.Import.Section = s
+			section = &m.Import.Section
 		}
 	case SectionIDFunction:
 		log.Trace("section function")
 		if err = m.readSectionFunctions(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
-			m.Function.Section = s
+			section = &m.Function.Section
 		}
 	case SectionIDTable:
 		log.Trace("section table")
 		if err = m.readSectionTables(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
-			m.Table.Section = s
+			section = &m.Table.Section
 		}
 	case SectionIDMemory:
 		log.Trace("section memory")
 		if err = m.readSectionMemories(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
-			m.Memory.Section = s
+			section = &m.Memory.Section
 		}
 	case SectionIDGlobal:
 		log.Trace("section global")
 		if err = m.readSectionGlobals(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
-			m.Global.Section = s
+			section = &m.Global.Section
 		}
 	case SectionIDExport:
 		log.Trace("section export")
 		if err = m.readSectionExports(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
-			m.Export.Section = s
+			section = &m.Export.Section
 		}
 	case SectionIDStart:
 		log.Trace("section start")
 		if err = m.readSectionStart(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
-			m.Start.Section = s
+			section = &m.Start.Section
 		}
 	case SectionIDElement:
 		log.Trace("section element")
 		if err = m.readSectionElements(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
-			m.Elements.Section = s
+			section = &m.Elements.Section
 		}
 	case SectionIDCode:
 		log.Trace("section code")
-		if err = m.readSectionCode(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
-			m.Code.Section = s
+		if err = m.readSectionCode(sectionReader, r, offset); err == nil {
+			section = &m.Code.Section
 		}
 	case SectionIDData:
 		log.Trace("section data")
 		if err = m.readSectionData(sectionReader); err == nil {
-			s.End = r.CurPos
-			s.Bytes = sectionBytes.Bytes()
-			m.Data.Section = s
+			section = &m.Data.Section
+		}
+	case SectionIDDataCount:
+		log.Trace("section data count")
+		if err = m.readSectionDataCount(sectionReader); err == nil {
+			section = &m.DataCount.Section
+		}
+	case SectionIDTag:
+		log.Trace("section tag")
+		if err = m.readSectionTags(sectionReader); err == nil {
+			section = &m.Tag.Section
 		}
 	default:
-		return false, InvalidSectionIDError(s.ID)
+		return nil, InvalidSectionIDError(s.ID)
 	}
-
 	log.Trace(err)
-	return false, err
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.CurPos != s.Start+int64(payloadDataLen) {
+		return nil, ErrSectionSize
+	}
+
+	s.End = r.CurPos
+	if sectionBytes != nil {
+		s.Bytes = sectionBytes.Bytes()
+	}
+	*section = s
+	return section, nil
 }
 
 func (m *Module) readSectionCustom(r io.Reader) error {
@@ -275,15 +356,44 @@ func (m *Module) readSectionTypes(r io.Reader) error {
 		return err
 	}
 
-	s.Entries = make([]FunctionSig, int(count))
+	if err = checkCount(r, count); err != nil {
+		return err
+	}
+	s.Entries = make([]FunctionSig, 0, int(count))
 
-	for i := range s.Entries {
-		if s.Entries[i], err = readFunction(r); err != nil {
+	// the types of a recursion group of the GC proposal are given their
+	// own indices
+	for i := uint32(0); i < count; i++ {
+		form, err := leb128.ReadVarint32(r)
+		if err != nil {
 			return err
 		}
-
+		n := uint32(1)
+		if form == typeRec {
+			if n, err = leb128.ReadVarUint32(r); err != nil {
+				return err
+			}
+			if err = checkCount(r, n); err != nil {
+				return err
+			}
+		}
+		for j := uint32(0); j < n; j++ {
+			if form == typeRec || j > 0 {
+				if form, err = leb128.ReadVarint32(r); err != nil {
+					return err
+				}
+			}
+			sig, err := readFunction(r, form)
+			if err != nil {
+				return err
+			}
+			s.Entries = append(s.Entries, sig)
+		}
 	}
 
+	if err = checkTypeIndices(s.Entries); err != nil {
+		return err
+	}
 	m.Types = s
 
 	return nil
@@ -301,10 +411,16 @@ func (m *Module) readSectionImports(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	if err = checkLimit("imports", uint64(count), m.limits.MaxImports); err != nil {
+		return err
+	}
+	if err = checkCount(r, count); err != nil {
+		return err
+	}
 	s.Entries = make([]ImportEntry, count)
 
 	for i := range s.Entries {
-		s.Entries[i], err = readImportEntry(r)
+		s.Entries[i], err = readImportEntry(r, m.limits.MaxNameLength)
 		if err != nil {
 			return err
 		}
@@ -314,29 +430,28 @@ func (m *Module) readSectionImports(r io.Reader) error {
 	return nil
 }
 
-func readImportEntry(r io.Reader) (ImportEntry, error) {
+// readImportEntry reads an import, whose names can't be longer than
+// maxName bytes, see DecodeLimits.MaxNameLength.
+func readImportEntry(r io.Reader, maxName int) (ImportEntry, error) {
 	i := ImportEntry{}
 
-	modLen, err := leb128.ReadVarUint32(r)
-	if err != nil {
-		return i, err
-	}
-
-	if i.ModuleName, err = readString(r, int(modLen)); err != nil {
+	var err error
+	if i.ModuleName, err = readNameLimit(r, maxName); err != nil {
 		return i, err
 	}
-
-	fieldLen, err := leb128.ReadVarUint32(r)
-	if err != nil {
+	if i.FieldName, err = readNameLimit(r, maxName); err != nil {
 		return i, err
 	}
 
-	if i.FieldName, err = readString(r, int(fieldLen)); err != nil {
-		return i, err
-	}
+	err = readImportDesc(r, &i)
+	return i, err
+}
 
+// readImportDesc reads the kind and the type of the import i.
+func readImportDesc(r io.Reader, i *ImportEntry) error {
+	var err error
 	if i.Kind, err = readExternal(r); err != nil {
-		return i, err
+		return err
 	}
 
 	switch i.Kind {
@@ -368,12 +483,19 @@ func readImportEntry(r io.Reader) (ImportEntry, error) {
 		if gl != nil {
 			i.Type = GlobalVarImport{*gl}
 		}
+	case ExternalTag:
+		log.Trace("importing tag")
+		var tag *TagType
+		tag, err = readTagType(r)
+		if tag != nil {
+			i.Type = TagImport{*tag}
+		}
 
 	default:
-		return i, InvalidExternalError(i.Kind)
+		return InvalidExternalError(i.Kind)
 	}
 
-	return i, err
+	return err
 }
 
 // SectionFunctions declares the signature of all functions defined in the module (in the code section)
@@ -390,6 +512,12 @@ func (m *Module) readSectionFunctions(r io.Reader) error {
 		return err
 	}
 
+	if err = checkLimit("functions", uint64(count), m.limits.MaxFunctions); err != nil {
+		return err
+	}
+	if err = checkCount(r, count); err != nil {
+		return err
+	}
 	s.Types = make([]uint32, count)
 
 	for i := range s.Types {
@@ -397,6 +525,11 @@ func (m *Module) readSectionFunctions(r io.Reader) error {
 		if err != nil {
 			return err
 		}
+		// the types section precedes, so that a stream is rejected as
+		// soon as a function references an unknown type
+		if m.Types == nil || int(t) >= len(m.Types.Entries) {
+			return InvalidTypeIndexError(t)
+		}
 		s.Types[i] = t
 	}
 
@@ -416,6 +549,9 @@ func (m *Module) readSectionTables(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	if err = checkCount(r, count); err != nil {
+		return err
+	}
 	s.Entries = make([]Table, count)
 
 	for i := range s.Entries {
@@ -443,6 +579,9 @@ func (m *Module) readSectionMemories(r io.Reader) error {
 		return err
 	}
 
+	if err = checkCount(r, count); err != nil {
+		return err
+	}
 	s.Entries = make([]Memory, count)
 
 	for i := range s.Entries {
@@ -470,6 +609,12 @@ func (m *Module) readSectionGlobals(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	if err = checkLimit("globals", uint64(count), m.limits.MaxGlobals); err != nil {
+		return err
+	}
+	if err = checkCount(r, count); err != nil {
+		return err
+	}
 	s.Globals = make([]GlobalEntry, count)
 
 	log.Trace("%d global entries\n", count)
@@ -511,13 +656,16 @@ func readGlobalEntry(r io.Reader) (e GlobalEntry, err error) {
 type SectionExports struct {
 	Section
 	Entries map[string]ExportEntry
+	// Names are the names of the entries, in the order of the section
+	Names []string
 }
 
-// DuplicateExportError duplicated export
+// DuplicateExportError is returned when several exports of a module have
+// the same name.
 type DuplicateExportError string
 
 func (e DuplicateExportError) Error() string {
-	return fmt.Sprintf("Duplicate export entry: %s", e)
+	return fmt.Sprintf("wasm: duplicate export %q", string(e))
 }
 
 func (m *Module) readSectionExports(r io.Reader) error {
@@ -526,10 +674,13 @@ func (m *Module) readSectionExports(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	if err = checkCount(r, count); err != nil {
+		return err
+	}
 	s.Entries = make(map[string]ExportEntry, count)
 
 	for i := uint32(0); i < count; i++ {
-		entry, err := readExportEntry(r)
+		entry, err := readExportEntry(r, m.limits.MaxNameLength)
 		if err != nil {
 			return err
 		}
@@ -538,6 +689,7 @@ func (m *Module) readSectionExports(r io.Reader) error {
 			return DuplicateExportError(entry.FieldStr)
 		}
 		s.Entries[entry.FieldStr] = entry
+		s.Names = append(s.Names, entry.FieldStr)
 	}
 
 	m.Export = s
@@ -551,11 +703,12 @@ type ExportEntry struct {
 	Index    uint32
 }
 
-func readExportEntry(r io.Reader) (ExportEntry, error) {
+// readExportEntry reads an export, whose name can't be longer than maxName
+// bytes, see DecodeLimits.MaxNameLength.
+func readExportEntry(r io.Reader, maxName int) (ExportEntry, error) {
 	e := ExportEntry{}
-	fieldLen, err := leb128.ReadVarUint32(r)
-
-	if e.FieldStr, err = readString(r, int(fieldLen)); err != nil {
+	var err error
+	if e.FieldStr, err = readNameLimit(r, maxName); err != nil {
 		return e, err
 	}
 
@@ -599,6 +752,9 @@ func (m *Module) readSectionElements(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	if err = checkCount(r, count); err != nil {
+		return err
+	}
 	s.Entries = make([]ElementSegment, count)
 
 	for i := range s.Entries {
@@ -612,32 +768,109 @@ func (m *Module) readSectionElements(r io.Reader) error {
 	return nil
 }
 
+// SegmentMode tells how the elements or data of a segment are used.
+type SegmentMode uint8
+
+const (
+	// SegmentActive segments are copied into a table or memory when the
+	// module is instantiated.
+	SegmentActive SegmentMode = iota
+	// SegmentPassive segments are copied at runtime by table.init or
+	// memory.init.
+	SegmentPassive
+	// SegmentDeclarative segments only declare the functions referenced
+	// by ref.func.
+	SegmentDeclarative
+)
+
+// InvalidSegmentFlagsError is returned for a segment encoded with unknown
+// flags.
+type InvalidSegmentFlagsError uint32
+
+func (e InvalidSegmentFlagsError) Error() string {
+	return fmt.Sprintf("wasm: invalid segment flags: %#x", uint32(e))
+}
+
 // ElementSegment describes a group of repeated elements that begin at a specified offset
 type ElementSegment struct {
-	Index  uint32 // The index into the global table space, should always be 0 in the MVP.
-	Offset []byte // initializer expression for computing the offset for placing elements, should return an i32 value
-	Elems  []uint32
+	Mode   SegmentMode
+	Index  uint32    // The index into the global table space, should always be 0 in the MVP.
+	Offset []byte    // initializer expression for computing the offset for placing elements, should return an i32 value, nil unless the segment is active
+	Type   ValueType // the reference type of the elements, ValueTypeFuncref unless given by the segment
+	Elems  []uint32  // function indices, or NullRef
+	// Exprs is whether the elements are encoded as initializer
+	// expressions rather than function indices.
+	Exprs bool
 }
 
 func readElementSegment(r io.Reader) (ElementSegment, error) {
-	s := ElementSegment{}
+	s := ElementSegment{Type: ValueTypeFuncref}
 	var err error
 
-	if s.Index, err = leb128.ReadVarUint32(r); err != nil {
+	// the table index of the MVP encoding is reused as flags by the bulk
+	// memory proposal: bit 0 marks passive or declarative segments, bit 1
+	// an explicit table index, or a declarative segment if bit 0 is set,
+	// and bit 2 elements given by initializer expressions
+	flags, err := leb128.ReadVarUint32(r)
+	if err != nil {
 		return s, err
 	}
-	if s.Offset, err = readInitExpr(r); err != nil {
-		return s, err
+	if flags > 7 {
+		return s, InvalidSegmentFlagsError(flags)
+	}
+	s.Exprs = flags&4 != 0
+	switch flags &^ 4 {
+	case 0:
+	case 1:
+		s.Mode = SegmentPassive
+	case 2:
+		if s.Index, err = leb128.ReadVarUint32(r); err != nil {
+			return s, err
+		}
+	case 3:
+		s.Mode = SegmentDeclarative
+	}
+	if s.Mode == SegmentActive {
+		if s.Offset, err = readInitExpr(r); err != nil {
+			return s, err
+		}
+	}
+	switch {
+	case flags&^4 == 0:
+	case s.Exprs:
+		if s.Type, err = ReadValueType(r); err != nil {
+			return s, err
+		}
+		if !s.Type.IsRef() {
+			return s, InvalidSegmentFlagsError(flags)
+		}
+	default:
+		// the kind of the elements, only functions are supported
+		kind, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return s, err
+		}
+		if kind != 0 {
+			return s, InvalidSegmentFlagsError(flags)
+		}
 	}
 
 	numElems, err := leb128.ReadVarUint32(r)
 	if err != nil {
 		return s, err
 	}
+	if err = checkCount(r, numElems); err != nil {
+		return s, err
+	}
 	s.Elems = make([]uint32, numElems)
 
 	for i := range s.Elems {
-		e, err := leb128.ReadVarUint32(r)
+		var e uint32
+		if s.Exprs {
+			e, err = readElemExpr(r)
+		} else {
+			e, err = leb128.ReadVarUint32(r)
+		}
 		if err != nil {
 			return s, err
 		}
@@ -647,28 +880,62 @@ func readElementSegment(r io.Reader) (ElementSegment, error) {
 	return s, nil
 }
 
+// readElemExpr reads an element given by an initializer expression, which
+// must be a ref.func or a ref.null.
+func readElemExpr(r io.Reader) (uint32, error) {
+	expr, err := readInitExpr(r)
+	if err != nil {
+		return 0, err
+	}
+	switch expr[0] {
+	case refFunc:
+		index, err := leb128.ReadVarUint32(bytes.NewReader(expr[1:]))
+		return index, err
+	case refNull:
+		return uint32(NullRef), nil
+	}
+	return 0, InvalidInitExprOpError(expr[0])
+}
+
 // SectionCode describes the body for every function declared inside a module.
 type SectionCode struct {
 	Section
 	Bodies []FunctionBody
 }
 
-func (m *Module) readSectionCode(r io.Reader) error {
+// readSectionCode reads the code section, whose id is at offset in the
+// module, pos being the position of the reader in the module.
+func (m *Module) readSectionCode(r io.Reader, pos *readpos.ReadPos, offset int64) error {
 	s := &SectionCode{}
 
 	count, err := leb128.ReadVarUint32(r)
 	if err != nil {
 		return err
 	}
+	if err = checkLimit("functions", uint64(count), m.limits.MaxFunctions); err != nil {
+		return err
+	}
+	if err = checkCount(r, count); err != nil {
+		return err
+	}
 	s.Bodies = make([]FunctionBody, count)
 	log.Trace("%d function bodies\n", count)
 
 	for i := range s.Bodies {
 		log.Trace("Reading function %d\n", i)
-		if s.Bodies[i], err = readFunctionBody(r); err != nil {
+		body, err := m.readFunctionBody(r)
+		if err != nil {
 			return err
 		}
 		s.Bodies[i].Module = m
+		start := pos.CurPos - int64(len(body))
+		if m.lazyCode {
+			s.Bodies[i].lazy = &lazyBody{raw: body, start: start}
+			continue
+		}
+		if err = s.Bodies[i].decode(body, start); err != nil {
+			return err
+		}
 	}
 
 	m.Code = s
@@ -676,7 +943,7 @@ func (m *Module) readSectionCode(r io.Reader) error {
 		return MissingSectionError(SectionIDFunction)
 	}
 	if len(m.Function.Types) != len(s.Bodies) {
-		return errors.New("The number of entries in the function and code section are unequal")
+		return CountMismatchError{Offset: offset, Functions: len(m.Function.Types), Bodies: len(s.Bodies)}
 	}
 
 	if m.Types == nil {
@@ -686,6 +953,19 @@ func (m *Module) readSectionCode(r io.Reader) error {
 	return nil
 }
 
+// CountMismatchError is returned when the code section doesn't have a body
+// for every function of the function section. Offset is the one of the id
+// of the code section, or the end of the module if it has none.
+type CountMismatchError struct {
+	Offset    int64
+	Functions int
+	Bodies    int
+}
+
+func (e CountMismatchError) Error() string {
+	return fmt.Sprintf("wasm: %d function bodies for %d functions at offset %d", e.Bodies, e.Functions, e.Offset)
+}
+
 // ErrFunctionNoEnd function no end error
 var ErrFunctionNoEnd = errors.New("Function body does not end with 0x0b (end)")
 
@@ -694,48 +974,123 @@ type FunctionBody struct {
 	Module *Module // The parent module containing this function body, for execution purposes
 	Locals []LocalEntry
 	Code   []byte
+	// Offset is the offset of Code in the module, the offsets of the
+	// instructions of the function are counted from it.
+	Offset int64
+
+	// the encoded body, when it is left for Decode to decode
+	lazy *lazyBody
+}
+
+// lazyBody is the encoded locals and code of a function body read by a
+// Decoder with LazyCode.
+type lazyBody struct {
+	once    sync.Once
+	raw     []byte
+	start   int64
+	decoded bool
+	err     error
+}
+
+// Decode decodes the locals and the code of a body read by a Decoder with
+// LazyCode, on its first call, and returns the error decoding them. The
+// bodies decoded as they were read are left alone. Decode is safe for
+// concurrent use, and the Locals and Code of the body must not be read
+// before it returns.
+func (f *FunctionBody) Decode() error {
+	if f == nil || f.lazy == nil {
+		return nil
+	}
+	f.lazy.once.Do(func() {
+		f.lazy.err = f.decode(f.lazy.raw, f.lazy.start)
+		f.lazy.decoded = true
+	})
+	return f.lazy.err
 }
 
-func readFunctionBody(r io.Reader) (FunctionBody, error) {
-	f := FunctionBody{}
+// DecodeCode decodes the function bodies of the module left undecoded by a
+// Decoder with LazyCode, and returns the first error decoding them.
+func (m *Module) DecodeCode() error {
+	if m.Code == nil {
+		return nil
+	}
+	for i := range m.Code.Bodies {
+		if err := m.Code.Bodies[i].Decode(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// readFunctionBody reads the encoded locals and code of a function body,
+// which refer to the bytes of the module read by a NewBytesDecoder.
+func (m *Module) readFunctionBody(r io.Reader) ([]byte, error) {
 	bodySize, err := leb128.ReadVarUint32(r)
 	if err != nil {
-		return f, err
+		return nil, err
 	}
 
+	if err = checkCount(r, bodySize); err != nil {
+		return nil, err
+	}
+	if m.source != nil {
+		start := m.source.pos.CurPos
+		if _, err = io.CopyN(ioutil.Discard, r, int64(bodySize)); err != nil {
+			return nil, err
+		}
+		end := start + int64(bodySize)
+		return m.source.data[start:end:end], nil
+	}
 	body := make([]byte, bodySize)
 
 	if _, err = io.ReadFull(r, body); err != nil {
-		return f, err
+		return nil, err
 	}
+	return body, nil
+}
 
+// decode sets the locals and the code of f from its encoded body, found at
+// offset start in the module, within the limits of its module.
+func (f *FunctionBody) decode(body []byte, start int64) error {
 	bytesReader := bytes.NewBuffer(body)
+	var locals io.Reader = bytesReader
+	if f.Module.limits.StrictLEB128 {
+		locals = leb128.StrictReader{Reader: bytesReader}
+	}
 
-	localCount, err := leb128.ReadVarUint32(bytesReader)
+	localCount, err := leb128.ReadVarUint32(locals)
 	if err != nil {
-		return f, err
+		return err
 	}
-	f.Locals = make([]LocalEntry, localCount)
+	if err = checkCount(bytesReader, localCount); err != nil {
+		return err
+	}
+	entries := make([]LocalEntry, localCount)
 
-	for i := range f.Locals {
-		if f.Locals[i], err = readLocalEntry(bytesReader); err != nil {
-			return f, err
+	var total uint64
+	for i := range entries {
+		if entries[i], err = readLocalEntry(locals); err != nil {
+			return err
 		}
+		total += uint64(entries[i].Count)
+	}
+	if err = checkLimit("locals per function", total, f.Module.limits.MaxLocalsPerFunc); err != nil {
+		return err
 	}
 
-	log.Trace("bodySize: %d, localCount: %d\n", bodySize, localCount)
+	log.Trace("bodySize: %d, localCount: %d\n", len(body), localCount)
 
 	code := bytesReader.Bytes()
 	log.Trace("Read %d bytes for function body", len(code))
 
-	if code[len(code)-1] != end {
-		return f, ErrFunctionNoEnd
+	if len(code) == 0 || code[len(code)-1] != end {
+		return ErrFunctionNoEnd
 	}
 
+	f.Locals = entries
 	f.Code = code[:len(code)-1]
-
-	return f, nil
+	f.Offset = start + int64(len(body)-len(code))
+	return nil
 }
 
 // LocalEntry define the local entry format
@@ -753,7 +1108,7 @@ func readLocalEntry(r io.Reader) (LocalEntry, error) {
 		return l, err
 	}
 
-	l.Type, err = readValueType(r)
+	l.Type, err = ReadValueType(r)
 	if err != nil {
 		return l, err
 	}
@@ -774,6 +1129,12 @@ func (m *Module) readSectionData(r io.Reader) error {
 		return err
 	}
 
+	if err = checkLimit("data segments", uint64(count), m.limits.MaxDataSegments); err != nil {
+		return err
+	}
+	if err = checkCount(r, count); err != nil {
+		return err
+	}
 	s.Entries = make([]DataSegment, count)
 
 	for i := range s.Entries {
@@ -782,14 +1143,73 @@ func (m *Module) readSectionData(r io.Reader) error {
 		}
 	}
 
+	if m.DataCount != nil && m.DataCount.Count != count {
+		return ErrDataCountMismatch
+	}
+
 	m.Data = s
 	return err
 }
 
+// ErrDataCountMismatch is returned when the data section doesn't have the
+// number of segments given by the data count section.
+var ErrDataCountMismatch = errors.New("wasm: data count and data section have inconsistent lengths")
+
+// SectionDataCount declares the number of data segments of a module ahead
+// of its code section.
+type SectionDataCount struct {
+	Section
+	Count uint32
+}
+
+func (m *Module) readSectionDataCount(r io.Reader) error {
+	s := &SectionDataCount{}
+	var err error
+	if s.Count, err = leb128.ReadVarUint32(r); err != nil {
+		return err
+	}
+	if err = checkLimit("data segments", uint64(s.Count), m.limits.MaxDataSegments); err != nil {
+		return err
+	}
+
+	m.DataCount = s
+	return nil
+}
+
+// SectionTags declares the exception tags defined by the module.
+type SectionTags struct {
+	Section
+	Entries []TagType
+}
+
+func (m *Module) readSectionTags(r io.Reader) error {
+	s := &SectionTags{}
+	count, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return err
+	}
+	if err = checkCount(r, count); err != nil {
+		return err
+	}
+	s.Entries = make([]TagType, count)
+
+	for i := range s.Entries {
+		tag, err := readTagType(r)
+		if err != nil {
+			return err
+		}
+		s.Entries[i] = *tag
+	}
+
+	m.Tag = s
+	return nil
+}
+
 // DataSegment describes a group of repeated elements that begin at a specified offset in the linear memory
 type DataSegment struct {
-	Index  uint32 // The index into the global linear memory space, should always be 0 in the MVP.
-	Offset []byte // initializer expression for computing the offset for placing elements, should return an i32 value
+	Mode   SegmentMode // SegmentActive or SegmentPassive
+	Index  uint32      // The index into the global linear memory space, should always be 0 in the MVP.
+	Offset []byte      // initializer expression for computing the offset for placing elements, should return an i32 value, nil for passive segments
 	Data   []byte
 }
 
@@ -797,11 +1217,28 @@ func readDataSegment(r io.Reader) (DataSegment, error) {
 	s := DataSegment{}
 	var err error
 
-	if s.Index, err = leb128.ReadVarUint32(r); err != nil {
+	// the memory index of the MVP encoding is reused as flags by the
+	// bulk memory proposal: 1 marks a passive segment, and 2 an active
+	// segment with an explicit memory index
+	flags, err := leb128.ReadVarUint32(r)
+	if err != nil {
 		return s, err
 	}
-	if s.Offset, err = readInitExpr(r); err != nil {
-		return s, err
+	switch flags {
+	case 0:
+	case 1:
+		s.Mode = SegmentPassive
+	case 2:
+		if s.Index, err = leb128.ReadVarUint32(r); err != nil {
+			return s, err
+		}
+	default:
+		return s, InvalidSegmentFlagsError(flags)
+	}
+	if s.Mode == SegmentActive {
+		if s.Offset, err = readInitExpr(r); err != nil {
+			return s, err
+		}
 	}
 
 	size, err := leb128.ReadVarUint32(r)
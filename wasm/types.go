@@ -22,14 +22,16 @@
 package wasm
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"math"
 
 	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
 )
 
 // ValueType represents the type of a valid value in Wasm
-type ValueType int8
+type ValueType int32
 
 const (
 	// ValueTypeI32 int32 type
@@ -40,19 +42,97 @@ const (
 	ValueTypeF32 ValueType = -0x03
 	// ValueTypeF64 float64 type
 	ValueTypeF64 ValueType = -0x04
+	// ValueTypeV128 128 bits vector type
+	ValueTypeV128 ValueType = -0x05
+	// ValueTypeFuncref function reference type
+	ValueTypeFuncref ValueType = -0x10
+	// ValueTypeExternref host reference type
+	ValueTypeExternref ValueType = -0x11
+	// ValueTypeAnyref is the top type of the internal references of the
+	// GC proposal
+	ValueTypeAnyref ValueType = -0x12
+	// ValueTypeEqref references values comparable with ref.eq
+	ValueTypeEqref ValueType = -0x13
+	// ValueTypeI31ref unboxed 31-bit integer reference type
+	ValueTypeI31ref ValueType = -0x14
+	// ValueTypeStructref reference to any struct type
+	ValueTypeStructref ValueType = -0x15
+	// ValueTypeArrayref reference to any array type
+	ValueTypeArrayref ValueType = -0x16
+	// ValueTypeNullref is the bottom type of anyref, only holding null
+	ValueTypeNullref ValueType = -0x0f
+	// ValueTypeNullexternref is the bottom type of externref
+	ValueTypeNullexternref ValueType = -0x0e
+	// ValueTypeNullfuncref is the bottom type of funcref
+	ValueTypeNullfuncref ValueType = -0x0d
+
+	// ValueTypeI8 is the packed 8-bit storage type of struct and array
+	// fields, read as an i32
+	ValueTypeI8 ValueType = -0x08
+	// ValueTypeI16 is the packed 16-bit storage type of fields
+	ValueTypeI16 ValueType = -0x09
+)
+
+// the prefixes of the value types of the GC proposal followed by a heap
+// type, for nullable and non-nullable references
+const (
+	refNullPrefix = -0x1d
+	refPrefix     = -0x1c
 )
 
 var valueTypeStrMap = map[ValueType]string{
-	ValueTypeI32: "i32",
-	ValueTypeI64: "i64",
-	ValueTypeF32: "f32",
-	ValueTypeF64: "f64",
+	ValueTypeI32:       "i32",
+	ValueTypeI64:       "i64",
+	ValueTypeF32:       "f32",
+	ValueTypeF64:       "f64",
+	ValueTypeV128:      "v128",
+	ValueTypeFuncref:   "funcref",
+	ValueTypeExternref: "externref",
+	ValueTypeAnyref:    "anyref",
+	ValueTypeEqref:     "eqref",
+	ValueTypeI31ref:    "i31ref",
+	ValueTypeStructref: "structref",
+	ValueTypeArrayref:  "arrayref",
+	ValueTypeNullref:   "nullref",
+
+	ValueTypeNullexternref: "nullexternref",
+	ValueTypeNullfuncref:   "nullfuncref",
+	ValueTypeI8:            "i8",
+	ValueTypeI16:           "i16",
+}
+
+// IsRef returns whether t is a reference type. The non-negative value
+// types are references to the type at that index in the types section.
+func (t ValueType) IsRef() bool {
+	return t >= 0 || t <= ValueTypeNullfuncref && t >= ValueTypeArrayref
 }
 
+// Unpacked returns the type of the values of the storage type t once
+// read from a field: i32 for the packed types.
+func (t ValueType) Unpacked() ValueType {
+	if t == ValueTypeI8 || t == ValueTypeI16 {
+		return ValueTypeI32
+	}
+	return t
+}
+
+// Ref is the value of a reference: the index of a function for a funcref,
+// or a handle given by the host for an externref.
+type Ref uint32
+
+// NullRef is the null reference of both reference types.
+const NullRef Ref = math.MaxUint32
+
+// V128 is the value of a v128, its 16 bytes in little endian order.
+type V128 [16]byte
+
 func (t ValueType) String() string {
+	if t >= 0 {
+		return fmt.Sprintf("(ref null %d)", int32(t))
+	}
 	str, ok := valueTypeStrMap[t]
 	if !ok {
-		str = fmt.Sprintf("<unknown value_type %d>", int8(t))
+		str = fmt.Sprintf("<unknown value_type %d>", int32(t))
 	}
 	return str
 }
@@ -60,42 +140,117 @@ func (t ValueType) String() string {
 // TypeFunc represents the value type of a function
 const TypeFunc int = -0x20
 
-func readValueType(r io.Reader) (ValueType, error) {
+// The composite types of the GC proposal defined in the types section
+// along with the function types.
+const (
+	TypeStruct int = -0x21
+	TypeArray  int = -0x22
+)
+
+// ReadValueType reads a value type. The references to a heap type of the
+// GC proposal are read as the abstract reference type of the same code,
+// or as the index of the type they reference, their nullability being
+// ignored.
+func ReadValueType(r io.Reader) (ValueType, error) {
 	v, err := leb128.ReadVarint32(r)
+	if err != nil || v != refNullPrefix && v != refPrefix {
+		return ValueType(v), err
+	}
+	v, err = leb128.ReadVarint32(r)
 	return ValueType(v), err
 }
 
-// BlockType represents the signature of a structured block
-type BlockType ValueType // varint7
+// BlockType represents the signature of a structured block. It is either
+// BlockTypeEmpty, a value type for blocks with a single result, or the
+// non-negative index of a function type in the types section for blocks
+// with parameters or several results.
+type BlockType int32 // varint33
 
 // BlockTypeEmpty block type empty
 const BlockTypeEmpty BlockType = -0x40
 
-func readBlockType(r io.Reader) (BlockType, error) {
+// blockTypeRef is the block type of blocks with a single result
+// referencing the type at index 0, the following indices counting down
+// from it.
+const blockTypeRef BlockType = -0x80
+
+// ReadBlockType reads the block type of a block, loop, if or try
+// operator.
+func ReadBlockType(r io.Reader) (BlockType, error) {
 	b, err := leb128.ReadVarint32(r)
+	if err != nil || b != refNullPrefix && b != refPrefix {
+		return BlockType(b), err
+	}
+	if b, err = leb128.ReadVarint32(r); b >= 0 {
+		return blockTypeRef - BlockType(b), err
+	}
 	return BlockType(b), err
 }
 
+// valueType returns the type of the single result of the blocks of type
+// b, which must be negative.
+func (b BlockType) valueType() ValueType {
+	if b <= blockTypeRef {
+		return ValueType(blockTypeRef - b)
+	}
+	return ValueType(b)
+}
+
 func (b BlockType) String() string {
 	if b == BlockTypeEmpty {
 		return "<empty block>"
 	}
-	return ValueType(b).String()
+	if b >= 0 {
+		return fmt.Sprintf("<block type %d>", int32(b))
+	}
+	return b.valueType().String()
+}
+
+// InvalidTypeIndexError is returned for a reference to a type beyond the
+// types section of a module.
+type InvalidTypeIndexError uint32
+
+func (e InvalidTypeIndexError) Error() string {
+	return fmt.Sprintf("wasm: invalid type index: %d", uint32(e))
+}
+
+// Signature returns the parameter and result types of a block of type b
+// in the module m.
+func (b BlockType) Signature(m *Module) (params, results []ValueType, err error) {
+	switch {
+	case b == BlockTypeEmpty:
+		return nil, nil, nil
+	case b < 0:
+		return nil, []ValueType{b.valueType()}, nil
+	}
+	if m.Types == nil || int(b) >= len(m.Types.Entries) {
+		return nil, nil, InvalidTypeIndexError(b)
+	}
+	sig := &m.Types.Entries[b]
+	return sig.ParamTypes, sig.ReturnTypes, nil
 }
 
 // ElemType describes the type of a table's elements
 type ElemType int // varint7
-// ElemTypeAnyFunc descibres an any_func value
-const ElemTypeAnyFunc ElemType = -0x10
+
+const (
+	// ElemTypeAnyFunc descibres an any_func value
+	ElemTypeAnyFunc ElemType = -0x10
+	// ElemTypeExternRef describes tables of host references
+	ElemTypeExternRef ElemType = -0x11
+)
 
 func readElemType(r io.Reader) (ElemType, error) {
-	b, err := leb128.ReadVarint32(r)
-	return ElemType(b), err
+	t, err := ReadValueType(r)
+	return ElemType(t), err
 }
 
 func (t ElemType) String() string {
-	if t == ElemTypeAnyFunc {
+	switch t {
+	case ElemTypeAnyFunc:
 		return "anyfunc"
+	case ElemTypeExternRef:
+		return "externref"
 	}
 
 	return "<unknown elem_type>"
@@ -103,17 +258,47 @@ func (t ElemType) String() string {
 
 // FunctionSig describes the signature of a declared function in a WASM module
 type FunctionSig struct {
-	// value for the 'func` type constructor
+	// value for the 'func` type constructor, or TypeStruct or TypeArray
+	// for the composite types of the GC proposal
 	Form int8
 	// The parameter types of the function
 	ParamTypes  []ValueType
 	ReturnTypes []ValueType
+	// Fields are the fields of a struct type, or the single element type
+	// of an array type
+	Fields []FieldType
+	// Supertypes are the indices of the types a subtype declaration
+	// extends
+	Supertypes []uint32
+}
+
+// FieldType is the type of a field of a struct, or of the elements of an
+// array.
+type FieldType struct {
+	Type    ValueType // a value type, or the packed ValueTypeI8 or ValueTypeI16
+	Mutable bool
 }
 
 func (f FunctionSig) String() string {
+	switch {
+	case f.IsStruct():
+		return fmt.Sprintf("<struct %v>", f.Fields)
+	case f.IsArray():
+		return fmt.Sprintf("<array %v>", f.Fields[0])
+	}
 	return fmt.Sprintf("<func %v -> %v>", f.ParamTypes, f.ReturnTypes)
 }
 
+// IsStruct returns whether f is a struct type.
+func (f FunctionSig) IsStruct() bool {
+	return int(f.Form) == TypeStruct
+}
+
+// IsArray returns whether f is an array type.
+func (f FunctionSig) IsArray() bool {
+	return int(f.Form) == TypeArray
+}
+
 // InvalidTypeConstructorError invalid type contructor
 type InvalidTypeConstructorError struct {
 	Wanted int
@@ -124,24 +309,71 @@ func (e InvalidTypeConstructorError) Error() string {
 	return fmt.Sprintf("wasm: invalid type constructor: wanted %d, got %d", e.Wanted, e.Got)
 }
 
-func readFunction(r io.Reader) (FunctionSig, error) {
+// ErrFieldTypeV128 is returned for the struct and array types with v128
+// fields, which aren't supported.
+var ErrFieldTypeV128 = errors.New("wasm: v128 fields are not supported")
+
+// the codes introducing the subtype declarations and the recursion groups
+// of the GC proposal
+const (
+	typeSub      = -0x30
+	typeSubFinal = -0x31
+	typeRec      = -0x32
+)
+
+// readFunction reads a type of the types section introduced by form,
+// after the optional subtype declaration.
+func readFunction(r io.Reader, form int32) (FunctionSig, error) {
 	f := FunctionSig{}
 
-	form, err := leb128.ReadVarint32(r)
-	if err != nil {
-		return f, err
+	var err error
+	if form == typeSub || form == typeSubFinal {
+		if f.Supertypes, err = readIndices(r); err != nil {
+			return f, err
+		}
+		if form, err = leb128.ReadVarint32(r); err != nil {
+			return f, err
+		}
 	}
 
 	f.Form = int8(form)
 
+	switch int(form) {
+	case TypeFunc:
+	case TypeStruct:
+		n, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return f, err
+		}
+		if err = checkCount(r, n); err != nil {
+			return f, err
+		}
+		f.Fields = make([]FieldType, n)
+		for i := range f.Fields {
+			if f.Fields[i], err = readFieldType(r); err != nil {
+				return f, err
+			}
+		}
+		return f, nil
+	case TypeArray:
+		field, err := readFieldType(r)
+		f.Fields = []FieldType{field}
+		return f, err
+	default:
+		return f, InvalidTypeConstructorError{TypeFunc, int(form)}
+	}
+
 	paramCount, err := leb128.ReadVarUint32(r)
 	if err != nil {
 		return f, err
 	}
+	if err = checkCount(r, paramCount); err != nil {
+		return f, err
+	}
 	f.ParamTypes = make([]ValueType, paramCount)
 
 	for i := range f.ParamTypes {
-		f.ParamTypes[i], err = readValueType(r)
+		f.ParamTypes[i], err = ReadValueType(r)
 		if err != nil {
 			return f, err
 		}
@@ -151,10 +383,12 @@ func readFunction(r io.Reader) (FunctionSig, error) {
 	if err != nil {
 		return f, err
 	}
-
+	if err = checkCount(r, returnCount); err != nil {
+		return f, err
+	}
 	f.ReturnTypes = make([]ValueType, returnCount)
 	for i := range f.ReturnTypes {
-		vt, err := readValueType(r)
+		vt, err := ReadValueType(r)
 		if err != nil {
 			return f, err
 		}
@@ -164,6 +398,37 @@ func readFunction(r io.Reader) (FunctionSig, error) {
 	return f, nil
 }
 
+func readFieldType(r io.Reader) (FieldType, error) {
+	var f FieldType
+	var err error
+	if f.Type, err = ReadValueType(r); err != nil {
+		return f, err
+	}
+	if f.Type == ValueTypeV128 {
+		return f, ErrFieldTypeV128
+	}
+	m, err := leb128.ReadVarUint32(r)
+	f.Mutable = m == 1
+	return f, err
+}
+
+func readIndices(r io.Reader) ([]uint32, error) {
+	n, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkCount(r, n); err != nil {
+		return nil, err
+	}
+	indices := make([]uint32, n)
+	for i := range indices {
+		if indices[i], err = leb128.ReadVarUint32(r); err != nil {
+			return nil, err
+		}
+	}
+	return indices, nil
+}
+
 // GlobalVar describes the type and mutability of a declared global variable
 type GlobalVar struct {
 	Type    ValueType // Type of the value stored by the variable
@@ -174,7 +439,7 @@ func readGlobalVar(r io.Reader) (*GlobalVar, error) {
 	g := &GlobalVar{}
 	var err error
 
-	g.Type, err = readValueType(r)
+	g.Type, err = ReadValueType(r)
 	if err != nil {
 		return nil, err
 	}
@@ -219,15 +484,53 @@ type Memory struct {
 	Limits ResizableLimits
 }
 
+// ErrSharedMemoryNoMaximum is returned for a shared memory declared
+// without a maximum size.
+var ErrSharedMemoryNoMaximum = errors.New("wasm: shared memory must have a maximum size")
+
 func readMemory(r io.Reader) (*Memory, error) {
 	lim, err := readResizableLimits(r)
 	if err != nil {
 		return nil, err
 	}
+	if lim.Shared() && lim.Flags&0x1 == 0 {
+		return nil, ErrSharedMemoryNoMaximum
+	}
 
 	return &Memory{*lim}, nil
 }
 
+// TagAttributeException is the attribute of the tags of exceptions, the
+// only ones defined by the exception handling proposal.
+const TagAttributeException uint8 = 0
+
+// ErrInvalidTagAttribute is returned for a tag whose attribute isn't
+// TagAttributeException.
+var ErrInvalidTagAttribute = errors.New("wasm: invalid tag attribute")
+
+// TagType describes an exception tag: the values of the exceptions thrown
+// with the tag are the parameters of the function signature at the type
+// index Type, which has no results.
+type TagType struct {
+	Attribute uint8
+	Type      uint32
+}
+
+func readTagType(r io.Reader) (*TagType, error) {
+	attribute, err := readBytes(r, 1)
+	if err != nil {
+		return nil, err
+	}
+	if attribute[0] != TagAttributeException {
+		return nil, ErrInvalidTagAttribute
+	}
+	index, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	return &TagType{Attribute: attribute[0], Type: index}, nil
+}
+
 // External describes the kind of the entry being imported or exported.
 type External uint8
 
@@ -240,6 +543,8 @@ const (
 	ExternalMemory External = 2
 	// ExternalGlobal external global type
 	ExternalGlobal External = 3
+	// ExternalTag external exception tag type
+	ExternalTag External = 4
 )
 
 func (e External) String() string {
@@ -252,23 +557,65 @@ func (e External) String() string {
 		return "memory"
 	case ExternalGlobal:
 		return "global"
+	case ExternalTag:
+		return "tag"
 	default:
 		return "<unknown external_kind>"
 	}
 }
 func readExternal(r io.Reader) (External, error) {
 	bytes, err := readBytes(r, 1)
-
-	return External(bytes[0]), err
+	if err != nil {
+		return 0, err
+	}
+	return External(bytes[0]), nil
 }
 
 // ResizableLimits describe the limit of a table or linear memory.
 type ResizableLimits struct {
-	Flags   uint32 // 1 if the Maximum field is valid
+	Flags   uint32 // bit 0 if the Maximum field is valid, bit 1 for a shared memory, bit 2 for a 64-bit memory, bit 3 for a custom page size
 	Initial uint32 // initial length (in units of table elements or wasm pages)
 	Maximum uint32 // If flags is 1, it describes the maximum size of the table or memory
+
+	// PageSizeLog2 is the log2 of the page size of a memory with bit 3 of
+	// Flags set, as defined by the custom-page-sizes proposal.
+	PageSizeLog2 uint32
 }
 
+// Shared returns whether the limits are the ones of a memory shared
+// between threads, as defined by the threads proposal.
+func (l ResizableLimits) Shared() bool {
+	return l.Flags&0x2 != 0
+}
+
+// Memory64 returns whether the limits are the ones of a memory indexed by
+// i64 addresses, as defined by the memory64 proposal.
+func (l ResizableLimits) Memory64() bool {
+	return l.Flags&0x4 != 0
+}
+
+// PageSize returns the size in bytes of the pages of a memory with the
+// limits, 64 KiB unless the memory declares a custom page size.
+func (l ResizableLimits) PageSize() int {
+	if l.Flags&0x8 == 0 {
+		return 65536
+	}
+	return 1 << l.PageSizeLog2
+}
+
+// InvalidPageSizeError is returned for a memory declaring a custom page size
+// other than 1 byte or 64 KiB, the only ones the proposal allows.
+type InvalidPageSizeError uint32
+
+func (e InvalidPageSizeError) Error() string {
+	return fmt.Sprintf("wasm: invalid page size: 2^%d", uint32(e))
+}
+
+// ErrLimitTooLarge is returned for the limits of a 64-bit memory whose
+// initial size doesn't fit in 32 bits. Such a memory, of 256 TiB or more,
+// couldn't be allocated anyway.
+var ErrLimitTooLarge = errors.New("wasm: memory limit too large")
+
 func readResizableLimits(r io.Reader) (*ResizableLimits, error) {
 	lim := &ResizableLimits{
 		Maximum: 0,
@@ -279,6 +626,12 @@ func readResizableLimits(r io.Reader) (*ResizableLimits, error) {
 	}
 
 	lim.Flags = f
+	if lim.Memory64() {
+		if _, err = readLimits64(r, lim); err != nil {
+			return nil, err
+		}
+		return readPageSize(r, lim)
+	}
 	lim.Initial, err = leb128.ReadVarUint32(r)
 	if err != nil {
 		return nil, err
@@ -292,5 +645,48 @@ func readResizableLimits(r io.Reader) (*ResizableLimits, error) {
 		lim.Maximum = m
 
 	}
+	return readPageSize(r, lim)
+}
+
+// readPageSize reads the log2 of the page size following the limits of a
+// memory with a custom page size.
+func readPageSize(r io.Reader, lim *ResizableLimits) (*ResizableLimits, error) {
+	if lim.Flags&0x8 == 0 {
+		return lim, nil
+	}
+	log2, err := leb128.ReadVarUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if log2 != 0 && log2 != 16 {
+		return nil, InvalidPageSizeError(log2)
+	}
+	lim.PageSizeLog2 = log2
+	return lim, nil
+}
+
+// readLimits64 reads the sizes of the limits of a 64-bit memory, which are
+// encoded as u64. A maximum past 32 bits is lowered to the largest one,
+// which the memory can't reach anyway.
+func readLimits64(r io.Reader, lim *ResizableLimits) (*ResizableLimits, error) {
+	initial, err := leb128.ReadVarUint64(r)
+	if err != nil {
+		return nil, err
+	}
+	if initial > math.MaxUint32 {
+		return nil, ErrLimitTooLarge
+	}
+	lim.Initial = uint32(initial)
+
+	if lim.Flags&0x1 != 0 {
+		m, err := leb128.ReadVarUint64(r)
+		if err != nil {
+			return nil, err
+		}
+		if m > math.MaxUint32 {
+			m = math.MaxUint32
+		}
+		lim.Maximum = uint32(m)
+	}
 	return lim, nil
 }
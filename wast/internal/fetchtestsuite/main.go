@@ -0,0 +1,161 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Command fetchtestsuite downloads the scripts of the spec testsuite at
+// the revision pinned in a file to a directory, for TestSpecTestsuite. It
+// is run by go generate in the wast package:
+//
+//	go generate ./wast
+//	go test ./wast -run TestSpecTestsuite
+//
+// The revision file holds the hash of a commit of
+// https://github.com/WebAssembly/testsuite. If it doesn't exist, the
+// commit at the head of its main branch is fetched and written to it, to
+// be checked in: updating the testsuite is then removing the file.
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const repo = "WebAssembly/testsuite"
+
+func main() {
+	revFile := flag.String("rev", "testsuite.rev", "the file holding the revision of the testsuite")
+	out := flag.String("o", "testsuite", "the directory the scripts are written to")
+	flag.Parse()
+
+	if err := run(*revFile, *out); err != nil {
+		fmt.Fprintf(os.Stderr, "fetchtestsuite: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(revFile, out string) error {
+	rev, err := revision(revFile)
+	if err != nil {
+		return err
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(out, ".rev")); err == nil && string(b) == rev {
+		return nil
+	}
+	if err := os.RemoveAll(out); err != nil {
+		return err
+	}
+	body, err := get("https://codeload.github.com/" + repo + "/tar.gz/" + rev)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := extract(body, out); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(out, ".rev"), []byte(rev), 0644)
+}
+
+// revision returns the revision in revFile, pinning the head of the main
+// branch in it if it doesn't exist.
+func revision(revFile string) (string, error) {
+	b, err := ioutil.ReadFile(revFile)
+	if err == nil {
+		rev := strings.TrimSpace(string(b))
+		if len(rev) != 40 {
+			return "", fmt.Errorf("%s: %q isn't the hash of a commit", revFile, rev)
+		}
+		return rev, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	body, err := get("https://api.github.com/repos/" + repo + "/commits/main")
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	var rev string
+	if _, err := fmt.Fscanf(body, "%40s", &rev); err != nil || len(rev) != 40 {
+		return "", fmt.Errorf("can't read the head of %s", repo)
+	}
+	return rev, ioutil.WriteFile(revFile, []byte(rev+"\n"), 0644)
+}
+
+// get returns the body of the response to a GET of url, which must be
+// successful. The commit of the GitHub API is asked as its bare hash.
+func get(url string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.sha")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// extract writes the .wast files of the gzipped tarball r to out, without
+// the directory at the root of the tarball.
+func extract(r io.Reader, out string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || path.Ext(hdr.Name) != ".wast" {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		i := strings.IndexByte(name, '/')
+		if i < 0 || strings.HasPrefix(name, "../") {
+			continue
+		}
+		file := filepath.Join(out, filepath.FromSlash(name[i+1:]))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(file, b, 0644); err != nil {
+			return err
+		}
+	}
+}
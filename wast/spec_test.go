@@ -0,0 +1,115 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wast
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+)
+
+//go:generate go run ./internal/fetchtestsuite -rev testdata/testsuite.rev -o testdata/testsuite
+
+// specSkips are the scripts of the spec testsuite, or the directories of
+// its proposals, which the VM doesn't pass, with the reason why. They
+// still run, and fail if they pass: the entry is then stale.
+var specSkips = map[string]string{
+	"proposals/annotations":     "the (@...) annotations of the text format aren't parsed",
+	"proposals/branch-hinting":  "the (@metadata.code.branch_hint ...) annotations aren't parsed",
+	"proposals/wide-arithmetic": "i64.add128, i64.sub128 and the wide multiplications aren't implemented",
+}
+
+// TestSpecTestsuite runs the scripts of the spec testsuite fetched by go
+// generate into testdata/testsuite, at the revision pinned in
+// testdata/testsuite.rev, or else cloned from
+// https://github.com/WebAssembly/testsuite in the directory given by the
+// WASM_TESTSUITE environment variable:
+//
+//	go generate ./wast
+//	go test ./wast -run TestSpecTestsuite
+//
+// Every script is a subtest named after its path in the testsuite, the
+// ones of specSkips being skipped when they fail.
+func TestSpecTestsuite(t *testing.T) {
+	dir := os.Getenv("WASM_TESTSUITE")
+	if dir == "" {
+		dir = filepath.Join("testdata", "testsuite")
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			t.Skip("no testsuite, run go generate or set WASM_TESTSUITE")
+		}
+	}
+	var scripts []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && strings.HasPrefix(info.Name(), ".") && path != dir {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".wast") {
+			name, _ := filepath.Rel(dir, path)
+			scripts = append(scripts, filepath.ToSlash(name))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) == 0 {
+		t.Fatalf("no script in %s", dir)
+	}
+
+	for _, name := range scripts {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			src, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			failures, err := Run(src, exec.VMConfig{})
+			if reason, ok := skipped(name); ok {
+				if err == nil && len(failures) == 0 {
+					t.Fatalf("skipped because %s, but passes", reason)
+				}
+				t.Skip(reason)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range failures {
+				t.Error(f)
+			}
+		})
+	}
+}
+
+// skipped returns the reason why the script name is in specSkips, by
+// itself or through one of its directories.
+func skipped(name string) (string, bool) {
+	for p := name; p != "."; p = path.Dir(p) {
+		if reason, ok := specSkips[p]; ok {
+			return reason, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,77 @@
+;; the commands of the scripts, with the values of every type
+
+(module $math
+  (global $count (export "count") (mut i32) (i32.const 0))
+  (func (export "div") (param i32 i32) (result i32)
+    (global.set $count (i32.add (global.get $count) (i32.const 1)))
+    (i32.div_s (local.get 0) (local.get 1)))
+  (func (export "wide") (param i64) (result i64 i64)
+    (i64.mul (local.get 0) (i64.const 2))
+    (i64.const -1))
+  (func (export "half") (param f32 f64) (result f32 f64)
+    (f32.div (local.get 0) (f32.const 2))
+    (f64.div (local.get 1) (f64.const 2)))
+  (func (export "nan") (result f32 f64)
+    (f32.div (f32.const 0) (f32.const 0))
+    (f64.sqrt (f64.const -1)))
+  (func (export "swap") (param v128) (result v128)
+    (i8x16.shuffle 8 9 10 11 12 13 14 15 0 1 2 3 4 5 6 7 (local.get 0) (local.get 0)))
+  (func (export "id") (param externref) (result externref)
+    (local.get 0)))
+
+(assert_return (invoke "div" (i32.const 7) (i32.const 2)) (i32.const 3))
+(assert_return (invoke "div" (i32.const -7) (i32.const 2)) (i32.const -3))
+(assert_return (get "count") (i32.const 2))
+(assert_trap (invoke "div" (i32.const 1) (i32.const 0)) "integer divide by zero")
+(assert_return (invoke "wide" (i64.const 0x4000_0000_0000)) (i64.const 0x8000_0000_0000) (i64.const -1))
+(assert_return (invoke "half" (f32.const 3) (f64.const -0x1p-1)) (f32.const 1.5) (f64.const -0.25))
+(assert_return (invoke "nan") (f32.const nan:canonical) (f64.const nan:arithmetic))
+(assert_return (invoke "swap" (v128.const i64x2 1 2)) (v128.const i64x2 2 1))
+(assert_return (invoke "id" (ref.extern 7)) (ref.extern 7))
+(assert_return (invoke "id" (ref.null extern)) (ref.null extern))
+(invoke "div" (i32.const 1) (i32.const 1))
+(assert_return (get $math "count") (i32.const 4))
+
+;; the modules importing from a registered module, or from spectest
+(module $lib
+  (func (export "sub") (param i32 i32) (result i32)
+    (i32.sub (local.get 0) (local.get 1))))
+(register "lib")
+(module
+  (import "lib" "sub" (func $sub (param i32 i32) (result i32)))
+  (import "spectest" "global_i32" (global $g i32))
+  (import "spectest" "print_i32" (func $print (param i32)))
+  (func (export "sub-g") (param i32) (result i32)
+    (call $print (local.get 0))
+    (call $sub (global.get $g) (local.get 0))))
+(assert_return (invoke "sub-g" (i32.const 6)) (i32.const 660))
+(assert_return (invoke $math "div" (i32.const 9) (i32.const 3)) (i32.const 3))
+(assert_return (invoke $lib "sub" (i32.const 9) (i32.const 3)) (i32.const 6))
+
+;; the modules trapping in their start function
+(assert_trap
+  (module
+    (memory 1)
+    (func $start (drop (i32.load (i32.const 65536))))
+    (start $start))
+  "out of bounds memory access")
+
+;; the modules which don't validate, or reference unknown entries
+(assert_invalid (module (func (result i32))) "type mismatch")
+(assert_invalid (module (func (result i32) (i64.const 1))) "type mismatch")
+(assert_invalid (module (func (call $missing))) "unknown function")
+(assert_invalid (module binary "\00asm" "\01\00\00\00" "\01\05\01\60\00\01\7f" "\03\02\01\00" "\0a\04\01\02\00\0b") "type mismatch")
+
+;; the modules which can't be decoded or linked
+(assert_malformed (module quote "(func (i32.const))") "unexpected token")
+(assert_malformed (module binary "\00asn" "\01\00\00\00") "magic header not detected")
+(assert_malformed (module binary "\00asm" "\01\00\00\00" "\01") "unexpected end")
+(assert_unlinkable (module (import "spectest" "missing" (func))) "unknown import")
+
+;; the calls exhausting the call stack
+(module
+  (func $loop (export "loop") (call $loop))
+  (func (export "lanes") (result v128)
+    (f32x4.div (v128.const f32x4 0 1 0 4) (v128.const f32x4 0 2 0 2))))
+(assert_exhaustion (invoke "loop") "call stack exhausted")
+(assert_return (invoke "lanes") (v128.const f32x4 nan:canonical 0.5 nan:arithmetic 2))
@@ -0,0 +1,458 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package wast runs the scripts of the spec tests, in the .wast format,
+// for the conformance and regression tests of the VM to be written like
+// the spec ones:
+//
+//	(module $m
+//	  (func (export "div") (param i32 i32) (result i32)
+//	    (i32.div_s (local.get 0) (local.get 1))))
+//	(assert_return (invoke "div" (i32.const 7) (i32.const 2)) (i32.const 3))
+//	(assert_trap (invoke "div" (i32.const 1) (i32.const 0)) "integer divide by zero")
+//	(assert_invalid (module (func (result i32))) "type mismatch")
+//	(register "m" $m)
+//
+// The commands are parsed by wat.ParseScript. The modules importing from
+// the registered ones are linked by wasm.ReadModule, which copies the
+// imported entries instead of sharing them with the instance exporting
+// them. The spectest module of the spec tests, with its print functions,
+// globals, table and memory, is registered in every script.
+//
+// The messages of the assert commands are not compared with the errors of
+// the VM, which words them differently: the commands only need the action
+// or the instantiation to fail, and the module to be rejected.
+package wast
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/bottos-project/bottos/vm/wasm/disasm"
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/validate"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wat"
+)
+
+// spectest is the module the spec tests import from.
+const spectest = `(module
+  (global (export "global_i32") i32 (i32.const 666))
+  (global (export "global_i64") i64 (i64.const 666))
+  (global (export "global_f32") f32 (f32.const 666.6))
+  (global (export "global_f64") f64 (f64.const 666.6))
+  (table (export "table") 10 20 funcref)
+  (memory (export "memory") 1 2)
+  (func (export "print"))
+  (func (export "print_i32") (param i32))
+  (func (export "print_i64") (param i64))
+  (func (export "print_f32") (param f32))
+  (func (export "print_f64") (param f64))
+  (func (export "print_i32_f32") (param i32 f32))
+  (func (export "print_f64_f64") (param f64 f64)))`
+
+// Failure is a command of a script which failed.
+type Failure struct {
+	Line    int
+	Command string
+	Msg     string
+}
+
+func (f Failure) Error() string {
+	return fmt.Sprintf("wast: %d: %s: %s", f.Line, f.Command, f.Msg)
+}
+
+// Run runs the commands of the script src with VMs using config, and
+// returns the ones which failed, in their order. The error is the one of
+// a script which can't be parsed, none of its commands running then.
+func Run(src []byte, config exec.VMConfig) ([]Failure, error) {
+	script, err := wat.ParseScript(src)
+	if err != nil {
+		return nil, err
+	}
+	code, err := wat.Assemble([]byte(spectest))
+	if err != nil {
+		return nil, err
+	}
+	module, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &runner{
+		config:     config,
+		registered: map[string]*wasm.Module{"spectest": module},
+		named:      make(map[string]*instance),
+	}
+	var failures []Failure
+	for i := range script.Commands {
+		command := &script.Commands[i]
+		if err := r.run(command); err != nil {
+			failures = append(failures, Failure{Line: command.Line, Command: command.Kind, Msg: err.Error()})
+		}
+	}
+	return failures, nil
+}
+
+// instance is an instance of a module of a script.
+type instance struct {
+	module *wasm.Module
+	vm     *exec.VM
+}
+
+// runner runs the commands of a script.
+type runner struct {
+	config exec.VMConfig
+	// the modules the others can import from, by the name they are
+	// registered under
+	registered map[string]*wasm.Module
+	// the instances of the modules with an identifier, and the last one
+	named map[string]*instance
+	last  *instance
+}
+
+// run runs command, returning why it failed, if it did.
+func (r *runner) run(command *wat.Command) error {
+	switch command.Kind {
+	case wat.CommandModule:
+		inst, err := r.instantiate(command.Module)
+		r.last = inst
+		if command.ID != "" {
+			r.named[command.ID] = inst
+		}
+		return err
+	case wat.CommandRegister:
+		inst, err := r.instance(command.ID)
+		if err != nil {
+			return err
+		}
+		r.registered[command.Name] = inst.module
+	case wat.CommandAction:
+		a, err := r.action(command.Action)
+		if err != nil {
+			return err
+		}
+		_, err = a.run()
+		return err
+	case wat.CommandAssertReturn:
+		a, err := r.action(command.Action)
+		if err != nil {
+			return err
+		}
+		results, err := a.run()
+		if err != nil {
+			return err
+		}
+		return a.check(results, command.Results)
+	case wat.CommandAssertTrap:
+		if command.Action == nil {
+			if _, err := r.instantiate(command.Module); err == nil {
+				return fmt.Errorf("the module didn't trap, expected %q", command.Message)
+			}
+			return nil
+		}
+		a, err := r.action(command.Action)
+		if err != nil {
+			return err
+		}
+		if results, err := a.run(); err == nil {
+			return fmt.Errorf("%s returned %s, expected a trap with %q", a, a.format(results), command.Message)
+		}
+	case wat.CommandAssertUnlinkable:
+		if _, err := r.instantiate(command.Module); err == nil {
+			return fmt.Errorf("the module linked, expected %q", command.Message)
+		}
+	case wat.CommandAssertExhaustion:
+		a, err := r.action(command.Action)
+		if err != nil {
+			return err
+		}
+		if results, err := a.run(); err == nil {
+			return fmt.Errorf("%s returned %s, expected %q", a, a.format(results), command.Message)
+		}
+	case wat.CommandAssertMalformed:
+		if command.ModuleErr != nil {
+			return nil
+		}
+		if _, err := wasm.ReadModule(bytes.NewReader(command.Module), r.resolve); err == nil {
+			return fmt.Errorf("the module is well-formed, expected %q", command.Message)
+		}
+	case wat.CommandAssertInvalid:
+		if command.ModuleErr != nil {
+			return nil
+		}
+		module, err := wasm.ReadModule(bytes.NewReader(command.Module), r.resolve)
+		if err == nil && validate.VerifyModule(module) == nil {
+			return fmt.Errorf("the module is valid, expected %q", command.Message)
+		}
+	default:
+		return fmt.Errorf("unsupported command")
+	}
+	return nil
+}
+
+// resolve resolves the modules imported from the registered ones.
+func (r *runner) resolve(name string) (*wasm.Module, error) {
+	module, ok := r.registered[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown module %q", name)
+	}
+	return module, nil
+}
+
+// instantiate reads, validates and instantiates the module code, whose
+// start function runs, if any. It returns the error, or the trap, failing
+// it.
+func (r *runner) instantiate(code []byte) (inst *instance, err error) {
+	module, err := wasm.ReadModule(bytes.NewReader(code), r.resolve)
+	if err != nil {
+		return nil, err
+	}
+	defer exec.RecoverTrap(&err)
+	vm, err := exec.NewVMWithConfig(module, r.config)
+	if err != nil {
+		return nil, err
+	}
+	return &instance{module: module, vm: vm}, nil
+}
+
+// instance returns the instance with the identifier id, the last one if
+// empty.
+func (r *runner) instance(id string) (*instance, error) {
+	inst := r.last
+	if id != "" {
+		inst = r.named[id]
+	}
+	if inst == nil {
+		if id != "" {
+			return nil, fmt.Errorf("no module %s", id)
+		}
+		return nil, fmt.Errorf("no module")
+	}
+	return inst, nil
+}
+
+// action is an action of a script resolved to the entry exported by the
+// instance it runs on.
+type action struct {
+	*wat.Action
+	inst  *instance
+	index uint32
+	// the arguments and the types of the results
+	args  []uint64
+	types []wasm.ValueType
+}
+
+// action resolves a.
+func (r *runner) action(a *wat.Action) (*action, error) {
+	inst, err := r.instance(a.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := &action{Action: a, inst: inst}
+	kind := wasm.ExternalGlobal
+	if a.Invoke {
+		kind = wasm.ExternalFunction
+	}
+	var export wasm.ExportEntry
+	ok := false
+	if inst.module.Export != nil {
+		export, ok = inst.module.Export.Entries[a.Field]
+	}
+	if !ok || export.Kind != kind {
+		return nil, fmt.Errorf("no exported %s %q", kind, a.Field)
+	}
+	res.index = export.Index
+
+	if !a.Invoke {
+		res.types = []wasm.ValueType{inst.module.GetGlobal(int(export.Index)).Type.Type}
+		return res, nil
+	}
+	sig := inst.module.GetFunction(int(export.Index)).Sig
+	if len(a.Args) != len(sig.ParamTypes) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", res, len(sig.ParamTypes), len(a.Args))
+	}
+	for i, arg := range a.Args {
+		if arg.Type != sig.ParamTypes[i] {
+			return nil, fmt.Errorf("argument %d of %s is a %v, not a %v", i, res, sig.ParamTypes[i], arg.Type)
+		}
+		switch {
+		case arg.Type == wasm.ValueTypeV128:
+			res.args = append(res.args, arg.Bits, arg.High)
+		case arg.Type == wasm.ValueTypeExternref && arg.Bits != uint64(wasm.NullRef):
+			res.args = append(res.args, inst.vm.ExternRef(arg.Bits))
+		default:
+			res.args = append(res.args, arg.Bits)
+		}
+	}
+	res.types = sig.ReturnTypes
+	return res, nil
+}
+
+func (a *action) String() string {
+	if a.Invoke {
+		return "invoke " + a.Field
+	}
+	return "get " + a.Field
+}
+
+// run runs a, and returns its results, or the error or trap failing it.
+func (a *action) run() (results []uint64, err error) {
+	vm := a.inst.vm
+	if !a.Invoke {
+		slot := disasm.GlobalSlots(a.inst.module)[a.index]
+		results = append(results, vm.Globals()[slot])
+		if a.types[0] == wasm.ValueTypeV128 {
+			results = append(results, vm.Globals()[slot+1])
+		}
+		return results, nil
+	}
+	defer exec.RecoverTrap(&err)
+	return vm.ExecCodeValues(int64(a.index), a.args...)
+}
+
+// check returns an error if the results of a don't match the expected
+// ones.
+func (a *action) check(results []uint64, expected []wat.Value) error {
+	if len(expected) != len(a.types) {
+		return fmt.Errorf("%s returns %d results, expected %d", a, len(a.types), len(expected))
+	}
+	values := results
+	for i, t := range a.types {
+		if expected[i].Type != t {
+			return fmt.Errorf("result %d of %s is a %v, expected a %v", i, a, t, expected[i].Type)
+		}
+		if !a.matches(values, expected[i]) {
+			return fmt.Errorf("%s returned %s, expected %s", a, a.format(results), formatValues(expected))
+		}
+		values = values[disasm.Slots(t):]
+	}
+	return nil
+}
+
+// matches returns whether the value at the start of values matches want.
+func (a *action) matches(values []uint64, want wat.Value) bool {
+	got := values[0]
+	switch want.Type {
+	case wasm.ValueTypeI32:
+		return uint32(got) == uint32(want.Bits)
+	case wasm.ValueTypeF32:
+		switch want.NaN {
+		case "canonical":
+			return uint32(got)&^(1<<31) == 0x7fc00000
+		case "arithmetic":
+			return uint32(got)&0x7fc00000 == 0x7fc00000
+		}
+		return uint32(got) == uint32(want.Bits)
+	case wasm.ValueTypeF64:
+		switch want.NaN {
+		case "canonical":
+			return got&^(1<<63) == 0x7ff8000000000000
+		case "arithmetic":
+			return got&0x7ff8000000000000 == 0x7ff8000000000000
+		}
+		return got == want.Bits
+	case wasm.ValueTypeV128:
+		if want.LaneNaN == nil {
+			return got == want.Bits && values[1] == want.High
+		}
+		bits := uint(128 / len(want.LaneNaN))
+		for i, kind := range want.LaneNaN {
+			lane, wantLane := laneOf(got, values[1], i, bits), laneOf(want.Bits, want.High, i, bits)
+			switch {
+			case kind == "" && lane != wantLane:
+				return false
+			case kind != "" && bits == 32 && !a.matches([]uint64{lane}, wat.Value{Type: wasm.ValueTypeF32, NaN: kind}):
+				return false
+			case kind != "" && bits == 64 && !a.matches([]uint64{lane}, wat.Value{Type: wasm.ValueTypeF64, NaN: kind}):
+				return false
+			}
+		}
+		return true
+	case wasm.ValueTypeFuncref, wasm.ValueTypeExternref:
+		if want.Bits == uint64(wasm.NullRef) || uint32(got) == uint32(wasm.NullRef) {
+			return uint32(got) == uint32(want.Bits)
+		}
+		return want.Type == wasm.ValueTypeExternref && a.inst.vm.ExternValue(got) == want.Bits
+	}
+	return got == want.Bits
+}
+
+// laneOf returns the lane i of the given number of bits of the v128 whose
+// low and high bits are given.
+func laneOf(low, high uint64, i int, bits uint) uint64 {
+	if bits == 64 {
+		if i == 0 {
+			return low
+		}
+		return high
+	}
+	v := low
+	if uint(i)*bits >= 64 {
+		v, i = high, i-int(64/bits)
+	}
+	return v >> (uint(i) * bits) & (1<<bits - 1)
+}
+
+// format formats the results of a.
+func (a *action) format(results []uint64) string {
+	var values []wat.Value
+	for _, t := range a.types {
+		if len(results) < disasm.Slots(t) {
+			break
+		}
+		v := wat.Value{Type: t, Bits: results[0]}
+		if t == wasm.ValueTypeV128 {
+			v.High = results[1]
+		}
+		values = append(values, v)
+		results = results[disasm.Slots(t):]
+	}
+	return formatValues(values)
+}
+
+// formatValues formats values like the constants of a script.
+func formatValues(values []wat.Value) string {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		switch {
+		case v.NaN != "":
+			fmt.Fprintf(&buf, "%v:nan:%s", v.Type, v.NaN)
+		case v.Type == wasm.ValueTypeI32:
+			fmt.Fprintf(&buf, "i32:%d", int32(v.Bits))
+		case v.Type == wasm.ValueTypeI64:
+			fmt.Fprintf(&buf, "i64:%d", int64(v.Bits))
+		case v.Type == wasm.ValueTypeF32:
+			fmt.Fprintf(&buf, "f32:%v", math.Float32frombits(uint32(v.Bits)))
+		case v.Type == wasm.ValueTypeF64:
+			fmt.Fprintf(&buf, "f64:%v", math.Float64frombits(v.Bits))
+		case v.Type == wasm.ValueTypeV128:
+			fmt.Fprintf(&buf, "v128:0x%016x%016x", v.High, v.Bits)
+		case uint32(v.Bits) == uint32(wasm.NullRef):
+			fmt.Fprintf(&buf, "%v:null", v.Type)
+		default:
+			fmt.Fprintf(&buf, "%v:%d", v.Type, v.Bits)
+		}
+	}
+	buf.WriteByte(']')
+	return buf.String()
+}
@@ -0,0 +1,102 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wast
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+)
+
+// TestRunScripts runs the scripts of testdata, whose commands must all
+// succeed, and the modules of the spec tests.
+func TestRunScripts(t *testing.T) {
+	scripts, err := filepath.Glob("testdata/*.wast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := filepath.Glob("../exec/testdata/spec/*.wast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range append(scripts, spec...) {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		failures, err := Run(src, exec.VMConfig{})
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		for _, f := range failures {
+			t.Errorf("%s: %v", name, f)
+		}
+	}
+}
+
+// TestRunFailures checks the failures of the commands which don't hold.
+func TestRunFailures(t *testing.T) {
+	src := `
+(module
+  (func (export "one") (result i32) (i32.const 1))
+  (func (export "nan") (result f32) (f32.const nan:0x200000))
+  (func (export "trap") (i32.const 1) (i32.const 0) (i32.div_u) (drop)))
+(assert_return (invoke "one") (i32.const 2))
+(assert_return (invoke "one") (i64.const 1))
+(assert_return (invoke "nan") (f32.const nan:canonical))
+(assert_return (invoke "trap"))
+(assert_trap (invoke "one") "unreachable")
+(assert_return (invoke "missing"))
+(assert_return (invoke $other "one") (i32.const 1))
+(assert_invalid (module (func (result i32) (i32.const 1))) "type mismatch")
+(register "m" $other)
+(module (import "unknown" "f" (func)))
+(assert_return (invoke "one") (i32.const 1))
+`
+	want := []string{
+		"wast: 6: assert_return: invoke one returned [i32:1], expected [i32:2]",
+		"wast: 7: assert_return: result 0 of invoke one is a i32, expected a i64",
+		"wast: 8: assert_return: invoke nan returned [f32:NaN], expected [f32:nan:canonical]",
+		"wast: 9: assert_return: runtime error: integer divide by zero",
+		"wast: 10: assert_trap: invoke one returned [i32:1], expected a trap with \"unreachable\"",
+		"wast: 11: assert_return: no exported function \"missing\"",
+		"wast: 12: assert_return: no module $other",
+		"wast: 13: assert_invalid: the module is valid, expected \"type mismatch\"",
+		"wast: 14: register: no module $other",
+		"wast: 15: module: unknown module \"unknown\"",
+		"wast: 16: assert_return: no module",
+	}
+	failures, err := Run([]byte(src), exec.VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range failures {
+		got = append(got, f.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got the failures\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if _, err := Run([]byte(`(assert_return (invoke "f") (i32.const))`), exec.VMConfig{}); err == nil {
+		t.Error("the script with a missing constant ran")
+	}
+}
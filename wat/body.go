@@ -0,0 +1,509 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// funcCtx encodes the instructions of a function body, or of a constant
+// expression.
+type funcCtx struct {
+	p      *parser
+	locals space
+	labels []*node // the identifiers of the enclosing blocks, or nil
+	out    *bytes.Buffer
+}
+
+func (p *parser) newFunc() *funcCtx {
+	return &funcCtx{p: p, locals: space{kind: "local"}, out: new(bytes.Buffer)}
+}
+
+// instrs encodes the instructions read by c, either plain or folded.
+func (f *funcCtx) instrs(c *cursor) {
+	for !c.done() {
+		n := c.next()
+		switch n.kind {
+		case nodeList:
+			f.folded(n)
+		case nodeKeyword:
+			f.plain(n, c)
+		default:
+			fail(n, "expected an instruction, got %s", n)
+		}
+	}
+}
+
+// lookup returns the instruction named by n.
+func lookup(n *node, name string) *instr {
+	in, ok := instrs[name]
+	if !ok {
+		fail(n, "unknown instruction %s", name)
+	}
+	return in
+}
+
+// plain encodes the plain instruction n, whose immediates are read by c.
+func (f *funcCtx) plain(n *node, c *cursor) {
+	switch n.atom {
+	case "end":
+		f.popLabel(n, c)
+		f.out.WriteByte(ops.End)
+	case "else", "catch", "catch_all":
+		if len(f.labels) == 0 {
+			fail(n, "%s outside of a block", n.atom)
+		}
+		f.op(lookup(n, n.atom), n, c)
+		if n.atom == "else" {
+			f.checkLabel(c)
+		}
+	case "delegate":
+		f.popLabel(n, nil)
+		f.op(lookup(n, n.atom), n, c)
+	default:
+		f.op(lookup(n, n.atom), n, c)
+	}
+}
+
+// popLabel ends the innermost block, whose identifier may follow the end
+// if c is not nil.
+func (f *funcCtx) popLabel(n *node, c *cursor) {
+	if len(f.labels) == 0 {
+		fail(n, "%s outside of a block", n.atom)
+	}
+	if c != nil {
+		f.checkLabel(c)
+	}
+	f.labels = f.labels[:len(f.labels)-1]
+}
+
+// checkLabel checks the optional identifier following an else or an end,
+// which must be the one of the innermost block.
+func (f *funcCtx) checkLabel(c *cursor) {
+	id := c.id()
+	if id == nil {
+		return
+	}
+	if label := f.labels[len(f.labels)-1]; label == nil || label.atom != id.atom {
+		fail(id, "mismatched label %s", id.atom)
+	}
+}
+
+// folded encodes the folded instruction n: the operands, then the
+// instruction, or the blocks of a structured instruction.
+func (f *funcCtx) folded(n *node) {
+	head := n.list[0]
+	if head.kind != nodeKeyword {
+		fail(head, "expected an instruction, got %s", head)
+	}
+	c := newCursor(n, 1)
+	switch head.atom {
+	case "block", "loop":
+		f.op(lookup(head, head.atom), head, c)
+		f.instrs(c)
+		f.labels = f.labels[:len(f.labels)-1]
+		f.out.WriteByte(ops.End)
+	case "if":
+		// the condition precedes the if
+		label := c.id()
+		out := f.out
+		f.out = new(bytes.Buffer)
+		f.blockType(c)
+		bt := f.out.Bytes()
+		f.out = out
+		for n := c.peek(); n != nil && !n.is("then"); n = c.peek() {
+			if n.kind != nodeList {
+				fail(n, "expected a folded instruction, got %s", n)
+			}
+			f.folded(c.next())
+		}
+		f.out.WriteByte(ops.If)
+		f.out.Write(bt)
+		f.labels = append(f.labels, label)
+		then := c.list("then")
+		if then == nil {
+			fail(n, "if without then")
+		}
+		f.instrs(newCursor(then, 1))
+		if else_ := c.list("else"); else_ != nil && len(else_.list) > 1 {
+			f.out.WriteByte(ops.Else)
+			f.instrs(newCursor(else_, 1))
+		}
+		c.end()
+		f.labels = f.labels[:len(f.labels)-1]
+		f.out.WriteByte(ops.End)
+	case "try":
+		f.op(lookup(head, head.atom), head, c)
+		if do := c.list("do"); do != nil {
+			f.instrs(newCursor(do, 1))
+		}
+		for catch := c.list("catch"); catch != nil; catch = c.list("catch") {
+			cc := newCursor(catch, 1)
+			f.op(instrs["catch"], catch.list[0], cc)
+			f.instrs(cc)
+		}
+		if catchAll := c.list("catch_all"); catchAll != nil {
+			f.out.WriteByte(ops.CatchAll)
+			f.instrs(newCursor(catchAll, 1))
+		}
+		if delegate := c.list("delegate"); delegate != nil {
+			dc := newCursor(delegate, 1)
+			f.labels = f.labels[:len(f.labels)-1]
+			f.op(instrs["delegate"], delegate.list[0], dc)
+			dc.end()
+			c.end()
+			return
+		}
+		c.end()
+		f.labels = f.labels[:len(f.labels)-1]
+		f.out.WriteByte(ops.End)
+	default:
+		in := lookup(head, head.atom)
+		if in.imm == immBlock || in.code == ops.Else || in.code == ops.End {
+			fail(head, "unexpected %s", head.atom)
+		}
+		out := f.out
+		f.out = new(bytes.Buffer)
+		f.op(in, head, c)
+		encoded := f.out.Bytes()
+		f.out = out
+		for !c.done() {
+			operand := c.next()
+			if operand.kind != nodeList {
+				fail(operand, "expected a folded instruction, got %s", operand)
+			}
+			f.folded(operand)
+		}
+		f.out.Write(encoded)
+	}
+}
+
+// op encodes the instruction in and the immediates read by c. The
+// instruction is named by n.
+func (f *funcCtx) op(in *instr, n *node, c *cursor) {
+	p, out := f.p, f.out
+	switch in.imm {
+	case immSelect:
+		var types []wasm.ValueType
+		for result := c.list("result"); result != nil; result = c.list("result") {
+			rc := newCursor(result, 1)
+			for !rc.done() {
+				types = append(types, p.valueType(rc.next()))
+			}
+		}
+		if types == nil {
+			out.WriteByte(ops.Select)
+			return
+		}
+		out.WriteByte(ops.SelectTyped)
+		leb128.WriteVarUint32(out, uint32(len(types)))
+		for _, t := range types {
+			writeValueType(out, t)
+		}
+		return
+	case immRefType:
+		t, nullable := p.refType(c.next())
+		sub := in.sub
+		if nullable {
+			// the nullable variants follow ref.test and ref.cast
+			sub++
+		}
+		out.WriteByte(in.code)
+		leb128.WriteVarUint32(out, sub)
+		leb128.WriteVarint64(out, int64(t))
+		return
+	}
+
+	out.WriteByte(in.code)
+	if in.prefixed {
+		leb128.WriteVarUint32(out, in.sub)
+	}
+	switch in.imm {
+	case immBlock:
+		label := c.id()
+		f.blockType(c)
+		f.labels = append(f.labels, label)
+	case immLabel:
+		leb128.WriteVarUint32(out, f.label(c.next()))
+	case immBrTable:
+		var labels []uint32
+		for n := c.index(); n != nil; n = c.index() {
+			labels = append(labels, f.label(n))
+		}
+		if len(labels) == 0 {
+			fail(n, "br_table without a default label")
+		}
+		leb128.WriteVarUint32(out, uint32(len(labels)-1))
+		for _, l := range labels {
+			leb128.WriteVarUint32(out, l)
+		}
+	case immFunc:
+		leb128.WriteVarUint32(out, p.funcs.index(c.next()))
+	case immCallIndirect:
+		table := uint32(0)
+		if n := c.index(); n != nil {
+			if _, ok := p.tables.names[n.atom]; !ok && !isTypeUse(c.peek()) {
+				// the former syntax giving the type index alone
+				leb128.WriteVarUint32(out, p.types.index(n))
+				leb128.WriteVarUint32(out, 0)
+				break
+			}
+			table = p.tables.index(n)
+		}
+		leb128.WriteVarUint32(out, p.typeUse(c, nil))
+		leb128.WriteVarUint32(out, table)
+	case immType:
+		leb128.WriteVarUint32(out, p.types.index(c.next()))
+	case immLocal:
+		leb128.WriteVarUint32(out, f.locals.index(c.next()))
+	case immGlobal:
+		leb128.WriteVarUint32(out, p.globals.index(c.next()))
+	case immTable, immElem, immData, immMemory, immTag:
+		s := map[immKind]*space{immTable: &p.tables, immElem: &p.elems, immData: &p.datas, immMemory: &p.memories, immTag: &p.tags}[in.imm]
+		index := uint32(0)
+		if in.imm == immElem || in.imm == immData || in.imm == immTag {
+			index = s.index(c.next())
+			p.dataCount = p.dataCount || in.imm == immData
+		} else if n := c.index(); n != nil {
+			index = s.index(n)
+		}
+		leb128.WriteVarUint32(out, index)
+	case immTableInit, immMemoryInit:
+		// the text gives the optional table or memory first, while the
+		// binary gives it last
+		s, segments := &p.tables, &p.elems
+		if in.imm == immMemoryInit {
+			s, segments = &p.memories, &p.datas
+			p.dataCount = true
+		}
+		first := c.next()
+		index := uint32(0)
+		if second := c.index(); second != nil {
+			index, first = s.index(first), second
+		}
+		leb128.WriteVarUint32(out, segments.index(first))
+		leb128.WriteVarUint32(out, index)
+	case immTableCopy, immMemoryCopy:
+		s := &p.tables
+		if in.imm == immMemoryCopy {
+			s = &p.memories
+		}
+		dst, src := uint32(0), uint32(0)
+		if n := c.index(); n != nil {
+			dst, src = s.index(n), s.index(c.next())
+		}
+		leb128.WriteVarUint32(out, dst)
+		leb128.WriteVarUint32(out, src)
+	case immMemArg:
+		f.memArg(in, c, false)
+	case immMemArgLane:
+		f.memArg(in, c, true)
+		out.WriteByte(byte(f.uint(c.next(), 8)))
+	case immI32:
+		leb128.WriteVarint64(out, int64(int32(f.int(c.next(), 32))))
+	case immI64:
+		leb128.WriteVarint64(out, int64(f.int(c.next(), 64)))
+	case immF32:
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(parseFloat(c.next(), 32)))
+		out.Write(b[:])
+	case immF64:
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], parseFloat(c.next(), 64))
+		out.Write(b[:])
+	case immHeapType:
+		leb128.WriteVarint64(out, int64(p.heapType(c.next())))
+	case immV128:
+		f.v128(c)
+	case immShuffle:
+		for i := 0; i < 16; i++ {
+			out.WriteByte(byte(f.uint(c.next(), 8)))
+		}
+	case immLane:
+		out.WriteByte(byte(f.uint(c.next(), 8)))
+	case immFence:
+		out.WriteByte(0)
+	case immField:
+		t := p.types.index(c.next())
+		leb128.WriteVarUint32(out, t)
+		n := c.next()
+		if index, ok := p.fieldNames[t][n.atom]; ok && n.kind == nodeID {
+			leb128.WriteVarUint32(out, index)
+		} else {
+			leb128.WriteVarUint32(out, uint32(f.uint(n, 32)))
+		}
+	case immTypeCount:
+		leb128.WriteVarUint32(out, p.types.index(c.next()))
+		leb128.WriteVarUint32(out, uint32(f.uint(c.next(), 32)))
+	case immTypes:
+		leb128.WriteVarUint32(out, p.types.index(c.next()))
+		leb128.WriteVarUint32(out, p.types.index(c.next()))
+	}
+}
+
+// blockType encodes the type of a block: empty, a single result or a
+// function type.
+func (f *funcCtx) blockType(c *cursor) {
+	if !isTypeUse(c.peek()) {
+		f.out.WriteByte(0x40)
+		return
+	}
+	if n := c.peek(); !n.is("type") {
+		pos := c.pos
+		params, results := f.p.signature(c, nil)
+		if len(params) == 0 && len(results) <= 1 {
+			if len(results) == 0 {
+				f.out.WriteByte(0x40)
+			} else {
+				writeValueType(f.out, results[0])
+			}
+			return
+		}
+		c.pos = pos
+	}
+	leb128.WriteVarint64(f.out, int64(f.p.typeUse(c, nil)))
+}
+
+// isTypeUse returns whether n starts a type use.
+func isTypeUse(n *node) bool {
+	return n != nil && (n.is("type") || n.is("param") || n.is("result"))
+}
+
+// label returns the depth of the block referenced by n, an identifier or
+// a number.
+func (f *funcCtx) label(n *node) uint32 {
+	if n.kind == nodeID {
+		for i := len(f.labels) - 1; i >= 0; i-- {
+			if f.labels[i] != nil && f.labels[i].atom == n.atom {
+				return uint32(len(f.labels) - 1 - i)
+			}
+		}
+		fail(n, "unknown label %s", n.atom)
+	}
+	return uint32(f.uint(n, 32))
+}
+
+// memArg encodes the optional memory index, offset and alignment of a
+// memory access. A lane index follows the ones of lane accesses, so that
+// a single number is the lane index.
+func (f *funcCtx) memArg(in *instr, c *cursor, lane bool) {
+	memory := uint32(0)
+	if n := c.index(); n != nil {
+		if next := c.peek(); lane && n.kind == nodeKeyword && (next == nil || next.kind != nodeKeyword ||
+			!isNumber(next.atom) && !strings.HasPrefix(next.atom, "offset=") && !strings.HasPrefix(next.atom, "align=")) {
+			c.pos--
+		} else {
+			memory = f.p.memories.index(n)
+		}
+	}
+	offset, align := uint64(0), in.align
+	if n := c.peek(); n != nil && n.kind == nodeKeyword && strings.HasPrefix(n.atom, "offset=") {
+		c.next()
+		v, ok := parseUint(n.atom[len("offset="):], 64)
+		if !ok {
+			fail(n, "invalid offset %s", n)
+		}
+		offset = v
+	}
+	if n := c.peek(); n != nil && n.kind == nodeKeyword && strings.HasPrefix(n.atom, "align=") {
+		c.next()
+		v, ok := parseUint(n.atom[len("align="):], 32)
+		if !ok || v == 0 || v&(v-1) != 0 {
+			fail(n, "invalid alignment %s", n)
+		}
+		for align = 0; v > 1; v >>= 1 {
+			align++
+		}
+	}
+
+	if memory != 0 {
+		// bit 6 of the alignment flags an explicit memory index
+		leb128.WriteVarUint32(f.out, align|0x40)
+		leb128.WriteVarUint32(f.out, memory)
+	} else {
+		leb128.WriteVarUint32(f.out, align)
+	}
+	leb128.WriteVarUint64(f.out, offset)
+}
+
+// v128 encodes the lanes of a v128 constant, given by its shape.
+func (f *funcCtx) v128(c *cursor) {
+	shape := c.next()
+	lanes, bits := 0, 0
+	float := false
+	switch shape.atom {
+	case "i8x16":
+		lanes, bits = 16, 8
+	case "i16x8":
+		lanes, bits = 8, 16
+	case "i32x4":
+		lanes, bits = 4, 32
+	case "i64x2":
+		lanes, bits = 2, 64
+	case "f32x4":
+		lanes, bits, float = 4, 32, true
+	case "f64x2":
+		lanes, bits, float = 2, 64, true
+	default:
+		fail(shape, "unknown vector shape %s", shape)
+	}
+	var b [8]byte
+	for i := 0; i < lanes; i++ {
+		var v uint64
+		if float {
+			v = parseFloat(c.next(), bits)
+		} else {
+			v = f.int(c.next(), bits)
+		}
+		binary.LittleEndian.PutUint64(b[:], v)
+		f.out.Write(b[:bits/8])
+	}
+}
+
+// int parses an integer of the given number of bits.
+func (f *funcCtx) int(n *node, bits int) uint64 {
+	v, ok := parseInt(n.atom, bits)
+	if n.kind != nodeKeyword || !ok {
+		fail(n, "invalid i%d %s", bits, n)
+	}
+	return v
+}
+
+// uint parses an unsigned integer of the given number of bits.
+func (f *funcCtx) uint(n *node, bits int) uint64 {
+	v, ok := parseUint(n.atom, bits)
+	if n.kind != nodeKeyword || !ok {
+		fail(n, "invalid u%d %s", bits, n)
+	}
+	return v
+}
+
+// writeValueType writes the value type t like wasm.Module.Encode does,
+// the references to a type being nullable.
+func writeValueType(w *bytes.Buffer, t wasm.ValueType) {
+	if t >= 0 {
+		w.WriteByte(0x63)
+	}
+	leb128.WriteVarint64(w, int64(t))
+}
@@ -0,0 +1,288 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wat
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// immKind tells which immediates follow an instruction.
+type immKind uint8
+
+const (
+	immNone         immKind = iota
+	immBlock                // a label and a block type
+	immLabel                // a label
+	immBrTable              // a vector of labels, then the default one
+	immFunc                 // a function index
+	immCallIndirect         // a table index and a type use
+	immType                 // a type index
+	immLocal                // a local index
+	immGlobal               // a global index
+	immTable                // a table index, 0 if omitted
+	immMemory               // a memory index, 0 if omitted
+	immMemArg               // a memory index, an offset and an alignment
+	immI32                  // an i32 constant
+	immI64                  // an i64 constant
+	immF32                  // an f32 constant
+	immF64                  // an f64 constant
+	immSelect               // the optional types of a typed select
+	immHeapType             // a heap type
+	immTag                  // a tag index
+	immTableInit            // a table index, and an element segment index
+	immTableCopy            // two table indices
+	immElem                 // an element segment index
+	immMemoryInit           // a memory index, and a data segment index
+	immMemoryCopy           // two memory indices
+	immData                 // a data segment index
+	immV128                 // a v128 constant, given by its shape and lanes
+	immShuffle              // 16 lane indices
+	immLane                 // a lane index
+	immMemArgLane           // a memory argument and a lane index
+	immFence                // the reserved byte of atomic.fence
+	immField                // a type index and a field index
+	immTypeCount            // a type index and a number of values
+	immTypes                // two type indices
+	immRefType              // a reference type, selecting the nullable variant
+)
+
+// instr is an instruction of the text format.
+type instr struct {
+	name     string
+	code     byte // the opcode, or the prefix of a prefixed instruction
+	sub      uint32
+	prefixed bool
+	imm      immKind
+	align    uint32 // the log2 of the natural alignment of a memory access
+}
+
+// instrs maps the names of the instructions to their encoding.
+var instrs = map[string]*instr{}
+
+// opcodes maps the opcodes of the instructions, see opcode, to them.
+var opcodes = map[uint32]*instr{}
+
+// opcode returns the key of the instruction of the given opcode and
+// sub-opcode in opcodes.
+func opcode(code byte, sub uint32) uint32 {
+	return uint32(code)<<16 | sub
+}
+
+func init() {
+	for code := 0; code < 256; code++ {
+		if op, err := ops.New(byte(code)); err == nil {
+			addInstr(op)
+		}
+	}
+	for _, prefix := range []byte{ops.PrefixMisc, ops.PrefixSIMD, ops.PrefixAtomic, ops.PrefixGC} {
+		for sub := uint32(0); sub < 0x200; sub++ {
+			if op, err := ops.NewPrefixed(prefix, sub); err == nil {
+				addInstr(op)
+			}
+		}
+	}
+}
+
+func addInstr(op ops.Op) {
+	switch op.Name {
+	case "select.typed", "ref.test null", "ref.cast null":
+		// the variants selected by the immediates of select, ref.test
+		// and ref.cast
+		return
+	}
+	in := &instr{
+		name:     standardName(op.Name),
+		code:     op.Code,
+		sub:      op.Sub,
+		prefixed: isPrefix(op.Code),
+	}
+	in.imm = immediates(op)
+	if in.imm == immMemArg || in.imm == immMemArgLane {
+		in.align = naturalAlignment(in.name)
+	}
+	instrs[in.name] = in
+	opcodes[opcode(in.code, in.sub)] = in
+	// the old names are still accepted
+	instrs[op.Name] = in
+}
+
+// isPrefix returns whether code is the prefix of prefixed instructions.
+func isPrefix(code byte) bool {
+	return code == ops.PrefixMisc || code == ops.PrefixSIMD || code == ops.PrefixAtomic || code == ops.PrefixGC
+}
+
+// standardName returns the name of the operator named name by the
+// operators package in the current text format, which renamed the
+// variable and memory instructions and the conversions.
+func standardName(name string) string {
+	switch name {
+	case "get_local":
+		return "local.get"
+	case "set_local":
+		return "local.set"
+	case "tee_local":
+		return "local.tee"
+	case "get_global":
+		return "global.get"
+	case "set_global":
+		return "global.set"
+	case "current_memory":
+		return "memory.size"
+	case "grow_memory":
+		return "memory.grow"
+	}
+	// i32.trunc_s/f32 is i32.trunc_f32_s
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		base, from := name[:i], name[i+1:]
+		if strings.HasSuffix(base, "_s") || strings.HasSuffix(base, "_u") {
+			return base[:len(base)-2] + "_" + from + base[len(base)-2:]
+		}
+		return base + "_" + from
+	}
+	return name
+}
+
+// immediates returns the kind of the immediates of op.
+func immediates(op ops.Op) immKind {
+	switch op.Code {
+	case ops.Block, ops.Loop, ops.If, ops.Try:
+		return immBlock
+	case ops.Br, ops.BrIf, ops.Rethrow, ops.Delegate, ops.BrOnNull, ops.BrOnNonNull:
+		return immLabel
+	case ops.BrTable:
+		return immBrTable
+	case ops.Call, ops.ReturnCall, ops.RefFunc:
+		return immFunc
+	case ops.CallIndirect, ops.ReturnCallIndirect:
+		return immCallIndirect
+	case ops.CallRef, ops.ReturnCallRef:
+		return immType
+	case ops.GetLocal, ops.SetLocal, ops.TeeLocal:
+		return immLocal
+	case ops.GetGlobal, ops.SetGlobal:
+		return immGlobal
+	case ops.TableGet, ops.TableSet:
+		return immTable
+	case ops.CurrentMemory, ops.GrowMemory:
+		return immMemory
+	case ops.I32Const:
+		return immI32
+	case ops.I64Const:
+		return immI64
+	case ops.F32Const:
+		return immF32
+	case ops.F64Const:
+		return immF64
+	case ops.Select:
+		return immSelect
+	case ops.RefNull:
+		return immHeapType
+	case ops.Throw, ops.Catch:
+		return immTag
+	case ops.PrefixMisc:
+		switch op.Sub {
+		case ops.MemoryInit:
+			return immMemoryInit
+		case ops.DataDrop:
+			return immData
+		case ops.MemoryCopy:
+			return immMemoryCopy
+		case ops.MemoryFill:
+			return immMemory
+		case ops.TableInit:
+			return immTableInit
+		case ops.ElemDrop:
+			return immElem
+		case ops.TableCopy:
+			return immTableCopy
+		}
+		return immTable
+	case ops.PrefixSIMD:
+		switch sub := op.Sub; {
+		case sub == ops.V128Const:
+			return immV128
+		case sub == ops.I8x16Shuffle:
+			return immShuffle
+		case sub >= ops.I8x16ExtractLaneS && sub <= ops.F64x2ReplaceLane:
+			return immLane
+		case sub >= ops.V128Load8Lane && sub <= ops.V128Store64Lane:
+			return immMemArgLane
+		case sub <= ops.V128Store, sub >= ops.V128Load8Lane && sub <= ops.V128Load64Zero:
+			return immMemArg
+		}
+		return immNone
+	case ops.PrefixAtomic:
+		if op.Sub == ops.AtomicFence {
+			return immFence
+		}
+		return immMemArg
+	case ops.PrefixGC:
+		switch op.Sub {
+		case ops.StructNew, ops.StructNewDefault, ops.ArrayNew, ops.ArrayNewDefault,
+			ops.ArrayGet, ops.ArrayGetS, ops.ArrayGetU, ops.ArraySet, ops.ArrayFill:
+			return immType
+		case ops.StructGet, ops.StructGetS, ops.StructGetU, ops.StructSet:
+			return immField
+		case ops.ArrayNewFixed:
+			return immTypeCount
+		case ops.ArrayCopy:
+			return immTypes
+		case ops.RefTest, ops.RefCast:
+			return immRefType
+		}
+		return immNone
+	}
+	if op.Code >= ops.I32Load && op.Code <= ops.I64Store32 {
+		return immMemArg
+	}
+	return immNone
+}
+
+var (
+	accessSize = regexp.MustCompile(`(load|store|rmw|wait)(\d+)`)
+	vectorSize = regexp.MustCompile(`\d+x\d+`)
+)
+
+// naturalAlignment returns the log2 of the size of the memory accessed by
+// the memory instruction name, its default alignment.
+func naturalAlignment(name string) uint32 {
+	op := name[strings.IndexByte(name, '.')+1:]
+	bits := 0
+	switch {
+	case vectorSize.MatchString(op):
+		// the extending loads of 8 bytes
+		bits = 64
+	case accessSize.MatchString(op):
+		bits, _ = strconv.Atoi(accessSize.FindStringSubmatch(op)[2])
+	case strings.HasPrefix(name, "i64."), strings.HasPrefix(name, "f64."):
+		bits = 64
+	case strings.HasPrefix(name, "v128."):
+		bits = 128
+	default:
+		bits = 32
+	}
+	align := uint32(0)
+	for size := bits / 8; size > 1; size >>= 1 {
+		align++
+	}
+	return align
+}
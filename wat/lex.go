@@ -0,0 +1,255 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error is a syntax or semantic error of a text module, at the given
+// line and column, counted from 1.
+type Error struct {
+	Line, Col int
+	Msg       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("wat: %d:%d: %s", e.Line, e.Col, e.Msg)
+}
+
+// nodeKind tells what a node of the text is.
+type nodeKind uint8
+
+const (
+	nodeList    nodeKind = iota // a parenthesized list
+	nodeKeyword                 // a keyword, or a number
+	nodeID                      // an identifier, starting with $
+	nodeString                  // a string, whose bytes are in str
+)
+
+// node is a list or an atom of the S-expressions of a text module.
+type node struct {
+	kind      nodeKind
+	line, col int
+	atom      string  // the text of a keyword or an identifier
+	str       []byte  // the decoded bytes of a string
+	list      []*node // the items of a list
+}
+
+// head returns the keyword a list starts with, or an empty string.
+func (n *node) head() string {
+	if n.kind != nodeList || len(n.list) == 0 || n.list[0].kind != nodeKeyword {
+		return ""
+	}
+	return n.list[0].atom
+}
+
+// is returns whether n is a list starting with the keyword head.
+func (n *node) is(head string) bool {
+	return n.head() == head
+}
+
+func (n *node) String() string {
+	switch n.kind {
+	case nodeList:
+		if head := n.head(); head != "" {
+			return "(" + head + " ...)"
+		}
+		return "(...)"
+	case nodeString:
+		return strconv.Quote(string(n.str))
+	}
+	return n.atom
+}
+
+// lexer splits a text module into its S-expressions.
+type lexer struct {
+	src       string
+	pos       int
+	line, col int
+}
+
+func (l *lexer) fail(line, col int, format string, args ...interface{}) {
+	panic(&Error{Line: line, Col: col, Msg: fmt.Sprintf(format, args...)})
+}
+
+// advance moves past the next n bytes, which don't hold a newline unless
+// n is 1.
+func (l *lexer) advance(n int) {
+	for i := 0; i < n; i++ {
+		if l.src[l.pos] == '\n' {
+			l.line, l.col = l.line+1, 1
+		} else {
+			l.col++
+		}
+		l.pos++
+	}
+}
+
+// skipSpace skips the white space and the comments.
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.src) {
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], ";;"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.advance(1)
+			}
+		case strings.HasPrefix(l.src[l.pos:], "(;"):
+			line, col := l.line, l.col
+			depth := 0
+			for {
+				switch {
+				case l.pos >= len(l.src):
+					l.fail(line, col, "unterminated block comment")
+				case strings.HasPrefix(l.src[l.pos:], "(;"):
+					depth++
+					l.advance(2)
+				case strings.HasPrefix(l.src[l.pos:], ";)"):
+					depth--
+					l.advance(2)
+				default:
+					l.advance(1)
+				}
+				if depth == 0 {
+					break
+				}
+			}
+		case strings.IndexByte(" \t\r\n", l.src[l.pos]) >= 0:
+			l.advance(1)
+		default:
+			return
+		}
+	}
+}
+
+// parse returns the S-expressions of src.
+func parseSExprs(src string) []*node {
+	l := &lexer{src: src, line: 1, col: 1}
+	var stack [][]*node
+	var opened []*node
+	var top []*node
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.src) {
+			break
+		}
+		line, col := l.line, l.col
+		switch c := l.src[l.pos]; {
+		case c == '(':
+			l.advance(1)
+			stack = append(stack, top)
+			opened = append(opened, &node{kind: nodeList, line: line, col: col})
+			top = nil
+		case c == ')':
+			if len(stack) == 0 {
+				l.fail(line, col, "unexpected )")
+			}
+			l.advance(1)
+			n := opened[len(opened)-1]
+			n.list = top
+			top = append(stack[len(stack)-1], n)
+			stack, opened = stack[:len(stack)-1], opened[:len(opened)-1]
+		case c == '"':
+			top = append(top, &node{kind: nodeString, line: line, col: col, str: l.string()})
+		default:
+			start := l.pos
+			for l.pos < len(l.src) && strings.IndexByte(" \t\r\n()\";", l.src[l.pos]) < 0 {
+				l.advance(1)
+			}
+			if l.pos == start {
+				l.fail(line, col, "unexpected %q", l.src[l.pos])
+			}
+			n := &node{kind: nodeKeyword, line: line, col: col, atom: l.src[start:l.pos]}
+			if n.atom[0] == '$' {
+				if len(n.atom) == 1 {
+					l.fail(line, col, "empty identifier")
+				}
+				n.kind = nodeID
+			}
+			top = append(top, n)
+		}
+	}
+	if len(opened) != 0 {
+		n := opened[len(opened)-1]
+		l.fail(n.line, n.col, "unclosed (")
+	}
+	return top
+}
+
+// string reads a string and returns its bytes.
+func (l *lexer) string() []byte {
+	line, col := l.line, l.col
+	l.advance(1)
+	var b []byte
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+			l.fail(line, col, "unterminated string")
+		}
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.advance(1)
+			return b
+		case c != '\\':
+			b = append(b, c)
+			l.advance(1)
+			continue
+		}
+		if l.pos+1 >= len(l.src) {
+			l.fail(line, col, "unterminated string")
+		}
+		esc := l.src[l.pos+1]
+		switch esc {
+		case 't':
+			b = append(b, '\t')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case '"', '\'', '\\':
+			b = append(b, esc)
+		case 'u':
+			end := strings.IndexByte(l.src[l.pos:], '}')
+			if !strings.HasPrefix(l.src[l.pos+2:], "{") || end < 0 {
+				l.fail(l.line, l.col, "invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(strings.Replace(l.src[l.pos+3:l.pos+end], "_", "", -1), 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				l.fail(l.line, l.col, "invalid unicode escape")
+			}
+			b = append(b, string(rune(r))...)
+			l.advance(end + 1)
+			continue
+		default:
+			if l.pos+2 >= len(l.src) {
+				l.fail(line, col, "unterminated string")
+			}
+			v, err := strconv.ParseUint(l.src[l.pos+1:l.pos+3], 16, 8)
+			if err != nil {
+				l.fail(l.line, l.col, "invalid escape %q", l.src[l.pos:l.pos+2])
+			}
+			b = append(b, byte(v))
+			l.advance(3)
+			continue
+		}
+		l.advance(2)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wat
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bottos-project/bottos/vm/wasm/demangle"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// names are the identifiers given to the entries of a module by its name
+// section, with their $ prefix.
+type names struct {
+	module   string
+	entries  map[wasm.NameSubsection]map[uint32]string
+	indirect map[wasm.NameSubsection]map[uint32]map[uint32]string
+	// demangled are the readable names of the functions whose name is a
+	// mangled symbol, see demangle.Demangle.
+	demangled map[uint32]string
+}
+
+// readNames returns the identifiers of the names of m, unique in each
+// index space, function and type.
+func readNames(m *wasm.Module) *names {
+	read := m.Names()
+	n := &names{
+		entries:   make(map[wasm.NameSubsection]map[uint32]string),
+		indirect:  make(map[wasm.NameSubsection]map[uint32]map[uint32]string),
+		demangled: make(map[uint32]string),
+	}
+	if read.Module != "" {
+		n.module = identifier(read.Module)
+	}
+	for id, entries := range read.Entries {
+		n.entries[id] = identifiers(entries)
+	}
+	for index, name := range read.Entries[wasm.NamesFunctions] {
+		if readable := demangle.Demangle(name); readable != name {
+			n.demangled[index] = readable
+		}
+	}
+	for id, maps := range read.Indirect {
+		n.indirect[id] = make(map[uint32]map[uint32]string, len(maps))
+		for index, entries := range maps {
+			n.indirect[id][index] = identifiers(entries)
+		}
+	}
+	return n
+}
+
+// identifiers turns the names of a map from indices to names into
+// identifiers, unique in the map in the order of the indices.
+func identifiers(names map[uint32]string) map[uint32]string {
+	indices := make([]uint32, 0, len(names))
+	for index := range names {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	ids := make(map[uint32]string, len(names))
+	used := make(map[string]bool, len(names))
+	for _, index := range indices {
+		id := identifier(names[index])
+		if used[id] {
+			id += "_" + strconv.FormatUint(uint64(index), 10)
+		}
+		used[id] = true
+		ids[index] = id
+	}
+	return ids
+}
+
+// identifier returns the identifier of the given name, its characters
+// that can't be part of an identifier being replaced by underscores.
+func identifier(name string) string {
+	b := []byte("$" + name)
+	for i := 1; i < len(b); i++ {
+		if !isIDChar(b[i]) {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 1 {
+		return "$_"
+	}
+	return string(b)
+}
+
+// isIDChar returns whether c may be part of an identifier.
+func isIDChar(c byte) bool {
+	switch {
+	case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	}
+	return c < 0x7f && strings.IndexByte("!#$%&'*+-./:<=>?@\\^_`|~", c) >= 0
+}
@@ -0,0 +1,1225 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package wat parses modules written in the WebAssembly text format, with
+// their folded expressions and symbolic identifiers, into modules of the
+// wasm package. The custom sections of a module are written with the
+// (@custom "name" "data") annotation.
+package wat
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// Parse parses the text module src, and reads its binary encoding with
+// wasm.ReadModule, which resolves its imports with resolve.
+func Parse(src []byte, resolve wasm.ResolveFunc) (*wasm.Module, error) {
+	code, err := Assemble(src)
+	if err != nil {
+		return nil, err
+	}
+	return wasm.ReadModule(bytes.NewReader(code), resolve)
+}
+
+// Assemble returns the binary encoding of the text module src, which is
+// either a module or the sequence of its fields. The errors of the text
+// are returned as an *Error.
+func Assemble(src []byte) (code []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			code, err = nil, e
+		}
+	}()
+
+	fields := parseSExprs(string(src))
+	if len(fields) == 1 && fields[0].is("module") {
+		fields = fields[0].list[1:]
+		if len(fields) != 0 && fields[0].kind == nodeID {
+			fields = fields[1:]
+		}
+	}
+	return assemble(fields)
+}
+
+// assemble returns the binary encoding of the module with the given
+// fields. The errors of the text are reported by panicking.
+func assemble(fields []*node) ([]byte, error) {
+	p := &parser{
+		module: &wasm.Module{Version: wasm.Version},
+		fields: make(map[*node]uint32),
+	}
+	p.parseModule(fields)
+
+	var buf bytes.Buffer
+	if err := p.module.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fail reports an error of the text at n.
+func fail(n *node, format string, args ...interface{}) {
+	panic(&Error{Line: n.line, Col: n.col, Msg: fmt.Sprintf(format, args...)})
+}
+
+// space is an index space of the module, such as its functions.
+type space struct {
+	kind  string
+	names map[string]uint32
+	count uint32
+}
+
+// define adds an entry named by id, which may be nil, to s, and returns
+// its index.
+func (s *space) define(id *node) uint32 {
+	index := s.count
+	s.count++
+	if id != nil {
+		if s.names == nil {
+			s.names = make(map[string]uint32)
+		}
+		if _, ok := s.names[id.atom]; ok {
+			fail(id, "duplicate %s %s", s.kind, id.atom)
+		}
+		s.names[id.atom] = index
+	}
+	return index
+}
+
+// index returns the index referenced by n, an identifier or a number.
+func (s *space) index(n *node) uint32 {
+	switch n.kind {
+	case nodeID:
+		index, ok := s.names[n.atom]
+		if !ok {
+			fail(n, "unknown %s %s", s.kind, n.atom)
+		}
+		return index
+	case nodeKeyword:
+		if index, ok := parseUint(n.atom, 32); ok {
+			return uint32(index)
+		}
+	}
+	fail(n, "expected a %s index, got %s", s.kind, n)
+	return 0
+}
+
+// cursor reads the items of a list in order.
+type cursor struct {
+	items  []*node
+	pos    int
+	parent *node // the list, for reporting its missing items
+}
+
+func newCursor(n *node, from int) *cursor {
+	return &cursor{items: n.list[from:], parent: n}
+}
+
+func (c *cursor) done() bool {
+	return c.pos >= len(c.items)
+}
+
+// peek returns the next item, or nil.
+func (c *cursor) peek() *node {
+	if c.done() {
+		return nil
+	}
+	return c.items[c.pos]
+}
+
+// next returns the next item, failing at the end of the list.
+func (c *cursor) next() *node {
+	if c.done() {
+		fail(c.parent, "unexpected end of %s", c.parent)
+	}
+	c.pos++
+	return c.items[c.pos-1]
+}
+
+// id returns the next item if it's an identifier, or nil.
+func (c *cursor) id() *node {
+	if n := c.peek(); n != nil && n.kind == nodeID {
+		c.pos++
+		return n
+	}
+	return nil
+}
+
+// list returns the next item if it's a list starting with head, or nil.
+func (c *cursor) list(head string) *node {
+	if n := c.peek(); n != nil && n.is(head) {
+		c.pos++
+		return n
+	}
+	return nil
+}
+
+// index returns the next item if it's an index, or nil.
+func (c *cursor) index() *node {
+	n := c.peek()
+	if n == nil || n.kind != nodeID && (n.kind != nodeKeyword || !isNumber(n.atom)) {
+		return nil
+	}
+	c.pos++
+	return n
+}
+
+// end fails if some items remain.
+func (c *cursor) end() {
+	if n := c.peek(); n != nil {
+		fail(n, "unexpected %s", n)
+	}
+}
+
+// parser builds a module from its text fields.
+type parser struct {
+	module *wasm.Module
+
+	types, funcs, tables, memories, globals, tags, elems, datas space
+	// the names of the fields of the struct types
+	fieldNames map[uint32]map[string]uint32
+	// the index of the fields defining or importing an entry
+	fields map[*node]uint32
+	// whether the code references the data segments
+	dataCount bool
+}
+
+// parseModule builds p.module from the fields of a module. The types are
+// defined first, then the imports, whose indices come first, and the
+// other entries, so that they can all be referenced by name.
+func (p *parser) parseModule(fields []*node) {
+	p.types.kind, p.funcs.kind, p.tables.kind, p.memories.kind = "type", "function", "table", "memory"
+	p.globals.kind, p.tags.kind, p.elems.kind, p.datas.kind = "global", "tag", "elem segment", "data segment"
+	p.module.Types = &wasm.SectionTypes{}
+
+	var types []*node
+	for _, field := range fields {
+		switch field.head() {
+		case "type":
+			types = append(types, field)
+		case "rec":
+			types = append(types, field.list[1:]...)
+		}
+	}
+	for _, t := range types {
+		if !t.is("type") {
+			fail(t, "expected a type, got %s", t)
+		}
+		p.types.define(newCursor(t, 1).id())
+	}
+	for _, t := range types {
+		p.parseType(t)
+	}
+
+	for _, field := range fields {
+		if field.kind != nodeList {
+			fail(field, "expected a module field, got %s", field)
+		}
+		if import_ := importOf(field); import_ != nil {
+			p.parseImport(field, import_)
+		}
+	}
+	for _, field := range fields {
+		switch field.head() {
+		case "type", "rec", "import", "export", "start":
+		case "func", "table", "memory", "global", "tag":
+			if importOf(field) == nil {
+				p.defineEntry(field)
+			}
+		case "elem":
+			p.fields[field] = p.elems.define(newCursor(field, 1).id())
+		case "data":
+			p.fields[field] = p.datas.define(newCursor(field, 1).id())
+		case "@custom":
+		default:
+			fail(field, "unknown module field %s", field)
+		}
+	}
+
+	for _, field := range fields {
+		switch field.head() {
+		case "func":
+			if importOf(field) == nil {
+				p.parseFunc(field)
+			}
+		case "table":
+			if importOf(field) == nil {
+				p.parseTableElems(field)
+			}
+		case "memory":
+			if importOf(field) == nil {
+				p.parseMemoryData(field)
+			}
+		case "global":
+			if importOf(field) == nil {
+				p.parseGlobal(field)
+			}
+		case "elem":
+			p.parseElem(field)
+		case "data":
+			p.parseData(field)
+		case "@custom":
+			p.parseCustom(field)
+		case "start":
+			if p.module.Start != nil {
+				fail(field, "duplicate start function")
+			}
+			c := newCursor(field, 1)
+			p.module.Start = &wasm.SectionStartFunction{Index: p.funcs.index(c.next())}
+			c.end()
+		}
+		p.parseExports(field)
+	}
+
+	m := p.module
+	if len(m.Types.Entries) == 0 {
+		m.Types = nil
+	}
+	if m.Code != nil {
+		for i := range m.Code.Bodies {
+			m.Code.Bodies[i].Module = m
+		}
+	}
+	if p.dataCount {
+		// memory.init and data.drop need the count of the data segments
+		m.DataCount = &wasm.SectionDataCount{Count: p.datas.count}
+	}
+}
+
+// importOf returns the import of a field, either an import field or the
+// inline import of a function, table, memory, global or tag, or nil.
+func importOf(field *node) *node {
+	if field.is("import") {
+		return field
+	}
+	switch field.head() {
+	case "func", "table", "memory", "global", "tag":
+		c := newCursor(field, 1)
+		c.id()
+		for c.list("export") != nil {
+		}
+		return c.list("import")
+	}
+	return nil
+}
+
+// parseImport adds the import of field to the module.
+func (p *parser) parseImport(field, import_ *node) {
+	c := newCursor(import_, 1)
+	entry := wasm.ImportEntry{ModuleName: p.name(c.next()), FieldName: p.name(c.next())}
+
+	desc, from := field, 1
+	if field == import_ {
+		desc = c.next()
+		if desc.kind != nodeList {
+			fail(desc, "expected an import description, got %s", desc)
+		}
+	}
+	c.end()
+
+	c = newCursor(desc, from)
+	id := c.id()
+	for c.list("export") != nil || c.list("import") != nil {
+	}
+	switch desc.head() {
+	case "func":
+		entry.Kind = wasm.ExternalFunction
+		entry.Type = wasm.FuncImport{Type: p.typeUse(c, nil)}
+		p.fields[field] = p.funcs.define(id)
+	case "table":
+		entry.Kind = wasm.ExternalTable
+		entry.Type = wasm.TableImport{Type: p.tableType(c)}
+		p.fields[field] = p.tables.define(id)
+	case "memory":
+		entry.Kind = wasm.ExternalMemory
+		entry.Type = wasm.MemoryImport{Type: wasm.Memory{Limits: p.limits(c, true)}}
+		p.fields[field] = p.memories.define(id)
+	case "global":
+		entry.Kind = wasm.ExternalGlobal
+		entry.Type = wasm.GlobalVarImport{Type: p.globalType(c.next())}
+		p.fields[field] = p.globals.define(id)
+	case "tag":
+		entry.Kind = wasm.ExternalTag
+		entry.Type = wasm.TagImport{Type: wasm.TagType{Type: p.typeUse(c, nil)}}
+		p.fields[field] = p.tags.define(id)
+	default:
+		fail(desc, "unknown import description %s", desc)
+	}
+	c.end()
+
+	if p.module.Import == nil {
+		p.module.Import = &wasm.SectionImports{}
+	}
+	p.module.Import.Entries = append(p.module.Import.Entries, entry)
+}
+
+// defineEntry adds the function, table, memory, global or tag defined by
+// field to the module, their contents being parsed once every entry is
+// defined.
+func (p *parser) defineEntry(field *node) {
+	m := p.module
+	c := newCursor(field, 1)
+	id := c.id()
+	for c.list("export") != nil {
+	}
+	switch field.head() {
+	case "func":
+		if m.Function == nil {
+			m.Function = &wasm.SectionFunctions{}
+			m.Code = &wasm.SectionCode{}
+		}
+		m.Function.Types = append(m.Function.Types, p.typeUse(c, nil))
+		m.Code.Bodies = append(m.Code.Bodies, wasm.FunctionBody{})
+		p.fields[field] = p.funcs.define(id)
+	case "table":
+		if m.Table == nil {
+			m.Table = &wasm.SectionTables{}
+		}
+		var table wasm.Table
+		if t, elem := p.tableElem(c); elem != nil {
+			// the elements of the table make an active segment
+			size := uint32(len(elem.list) - 1)
+			if len(elem.list) > 1 && elem.list[1].kind == nodeKeyword && elem.list[1].atom == "func" {
+				size--
+			}
+			table.ElementType = wasm.ElemType(t)
+			table.Limits = wasm.ResizableLimits{Flags: 1, Initial: size, Maximum: size}
+			p.elems.define(nil)
+		} else {
+			table = p.tableType(c)
+		}
+		c.end()
+		m.Table.Entries = append(m.Table.Entries, table)
+		p.fields[field] = p.tables.define(id)
+	case "memory":
+		if m.Memory == nil {
+			m.Memory = &wasm.SectionMemories{}
+		}
+		var memory wasm.Memory
+		if data, is64 := memoryData(c); data != nil {
+			// the data of the memory make an active segment
+			pages := uint32((len(p.strings(newCursor(data, 1))) + 65535) / 65536)
+			memory.Limits = wasm.ResizableLimits{Flags: 1, Initial: pages, Maximum: pages}
+			if is64 {
+				memory.Limits.Flags |= 0x4
+			}
+			p.datas.define(nil)
+		} else {
+			memory.Limits = p.limits(c, true)
+		}
+		c.end()
+		m.Memory.Entries = append(m.Memory.Entries, memory)
+		p.fields[field] = p.memories.define(id)
+	case "global":
+		if m.Global == nil {
+			m.Global = &wasm.SectionGlobals{}
+		}
+		t := p.globalType(c.next())
+		m.Global.Globals = append(m.Global.Globals, wasm.GlobalEntry{Type: &t})
+		// the initializer is parsed once the globals are defined
+		p.fields[field] = p.globals.define(id)
+	case "tag":
+		if m.Tag == nil {
+			m.Tag = &wasm.SectionTags{}
+		}
+		m.Tag.Entries = append(m.Tag.Entries, wasm.TagType{Type: p.typeUse(c, nil)})
+		c.end()
+		p.fields[field] = p.tags.define(id)
+	}
+}
+
+// parseExports adds the exports of field to the module: the ones of an
+// export field, or the inline exports of an entry it defines or imports.
+func (p *parser) parseExports(field *node) {
+	var names []*node
+	var kind wasm.External
+	var index uint32
+	if field.is("export") {
+		c := newCursor(field, 1)
+		names = append(names, c.next())
+		desc := c.next()
+		c.end()
+		dc := newCursor(desc, 1)
+		s, ok := p.externalSpace(desc.head())
+		if !ok {
+			fail(desc, "unknown export description %s", desc)
+		}
+		kind, index = s.kind, s.space.index(dc.next())
+		dc.end()
+	} else {
+		s, ok := p.externalSpace(field.head())
+		if !ok {
+			return
+		}
+		c := newCursor(field, 1)
+		c.id()
+		for export := c.list("export"); export != nil; export = c.list("export") {
+			ec := newCursor(export, 1)
+			names = append(names, ec.next())
+			ec.end()
+		}
+		kind, index = s.kind, p.fields[field]
+	}
+
+	m := p.module
+	for _, name := range names {
+		if m.Export == nil {
+			m.Export = &wasm.SectionExports{Entries: make(map[string]wasm.ExportEntry)}
+		}
+		s := p.name(name)
+		if _, ok := m.Export.Entries[s]; ok {
+			fail(name, "duplicate export %q", s)
+		}
+		m.Export.Entries[s] = wasm.ExportEntry{FieldStr: s, Kind: kind, Index: index}
+		m.Export.Names = append(m.Export.Names, s)
+	}
+}
+
+// externalSpace returns the kind and the index space of the entries
+// introduced by head.
+func (p *parser) externalSpace(head string) (s struct {
+	kind  wasm.External
+	space *space
+}, ok bool) {
+	switch head {
+	case "func":
+		s.kind, s.space = wasm.ExternalFunction, &p.funcs
+	case "table":
+		s.kind, s.space = wasm.ExternalTable, &p.tables
+	case "memory":
+		s.kind, s.space = wasm.ExternalMemory, &p.memories
+	case "global":
+		s.kind, s.space = wasm.ExternalGlobal, &p.globals
+	case "tag":
+		s.kind, s.space = wasm.ExternalTag, &p.tags
+	default:
+		return s, false
+	}
+	return s, true
+}
+
+// name returns the string of n, which must be valid UTF-8.
+func (p *parser) name(n *node) string {
+	if n.kind != nodeString {
+		fail(n, "expected a string, got %s", n)
+	}
+	s := string(n.str)
+	if !utf8.ValidString(s) {
+		fail(n, "invalid UTF-8 name")
+	}
+	return s
+}
+
+// strings returns the concatenation of the strings read by c.
+func (p *parser) strings(c *cursor) []byte {
+	var b []byte
+	for !c.done() {
+		n := c.next()
+		if n.kind != nodeString {
+			fail(n, "expected a string, got %s", n)
+		}
+		b = append(b, n.str...)
+	}
+	return b
+}
+
+// parseType parses a type field, whose index is already defined.
+func (p *parser) parseType(field *node) {
+	c := newCursor(field, 1)
+	c.id()
+	index := uint32(len(p.module.Types.Entries))
+	def := c.next()
+	c.end()
+
+	var sig wasm.FunctionSig
+	if def.is("sub") {
+		dc := newCursor(def, 1)
+		if n := dc.peek(); n != nil && n.kind == nodeKeyword && n.atom == "final" {
+			dc.next()
+		}
+		for n := dc.index(); n != nil; n = dc.index() {
+			sig.Supertypes = append(sig.Supertypes, p.types.index(n))
+		}
+		def = dc.next()
+		dc.end()
+	}
+
+	dc := newCursor(def, 1)
+	switch def.head() {
+	case "func":
+		sig.Form = int8(wasm.TypeFunc)
+		sig.ParamTypes, sig.ReturnTypes = p.signature(dc, nil)
+	case "struct":
+		sig.Form = int8(wasm.TypeStruct)
+		for !dc.done() {
+			f := dc.next()
+			if !f.is("field") {
+				fail(f, "expected a field, got %s", f)
+			}
+			fc := newCursor(f, 1)
+			if id := fc.id(); id != nil {
+				if p.fieldNames == nil {
+					p.fieldNames = make(map[uint32]map[string]uint32)
+				}
+				if p.fieldNames[index] == nil {
+					p.fieldNames[index] = make(map[string]uint32)
+				}
+				p.fieldNames[index][id.atom] = uint32(len(sig.Fields))
+				sig.Fields = append(sig.Fields, p.fieldType(fc.next()))
+				fc.end()
+				continue
+			}
+			for !fc.done() {
+				sig.Fields = append(sig.Fields, p.fieldType(fc.next()))
+			}
+		}
+	case "array":
+		sig.Form = int8(wasm.TypeArray)
+		sig.Fields = []wasm.FieldType{p.fieldType(dc.next())}
+	default:
+		fail(def, "unknown type %s", def)
+	}
+	dc.end()
+	p.module.Types.Entries = append(p.module.Types.Entries, sig)
+}
+
+// fieldType parses the type of a field of a struct or an array.
+func (p *parser) fieldType(n *node) wasm.FieldType {
+	var f wasm.FieldType
+	if n.is("mut") {
+		c := newCursor(n, 1)
+		n = c.next()
+		c.end()
+		f.Mutable = true
+	}
+	if n.kind == nodeKeyword && n.atom == "i8" {
+		f.Type = wasm.ValueTypeI8
+	} else if n.kind == nodeKeyword && n.atom == "i16" {
+		f.Type = wasm.ValueTypeI16
+	} else {
+		f.Type = p.valueType(n)
+	}
+	return f
+}
+
+// signature parses the parameters and results of a function type. The
+// names of the parameters are defined in locals if not nil.
+func (p *parser) signature(c *cursor, locals *space) (params, results []wasm.ValueType) {
+	for param := c.list("param"); param != nil; param = c.list("param") {
+		pc := newCursor(param, 1)
+		if id := pc.id(); id != nil {
+			if locals != nil {
+				locals.define(id)
+			}
+			params = append(params, p.valueType(pc.next()))
+			pc.end()
+			continue
+		}
+		for !pc.done() {
+			params = append(params, p.valueType(pc.next()))
+			if locals != nil {
+				locals.define(nil)
+			}
+		}
+	}
+	for result := c.list("result"); result != nil; result = c.list("result") {
+		rc := newCursor(result, 1)
+		for !rc.done() {
+			results = append(results, p.valueType(rc.next()))
+		}
+	}
+	return params, results
+}
+
+// typeUse parses a reference to a function type, (type $t), which may be
+// followed or replaced by its parameters and results, and returns its
+// index. A type not in the module is added to it.
+func (p *parser) typeUse(c *cursor, locals *space) uint32 {
+	if use := c.list("type"); use != nil {
+		uc := newCursor(use, 1)
+		index := p.types.index(uc.next())
+		uc.end()
+		if int(index) >= len(p.module.Types.Entries) {
+			fail(use, "unknown type %d", index)
+		}
+		sig := p.module.Types.Entries[index]
+		pos := c.pos
+		params, results := p.signature(c, locals)
+		if c.pos != pos && (!sameTypes(params, sig.ParamTypes) || !sameTypes(results, sig.ReturnTypes)) {
+			fail(use, "inline type doesn't match type %d", index)
+		}
+		if c.pos == pos && locals != nil {
+			for range sig.ParamTypes {
+				locals.define(nil)
+			}
+		}
+		return index
+	}
+	params, results := p.signature(c, locals)
+	return p.funcType(params, results)
+}
+
+// funcType returns the index of the function type with the given
+// parameters and results, which is added to the module if it has none.
+func (p *parser) funcType(params, results []wasm.ValueType) uint32 {
+	for i, sig := range p.module.Types.Entries {
+		if int(sig.Form) == wasm.TypeFunc && len(sig.Supertypes) == 0 &&
+			sameTypes(sig.ParamTypes, params) && sameTypes(sig.ReturnTypes, results) {
+			return uint32(i)
+		}
+	}
+	p.module.Types.Entries = append(p.module.Types.Entries, wasm.FunctionSig{
+		Form:        int8(wasm.TypeFunc),
+		ParamTypes:  params,
+		ReturnTypes: results,
+	})
+	p.types.count++
+	return uint32(len(p.module.Types.Entries) - 1)
+}
+
+func sameTypes(a, b []wasm.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// heapTypes are the abstract heap types, by name.
+var heapTypes = map[string]wasm.ValueType{
+	"func":     wasm.ValueTypeFuncref,
+	"extern":   wasm.ValueTypeExternref,
+	"any":      wasm.ValueTypeAnyref,
+	"eq":       wasm.ValueTypeEqref,
+	"i31":      wasm.ValueTypeI31ref,
+	"struct":   wasm.ValueTypeStructref,
+	"array":    wasm.ValueTypeArrayref,
+	"none":     wasm.ValueTypeNullref,
+	"noextern": wasm.ValueTypeNullexternref,
+	"nofunc":   wasm.ValueTypeNullfuncref,
+}
+
+// valueTypes are the value types named by a keyword.
+var valueTypes = map[string]wasm.ValueType{
+	"i32":  wasm.ValueTypeI32,
+	"i64":  wasm.ValueTypeI64,
+	"f32":  wasm.ValueTypeF32,
+	"f64":  wasm.ValueTypeF64,
+	"v128": wasm.ValueTypeV128,
+}
+
+func init() {
+	for name, t := range heapTypes {
+		if name == "none" || name == "noextern" || name == "nofunc" {
+			valueTypes["null"+strings.TrimPrefix(name, "no")+"ref"] = t
+			continue
+		}
+		valueTypes[name+"ref"] = t
+	}
+	// the former name of funcref
+	valueTypes["anyfunc"] = wasm.ValueTypeFuncref
+}
+
+// valueType parses a value type. The references to a type are read as its
+// index, whether they are nullable or not, like wasm.ReadValueType does.
+func (p *parser) valueType(n *node) wasm.ValueType {
+	if n.kind == nodeKeyword {
+		if t, ok := valueTypes[n.atom]; ok {
+			return t
+		}
+	}
+	if n.is("ref") {
+		t, _ := p.refType(n)
+		return t
+	}
+	fail(n, "expected a value type, got %s", n)
+	return 0
+}
+
+// refType parses a reference type (ref null? heaptype), and returns
+// whether it's nullable.
+func (p *parser) refType(n *node) (wasm.ValueType, bool) {
+	if n.kind == nodeKeyword {
+		if t, ok := valueTypes[n.atom]; ok && t.IsRef() {
+			return t, true
+		}
+		fail(n, "expected a reference type, got %s", n)
+	}
+	if !n.is("ref") {
+		fail(n, "expected a reference type, got %s", n)
+	}
+	c := newCursor(n, 1)
+	nullable := false
+	if m := c.peek(); m != nil && m.kind == nodeKeyword && m.atom == "null" {
+		c.next()
+		nullable = true
+	}
+	t := p.heapType(c.next())
+	c.end()
+	return t, nullable
+}
+
+// heapType parses an abstract heap type, or a type index.
+func (p *parser) heapType(n *node) wasm.ValueType {
+	if n.kind == nodeKeyword {
+		if t, ok := heapTypes[n.atom]; ok {
+			return t
+		}
+	}
+	return wasm.ValueType(p.types.index(n))
+}
+
+// globalType parses the type of a global, (mut t) for a mutable one.
+func (p *parser) globalType(n *node) wasm.GlobalVar {
+	if n.is("mut") {
+		c := newCursor(n, 1)
+		t := p.valueType(c.next())
+		c.end()
+		return wasm.GlobalVar{Type: t, Mutable: true}
+	}
+	return wasm.GlobalVar{Type: p.valueType(n)}
+}
+
+// limits parses the limits of a table or a memory, the index type i64 of
+// a 64-bit memory, and the shared flag of a memory.
+func (p *parser) limits(c *cursor, memory bool) wasm.ResizableLimits {
+	var l wasm.ResizableLimits
+	if n := c.peek(); memory && n != nil && n.kind == nodeKeyword && n.atom == "i64" {
+		c.next()
+		l.Flags |= 0x4
+	}
+	bits := 32
+	if l.Flags&0x4 != 0 {
+		bits = 64
+	}
+	n := c.next()
+	initial, ok := parseUint(n.atom, bits)
+	if n.kind != nodeKeyword || !ok || initial > math.MaxUint32 {
+		fail(n, "invalid limit %s", n)
+	}
+	l.Initial = uint32(initial)
+	if n := c.peek(); n != nil && n.kind == nodeKeyword && isNumber(n.atom) {
+		c.next()
+		max, ok := parseUint(n.atom, bits)
+		if !ok {
+			fail(n, "invalid limit %s", n)
+		}
+		if max > math.MaxUint32 {
+			max = math.MaxUint32
+		}
+		l.Flags |= 0x1
+		l.Maximum = uint32(max)
+	}
+	if n := c.peek(); memory && n != nil && n.kind == nodeKeyword && n.atom == "shared" {
+		c.next()
+		l.Flags |= 0x2
+	}
+	if pageSize := c.list("pagesize"); memory && pageSize != nil {
+		pc := newCursor(pageSize, 1)
+		n := pc.next()
+		size, ok := parseUint(n.atom, 32)
+		if !ok || size != 1 && size != 65536 {
+			fail(n, "invalid page size %s", n)
+		}
+		pc.end()
+		l.Flags |= 0x8
+		if size == 65536 {
+			l.PageSizeLog2 = 16
+		}
+	}
+	return l
+}
+
+// tableType parses the limits and the reference type of a table.
+func (p *parser) tableType(c *cursor) wasm.Table {
+	l := p.limits(c, false)
+	t, _ := p.refType(c.next())
+	return wasm.Table{ElementType: wasm.ElemType(t), Limits: l}
+}
+
+// isNumber returns whether s is a number.
+func isNumber(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// parseUint parses an unsigned integer of the given number of bits, with
+// an optional 0x prefix and underscores between its digits.
+func parseUint(s string, bits int) (uint64, bool) {
+	base := 10
+	if strings.HasPrefix(s, "0x") {
+		s, base = s[2:], 16
+	}
+	if s == "" || s[0] == '_' || s[len(s)-1] == '_' || strings.Contains(s, "__") {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(strings.Replace(s, "_", "", -1), base, bits)
+	return v, err == nil
+}
+
+// parseInt parses an integer of the given number of bits, either signed or
+// unsigned, and returns its bits.
+func parseInt(s string, bits int) (uint64, bool) {
+	negative := strings.HasPrefix(s, "-")
+	v, ok := parseUint(strings.TrimLeft(s, "+-"), 64)
+	if !ok || len(s) > 1 && (s[1] == '+' || s[1] == '-') {
+		return 0, false
+	}
+	if !negative {
+		return v, bits == 64 || v < 1<<uint(bits)
+	}
+	if v > 1<<uint(bits-1) {
+		return 0, false
+	}
+	v = -v
+	if bits < 64 {
+		v &= 1<<uint(bits) - 1
+	}
+	return v, true
+}
+
+// parseFloat parses a float of the given number of bits, either decimal
+// or hexadecimal, an infinity or a NaN with an optional payload, and
+// returns its bits.
+func parseFloat(n *node, bits int) uint64 {
+	s := n.atom
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	if len(n.atom)-len(s) > 1 {
+		fail(n, "invalid float %s", n)
+	}
+
+	mantissa := uint(52)
+	if bits == 32 {
+		mantissa = 23
+	}
+	exponent := uint64(1)<<uint(bits-1-int(mantissa)) - 1
+	var v uint64
+	switch {
+	case s == "inf":
+		v = exponent << mantissa
+	case s == "nan":
+		v = exponent<<mantissa | 1<<(mantissa-1)
+	case strings.HasPrefix(s, "nan:0x"):
+		payload, ok := parseUint(s[len("nan:"):], 64)
+		if !ok || payload == 0 || payload >= 1<<mantissa {
+			fail(n, "invalid NaN payload %s", n)
+		}
+		v = exponent<<mantissa | payload
+	default:
+		if s == "" || s[0] < '0' || s[0] > '9' || strings.Contains(s, "__") || strings.HasSuffix(s, "_") {
+			fail(n, "invalid float %s", n)
+		}
+		s = strings.Replace(s, "_", "", -1)
+		if strings.HasPrefix(s, "0x") && !strings.ContainsAny(s, "pP") {
+			s += "p0"
+		}
+		f, err := strconv.ParseFloat(s, bits)
+		if err != nil {
+			fail(n, "invalid float %s", n)
+		}
+		if bits == 32 {
+			v = uint64(math.Float32bits(float32(f)))
+		} else {
+			v = math.Float64bits(f)
+		}
+	}
+	if negative {
+		v |= 1 << uint(bits-1)
+	}
+	return v
+}
+
+// tableElem returns the reference type and the elements of a table
+// defined by its elements, or a nil list.
+func (p *parser) tableElem(c *cursor) (wasm.ValueType, *node) {
+	if len(c.items)-c.pos != 2 || !c.items[c.pos+1].is("elem") {
+		return 0, nil
+	}
+	t, _ := p.refType(c.next())
+	return t, c.next()
+}
+
+// memoryData returns the data of a memory defined by its data, or nil,
+// and whether the memory is a 64-bit one.
+func memoryData(c *cursor) (*node, bool) {
+	rest := c.items[c.pos:]
+	is64 := len(rest) == 2 && rest[0].kind == nodeKeyword && rest[0].atom == "i64"
+	if is64 {
+		rest = rest[1:]
+	}
+	if len(rest) != 1 || !rest[0].is("data") {
+		return nil, false
+	}
+	c.pos = len(c.items)
+	return rest[0], is64
+}
+
+// definedIndex returns the index of the entry defined by field among the
+// entries defined by the module, which follow the imported ones.
+func (p *parser) definedIndex(field *node, s *space, defined int) int {
+	return int(p.fields[field]) - (int(s.count) - defined)
+}
+
+// parseFunc parses the locals and the body of a function.
+func (p *parser) parseFunc(field *node) {
+	m := p.module
+	c := newCursor(field, 1)
+	c.id()
+	for c.list("export") != nil {
+	}
+	f := p.newFunc()
+	p.typeUse(c, &f.locals)
+
+	body := &m.Code.Bodies[p.definedIndex(field, &p.funcs, len(m.Code.Bodies))]
+	for local := c.list("local"); local != nil; local = c.list("local") {
+		lc := newCursor(local, 1)
+		id := lc.id()
+		for !lc.done() {
+			t := p.valueType(lc.next())
+			f.locals.define(id)
+			if n := len(body.Locals); n != 0 && body.Locals[n-1].Type == t {
+				body.Locals[n-1].Count++
+			} else {
+				body.Locals = append(body.Locals, wasm.LocalEntry{Count: 1, Type: t})
+			}
+			if id != nil {
+				break
+			}
+		}
+		lc.end()
+	}
+
+	f.instrs(c)
+	if len(f.labels) != 0 {
+		fail(field, "unclosed block")
+	}
+	body.Code = f.out.Bytes()
+}
+
+// parseGlobal parses the initializer of a global.
+func (p *parser) parseGlobal(field *node) {
+	m := p.module
+	c := newCursor(field, 1)
+	c.id()
+	for c.list("export") != nil {
+	}
+	c.next()
+	m.Global.Globals[p.definedIndex(field, &p.globals, len(m.Global.Globals))].Init = p.constExpr(c)
+}
+
+// constExpr parses the instructions read by c as a constant expression,
+// which ends with an end operator.
+func (p *parser) constExpr(c *cursor) []byte {
+	f := p.newFunc()
+	f.instrs(c)
+	f.out.WriteByte(ops.End)
+	return f.out.Bytes()
+}
+
+// offset parses the offset of an active segment, either an (offset ...)
+// list or a folded instruction.
+func (p *parser) offset(n *node) []byte {
+	if n.is("offset") {
+		return p.constExpr(newCursor(n, 1))
+	}
+	return p.constExpr(&cursor{items: []*node{n}, parent: n})
+}
+
+// parseTableElems adds the segment of the elements of a table defined by
+// them.
+func (p *parser) parseTableElems(field *node) {
+	c := newCursor(field, 1)
+	c.id()
+	for c.list("export") != nil {
+	}
+	t, elem := p.tableElem(c)
+	if elem == nil {
+		return
+	}
+	segment := wasm.ElementSegment{
+		Mode:   wasm.SegmentActive,
+		Index:  p.fields[field],
+		Offset: []byte{ops.I32Const, 0, ops.End},
+		Type:   t,
+	}
+	ec := newCursor(elem, 1)
+	if n := ec.peek(); n != nil && n.kind == nodeKeyword && n.atom == "func" {
+		ec.next()
+	}
+	exprs := !ec.done() && ec.peek().kind == nodeList
+	segment.Elems, segment.Exprs = p.elemList(ec, exprs)
+	p.addElem(segment)
+}
+
+// parseElem parses an element segment.
+func (p *parser) parseElem(field *node) {
+	c := newCursor(field, 1)
+	c.id()
+	segment := wasm.ElementSegment{Mode: wasm.SegmentPassive, Type: wasm.ValueTypeFuncref}
+	if n := c.peek(); n != nil && n.kind == nodeKeyword && n.atom == "declare" {
+		c.next()
+		segment.Mode = wasm.SegmentDeclarative
+	} else {
+		if table := c.list("table"); table != nil {
+			tc := newCursor(table, 1)
+			segment.Index = p.tables.index(tc.next())
+			tc.end()
+			segment.Mode = wasm.SegmentActive
+		}
+		if n := c.peek(); segment.Mode == wasm.SegmentActive || n != nil && n.kind == nodeList && !n.is("ref") {
+			segment.Mode = wasm.SegmentActive
+			segment.Offset = p.offset(c.next())
+		}
+	}
+
+	exprs := false
+	switch n := c.peek(); {
+	case n == nil:
+	case n.kind == nodeKeyword && n.atom == "func":
+		c.next()
+	case n.is("ref") || n.kind == nodeKeyword && !isNumber(n.atom):
+		segment.Type, _ = p.refType(c.next())
+		exprs = true
+	case segment.Mode != wasm.SegmentActive:
+		fail(n, "expected an element type, got %s", n)
+	}
+	segment.Elems, segment.Exprs = p.elemList(c, exprs)
+	p.addElem(segment)
+}
+
+// elemList parses the elements of a segment, either function indices, or
+// the expressions ref.func and ref.null if exprs is set.
+func (p *parser) elemList(c *cursor, exprs bool) ([]uint32, bool) {
+	var elems []uint32
+	for !c.done() {
+		n := c.next()
+		if !exprs {
+			elems = append(elems, p.funcs.index(n))
+			continue
+		}
+		instr := n
+		if n.is("item") {
+			ic := newCursor(n, 1)
+			instr = ic.next()
+			if instr.kind == nodeKeyword {
+				// a plain instruction
+				instr = &node{kind: nodeList, line: instr.line, col: instr.col, list: n.list[1:]}
+			} else {
+				ic.end()
+			}
+		}
+		ic := newCursor(instr, 1)
+		switch instr.head() {
+		case "ref.func":
+			elems = append(elems, p.funcs.index(ic.next()))
+		case "ref.null":
+			p.heapType(ic.next())
+			elems = append(elems, uint32(wasm.NullRef))
+		default:
+			fail(n, "unsupported element expression %s", n)
+		}
+		ic.end()
+	}
+	return elems, exprs
+}
+
+func (p *parser) addElem(segment wasm.ElementSegment) {
+	if p.module.Elements == nil {
+		p.module.Elements = &wasm.SectionElements{}
+	}
+	p.module.Elements.Entries = append(p.module.Elements.Entries, segment)
+}
+
+// parseMemoryData adds the segment of the data of a memory defined by
+// them.
+func (p *parser) parseMemoryData(field *node) {
+	c := newCursor(field, 1)
+	c.id()
+	for c.list("export") != nil {
+	}
+	data, is64 := memoryData(c)
+	if data == nil {
+		return
+	}
+	segment := wasm.DataSegment{
+		Mode:   wasm.SegmentActive,
+		Index:  p.fields[field],
+		Offset: []byte{ops.I32Const, 0, ops.End},
+		Data:   p.strings(newCursor(data, 1)),
+	}
+	if is64 {
+		segment.Offset[0] = ops.I64Const
+	}
+	p.addData(segment)
+}
+
+// parseData parses a data segment.
+func (p *parser) parseData(field *node) {
+	c := newCursor(field, 1)
+	c.id()
+	segment := wasm.DataSegment{Mode: wasm.SegmentPassive}
+	if memory := c.list("memory"); memory != nil {
+		mc := newCursor(memory, 1)
+		segment.Index = p.memories.index(mc.next())
+		mc.end()
+		segment.Mode = wasm.SegmentActive
+	}
+	if n := c.peek(); segment.Mode == wasm.SegmentActive || n != nil && n.kind == nodeList {
+		segment.Mode = wasm.SegmentActive
+		segment.Offset = p.offset(c.next())
+	}
+	segment.Data = p.strings(c)
+	p.addData(segment)
+}
+
+// parseCustom parses a custom section annotation, (@custom "name" "data"),
+// whose section follows the other sections of the module.
+func (p *parser) parseCustom(field *node) {
+	c := newCursor(field, 1)
+	name := c.next()
+	if name.kind != nodeString {
+		fail(name, "expected the name of a custom section, got %s", name)
+	}
+	if n := c.peek(); n != nil && n.kind == nodeList {
+		fail(n, "the placement of custom sections isn't supported")
+	}
+	p.module.AddCustomSection(string(name.str), p.strings(c))
+}
+
+func (p *parser) addData(segment wasm.DataSegment) {
+	if p.module.Data == nil {
+		p.module.Data = &wasm.SectionData{}
+	}
+	p.module.Data.Entries = append(p.module.Data.Entries, segment)
+}
@@ -0,0 +1,759 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+	ops "github.com/bottos-project/bottos/vm/wasm/wasm/operators"
+)
+
+// PrintError is returned by Print for a module whose code can't be
+// decoded.
+type PrintError struct {
+	Function int // the index of the function, or -1 for an expression
+	Offset   int // the offset of the instruction in the code
+	Reason   string
+}
+
+func (e PrintError) Error() string {
+	if e.Function < 0 {
+		return fmt.Sprintf("wat: expression at offset %d: %s", e.Offset, e.Reason)
+	}
+	return fmt.Sprintf("wat: function %d at offset %d: %s", e.Function, e.Offset, e.Reason)
+}
+
+// Print returns the text of module m, one field per entry, the code of
+// its functions being unfolded. The entries are referenced by the names
+// of the name section of m, or by their index, which is given in a
+// comment of the unnamed ones.
+func Print(m *wasm.Module) ([]byte, error) {
+	p := &printer{m: m, names: readNames(m)}
+	if err := p.module(); err != nil {
+		return nil, err
+	}
+	return p.buf.Bytes(), nil
+}
+
+type printer struct {
+	m     *wasm.Module
+	names *names
+	buf   bytes.Buffer
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&p.buf, format, args...)
+}
+
+// ref returns the reference to the entry at index in the space named by
+// the names subsection id.
+func (p *printer) ref(id wasm.NameSubsection, index uint32) string {
+	if name, ok := p.names.entries[id][index]; ok {
+		return name
+	}
+	return strconv.FormatUint(uint64(index), 10)
+}
+
+// def returns the identifier of the entry at index, or its index in a
+// comment.
+func (p *printer) def(id wasm.NameSubsection, index uint32) string {
+	if name, ok := p.names.entries[id][index]; ok {
+		return " " + name
+	}
+	return fmt.Sprintf(" (;%d;)", index)
+}
+
+// funcDef returns the identifier of the function at index like def,
+// followed by its readable name in a comment if its name is mangled.
+func (p *printer) funcDef(index uint32) string {
+	def := p.def(wasm.NamesFunctions, index)
+	if name, ok := p.names.demangled[index]; ok {
+		// the comments nest
+		name = strings.NewReplacer("(;", "( ;", ";)", "; )").Replace(name)
+		def += " (;" + name + ";)"
+	}
+	return def
+}
+
+func (p *printer) module() error {
+	m := p.m
+	p.printf("(module")
+	if p.names.module != "" {
+		p.printf(" %s", p.names.module)
+	}
+	p.printf("\n")
+
+	if m.Types != nil {
+		for i, sig := range m.Types.Entries {
+			p.printf("  (type%s %s)\n", p.def(wasm.NamesTypes, uint32(i)), p.typeDef(uint32(i), sig))
+		}
+	}
+
+	var funcs, tables, memories, globals, tags uint32
+	if m.Import != nil {
+		for _, entry := range m.Import.Entries {
+			p.printf("  (import %s %s ", quote([]byte(entry.ModuleName)), quote([]byte(entry.FieldName)))
+			switch t := entry.Type.(type) {
+			case wasm.FuncImport:
+				p.printf("(func%s (type %s))", p.funcDef(funcs), p.ref(wasm.NamesTypes, t.Type))
+				funcs++
+			case wasm.TableImport:
+				p.printf("(table%s %s)", p.def(wasm.NamesTables, tables), p.tableType(t.Type))
+				tables++
+			case wasm.MemoryImport:
+				p.printf("(memory%s %s)", p.def(wasm.NamesMemories, memories), limits(t.Type.Limits, true))
+				memories++
+			case wasm.GlobalVarImport:
+				p.printf("(global%s %s)", p.def(wasm.NamesGlobals, globals), p.globalType(t.Type))
+				globals++
+			case wasm.TagImport:
+				p.printf("(tag%s (type %s))", p.def(wasm.NamesTags, tags), p.ref(wasm.NamesTypes, t.Type.Type))
+				tags++
+			}
+			p.printf(")\n")
+		}
+	}
+
+	if m.Function != nil {
+		if m.Code == nil || len(m.Code.Bodies) != len(m.Function.Types) {
+			return PrintError{Function: -1, Offset: -1, Reason: "function and code section sizes differ"}
+		}
+		for i, t := range m.Function.Types {
+			if err := m.Code.Bodies[i].Decode(); err != nil {
+				return PrintError{Function: int(funcs) + i, Reason: err.Error()}
+			}
+			if err := p.function(funcs+uint32(i), t, m.Code.Bodies[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if m.Table != nil {
+		for i, table := range m.Table.Entries {
+			p.printf("  (table%s %s)\n", p.def(wasm.NamesTables, tables+uint32(i)), p.tableType(table))
+		}
+	}
+	if m.Memory != nil {
+		for i, memory := range m.Memory.Entries {
+			p.printf("  (memory%s %s)\n", p.def(wasm.NamesMemories, memories+uint32(i)), limits(memory.Limits, true))
+		}
+	}
+	if m.Tag != nil {
+		for i, tag := range m.Tag.Entries {
+			p.printf("  (tag%s (type %s))\n", p.def(wasm.NamesTags, tags+uint32(i)), p.ref(wasm.NamesTypes, tag.Type))
+		}
+	}
+	if m.Global != nil {
+		for i, global := range m.Global.Globals {
+			init, err := p.expr(global.Init, false)
+			if err != nil {
+				return err
+			}
+			p.printf("  (global%s %s %s)\n", p.def(wasm.NamesGlobals, globals+uint32(i)), p.globalType(*global.Type), init)
+		}
+	}
+
+	for _, export := range m.Exports() {
+		var kind string
+		var id wasm.NameSubsection
+		switch export.Kind {
+		case wasm.ExternalFunction:
+			kind, id = "func", wasm.NamesFunctions
+		case wasm.ExternalTable:
+			kind, id = "table", wasm.NamesTables
+		case wasm.ExternalMemory:
+			kind, id = "memory", wasm.NamesMemories
+		case wasm.ExternalGlobal:
+			kind, id = "global", wasm.NamesGlobals
+		case wasm.ExternalTag:
+			kind, id = "tag", wasm.NamesTags
+		}
+		p.printf("  (export %s (%s %s))\n", quote([]byte(export.FieldStr)), kind, p.ref(id, export.Index))
+	}
+	if m.Start != nil {
+		p.printf("  (start %s)\n", p.ref(wasm.NamesFunctions, m.Start.Index))
+	}
+
+	if m.Elements != nil {
+		for i, segment := range m.Elements.Entries {
+			if err := p.elem(uint32(i), segment); err != nil {
+				return err
+			}
+		}
+	}
+	if m.Data != nil {
+		for i, segment := range m.Data.Entries {
+			p.printf("  (data%s", p.def(wasm.NamesData, uint32(i)))
+			if segment.Mode == wasm.SegmentActive {
+				if segment.Index != 0 {
+					p.printf(" (memory %s)", p.ref(wasm.NamesMemories, segment.Index))
+				}
+				offset, err := p.expr(segment.Offset, true)
+				if err != nil {
+					return err
+				}
+				p.printf(" %s", offset)
+			}
+			p.printf(" %s)\n", quote(segment.Data))
+		}
+	}
+	p.printf(")\n")
+	return nil
+}
+
+// typeDef returns the definition of the type at index.
+func (p *printer) typeDef(index uint32, sig wasm.FunctionSig) string {
+	var def string
+	switch {
+	case sig.IsStruct():
+		def = "(struct"
+		for i, field := range sig.Fields {
+			def += " (field"
+			if name, ok := p.names.indirect[wasm.NamesFields][index][uint32(i)]; ok {
+				def += " " + name
+			}
+			def += " " + p.fieldType(field) + ")"
+		}
+		def += ")"
+	case sig.IsArray():
+		def = "(array " + p.fieldType(sig.Fields[0]) + ")"
+	default:
+		def = "(func" + p.valueTypes(" (param", sig.ParamTypes) + p.valueTypes(" (result", sig.ReturnTypes) + ")"
+	}
+	if len(sig.Supertypes) == 0 {
+		return def
+	}
+	sub := "(sub"
+	for _, super := range sig.Supertypes {
+		sub += " " + p.ref(wasm.NamesTypes, super)
+	}
+	return sub + " " + def + ")"
+}
+
+func (p *printer) fieldType(f wasm.FieldType) string {
+	t := "i8"
+	switch f.Type {
+	case wasm.ValueTypeI16:
+		t = "i16"
+	case wasm.ValueTypeI8:
+	default:
+		t = p.valueType(f.Type)
+	}
+	if f.Mutable {
+		return "(mut " + t + ")"
+	}
+	return t
+}
+
+// valueTypes returns the list of the given types starting with head, or
+// nothing if there are none.
+func (p *printer) valueTypes(head string, types []wasm.ValueType) string {
+	if len(types) == 0 {
+		return ""
+	}
+	s := head
+	for _, t := range types {
+		s += " " + p.valueType(t)
+	}
+	return s + ")"
+}
+
+// typeNames are the names of the value types.
+var typeNames = make(map[wasm.ValueType]string)
+
+// heapTypeNames are the names of the abstract heap types.
+var heapTypeNames = make(map[wasm.ValueType]string)
+
+func init() {
+	for name, t := range valueTypes {
+		if name != "anyfunc" {
+			typeNames[t] = name
+		}
+	}
+	for name, t := range heapTypes {
+		heapTypeNames[t] = name
+	}
+}
+
+func (p *printer) valueType(t wasm.ValueType) string {
+	if t >= 0 {
+		return "(ref null " + p.ref(wasm.NamesTypes, uint32(t)) + ")"
+	}
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("(;invalid type %d;)", t)
+}
+
+func (p *printer) heapType(t wasm.ValueType) string {
+	if t >= 0 {
+		return p.ref(wasm.NamesTypes, uint32(t))
+	}
+	if name, ok := heapTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("(;invalid heap type %d;)", t)
+}
+
+func (p *printer) globalType(t wasm.GlobalVar) string {
+	if t.Mutable {
+		return "(mut " + p.valueType(t.Type) + ")"
+	}
+	return p.valueType(t.Type)
+}
+
+func (p *printer) tableType(t wasm.Table) string {
+	return limits(t.Limits, false) + " " + p.valueType(wasm.ValueType(t.ElementType))
+}
+
+// limits returns the limits of a table or a memory.
+func limits(l wasm.ResizableLimits, memory bool) string {
+	var s string
+	if memory && l.Flags&0x4 != 0 {
+		s = "i64 "
+	}
+	s += strconv.FormatUint(uint64(l.Initial), 10)
+	if l.Flags&0x1 != 0 {
+		s += " " + strconv.FormatUint(uint64(l.Maximum), 10)
+	}
+	if memory && l.Flags&0x2 != 0 {
+		s += " shared"
+	}
+	if memory && l.Flags&0x8 != 0 {
+		s += fmt.Sprintf(" (pagesize %d)", l.PageSize())
+	}
+	return s
+}
+
+// function prints the function at index, of type t.
+func (p *printer) function(index, t uint32, body wasm.FunctionBody) error {
+	m := p.m
+	if m.Types == nil || int(t) >= len(m.Types.Entries) {
+		return PrintError{Function: int(index), Offset: -1, Reason: fmt.Sprintf("unknown type %d", t)}
+	}
+	sig := m.Types.Entries[t]
+	locals := p.names.indirect[wasm.NamesLocals][index]
+
+	p.printf("  (func%s (type %s)", p.funcDef(index), p.ref(wasm.NamesTypes, t))
+	if len(locals) == 0 {
+		p.printf("%s", p.valueTypes(" (param", sig.ParamTypes))
+	} else {
+		for i, param := range sig.ParamTypes {
+			if name, ok := locals[uint32(i)]; ok {
+				p.printf(" (param %s %s)", name, p.valueType(param))
+			} else {
+				p.printf(" (param %s)", p.valueType(param))
+			}
+		}
+	}
+	p.printf("%s", p.valueTypes(" (result", sig.ReturnTypes))
+
+	var types []wasm.ValueType
+	for _, entry := range body.Locals {
+		for i := uint32(0); i < entry.Count; i++ {
+			types = append(types, entry.Type)
+		}
+	}
+	if len(locals) == 0 {
+		if len(types) != 0 {
+			p.printf("\n    %s", p.valueTypes("(local", types))
+		}
+	} else {
+		for i, local := range types {
+			if name, ok := locals[uint32(len(sig.ParamTypes)+i)]; ok {
+				p.printf("\n    (local %s %s)", name, p.valueType(local))
+			} else {
+				p.printf("\n    (local %s)", p.valueType(local))
+			}
+		}
+	}
+
+	c := &codeReader{Reader: bytes.NewReader(body.Code)}
+	depth := 0
+	for c.Len() > 0 {
+		offset := len(body.Code) - c.Len()
+		text, nesting := p.instr(c, locals)
+		if c.err != nil {
+			return PrintError{Function: int(index), Offset: offset, Reason: c.err.Error()}
+		}
+		switch nesting {
+		case nestEnd:
+			depth--
+		case nestMiddle:
+			depth--
+		}
+		if depth < 0 {
+			return PrintError{Function: int(index), Offset: offset, Reason: "unbalanced " + text}
+		}
+		p.printf("\n    %s%s", strings.Repeat("  ", depth), text)
+		if nesting == nestBegin || nesting == nestMiddle {
+			depth++
+		}
+	}
+	p.printf(")\n")
+	return nil
+}
+
+// expr returns the constant expression expr, folded if it's a single
+// instruction, or otherwise unfolded in an (offset ...) list for the
+// offset of a segment.
+func (p *printer) expr(expr []byte, offset bool) (string, error) {
+	c := &codeReader{Reader: bytes.NewReader(expr)}
+	var instrs []string
+	for c.Len() > 0 {
+		at := len(expr) - c.Len()
+		text, nesting := p.instr(c, nil)
+		if c.err != nil {
+			return "", PrintError{Function: -1, Offset: at, Reason: c.err.Error()}
+		}
+		if nesting == nestEnd && c.Len() == 0 {
+			break
+		}
+		instrs = append(instrs, text)
+	}
+	switch {
+	case len(instrs) == 1:
+		return "(" + instrs[0] + ")", nil
+	case offset:
+		return "(offset " + strings.Join(instrs, " ") + ")", nil
+	}
+	return strings.Join(instrs, " "), nil
+}
+
+// elem prints the element segment at index.
+func (p *printer) elem(index uint32, segment wasm.ElementSegment) error {
+	p.printf("  (elem%s", p.def(wasm.NamesElements, index))
+	switch segment.Mode {
+	case wasm.SegmentActive:
+		if segment.Index != 0 {
+			p.printf(" (table %s)", p.ref(wasm.NamesTables, segment.Index))
+		}
+		offset, err := p.expr(segment.Offset, true)
+		if err != nil {
+			return err
+		}
+		p.printf(" %s", offset)
+	case wasm.SegmentDeclarative:
+		p.printf(" declare")
+	}
+	if !segment.Exprs {
+		p.printf(" func")
+		for _, elem := range segment.Elems {
+			p.printf(" %s", p.ref(wasm.NamesFunctions, elem))
+		}
+		p.printf(")\n")
+		return nil
+	}
+	p.printf(" %s", p.valueType(segment.Type))
+	for _, elem := range segment.Elems {
+		if elem == uint32(wasm.NullRef) {
+			p.printf(" (ref.null %s)", p.heapType(segment.Type))
+		} else {
+			p.printf(" (ref.func %s)", p.ref(wasm.NamesFunctions, elem))
+		}
+	}
+	p.printf(")\n")
+	return nil
+}
+
+// quote returns the string literal of b, its non-printable characters
+// being escaped.
+func quote(b []byte) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, c := range b {
+		if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			fmt.Fprintf(&buf, "\\%02x", c)
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// codeReader reads the code of a function, keeping the first error.
+type codeReader struct {
+	*bytes.Reader
+	err error
+}
+
+func (c *codeReader) fail(err error) {
+	if c.err == nil && err != nil {
+		c.err = err
+	}
+}
+
+func (c *codeReader) byte() byte {
+	b, err := c.ReadByte()
+	c.fail(err)
+	return b
+}
+
+func (c *codeReader) u32() uint32 {
+	v, err := leb128.ReadVarUint32(c)
+	c.fail(err)
+	return v
+}
+
+func (c *codeReader) u64() uint64 {
+	v, err := leb128.ReadVarUint64(c)
+	c.fail(err)
+	return v
+}
+
+func (c *codeReader) s64() int64 {
+	v, err := leb128.ReadVarint64(c)
+	c.fail(err)
+	return v
+}
+
+func (c *codeReader) bytes(n int) []byte {
+	b := make([]byte, n)
+	if read, _ := c.Read(b); read != n {
+		c.fail(io.ErrUnexpectedEOF)
+	}
+	return b
+}
+
+// How an instruction changes the nesting of the blocks.
+const (
+	nestNone   = iota
+	nestBegin  // block, loop, if and try
+	nestMiddle // else, catch and catch_all
+	nestEnd    // end and delegate
+)
+
+// instr returns the text of the instruction read by c, and how it
+// changes the nesting of the blocks. The locals are named by locals.
+func (p *printer) instr(c *codeReader, locals map[uint32]string) (string, int) {
+	code := c.byte()
+	var sub uint32
+	if isPrefix(code) {
+		sub = c.u32()
+	}
+	if c.err != nil {
+		return "", nestNone
+	}
+
+	switch {
+	case code == ops.SelectTyped:
+		types := make([]wasm.ValueType, c.u32())
+		for i := range types {
+			types[i] = p.readValueType(c)
+		}
+		return "select" + p.valueTypes(" (result", types), nestNone
+	case code == ops.PrefixGC && (sub == ops.RefTestNull || sub == ops.RefCastNull):
+		in := opcodes[opcode(code, sub-1)]
+		return in.name + " (ref null " + p.heapType(wasm.ValueType(c.s64())) + ")", nestNone
+	}
+	in, ok := opcodes[opcode(code, sub)]
+	if !ok {
+		c.fail(fmt.Errorf("unknown opcode %#x %#x", code, sub))
+		return "", nestNone
+	}
+
+	text := []string{in.name}
+	nesting := nestNone
+	switch in.code {
+	case ops.Else, ops.Catch, ops.CatchAll:
+		nesting = nestMiddle
+	case ops.End, ops.Delegate:
+		nesting = nestEnd
+	}
+
+	add := func(s string) {
+		text = append(text, s)
+	}
+	u32 := func() string {
+		return strconv.FormatUint(uint64(c.u32()), 10)
+	}
+	switch in.imm {
+	case immBlock:
+		nesting = nestBegin
+		switch bt := c.s64(); {
+		case bt == -0x40:
+		case bt == -0x1d || bt == -0x1c:
+			// a reference to a type, which is read as nullable
+			add("(result (ref null " + p.heapType(wasm.ValueType(c.s64())) + "))")
+		case bt < 0:
+			add("(result " + p.valueType(wasm.ValueType(bt)) + ")")
+		default:
+			add("(type " + p.ref(wasm.NamesTypes, uint32(bt)) + ")")
+		}
+	case immLabel:
+		add(u32())
+	case immBrTable:
+		n := c.u32()
+		for i := uint32(0); i <= n && c.err == nil; i++ {
+			add(u32())
+		}
+	case immFunc:
+		add(p.ref(wasm.NamesFunctions, c.u32()))
+	case immCallIndirect:
+		t, table := c.u32(), c.u32()
+		if table != 0 {
+			add(p.ref(wasm.NamesTables, table))
+		}
+		add("(type " + p.ref(wasm.NamesTypes, t) + ")")
+	case immType:
+		add(p.ref(wasm.NamesTypes, c.u32()))
+	case immLocal:
+		index := c.u32()
+		if name, ok := locals[index]; ok {
+			add(name)
+		} else {
+			add(strconv.FormatUint(uint64(index), 10))
+		}
+	case immGlobal:
+		add(p.ref(wasm.NamesGlobals, c.u32()))
+	case immTable:
+		if index := c.u32(); index != 0 {
+			add(p.ref(wasm.NamesTables, index))
+		}
+	case immMemory:
+		if index := c.u32(); index != 0 {
+			add(p.ref(wasm.NamesMemories, index))
+		}
+	case immElem:
+		add(p.ref(wasm.NamesElements, c.u32()))
+	case immData:
+		add(p.ref(wasm.NamesData, c.u32()))
+	case immTag:
+		add(p.ref(wasm.NamesTags, c.u32()))
+	case immTableInit, immMemoryInit:
+		segments, s := wasm.NamesElements, wasm.NamesTables
+		if in.imm == immMemoryInit {
+			segments, s = wasm.NamesData, wasm.NamesMemories
+		}
+		segment, index := c.u32(), c.u32()
+		if index != 0 {
+			add(p.ref(s, index))
+		}
+		add(p.ref(segments, segment))
+	case immTableCopy, immMemoryCopy:
+		s := wasm.NamesTables
+		if in.imm == immMemoryCopy {
+			s = wasm.NamesMemories
+		}
+		if dst, src := c.u32(), c.u32(); dst != 0 || src != 0 {
+			add(p.ref(s, dst))
+			add(p.ref(s, src))
+		}
+	case immMemArg, immMemArgLane:
+		flags := c.u32()
+		if flags&0x40 != 0 {
+			// an explicit memory index
+			flags &^= 0x40
+			add(p.ref(wasm.NamesMemories, c.u32()))
+		}
+		if offset := c.u64(); offset != 0 {
+			add("offset=" + strconv.FormatUint(offset, 10))
+		}
+		if flags != in.align && flags < 64 {
+			add("align=" + strconv.FormatUint(1<<flags, 10))
+		}
+		if in.imm == immMemArgLane {
+			add(strconv.Itoa(int(c.byte())))
+		}
+	case immI32:
+		v, err := leb128.ReadVarint32(c)
+		c.fail(err)
+		add(strconv.FormatInt(int64(v), 10))
+	case immI64:
+		add(strconv.FormatInt(c.s64(), 10))
+	case immF32:
+		add(formatFloat(uint64(binary.LittleEndian.Uint32(c.bytes(4))), 32))
+	case immF64:
+		add(formatFloat(binary.LittleEndian.Uint64(c.bytes(8)), 64))
+	case immHeapType:
+		add(p.heapType(wasm.ValueType(c.s64())))
+	case immV128:
+		b := c.bytes(16)
+		add("i32x4")
+		for i := 0; i < 16; i += 4 {
+			add(fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(b[i:])))
+		}
+	case immShuffle:
+		for _, lane := range c.bytes(16) {
+			add(strconv.Itoa(int(lane)))
+		}
+	case immLane:
+		add(strconv.Itoa(int(c.byte())))
+	case immFence:
+		c.byte()
+	case immField:
+		t, field := c.u32(), c.u32()
+		add(p.ref(wasm.NamesTypes, t))
+		if name, ok := p.names.indirect[wasm.NamesFields][t][field]; ok {
+			add(name)
+		} else {
+			add(strconv.FormatUint(uint64(field), 10))
+		}
+	case immTypeCount:
+		add(p.ref(wasm.NamesTypes, c.u32()))
+		add(u32())
+	case immTypes:
+		add(p.ref(wasm.NamesTypes, c.u32()))
+		add(p.ref(wasm.NamesTypes, c.u32()))
+	case immRefType:
+		add("(ref " + p.heapType(wasm.ValueType(c.s64())) + ")")
+	case immSelect:
+	}
+	return strings.Join(text, " "), nesting
+}
+
+// readValueType reads a value type of the code.
+func (p *printer) readValueType(c *codeReader) wasm.ValueType {
+	t, err := wasm.ReadValueType(c)
+	c.fail(err)
+	return t
+}
+
+// formatFloat returns the text of a float of the given number of bits,
+// which parseFloat parses back to the same bits.
+func formatFloat(v uint64, bits int) string {
+	mantissa := uint(52)
+	if bits == 32 {
+		mantissa = 23
+	}
+	var sign string
+	if v>>uint(bits-1) != 0 {
+		sign = "-"
+	}
+	exponent := v >> mantissa & (1<<uint(bits-1-int(mantissa)) - 1)
+	fraction := v & (1<<mantissa - 1)
+	switch {
+	case exponent == 1<<uint(bits-1-int(mantissa))-1 && fraction == 0:
+		return sign + "inf"
+	case exponent == 1<<uint(bits-1-int(mantissa))-1 && fraction == 1<<(mantissa-1):
+		return sign + "nan"
+	case exponent == 1<<uint(bits-1-int(mantissa))-1:
+		return fmt.Sprintf("%snan:0x%x", sign, fraction)
+	case bits == 32:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(v))), 'g', -1, 32)
+	}
+	return strconv.FormatFloat(math.Float64frombits(v), 'g', -1, 64)
+}
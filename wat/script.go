@@ -0,0 +1,304 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wat
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+)
+
+// Script is a script of the spec tests, in the .wast format: a sequence
+// of commands defining modules and checking their behavior.
+type Script struct {
+	Commands []Command
+}
+
+// The kinds of the commands of a script.
+const (
+	CommandModule        = "module"         // defines a module, the current one of the following commands
+	CommandRegister      = "register"       // registers a module under a name other modules import from
+	CommandAction        = "action"         // runs an action, ignoring its results
+	CommandAssertReturn  = "assert_return"  // runs an action, which must return the results
+	CommandAssertTrap    = "assert_trap"    // runs an action or instantiates a module, which must trap
+	CommandAssertInvalid = "assert_invalid" // defines a module, which must not validate
+	// defines a module, which must not be decoded
+	CommandAssertMalformed = "assert_malformed"
+	// defines a module, whose imports must not be resolved or instantiated
+	CommandAssertUnlinkable = "assert_unlinkable"
+	// runs an action, which must exhaust the resources of the VM
+	CommandAssertExhaustion = "assert_exhaustion"
+)
+
+// Command is a command of a script.
+type Command struct {
+	// Kind is the kind of the command, one of the Command constants.
+	Kind string
+	// Line is the line of the command in the script, counted from 1.
+	Line int
+	// ID is the identifier of the module defined by a module command, or
+	// of the module registered by a register command, which is the last
+	// defined one if empty.
+	ID string
+	// Name is the name a register command registers its module under.
+	Name string
+	// Module is the binary of the module of the module and assert
+	// commands, and ModuleErr the error assembling the text module of an
+	// assert_invalid or assert_malformed command, Module being nil then.
+	Module    []byte
+	ModuleErr error
+	// Action is the action of the action, assert_return, assert_trap and
+	// assert_exhaustion commands, assert_trap having either an action or
+	// a module.
+	Action *Action
+	// Results are the results of an assert_return command.
+	Results []Value
+	// Message is the message of the assert commands but assert_return.
+	Message string
+}
+
+// Action is an action of a script, either invoking an exported function
+// or getting an exported global.
+type Action struct {
+	// Invoke tells whether the action invokes a function, rather than
+	// getting a global.
+	Invoke bool
+	// ID is the identifier of the module, the last defined one if empty.
+	ID    string
+	Field string
+	Args  []Value
+}
+
+// Value is a constant of a script, an argument or the expected result of
+// an action.
+type Value struct {
+	Type wasm.ValueType
+	// Bits are the bits of the value, the low ones of a v128, whose high
+	// ones are in High. A reference is either null, wasm.NullRef, or an
+	// externref given by its number.
+	Bits, High uint64
+	// NaN is "canonical" or "arithmetic" for the f32 and f64 results
+	// which match any NaN of that kind, see the spec. LaneNaN are the
+	// ones of the lanes of a v128 result of f32x4 or f64x2 shape, if any
+	// lane is such a NaN, the bits of those lanes being zero.
+	NaN     string
+	LaneNaN []string
+}
+
+// ParseScript parses the script src. The errors of the text are returned
+// as an *Error.
+func ParseScript(src []byte) (script *Script, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			script, err = nil, e
+		}
+	}()
+
+	script = &Script{}
+	for _, n := range parseSExprs(string(src)) {
+		command := Command{Kind: n.head(), Line: n.line}
+		c := newCursor(n, 1)
+		switch n.head() {
+		case "module":
+			command.ID, command.Module = scriptModule(n)
+			c.pos = len(c.items)
+		case "register":
+			command.Name = string(scriptString(c.next()))
+			if id := c.id(); id != nil {
+				command.ID = id.atom
+			}
+		case "invoke", "get":
+			command.Kind = CommandAction
+			command.Action = scriptAction(n)
+			c.pos = len(c.items)
+		case "assert_return":
+			command.Action = scriptAction(c.next())
+			for !c.done() {
+				command.Results = append(command.Results, scriptValue(c.next(), true))
+			}
+		case "assert_trap":
+			if first := c.next(); first.is("module") {
+				_, command.Module = scriptModule(first)
+			} else {
+				command.Action = scriptAction(first)
+			}
+			command.Message = string(scriptString(c.next()))
+		case "assert_invalid", "assert_malformed":
+			command.Module, command.ModuleErr = failingModule(c.next())
+			command.Message = string(scriptString(c.next()))
+		case "assert_unlinkable":
+			_, command.Module = scriptModule(c.next())
+			command.Message = string(scriptString(c.next()))
+		case "assert_exhaustion":
+			command.Action = scriptAction(c.next())
+			command.Message = string(scriptString(c.next()))
+		default:
+			fail(n, "unknown script command %s", n)
+		}
+		c.end()
+		script.Commands = append(script.Commands, command)
+	}
+	return script, nil
+}
+
+// scriptModule returns the identifier of the module n, if any, and its
+// binary, given in the text format, or as a binary or quoted module.
+func scriptModule(n *node) (string, []byte) {
+	c := newCursor(n, 1)
+	var id string
+	if n := c.id(); n != nil {
+		id = n.atom
+	}
+	switch first := c.peek(); {
+	case first != nil && first.kind == nodeKeyword && first.atom == "binary":
+		c.next()
+		return id, (&parser{}).strings(c)
+	case first != nil && first.kind == nodeKeyword && first.atom == "quote":
+		c.next()
+		code, err := Assemble((&parser{}).strings(c))
+		if err != nil {
+			fail(n, "%v", err)
+		}
+		return id, code
+	}
+	code, err := assemble(c.items[c.pos:])
+	if err != nil {
+		fail(n, "%v", err)
+	}
+	return id, code
+}
+
+// failingModule returns the binary of the module n of an assert_invalid
+// or assert_malformed command, or the error assembling it, which is the
+// error expected from a malformed text module, or from an invalid one
+// whose text references unknown entries.
+func failingModule(n *node) (code []byte, err error) {
+	if !n.is("module") {
+		fail(n, "expected a module, got %s", n)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			code, err = nil, e
+		}
+	}()
+	_, code = scriptModule(n)
+	return code, nil
+}
+
+// scriptAction returns the action n.
+func scriptAction(n *node) *Action {
+	if !n.is("invoke") && !n.is("get") {
+		fail(n, "expected an action, got %s", n)
+	}
+	action := &Action{Invoke: n.is("invoke")}
+	c := newCursor(n, 1)
+	if id := c.id(); id != nil {
+		action.ID = id.atom
+	}
+	action.Field = (&parser{}).name(c.next())
+	for action.Invoke && !c.done() {
+		action.Args = append(action.Args, scriptValue(c.next(), false))
+	}
+	c.end()
+	return action
+}
+
+// scriptString returns the bytes of the string n.
+func scriptString(n *node) []byte {
+	if n.kind != nodeString {
+		fail(n, "expected a string, got %s", n)
+	}
+	return n.str
+}
+
+// scriptValue returns the constant n, a result matching any NaN if
+// result.
+func scriptValue(n *node, result bool) Value {
+	c := newCursor(n, 1)
+	var v Value
+	switch n.head() {
+	case "i32.const":
+		v.Type, v.Bits = wasm.ValueTypeI32, (&funcCtx{}).int(c.next(), 32)
+	case "i64.const":
+		v.Type, v.Bits = wasm.ValueTypeI64, (&funcCtx{}).int(c.next(), 64)
+	case "f32.const", "f64.const":
+		v.Type = wasm.ValueTypeF32
+		bits := 32
+		if n.is("f64.const") {
+			v.Type, bits = wasm.ValueTypeF64, 64
+		}
+		if x := c.next(); result && x.kind == nodeKeyword && (x.atom == "nan:canonical" || x.atom == "nan:arithmetic") {
+			v.NaN = x.atom[len("nan:"):]
+		} else {
+			v.Bits = parseFloat(x, bits)
+		}
+	case "v128.const":
+		v.Type = wasm.ValueTypeV128
+		if result {
+			v.LaneNaN = laneNaNs(c)
+		}
+		f := &funcCtx{out: new(bytes.Buffer)}
+		f.v128(c)
+		v.Bits = binary.LittleEndian.Uint64(f.out.Bytes())
+		v.High = binary.LittleEndian.Uint64(f.out.Bytes()[8:])
+	case "ref.null":
+		v.Type, v.Bits = (&parser{}).heapType(c.next()), uint64(wasm.NullRef)
+		if v.Type != wasm.ValueTypeFuncref && v.Type != wasm.ValueTypeExternref {
+			fail(n, "unsupported reference %s", n)
+		}
+	case "ref.extern":
+		v.Type, v.Bits = wasm.ValueTypeExternref, (&funcCtx{}).uint(c.next(), 32)
+	default:
+		fail(n, "expected a constant, got %s", n)
+	}
+	c.end()
+	return v
+}
+
+// laneNaNs returns the NaN kinds of the lanes of the v128 constant read by
+// c, if any lane is a NaN matching any NaN of a kind, those lanes being
+// replaced by zeros.
+func laneNaNs(c *cursor) []string {
+	shape := c.peek()
+	if shape == nil || shape.atom != "f32x4" && shape.atom != "f64x2" {
+		return nil
+	}
+	lanes := c.items[c.pos+1:]
+	kinds := make([]string, len(lanes))
+	found := false
+	for i, lane := range lanes {
+		if lane.kind == nodeKeyword && (lane.atom == "nan:canonical" || lane.atom == "nan:arithmetic") {
+			kinds[i] = lane.atom[len("nan:"):]
+			lanes[i] = &node{kind: nodeKeyword, line: lane.line, col: lane.col, atom: "0"}
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return kinds
+}
@@ -0,0 +1,376 @@
+// Copyright 2017~2022 The Bottos Authors
+// This file is part of the Bottos Chain library.
+// Created by Rocket Core Team of Bottos.
+
+// This program is free software: you can distribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Bottos.  If not, see <http://www.gnu.org/licenses/>.
+
+package wat
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bottos-project/bottos/vm/wasm/exec"
+	"github.com/bottos-project/bottos/vm/wasm/wasm"
+	"github.com/bottos-project/bottos/vm/wasm/wasm/leb128"
+)
+
+// TestAssembleSpec assembles the sources of the spec test modules, which
+// must give their binaries.
+func TestAssembleSpec(t *testing.T) {
+	files, err := filepath.Glob("../exec/testdata/spec/*.wast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		want, err := ioutil.ReadFile(strings.TrimSuffix(name, ".wast") + ".wasm")
+		if err != nil {
+			continue
+		}
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Assemble(src)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: the binary doesn't match %s", name, filepath.Base(strings.TrimSuffix(name, ".wast")+".wasm"))
+		}
+	}
+}
+
+// TestAssembleTestdata assembles the sources of the test modules of the
+// other packages, which must give their binaries, custom sections
+// included.
+func TestAssembleTestdata(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"../exec/testdata/*.wat", "../debuginfo/testdata/*.wat"} {
+		more, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, more...)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test module sources")
+	}
+	for _, name := range files {
+		want, err := ioutil.ReadFile(strings.TrimSuffix(name, ".wat") + ".wasm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Assemble(src)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: the binary doesn't match %s", name, filepath.Base(strings.TrimSuffix(name, ".wat")+".wasm"))
+		}
+	}
+}
+
+const testModule = `
+(module $test
+  (type $binop (func (param i32 i32) (result i32)))
+  (import "env" "add" (func $imported (type $binop)))
+  (memory (export "memory") (data "\01\02\03\04" "hi"))
+  (global $count (mut i32) (i32.const 0))
+  (table funcref (elem $add $sub))
+
+  (func $add (type $binop) (i32.add (local.get 0) (local.get 1)))
+  (func $sub (type $binop) local.get 0 local.get 1 i32.sub)
+
+  ;; 1 + 2 + ... + n, counting the calls in $count
+  (func (export "sum") (param $n i32) (result i32) (local $acc i32)
+    (global.set $count (i32.add (global.get $count) (i32.const 1)))
+    block $done
+      loop $next
+        (br_if $done (i32.eqz (local.get $n)))
+        (local.set $acc (i32.add (local.get $acc) (local.get $n)))
+        (local.set $n (i32.sub (local.get $n) (i32.const 1)))
+        br $next
+      end $next
+    end
+    local.get $acc)
+
+  (func (export "apply") (param $op i32) (param $a i32) (param $b i32) (result i32)
+    (call_indirect (type $binop) (local.get $a) (local.get $b) (local.get $op)))
+
+  (func (export "max") (param $a i32) (param $b i32) (result i32)
+    (if (result i32) (i32.gt_s (local.get $a) (local.get $b))
+      (then (local.get $a))
+      (else (local.get $b))))
+
+  (func (export "load") (param $addr i32) (result i32)
+    (i32.load16_u offset=1 (local.get $addr)))
+
+  (func (export "float") (result i64)
+    (i64.trunc_f64_s (f64.add (f64.const 0x1.8p1) (f64.const -1_000.5e-1))))
+
+  (func (export "count") (result i32) global.get $count)
+)`
+
+func TestParse(t *testing.T) {
+	module, err := Parse([]byte(testModule), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(module.Import.Entries) != 1 || module.Import.Entries[0].FieldName != "add" {
+		t.Fatalf("unexpected imports: %v", module.Import.Entries)
+	}
+	// run the module without its import, which the VM can't resolve
+	src := strings.Replace(testModule, `(import "env" "add" (func $imported (type $binop)))`, "", 1)
+	if module, err = Parse([]byte(src), nil); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := exec.NewVM(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		export string
+		args   []uint64
+		want   interface{}
+	}{
+		{"sum", []uint64{10}, uint32(55)},
+		{"sum", []uint64{0}, uint32(0)},
+		{"apply", []uint64{0, 7, 5}, uint32(12)},
+		{"apply", []uint64{1, 7, 5}, uint32(2)},
+		{"max", []uint64{3, 9}, uint32(9)},
+		{"max", []uint64{uint64(uint32(4)), uint64(0xffffffff)}, uint32(4)},
+		{"load", []uint64{0}, uint32(0x0302)},
+		{"float", nil, ^uint64(96)}, // -97
+		{"count", nil, uint32(2)},
+	} {
+		export, ok := module.Export.Entries[tc.export]
+		if !ok {
+			t.Fatalf("missing export %s", tc.export)
+		}
+		got, err := vm.ExecCode(int64(export.Index), tc.args...)
+		if err != nil {
+			t.Errorf("%s%v: %v", tc.export, tc.args, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s%v: got=%v (%T), want=%v (%T)", tc.export, tc.args, got, got, tc.want, tc.want)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src string
+		err string
+	}{
+		{"(module (func", "wat: 1:9: unclosed ("},
+		{"(module\n  (func (local.get $x)))", "wat: 2:20: unknown local $x"},
+		{"(module (func (i32.frob)))", "wat: 1:16: unknown instruction i32.frob"},
+		{"(module (func block $a end $b))", "wat: 1:28: mismatched label $b"},
+		{"(module (func (i32.const 4294967296)))", "wat: 1:26: invalid i32 4294967296"},
+		{"(module (func $f) (func $f))", "wat: 1:25: duplicate function $f"},
+		{`(module (export "x" (func 0)) (export "x" (func 0)) (func))`, `wat: 1:39: duplicate export "x"`},
+		{"(module (data \"\\q\"))", `wat: 1:16: invalid escape "\\q"`},
+		{`(module (@custom "a" (after code) ""))`, "wat: 1:22: the placement of custom sections isn't supported"},
+	} {
+		_, err := Assemble([]byte(tc.src))
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("%q: got=%v, want=%s", tc.src, err, tc.err)
+		}
+	}
+}
+
+func TestParseNumbers(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		bits int
+		want uint64
+		ok   bool
+	}{
+		{"0", 32, 0, true},
+		{"-1", 32, 0xffffffff, true},
+		{"4294967295", 32, 0xffffffff, true},
+		{"-2147483648", 32, 0x80000000, true},
+		{"-2147483649", 32, 0, false},
+		{"0x7fff_ffff", 32, 0x7fffffff, true},
+		{"1__0", 32, 0, false},
+		{"-0x8000000000000000", 64, 1 << 63, true},
+		{"+12", 64, 12, true},
+	} {
+		got, ok := parseInt(tc.s, tc.bits)
+		if ok != tc.ok || ok && got != tc.want {
+			t.Errorf("parseInt(%s, %d): got=%#x, %v, want=%#x, %v", tc.s, tc.bits, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	for _, tc := range []struct {
+		s    string
+		bits int
+		want uint64
+	}{
+		{"1.5", 32, 0x3fc00000},
+		{"-0", 32, 0x80000000},
+		{"0x1p-1", 64, 0x3fe0000000000000},
+		{"0x1.8", 64, 0x3ff8000000000000},
+		{"1_000", 64, 0x408f400000000000},
+		{"inf", 32, 0x7f800000},
+		{"-nan", 32, 0xffc00000},
+		{"nan:0x1", 64, 0x7ff0000000000001},
+	} {
+		got := parseFloat(&node{kind: nodeKeyword, atom: tc.s}, tc.bits)
+		if got != tc.want {
+			t.Errorf("parseFloat(%s, %d): got=%#x, want=%#x", tc.s, tc.bits, got, tc.want)
+		}
+	}
+}
+
+// TestPrint prints the test modules, and assembles them back, which must
+// give them minus their custom sections.
+func TestPrint(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"../wasm/testdata/*.wasm", "../exec/testdata/*.wasm", "../exec/testdata/spec/*.wasm"} {
+		more, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, more...)
+	}
+	for _, name := range files {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := wasm.ReadModule(bytes.NewReader(raw), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		text, err := Print(m)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		got, err := Assemble(text)
+		if err != nil {
+			t.Errorf("%s: assembling the text: %v", name, err)
+			continue
+		}
+		m.Other = nil
+		var want bytes.Buffer
+		if err = m.Encode(&want); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("%s: the assembled text differs from the module", name)
+		}
+	}
+}
+
+func TestPrintNames(t *testing.T) {
+	code, err := Assemble([]byte(`
+(module
+  (memory 1)
+  (func (param i32) (result i32) (local i64)
+    (if (result i32) (local.get 0)
+      (then (call 1 (i32.const 1)))
+      (else (i32.load offset=4 align=1 (i32.const 0)))))
+  (func (param i32) (result i32) (local.get 0))
+  (func (param i32) (result i32) (local.get 0))
+  (export "f" (func 0)))`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a name section naming the module, the functions and the locals of
+	// the first one, with a name that isn't an identifier, twice the same
+	// name and a mangled C++ symbol
+	var names, sub bytes.Buffer
+	writeName := func(w *bytes.Buffer, name string) {
+		leb128.WriteVarUint32(w, uint32(len(name)))
+		w.WriteString(name)
+	}
+	writeSub := func(id wasm.NameSubsection) {
+		names.WriteByte(byte(id))
+		leb128.WriteVarUint32(&names, uint32(sub.Len()))
+		names.Write(sub.Bytes())
+		sub.Reset()
+	}
+	writeName(&sub, "test")
+	writeSub(wasm.NamesModule)
+	sub.Write([]byte{3, 0})
+	writeName(&sub, "my func")
+	sub.WriteByte(1)
+	writeName(&sub, "my func")
+	sub.WriteByte(2)
+	writeName(&sub, "_Z3fooi")
+	writeSub(wasm.NamesFunctions)
+	sub.Write([]byte{1, 0, 2, 0})
+	writeName(&sub, "x")
+	sub.WriteByte(1)
+	writeName(&sub, "y")
+	writeSub(wasm.NamesLocals)
+
+	var section bytes.Buffer
+	writeName(&section, "name")
+	section.Write(names.Bytes())
+	module := bytes.NewBuffer(code)
+	module.WriteByte(byte(wasm.SectionIDCustom))
+	leb128.WriteVarUint32(module, uint32(section.Len()))
+	module.Write(section.Bytes())
+
+	m, err := wasm.ReadModule(module, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := Print(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `(module $test
+  (type (;0;) (func (param i32) (result i32)))
+  (func $my_func (type 0) (param $x i32) (result i32)
+    (local $y i64)
+    local.get $x
+    if (result i32)
+      i32.const 1
+      call $my_func_1
+    else
+      i32.const 0
+      i32.load offset=4 align=1
+    end)
+  (func $my_func_1 (type 0) (param i32) (result i32)
+    local.get 0)
+  (func $_Z3fooi (;foo(int);) (type 0) (param i32) (result i32)
+    local.get 0)
+  (memory (;0;) 1)
+  (export "f" (func $my_func))
+)
+`
+	if string(text) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", text, want)
+	}
+	if _, err := Assemble(text); err != nil {
+		t.Errorf("assembling the text: %v", err)
+	}
+}